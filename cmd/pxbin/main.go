@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"io/fs"
 	"log"
 	"net/http"
@@ -10,36 +12,168 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	pxbin "github.com/sertdev/pxbin"
 	"github.com/sertdev/pxbin/internal/api"
 	"github.com/sertdev/pxbin/internal/auth"
 	"github.com/sertdev/pxbin/internal/billing"
 	"github.com/sertdev/pxbin/internal/config"
 	"github.com/sertdev/pxbin/internal/crypto"
+	"github.com/sertdev/pxbin/internal/discovery"
+	"github.com/sertdev/pxbin/internal/events"
+	"github.com/sertdev/pxbin/internal/extension"
+	"github.com/sertdev/pxbin/internal/guardrail"
 	"github.com/sertdev/pxbin/internal/logging"
+	"github.com/sertdev/pxbin/internal/loopguard"
 	"github.com/sertdev/pxbin/internal/metrics"
+	"github.com/sertdev/pxbin/internal/policy"
 	"github.com/sertdev/pxbin/internal/proxy"
 	"github.com/sertdev/pxbin/internal/ratelimit"
+	"github.com/sertdev/pxbin/internal/redis"
 	"github.com/sertdev/pxbin/internal/resilience"
+	"github.com/sertdev/pxbin/internal/scoreboard"
+	"github.com/sertdev/pxbin/internal/seed"
 	"github.com/sertdev/pxbin/internal/server"
 	"github.com/sertdev/pxbin/internal/slogger"
 	"github.com/sertdev/pxbin/internal/store"
+	"github.com/sertdev/pxbin/internal/streamtap"
+	"github.com/sertdev/pxbin/internal/tracing"
+	"github.com/sertdev/pxbin/internal/traffic"
+	"github.com/sertdev/pxbin/internal/warmup"
 )
 
+// command is what pxbin was asked to do on the command line.
+type command struct {
+	name      string             // "serve", "migrate" or "replay"
+	ephemeral bool               // serve --ephemeral
+	to        int                // migrate --to; -1 for the latest version
+	file      string             // replay --file
+	replay    traffic.ReplayOpts // replay --target, --key and --speed
+}
+
+const usage = "usage: pxbin [serve] [--ephemeral] | pxbin migrate [--to N] | pxbin replay --file F --target URL [--key K] [--speed N]"
+
+// parseArgs parses `pxbin [serve] [--ephemeral]`, `pxbin migrate [--to N]`
+// and `pxbin replay --file F --target URL [--key K] [--speed N]`. serve is
+// the default command.
+func parseArgs(args []string) command {
+	cmd := command{name: "serve", to: -1}
+	if len(args) > 0 && (args[0] == "serve" || args[0] == "migrate" || args[0] == "replay") {
+		cmd.name, args = args[0], args[1:]
+	}
+	flags := flag.NewFlagSet("pxbin "+cmd.name, flag.ExitOnError)
+	switch cmd.name {
+	case "migrate":
+		flags.IntVar(&cmd.to, "to", -1, "schema version to migrate to, reverting newer migrations; the latest if unset")
+	case "replay":
+		flags.StringVar(&cmd.file, "file", "", "traffic capture file written with traffic_capture_file")
+		flags.StringVar(&cmd.replay.Target, "target", "", "base URL of the pxbin instance to replay against")
+		flags.StringVar(&cmd.replay.Key, "key", os.Getenv("PXBIN_REPLAY_KEY"), "LLM key to send the requests with (default $PXBIN_REPLAY_KEY)")
+		flags.Float64Var(&cmd.replay.Speed, "speed", 1, "how many times faster than captured to replay")
+	default:
+		flags.BoolVar(&cmd.ephemeral, "ephemeral", false, "keep all state in memory instead of PostgreSQL; it is lost on exit")
+	}
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		log.Fatalf("unknown command %q (%s)", flags.Arg(0), usage)
+	}
+	return cmd
+}
+
+// migrate brings the database schema to version to, or the latest version
+// if to is -1, and logs the resulting status. It runs instead of the server.
+func migrate(cfg *config.Config, to int) {
+	if cfg.Ephemeral {
+		log.Fatalf("pxbin migrate needs a database; ephemeral mode has no schema")
+	}
+	ctx := context.Background()
+	pool, err := store.NewPool(ctx, cfg.DatabaseURL, cfg.DatabaseSchema, 1, 1)
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	defer pool.Close()
+
+	pg := store.New(pool)
+	if to < 0 {
+		err = pg.Migrate(ctx)
+	} else {
+		err = pg.MigrateTo(ctx, to)
+	}
+	if err != nil {
+		log.Fatalf("failed to run migrations: %v", err)
+	}
+	status, err := pg.MigrationStatus(ctx)
+	if err != nil {
+		log.Fatalf("failed to read migration status: %v", err)
+	}
+	log.Printf("schema version %d (latest %d), %d migrations pending", status.Version, status.Latest, len(status.Pending))
+}
+
+// replay sends synthetic requests shaped like the captured ones to another
+// instance and prints how it coped. It runs instead of the server and needs
+// no config; an interrupt stops sending and reports what was sent.
+func replay(file string, opts traffic.ReplayOpts) {
+	if file == "" || opts.Target == "" {
+		log.Fatalf("pxbin replay needs --file and --target (%s)", usage)
+	}
+	records, err := traffic.ReadRecords(file)
+	if err != nil {
+		log.Fatalf("failed to read traffic capture: %v", err)
+	}
+	if len(records) == 0 {
+		log.Fatalf("traffic capture %s is empty", file)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	span := records[len(records)-1].Time.Sub(records[0].Time)
+	log.Printf("replaying %d requests spanning %s against %s", len(records), span.Round(time.Second), opts.Target)
+	fmt.Print(traffic.Replay(ctx, records, opts))
+}
+
 func main() {
-	// 1. Load config
+	// 1. Run `pxbin replay` if that was asked for; it needs no config. Load
+	// config otherwise; --ephemeral overrides the config file
+	cmd := parseArgs(os.Args[1:])
+	if cmd.name == "replay" {
+		replay(cmd.file, cmd.replay)
+		return
+	}
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	if cmd.ephemeral {
+		cfg.Ephemeral = true
+	}
 
-	// 2. Validate config
+	// 2. Validate config, then run `pxbin migrate` instead of the server if
+	// that was asked for
 	if err := config.Validate(cfg); err != nil {
 		log.Fatalf("config validation failed: %v", err)
 	}
+	if cmd.name == "migrate" {
+		migrate(cfg, cmd.to)
+		return
+	}
 
-	// 3. Setup structured logging
+	// 3. Setup structured logging, and tracing of proxy requests if an OTLP
+	// endpoint is configured
 	slogger.Setup(cfg.LogFormat)
+	if cfg.TracingEndpoint != "" {
+		shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracingEndpoint, cfg.TracingServiceName, cfg.TracingSampleRatio)
+		if err != nil {
+			log.Fatalf("failed to set up tracing: %v", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				log.Printf("tracing shutdown: %v", err)
+			}
+		}()
+	}
 
 	// 4. Derive encryption key (if set)
 	var encryptionKey []byte
@@ -47,24 +181,58 @@ func main() {
 		encryptionKey = crypto.DeriveKey(cfg.EncryptionKey)
 	}
 
-	// 5. Initialize database connection pool with configurable sizes
-	pool, err := store.NewPool(context.Background(), cfg.DatabaseURL, cfg.DatabaseSchema, cfg.MaxDBConns, cfg.MinDBConns)
-	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
-	}
-	defer pool.Close()
-
-	// 6. Initialize store (with encryption if key is set)
-	var st *store.Store
-	if encryptionKey != nil {
-		st = store.NewWithEncryption(pool, encryptionKey)
+	// 5-6. Initialize the store: in memory when ephemeral, with a generated
+	// management key since nothing persists; otherwise PostgreSQL, with a
+	// connection pool logging queries slower than slow_query_ms, encryption
+	// if a key is set, and migrations
+	var st store.Store
+	var pool *pgxpool.Pool
+	var slowQueries *store.SlowQueryTracer
+	if cfg.Ephemeral {
+		st = store.NewMemory()
+		key, hash, prefix := auth.GenerateManagementKey()
+		if _, err := st.CreateManagementKey(context.Background(), hash, prefix, "ephemeral", []string{"read", "write"}); err != nil {
+			log.Fatalf("failed to create management key: %v", err)
+		}
+		log.Printf("ephemeral mode: all state is kept in memory and lost on exit")
+		log.Printf("ephemeral mode: management key %s", key)
 	} else {
-		st = store.New(pool)
+		var tracer pgx.QueryTracer
+		if cfg.SlowQueryMS > 0 {
+			slowQueries = store.NewSlowQueryTracer(time.Duration(cfg.SlowQueryMS) * time.Millisecond)
+			tracer = slowQueries
+		}
+		pool, err = store.NewPoolWithTracer(context.Background(), cfg.DatabaseURL, cfg.DatabaseSchema, cfg.MaxDBConns, cfg.MinDBConns, tracer)
+		if err != nil {
+			log.Fatalf("failed to connect to database: %v", err)
+		}
+		defer pool.Close()
+
+		var pg *store.Postgres
+		if encryptionKey != nil {
+			pg = store.NewWithEncryption(pool, encryptionKey)
+		} else {
+			pg = store.New(pool)
+		}
+		if err := pg.Migrate(context.Background()); err != nil {
+			log.Fatalf("failed to run migrations: %v", err)
+		}
+		st = pg
 	}
 
-	// 7. Run migrations
-	if err := st.Migrate(context.Background()); err != nil {
-		log.Fatalf("failed to run migrations: %v", err)
+	// 7. Create what the seed file declares
+	if cfg.SeedFile != "" {
+		seedFile, err := seed.Load(cfg.SeedFile)
+		if err != nil {
+			log.Fatalf("failed to load seed file: %v", err)
+		}
+		n, err := seed.Apply(context.Background(), st, seedFile)
+		if err != nil {
+			log.Fatalf("failed to apply seed file: %v", err)
+		}
+		if n > 0 {
+			log.Printf("seed file: created %d entries", n)
+		}
 	}
 
 	// 8. Initialize billing tracker
@@ -72,14 +240,24 @@ func main() {
 	defer billingTracker.Close()
 
 	// 9. Initialize async logger
-	asyncLogger := logging.NewAsyncLogger(st, cfg.LogBufferSize)
+	asyncLogger, err := logging.NewAsyncLoggerWithOpts(st, logging.AsyncLoggerOpts{
+		BufferSize:     cfg.LogBufferSize,
+		OverflowPolicy: logging.OverflowPolicy(cfg.LogOverflowPolicy),
+		BlockTimeout:   time.Duration(cfg.LogBlockTimeoutMS) * time.Millisecond,
+		SpillDir:       cfg.LogSpillDir,
+		SampleRate:     cfg.LogSampleRate,
+	})
+	if err != nil {
+		log.Fatalf("failed to initialize async logger: %v", err)
+	}
 	defer asyncLogger.Close()
 
-	// 10. Initialize log retention cleaner
-	logCleaner := logging.NewLogCleaner(st, cfg.LogRetentionDays)
+	// 10. Initialize log retention cleaner (request and management access logs)
+	logCleaner := logging.NewLogCleaner(st, cfg.LogRetentionDays, cfg.AccessLogRetentionDays, cfg.PayloadRetentionDays, cfg.AuditRetentionDays)
 	defer logCleaner.Close()
 
-	// 11. Initialize metrics (if enabled)
+	// 11. Initialize metrics (if enabled), and the bus publishing key
+	// lifecycle and budget events to metrics, the webhook and the log
 	var m *metrics.Metrics
 	var metricsMiddleware func(http.Handler) http.Handler
 	var metricsHandler http.Handler
@@ -88,20 +266,56 @@ func main() {
 		metricsMiddleware = metrics.Middleware(m)
 		metricsHandler = m.Handler()
 		asyncLogger.SetDroppedCounter(m.DroppedLogsTotal)
+		if pool != nil {
+			m.RegisterPool(pool)
+		}
+		if slowQueries != nil {
+			slowQueries.SetCounter(m.SlowQueriesTotal)
+		}
 	}
+	var eventConsumers []events.Consumer
+	if m != nil {
+		eventConsumers = append(eventConsumers, events.ConsumerFunc(func(e events.Event) {
+			m.KeyEventsTotal.WithLabelValues(string(e.Type)).Inc()
+		}))
+	}
+	if cfg.EventWebhookURL != "" {
+		eventConsumers = append(eventConsumers, events.NewWebhookSink(cfg.EventWebhookURL, cfg.EventWebhookSecret))
+	}
+	if cfg.EventLog {
+		eventConsumers = append(eventConsumers, events.LogSink{})
+	}
+	eventBus := events.NewBus(0, eventConsumers...)
+	defer eventBus.Close()
+	billingTracker.SetEvents(eventBus)
 
-	// 12. Initialize rate limiter (if configured)
-	var rateLimiter *ratelimit.Limiter
+	// 12. Initialize rate limiter (if configured), with buckets shared
+	// through Redis for rate_limit_backend redis. It gets its own connection
+	// since every proxy request goes through it.
+	var rateLimiter ratelimit.Limiter
 	if cfg.RateLimitRPS > 0 {
 		burst := cfg.RateLimitBurst
 		if burst <= 0 {
 			burst = int(cfg.RateLimitRPS * 2) // default burst = 2x RPS
 		}
-		rateLimiter = ratelimit.NewLimiter(cfg.RateLimitRPS, burst)
+		if cfg.RateLimitBackend == "redis" {
+			redisClient, err := redis.NewClient(cfg.RedisURL)
+			if err != nil {
+				log.Fatalf("invalid redis_url: %v", err)
+			}
+			defer redisClient.Close()
+			rateLimiter = ratelimit.NewRedisLimiter(redisClient, cfg.RateLimitRPS, burst)
+		} else {
+			rateLimiter = ratelimit.NewMemoryLimiter(cfg.RateLimitRPS, burst)
+		}
 		defer rateLimiter.Close()
+		if m != nil {
+			m.RegisterRateLimiter(rateLimiter)
+		}
 	}
 
-	// 13. Initialize upstream options (circuit breaker + retry)
+	// 13. Initialize upstream options (circuit breaker + retry). Upstreams'
+	// resilience policies override them.
 	var upstreamOpts *proxy.UpstreamOpts
 	if cfg.CBFailureThreshold > 0 || cfg.RetryMaxAttempts > 1 {
 		upstreamOpts = &proxy.UpstreamOpts{
@@ -110,38 +324,151 @@ func main() {
 				Timeout:   time.Duration(cfg.CBTimeoutSeconds) * time.Second,
 			},
 			RetryOpts: resilience.RetryOpts{
-				MaxAttempts: cfg.RetryMaxAttempts,
-				BaseDelay:   time.Duration(cfg.RetryBaseDelayMS) * time.Millisecond,
+				MaxAttempts:   cfg.RetryMaxAttempts,
+				BaseDelay:     time.Duration(cfg.RetryBaseDelayMS) * time.Millisecond,
+				MaxRetryAfter: time.Duration(cfg.RetryAfterMaxSeconds) * time.Second,
 			},
+			RetryStatusCodes: cfg.RetryStatusCodes,
+			RetryBudgetRatio: cfg.RetryBudgetRatio,
 		}
 	}
 
 	// 14. Initialize client cache with resilience options
 	clientCache := proxy.NewClientCache(upstreamOpts)
 
-	// 15. Initialize model resolution cache (60s TTL)
+	// 15. Initialize model resolution cache (60s TTL). With the startup
+	// warmup enabled it is loaded in the background instead.
 	modelCache := proxy.NewModelCache(st, 60*time.Second)
-	if err := modelCache.Warm(context.Background()); err != nil {
-		log.Printf("model cache warmup failed: %v", err)
+	if !cfg.WarmupEnabled {
+		if err := modelCache.Warm(context.Background()); err != nil {
+			log.Printf("model cache warmup failed: %v", err)
+		}
 	}
 
-	// 16. Initialize proxy handler
+	// 16. Initialize proxy handler with admission policies and router models
+	// (reloaded every 15s), the upstream scoreboard, restored from its last
+	// save, and upstream pins and guardrails (reloaded every 15s and on
+	// changes)
 	proxyHandler := proxy.NewHandler(clientCache, modelCache, st, asyncLogger, billingTracker)
+	policyEngine := policy.NewEngine(st, 15*time.Second)
+	defer policyEngine.Close()
+	proxyHandler.SetPolicyEngine(policyEngine)
+	modelRouters := proxy.NewRouters(st, 15*time.Second)
+	defer modelRouters.Close()
+	proxyHandler.SetRouters(modelRouters)
+	proxyHandler.SetDefaultMaxTokens(cfg.DefaultMaxTokens)
+	proxyHandler.SetMaxSSEFrameSize(cfg.MaxSSEFrameBytes)
+	proxyHandler.SetSSEOptions(time.Duration(cfg.SSERetryMS)*time.Millisecond, time.Duration(cfg.SSECommentIntervalSeconds)*time.Second)
+	proxyHandler.SetStreamIdleTimeout(time.Duration(cfg.StreamIdleTimeoutSeconds) * time.Second)
+	upstreamScores := scoreboard.New(st, time.Duration(cfg.UpstreamScoreSaveSeconds)*time.Second)
+	defer upstreamScores.Close()
+	if err := upstreamScores.Load(context.Background()); err != nil {
+		log.Printf("upstream scoreboard load failed: %v", err)
+	}
+	proxyHandler.SetScoreboard(upstreamScores)
+	if m != nil {
+		proxyHandler.SetTransportErrorCounter(m.NewTransportErrorCounter())
+		proxyHandler.SetUpstreamObserver(m)
+		m.RegisterCircuitBreakers(proxyHandler.CircuitBreakerStates)
+	}
+	upstreamPins := proxy.NewPins(st, 15*time.Second)
+	defer upstreamPins.Close()
+	proxyHandler.SetPins(upstreamPins)
+	proxyHandler.SetImageLimits(proxy.ImageLimits{
+		MaxBytes:     cfg.ImageMaxBytes,
+		MaxDimension: cfg.ImageMaxDimension,
+		Downscale:    cfg.ImageDownscale,
+		JPEGQuality:  cfg.ImageJPEGQuality,
+	})
+	proxyHandler.SetPayloadCapture(proxy.PayloadCaptureOpts{
+		All:      cfg.PayloadCaptureAll,
+		MaxBytes: cfg.PayloadCaptureMaxBytes,
+		Redact:   cfg.PayloadCaptureRedact,
+	})
+	auditSampler := proxy.NewAuditSampler(st, 15*time.Second, proxy.AuditOpts{
+		DefaultPercent: cfg.AuditSamplePercent,
+		MaxBytes:       cfg.AuditCaptureMaxBytes,
+	})
+	defer auditSampler.Close()
+	proxyHandler.SetAuditSampler(auditSampler)
+	proxyHandler.SetMetadataOptions(cfg.MetadataMap, cfg.LogMetadataKeys)
+	guardrails := guardrail.NewEngine(st, 15*time.Second)
+	defer guardrails.Close()
+	proxyHandler.SetGuardrails(guardrails)
+	if cfg.ExtensionsDir != "" {
+		if fi, err := os.Stat(cfg.ExtensionsDir); err != nil || !fi.IsDir() {
+			log.Fatalf("extensions_dir %q is not a directory", cfg.ExtensionsDir)
+		}
+		extRuntime, err := extension.NewRuntime(context.Background(), cfg.ExtensionsDir)
+		if err != nil {
+			log.Fatalf("failed to initialize extensions: %v", err)
+		}
+		defer extRuntime.Close(context.Background())
+		proxyHandler.SetExtensions(extRuntime)
+	}
 
-	// 17. Initialize auth key cache and last-used tracker
+	// 17. Initialize auth key cache, last-used tracker and the tarpit for
+	// repeated invalid keys (shared through Redis when configured)
 	keyCache := auth.NewKeyCache(st, 60*time.Second)
+	keyCache.SetMaxStale(time.Duration(cfg.KeyMaxStaleSeconds) * time.Second)
 	lastUsedTracker := auth.NewLastUsedTracker(st)
 	defer lastUsedTracker.Close()
+	var tarpit *auth.Tarpit
+	if cfg.AuthFailBaseDelayMS > 0 || cfg.AuthFailBanThreshold > 0 {
+		var failures auth.FailureStore
+		if cfg.RedisURL != "" {
+			redisClient, err := redis.NewClient(cfg.RedisURL)
+			if err != nil {
+				log.Fatalf("invalid redis_url: %v", err)
+			}
+			defer redisClient.Close()
+			failures = auth.NewRedisFailureStore(redisClient)
+		} else {
+			memFailures := auth.NewMemoryFailureStore()
+			defer memFailures.Close()
+			failures = memFailures
+		}
+		tarpit = auth.NewTarpit(failures, auth.TarpitOpts{
+			BaseDelay:         time.Duration(cfg.AuthFailBaseDelayMS) * time.Millisecond,
+			MaxDelay:          time.Duration(cfg.AuthFailMaxDelayMS) * time.Millisecond,
+			BanThreshold:      cfg.AuthFailBanThreshold,
+			Window:            time.Duration(cfg.AuthFailWindowSeconds) * time.Second,
+			BanDuration:       time.Duration(cfg.AuthFailBanSeconds) * time.Second,
+			TrustForwardedFor: cfg.TrustForwardedFor,
+		})
+	}
 
-	// 18. Initialize auth middleware functions
-	llmAuth := auth.LLMAuthMiddleware(keyCache, lastUsedTracker)
-	mgmtAuth := auth.ManagementAuthMiddleware(st)
+	// 18. Initialize auth middleware functions, with the tarpit and spend
+	// budgets for LLM keys; management API calls, including failed
+	// authentications, go to the access log
+	llmAuth := auth.LLMAuthMiddlewareWithOpts(keyCache, lastUsedTracker, auth.LLMAuthOpts{Tarpit: tarpit, Budgets: billingTracker})
+	accessLogger := logging.NewAccessLogger(st, cfg.TrustForwardedFor)
+	defer accessLogger.Close()
+	mgmtAuth := accessLogger.Wrap(auth.ManagementAuthMiddleware(st))
 
-	// 19. Initialize management API router
-	mgmtRouter := api.NewRouter(st, mgmtAuth, billingTracker)
+	// 19. Initialize management API router, with signed log links when
+	// log_share_secret is set and the model discovery sync (periodic when
+	// model_sync_seconds is set), the drain toggle shared with the server,
+	// the upstream scoreboard and the upstream pins
+	logSigner := api.NewLogSigner(cfg.LogShareSecret, time.Duration(cfg.LogShareMaxTTLSeconds)*time.Second)
+	modelSyncer := discovery.NewSyncer(st, billingTracker, time.Duration(cfg.ModelSyncSeconds)*time.Second)
+	defer modelSyncer.Close()
+	drain := server.NewDrain()
+	streamTaps := streamtap.New()
+	mgmtRouter := api.NewRouter(st, mgmtAuth, billingTracker, tarpit, logSigner, rateLimiter, modelSyncer, drain, streamTaps, upstreamScores, upstreamPins, auditSampler, guardrails, loopguard.NewSelf(cfg.ListenAddr, cfg.AdvertisedHosts), cfg.SCIMKeyMetadata, cfg.SeedFile, eventBus)
 
 	// 20. Initialize bootstrap handler (nil if no bootstrap key configured)
+	// and the anonymized usage report (nil unless public_usage_enabled is set)
 	bootstrapHandler := api.NewBootstrapHandler(st, cfg.ManagementBootstrapKey)
+	publicUsage := api.NewPublicUsageHandler(st, api.PublicUsageOpts{
+		Enabled:       cfg.PublicUsageEnabled,
+		Days:          cfg.PublicUsageDays,
+		Epsilon:       cfg.PublicUsageEpsilon,
+		RoundRequests: cfg.PublicUsageRoundRequests,
+		RoundTokens:   cfg.PublicUsageRoundTokens,
+		MinKeys:       cfg.PublicUsageMinKeys,
+		NoiseSecret:   cfg.PublicUsageNoiseSecret,
+	})
 
 	// 21. Strip "frontend/dist" prefix from embedded FS
 	frontendFS, err := fs.Sub(pxbin.FrontendDist, "frontend/dist")
@@ -154,7 +481,43 @@ func main() {
 		RateLimiter:       rateLimiter,
 		MetricsMiddleware: metricsMiddleware,
 		MetricsHandler:    metricsHandler,
-		Pool:              pool,
+		DB:                server.PingFunc(st.Health),
+		Logs:              asyncLogger,
+		OpenAPI:           api.OpenAPIHandler(mgmtRouter),
+		SharedLogs:        api.NewSharedLogHandler(st, logSigner),
+		PublicUsage:       publicUsage,
+		Drain:             drain,
+		MaxHops:           cfg.MaxProxyHops,
+		Tracing:           cfg.TracingEndpoint != "",
+		PayloadCapture:    proxyHandler.CapturePayloads,
+		StreamTap:         streamTaps.Middleware,
+	}
+	if cfg.TrafficCaptureFile != "" {
+		recorder, err := traffic.NewRecorder(cfg.TrafficCaptureFile)
+		if err != nil {
+			log.Fatalf("failed to open traffic capture file: %v", err)
+		}
+		defer recorder.Close()
+		serverOpts.TrafficCapture = recorder.Middleware
+		log.Printf("recording request shapes to %s", cfg.TrafficCaptureFile)
+	}
+	if cfg.SelfServiceEnabled {
+		// Without budgets, so that keys over their budget can still see it
+		selfAuth := auth.LLMAuthMiddlewareWithOpts(keyCache, lastUsedTracker, auth.LLMAuthOpts{Tarpit: tarpit})
+		serverOpts.Self = api.NewSelfRouter(st, billingTracker, selfAuth)
+	}
+	if cfg.StreamResumeTTLSeconds > 0 {
+		serverOpts.StreamResume = proxy.NewStreamResumer(time.Duration(cfg.StreamResumeTTLSeconds) * time.Second).Middleware
+	}
+	if cfg.WarmupEnabled {
+		serverOpts.Warmup = warmup.Start(warmup.Opts{
+			Store:   st,
+			Models:  modelCache,
+			Keys:    keyCache,
+			Proxy:   proxyHandler,
+			Probe:   cfg.WarmupProbeUpstreams,
+			Timeout: time.Duration(cfg.WarmupTimeoutSeconds) * time.Second,
+		})
 	}
 	router := server.New(cfg, proxyHandler, llmAuth, mgmtRouter, bootstrapHandler, frontendFS, serverOpts)
 
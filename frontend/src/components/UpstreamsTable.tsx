@@ -93,6 +93,7 @@ function EditUpstreamDialog({ upstream, onClose }: { upstream: Upstream; onClose
             >
               <option value="openai">OpenAI Compatible</option>
               <option value="anthropic">Native Anthropic</option>
+              <option value="vertex">Google Vertex AI</option>
             </select>
           </div>
           <div>
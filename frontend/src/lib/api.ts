@@ -13,12 +13,32 @@ function getAuthToken(): string | null {
   return localStorage.getItem("pxbin_api_key");
 }
 
+interface FieldError {
+  field: string;
+  message: string;
+}
+
 class ApiError extends Error {
   status: number;
-  constructor(status: number, message: string) {
+  code: string;
+  fields: FieldError[];
+  constructor(status: number, message: string, code = "", fields: FieldError[] = []) {
     super(message);
     this.name = "ApiError";
     this.status = status;
+    this.code = code;
+    this.fields = fields;
+  }
+}
+
+// apiError reads the management API's error envelope from a failed response.
+async function apiError(res: Response): Promise<ApiError> {
+  const body = await res.text().catch(() => "Unknown error");
+  try {
+    const { error } = JSON.parse(body) as { error: { code: string; message: string; fields?: FieldError[] } };
+    return new ApiError(res.status, error.message, error.code, error.fields ?? []);
+  } catch {
+    return new ApiError(res.status, body);
   }
 }
 
@@ -44,12 +64,11 @@ async function apiFetch<T>(path: string, options?: RequestInit): Promise<T> {
   const res = await fetch(`/api/v1${path}`, { ...options, headers });
 
   if (!res.ok) {
-    const body = await res.text().catch(() => "Unknown error");
     if (res.status === 401) {
       localStorage.removeItem("pxbin_api_key");
       window.location.href = "/login";
     }
-    throw new ApiError(res.status, body);
+    throw await apiError(res);
   }
 
   const json = (await res.json()) as ApiResponse<T>;
@@ -69,12 +88,11 @@ async function apiFetchPaginated<T>(path: string, options?: RequestInit): Promis
   const res = await fetch(`/api/v1${path}`, { ...options, headers });
 
   if (!res.ok) {
-    const body = await res.text().catch(() => "Unknown error");
     if (res.status === 401) {
       localStorage.removeItem("pxbin_api_key");
       window.location.href = "/login";
     }
-    throw new ApiError(res.status, body);
+    throw await apiError(res);
   }
 
   const json = (await res.json()) as ApiResponse<T[]>;
@@ -73,7 +73,7 @@ export interface RequestLog {
   method: string;
   path: string;
   model: string | null;
-  input_format: "anthropic" | "openai";
+  input_format: "anthropic" | "openai" | "gemini";
   upstream_id: string | null;
   status_code: number | null;
   latency_ms: number | null;
@@ -11,6 +11,7 @@ const FORMAT_OPTIONS = [
   { label: "All Formats", value: "" },
   { label: "Anthropic", value: "anthropic" },
   { label: "OpenAI", value: "openai" },
+  { label: "Gemini", value: "gemini" },
 ];
 
 const STATUS_OPTIONS = [
@@ -131,6 +131,7 @@ function CreateUpstreamDialog({ onClose }: { onClose: () => void }) {
             >
               <option value="openai">OpenAI Compatible</option>
               <option value="anthropic">Native Anthropic</option>
+              <option value="vertex">Google Vertex AI</option>
             </select>
           </div>
           <div>
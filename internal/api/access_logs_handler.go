@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+type accessLogsHandler struct {
+	store store.Store
+}
+
+func (h *accessLogsHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := store.AccessLogFilter{
+		Page:    queryInt(r, "page", 1),
+		PerPage: queryInt(r, "per_page", 50),
+	}
+
+	if v := q.Get("key_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "Invalid key_id format")
+			return
+		}
+		filter.ManagementKeyID = &id
+	}
+	if v := q.Get("unauthenticated"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "Invalid unauthenticated, use true or false")
+			return
+		}
+		filter.Unauthenticated = b
+	}
+	if v := q.Get("status_code"); v != "" {
+		code, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "Invalid status_code")
+			return
+		}
+		filter.StatusCode = &code
+	}
+	if v := q.Get("client_ip"); v != "" {
+		filter.ClientIP = &v
+	}
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "Invalid 'from' timestamp, use RFC3339")
+			return
+		}
+		filter.DateFrom = &t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "Invalid 'to' timestamp, use RFC3339")
+			return
+		}
+		filter.DateTo = &t
+	}
+
+	logs, total, err := h.store.ListAccessLogs(r.Context(), filter)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list access logs")
+		return
+	}
+
+	writeDataPaginated(w, logs, total, filter.Page, filter.PerPage)
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// auditPermission is the management key permission needed to read audit
+// samples, which hold unredacted prompts and completions.
+const auditPermission = "audit"
+
+// AuditReloader applies audit rule changes to the proxy without waiting for
+// its periodic reload.
+type AuditReloader interface {
+	Reload(ctx context.Context) error
+}
+
+type auditHandler struct {
+	store store.Store
+	rules AuditReloader // nil when the proxy only picks up rules periodically
+}
+
+// ListRules returns the audit sampling rules.
+func (h *auditHandler) ListRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.store.ListAuditRules(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list audit rules")
+		return
+	}
+	writeData(w, rules)
+}
+
+// SetRule samples a share of the requests of a key, a model or both,
+// replacing the rule for the same key and model.
+func (h *auditHandler) SetRule(w http.ResponseWriter, r *http.Request) {
+	var req store.AuditRuleCreate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+	req.Model = strings.TrimSpace(req.Model)
+	var errs fieldErrors
+	if req.Percent < 0 || req.Percent > 100 {
+		errs.add("percent", "must be between 0 and 100")
+	}
+	if req.KeyID == nil && req.Model == "" {
+		errs.add("llm_key_id", "or model is required; use audit_sample_percent to sample every request")
+	}
+	if errs.write(w, r) {
+		return
+	}
+	if req.KeyID != nil {
+		key, err := h.store.GetLLMKey(r.Context(), *req.KeyID)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch key")
+			return
+		}
+		if key == nil {
+			writeFieldError(w, r, "llm_key_id", "must name an LLM key")
+			return
+		}
+	}
+
+	rule, err := h.store.SetAuditRule(r.Context(), &req)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to set audit rule")
+		return
+	}
+	reloadNow(r.Context(), h.rules, "audit rules")
+
+	writeData(w, rule)
+}
+
+// DeleteRule stops a rule's sampling. The samples it took are kept.
+func (h *auditHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+
+	ok, err := h.store.DeleteAuditRule(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to delete audit rule")
+		return
+	}
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "not_found", "Audit rule not found")
+		return
+	}
+	reloadNow(r.Context(), h.rules, "audit rules")
+
+	writeData(w, statusResponse{Status: "deleted"})
+}
+
+// ListSamples returns audit samples newest first, without their bodies.
+func (h *auditHandler) ListSamples(w http.ResponseWriter, r *http.Request) {
+	if !checkAuditPermission(w, r) {
+		return
+	}
+	q := r.URL.Query()
+	var filter store.AuditSampleFilter
+	for _, f := range []struct {
+		name string
+		dst  **uuid.UUID
+	}{{"key_id", &filter.KeyID}, {"rule_id", &filter.RuleID}} {
+		if v := q.Get(f.name); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				writeFieldError(w, r, f.name, "must be a UUID")
+				return
+			}
+			*f.dst = &id
+		}
+	}
+	if v := q.Get("model"); v != "" {
+		filter.Model = &v
+	}
+	for _, f := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &filter.DateFrom}, {"to", &filter.DateTo}} {
+		if v := q.Get(f.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeFieldError(w, r, f.name, "must be an RFC 3339 timestamp")
+				return
+			}
+			*f.dst = &t
+		}
+	}
+	filter.Page = queryInt(r, "page", 1)
+	filter.PerPage = queryInt(r, "per_page", 50)
+
+	samples, total, err := h.store.ListAuditSamples(r.Context(), filter)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list audit samples")
+		return
+	}
+	writeDataPaginated(w, samples, total, filter.Page, filter.PerPage)
+}
+
+// auditSampleResponse is a sample with everyone who has read it.
+type auditSampleResponse struct {
+	store.AuditSample
+	Views []store.AuditSampleView `json:"views"`
+}
+
+// GetSample returns a sample with its bodies, and records that the caller's
+// key read it.
+func (h *auditHandler) GetSample(w http.ResponseWriter, r *http.Request) {
+	if !checkAuditPermission(w, r) {
+		return
+	}
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+
+	sample, views, err := h.store.ViewAuditSample(r.Context(), id, auth.GetManagementKeyIDFromContext(r.Context()))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get audit sample")
+		return
+	}
+	if sample == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Audit sample not found")
+		return
+	}
+	writeData(w, auditSampleResponse{AuditSample: *sample, Views: views})
+}
+
+// checkAuditPermission writes a 403 and returns false unless the caller's
+// management key has the audit permission, which unredacted request
+// content needs.
+func checkAuditPermission(w http.ResponseWriter, r *http.Request) bool {
+	key := auth.GetManagementKeyFromContext(r.Context())
+	if key == nil || !slices.Contains(key.Permissions, auditPermission) {
+		writeErrorCode(w, r, http.StatusForbidden, "permission_error", "audit_permission_required",
+			"Reading audit samples or unmasked streams needs a management key with the audit permission")
+		return false
+	}
+	return true
+}
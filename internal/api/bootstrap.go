@@ -13,7 +13,7 @@ import (
 // NewBootstrapHandler returns an http.HandlerFunc that creates API keys
 // when authenticated with the bootstrap key. Returns nil if bootstrapKey
 // is empty (disabled).
-func NewBootstrapHandler(s *store.Store, bootstrapKey string) http.HandlerFunc {
+func NewBootstrapHandler(s store.Store, bootstrapKey string) http.HandlerFunc {
 	if bootstrapKey == "" {
 		return nil
 	}
@@ -28,13 +28,13 @@ func NewBootstrapHandler(s *store.Store, bootstrapKey string) http.HandlerFunc {
 		}
 
 		if subtle.ConstantTimeCompare([]byte(key), []byte(bootstrapKey)) != 1 {
-			writeError(w, http.StatusUnauthorized, "authentication_error", "Invalid bootstrap key")
+			writeError(w, r, http.StatusUnauthorized, "authentication_error", "Invalid bootstrap key")
 			return
 		}
 
 		var req createKeyRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+			writeInvalidJSON(w, r)
 			return
 		}
 
@@ -47,7 +47,7 @@ func NewBootstrapHandler(s *store.Store, bootstrapKey string) http.HandlerFunc {
 			}
 			record, err := s.CreateManagementKey(r.Context(), hash, prefix, req.Name, perms)
 			if err != nil {
-				writeError(w, http.StatusInternalServerError, "server_error", "Failed to create key")
+				writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to create key")
 				return
 			}
 			writeJSON(w, http.StatusCreated, response{Data: createKeyResponse{
@@ -60,7 +60,7 @@ func NewBootstrapHandler(s *store.Store, bootstrapKey string) http.HandlerFunc {
 			plaintext, hash, prefix := auth.GenerateLLMKey()
 			record, err := s.CreateLLMKey(r.Context(), hash, prefix, req.Name, req.RateLimit)
 			if err != nil {
-				writeError(w, http.StatusInternalServerError, "server_error", "Failed to create key")
+				writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to create key")
 				return
 			}
 			writeJSON(w, http.StatusCreated, response{Data: createKeyResponse{
@@ -70,7 +70,7 @@ func NewBootstrapHandler(s *store.Store, bootstrapKey string) http.HandlerFunc {
 				CreatedAt: record.CreatedAt.Format("2006-01-02T15:04:05Z"),
 			}})
 		default:
-			writeError(w, http.StatusBadRequest, "invalid_request", "Invalid key type, must be 'llm' or 'management'")
+			writeFieldError(w, r, "type", "must be 'llm' or 'management'")
 		}
 	}
 }
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+type canariesHandler struct {
+	store store.Store
+}
+
+type canaryResponse struct {
+	*store.PolicyCanary
+	Stats *store.CanaryStats `json:"stats"`
+}
+
+func (h *canariesHandler) List(w http.ResponseWriter, r *http.Request) {
+	canaries, err := h.store.ListPolicyCanaries(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list canaries")
+		return
+	}
+	writeData(w, canaries)
+}
+
+func (h *canariesHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req store.PolicyCanaryCreate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+	if validateCanary(&req).write(w, r) {
+		return
+	}
+
+	running, err := h.store.GetRunningPolicyCanary(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to check running canary")
+		return
+	}
+	if running != nil {
+		writeError(w, r, http.StatusConflict, "conflict", fmt.Sprintf("Canary %q is already running; promote or roll it back first", running.Name))
+		return
+	}
+
+	c, err := h.store.CreatePolicyCanary(r.Context(), &req)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to create canary")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, response{Data: c})
+}
+
+func (h *canariesHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+
+	c, err := h.store.GetPolicyCanary(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch canary")
+		return
+	}
+	if c == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Canary not found")
+		return
+	}
+	stats, err := h.store.PolicyCanaryStats(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch canary stats")
+		return
+	}
+
+	writeData(w, canaryResponse{PolicyCanary: c, Stats: stats})
+}
+
+func (h *canariesHandler) Promote(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+
+	ok, err := h.store.PromotePolicyCanary(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to promote canary")
+		return
+	}
+	if !ok {
+		writeError(w, r, http.StatusConflict, "conflict", "Canary is not running")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response{Data: map[string]string{"status": store.CanaryPromoted}})
+}
+
+func (h *canariesHandler) RollBack(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+
+	ok, err := h.store.RollBackPolicyCanary(r.Context(), id, "rolled back manually")
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to roll back canary")
+		return
+	}
+	if !ok {
+		writeError(w, r, http.StatusConflict, "conflict", "Canary is not running")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response{Data: map[string]string{"status": store.CanaryRolledBack}})
+}
+
+// validateCanary returns the canary's invalid fields. The candidate
+// policies are checked like regular policies.
+func validateCanary(c *store.PolicyCanaryCreate) fieldErrors {
+	var errs fieldErrors
+	if c.Name == "" {
+		errs.add("name", "is required")
+	}
+	if c.Percent < 1 || c.Percent > 99 {
+		errs.add("percent", "must be between 1 and 99")
+	}
+	if c.Policies == nil {
+		errs.add("policies", "is required; send [] to canary an empty policy set")
+	}
+	if c.MaxErrorRateDelta != nil && (*c.MaxErrorRateDelta < 0 || *c.MaxErrorRateDelta > 1) {
+		errs.add("max_error_rate_delta", "must be between 0 and 1")
+	}
+	if c.MaxLatencyDeltaMS != nil && *c.MaxLatencyDeltaMS < 0 {
+		errs.add("max_latency_delta_ms", "must not be negative")
+	}
+	if c.MinRequests != nil && *c.MinRequests < 1 {
+		errs.add("min_requests", "must be positive")
+	}
+	names := make(map[string]bool, len(c.Policies))
+	for i, p := range c.Policies {
+		prefix := fmt.Sprintf("policies[%d].", i)
+		if p.Name == "" {
+			errs.add(prefix+"name", "is required")
+		} else if names[p.Name] {
+			errs.add(prefix+"name", fmt.Sprintf("duplicates policy %q", p.Name))
+		}
+		names[p.Name] = true
+		validatePolicy(&errs, prefix, p.Expression, p.Action, p.TargetModel, p.MaxTokens)
+	}
+	return errs
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/sertdev/pxbin/internal/server"
+)
+
+// DrainController puts the instance in and out of drain mode.
+type DrainController interface {
+	SetDraining(on bool)
+	DrainStatus() server.DrainStatus
+}
+
+type drainHandler struct {
+	drain DrainController // nil when drain mode is not wired up
+}
+
+// Get reports whether the instance is draining and how many proxy requests
+// are still in flight.
+func (h *drainHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if h.drain == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Drain mode is not available")
+		return
+	}
+	writeData(w, h.drain.DrainStatus())
+}
+
+// Start puts the instance into drain mode: /readyz fails and new proxy
+// requests are turned away, while requests in flight finish.
+func (h *drainHandler) Start(w http.ResponseWriter, r *http.Request) {
+	h.set(w, r, true)
+}
+
+// Stop takes the instance out of drain mode.
+func (h *drainHandler) Stop(w http.ResponseWriter, r *http.Request) {
+	h.set(w, r, false)
+}
+
+func (h *drainHandler) set(w http.ResponseWriter, r *http.Request, on bool) {
+	if h.drain == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Drain mode is not available")
+		return
+	}
+	h.drain.SetDraining(on)
+	writeData(w, h.drain.DrainStatus())
+}
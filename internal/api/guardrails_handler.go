@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/guardrail"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// GuardrailReloader applies guardrail changes to the proxy without waiting
+// for its periodic reload.
+type GuardrailReloader interface {
+	Reload(ctx context.Context) error
+}
+
+type guardrailsHandler struct {
+	store      store.Store
+	guardrails GuardrailReloader // nil when the proxy only picks up guardrails periodically
+}
+
+func (h *guardrailsHandler) List(w http.ResponseWriter, r *http.Request) {
+	guardrails, err := h.store.ListGuardrails(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list guardrails")
+		return
+	}
+	writeData(w, guardrails)
+}
+
+func (h *guardrailsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req store.GuardrailCreate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	var errs fieldErrors
+	if req.Name == "" {
+		errs.add("name", "is required")
+	}
+	validateGuardrail(&errs, &store.Guardrail{
+		Kind:     req.Kind,
+		Stage:    req.Stage,
+		Mode:     req.Mode,
+		Patterns: req.Patterns,
+		MaxChars: req.MaxChars,
+		Entities: req.Entities,
+	})
+	if errs.write(w, r) {
+		return
+	}
+	if req.KeyID != nil {
+		key, err := h.store.GetLLMKey(r.Context(), *req.KeyID)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch key")
+			return
+		}
+		if key == nil {
+			writeFieldError(w, r, "llm_key_id", "must name an LLM key")
+			return
+		}
+	}
+
+	g, err := h.store.CreateGuardrail(r.Context(), &req)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to create guardrail")
+		return
+	}
+	reloadNow(r.Context(), h.guardrails, "guardrails")
+
+	writeJSON(w, http.StatusCreated, response{Data: g})
+}
+
+func (h *guardrailsHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+
+	var updates store.GuardrailUpdate
+	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+
+	// Validate the guardrail as it will look after the update.
+	existing, err := h.store.GetGuardrail(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch guardrail")
+		return
+	}
+	if existing == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Guardrail not found")
+		return
+	}
+	var errs fieldErrors
+	if updates.Name != nil && strings.TrimSpace(*updates.Name) == "" {
+		errs.add("name", "must not be empty")
+	}
+	g := updates.Apply(*existing)
+	validateGuardrail(&errs, &g)
+	if errs.write(w, r) {
+		return
+	}
+
+	if err := h.store.UpdateGuardrail(r.Context(), id, &updates); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to update guardrail")
+		return
+	}
+	reloadNow(r.Context(), h.guardrails, "guardrails")
+
+	writeData(w, statusResponse{Status: "updated"})
+}
+
+func (h *guardrailsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+
+	ok, err := h.store.DeleteGuardrail(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to delete guardrail")
+		return
+	}
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "not_found", "Guardrail not found")
+		return
+	}
+	reloadNow(r.Context(), h.guardrails, "guardrails")
+
+	writeData(w, statusResponse{Status: "deleted"})
+}
+
+// validateGuardrail adds the errors of a guardrail's stage, mode and the
+// settings of its kind.
+func validateGuardrail(errs *fieldErrors, g *store.Guardrail) {
+	if !guardrail.ValidStage(g.Stage) {
+		errs.add("stage", "must be 'request', 'response', or 'both'")
+	}
+	if !guardrail.ValidMode(g.Mode) {
+		errs.add("mode", "must be 'block' or 'flag'")
+	}
+	if !guardrail.ValidStage(g.Stage) {
+		return
+	}
+	var invalid *guardrail.InvalidError
+	if _, err := guardrail.New(g); errors.As(err, &invalid) {
+		errs.add(invalid.Field, invalid.Message)
+	}
+}
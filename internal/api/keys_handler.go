@@ -3,15 +3,22 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/billing"
+	"github.com/sertdev/pxbin/internal/events"
 	"github.com/sertdev/pxbin/internal/store"
 )
 
 type keysHandler struct {
-	store *store.Store
+	store   store.Store
+	billing *billing.Tracker
+	events  *events.Bus // nil when no event consumers are configured
 }
 
 func (h *keysHandler) List(w http.ResponseWriter, r *http.Request) {
@@ -23,14 +30,14 @@ func (h *keysHandler) List(w http.ResponseWriter, r *http.Request) {
 	case "management":
 		keys, total, err := h.store.ListManagementKeys(r.Context(), page, perPage)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "server_error", "Failed to list keys")
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list keys")
 			return
 		}
 		writeDataPaginated(w, keys, total, page, perPage)
 	default:
 		keys, total, err := h.store.ListLLMKeys(r.Context(), page, perPage)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "server_error", "Failed to list keys")
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list keys")
 			return
 		}
 		writeDataPaginated(w, keys, total, page, perPage)
@@ -54,7 +61,7 @@ type createKeyResponse struct {
 func (h *keysHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var req createKeyRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		writeInvalidJSON(w, r)
 		return
 	}
 
@@ -67,7 +74,7 @@ func (h *keysHandler) Create(w http.ResponseWriter, r *http.Request) {
 		}
 		record, err := h.store.CreateManagementKey(r.Context(), hash, prefix, req.Name, perms)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "server_error", "Failed to create key")
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to create key")
 			return
 		}
 		writeJSON(w, http.StatusCreated, response{Data: createKeyResponse{
@@ -80,9 +87,10 @@ func (h *keysHandler) Create(w http.ResponseWriter, r *http.Request) {
 		plaintext, hash, prefix := auth.GenerateLLMKey()
 		record, err := h.store.CreateLLMKey(r.Context(), hash, prefix, req.Name, req.RateLimit)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "server_error", "Failed to create key")
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to create key")
 			return
 		}
+		h.events.Emit(events.KeyCreated, record.ID, record.Name, nil)
 		writeJSON(w, http.StatusCreated, response{Data: createKeyResponse{
 			Key:       plaintext,
 			ID:        record.ID.String(),
@@ -90,14 +98,14 @@ func (h *keysHandler) Create(w http.ResponseWriter, r *http.Request) {
 			CreatedAt: record.CreatedAt.Format("2006-01-02T15:04:05Z"),
 		}})
 	default:
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid key type, must be 'llm' or 'management'")
+		writeFieldError(w, r, "type", "must be 'llm' or 'management'")
 	}
 }
 
 func (h *keysHandler) Update(w http.ResponseWriter, r *http.Request) {
 	id, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid ID format")
+		writeInvalidID(w, r)
 		return
 	}
 
@@ -107,23 +115,47 @@ func (h *keysHandler) Update(w http.ResponseWriter, r *http.Request) {
 	case "management":
 		var updates store.ManagementKeyUpdate
 		if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-			writeError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+			writeInvalidJSON(w, r)
 			return
 		}
 		if err := h.store.UpdateManagementKey(r.Context(), id, updates); err != nil {
-			writeError(w, http.StatusInternalServerError, "server_error", "Failed to update key")
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to update key")
 			return
 		}
 	default:
 		var updates store.LLMKeyUpdate
 		if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-			writeError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+			writeInvalidJSON(w, r)
 			return
 		}
+		var errs fieldErrors
+		if updates.AllowedRegions != nil && slices.Contains(*updates.AllowedRegions, "") {
+			errs.add("allowed_regions", "must not contain empty regions")
+		}
+		if updates.AllowedModels != nil && !validAllowedModels(*updates.AllowedModels) {
+			errs.add("allowed_models", "must not contain empty names")
+		}
+		if updates.MaxPriority != nil && store.PriorityRank(*updates.MaxPriority) == 0 {
+			errs.add("max_priority", "must be low, normal or high")
+		}
+		if errs.write(w, r) {
+			return
+		}
+		var before *store.LLMAPIKey
+		if updates.IsActive != nil {
+			before = h.keyBeforeChange(r, id)
+		}
 		if err := h.store.UpdateLLMKey(r.Context(), id, updates); err != nil {
-			writeError(w, http.StatusInternalServerError, "server_error", "Failed to update key")
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to update key")
 			return
 		}
+		if before != nil && before.IsActive != *updates.IsActive {
+			t := events.KeyDeactivated
+			if *updates.IsActive {
+				t = events.KeyReactivated
+			}
+			h.events.Emit(t, id, before.Name, nil)
+		}
 	}
 
 	writeJSON(w, http.StatusOK, response{Data: map[string]string{"status": "updated"}})
@@ -132,7 +164,7 @@ func (h *keysHandler) Update(w http.ResponseWriter, r *http.Request) {
 func (h *keysHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid ID format")
+		writeInvalidID(w, r)
 		return
 	}
 
@@ -141,15 +173,350 @@ func (h *keysHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	switch keyType {
 	case "management":
 		if err := h.store.DeactivateManagementKey(r.Context(), id); err != nil {
-			writeError(w, http.StatusInternalServerError, "server_error", "Failed to deactivate key")
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to deactivate key")
 			return
 		}
 	default:
+		before := h.keyBeforeChange(r, id)
 		if err := h.store.DeactivateLLMKey(r.Context(), id); err != nil {
-			writeError(w, http.StatusInternalServerError, "server_error", "Failed to deactivate key")
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to deactivate key")
 			return
 		}
+		if before != nil && before.IsActive {
+			h.events.Emit(events.KeyDeactivated, id, before.Name, nil)
+		}
 	}
 
 	writeJSON(w, http.StatusOK, response{Data: map[string]string{"status": "deactivated"}})
 }
+
+// keyBeforeChange returns the LLM key id before its is_active is changed,
+// to tell whether the change is an event. It returns nil if no events are
+// wanted or the key cannot be read.
+func (h *keysHandler) keyBeforeChange(r *http.Request, id uuid.UUID) *store.LLMAPIKey {
+	if h.events == nil {
+		return nil
+	}
+	key, _ := h.store.GetLLMKey(r.Context(), id)
+	return key
+}
+
+type keyUsageResponse struct {
+	Key       *store.LLMAPIKey `json:"key"`
+	Period    string           `json:"period"`
+	RateLimit keyRateLimit     `json:"rate_limit"`
+	*store.KeyUsage
+}
+
+type keyRateLimit struct {
+	Limit              *int `json:"limit"`
+	RequestsLastMinute int  `json:"requests_last_minute"`
+}
+
+// Usage returns a usage report for a single LLM key: totals, spend over
+// time, per-model breakdown, recent errors, and rate-limit status.
+func (h *keysHandler) Usage(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "24h"
+	}
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "1h"
+	}
+
+	errorLimit := queryInt(r, "errors", 10)
+	if errorLimit < 0 || errorLimit > maxRecentErrors {
+		writeFieldError(w, r, "errors", "must be between 0 and 100")
+		return
+	}
+
+	key, err := h.store.GetLLMKey(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch key")
+		return
+	}
+	if key == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Key not found")
+		return
+	}
+
+	usage, err := h.store.GetKeyUsage(r.Context(), id, period, interval, errorLimit)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get key usage")
+		return
+	}
+
+	writeData(w, keyUsageResponse{
+		Key:    key,
+		Period: period,
+		RateLimit: keyRateLimit{
+			Limit:              key.RateLimit,
+			RequestsLastMinute: usage.RequestsLastMinute,
+		},
+		KeyUsage: usage,
+	})
+}
+
+type keyBudgetRequest struct {
+	DailyBudget   *float64 `json:"daily_budget_usd"`   // null removes the budget
+	MonthlyBudget *float64 `json:"monthly_budget_usd"` // null removes the budget
+}
+
+// keyBudgetResponse reports the key's own budgets and, as effective_*, the
+// ones enforced: its own, or its team's where it sets none.
+type keyBudgetResponse struct {
+	DailyBudget            *float64       `json:"daily_budget_usd"`
+	MonthlyBudget          *float64       `json:"monthly_budget_usd"`
+	EffectiveDailyBudget   *float64       `json:"effective_daily_budget_usd"`
+	EffectiveMonthlyBudget *float64       `json:"effective_monthly_budget_usd"`
+	Spend                  store.KeySpend `json:"spend"`
+	Exceeded               bool           `json:"exceeded"`
+	DailyResetsAt          time.Time      `json:"daily_resets_at"`
+	MonthlyResetsAt        time.Time      `json:"monthly_resets_at"`
+}
+
+// Budget returns an LLM key's spend budgets with its spend this UTC day and
+// month, including requests whose logs are not written yet.
+func (h *keysHandler) Budget(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+	key, err := h.store.GetLLMKey(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch key")
+		return
+	}
+	if key == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Key not found")
+		return
+	}
+	writeData(w, budgetResponse(h.billing, key))
+}
+
+// SetBudget replaces an LLM key's daily and monthly spend budgets.
+func (h *keysHandler) SetBudget(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+	var req keyBudgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+	if validateBudgets(req).write(w, r) {
+		return
+	}
+
+	found, err := h.store.SetLLMKeyBudgets(r.Context(), id, req.DailyBudget, req.MonthlyBudget)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to update key")
+		return
+	}
+	if !found {
+		writeError(w, r, http.StatusNotFound, "not_found", "Key not found")
+		return
+	}
+	// Load the key's logged spend now, not at the next periodic refresh.
+	_ = h.billing.RefreshSpend(r.Context())
+
+	key, err := h.store.GetLLMKey(r.Context(), id)
+	if err != nil || key == nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch key")
+		return
+	}
+	writeData(w, budgetResponse(h.billing, key))
+}
+
+// validateBudgets returns the invalid budgets of a key or team budget
+// request.
+func validateBudgets(req keyBudgetRequest) fieldErrors {
+	var errs fieldErrors
+	if req.DailyBudget != nil && *req.DailyBudget <= 0 {
+		errs.add("daily_budget_usd", "must be greater than 0, or null to remove it")
+	}
+	if req.MonthlyBudget != nil && *req.MonthlyBudget <= 0 {
+		errs.add("monthly_budget_usd", "must be greater than 0, or null to remove it")
+	}
+	return errs
+}
+
+func budgetResponse(bt *billing.Tracker, key *store.LLMAPIKey) keyBudgetResponse {
+	exceeded, _, _ := bt.CheckBudget(key)
+	day, month := billing.BudgetResets(time.Now())
+	daily, monthly := key.Budgets()
+	return keyBudgetResponse{
+		DailyBudget:            key.DailyBudget,
+		MonthlyBudget:          key.MonthlyBudget,
+		EffectiveDailyBudget:   daily,
+		EffectiveMonthlyBudget: monthly,
+		Spend:                  bt.Spend(key.ID),
+		Exceeded:               exceeded,
+		DailyResetsAt:          day,
+		MonthlyResetsAt:        month,
+	}
+}
+
+type keyTeamRequest struct {
+	TeamID *uuid.UUID `json:"team_id"`
+}
+
+// SetTeam moves an LLM key into a team, whose allowlist and budgets it
+// inherits where it sets none of its own.
+func (h *keysHandler) SetTeam(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+	var req keyTeamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+	if req.TeamID == nil {
+		writeFieldError(w, r, "team_id", "is required")
+		return
+	}
+	team, err := h.store.GetTeam(r.Context(), *req.TeamID)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch team")
+		return
+	}
+	if team == nil {
+		writeFieldError(w, r, "team_id", "is not a team")
+		return
+	}
+	h.updateTeam(w, r, id, req.TeamID)
+}
+
+// DeleteTeam takes an LLM key out of its team.
+func (h *keysHandler) DeleteTeam(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+	h.updateTeam(w, r, id, nil)
+}
+
+func (h *keysHandler) updateTeam(w http.ResponseWriter, r *http.Request, id uuid.UUID, teamID *uuid.UUID) {
+	found, err := h.store.SetLLMKeyTeam(r.Context(), id, teamID)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to update key")
+		return
+	}
+	if !found {
+		writeError(w, r, http.StatusNotFound, "not_found", "Key not found")
+		return
+	}
+	// The key may have gained or lost budgets through the team.
+	_ = h.billing.RefreshSpend(r.Context())
+
+	key, err := h.store.GetLLMKey(r.Context(), id)
+	if err != nil || key == nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch key")
+		return
+	}
+	writeData(w, key)
+}
+
+// keyModelsBody is the model allowlist of an LLM key; an empty list allows
+// every model.
+type keyModelsBody struct {
+	AllowedModels []string `json:"allowed_models"`
+}
+
+func validAllowedModels(models []string) bool {
+	for _, m := range models {
+		if strings.TrimSpace(m) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Models returns an LLM key's model allowlist.
+func (h *keysHandler) Models(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+	h.writeModels(w, r, id)
+}
+
+// SetModels replaces an LLM key's model allowlist.
+func (h *keysHandler) SetModels(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+	var req keyModelsBody
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+	if !validAllowedModels(req.AllowedModels) {
+		writeFieldError(w, r, "allowed_models", "must not contain empty names")
+		return
+	}
+	h.updateModels(w, r, id, req.AllowedModels)
+}
+
+// DeleteModels removes an LLM key's model allowlist, allowing every model.
+func (h *keysHandler) DeleteModels(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+	h.updateModels(w, r, id, nil)
+}
+
+func (h *keysHandler) updateModels(w http.ResponseWriter, r *http.Request, id uuid.UUID, models []string) {
+	key, err := h.store.GetLLMKey(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch key")
+		return
+	}
+	if key == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Key not found")
+		return
+	}
+	if models == nil {
+		models = []string{}
+	}
+	if err := h.store.UpdateLLMKey(r.Context(), id, store.LLMKeyUpdate{AllowedModels: &models}); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to update key")
+		return
+	}
+	h.writeModels(w, r, id)
+}
+
+func (h *keysHandler) writeModels(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	key, err := h.store.GetLLMKey(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch key")
+		return
+	}
+	if key == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Key not found")
+		return
+	}
+	models := key.AllowedModels
+	if models == nil {
+		models = []string{}
+	}
+	writeData(w, keyModelsBody{AllowedModels: models})
+}
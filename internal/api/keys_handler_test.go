@@ -0,0 +1,36 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestKeysHandlerUsageErrorLimit(t *testing.T) {
+	st := store.NewMemory()
+	key, err := st.CreateLLMKey(context.Background(), "hash", "pxb_abc", "ci", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := chi.NewRouter()
+	r.Get("/keys/{id}/usage", (&keysHandler{store: st}).Usage)
+
+	for query, want := range map[string]int{
+		"":             http.StatusOK,
+		"?errors=0":    http.StatusOK,
+		"?errors=100":  http.StatusOK,
+		"?errors=-1":   http.StatusBadRequest,
+		"?errors=101":  http.StatusBadRequest,
+		"?errors=1000": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", "/keys/"+key.ID.String()+"/usage"+query, nil))
+		if rec.Code != want {
+			t.Errorf("%q: expected %d, got %d: %s", query, want, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package api
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+const (
+	exportPageSize = 1000
+	// maxExportRows caps one export; continue with after for more.
+	maxExportRows = 100000
+	// maxComputedColumns caps the compute parameters of one export.
+	maxComputedColumns = 20
+)
+
+// exportColumn is a request log field written to exports.
+type exportColumn struct {
+	name  string
+	value func(l *store.RequestLog) any // string, int, float64, bool or nil
+}
+
+var exportColumns = []exportColumn{
+	{"id", func(l *store.RequestLog) any { return l.ID.String() }},
+	{"timestamp", func(l *store.RequestLog) any { return l.Timestamp.UTC().Format(time.RFC3339Nano) }},
+	{"llm_key_id", func(l *store.RequestLog) any { return exportUUID(l.KeyID) }},
+	{"method", func(l *store.RequestLog) any { return l.Method }},
+	{"path", func(l *store.RequestLog) any { return l.Path }},
+	{"model", func(l *store.RequestLog) any { return exportPtr(l.Model) }},
+	{"input_format", func(l *store.RequestLog) any { return l.InputFormat }},
+	{"upstream_id", func(l *store.RequestLog) any { return exportUUID(l.UpstreamID) }},
+	{"upstream_format", func(l *store.RequestLog) any { return exportPtr(l.UpstreamFormat) }},
+	{"translated", func(l *store.RequestLog) any { return l.Translated }},
+	{"status_code", func(l *store.RequestLog) any { return exportPtr(l.StatusCode) }},
+	{"latency_ms", func(l *store.RequestLog) any { return exportPtr(l.LatencyMS) }},
+	{"input_tokens", func(l *store.RequestLog) any { return exportPtr(l.InputTokens) }},
+	{"output_tokens", func(l *store.RequestLog) any { return exportPtr(l.OutputTokens) }},
+	{"reasoning_tokens", func(l *store.RequestLog) any { return l.ReasoningTokens }},
+	{"cost", func(l *store.RequestLog) any { return exportPtr(l.Cost) }},
+	{"overhead_us", func(l *store.RequestLog) any { return exportPtr(l.OverheadUS) }},
+	{"tool_calls", func(l *store.RequestLog) any { return l.ToolCalls }},
+	{"web_search_requests", func(l *store.RequestLog) any { return l.WebSearches }},
+	{"region", func(l *store.RequestLog) any { return exportPtr(l.Region) }},
+	{"priority", func(l *store.RequestLog) any { return exportPtr(l.Priority) }},
+	{"error_code", func(l *store.RequestLog) any { return exportPtr(l.ErrorCode) }},
+	{"error_message", func(l *store.RequestLog) any { return exportPtr(l.ErrorMessage) }},
+}
+
+func exportPtr[T any](p *T) any {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+func exportUUID(id *uuid.UUID) any {
+	if id == nil {
+		return nil
+	}
+	return id.String()
+}
+
+// computedColumn is a column defined by the export request.
+type computedColumn struct {
+	name string
+	eval exprFunc
+}
+
+var computedNameRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// parseComputedColumns compiles compute parameters of the form name=expr.
+// Expressions may use the log columns and computed columns defined before
+// them.
+func parseComputedColumns(params []string) ([]computedColumn, error) {
+	if len(params) > maxComputedColumns {
+		return nil, fmt.Errorf("at most %d compute columns", maxComputedColumns)
+	}
+	known := make(map[string]bool, len(exportColumns)+len(params))
+	for _, c := range exportColumns {
+		known[c.name] = true
+	}
+	cols := make([]computedColumn, 0, len(params))
+	for _, p := range params {
+		name, src, ok := strings.Cut(p, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !computedNameRe.MatchString(name) {
+			return nil, fmt.Errorf("compute %q: want name=expression with a lowercase name", p)
+		}
+		if known[name] {
+			return nil, fmt.Errorf("compute %q: column %s already exists", p, name)
+		}
+		eval, err := compileExpr(strings.TrimSpace(src), known)
+		if err != nil {
+			return nil, fmt.Errorf("compute %s: %v", name, err)
+		}
+		known[name] = true
+		cols = append(cols, computedColumn{name: name, eval: eval})
+	}
+	return cols, nil
+}
+
+// Export streams the logs matching the List filters, newest first, as CSV
+// (format=csv, the default) or JSON Lines (format=jsonl), with any
+// computed columns appended. An export stops after limit rows;
+// after=<timestamp>,<id> of its last row continues it.
+func (h *logsHandler) Export(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter, msg := logFilterFromQuery(q)
+	if msg != "" {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", msg)
+		return
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "jsonl" {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", "format must be csv or jsonl")
+		return
+	}
+	computed, err := parseComputedColumns(q["compute"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	limit := queryInt(r, "limit", maxExportRows)
+	if limit < 1 || limit > maxExportRows {
+		writeFieldError(w, r, "limit", fmt.Sprintf("must be between 1 and %d", maxExportRows))
+		return
+	}
+	// Pages continue from the last log of the one before, so logs written
+	// during the export do not shift them.
+	if v := q.Get("after"); v != "" {
+		if filter.After, err = parseExportCursor(v); err != nil {
+			writeFieldError(w, r, "after", "must be the timestamp and id of a row, separated by a comma, or a request log ID")
+			return
+		}
+		if filter.After.Timestamp.IsZero() {
+			after, err := h.store.GetLog(r.Context(), filter.After.ID)
+			if err != nil {
+				writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get log")
+				return
+			}
+			if after == nil {
+				writeFieldError(w, r, "after", "must be the ID of an existing request log")
+				return
+			}
+			filter.After.Timestamp = after.Timestamp
+		}
+	}
+
+	var enc exportEncoder
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		enc = newCSVExport(w, computed)
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc = newJSONLExport(w, computed)
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="logs.`+format+`"`)
+
+	started := false
+	for exported := 0; exported < limit; {
+		filter.PerPage = min(exportPageSize, limit-exported)
+		logs, _, err := h.store.ListLogs(r.Context(), filter)
+		if err != nil {
+			if !started {
+				w.Header().Del("Content-Disposition")
+				writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list logs")
+				return
+			}
+			log.Printf("log export: %v", err)
+			return
+		}
+		started = true
+		for i := range logs {
+			row := make(map[string]any, len(exportColumns)+len(computed))
+			for _, c := range exportColumns {
+				row[c.name] = c.value(&logs[i])
+			}
+			evalComputed(computed, row)
+			if err := enc.write(row); err != nil {
+				return // client went away
+			}
+		}
+		if err := enc.flush(); err != nil || len(logs) < filter.PerPage {
+			return
+		}
+		exported += len(logs)
+		last := &logs[len(logs)-1]
+		filter.After = &store.LogCursor{Timestamp: last.Timestamp, ID: last.ID}
+	}
+}
+
+// parseExportCursor parses an after parameter: the timestamp and id
+// columns of an export's last row, as "<timestamp>,<id>". A bare request
+// log ID is accepted too, with a zero timestamp for the caller to look up.
+func parseExportCursor(v string) (*store.LogCursor, error) {
+	ts, idStr, ok := strings.Cut(v, ",")
+	if !ok {
+		ts, idStr = "", v
+	}
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return nil, err
+	}
+	c := &store.LogCursor{ID: id}
+	if ok {
+		if c.Timestamp, err = time.Parse(time.RFC3339Nano, ts); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// exportEncoder writes export rows in one format.
+type exportEncoder interface {
+	write(row map[string]any) error
+	flush() error
+}
+
+type csvExport struct {
+	w     http.ResponseWriter
+	csv   *csv.Writer
+	names []string
+}
+
+func newCSVExport(w http.ResponseWriter, computed []computedColumn) *csvExport {
+	e := &csvExport{w: w, csv: csv.NewWriter(w)}
+	for _, c := range exportColumns {
+		e.names = append(e.names, c.name)
+	}
+	for _, c := range computed {
+		e.names = append(e.names, c.name)
+	}
+	e.csv.Write(e.names) // buffered until the first flush
+	return e
+}
+
+func (e *csvExport) write(row map[string]any) error {
+	record := make([]string, len(e.names))
+	for i, name := range e.names {
+		record[i] = csvValue(row[name])
+	}
+	return e.csv.Write(record)
+}
+
+func (e *csvExport) flush() error {
+	e.csv.Flush()
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return e.csv.Error()
+}
+
+func csvValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
+
+type jsonlExport struct {
+	w     http.ResponseWriter
+	buf   *bufio.Writer
+	names []string
+}
+
+func newJSONLExport(w http.ResponseWriter, computed []computedColumn) *jsonlExport {
+	e := &jsonlExport{w: w, buf: bufio.NewWriter(w)}
+	for _, c := range exportColumns {
+		e.names = append(e.names, c.name)
+	}
+	for _, c := range computed {
+		e.names = append(e.names, c.name)
+	}
+	return e
+}
+
+// write writes row as one JSON object with the keys in column order.
+func (e *jsonlExport) write(row map[string]any) error {
+	e.buf.WriteByte('{')
+	for i, name := range e.names {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		e.buf.Write(key)
+		e.buf.WriteByte(':')
+		val, err := json.Marshal(row[name])
+		if err != nil {
+			val = []byte("null") // NaN or Inf from an expression
+		}
+		e.buf.Write(val)
+	}
+	_, err := io.WriteString(e.buf, "}\n")
+	return err
+}
+
+func (e *jsonlExport) flush() error {
+	if err := e.buf.Flush(); err != nil {
+		return err
+	}
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/sertdev/pxbin/internal/policy"
+)
+
+// Computed export columns are policy expressions over a log's columns, with
+// the functions round(x[, digits]), bucket(x, bound, ...) and
+// coalesce(a, b, ...) added. Numeric columns are doubles, so division does
+// not truncate. An expression that fails on a row, such as arithmetic on a
+// missing value (NULL), gives NULL, as does division by zero.
+
+// exprFunc evaluates a compiled expression against the values of one export
+// row, as exprVars prepares them.
+type exprFunc func(vars map[string]any) any
+
+// maxExprLen bounds a compute expression, so a request cannot ask for an
+// arbitrarily deep parse.
+const maxExprLen = 500
+
+var exportFuncs = map[string]policy.Func{
+	"round":    {MinArgs: 1, MaxArgs: 2, Call: exprRound},
+	"bucket":   {MinArgs: 2, MaxArgs: -1, Call: exprBucket},
+	"coalesce": {MinArgs: 1, MaxArgs: -1, Call: exprCoalesce},
+}
+
+// compileExpr parses src. Column names must be in columns.
+func compileExpr(src string, columns map[string]bool) (exprFunc, error) {
+	if len(src) > maxExprLen {
+		return nil, fmt.Errorf("expression longer than %d characters", maxExprLen)
+	}
+	prog, err := policy.Env{Vars: columns, Funcs: exportFuncs}.Compile(src)
+	if err != nil {
+		return nil, err
+	}
+	return func(vars map[string]any) any {
+		v, err := prog.Eval(vars)
+		if err != nil {
+			return nil
+		}
+		if f, ok := v.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+			return nil // division by zero
+		}
+		return v
+	}, nil
+}
+
+// exprVars returns the values of row as expressions see them.
+func exprVars(row map[string]any) map[string]any {
+	vars := make(map[string]any, len(row))
+	for name, v := range row {
+		if n, ok := v.(int); ok {
+			vars[name] = float64(n)
+		} else {
+			vars[name] = v
+		}
+	}
+	return vars
+}
+
+// evalComputed adds the computed columns to row, each seeing the ones
+// before it.
+func evalComputed(computed []computedColumn, row map[string]any) {
+	if len(computed) == 0 {
+		return
+	}
+	vars := exprVars(row)
+	for _, c := range computed {
+		v := c.eval(vars)
+		row[c.name], vars[c.name] = v, v
+	}
+}
+
+var errNotNumber = errors.New("not a number")
+
+func exprRound(args []any) (any, error) {
+	x, ok := exprNumber(args[0])
+	if !ok {
+		return nil, errNotNumber
+	}
+	digits := 0.0
+	if len(args) == 2 {
+		if digits, ok = exprNumber(args[1]); !ok {
+			return nil, errNotNumber
+		}
+	}
+	scale := math.Pow(10, math.Trunc(digits))
+	return math.Round(x*scale) / scale, nil
+}
+
+// exprBucket labels x with the range between bounds it falls in: "<b1",
+// "b1-b2" and so on up to ">=bn".
+func exprBucket(args []any) (any, error) {
+	x, ok := exprNumber(args[0])
+	if !ok {
+		return nil, errNotNumber
+	}
+	lower := ""
+	for _, arg := range args[1:] {
+		b, ok := exprNumber(arg)
+		if !ok {
+			return nil, errNotNumber
+		}
+		bound := strconv.FormatFloat(b, 'f', -1, 64)
+		if x < b {
+			if lower == "" {
+				return "<" + bound, nil
+			}
+			return lower + "-" + bound, nil
+		}
+		lower = bound
+	}
+	return ">=" + lower, nil
+}
+
+func exprCoalesce(args []any) (any, error) {
+	for _, v := range args {
+		if v != nil {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// exprNumber converts an expression value to a number; strings, booleans
+// and NULL are not numbers.
+func exprNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestComputedColumns(t *testing.T) {
+	cols, err := parseComputedColumns([]string{
+		"cost_with_markup=cost * 1.2",
+		"latency_bucket=bucket(latency_ms, 500, 2000)",
+		"tokens = input_tokens + coalesce(output_tokens, 0)",
+		"ms_per_token=round(latency_ms / tokens, 1)",
+		"label='fixed'",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := map[string]any{"cost": 0.5, "latency_ms": 1000, "input_tokens": 30, "output_tokens": nil}
+	evalComputed(cols, row)
+	want := map[string]any{
+		"cost_with_markup": 0.6,
+		"latency_bucket":   "500-2000",
+		"tokens":           30.0,
+		"ms_per_token":     33.3,
+		"label":            "fixed",
+	}
+	for name, v := range want {
+		if row[name] != v {
+			t.Errorf("%s = %#v, want %#v", name, row[name], v)
+		}
+	}
+
+	// NULL operands and division by zero give NULL; bucket labels the ends.
+	row = map[string]any{"cost": nil, "latency_ms": 50, "input_tokens": 0, "output_tokens": 0}
+	evalComputed(cols, row)
+	if row["cost_with_markup"] != nil || row["ms_per_token"] != nil || row["latency_bucket"] != "<500" {
+		t.Errorf("unexpected row %v", row)
+	}
+	row["latency_ms"] = 2000
+	if got := cols[1].eval(exprVars(row)); got != ">=2000" {
+		t.Errorf("bucket = %v, want >=2000", got)
+	}
+
+	// The policy language's strings, comparisons and conditionals work too.
+	cols, err = parseComputedColumns([]string{
+		`tier=status_code >= 500 ? "error" : "ok"`,
+		`family=model.startsWith("gpt-") ? "openai" : model`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	row = map[string]any{"status_code": 503, "model": "gpt-4o"}
+	evalComputed(cols, row)
+	if row["tier"] != "error" || row["family"] != "openai" {
+		t.Errorf("unexpected row %v", row)
+	}
+}
+
+func TestComputedColumnErrors(t *testing.T) {
+	for _, tc := range []struct{ param, want string }{
+		{"x=nope + 1", `undeclared reference to "nope"`},
+		{"x=cost *", "unexpected \"end of expression\""},
+		{"x=(cost", `expected ")"`},
+		{"x=sqrt(cost)", "unknown function sqrt"},
+		{"x=round(cost, 1, 2)", "wrong number of arguments to round"},
+		{"Cost=cost", "lowercase name"},
+		{"cost=1", "already exists"},
+		{"x='open", "unterminated string"},
+		{"x=cost 2", "unexpected"},
+	} {
+		_, err := parseComputedColumns([]string{tc.param})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: err = %v, want %q", tc.param, err, tc.want)
+		}
+	}
+}
+
+func TestExportCursor(t *testing.T) {
+	s := store.NewMemory()
+	ctx := context.Background()
+	key, _ := s.CreateLLMKey(ctx, "hash", "pxb_exp", "export", nil)
+	start := time.Now().Add(-time.Hour)
+	var entries []*store.LogEntry
+	for i := range 5 {
+		// Two logs share each timestamp, so pages must break ties by ID.
+		entries = append(entries, &store.LogEntry{KeyID: key.ID, Timestamp: start.Add(time.Duration(i/2) * time.Minute), Model: "gpt-4o", StatusCode: 200})
+	}
+	s.InsertLogBatch(ctx, entries)
+	h := &logsHandler{store: s}
+
+	// cursors holds the after parameter each row would continue from.
+	var cursors map[string]string
+	export := func(query string) (int, []string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.Export(rec, httptest.NewRequest("GET", "/logs/export?format=jsonl"+query, nil))
+		var ids []string
+		for _, line := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n") {
+			var row struct{ ID, Timestamp string }
+			if json.Unmarshal([]byte(line), &row) == nil {
+				ids = append(ids, row.ID)
+				cursors[row.ID] = url.QueryEscape(row.Timestamp + "," + row.ID)
+			}
+		}
+		return rec.Code, ids
+	}
+
+	cursors = map[string]string{}
+	_, all := export("")
+	if len(all) != 5 {
+		t.Fatalf("expected 5 rows, got %v", all)
+	}
+	for _, byID := range []bool{false, true} {
+		var paged []string
+		for query := "&limit=2"; ; {
+			_, ids := export(query)
+			paged = append(paged, ids...)
+			if len(ids) < 2 {
+				break
+			}
+			last := ids[len(ids)-1]
+			if byID {
+				query = "&limit=2&after=" + last
+			} else {
+				query = "&limit=2&after=" + cursors[last]
+			}
+		}
+		if strings.Join(paged, ",") != strings.Join(all, ",") {
+			t.Fatalf("expected the pages to add up to the full export (by ID: %v)\n got %v\nwant %v", byID, paged, all)
+		}
+	}
+
+	// A cursor does not need its log to still exist.
+	gone := url.QueryEscape(start.Add(90*time.Second).Format(time.RFC3339Nano) + "," + key.ID.String())
+	if _, ids := export("&after=" + gone); len(ids) != 4 {
+		t.Errorf("expected the 4 logs older than the cursor, got %v", ids)
+	}
+
+	for _, query := range []string{"&limit=0", "&after=nope", "&after=" + key.ID.String(), "&after=yesterday," + key.ID.String()} {
+		if code, _ := export(query); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", query, code)
+		}
+	}
+}
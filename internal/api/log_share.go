@@ -0,0 +1,160 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// defaultLogShareTTL is how long a share link stays valid when the request
+// does not say.
+const defaultLogShareTTL = time.Hour
+
+// LogSigner signs and verifies links granting read access to a single
+// request log without a management key.
+type LogSigner struct {
+	key    []byte
+	maxTTL time.Duration
+}
+
+// NewLogSigner creates a signer keyed by secret whose links live at most
+// maxTTL. Returns nil if secret is empty (sharing disabled).
+func NewLogSigner(secret string, maxTTL time.Duration) *LogSigner {
+	if secret == "" {
+		return nil
+	}
+	return &LogSigner{key: []byte(secret), maxTTL: maxTTL}
+}
+
+// Sign returns the signature for log id expiring at expires.
+func (s *LogSigner) Sign(id uuid.UUID, expires time.Time) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte("pxbin-log-share-v1:" + id.String() + ":" + strconv.FormatInt(expires.Unix(), 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether sig is a valid, unexpired signature for log id.
+func (s *LogSigner) Verify(id uuid.UUID, expires time.Time, sig string) bool {
+	if time.Now().After(expires) {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(s.Sign(id, expires)))
+}
+
+// sharedLogPath is the unauthenticated route serving signed links, relative
+// to the server root.
+const sharedLogPath = "/api/v1/shared/logs/"
+
+type shareLogRequest struct {
+	TTLSeconds int `json:"ttl_seconds,omitempty"`
+}
+
+type shareLogResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Share creates a signed link to a request log.
+func (h *logsHandler) Share(w http.ResponseWriter, r *http.Request) {
+	if h.signer == nil {
+		writeError(w, r, http.StatusNotImplemented, "not_implemented", "Log sharing is disabled; set log_share_secret to enable it")
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+
+	var req shareLogRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeInvalidJSON(w, r)
+			return
+		}
+	}
+	ttl := defaultLogShareTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if req.TTLSeconds < 0 || ttl > h.signer.maxTTL {
+		writeError(w, r, http.StatusBadRequest, "invalid_request",
+			"ttl_seconds must be between 1 and "+strconv.Itoa(int(h.signer.maxTTL/time.Second)))
+		return
+	}
+
+	log, err := h.store.GetLog(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get log")
+		return
+	}
+	if log == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Log not found")
+		return
+	}
+
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	writeJSON(w, http.StatusCreated, response{Data: shareLogResponse{
+		URL:       sharedLogPath + id.String() + "?expires=" + strconv.FormatInt(expires.Unix(), 10) + "&sig=" + h.signer.Sign(id, expires),
+		ExpiresAt: expires.UTC(),
+	}})
+}
+
+// NewSharedLogHandler returns an http.HandlerFunc serving the request log
+// named by a signed link, and its captured bodies, without other
+// authentication. Returns nil if
+// signer is nil (sharing disabled).
+func NewSharedLogHandler(s store.Store, signer *LogSigner) http.HandlerFunc {
+	if signer == nil {
+		return nil
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Robots-Tag", "noindex")
+
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			writeInvalidID(w, r)
+			return
+		}
+		unix, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+		if err != nil || !signer.Verify(id, time.Unix(unix, 0), r.URL.Query().Get("sig")) {
+			writeError(w, r, http.StatusForbidden, "permission_error", "Invalid or expired link")
+			return
+		}
+
+		log, err := s.GetLog(r.Context(), id)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get log")
+			return
+		}
+		if log == nil {
+			writeError(w, r, http.StatusNotFound, "not_found", "Log not found")
+			return
+		}
+		payload, err := s.GetLogPayload(r.Context(), id)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get log payload")
+			return
+		}
+
+		writeData(w, sharedLogResponse{RequestLog: log, Payload: payload})
+	}
+}
+
+// sharedLogResponse is a shared request log with the bodies captured for
+// it, if payload capture was on for its request.
+type sharedLogResponse struct {
+	*store.RequestLog
+	Payload *store.LogPayload `json:"payload,omitempty"`
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestLogSignerVerify(t *testing.T) {
+	signer := NewLogSigner("0123456789abcdef0123456789abcdef", time.Hour)
+	id := uuid.New()
+	expires := time.Now().Add(time.Minute).Truncate(time.Second)
+	sig := signer.Sign(id, expires)
+
+	if !signer.Verify(id, expires, sig) {
+		t.Fatal("expected a fresh signature to verify")
+	}
+	if signer.Verify(uuid.New(), expires, sig) {
+		t.Fatal("signature must not verify for another log")
+	}
+	if signer.Verify(id, expires.Add(time.Hour), sig) {
+		t.Fatal("signature must not verify with an extended expiry")
+	}
+	past := time.Now().Add(-time.Second).Truncate(time.Second)
+	if signer.Verify(id, past, signer.Sign(id, past)) {
+		t.Fatal("expired signature must not verify")
+	}
+	other := NewLogSigner("another-secret-another-secret-xx", time.Hour)
+	if other.Verify(id, expires, sig) {
+		t.Fatal("signature must not verify under another secret")
+	}
+	if NewLogSigner("", time.Hour) != nil {
+		t.Fatal("expected an empty secret to disable sharing")
+	}
+}
+
+func TestSharedLogHandlerRejectsBadLinks(t *testing.T) {
+	signer := NewLogSigner("0123456789abcdef0123456789abcdef", time.Hour)
+	r := chi.NewRouter()
+	r.Get("/api/v1/shared/logs/{id}", NewSharedLogHandler(nil, signer))
+
+	id := uuid.New()
+	expires := time.Now().Add(time.Minute).Truncate(time.Second)
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	for name, query := range map[string]string{
+		"missing signature": "?expires=" + exp,
+		"bad signature":     "?expires=" + exp + "&sig=AAAA",
+		"bad expiry":        "?expires=soon&sig=" + signer.Sign(id, expires),
+		"extended expiry":   "?expires=" + strconv.FormatInt(expires.Unix()+3600, 10) + "&sig=" + signer.Sign(id, expires),
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", sharedLogPath+id.String()+query, nil))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d", name, rec.Code)
+		}
+		if rec.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: expected Cache-Control: no-store", name)
+		}
+	}
+}
+
+func TestSharedLogHandlerServesSignedLink(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	key, _ := st.CreateLLMKey(ctx, "hash", "pxb_abc", "ci", nil)
+	if err := st.InsertLog(ctx, &store.LogEntry{KeyID: key.ID, Timestamp: time.Now(), Model: "gpt-4o", StatusCode: 200}); err != nil {
+		t.Fatal(err)
+	}
+	logs, _, err := st.ListLogs(ctx, store.LogFilter{})
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("list logs: %v", err)
+	}
+
+	signer := NewLogSigner("0123456789abcdef0123456789abcdef", time.Hour)
+	r := chi.NewRouter()
+	r.Get("/api/v1/shared/logs/{id}", NewSharedLogHandler(st, signer))
+
+	expires := time.Now().Add(time.Minute).Truncate(time.Second)
+	for id, want := range map[uuid.UUID]int{logs[0].ID: http.StatusOK, uuid.New(): http.StatusNotFound} {
+		query := "?expires=" + strconv.FormatInt(expires.Unix(), 10) + "&sig=" + signer.Sign(id, expires)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", sharedLogPath+id.String()+query, nil))
+		if rec.Code != want {
+			t.Errorf("expected %d, got %d: %s", want, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestSharedLogHandlerServesCapturedPayload(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	key, _ := st.CreateLLMKey(ctx, "hash", "pxb_abc", "ci", nil)
+	payload := &store.LogPayload{Request: `{"model":"gpt-4o"}`, Response: `{"id":"chatcmpl-1"}`, RequestBytes: 18, ResponseBytes: 19}
+	if err := st.InsertLog(ctx, &store.LogEntry{KeyID: key.ID, Timestamp: time.Now(), Model: "gpt-4o", StatusCode: 200, Payload: payload}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.InsertLog(ctx, &store.LogEntry{KeyID: key.ID, Timestamp: time.Now().Add(-time.Minute), Model: "gpt-4o", StatusCode: 200}); err != nil {
+		t.Fatal(err)
+	}
+	logs, _, err := st.ListLogs(ctx, store.LogFilter{})
+	if err != nil || len(logs) != 2 {
+		t.Fatalf("list logs: %v", err)
+	}
+
+	signer := NewLogSigner("0123456789abcdef0123456789abcdef", time.Hour)
+	r := chi.NewRouter()
+	r.Get("/api/v1/shared/logs/{id}", NewSharedLogHandler(st, signer))
+
+	expires := time.Now().Add(time.Minute).Truncate(time.Second)
+	for i, want := range []*store.LogPayload{payload, nil} {
+		id := logs[i].ID
+		query := "?expires=" + strconv.FormatInt(expires.Unix(), 10) + "&sig=" + signer.Sign(id, expires)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", sharedLogPath+id.String()+query, nil))
+		var body struct {
+			Data struct {
+				ID      uuid.UUID         `json:"id"`
+				Payload *store.LogPayload `json:"payload"`
+			} `json:"data"`
+		}
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &body) != nil || body.Data.ID != id {
+			t.Fatalf("expected log %s, got %d: %s", id, rec.Code, rec.Body)
+		}
+		switch {
+		case want == nil && body.Data.Payload != nil:
+			t.Errorf("expected no payload for a log without captured bodies, got %+v", body.Data.Payload)
+		case want != nil && (body.Data.Payload == nil || body.Data.Payload.Request != want.Request || body.Data.Payload.Response != want.Response):
+			t.Errorf("expected the captured bodies, got %s", rec.Body)
+		}
+	}
+}
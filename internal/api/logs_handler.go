@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -11,21 +12,37 @@ import (
 )
 
 type logsHandler struct {
-	store *store.Store
+	store  store.Store
+	signer *LogSigner // nil = sharing disabled
 }
 
 func (h *logsHandler) List(w http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query()
-	filter := store.LogFilter{
-		Page:    queryInt(r, "page", 1),
-		PerPage: queryInt(r, "per_page", 50),
+	filter, msg := logFilterFromQuery(r.URL.Query())
+	if msg != "" {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", msg)
+		return
+	}
+	filter.Page = queryInt(r, "page", 1)
+	filter.PerPage = queryInt(r, "per_page", 50)
+
+	logs, total, err := h.store.ListLogs(r.Context(), filter)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list logs")
+		return
 	}
 
+	writeDataPaginated(w, logs, total, filter.Page, filter.PerPage)
+}
+
+// logFilterFromQuery reads the log filters shared by List and Export. It
+// returns a message for the client when a filter is malformed.
+func logFilterFromQuery(q url.Values) (store.LogFilter, string) {
+	var filter store.LogFilter
+
 	if v := q.Get("key_id"); v != "" {
 		id, err := uuid.Parse(v)
 		if err != nil {
-			writeError(w, http.StatusBadRequest, "invalid_request", "Invalid key_id format")
-			return
+			return filter, "Invalid key_id format"
 		}
 		filter.KeyID = &id
 	}
@@ -35,56 +52,77 @@ func (h *logsHandler) List(w http.ResponseWriter, r *http.Request) {
 	if v := q.Get("status_code"); v != "" {
 		code, err := strconv.Atoi(v)
 		if err != nil {
-			writeError(w, http.StatusBadRequest, "invalid_request", "Invalid status_code")
-			return
+			return filter, "Invalid status_code"
 		}
 		filter.StatusCode = &code
 	}
 	if v := q.Get("input_format"); v != "" {
 		filter.InputFormat = &v
 	}
+	if v := q.Get("region"); v != "" {
+		filter.Region = &v
+	}
+	if v := q.Get("priority"); v != "" {
+		filter.Priority = &v
+	}
+	if v := q.Get("error_code"); v != "" {
+		filter.ErrorCode = &v
+	}
 	if v := q.Get("from"); v != "" {
 		t, err := time.Parse(time.RFC3339, v)
 		if err != nil {
-			writeError(w, http.StatusBadRequest, "invalid_request", "Invalid 'from' timestamp, use RFC3339")
-			return
+			return filter, "Invalid 'from' timestamp, use RFC3339"
 		}
 		filter.DateFrom = &t
 	}
 	if v := q.Get("to"); v != "" {
 		t, err := time.Parse(time.RFC3339, v)
 		if err != nil {
-			writeError(w, http.StatusBadRequest, "invalid_request", "Invalid 'to' timestamp, use RFC3339")
-			return
+			return filter, "Invalid 'to' timestamp, use RFC3339"
 		}
 		filter.DateTo = &t
 	}
+	return filter, ""
+}
 
-	logs, total, err := h.store.ListLogs(r.Context(), filter)
+func (h *logsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to list logs")
+		writeInvalidID(w, r)
 		return
 	}
 
-	writeDataPaginated(w, logs, total, filter.Page, filter.PerPage)
+	log, err := h.store.GetLog(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get log")
+		return
+	}
+	if log == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Log not found")
+		return
+	}
+
+	writeData(w, log)
 }
 
-func (h *logsHandler) Get(w http.ResponseWriter, r *http.Request) {
+// Payload returns the request and response bodies captured for a log, which
+// only keys with capture_payloads or payload_capture_all have.
+func (h *logsHandler) Payload(w http.ResponseWriter, r *http.Request) {
 	id, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid ID format")
+		writeInvalidID(w, r)
 		return
 	}
 
-	log, err := h.store.GetLog(r.Context(), id)
+	payload, err := h.store.GetLogPayload(r.Context(), id)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to get log")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get payload")
 		return
 	}
-	if log == nil {
-		writeError(w, http.StatusNotFound, "not_found", "Log not found")
+	if payload == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Payload not found")
 		return
 	}
 
-	writeData(w, log)
+	writeData(w, payload)
 }
@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+type migrationsHandler struct {
+	store store.Store
+}
+
+// Get reports the database's schema version, the migrations this build
+// would still apply and the history of applied migrations. Rolling back is
+// done offline with `pxbin migrate --to N`.
+func (h *migrationsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	status, err := h.store.MigrationStatus(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to read the migration status")
+		return
+	}
+	writeData(w, status)
+}
@@ -2,46 +2,117 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/sertdev/pxbin/internal/billing"
+	"github.com/sertdev/pxbin/internal/discovery"
 	"github.com/sertdev/pxbin/internal/pricing"
 	"github.com/sertdev/pxbin/internal/store"
+	"github.com/sertdev/pxbin/internal/tokenizer"
 )
 
 type modelsHandler struct {
-	store   *store.Store
+	store   store.Store
 	billing *billing.Tracker
+	syncer  *discovery.Syncer
 }
 
+// List returns models, optionally filtered by provider, upstream_id,
+// is_active, stale and q (name search), and sorted by sort=name|created_at|cost
+// (prefix "-" for descending). Without per_page all matches are returned.
 func (h *modelsHandler) List(w http.ResponseWriter, r *http.Request) {
-	models, err := h.store.ListModels(r.Context())
+	q := r.URL.Query()
+	filter := store.ModelFilter{
+		Sort:    q.Get("sort"),
+		Page:    queryInt(r, "page", 1),
+		PerPage: queryInt(r, "per_page", 0),
+	}
+
+	if v := q.Get("provider"); v != "" {
+		filter.Provider = &v
+	}
+	if v := q.Get("upstream_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "Invalid upstream_id format")
+			return
+		}
+		filter.UpstreamID = &id
+	}
+	if v := q.Get("is_active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "Invalid is_active, use true or false")
+			return
+		}
+		filter.IsActive = &active
+	}
+	if v := q.Get("stale"); v != "" {
+		stale, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "Invalid stale, use true or false")
+			return
+		}
+		filter.Stale = &stale
+	}
+	if v := q.Get("q"); v != "" {
+		filter.Search = &v
+	}
+
+	models, total, err := h.store.ListModelsFiltered(r.Context(), filter)
+	if errors.Is(err, store.ErrInvalidSort) {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", "Invalid sort, use name, created_at, or cost")
+		return
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to list models")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list models")
 		return
 	}
-	writeData(w, models)
+	if filter.PerPage <= 0 {
+		writeDataPaginated(w, models, total, 1, total)
+		return
+	}
+	writeDataPaginated(w, models, total, filter.Page, filter.PerPage)
 }
 
 func (h *modelsHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var req store.ModelCreate
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		writeInvalidJSON(w, r)
 		return
 	}
+	var errs fieldErrors
 	if req.Name == "" {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Name is required")
+		errs.add("name", "is required")
+	}
+	errs.check("availability", req.Availability.Validate())
+	validateModelLimits(&errs, req.ContextWindow, req.MaxOutputTokens, req.DefaultMaxTokens, req.Tokenizer)
+	if errs.write(w, r) {
+		return
+	}
+	if req.Tokenizer != nil && *req.Tokenizer == "" {
+		req.Tokenizer = nil
+	}
+	req.Aliases = normalizeAliases(req.Aliases, req.Name)
+	if !h.checkNameConflict(w, r, append([]string{req.Name}, req.Aliases...), nil) {
+		return
+	}
+	req.FallbackUpstreamIDs = uniqueIDs(req.FallbackUpstreamIDs)
+	if !h.checkFallbacks(w, r, req.FallbackUpstreamIDs) {
 		return
 	}
 
 	model, err := h.store.CreateModel(r.Context(), &req)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to create model")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to create model")
 		return
 	}
 
@@ -51,18 +122,52 @@ func (h *modelsHandler) Create(w http.ResponseWriter, r *http.Request) {
 func (h *modelsHandler) Update(w http.ResponseWriter, r *http.Request) {
 	id, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid ID format")
+		writeInvalidID(w, r)
 		return
 	}
 
 	var updates store.ModelUpdate
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		writeInvalidJSON(w, r)
+		return
+	}
+	var errs fieldErrors
+	if updates.Availability != nil {
+		errs.check("availability", updates.Availability.Validate())
+	}
+	validateModelLimits(&errs, updates.ContextWindow, updates.MaxOutputTokens, updates.DefaultMaxTokens, updates.Tokenizer)
+	var names []string
+	if updates.Name != nil {
+		if *updates.Name == "" {
+			errs.add("name", "must not be empty")
+		}
+		names = append(names, *updates.Name)
+	}
+	if errs.write(w, r) {
+		return
+	}
+	if updates.Aliases != nil {
+		name := ""
+		if updates.Name != nil {
+			name = *updates.Name
+		}
+		aliases := normalizeAliases(*updates.Aliases, name)
+		updates.Aliases = &aliases
+		names = append(names, aliases...)
+	}
+	if len(names) > 0 && !h.checkNameConflict(w, r, names, &id) {
 		return
 	}
+	if updates.FallbackUpstreamIDs != nil {
+		ids := uniqueIDs(*updates.FallbackUpstreamIDs)
+		if !h.checkFallbacks(w, r, ids) {
+			return
+		}
+		updates.FallbackUpstreamIDs = &ids
+	}
 
 	if err := h.store.UpdateModel(r.Context(), id, &updates); err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to update model")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to update model")
 		return
 	}
 
@@ -72,12 +177,12 @@ func (h *modelsHandler) Update(w http.ResponseWriter, r *http.Request) {
 func (h *modelsHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid ID format")
+		writeInvalidID(w, r)
 		return
 	}
 
 	if err := h.store.DeleteModel(r.Context(), id); err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to delete model")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to delete model")
 		return
 	}
 
@@ -85,15 +190,13 @@ func (h *modelsHandler) Delete(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *modelsHandler) BulkDelete(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		IDs []string `json:"ids"`
-	}
+	var req bulkDeleteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		writeInvalidJSON(w, r)
 		return
 	}
 	if len(req.IDs) == 0 {
-		writeError(w, http.StatusBadRequest, "invalid_request", "At least one ID is required")
+		writeError(w, r, http.StatusBadRequest, "invalid_request", "At least one ID is required")
 		return
 	}
 
@@ -101,7 +204,7 @@ func (h *modelsHandler) BulkDelete(w http.ResponseWriter, r *http.Request) {
 	for _, raw := range req.IDs {
 		id, err := uuid.Parse(raw)
 		if err != nil {
-			writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Invalid ID: %s", raw))
+			writeError(w, r, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Invalid ID: %s", raw))
 			return
 		}
 		ids = append(ids, id)
@@ -109,91 +212,81 @@ func (h *modelsHandler) BulkDelete(w http.ResponseWriter, r *http.Request) {
 
 	deleted, err := h.store.DeleteModels(r.Context(), ids)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to delete models")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to delete models")
 		return
 	}
 
 	_ = h.billing.RefreshPricing(r.Context())
 
-	writeJSON(w, http.StatusOK, response{Data: map[string]any{"deleted": deleted}})
+	writeJSON(w, http.StatusOK, response{Data: bulkDeleteResponse{Deleted: deleted}})
 }
 
 type discoverRequest struct {
 	UpstreamID string `json:"upstream_id"`
 }
 
-type discoveredModel struct {
-	ID      string `json:"id"`
-	OwnedBy string `json:"owned_by"`
-}
-
 func (h *modelsHandler) Discover(w http.ResponseWriter, r *http.Request) {
 	var req discoverRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		writeInvalidJSON(w, r)
 		return
 	}
 	if req.UpstreamID == "" {
-		writeError(w, http.StatusBadRequest, "invalid_request", "upstream_id is required")
+		writeError(w, r, http.StatusBadRequest, "invalid_request", "upstream_id is required")
 		return
 	}
 
 	upstreamID, err := uuid.Parse(req.UpstreamID)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid upstream_id format")
+		writeError(w, r, http.StatusBadRequest, "invalid_request", "Invalid upstream_id format")
 		return
 	}
 
 	upstream, err := h.store.GetUpstream(r.Context(), upstreamID)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to fetch upstream")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch upstream")
 		return
 	}
 	if upstream == nil {
-		writeError(w, http.StatusNotFound, "not_found", "Upstream not found")
+		writeError(w, r, http.StatusNotFound, "not_found", "Upstream not found")
 		return
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	upstreamReq, err := http.NewRequestWithContext(r.Context(), http.MethodGet, upstream.BaseURL+"/v1/models", nil)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid upstream base_url")
+	if !discovery.Listable(upstream.Format) {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", upstream.Format+" upstreams do not list their models; add them by name")
 		return
 	}
-	if upstream.APIKeyEncrypted != "" {
-		upstreamReq.Header.Set("Authorization", "Bearer "+upstream.APIKeyEncrypted)
-	}
 
-	resp, err := client.Do(upstreamReq)
+	models, err := discovery.Fetch(r.Context(), &http.Client{Timeout: 10 * time.Second}, upstream)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "upstream_error", fmt.Sprintf("Failed to reach upstream: %v", err))
+		writeError(w, r, http.StatusBadGateway, "upstream_error", "Failed to list upstream models: "+err.Error())
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		writeError(w, http.StatusBadGateway, "upstream_error", fmt.Sprintf("Upstream returned %d: %s", resp.StatusCode, string(body)))
+	writeData(w, models)
+}
+
+// Drift returns what the last discovery sync of each upstream found.
+func (h *modelsHandler) Drift(w http.ResponseWriter, r *http.Request) {
+	if h.syncer == nil {
+		writeData(w, []discovery.Report{})
 		return
 	}
+	writeData(w, h.syncer.Reports())
+}
 
-	var upstreamResp struct {
-		Data []struct {
-			ID      string `json:"id"`
-			OwnedBy string `json:"owned_by"`
-		} `json:"data"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&upstreamResp); err != nil {
-		writeError(w, http.StatusBadGateway, "upstream_error", "Failed to parse upstream response")
+// Sync runs a discovery sync of every active upstream now.
+func (h *modelsHandler) Sync(w http.ResponseWriter, r *http.Request) {
+	if h.syncer == nil {
+		writeError(w, r, http.StatusNotImplemented, "not_implemented", "Model discovery sync is not available")
 		return
 	}
-
-	models := make([]discoveredModel, len(upstreamResp.Data))
-	for i, m := range upstreamResp.Data {
-		models[i] = discoveredModel{ID: m.ID, OwnedBy: m.OwnedBy}
+	reports, err := h.syncer.SyncNow(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to sync models")
+		return
 	}
-
-	writeData(w, models)
+	writeData(w, reports)
 }
 
 type importRequest struct {
@@ -204,34 +297,40 @@ type importRequest struct {
 	} `json:"models"`
 }
 
+type importResponse struct {
+	Upstream      *store.Upstream `json:"upstream"`
+	ModelsCreated int             `json:"models_created"`
+	ModelsSkipped int             `json:"models_skipped"`
+}
+
 func (h *modelsHandler) Import(w http.ResponseWriter, r *http.Request) {
 	var req importRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		writeInvalidJSON(w, r)
 		return
 	}
 	if req.UpstreamID == "" {
-		writeError(w, http.StatusBadRequest, "invalid_request", "upstream_id is required")
+		writeError(w, r, http.StatusBadRequest, "invalid_request", "upstream_id is required")
 		return
 	}
 	if len(req.Models) == 0 {
-		writeError(w, http.StatusBadRequest, "invalid_request", "At least one model is required")
+		writeError(w, r, http.StatusBadRequest, "invalid_request", "At least one model is required")
 		return
 	}
 
 	upstreamID, err := uuid.Parse(req.UpstreamID)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid upstream_id format")
+		writeError(w, r, http.StatusBadRequest, "invalid_request", "Invalid upstream_id format")
 		return
 	}
 
 	upstream, err := h.store.GetUpstream(r.Context(), upstreamID)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to fetch upstream")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch upstream")
 		return
 	}
 	if upstream == nil {
-		writeError(w, http.StatusNotFound, "not_found", "Upstream not found")
+		writeError(w, r, http.StatusNotFound, "not_found", "Upstream not found")
 		return
 	}
 
@@ -247,7 +346,7 @@ func (h *modelsHandler) Import(w http.ResponseWriter, r *http.Request) {
 	for _, m := range req.Models {
 		existing, err := h.store.GetModelByName(r.Context(), m.Name)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "server_error", "Failed to check existing model")
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to check existing model")
 			return
 		}
 		if existing != nil {
@@ -255,23 +354,9 @@ func (h *modelsHandler) Import(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		// Look up pricing from LiteLLM
-		inputCost := 0.0
-		outputCost := 0.0
-		if p, ok := pricingData[m.Name]; ok {
-			inputCost = p.InputCostPerMillion
-			outputCost = p.OutputCostPerMillion
-		}
-
-		_, err = h.store.CreateModel(r.Context(), &store.ModelCreate{
-			Name:                 m.Name,
-			Provider:             m.Provider,
-			UpstreamID:           &upstreamID,
-			InputCostPerMillion:  inputCost,
-			OutputCostPerMillion: outputCost,
-		})
+		_, err = h.store.CreateModel(r.Context(), discovery.NewModel(m.Name, m.Provider, upstreamID, pricingData))
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "server_error", fmt.Sprintf("Failed to create model %s", m.Name))
+			writeError(w, r, http.StatusInternalServerError, "server_error", fmt.Sprintf("Failed to create model %s", m.Name))
 			return
 		}
 		created++
@@ -280,23 +365,29 @@ func (h *modelsHandler) Import(w http.ResponseWriter, r *http.Request) {
 	// Refresh billing tracker immediately
 	_ = h.billing.RefreshPricing(r.Context())
 
-	writeJSON(w, http.StatusCreated, response{Data: map[string]any{
-		"upstream":       upstream,
-		"models_created": created,
-		"models_skipped": skipped,
+	writeJSON(w, http.StatusCreated, response{Data: importResponse{
+		Upstream:      upstream,
+		ModelsCreated: created,
+		ModelsSkipped: skipped,
 	}})
 }
 
+type syncPricingResponse struct {
+	ModelsUpdated  int `json:"models_updated"`
+	ModelsNotFound int `json:"models_not_found"`
+	TotalModels    int `json:"total_models"`
+}
+
 func (h *modelsHandler) SyncPricing(w http.ResponseWriter, r *http.Request) {
 	pricingData, err := pricing.FetchLiteLLMPricing(r.Context())
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "upstream_error", fmt.Sprintf("Failed to fetch pricing: %v", err))
+		writeError(w, r, http.StatusBadGateway, "upstream_error", fmt.Sprintf("Failed to fetch pricing: %v", err))
 		return
 	}
 
 	models, err := h.store.ListModels(r.Context())
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to list models")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list models")
 		return
 	}
 
@@ -307,11 +398,16 @@ func (h *modelsHandler) SyncPricing(w http.ResponseWriter, r *http.Request) {
 			inputCost := p.InputCostPerMillion
 			outputCost := p.OutputCostPerMillion
 			err := h.store.UpdateModel(r.Context(), model.ID, &store.ModelUpdate{
-				InputCostPerMillion:  &inputCost,
-				OutputCostPerMillion: &outputCost,
+				InputCostPerMillion:     &inputCost,
+				OutputCostPerMillion:    &outputCost,
+				ContextWindow:           nonZero(p.ContextWindow),
+				MaxOutputTokens:         nonZero(p.MaxOutputTokens),
+				WebSearchCostPer1K:      nonZero(p.WebSearchCostPer1K),
+				EmbeddingCostPerMillion: nonZero(p.EmbeddingCostPerMillion),
+				ReasoningCostPerMillion: nonZero(p.ReasoningCostPerMillion),
 			})
 			if err != nil {
-				writeError(w, http.StatusInternalServerError, "server_error", fmt.Sprintf("Failed to update model %s", model.Name))
+				writeError(w, r, http.StatusInternalServerError, "server_error", fmt.Sprintf("Failed to update model %s", model.Name))
 				return
 			}
 			updated++
@@ -323,9 +419,120 @@ func (h *modelsHandler) SyncPricing(w http.ResponseWriter, r *http.Request) {
 	// Refresh billing tracker immediately so new requests get correct pricing
 	_ = h.billing.RefreshPricing(r.Context())
 
-	writeJSON(w, http.StatusOK, response{Data: map[string]any{
-		"models_updated":  updated,
-		"models_not_found": notFound,
-		"total_models":    len(models),
+	writeJSON(w, http.StatusOK, response{Data: syncPricingResponse{
+		ModelsUpdated:  updated,
+		ModelsNotFound: notFound,
+		TotalModels:    len(models),
 	}})
 }
+
+// nonZero returns a pointer to n, or nil when n is 0 (unknown).
+func nonZero[T int | float64](n T) *T {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+// normalizeAliases lowercases and trims aliases, dropping empty ones,
+// duplicates and any that just repeat name.
+func normalizeAliases(aliases []string, name string) []string {
+	out := make([]string, 0, len(aliases))
+	seen := map[string]bool{strings.ToLower(name): true}
+	for _, a := range aliases {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a == "" || seen[a] {
+			continue
+		}
+		seen[a] = true
+		out = append(out, a)
+	}
+	return out
+}
+
+// checkNameConflict writes a 409 and returns false if any of names is
+// already another model's name or alias, or a router's name, ignoring case.
+func (h *modelsHandler) checkNameConflict(w http.ResponseWriter, r *http.Request, names []string, exclude *uuid.UUID) bool {
+	conflict, err := h.store.ModelNameConflict(r.Context(), names, exclude)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to check model names")
+		return false
+	}
+	if conflict != "" {
+		writeErrorCode(w, r, http.StatusConflict, "conflict", "name_conflict", fmt.Sprintf("Name or alias is already used by model %q (names are case-insensitive)", conflict))
+		return false
+	}
+	routers, err := h.store.ListModelRouters(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to check model names")
+		return false
+	}
+	for _, mr := range routers {
+		for _, name := range names {
+			if strings.EqualFold(mr.Name, name) {
+				writeErrorCode(w, r, http.StatusConflict, "conflict", "name_conflict", fmt.Sprintf("Name or alias is already used by router %q (names are case-insensitive)", mr.Name))
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// uniqueIDs returns ids without duplicates, in their first-seen order.
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	out := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !slices.Contains(out, id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// checkFallbacks writes a 400 and returns false if any of ids is not an
+// upstream.
+func (h *modelsHandler) checkFallbacks(w http.ResponseWriter, r *http.Request, ids []uuid.UUID) bool {
+	for _, id := range ids {
+		u, err := h.store.GetUpstream(r.Context(), id)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to check fallback upstreams")
+			return false
+		}
+		if u == nil {
+			writeFieldError(w, r, "fallback_upstream_ids", fmt.Sprintf("has %s, which is not an upstream", id))
+			return false
+		}
+	}
+	return true
+}
+
+// validateModelLimits adds the errors of a model's token limits and
+// tokenizer override; nil fields are not checked.
+func validateModelLimits(errs *fieldErrors, contextWindow, maxOutputTokens, defaultMaxTokens *int, tok *string) {
+	if !positiveOrNil(contextWindow) {
+		errs.add("context_window", "must be positive")
+	}
+	if !positiveOrNil(maxOutputTokens) {
+		errs.add("max_output_tokens", "must be positive")
+	}
+	if !positiveOrNil(defaultMaxTokens) {
+		errs.add("default_max_tokens", "must be positive")
+	}
+	if !validTokenizer(tok) {
+		errs.add("tokenizer", "must be one of: "+strings.Join(tokenizer.Names(), ", "))
+	}
+}
+
+func positiveOrNil(n *int) bool {
+	return n == nil || *n > 0
+}
+
+// validTokenizer reports whether name is unset, empty (clear the override)
+// or a registered tokenizer.
+func validTokenizer(name *string) bool {
+	if name == nil || *name == "" {
+		return true
+	}
+	_, ok := tokenizer.Get(*name)
+	return ok
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sertdev/pxbin/internal/auth"
+)
+
+type offendersHandler struct {
+	tarpit *auth.Tarpit // nil when the auth tarpit is disabled
+}
+
+// List returns client IPs with recent authentication failures or an active
+// ban, banned ones first.
+func (h *offendersHandler) List(w http.ResponseWriter, r *http.Request) {
+	if h.tarpit == nil {
+		writeData(w, []auth.Offender{})
+		return
+	}
+	offenders, err := h.tarpit.Offenders(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list offenders")
+		return
+	}
+	writeData(w, offenders)
+}
+
+// Clear lifts an IP's ban and resets its failure count.
+func (h *offendersHandler) Clear(w http.ResponseWriter, r *http.Request) {
+	if h.tarpit == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Auth tarpit is disabled")
+		return
+	}
+	if err := h.tarpit.Clear(r.Context(), chi.URLParam(r, "ip")); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to clear offender")
+		return
+	}
+	writeJSON(w, http.StatusOK, response{Data: map[string]string{"status": "cleared"}})
+}
@@ -0,0 +1,564 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/apierror"
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/discovery"
+	"github.com/sertdev/pxbin/internal/scoreboard"
+	"github.com/sertdev/pxbin/internal/seed"
+	"github.com/sertdev/pxbin/internal/server"
+	"github.com/sertdev/pxbin/internal/store"
+	"github.com/sertdev/pxbin/internal/streamtap"
+)
+
+// endpointDoc describes one management API route for the OpenAPI document.
+// Request and response are zero values of the types the handler decodes and
+// writes under "data"; their schemas are derived from the struct fields and
+// json tags, so the document follows the code.
+type endpointDoc struct {
+	summary   string
+	query     []queryParam
+	request   any
+	response  any
+	status    int  // success status; 0 means 200
+	paginated bool // response carries meta with total/page/per_page
+	// files lists the content types of a response that is not the JSON
+	// envelope, such as a file download or a SCIM resource.
+	files []string
+}
+
+type queryParam struct {
+	name        string
+	typ         string // OpenAPI primitive type
+	description string
+}
+
+var (
+	pageParams = []queryParam{
+		{"page", "integer", "Page number, starting at 1"},
+		{"per_page", "integer", "Items per page"},
+	}
+	periodParam   = queryParam{"period", "string", "Time window, e.g. 1h, 24h, 7d or 30d (default 24h)"}
+	intervalParam = queryParam{"interval", "string", "Bucket size, e.g. 5m, 1h or 1d (default 1h)"}
+	keyTypeParam  = queryParam{"type", "string", "Key kind: llm (default) or management"}
+
+	logFilterParams = []queryParam{
+		{"key_id", "string", "Filter by LLM key ID"},
+		{"model", "string", "Filter by model"},
+		{"status_code", "integer", "Filter by HTTP status"},
+		{"input_format", "string", "Filter by client format: anthropic, openai or gemini"},
+		{"region", "string", "Filter by upstream region"},
+		{"priority", "string", "Filter by effective priority: low, normal or high"},
+		{"error_code", "string", "Filter by error code, e.g. upstream_stall"},
+		{"from", "string", "Start time, RFC 3339"},
+		{"to", "string", "End time, RFC 3339"},
+	}
+)
+
+// endpointDocs is keyed by "METHOD /path" as registered on the management
+// router, relative to /api/v1.
+var endpointDocs = map[string]endpointDoc{
+	"GET /keys": {summary: "List API keys", query: append([]queryParam{keyTypeParam}, pageParams...),
+		response: []store.LLMAPIKey{}, paginated: true},
+	"POST /keys":               {summary: "Create an API key; the key is only returned once", request: createKeyRequest{}, response: createKeyResponse{}, status: http.StatusCreated},
+	"PATCH /keys/{id}":         {summary: "Update an API key", query: []queryParam{keyTypeParam}, request: store.LLMKeyUpdate{}, response: statusResponse{}},
+	"DELETE /keys/{id}":        {summary: "Deactivate an API key", query: []queryParam{keyTypeParam}, response: statusResponse{}},
+	"GET /keys/{id}/usage":     {summary: "Usage report for an LLM key", query: []queryParam{periodParam, intervalParam, {"errors", "integer", "Number of recent errors to include, 0 to 100 (default 10)"}}, response: keyUsageResponse{}},
+	"GET /keys/{id}/budget":    {summary: "Spend budgets of an LLM key and its spend this UTC day and month", response: keyBudgetResponse{}},
+	"PUT /keys/{id}/budget":    {summary: "Replace the daily and monthly spend budgets of an LLM key; null removes one", request: keyBudgetRequest{}, response: keyBudgetResponse{}},
+	"GET /keys/{id}/models":    {summary: "Model allowlist of an LLM key; empty allows every model", response: keyModelsBody{}},
+	"PUT /keys/{id}/models":    {summary: "Replace the model allowlist of an LLM key with model names and \"*\" patterns; an empty list allows every model", request: keyModelsBody{}, response: keyModelsBody{}},
+	"DELETE /keys/{id}/models": {summary: "Remove the model allowlist of an LLM key, allowing every model", response: keyModelsBody{}},
+	"PUT /keys/{id}/team":      {summary: "Move an LLM key into a team, whose allowlist and budgets apply where the key sets none", request: keyTeamRequest{}, response: store.LLMAPIKey{}},
+	"DELETE /keys/{id}/team":   {summary: "Take an LLM key out of its team", response: store.LLMAPIKey{}},
+
+	"GET /teams":             {summary: "List teams of LLM keys", response: []store.Team{}},
+	"POST /teams":            {summary: "Create a team", request: store.TeamCreate{}, response: store.Team{}, status: http.StatusCreated},
+	"GET /teams/{id}":        {summary: "Get a team", response: store.Team{}},
+	"PATCH /teams/{id}":      {summary: "Update a team's name or model allowlist; an empty list removes the allowlist", request: store.TeamUpdate{}, response: statusResponse{}},
+	"DELETE /teams/{id}":     {summary: "Delete a team; its keys are left without one", response: statusResponse{}},
+	"PUT /teams/{id}/budget": {summary: "Replace the daily and monthly spend budgets each member key gets unless it has its own; null removes one", request: keyBudgetRequest{}, response: store.Team{}},
+
+	"GET /logs": {summary: "List request logs", query: append(append([]queryParam{}, logFilterParams...), pageParams...),
+		response: []store.RequestLog{}, paginated: true},
+	"GET /logs/export": {summary: "Export request logs as CSV or JSON Lines, newest first, up to limit rows", query: append([]queryParam{
+		{"format", "string", "csv (default) or jsonl"},
+		{"limit", "integer", "Rows to export, at most 100000 (the default)"},
+		{"after", "string", "Continue an export after its last row, given as <timestamp>,<id> of that row, or as its ID alone"},
+		{"compute", "string", "Computed column as name=expression, e.g. cost_with_markup=cost * 1.2 or latency_bucket=bucket(latency_ms, 500, 2000); repeatable"},
+	}, logFilterParams...), files: []string{"text/csv", "application/x-ndjson"}},
+	"GET /logs/{id}":         {summary: "Get a request log", response: store.RequestLog{}},
+	"GET /logs/{id}/payload": {summary: "Get the captured request and response bodies of a request log", response: store.LogPayload{}},
+	"POST /logs/{id}/share": {summary: "Create a signed link to a request log that works without a management key; requires log_share_secret",
+		request: shareLogRequest{}, response: shareLogResponse{}, status: http.StatusCreated},
+
+	"GET /access-logs": {summary: "List management API calls, newest first", query: append([]queryParam{
+		{"key_id", "string", "Filter by management key ID"},
+		{"unauthenticated", "boolean", "Only calls rejected for a missing or invalid key"},
+		{"status_code", "integer", "Filter by HTTP status; 400, 500 etc. match the whole class"},
+		{"client_ip", "string", "Filter by client IP"},
+		{"from", "string", "Start time, RFC 3339"},
+		{"to", "string", "End time, RFC 3339"},
+	}, pageParams...), response: []store.AccessLog{}, paginated: true},
+
+	"GET /models": {summary: "List models; all models when per_page is omitted", query: append([]queryParam{
+		{"provider", "string", "Filter by provider"},
+		{"upstream_id", "string", "Filter by upstream ID"},
+		{"is_active", "boolean", "Filter by active state"},
+		{"stale", "boolean", "Filter by whether the model's upstream no longer lists it"},
+		{"q", "string", "Search by name"},
+		{"sort", "string", "Sort order"},
+	}, pageParams...), response: []store.Model{}, paginated: true},
+	"POST /models":              {summary: "Create a model", request: store.ModelCreate{}, response: store.Model{}, status: http.StatusCreated},
+	"PATCH /models/{id}":        {summary: "Update a model", request: store.ModelUpdate{}, response: statusResponse{}},
+	"DELETE /models/{id}":       {summary: "Delete a model", response: statusResponse{}},
+	"POST /models/discover":     {summary: "List the models an upstream offers", request: discoverRequest{}, response: []discovery.Model{}},
+	"GET /models/drift":         {summary: "What the last discovery sync found on each upstream: new and stale models", response: []discovery.Report{}},
+	"POST /models/sync":         {summary: "Run a discovery sync of every active upstream now", response: []discovery.Report{}},
+	"POST /models/import":       {summary: "Create models discovered on an upstream", request: importRequest{}, response: importResponse{}, status: http.StatusCreated},
+	"POST /models/sync-pricing": {summary: "Update model prices and limits from LiteLLM", response: syncPricingResponse{}},
+	"POST /models/bulk-delete":  {summary: "Delete several models", request: bulkDeleteRequest{}, response: bulkDeleteResponse{}},
+
+	"GET /upstreams": {summary: "List upstreams; all upstreams when per_page is omitted", query: append([]queryParam{
+		{"format", "string", "Filter by format: openai, anthropic or vertex"},
+		{"is_active", "boolean", "Filter by active state"},
+		{"q", "string", "Search by name"},
+		{"sort", "string", "Sort by name, created_at or priority"},
+	}, pageParams...), response: []store.Upstream{}, paginated: true},
+	"POST /upstreams":              {summary: "Create an upstream", request: store.UpstreamCreate{}, response: store.Upstream{}, status: http.StatusCreated},
+	"PATCH /upstreams/{id}":        {summary: "Update an upstream", request: store.UpstreamUpdate{}, response: statusResponse{}},
+	"DELETE /upstreams/{id}":       {summary: "Delete an upstream", response: statusResponse{}},
+	"POST /upstreams/bulk-delete":  {summary: "Delete several upstreams", request: bulkDeleteRequest{}, response: bulkDeleteResponse{}},
+	"POST /upstreams/health-check": {summary: "Check that an upstream answers", request: healthCheckRequest{}, response: healthCheckResult{}},
+	"GET /upstreams/scoreboard":    {summary: "Each upstream's success rate, p95 latency and consecutive failures over its recent requests", response: []scoreboard.Score{}},
+
+	"GET /upstream-pins":         {summary: "Pins in force, sending a key's or every key's requests to one upstream", response: []store.UpstreamPin{}},
+	"POST /upstream-pins":        {summary: "Pin a key, or every key when llm_key_id is omitted, to an upstream for ttl_seconds (default 3600)", request: pinRequest{}, response: store.UpstreamPin{}, status: http.StatusCreated},
+	"DELETE /upstream-pins/{id}": {summary: "Lift a pin before it expires", response: statusResponse{}},
+
+	"GET /audit/rules":         {summary: "Audit sampling rules, each capturing a share of a key's or model's requests in full", response: []store.AuditRule{}},
+	"POST /audit/rules":        {summary: "Set the sampling rate of a key, a model or both, replacing the rule for the same key and model", request: store.AuditRuleCreate{}, response: store.AuditRule{}},
+	"DELETE /audit/rules/{id}": {summary: "Stop a rule's sampling; its samples are kept", response: statusResponse{}},
+	"GET /audit/samples":       {summary: "List audit samples without their bodies; needs the audit permission", response: []store.AuditSample{}, paginated: true},
+	"GET /audit/samples/{id}":  {summary: "Read an audit sample's bodies, recording the view; needs the audit permission", response: auditSampleResponse{}},
+
+	"GET /guardrails":         {summary: "List guardrails, the filters run over request and response text", response: []store.Guardrail{}},
+	"POST /guardrails":        {summary: "Create a guardrail for every key, or for one key with llm_key_id", request: store.GuardrailCreate{}, response: store.Guardrail{}, status: http.StatusCreated},
+	"PATCH /guardrails/{id}":  {summary: "Update a guardrail", request: store.GuardrailUpdate{}, response: statusResponse{}},
+	"DELETE /guardrails/{id}": {summary: "Delete a guardrail", response: statusResponse{}},
+
+	"GET /policies":         {summary: "List admission policies", response: []store.Policy{}},
+	"POST /policies":        {summary: "Create an admission policy", request: store.PolicyCreate{}, response: store.Policy{}, status: http.StatusCreated},
+	"PATCH /policies/{id}":  {summary: "Update an admission policy", request: store.PolicyUpdate{}, response: statusResponse{}},
+	"DELETE /policies/{id}": {summary: "Delete an admission policy", response: statusResponse{}},
+	"GET /routers":          {summary: "List router models", response: []store.ModelRouter{}},
+	"POST /routers":         {summary: "Create a router model", request: store.ModelRouterCreate{}, response: store.ModelRouter{}, status: http.StatusCreated},
+	"PATCH /routers/{id}":   {summary: "Update a router model", request: store.ModelRouterUpdate{}, response: statusResponse{}},
+	"DELETE /routers/{id}":  {summary: "Delete a router model", response: statusResponse{}},
+
+	"GET /canaries":                {summary: "List policy canaries", response: []store.PolicyCanary{}},
+	"POST /canaries":               {summary: "Start a policy canary", request: store.PolicyCanaryCreate{}, response: store.PolicyCanary{}, status: http.StatusCreated},
+	"GET /canaries/{id}":           {summary: "Get a policy canary with per-arm stats", response: canaryResponse{}},
+	"POST /canaries/{id}/promote":  {summary: "Promote a running canary", response: statusResponse{}},
+	"POST /canaries/{id}/rollback": {summary: "Roll back a running canary", response: statusResponse{}},
+
+	"GET /stats/overview":        {summary: "Request, token and cost totals", query: []queryParam{periodParam}, response: store.OverviewStats{}},
+	"GET /stats/by-key":          {summary: "Usage per LLM key", query: append([]queryParam{periodParam}, pageParams...), response: []store.KeyStats{}, paginated: true},
+	"GET /stats/teams":           {summary: "Usage per team, summed over its current member keys", query: []queryParam{periodParam}, response: []store.TeamStats{}},
+	"GET /stats/by-team":         {summary: "Same as GET /stats/teams", query: []queryParam{periodParam}, response: []store.TeamStats{}},
+	"GET /stats/by-model":        {summary: "Usage per model", query: []queryParam{periodParam}, response: []store.ModelStats{}},
+	"GET /stats/by-translation":  {summary: "Usage per translation path", query: []queryParam{periodParam}, response: []store.TranslationStats{}},
+	"GET /stats/provider-errors": {summary: "Requests refused by upstream provider policies, per code, upstream and model", query: []queryParam{periodParam}, response: []store.ProviderErrorStats{}},
+	"GET /stats/cache-injection": {summary: "Prompt caching and estimated savings per model on requests with injected cache_control breakpoints", query: []queryParam{periodParam}, response: []store.CacheInjectionStats{}},
+	"GET /stats/timeseries":      {summary: "Usage over time", query: []queryParam{periodParam, intervalParam}, response: []store.TimeSeriesBucket{}},
+	"GET /stats/latency":         {summary: "Latency percentiles", query: []queryParam{periodParam}, response: store.LatencyStats{}},
+
+	"GET /auth/offenders":         {summary: "IPs with recent authentication failures or bans", response: []auth.Offender{}},
+	"DELETE /auth/offenders/{ip}": {summary: "Lift an IP's ban and forget its failures", response: statusResponse{}},
+
+	"GET /admin/drain":    {summary: "Whether the instance is draining, and proxy requests still in flight", response: server.DrainStatus{}},
+	"POST /admin/drain":   {summary: "Start draining: /readyz fails and new proxy requests get 503 with Retry-After", response: server.DrainStatus{}},
+	"DELETE /admin/drain": {summary: "Stop draining", response: server.DrainStatus{}},
+
+	"GET /admin/streams": {summary: "Streaming responses in flight on this instance, by X-Request-ID", response: []streamtap.Stream{}},
+	"GET /admin/streams/{requestID}/tail": {summary: "Follow an in-flight stream read-only as server-sent events: stream, then one event per event its client receives, then end",
+		query: []queryParam{{"redact", "string", "content (default) masks every string but structural fields such as type and id; none shows events as sent and needs the audit permission"}}, files: []string{"text/event-stream"}},
+
+	"GET /admin/migrations": {summary: "Schema version, pending migrations and the history of applied ones", response: store.MigrationStatus{}},
+
+	"GET /ratelimit": {summary: "Rate limiter totals and the most rejected keys", query: []queryParam{{"limit", "integer", "Number of keys to include (default 20, max 100)"}}, response: rateLimitResponse{}},
+
+	"POST /utils/count_tokens": {summary: "Count prompt tokens for a model or tokenizer", request: countTokensRequest{}, response: countTokensResponse{}},
+	"POST /utils/estimate":     {summary: "Preview a request's tokens and cost, and the model and key limits it would break", request: estimateRequest{}, response: estimateResponse{}},
+
+	"GET /config/drift": {summary: "Differences between the database and the seed file: missing, unmanaged and changed entries", response: seed.Drift{}},
+
+	"GET /scim/v2/ServiceProviderConfig": {summary: "SCIM features supported by pxbin", files: scimFiles},
+	"GET /scim/v2/Users":                 {summary: "SCIM: list provisioned users", query: scimListParamsDoc("userName"), files: scimFiles},
+	"POST /scim/v2/Users":                {summary: "SCIM: provision a user with a new LLM key, returned once in the pxbin extension", status: http.StatusCreated, files: scimFiles},
+	"GET /scim/v2/Users/{id}":            {summary: "SCIM: get a user", files: scimFiles},
+	"PUT /scim/v2/Users/{id}":            {summary: "SCIM: replace a user; the key is active while the user is", files: scimFiles},
+	"PATCH /scim/v2/Users/{id}":          {summary: "SCIM: patch a user", files: scimFiles},
+	"DELETE /scim/v2/Users/{id}":         {summary: "SCIM: deprovision a user and deactivate their key", status: http.StatusNoContent},
+	"GET /scim/v2/Groups":                {summary: "SCIM: list teams", query: scimListParamsDoc("displayName"), files: scimFiles},
+	"POST /scim/v2/Groups":               {summary: "SCIM: create a team", status: http.StatusCreated, files: scimFiles},
+	"GET /scim/v2/Groups/{id}":           {summary: "SCIM: get a team", files: scimFiles},
+	"PUT /scim/v2/Groups/{id}":           {summary: "SCIM: replace a team and its members", files: scimFiles},
+	"PATCH /scim/v2/Groups/{id}":         {summary: "SCIM: patch a team, e.g. to add or remove members", files: scimFiles},
+	"DELETE /scim/v2/Groups/{id}":        {summary: "SCIM: delete a team", status: http.StatusNoContent},
+}
+
+var scimFiles = []string{"application/scim+json"}
+
+func scimListParamsDoc(nameAttr string) []queryParam {
+	return []queryParam{
+		{"filter", "string", nameAttr + ` eq "value" or externalId eq "value"`},
+		{"startIndex", "integer", "1-based index of the first result"},
+		{"count", "integer", "Maximum results (default 100, max 1000)"},
+	}
+}
+
+// bootstrapDoc documents POST /bootstrap, which is served outside the
+// management router and authenticated with the bootstrap key.
+var bootstrapDoc = endpointDoc{
+	summary:  "Create an API key with the bootstrap key; only available when management_bootstrap_key is set",
+	request:  createKeyRequest{},
+	response: createKeyResponse{},
+	status:   http.StatusCreated,
+}
+
+// sharedLogDoc documents GET /shared/logs/{id}, which is served outside the
+// management router and authorized by the link's signature.
+var sharedLogDoc = endpointDoc{
+	summary: "Get a request log through a link from POST /logs/{id}/share",
+	query: []queryParam{
+		{"expires", "integer", "Link expiry, Unix seconds"},
+		{"sig", "string", "Link signature"},
+	},
+	response: sharedLogResponse{},
+}
+
+// publicUsageDoc documents GET /public/usage, which is served outside the
+// management router without authentication.
+var publicUsageDoc = endpointDoc{
+	summary:  "Get noised, rounded per-model daily usage; only available when public_usage_enabled is set",
+	response: publicUsageReport{},
+}
+
+// OpenAPIHandler serves an OpenAPI 3 document describing the management
+// routes registered on router.
+func OpenAPIHandler(router chi.Routes) http.Handler {
+	doc, err := buildOpenAPI(router)
+	body, merr := json.MarshalIndent(doc, "", "  ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil || merr != nil {
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to build OpenAPI document")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
+
+// buildOpenAPI walks router and documents every route. Routes missing from
+// endpointDocs are still listed, with only their path parameters.
+func buildOpenAPI(router chi.Routes) (map[string]any, error) {
+	g := &schemaGen{schemas: map[string]any{
+		"Error": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"error": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"type":    map[string]any{"type": "string", "description": "Class of the error, e.g. invalid_request or not_found"},
+						"code":    map[string]any{"type": "string", "description": "Specific cause, e.g. validation_failed or name_conflict"},
+						"message": map[string]any{"type": "string"},
+						"fields":  map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/FieldError"}},
+					},
+				},
+			},
+		},
+		"Problem": map[string]any{
+			"type":        "object",
+			"description": "RFC 7807 problem document, sent instead of Error to clients that accept application/problem+json",
+			"properties": map[string]any{
+				"type":   map[string]any{"type": "string", "description": "urn:pxbin:error:<code>"},
+				"title":  map[string]any{"type": "string"},
+				"status": map[string]any{"type": "integer"},
+				"detail": map[string]any{"type": "string"},
+				"code":   map[string]any{"type": "string"},
+				"errors": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/FieldError"}},
+			},
+		},
+		"FieldError": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"field":   map[string]any{"type": "string"},
+				"message": map[string]any{"type": "string"},
+			},
+		},
+		"Meta": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"total":    map[string]any{"type": "integer"},
+				"page":     map[string]any{"type": "integer"},
+				"per_page": map[string]any{"type": "integer"},
+			},
+		},
+	}}
+
+	paths := map[string]map[string]any{}
+	add := func(method, path string, doc endpointDoc, security []map[string][]string) {
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		op := g.operation(method, path, doc)
+		if security != nil {
+			op["security"] = security
+		}
+		paths[path][strings.ToLower(method)] = op
+	}
+
+	err := chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		path := normalizeRoutePath(route)
+		add(method, path, endpointDocs[method+" "+path], nil)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk management routes: %w", err)
+	}
+	add(http.MethodPost, "/bootstrap", bootstrapDoc, []map[string][]string{{"bootstrapKey": {}}})
+	add(http.MethodGet, "/shared/logs/{id}", sharedLogDoc, []map[string][]string{})
+	add(http.MethodGet, "/public/usage", publicUsageDoc, []map[string][]string{})
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "pxbin management API",
+			"version": "v1",
+		},
+		"servers": []map[string]any{{"url": "/api/v1"}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth":   map[string]any{"type": "http", "scheme": "bearer", "description": "Management key (pxm_*)"},
+				"apiKeyAuth":   map[string]any{"type": "apiKey", "in": "header", "name": "x-api-key", "description": "Management key (pxm_*)"},
+				"bootstrapKey": map[string]any{"type": "http", "scheme": "bearer", "description": "management_bootstrap_key"},
+			},
+		},
+		"security": []map[string][]string{{"bearerAuth": {}}, {"apiKeyAuth": {}}},
+	}, nil
+}
+
+// normalizeRoutePath turns a chi route pattern into an OpenAPI path:
+// "/keys/" becomes "/keys".
+func normalizeRoutePath(route string) string {
+	if len(route) > 1 {
+		route = strings.TrimSuffix(route, "/")
+	}
+	return route
+}
+
+func (g *schemaGen) operation(method, path string, doc endpointDoc) map[string]any {
+	op := map[string]any{
+		"operationId": operationID(method, path),
+		"tags":        []string{strings.Split(strings.TrimPrefix(path, "/"), "/")[0]},
+	}
+	if doc.summary != "" {
+		op["summary"] = doc.summary
+	}
+
+	var params []map[string]any
+	for _, seg := range strings.Split(path, "/") {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			name := seg[1 : len(seg)-1]
+			schema := map[string]any{"type": "string"}
+			if name == "id" {
+				schema["format"] = "uuid"
+			}
+			params = append(params, map[string]any{"name": name, "in": "path", "required": true, "schema": schema})
+		}
+	}
+	for _, q := range doc.query {
+		params = append(params, map[string]any{
+			"name":        q.name,
+			"in":          "query",
+			"description": q.description,
+			"schema":      map[string]any{"type": q.typ},
+		})
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if doc.request != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(doc.request))},
+			},
+		}
+	}
+
+	envelope := map[string]any{"type": "object", "properties": map[string]any{}}
+	if doc.response != nil {
+		envelope["properties"].(map[string]any)["data"] = g.schema(reflect.TypeOf(doc.response))
+	}
+	if doc.paginated {
+		envelope["properties"].(map[string]any)["meta"] = map[string]any{"$ref": "#/components/schemas/Meta"}
+	}
+	status := doc.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	content := map[string]any{"application/json": map[string]any{"schema": envelope}}
+	if len(doc.files) > 0 {
+		content = map[string]any{}
+		for _, typ := range doc.files {
+			content[typ] = map[string]any{"schema": map[string]any{"type": "string"}}
+		}
+	}
+	op["responses"] = map[string]any{
+		fmt.Sprint(status): map[string]any{
+			"description": http.StatusText(status),
+			"content":     content,
+		},
+		"default": map[string]any{
+			"description": "Error",
+			"content": map[string]any{
+				"application/json":   map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}},
+				apierror.ProblemJSON: map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Problem"}},
+			},
+		},
+	}
+	return op
+}
+
+// operationID derives a stable camel-case ID, e.g. "GET /keys/{id}/usage"
+// becomes "getKeysIdUsage".
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, seg := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '-' || r == '_'
+	}) {
+		b.WriteString(strings.ToUpper(seg[:1]) + seg[1:])
+	}
+	return b.String()
+}
+
+// schemaGen derives JSON schemas from Go types. Named structs become
+// components referenced by name.
+type schemaGen struct {
+	schemas map[string]any
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	uuidType    = reflect.TypeOf(uuid.UUID{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case uuidType:
+		return map[string]any{"type": "string", "format": "uuid"}
+	case rawJSONType:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := g.schema(t.Elem())
+		if _, ref := s["$ref"]; ref {
+			return map[string]any{"allOf": []any{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := componentName(t)
+		if _, ok := g.schemas[name]; !ok {
+			g.schemas[name] = map[string]any{} // placeholder for recursive types
+			g.schemas[name] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	// Interfaces and anything else accept any JSON value.
+	return map[string]any{}
+}
+
+func (g *schemaGen) structSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	g.addFields(t, props)
+	return map[string]any{"type": "object", "properties": props}
+}
+
+// addFields adds t's JSON fields to props, flattening embedded structs the
+// way encoding/json does.
+func (g *schemaGen) addFields(t reflect.Type, props map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(ft, props)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+	}
+}
+
+// componentName names a struct's schema after its Go type, capitalised so
+// unexported handler types read like the rest.
+func componentName(t reflect.Type) string {
+	r := []rune(t.Name())
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
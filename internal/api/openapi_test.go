@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	noAuth := func(next http.Handler) http.Handler { return next }
+	router := NewRouter(nil, noAuth, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, "", nil)
+
+	routed := map[string]bool{}
+	chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routed[method+" "+normalizeRoutePath(route)] = true
+		return nil
+	})
+	for route := range routed {
+		if _, ok := endpointDocs[route]; !ok {
+			t.Errorf("route %s is missing from endpointDocs", route)
+		}
+	}
+	for route := range endpointDocs {
+		if !routed[route] {
+			t.Errorf("endpointDocs has %s, which is not routed", route)
+		}
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	noAuth := func(next http.Handler) http.Handler { return next }
+	rec := httptest.NewRecorder()
+	OpenAPIHandler(NewRouter(nil, noAuth, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, "", nil)).ServeHTTP(rec, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			Parameters []struct {
+				Name string `json:"name"`
+				In   string `json:"in"`
+			} `json:"parameters"`
+			RequestBody *struct {
+				Content map[string]struct {
+					Schema map[string]any `json:"schema"`
+				} `json:"content"`
+			} `json:"requestBody"`
+			Responses map[string]any `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if doc.OpenAPI != "3.0.3" {
+		t.Fatalf("unexpected openapi version %q", doc.OpenAPI)
+	}
+
+	usage, ok := doc.Paths["/keys/{id}/usage"]["get"]
+	if !ok {
+		t.Fatal("missing GET /keys/{id}/usage")
+	}
+	params := map[string]string{}
+	for _, p := range usage.Parameters {
+		params[p.Name] = p.In
+	}
+	if params["id"] != "path" || params["period"] != "query" {
+		t.Fatalf("unexpected parameters: %v", params)
+	}
+
+	create, ok := doc.Paths["/upstreams"]["post"]
+	if !ok || create.RequestBody == nil {
+		t.Fatal("missing POST /upstreams request body")
+	}
+	if ref := create.RequestBody.Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/UpstreamCreate" {
+		t.Fatalf("unexpected request schema %v", ref)
+	}
+	if _, ok := create.Responses["201"]; !ok {
+		t.Fatalf("expected a 201 response, got %v", create.Responses)
+	}
+
+	upstream := doc.Components.Schemas["Upstream"].Properties
+	if upstream["created_at"]["format"] != "date-time" || upstream["id"]["format"] != "uuid" {
+		t.Fatalf("unexpected Upstream schema: %v", upstream)
+	}
+	if _, ok := upstream["api_key_encrypted"]; ok {
+		t.Fatal("fields tagged json:\"-\" must not be documented")
+	}
+	// Embedded structs are flattened like encoding/json does.
+	if _, ok := doc.Components.Schemas["CanaryResponse"].Properties["stats"]; !ok {
+		t.Fatal("expected CanaryResponse to include stats")
+	}
+	if _, ok := doc.Paths["/bootstrap"]["post"]; !ok {
+		t.Fatal("missing POST /bootstrap")
+	}
+}
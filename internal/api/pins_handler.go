@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+const (
+	defaultPinTTL = time.Hour
+	maxPinTTL     = 7 * 24 * time.Hour
+)
+
+// PinReloader applies pin changes to the proxy without waiting for its
+// periodic reload.
+type PinReloader interface {
+	Reload(ctx context.Context) error
+}
+
+type pinsHandler struct {
+	store store.Store
+	pins  PinReloader // nil when the proxy only picks up pins periodically
+}
+
+// pinRequest pins llm_key_id, or every key when it is omitted, to
+// upstream_id for ttl_seconds.
+type pinRequest struct {
+	store.UpstreamPinCreate
+	TTLSeconds int `json:"ttl_seconds"`
+}
+
+// List returns the pins in force.
+func (h *pinsHandler) List(w http.ResponseWriter, r *http.Request) {
+	pins, err := h.store.ListUpstreamPins(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list pins")
+		return
+	}
+	writeData(w, pins)
+}
+
+// Create pins a key, or every key, to an upstream, replacing its current
+// pin.
+func (h *pinsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req pinRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+	ttl := defaultPinTTL
+	if req.TTLSeconds != 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl < time.Minute || ttl > maxPinTTL {
+		writeFieldError(w, r, "ttl_seconds", "must be between 60 and 604800")
+		return
+	}
+	if req.UpstreamID == uuid.Nil {
+		writeFieldError(w, r, "upstream_id", "is required")
+		return
+	}
+
+	upstream, err := h.store.GetUpstream(r.Context(), req.UpstreamID)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch upstream")
+		return
+	}
+	if upstream == nil || !upstream.IsActive {
+		writeFieldError(w, r, "upstream_id", "must name an active upstream")
+		return
+	}
+	if req.KeyID != nil {
+		key, err := h.store.GetLLMKey(r.Context(), *req.KeyID)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch key")
+			return
+		}
+		if key == nil {
+			writeFieldError(w, r, "llm_key_id", "must name an LLM key")
+			return
+		}
+	}
+
+	req.ExpiresAt = time.Now().Add(ttl)
+	pin, err := h.store.CreateUpstreamPin(r.Context(), &req.UpstreamPinCreate)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to create pin")
+		return
+	}
+	reloadNow(r.Context(), h.pins, "pins")
+
+	writeJSON(w, http.StatusCreated, response{Data: pin})
+}
+
+// Delete lifts a pin before it expires.
+func (h *pinsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+
+	ok, err := h.store.DeleteUpstreamPin(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to delete pin")
+		return
+	}
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "not_found", "Pin not found")
+		return
+	}
+	reloadNow(r.Context(), h.pins, "pins")
+
+	writeData(w, statusResponse{Status: "deleted"})
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/policy"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+type policiesHandler struct {
+	store store.Store
+}
+
+func (h *policiesHandler) List(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.store.ListPolicies(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list policies")
+		return
+	}
+	writeData(w, policies)
+}
+
+func (h *policiesHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req store.PolicyCreate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+	var errs fieldErrors
+	if req.Name == "" {
+		errs.add("name", "is required")
+	}
+	validatePolicy(&errs, "", req.Expression, req.Action, req.TargetModel, req.MaxTokens)
+	if errs.write(w, r) {
+		return
+	}
+	if !h.checkNameConflict(w, r, req.Name, nil) {
+		return
+	}
+
+	p, err := h.store.CreatePolicy(r.Context(), &req)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to create policy")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, response{Data: p})
+}
+
+func (h *policiesHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+
+	var updates store.PolicyUpdate
+	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+
+	// Validate the policy as it will look after the update.
+	existing, err := h.store.GetPolicy(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch policy")
+		return
+	}
+	if existing == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Policy not found")
+		return
+	}
+	expr, action, target, maxTokens := existing.Expression, existing.Action, existing.TargetModel, existing.MaxTokens
+	if updates.Expression != nil {
+		expr = *updates.Expression
+	}
+	if updates.Action != nil {
+		action = *updates.Action
+	}
+	if updates.TargetModel != nil {
+		target = updates.TargetModel
+	}
+	if updates.MaxTokens != nil {
+		maxTokens = updates.MaxTokens
+	}
+	var errs fieldErrors
+	if updates.Name != nil && *updates.Name == "" {
+		errs.add("name", "must not be empty")
+	}
+	validatePolicy(&errs, "", expr, action, target, maxTokens)
+	if errs.write(w, r) {
+		return
+	}
+	if updates.Name != nil && !h.checkNameConflict(w, r, *updates.Name, &id) {
+		return
+	}
+
+	if err := h.store.UpdatePolicy(r.Context(), id, &updates); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to update policy")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response{Data: map[string]string{"status": "updated"}})
+}
+
+func (h *policiesHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+
+	if err := h.store.DeletePolicy(r.Context(), id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to delete policy")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response{Data: map[string]string{"status": "deleted"}})
+}
+
+// checkNameConflict writes a 409 and returns false if a policy other than
+// exclude is already named name.
+func (h *policiesHandler) checkNameConflict(w http.ResponseWriter, r *http.Request, name string, exclude *uuid.UUID) bool {
+	policies, err := h.store.ListPolicies(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to check policy names")
+		return false
+	}
+	for _, p := range policies {
+		if p.Name == name && (exclude == nil || p.ID != *exclude) {
+			writeErrorCode(w, r, http.StatusConflict, "conflict", "name_conflict", fmt.Sprintf("Policy %q already exists", name))
+			return false
+		}
+	}
+	return true
+}
+
+// validatePolicy adds the errors of a policy's expression and action, with
+// field names led by prefix.
+func validatePolicy(errs *fieldErrors, prefix, expr, action string, targetModel *string, maxTokens *int) {
+	if expr == "" {
+		errs.add(prefix+"expression", "is required")
+	} else if _, err := policy.Compile(expr); err != nil {
+		errs.add(prefix+"expression", "is invalid: "+err.Error())
+	}
+	if !policy.ValidAction(action) {
+		errs.add(prefix+"action", "must be 'allow', 'deny', 'route', 'cap', or 'filter'")
+	}
+	if action == policy.ActionRoute && (targetModel == nil || *targetModel == "") {
+		errs.add(prefix+"target_model", "is required for route policies")
+	}
+	if action == policy.ActionCap && (maxTokens == nil || *maxTokens <= 0) {
+		errs.add(prefix+"max_tokens", "must be positive for cap policies")
+	}
+}
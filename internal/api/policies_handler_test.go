@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestPoliciesHandlerNameConflict(t *testing.T) {
+	st := store.NewMemory()
+	h := &policiesHandler{store: st}
+	r := chi.NewRouter()
+	r.Post("/policies", h.Create)
+	r.Put("/policies/{id}", h.Update)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := do("POST", "/policies", `{"name":"deny-all","expression":"true","action":"deny"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do("POST", "/policies", `{"name":"allow-all","expression":"true","action":"allow"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec := do("POST", "/policies", `{"name":"deny-all","expression":"false","action":"deny"}`)
+	var body struct {
+		Error struct {
+			Type string `json:"type"`
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if rec.Code != http.StatusConflict || json.Unmarshal(rec.Body.Bytes(), &body) != nil || body.Error.Type != "conflict" || body.Error.Code != "name_conflict" {
+		t.Fatalf("duplicate create: expected 409 name_conflict, got %d: %s", rec.Code, rec.Body)
+	}
+
+	policies, err := st.ListPolicies(context.Background())
+	if err != nil || len(policies) != 2 {
+		t.Fatalf("list policies: %d, %v", len(policies), err)
+	}
+	var allow store.Policy
+	for _, p := range policies {
+		if p.Name == "allow-all" {
+			allow = p
+		}
+	}
+	if rec := do("PUT", "/policies/"+allow.ID.String(), `{"name":"deny-all"}`); rec.Code != http.StatusConflict {
+		t.Fatalf("rename onto another policy: expected 409, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do("PUT", "/policies/"+allow.ID.String(), `{"name":"allow-all","priority":5}`); rec.Code != http.StatusOK {
+		t.Fatalf("keeping its own name: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+}
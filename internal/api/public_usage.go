@@ -0,0 +1,163 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"math"
+	mrand "math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// publicUsageTokenClip caps the input and output tokens one request adds to
+// the published sums, which bounds the noise those sums need.
+const publicUsageTokenClip = 100_000
+
+// publicUsageCacheTTL is how long a report is served before the logs are
+// queried again. Reports only cover completed days, so they rarely change.
+const publicUsageCacheTTL = 10 * time.Minute
+
+// PublicUsageOpts configures the public usage report.
+type PublicUsageOpts struct {
+	Enabled       bool
+	Days          int     // completed UTC days covered
+	Epsilon       float64 // privacy budget per request; 0 adds no noise
+	RoundRequests int
+	RoundTokens   int
+	MinKeys       int    // fewest distinct keys a day and model needs to be shown
+	NoiseSecret   string // seeds the noise; empty picks a random one per process
+}
+
+type publicUsageRow struct {
+	Date         string `json:"date"`
+	Model        string `json:"model"`
+	Requests     int64  `json:"requests"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+}
+
+type publicUsageReport struct {
+	From          string           `json:"from"`
+	To            string           `json:"to"`
+	Epsilon       float64          `json:"epsilon"`
+	RoundRequests int              `json:"round_requests"`
+	RoundTokens   int              `json:"round_tokens"`
+	MinKeys       int              `json:"min_keys"`
+	Usage         []publicUsageRow `json:"usage"`
+}
+
+type publicUsage struct {
+	store  store.Store
+	opts   PublicUsageOpts
+	secret []byte
+	now    func() time.Time
+
+	mu       sync.Mutex
+	report   *publicUsageReport
+	cachedAt time.Time
+}
+
+// NewPublicUsageHandler returns an http.HandlerFunc serving per-model daily
+// usage without authentication, for vendors or status pages. Counts are
+// noised and rounded, days and models used by fewer than MinKeys keys are
+// left out, and nothing identifies a key. Returns nil if disabled.
+func NewPublicUsageHandler(s store.Store, opts PublicUsageOpts) http.HandlerFunc {
+	if !opts.Enabled {
+		return nil
+	}
+	h := &publicUsage{store: s, opts: opts, secret: []byte(opts.NoiseSecret), now: time.Now}
+	if len(h.secret) == 0 {
+		h.secret = make([]byte, 32)
+		rand.Read(h.secret)
+	}
+	return h.serve
+}
+
+func (h *publicUsage) serve(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.report == nil || h.now().Sub(h.cachedAt) >= publicUsageCacheTTL {
+		report, err := h.build(r)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get usage")
+			return
+		}
+		h.report, h.cachedAt = report, h.now()
+	}
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(publicUsageCacheTTL/time.Second)))
+	writeData(w, h.report)
+}
+
+// build aggregates the completed UTC days of the window.
+func (h *publicUsage) build(r *http.Request) (*publicUsageReport, error) {
+	now := h.now().UTC()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, 0, -h.opts.Days)
+	usage, err := h.store.GetDailyModelUsage(r.Context(), from, to, publicUsageTokenClip)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &publicUsageReport{
+		From:          from.Format(time.DateOnly),
+		To:            to.AddDate(0, 0, -1).Format(time.DateOnly),
+		Epsilon:       h.opts.Epsilon,
+		RoundRequests: h.opts.RoundRequests,
+		RoundTokens:   h.opts.RoundTokens,
+		MinKeys:       h.opts.MinKeys,
+		Usage:         []publicUsageRow{},
+	}
+	for _, u := range usage {
+		if u.Keys < h.opts.MinKeys {
+			continue
+		}
+		row := publicUsageRow{Date: u.Day.Format(time.DateOnly), Model: u.Model}
+		rng := h.rng(row.Date, row.Model)
+		row.Requests = h.release(rng, float64(u.Requests), 1, h.opts.RoundRequests)
+		row.InputTokens = h.release(rng, float64(u.InputTokens), publicUsageTokenClip, h.opts.RoundTokens)
+		row.OutputTokens = h.release(rng, float64(u.OutputTokens), publicUsageTokenClip, h.opts.RoundTokens)
+		if row.Requests > 0 {
+			report.Usage = append(report.Usage, row)
+		}
+	}
+	return report, nil
+}
+
+// rng returns the noise source of one day and model. It is seeded from the
+// secret so the same figures get the same noise on every request, rather
+// than fresh noise that averaging repeated requests would cancel out.
+func (h *publicUsage) rng(date, model string) *mrand.Rand {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte("pxbin-public-usage-v1:" + date + ":" + model))
+	var seed [32]byte
+	copy(seed[:], mac.Sum(nil))
+	return mrand.New(mrand.NewChaCha8(seed))
+}
+
+// release adds Laplace noise to v, which one request changes by at most
+// sensitivity, then rounds it to a multiple of step. The epsilon budget is
+// split evenly between the three figures of a row.
+func (h *publicUsage) release(rng *mrand.Rand, v, sensitivity float64, step int) int64 {
+	if h.opts.Epsilon > 0 {
+		v += laplace(rng, 3*sensitivity/h.opts.Epsilon)
+	}
+	return max(0, int64(math.Round(v/float64(step)))*int64(step))
+}
+
+// laplace draws from the Laplace distribution centred on 0 with the given
+// scale.
+func laplace(rng *mrand.Rand, scale float64) float64 {
+	u := rng.Float64() - 0.5
+	for u == -0.5 {
+		u = rng.Float64() - 0.5
+	}
+	if u < 0 {
+		return scale * math.Log(1+2*u)
+	}
+	return -scale * math.Log(1-2*u)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestPublicUsageHandler(t *testing.T) {
+	st := store.NewMemory()
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	yesterday := now.AddDate(0, 0, -1)
+	keys := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	var entries []*store.LogEntry
+	for i := range 45 {
+		entries = append(entries, &store.LogEntry{
+			KeyID: keys[i%3], Timestamp: yesterday, Model: "shared-model",
+			InputTokens: 1000, OutputTokens: 500_000,
+		})
+	}
+	entries = append(entries,
+		// One key alone on a model is left out.
+		&store.LogEntry{KeyID: keys[0], Timestamp: yesterday, Model: "private-model", InputTokens: 10},
+		// Today is not complete yet.
+		&store.LogEntry{KeyID: keys[1], Timestamp: now, Model: "shared-model"},
+	)
+	if err := st.InsertLogBatch(context.Background(), entries); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(opts PublicUsageOpts) (string, publicUsageReport) {
+		opts.Enabled = true
+		h := &publicUsage{store: st, opts: opts, secret: []byte("secret"), now: func() time.Time { return now }}
+		rec := httptest.NewRecorder()
+		h.serve(rec, httptest.NewRequest("GET", "/api/v1/public/usage", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		var resp struct{ Data publicUsageReport }
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Body.String(), resp.Data
+	}
+
+	body, report := serve(PublicUsageOpts{Days: 7, RoundRequests: 10, RoundTokens: 10000, MinKeys: 3})
+	if report.From != "2026-03-03" || report.To != "2026-03-09" {
+		t.Fatalf("expected the last 7 complete days, got %s to %s", report.From, report.To)
+	}
+	want := publicUsageRow{Date: "2026-03-09", Model: "shared-model", Requests: 50, InputTokens: 50000, OutputTokens: 4_500_000}
+	if len(report.Usage) != 1 || report.Usage[0] != want {
+		t.Fatalf("expected only %+v, rounded with clipped tokens, got %+v", want, report.Usage)
+	}
+	for _, k := range keys {
+		if strings.Contains(body, k.String()) {
+			t.Fatal("expected no key IDs in the report")
+		}
+	}
+
+	_, noised := serve(PublicUsageOpts{Days: 7, Epsilon: 0.5, RoundRequests: 1, RoundTokens: 1, MinKeys: 3})
+	_, again := serve(PublicUsageOpts{Days: 7, Epsilon: 0.5, RoundRequests: 1, RoundTokens: 1, MinKeys: 3})
+	if len(noised.Usage) != 1 || noised.Usage[0] == (publicUsageRow{Date: "2026-03-09", Model: "shared-model", Requests: 45, InputTokens: 45000, OutputTokens: 4_500_000}) {
+		t.Fatalf("expected noised figures, got %+v", noised.Usage)
+	}
+	if again.Usage[0] != noised.Usage[0] {
+		t.Fatalf("expected the same noise on every request, got %+v and %+v", noised.Usage[0], again.Usage[0])
+	}
+
+	if NewPublicUsageHandler(st, PublicUsageOpts{}) != nil {
+		t.Fatal("expected the report to be disabled by default")
+	}
+}
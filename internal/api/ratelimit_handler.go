@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/ratelimit"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+type rateLimitHandler struct {
+	store   store.Store
+	limiter ratelimit.Limiter // nil when rate limiting is disabled
+}
+
+// rateLimitStanding is a key's bucket state, with the key's name and its
+// configured per-key rate_limit when the bucket belongs to an API key.
+// Buckets of unauthenticated requests are keyed by client address.
+type rateLimitStanding struct {
+	ratelimit.Standing
+	Name      string `json:"name,omitempty"`
+	RateLimit *int   `json:"rate_limit,omitempty"`
+}
+
+type rateLimitResponse struct {
+	Enabled bool `json:"enabled"`
+	ratelimit.Stats
+	TopKeys []rateLimitStanding `json:"top_keys"`
+}
+
+// Get returns the limiter's totals and the keys with the most rejections.
+func (h *rateLimitHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if h.limiter == nil {
+		writeData(w, rateLimitResponse{TopKeys: []rateLimitStanding{}})
+		return
+	}
+
+	limit := queryInt(r, "limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	standings := h.limiter.Standings()
+	if len(standings) > limit {
+		standings = standings[:limit]
+	}
+
+	resp := rateLimitResponse{Enabled: true, Stats: h.limiter.Stats(), TopKeys: make([]rateLimitStanding, 0, len(standings))}
+	for _, st := range standings {
+		entry := rateLimitStanding{Standing: st}
+		if id, err := uuid.Parse(st.Key); err == nil && h.store != nil {
+			key, err := h.store.GetLLMKey(r.Context(), id)
+			if err != nil {
+				writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch key")
+				return
+			}
+			if key != nil {
+				entry.Name, entry.RateLimit = key.Name, key.RateLimit
+			}
+		}
+		resp.TopKeys = append(resp.TopKeys, entry)
+	}
+	writeData(w, resp)
+}
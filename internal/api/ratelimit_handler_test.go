@@ -0,0 +1,42 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sertdev/pxbin/internal/ratelimit"
+)
+
+func TestRateLimitHandler(t *testing.T) {
+	l := ratelimit.NewMemoryLimiter(0.001, 1)
+	defer l.Close()
+	for i := 0; i < 3; i++ {
+		l.Allow("10.0.0.1:1234")
+	}
+	l.Allow("10.0.0.2:1234")
+
+	rec := httptest.NewRecorder()
+	h := &rateLimitHandler{limiter: l}
+	h.Get(rec, httptest.NewRequest("GET", "/ratelimit?limit=1", nil))
+
+	var body struct {
+		Data rateLimitResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	got := body.Data
+	if !got.Enabled || got.Rejected != 2 || got.Keys != 2 {
+		t.Fatalf("unexpected totals: %+v", got)
+	}
+	if len(got.TopKeys) != 1 || got.TopKeys[0].Key != "10.0.0.1:1234" || got.TopKeys[0].Rejected != 2 {
+		t.Fatalf("expected only the most rejected key, got %+v", got.TopKeys)
+	}
+
+	rec = httptest.NewRecorder()
+	(&rateLimitHandler{}).Get(rec, httptest.NewRequest("GET", "/ratelimit", nil))
+	if rec.Code != 200 || json.Unmarshal(rec.Body.Bytes(), &body) != nil || body.Data.Enabled {
+		t.Fatalf("expected a disabled report, got %d %s", rec.Code, rec.Body)
+	}
+}
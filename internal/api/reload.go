@@ -0,0 +1,24 @@
+package api
+
+import (
+	"context"
+	"log"
+)
+
+// reloader is what GuardrailReloader, PinReloader and AuditReloader have in
+// common.
+type reloader interface {
+	Reload(ctx context.Context) error
+}
+
+// reloadNow applies a change to the proxy right away, if rl is set. If it
+// fails, the proxy still picks the change up on its next periodic reload;
+// the error is logged under prefix.
+func reloadNow(ctx context.Context, rl reloader, prefix string) {
+	if rl == nil {
+		return
+	}
+	if err := rl.Reload(ctx); err != nil {
+		log.Printf("%s: reload failed: %v", prefix, err)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
+
+	"github.com/sertdev/pxbin/internal/apierror"
 )
 
 type response struct {
@@ -17,13 +20,17 @@ type meta struct {
 	PerPage int `json:"per_page"`
 }
 
-type errorResponse struct {
-	Error errorBody `json:"error"`
+// statusResponse is the data of responses that only confirm an action.
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+type bulkDeleteRequest struct {
+	IDs []string `json:"ids"`
 }
 
-type errorBody struct {
-	Type    string `json:"type"`
-	Message string `json:"message"`
+type bulkDeleteResponse struct {
+	Deleted int64 `json:"deleted"`
 }
 
 func writeJSON(w http.ResponseWriter, status int, v any) {
@@ -43,10 +50,62 @@ func writeDataPaginated(w http.ResponseWriter, data any, total, page, perPage in
 	})
 }
 
-func writeError(w http.ResponseWriter, status int, errType, message string) {
-	writeJSON(w, status, errorResponse{
-		Error: errorBody{Type: errType, Message: message},
+// writeError responds with an error whose code is its type.
+func writeError(w http.ResponseWriter, r *http.Request, status int, errType, message string) {
+	apierror.Write(w, r, status, &apierror.Error{Type: errType, Message: message})
+}
+
+// writeErrorCode responds with an error with a code more specific than its
+// type.
+func writeErrorCode(w http.ResponseWriter, r *http.Request, status int, errType, code, message string) {
+	apierror.Write(w, r, status, &apierror.Error{Type: errType, Code: code, Message: message})
+}
+
+func writeInvalidJSON(w http.ResponseWriter, r *http.Request) {
+	writeErrorCode(w, r, http.StatusBadRequest, "invalid_request", "invalid_json", "Invalid JSON body")
+}
+
+func writeInvalidID(w http.ResponseWriter, r *http.Request) {
+	writeErrorCode(w, r, http.StatusBadRequest, "invalid_request", "invalid_id", "Invalid ID format")
+}
+
+// fieldErrors collects the invalid fields of a create or update request, so
+// they are reported together.
+type fieldErrors []apierror.FieldError
+
+func (fe *fieldErrors) add(field, message string) {
+	*fe = append(*fe, apierror.FieldError{Field: field, Message: message})
+}
+
+// check adds err's message for field if err is not nil.
+func (fe *fieldErrors) check(field string, err error) {
+	if err != nil {
+		fe.add(field, err.Error())
+	}
+}
+
+// write responds with a validation_failed error listing the invalid fields,
+// if there are any, and reports whether it did.
+func (fe fieldErrors) write(w http.ResponseWriter, r *http.Request) bool {
+	if len(fe) == 0 {
+		return false
+	}
+	msgs := make([]string, len(fe))
+	for i, f := range fe {
+		msgs[i] = f.Field + " " + f.Message
+	}
+	apierror.Write(w, r, http.StatusBadRequest, &apierror.Error{
+		Type:    "invalid_request",
+		Code:    "validation_failed",
+		Message: strings.Join(msgs, "; "),
+		Fields:  fe,
 	})
+	return true
+}
+
+// writeFieldError responds with a validation_failed error for one field.
+func writeFieldError(w http.ResponseWriter, r *http.Request, field, message string) {
+	fieldErrors{{Field: field, Message: message}}.write(w, r)
 }
 
 func queryInt(r *http.Request, key string, defaultVal int) int {
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sertdev/pxbin/internal/apierror"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestManagementErrors(t *testing.T) {
+	noAuth := func(next http.Handler) http.Handler { return next }
+	router := NewRouter(store.NewMemory(), noAuth, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, "", nil)
+	do := func(method, path, body string, header http.Header) (int, apierror.Error) {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		var env struct{ Error apierror.Error }
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, path, err, w.Body)
+		}
+		return w.Code, env.Error
+	}
+
+	status, e := do("POST", "/upstreams", `{"format":"gemini","max_sse_frame_bytes":10}`, nil)
+	if status != http.StatusBadRequest || e.Type != "invalid_request" || e.Code != "validation_failed" {
+		t.Fatalf("expected a validation error, got %d %+v", status, e)
+	}
+	var fields []string
+	for _, f := range e.Fields {
+		fields = append(fields, f.Field)
+	}
+	if got := strings.Join(fields, ","); got != "name,base_url,api_key,format,max_sse_frame_bytes" {
+		t.Fatalf("expected every invalid field, got %s", got)
+	}
+	if !strings.Contains(e.Message, "format must be 'openai', 'anthropic', or 'vertex'") {
+		t.Fatalf("expected the fields in the message, got %q", e.Message)
+	}
+
+	status, e = do("POST", "/guardrails", `{"name":"g","kind":"regex","stage":"both","mode":"drop","patterns":["ok","("]}`, nil)
+	fields = fields[:0]
+	for _, f := range e.Fields {
+		fields = append(fields, f.Field)
+	}
+	if got := strings.Join(fields, ","); status != http.StatusBadRequest || got != "mode,patterns[1]" {
+		t.Fatalf("expected the mode and the invalid pattern, got %d %s", status, got)
+	}
+
+	for _, tt := range []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{"POST", "/policies", `{`, http.StatusBadRequest, "invalid_json"},
+		{"PATCH", "/models/nope", `{}`, http.StatusBadRequest, "invalid_id"},
+		{"GET", "/nope", ``, http.StatusNotFound, "route_not_found"},
+		{"PUT", "/policies/", ``, http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"GET", "/audit/samples", ``, http.StatusForbidden, "audit_permission_required"},
+	} {
+		if status, e := do(tt.method, tt.path, tt.body, nil); status != tt.status || e.Code != tt.code {
+			t.Errorf("%s %s: got %d %+v, want %d %s", tt.method, tt.path, status, e, tt.status, tt.code)
+		}
+	}
+
+	r := httptest.NewRequest("POST", "/policies", strings.NewReader(`{"name":"p","expression":"model ==","action":"route"}`))
+	r.Header.Set("Accept", apierror.ProblemJSON)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	var p struct {
+		Type   string
+		Status int
+		Errors []apierror.FieldError
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if w.Header().Get("Content-Type") != apierror.ProblemJSON || p.Type != "urn:pxbin:error:validation_failed" || p.Status != 400 || len(p.Errors) != 2 {
+		t.Fatalf("expected a problem document for the expression and target_model, got %s", w.Body)
+	}
+}
@@ -4,35 +4,76 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/sertdev/pxbin/internal/auth"
 	"github.com/sertdev/pxbin/internal/billing"
+	"github.com/sertdev/pxbin/internal/discovery"
+	"github.com/sertdev/pxbin/internal/events"
+	"github.com/sertdev/pxbin/internal/loopguard"
+	"github.com/sertdev/pxbin/internal/ratelimit"
+	"github.com/sertdev/pxbin/internal/scoreboard"
 	"github.com/sertdev/pxbin/internal/store"
+	"github.com/sertdev/pxbin/internal/streamtap"
 )
 
-func NewRouter(s *store.Store, authMw func(http.Handler) http.Handler, bt *billing.Tracker) chi.Router {
+func NewRouter(s store.Store, authMw func(http.Handler) http.Handler, bt *billing.Tracker, tarpit *auth.Tarpit, signer *LogSigner, limiter ratelimit.Limiter, syncer *discovery.Syncer, drain DrainController, taps *streamtap.Registry, scores *scoreboard.Board, pins PinReloader, audit AuditReloader, guardrails GuardrailReloader, self *loopguard.Self, scimMetadata map[string]string, seedFile string, ev *events.Bus) chi.Router {
 	r := chi.NewRouter()
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeErrorCode(w, r, http.StatusNotFound, "not_found", "route_not_found", "No management API route at "+r.URL.Path)
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeErrorCode(w, r, http.StatusMethodNotAllowed, "invalid_request", "method_not_allowed", r.Method+" is not allowed on "+r.URL.Path)
+	})
 
 	r.Group(func(r chi.Router) {
 		r.Use(authMw)
 
 		r.Route("/keys", func(r chi.Router) {
-			h := &keysHandler{store: s}
+			h := &keysHandler{store: s, billing: bt, events: ev}
 			r.Get("/", h.List)
 			r.Post("/", h.Create)
+			r.Get("/{id}/usage", h.Usage)
+			r.Get("/{id}/budget", h.Budget)
+			r.Put("/{id}/budget", h.SetBudget)
+			r.Get("/{id}/models", h.Models)
+			r.Put("/{id}/models", h.SetModels)
+			r.Delete("/{id}/models", h.DeleteModels)
+			r.Put("/{id}/team", h.SetTeam)
+			r.Delete("/{id}/team", h.DeleteTeam)
 			r.Patch("/{id}", h.Update)
 			r.Delete("/{id}", h.Delete)
 		})
 
+		r.Route("/teams", func(r chi.Router) {
+			h := &teamsHandler{store: s, billing: bt}
+			r.Get("/", h.List)
+			r.Post("/", h.Create)
+			r.Get("/{id}", h.Get)
+			r.Patch("/{id}", h.Update)
+			r.Delete("/{id}", h.Delete)
+			r.Put("/{id}/budget", h.SetBudget)
+		})
+
 		r.Route("/logs", func(r chi.Router) {
-			h := &logsHandler{store: s}
+			h := &logsHandler{store: s, signer: signer}
 			r.Get("/", h.List)
+			r.Get("/export", h.Export)
 			r.Get("/{id}", h.Get)
+			r.Get("/{id}/payload", h.Payload)
+			r.Post("/{id}/share", h.Share)
+		})
+
+		r.Route("/access-logs", func(r chi.Router) {
+			h := &accessLogsHandler{store: s}
+			r.Get("/", h.List)
 		})
 
 		r.Route("/models", func(r chi.Router) {
-			h := &modelsHandler{store: s, billing: bt}
+			h := &modelsHandler{store: s, billing: bt, syncer: syncer}
 			r.Get("/", h.List)
 			r.Post("/", h.Create)
 			r.Post("/discover", h.Discover)
+			r.Get("/drift", h.Drift)
+			r.Post("/sync", h.Sync)
 			r.Post("/import", h.Import)
 			r.Post("/sync-pricing", h.SyncPricing)
 			r.Post("/bulk-delete", h.BulkDelete)
@@ -41,8 +82,9 @@ func NewRouter(s *store.Store, authMw func(http.Handler) http.Handler, bt *billi
 		})
 
 		r.Route("/upstreams", func(r chi.Router) {
-			h := &upstreamsHandler{store: s}
+			h := &upstreamsHandler{store: s, scores: scores, self: self}
 			r.Get("/", h.List)
+			r.Get("/scoreboard", h.Scoreboard)
 			r.Post("/", h.Create)
 			r.Post("/bulk-delete", h.BulkDelete)
 			r.Post("/health-check", h.HealthCheck)
@@ -50,14 +92,128 @@ func NewRouter(s *store.Store, authMw func(http.Handler) http.Handler, bt *billi
 			r.Delete("/{id}", h.Delete)
 		})
 
+		r.Route("/upstream-pins", func(r chi.Router) {
+			h := &pinsHandler{store: s, pins: pins}
+			r.Get("/", h.List)
+			r.Post("/", h.Create)
+			r.Delete("/{id}", h.Delete)
+		})
+
+		r.Route("/audit", func(r chi.Router) {
+			h := &auditHandler{store: s, rules: audit}
+			r.Get("/rules", h.ListRules)
+			r.Post("/rules", h.SetRule)
+			r.Delete("/rules/{id}", h.DeleteRule)
+			r.Get("/samples", h.ListSamples)
+			r.Get("/samples/{id}", h.GetSample)
+		})
+
+		r.Route("/guardrails", func(r chi.Router) {
+			h := &guardrailsHandler{store: s, guardrails: guardrails}
+			r.Get("/", h.List)
+			r.Post("/", h.Create)
+			r.Patch("/{id}", h.Update)
+			r.Delete("/{id}", h.Delete)
+		})
+
+		r.Route("/policies", func(r chi.Router) {
+			h := &policiesHandler{store: s}
+			r.Get("/", h.List)
+			r.Post("/", h.Create)
+			r.Patch("/{id}", h.Update)
+			r.Delete("/{id}", h.Delete)
+		})
+
+		r.Route("/routers", func(r chi.Router) {
+			h := &routersHandler{store: s}
+			r.Get("/", h.List)
+			r.Post("/", h.Create)
+			r.Patch("/{id}", h.Update)
+			r.Delete("/{id}", h.Delete)
+		})
+
+		r.Route("/canaries", func(r chi.Router) {
+			h := &canariesHandler{store: s}
+			r.Get("/", h.List)
+			r.Post("/", h.Create)
+			r.Get("/{id}", h.Get)
+			r.Post("/{id}/promote", h.Promote)
+			r.Post("/{id}/rollback", h.RollBack)
+		})
+
 		r.Route("/stats", func(r chi.Router) {
 			h := &statsHandler{store: s}
 			r.Get("/overview", h.Overview)
 			r.Get("/by-key", h.ByKey)
+			r.Get("/teams", h.ByTeam)
+			r.Get("/by-team", h.ByTeam) // named like the other groupings
 			r.Get("/by-model", h.ByModel)
+			r.Get("/by-translation", h.ByTranslation)
+			r.Get("/provider-errors", h.ProviderErrors)
+			r.Get("/cache-injection", h.CacheInjection)
 			r.Get("/timeseries", h.TimeSeries)
 			r.Get("/latency", h.Latency)
 		})
+
+		r.Route("/auth/offenders", func(r chi.Router) {
+			h := &offendersHandler{tarpit: tarpit}
+			r.Get("/", h.List)
+			r.Delete("/{ip}", h.Clear)
+		})
+
+		r.Route("/ratelimit", func(r chi.Router) {
+			h := &rateLimitHandler{store: s, limiter: limiter}
+			r.Get("/", h.Get)
+		})
+
+		r.Route("/admin/drain", func(r chi.Router) {
+			h := &drainHandler{drain: drain}
+			r.Get("/", h.Get)
+			r.Post("/", h.Start)
+			r.Delete("/", h.Stop)
+		})
+
+		r.Route("/admin/streams", func(r chi.Router) {
+			h := &streamsHandler{taps: taps}
+			r.Get("/", h.List)
+			r.Get("/{requestID}/tail", h.Tail)
+		})
+
+		r.Route("/admin/migrations", func(r chi.Router) {
+			h := &migrationsHandler{store: s}
+			r.Get("/", h.Get)
+		})
+
+		r.Route("/config", func(r chi.Router) {
+			h := &seedHandler{store: s, seedFile: seedFile}
+			r.Get("/drift", h.Drift)
+		})
+
+		r.Route("/scim/v2", func(r chi.Router) {
+			h := &scimHandler{store: s, metadata: scimMetadata, events: ev}
+			if h.metadata == nil {
+				h.metadata = defaultSCIMKeyMetadata
+			}
+			r.Get("/ServiceProviderConfig", h.ServiceProviderConfig)
+			r.Get("/Users", h.ListUsers)
+			r.Post("/Users", h.CreateUser)
+			r.Get("/Users/{id}", h.GetUser)
+			r.Put("/Users/{id}", h.ReplaceUser)
+			r.Patch("/Users/{id}", h.PatchUser)
+			r.Delete("/Users/{id}", h.DeleteUser)
+			r.Get("/Groups", h.ListGroups)
+			r.Post("/Groups", h.CreateGroup)
+			r.Get("/Groups/{id}", h.GetGroup)
+			r.Put("/Groups/{id}", h.ReplaceGroup)
+			r.Patch("/Groups/{id}", h.PatchGroup)
+			r.Delete("/Groups/{id}", h.DeleteGroup)
+		})
+
+		r.Route("/utils", func(r chi.Router) {
+			h := &utilsHandler{store: s, billing: bt, limiter: limiter}
+			r.Post("/count_tokens", h.CountTokens)
+			r.Post("/estimate", h.Estimate)
+		})
 	})
 
 	return r
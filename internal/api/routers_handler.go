@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+type routersHandler struct {
+	store store.Store
+}
+
+func (h *routersHandler) List(w http.ResponseWriter, r *http.Request) {
+	routers, err := h.store.ListModelRouters(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list model routers")
+		return
+	}
+	writeData(w, routers)
+}
+
+func (h *routersHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req store.ModelRouterCreate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+	if validateRouter(req.Name, req.DefaultModel, req.Rules).write(w, r) {
+		return
+	}
+	if !h.checkNameConflict(w, r, req.Name, nil) {
+		return
+	}
+
+	mr, err := h.store.CreateModelRouter(r.Context(), &req)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to create model router")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, response{Data: mr})
+}
+
+func (h *routersHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+
+	var updates store.ModelRouterUpdate
+	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+
+	// Validate the router as it will look after the update.
+	existing, err := h.store.GetModelRouter(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch model router")
+		return
+	}
+	if existing == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Model router not found")
+		return
+	}
+	name, defaultModel, rules := existing.Name, existing.DefaultModel, existing.Rules
+	if updates.Name != nil {
+		name = *updates.Name
+	}
+	if updates.DefaultModel != nil {
+		defaultModel = *updates.DefaultModel
+	}
+	if updates.Rules != nil {
+		rules = *updates.Rules
+	}
+	if validateRouter(name, defaultModel, rules).write(w, r) {
+		return
+	}
+	if updates.Name != nil && !h.checkNameConflict(w, r, name, &id) {
+		return
+	}
+
+	if err := h.store.UpdateModelRouter(r.Context(), id, &updates); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to update model router")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response{Data: map[string]string{"status": "updated"}})
+}
+
+func (h *routersHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+
+	if err := h.store.DeleteModelRouter(r.Context(), id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to delete model router")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response{Data: map[string]string{"status": "deleted"}})
+}
+
+// validateRouter returns the router's invalid fields. A router cannot pick
+// itself.
+func validateRouter(name, defaultModel string, rules []store.RouterRule) fieldErrors {
+	var errs fieldErrors
+	if name == "" {
+		errs.add("name", "is required")
+	}
+	switch {
+	case defaultModel == "":
+		errs.add("default_model", "is required")
+	case strings.EqualFold(defaultModel, name):
+		errs.add("default_model", "must not be the router itself")
+	}
+	errs.check("rules", store.ValidateRouterRules(rules))
+	for i, rule := range rules {
+		if strings.EqualFold(rule.Model, name) {
+			errs.add(fmt.Sprintf("rules[%d].model", i), "must not be the router itself")
+		}
+	}
+	return errs
+}
+
+// checkNameConflict writes a 409 and returns false if name is already a
+// model's name or alias or another router's name, ignoring case.
+func (h *routersHandler) checkNameConflict(w http.ResponseWriter, r *http.Request, name string, exclude *uuid.UUID) bool {
+	conflict, err := routerNameConflict(r.Context(), h.store, name, exclude)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to check model names")
+		return false
+	}
+	if conflict != "" {
+		writeErrorCode(w, r, http.StatusConflict, "conflict", "name_conflict", conflict)
+		return false
+	}
+	return true
+}
+
+// routerNameConflict describes the model or router, other than router
+// exclude, that name would clash with, or returns "" if it is free.
+func routerNameConflict(ctx context.Context, s store.Store, name string, exclude *uuid.UUID) (string, error) {
+	model, err := s.ModelNameConflict(ctx, []string{name}, nil)
+	if err != nil {
+		return "", err
+	}
+	if model != "" {
+		return fmt.Sprintf("Name is already used by model %q (names are case-insensitive)", model), nil
+	}
+	routers, err := s.ListModelRouters(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, mr := range routers {
+		if strings.EqualFold(mr.Name, name) && (exclude == nil || mr.ID != *exclude) {
+			return fmt.Sprintf("Name is already used by router %q (names are case-insensitive)", mr.Name), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,641 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/events"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// Identity providers provision employees through a SCIM 2.0 service
+// (RFC 7643, RFC 7644) under /api/v1/scim/v2, authenticated with a
+// management key as the bearer token. Each User gets an LLM key that is
+// active while the user is, and each Group is a team recorded in its
+// members' key metadata.
+
+const (
+	scimUserSchema       = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema      = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimEnterpriseSchema = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	scimKeySchema        = "urn:pxbin:params:scim:schemas:extension:2.0:User"
+	scimListSchema       = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema      = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimConfigSchema     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+	scimMaxResults = 1000
+)
+
+// defaultSCIMKeyMetadata maps key metadata fields to the SCIM attributes
+// they are copied from, unless scim_key_metadata is configured.
+var defaultSCIMKeyMetadata = map[string]string{
+	"email":           "emails",
+	"display_name":    "displayName",
+	"title":           "title",
+	"department":      scimEnterpriseSchema + ":department",
+	"employee_number": scimEnterpriseSchema + ":employeeNumber",
+	"cost_center":     scimEnterpriseSchema + ":costCenter",
+}
+
+type scimHandler struct {
+	store    store.Store
+	metadata map[string]string // key metadata field -> SCIM attribute
+	events   *events.Bus       // nil when no event consumers are configured
+}
+
+type scimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	SCIMType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+type scimListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+func writeSCIM(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeSCIMError(w http.ResponseWriter, status int, scimType, detail string) {
+	writeSCIM(w, status, scimError{
+		Schemas:  []string{scimErrorSchema},
+		Status:   strconv.Itoa(status),
+		SCIMType: scimType,
+		Detail:   detail,
+	})
+}
+
+// ServiceProviderConfig describes the SCIM features pxbin supports.
+func (h *scimHandler) ServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	unsupported := map[string]bool{"supported": false}
+	writeSCIM(w, http.StatusOK, map[string]any{
+		"schemas":        []string{scimConfigSchema},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": scimMaxResults},
+		"changePassword": unsupported,
+		"sort":           unsupported,
+		"etag":           unsupported,
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "Management API key",
+			"description": "A pxbin management key sent as the bearer token",
+		}},
+	})
+}
+
+var scimListFilterRe = regexp.MustCompile(`(?i)^\s*(\w+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// scimListParams parses the filter, startIndex and count of a list
+// request. nameAttr is the attribute filtered by SCIMFilter.Name.
+func scimListParams(r *http.Request, nameAttr string) (store.SCIMFilter, int, int, string) {
+	var f store.SCIMFilter
+	q := r.URL.Query()
+	if v := q.Get("filter"); v != "" {
+		m := scimListFilterRe.FindStringSubmatch(v)
+		if m == nil {
+			return f, 0, 0, `filter must be of the form attribute eq "value"`
+		}
+		value := strings.ReplaceAll(m[2], `\"`, `"`)
+		switch {
+		case strings.EqualFold(m[1], nameAttr):
+			f.Name = &value
+		case strings.EqualFold(m[1], "externalId"):
+			f.ExternalID = &value
+		default:
+			return f, 0, 0, "filter supports " + nameAttr + " and externalId"
+		}
+	}
+	start := queryInt(r, "startIndex", 1)
+	if start < 1 {
+		start = 1
+	}
+	count := queryInt(r, "count", 100)
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxResults {
+		count = scimMaxResults
+	}
+	return f, start, count, ""
+}
+
+func scimID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeSCIMError(w, http.StatusNotFound, "", "Resource not found")
+		return id, false
+	}
+	return id, true
+}
+
+// decodeSCIMResource decodes a User or Group sent by the identity provider.
+func decodeSCIMResource(w http.ResponseWriter, r *http.Request) (map[string]any, bool) {
+	var res map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&res); err != nil || res == nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalidSyntax", "Invalid JSON body")
+		return nil, false
+	}
+	return res, true
+}
+
+func scimMeta(resourceType, location string, created, updated time.Time) map[string]any {
+	return map[string]any{
+		"resourceType": resourceType,
+		"created":      created.UTC().Format(time.RFC3339),
+		"lastModified": updated.UTC().Format(time.RFC3339),
+		"location":     location,
+	}
+}
+
+// --- Users ---
+
+// userWrite validates a User and derives what is stored for it. It
+// normalizes res in place.
+func (h *scimHandler) userWrite(res map[string]any) (*store.SCIMUserWrite, error) {
+	for _, attr := range []string{"id", "meta", "groups", "password", scimKeySchema} {
+		delete(res, scimKey(res, attr))
+	}
+
+	userName, _ := scimGet(res, "userName").(string)
+	userName = strings.TrimSpace(userName)
+	if userName == "" {
+		return nil, errors.New("userName is required")
+	}
+	scimSet(res, "userName", userName)
+
+	active := true
+	switch v := scimGet(res, "active").(type) {
+	case nil:
+	case bool:
+		active = v
+	case string: // some providers send "True" and "False"
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New("active must be a boolean")
+		}
+		active = b
+	default:
+		return nil, errors.New("active must be a boolean")
+	}
+	scimSet(res, "active", active)
+
+	w := &store.SCIMUserWrite{UserName: userName, Active: active, KeyName: userName}
+	if v, ok := scimGet(res, "externalId").(string); ok && v != "" {
+		w.ExternalID = &v
+	}
+	if v, ok := scimGet(res, "displayName").(string); ok && v != "" {
+		w.KeyName = v
+	}
+
+	w.Metadata = make(map[string]any, len(h.metadata))
+	for field, attr := range h.metadata {
+		if v := scimAttribute(res, attr); v != nil {
+			w.Metadata[field] = v
+		}
+	}
+
+	schemas := []any{scimUserSchema}
+	if _, ok := scimGet(res, scimEnterpriseSchema).(map[string]any); ok {
+		schemas = append(schemas, scimEnterpriseSchema)
+	}
+	scimSet(res, "schemas", schemas)
+
+	raw, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	w.Resource = raw
+	return w, nil
+}
+
+// userResource renders u as a SCIM User. key is the plaintext key, shown
+// only when it was just created.
+func userResource(r *http.Request, u *store.SCIMUser, key string) map[string]any {
+	res := map[string]any{}
+	json.Unmarshal(u.Resource, &res)
+	res["id"] = u.ID.String()
+	res["userName"] = u.UserName
+	res["active"] = u.Active
+	if u.ExternalID != nil {
+		res["externalId"] = *u.ExternalID
+	}
+	groups := make([]map[string]any, 0, len(u.Groups))
+	for _, g := range u.Groups {
+		groups = append(groups, map[string]any{"value": g.Value.String(), "display": g.Display, "type": "direct"})
+	}
+	res["groups"] = groups
+
+	ext := map[string]any{"llmKeyId": u.KeyID.String(), "keyPrefix": u.KeyPrefix}
+	if key != "" {
+		ext["key"] = key
+	}
+	res[scimKeySchema] = ext
+	schemas, _ := res["schemas"].([]any)
+	res["schemas"] = append(schemas, scimKeySchema)
+
+	res["meta"] = scimMeta("User", scimLocation(r, "Users", u.ID), u.CreatedAt, u.UpdatedAt)
+	return res
+}
+
+// scimLocation is the URL of a resource, relative to the SCIM base of r.
+func scimLocation(r *http.Request, kind string, id uuid.UUID) string {
+	base := r.URL.Path
+	if i := strings.Index(base, "/scim/v2/"); i >= 0 {
+		base = base[:i+len("/scim/v2/")]
+	}
+	return base + kind + "/" + id.String()
+}
+
+// ListUsers returns the provisioned users, filtered by userName or
+// externalId.
+func (h *scimHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	filter, start, count, msg := scimListParams(r, "userName")
+	if msg != "" {
+		writeSCIMError(w, http.StatusBadRequest, "invalidFilter", msg)
+		return
+	}
+	users, total, err := h.store.ListSCIMUsers(r.Context(), filter, start-1, count)
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", "Failed to list users")
+		return
+	}
+	resources := make([]any, 0, len(users))
+	for i := range users {
+		resources = append(resources, userResource(r, &users[i], ""))
+	}
+	writeSCIM(w, http.StatusOK, scimListResponse{
+		Schemas:      []string{scimListSchema},
+		TotalResults: total,
+		StartIndex:   start,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// CreateUser provisions a user with a new LLM key. The plaintext key is
+// returned once, in the pxbin extension of the response.
+func (h *scimHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	res, ok := decodeSCIMResource(w, r)
+	if !ok {
+		return
+	}
+	write, err := h.userWrite(res)
+	if err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	plaintext, hash, prefix := auth.GenerateLLMKey()
+	user, err := h.store.CreateSCIMUser(r.Context(), write, hash, prefix)
+	if errors.Is(err, store.ErrSCIMConflict) {
+		writeSCIMError(w, http.StatusConflict, "uniqueness", "userName is already provisioned")
+		return
+	}
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", "Failed to create user")
+		return
+	}
+	h.events.Emit(events.KeyCreated, user.KeyID, user.UserName, map[string]any{"scim_user_id": user.ID})
+	writeSCIM(w, http.StatusCreated, userResource(r, user, plaintext))
+}
+
+func (h *scimHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := scimID(w, r)
+	if !ok {
+		return
+	}
+	user, err := h.store.GetSCIMUser(r.Context(), id)
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", "Failed to fetch user")
+		return
+	}
+	if user == nil {
+		writeSCIMError(w, http.StatusNotFound, "", "User not found")
+		return
+	}
+	writeSCIM(w, http.StatusOK, userResource(r, user, ""))
+}
+
+// ReplaceUser overwrites a user; deactivating them deactivates their key.
+func (h *scimHandler) ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := scimID(w, r)
+	if !ok {
+		return
+	}
+	res, ok := decodeSCIMResource(w, r)
+	if !ok {
+		return
+	}
+	user, err := h.store.GetSCIMUser(r.Context(), id)
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", "Failed to fetch user")
+		return
+	}
+	if user == nil {
+		writeSCIMError(w, http.StatusNotFound, "", "User not found")
+		return
+	}
+	h.replaceUser(w, r, user, res)
+}
+
+// PatchUser applies a PatchOp to a user, as identity providers do to
+// deactivate leavers.
+func (h *scimHandler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := scimID(w, r)
+	if !ok {
+		return
+	}
+	var req scimPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalidSyntax", "Invalid JSON body")
+		return
+	}
+	user, err := h.store.GetSCIMUser(r.Context(), id)
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", "Failed to fetch user")
+		return
+	}
+	if user == nil {
+		writeSCIMError(w, http.StatusNotFound, "", "User not found")
+		return
+	}
+	res := map[string]any{}
+	json.Unmarshal(user.Resource, &res)
+	if err := applySCIMPatch(res, scimUserSchema, req.Operations); err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalidPath", err.Error())
+		return
+	}
+	h.replaceUser(w, r, user, res)
+}
+
+// replaceUser overwrites before with res, emitting an event if the user's
+// key is deactivated or activated again.
+func (h *scimHandler) replaceUser(w http.ResponseWriter, r *http.Request, before *store.SCIMUser, res map[string]any) {
+	write, err := h.userWrite(res)
+	if err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	user, err := h.store.ReplaceSCIMUser(r.Context(), before.ID, write)
+	if errors.Is(err, store.ErrSCIMConflict) {
+		writeSCIMError(w, http.StatusConflict, "uniqueness", "userName is already provisioned")
+		return
+	}
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", "Failed to update user")
+		return
+	}
+	if user == nil {
+		writeSCIMError(w, http.StatusNotFound, "", "User not found")
+		return
+	}
+	if user.Active != before.Active {
+		t := events.KeyDeactivated
+		if user.Active {
+			t = events.KeyReactivated
+		}
+		h.events.Emit(t, user.KeyID, user.UserName, map[string]any{"scim_user_id": user.ID})
+	}
+	writeSCIM(w, http.StatusOK, userResource(r, user, ""))
+}
+
+// DeleteUser deprovisions a user and deactivates their key.
+func (h *scimHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := scimID(w, r)
+	if !ok {
+		return
+	}
+	user, err := h.store.GetSCIMUser(r.Context(), id)
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", "Failed to fetch user")
+		return
+	}
+	deleted, err := h.store.DeleteSCIMUser(r.Context(), id)
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", "Failed to delete user")
+		return
+	}
+	if !deleted {
+		writeSCIMError(w, http.StatusNotFound, "", "User not found")
+		return
+	}
+	if user != nil && user.Active {
+		h.events.Emit(events.KeyDeactivated, user.KeyID, user.UserName, map[string]any{"scim_user_id": user.ID})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// --- Groups ---
+
+// groupWrite validates a Group and derives what is stored for it.
+func groupWrite(res map[string]any) (*store.SCIMGroupWrite, error) {
+	name, _ := scimGet(res, "displayName").(string)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("displayName is required")
+	}
+	w := &store.SCIMGroupWrite{DisplayName: name}
+	if v, ok := scimGet(res, "externalId").(string); ok && v != "" {
+		w.ExternalID = &v
+	}
+	members, _ := scimGet(res, "members").([]any)
+	for _, m := range members {
+		obj, _ := m.(map[string]any)
+		value, _ := scimGet(obj, "value").(string)
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, errors.New("members must reference users by id")
+		}
+		w.Members = append(w.Members, id)
+	}
+	return w, nil
+}
+
+func groupResource(r *http.Request, g *store.SCIMGroup) map[string]any {
+	members := make([]map[string]any, 0, len(g.Members))
+	for _, m := range g.Members {
+		members = append(members, map[string]any{
+			"value":   m.Value.String(),
+			"display": m.Display,
+			"$ref":    scimLocation(r, "Users", m.Value),
+		})
+	}
+	res := map[string]any{
+		"schemas":     []string{scimGroupSchema},
+		"id":          g.ID.String(),
+		"displayName": g.DisplayName,
+		"members":     members,
+		"meta":        scimMeta("Group", scimLocation(r, "Groups", g.ID), g.CreatedAt, g.UpdatedAt),
+	}
+	if g.ExternalID != nil {
+		res["externalId"] = *g.ExternalID
+	}
+	return res
+}
+
+// ListGroups returns the provisioned teams, filtered by displayName or
+// externalId.
+func (h *scimHandler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	filter, start, count, msg := scimListParams(r, "displayName")
+	if msg != "" {
+		writeSCIMError(w, http.StatusBadRequest, "invalidFilter", msg)
+		return
+	}
+	groups, total, err := h.store.ListSCIMGroups(r.Context(), filter, start-1, count)
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", "Failed to list groups")
+		return
+	}
+	resources := make([]any, 0, len(groups))
+	for i := range groups {
+		resources = append(resources, groupResource(r, &groups[i]))
+	}
+	writeSCIM(w, http.StatusOK, scimListResponse{
+		Schemas:      []string{scimListSchema},
+		TotalResults: total,
+		StartIndex:   start,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func (h *scimHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	res, ok := decodeSCIMResource(w, r)
+	if !ok {
+		return
+	}
+	write, err := groupWrite(res)
+	if err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	group, err := h.store.CreateSCIMGroup(r.Context(), write)
+	if errors.Is(err, store.ErrSCIMConflict) {
+		writeSCIMError(w, http.StatusConflict, "uniqueness", "displayName is already provisioned")
+		return
+	}
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", "Failed to create group")
+		return
+	}
+	writeSCIM(w, http.StatusCreated, groupResource(r, group))
+}
+
+func (h *scimHandler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	id, ok := scimID(w, r)
+	if !ok {
+		return
+	}
+	group, err := h.store.GetSCIMGroup(r.Context(), id)
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", "Failed to fetch group")
+		return
+	}
+	if group == nil {
+		writeSCIMError(w, http.StatusNotFound, "", "Group not found")
+		return
+	}
+	writeSCIM(w, http.StatusOK, groupResource(r, group))
+}
+
+func (h *scimHandler) ReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	id, ok := scimID(w, r)
+	if !ok {
+		return
+	}
+	res, ok := decodeSCIMResource(w, r)
+	if !ok {
+		return
+	}
+	h.replaceGroup(w, r, id, res)
+}
+
+// PatchGroup applies a PatchOp to a group, typically adding or removing
+// members as people join and leave a team.
+func (h *scimHandler) PatchGroup(w http.ResponseWriter, r *http.Request) {
+	id, ok := scimID(w, r)
+	if !ok {
+		return
+	}
+	var req scimPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalidSyntax", "Invalid JSON body")
+		return
+	}
+	group, err := h.store.GetSCIMGroup(r.Context(), id)
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", "Failed to fetch group")
+		return
+	}
+	if group == nil {
+		writeSCIMError(w, http.StatusNotFound, "", "Group not found")
+		return
+	}
+	// Round-trip through JSON so the patch sees the same types as a
+	// decoded request body.
+	var res map[string]any
+	raw, _ := json.Marshal(groupResource(r, group))
+	json.Unmarshal(raw, &res)
+	if err := applySCIMPatch(res, scimGroupSchema, req.Operations); err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalidPath", err.Error())
+		return
+	}
+	h.replaceGroup(w, r, id, res)
+}
+
+func (h *scimHandler) replaceGroup(w http.ResponseWriter, r *http.Request, id uuid.UUID, res map[string]any) {
+	write, err := groupWrite(res)
+	if err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	group, err := h.store.ReplaceSCIMGroup(r.Context(), id, write)
+	if errors.Is(err, store.ErrSCIMConflict) {
+		writeSCIMError(w, http.StatusConflict, "uniqueness", "displayName is already provisioned")
+		return
+	}
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", "Failed to update group")
+		return
+	}
+	if group == nil {
+		writeSCIMError(w, http.StatusNotFound, "", "Group not found")
+		return
+	}
+	writeSCIM(w, http.StatusOK, groupResource(r, group))
+}
+
+// DeleteGroup removes a team; its members keep their keys.
+func (h *scimHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	id, ok := scimID(w, r)
+	if !ok {
+		return
+	}
+	deleted, err := h.store.DeleteSCIMGroup(r.Context(), id)
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", "Failed to delete group")
+		return
+	}
+	if !deleted {
+		writeSCIMError(w, http.StatusNotFound, "", "Group not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,365 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SCIM resources are handled as decoded JSON maps so attributes pxbin does
+// not know about are kept as the identity provider wrote them. Attribute
+// names are case-insensitive, as in SCIM.
+
+// scimPatchOp is one operation of a PatchOp request (RFC 7644 §3.5.2).
+type scimPatchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+type scimPatchRequest struct {
+	Schemas    []string      `json:"schemas"`
+	Operations []scimPatchOp `json:"Operations"`
+}
+
+// scimPath is a parsed attribute path: attr, attr.sub or
+// attr[filterAttr eq "filterValue"].sub, optionally prefixed by a schema
+// URN.
+type scimPath struct {
+	schema      string // extension schema URN; "" for core attributes
+	attr        string
+	filterAttr  string
+	filterValue any
+	sub         string
+}
+
+var scimFilterRe = regexp.MustCompile(`(?i)^\s*(\w+)\s+eq\s+(?:"((?:[^"\\]|\\.)*)"|(true|false))\s*$`)
+
+// parseSCIMPath parses path. coreSchema is the URN of the resource's own
+// schema, whose prefix is dropped.
+func parseSCIMPath(path, coreSchema string) (scimPath, error) {
+	var p scimPath
+	rest := path
+	if strings.HasPrefix(strings.ToLower(rest), "urn:") {
+		// The attribute follows the last colon outside a filter.
+		end := len(rest)
+		if i := strings.IndexByte(rest, '['); i >= 0 {
+			end = i
+		}
+		i := strings.LastIndexByte(rest[:end], ':')
+		p.schema, rest = rest[:i], rest[i+1:]
+		if strings.EqualFold(p.schema, coreSchema) {
+			p.schema = ""
+		}
+	}
+	if i := strings.IndexByte(rest, '['); i >= 0 {
+		j := strings.IndexByte(rest, ']')
+		if j < i {
+			return p, fmt.Errorf("invalid path %q", path)
+		}
+		m := scimFilterRe.FindStringSubmatch(rest[i+1 : j])
+		if m == nil {
+			return p, fmt.Errorf("unsupported filter in path %q", path)
+		}
+		p.filterAttr = m[1]
+		if m[3] != "" {
+			p.filterValue = strings.EqualFold(m[3], "true")
+		} else {
+			p.filterValue = strings.ReplaceAll(m[2], `\"`, `"`)
+		}
+		p.attr = rest[:i]
+		rest = strings.TrimPrefix(rest[j+1:], ".")
+		p.sub = rest
+	} else if attr, sub, ok := strings.Cut(rest, "."); ok {
+		p.attr, p.sub = attr, sub
+	} else {
+		p.attr = rest
+	}
+	if p.attr == "" || strings.ContainsAny(p.sub, ".[") {
+		return p, fmt.Errorf("invalid path %q", path)
+	}
+	return p, nil
+}
+
+// scimKey returns the key of m matching name case-insensitively, or name.
+func scimKey(m map[string]any, name string) string {
+	if _, ok := m[name]; ok {
+		return name
+	}
+	for k := range m {
+		if strings.EqualFold(k, name) {
+			return k
+		}
+	}
+	return name
+}
+
+// scimGet returns the attribute name of m, matched case-insensitively.
+func scimGet(m map[string]any, name string) any {
+	return m[scimKey(m, name)]
+}
+
+// scimSet sets the attribute name of m, replacing any case variant.
+func scimSet(m map[string]any, name string, v any) {
+	delete(m, scimKey(m, name))
+	m[name] = v
+}
+
+// applySCIMPatch applies ops to res in order.
+func applySCIMPatch(res map[string]any, coreSchema string, ops []scimPatchOp) error {
+	for _, op := range ops {
+		kind := strings.ToLower(op.Op)
+		if kind != "add" && kind != "replace" && kind != "remove" {
+			return fmt.Errorf("unsupported op %q", op.Op)
+		}
+		if op.Path == "" {
+			if kind == "remove" {
+				return fmt.Errorf("remove requires a path")
+			}
+			values, ok := op.Value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s without a path requires an object value", kind)
+			}
+			for name, v := range values {
+				if err := applySCIMOp(res, coreSchema, kind, name, v); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := applySCIMOp(res, coreSchema, kind, op.Path, op.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applySCIMOp(res map[string]any, coreSchema, kind, path string, value any) error {
+	// An extension schema given as a whole is applied attribute by
+	// attribute.
+	if values, ok := value.(map[string]any); ok && kind != "remove" && isSCIMExtension(res, path) {
+		ext, _ := scimGet(res, path).(map[string]any)
+		if ext == nil {
+			ext = map[string]any{}
+		}
+		for name, v := range values {
+			scimSet(ext, name, v)
+		}
+		scimSet(res, path, ext)
+		return nil
+	}
+
+	p, err := parseSCIMPath(path, coreSchema)
+	if err != nil {
+		return err
+	}
+	target := res
+	if p.schema != "" {
+		ext, _ := scimGet(res, p.schema).(map[string]any)
+		if ext == nil {
+			if kind == "remove" {
+				return nil
+			}
+			ext = map[string]any{}
+			scimSet(res, p.schema, ext)
+		}
+		target = ext
+	}
+
+	switch {
+	case p.filterAttr != "":
+		return applySCIMFiltered(target, kind, p, value)
+	case p.sub != "":
+		parent, _ := scimGet(target, p.attr).(map[string]any)
+		if parent == nil {
+			if kind == "remove" {
+				return nil
+			}
+			parent = map[string]any{}
+			scimSet(target, p.attr, parent)
+		}
+		if kind == "remove" {
+			delete(parent, scimKey(parent, p.sub))
+		} else {
+			scimSet(parent, p.sub, value)
+		}
+	case kind == "remove":
+		// Some providers remove members by listing them as the value.
+		existing, isList := scimGet(target, p.attr).([]any)
+		if removed, ok := value.([]any); ok && isList {
+			scimSet(target, p.attr, removeSCIMValues(existing, removed))
+		} else {
+			delete(target, scimKey(target, p.attr))
+		}
+	case kind == "add":
+		// Adding to a multi-valued attribute appends.
+		existing, isList := scimGet(target, p.attr).([]any)
+		if added, ok := value.([]any); ok && isList {
+			scimSet(target, p.attr, appendSCIMValues(existing, added))
+		} else {
+			scimSet(target, p.attr, value)
+		}
+	default:
+		scimSet(target, p.attr, value)
+	}
+	return nil
+}
+
+// isSCIMExtension reports whether path names an extension schema of res,
+// rather than an attribute in one.
+func isSCIMExtension(res map[string]any, path string) bool {
+	if strings.EqualFold(path, scimEnterpriseSchema) {
+		return true
+	}
+	schemas, _ := scimGet(res, "schemas").([]any)
+	for _, s := range schemas {
+		if s, ok := s.(string); ok && strings.EqualFold(s, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendSCIMValues appends added to list, skipping objects whose "value"
+// is already present.
+func appendSCIMValues(list, added []any) []any {
+	seen := map[any]bool{}
+	for _, v := range list {
+		if m, ok := v.(map[string]any); ok {
+			if id := scimGet(m, "value"); id != nil {
+				seen[id] = true
+			}
+		}
+	}
+	for _, v := range added {
+		if m, ok := v.(map[string]any); ok {
+			if id := scimGet(m, "value"); id != nil {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+			}
+		}
+		list = append(list, v)
+	}
+	return list
+}
+
+// removeSCIMValues returns list without the objects whose "value" is that
+// of an object in removed.
+func removeSCIMValues(list, removed []any) []any {
+	drop := map[any]bool{}
+	for _, v := range removed {
+		if m, ok := v.(map[string]any); ok {
+			drop[scimGet(m, "value")] = true
+		}
+	}
+	out := list[:0:0]
+	for _, v := range list {
+		if m, ok := v.(map[string]any); ok && drop[scimGet(m, "value")] {
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// applySCIMFiltered applies an operation to the elements of a multi-valued
+// attribute that match the path's filter.
+func applySCIMFiltered(target map[string]any, kind string, p scimPath, value any) error {
+	list, _ := scimGet(target, p.attr).([]any)
+	matches := func(v any) bool {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return false
+		}
+		got := scimGet(m, p.filterAttr)
+		if s, ok := got.(string); ok {
+			want, _ := p.filterValue.(string)
+			return strings.EqualFold(s, want)
+		}
+		return got == p.filterValue
+	}
+
+	out := list[:0:0]
+	found := false
+	for _, v := range list {
+		if !matches(v) {
+			out = append(out, v)
+			continue
+		}
+		found = true
+		m := v.(map[string]any)
+		switch {
+		case kind == "remove" && p.sub == "":
+			continue // drop the element
+		case kind == "remove":
+			delete(m, scimKey(m, p.sub))
+		case p.sub != "":
+			scimSet(m, p.sub, value)
+		default:
+			values, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s of %s[...] requires an object value", kind, p.attr)
+			}
+			for name, sv := range values {
+				scimSet(m, name, sv)
+			}
+		}
+		out = append(out, m)
+	}
+	if !found && kind != "remove" {
+		m := map[string]any{p.filterAttr: p.filterValue}
+		if p.sub != "" {
+			m[p.sub] = value
+		} else if values, ok := value.(map[string]any); ok {
+			for name, sv := range values {
+				scimSet(m, name, sv)
+			}
+		}
+		out = append(out, m)
+	}
+	scimSet(target, p.attr, out)
+	return nil
+}
+
+// scimAttribute resolves a path such as "emails", "name.givenName" or
+// "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department"
+// to a single value. Multi-valued attributes resolve to the primary
+// element's value, else the first's.
+func scimAttribute(res map[string]any, path string) any {
+	p, err := parseSCIMPath(path, scimUserSchema)
+	if err != nil {
+		return nil
+	}
+	target := res
+	if p.schema != "" {
+		if target, _ = scimGet(res, p.schema).(map[string]any); target == nil {
+			return nil
+		}
+	}
+	v := scimGet(target, p.attr)
+	if list, ok := v.([]any); ok {
+		v = nil
+		for _, e := range list {
+			if m, ok := e.(map[string]any); ok && (v == nil || scimGet(m, "primary") == true) {
+				v = e
+			}
+		}
+		if m, ok := v.(map[string]any); ok && p.sub == "" {
+			v = scimGet(m, "value")
+		}
+	}
+	if p.sub != "" {
+		m, _ := v.(map[string]any)
+		if m == nil {
+			return nil
+		}
+		v = scimGet(m, p.sub)
+	}
+	switch v.(type) {
+	case string, bool, float64:
+		return v
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func decodeSCIMTest(t *testing.T, s string) map[string]any {
+	t.Helper()
+	var m map[string]any
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestSCIMUserWriteMapsMetadata(t *testing.T) {
+	h := &scimHandler{metadata: defaultSCIMKeyMetadata}
+	res := decodeSCIMTest(t, `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"id": "client-sent", "password": "hunter2",
+		"UserName": " ada@example.com ", "externalId": "00u1", "active": "False",
+		"displayName": "Ada Lovelace", "title": "Engineer",
+		"emails": [{"value": "ada@home.example"}, {"value": "ada@example.com", "primary": true}],
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "R&D", "costCenter": "42"}
+	}`)
+
+	w, err := h.userWrite(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.UserName != "ada@example.com" || w.Active || w.KeyName != "Ada Lovelace" || w.ExternalID == nil || *w.ExternalID != "00u1" {
+		t.Fatalf("unexpected write: %+v", w)
+	}
+	want := map[string]any{
+		"email":        "ada@example.com",
+		"display_name": "Ada Lovelace",
+		"title":        "Engineer",
+		"department":   "R&D",
+		"cost_center":  "42",
+	}
+	if !reflect.DeepEqual(w.Metadata, want) {
+		t.Fatalf("metadata = %v, want %v", w.Metadata, want)
+	}
+
+	stored := decodeSCIMTest(t, string(w.Resource))
+	for _, attr := range []string{"id", "password", "UserName"} {
+		if _, ok := stored[attr]; ok {
+			t.Errorf("%s stored", attr)
+		}
+	}
+	if stored["userName"] != "ada@example.com" || stored["active"] != false {
+		t.Errorf("not normalized: %v", stored)
+	}
+
+	if _, err := h.userWrite(map[string]any{"active": true}); err == nil {
+		t.Error("user without userName accepted")
+	}
+}
+
+func TestApplySCIMPatch(t *testing.T) {
+	res := decodeSCIMTest(t, `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "ada", "active": true,
+		"name": {"givenName": "Ada"},
+		"emails": [{"type": "work", "value": "ada@old.example"}]
+	}`)
+	ops := []scimPatchOp{
+		{Op: "Replace", Path: "active", Value: false},
+		{Op: "replace", Path: "name.familyName", Value: "Lovelace"},
+		{Op: "replace", Path: `emails[type eq "work"].value`, Value: "ada@example.com"},
+		{Op: "add", Path: `phoneNumbers[type eq "mobile"].value`, Value: "+1 555"},
+		{Op: "replace", Value: map[string]any{
+			"displayName": "Ada L",
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department": "R&D",
+		}},
+		{Op: "remove", Path: "name.givenName"},
+	}
+	if err := applySCIMPatch(res, scimUserSchema, ops); err != nil {
+		t.Fatal(err)
+	}
+	want := decodeSCIMTest(t, `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "ada", "active": false, "displayName": "Ada L",
+		"name": {"familyName": "Lovelace"},
+		"emails": [{"type": "work", "value": "ada@example.com"}],
+		"phoneNumbers": [{"type": "mobile", "value": "+1 555"}],
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "R&D"}
+	}`)
+	if !reflect.DeepEqual(res, want) {
+		got, _ := json.Marshal(res)
+		t.Fatalf("patched = %s", got)
+	}
+
+	if err := applySCIMPatch(res, scimUserSchema, []scimPatchOp{{Op: "move", Path: "active"}}); err == nil {
+		t.Error("unknown op accepted")
+	}
+	if err := applySCIMPatch(res, scimUserSchema, []scimPatchOp{{Op: "remove"}}); err == nil {
+		t.Error("remove without path accepted")
+	}
+}
+
+func TestApplySCIMPatchGroupMembers(t *testing.T) {
+	res := decodeSCIMTest(t, `{"displayName": "ml", "members": [{"value": "a"}, {"value": "b"}]}`)
+	ops := []scimPatchOp{
+		{Op: "add", Path: "members", Value: []any{map[string]any{"value": "b"}, map[string]any{"value": "c"}}},
+		{Op: "remove", Path: `members[value eq "a"]`},
+		{Op: "remove", Path: "members", Value: []any{map[string]any{"value": "c"}}},
+		{Op: "add", Path: "members", Value: []any{map[string]any{"value": "d"}}},
+	}
+	if err := applySCIMPatch(res, scimGroupSchema, ops); err != nil {
+		t.Fatal(err)
+	}
+	w, err := groupWrite(res)
+	if err == nil {
+		t.Fatalf("non-UUID members accepted: %+v", w)
+	}
+	var got []string
+	for _, m := range res["members"].([]any) {
+		got = append(got, m.(map[string]any)["value"].(string))
+	}
+	if !reflect.DeepEqual(got, []string{"b", "d"}) {
+		t.Fatalf("members = %v", got)
+	}
+}
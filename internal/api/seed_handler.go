@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/sertdev/pxbin/internal/seed"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+type seedHandler struct {
+	store    store.Store
+	seedFile string // "" when no seed file is configured
+}
+
+// Drift reports how the upstreams, models, keys and policies in the
+// database differ from the seed file. The file is read on every request, so
+// edits to it show up without a restart.
+func (h *seedHandler) Drift(w http.ResponseWriter, r *http.Request) {
+	if h.seedFile == "" {
+		writeError(w, r, http.StatusNotFound, "not_found", "No seed_file is configured")
+		return
+	}
+	f, err := seed.Load(h.seedFile)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	drift, err := seed.Diff(r.Context(), h.store, f)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to compare the seed file with the database")
+		return
+	}
+	writeData(w, drift)
+}
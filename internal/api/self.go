@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/billing"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// maxRecentErrors caps the recent errors one key usage or /api/self/errors
+// request returns.
+const maxRecentErrors = 100
+
+// NewSelfRouter serves the self-service endpoints, where the holder of an
+// LLM key reads the key's own usage, budget status and recent errors with
+// the key itself, without a management key. authMw authenticates the LLM
+// key; it should not enforce budgets, so that a key over its budget can
+// still see why.
+func NewSelfRouter(s store.Store, bt *billing.Tracker, authMw func(http.Handler) http.Handler) chi.Router {
+	r := chi.NewRouter()
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeErrorCode(w, r, http.StatusNotFound, "not_found", "route_not_found", "No self-service route at "+r.URL.Path)
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeErrorCode(w, r, http.StatusMethodNotAllowed, "invalid_request", "method_not_allowed", r.Method+" is not allowed on "+r.URL.Path)
+	})
+
+	h := &selfHandler{store: s, billing: bt}
+	r.Group(func(r chi.Router) {
+		r.Use(authMw)
+		r.Get("/usage", h.Usage)
+		r.Get("/budget", h.Budget)
+		r.Get("/errors", h.Errors)
+	})
+	return r
+}
+
+type selfHandler struct {
+	store   store.Store
+	billing *billing.Tracker
+}
+
+// selfUsageResponse is a key's usage report without the key's settings,
+// which only management keys see.
+type selfUsageResponse struct {
+	Period     string                   `json:"period"`
+	RateLimit  keyRateLimit             `json:"rate_limit"`
+	Totals     store.OverviewStats      `json:"totals"`
+	TimeSeries []store.TimeSeriesBucket `json:"timeseries"`
+	ByModel    []store.ModelStats       `json:"by_model"`
+}
+
+// key returns the calling key as stored now, with the budgets it inherits
+// from its team. It writes an error and returns nil if it cannot.
+func (h *selfHandler) key(w http.ResponseWriter, r *http.Request) *store.LLMAPIKey {
+	key, err := h.store.GetLLMKey(r.Context(), auth.GetKeyIDFromContext(r.Context()))
+	if err != nil || key == nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch key")
+		return nil
+	}
+	return key
+}
+
+// Usage returns the calling key's totals, spend over time and per-model
+// breakdown over period, and its rate-limit status.
+func (h *selfHandler) Usage(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "24h"
+	}
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "1h"
+	}
+	key := h.key(w, r)
+	if key == nil {
+		return
+	}
+
+	usage, err := h.store.GetKeyUsage(r.Context(), key.ID, period, interval, 0)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get key usage")
+		return
+	}
+	writeData(w, selfUsageResponse{
+		Period: period,
+		RateLimit: keyRateLimit{
+			Limit:              key.RateLimit,
+			RequestsLastMinute: usage.RequestsLastMinute,
+		},
+		Totals:     usage.Totals,
+		TimeSeries: usage.TimeSeries,
+		ByModel:    usage.ByModel,
+	})
+}
+
+// Budget returns the calling key's spend budgets, its spend this UTC day
+// and month, and whether it is over them.
+func (h *selfHandler) Budget(w http.ResponseWriter, r *http.Request) {
+	key := h.key(w, r)
+	if key == nil {
+		return
+	}
+	writeData(w, budgetResponse(h.billing, key))
+}
+
+// Errors returns the calling key's most recent failed requests over period,
+// newest first.
+func (h *selfHandler) Errors(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "24h"
+	}
+	limit := queryInt(r, "limit", 10)
+	if limit < 1 || limit > maxRecentErrors {
+		writeFieldError(w, r, "limit", "must be between 1 and 100")
+		return
+	}
+	key := h.key(w, r)
+	if key == nil {
+		return
+	}
+
+	usage, err := h.store.GetKeyUsage(r.Context(), key.ID, period, "1h", limit)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get key errors")
+		return
+	}
+	writeData(w, usage.RecentErrors)
+}
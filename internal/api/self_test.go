@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/billing"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestSelfRouter(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	plain, hash, prefix := auth.GenerateLLMKey()
+	key, err := st.CreateLLMKey(ctx, hash, prefix, "team-a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := st.CreateLLMKey(ctx, "other-hash", "pxb_other", "team-b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	daily := 1.0
+	if _, err := st.SetLLMKeyBudgets(ctx, key.ID, &daily, nil); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := st.InsertLogBatch(ctx, []*store.LogEntry{
+		{KeyID: key.ID, Timestamp: now, Model: "own-model", StatusCode: 200, Cost: 2},
+		{KeyID: key.ID, Timestamp: now, Model: "own-model", StatusCode: 502, ErrorMessage: "upstream down"},
+		{KeyID: other.ID, Timestamp: now, Model: "other-model", StatusCode: 500, ErrorMessage: "not yours"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	bt := billing.NewTracker(st)
+	defer bt.Close()
+	if err := bt.RefreshSpend(ctx); err != nil {
+		t.Fatal(err)
+	}
+	tracker := auth.NewLastUsedTracker(st)
+	defer tracker.Close()
+	// Budgets are left out, as in production, so the over-budget key can
+	// still read its status.
+	authMw := auth.LLMAuthMiddlewareWithOpts(auth.NewKeyCache(st, time.Minute), tracker, auth.LLMAuthOpts{})
+	h := NewSelfRouter(st, bt, authMw)
+
+	get := func(path, bearer string, v any) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if v != nil && rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code
+	}
+
+	if code := get("/usage", "", nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a key, got %d", code)
+	}
+
+	var usage struct{ Data selfUsageResponse }
+	if code := get("/usage", plain, &usage); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if usage.Data.Totals.TotalRequests != 2 || len(usage.Data.ByModel) != 1 || usage.Data.ByModel[0].Model != "own-model" {
+		t.Fatalf("expected only the key's own 2 requests, got %+v", usage.Data)
+	}
+
+	var budget struct{ Data keyBudgetResponse }
+	if code := get("/budget", plain, &budget); code != http.StatusOK {
+		t.Fatalf("expected 200 for a key over its budget, got %d", code)
+	}
+	if !budget.Data.Exceeded || budget.Data.Spend.Daily != 2 {
+		t.Fatalf("expected the daily budget exceeded with 2 spent, got %+v", budget.Data)
+	}
+
+	var errs struct{ Data []store.KeyUsageError }
+	if code := get("/errors?limit=5", plain, &errs); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if len(errs.Data) != 1 || *errs.Data[0].ErrorMessage != "upstream down" {
+		t.Fatalf("expected only the key's own error, got %+v", errs.Data)
+	}
+	if code := get("/errors?limit=500", plain, nil); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a limit over 100, got %d", code)
+	}
+}
@@ -7,7 +7,7 @@ import (
 )
 
 type statsHandler struct {
-	store *store.Store
+	store store.Store
 }
 
 func (h *statsHandler) Overview(w http.ResponseWriter, r *http.Request) {
@@ -18,7 +18,7 @@ func (h *statsHandler) Overview(w http.ResponseWriter, r *http.Request) {
 
 	stats, err := h.store.GetOverviewStats(r.Context(), period)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to get overview stats")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get overview stats")
 		return
 	}
 	writeData(w, stats)
@@ -34,12 +34,27 @@ func (h *statsHandler) ByKey(w http.ResponseWriter, r *http.Request) {
 
 	stats, total, err := h.store.GetStatsByKey(r.Context(), period, page, perPage)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to get key stats")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get key stats")
 		return
 	}
 	writeDataPaginated(w, stats, total, page, perPage)
 }
 
+// ByTeam sums requests, tokens and spend per team, across its member keys.
+func (h *statsHandler) ByTeam(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "24h"
+	}
+
+	stats, err := h.store.GetStatsByTeam(r.Context(), period)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get team stats")
+		return
+	}
+	writeData(w, stats)
+}
+
 func (h *statsHandler) ByModel(w http.ResponseWriter, r *http.Request) {
 	period := r.URL.Query().Get("period")
 	if period == "" {
@@ -48,7 +63,56 @@ func (h *statsHandler) ByModel(w http.ResponseWriter, r *http.Request) {
 
 	stats, err := h.store.GetStatsByModel(r.Context(), period)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to get model stats")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get model stats")
+		return
+	}
+	writeData(w, stats)
+}
+
+// ByTranslation breaks error rate and latency down by translation path, to
+// measure the overhead of cross-format translation.
+func (h *statsHandler) ByTranslation(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "24h"
+	}
+
+	stats, err := h.store.GetStatsByTranslation(r.Context(), period)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get translation stats")
+		return
+	}
+	writeData(w, stats)
+}
+
+// ProviderErrors counts the requests upstreams refused for a provider policy,
+// to tell policy blocks such as an unsupported region apart from failed
+// authentication.
+func (h *statsHandler) ProviderErrors(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "24h"
+	}
+
+	stats, err := h.store.GetProviderErrorStats(r.Context(), period)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get provider error stats")
+		return
+	}
+	writeData(w, stats)
+}
+
+// CacheInjection reports the prompt caching of requests pxbin added
+// cache_control breakpoints to, and what it saved.
+func (h *statsHandler) CacheInjection(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "24h"
+	}
+
+	stats, err := h.store.GetCacheInjectionStats(r.Context(), period)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get cache injection stats")
 		return
 	}
 	writeData(w, stats)
@@ -66,7 +130,7 @@ func (h *statsHandler) TimeSeries(w http.ResponseWriter, r *http.Request) {
 
 	stats, err := h.store.GetTimeSeries(r.Context(), period, interval)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to get time series")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get time series")
 		return
 	}
 	writeData(w, stats)
@@ -80,7 +144,7 @@ func (h *statsHandler) Latency(w http.ResponseWriter, r *http.Request) {
 
 	stats, err := h.store.GetLatencyPercentiles(r.Context(), period)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to get latency stats")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to get latency stats")
 		return
 	}
 	writeData(w, stats)
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestTeamStatsPaths(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	team, err := st.CreateTeam(ctx, &store.TeamCreate{Name: "research"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := st.CreateLLMKey(ctx, "hash", "pxb_team", "research-bot", nil)
+	if _, err := st.SetLLMKeyTeam(ctx, key.ID, &team.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.InsertLog(ctx, &store.LogEntry{KeyID: key.ID, Timestamp: time.Now(), Model: "gpt-4o", StatusCode: 200, InputTokens: 10, OutputTokens: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	noAuth := func(next http.Handler) http.Handler { return next }
+	router := NewRouter(st, noAuth, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, "", nil)
+	for _, path := range []string{"/stats/teams", "/stats/by-team"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path+"?period=7d", nil))
+		var body struct{ Data []store.TeamStats }
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &body) != nil {
+			t.Fatalf("%s: got %d: %s", path, rec.Code, rec.Body)
+		}
+		if len(body.Data) != 1 || body.Data[0].TeamName != "research" || body.Data[0].TotalRequests != 1 || body.Data[0].TotalInputTokens != 10 {
+			t.Errorf("%s: unexpected stats %+v", path, body.Data)
+		}
+	}
+}
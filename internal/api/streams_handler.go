@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sertdev/pxbin/internal/streamtap"
+)
+
+// tailKeepalive is how often an idle tail sends a comment, so proxies in
+// between do not time it out.
+const tailKeepalive = 15 * time.Second
+
+type streamsHandler struct {
+	taps *streamtap.Registry // nil when streams cannot be watched
+}
+
+// List returns the streaming responses in flight on this instance.
+func (h *streamsHandler) List(w http.ResponseWriter, r *http.Request) {
+	if h.taps == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Stream tailing is not available")
+		return
+	}
+	writeData(w, h.taps.List())
+}
+
+// tailEvent is one event of the tailed stream, as its client received it.
+type tailEvent struct {
+	Seq     int64     `json:"seq"`
+	At      time.Time `json:"at"`
+	Raw     string    `json:"raw"`     // the SSE event's lines
+	Dropped int64     `json:"dropped"` // events this tail has missed so far
+}
+
+type tailEnd struct {
+	Events  int64 `json:"events"`
+	Dropped int64 `json:"dropped"`
+}
+
+// Tail follows an in-flight stream, found by the X-Request-ID its client
+// was sent, as server-sent events: a "stream" event describing it, an
+// "event" event per event the client receives and an "end" event when it
+// ends. Content is masked unless redact=none, which needs the audit
+// permission.
+func (h *streamsHandler) Tail(w http.ResponseWriter, r *http.Request) {
+	if h.taps == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Stream tailing is not available")
+		return
+	}
+	redact := true
+	switch r.URL.Query().Get("redact") {
+	case "", "content":
+	case "none":
+		if !checkAuditPermission(w, r) {
+			return
+		}
+		redact = false
+	default:
+		writeFieldError(w, r, "redact", "must be content or none")
+		return
+	}
+	watcher, st, ok := h.taps.Watch(chi.URLParam(r, "requestID"))
+	if !ok {
+		writeErrorCode(w, r, http.StatusNotFound, "not_found", "stream_not_found", "No stream in flight on this instance has that request ID")
+		return
+	}
+	defer watcher.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	send := func(event string, v any) error {
+		b, _ := json.Marshal(v)
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	if send("stream", st) != nil {
+		return
+	}
+
+	keepalive := time.NewTicker(tailKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case ev, open := <-watcher.Events:
+			if !open {
+				send("end", tailEnd{Events: watcher.Sent(), Dropped: watcher.Dropped()})
+				return
+			}
+			raw := ev.Raw
+			if redact {
+				raw = streamtap.Redact(raw)
+			}
+			if send("event", tailEvent{Seq: ev.Seq, At: ev.At, Raw: string(raw), Dropped: watcher.Dropped()}) != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sertdev/pxbin/internal/streamtap"
+)
+
+func TestStreamsTailUnmaskedNeedsAuditPermission(t *testing.T) {
+	h := &streamsHandler{taps: streamtap.New()}
+	r := chi.NewRouter()
+	r.Get("/admin/streams/{requestID}/tail", h.Tail)
+
+	do := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/streams/req-1/tail"+query, nil))
+		return rec
+	}
+	if rec := do("?redact=none"); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "audit_permission_required") {
+		t.Fatalf("redact=none: expected 403, got %d: %s", rec.Code, rec.Body)
+	}
+	// Masked tails need no more than the route's own permission.
+	if rec := do("?redact=content"); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "stream_not_found") {
+		t.Fatalf("redact=content: expected 404 for an unknown stream, got %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/billing"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+type teamsHandler struct {
+	store   store.Store
+	billing *billing.Tracker
+}
+
+func (h *teamsHandler) List(w http.ResponseWriter, r *http.Request) {
+	teams, err := h.store.ListTeams(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list teams")
+		return
+	}
+	writeData(w, teams)
+}
+
+func (h *teamsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+	h.writeTeam(w, r, id)
+}
+
+func (h *teamsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req store.TeamCreate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+	if validateTeam(req.Name, req.AllowedModels).write(w, r) {
+		return
+	}
+	if !h.checkNameConflict(w, r, req.Name, nil) {
+		return
+	}
+
+	t, err := h.store.CreateTeam(r.Context(), &req)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to create team")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, response{Data: t})
+}
+
+func (h *teamsHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+
+	var updates store.TeamUpdate
+	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+
+	existing, err := h.store.GetTeam(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch team")
+		return
+	}
+	if existing == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Team not found")
+		return
+	}
+	name, models := existing.Name, existing.AllowedModels
+	if updates.Name != nil {
+		name = *updates.Name
+	}
+	if updates.AllowedModels != nil {
+		models = *updates.AllowedModels
+	}
+	if validateTeam(name, models).write(w, r) {
+		return
+	}
+	if updates.Name != nil && !h.checkNameConflict(w, r, name, &id) {
+		return
+	}
+
+	if err := h.store.UpdateTeam(r.Context(), id, &updates); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to update team")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response{Data: map[string]string{"status": "updated"}})
+}
+
+// Delete deletes a team. Its keys stay, without a team.
+func (h *teamsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+
+	if err := h.store.DeleteTeam(r.Context(), id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to delete team")
+		return
+	}
+	// Keys that were budgeted only through the team no longer are.
+	_ = h.billing.RefreshSpend(r.Context())
+
+	writeJSON(w, http.StatusOK, response{Data: map[string]string{"status": "deleted"}})
+}
+
+// SetBudget replaces a team's daily and monthly spend budgets, which apply
+// to each member key without budgets of its own.
+func (h *teamsHandler) SetBudget(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeInvalidID(w, r)
+		return
+	}
+	var req keyBudgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+	if validateBudgets(req).write(w, r) {
+		return
+	}
+
+	found, err := h.store.SetTeamBudgets(r.Context(), id, req.DailyBudget, req.MonthlyBudget)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to update team")
+		return
+	}
+	if !found {
+		writeError(w, r, http.StatusNotFound, "not_found", "Team not found")
+		return
+	}
+	// Load the member keys' logged spend now, not at the next periodic refresh.
+	_ = h.billing.RefreshSpend(r.Context())
+
+	h.writeTeam(w, r, id)
+}
+
+func (h *teamsHandler) writeTeam(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	t, err := h.store.GetTeam(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch team")
+		return
+	}
+	if t == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Team not found")
+		return
+	}
+	writeData(w, t)
+}
+
+// validateTeam returns the team's invalid fields.
+func validateTeam(name string, models []string) fieldErrors {
+	var errs fieldErrors
+	if strings.TrimSpace(name) == "" {
+		errs.add("name", "is required")
+	}
+	if !validAllowedModels(models) {
+		errs.add("allowed_models", "must not contain empty names")
+	}
+	return errs
+}
+
+// checkNameConflict writes a 409 and returns false if another team is named
+// name, ignoring case.
+func (h *teamsHandler) checkNameConflict(w http.ResponseWriter, r *http.Request, name string, exclude *uuid.UUID) bool {
+	conflict, err := teamNameConflict(r.Context(), h.store, name, exclude)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to check team names")
+		return false
+	}
+	if conflict != "" {
+		writeErrorCode(w, r, http.StatusConflict, "conflict", "name_conflict", conflict)
+		return false
+	}
+	return true
+}
+
+func teamNameConflict(ctx context.Context, s store.Store, name string, exclude *uuid.UUID) (string, error) {
+	teams, err := s.ListTeams(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, t := range teams {
+		if strings.EqualFold(t.Name, name) && (exclude == nil || t.ID != *exclude) {
+			return fmt.Sprintf("Name is already used by team %q (names are case-insensitive)", t.Name), nil
+		}
+	}
+	return "", nil
+}
@@ -1,52 +1,109 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand/v2"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/extension"
+	"github.com/sertdev/pxbin/internal/loopguard"
+	"github.com/sertdev/pxbin/internal/scoreboard"
 	"github.com/sertdev/pxbin/internal/store"
+	"github.com/sertdev/pxbin/internal/vertex"
 )
 
 type upstreamsHandler struct {
-	store *store.Store
+	store  store.Store
+	scores *scoreboard.Board
+	self   *loopguard.Self // nil skips the proxy loop check
 }
 
+// List returns upstreams, optionally filtered by format, is_active and q
+// (name/base_url search), and sorted by sort=name|created_at|priority
+// (prefix "-" for descending). Without per_page all matches are returned.
 func (h *upstreamsHandler) List(w http.ResponseWriter, r *http.Request) {
-	upstreams, err := h.store.ListUpstreams(r.Context())
+	q := r.URL.Query()
+	filter := store.UpstreamFilter{
+		Sort:    q.Get("sort"),
+		Page:    queryInt(r, "page", 1),
+		PerPage: queryInt(r, "per_page", 0),
+	}
+
+	if v := q.Get("format"); v != "" {
+		filter.Format = &v
+	}
+	if v := q.Get("is_active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "Invalid is_active, use true or false")
+			return
+		}
+		filter.IsActive = &active
+	}
+	if v := q.Get("q"); v != "" {
+		filter.Search = &v
+	}
+
+	upstreams, total, err := h.store.ListUpstreamsFiltered(r.Context(), filter)
+	if errors.Is(err, store.ErrInvalidSort) {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", "Invalid sort, use name, created_at, or priority")
+		return
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to list upstreams")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list upstreams")
+		return
+	}
+	if filter.PerPage <= 0 {
+		writeDataPaginated(w, upstreams, total, 1, total)
 		return
 	}
-	writeData(w, upstreams)
+	writeDataPaginated(w, upstreams, total, filter.Page, filter.PerPage)
 }
 
 func (h *upstreamsHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var req store.UpstreamCreate
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
-		return
-	}
-	if req.Name == "" || req.BaseURL == "" || req.APIKey == "" {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Name, base_url, and api_key are required")
+		writeInvalidJSON(w, r)
 		return
 	}
 	if req.Format == "" {
 		req.Format = "openai"
 	}
-	if req.Format != "openai" && req.Format != "anthropic" {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Format must be 'openai' or 'anthropic'")
+	var errs fieldErrors
+	if req.Name == "" {
+		errs.add("name", "is required")
+	}
+	if req.BaseURL == "" {
+		errs.add("base_url", "is required")
+	}
+	if req.APIKey == "" {
+		errs.add("api_key", "is required")
+	}
+	if req.Format != "openai" && req.Format != "anthropic" && req.Format != vertex.Format {
+		errs.add("format", "must be 'openai', 'anthropic', or 'vertex'")
+	}
+	if req.Format == vertex.Format && req.BaseURL != "" && req.APIKey != "" {
+		validateVertex(&errs, req.BaseURL, req.APIKey)
+	}
+	errs.check("availability", req.Availability.Validate())
+	errs.check("role_map", req.RoleMap.Validate())
+	errs.check("service_tiers", req.ServiceTiers.Validate())
+	h.validate(&errs, &req.BaseURL, req.AnthropicBetas, req.Resilience, req.MaxSSEFrameBytes, req.StreamIdleTimeoutSeconds, req.Extension)
+	if errs.write(w, r) {
 		return
 	}
 
 	upstream, err := h.store.CreateUpstream(r.Context(), &req)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to create upstream")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to create upstream")
 		return
 	}
 
@@ -56,33 +113,99 @@ func (h *upstreamsHandler) Create(w http.ResponseWriter, r *http.Request) {
 func (h *upstreamsHandler) Update(w http.ResponseWriter, r *http.Request) {
 	id, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid ID format")
+		writeInvalidID(w, r)
 		return
 	}
 
 	var updates store.UpstreamUpdate
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		writeInvalidJSON(w, r)
+		return
+	}
+	var errs fieldErrors
+	if updates.Availability != nil {
+		errs.check("availability", updates.Availability.Validate())
+	}
+	if updates.RoleMap != nil {
+		errs.check("role_map", updates.RoleMap.Validate())
+	}
+	if updates.ServiceTiers != nil {
+		errs.check("service_tiers", updates.ServiceTiers.Validate())
+	}
+	h.validate(&errs, updates.BaseURL, updates.AnthropicBetas, updates.Resilience, updates.MaxSSEFrameBytes, updates.StreamIdleTimeoutSeconds, updates.Extension)
+	if updates.Format != nil || updates.BaseURL != nil || updates.APIKey != nil {
+		// Check a Vertex AI upstream's base URL and key as they will be
+		// after the update.
+		existing, err := h.store.GetUpstream(r.Context(), id)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch upstream")
+			return
+		}
+		if existing != nil {
+			format, baseURL, apiKey := existing.Format, existing.BaseURL, existing.APIKeyEncrypted
+			if updates.Format != nil {
+				format = *updates.Format
+			}
+			if updates.BaseURL != nil {
+				baseURL = *updates.BaseURL
+			}
+			if updates.APIKey != nil {
+				apiKey = *updates.APIKey
+			}
+			if format == vertex.Format {
+				validateVertex(&errs, baseURL, apiKey)
+			}
+		}
+	}
+	if errs.write(w, r) {
 		return
 	}
 
 	if err := h.store.UpdateUpstream(r.Context(), id, &updates); err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to update upstream")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to update upstream")
 		return
 	}
 
 	writeJSON(w, http.StatusOK, response{Data: map[string]string{"status": "updated"}})
 }
 
+// validate adds the errors of the optional upstream fields shared by create
+// and update; nil fields are not checked.
+func (h *upstreamsHandler) validate(errs *fieldErrors, baseURL *string, betas *store.AnthropicBetas, res *store.ResiliencePolicy, maxFrame, idleTimeout *int, ext *string) {
+	if baseURL != nil && h.pointsAtSelf(*baseURL) {
+		errs.add("base_url", "points back at this pxbin instance")
+	}
+	if betas != nil {
+		errs.check("anthropic_betas", betas.Validate())
+	}
+	if res != nil {
+		errs.check("resilience", res.Validate())
+	}
+	if maxFrame != nil && !validSSEFrameSize(*maxFrame) {
+		errs.add("max_sse_frame_bytes", "must be 0 or at least 65536")
+	}
+	if idleTimeout != nil && *idleTimeout < 0 {
+		errs.add("stream_idle_timeout_seconds", "must be >= 0")
+	}
+	if ext != nil && *ext != "" && !extension.ValidName(*ext) {
+		errs.add("extension", "must be the file name of a .wasm module in extensions_dir")
+	}
+}
+
+// pointsAtSelf reports whether baseURL would make pxbin proxy to itself.
+func (h *upstreamsHandler) pointsAtSelf(baseURL string) bool {
+	return h.self != nil && h.self.Matches(baseURL)
+}
+
 func (h *upstreamsHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid ID format")
+		writeInvalidID(w, r)
 		return
 	}
 
 	if err := h.store.DeleteUpstream(r.Context(), id); err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to delete upstream")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to delete upstream")
 		return
 	}
 
@@ -90,15 +213,13 @@ func (h *upstreamsHandler) Delete(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *upstreamsHandler) BulkDelete(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		IDs []string `json:"ids"`
-	}
+	var req bulkDeleteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		writeInvalidJSON(w, r)
 		return
 	}
 	if len(req.IDs) == 0 {
-		writeError(w, http.StatusBadRequest, "invalid_request", "At least one ID is required")
+		writeError(w, r, http.StatusBadRequest, "invalid_request", "At least one ID is required")
 		return
 	}
 
@@ -106,7 +227,7 @@ func (h *upstreamsHandler) BulkDelete(w http.ResponseWriter, r *http.Request) {
 	for _, raw := range req.IDs {
 		id, err := uuid.Parse(raw)
 		if err != nil {
-			writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Invalid ID: %s", raw))
+			writeError(w, r, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Invalid ID: %s", raw))
 			return
 		}
 		ids = append(ids, id)
@@ -114,22 +235,49 @@ func (h *upstreamsHandler) BulkDelete(w http.ResponseWriter, r *http.Request) {
 
 	deleted, err := h.store.DeleteUpstreams(r.Context(), ids)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "server_error", "Failed to delete upstreams")
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to delete upstreams")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, response{Data: map[string]any{"deleted": deleted}})
+	writeJSON(w, http.StatusOK, response{Data: bulkDeleteResponse{Deleted: deleted}})
 }
 
-func (h *upstreamsHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		UpstreamID string `json:"upstream_id"`
-		BaseURL    string `json:"base_url"`
-		APIKey     string `json:"api_key"`
-		Format     string `json:"format"`
+// Scoreboard returns each upstream's rolling success rate, p95 latency and
+// consecutive failures, named where the upstream still exists.
+func (h *upstreamsHandler) Scoreboard(w http.ResponseWriter, r *http.Request) {
+	if h.scores == nil {
+		writeData(w, []scoreboard.Score{})
+		return
+	}
+	upstreams, err := h.store.ListUpstreams(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to list upstreams")
+		return
+	}
+	names := make(map[uuid.UUID]string, len(upstreams))
+	for _, u := range upstreams {
+		names[u.ID] = u.Name
+	}
+	scores := h.scores.Scores()
+	for i := range scores {
+		scores[i].UpstreamName = names[scores[i].UpstreamID]
 	}
+	writeData(w, scores)
+}
+
+// healthCheckRequest names a saved upstream, or gives connection details
+// for one that has not been created yet.
+type healthCheckRequest struct {
+	UpstreamID string `json:"upstream_id"`
+	BaseURL    string `json:"base_url"`
+	APIKey     string `json:"api_key"`
+	Format     string `json:"format"`
+}
+
+func (h *upstreamsHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	var req healthCheckRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		writeInvalidJSON(w, r)
 		return
 	}
 
@@ -138,16 +286,16 @@ func (h *upstreamsHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	if req.UpstreamID != "" {
 		id, err := uuid.Parse(req.UpstreamID)
 		if err != nil {
-			writeError(w, http.StatusBadRequest, "invalid_request", "Invalid upstream_id format")
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "Invalid upstream_id format")
 			return
 		}
 		upstream, err := h.store.GetUpstream(r.Context(), id)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "server_error", "Failed to fetch upstream")
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch upstream")
 			return
 		}
 		if upstream == nil {
-			writeError(w, http.StatusNotFound, "not_found", "Upstream not found")
+			writeError(w, r, http.StatusNotFound, "not_found", "Upstream not found")
 			return
 		}
 		baseURL = upstream.BaseURL
@@ -161,7 +309,7 @@ func (h *upstreamsHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 			format = "openai"
 		}
 	} else {
-		writeError(w, http.StatusBadRequest, "invalid_request", "Provide upstream_id or base_url + api_key")
+		writeError(w, r, http.StatusBadRequest, "invalid_request", "Provide upstream_id or base_url + api_key")
 		return
 	}
 
@@ -170,9 +318,12 @@ func (h *upstreamsHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 
 	result := healthCheckResult{Healthy: false}
 
-	if format == "anthropic" {
+	switch format {
+	case "anthropic":
 		h.healthCheckAnthropic(baseURL, apiKey, &result)
-	} else {
+	case vertex.Format:
+		h.healthCheckVertex(r.Context(), baseURL, apiKey, &result)
+	default:
 		h.healthCheckOpenAI(baseURL, apiKey, &result)
 	}
 
@@ -321,3 +472,36 @@ func (h *upstreamsHandler) healthCheckAnthropic(baseURL, apiKey string, result *
 
 	result.Healthy = true
 }
+
+// healthCheckVertex checks a Vertex AI upstream by obtaining an access
+// token for its service account. Vertex AI lists no models to test.
+func (h *upstreamsHandler) healthCheckVertex(ctx context.Context, baseURL, apiKey string, result *healthCheckResult) {
+	target, err := vertex.NewTarget(baseURL, apiKey)
+	if err != nil {
+		errMsg := err.Error()
+		result.Error = &errMsg
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if _, err := target.Token(ctx); err != nil {
+		errMsg := err.Error()
+		result.Error = &errMsg
+		return
+	}
+	result.Healthy = true
+}
+
+// validateVertex adds the errors of a Vertex AI upstream's base URL and
+// service account key.
+func validateVertex(errs *fieldErrors, baseURL, apiKey string) {
+	if field, err := vertex.Validate(baseURL, apiKey); err != nil {
+		errs.add(field, err.Error())
+	}
+}
+
+// validSSEFrameSize reports whether n is usable as an upstream's
+// max_sse_frame_bytes: 0 for the proxy default, or at least 64 KiB.
+func validSSEFrameSize(n int) bool {
+	return n == 0 || n >= 64*1024
+}
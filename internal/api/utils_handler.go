@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/billing"
+	"github.com/sertdev/pxbin/internal/ratelimit"
+	"github.com/sertdev/pxbin/internal/store"
+	"github.com/sertdev/pxbin/internal/tokenizer"
+	"github.com/sertdev/pxbin/pkg/translate"
+)
+
+type utilsHandler struct {
+	store   store.Store
+	billing *billing.Tracker
+	limiter ratelimit.Limiter // nil when rate limiting is disabled
+}
+
+// countTokensRequest takes either plain text or an Anthropic-style prompt
+// (system, messages, tools). Tokenizer overrides the model's tokenizer.
+type countTokensRequest struct {
+	translate.AnthropicRequest
+	Tokenizer string `json:"tokenizer,omitempty"`
+	Text      string `json:"text,omitempty"`
+}
+
+type countTokensResponse struct {
+	Model       string `json:"model,omitempty"`
+	Tokenizer   string `json:"tokenizer"`
+	InputTokens int    `json:"input_tokens"`
+}
+
+func (h *utilsHandler) CountTokens(w http.ResponseWriter, r *http.Request) {
+	var req countTokensRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+	if req.Model == "" && req.Tokenizer == "" {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", "Model or tokenizer is required")
+		return
+	}
+	if req.Tokenizer != "" && !validTokenizer(&req.Tokenizer) {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", "Unknown tokenizer, must be one of: "+strings.Join(tokenizer.Names(), ", "))
+		return
+	}
+
+	tok, tokens, _, err := h.countTokens(r.Context(), &req)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch model")
+		return
+	}
+
+	writeData(w, countTokensResponse{
+		Model:       req.Model,
+		Tokenizer:   tok.Name(),
+		InputTokens: tokens,
+	})
+}
+
+// countTokens counts req's prompt with its tokenizer, or its model's. The
+// model is returned when it is configured.
+func (h *utilsHandler) countTokens(ctx context.Context, req *countTokensRequest) (tokenizer.Tokenizer, int, *store.Model, error) {
+	var m *store.Model
+	configured := req.Tokenizer
+	if req.Model != "" {
+		var err error
+		if m, err = h.store.GetModelByName(ctx, req.Model); err != nil {
+			return nil, 0, nil, err
+		}
+		// Unknown models still get a count from their family's tokenizer.
+		if configured == "" && m != nil && m.Tokenizer != nil {
+			configured = *m.Tokenizer
+		}
+	}
+	tok := tokenizer.ForModel(req.Model, configured)
+
+	tokens := tok.Count(req.Text)
+	if len(req.Messages) > 0 || len(req.System) > 0 || len(req.Tools) > 0 {
+		tokens += translate.CountInputTokens(&req.AnthropicRequest, tok.Count)
+	}
+	return tok, tokens, m, nil
+}
+
+// estimateRequest is a count_tokens request for a model, optionally made
+// with an LLM key whose limits are checked.
+type estimateRequest struct {
+	countTokensRequest
+	KeyID string `json:"key_id,omitempty"`
+}
+
+type estimateResponse struct {
+	Model           string   `json:"model"`
+	Tokenizer       string   `json:"tokenizer"`
+	InputTokens     int      `json:"input_tokens"`
+	MaxOutputTokens int      `json:"max_output_tokens"` // max_tokens, else the model's default or limit; 0 when unbounded
+	Priced          bool     `json:"priced"`            // false when the model has no known pricing
+	InputCost       float64  `json:"input_cost"`
+	MaxCost         *float64 `json:"max_cost"` // nil when the output is unbounded
+	Allowed         bool     `json:"allowed"`
+	Violations      []string `json:"violations"` // why the request would be rejected
+}
+
+// Estimate previews the tokens and cost of a prospective request and the
+// model and key limits it would break, without sending it anywhere.
+func (h *utilsHandler) Estimate(w http.ResponseWriter, r *http.Request) {
+	var req estimateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidJSON(w, r)
+		return
+	}
+	if req.Model == "" {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", "Model is required")
+		return
+	}
+	if req.Tokenizer != "" && !validTokenizer(&req.Tokenizer) {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", "Unknown tokenizer, must be one of: "+strings.Join(tokenizer.Names(), ", "))
+		return
+	}
+	var key *store.LLMAPIKey
+	if req.KeyID != "" {
+		id, err := uuid.Parse(req.KeyID)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "Invalid key_id")
+			return
+		}
+		if key, err = h.store.GetLLMKey(r.Context(), id); err != nil {
+			writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch key")
+			return
+		}
+		if key == nil {
+			writeError(w, r, http.StatusNotFound, "not_found", "Key not found")
+			return
+		}
+	}
+
+	tok, tokens, m, err := h.countTokens(r.Context(), &req.countTokensRequest)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server_error", "Failed to fetch model")
+		return
+	}
+	resp := estimateResponse{
+		Model:           req.Model,
+		Tokenizer:       tok.Name(),
+		InputTokens:     tokens,
+		MaxOutputTokens: req.MaxTokens,
+		Violations:      []string{},
+	}
+
+	if m == nil {
+		resp.Violations = append(resp.Violations, fmt.Sprintf("model %s is not configured", req.Model))
+	} else {
+		resp.Model = m.Name
+		if !m.IsActive {
+			resp.Violations = append(resp.Violations, fmt.Sprintf("model %s is not active", m.Name))
+		}
+		if resp.MaxOutputTokens == 0 && m.DefaultMaxTokens != nil {
+			resp.MaxOutputTokens = *m.DefaultMaxTokens
+		}
+		if m.MaxOutputTokens != nil {
+			if resp.MaxOutputTokens == 0 {
+				resp.MaxOutputTokens = *m.MaxOutputTokens
+			} else if resp.MaxOutputTokens > *m.MaxOutputTokens {
+				resp.Violations = append(resp.Violations, fmt.Sprintf("max_tokens: %d > %d, which is the maximum allowed number of output tokens for %s", resp.MaxOutputTokens, *m.MaxOutputTokens, m.Name))
+			}
+		}
+		if m.ContextWindow != nil && tokens > *m.ContextWindow {
+			resp.Violations = append(resp.Violations, fmt.Sprintf("prompt is too long: an estimated %d tokens > %d maximum context window for %s", tokens, *m.ContextWindow, m.Name))
+		}
+	}
+
+	if key != nil {
+		if !key.IsActive {
+			resp.Violations = append(resp.Violations, "key is not active")
+		}
+		if h.limiter != nil && h.limiter.Tokens(key.ID.String()) <= 0 {
+			resp.Violations = append(resp.Violations, "key is rate limited right now")
+		}
+	}
+
+	if h.billing != nil {
+		if p, ok := h.billing.Pricing(resp.Model); ok {
+			resp.Priced = true
+			resp.InputCost = float64(tokens) / 1_000_000 * p.InputCostPerMillion
+			if resp.MaxOutputTokens > 0 {
+				maxCost := resp.InputCost + float64(resp.MaxOutputTokens)/1_000_000*p.OutputCostPerMillion
+				resp.MaxCost = &maxCost
+			}
+		}
+	}
+	resp.Allowed = len(resp.Violations) == 0
+	writeData(w, resp)
+}
@@ -0,0 +1,84 @@
+// Package apierror writes the error responses of the management API, in one
+// envelope for every handler and middleware.
+package apierror
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ProblemJSON is the RFC 7807 media type clients send in Accept to get
+// errors as problem documents.
+const ProblemJSON = "application/problem+json"
+
+// Error is a management API error. Type is the broad class of the error
+// (invalid_request, not_found, conflict, ...) and Code its specific cause;
+// clients should branch on Code. Fields lists the invalid fields of a
+// create or update request.
+type Error struct {
+	Type    string       `json:"type"`
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError is one invalid field of a request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type envelope struct {
+	Error *Error `json:"error"`
+}
+
+// problem is an RFC 7807 problem document. code and errors are extension
+// members carrying Error's Code and Fields.
+type problem struct {
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Status int          `json:"status"`
+	Detail string       `json:"detail"`
+	Code   string       `json:"code"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// Write responds with e as {"error": e}, or as a problem document whose type
+// is "urn:pxbin:error:<code>" when the client accepts application/problem+json.
+func Write(w http.ResponseWriter, r *http.Request, status int, e *Error) {
+	if e.Code == "" {
+		e.Code = e.Type
+	}
+	if !WantsProblem(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(envelope{Error: e})
+		return
+	}
+	w.Header().Set("Content-Type", ProblemJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem{
+		Type:   "urn:pxbin:error:" + e.Code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: e.Message,
+		Code:   e.Code,
+		Errors: e.Fields,
+	})
+}
+
+// WantsProblem reports whether r's Accept header lists
+// application/problem+json.
+func WantsProblem(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mt, params, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && mt == ProblemJSON && params["q"] != "0" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWantsProblem(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"":                         false,
+		"application/json":         false,
+		"application/problem+json": true,
+		"application/json, application/problem+json;q=0.5": true,
+		"application/problem+json;q=0":                     false,
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+		if got := WantsProblem(r); got != want {
+			t.Errorf("WantsProblem(%q) = %v, want %v", accept, got, want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	e := &Error{Type: "invalid_request", Code: "validation_failed", Message: "name is required", Fields: []FieldError{{Field: "name", Message: "is required"}}}
+
+	w := httptest.NewRecorder()
+	Write(w, httptest.NewRequest("POST", "/", nil), 400, e)
+	var env struct{ Error Error }
+	if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+		t.Fatal(err)
+	}
+	if w.Header().Get("Content-Type") != "application/json" || env.Error.Code != "validation_failed" || len(env.Error.Fields) != 1 {
+		t.Fatalf("unexpected envelope %s", w.Body)
+	}
+
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Accept", ProblemJSON)
+	w = httptest.NewRecorder()
+	Write(w, r, 400, e)
+	var p problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if w.Header().Get("Content-Type") != ProblemJSON || p.Type != "urn:pxbin:error:validation_failed" || p.Status != 400 || p.Title != "Bad Request" || p.Detail != e.Message || p.Errors[0].Field != "name" {
+		t.Fatalf("unexpected problem document %s", w.Body)
+	}
+
+	// Errors without a code use their type.
+	w = httptest.NewRecorder()
+	Write(w, nil, 404, &Error{Type: "not_found", Message: "Key not found"})
+	if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil || env.Error.Code != "not_found" {
+		t.Fatalf("unexpected envelope %s", w.Body)
+	}
+}
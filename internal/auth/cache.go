@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"log"
 	"sync"
 	"time"
 
@@ -13,25 +14,56 @@ type keyCacheEntry struct {
 	expires time.Time
 }
 
+// keyLookup is the store query behind KeyCache.
+type keyLookup interface {
+	GetLLMKeyByHash(ctx context.Context, hash string) (*store.LLMAPIKey, error)
+}
+
 // KeyCache provides an in-memory TTL cache for LLM API key lookups,
 // eliminating a DB round-trip on every proxied request.
+//
+// Uses stale-while-revalidate: a key up to maxStale past its TTL is returned
+// immediately while a background goroutine refreshes it, so requests do not
+// queue behind the DB every TTL. If the refresh fails (the DB is down) the
+// stale key keeps being served until maxStale runs out.
 type KeyCache struct {
-	mu    sync.RWMutex
-	items map[string]*keyCacheEntry // keyed by hash
-	ttl   time.Duration
-	store *store.Store
+	mu         sync.RWMutex
+	items      map[string]*keyCacheEntry // keyed by hash
+	refreshing map[string]bool           // in-flight background refreshes
+	gen        uint64                    // bumped by Invalidate; refreshes started before it are dropped
+	ttl        time.Duration
+	maxStale   time.Duration // how long past expiry an entry may be served
+	store      keyLookup
 }
 
+// defaultKeyMaxStale is how long expired keys keep being served when the
+// database cannot be reached.
+const defaultKeyMaxStale = time.Hour
+
 // NewKeyCache creates a key cache with the given TTL.
-func NewKeyCache(s *store.Store, ttl time.Duration) *KeyCache {
+func NewKeyCache(s store.Store, ttl time.Duration) *KeyCache {
+	return newKeyCache(s, ttl)
+}
+
+func newKeyCache(s keyLookup, ttl time.Duration) *KeyCache {
 	return &KeyCache{
-		items: make(map[string]*keyCacheEntry),
-		ttl:   ttl,
-		store: s,
+		items:      make(map[string]*keyCacheEntry),
+		refreshing: make(map[string]bool),
+		ttl:        ttl,
+		maxStale:   defaultKeyMaxStale,
+		store:      s,
 	}
 }
 
-// GetLLMKeyByHash returns a cached key or queries the DB and caches the result.
+// SetMaxStale sets how long past its TTL a cached key is still served, while
+// it is refreshed in the background or the database cannot be reached. 0
+// disables serving stale keys: every expired key blocks on the database.
+func (c *KeyCache) SetMaxStale(d time.Duration) {
+	c.maxStale = d
+}
+
+// GetLLMKeyByHash returns a cached key or queries the DB and caches the
+// result. Only cold misses and keys past maxStale block on the DB.
 func (c *KeyCache) GetLLMKeyByHash(ctx context.Context, hash string) (*store.LLMAPIKey, error) {
 	now := time.Now()
 
@@ -39,25 +71,81 @@ func (c *KeyCache) GetLLMKeyByHash(ctx context.Context, hash string) (*store.LLM
 	entry, ok := c.items[hash]
 	c.mu.RUnlock()
 
-	if ok && now.Before(entry.expires) {
-		return entry.key, nil
+	if ok {
+		if now.Before(entry.expires) {
+			return entry.key, nil
+		}
+		if now.Before(entry.expires.Add(c.maxStale)) {
+			c.triggerRefresh(hash)
+			return entry.key, nil
+		}
 	}
 
+	c.mu.RLock()
+	gen := c.gen
+	c.mu.RUnlock()
+	return c.fetchAndCache(ctx, hash, gen)
+}
+
+// triggerRefresh starts a background goroutine to refresh a stale entry,
+// deduplicating concurrent refreshes for the same key.
+func (c *KeyCache) triggerRefresh(hash string) {
+	c.mu.Lock()
+	if c.refreshing[hash] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[hash] = true
+	gen := c.gen
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, hash)
+			c.mu.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if _, err := c.fetchAndCache(ctx, hash, gen); err != nil {
+			log.Printf("key cache: background refresh failed: %v", err)
+		}
+	}()
+}
+
+// fetchAndCache looks hash up and caches the result unless the cache was
+// invalidated since gen, when the result may predate the change.
+func (c *KeyCache) fetchAndCache(ctx context.Context, hash string, gen uint64) (*store.LLMAPIKey, error) {
 	key, err := c.store.GetLLMKeyByHash(ctx, hash)
 	if err != nil {
 		return nil, err
 	}
 
 	c.mu.Lock()
-	c.items[hash] = &keyCacheEntry{key: key, expires: now.Add(c.ttl)}
+	if c.gen == gen {
+		c.items[hash] = &keyCacheEntry{key: key, expires: time.Now().Add(c.ttl)}
+	}
 	c.mu.Unlock()
 
 	return key, nil
 }
 
+// Prime caches keys ahead of their first request, e.g. at startup.
+func (c *KeyCache) Prime(keys []store.LLMAPIKey) {
+	expires := time.Now().Add(c.ttl)
+	c.mu.Lock()
+	for i := range keys {
+		c.items[keys[i].KeyHash] = &keyCacheEntry{key: &keys[i], expires: expires}
+	}
+	c.mu.Unlock()
+}
+
 // Invalidate removes a specific key hash from the cache.
 func (c *KeyCache) Invalidate(hash string) {
 	c.mu.Lock()
 	delete(c.items, hash)
+	c.gen++
 	c.mu.Unlock()
 }
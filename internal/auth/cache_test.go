@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// fakeKeys answers key lookups with name, blocking each one until release
+// is closed when it is set.
+type fakeKeys struct {
+	mu      sync.Mutex
+	name    string
+	err     error
+	release chan struct{}
+	calls   int
+}
+
+func (f *fakeKeys) GetLLMKeyByHash(ctx context.Context, hash string) (*store.LLMAPIKey, error) {
+	f.mu.Lock()
+	f.calls++
+	release, name, err := f.release, f.name, f.err
+	f.mu.Unlock()
+	if release != nil {
+		<-release
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &store.LLMAPIKey{KeyHash: hash, Name: name}, nil
+}
+
+func (f *fakeKeys) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// expiredKeyCache returns a cache holding key "h" named "old", expired a
+// second ago.
+func expiredKeyCache(f *fakeKeys) *KeyCache {
+	c := newKeyCache(f, time.Minute)
+	c.Prime([]store.LLMAPIKey{{KeyHash: "h", Name: "old"}})
+	c.items["h"].expires = time.Now().Add(-time.Second)
+	return c
+}
+
+func waitRefreshed(t *testing.T, c *KeyCache, hash string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.RLock()
+		busy := c.refreshing[hash]
+		c.mu.RUnlock()
+		if !busy {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("background refresh did not finish")
+}
+
+func keyName(t *testing.T, c *KeyCache) string {
+	t.Helper()
+	key, err := c.GetLLMKeyByHash(context.Background(), "h")
+	if err != nil {
+		t.Fatalf("GetLLMKeyByHash: %v", err)
+	}
+	return key.Name
+}
+
+func TestKeyCacheServesStaleWhileRefreshing(t *testing.T) {
+	f := &fakeKeys{name: "new", release: make(chan struct{})}
+	c := expiredKeyCache(f)
+
+	// Both calls return at once even though the lookup is blocked, and
+	// share one refresh.
+	if got := keyName(t, c); got != "old" {
+		t.Fatalf("got %q, want the stale key", got)
+	}
+	if got := keyName(t, c); got != "old" {
+		t.Fatalf("got %q, want the stale key", got)
+	}
+	close(f.release)
+	waitRefreshed(t, c, "h")
+
+	if got := keyName(t, c); got != "new" {
+		t.Fatalf("got %q after refresh, want new", got)
+	}
+	if n := f.callCount(); n != 1 {
+		t.Fatalf("expected one lookup, got %d", n)
+	}
+}
+
+func TestKeyCacheBlocksPastMaxStale(t *testing.T) {
+	f := &fakeKeys{name: "new"}
+	c := expiredKeyCache(f)
+	c.SetMaxStale(0)
+
+	if got := keyName(t, c); got != "new" {
+		t.Fatalf("got %q, want a synchronous lookup", got)
+	}
+}
+
+func TestKeyCacheKeepsStaleKeyWhenRefreshFails(t *testing.T) {
+	f := &fakeKeys{err: errors.New("connection refused")}
+	c := expiredKeyCache(f)
+
+	if got := keyName(t, c); got != "old" {
+		t.Fatalf("got %q, want the stale key", got)
+	}
+	waitRefreshed(t, c, "h")
+	if got := keyName(t, c); got != "old" {
+		t.Fatalf("got %q after a failed refresh, want the stale key", got)
+	}
+
+	c.items["h"].expires = time.Now().Add(-2 * defaultKeyMaxStale)
+	if _, err := c.GetLLMKeyByHash(context.Background(), "h"); err == nil {
+		t.Fatal("expected the lookup error once past max stale")
+	}
+}
+
+func TestKeyCacheInvalidateWinsOverRefresh(t *testing.T) {
+	f := &fakeKeys{name: "new", release: make(chan struct{})}
+	c := expiredKeyCache(f)
+
+	keyName(t, c)
+	c.Invalidate("h")
+	close(f.release)
+	waitRefreshed(t, c, "h")
+
+	c.mu.RLock()
+	_, cached := c.items["h"]
+	c.mu.RUnlock()
+	if cached {
+		t.Fatal("a refresh started before Invalidate repopulated the cache")
+	}
+}
@@ -15,13 +15,13 @@ import (
 type LastUsedTracker struct {
 	mu      sync.Mutex
 	pending map[uuid.UUID]struct{}
-	store   *store.Store
+	store   store.Store
 	done    chan struct{}
 	wg      sync.WaitGroup
 }
 
 // NewLastUsedTracker creates a tracker that flushes every 30 seconds.
-func NewLastUsedTracker(s *store.Store) *LastUsedTracker {
+func NewLastUsedTracker(s store.Store) *LastUsedTracker {
 	t := &LastUsedTracker{
 		pending: make(map[uuid.UUID]struct{}),
 		store:   s,
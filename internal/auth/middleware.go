@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/apierror"
+	"github.com/sertdev/pxbin/internal/ratelimit"
+	"github.com/sertdev/pxbin/internal/slogger"
 	"github.com/sertdev/pxbin/internal/store"
 )
 
@@ -48,6 +52,30 @@ func GetManagementKeyFromContext(ctx context.Context) *store.ManagementAPIKey {
 }
 
 func LLMAuthMiddleware(cache *KeyCache, tracker *LastUsedTracker) func(http.Handler) http.Handler {
+	return LLMAuthMiddlewareWithTarpit(cache, tracker, nil)
+}
+
+// LLMAuthMiddlewareWithTarpit is LLMAuthMiddleware with penalties for
+// clients that keep sending invalid keys. A nil tarpit disables them.
+func LLMAuthMiddlewareWithTarpit(cache *KeyCache, tracker *LastUsedTracker, tarpit *Tarpit) func(http.Handler) http.Handler {
+	return LLMAuthMiddlewareWithOpts(cache, tracker, LLMAuthOpts{Tarpit: tarpit})
+}
+
+// BudgetChecker reports whether a key has spent one of its budgets, with
+// the message for the client and the time until the budget resets.
+type BudgetChecker interface {
+	CheckBudget(k *store.LLMAPIKey) (exceeded bool, message string, retryAfter time.Duration)
+}
+
+// LLMAuthOpts holds the optional checks of LLM key authentication.
+type LLMAuthOpts struct {
+	Tarpit  *Tarpit       // nil = invalid keys are not penalized
+	Budgets BudgetChecker // nil = spend budgets are not enforced
+}
+
+// LLMAuthMiddlewareWithOpts is LLMAuthMiddleware with the checks in opts.
+func LLMAuthMiddlewareWithOpts(cache *KeyCache, tracker *LastUsedTracker, opts LLMAuthOpts) func(http.Handler) http.Handler {
+	tarpit := opts.Tarpit
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			key := extractAPIKey(r)
@@ -56,6 +84,16 @@ func LLMAuthMiddleware(cache *KeyCache, tracker *LastUsedTracker) func(http.Hand
 				return
 			}
 
+			var ip string
+			if tarpit != nil {
+				ip = tarpit.ClientIP(r)
+				if banned, remaining := tarpit.Banned(r.Context(), ip); banned {
+					ratelimit.Hints{RetryAfter: remaining, Reset: remaining, NoRetry: true}.Set(w.Header(), time.Now())
+					writeAuthError(w, r, http.StatusTooManyRequests, "Too many failed authentication attempts")
+					return
+				}
+			}
+
 			hash := HashKey(key)
 			record, err := cache.GetLLMKeyByHash(r.Context(), hash)
 			if err != nil {
@@ -63,6 +101,9 @@ func LLMAuthMiddleware(cache *KeyCache, tracker *LastUsedTracker) func(http.Hand
 				return
 			}
 			if record == nil {
+				if tarpit != nil {
+					sleepCtx(r.Context(), tarpit.Fail(r.Context(), ip))
+				}
 				writeAuthError(w, r, http.StatusUnauthorized, "Invalid API key")
 				return
 			}
@@ -70,38 +111,46 @@ func LLMAuthMiddleware(cache *KeyCache, tracker *LastUsedTracker) func(http.Hand
 				writeAuthError(w, r, http.StatusForbidden, "API key is deactivated")
 				return
 			}
+			if opts.Budgets != nil {
+				if exceeded, msg, retryAfter := opts.Budgets.CheckBudget(record); exceeded {
+					ratelimit.Hints{RetryAfter: retryAfter, Reset: retryAfter, NoRetry: true}.Set(w.Header(), time.Now())
+					writeBudgetError(w, r, msg)
+					return
+				}
+			}
 
 			tracker.Touch(record.ID)
 
 			ctx := r.Context()
 			ctx = context.WithValue(ctx, ctxKeyLLMKeyID, record.ID)
 			ctx = context.WithValue(ctx, ctxKeyLLMKey, record)
+			ctx = slogger.With(ctx, "key_id", record.ID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-func ManagementAuthMiddleware(s *store.Store) func(http.Handler) http.Handler {
+func ManagementAuthMiddleware(s store.Store) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			key := extractAPIKey(r)
 			if key == "" {
-				writeJSONError(w, http.StatusUnauthorized, "Missing API key")
+				writeManagementError(w, r, http.StatusUnauthorized, "authentication_error", "missing_api_key", "Missing API key")
 				return
 			}
 
 			hash := HashKey(key)
 			record, err := s.GetManagementKeyByHash(r.Context(), hash)
 			if err != nil {
-				writeJSONError(w, http.StatusInternalServerError, "Internal server error")
+				writeManagementError(w, r, http.StatusInternalServerError, "server_error", "server_error", "Internal server error")
 				return
 			}
 			if record == nil {
-				writeJSONError(w, http.StatusUnauthorized, "Invalid API key")
+				writeManagementError(w, r, http.StatusUnauthorized, "authentication_error", "invalid_api_key", "Invalid API key")
 				return
 			}
 			if !record.IsActive {
-				writeJSONError(w, http.StatusForbidden, "API key is deactivated")
+				writeManagementError(w, r, http.StatusForbidden, "permission_error", "key_deactivated", "API key is deactivated")
 				return
 			}
 
@@ -120,21 +169,60 @@ func extractAPIKey(r *http.Request) string {
 	if strings.HasPrefix(auth, "Bearer ") {
 		return strings.TrimPrefix(auth, "Bearer ")
 	}
+	// Gemini SDKs send the key in x-goog-api-key or the key query parameter.
+	if strings.HasPrefix(r.URL.Path, "/v1beta/") {
+		if key := r.Header.Get("x-goog-api-key"); key != "" {
+			return key
+		}
+		return r.URL.Query().Get("key")
+	}
 	return ""
 }
 
+// WriteError writes an error in the API format of the request's endpoint,
+// for rejections of LLM requests outside this package.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeAuthError(w, r, status, message)
+}
+
 func writeAuthError(w http.ResponseWriter, r *http.Request, status int, message string) {
-	if strings.HasPrefix(r.URL.Path, "/v1/messages") {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/messages"):
 		writeAnthropicError(w, status, message)
-	} else {
+	case strings.HasPrefix(r.URL.Path, "/v1beta/"):
+		writeGeminiError(w, status, message)
+	default:
 		writeOpenAIError(w, status, message)
 	}
 }
 
+// writeBudgetError rejects a request from a key over its spend budget with
+// 429, as each API reports an exhausted quota.
+func writeBudgetError(w http.ResponseWriter, r *http.Request, message string) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/messages"):
+		writeAnthropicError(w, http.StatusTooManyRequests, message)
+	case strings.HasPrefix(r.URL.Path, "/v1beta/"):
+		writeGeminiError(w, http.StatusTooManyRequests, message)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error": map[string]any{
+				"message": message,
+				"type":    "insufficient_quota",
+				"code":    "budget_exceeded",
+			},
+		})
+	}
+}
+
 func writeAnthropicError(w http.ResponseWriter, status int, message string) {
 	errType := "authentication_error"
 	if status == http.StatusForbidden {
 		errType = "permission_error"
+	} else if status == http.StatusTooManyRequests {
+		errType = "rate_limit_error"
 	} else if status == http.StatusInternalServerError {
 		errType = "api_error"
 	}
@@ -154,6 +242,8 @@ func writeOpenAIError(w http.ResponseWriter, status int, message string) {
 	errType := "invalid_api_key"
 	if status == http.StatusForbidden {
 		errType = "access_denied"
+	} else if status == http.StatusTooManyRequests {
+		errType = "rate_limit_exceeded"
 	} else if status == http.StatusInternalServerError {
 		errType = "server_error"
 	}
@@ -169,10 +259,29 @@ func writeOpenAIError(w http.ResponseWriter, status int, message string) {
 	})
 }
 
-func writeJSONError(w http.ResponseWriter, status int, message string) {
+func writeGeminiError(w http.ResponseWriter, status int, message string) {
+	errStatus := "UNAUTHENTICATED"
+	if status == http.StatusForbidden {
+		errStatus = "PERMISSION_DENIED"
+	} else if status == http.StatusTooManyRequests {
+		errStatus = "RESOURCE_EXHAUSTED"
+	} else if status == http.StatusInternalServerError {
+		errStatus = "INTERNAL"
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(map[string]any{
-		"error": message,
+		"error": map[string]any{
+			"code":    status,
+			"message": message,
+			"status":  errStatus,
+		},
 	})
 }
+
+// writeManagementError rejects a management API request in the management
+// API's error envelope.
+func writeManagementError(w http.ResponseWriter, r *http.Request, status int, errType, code, message string) {
+	apierror.Write(w, r, status, &apierror.Error{Type: errType, Code: code, Message: message})
+}
@@ -0,0 +1,299 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Offender is a client IP with recent authentication failures.
+type Offender struct {
+	IP          string     `json:"ip"`
+	Failures    int        `json:"failures"`
+	BannedUntil *time.Time `json:"banned_until"`
+}
+
+// FailureStore tracks authentication failures and bans per client IP.
+// MemoryFailureStore keeps them per process; RedisFailureStore shares them
+// between replicas.
+type FailureStore interface {
+	// RecordFailure counts a failure for ip and returns the number of
+	// failures within window, counted from the first one.
+	RecordFailure(ctx context.Context, ip string, window time.Duration) (int, error)
+	Ban(ctx context.Context, ip string, until time.Time) error
+	// BannedUntil returns when ip's ban ends, or the zero time if it is
+	// not banned.
+	BannedUntil(ctx context.Context, ip string) (time.Time, error)
+	// Clear lifts ip's ban and forgets its failures.
+	Clear(ctx context.Context, ip string) error
+	Offenders(ctx context.Context) ([]Offender, error)
+}
+
+// TarpitOpts configures a Tarpit.
+type TarpitOpts struct {
+	BaseDelay    time.Duration // response delay after the first failure, doubled for each further one
+	MaxDelay     time.Duration // cap on the response delay
+	BanThreshold int           // failures within Window that ban the IP; 0 disables bans
+	Window       time.Duration // how long failures are remembered
+	BanDuration  time.Duration
+
+	// TrustForwardedFor takes the client IP from the last X-Forwarded-For
+	// hop, for deployments behind a load balancer.
+	TrustForwardedFor bool
+}
+
+// Tarpit penalises clients that repeatedly fail authentication. Each
+// failure delays the response exponentially, and an IP that keeps failing
+// is banned for a while: banned requests are rejected before the key is
+// looked up, so brute-force attempts stop costing a database round-trip.
+type Tarpit struct {
+	opts  TarpitOpts
+	store FailureStore
+}
+
+// NewTarpit creates a tarpit backed by store.
+func NewTarpit(store FailureStore, opts TarpitOpts) *Tarpit {
+	return &Tarpit{opts: opts, store: store}
+}
+
+// Banned reports whether ip is banned and, if so, for how much longer.
+// Store errors fail open.
+func (t *Tarpit) Banned(ctx context.Context, ip string) (bool, time.Duration) {
+	until, err := t.store.BannedUntil(ctx, ip)
+	if err != nil {
+		log.Printf("auth tarpit: ban lookup for %s failed: %v", ip, err)
+		return false, 0
+	}
+	if remaining := time.Until(until); remaining > 0 {
+		return true, remaining
+	}
+	return false, 0
+}
+
+// Fail records a failed attempt from ip, banning it once it crosses the
+// threshold, and returns how long to delay the response.
+func (t *Tarpit) Fail(ctx context.Context, ip string) time.Duration {
+	n, err := t.store.RecordFailure(ctx, ip, t.opts.Window)
+	if err != nil {
+		log.Printf("auth tarpit: recording failure for %s failed: %v", ip, err)
+		return t.opts.BaseDelay
+	}
+	if t.opts.BanThreshold > 0 && n >= t.opts.BanThreshold {
+		if err := t.store.Ban(ctx, ip, time.Now().Add(t.opts.BanDuration)); err != nil {
+			log.Printf("auth tarpit: banning %s failed: %v", ip, err)
+		}
+	}
+	return t.delay(n)
+}
+
+// delay returns the response delay after n failures.
+func (t *Tarpit) delay(n int) time.Duration {
+	d := t.opts.BaseDelay
+	for i := 1; i < n && i < 32; i++ {
+		d *= 2
+		if t.opts.MaxDelay > 0 && d >= t.opts.MaxDelay {
+			break
+		}
+	}
+	if t.opts.MaxDelay > 0 && d > t.opts.MaxDelay {
+		d = t.opts.MaxDelay
+	}
+	return d
+}
+
+// Offenders lists IPs with recent failures or an active ban.
+func (t *Tarpit) Offenders(ctx context.Context) ([]Offender, error) {
+	return t.store.Offenders(ctx)
+}
+
+// Clear lifts ip's ban and forgets its failures.
+func (t *Tarpit) Clear(ctx context.Context, ip string) error {
+	return t.store.Clear(ctx, ip)
+}
+
+// ClientIP returns the IP a request is attributed to.
+func (t *Tarpit) ClientIP(r *http.Request) string {
+	return ClientIP(r, t.opts.TrustForwardedFor)
+}
+
+// ClientIP returns the caller's address: the last X-Forwarded-For hop when
+// trustForwardedFor is set, otherwise the connection's remote host. The
+// last hop is the one the trusted proxy appended; earlier ones are whatever
+// the client sent, so trusting them would let a client dodge a ban or get
+// someone else banned.
+func ClientIP(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			last := xff[len(xff)-1]
+			if i := strings.LastIndexByte(last, ','); i >= 0 {
+				last = last[i+1:]
+			}
+			if ip := strings.TrimSpace(last); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// sleepCtx waits for d or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+type failureRecord struct {
+	failures    int
+	windowEnd   time.Time
+	bannedUntil time.Time
+}
+
+// MemoryFailureStore is an in-process FailureStore.
+type MemoryFailureStore struct {
+	mu      sync.Mutex
+	records map[string]*failureRecord
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewMemoryFailureStore creates an in-memory failure store. Close stops
+// its cleanup goroutine.
+func NewMemoryFailureStore() *MemoryFailureStore {
+	s := &MemoryFailureStore{
+		records: make(map[string]*failureRecord),
+		done:    make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.cleanup()
+	return s
+}
+
+func (s *MemoryFailureStore) RecordFailure(_ context.Context, ip string, window time.Duration) (int, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[ip]
+	if !ok {
+		rec = &failureRecord{}
+		s.records[ip] = rec
+	}
+	if now.After(rec.windowEnd) {
+		rec.failures = 0
+		rec.windowEnd = now.Add(window)
+	}
+	rec.failures++
+	return rec.failures, nil
+}
+
+func (s *MemoryFailureStore) Ban(_ context.Context, ip string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[ip]
+	if !ok {
+		rec = &failureRecord{}
+		s.records[ip] = rec
+	}
+	rec.bannedUntil = until
+	return nil
+}
+
+func (s *MemoryFailureStore) BannedUntil(_ context.Context, ip string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, ok := s.records[ip]; ok {
+		return rec.bannedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *MemoryFailureStore) Clear(_ context.Context, ip string) error {
+	s.mu.Lock()
+	delete(s.records, ip)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryFailureStore) Offenders(_ context.Context) ([]Offender, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offenders := make([]Offender, 0, len(s.records))
+	for ip, rec := range s.records {
+		o := Offender{IP: ip}
+		if now.Before(rec.windowEnd) {
+			o.Failures = rec.failures
+		}
+		if now.Before(rec.bannedUntil) {
+			until := rec.bannedUntil
+			o.BannedUntil = &until
+		}
+		if o.Failures > 0 || o.BannedUntil != nil {
+			offenders = append(offenders, o)
+		}
+	}
+	sortOffenders(offenders)
+	return offenders, nil
+}
+
+// Close stops the cleanup goroutine.
+func (s *MemoryFailureStore) Close() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+// cleanup evicts records whose window and ban have both ended.
+func (s *MemoryFailureStore) cleanup() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(60 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			s.mu.Lock()
+			for ip, rec := range s.records {
+				if now.After(rec.windowEnd) && now.After(rec.bannedUntil) {
+					delete(s.records, ip)
+				}
+			}
+			s.mu.Unlock()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// sortOffenders orders banned IPs first, then by failure count.
+func sortOffenders(offenders []Offender) {
+	sort.Slice(offenders, func(i, j int) bool {
+		a, b := offenders[i], offenders[j]
+		if (a.BannedUntil != nil) != (b.BannedUntil != nil) {
+			return a.BannedUntil != nil
+		}
+		if a.Failures != b.Failures {
+			return a.Failures > b.Failures
+		}
+		return a.IP < b.IP
+	})
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/redis"
+)
+
+const (
+	redisFailPrefix = "pxbin:authfail:"
+	redisBanPrefix  = "pxbin:authban:"
+)
+
+// RedisFailureStore is a FailureStore shared by every replica using the
+// same Redis. Failure counters and bans are keys that expire on their own.
+type RedisFailureStore struct {
+	client *redis.Client
+}
+
+func NewRedisFailureStore(client *redis.Client) *RedisFailureStore {
+	return &RedisFailureStore{client: client}
+}
+
+// recordFailureScript counts a failure and starts the window with the
+// first, in one step, so a counter can never be left without an expiry.
+const recordFailureScript = `
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`
+
+func (s *RedisFailureStore) RecordFailure(ctx context.Context, ip string, window time.Duration) (int, error) {
+	n, err := redis.Int(s.client.Do(ctx, "EVAL", recordFailureScript, "1", redisFailPrefix+ip, strconv.FormatInt(window.Milliseconds(), 10)))
+	if err != nil {
+		return 0, fmt.Errorf("record auth failure: %w", err)
+	}
+	return int(n), nil
+}
+
+func (s *RedisFailureStore) Ban(ctx context.Context, ip string, until time.Time) error {
+	ms := time.Until(until).Milliseconds()
+	if ms <= 0 {
+		return nil
+	}
+	_, err := s.client.Do(ctx, "SET", redisBanPrefix+ip, strconv.FormatInt(until.UnixMilli(), 10), "PX", strconv.FormatInt(ms, 10))
+	if err != nil {
+		return fmt.Errorf("ban ip: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisFailureStore) BannedUntil(ctx context.Context, ip string) (time.Time, error) {
+	ms, err := redis.Int(s.client.Do(ctx, "GET", redisBanPrefix+ip))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("get ban: %w", err)
+	}
+	if ms == 0 {
+		return time.Time{}, nil
+	}
+	return time.UnixMilli(ms), nil
+}
+
+func (s *RedisFailureStore) Clear(ctx context.Context, ip string) error {
+	if _, err := s.client.Do(ctx, "DEL", redisFailPrefix+ip, redisBanPrefix+ip); err != nil {
+		return fmt.Errorf("clear ip: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisFailureStore) Offenders(ctx context.Context) ([]Offender, error) {
+	byIP := make(map[string]*Offender)
+	get := func(ip string) *Offender {
+		o, ok := byIP[ip]
+		if !ok {
+			o = &Offender{IP: ip}
+			byIP[ip] = o
+		}
+		return o
+	}
+
+	fails, err := s.client.Scan(ctx, redisFailPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range fails {
+		n, err := redis.Int(s.client.Do(ctx, "GET", key))
+		if err != nil {
+			return nil, fmt.Errorf("get auth failures: %w", err)
+		}
+		if n > 0 {
+			get(strings.TrimPrefix(key, redisFailPrefix)).Failures = int(n)
+		}
+	}
+
+	bans, err := s.client.Scan(ctx, redisBanPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range bans {
+		ms, err := redis.Int(s.client.Do(ctx, "GET", key))
+		if err != nil {
+			return nil, fmt.Errorf("get ban: %w", err)
+		}
+		if ms > 0 {
+			until := time.UnixMilli(ms)
+			get(strings.TrimPrefix(key, redisBanPrefix)).BannedUntil = &until
+		}
+	}
+
+	offenders := make([]Offender, 0, len(byIP))
+	for _, o := range byIP {
+		offenders = append(offenders, *o)
+	}
+	sortOffenders(offenders)
+	return offenders, nil
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/redis"
+)
+
+func TestTarpitDelayDoublesUpToMax(t *testing.T) {
+	tp := NewTarpit(nil, TarpitOpts{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second})
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, w := range want {
+		if got := tp.delay(i + 1); got != w*time.Millisecond {
+			t.Fatalf("delay(%d) = %v, want %v", i+1, got, w*time.Millisecond)
+		}
+	}
+	if got := tp.delay(1000); got != time.Second {
+		t.Fatalf("delay(1000) = %v, want cap", got)
+	}
+}
+
+func TestTarpitBansAfterThreshold(t *testing.T) {
+	store := NewMemoryFailureStore()
+	defer store.Close()
+	tp := NewTarpit(store, TarpitOpts{BanThreshold: 3, Window: time.Minute, BanDuration: time.Minute})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		tp.Fail(ctx, "10.0.0.1")
+	}
+	if banned, _ := tp.Banned(ctx, "10.0.0.1"); banned {
+		t.Fatal("banned before reaching the threshold")
+	}
+	tp.Fail(ctx, "10.0.0.1")
+	banned, remaining := tp.Banned(ctx, "10.0.0.1")
+	if !banned || remaining <= 0 || remaining > time.Minute {
+		t.Fatalf("expected a one-minute ban, got banned=%v remaining=%v", banned, remaining)
+	}
+	if banned, _ := tp.Banned(ctx, "10.0.0.2"); banned {
+		t.Fatal("other IPs must not be banned")
+	}
+
+	tp.Fail(ctx, "10.0.0.2")
+	offenders, err := tp.Offenders(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offenders) != 2 || offenders[0].IP != "10.0.0.1" || offenders[0].BannedUntil == nil || offenders[1].Failures != 1 {
+		t.Fatalf("unexpected offenders: %+v", offenders)
+	}
+
+	if err := tp.Clear(ctx, "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if banned, _ := tp.Banned(ctx, "10.0.0.1"); banned {
+		t.Fatal("ban should be lifted after Clear")
+	}
+}
+
+func TestMemoryFailureStoreWindowExpires(t *testing.T) {
+	store := NewMemoryFailureStore()
+	defer store.Close()
+	ctx := context.Background()
+
+	store.RecordFailure(ctx, "ip", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if n, _ := store.RecordFailure(ctx, "ip", time.Minute); n != 1 {
+		t.Fatalf("expected the count to restart after the window, got %d", n)
+	}
+}
+
+func TestTarpitClientIP(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/messages", nil)
+	r.RemoteAddr = "192.0.2.1:4321"
+	r.Header.Set("X-Forwarded-For", "198.51.100.9, 203.0.113.7")
+
+	if got := NewTarpit(nil, TarpitOpts{}).ClientIP(r); got != "192.0.2.1" {
+		t.Fatalf("expected remote address, got %q", got)
+	}
+	if got := NewTarpit(nil, TarpitOpts{TrustForwardedFor: true}).ClientIP(r); got != "203.0.113.7" {
+		t.Fatalf("expected the hop the proxy appended, got %q", got)
+	}
+	// A client-sent header line comes before the one the proxy adds.
+	r.Header.Add("X-Forwarded-For", "192.0.2.50")
+	if got := ClientIP(r, true); got != "192.0.2.50" {
+		t.Fatalf("expected the last header line's hop, got %q", got)
+	}
+}
+
+// TestRedisFailureStoreExpiry runs against a real Redis and is skipped
+// unless PXBIN_TEST_REDIS_URL is set.
+func TestRedisFailureStoreExpiry(t *testing.T) {
+	url := os.Getenv("PXBIN_TEST_REDIS_URL")
+	if url == "" {
+		t.Skip("PXBIN_TEST_REDIS_URL not set")
+	}
+	client, err := redis.NewClient(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+	store := NewRedisFailureStore(client)
+	ip := "test-" + uuid.NewString()
+	defer store.Clear(ctx, ip)
+
+	for want := 1; want <= 2; want++ {
+		if n, err := store.RecordFailure(ctx, ip, time.Minute); err != nil || n != want {
+			t.Fatalf("failure %d: got %d, %v", want, n, err)
+		}
+	}
+	// The counter gets its expiry with the first failure.
+	if ttl, err := redis.Int(client.Do(ctx, "PTTL", redisFailPrefix+ip)); err != nil || ttl <= 0 || ttl > time.Minute.Milliseconds() {
+		t.Fatalf("expected the counter to expire within the window, got PTTL %d, %v", ttl, err)
+	}
+}
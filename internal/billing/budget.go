@@ -0,0 +1,180 @@
+package billing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/events"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// spendRefreshInterval is how often running spend is reconciled with the
+// request logs, which also carry the spend of other instances.
+const spendRefreshInterval = 30 * time.Second
+
+// keySpend is a key's running spend in the UTC day and month starting at
+// day and month.
+type keySpend struct {
+	day, month time.Time
+	store.KeySpend
+}
+
+func dayStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// BudgetResets returns when the daily and monthly budgets next reset.
+func BudgetResets(now time.Time) (day, month time.Time) {
+	return dayStart(now).AddDate(0, 0, 1), monthStart(now).AddDate(0, 1, 0)
+}
+
+// roll starts new totals for windows that ended before now.
+func (s *keySpend) roll(now time.Time) {
+	if d := dayStart(now); d.After(s.day) {
+		s.day, s.Daily = d, 0
+	}
+	if m := monthStart(now); m.After(s.month) {
+		s.month, s.Monthly = m, 0
+	}
+}
+
+// AddSpend adds the cost of a request made at at to the key's running
+// spend, so budgets apply before the request's log reaches the database.
+func (t *Tracker) AddSpend(keyID uuid.UUID, cost float64, at time.Time) {
+	if cost <= 0 || keyID == uuid.Nil {
+		return
+	}
+	t.spendMu.Lock()
+	defer t.spendMu.Unlock()
+	s, ok := t.spend[keyID]
+	if !ok {
+		s = &keySpend{}
+		t.spend[keyID] = s
+	}
+	s.roll(at)
+	if at.Before(s.month) {
+		return // logged after its month ended
+	}
+	if !at.Before(s.day) {
+		s.Daily += cost
+	}
+	s.Monthly += cost
+}
+
+// Spend returns the key's running spend in the current UTC day and month.
+func (t *Tracker) Spend(keyID uuid.UUID) store.KeySpend {
+	return t.spendAt(keyID, time.Now())
+}
+
+func (t *Tracker) spendAt(keyID uuid.UUID, now time.Time) store.KeySpend {
+	t.spendMu.Lock()
+	defer t.spendMu.Unlock()
+	s, ok := t.spend[keyID]
+	if !ok {
+		return store.KeySpend{}
+	}
+	s.roll(now)
+	return s.KeySpend
+}
+
+// RefreshSpend reloads the spend of keys with a budget from the request
+// logs. Totals counted here that are not logged yet are kept.
+func (t *Tracker) RefreshSpend(ctx context.Context) error {
+	now := time.Now()
+	day, month := dayStart(now), monthStart(now)
+	logged, err := t.store.ListBudgetedKeySpend(ctx, day, month)
+	if err != nil {
+		return err
+	}
+
+	t.spendMu.Lock()
+	defer t.spendMu.Unlock()
+	spend := make(map[uuid.UUID]*keySpend, len(logged))
+	for id, ks := range logged {
+		s := &keySpend{day: day, month: month, KeySpend: ks}
+		if cur, ok := t.spend[id]; ok {
+			cur.roll(now)
+			s.Daily = max(s.Daily, cur.Daily)
+			s.Monthly = max(s.Monthly, cur.Monthly)
+		}
+		spend[id] = s
+	}
+	t.spend = spend
+	return nil
+}
+
+// CheckBudget reports whether k has spent its daily or monthly budget,
+// with a message for the client and the time until the budget resets.
+func (t *Tracker) CheckBudget(k *store.LLMAPIKey) (exceeded bool, message string, retryAfter time.Duration) {
+	return t.checkBudgetAt(k, time.Now())
+}
+
+func (t *Tracker) checkBudgetAt(k *store.LLMAPIKey, now time.Time) (bool, string, time.Duration) {
+	window, budget, resets := t.spentBudget(k, now)
+	t.noteBudgetState(k, window, budget, resets)
+	switch window {
+	case "monthly":
+		return true, fmt.Sprintf("Monthly budget of $%.2f for this API key is exhausted; it resets at %s", budget, resets.Format(time.RFC3339)), resets.Sub(now)
+	case "daily":
+		return true, fmt.Sprintf("Daily budget of $%.2f for this API key is exhausted; it resets at %s", budget, resets.Format(time.RFC3339)), resets.Sub(now)
+	}
+	return false, "", 0
+}
+
+// spentBudget returns which of k's budgets is spent, "monthly" or "daily",
+// with its amount and when it resets. window is "" if k is within its
+// budgets.
+func (t *Tracker) spentBudget(k *store.LLMAPIKey, now time.Time) (window string, budget float64, resets time.Time) {
+	daily, monthly := k.Budgets()
+	if daily == nil && monthly == nil {
+		return "", 0, time.Time{}
+	}
+	s := t.spendAt(k.ID, now)
+	dayReset, monthReset := BudgetResets(now)
+	if monthly != nil && s.Monthly >= *monthly {
+		return "monthly", *monthly, monthReset
+	}
+	if daily != nil && s.Daily >= *daily {
+		return "daily", *daily, dayReset
+	}
+	return "", 0, time.Time{}
+}
+
+// SetEvents makes the tracker emit key.budget_exceeded when a key's
+// requests start being rejected for its budget, and key.budget_restored
+// when they are let through again.
+func (t *Tracker) SetEvents(b *events.Bus) {
+	t.events = b
+}
+
+// noteBudgetState emits an event if the budget k has spent, window, changed
+// since its last check on this instance.
+func (t *Tracker) noteBudgetState(k *store.LLMAPIKey, window string, budget float64, resets time.Time) {
+	if t.events == nil {
+		return
+	}
+	t.spendMu.Lock()
+	prev := t.overBudget[k.ID]
+	if window == "" {
+		delete(t.overBudget, k.ID)
+	} else {
+		t.overBudget[k.ID] = window
+	}
+	t.spendMu.Unlock()
+
+	switch {
+	case window == prev:
+	case window == "":
+		t.events.Emit(events.KeyBudgetRestored, k.ID, k.Name, map[string]any{"budget": prev})
+	default:
+		t.events.Emit(events.KeyBudgetExceeded, k.ID, k.Name, map[string]any{"budget": window, "budget_usd": budget, "resets_at": resets})
+	}
+}
@@ -0,0 +1,120 @@
+package billing
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/events"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestCheckBudgetUsesRunningSpend(t *testing.T) {
+	st := store.NewMemory()
+	tr := NewTracker(st)
+	defer tr.Close()
+	ctx := context.Background()
+
+	key, err := st.CreateLLMKey(ctx, "hash", "pxb_budget", "budgeted", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	daily, monthly := 1.0, 5.0
+	key.DailyBudget, key.MonthlyBudget = &daily, &monthly
+
+	now := time.Date(2026, 3, 31, 22, 0, 0, 0, time.UTC)
+	tr.AddSpend(key.ID, 0.6, now.Add(-time.Hour))
+	if exceeded, _, _ := tr.checkBudgetAt(key, now); exceeded {
+		t.Fatal("expected the key to be within budget")
+	}
+
+	tr.AddSpend(key.ID, 0.4, now)
+	exceeded, msg, retryAfter := tr.checkBudgetAt(key, now)
+	if !exceeded || !strings.Contains(msg, "Daily budget of $1.00") || retryAfter != 2*time.Hour {
+		t.Fatalf("expected the daily budget to be exhausted until midnight, got %v %q %v", exceeded, msg, retryAfter)
+	}
+
+	tr.AddSpend(key.ID, 4, now.Add(-24*time.Hour))
+	if s := tr.spendAt(key.ID, now); s.Daily != 1 || s.Monthly != 5 {
+		t.Fatalf("unexpected spend: %+v", s)
+	}
+	exceeded, msg, _ = tr.checkBudgetAt(key, now)
+	if !exceeded || !strings.Contains(msg, "Monthly budget") || !strings.Contains(msg, "2026-04-01T00:00:00Z") {
+		t.Fatalf("expected the monthly budget to be exhausted, got %v %q", exceeded, msg)
+	}
+
+	// Both totals start over at midnight UTC on the first of the month.
+	if exceeded, _, _ := tr.checkBudgetAt(key, now.Add(3*time.Hour)); exceeded {
+		t.Fatal("expected the budgets to reset")
+	}
+}
+
+func TestRefreshSpendKeepsUnloggedSpend(t *testing.T) {
+	st := store.NewMemory()
+	tr := NewTracker(st)
+	defer tr.Close()
+	ctx := context.Background()
+
+	budgeted, _ := st.CreateLLMKey(ctx, "hash-a", "pxb_a", "budgeted", nil)
+	other, _ := st.CreateLLMKey(ctx, "hash-b", "pxb_b", "unbudgeted", nil)
+	monthly := 10.0
+	if ok, err := st.SetLLMKeyBudgets(ctx, budgeted.ID, nil, &monthly); !ok || err != nil {
+		t.Fatalf("set budgets: %v %v", ok, err)
+	}
+
+	now := time.Now()
+	if err := st.InsertLog(ctx, &store.LogEntry{KeyID: budgeted.ID, Timestamp: now, StatusCode: 200, Cost: 2}); err != nil {
+		t.Fatal(err)
+	}
+	tr.AddSpend(other.ID, 1, now)
+	if err := tr.RefreshSpend(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s := tr.Spend(budgeted.ID); s.Monthly != 2 {
+		t.Fatalf("expected the logged spend to be loaded, got %+v", s)
+	}
+	if s := tr.Spend(other.ID); s.Monthly != 0 {
+		t.Fatalf("expected spend of keys without a budget to be dropped, got %+v", s)
+	}
+
+	// Spend counted before its log is written survives a refresh.
+	tr.AddSpend(budgeted.ID, 3, now)
+	if err := tr.RefreshSpend(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s := tr.Spend(budgeted.ID); s.Monthly != 5 {
+		t.Fatalf("expected unlogged spend to be kept, got %+v", s)
+	}
+}
+
+func TestCheckBudgetEmitsTransitions(t *testing.T) {
+	st := store.NewMemory()
+	tr := NewTracker(st)
+	defer tr.Close()
+	var got []events.Event
+	bus := events.NewBus(0, events.ConsumerFunc(func(e events.Event) { got = append(got, e) }))
+	tr.SetEvents(bus)
+
+	key, err := st.CreateLLMKey(context.Background(), "hash", "pxb_events", "evented", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	daily := 1.0
+	key.DailyBudget = &daily
+
+	now := time.Date(2026, 3, 10, 22, 0, 0, 0, time.UTC)
+	tr.checkBudgetAt(key, now)
+	tr.AddSpend(key.ID, 1, now)
+	tr.checkBudgetAt(key, now)
+	tr.checkBudgetAt(key, now) // still over: no new event
+	tr.checkBudgetAt(key, now.Add(3*time.Hour))
+	bus.Close()
+
+	if len(got) != 2 || got[0].Type != events.KeyBudgetExceeded || got[1].Type != events.KeyBudgetRestored {
+		t.Fatalf("expected budget_exceeded then budget_restored, got %+v", got)
+	}
+	if got[0].KeyID != key.ID || got[0].Data["budget"] != "daily" || got[0].Data["budget_usd"] != 1.0 {
+		t.Fatalf("unexpected event: %+v", got[0])
+	}
+}
@@ -5,27 +5,51 @@ import (
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/events"
 	"github.com/sertdev/pxbin/internal/store"
 )
 
 type ModelPricing struct {
-	InputCostPerMillion  float64
-	OutputCostPerMillion float64
+	InputCostPerMillion     float64
+	OutputCostPerMillion    float64
+	ReasoningCostPerMillion float64 // 0 bills reasoning at the output price
+	WebSearchCostPer1K      float64
+	EmbeddingCostPerMillion float64
 }
 
+// Tracker holds per-model pricing and computes request cost. What is
+// persisted is per request: cost and token counts are written to
+// request_logs by the async logger (which can spill to a disk WAL while the
+// database is unavailable), and all usage and cost stats are derived from
+// those rows at query time.
+//
+// In memory it keeps only each key's running spend in the current day and
+// month, for spend budgets. It is added to as requests are logged and
+// periodically reconciled with request_logs, keeping the higher figure
+// while log writes catch up. It only mirrors the logged rows, so losing it
+// on a crash loses nothing, and a restart reloads it without double
+// counting.
 type Tracker struct {
 	pricing map[string]*ModelPricing
-	store   *store.Store
+	store   store.Store
 	mu      sync.RWMutex
 	done    chan struct{}
 	wg      sync.WaitGroup
+
+	spend      map[uuid.UUID]*keySpend
+	overBudget map[uuid.UUID]string // budget each key was last found over; guarded by spendMu
+	spendMu    sync.Mutex
+	events     *events.Bus
 }
 
-func NewTracker(s *store.Store) *Tracker {
+func NewTracker(s store.Store) *Tracker {
 	t := &Tracker{
-		pricing: make(map[string]*ModelPricing),
-		store:   s,
-		done:    make(chan struct{}),
+		pricing:    make(map[string]*ModelPricing),
+		store:      s,
+		done:       make(chan struct{}),
+		spend:      make(map[uuid.UUID]*keySpend),
+		overBudget: make(map[uuid.UUID]string),
 	}
 	// Load hardcoded defaults
 	t.loadDefaults()
@@ -33,6 +57,7 @@ func NewTracker(s *store.Store) *Tracker {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	_ = t.RefreshPricing(ctx)
+	_ = t.RefreshSpend(ctx)
 
 	// Start periodic refresh
 	t.wg.Add(1)
@@ -40,7 +65,10 @@ func NewTracker(s *store.Store) *Tracker {
 	return t
 }
 
-func (t *Tracker) CalculateCost(model string, inputTokens, outputTokens int) float64 {
+// CalculateCost returns the token cost of a request to model.
+// reasoningTokens is the part of outputTokens spent on reasoning, billed at
+// the model's reasoning price if it has one.
+func (t *Tracker) CalculateCost(model string, inputTokens, outputTokens, reasoningTokens int) float64 {
 	t.mu.RLock()
 	p, ok := t.pricing[model]
 	t.mu.RUnlock()
@@ -48,8 +76,56 @@ func (t *Tracker) CalculateCost(model string, inputTokens, outputTokens int) flo
 		return 0
 	}
 	inputCost := float64(inputTokens) / 1_000_000 * p.InputCostPerMillion
-	outputCost := float64(outputTokens) / 1_000_000 * p.OutputCostPerMillion
-	return inputCost + outputCost
+	if p.ReasoningCostPerMillion == 0 {
+		reasoningTokens = 0
+	}
+	reasoningTokens = min(reasoningTokens, outputTokens)
+	outputCost := float64(outputTokens-reasoningTokens) / 1_000_000 * p.OutputCostPerMillion
+	reasoningCost := float64(reasoningTokens) / 1_000_000 * p.ReasoningCostPerMillion
+	return inputCost + outputCost + reasoningCost
+}
+
+// Pricing returns the pricing of model, if any is known.
+func (t *Tracker) Pricing(model string) (ModelPricing, bool) {
+	t.mu.RLock()
+	p, ok := t.pricing[model]
+	t.mu.RUnlock()
+	if !ok {
+		return ModelPricing{}, false
+	}
+	return *p, true
+}
+
+// WebSearchCost returns the cost of webSearches server-side web searches
+// run for a request to model, which are billed per use on top of tokens.
+func (t *Tracker) WebSearchCost(model string, webSearches int) float64 {
+	if webSearches == 0 {
+		return 0
+	}
+	t.mu.RLock()
+	p, ok := t.pricing[model]
+	t.mu.RUnlock()
+	if !ok {
+		return 0
+	}
+	return float64(webSearches) / 1_000 * p.WebSearchCostPer1K
+}
+
+// EmbeddingCost returns the cost of an embedding request to model with
+// inputTokens input tokens, at the model's embedding price or, if it has
+// none, its input price.
+func (t *Tracker) EmbeddingCost(model string, inputTokens int) float64 {
+	t.mu.RLock()
+	p, ok := t.pricing[model]
+	t.mu.RUnlock()
+	if !ok {
+		return 0
+	}
+	perMillion := p.EmbeddingCostPerMillion
+	if perMillion == 0 {
+		perMillion = p.InputCostPerMillion
+	}
+	return float64(inputTokens) / 1_000_000 * perMillion
 }
 
 func (t *Tracker) RefreshPricing(ctx context.Context) error {
@@ -61,8 +137,11 @@ func (t *Tracker) RefreshPricing(ctx context.Context) error {
 	defer t.mu.Unlock()
 	for _, m := range models {
 		t.pricing[m.Name] = &ModelPricing{
-			InputCostPerMillion:  m.InputCostPerMillion,
-			OutputCostPerMillion: m.OutputCostPerMillion,
+			InputCostPerMillion:     m.InputCostPerMillion,
+			OutputCostPerMillion:    m.OutputCostPerMillion,
+			ReasoningCostPerMillion: m.ReasoningCostPerMillion,
+			WebSearchCostPer1K:      m.WebSearchCostPer1K,
+			EmbeddingCostPerMillion: m.EmbeddingCostPerMillion,
 		}
 	}
 	return nil
@@ -72,12 +151,18 @@ func (t *Tracker) refreshLoop() {
 	defer t.wg.Done()
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
+	spendTicker := time.NewTicker(spendRefreshInterval)
+	defer spendTicker.Stop()
 	for {
 		select {
 		case <-ticker.C:
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			_ = t.RefreshPricing(ctx)
 			cancel()
+		case <-spendTicker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			_ = t.RefreshSpend(ctx)
+			cancel()
 		case <-t.done:
 			return
 		}
@@ -0,0 +1,39 @@
+package billing
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestCalculateCostReasoningPrice(t *testing.T) {
+	st := store.NewMemory()
+	ctx := context.Background()
+	for _, m := range []*store.ModelCreate{
+		{Name: "reasoner", Provider: "openai", InputCostPerMillion: 1, OutputCostPerMillion: 4, ReasoningCostPerMillion: 10},
+		{Name: "flat", Provider: "openai", InputCostPerMillion: 1, OutputCostPerMillion: 4},
+	} {
+		if _, err := st.CreateModel(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tr := NewTracker(st)
+	defer tr.Close()
+
+	for _, tc := range []struct {
+		model                    string
+		input, output, reasoning int
+		want                     float64
+	}{
+		{"reasoner", 1_000_000, 1_000_000, 250_000, 1 + 3 + 2.5},
+		{"reasoner", 0, 1_000_000, 0, 4},
+		{"reasoner", 0, 100_000, 500_000, 1}, // reasoning capped at output
+		{"flat", 1_000_000, 1_000_000, 250_000, 5},
+	} {
+		if got := tr.CalculateCost(tc.model, tc.input, tc.output, tc.reasoning); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("CalculateCost(%s, %d, %d, %d) = %v, want %v", tc.model, tc.input, tc.output, tc.reasoning, got, tc.want)
+		}
+	}
+}
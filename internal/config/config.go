@@ -14,36 +14,190 @@ type Config struct {
 	DatabaseURL            string   `yaml:"database_url"`
 	DatabaseSchema         string   `yaml:"database_schema"`
 	LogBufferSize          int      `yaml:"log_buffer_size"`
+	LogOverflowPolicy      string   `yaml:"log_overflow_policy"`
+	LogBlockTimeoutMS      int      `yaml:"log_block_timeout_ms"`
+	LogSpillDir            string   `yaml:"log_spill_dir"`
+	LogSampleRate          float64  `yaml:"log_sample_rate"`
 	ManagementBootstrapKey string   `yaml:"management_bootstrap_key"`
 	CORSOrigins            []string `yaml:"cors_origins"`
 	EncryptionKey          string   `yaml:"encryption_key"`
 	LogRetentionDays       int      `yaml:"log_retention_days"`
+	AccessLogRetentionDays int      `yaml:"access_log_retention_days"`
 	RateLimitRPS           float64  `yaml:"rate_limit_rps"`
 	RateLimitBurst         int      `yaml:"rate_limit_burst"`
+	RateLimitBackend       string   `yaml:"rate_limit_backend"` // memory or redis
 	CBFailureThreshold     int      `yaml:"cb_failure_threshold"`
 	CBTimeoutSeconds       int      `yaml:"cb_timeout_seconds"`
 	RetryMaxAttempts       int      `yaml:"retry_max_attempts"`
 	RetryBaseDelayMS       int      `yaml:"retry_base_delay_ms"`
+	RetryStatusCodes       []int    `yaml:"retry_status_codes"`
+	RetryBudgetRatio       float64  `yaml:"retry_budget_ratio"`
+	RetryAfterMaxSeconds   int      `yaml:"retry_after_max_seconds"`
 	MaxDBConns             int32    `yaml:"max_db_conns"`
 	MinDBConns             int32    `yaml:"min_db_conns"`
 	MetricsEnabled         bool     `yaml:"metrics_enabled"`
 	LogFormat              string   `yaml:"log_format"`
+	DefaultMaxTokens       int      `yaml:"default_max_tokens"`
+	KeyMaxStaleSeconds     int      `yaml:"key_max_stale_seconds"`
+	AuthFailBaseDelayMS    int      `yaml:"auth_fail_base_delay_ms"`
+	AuthFailMaxDelayMS     int      `yaml:"auth_fail_max_delay_ms"`
+	AuthFailBanThreshold   int      `yaml:"auth_fail_ban_threshold"`
+	AuthFailWindowSeconds  int      `yaml:"auth_fail_window_seconds"`
+	AuthFailBanSeconds     int      `yaml:"auth_fail_ban_seconds"`
+	TrustForwardedFor      bool     `yaml:"trust_forwarded_for"`
+	RedisURL               string   `yaml:"redis_url"`
+	WarmupEnabled          bool     `yaml:"warmup_enabled"`
+	WarmupProbeUpstreams   bool     `yaml:"warmup_probe_upstreams"`
+	WarmupTimeoutSeconds   int      `yaml:"warmup_timeout_seconds"`
+	MaxSSEFrameBytes       int      `yaml:"max_sse_frame_bytes"`
+	SlowQueryMS            int      `yaml:"slow_query_ms"`
+	LogShareSecret         string   `yaml:"log_share_secret"`
+	LogShareMaxTTLSeconds  int      `yaml:"log_share_max_ttl_seconds"`
+	ImageMaxBytes          int      `yaml:"image_max_bytes"`
+	ImageMaxDimension      int      `yaml:"image_max_dimension"`
+	ImageDownscale         bool     `yaml:"image_downscale"`
+	ImageJPEGQuality       int      `yaml:"image_jpeg_quality"`
+	ModelSyncSeconds       int      `yaml:"model_sync_seconds"`
+	ExtensionsDir          string   `yaml:"extensions_dir"`
+
+	SSERetryMS                int `yaml:"sse_retry_ms"`
+	SSECommentIntervalSeconds int `yaml:"sse_comment_interval_seconds"`
+	StreamResumeTTLSeconds    int `yaml:"stream_resume_ttl_seconds"`
+	StreamIdleTimeoutSeconds  int `yaml:"stream_idle_timeout_seconds"`
+
+	UpstreamScoreSaveSeconds int `yaml:"upstream_score_save_seconds"`
+
+	MaxProxyHops    int      `yaml:"max_proxy_hops"`
+	AdvertisedHosts []string `yaml:"advertised_hosts"`
+
+	// SCIMKeyMetadata maps key metadata fields to the SCIM user attributes
+	// they are copied from; nil uses the built-in mapping.
+	SCIMKeyMetadata map[string]string `yaml:"scim_key_metadata"`
+
+	SeedFile string `yaml:"seed_file"`
+
+	// ProxyCORSOrigins gives the LLM endpoints their own CORS policy for
+	// browser apps; empty keeps them on cors_origins.
+	ProxyCORSOrigins        []string `yaml:"proxy_cors_origins"`
+	ProxyCORSAllowedHeaders []string `yaml:"proxy_cors_allowed_headers"`
+	ProxyCORSExposedHeaders []string `yaml:"proxy_cors_exposed_headers"`
+	ProxyCORSMaxAgeSeconds  int      `yaml:"proxy_cors_max_age_seconds"`
+
+	// TracingEndpoint is the OTLP/HTTP collector proxy request spans are
+	// exported to, e.g. http://localhost:4318; empty disables tracing.
+	TracingEndpoint    string  `yaml:"tracing_endpoint"`
+	TracingServiceName string  `yaml:"tracing_service_name"`
+	TracingSampleRatio float64 `yaml:"tracing_sample_ratio"`
+
+	// PublicUsageEnabled serves noised, rounded per-model daily usage at
+	// /api/v1/public/usage without authentication.
+	PublicUsageEnabled       bool    `yaml:"public_usage_enabled"`
+	PublicUsageDays          int     `yaml:"public_usage_days"`
+	PublicUsageEpsilon       float64 `yaml:"public_usage_epsilon"`
+	PublicUsageRoundRequests int     `yaml:"public_usage_round_requests"`
+	PublicUsageRoundTokens   int     `yaml:"public_usage_round_tokens"`
+	PublicUsageMinKeys       int     `yaml:"public_usage_min_keys"`
+	PublicUsageNoiseSecret   string  `yaml:"public_usage_noise_secret"`
+
+	// SelfServiceEnabled lets LLM keys read their own usage, budget status
+	// and recent errors at /api/self, authenticated by the key itself.
+	SelfServiceEnabled bool `yaml:"self_service_enabled"`
+
+	// PayloadCaptureAll stores the request and response bodies of every
+	// proxied request; keys with capture_payloads set are captured either way.
+	PayloadCaptureAll      bool `yaml:"payload_capture_all"`
+	PayloadCaptureMaxBytes int  `yaml:"payload_capture_max_bytes"`
+	PayloadCaptureRedact   bool `yaml:"payload_capture_redact"`
+	PayloadRetentionDays   int  `yaml:"payload_retention_days"`
+
+	// AuditSamplePercent is the share of requests, 0-100, captured in full
+	// for quality audits where no audit rule applies.
+	AuditSamplePercent   float64 `yaml:"audit_sample_percent"`
+	AuditCaptureMaxBytes int     `yaml:"audit_capture_max_bytes"`
+	AuditRetentionDays   int     `yaml:"audit_retention_days"`
+
+	// MetadataMap maps Anthropic request metadata keys to the OpenAI
+	// metadata keys, or "store" for OpenAI's store flag, they become when
+	// translating, and back. LogMetadataKeys are request metadata keys
+	// copied into request logs.
+	MetadataMap     map[string]string `yaml:"metadata_map"`
+	LogMetadataKeys []string          `yaml:"log_metadata_keys"`
+
+	// TrafficCaptureFile, if set, gets the anonymized shape of every proxied
+	// request appended to it as JSON Lines, for `pxbin replay`.
+	TrafficCaptureFile string `yaml:"traffic_capture_file"`
+
+	// EventWebhookURL receives key lifecycle and budget events as JSON
+	// POSTs, signed with EventWebhookSecret if set; empty disables it.
+	// EventLog writes the events to the application log.
+	EventWebhookURL    string `yaml:"event_webhook_url"`
+	EventWebhookSecret string `yaml:"event_webhook_secret"`
+	EventLog           bool   `yaml:"event_log"`
+
+	// Ephemeral keeps all state in memory instead of PostgreSQL, for demos
+	// and tests. Everything is lost on exit.
+	Ephemeral bool `yaml:"ephemeral"`
 }
 
 // Load reads configuration from config.yaml and overrides with environment variables.
 func Load() (*Config, error) {
 	cfg := &Config{
-		ListenAddr:         ":8080",
-		DatabaseSchema:     "public",
-		LogBufferSize:      10000,
-		LogRetentionDays:   7,
-		CBFailureThreshold: 5,
-		CBTimeoutSeconds:   30,
-		RetryMaxAttempts:   3,
-		RetryBaseDelayMS:   100,
-		MaxDBConns:         25,
-		MinDBConns:         5,
-		LogFormat:          "json",
+		ListenAddr:           ":8080",
+		DatabaseSchema:       "public",
+		LogBufferSize:        10000,
+		LogOverflowPolicy:    "drop",
+		LogBlockTimeoutMS:    50,
+		LogSpillDir:          "data/spill",
+		LogSampleRate:        0.1,
+		LogRetentionDays:     7,
+		RateLimitBackend:     "memory",
+		CBFailureThreshold:   5,
+		CBTimeoutSeconds:     30,
+		RetryMaxAttempts:     3,
+		RetryBaseDelayMS:     100,
+		RetryStatusCodes:     []int{429, 500, 529},
+		RetryBudgetRatio:     0.2,
+		RetryAfterMaxSeconds: 30,
+		MaxDBConns:           25,
+		MinDBConns:           5,
+		LogFormat:            "json",
+		DefaultMaxTokens:     4096,
+		KeyMaxStaleSeconds:   3600,
+
+		AuthFailBaseDelayMS:   250,
+		AuthFailMaxDelayMS:    5000,
+		AuthFailBanThreshold:  20,
+		AuthFailWindowSeconds: 600,
+		AuthFailBanSeconds:    900,
+		WarmupTimeoutSeconds:  30,
+		MaxSSEFrameBytes:      8 << 20,
+		SlowQueryMS:           500,
+		LogShareMaxTTLSeconds: 86400,
+		ImageJPEGQuality:      85,
+
+		StreamIdleTimeoutSeconds: 300,
+		UpstreamScoreSaveSeconds: 60,
+		MaxProxyHops:             3,
+
+		AccessLogRetentionDays: 90,
+		ProxyCORSMaxAgeSeconds: 600,
+
+		TracingServiceName: "pxbin",
+		TracingSampleRatio: 1,
+
+		PublicUsageDays:          30,
+		PublicUsageEpsilon:       1,
+		PublicUsageRoundRequests: 10,
+		PublicUsageRoundTokens:   10000,
+		PublicUsageMinKeys:       3,
+
+		SelfServiceEnabled: true,
+
+		PayloadCaptureMaxBytes: 64 << 10,
+		PayloadCaptureRedact:   true,
+		PayloadRetentionDays:   3,
+		AuditCaptureMaxBytes:   1 << 20,
+		AuditRetentionDays:     30,
 	}
 
 	configPath := os.Getenv("PXBIN_CONFIG_PATH")
@@ -79,6 +233,22 @@ func overrideFromEnv(cfg *Config) {
 			cfg.LogBufferSize = n
 		}
 	}
+	if v := os.Getenv("PXBIN_LOG_OVERFLOW_POLICY"); v != "" {
+		cfg.LogOverflowPolicy = v
+	}
+	if v := os.Getenv("PXBIN_LOG_BLOCK_TIMEOUT_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.LogBlockTimeoutMS = n
+		}
+	}
+	if v := os.Getenv("PXBIN_LOG_SPILL_DIR"); v != "" {
+		cfg.LogSpillDir = v
+	}
+	if v := os.Getenv("PXBIN_LOG_SAMPLE_RATE"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.LogSampleRate = f
+		}
+	}
 	if v := os.Getenv("PXBIN_MANAGEMENT_BOOTSTRAP_KEY"); v != "" {
 		cfg.ManagementBootstrapKey = v
 	}
@@ -93,6 +263,11 @@ func overrideFromEnv(cfg *Config) {
 			cfg.LogRetentionDays = n
 		}
 	}
+	if v := os.Getenv("PXBIN_ACCESS_LOG_RETENTION_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.AccessLogRetentionDays = n
+		}
+	}
 	if v := os.Getenv("PXBIN_RATE_LIMIT_RPS"); v != "" {
 		if f, err := strconv.ParseFloat(v, 64); err == nil {
 			cfg.RateLimitRPS = f
@@ -103,6 +278,9 @@ func overrideFromEnv(cfg *Config) {
 			cfg.RateLimitBurst = n
 		}
 	}
+	if v := os.Getenv("PXBIN_RATE_LIMIT_BACKEND"); v != "" {
+		cfg.RateLimitBackend = v
+	}
 	if v := os.Getenv("PXBIN_CB_FAILURE_THRESHOLD"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
 			cfg.CBFailureThreshold = n
@@ -123,6 +301,24 @@ func overrideFromEnv(cfg *Config) {
 			cfg.RetryBaseDelayMS = n
 		}
 	}
+	if v := os.Getenv("PXBIN_RETRY_STATUS_CODES"); v != "" {
+		cfg.RetryStatusCodes = nil
+		for _, code := range strings.Split(v, ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(code)); err == nil {
+				cfg.RetryStatusCodes = append(cfg.RetryStatusCodes, n)
+			}
+		}
+	}
+	if v := os.Getenv("PXBIN_RETRY_BUDGET_RATIO"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.RetryBudgetRatio = f
+		}
+	}
+	if v := os.Getenv("PXBIN_RETRY_AFTER_MAX_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.RetryAfterMaxSeconds = n
+		}
+	}
 	if v := os.Getenv("PXBIN_MAX_DB_CONNS"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
 			cfg.MaxDBConns = int32(n)
@@ -139,4 +335,258 @@ func overrideFromEnv(cfg *Config) {
 	if v := os.Getenv("PXBIN_LOG_FORMAT"); v != "" {
 		cfg.LogFormat = v
 	}
+	if v := os.Getenv("PXBIN_DEFAULT_MAX_TOKENS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.DefaultMaxTokens = n
+		}
+	}
+	if v := os.Getenv("PXBIN_KEY_MAX_STALE_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.KeyMaxStaleSeconds = n
+		}
+	}
+	if v := os.Getenv("PXBIN_AUTH_FAIL_BASE_DELAY_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.AuthFailBaseDelayMS = n
+		}
+	}
+	if v := os.Getenv("PXBIN_AUTH_FAIL_MAX_DELAY_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.AuthFailMaxDelayMS = n
+		}
+	}
+	if v := os.Getenv("PXBIN_AUTH_FAIL_BAN_THRESHOLD"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.AuthFailBanThreshold = n
+		}
+	}
+	if v := os.Getenv("PXBIN_AUTH_FAIL_WINDOW_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.AuthFailWindowSeconds = n
+		}
+	}
+	if v := os.Getenv("PXBIN_AUTH_FAIL_BAN_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.AuthFailBanSeconds = n
+		}
+	}
+	if v := os.Getenv("PXBIN_TRUST_FORWARDED_FOR"); v != "" {
+		cfg.TrustForwardedFor = v == "true" || v == "1"
+	}
+	if v := os.Getenv("PXBIN_REDIS_URL"); v != "" {
+		cfg.RedisURL = v
+	}
+	if v := os.Getenv("PXBIN_WARMUP_ENABLED"); v != "" {
+		cfg.WarmupEnabled = v == "true" || v == "1"
+	}
+	if v := os.Getenv("PXBIN_WARMUP_PROBE_UPSTREAMS"); v != "" {
+		cfg.WarmupProbeUpstreams = v == "true" || v == "1"
+	}
+	if v := os.Getenv("PXBIN_WARMUP_TIMEOUT_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.WarmupTimeoutSeconds = n
+		}
+	}
+	if v := os.Getenv("PXBIN_MAX_SSE_FRAME_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.MaxSSEFrameBytes = n
+		}
+	}
+	if v := os.Getenv("PXBIN_SLOW_QUERY_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.SlowQueryMS = n
+		}
+	}
+	if v := os.Getenv("PXBIN_LOG_SHARE_SECRET"); v != "" {
+		cfg.LogShareSecret = v
+	}
+	if v := os.Getenv("PXBIN_LOG_SHARE_MAX_TTL_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.LogShareMaxTTLSeconds = n
+		}
+	}
+	if v := os.Getenv("PXBIN_IMAGE_MAX_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.ImageMaxBytes = n
+		}
+	}
+	if v := os.Getenv("PXBIN_IMAGE_MAX_DIMENSION"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.ImageMaxDimension = n
+		}
+	}
+	if v := os.Getenv("PXBIN_IMAGE_DOWNSCALE"); v != "" {
+		cfg.ImageDownscale = v == "true" || v == "1"
+	}
+	if v := os.Getenv("PXBIN_IMAGE_JPEG_QUALITY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.ImageJPEGQuality = n
+		}
+	}
+	if v := os.Getenv("PXBIN_MODEL_SYNC_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.ModelSyncSeconds = n
+		}
+	}
+	if v := os.Getenv("PXBIN_EXTENSIONS_DIR"); v != "" {
+		cfg.ExtensionsDir = v
+	}
+	if v := os.Getenv("PXBIN_SSE_RETRY_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.SSERetryMS = n
+		}
+	}
+	if v := os.Getenv("PXBIN_SSE_COMMENT_INTERVAL_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.SSECommentIntervalSeconds = n
+		}
+	}
+	if v := os.Getenv("PXBIN_STREAM_RESUME_TTL_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.StreamResumeTTLSeconds = n
+		}
+	}
+	if v := os.Getenv("PXBIN_STREAM_IDLE_TIMEOUT_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.StreamIdleTimeoutSeconds = n
+		}
+	}
+	if v := os.Getenv("PXBIN_UPSTREAM_SCORE_SAVE_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.UpstreamScoreSaveSeconds = n
+		}
+	}
+	if v := os.Getenv("PXBIN_MAX_PROXY_HOPS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.MaxProxyHops = n
+		}
+	}
+	if v := os.Getenv("PXBIN_ADVERTISED_HOSTS"); v != "" {
+		cfg.AdvertisedHosts = strings.Split(v, ",")
+	}
+	if v := os.Getenv("PXBIN_SCIM_KEY_METADATA"); v != "" {
+		cfg.SCIMKeyMetadata = map[string]string{}
+		for _, pair := range strings.Split(v, ",") {
+			field, attr, _ := strings.Cut(pair, "=")
+			cfg.SCIMKeyMetadata[strings.TrimSpace(field)] = strings.TrimSpace(attr)
+		}
+	}
+	if v := os.Getenv("PXBIN_SEED_FILE"); v != "" {
+		cfg.SeedFile = v
+	}
+	if v := os.Getenv("PXBIN_PROXY_CORS_ORIGINS"); v != "" {
+		cfg.ProxyCORSOrigins = strings.Split(v, ",")
+	}
+	if v := os.Getenv("PXBIN_PROXY_CORS_ALLOWED_HEADERS"); v != "" {
+		cfg.ProxyCORSAllowedHeaders = strings.Split(v, ",")
+	}
+	if v := os.Getenv("PXBIN_PROXY_CORS_EXPOSED_HEADERS"); v != "" {
+		cfg.ProxyCORSExposedHeaders = strings.Split(v, ",")
+	}
+	if v := os.Getenv("PXBIN_PROXY_CORS_MAX_AGE_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.ProxyCORSMaxAgeSeconds = n
+		}
+	}
+	if v := os.Getenv("PXBIN_TRACING_ENDPOINT"); v != "" {
+		cfg.TracingEndpoint = v
+	}
+	if v := os.Getenv("PXBIN_TRACING_SERVICE_NAME"); v != "" {
+		cfg.TracingServiceName = v
+	}
+	if v := os.Getenv("PXBIN_TRACING_SAMPLE_RATIO"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.TracingSampleRatio = f
+		}
+	}
+	if v := os.Getenv("PXBIN_PUBLIC_USAGE_ENABLED"); v != "" {
+		cfg.PublicUsageEnabled = v == "true" || v == "1"
+	}
+	if v := os.Getenv("PXBIN_PUBLIC_USAGE_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.PublicUsageDays = n
+		}
+	}
+	if v := os.Getenv("PXBIN_PUBLIC_USAGE_EPSILON"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.PublicUsageEpsilon = f
+		}
+	}
+	if v := os.Getenv("PXBIN_PUBLIC_USAGE_ROUND_REQUESTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.PublicUsageRoundRequests = n
+		}
+	}
+	if v := os.Getenv("PXBIN_PUBLIC_USAGE_ROUND_TOKENS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.PublicUsageRoundTokens = n
+		}
+	}
+	if v := os.Getenv("PXBIN_PUBLIC_USAGE_MIN_KEYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.PublicUsageMinKeys = n
+		}
+	}
+	if v := os.Getenv("PXBIN_PUBLIC_USAGE_NOISE_SECRET"); v != "" {
+		cfg.PublicUsageNoiseSecret = v
+	}
+	if v := os.Getenv("PXBIN_SELF_SERVICE_ENABLED"); v != "" {
+		cfg.SelfServiceEnabled = v == "true" || v == "1"
+	}
+	if v := os.Getenv("PXBIN_PAYLOAD_CAPTURE_ALL"); v != "" {
+		cfg.PayloadCaptureAll = v == "true" || v == "1"
+	}
+	if v := os.Getenv("PXBIN_PAYLOAD_CAPTURE_MAX_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.PayloadCaptureMaxBytes = n
+		}
+	}
+	if v := os.Getenv("PXBIN_PAYLOAD_CAPTURE_REDACT"); v != "" {
+		cfg.PayloadCaptureRedact = v == "true" || v == "1"
+	}
+	if v := os.Getenv("PXBIN_PAYLOAD_RETENTION_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.PayloadRetentionDays = n
+		}
+	}
+	if v := os.Getenv("PXBIN_AUDIT_SAMPLE_PERCENT"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.AuditSamplePercent = f
+		}
+	}
+	if v := os.Getenv("PXBIN_AUDIT_CAPTURE_MAX_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.AuditCaptureMaxBytes = n
+		}
+	}
+	if v := os.Getenv("PXBIN_AUDIT_RETENTION_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.AuditRetentionDays = n
+		}
+	}
+	if v := os.Getenv("PXBIN_METADATA_MAP"); v != "" {
+		cfg.MetadataMap = map[string]string{}
+		for _, pair := range strings.Split(v, ",") {
+			from, to, _ := strings.Cut(pair, "=")
+			cfg.MetadataMap[strings.TrimSpace(from)] = strings.TrimSpace(to)
+		}
+	}
+	if v := os.Getenv("PXBIN_LOG_METADATA_KEYS"); v != "" {
+		cfg.LogMetadataKeys = strings.Split(v, ",")
+	}
+	if v := os.Getenv("PXBIN_TRAFFIC_CAPTURE_FILE"); v != "" {
+		cfg.TrafficCaptureFile = v
+	}
+	if v := os.Getenv("PXBIN_EVENT_WEBHOOK_URL"); v != "" {
+		cfg.EventWebhookURL = v
+	}
+	if v := os.Getenv("PXBIN_EVENT_WEBHOOK_SECRET"); v != "" {
+		cfg.EventWebhookSecret = v
+	}
+	if v := os.Getenv("PXBIN_EVENT_LOG"); v != "" {
+		cfg.EventLog = v == "true" || v == "1"
+	}
+	if v := os.Getenv("PXBIN_EPHEMERAL"); v != "" {
+		cfg.Ephemeral = v == "true" || v == "1"
+	}
 }
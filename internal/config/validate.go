@@ -3,6 +3,7 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"regexp"
 	"strings"
 )
@@ -17,7 +18,7 @@ func Validate(cfg *Config) error {
 	if cfg.ListenAddr == "" {
 		errs = append(errs, "listen_addr is required")
 	}
-	if cfg.DatabaseURL == "" {
+	if cfg.DatabaseURL == "" && !cfg.Ephemeral {
 		errs = append(errs, "database_url is required")
 	}
 	if cfg.DatabaseSchema != "" && !schemaNamePattern.MatchString(cfg.DatabaseSchema) {
@@ -32,6 +33,15 @@ func Validate(cfg *Config) error {
 	if cfg.RateLimitBurst < 0 {
 		errs = append(errs, "rate_limit_burst must be >= 0")
 	}
+	switch cfg.RateLimitBackend {
+	case "", "memory":
+	case "redis":
+		if cfg.RedisURL == "" {
+			errs = append(errs, "rate_limit_backend redis requires redis_url")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("rate_limit_backend must be memory or redis, got %q", cfg.RateLimitBackend))
+	}
 	if cfg.MaxDBConns > 0 && cfg.MinDBConns > 0 && cfg.MaxDBConns <= cfg.MinDBConns {
 		errs = append(errs, fmt.Sprintf("max_db_conns (%d) must be greater than min_db_conns (%d)", cfg.MaxDBConns, cfg.MinDBConns))
 	}
@@ -44,6 +54,152 @@ func Validate(cfg *Config) error {
 	if cfg.RetryMaxAttempts < 0 {
 		errs = append(errs, "retry_max_attempts must be >= 0")
 	}
+	for _, code := range cfg.RetryStatusCodes {
+		if code < 400 || code > 599 {
+			errs = append(errs, fmt.Sprintf("retry_status_codes: invalid status %d", code))
+		}
+	}
+	if cfg.RetryBudgetRatio < 0 || cfg.RetryBudgetRatio > 1 {
+		errs = append(errs, "retry_budget_ratio must be between 0 and 1")
+	}
+	if cfg.RetryAfterMaxSeconds < 0 {
+		errs = append(errs, "retry_after_max_seconds must be >= 0")
+	}
+	switch cfg.LogOverflowPolicy {
+	case "", "drop", "block", "sample":
+	case "spill":
+		if cfg.LogSpillDir == "" {
+			errs = append(errs, "log_spill_dir is required when log_overflow_policy is spill")
+		}
+	default:
+		errs = append(errs, "log_overflow_policy must be one of drop, block, spill, sample")
+	}
+	if cfg.LogBlockTimeoutMS < 0 {
+		errs = append(errs, "log_block_timeout_ms must be >= 0")
+	}
+	if cfg.LogSampleRate < 0 || cfg.LogSampleRate > 1 {
+		errs = append(errs, "log_sample_rate must be between 0 and 1")
+	}
+	if cfg.DefaultMaxTokens < 0 {
+		errs = append(errs, "default_max_tokens must be >= 0")
+	}
+	if cfg.MaxSSEFrameBytes < 0 || (cfg.MaxSSEFrameBytes > 0 && cfg.MaxSSEFrameBytes < 64*1024) {
+		errs = append(errs, "max_sse_frame_bytes must be 0 (default) or >= 65536")
+	}
+	if cfg.SlowQueryMS < 0 {
+		errs = append(errs, "slow_query_ms must be >= 0")
+	}
+	if cfg.LogShareSecret != "" && len(cfg.LogShareSecret) < 32 {
+		errs = append(errs, "log_share_secret must be at least 32 characters")
+	}
+	if cfg.LogShareSecret != "" && cfg.LogShareMaxTTLSeconds <= 0 {
+		errs = append(errs, "log_share_max_ttl_seconds must be > 0 when log_share_secret is set")
+	}
+	if cfg.ImageMaxBytes < 0 || cfg.ImageMaxDimension < 0 {
+		errs = append(errs, "image_max_bytes and image_max_dimension must be >= 0")
+	}
+	if cfg.ImageDownscale && (cfg.ImageJPEGQuality < 1 || cfg.ImageJPEGQuality > 100) {
+		errs = append(errs, "image_jpeg_quality must be between 1 and 100")
+	}
+	if cfg.AccessLogRetentionDays < 0 {
+		errs = append(errs, "access_log_retention_days must be >= 0")
+	}
+	if cfg.ModelSyncSeconds < 0 || (cfg.ModelSyncSeconds > 0 && cfg.ModelSyncSeconds < 60) {
+		errs = append(errs, "model_sync_seconds must be 0 (disabled) or >= 60")
+	}
+	if cfg.SSERetryMS < 0 || cfg.SSECommentIntervalSeconds < 0 {
+		errs = append(errs, "sse_retry_ms and sse_comment_interval_seconds must be >= 0")
+	}
+	if cfg.StreamResumeTTLSeconds < 0 {
+		errs = append(errs, "stream_resume_ttl_seconds must be >= 0")
+	}
+	if cfg.StreamIdleTimeoutSeconds < 0 {
+		errs = append(errs, "stream_idle_timeout_seconds must be >= 0")
+	}
+	if cfg.UpstreamScoreSaveSeconds < 0 {
+		errs = append(errs, "upstream_score_save_seconds must be >= 0")
+	}
+	if cfg.MaxProxyHops < 0 {
+		errs = append(errs, "max_proxy_hops must be >= 0")
+	}
+	for field, attr := range cfg.SCIMKeyMetadata {
+		switch {
+		case field == "" || attr == "":
+			errs = append(errs, "scim_key_metadata entries must map a field to a SCIM attribute")
+		case field == "user_id" || field == "user_name" || field == "external_id" || field == "teams":
+			errs = append(errs, fmt.Sprintf("scim_key_metadata field %q is reserved", field))
+		}
+	}
+	if cfg.KeyMaxStaleSeconds < 0 {
+		errs = append(errs, "key_max_stale_seconds must be >= 0")
+	}
+	if cfg.AuthFailBaseDelayMS < 0 || cfg.AuthFailMaxDelayMS < 0 {
+		errs = append(errs, "auth_fail_base_delay_ms and auth_fail_max_delay_ms must be >= 0")
+	}
+	if cfg.AuthFailBanThreshold < 0 {
+		errs = append(errs, "auth_fail_ban_threshold must be >= 0")
+	}
+	if (cfg.AuthFailBaseDelayMS > 0 || cfg.AuthFailBanThreshold > 0) && cfg.AuthFailWindowSeconds <= 0 {
+		errs = append(errs, "auth_fail_window_seconds must be > 0 when the auth tarpit is enabled")
+	}
+	if cfg.AuthFailBanThreshold > 0 && cfg.AuthFailBanSeconds <= 0 {
+		errs = append(errs, "auth_fail_ban_seconds must be > 0 when auth_fail_ban_threshold is set")
+	}
+	if cfg.WarmupEnabled && cfg.WarmupTimeoutSeconds <= 0 {
+		errs = append(errs, "warmup_timeout_seconds must be > 0 when warmup is enabled")
+	}
+	if cfg.ProxyCORSMaxAgeSeconds < 0 {
+		errs = append(errs, "proxy_cors_max_age_seconds must be >= 0")
+	}
+	if cfg.TracingSampleRatio < 0 || cfg.TracingSampleRatio > 1 {
+		errs = append(errs, "tracing_sample_ratio must be between 0 and 1")
+	}
+	if cfg.PublicUsageEnabled {
+		if cfg.PublicUsageDays < 1 || cfg.PublicUsageDays > 366 {
+			errs = append(errs, "public_usage_days must be between 1 and 366")
+		}
+		if cfg.PublicUsageEpsilon < 0 {
+			errs = append(errs, "public_usage_epsilon must be >= 0")
+		}
+		if cfg.PublicUsageRoundRequests < 1 || cfg.PublicUsageRoundTokens < 1 {
+			errs = append(errs, "public_usage_round_requests and public_usage_round_tokens must be >= 1")
+		}
+		if cfg.PublicUsageMinKeys < 1 {
+			errs = append(errs, "public_usage_min_keys must be >= 1")
+		}
+	}
+	if cfg.PayloadCaptureMaxBytes < 0 {
+		errs = append(errs, "payload_capture_max_bytes must be >= 0")
+	}
+	if cfg.PayloadRetentionDays < 0 {
+		errs = append(errs, "payload_retention_days must be >= 0")
+	}
+	if cfg.AuditSamplePercent < 0 || cfg.AuditSamplePercent > 100 {
+		errs = append(errs, "audit_sample_percent must be between 0 and 100")
+	}
+	if cfg.AuditCaptureMaxBytes < 0 || cfg.AuditRetentionDays < 0 {
+		errs = append(errs, "audit_capture_max_bytes and audit_retention_days must be >= 0")
+	}
+	targets := map[string]bool{}
+	for from, to := range cfg.MetadataMap {
+		switch {
+		case from == "" || to == "":
+			errs = append(errs, "metadata_map entries must map an Anthropic metadata key to an OpenAI one")
+		case len(to) > 64:
+			errs = append(errs, fmt.Sprintf("metadata_map key %q is longer than OpenAI's 64 characters", to))
+		case targets[to]:
+			errs = append(errs, fmt.Sprintf("metadata_map maps more than one key to %q", to))
+		}
+		targets[to] = true
+	}
+	if cfg.EventWebhookURL != "" {
+		if u, err := url.Parse(cfg.EventWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, "event_webhook_url must be an http or https URL")
+		}
+	}
+	if cfg.RedisURL != "" && !strings.HasPrefix(cfg.RedisURL, "redis://") {
+		errs = append(errs, "redis_url must start with redis://")
+	}
 
 	if len(errs) > 0 {
 		return errors.New("config validation failed: " + strings.Join(errs, "; "))
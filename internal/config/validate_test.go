@@ -29,6 +29,16 @@ func TestValidateMissingDatabaseURL(t *testing.T) {
 	}
 }
 
+func TestValidateEphemeralWithoutDatabaseURL(t *testing.T) {
+	cfg := &Config{
+		ListenAddr: ":8080",
+		Ephemeral:  true,
+	}
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("expected valid config, got: %v", err)
+	}
+}
+
 func TestValidateInvalidDatabaseSchema(t *testing.T) {
 	cfg := &Config{
 		ListenAddr:     ":8080",
@@ -104,3 +114,196 @@ func TestValidateMultipleErrors(t *testing.T) {
 		t.Fatalf("expected both errors, got: %v", err)
 	}
 }
+
+func TestValidateLogOverflowPolicy(t *testing.T) {
+	cfg := &Config{
+		ListenAddr:        ":8080",
+		DatabaseURL:       "postgres://localhost/db",
+		LogOverflowPolicy: "discard",
+	}
+	err := Validate(cfg)
+	if err == nil || !strings.Contains(err.Error(), "log_overflow_policy") {
+		t.Fatalf("expected log_overflow_policy error, got: %v", err)
+	}
+
+	cfg.LogOverflowPolicy = "spill"
+	err = Validate(cfg)
+	if err == nil || !strings.Contains(err.Error(), "log_spill_dir") {
+		t.Fatalf("expected log_spill_dir error, got: %v", err)
+	}
+
+	cfg.LogSpillDir = "/var/lib/pxbin/spill"
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("expected valid config, got: %v", err)
+	}
+}
+
+func TestValidateNegativeProxyCORSMaxAge(t *testing.T) {
+	cfg := &Config{
+		ListenAddr:             ":8080",
+		DatabaseURL:            "postgres://localhost/db",
+		ProxyCORSMaxAgeSeconds: -1,
+	}
+	err := Validate(cfg)
+	if err == nil || !strings.Contains(err.Error(), "proxy_cors_max_age_seconds") {
+		t.Fatalf("expected proxy_cors_max_age_seconds error, got: %v", err)
+	}
+}
+
+func TestValidateTracingSampleRatio(t *testing.T) {
+	cfg := &Config{
+		ListenAddr:         ":8080",
+		DatabaseURL:        "postgres://localhost/db",
+		TracingSampleRatio: 1.5,
+	}
+	err := Validate(cfg)
+	if err == nil || !strings.Contains(err.Error(), "tracing_sample_ratio") {
+		t.Fatalf("expected tracing_sample_ratio error, got: %v", err)
+	}
+}
+
+func TestValidatePublicUsage(t *testing.T) {
+	cfg := &Config{
+		ListenAddr:               ":8080",
+		DatabaseURL:              "postgres://localhost/db",
+		PublicUsageEnabled:       true,
+		PublicUsageDays:          30,
+		PublicUsageEpsilon:       -1,
+		PublicUsageRoundRequests: 10,
+		PublicUsageRoundTokens:   10000,
+		PublicUsageMinKeys:       3,
+	}
+	err := Validate(cfg)
+	if err == nil || !strings.Contains(err.Error(), "public_usage_epsilon") {
+		t.Fatalf("expected public_usage_epsilon error, got: %v", err)
+	}
+
+	cfg.PublicUsageEpsilon = 1
+	cfg.PublicUsageMinKeys = 0
+	err = Validate(cfg)
+	if err == nil || !strings.Contains(err.Error(), "public_usage_min_keys") {
+		t.Fatalf("expected public_usage_min_keys error, got: %v", err)
+	}
+
+	cfg.PublicUsageEnabled = false
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("expected disabled public usage settings to be ignored, got: %v", err)
+	}
+}
+
+func TestValidatePayloadCapture(t *testing.T) {
+	cfg := &Config{
+		ListenAddr:             ":8080",
+		DatabaseURL:            "postgres://localhost/db",
+		PayloadCaptureMaxBytes: -1,
+	}
+	err := Validate(cfg)
+	if err == nil || !strings.Contains(err.Error(), "payload_capture_max_bytes") {
+		t.Fatalf("expected payload_capture_max_bytes error, got: %v", err)
+	}
+
+	cfg.PayloadCaptureMaxBytes = 65536
+	cfg.PayloadRetentionDays = -1
+	err = Validate(cfg)
+	if err == nil || !strings.Contains(err.Error(), "payload_retention_days") {
+		t.Fatalf("expected payload_retention_days error, got: %v", err)
+	}
+}
+
+func TestValidateAuditSampling(t *testing.T) {
+	cfg := &Config{
+		ListenAddr:         ":8080",
+		DatabaseURL:        "postgres://localhost/db",
+		AuditSamplePercent: 120,
+	}
+	err := Validate(cfg)
+	if err == nil || !strings.Contains(err.Error(), "audit_sample_percent") {
+		t.Fatalf("expected audit_sample_percent error, got: %v", err)
+	}
+
+	cfg.AuditSamplePercent = 1
+	cfg.AuditRetentionDays = -1
+	err = Validate(cfg)
+	if err == nil || !strings.Contains(err.Error(), "audit_retention_days") {
+		t.Fatalf("expected audit_retention_days error, got: %v", err)
+	}
+}
+
+func TestValidateMetadataMap(t *testing.T) {
+	cfg := &Config{
+		ListenAddr:  ":8080",
+		DatabaseURL: "postgres://localhost/db",
+		MetadataMap: map[string]string{"session_id": "session", "conversation_id": "session"},
+	}
+	err := Validate(cfg)
+	if err == nil || !strings.Contains(err.Error(), `metadata_map maps more than one key to "session"`) {
+		t.Fatalf("expected metadata_map error, got: %v", err)
+	}
+
+	cfg.MetadataMap = map[string]string{"session_id": "session", "retain": "store"}
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("expected a valid metadata_map, got: %v", err)
+	}
+}
+
+func TestValidateEventWebhookURL(t *testing.T) {
+	cfg := &Config{
+		ListenAddr:      ":8080",
+		DatabaseURL:     "postgres://localhost/db",
+		EventWebhookURL: "hooks.example.com/pxbin",
+	}
+	err := Validate(cfg)
+	if err == nil || !strings.Contains(err.Error(), "event_webhook_url") {
+		t.Fatalf("expected event_webhook_url error, got: %v", err)
+	}
+
+	cfg.EventWebhookURL = "https://hooks.example.com/pxbin"
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("expected a valid webhook URL, got: %v", err)
+	}
+}
+
+func TestValidateRateLimitBackend(t *testing.T) {
+	cfg := &Config{
+		ListenAddr:       ":8080",
+		DatabaseURL:      "postgres://localhost/db",
+		RateLimitBackend: "redis",
+	}
+	err := Validate(cfg)
+	if err == nil || !strings.Contains(err.Error(), "requires redis_url") {
+		t.Fatalf("expected redis_url error, got: %v", err)
+	}
+
+	cfg.RedisURL = "redis://localhost:6379"
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("expected a valid config, got: %v", err)
+	}
+
+	cfg.RateLimitBackend = "memcached"
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "rate_limit_backend") {
+		t.Fatalf("expected rate_limit_backend error, got: %v", err)
+	}
+}
+
+func TestValidateRetrySettings(t *testing.T) {
+	cfg := &Config{
+		ListenAddr:       ":8080",
+		DatabaseURL:      "postgres://localhost/db",
+		RetryStatusCodes: []int{429, 200},
+	}
+	err := Validate(cfg)
+	if err == nil || !strings.Contains(err.Error(), "retry_status_codes") {
+		t.Fatalf("expected retry_status_codes error, got: %v", err)
+	}
+
+	cfg.RetryStatusCodes = []int{429, 500, 529}
+	cfg.RetryBudgetRatio = 1.5
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "retry_budget_ratio") {
+		t.Fatalf("expected retry_budget_ratio error, got: %v", err)
+	}
+
+	cfg.RetryBudgetRatio = 0.2
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("expected a valid config, got: %v", err)
+	}
+}
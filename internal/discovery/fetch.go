@@ -0,0 +1,71 @@
+// Package discovery lists the models upstreams serve and keeps pxbin's
+// model table in step with them.
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// Model is a model listed by an upstream's /v1/models endpoint.
+type Model struct {
+	ID      string `json:"id"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// Listable reports whether upstreams of format list their models. Vertex
+// AI upstreams do not.
+func Listable(format string) bool {
+	return format != "vertex"
+}
+
+// Fetch lists the models u serves. Anthropic-format upstreams are queried
+// with their own auth headers and the largest page size.
+func Fetch(ctx context.Context, client *http.Client, u *store.Upstream) ([]Model, error) {
+	if !Listable(u.Format) {
+		return nil, fmt.Errorf("%s upstreams do not list their models", u.Format)
+	}
+	url := u.BaseURL + "/v1/models"
+	if u.Format == "anthropic" {
+		url += "?limit=1000"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream base_url: %w", err)
+	}
+	if u.APIKeyEncrypted != "" {
+		if u.Format == "anthropic" {
+			req.Header.Set("x-api-key", u.APIKeyEncrypted)
+			req.Header.Set("anthropic-version", "2023-06-01")
+		} else {
+			req.Header.Set("Authorization", "Bearer "+u.APIKeyEncrypted)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach upstream: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("upstream returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var list struct {
+		Data []Model `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to parse upstream response: %w", err)
+	}
+	if list.Data == nil {
+		list.Data = []Model{}
+	}
+	return list.Data, nil
+}
@@ -0,0 +1,66 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestFetch(t *testing.T) {
+	var gotAuth, gotKey, gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth, gotKey, gotQuery = r.Header.Get("Authorization"), r.Header.Get("x-api-key"), r.URL.RawQuery
+		if r.URL.Path != "/v1/models" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"data":[{"id":"gpt-x","owned_by":"acme"},{"id":"gpt-y"}]}`))
+	}))
+	defer srv.Close()
+
+	models, err := Fetch(context.Background(), srv.Client(), &store.Upstream{BaseURL: srv.URL, APIKeyEncrypted: "sk-1", Format: "openai"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 2 || models[0] != (Model{ID: "gpt-x", OwnedBy: "acme"}) {
+		t.Fatalf("unexpected models: %+v", models)
+	}
+	if gotAuth != "Bearer sk-1" || gotKey != "" {
+		t.Fatalf("expected bearer auth, got %q / %q", gotAuth, gotKey)
+	}
+
+	if _, err := Fetch(context.Background(), srv.Client(), &store.Upstream{BaseURL: srv.URL, APIKeyEncrypted: "sk-2", Format: "anthropic"}); err != nil {
+		t.Fatal(err)
+	}
+	if gotAuth != "" || gotKey != "sk-2" || gotQuery != "limit=1000" {
+		t.Fatalf("expected x-api-key auth with a page size, got %q / %q / %q", gotAuth, gotKey, gotQuery)
+	}
+
+	if _, err := Fetch(context.Background(), srv.Client(), &store.Upstream{BaseURL: srv.URL + "/nope"}); err == nil {
+		t.Fatal("expected an error for a non-200 response")
+	}
+}
+
+func TestSyncFailureBacksOff(t *testing.T) {
+	sy := &Syncer{interval: time.Minute, reports: make(map[uuid.UUID]*Report)}
+	id := uuid.New()
+	sy.reports[id] = &Report{UpstreamID: id, Listed: 3, New: []string{"a"}, Stale: []string{}}
+
+	start := time.Now()
+	for i, want := range []time.Duration{1, 2, 4, 8, 8} {
+		sy.fail(&Report{UpstreamID: id, SyncedAt: start}, errors.New("down"))
+		r := sy.reports[id]
+		if r.Failures != i+1 || r.NextSyncAt.Sub(start) != want*time.Minute {
+			t.Fatalf("failure %d: expected retry in %d intervals, got %+v", i+1, want, r)
+		}
+		if r.Listed != 3 || len(r.New) != 1 || r.Error != "down" {
+			t.Fatalf("expected the last successful sync to be kept, got %+v", r)
+		}
+	}
+}
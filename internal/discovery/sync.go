@@ -0,0 +1,312 @@
+package discovery
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/billing"
+	"github.com/sertdev/pxbin/internal/pricing"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// syncConcurrency is how many upstreams are listed at once.
+const syncConcurrency = 4
+
+// maxBackoff caps how many intervals an upstream that keeps failing waits
+// between attempts.
+const maxBackoff = 8
+
+// NewModel returns the model created when importing name from upstreamID,
+// priced from pricingData when LiteLLM knows it.
+func NewModel(name, provider string, upstreamID uuid.UUID, pricingData map[string]*pricing.ModelPricing) *store.ModelCreate {
+	mc := &store.ModelCreate{
+		Name:       name,
+		Provider:   provider,
+		UpstreamID: &upstreamID,
+	}
+	if p, ok := pricingData[name]; ok {
+		mc.InputCostPerMillion = p.InputCostPerMillion
+		mc.OutputCostPerMillion = p.OutputCostPerMillion
+		mc.WebSearchCostPer1K = p.WebSearchCostPer1K
+		mc.EmbeddingCostPerMillion = p.EmbeddingCostPerMillion
+		mc.ReasoningCostPerMillion = p.ReasoningCostPerMillion
+		mc.ContextWindow = nonZero(p.ContextWindow)
+		mc.MaxOutputTokens = nonZero(p.MaxOutputTokens)
+	}
+	return mc
+}
+
+func nonZero(n int) *int {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+// Report is the outcome of an upstream's last model sync.
+type Report struct {
+	UpstreamID   uuid.UUID `json:"upstream_id"`
+	UpstreamName string    `json:"upstream_name"`
+	SyncedAt     time.Time `json:"synced_at"`
+	NextSyncAt   time.Time `json:"next_sync_at"`
+	// Error is why the last sync failed; the upstream's models keep the
+	// stale flags of the last successful sync, and retries back off.
+	Error    string `json:"error,omitempty"`
+	Failures int    `json:"consecutive_failures"`
+
+	Listed   int      `json:"listed"`   // models the upstream lists
+	New      []string `json:"new"`      // listed, but not a pxbin model
+	Stale    []string `json:"stale"`    // pxbin models on this upstream it no longer lists
+	Imported []string `json:"imported"` // new models created (auto_import_models)
+}
+
+// Syncer periodically lists every active upstream's models, flags pxbin
+// models their upstream no longer lists as stale, and imports new ones for
+// upstreams with auto_import_models set.
+type Syncer struct {
+	store    store.Store
+	billing  *billing.Tracker
+	client   *http.Client
+	interval time.Duration
+
+	running sync.Mutex // held for a whole sync run
+	mu      sync.Mutex
+	reports map[uuid.UUID]*Report
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewSyncer creates a syncer that syncs every interval, or only on SyncNow
+// when interval is 0. Call Close to stop it.
+func NewSyncer(s store.Store, bt *billing.Tracker, interval time.Duration) *Syncer {
+	sy := &Syncer{
+		store:    s,
+		billing:  bt,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		interval: interval,
+		reports:  make(map[uuid.UUID]*Report),
+		done:     make(chan struct{}),
+	}
+	if interval > 0 {
+		sy.wg.Add(1)
+		go sy.worker()
+	}
+	return sy
+}
+
+func (sy *Syncer) Close() {
+	close(sy.done)
+	sy.wg.Wait()
+}
+
+func (sy *Syncer) worker() {
+	defer sy.wg.Done()
+
+	ticker := time.NewTicker(sy.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), sy.interval)
+			if err := sy.sync(ctx, false); err != nil {
+				log.Printf("discovery: sync failed: %v", err)
+			}
+			cancel()
+		case <-sy.done:
+			return
+		}
+	}
+}
+
+// Reports returns the last sync of every active upstream, by name.
+func (sy *Syncer) Reports() []Report {
+	sy.mu.Lock()
+	defer sy.mu.Unlock()
+	out := make([]Report, 0, len(sy.reports))
+	for _, r := range sy.reports {
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UpstreamName < out[j].UpstreamName })
+	return out
+}
+
+// SyncNow syncs every active upstream immediately, including those backing
+// off after failures, and returns the resulting reports.
+func (sy *Syncer) SyncNow(ctx context.Context) ([]Report, error) {
+	if err := sy.sync(ctx, true); err != nil {
+		return nil, err
+	}
+	return sy.Reports(), nil
+}
+
+// sync lists the upstreams that are due, or all of them when force is set,
+// a few at a time. An upstream that failed waits twice as many intervals
+// after each further failure, so a dead upstream costs little.
+func (sy *Syncer) sync(ctx context.Context, force bool) error {
+	sy.running.Lock()
+	defer sy.running.Unlock()
+
+	upstreams, err := sy.store.ListUpstreams(ctx)
+	if err != nil {
+		return err
+	}
+	models, err := sy.store.ListModels(ctx)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(models))
+	linked := make(map[uuid.UUID][]string)
+	for _, m := range models {
+		known[strings.ToLower(m.Name)] = true
+		for _, a := range m.Aliases {
+			known[a] = true
+		}
+		if m.UpstreamID != nil {
+			linked[*m.UpstreamID] = append(linked[*m.UpstreamID], m.Name)
+		}
+	}
+
+	// Drop reports of upstreams that were deleted or deactivated.
+	now := time.Now()
+	active := make(map[uuid.UUID]bool)
+	var due []store.Upstream
+	sy.mu.Lock()
+	for _, u := range upstreams {
+		if !u.IsActive || !Listable(u.Format) {
+			continue
+		}
+		active[u.ID] = true
+		// Ticks and runs drift by a little; half an interval of slack keeps
+		// an upstream from skipping a tick it is due on.
+		if r := sy.reports[u.ID]; force || r == nil || !now.Before(r.NextSyncAt.Add(-sy.interval/2)) {
+			due = append(due, u)
+		}
+	}
+	for id := range sy.reports {
+		if !active[id] {
+			delete(sy.reports, id)
+		}
+	}
+	sy.mu.Unlock()
+
+	var pricingOnce sync.Once
+	var pricingData map[string]*pricing.ModelPricing
+	loadPricing := func() map[string]*pricing.ModelPricing {
+		pricingOnce.Do(func() {
+			var err error
+			if pricingData, err = pricing.FetchLiteLLMPricing(ctx); err != nil {
+				log.Printf("discovery: pricing unavailable for imported models: %v", err)
+				pricingData = map[string]*pricing.ModelPricing{}
+			}
+		})
+		return pricingData
+	}
+
+	var knownMu sync.Mutex
+	imported := false
+	sem := make(chan struct{}, syncConcurrency)
+	var wg sync.WaitGroup
+	for i := range due {
+		u := &due[i]
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			r := &Report{UpstreamID: u.ID, UpstreamName: u.Name, SyncedAt: time.Now(), New: []string{}, Stale: []string{}, Imported: []string{}}
+			listed, err := Fetch(ctx, sy.client, u)
+			if err == nil {
+				err = sy.store.MarkStaleModels(ctx, u.ID, modelIDs(listed))
+			}
+			if err != nil {
+				sy.fail(r, err)
+				return
+			}
+
+			r.Listed = len(listed)
+			upstreamHas := make(map[string]bool, len(listed))
+			for _, m := range listed {
+				upstreamHas[strings.ToLower(m.ID)] = true
+			}
+			for _, name := range linked[u.ID] {
+				if !upstreamHas[strings.ToLower(name)] {
+					r.Stale = append(r.Stale, name)
+				}
+			}
+			for _, m := range listed {
+				knownMu.Lock()
+				isNew := !known[strings.ToLower(m.ID)]
+				if isNew && u.AutoImportModels {
+					// Claimed before creating, so two upstreams listing the
+					// same model do not both import it.
+					known[strings.ToLower(m.ID)] = true
+				}
+				knownMu.Unlock()
+				if !isNew {
+					continue
+				}
+				r.New = append(r.New, m.ID)
+				if !u.AutoImportModels {
+					continue
+				}
+				provider := m.OwnedBy
+				if provider == "" {
+					provider = u.Name
+				}
+				if _, err := sy.store.CreateModel(ctx, NewModel(m.ID, provider, u.ID, loadPricing())); err != nil {
+					log.Printf("discovery: import %s from %s: %v", m.ID, u.Name, err)
+					continue
+				}
+				r.Imported = append(r.Imported, m.ID)
+			}
+			sort.Strings(r.Stale)
+			sort.Strings(r.New)
+			r.NextSyncAt = r.SyncedAt.Add(sy.interval)
+
+			sy.mu.Lock()
+			sy.reports[u.ID] = r
+			if len(r.Imported) > 0 {
+				imported = true
+			}
+			sy.mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if imported && sy.billing != nil {
+		_ = sy.billing.RefreshPricing(ctx)
+	}
+	return nil
+}
+
+// fail records a failed sync of r's upstream, keeping what the last
+// successful sync found.
+func (sy *Syncer) fail(r *Report, err error) {
+	sy.mu.Lock()
+	defer sy.mu.Unlock()
+	if prev := sy.reports[r.UpstreamID]; prev != nil {
+		r.Failures = prev.Failures
+		r.Listed, r.New, r.Stale = prev.Listed, prev.New, prev.Stale
+	}
+	r.Error = err.Error()
+	r.Failures++
+	r.NextSyncAt = r.SyncedAt.Add(sy.interval * time.Duration(min(1<<(r.Failures-1), maxBackoff)))
+	sy.reports[r.UpstreamID] = r
+}
+
+func modelIDs(models []Model) []string {
+	ids := make([]string, len(models))
+	for i, m := range models {
+		ids[i] = m.ID
+	}
+	return ids
+}
@@ -0,0 +1,137 @@
+// Package events publishes key lifecycle and budget events to pluggable
+// consumers, such as a webhook, the application log or metrics, so other
+// systems can react to them without polling the management API.
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Type names an event.
+type Type string
+
+const (
+	// KeyCreated is emitted when an LLM key is created, by the management
+	// API or by SCIM provisioning.
+	KeyCreated Type = "key.created"
+	// KeyDeactivated is emitted when an active LLM key is deactivated.
+	KeyDeactivated Type = "key.deactivated"
+	// KeyReactivated is emitted when a deactivated LLM key is activated again.
+	KeyReactivated Type = "key.reactivated"
+	// KeyBudgetExceeded is emitted when a key's requests start being
+	// rejected for spending its daily or monthly budget.
+	KeyBudgetExceeded Type = "key.budget_exceeded"
+	// KeyBudgetRestored is emitted when a key over budget is let through
+	// again, because the budget reset, was raised or was removed.
+	KeyBudgetRestored Type = "key.budget_restored"
+)
+
+// Event is something that happened to an LLM key.
+type Event struct {
+	ID      uuid.UUID      `json:"id"`
+	Type    Type           `json:"type"`
+	Time    time.Time      `json:"time"`
+	KeyID   uuid.UUID      `json:"key_id"`
+	KeyName string         `json:"key_name,omitempty"`
+	Data    map[string]any `json:"data,omitempty"`
+}
+
+// Consumer receives events. Each consumer is called from its own goroutine,
+// one event at a time, so a slow consumer does not hold up the others.
+type Consumer interface {
+	Consume(e Event)
+}
+
+// ConsumerFunc adapts a function to a Consumer.
+type ConsumerFunc func(e Event)
+
+// Consume calls f(e).
+func (f ConsumerFunc) Consume(e Event) { f(e) }
+
+// LogSink writes each event to the application log, as an audit trail of
+// key changes.
+type LogSink struct{}
+
+// Consume logs e.
+func (LogSink) Consume(e Event) {
+	log.Printf("event %s: key %s (%s) %v", e.Type, e.KeyID, e.KeyName, e.Data)
+}
+
+// defaultBufferSize is how many events wait for each consumer before new
+// ones are dropped.
+const defaultBufferSize = 1000
+
+// Bus fans events out to its consumers. Emit never blocks: an event that
+// does not fit in a consumer's buffer is dropped for that consumer. A nil
+// Bus discards every event.
+type Bus struct {
+	queues []chan Event
+	wg     sync.WaitGroup
+	mu     sync.RWMutex // guards closed against sends on closed queues
+	closed bool
+}
+
+// NewBus starts a bus delivering to consumers, with bufferSize events
+// queued per consumer (default 1000). It returns nil without consumers.
+func NewBus(bufferSize int, consumers ...Consumer) *Bus {
+	if len(consumers) == 0 {
+		return nil
+	}
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	b := &Bus{}
+	for _, c := range consumers {
+		q := make(chan Event, bufferSize)
+		b.queues = append(b.queues, q)
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			for e := range q {
+				c.Consume(e)
+			}
+		}()
+	}
+	return b
+}
+
+// Emit publishes an event of type t for a key, with optional details.
+func (b *Bus) Emit(t Type, keyID uuid.UUID, keyName string, data map[string]any) {
+	if b == nil {
+		return
+	}
+	e := Event{ID: uuid.New(), Type: t, Time: time.Now().UTC(), KeyID: keyID, KeyName: keyName, Data: data}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+	for _, q := range b.queues {
+		select {
+		case q <- e:
+		default:
+			log.Printf("events: consumer buffer full, dropping %s event for key %s", t, keyID)
+		}
+	}
+}
+
+// Close stops accepting events and waits for the consumers to handle the
+// ones already queued. Events emitted after Close are discarded.
+func (b *Bus) Close() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		for _, q := range b.queues {
+			close(q)
+		}
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
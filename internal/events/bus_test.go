@@ -0,0 +1,81 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBusDeliversToEveryConsumer(t *testing.T) {
+	var mu sync.Mutex
+	var got []Type
+	record := ConsumerFunc(func(e Event) {
+		mu.Lock()
+		got = append(got, e.Type)
+		mu.Unlock()
+	})
+	b := NewBus(0, record, record)
+	b.Emit(KeyCreated, uuid.New(), "ci", nil)
+	b.Close()
+	b.Emit(KeyDeactivated, uuid.New(), "ci", nil)
+
+	if len(got) != 2 || got[0] != KeyCreated || got[1] != KeyCreated {
+		t.Fatalf("expected one key.created per consumer and nothing after Close, got %v", got)
+	}
+
+	var none *Bus
+	none.Emit(KeyCreated, uuid.New(), "ci", nil)
+	none.Close()
+	if NewBus(0) != nil {
+		t.Fatal("expected no bus without consumers")
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var calls int
+	var body []byte
+	var sig, typ string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		sig, typ = r.Header.Get("X-Pxbin-Signature"), r.Header.Get("X-Pxbin-Event")
+	}))
+	defer srv.Close()
+
+	s := NewWebhookSink(srv.URL, "secret")
+	s.backoff = 0
+	keyID := uuid.New()
+	s.Consume(Event{ID: uuid.New(), Type: KeyBudgetExceeded, KeyID: keyID, Data: map[string]any{"budget": "daily"}})
+
+	if calls != 2 {
+		t.Fatalf("expected a retry after the 502, got %d calls", calls)
+	}
+	if typ != string(KeyBudgetExceeded) || sig != "sha256="+Sign([]byte("secret"), body) {
+		t.Fatalf("unexpected headers: event %q signature %q", typ, sig)
+	}
+	var e Event
+	if err := json.Unmarshal(body, &e); err != nil || e.KeyID != keyID || e.Data["budget"] != "daily" {
+		t.Fatalf("unexpected body %s: %v", body, err)
+	}
+
+	var rejected int
+	gone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rejected++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer gone.Close()
+	s.url = gone.URL
+	s.Consume(Event{ID: uuid.New(), Type: KeyCreated})
+	if rejected != 1 {
+		t.Fatalf("expected a 404 not to be retried, got %d calls", rejected)
+	}
+}
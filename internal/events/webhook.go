@@ -0,0 +1,90 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// webhookAttempts is how often a delivery is tried before it is given up.
+const webhookAttempts = 3
+
+// WebhookSink POSTs each event as JSON to a URL. With a secret, the body is
+// signed with HMAC-SHA256 in the X-Pxbin-Signature header as
+// sha256=<hex>, so the receiver can check it came from pxbin. Deliveries
+// that fail or get a 5xx are retried with backoff; other 4xx responses are
+// not.
+type WebhookSink struct {
+	url     string
+	secret  []byte
+	client  *http.Client
+	backoff time.Duration
+}
+
+// NewWebhookSink returns a sink posting events to url, signed with secret
+// if it is not empty.
+func NewWebhookSink(url, secret string) *WebhookSink {
+	return &WebhookSink{
+		url:     url,
+		secret:  []byte(secret),
+		client:  &http.Client{Timeout: 10 * time.Second},
+		backoff: time.Second,
+	}
+}
+
+// Consume delivers e, logging it if every attempt fails.
+func (s *WebhookSink) Consume(e Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("events: marshal %s event: %v", e.Type, err)
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		retry, err := s.deliver(e, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == webhookAttempts {
+			log.Printf("events: webhook delivery of %s event %s failed: %v", e.Type, e.ID, err)
+			return
+		}
+		time.Sleep(s.backoff << (attempt - 1))
+	}
+}
+
+// deliver posts body once, reporting whether a failure is worth retrying.
+func (s *WebhookSink) deliver(e Event, body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Pxbin-Event", string(e.Type))
+	req.Header.Set("X-Pxbin-Event-Id", e.ID.String())
+	if len(s.secret) > 0 {
+		req.Header.Set("X-Pxbin-Signature", "sha256="+Sign(s.secret, body))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return false, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of body with secret, as sent in the
+// X-Pxbin-Signature header.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
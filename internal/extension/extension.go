@@ -0,0 +1,252 @@
+// Package extension runs per-upstream WASM modules that patch the JSON sent
+// to and received from an upstream, so dialect quirks of OpenAI-compatible
+// providers can be fixed without forking pxbin.
+//
+// A module exports its linear memory as "memory", an allocator
+//
+//	alloc(size i32) -> i32
+//
+// and any of the hooks
+//
+//	patch_request(ptr i32, len i32) -> i64   // request body
+//	patch_response(ptr i32, len i32) -> i64  // non-streaming response body
+//	patch_chunk(ptr i32, len i32) -> i64     // data payload of one SSE event
+//
+// pxbin copies the JSON into memory returned by alloc and calls the hook. A
+// hook returns 0 to leave the JSON unchanged, or the patched JSON's pointer
+// in the high 32 bits and its length in the low 32 bits. A trap fails the
+// request. WASI reactor modules (TinyGo, Rust wasm32-wasip1) are supported;
+// they get no filesystem, clock or environment beyond WASI's defaults.
+package extension
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+const (
+	// callTimeout bounds a single hook call; a module that runs longer is
+	// killed and the request fails.
+	callTimeout = 250 * time.Millisecond
+
+	// memoryLimitPages caps a module's linear memory at 256 MiB, enough to
+	// hold a maximum-size request body a few times over.
+	memoryLimitPages = 4096
+)
+
+// ValidName reports whether name can name a module: a plain .wasm file name
+// inside the extensions directory.
+func ValidName(name string) bool {
+	return strings.HasSuffix(name, ".wasm") && !strings.HasPrefix(name, ".") &&
+		filepath.Base(name) == name && !strings.ContainsAny(name, `/\`)
+}
+
+// Runtime compiles and caches the modules in an extensions directory.
+// Modules are compiled on first use and recompiled when their file changes,
+// so a fix can be deployed by replacing the file.
+type Runtime struct {
+	dir string
+	rt  wazero.Runtime
+
+	mu      sync.Mutex
+	modules map[string]*Module
+}
+
+// NewRuntime creates a Runtime loading modules from dir.
+func NewRuntime(ctx context.Context, dir string) (*Runtime, error) {
+	rt := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(memoryLimitPages).
+		WithCloseOnContextDone(true))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		rt.Close(ctx)
+		return nil, fmt.Errorf("instantiate wasi: %w", err)
+	}
+	return &Runtime{dir: dir, rt: rt, modules: make(map[string]*Module)}, nil
+}
+
+// Close releases all compiled modules.
+func (r *Runtime) Close(ctx context.Context) error {
+	return r.rt.Close(ctx)
+}
+
+// Module returns the compiled module called name, compiling it if it is new
+// or its file changed since it was last compiled.
+func (r *Runtime) Module(ctx context.Context, name string) (*Module, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid extension name %q", name)
+	}
+	path := filepath.Join(r.dir, name)
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("load extension %s: %w", name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m, ok := r.modules[name]; ok && m.modTime.Equal(fi.ModTime()) && m.size == fi.Size() {
+		return m, nil
+	}
+
+	bin, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load extension %s: %w", name, err)
+	}
+	compiled, err := r.rt.CompileModule(ctx, bin)
+	if err != nil {
+		return nil, fmt.Errorf("compile extension %s: %w", name, err)
+	}
+	exports := compiled.ExportedFunctions()
+	if _, ok := exports["alloc"]; !ok {
+		compiled.Close(ctx)
+		return nil, fmt.Errorf("extension %s does not export alloc", name)
+	}
+	m := &Module{
+		name:     name,
+		rt:       r.rt,
+		compiled: compiled,
+		modTime:  fi.ModTime(),
+		size:     fi.Size(),
+		hooks:    make(map[string]bool),
+	}
+	for _, hook := range []string{hookRequest, hookResponse, hookChunk} {
+		_, m.hooks[hook] = exports[hook]
+	}
+	// The replaced module is left to in-flight requests; compiled code is
+	// freed with the runtime.
+	r.modules[name] = m
+	return m, nil
+}
+
+const (
+	hookRequest  = "patch_request"
+	hookResponse = "patch_response"
+	hookChunk    = "patch_chunk"
+)
+
+// Module is a compiled extension. Each request body or response runs in a
+// fresh instance, so modules cannot leak state between requests; a stream's
+// chunks share one instance so a module can carry state across them.
+type Module struct {
+	name     string
+	rt       wazero.Runtime
+	compiled wazero.CompiledModule
+	modTime  time.Time
+	size     int64
+	hooks    map[string]bool
+}
+
+// Name returns the module's file name.
+func (m *Module) Name() string { return m.name }
+
+// PatchesRequests reports whether the module exports patch_request.
+func (m *Module) PatchesRequests() bool { return m.hooks[hookRequest] }
+
+// PatchesResponses reports whether the module exports patch_response.
+func (m *Module) PatchesResponses() bool { return m.hooks[hookResponse] }
+
+// PatchesChunks reports whether the module exports patch_chunk.
+func (m *Module) PatchesChunks() bool { return m.hooks[hookChunk] }
+
+// PatchRequest runs patch_request on an upstream request body.
+func (m *Module) PatchRequest(ctx context.Context, body []byte) ([]byte, error) {
+	return m.runOnce(ctx, hookRequest, body)
+}
+
+// PatchResponse runs patch_response on a non-streaming response body.
+func (m *Module) PatchResponse(ctx context.Context, body []byte) ([]byte, error) {
+	return m.runOnce(ctx, hookResponse, body)
+}
+
+func (m *Module) runOnce(ctx context.Context, hook string, data []byte) ([]byte, error) {
+	if !m.hooks[hook] {
+		return data, nil
+	}
+	inst, err := m.instantiate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer inst.Close(context.WithoutCancel(ctx))
+	return m.call(ctx, inst, hook, data)
+}
+
+// Stream patches the chunks of one streamed response.
+type Stream struct {
+	m    *Module
+	inst api.Module
+}
+
+// NewStream instantiates the module for a stream. The caller must Close it.
+func (m *Module) NewStream(ctx context.Context) (*Stream, error) {
+	inst, err := m.instantiate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Stream{m: m, inst: inst}, nil
+}
+
+// PatchChunk runs patch_chunk on the data payload of one SSE event.
+func (s *Stream) PatchChunk(ctx context.Context, chunk []byte) ([]byte, error) {
+	return s.m.call(ctx, s.inst, hookChunk, chunk)
+}
+
+// Name returns the stream's module name.
+func (s *Stream) Name() string { return s.m.name }
+
+// Close releases the stream's instance.
+func (s *Stream) Close(ctx context.Context) error {
+	return s.inst.Close(ctx)
+}
+
+func (m *Module) instantiate(ctx context.Context) (api.Module, error) {
+	// Anonymous instances, so concurrent requests can each have one.
+	inst, err := m.rt.InstantiateModule(ctx, m.compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize"))
+	if err != nil {
+		return nil, fmt.Errorf("instantiate extension %s: %w", m.name, err)
+	}
+	return inst, nil
+}
+
+var errBadResult = errors.New("result out of memory bounds")
+
+func (m *Module) call(ctx context.Context, inst api.Module, hook string, data []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	mem := inst.Memory()
+	if mem == nil {
+		return nil, fmt.Errorf("extension %s does not export memory", m.name)
+	}
+	res, err := inst.ExportedFunction("alloc").Call(ctx, uint64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("extension %s alloc: %w", m.name, err)
+	}
+	ptr := uint32(res[0])
+	if !mem.Write(ptr, data) {
+		return nil, fmt.Errorf("extension %s alloc: %w", m.name, errBadResult)
+	}
+	res, err = inst.ExportedFunction(hook).Call(ctx, uint64(ptr), uint64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("extension %s %s: %w", m.name, hook, err)
+	}
+	if res[0] == 0 {
+		return data, nil
+	}
+	out, ok := mem.Read(uint32(res[0]>>32), uint32(res[0]))
+	if !ok {
+		return nil, fmt.Errorf("extension %s %s: %w", m.name, hook, errBadResult)
+	}
+	// Copy out: the view aliases the instance's memory.
+	return append([]byte(nil), out...), nil
+}
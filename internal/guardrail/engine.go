@@ -0,0 +1,205 @@
+// Package guardrail checks the text of requests before they are dispatched
+// and of responses before they reach the client against the guardrails
+// configured through the management API. Each guardrail runs one filter,
+// picked by its kind from those registered with Register: a blocklist of
+// regular expressions, a prompt length limit and PII detection are built
+// in. A guardrail in block mode stops what it matches; one in flag mode
+// only records a verdict with the request log.
+package guardrail
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// Stages a guardrail runs at.
+const (
+	StageRequest  = "request"
+	StageResponse = "response"
+	StageBoth     = "both"
+)
+
+// Modes of a guardrail.
+const (
+	ModeBlock = "block"
+	ModeFlag  = "flag"
+)
+
+// ValidStage reports whether s is a known stage.
+func ValidStage(s string) bool {
+	return s == StageRequest || s == StageResponse || s == StageBoth
+}
+
+// ValidMode reports whether m is a known mode.
+func ValidMode(m string) bool {
+	return m == ModeBlock || m == ModeFlag
+}
+
+// Verdict records a guardrail matching a request or its response.
+type Verdict struct {
+	Guardrail string `json:"guardrail"`
+	Stage     string `json:"stage"` // request or response
+	Mode      string `json:"mode"`
+	Reason    string `json:"reason"`
+	Message   string `json:"-"` // the guardrail's message for the client
+}
+
+// Blocked returns the first verdict of a block guardrail, or nil.
+func Blocked(verdicts []Verdict) *Verdict {
+	for i, v := range verdicts {
+		if v.Mode == ModeBlock {
+			return &verdicts[i]
+		}
+	}
+	return nil
+}
+
+type rule struct {
+	store.Guardrail
+	filter Filter
+}
+
+func (r *rule) runsAt(stage string) bool {
+	return r.Stage == StageBoth || r.Stage == stage
+}
+
+type ruleSet struct {
+	anyKey []rule               // guardrails for every key
+	byKey  map[uuid.UUID][]rule // guardrails for one key
+}
+
+// Engine checks text against the active guardrails in the store. They are
+// reloaded every interval, and on Reload after a change through the
+// management API.
+type Engine struct {
+	store    store.Store
+	interval time.Duration
+	set      atomic.Pointer[ruleSet]
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewEngine loads the guardrails from s and reloads them every interval.
+// Call Close to stop it.
+func NewEngine(s store.Store, interval time.Duration) *Engine {
+	e := &Engine{
+		store:    s,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	e.set.Store(&ruleSet{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := e.Reload(ctx); err != nil {
+		log.Printf("guardrails: initial load failed: %v", err)
+	}
+	cancel()
+
+	e.wg.Add(1)
+	go e.worker()
+	return e
+}
+
+func (e *Engine) Close() {
+	close(e.done)
+	e.wg.Wait()
+}
+
+func (e *Engine) worker() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := e.Reload(ctx); err != nil {
+				log.Printf("guardrails: reload failed: %v", err)
+			}
+			cancel()
+		case <-e.done:
+			return
+		}
+	}
+}
+
+// Reload replaces the guardrails with the active ones in the store.
+// Guardrails whose filter cannot be built are skipped.
+func (e *Engine) Reload(ctx context.Context) error {
+	guardrails, err := e.store.ListGuardrails(ctx)
+	if err != nil {
+		return err
+	}
+	set := &ruleSet{byKey: make(map[uuid.UUID][]rule)}
+	for _, g := range guardrails {
+		if !g.IsActive {
+			continue
+		}
+		f, err := New(&g)
+		if err != nil {
+			log.Printf("guardrails: skipping %q: %v", g.Name, err)
+			continue
+		}
+		if g.KeyID == nil {
+			set.anyKey = append(set.anyKey, rule{Guardrail: g, filter: f})
+		} else {
+			set.byKey[*g.KeyID] = append(set.byKey[*g.KeyID], rule{Guardrail: g, filter: f})
+		}
+	}
+	e.set.Store(set)
+	return nil
+}
+
+// Applies reports whether any guardrail runs at stage for a key's
+// requests.
+func (e *Engine) Applies(keyID uuid.UUID, stage string) bool {
+	if e == nil {
+		return false
+	}
+	set := e.set.Load()
+	for _, rules := range [][]rule{set.anyKey, set.byKey[keyID]} {
+		for i := range rules {
+			if rules[i].runsAt(stage) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check runs the guardrails of a key's requests at stage over text and
+// returns the verdicts of those that match, guardrails for every key first.
+func (e *Engine) Check(keyID uuid.UUID, stage, text string) []Verdict {
+	if e == nil {
+		return nil
+	}
+	set := e.set.Load()
+	var verdicts []Verdict
+	for _, rules := range [][]rule{set.anyKey, set.byKey[keyID]} {
+		for i := range rules {
+			r := &rules[i]
+			if !r.runsAt(stage) {
+				continue
+			}
+			if reason := r.filter.Check(text); reason != "" {
+				verdicts = append(verdicts, Verdict{
+					Guardrail: r.Name,
+					Stage:     stage,
+					Mode:      r.Mode,
+					Reason:    reason,
+					Message:   r.Message,
+				})
+			}
+		}
+	}
+	return verdicts
+}
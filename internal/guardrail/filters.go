@@ -0,0 +1,217 @@
+package guardrail
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// Filter checks text against one guardrail.
+type Filter interface {
+	// Check returns why text violates the guardrail, or "" if it does not.
+	// The reason must not quote the text: it is stored with the request log.
+	Check(text string) string
+}
+
+// Factory builds the filter of a guardrail from its settings. It returns an
+// *InvalidError if they are not valid for its kind.
+type Factory func(g *store.Guardrail) (Filter, error)
+
+// InvalidError reports a guardrail setting that is not valid for its kind.
+type InvalidError struct {
+	Field   string
+	Message string
+}
+
+func (e *InvalidError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// Register makes a filter kind available to guardrails. It panics if kind
+// is already registered.
+func Register(kind string, f Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, ok := factories[kind]; ok {
+		panic("guardrail: kind " + kind + " registered twice")
+	}
+	factories[kind] = f
+}
+
+// Kinds returns the registered filter kinds, sorted.
+func Kinds() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	kinds := make([]string, 0, len(factories))
+	for k := range factories {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// New builds the filter of g.
+func New(g *store.Guardrail) (Filter, error) {
+	factoriesMu.RLock()
+	f, ok := factories[g.Kind]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, &InvalidError{Field: "kind", Message: "must be one of " + strings.Join(Kinds(), ", ")}
+	}
+	return f(g)
+}
+
+func init() {
+	Register(KindRegex, newRegexFilter)
+	Register(KindMaxLength, newMaxLengthFilter)
+	Register(KindPII, newPIIFilter)
+}
+
+// Built-in filter kinds.
+const (
+	KindRegex     = "regex"      // blocklist of regular expressions
+	KindMaxLength = "max_length" // prompt length limit in characters
+	KindPII       = "pii"        // personal data detection
+)
+
+// regexFilter matches a blocklist of regular expressions.
+type regexFilter []*regexp.Regexp
+
+func newRegexFilter(g *store.Guardrail) (Filter, error) {
+	if len(g.Patterns) == 0 {
+		return nil, &InvalidError{Field: "patterns", Message: "must not be empty for regex guardrails"}
+	}
+	f := make(regexFilter, 0, len(g.Patterns))
+	for i, p := range g.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, &InvalidError{Field: fmt.Sprintf("patterns[%d]", i), Message: "is invalid: " + err.Error()}
+		}
+		f = append(f, re)
+	}
+	return f, nil
+}
+
+func (f regexFilter) Check(text string) string {
+	for i, re := range f {
+		if re.MatchString(text) {
+			return fmt.Sprintf("matched pattern %d", i)
+		}
+	}
+	return ""
+}
+
+// maxLengthFilter limits the length of a prompt.
+type maxLengthFilter int
+
+func newMaxLengthFilter(g *store.Guardrail) (Filter, error) {
+	if g.MaxChars <= 0 {
+		return nil, &InvalidError{Field: "max_chars", Message: "must be positive for max_length guardrails"}
+	}
+	if g.Stage != StageRequest {
+		return nil, &InvalidError{Field: "stage", Message: "must be request for max_length guardrails"}
+	}
+	return maxLengthFilter(g.MaxChars), nil
+}
+
+func (f maxLengthFilter) Check(text string) string {
+	if n := utf8.RuneCountInString(text); n > int(f) {
+		return fmt.Sprintf("prompt is %d characters, over the limit of %d", n, int(f))
+	}
+	return ""
+}
+
+// PII entities a pii guardrail can detect.
+const (
+	EntityEmail      = "email"
+	EntityPhone      = "phone"
+	EntityCreditCard = "credit_card"
+	EntitySSN        = "ssn"
+	EntityIPAddress  = "ip_address"
+)
+
+var piiPatterns = map[string]*regexp.Regexp{
+	EntityEmail:      regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	EntityPhone:      regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?\(?\b\d{3}\)?[\s.-]?\d{3}[\s.-]\d{4}\b`),
+	EntityCreditCard: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+	EntitySSN:        regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+	EntityIPAddress:  regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`),
+}
+
+// Entities returns the PII entities, sorted.
+func Entities() []string {
+	entities := make([]string, 0, len(piiPatterns))
+	for e := range piiPatterns {
+		entities = append(entities, e)
+	}
+	sort.Strings(entities)
+	return entities
+}
+
+// piiFilter detects personal data. Card numbers must pass the Luhn check,
+// so that long numbers such as order IDs do not match.
+type piiFilter []string
+
+func newPIIFilter(g *store.Guardrail) (Filter, error) {
+	if len(g.Entities) == 0 {
+		return piiFilter(Entities()), nil
+	}
+	for i, e := range g.Entities {
+		if _, ok := piiPatterns[e]; !ok {
+			return nil, &InvalidError{Field: fmt.Sprintf("entities[%d]", i), Message: "must be one of " + strings.Join(Entities(), ", ")}
+		}
+	}
+	f := slices.Clone(g.Entities)
+	slices.Sort(f)
+	return piiFilter(slices.Compact(f)), nil
+}
+
+func (f piiFilter) Check(text string) string {
+	var found []string
+	for _, e := range f {
+		re := piiPatterns[e]
+		if e == EntityCreditCard {
+			if !slices.ContainsFunc(re.FindAllString(text, -1), luhn) {
+				continue
+			}
+		} else if !re.MatchString(text) {
+			continue
+		}
+		found = append(found, e)
+	}
+	if len(found) == 0 {
+		return ""
+	}
+	return "found " + strings.Join(found, ", ")
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
@@ -0,0 +1,125 @@
+package guardrail
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestFilters(t *testing.T) {
+	tests := []struct {
+		name string
+		g    store.Guardrail
+		text string
+		want string
+	}{
+		{"regex match", store.Guardrail{Kind: KindRegex, Patterns: []string{`secret`, `(?i)drop\s+table`}}, "please DROP  table users", "matched pattern 1"},
+		{"regex no match", store.Guardrail{Kind: KindRegex, Patterns: []string{`secret`}}, "nothing here", ""},
+		{"max length over", store.Guardrail{Kind: KindMaxLength, Stage: StageRequest, MaxChars: 3}, "héllo", "prompt is 5 characters, over the limit of 3"},
+		{"max length at limit", store.Guardrail{Kind: KindMaxLength, Stage: StageRequest, MaxChars: 5}, "héllo", ""},
+		{"pii email", store.Guardrail{Kind: KindPII}, "mail me at jane.doe@example.com", "found email"},
+		{"pii several", store.Guardrail{Kind: KindPII}, "ssn 123-45-6789 from 10.0.0.1", "found ip_address, ssn"},
+		{"pii card passes luhn", store.Guardrail{Kind: KindPII, Entities: []string{EntityCreditCard}}, "card 4111 1111 1111 1111", "found credit_card"},
+		{"pii card fails luhn", store.Guardrail{Kind: KindPII, Entities: []string{EntityCreditCard}}, "order 4111 1111 1111 1112", ""},
+		{"pii phone", store.Guardrail{Kind: KindPII, Entities: []string{EntityPhone}}, "call (555) 123-4567", "found phone"},
+		{"pii not selected", store.Guardrail{Kind: KindPII, Entities: []string{EntitySSN}}, "jane@example.com", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := New(&tt.g)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if got := f.Check(tt.text); got != tt.want {
+				t.Errorf("Check(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		g     store.Guardrail
+		field string
+	}{
+		{"unknown kind", store.Guardrail{Kind: "toxicity"}, "kind"},
+		{"no patterns", store.Guardrail{Kind: KindRegex}, "patterns"},
+		{"bad pattern", store.Guardrail{Kind: KindRegex, Patterns: []string{"ok", "("}}, "patterns[1]"},
+		{"no max", store.Guardrail{Kind: KindMaxLength, Stage: StageRequest}, "max_chars"},
+		{"max on responses", store.Guardrail{Kind: KindMaxLength, Stage: StageBoth, MaxChars: 10}, "stage"},
+		{"unknown entity", store.Guardrail{Kind: KindPII, Entities: []string{"email", "passport"}}, "entities[1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(&tt.g)
+			var invalid *InvalidError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("New error = %v, want an *InvalidError", err)
+			}
+			if invalid.Field != tt.field {
+				t.Errorf("field = %q, want %q", invalid.Field, tt.field)
+			}
+		})
+	}
+}
+
+func TestEngine(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	key, err := st.CreateLLMKey(ctx, "hash", "pxb_test", "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := uuid.New()
+
+	for _, gc := range []store.GuardrailCreate{
+		{Name: "no-secrets", Kind: KindRegex, Stage: StageBoth, Mode: ModeBlock, Patterns: []string{"secret"}, Message: "no secrets"},
+		{Name: "short", Kind: KindMaxLength, Stage: StageRequest, Mode: ModeFlag, KeyID: &key.ID, MaxChars: 10},
+		{Name: "broken", Kind: KindRegex, Stage: StageRequest, Mode: ModeBlock, Patterns: []string{"("}},
+	} {
+		if _, err := st.CreateGuardrail(ctx, &gc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := NewEngine(st, time.Hour)
+	defer e.Close()
+
+	if !e.Applies(other, StageResponse) {
+		t.Error("Applies(other, response) = false, want true for a guardrail on every key")
+	}
+
+	got := e.Check(key.ID, StageRequest, "a long secret prompt")
+	if len(got) != 2 || got[0].Guardrail != "no-secrets" || got[1].Guardrail != "short" {
+		t.Fatalf("Check(key) = %+v, want no-secrets then short", got)
+	}
+	b := Blocked(got)
+	if b == nil || b.Guardrail != "no-secrets" || b.Message != "no secrets" {
+		t.Errorf("Blocked = %+v, want no-secrets", b)
+	}
+	if got := e.Check(other, StageRequest, "a long prompt"); len(got) != 0 {
+		t.Errorf("Check(other) = %+v, want no verdicts: short is for another key", got)
+	}
+	if got := e.Check(key.ID, StageResponse, "a long prompt"); len(got) != 0 {
+		t.Errorf("Check(response) = %+v, want none: short runs on requests only", got)
+	}
+
+	// Deactivated guardrails stop applying on reload.
+	gs, _ := st.ListGuardrails(ctx)
+	off := false
+	for _, g := range gs {
+		if g.Name == "no-secrets" {
+			st.UpdateGuardrail(ctx, g.ID, &store.GuardrailUpdate{IsActive: &off})
+		}
+	}
+	if err := e.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if e.Applies(other, StageResponse) {
+		t.Error("Applies after deactivating = true, want false")
+	}
+}
@@ -0,0 +1,121 @@
+// Package ids generates the identifiers pxbin puts in translated responses,
+// in the formats the providers themselves use, so clients that validate or
+// parse IDs accept them.
+package ids
+
+import (
+	crypto_rand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand/v2"
+	"sync"
+)
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var (
+	mu     sync.Mutex
+	seeded *rand.Rand // nil = crypto/rand
+)
+
+// Seed makes every ID generated afterwards derive from seed, so tests can
+// compare translated output byte for byte. The returned function restores
+// random IDs. The seed is process-wide; tests using it must not run in
+// parallel with others that generate IDs.
+func Seed(seed uint64) (restore func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	prev := seeded
+	seeded = rand.New(rand.NewPCG(seed, seed))
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		seeded = prev
+	}
+}
+
+// fill reads random bytes into b.
+func fill(b []byte) {
+	mu.Lock()
+	defer mu.Unlock()
+	if seeded != nil {
+		for i := range b {
+			b[i] = byte(seeded.Uint32())
+		}
+		return
+	}
+	crypto_rand.Read(b)
+}
+
+// randomBase62 returns n characters from [0-9A-Za-z]. Bytes of 248 and over
+// are rejected so every character is equally likely.
+func randomBase62(n int) string {
+	out := make([]byte, 0, n)
+	b := make([]byte, n+n/4)
+	for len(out) < n {
+		fill(b)
+		for _, c := range b {
+			if c < 248 && len(out) < n {
+				out = append(out, base62[c%62])
+			}
+		}
+	}
+	return string(out)
+}
+
+// randomHex returns n lowercase hex characters.
+func randomHex(n int) string {
+	b := make([]byte, (n+1)/2)
+	fill(b)
+	return hex.EncodeToString(b)[:n]
+}
+
+// AnthropicMessage returns a Messages API message ID: "msg_01" and 22
+// base62 characters.
+func AnthropicMessage() string {
+	return "msg_01" + randomBase62(22)
+}
+
+// AnthropicToolUse returns a tool_use block ID: "toolu_01" and 22 base62
+// characters.
+func AnthropicToolUse() string {
+	return "toolu_01" + randomBase62(22)
+}
+
+// ChatCompletion returns a Chat Completions ID: "chatcmpl-" and 29 base62
+// characters.
+func ChatCompletion() string {
+	return "chatcmpl-" + randomBase62(29)
+}
+
+// ToolCall returns a Chat Completions tool call ID: "call_" and 24 base62
+// characters.
+func ToolCall() string {
+	return "call_" + randomBase62(24)
+}
+
+// Response returns a Responses API response ID: "resp_" and 48 hex
+// characters.
+func Response() string {
+	return "resp_" + randomHex(48)
+}
+
+// ResponseMessage returns a Responses API message output item ID: "msg_"
+// and 48 hex characters.
+func ResponseMessage() string {
+	return "msg_" + randomHex(48)
+}
+
+// ResponseFunctionCall returns a Responses API function_call output item
+// ID: "fc_" and 48 hex characters. The item's call_id is the tool call ID.
+func ResponseFunctionCall() string {
+	return "fc_" + randomHex(48)
+}
+
+// Fingerprint returns a Chat Completions system_fingerprint for model:
+// "fp_" and 10 hex characters. It is derived from the model name, so it is
+// stable for a model like a real backend configuration's would be.
+func Fingerprint(model string) string {
+	sum := sha256.Sum256([]byte(model))
+	return "fp_" + hex.EncodeToString(sum[:5])
+}
@@ -0,0 +1,72 @@
+package ids
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		gen     func() string
+		pattern string
+	}{
+		{"AnthropicMessage", AnthropicMessage, `^msg_01[0-9A-Za-z]{22}$`},
+		{"AnthropicToolUse", AnthropicToolUse, `^toolu_01[0-9A-Za-z]{22}$`},
+		{"ChatCompletion", ChatCompletion, `^chatcmpl-[0-9A-Za-z]{29}$`},
+		{"ToolCall", ToolCall, `^call_[0-9A-Za-z]{24}$`},
+		{"Response", Response, `^resp_[0-9a-f]{48}$`},
+		{"ResponseMessage", ResponseMessage, `^msg_[0-9a-f]{48}$`},
+		{"ResponseFunctionCall", ResponseFunctionCall, `^fc_[0-9a-f]{48}$`},
+		{"Fingerprint", func() string { return Fingerprint("gpt-4o") }, `^fp_[0-9a-f]{10}$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re := regexp.MustCompile(tt.pattern)
+			for range 100 {
+				if id := tt.gen(); !re.MatchString(id) {
+					t.Fatalf("%q does not match %s", id, tt.pattern)
+				}
+			}
+		})
+	}
+}
+
+func TestUnique(t *testing.T) {
+	seen := map[string]bool{}
+	for range 1000 {
+		id := AnthropicMessage()
+		if seen[id] {
+			t.Fatalf("duplicate ID %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestSeed(t *testing.T) {
+	restore := Seed(42)
+	first := []string{AnthropicMessage(), ToolCall(), Response()}
+	restore()
+
+	restore = Seed(42)
+	second := []string{AnthropicMessage(), ToolCall(), Response()}
+	restore()
+
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("seeded IDs differ: %q vs %q", first[i], second[i])
+		}
+	}
+	if AnthropicMessage() == first[0] {
+		t.Fatal("expected random IDs after restore")
+	}
+}
+
+func TestFingerprintStable(t *testing.T) {
+	if Fingerprint("gpt-4o") != Fingerprint("gpt-4o") {
+		t.Fatal("fingerprint should be stable for a model")
+	}
+	if Fingerprint("gpt-4o") == Fingerprint("gpt-4o-mini") {
+		t.Fatal("fingerprints should differ between models")
+	}
+}
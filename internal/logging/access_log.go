@@ -0,0 +1,186 @@
+package logging
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// accessLogStore is the store query behind AccessLogger.
+type accessLogStore interface {
+	InsertAccessLogBatch(ctx context.Context, entries []*store.AccessLogEntry) error
+}
+
+// AccessLogger records management API calls into access_logs. Entries are
+// buffered and inserted in batches off the request path; when the buffer is
+// full they are dropped, since management traffic must never wait on logging.
+type AccessLogger struct {
+	ch       chan *store.AccessLogEntry
+	store    accessLogStore
+	trustXFF bool
+	wg       sync.WaitGroup
+	done     chan struct{}
+	dropped  int64 // atomic counter
+}
+
+// NewAccessLogger starts an access logger. trustForwardedFor attributes
+// calls to the last X-Forwarded-For hop, as the auth tarpit does.
+func NewAccessLogger(s store.Store, trustForwardedFor bool) *AccessLogger {
+	return newAccessLogger(s, trustForwardedFor, 1000)
+}
+
+func newAccessLogger(s accessLogStore, trustForwardedFor bool, bufferSize int) *AccessLogger {
+	al := &AccessLogger{
+		ch:       make(chan *store.AccessLogEntry, bufferSize),
+		store:    s,
+		trustXFF: trustForwardedFor,
+		done:     make(chan struct{}),
+	}
+	al.wg.Add(1)
+	go al.worker()
+	return al
+}
+
+func (al *AccessLogger) Log(entry *store.AccessLogEntry) {
+	select {
+	case al.ch <- entry:
+	default:
+		atomic.AddInt64(&al.dropped, 1)
+	}
+}
+
+func (al *AccessLogger) Close() {
+	close(al.done)
+	al.wg.Wait()
+}
+
+// accessKeyHolder carries the authenticated key ID from inside the auth
+// middleware back out to the access log wrapper.
+type accessKeyHolder struct {
+	keyID *uuid.UUID
+}
+
+type accessKeyHolderKey struct{}
+
+// Wrap returns authMw with every call through it logged, including calls
+// it rejects, so failed attempts against management keys are visible.
+func (al *AccessLogger) Wrap(authMw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		inner := authMw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if h, ok := r.Context().Value(accessKeyHolderKey{}).(*accessKeyHolder); ok {
+				if id := auth.GetManagementKeyIDFromContext(r.Context()); id != uuid.Nil {
+					h.keyID = &id
+				}
+			}
+			next.ServeHTTP(w, r)
+		}))
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			holder := &accessKeyHolder{}
+			sw := &statusWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+			inner.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), accessKeyHolderKey{}, holder)))
+
+			var route string
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				route = rctx.RoutePattern()
+			}
+			al.Log(&store.AccessLogEntry{
+				ManagementKeyID: holder.keyID,
+				Timestamp:       start,
+				Method:          r.Method,
+				Path:            r.URL.Path,
+				Route:           route,
+				StatusCode:      sw.statusCode,
+				LatencyMS:       int(time.Since(start).Milliseconds()),
+				ClientIP:        auth.ClientIP(r, al.trustXFF),
+			})
+		})
+	}
+}
+
+func (al *AccessLogger) worker() {
+	defer al.wg.Done()
+
+	batch := make([]*store.AccessLogEntry, 0, 100)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := al.store.InsertAccessLogBatch(ctx, batch); err != nil {
+			log.Printf("access logger: batch insert failed, %d entries lost: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case entry := <-al.ch:
+			batch = append(batch, entry)
+			if len(batch) >= 100 {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+			if n := atomic.SwapInt64(&al.dropped, 0); n > 0 {
+				log.Printf("access logger: dropped %d access log entries", n)
+			}
+		case <-al.done:
+			for {
+				select {
+				case entry := <-al.ch:
+					batch = append(batch, entry)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// statusWriter captures the status code written to the response.
+type statusWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.statusCode = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush implements http.Flusher for streamed responses.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+type fakeAccessLogs struct {
+	mu      sync.Mutex
+	entries []*store.AccessLogEntry
+}
+
+func (f *fakeAccessLogs) InsertAccessLogBatch(ctx context.Context, entries []*store.AccessLogEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries = append(f.entries, entries...)
+	return nil
+}
+
+// rejectWithout stands in for the management auth middleware: requests
+// without an Authorization header get a 401.
+func rejectWithout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func TestAccessLoggerWrap(t *testing.T) {
+	f := &fakeAccessLogs{}
+	al := newAccessLogger(f, true, 10)
+
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(al.Wrap(rejectWithout))
+		r.Delete("/keys/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+
+	req := httptest.NewRequest(http.MethodDelete, "/keys/abc", nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.9, 203.0.113.7")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodDelete, "/keys/def", nil)
+	req.Header.Set("Authorization", "Bearer pxm_test")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	al.Close()
+
+	if len(f.entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(f.entries))
+	}
+	rejected, ok := f.entries[0], f.entries[1]
+	if rejected.StatusCode != http.StatusUnauthorized || rejected.ClientIP != "203.0.113.7" || rejected.ManagementKeyID != nil {
+		t.Errorf("rejected call logged as %+v", rejected)
+	}
+	if ok.StatusCode != http.StatusNoContent || ok.Path != "/keys/def" || ok.Route != "/keys/{id}" || ok.Method != http.MethodDelete {
+		t.Errorf("call logged as %+v", ok)
+	}
+}
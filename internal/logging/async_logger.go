@@ -2,7 +2,9 @@ package logging
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"math/rand/v2"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,18 +19,31 @@ type LogEntry struct {
 	Method             string
 	Path               string
 	Model              string
-	InputFormat        string // "anthropic" or "openai"
+	InputFormat        string // "anthropic", "openai" or "gemini"
 	UpstreamID         *uuid.UUID
 	StatusCode         int
 	LatencyMS          int
 	InputTokens        int
 	OutputTokens       int
+	ReasoningTokens    int // part of OutputTokens
 	CacheCreationTokens int
 	CacheReadTokens    int
 	Cost               float64
 	OverheadUS         int
+	ToolCalls          int
+	WebSearchRequests  int // server-side web searches, billed per use
+	Region             string // region of the upstream that served the request
+	CanaryID           *uuid.UUID
+	CanaryArm          string // stable or canary while a policy canary runs
+	UpstreamFormat     string
+	Translated         bool // converted between API formats on the way upstream
+	Stream             bool // the response was streamed to the client; not stored
+	Priority           string // effective x-pxbin-priority
 	ErrorMessage       string
+	ErrorCode          string // machine-readable cause, e.g. upstream_stall
 	RequestMetadata    map[string]interface{}
+	Payload            *store.LogPayload // captured request and response bodies; nil for none
+	AuditSample        *store.AuditSample // sampled for a quality audit; nil for none
 }
 
 // DroppedCounter is an interface for reporting dropped log metrics.
@@ -36,27 +51,110 @@ type DroppedCounter interface {
 	Add(float64)
 }
 
+// OverflowPolicy controls what Log does when the buffer is full.
+type OverflowPolicy string
+
+const (
+	// OverflowDrop discards entries that do not fit in the buffer.
+	OverflowDrop OverflowPolicy = "drop"
+	// OverflowBlock waits up to BlockTimeout for buffer space before dropping.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowSpill appends entries that do not fit to a local write-ahead
+	// log that is replayed once the database accepts inserts again.
+	OverflowSpill OverflowPolicy = "spill"
+	// OverflowSample admits only SampleRate of new entries that bill nothing
+	// once the buffer is past its high-water mark. Billable entries are
+	// always admitted, so the space above the mark is kept for them.
+	OverflowSample OverflowPolicy = "sample"
+)
+
+// ValidOverflowPolicy reports whether p is a known overflow policy.
+func ValidOverflowPolicy(p string) bool {
+	switch OverflowPolicy(p) {
+	case OverflowDrop, OverflowBlock, OverflowSpill, OverflowSample:
+		return true
+	}
+	return false
+}
+
+// AsyncLoggerOpts configures buffering and overflow behavior.
+type AsyncLoggerOpts struct {
+	BufferSize     int            // channel capacity (default 10000)
+	OverflowPolicy OverflowPolicy // default OverflowDrop
+	BlockTimeout   time.Duration  // max wait under OverflowBlock (default 50ms)
+	SpillDir       string         // WAL directory; required for OverflowSpill, optional otherwise
+	SampleRate     float64        // fraction admitted under OverflowSample (default 0.1)
+}
+
+func (o *AsyncLoggerOpts) withDefaults() AsyncLoggerOpts {
+	out := *o
+	if out.BufferSize <= 0 {
+		out.BufferSize = 10000
+	}
+	if out.OverflowPolicy == "" {
+		out.OverflowPolicy = OverflowDrop
+	}
+	if out.BlockTimeout <= 0 {
+		out.BlockTimeout = 50 * time.Millisecond
+	}
+	if out.SampleRate <= 0 || out.SampleRate > 1 {
+		out.SampleRate = 0.1
+	}
+	return out
+}
+
 type AsyncLogger struct {
 	ch             chan *LogEntry
-	store          *store.Store
+	store          store.Store
 	wg             sync.WaitGroup
 	done           chan struct{}
 	dropped        int64 // atomic counter
+	spilled        int64 // atomic counter
 	droppedCounter DroppedCounter
+	opts           AsyncLoggerOpts
+	highWater      int
+	spill          *spillWAL
+	nextReplay     time.Time // worker-only; replay backoff after a failure
+}
+
+func NewAsyncLogger(s store.Store, bufferSize int) *AsyncLogger {
+	// The drop policy needs no external resources, so this cannot fail.
+	al, _ := NewAsyncLoggerWithOpts(s, AsyncLoggerOpts{BufferSize: bufferSize})
+	return al
 }
 
-func NewAsyncLogger(s *store.Store, bufferSize int) *AsyncLogger {
-	if bufferSize <= 0 {
-		bufferSize = 10000
+// NewAsyncLoggerWithOpts creates an async logger with a configurable overflow
+// policy. Returns an error if the spill directory cannot be prepared.
+func NewAsyncLoggerWithOpts(s store.Store, opts AsyncLoggerOpts) (*AsyncLogger, error) {
+	opts = opts.withDefaults()
+	if !ValidOverflowPolicy(string(opts.OverflowPolicy)) {
+		return nil, fmt.Errorf("unknown log overflow policy %q", opts.OverflowPolicy)
 	}
+
 	al := &AsyncLogger{
-		ch:    make(chan *LogEntry, bufferSize),
-		store: s,
-		done:  make(chan struct{}),
+		ch:        make(chan *LogEntry, opts.BufferSize),
+		store:     s,
+		done:      make(chan struct{}),
+		opts:      opts,
+		highWater: opts.BufferSize * 3 / 4,
+	}
+	// Batches that fail to insert (e.g. while the database is down) are
+	// spilled to disk under every policy when a spill directory is
+	// available; only the spill policy requires one.
+	if opts.OverflowPolicy == OverflowSpill || opts.SpillDir != "" {
+		wal, err := openSpillWAL(opts.SpillDir)
+		if err != nil {
+			if opts.OverflowPolicy == OverflowSpill {
+				return nil, err
+			}
+			log.Printf("async logger: spill disabled, failed inserts will be dropped: %v", err)
+		} else {
+			al.spill = wal
+		}
 	}
 	al.wg.Add(1)
 	go al.worker()
-	return al
+	return al, nil
 }
 
 // SetDroppedCounter sets an optional metrics counter for dropped logs.
@@ -65,21 +163,67 @@ func (al *AsyncLogger) SetDroppedCounter(c DroppedCounter) {
 }
 
 func (al *AsyncLogger) Log(entry *LogEntry) {
+	if al.opts.OverflowPolicy == OverflowSample && !entry.billable() && len(al.ch) >= al.highWater && rand.Float64() >= al.opts.SampleRate {
+		atomic.AddInt64(&al.dropped, 1)
+		return
+	}
+
 	select {
 	case al.ch <- entry:
+		return
 	default:
-		// Channel full, drop entry
-		atomic.AddInt64(&al.dropped, 1)
 	}
+
+	switch al.opts.OverflowPolicy {
+	case OverflowBlock:
+		timer := time.NewTimer(al.opts.BlockTimeout)
+		defer timer.Stop()
+		select {
+		case al.ch <- entry:
+			return
+		case <-timer.C:
+		}
+	case OverflowSpill:
+		err := al.spill.Append(convertToStoreEntry(entry))
+		if err == nil {
+			atomic.AddInt64(&al.spilled, 1)
+			return
+		}
+		log.Printf("async logger: spill failed: %v", err)
+	}
+
+	// Channel full, drop entry
+	atomic.AddInt64(&al.dropped, 1)
+}
+
+// billable reports whether an entry records usage or a cost, and so counts
+// towards spend.
+func (e *LogEntry) billable() bool {
+	return e.Cost > 0 || e.InputTokens > 0 || e.OutputTokens > 0 || e.CacheCreationTokens > 0 || e.CacheReadTokens > 0
 }
 
 func (al *AsyncLogger) Dropped() int64 {
 	return atomic.LoadInt64(&al.dropped)
 }
 
+// SpillPending reports whether log entries are waiting on disk to be
+// replayed into the database.
+func (al *AsyncLogger) SpillPending() bool {
+	return al.spill != nil && al.spill.Pending()
+}
+
+// Spilled returns the number of entries written to the spill WAL since the
+// last report.
+func (al *AsyncLogger) Spilled() int64 {
+	return atomic.LoadInt64(&al.spilled)
+}
+
 func (al *AsyncLogger) Close() {
 	close(al.done)
 	al.wg.Wait()
+	if al.spill != nil {
+		al.spill.Close()
+	}
 }
 
 // worker reads from channel, batches entries, and inserts them.
@@ -98,6 +242,13 @@ func (al *AsyncLogger) worker() {
 		defer cancel()
 		if err := al.store.InsertLogBatch(ctx, batch); err != nil {
 			log.Printf("async logger: batch insert failed: %v", err)
+			if al.spill != nil {
+				if err := al.spill.Append(batch...); err != nil {
+					log.Printf("async logger: spill failed, %d entries lost: %v", len(batch), err)
+				} else {
+					atomic.AddInt64(&al.spilled, int64(len(batch)))
+				}
+			}
 		}
 		batch = batch[:0]
 	}
@@ -111,12 +262,16 @@ func (al *AsyncLogger) worker() {
 			}
 		case <-ticker.C:
 			flush()
+			al.replaySpill()
 			if newDropped := atomic.SwapInt64(&al.dropped, 0); newDropped > 0 {
 				log.Printf("async logger: dropped %d log entries", newDropped)
 				if al.droppedCounter != nil {
 					al.droppedCounter.Add(float64(newDropped))
 				}
 			}
+			if newSpilled := atomic.SwapInt64(&al.spilled, 0); newSpilled > 0 {
+				log.Printf("async logger: spilled %d log entries to disk", newSpilled)
+			}
 		case <-al.done:
 			// Drain remaining
 			for {
@@ -132,6 +287,25 @@ func (al *AsyncLogger) worker() {
 	}
 }
 
+// replaySpill drains the spill WAL into the database. It runs on the worker
+// goroutine so replay never races with batch inserts, and backs off for 10s
+// after a failed attempt so a down database isn't hammered every tick.
+func (al *AsyncLogger) replaySpill() {
+	if al.spill == nil || time.Now().Before(al.nextReplay) || !al.spill.Pending() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	n, err := al.spill.Replay(ctx, 100, al.store.InsertLogBatch)
+	if n > 0 {
+		log.Printf("async logger: replayed %d spilled log entries", n)
+	}
+	if err != nil {
+		log.Printf("async logger: spill replay stopped: %v", err)
+		al.nextReplay = time.Now().Add(10 * time.Second)
+	}
+}
+
 func convertToStoreEntry(e *LogEntry) *store.LogEntry {
 	return &store.LogEntry{
 		KeyID:              e.KeyID,
@@ -145,11 +319,23 @@ func convertToStoreEntry(e *LogEntry) *store.LogEntry {
 		LatencyMS:          e.LatencyMS,
 		InputTokens:        e.InputTokens,
 		OutputTokens:       e.OutputTokens,
+		ReasoningTokens:    e.ReasoningTokens,
 		CacheCreationTokens: e.CacheCreationTokens,
 		CacheReadTokens:    e.CacheReadTokens,
 		Cost:               e.Cost,
 		OverheadUS:         e.OverheadUS,
+		ToolCalls:          e.ToolCalls,
+		WebSearchRequests:  e.WebSearchRequests,
+		Region:             e.Region,
+		CanaryID:           e.CanaryID,
+		CanaryArm:          e.CanaryArm,
+		UpstreamFormat:     e.UpstreamFormat,
+		Translated:         e.Translated,
+		Priority:           e.Priority,
 		ErrorMessage:       e.ErrorMessage,
+		ErrorCode:          e.ErrorCode,
 		RequestMetadata:    e.RequestMetadata,
+		Payload:            e.Payload,
+		AuditSample:        e.AuditSample,
 	}
 }
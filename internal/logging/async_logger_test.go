@@ -0,0 +1,21 @@
+package logging
+
+import "testing"
+
+func TestSampleKeepsBillableEntries(t *testing.T) {
+	al := &AsyncLogger{
+		ch:        make(chan *LogEntry, 4),
+		highWater: 2,
+		opts:      AsyncLoggerOpts{OverflowPolicy: OverflowSample},
+	}
+	al.Log(&LogEntry{Model: "a"})
+	al.Log(&LogEntry{Model: "b"})
+
+	// Past the high-water mark, with a sample rate of 0, only entries
+	// that bill are admitted.
+	al.Log(&LogEntry{Model: "free", StatusCode: 401})
+	al.Log(&LogEntry{Model: "paid", InputTokens: 10, Cost: 0.01})
+	if len(al.ch) != 3 || al.Dropped() != 1 {
+		t.Fatalf("expected the billable entry admitted and the other dropped, got %d queued, %d dropped", len(al.ch), al.Dropped())
+	}
+}
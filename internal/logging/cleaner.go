@@ -10,21 +10,31 @@ import (
 )
 
 type LogCleaner struct {
-	store     *store.Store
-	retention time.Duration
-	wg        sync.WaitGroup
-	done      chan struct{}
+	store            store.Store
+	retention        time.Duration
+	accessRetention  time.Duration // access_logs; 0 keeps them forever
+	payloadRetention time.Duration // captured bodies; 0 keeps them as long as their logs
+	auditRetention   time.Duration // audit samples; 0 keeps them forever
+	wg               sync.WaitGroup
+	done             chan struct{}
 }
 
-func NewLogCleaner(s *store.Store, retentionDays int) *LogCleaner {
+// NewLogCleaner deletes request logs older than retentionDays, management
+// access logs older than accessRetentionDays, captured request and
+// response bodies older than payloadRetentionDays and audit samples older
+// than auditRetentionDays. 0 disables any of them.
+func NewLogCleaner(s store.Store, retentionDays, accessRetentionDays, payloadRetentionDays, auditRetentionDays int) *LogCleaner {
 	lc := &LogCleaner{
 		store: s,
 		done:  make(chan struct{}),
 	}
-	if retentionDays <= 0 {
+	if retentionDays <= 0 && accessRetentionDays <= 0 && payloadRetentionDays <= 0 && auditRetentionDays <= 0 {
 		return lc
 	}
-	lc.retention = time.Duration(retentionDays) * 24 * time.Hour
+	lc.retention = time.Duration(max(retentionDays, 0)) * 24 * time.Hour
+	lc.accessRetention = time.Duration(max(accessRetentionDays, 0)) * 24 * time.Hour
+	lc.payloadRetention = time.Duration(max(payloadRetentionDays, 0)) * 24 * time.Hour
+	lc.auditRetention = time.Duration(max(auditRetentionDays, 0)) * 24 * time.Hour
 	lc.wg.Add(1)
 	go lc.worker()
 	return lc
@@ -55,6 +65,21 @@ func (lc *LogCleaner) worker() {
 }
 
 func (lc *LogCleaner) cleanup() {
+	if lc.retention > 0 {
+		lc.cleanupRequestLogs()
+	}
+	if lc.accessRetention > 0 {
+		lc.cleanupAccessLogs()
+	}
+	if lc.payloadRetention > 0 {
+		lc.cleanupPayloads()
+	}
+	if lc.auditRetention > 0 {
+		lc.cleanupAuditSamples()
+	}
+}
+
+func (lc *LogCleaner) cleanupRequestLogs() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -68,3 +93,48 @@ func (lc *LogCleaner) cleanup() {
 		log.Printf("log cleaner: deleted %d logs older than %d days", deleted, int(lc.retention.Hours()/24))
 	}
 }
+
+func (lc *LogCleaner) cleanupAccessLogs() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cutoff := time.Now().Add(-lc.accessRetention)
+	deleted, err := lc.store.DeleteOldAccessLogs(ctx, cutoff)
+	if err != nil {
+		log.Printf("log cleaner: failed to delete old access logs: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("log cleaner: deleted %d access logs older than %d days", deleted, int(lc.accessRetention.Hours()/24))
+	}
+}
+
+func (lc *LogCleaner) cleanupPayloads() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cutoff := time.Now().Add(-lc.payloadRetention)
+	deleted, err := lc.store.DeleteOldPayloads(ctx, cutoff)
+	if err != nil {
+		log.Printf("log cleaner: failed to delete old payloads: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("log cleaner: deleted %d payloads older than %d days", deleted, int(lc.payloadRetention.Hours()/24))
+	}
+}
+
+func (lc *LogCleaner) cleanupAuditSamples() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cutoff := time.Now().Add(-lc.auditRetention)
+	deleted, err := lc.store.DeleteOldAuditSamples(ctx, cutoff)
+	if err != nil {
+		log.Printf("log cleaner: failed to delete old audit samples: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("log cleaner: deleted %d audit samples older than %d days", deleted, int(lc.auditRetention.Hours()/24))
+	}
+}
@@ -0,0 +1,263 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+const (
+	spillFileName   = "request_logs.wal"
+	replayFileName  = "request_logs.wal.replay"
+	corruptFileName = "request_logs.wal.corrupt"
+)
+
+// spillWAL is an append-only, newline-delimited JSON file of log entries
+// that could not be delivered to the database. Entries are appended while
+// the buffer is full or the database is unavailable and are replayed in
+// order once inserts succeed again.
+type spillWAL struct {
+	mu   sync.Mutex
+	dir  string
+	f    *os.File
+	w    *bufio.Writer
+	size int64 // entries appended since the last replay rotation
+}
+
+func openSpillWAL(dir string) (*spillWAL, error) {
+	if dir == "" {
+		return nil, errors.New("spill directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create spill dir: %w", err)
+	}
+	return &spillWAL{dir: dir}, nil
+}
+
+// Append writes entries to the WAL and syncs the file so spilled entries
+// survive a crash.
+func (s *spillWAL) Append(entries ...*store.LogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		f, err := os.OpenFile(filepath.Join(s.dir, spillFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("open spill file: %w", err)
+		}
+		s.f = f
+		s.w = bufio.NewWriter(f)
+	}
+
+	enc := json.NewEncoder(s.w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("encode spill entry: %w", err)
+		}
+		s.size++
+	}
+	if err := s.w.Flush(); err != nil {
+		return fmt.Errorf("write spill file: %w", err)
+	}
+	return s.f.Sync()
+}
+
+// Pending reports whether there are spilled entries waiting to be replayed.
+func (s *spillWAL) Pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size > 0 {
+		return true
+	}
+	for _, name := range []string{spillFileName, replayFileName} {
+		if fi, err := os.Stat(filepath.Join(s.dir, name)); err == nil && fi.Size() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// rotate moves the active WAL aside so it can be replayed while new spills
+// go to a fresh file. An unfinished replay file from a previous attempt is
+// kept as-is and replayed first.
+func (s *spillWAL) rotate() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	replayPath := filepath.Join(s.dir, replayFileName)
+	if _, err := os.Stat(replayPath); err == nil {
+		return replayPath, nil
+	}
+
+	if s.f != nil {
+		s.w.Flush()
+		s.f.Close()
+		s.f = nil
+		s.w = nil
+	}
+	s.size = 0
+
+	if err := os.Rename(filepath.Join(s.dir, spillFileName), replayPath); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("rotate spill file: %w", err)
+	}
+	return replayPath, nil
+}
+
+// Replay inserts spilled entries in batches using insert. Entries that were
+// inserted are removed from the WAL; on the first failure the remainder is
+// kept for the next attempt. A line that does not decode is moved to the
+// corrupt file and replay carries on past it, unless it is the last line,
+// which is taken to be a write torn by a crash and dropped. Returns the
+// number of entries replayed.
+func (s *spillWAL) Replay(ctx context.Context, batchSize int, insert func(context.Context, []*store.LogEntry) error) (int, error) {
+	path, err := s.rotate()
+	if err != nil || path == "" {
+		return 0, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("open replay file: %w", err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	replayed, corrupt := 0, 0
+	batch := make([]*store.LogEntry, 0, batchSize)
+	for eof := false; !eof; {
+		batch = batch[:0]
+		for len(batch) < batchSize && !eof {
+			line, err := br.ReadBytes('\n')
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return replayed, fmt.Errorf("read replay file: %w", err)
+			}
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var e store.LogEntry
+			if err := json.Unmarshal(line, &e); err != nil {
+				if eof {
+					break
+				}
+				if qerr := s.quarantine(line); qerr != nil {
+					// Keep the line and everything after it for the next
+					// attempt, along with the entries not yet inserted.
+					if rerr := s.keepRemainder(path, batch, io.MultiReader(bytes.NewReader(line), br)); rerr != nil {
+						return replayed, rerr
+					}
+					return replayed, qerr
+				}
+				corrupt++
+				continue
+			}
+			batch = append(batch, &e)
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		if err := insert(ctx, batch); err != nil {
+			if rerr := s.keepRemainder(path, batch, br); rerr != nil {
+				return replayed, rerr
+			}
+			return replayed, err
+		}
+		replayed += len(batch)
+	}
+
+	f.Close()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return replayed, fmt.Errorf("remove replay file: %w", err)
+	}
+	if corrupt > 0 {
+		return replayed, fmt.Errorf("moved %d undecodable spilled entries to %s", corrupt, filepath.Join(s.dir, corruptFileName))
+	}
+	return replayed, nil
+}
+
+// quarantine appends an undecodable line to the corrupt file, where it is
+// kept for inspection instead of being dropped.
+func (s *spillWAL) quarantine(line []byte) error {
+	f, err := os.OpenFile(filepath.Join(s.dir, corruptFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open corrupt spill file: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("write corrupt spill file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync corrupt spill file: %w", err)
+	}
+	return f.Close()
+}
+
+// keepRemainder rewrites the replay file so it only contains the failed
+// batch and everything after it, preventing duplicate inserts on retry. The
+// file is only replaced once the remainder is safely on disk; on any error
+// the original is left as it was.
+func (s *spillWAL) keepRemainder(path string, failed []*store.LogEntry, rest io.Reader) error {
+	tmpPath := path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create replay remainder: %w", err)
+	}
+	if err := writeRemainder(tmp, failed, rest); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("write replay remainder: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("write replay remainder: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("replace replay file: %w", err)
+	}
+	return nil
+}
+
+func writeRemainder(f *os.File, failed []*store.LogEntry, rest io.Reader) error {
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range failed {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	if _, err := io.Copy(w, rest); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (s *spillWAL) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	s.w.Flush()
+	err := s.f.Close()
+	s.f = nil
+	s.w = nil
+	return err
+}
@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// collect returns an insert func recording the models it was given, which
+// fails with failErr once failAfter entries are in.
+func collect(models *[]string, failAfter int, failErr error) func(context.Context, []*store.LogEntry) error {
+	return func(_ context.Context, batch []*store.LogEntry) error {
+		if failAfter >= 0 && len(*models)+len(batch) > failAfter {
+			return failErr
+		}
+		for _, e := range batch {
+			*models = append(*models, e.Model)
+		}
+		return nil
+	}
+}
+
+func TestSpillReplayCorruptLine(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := openSpillWAL(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.Append(&store.LogEntry{Model: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+	// A corrupt line mid-file, a good entry after it, and a torn tail.
+	f, err := os.OpenFile(filepath.Join(dir, spillFileName), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("{not json\n" + `{"Model":"b"}` + "\n" + `{"Model":"c`)
+	f.Close()
+
+	var models []string
+	n, err := wal.Replay(context.Background(), 100, collect(&models, -1, nil))
+	if n != 2 || strings.Join(models, ",") != "a,b" {
+		t.Fatalf("expected a and b replayed, got %d %v", n, models)
+	}
+	if err == nil || !strings.Contains(err.Error(), "1 undecodable") {
+		t.Fatalf("expected the corrupt line to be reported, got %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, corruptFileName)); string(data) != "{not json\n" {
+		t.Fatalf("expected the corrupt line quarantined, got %q", data)
+	}
+	if wal.Pending() {
+		t.Fatal("expected nothing left to replay")
+	}
+}
+
+func TestSpillReplayKeepsRemainder(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := openSpillWAL(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []string{"a", "b", "c", "d", "e"} {
+		if err := wal.Append(&store.LogEntry{Model: m}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The second batch fails; only it and what follows are kept.
+	down := errors.New("db down")
+	var models []string
+	if n, err := wal.Replay(context.Background(), 2, collect(&models, 2, down)); n != 2 || !errors.Is(err, down) {
+		t.Fatalf("expected 2 replayed then the insert error, got %d %v", n, err)
+	}
+	if n, err := wal.Replay(context.Background(), 2, collect(&models, -1, nil)); n != 3 || err != nil {
+		t.Fatalf("expected the remaining 3 replayed, got %d %v", n, err)
+	}
+	if got := strings.Join(models, ","); got != "a,b,c,d,e" {
+		t.Fatalf("expected every entry once, got %s", got)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("no space left on device") }
+
+func TestSpillKeepRemainderFailureKeepsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, replayFileName)
+	if err := os.WriteFile(path, []byte(`{"Model":"a"}`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	wal := &spillWAL{dir: dir}
+	if err := wal.keepRemainder(path, []*store.LogEntry{{Model: "a"}}, failingReader{}); err == nil {
+		t.Fatal("expected the write error to be returned")
+	}
+	if data, _ := os.ReadFile(path); string(data) != `{"Model":"a"}`+"\n" {
+		t.Fatalf("expected the replay file untouched, got %q", data)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("expected the temp file removed, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+// Package loopguard keeps a misconfigured pxbin from proxying to itself.
+// Upstreams whose base_url resolves to this instance are rejected when they
+// are saved, and every proxied request carries an X-Pxbin-Hop count that
+// ingress checks, so a loop through other hosts or instances still ends.
+package loopguard
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Header counts the pxbin instances a request has passed through.
+const Header = "X-Pxbin-Hop"
+
+type hopKey struct{}
+
+// Middleware rejects requests that have already passed through maxHops
+// pxbin instances with 508 Loop Detected, and records the count for
+// NextHop.
+func Middleware(maxHops int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hops, _ := strconv.Atoi(r.Header.Get(Header))
+			if hops < 0 {
+				hops = 0
+			}
+			if hops >= maxHops {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusLoopDetected)
+				w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"Request passed through too many pxbin instances; check upstream base_url for a proxy loop"}}`))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), hopKey{}, hops)))
+		})
+	}
+}
+
+// NextHop returns the X-Pxbin-Hop value for a request made to an upstream
+// while serving ctx.
+func NextHop(ctx context.Context) string {
+	hops, _ := ctx.Value(hopKey{}).(int)
+	return strconv.Itoa(hops + 1)
+}
+
+// Self recognises base URLs that point back at this instance.
+type Self struct {
+	port       string              // listen port
+	hosts      map[string]bool     // names and addresses that reach the listener
+	advertised map[string][]string // advertised host -> ports; empty for any
+}
+
+// NewSelf describes the instance listening on listenAddr and reachable
+// from outside as advertised hosts ("llm.example.com" or
+// "llm.example.com:8443").
+func NewSelf(listenAddr string, advertised []string) *Self {
+	s := &Self{
+		hosts:      make(map[string]bool),
+		advertised: make(map[string][]string),
+	}
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err == nil {
+		s.port = port
+		ip := net.ParseIP(host)
+		if host == "" || (ip != nil && ip.IsUnspecified()) {
+			s.addLocalHosts()
+		} else {
+			s.hosts[strings.ToLower(host)] = true
+		}
+	}
+	for _, a := range advertised {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a == "" {
+			continue
+		}
+		if h, p, err := net.SplitHostPort(a); err == nil {
+			s.advertised[h] = append(s.advertised[h], p)
+		} else if _, ok := s.advertised[a]; !ok {
+			s.advertised[a] = nil
+		}
+	}
+	return s
+}
+
+// addLocalHosts adds the names and addresses of this machine, for a
+// listener bound to every interface.
+func (s *Self) addLocalHosts() {
+	if name, err := os.Hostname(); err == nil {
+		s.hosts[strings.ToLower(name)] = true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok {
+			s.hosts[n.IP.String()] = true
+		}
+	}
+}
+
+// Matches reports whether baseURL reaches this instance. Loopback
+// addresses on the listen port always match.
+func (s *Self) Matches(baseURL string) bool {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	if ports, ok := s.advertised[host]; ok {
+		if len(ports) == 0 {
+			return true
+		}
+		for _, p := range ports {
+			if p == port {
+				return true
+			}
+		}
+	}
+	if port != s.port {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback() || ip.IsUnspecified() || s.hosts[ip.String()]
+	}
+	return host == "localhost" || s.hosts[host]
+}
@@ -0,0 +1,71 @@
+package loopguard
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSelfMatches(t *testing.T) {
+	s := NewSelf(":8080", []string{"llm.example.com", "gw.example.com:8443"})
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://localhost:8080", true},
+		{"http://127.0.0.1:8080/v1", true},
+		{"http://[::1]:8080", true},
+		{"http://0.0.0.0:8080", true},
+		{"http://localhost:9090", false},
+		{"https://llm.example.com", true},
+		{"https://LLM.example.com:8443/v1", true},
+		{"https://gw.example.com:8443", true},
+		{"https://gw.example.com", false},
+		{"https://api.openai.com/v1", false},
+		{"not a url", false},
+	}
+	for _, tt := range tests {
+		if got := s.Matches(tt.url); got != tt.want {
+			t.Errorf("Matches(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+
+	// A listener bound to one address only matches that address.
+	s = NewSelf("10.0.0.5:8080", nil)
+	if !s.Matches("http://10.0.0.5:8080") || s.Matches("http://10.0.0.6:8080") {
+		t.Error("bound listener address not matched exactly")
+	}
+}
+
+func TestMiddlewareCountsHops(t *testing.T) {
+	var next string
+	h := Middleware(3)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next = NextHop(r.Context())
+	}))
+
+	for hop, want := range map[string]string{"": "1", "0": "1", "2": "3", "junk": "1"} {
+		next = ""
+		req := httptest.NewRequest("POST", "/v1/messages", nil)
+		if hop != "" {
+			req.Header.Set(Header, hop)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || next != want {
+			t.Errorf("hop %q: status %d, next hop %q, want %q", hop, rec.Code, next, want)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/v1/messages", nil)
+	req.Header.Set(Header, "3")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusLoopDetected {
+		t.Fatalf("status = %d, want 508", rec.Code)
+	}
+
+	if got := NextHop(context.Background()); got != "1" {
+		t.Errorf("NextHop without ingress = %q", got)
+	}
+}
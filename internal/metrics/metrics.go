@@ -12,13 +12,24 @@ type Metrics struct {
 	Registry            *prometheus.Registry
 	RequestsTotal       *prometheus.CounterVec
 	RequestDuration     *prometheus.HistogramVec
-	OverheadUS          prometheus.Histogram
+	OverheadUS          *prometheus.HistogramVec
 	ActiveStreams        prometheus.Gauge
 	DroppedLogsTotal    prometheus.Counter
-	CircuitBreakerState *prometheus.GaugeVec
 	RateLimitedTotal    prometheus.Counter
+	SlowQueriesTotal    prometheus.Counter
+	KeyEventsTotal      *prometheus.CounterVec
+
+	// Per-upstream metrics, fed by ObserveUpstream.
+	UpstreamRequestsTotal *prometheus.CounterVec
+	UpstreamDuration      *prometheus.HistogramVec
+	StreamDuration        *prometheus.HistogramVec
+	TokensTotal           *prometheus.CounterVec
 }
 
+// upstreamDurationBuckets span quick completions to long extended thinking
+// streams.
+var upstreamDurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
 // New creates and registers a new Metrics instance using a dedicated registry.
 func New() *Metrics {
 	reg := prometheus.NewRegistry()
@@ -37,11 +48,11 @@ func New() *Metrics {
 			Buckets: prometheus.DefBuckets,
 		}, []string{"method", "path"}),
 
-		OverheadUS: prometheus.NewHistogram(prometheus.HistogramOpts{
+		OverheadUS: prometheus.NewHistogramVec(prometheus.HistogramOpts{
 			Name:    "proxy_overhead_microseconds",
-			Help:    "Proxy processing overhead in microseconds.",
-			Buckets: []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000},
-		}),
+			Help:    "Proxy processing overhead in microseconds, including translation between API formats.",
+			Buckets: []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000},
+		}, []string{"upstream", "model", "translated"}),
 
 		ActiveStreams: prometheus.NewGauge(prometheus.GaugeOpts{
 			Name: "proxy_active_streams",
@@ -53,15 +64,42 @@ func New() *Metrics {
 			Help: "Total number of dropped log entries due to full buffer.",
 		}),
 
-		CircuitBreakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Name: "proxy_circuit_breaker_state",
-			Help: "Circuit breaker state (0=closed, 1=open, 2=half-open).",
-		}, []string{"upstream"}),
-
 		RateLimitedTotal: prometheus.NewCounter(prometheus.CounterOpts{
 			Name: "proxy_rate_limited_total",
 			Help: "Total number of rate-limited requests.",
 		}),
+
+		SlowQueriesTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "proxy_db_slow_queries_total",
+			Help: "Total number of database queries slower than slow_query_ms.",
+		}),
+
+		KeyEventsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "proxy_key_events_total",
+			Help: "Total number of key lifecycle and budget events emitted.",
+		}, []string{"type"}),
+
+		UpstreamRequestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "proxy_upstream_requests_total",
+			Help: "Total number of requests served by each upstream, by status code.",
+		}, []string{"upstream", "model", "status_code"}),
+
+		UpstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "proxy_upstream_request_duration_seconds",
+			Help:    "Duration of requests served by each upstream in seconds, until the response was complete.",
+			Buckets: upstreamDurationBuckets,
+		}, []string{"upstream", "model"}),
+
+		StreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "proxy_upstream_stream_duration_seconds",
+			Help:    "Duration of streamed responses in seconds.",
+			Buckets: upstreamDurationBuckets,
+		}, []string{"upstream", "model"}),
+
+		TokensTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "proxy_upstream_tokens_total",
+			Help: "Total number of tokens sent to (in) and generated by (out) each upstream.",
+		}, []string{"upstream", "model", "direction"}),
 	}
 
 	reg.MustRegister(
@@ -70,8 +108,13 @@ func New() *Metrics {
 		m.OverheadUS,
 		m.ActiveStreams,
 		m.DroppedLogsTotal,
-		m.CircuitBreakerState,
 		m.RateLimitedTotal,
+		m.SlowQueriesTotal,
+		m.KeyEventsTotal,
+		m.UpstreamRequestsTotal,
+		m.UpstreamDuration,
+		m.StreamDuration,
+		m.TokensTotal,
 	)
 
 	return m
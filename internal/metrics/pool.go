@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolStat is the subset of *pgxpool.Stat the collector reads.
+type poolStat interface {
+	AcquireCount() int64
+	AcquireDuration() time.Duration
+	EmptyAcquireCount() int64
+	CanceledAcquireCount() int64
+	AcquiredConns() int32
+	IdleConns() int32
+	ConstructingConns() int32
+	TotalConns() int32
+	MaxConns() int32
+}
+
+// poolCollector exports database connection pool statistics, read from the
+// pool at scrape time.
+type poolCollector struct {
+	stat func() poolStat
+
+	acquireCount         *prometheus.Desc
+	acquireWaitSeconds   *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+	acquiredConns        *prometheus.Desc
+	idleConns            *prometheus.Desc
+	constructingConns    *prometheus.Desc
+	totalConns           *prometheus.Desc
+	maxConns             *prometheus.Desc
+}
+
+func newPoolCollector(stat func() poolStat) *poolCollector {
+	return &poolCollector{
+		stat: stat,
+
+		acquireCount: prometheus.NewDesc("proxy_db_pool_acquire_total",
+			"Total number of connections acquired from the pool.", nil, nil),
+		acquireWaitSeconds: prometheus.NewDesc("proxy_db_pool_acquire_wait_seconds_total",
+			"Total time spent acquiring connections from the pool, in seconds.", nil, nil),
+		emptyAcquireCount: prometheus.NewDesc("proxy_db_pool_empty_acquire_total",
+			"Total number of acquires that had to wait because no idle connection was available.", nil, nil),
+		canceledAcquireCount: prometheus.NewDesc("proxy_db_pool_canceled_acquire_total",
+			"Total number of acquires canceled by their context.", nil, nil),
+		acquiredConns: prometheus.NewDesc("proxy_db_pool_acquired_conns",
+			"Number of connections currently in use.", nil, nil),
+		idleConns: prometheus.NewDesc("proxy_db_pool_idle_conns",
+			"Number of idle connections in the pool.", nil, nil),
+		constructingConns: prometheus.NewDesc("proxy_db_pool_constructing_conns",
+			"Number of connections being opened.", nil, nil),
+		totalConns: prometheus.NewDesc("proxy_db_pool_total_conns",
+			"Total number of connections in the pool.", nil, nil),
+		maxConns: prometheus.NewDesc("proxy_db_pool_max_conns",
+			"Maximum size of the pool.", nil, nil),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquireCount
+	ch <- c.acquireWaitSeconds
+	ch <- c.emptyAcquireCount
+	ch <- c.canceledAcquireCount
+	ch <- c.acquiredConns
+	ch <- c.idleConns
+	ch <- c.constructingConns
+	ch <- c.totalConns
+	ch <- c.maxConns
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stat()
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireWaitSeconds, prometheus.CounterValue, s.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquireCount, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquireCount, prometheus.CounterValue, float64(s.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.constructingConns, prometheus.GaugeValue, float64(s.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(s.MaxConns()))
+}
+
+// RegisterPool exports the pool's statistics as proxy_db_pool_* metrics.
+func (m *Metrics) RegisterPool(pool *pgxpool.Pool) {
+	m.Registry.MustRegister(newPoolCollector(func() poolStat { return pool.Stat() }))
+}
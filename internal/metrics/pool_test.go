@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type fakePoolStat struct{}
+
+func (fakePoolStat) AcquireCount() int64            { return 42 }
+func (fakePoolStat) AcquireDuration() time.Duration { return 1500 * time.Millisecond }
+func (fakePoolStat) EmptyAcquireCount() int64       { return 3 }
+func (fakePoolStat) CanceledAcquireCount() int64    { return 1 }
+func (fakePoolStat) AcquiredConns() int32           { return 4 }
+func (fakePoolStat) IdleConns() int32               { return 6 }
+func (fakePoolStat) ConstructingConns() int32       { return 0 }
+func (fakePoolStat) TotalConns() int32              { return 10 }
+func (fakePoolStat) MaxConns() int32                { return 25 }
+
+func TestPoolCollector(t *testing.T) {
+	scrapes := 0
+	c := newPoolCollector(func() poolStat {
+		scrapes++
+		return fakePoolStat{}
+	})
+
+	descs := make(chan *prometheus.Desc, 16)
+	c.Describe(descs)
+	close(descs)
+
+	ch := make(chan prometheus.Metric, 16)
+	c.Collect(ch)
+	close(ch)
+
+	if len(descs) != 9 || len(ch) != 9 {
+		t.Fatalf("expected 9 described and collected metrics, got %d and %d", len(descs), len(ch))
+	}
+	if scrapes != 1 {
+		t.Fatalf("expected one stat read per scrape, got %d", scrapes)
+	}
+
+	var first dto.Metric
+	if err := (<-ch).Write(&first); err != nil {
+		t.Fatal(err)
+	}
+	if first.GetCounter().GetValue() != 42 {
+		t.Fatalf("expected acquire count 42, got %v", first.GetCounter().GetValue())
+	}
+	var wait dto.Metric
+	(<-ch).Write(&wait)
+	if wait.GetCounter().GetValue() != 1.5 {
+		t.Fatalf("expected 1.5s acquire wait, got %v", wait.GetCounter().GetValue())
+	}
+}
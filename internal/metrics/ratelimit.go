@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sertdev/pxbin/internal/ratelimit"
+)
+
+// topRejectedKeys is how many keys get their own rejection gauge, bounding
+// the label cardinality.
+const topRejectedKeys = 10
+
+// rateLimitCollector exports the rate limiter's bucket state, read at
+// scrape time. Rejections are counted by proxy_rate_limited_total.
+type rateLimitCollector struct {
+	limiter ratelimit.Limiter
+
+	allowed     *prometheus.Desc
+	keys        *prometheus.Desc
+	emptyKeys   *prometheus.Desc
+	rps         *prometheus.Desc
+	burst       *prometheus.Desc
+	keyRejected *prometheus.Desc
+}
+
+func newRateLimitCollector(l ratelimit.Limiter) *rateLimitCollector {
+	return &rateLimitCollector{
+		limiter: l,
+
+		allowed: prometheus.NewDesc("proxy_ratelimit_allowed_total",
+			"Total number of requests admitted by the rate limiter.", nil, nil),
+		keys: prometheus.NewDesc("proxy_ratelimit_keys",
+			"Number of keys with a live token bucket.", nil, nil),
+		emptyKeys: prometheus.NewDesc("proxy_ratelimit_empty_keys",
+			"Number of keys with no tokens left.", nil, nil),
+		rps: prometheus.NewDesc("proxy_ratelimit_rps",
+			"Configured token refill rate per key (rate_limit_rps).", nil, nil),
+		burst: prometheus.NewDesc("proxy_ratelimit_burst",
+			"Configured bucket size per key (rate_limit_burst).", nil, nil),
+		keyRejected: prometheus.NewDesc("proxy_ratelimit_key_rejected",
+			"Rejections over the bucket's lifetime for the most rejected keys.", []string{"key_id"}, nil),
+	}
+}
+
+func (c *rateLimitCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.allowed
+	ch <- c.keys
+	ch <- c.emptyKeys
+	ch <- c.rps
+	ch <- c.burst
+	ch <- c.keyRejected
+}
+
+func (c *rateLimitCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.limiter.Stats()
+	ch <- prometheus.MustNewConstMetric(c.allowed, prometheus.CounterValue, float64(s.Allowed))
+	ch <- prometheus.MustNewConstMetric(c.keys, prometheus.GaugeValue, float64(s.Keys))
+	ch <- prometheus.MustNewConstMetric(c.emptyKeys, prometheus.GaugeValue, float64(s.Empty))
+	ch <- prometheus.MustNewConstMetric(c.rps, prometheus.GaugeValue, s.RPS)
+	ch <- prometheus.MustNewConstMetric(c.burst, prometheus.GaugeValue, float64(s.Burst))
+
+	for i, st := range c.limiter.Standings() {
+		if i == topRejectedKeys || st.Rejected == 0 {
+			break
+		}
+		ch <- prometheus.MustNewConstMetric(c.keyRejected, prometheus.GaugeValue, float64(st.Rejected), st.Key)
+	}
+}
+
+// RegisterRateLimiter exports the limiter's state as proxy_ratelimit_*
+// metrics and counts its rejections in RateLimitedTotal.
+func (m *Metrics) RegisterRateLimiter(l ratelimit.Limiter) {
+	l.SetRejectedCounter(m.RateLimitedTotal)
+	m.Registry.MustRegister(newRateLimitCollector(l))
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sertdev/pxbin/internal/ratelimit"
+)
+
+func TestRateLimitCollector(t *testing.T) {
+	m := New()
+	l := ratelimit.NewMemoryLimiter(0.001, 2)
+	defer l.Close()
+	m.RegisterRateLimiter(l)
+
+	for range 5 {
+		l.Allow("busy")
+	}
+	l.Allow("quiet")
+
+	var rejected dto.Metric
+	m.RateLimitedTotal.Write(&rejected)
+	if rejected.GetCounter().GetValue() != 3 {
+		t.Fatalf("expected 3 rejections counted, got %v", rejected.GetCounter().GetValue())
+	}
+
+	c := newRateLimitCollector(l)
+	ch := make(chan prometheus.Metric, 16)
+	c.Collect(ch)
+	close(ch)
+	// allowed, keys, empty keys, rps, burst, and one key with rejections
+	if len(ch) != 6 {
+		t.Fatalf("expected 6 metrics, got %d", len(ch))
+	}
+	var allowed dto.Metric
+	(<-ch).Write(&allowed)
+	if allowed.GetCounter().GetValue() != 3 {
+		t.Fatalf("expected 3 allowed, got %v", allowed.GetCounter().GetValue())
+	}
+	var last prometheus.Metric
+	for metric := range ch {
+		last = metric
+	}
+	if last.Desc() != c.keyRejected {
+		t.Fatalf("expected a per-key rejection gauge last, got %v", last.Desc())
+	}
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// TransportErrorCounter counts transient upstream transport errors in
+// proxy_upstream_transport_errors_total, apart from upstream 5xx
+// responses, which are counted by status in proxy_requests_total.
+type TransportErrorCounter struct {
+	vec *prometheus.CounterVec
+}
+
+// Inc counts one error of kind; retried reports whether the request was
+// sent again after it.
+func (c *TransportErrorCounter) Inc(kind string, retried bool) {
+	outcome := "failed"
+	if retried {
+		outcome = "retried"
+	}
+	c.vec.WithLabelValues(kind, outcome).Inc()
+}
+
+// NewTransportErrorCounter registers proxy_upstream_transport_errors_total.
+func (m *Metrics) NewTransportErrorCounter() *TransportErrorCounter {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_upstream_transport_errors_total",
+		Help: "Transient upstream transport errors (goaway, connection_reset, eof), by whether the request was retried.",
+	}, []string{"kind", "outcome"})
+	m.Registry.MustRegister(vec)
+	return &TransportErrorCounter{vec: vec}
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sertdev/pxbin/internal/logging"
+	"github.com/sertdev/pxbin/internal/resilience"
+)
+
+// ObserveUpstream records a request served by an upstream from its request
+// log entry: its status, duration and tokens, its stream duration if it was
+// streamed, and the proxy's overhead. Upstreams are labelled by ID.
+func (m *Metrics) ObserveUpstream(e *logging.LogEntry) {
+	if e.UpstreamID == nil {
+		return
+	}
+	upstream := e.UpstreamID.String()
+	duration := (time.Duration(e.LatencyMS) * time.Millisecond).Seconds()
+
+	m.UpstreamRequestsTotal.WithLabelValues(upstream, e.Model, strconv.Itoa(e.StatusCode)).Inc()
+	m.UpstreamDuration.WithLabelValues(upstream, e.Model).Observe(duration)
+	if e.Stream {
+		m.StreamDuration.WithLabelValues(upstream, e.Model).Observe(duration)
+	}
+	if e.InputTokens > 0 {
+		m.TokensTotal.WithLabelValues(upstream, e.Model, "in").Add(float64(e.InputTokens))
+	}
+	if e.OutputTokens > 0 {
+		m.TokensTotal.WithLabelValues(upstream, e.Model, "out").Add(float64(e.OutputTokens))
+	}
+	if e.OverheadUS > 0 {
+		m.OverheadUS.WithLabelValues(upstream, e.Model, strconv.FormatBool(e.Translated)).Observe(float64(e.OverheadUS))
+	}
+}
+
+// breakerCollector exports the state of every upstream's circuit breaker,
+// read at scrape time.
+type breakerCollector struct {
+	states func() map[uuid.UUID]resilience.State
+	state  *prometheus.Desc
+}
+
+func (c *breakerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.state
+}
+
+func (c *breakerCollector) Collect(ch chan<- prometheus.Metric) {
+	for id, st := range c.states() {
+		ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, float64(st), id.String())
+	}
+}
+
+// RegisterCircuitBreakers exports the states returned by states as
+// proxy_circuit_breaker_state.
+func (m *Metrics) RegisterCircuitBreakers(states func() map[uuid.UUID]resilience.State) {
+	m.Registry.MustRegister(&breakerCollector{
+		states: states,
+		state: prometheus.NewDesc("proxy_circuit_breaker_state",
+			"Circuit breaker state of each upstream (0=closed, 1=open, 2=half-open).", []string{"upstream"}, nil),
+	})
+}
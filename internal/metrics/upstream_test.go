@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sertdev/pxbin/internal/logging"
+	"github.com/sertdev/pxbin/internal/resilience"
+)
+
+func TestObserveUpstream(t *testing.T) {
+	m := New()
+	id := uuid.New()
+	up := id.String()
+	m.ObserveUpstream(&logging.LogEntry{UpstreamID: &id, Model: "gpt-x", StatusCode: 200, LatencyMS: 1500, InputTokens: 10, OutputTokens: 4, OverheadUS: 80, Translated: true, Stream: true})
+	m.ObserveUpstream(&logging.LogEntry{UpstreamID: &id, Model: "gpt-x", StatusCode: 502, LatencyMS: 20})
+	m.ObserveUpstream(&logging.LogEntry{Model: "gpt-x", StatusCode: 401})
+
+	if got := counterValue(m.UpstreamRequestsTotal.WithLabelValues(up, "gpt-x", "200")); got != 1 {
+		t.Errorf("200 responses = %v, want 1", got)
+	}
+	if got := counterValue(m.UpstreamRequestsTotal.WithLabelValues(up, "gpt-x", "502")); got != 1 {
+		t.Errorf("502 responses = %v, want 1", got)
+	}
+	if got := seriesCount(m.UpstreamRequestsTotal); got != 2 {
+		t.Errorf("expected requests without an upstream to be skipped, got %d series", got)
+	}
+	if got := counterValue(m.TokensTotal.WithLabelValues(up, "gpt-x", "in")); got != 10 {
+		t.Errorf("input tokens = %v, want 10", got)
+	}
+	if got := counterValue(m.TokensTotal.WithLabelValues(up, "gpt-x", "out")); got != 4 {
+		t.Errorf("output tokens = %v, want 4", got)
+	}
+	if got := seriesCount(m.UpstreamDuration); got != 1 {
+		t.Errorf("expected 1 duration series, got %d", got)
+	}
+	if got := seriesCount(m.StreamDuration); got != 1 {
+		t.Errorf("expected 1 stream duration series, got %d", got)
+	}
+	if got := seriesCount(m.OverheadUS); got != 1 {
+		t.Errorf("expected 1 overhead series, got %d", got)
+	}
+}
+
+func TestCircuitBreakerCollector(t *testing.T) {
+	m := New()
+	id := uuid.New()
+	m.RegisterCircuitBreakers(func() map[uuid.UUID]resilience.State {
+		return map[uuid.UUID]resilience.State{id: resilience.StateOpen}
+	})
+	mfs, err := m.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != "proxy_circuit_breaker_state" {
+			continue
+		}
+		metric := mf.GetMetric()[0]
+		if metric.GetLabel()[0].GetValue() != id.String() || metric.GetGauge().GetValue() != 1 {
+			t.Fatalf("unexpected breaker metric %v", metric)
+		}
+		return
+	}
+	t.Fatal("proxy_circuit_breaker_state not exported")
+}
+
+func counterValue(c prometheus.Counter) float64 {
+	var metric dto.Metric
+	c.Write(&metric)
+	return metric.GetCounter().GetValue()
+}
+
+func seriesCount(c prometheus.Collector) int {
+	ch := make(chan prometheus.Metric, 16)
+	c.Collect(ch)
+	close(ch)
+	return len(ch)
+}
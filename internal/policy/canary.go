@@ -0,0 +1,91 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// canary is the compiled candidate policy set of a running canary.
+type canary struct {
+	id      uuid.UUID
+	percent int
+	rules   []rule
+}
+
+// reloadCanary loads the running canary, rolling it back first if its arm
+// has regressed against the stable one.
+func (e *Engine) reloadCanary(ctx context.Context) error {
+	c, err := e.store.GetRunningPolicyCanary(ctx)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		e.canary.Store(nil)
+		return nil
+	}
+
+	stats, err := e.store.PolicyCanaryStats(ctx, c.ID)
+	if err != nil {
+		return err
+	}
+	if reason := Regression(c, stats); reason != "" {
+		if _, err := e.store.RollBackPolicyCanary(ctx, c.ID, reason); err != nil {
+			return err
+		}
+		log.Printf("policy: canary %q rolled back: %s", c.Name, reason)
+		e.canary.Store(nil)
+		return nil
+	}
+
+	e.canary.Store(&canary{id: c.ID, percent: c.Percent, rules: compileRules(CanaryPolicies(c))})
+	return nil
+}
+
+// CanaryPolicies returns a canary's candidate policies as active policies in
+// evaluation order (priority descending, then name).
+func CanaryPolicies(c *store.PolicyCanary) []store.Policy {
+	policies := make([]store.Policy, 0, len(c.Policies))
+	for _, p := range c.Policies {
+		policies = append(policies, store.Policy{
+			Name:        p.Name,
+			Expression:  p.Expression,
+			Action:      p.Action,
+			TargetModel: p.TargetModel,
+			MaxTokens:   p.MaxTokens,
+			Message:     p.Message,
+			Priority:    p.Priority,
+			IsActive:    true,
+		})
+	}
+	sort.SliceStable(policies, func(i, j int) bool {
+		if policies[i].Priority != policies[j].Priority {
+			return policies[i].Priority > policies[j].Priority
+		}
+		return policies[i].Name < policies[j].Name
+	})
+	return policies
+}
+
+// Regression returns why a canary should be rolled back, or "" if it is
+// healthy or has too few requests in either arm to judge.
+func Regression(c *store.PolicyCanary, stats *store.CanaryStats) string {
+	if stats.Stable.Requests < c.MinRequests || stats.Canary.Requests < c.MinRequests {
+		return ""
+	}
+	if delta := stats.Canary.ErrorRate - stats.Stable.ErrorRate; delta > c.MaxErrorRateDelta {
+		return fmt.Sprintf("error rate %.1f%% vs %.1f%% stable exceeds the allowed delta of %.1f%%",
+			stats.Canary.ErrorRate*100, stats.Stable.ErrorRate*100, c.MaxErrorRateDelta*100)
+	}
+	if c.MaxLatencyDeltaMS > 0 {
+		if delta := stats.Canary.AvgLatencyMS - stats.Stable.AvgLatencyMS; delta > float64(c.MaxLatencyDeltaMS) {
+			return fmt.Sprintf("average latency %.0fms vs %.0fms stable exceeds the allowed delta of %dms",
+				stats.Canary.AvgLatencyMS, stats.Stable.AvgLatencyMS, c.MaxLatencyDeltaMS)
+		}
+	}
+	return ""
+}
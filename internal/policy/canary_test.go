@@ -0,0 +1,64 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestRegression(t *testing.T) {
+	c := &store.PolicyCanary{MaxErrorRateDelta: 0.05, MaxLatencyDeltaMS: 200, MinRequests: 100}
+	arm := func(n int, errRate, latency float64) store.CanaryArmStats {
+		return store.CanaryArmStats{Requests: n, ErrorRate: errRate, AvgLatencyMS: latency}
+	}
+
+	tests := []struct {
+		name  string
+		stats store.CanaryStats
+		want  string
+	}{
+		{"healthy", store.CanaryStats{Stable: arm(500, 0.01, 900), Canary: arm(100, 0.03, 1000)}, ""},
+		{"too few requests", store.CanaryStats{Stable: arm(500, 0.01, 900), Canary: arm(99, 0.5, 900)}, ""},
+		{"error rate", store.CanaryStats{Stable: arm(500, 0.01, 900), Canary: arm(100, 0.10, 900)}, "error rate 10.0%"},
+		{"latency", store.CanaryStats{Stable: arm(500, 0.01, 900), Canary: arm(100, 0.01, 1200)}, "average latency 1200ms"},
+	}
+	for _, tt := range tests {
+		got := Regression(c, &tt.stats)
+		if (tt.want == "") != (got == "") || !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: got %q, want prefix %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateCanary(t *testing.T) {
+	deny := &store.PolicyCanary{Policies: []store.PolicyCreate{{Name: "no-opus", Expression: `model == "claude-opus-4"`, Action: ActionDeny}}}
+
+	e := &Engine{}
+	stable := []rule{}
+	e.rules.Store(&stable)
+	id := uuid.New()
+	e.canary.Store(&canary{id: id, percent: 50, rules: compileRules(CanaryPolicies(deny))})
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		d := e.Evaluate(Input{Model: "claude-opus-4"})
+		if d.CanaryID != id {
+			t.Fatalf("expected canary id on every decision, got %v", d.CanaryID)
+		}
+		// Only the canary arm runs the candidate deny policy.
+		if d.Denied != (d.CanaryArm == store.CanaryArmCanary) {
+			t.Fatalf("arm %q denied=%v", d.CanaryArm, d.Denied)
+		}
+		counts[d.CanaryArm]++
+	}
+	if counts[store.CanaryArmCanary] < 400 || counts[store.CanaryArmStable] < 400 {
+		t.Fatalf("expected a roughly even split, got %v", counts)
+	}
+
+	e.canary.Store(nil)
+	if d := e.Evaluate(Input{Model: "claude-opus-4"}); d.Denied || d.CanaryArm != "" {
+		t.Fatalf("expected stable evaluation without a canary, got %+v", d)
+	}
+}
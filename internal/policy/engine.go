@@ -0,0 +1,239 @@
+package policy
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// Policy actions.
+const (
+	ActionAllow  = "allow"
+	ActionDeny   = "deny"
+	ActionRoute  = "route"
+	ActionCap    = "cap"
+	ActionFilter = "filter"
+)
+
+// ValidAction reports whether a is a known policy action.
+func ValidAction(a string) bool {
+	switch a {
+	case ActionAllow, ActionDeny, ActionRoute, ActionCap, ActionFilter:
+		return true
+	}
+	return false
+}
+
+// Input is the per-request data exposed to policy expressions.
+type Input struct {
+	KeyID       string
+	KeyName     string
+	Model       string
+	InputTokens int
+	Headers     http.Header
+	Path        string
+	Format      string // anthropic, openai, responses, or gemini
+	Now         time.Time
+}
+
+// vars builds the expression environment. Header names are lowercased and
+// multi-valued headers are joined with ", ".
+func (in *Input) vars() map[string]any {
+	headers := make(map[string]any, len(in.Headers))
+	for k, v := range in.Headers {
+		headers[strings.ToLower(k)] = strings.Join(v, ", ")
+	}
+	now := in.Now.UTC()
+	return map[string]any{
+		"key":          map[string]any{"id": in.KeyID, "name": in.KeyName},
+		"model":        in.Model,
+		"input_tokens": int64(in.InputTokens),
+		"headers":      headers,
+		"path":         in.Path,
+		"format":       in.Format,
+		"hour":         int64(now.Hour()),
+		"weekday":      int64(now.Weekday()),
+	}
+}
+
+// Decision is the outcome of evaluating all policies for a request.
+type Decision struct {
+	Denied    bool
+	Filtered  bool   // answer with a content-filtered response instead
+	Policy    string // name of the denying or filtering policy
+	Message   string
+	Model     string // replacement model from a route policy, "" if none
+	MaxTokens int    // lowest cap from matching cap policies, 0 if none
+
+	// CanaryID and CanaryArm identify the canary arm the request was
+	// evaluated under while a policy canary runs; CanaryArm is "" otherwise.
+	CanaryID  uuid.UUID
+	CanaryArm string
+}
+
+type rule struct {
+	store.Policy
+	prog *Program
+}
+
+// Engine evaluates admission policies loaded from the store. Policies are
+// reloaded periodically so edits made through the management API take effect
+// without a restart.
+type Engine struct {
+	store    store.Store
+	rules    atomic.Pointer[[]rule]
+	canary   atomic.Pointer[canary]
+	interval time.Duration
+	wg       sync.WaitGroup
+	done     chan struct{}
+}
+
+// NewEngine loads policies from s and starts a background reload every
+// interval.
+func NewEngine(s store.Store, interval time.Duration) *Engine {
+	e := &Engine{
+		store:    s,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	empty := []rule{}
+	e.rules.Store(&empty)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := e.Reload(ctx); err != nil {
+		log.Printf("policy: initial load failed: %v", err)
+	}
+	cancel()
+
+	e.wg.Add(1)
+	go e.worker()
+	return e
+}
+
+func (e *Engine) Close() {
+	close(e.done)
+	e.wg.Wait()
+}
+
+func (e *Engine) worker() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := e.Reload(ctx); err != nil {
+				log.Printf("policy: reload failed: %v", err)
+			}
+			cancel()
+		case <-e.done:
+			return
+		}
+	}
+}
+
+// Reload replaces the active rule set with the active policies in the
+// store, and picks up, checks or drops the running canary. Policies whose
+// expression fails to compile are skipped.
+func (e *Engine) Reload(ctx context.Context) error {
+	policies, err := e.store.ListPolicies(ctx)
+	if err != nil {
+		return err
+	}
+	rules := compileRules(policies)
+	e.rules.Store(&rules)
+	return e.reloadCanary(ctx)
+}
+
+// compileRules compiles the active policies, in order.
+func compileRules(policies []store.Policy) []rule {
+	rules := make([]rule, 0, len(policies))
+	for _, p := range policies {
+		if !p.IsActive {
+			continue
+		}
+		prog, err := Compile(p.Expression)
+		if err != nil {
+			log.Printf("policy: skipping %q: %v", p.Name, err)
+			continue
+		}
+		rules = append(rules, rule{Policy: p, prog: prog})
+	}
+	return rules
+}
+
+// Evaluate runs policies in priority order. An allow or deny match stops
+// evaluation; route and cap matches are recorded and evaluation continues,
+// with the first route and the lowest cap winning. Expressions that fail at
+// runtime are treated as not matching.
+func (e *Engine) Evaluate(in Input) Decision {
+	rules := *e.rules.Load()
+	c := e.canary.Load()
+	if c == nil {
+		return evaluate(rules, in)
+	}
+	arm := store.CanaryArmStable
+	if rand.IntN(100) < c.percent {
+		rules, arm = c.rules, store.CanaryArmCanary
+	}
+	d := evaluate(rules, in)
+	d.CanaryID, d.CanaryArm = c.id, arm
+	return d
+}
+
+func evaluate(rules []rule, in Input) Decision {
+	var d Decision
+	if len(rules) == 0 {
+		return d
+	}
+	vars := in.vars()
+	for _, r := range rules {
+		ok, err := r.prog.EvalBool(vars)
+		if err != nil {
+			log.Printf("policy: %q evaluation error: %v", r.Name, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		switch r.Action {
+		case ActionAllow:
+			return d
+		case ActionDeny:
+			d.Denied = true
+			d.Policy = r.Name
+			d.Message = "Request denied by policy " + r.Name
+			if r.Message != nil && *r.Message != "" {
+				d.Message = *r.Message
+			}
+			return d
+		case ActionFilter:
+			d.Filtered = true
+			d.Policy = r.Name
+			if r.Message != nil {
+				d.Message = *r.Message
+			}
+			return d
+		case ActionRoute:
+			if d.Model == "" && r.TargetModel != nil {
+				d.Model = *r.TargetModel
+			}
+		case ActionCap:
+			if r.MaxTokens != nil && *r.MaxTokens > 0 && (d.MaxTokens == 0 || *r.MaxTokens < d.MaxTokens) {
+				d.MaxTokens = *r.MaxTokens
+			}
+		}
+	}
+	return d
+}
@@ -0,0 +1,92 @@
+package policy
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestEvaluate(t *testing.T) {
+	str := func(s string) *string { return &s }
+	num := func(n int) *int { return &n }
+	pol := func(name, expr, action string) store.Policy {
+		return store.Policy{Name: name, Expression: expr, Action: action, IsActive: true}
+	}
+	deny := pol("deny-opus", `model == "claude-opus-4"`, ActionDeny)
+	denyMsg := deny
+	denyMsg.Message = str("Opus is reserved")
+	filter := pol("moderation", `headers["x-team"] == "search"`, ActionFilter)
+	filter.Message = str("Filtered")
+	route1 := pol("to-sonnet", `input_tokens > 1000`, ActionRoute)
+	route1.TargetModel = str("claude-sonnet-4")
+	route2 := pol("to-haiku", `true`, ActionRoute)
+	route2.TargetModel = str("claude-haiku-4")
+	cap500 := pol("cap-500", `true`, ActionCap)
+	cap500.MaxTokens = num(500)
+	cap200 := pol("cap-200", `true`, ActionCap)
+	cap200.MaxTokens = num(200)
+	inactive := deny
+	inactive.IsActive = false
+
+	tests := []struct {
+		name     string
+		policies []store.Policy
+		want     Decision
+	}{
+		{"no policies", nil, Decision{}},
+		{"deny", []store.Policy{deny}, Decision{Denied: true, Policy: "deny-opus", Message: "Request denied by policy deny-opus"}},
+		{"deny message", []store.Policy{denyMsg}, Decision{Denied: true, Policy: "deny-opus", Message: "Opus is reserved"}},
+		{"no match", []store.Policy{pol("deny-gpt", `model.startsWith("gpt")`, ActionDeny)}, Decision{}},
+		{"allow stops evaluation", []store.Policy{pol("allow-ci", `key.name == "ci-bot"`, ActionAllow), deny}, Decision{}},
+		{"allow after route keeps it", []store.Policy{route1, pol("allow", `true`, ActionAllow), deny}, Decision{Model: "claude-sonnet-4"}},
+		{"filter", []store.Policy{filter, deny}, Decision{Filtered: true, Policy: "moderation", Message: "Filtered"}},
+		{"first route wins", []store.Policy{route1, route2}, Decision{Model: "claude-sonnet-4"}},
+		{"lowest cap wins", []store.Policy{cap200, cap500}, Decision{MaxTokens: 200}},
+		{"route and cap combine", []store.Policy{cap500, route2, cap200}, Decision{Model: "claude-haiku-4", MaxTokens: 200}},
+		{"runtime error does not match", []store.Policy{pol("broken", `headers["missing"] == "x"`, ActionDeny)}, Decision{}},
+		{"invalid expression skipped", []store.Policy{pol("invalid", `model ==`, ActionDeny)}, Decision{}},
+		{"inactive skipped", []store.Policy{inactive}, Decision{}},
+	}
+	in := Input{
+		KeyName:     "ci-bot",
+		Model:       "claude-opus-4",
+		InputTokens: 12000,
+		Headers:     http.Header{"X-Team": {"search"}},
+		Now:         time.Now(),
+	}
+	for _, tt := range tests {
+		e := &Engine{}
+		rules := compileRules(tt.policies)
+		e.rules.Store(&rules)
+		if got := e.Evaluate(in); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEngineReload(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	if _, err := st.CreatePolicy(ctx, &store.PolicyCreate{Name: "low", Expression: "true", Action: ActionAllow, Priority: 1}); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(st, time.Hour)
+	defer e.Close()
+	if d := e.Evaluate(Input{Model: "gpt-4o"}); d.Denied {
+		t.Fatalf("expected the allow policy to admit, got %+v", d)
+	}
+
+	// A higher priority deny runs first once reloaded.
+	if _, err := st.CreatePolicy(ctx, &store.PolicyCreate{Name: "high", Expression: `model == "gpt-4o"`, Action: ActionDeny, Priority: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d := e.Evaluate(Input{Model: "gpt-4o"}); !d.Denied || d.Policy != "high" {
+		t.Fatalf("expected a deny by the high priority policy, got %+v", d)
+	}
+}
@@ -0,0 +1,860 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Program is a compiled policy expression. The language is a small subset of
+// CEL: literals (int, double, string, bool, null, lists), identifiers with
+// field and index access, the operators ! - * / % + < <= > >= == != in && ||
+// and ?:, the global size() function, and the string methods startsWith,
+// endsWith, contains and matches.
+type Program struct {
+	src  string
+	root node
+}
+
+// Env adapts the language to a use other than policies.
+type Env struct {
+	// Vars, if set, are the only variables expressions may reference, and
+	// a reference to any other variable or to an unknown function fails to
+	// compile rather than to evaluate.
+	Vars map[string]bool
+
+	// Funcs are global functions callable besides size().
+	Funcs map[string]Func
+}
+
+// Func is a global function added by an Env. A call with fewer than
+// MinArgs or more than MaxArgs arguments fails to compile; a negative
+// MaxArgs allows any number. Call gets the evaluated arguments.
+type Func struct {
+	MinArgs, MaxArgs int
+	Call             func(args []any) (any, error)
+}
+
+// Compile parses a policy expression. Syntax errors are reported with the
+// byte offset at which parsing failed.
+func Compile(src string) (*Program, error) {
+	return Env{}.Compile(src)
+}
+
+// Compile parses an expression in env.
+func (env Env) Compile(src string) (*Program, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, env: env}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+	}
+	return &Program{src: src, root: root}, nil
+}
+
+// String returns the source expression.
+func (p *Program) String() string { return p.src }
+
+// Eval evaluates the program against vars.
+func (p *Program) Eval(vars map[string]any) (any, error) {
+	return p.root.eval(vars)
+}
+
+// EvalBool evaluates the program and requires a boolean result.
+func (p *Program) EvalBool(vars map[string]any) (bool, error) {
+	v, err := p.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression result is %s, not bool", typeName(v))
+	}
+	return b, nil
+}
+
+// ---------------------------------------------------------------------------
+// Lexer
+// ---------------------------------------------------------------------------
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokInt
+	tokFloat
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+var twoCharOps = []string{"&&", "||", "==", "!=", "<=", ">="}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			toks = append(toks, token{tokIdent, src[start:i], start})
+		case isDigit(c):
+			start := i
+			kind := tokInt
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.' || src[i] == 'e' || src[i] == 'E') {
+				if src[i] == '.' || src[i] == 'e' || src[i] == 'E' {
+					kind = tokFloat
+				}
+				i++
+			}
+			toks = append(toks, token{kind, src[start:i], start})
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			for {
+				if i >= len(src) {
+					return nil, fmt.Errorf("unterminated string at offset %d", start)
+				}
+				if src[i] == c {
+					i++
+					break
+				}
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					switch src[i] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 't':
+						sb.WriteByte('\t')
+					default:
+						sb.WriteByte(src[i])
+					}
+					i++
+					continue
+				}
+				sb.WriteByte(src[i])
+				i++
+			}
+			toks = append(toks, token{tokString, sb.String(), start})
+		default:
+			matched := false
+			for _, op := range twoCharOps {
+				if strings.HasPrefix(src[i:], op) {
+					toks = append(toks, token{tokOp, op, i})
+					i += 2
+					matched = true
+					break
+				}
+			}
+			if matched {
+				continue
+			}
+			if strings.ContainsRune("()[],.!<>+-*/%?:", rune(c)) {
+				toks = append(toks, token{tokOp, string(c), i})
+				i++
+				continue
+			}
+			return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+		}
+	}
+	toks = append(toks, token{tokEOF, "end of expression", len(src)})
+	return toks, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// ---------------------------------------------------------------------------
+// Parser
+// ---------------------------------------------------------------------------
+
+type parser struct {
+	toks []token
+	pos  int
+	env  Env
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) acceptOp(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp && !(t.kind == tokIdent && t.text == "in") {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expectOp(op string) error {
+	t := p.next()
+	if t.kind != tokOp || t.text != op {
+		return fmt.Errorf("expected %q at offset %d, got %q", op, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *parser) parseExpr() (node, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.acceptOp("?"); !ok {
+		return cond, nil
+	}
+	a, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectOp(":"); err != nil {
+		return nil, err
+	}
+	b, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &condNode{cond, a, b}, nil
+}
+
+// binaryLevels lists operators from lowest to highest precedence.
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">=", "in"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) parseBinary(level int) (node, error) {
+	if level == len(binaryLevels) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOp(binaryLevels[level]...)
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op, left, right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if op, ok := p.acceptOp("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op, operand}, nil
+	}
+	return p.parseMember()
+}
+
+func (p *parser) parseMember() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOp("."); ok {
+			name := p.next()
+			if name.kind != tokIdent {
+				return nil, fmt.Errorf("expected field name at offset %d", name.pos)
+			}
+			if _, ok := p.acceptOp("("); ok {
+				args, err := p.parseArgs(")")
+				if err != nil {
+					return nil, err
+				}
+				call := &callNode{name: name.text, target: n, args: args}
+				if name.text == "matches" {
+					if call.re, err = compileMatches(args, name.pos); err != nil {
+						return nil, err
+					}
+				}
+				n = call
+				continue
+			}
+			n = &indexNode{n, &literalNode{name.text}}
+			continue
+		}
+		if _, ok := p.acceptOp("["); ok {
+			idx, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp("]"); err != nil {
+				return nil, err
+			}
+			n = &indexNode{n, idx}
+			continue
+		}
+		return n, nil
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokInt:
+		v, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q at offset %d", t.text, t.pos)
+		}
+		return &literalNode{v}, nil
+	case tokFloat:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at offset %d", t.text, t.pos)
+		}
+		return &literalNode{v}, nil
+	case tokString:
+		return &literalNode{t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{true}, nil
+		case "false":
+			return &literalNode{false}, nil
+		case "null":
+			return &literalNode{nil}, nil
+		}
+		if _, ok := p.acceptOp("("); ok {
+			args, err := p.parseArgs(")")
+			if err != nil {
+				return nil, err
+			}
+			call := &callNode{name: t.text, args: args}
+			if fn, ok := p.env.Funcs[t.text]; ok && t.text != "size" {
+				if len(args) < fn.MinArgs || fn.MaxArgs >= 0 && len(args) > fn.MaxArgs {
+					return nil, fmt.Errorf("wrong number of arguments to %s at offset %d", t.text, t.pos)
+				}
+				call.fn = fn.Call
+			} else if p.env.Vars != nil && t.text != "size" {
+				return nil, fmt.Errorf("unknown function %s at offset %d", t.text, t.pos)
+			}
+			return call, nil
+		}
+		if p.env.Vars != nil && !p.env.Vars[t.text] {
+			return nil, fmt.Errorf("undeclared reference to %q at offset %d", t.text, t.pos)
+		}
+		return &identNode{t.text}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			n, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return n, nil
+		case "[":
+			elems, err := p.parseArgs("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{elems}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+}
+
+func (p *parser) parseArgs(closer string) ([]node, error) {
+	var args []node
+	if _, ok := p.acceptOp(closer); ok {
+		return args, nil
+	}
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if _, ok := p.acceptOp(","); ok {
+			continue
+		}
+		if err := p.expectOp(closer); err != nil {
+			return nil, err
+		}
+		return args, nil
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Evaluation
+// ---------------------------------------------------------------------------
+
+type node interface {
+	eval(vars map[string]any) (any, error)
+}
+
+type literalNode struct{ v any }
+
+func (n *literalNode) eval(map[string]any) (any, error) { return n.v, nil }
+
+type identNode struct{ name string }
+
+func (n *identNode) eval(vars map[string]any) (any, error) {
+	v, ok := vars[n.name]
+	if !ok {
+		return nil, fmt.Errorf("undeclared reference to %q", n.name)
+	}
+	return normalize(v), nil
+}
+
+type listNode struct{ elems []node }
+
+func (n *listNode) eval(vars map[string]any) (any, error) {
+	out := make([]any, len(n.elems))
+	for i, e := range n.elems {
+		v, err := e.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+type indexNode struct{ target, index node }
+
+func (n *indexNode) eval(vars map[string]any) (any, error) {
+	t, err := n.target.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := n.index.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch c := t.(type) {
+	case map[string]any:
+		k, ok := idx.(string)
+		if !ok {
+			return nil, fmt.Errorf("map key must be string, got %s", typeName(idx))
+		}
+		v, ok := c[k]
+		if !ok {
+			return nil, fmt.Errorf("no such key: %q", k)
+		}
+		return normalize(v), nil
+	case []any:
+		i, ok := idx.(int64)
+		if !ok {
+			return nil, fmt.Errorf("list index must be int, got %s", typeName(idx))
+		}
+		if i < 0 || int(i) >= len(c) {
+			return nil, fmt.Errorf("index %d out of range", i)
+		}
+		return c[i], nil
+	}
+	return nil, fmt.Errorf("cannot index %s", typeName(t))
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n *unaryNode) eval(vars map[string]any) (any, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "!":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("! requires bool, got %s", typeName(v))
+		}
+		return !b, nil
+	default: // "-"
+		switch x := v.(type) {
+		case int64:
+			return -x, nil
+		case float64:
+			return -x, nil
+		}
+		return nil, fmt.Errorf("- requires a number, got %s", typeName(v))
+	}
+}
+
+type condNode struct{ cond, a, b node }
+
+func (n *condNode) eval(vars map[string]any) (any, error) {
+	c, err := n.cond.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := c.(bool)
+	if !ok {
+		return nil, fmt.Errorf("?: condition must be bool, got %s", typeName(c))
+	}
+	if b {
+		return n.a.eval(vars)
+	}
+	return n.b.eval(vars)
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(vars map[string]any) (any, error) {
+	l, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// Logical operators short-circuit.
+	if n.op == "&&" || n.op == "||" {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s requires bool operands, got %s", n.op, typeName(l))
+		}
+		if (n.op == "&&" && !lb) || (n.op == "||" && lb) {
+			return lb, nil
+		}
+		r, err := n.right.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s requires bool operands, got %s", n.op, typeName(r))
+		}
+		return rb, nil
+	}
+
+	r, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "in":
+		return contains(r, l)
+	case "<", "<=", ">", ">=":
+		c, err := compare(l, r)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	case "+":
+		if ls, ok := l.(string); ok {
+			if rs, ok := r.(string); ok {
+				return ls + rs, nil
+			}
+		}
+	}
+	return arith(n.op, l, r)
+}
+
+type callNode struct {
+	name   string
+	target node // nil for global functions
+	args   []node
+	re     *regexp.Regexp                // compiled pattern for matches
+	fn     func(args []any) (any, error) // a global function added by an Env
+}
+
+// compileMatches compiles the pattern of a matches call. Patterns must be
+// string literals so that they are compiled once with the expression rather
+// than per evaluated value.
+func compileMatches(args []node, pos int) (*regexp.Regexp, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("matches takes one argument at offset %d", pos)
+	}
+	lit, ok := args[0].(*literalNode)
+	if !ok {
+		return nil, fmt.Errorf("matches requires a string literal pattern at offset %d", pos)
+	}
+	pattern, ok := lit.v.(string)
+	if !ok {
+		return nil, fmt.Errorf("matches requires a string literal pattern at offset %d", pos)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q at offset %d: %w", pattern, pos, err)
+	}
+	return re, nil
+}
+
+func (n *callNode) eval(vars map[string]any) (any, error) {
+	args := make([]any, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	if n.target == nil {
+		if n.fn != nil {
+			return n.fn(args)
+		}
+		if n.name == "size" && len(args) == 1 {
+			return size(args[0])
+		}
+		return nil, fmt.Errorf("unknown function %s/%d", n.name, len(args))
+	}
+
+	t, err := n.target.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if n.name == "size" && len(args) == 0 {
+		return size(t)
+	}
+	s, ok := t.(string)
+	if !ok || len(args) != 1 {
+		return nil, fmt.Errorf("unknown method %s/%d on %s", n.name, len(args), typeName(t))
+	}
+	arg, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s requires a string argument, got %s", n.name, typeName(args[0]))
+	}
+	switch n.name {
+	case "startsWith":
+		return strings.HasPrefix(s, arg), nil
+	case "endsWith":
+		return strings.HasSuffix(s, arg), nil
+	case "contains":
+		return strings.Contains(s, arg), nil
+	case "matches":
+		return n.re.MatchString(s), nil
+	}
+	return nil, fmt.Errorf("unknown method %s on string", n.name)
+}
+
+// normalize widens Go values supplied by callers to the evaluator's value
+// types: int64, float64, string, bool, []any, map[string]any.
+func normalize(v any) any {
+	switch x := v.(type) {
+	case int:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case float32:
+		return float64(x)
+	case []string:
+		out := make([]any, len(x))
+		for i, s := range x {
+			out[i] = s
+		}
+		return out
+	case map[string]string:
+		out := make(map[string]any, len(x))
+		for k, s := range x {
+			out[k] = s
+		}
+		return out
+	}
+	return v
+}
+
+func equal(a, b any) bool {
+	if af, bf, ok := numbers(a, b); ok {
+		return af == bf
+	}
+	switch x := a.(type) {
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		return false
+	}
+	return a == b
+}
+
+func compare(a, b any) (int, error) {
+	if af, bf, ok := numbers(a, b); ok {
+		switch {
+		case af < bf:
+			return -1, nil
+		case af > bf:
+			return 1, nil
+		}
+		return 0, nil
+	}
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if aok && bok {
+		return strings.Compare(as, bs), nil
+	}
+	return 0, fmt.Errorf("cannot compare %s and %s", typeName(a), typeName(b))
+}
+
+func contains(container, elem any) (any, error) {
+	switch c := container.(type) {
+	case []any:
+		for _, e := range c {
+			if equal(e, elem) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]any:
+		k, ok := elem.(string)
+		if !ok {
+			return false, nil
+		}
+		_, found := c[k]
+		return found, nil
+	}
+	return nil, fmt.Errorf("in requires a list or map, got %s", typeName(container))
+}
+
+func arith(op string, a, b any) (any, error) {
+	ai, aInt := a.(int64)
+	bi, bInt := b.(int64)
+	if aInt && bInt {
+		switch op {
+		case "+":
+			return ai + bi, nil
+		case "-":
+			return ai - bi, nil
+		case "*":
+			return ai * bi, nil
+		case "/", "%":
+			if bi == 0 {
+				return nil, errors.New("division by zero")
+			}
+			if op == "/" {
+				return ai / bi, nil
+			}
+			return ai % bi, nil
+		}
+	}
+	af, bf, ok := numbers(a, b)
+	if !ok {
+		return nil, fmt.Errorf("%s not supported for %s and %s", op, typeName(a), typeName(b))
+	}
+	switch op {
+	case "+":
+		return af + bf, nil
+	case "-":
+		return af - bf, nil
+	case "*":
+		return af * bf, nil
+	case "/":
+		return af / bf, nil
+	}
+	return nil, fmt.Errorf("%s not supported for double", op)
+}
+
+func numbers(a, b any) (float64, float64, bool) {
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	return af, bf, aok && bok
+}
+
+func toFloat(v any) (float64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+	return 0, false
+}
+
+func size(v any) (any, error) {
+	switch x := v.(type) {
+	case string:
+		return int64(len(x)), nil
+	case []any:
+		return int64(len(x)), nil
+	case map[string]any:
+		return int64(len(x)), nil
+	}
+	return nil, fmt.Errorf("size not supported for %s", typeName(v))
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case int64:
+		return "int"
+	case float64:
+		return "double"
+	case string:
+		return "string"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "map"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,198 @@
+package policy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testVars() map[string]any {
+	in := Input{
+		KeyID:       "k1",
+		KeyName:     "ci-bot",
+		Model:       "claude-opus-4",
+		InputTokens: 12000,
+		Headers:     http.Header{"X-Team": {"search"}},
+		Path:        "/v1/messages",
+		Format:      "anthropic",
+		Now:         time.Date(2026, 1, 5, 22, 0, 0, 0, time.UTC), // Monday
+	}
+	return in.vars()
+}
+
+func TestEvalBool(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`model == "claude-opus-4"`, true},
+		{`model.startsWith("claude-") && input_tokens > 10000`, true},
+		{`key.name in ["ci-bot", "nightly"]`, true},
+		{`headers["x-team"] == "search"`, true},
+		{`"x-missing" in headers`, false},
+		{`hour >= 18 || hour < 8`, true},
+		{`weekday == 1`, true},
+		{`input_tokens / 1000 == 12`, true},
+		{`input_tokens > 1.5e4`, false},
+		{`!(format == "openai")`, true},
+		{`size(key.name) == 6 && key.name.size() == 6`, true},
+		{`model.matches("^claude-(opus|sonnet)")`, true},
+		{`path.endsWith("/messages") ? input_tokens > 0 : false`, true},
+		{`model.contains("gpt") && headers["nope"] == "x"`, false}, // short-circuit
+	}
+	vars := testVars()
+	for _, tt := range tests {
+		prog, err := Compile(tt.expr)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.expr, err)
+		}
+		got, err := prog.EvalBool(vars)
+		if err != nil {
+			t.Fatalf("EvalBool(%q): %v", tt.expr, err)
+		}
+		if got != tt.want {
+			t.Errorf("EvalBool(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvalPrecedence(t *testing.T) {
+	tests := []struct {
+		expr string
+		want any
+	}{
+		{`1 + 2 * 3`, int64(7)},
+		{`(1 + 2) * 3`, int64(9)},
+		{`10 - 4 - 3`, int64(3)},
+		{`24 / 4 / 2`, int64(3)},
+		{`7 % 4 * 2`, int64(6)},
+		{`-2 * 3`, int64(-6)},
+		{`- -2`, int64(2)},
+		{`1 + 2.5`, 3.5},
+		{`"a" + "b" + "c"`, "abc"},
+		{`1 + 2 == 3`, true},
+		{`1 < 2 == true`, true},
+		{`"a" in ["a"] == true`, true},
+		{`true || false && false`, true},
+		{`(true || false) && false`, false},
+		{`!true || true`, true},
+		{`!(true || true)`, false},
+		{`1 == 1 && 2 == 3 || 4 == 4`, true},
+		{`true ? 1 : 2 + 10`, int64(1)},
+		{`false ? 1 : true ? 2 : 3`, int64(2)},
+		{`false || true ? "yes" : "no"`, "yes"},
+		{`[1, 2, 3][1 + 1]`, int64(3)},
+		{`key.name.size() * 2`, int64(12)},
+		{`size([1, 2]) + size("abc")`, int64(5)},
+	}
+	vars := testVars()
+	for _, tt := range tests {
+		prog, err := Compile(tt.expr)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.expr, err)
+		}
+		got, err := prog.Eval(vars)
+		if err != nil {
+			t.Fatalf("Eval(%q): %v", tt.expr, err)
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %#v, want %#v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`model ==`,
+		`(model == "a"`,
+		`model == "unterminated`,
+		`model # 1`,
+		`a b`,
+		`model.matches(path)`,
+		`model.matches("a" + "b")`,
+		`model.matches(1)`,
+		`model.matches("(")`,
+		`model.matches()`,
+	} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("Compile(%q): expected error", expr)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string // error prefix
+	}{
+		{`unknown == 1`, "undeclared reference"},
+		{`headers["x-missing"] == "a"`, "no such key"},
+		{`headers[1] == "a"`, "map key must be string"},
+		{`[1][5] == 1`, "index 5 out of range"},
+		{`[1]["a"] == 1`, "list index must be int"},
+		{`model.name == "a"`, "cannot index string"},
+		{`model + 1 == 2`, "+ not supported for string and int"},
+		{`input_tokens / 0 == 1`, "division by zero"},
+		{`1.5 % 2 == 1`, "% not supported for double"},
+		{`model < 1`, "cannot compare string and int"},
+		{`1 in model`, "in requires a list or map"},
+		{`!model`, "! requires bool"},
+		{`-model == 1`, "- requires a number"},
+		{`model && true`, "&& requires bool operands"},
+		{`false || 1`, "|| requires bool operands"},
+		{`input_tokens ? true : false`, "?: condition must be bool"},
+		{`size(1) == 1`, "size not supported for int"},
+		{`model.startsWith(1)`, "startsWith requires a string argument"},
+		{`input_tokens.contains("1")`, "unknown method contains/1 on int"},
+		{`model.trim("a")`, "unknown method trim on string"},
+		{`lower(model) == "a"`, "unknown function lower/1"},
+		{`model`, "expression result is string, not bool"},
+	}
+	vars := testVars()
+	for _, tt := range tests {
+		prog, err := Compile(tt.expr)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.expr, err)
+		}
+		_, err = prog.EvalBool(vars)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("EvalBool(%q): got error %v, want prefix %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestEnv(t *testing.T) {
+	env := Env{
+		Vars: map[string]bool{"a": true, "b": true},
+		Funcs: map[string]Func{
+			"first": {MinArgs: 1, MaxArgs: -1, Call: func(args []any) (any, error) { return args[0], nil }},
+		},
+	}
+	prog, err := env.Compile(`first(a + b, 0) * 2 + size("xy")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := prog.Eval(map[string]any{"a": 1, "b": 2}); err != nil || got != int64(8) {
+		t.Fatalf("Eval = %#v, %v; want 8", got, err)
+	}
+
+	for expr, want := range map[string]string{
+		`a + c`:     `undeclared reference to "c" at offset 4`,
+		`lower(a)`:  "unknown function lower at offset 0",
+		`first()`:   "wrong number of arguments to first at offset 0",
+		`a.size()`:  "",
+		`{`:         "unexpected character",
+		`a == "x"`:  "",
+		`b in [a]`:  "",
+		`first(b)`:  "",
+		`size(a)`:   "",
+		`a ? b : 1`: "",
+	} {
+		_, err := env.Compile(expr)
+		if want == "" && err != nil || want != "" && (err == nil || !strings.HasPrefix(err.Error(), want)) {
+			t.Errorf("Compile(%q): got error %v, want %q", expr, err, want)
+		}
+	}
+}
@@ -12,15 +12,45 @@ import (
 const LiteLLMPricingURL = "https://raw.githubusercontent.com/BerriAI/litellm/main/model_prices_and_context_window.json"
 
 type LiteLLMModel struct {
-	InputCostPerToken  float64 `json:"input_cost_per_token"`
-	OutputCostPerToken float64 `json:"output_cost_per_token"`
-	Mode               string  `json:"mode"`
+	InputCostPerToken  float64  `json:"input_cost_per_token"`
+	OutputCostPerToken float64  `json:"output_cost_per_token"`
+	Mode               string   `json:"mode"`
+	MaxInputTokens     tokenInt `json:"max_input_tokens"`
+	MaxOutputTokens    tokenInt `json:"max_output_tokens"`
+	MaxTokens          tokenInt `json:"max_tokens"` // legacy; output limit if known, else input
+	SearchCostPerQuery *struct {
+		Medium float64 `json:"search_context_size_medium"`
+	} `json:"search_context_cost_per_query"`
+	// OutputCostPerReasoningToken is only set for models that price
+	// reasoning apart from other output.
+	OutputCostPerReasoningToken float64 `json:"output_cost_per_reasoning_token"`
 	// Fields we don't need can be omitted or left as json.RawMessage
 }
 
+// tokenInt decodes a token limit, ignoring non-numeric values such as the
+// descriptive strings in LiteLLM's sample_spec entry.
+type tokenInt int
+
+func (t *tokenInt) UnmarshalJSON(b []byte) error {
+	var f float64
+	if err := json.Unmarshal(b, &f); err != nil {
+		*t = 0
+		return nil
+	}
+	*t = tokenInt(f)
+	return nil
+}
+
 type ModelPricing struct {
 	InputCostPerMillion  float64
 	OutputCostPerMillion float64
+	ContextWindow        int // 0 if unknown
+	MaxOutputTokens      int // 0 if unknown
+	WebSearchCostPer1K   float64
+	// EmbeddingCostPerMillion is set instead of the token prices for
+	// embedding models.
+	EmbeddingCostPerMillion float64
+	ReasoningCostPerMillion float64 // 0 if reasoning is billed as output
 }
 
 // FetchLiteLLMPricing fetches the model pricing from LiteLLM's GitHub repo.
@@ -49,17 +79,41 @@ func FetchLiteLLMPricing(ctx context.Context) (map[string]*ModelPricing, error)
 
 	pricing := make(map[string]*ModelPricing)
 	for modelName, model := range raw {
-		// Skip sample_spec and non-chat models
-		if modelName == "sample_spec" || (model.Mode != "" && model.Mode != "chat") {
+		// Skip sample_spec and models that are neither chat nor embedding
+		if modelName == "sample_spec" || (model.Mode != "" && model.Mode != "chat" && model.Mode != "embedding") {
 			continue
 		}
 		// Skip models with zero pricing
 		if model.InputCostPerToken == 0 && model.OutputCostPerToken == 0 {
 			continue
 		}
+		contextWindow := int(model.MaxInputTokens)
+		if contextWindow == 0 && model.MaxOutputTokens == 0 {
+			contextWindow = int(model.MaxTokens)
+		}
+		maxOutput := int(model.MaxOutputTokens)
+		if maxOutput == 0 && model.MaxInputTokens != 0 {
+			maxOutput = int(model.MaxTokens)
+		}
+		if model.Mode == "embedding" {
+			pricing[modelName] = &ModelPricing{
+				ContextWindow:           contextWindow,
+				EmbeddingCostPerMillion: model.InputCostPerToken * 1_000_000,
+			}
+			continue
+		}
+		var searchCost float64
+		if model.SearchCostPerQuery != nil {
+			searchCost = model.SearchCostPerQuery.Medium * 1_000
+		}
 		pricing[modelName] = &ModelPricing{
 			InputCostPerMillion:  model.InputCostPerToken * 1_000_000,
 			OutputCostPerMillion: model.OutputCostPerToken * 1_000_000,
+			ContextWindow:        contextWindow,
+			MaxOutputTokens:      maxOutput,
+			WebSearchCostPer1K:   searchCost,
+
+			ReasoningCostPerMillion: model.OutputCostPerReasoningToken * 1_000_000,
 		}
 	}
 
@@ -1,22 +1,30 @@
 package proxy
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	stdjson "encoding/json"
+	"errors"
 	"fmt"
 	json "github.com/bytedance/sonic"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"path"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/sertdev/pxbin/internal/auth"
 	"github.com/sertdev/pxbin/internal/logging"
-	"github.com/sertdev/pxbin/internal/translate"
+	"github.com/sertdev/pxbin/internal/slogger"
+	"github.com/sertdev/pxbin/internal/store"
+	"github.com/sertdev/pxbin/internal/tokenizer"
+	"github.com/sertdev/pxbin/internal/tracing"
+	"github.com/sertdev/pxbin/internal/vertex"
+	"github.com/sertdev/pxbin/pkg/translate"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // upstreamInfo contains the resolved upstream client and metadata.
@@ -24,13 +32,54 @@ type upstreamInfo struct {
 	client *UpstreamClient
 	format string
 	id     uuid.UUID
+	region string
+
+	// model is the model's canonical name, which may differ in case from
+	// the client's or be the model an alias resolved to.
+	model string
+
+	// roles rewrites OpenAI message roles for upstreams that reject some
+	// of them (see store.RoleMap).
+	roles store.RoleMap
+
+	// serviceTiers maps request priorities to the upstream's service_tier.
+	serviceTiers store.ServiceTiers
+
+	// betas sets default and allowed anthropic-beta flags; nil forwards
+	// the client's.
+	betas *store.AnthropicBetas
+
+	// compress asks for compressed non-streaming responses.
+	compress bool
+
+	// Model limits; 0 means unknown.
+	contextWindow   int
+	maxOutputTokens int
+
+	// max_tokens for Anthropic requests that omit it; 0 means use the
+	// proxy-wide default.
+	defaultMaxTokens int
+
+	// counter counts prompt tokens for limit checks; nil falls back to the
+	// byte-length estimate.
+	counter tokenizer.Tokenizer
+
+	// maxSSEFrame is the longest SSE line accepted from the upstream.
+	maxSSEFrame int
+
+	// streamIdleTimeout ends a stream from the upstream that sends nothing
+	// for this long; 0 disables it.
+	streamIdleTimeout time.Duration
 }
 
 // resolveUpstream looks up the model's linked upstream from the DB. If found,
 // it returns a cached UpstreamClient and the upstream's format. If the model
 // has no linked upstream, it returns an error — all upstreams must be
 // configured via the management API.
-func (h *Handler) resolveUpstream(ctx context.Context, modelName string) (*upstreamInfo, error) {
+func (h *Handler) resolveUpstream(ctx context.Context, modelName string) (_ *upstreamInfo, err error) {
+	_, span := tracing.Start(ctx, spanResolve, attribute.String("pxbin.model", modelName))
+	defer func() { tracing.EndWithError(span, err) }()
+
 	mw, err := h.modelCache.GetModelWithUpstream(ctx, modelName)
 	if err != nil {
 		return nil, fmt.Errorf("resolve upstream: %w", err)
@@ -38,18 +87,173 @@ func (h *Handler) resolveUpstream(ctx context.Context, modelName string) (*upstr
 	if mw == nil {
 		return nil, fmt.Errorf("no upstream configured for model %q", modelName)
 	}
-	client := h.clients.Get(*mw.UpstreamID, mw.UpstreamBaseURL, mw.UpstreamAPIKey)
-	return &upstreamInfo{
+	if key := auth.GetKeyFromContext(ctx); key != nil && !key.AllowsModel(modelName, mw.Name) {
+		return nil, &modelNotAllowedError{model: modelName}
+	}
+	now := time.Now()
+	pinned := false
+	if key := auth.GetKeyFromContext(ctx); key != nil && h.pins != nil {
+		if pin := h.pins.lookup(key.ID, now); pin != nil {
+			mw, pinned = pin.apply(mw), true
+		}
+	}
+	if mw, err = h.failoverTarget(ctx, mw, pinned, now); err != nil {
+		return nil, fmt.Errorf("resolve upstream: %w", err)
+	}
+	if !mw.Availability.Allows(now) {
+		return nil, &unavailableError{kind: "model", name: modelName, schedule: mw.Availability}
+	}
+	if !mw.UpstreamAvailability.Allows(now) {
+		return nil, &unavailableError{kind: "upstream for model", name: modelName, schedule: mw.UpstreamAvailability}
+	}
+	if key := auth.GetKeyFromContext(ctx); key != nil && !key.AllowsRegion(mw.UpstreamRegion) {
+		return nil, &regionError{model: modelName, region: mw.UpstreamRegion, allowed: key.AllowedRegions}
+	}
+	sandbox := isSandboxKey(ctx)
+	format := mw.UpstreamFormat
+	client := h.clients.Get(*mw.UpstreamID, mw.UpstreamBaseURL, mw.UpstreamAPIKey, mw.UpstreamResilience)
+	if format == vertex.Format {
+		// Vertex AI serves Claude models natively and Gemini models
+		// through Chat Completions requests translated by its client.
+		format = vertex.Dialect(mw.Name)
+		if !sandbox {
+			target, err := h.vertex.Get(*mw.UpstreamID, mw.UpstreamBaseURL, mw.UpstreamAPIKey)
+			if err != nil {
+				return nil, fmt.Errorf("resolve upstream: %w", err)
+			}
+			client = client.withVertex(target)
+		}
+	}
+	if sandbox {
+		client = sandboxClient
+	} else if mw.UpstreamExtension != nil {
+		if h.extensions == nil {
+			return nil, fmt.Errorf("upstream for model %q uses extension %q but extensions_dir is not set", modelName, *mw.UpstreamExtension)
+		}
+		ext, err := h.extensions.Module(ctx, *mw.UpstreamExtension)
+		if err != nil {
+			slogger.FromContext(ctx).Warn("load upstream extension", "model", modelName, "extension", *mw.UpstreamExtension, "error", err)
+			return nil, fmt.Errorf("resolve upstream: %w", err)
+		}
+		client = client.withExtension(ext)
+	}
+	info := &upstreamInfo{
 		client: client,
-		format: mw.UpstreamFormat,
+		format: format,
 		id:     *mw.UpstreamID,
-	}, nil
+		region: mw.UpstreamRegion,
+		roles:  mw.UpstreamRoleMap,
+		model:  mw.Name,
+
+		serviceTiers: mw.UpstreamServiceTiers,
+		betas:        mw.UpstreamAnthropicBetas,
+		compress:     !mw.UpstreamDisableCompression && !sandbox,
+
+		maxSSEFrame:       h.maxSSEFrame,
+		streamIdleTimeout: h.streamIdleTimeout,
+	}
+	if mw.UpstreamMaxSSEFrameBytes != nil {
+		info.maxSSEFrame = *mw.UpstreamMaxSSEFrameBytes
+	}
+	if mw.UpstreamStreamIdleTimeoutSeconds != nil {
+		info.streamIdleTimeout = time.Duration(*mw.UpstreamStreamIdleTimeoutSeconds) * time.Second
+	}
+	if mw.ContextWindow != nil {
+		info.contextWindow = *mw.ContextWindow
+	}
+	if mw.MaxOutputTokens != nil {
+		info.maxOutputTokens = *mw.MaxOutputTokens
+	}
+	if mw.DefaultMaxTokens != nil {
+		info.defaultMaxTokens = *mw.DefaultMaxTokens
+	}
+	configured := ""
+	if mw.Tokenizer != nil {
+		configured = *mw.Tokenizer
+	}
+	info.counter = tokenizer.ForModel(mw.Name, configured)
+	return info, nil
+}
+
+// setRequestModel rewrites the request body's model, so upstreams receive
+// the canonical name whatever casing or alias the client used.
+func setRequestModel(body []byte, model string) ([]byte, error) {
+	var req map[string]any
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	req["model"] = model
+	return json.Marshal(req)
+}
+
+// unavailableError is returned by resolveUpstream when a model or its
+// upstream is outside its scheduled availability windows.
+type unavailableError struct {
+	kind     string
+	name     string
+	schedule store.Schedule
+}
+
+func (e *unavailableError) Error() string {
+	return fmt.Sprintf("%s %q is only available %s", e.kind, e.name, e.schedule)
+}
+
+// regionError is returned by resolveUpstream when the model's upstream is
+// outside the regions the API key is restricted to.
+type regionError struct {
+	model   string
+	region  string
+	allowed []string
+}
+
+func (e *regionError) Error() string {
+	region := e.region
+	if region == "" {
+		region = "no region"
+	}
+	return fmt.Sprintf("model %q is served from %s, but this key is restricted to regions: %s", e.model, region, strings.Join(e.allowed, ", "))
+}
+
+// modelNotAllowedError is returned by resolveUpstream when the API key's
+// model allowlist does not cover the model.
+type modelNotAllowedError struct {
+	model string
+}
+
+func (e *modelNotAllowedError) Error() string {
+	return fmt.Sprintf("this key is not allowed to use model %q", e.model)
+}
+
+// resolveErrorStatus maps a resolveUpstream error to a status code and a
+// client-facing message.
+func resolveErrorStatus(err error) (int, string) {
+	var ue *unavailableError
+	if errors.As(err, &ue) {
+		return http.StatusServiceUnavailable, ue.Error()
+	}
+	var re *regionError
+	if errors.As(err, &re) {
+		return http.StatusForbidden, re.Error()
+	}
+	var me *modelNotAllowedError
+	if errors.As(err, &me) {
+		return http.StatusForbidden, me.Error()
+	}
+	return http.StatusInternalServerError, "Failed to resolve upstream"
 }
 
 // HandleAnthropic proxies Anthropic /v1/messages requests. Depending on the
 // upstream format, it either passes through natively or translates to OpenAI.
 func (h *Handler) HandleAnthropic(w http.ResponseWriter, r *http.Request) {
+	h.withGuardrails(w, r, guardAnthropic, func(w http.ResponseWriter, r *http.Request) {
+		h.withFailover(w, r, h.handleAnthropic)
+	})
+}
+
+func (h *Handler) handleAnthropic(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
+	w, closeStream := h.streamWriter(w, r, anthropicPing)
+	defer closeStream()
 	keyID := auth.GetKeyIDFromContext(r.Context())
 
 	// Read the request body. Pre-allocates when Content-Length is known.
@@ -63,40 +267,131 @@ func (h *Handler) HandleAnthropic(w http.ResponseWriter, r *http.Request) {
 	// Lazy-extract only model and stream — avoids full parse of large payloads
 	// (100KB+ system prompts, tools, conversation history).
 	model, stream, err := extractModelAndStream(body)
+	if errors.Is(err, errDuplicateModel) {
+		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", duplicateModelMessage)
+		return
+	}
 	if err != nil {
 		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
 		return
 	}
+	r = h.withRequestMetadata(r, body)
+	var clientBetas []string
+	if clientBetas, body, err = requestBetas(r.Header, body); err != nil {
+		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
+		return
+	}
+
+	priority, ok := requestPriority(r)
+	if !ok {
+		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", invalidPriorityMessage)
+		return
+	}
+	r = withPriority(r, priority)
+
+	var msg string
+	if r, body, msg = h.applyImageLimits(r, body); msg != "" {
+		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", msg)
+		return
+	}
+
+	// Apply admission policies before dispatch.
+	decision := h.admit(r, model, "anthropic", int64(len(body)))
+	r = withCanaryArm(r, decision)
+	if decision.Denied {
+		h.logDenied(r, decision, model, "anthropic", start)
+		writeAnthropicError(w, http.StatusForbidden, "permission_error", decision.Message)
+		return
+	}
+	if decision.Filtered {
+		h.logFiltered(r, decision, model, "anthropic", start)
+		writeAnthropicFiltered(w, model, decision.Message, stream)
+		return
+	}
+	if body, err = applyDecision(body, decision, "max_tokens"); err != nil {
+		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
+		return
+	}
+	if decision.Model != "" {
+		model = decision.Model
+	}
+
+	// A router model is served by the model it picks for the request.
+	var routed bool
+	if r, model, routed, err = h.routeModel(r, model, body); err != nil {
+		status, msg := resolveErrorStatus(err)
+		h.logRejected(r, model, "anthropic", status, msg, start)
+		writeAnthropicError(w, status, "permission_error", msg)
+		return
+	}
+	if routed {
+		if body, err = setRequestModel(body, model); err != nil {
+			writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
+			return
+		}
+	}
 
 	// Resolve which upstream to use based on the model.
 	upstream, err := h.resolveUpstream(r.Context(), model)
 	if err != nil {
-		writeAnthropicError(w, http.StatusInternalServerError, "api_error", "Failed to resolve upstream")
+		status, msg := resolveErrorStatus(err)
+		if status == http.StatusForbidden {
+			h.logRejected(r, model, "anthropic", status, msg, start)
+			writeAnthropicError(w, status, "permission_error", msg)
+			return
+		}
+		writeAnthropicError(w, status, "api_error", msg)
+		return
+	}
+	r = withTranslationPath(r, upstream.format, upstream.format == "openai")
+	r = withRequestLogger(r, upstream)
+	betas := upstreamBetas(clientBetas, upstream.betas)
+	if upstream.model != model {
+		if body, err = setRequestModel(body, upstream.model); err != nil {
+			writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
+			return
+		}
+		model = upstream.model
+	}
+
+	// Anthropic rejects requests without max_tokens; fill it in for clients
+	// that leave it out rather than surfacing the upstream's 400.
+	if upstream.format != "openai" {
+		if body, err = h.applyDefaultMaxTokens(body, upstream); err != nil {
+			writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
+			return
+		}
+	}
+
+	if msg := checkAnthropicLimits(upstream, model, body); msg != "" {
+		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", msg)
 		return
 	}
 
 	if upstream.format == "openai" {
+		if r.URL.Path != "/v1/messages" {
+			writeAnthropicError(w, http.StatusNotFound, "not_found_error", "This endpoint is only available for Anthropic-format upstreams")
+			return
+		}
 		// Translation path — full parse required.
 		var anthropicReq translate.AnthropicRequest
 		if err := json.Unmarshal(body, &anthropicReq); err != nil {
 			writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
 			return
 		}
+		anthropicReq.InterleavedThinking = hasBeta(betas, "interleaved-thinking")
 		h.handleAnthropicToOpenAI(w, r, upstream, body, &anthropicReq, keyID, start)
 	} else {
 		// Native passthrough — no full parse needed.
-		h.handleAnthropicNative(w, r, upstream, body, model, stream, keyID, start)
+		h.handleAnthropicNative(w, r, upstream, body, model, stream, betas, keyID, start)
 	}
 }
 
-// extractModelAndStream uses sonic's lazy parser to pull out just "model" and
-// "stream" from the request JSON without deserializing the full body.
+// extractModelAndStream pulls out just "model" and "stream" from the request
+// JSON without deserializing the full body. Like extractModel, it rejects a
+// body that names its model more than once.
 func extractModelAndStream(body []byte) (string, bool, error) {
-	modelNode, err := json.Get(body, "model")
-	if err != nil {
-		return "", false, err
-	}
-	model, err := modelNode.String()
+	model, err := extractModel(body)
 	if err != nil {
 		return "", false, err
 	}
@@ -105,14 +400,41 @@ func extractModelAndStream(body []byte) (string, bool, error) {
 	return model, stream, nil
 }
 
+// anthropicQueryAllowlist lists the client query parameters forwarded to
+// Anthropic-format upstreams (e.g. ?beta=true); everything else is dropped.
+var anthropicQueryAllowlist = map[string]bool{
+	"beta": true,
+}
+
+// anthropicUpstreamPath returns the upstream path for a native Anthropic
+// request: the client's path, so sub-resources under /v1/messages keep
+// working, plus any allowlisted query parameters.
+func anthropicUpstreamPath(u *url.URL) string {
+	p := path.Clean(u.Path)
+	if p != "/v1/messages" && !strings.HasPrefix(p, "/v1/messages/") {
+		p = "/v1/messages"
+	}
+
+	query := url.Values{}
+	for k, v := range u.Query() {
+		if anthropicQueryAllowlist[k] {
+			query[k] = v
+		}
+	}
+	if len(query) > 0 {
+		p += "?" + query.Encode()
+	}
+	return p
+}
+
 // handleAnthropicNative passes the request through to an Anthropic-format
-// upstream using x-api-key auth.
-func (h *Handler) handleAnthropicNative(w http.ResponseWriter, r *http.Request, upstream *upstreamInfo, body []byte, model string, stream bool, keyID uuid.UUID, start time.Time) {
+// upstream using x-api-key auth, with betas as its anthropic-beta header.
+func (h *Handler) handleAnthropicNative(w http.ResponseWriter, r *http.Request, upstream *upstreamInfo, body []byte, model string, stream bool, betas []string, keyID uuid.UUID, start time.Time) {
 	upstreamID := &upstream.id
-	extraHeaders := http.Header{
+	extraHeaders := withBetaHeader(http.Header{
 		"X-Api-Key":         {upstream.client.apiKey},
 		"Anthropic-Version": {"2023-06-01"},
-	}
+	}, betas)
 	// Strip unsupported fields (e.g. cache_control.scope) that some
 	// upstreams reject. Cheap no-op when the field isn't present.
 	body = sanitizeAnthropicBody(body)
@@ -125,11 +447,20 @@ func (h *Handler) handleAnthropicNative(w http.ResponseWriter, r *http.Request,
 	// have no valid signature and cause upstream validation errors.
 	// Anthropic re-derives thinking from context, so stripping is safe.
 	body = stripThinkingBlocks(body)
+	r, body = injectCacheControl(r, body)
+	if tier := serviceTier(r, upstream); tier != "" {
+		var err error
+		if body, err = setServiceTier(body, tier); err != nil {
+			writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
+			return
+		}
+	}
 	overheadUS := int(time.Since(start).Microseconds())
-	upstreamResp, err := upstream.client.DoRaw(r.Context(), "POST", "/v1/messages", bytes.NewReader(body), extraHeaders)
+	extraHeaders = acceptCompressed(extraHeaders, upstream, stream)
+	upstreamResp, err := upstream.client.DoRaw(r.Context(), "POST", anthropicUpstreamPath(r.URL), bytes.NewReader(body), extraHeaders)
 	if err != nil {
 		latency := time.Since(start)
-		h.logger.Log(&logging.LogEntry{
+		h.log(r, &logging.LogEntry{
 			KeyID:        keyID,
 			Timestamp:    start,
 			Method:       r.Method,
@@ -137,22 +468,26 @@ func (h *Handler) handleAnthropicNative(w http.ResponseWriter, r *http.Request,
 			Model:        model,
 			InputFormat:  "anthropic",
 			UpstreamID:   upstreamID,
+			Region:       upstream.region,
 			StatusCode:   http.StatusBadGateway,
 			LatencyMS:    int(latency.Milliseconds()),
 			OverheadUS:   overheadUS,
 			ErrorMessage: "upstream connection error: " + err.Error(),
+			ErrorCode:    transportErrorCode(err),
 		})
 		writeAnthropicError(w, http.StatusBadGateway, "api_error", "Failed to connect to upstream")
 		return
 	}
 	defer upstreamResp.Body.Close()
+	setGatewayHeaders(w, r, upstream.id, model, overheadUS, stream)
 
 	// Handle upstream errors — pass through as-is.
 	if upstreamResp.StatusCode >= 400 {
 		upstreamBody, _ := io.ReadAll(upstreamResp.Body)
+		perr := classifyProviderError(upstreamResp.StatusCode, upstreamBody)
 
 		latency := time.Since(start)
-		h.logger.Log(&logging.LogEntry{
+		h.log(r, &logging.LogEntry{
 			KeyID:        keyID,
 			Timestamp:    start,
 			Method:       r.Method,
@@ -160,11 +495,17 @@ func (h *Handler) handleAnthropicNative(w http.ResponseWriter, r *http.Request,
 			Model:        model,
 			InputFormat:  "anthropic",
 			UpstreamID:   upstreamID,
+			Region:       upstream.region,
 			StatusCode:   upstreamResp.StatusCode,
 			LatencyMS:    int(latency.Milliseconds()),
 			OverheadUS:   overheadUS,
-			ErrorMessage: string(upstreamBody),
+			ErrorMessage: perr.logMessage(upstreamBody),
+			ErrorCode:    perr.errorCode(),
 		})
+		if perr != nil {
+			perr.writeAnthropic(w, upstreamResp.StatusCode)
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(upstreamResp.StatusCode)
@@ -184,11 +525,15 @@ func (h *Handler) handleAnthropicNative(w http.ResponseWriter, r *http.Request,
 			return
 		}
 
-		result := passthroughAnthropicStream(upstreamResp.Body, w, flusher)
+		body := upstream.watchStream(upstreamResp.Body)
+		result := passthroughAnthropicStream(slogger.FromContext(r.Context()), body, w, flusher, upstream.maxSSEFrame)
+		body.Close()
 
 		latency := time.Since(start)
-		cost := h.billing.CalculateCost(model, result.InputTokens, result.OutputTokens)
-		h.logger.Log(&logging.LogEntry{
+		cost := h.billing.CalculateCost(model, result.InputTokens, result.OutputTokens, result.ReasoningTokens) +
+			h.billing.WebSearchCost(model, result.WebSearchRequests)
+		setUsageHeaders(w, r, cost, result.InputTokens, result.OutputTokens)
+		h.log(r, &logging.LogEntry{
 			KeyID:               keyID,
 			Timestamp:           start,
 			Method:              r.Method,
@@ -196,14 +541,21 @@ func (h *Handler) handleAnthropicNative(w http.ResponseWriter, r *http.Request,
 			Model:               model,
 			InputFormat:         "anthropic",
 			UpstreamID:          upstreamID,
+			Region:              upstream.region,
 			StatusCode:          http.StatusOK,
+			Stream:              true,
 			LatencyMS:           int(latency.Milliseconds()),
 			OverheadUS:          overheadUS,
 			InputTokens:         result.InputTokens,
 			OutputTokens:        result.OutputTokens,
+			ReasoningTokens:     result.ReasoningTokens,
 			CacheCreationTokens: result.CacheCreationTokens,
 			CacheReadTokens:     result.CacheReadTokens,
+			ToolCalls:           result.ToolCalls,
+			WebSearchRequests:   result.WebSearchRequests,
 			Cost:                cost,
+			ErrorMessage:        body.errorMessage(),
+			ErrorCode:           body.errorCode(),
 		})
 		return
 	}
@@ -219,12 +571,15 @@ func (h *Handler) handleAnthropicNative(w http.ResponseWriter, r *http.Request,
 	if err := json.Unmarshal(upstreamBody, &anthropicResp); err == nil {
 		inputTokens := anthropicResp.Usage.InputTokens
 		outputTokens := anthropicResp.Usage.OutputTokens
+		reasoningTokens := anthropicResp.ThinkingTokens()
 		cacheCreation := anthropicResp.Usage.CacheCreationInputTokens
 		cacheRead := anthropicResp.Usage.CacheReadInputTokens
+		webSearches := anthropicResp.Usage.ServerToolUse.WebSearches()
 
 		latency := time.Since(start)
-		cost := h.billing.CalculateCost(model, inputTokens, outputTokens)
-		h.logger.Log(&logging.LogEntry{
+		cost := h.billing.CalculateCost(model, inputTokens, outputTokens, reasoningTokens) + h.billing.WebSearchCost(model, webSearches)
+		setUsageHeaders(w, r, cost, inputTokens, outputTokens)
+		h.log(r, &logging.LogEntry{
 			KeyID:               keyID,
 			Timestamp:           start,
 			Method:              r.Method,
@@ -232,13 +587,17 @@ func (h *Handler) handleAnthropicNative(w http.ResponseWriter, r *http.Request,
 			Model:               model,
 			InputFormat:         "anthropic",
 			UpstreamID:          upstreamID,
+			Region:              upstream.region,
 			StatusCode:          http.StatusOK,
 			LatencyMS:           int(latency.Milliseconds()),
 			OverheadUS:          overheadUS,
 			InputTokens:         inputTokens,
 			OutputTokens:        outputTokens,
+			ReasoningTokens:     reasoningTokens,
 			CacheCreationTokens: cacheCreation,
 			CacheReadTokens:     cacheRead,
+			ToolCalls:           countToolUses(anthropicResp.Content),
+			WebSearchRequests:   webSearches,
 			Cost:                cost,
 		})
 	}
@@ -252,23 +611,39 @@ func (h *Handler) handleAnthropicNative(w http.ResponseWriter, r *http.Request,
 // sends it to the upstream, and translates the response back.
 func (h *Handler) handleAnthropicToOpenAI(w http.ResponseWriter, r *http.Request, upstream *upstreamInfo, body []byte, anthropicReq *translate.AnthropicRequest, keyID uuid.UUID, start time.Time) {
 	upstreamID := &upstream.id
+	span := startTranslate(r.Context(), "anthropic", "openai")
 	openaiReq, err := translate.AnthropicRequestToOpenAI(anthropicReq)
+	tracing.EndWithError(span, err)
 	if err != nil {
 		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "Failed to translate request: "+err.Error())
 		return
 	}
+	h.metadataMap.ToOpenAI(anthropicReq.Metadata, openaiReq)
+	translate.MapRoles(openaiReq.Messages, upstream.roles)
+	// The upstream drops cache_control; record what it marked, to set
+	// against the cached tokens the upstream reports.
+	if p := translate.EstimateCachePrefix(anthropicReq); p.Breakpoints > 0 {
+		t := requestLogTags(r)
+		t.cachePrefix = &p
+		r = withLogTags(r, t)
+	}
 
 	openaiBody, err := json.Marshal(openaiReq)
+	if err == nil {
+		if tier := serviceTier(r, upstream); tier != "" {
+			openaiBody, err = setServiceTier(openaiBody, tier)
+		}
+	}
 	if err != nil {
 		writeAnthropicError(w, http.StatusInternalServerError, "api_error", "Failed to encode translated request")
 		return
 	}
 
 	overheadUS := int(time.Since(start).Microseconds())
-	upstreamResp, err := upstream.client.Do(r.Context(), "POST", "/v1/chat/completions", bytes.NewReader(openaiBody), nil)
+	upstreamResp, err := upstream.client.Do(r.Context(), "POST", "/v1/chat/completions", bytes.NewReader(openaiBody), acceptCompressed(nil, upstream, anthropicReq.Stream))
 	if err != nil {
 		latency := time.Since(start)
-		h.logger.Log(&logging.LogEntry{
+		h.log(r, &logging.LogEntry{
 			KeyID:        keyID,
 			Timestamp:    start,
 			Method:       r.Method,
@@ -276,21 +651,25 @@ func (h *Handler) handleAnthropicToOpenAI(w http.ResponseWriter, r *http.Request
 			Model:        anthropicReq.Model,
 			InputFormat:  "anthropic",
 			UpstreamID:   upstreamID,
+			Region:       upstream.region,
 			StatusCode:   http.StatusBadGateway,
 			LatencyMS:    int(latency.Milliseconds()),
 			OverheadUS:   overheadUS,
 			ErrorMessage: "upstream connection error: " + err.Error(),
+			ErrorCode:    transportErrorCode(err),
 		})
 		writeAnthropicError(w, http.StatusBadGateway, "api_error", "Failed to connect to upstream")
 		return
 	}
 	defer upstreamResp.Body.Close()
+	setGatewayHeaders(w, r, upstream.id, anthropicReq.Model, overheadUS, anthropicReq.Stream)
 
 	// Handle upstream errors.
 	if upstreamResp.StatusCode >= 400 {
 		upstreamBody, _ := io.ReadAll(upstreamResp.Body)
+		perr := classifyProviderError(upstreamResp.StatusCode, upstreamBody)
 		latency := time.Since(start)
-		h.logger.Log(&logging.LogEntry{
+		h.log(r, &logging.LogEntry{
 			KeyID:        keyID,
 			Timestamp:    start,
 			Method:       r.Method,
@@ -298,11 +677,17 @@ func (h *Handler) handleAnthropicToOpenAI(w http.ResponseWriter, r *http.Request
 			Model:        anthropicReq.Model,
 			InputFormat:  "anthropic",
 			UpstreamID:   upstreamID,
+			Region:       upstream.region,
 			StatusCode:   upstreamResp.StatusCode,
 			LatencyMS:    int(latency.Milliseconds()),
 			OverheadUS:   overheadUS,
-			ErrorMessage: string(upstreamBody),
+			ErrorMessage: perr.logMessage(upstreamBody),
+			ErrorCode:    perr.errorCode(),
 		})
+		if perr != nil {
+			perr.writeAnthropic(w, upstreamResp.StatusCode)
+			return
+		}
 		writeAnthropicError(w, upstreamResp.StatusCode, "api_error", "Upstream error: "+string(upstreamBody))
 		return
 	}
@@ -319,21 +704,33 @@ func (h *Handler) handleAnthropicToOpenAI(w http.ResponseWriter, r *http.Request
 			return
 		}
 
-		result, _ := translate.TranslateOpenAIStreamToAnthropic(r.Context(), upstreamResp.Body, w, flusher, anthropicReq.Model)
+		body := upstream.watchStream(upstreamResp.Body)
+		result, _ := translate.TranslateOpenAIStreamToAnthropic(r.Context(), body, w, flusher, anthropicReq.Model, translate.EstimateInputTokens(anthropicReq), anthropicReq.InterleavedThinking, translate.AnthropicPrefill(anthropicReq), anthropicReq.StopSequences, upstream.maxSSEFrame)
+		body.Close()
 
 		latency := time.Since(start)
 		inputTokens := 0
 		outputTokens := 0
+		reasoningTokens := 0
 		cacheCreationTokens := 0
 		cacheReadTokens := 0
+		toolCalls := 0
+		var metadata map[string]interface{}
 		if result != nil {
 			inputTokens = result.InputTokens
 			outputTokens = result.OutputTokens
+			reasoningTokens = result.ReasoningTokens
 			cacheCreationTokens = result.CacheCreationTokens
 			cacheReadTokens = result.CacheReadTokens
+			toolCalls = result.ToolCalls
+			// The stream ended mid tool call and its arguments were closed.
+			if result.RepairedToolCalls > 0 {
+				metadata = map[string]interface{}{"repaired_tool_calls": result.RepairedToolCalls}
+			}
 		}
-		cost := h.billing.CalculateCost(anthropicReq.Model, inputTokens, outputTokens)
-		h.logger.Log(&logging.LogEntry{
+		cost := h.billing.CalculateCost(anthropicReq.Model, inputTokens, outputTokens, reasoningTokens)
+		setUsageHeaders(w, r, cost, inputTokens, outputTokens)
+		h.log(r, &logging.LogEntry{
 			KeyID:               keyID,
 			Timestamp:           start,
 			Method:              r.Method,
@@ -341,14 +738,21 @@ func (h *Handler) handleAnthropicToOpenAI(w http.ResponseWriter, r *http.Request
 			Model:               anthropicReq.Model,
 			InputFormat:         "anthropic",
 			UpstreamID:          upstreamID,
+			Region:              upstream.region,
 			StatusCode:          http.StatusOK,
+			Stream:              true,
 			LatencyMS:           int(latency.Milliseconds()),
 			OverheadUS:          overheadUS,
 			InputTokens:         inputTokens,
 			OutputTokens:        outputTokens,
+			ReasoningTokens:     reasoningTokens,
 			CacheCreationTokens: cacheCreationTokens,
 			CacheReadTokens:     cacheReadTokens,
+			ToolCalls:           toolCalls,
 			Cost:                cost,
+			ErrorMessage:        body.errorMessage(),
+			ErrorCode:           body.errorCode(),
+			RequestMetadata:     metadata,
 		})
 		return
 	}
@@ -366,7 +770,7 @@ func (h *Handler) handleAnthropicToOpenAI(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	anthropicResp, err := translate.OpenAIResponseToAnthropic(&oaiResp, anthropicReq.Model)
+	anthropicResp, err := translate.OpenAIResponseToAnthropic(&oaiResp, anthropicReq.Model, translate.AnthropicPrefill(anthropicReq), anthropicReq.StopSequences)
 	if err != nil {
 		writeAnthropicError(w, http.StatusBadGateway, "api_error", "Failed to translate upstream response")
 		return
@@ -374,6 +778,7 @@ func (h *Handler) handleAnthropicToOpenAI(w http.ResponseWriter, r *http.Request
 	inputTokens := 0
 	outputTokens := 0
 	cacheReadTokens := 0
+	reasoningTokens := translate.OpenAIReasoningTokens(oaiResp.Usage)
 	if oaiResp.Usage != nil {
 		inputTokens = oaiResp.Usage.PromptTokens
 		outputTokens = oaiResp.Usage.CompletionTokens
@@ -384,8 +789,9 @@ func (h *Handler) handleAnthropicToOpenAI(w http.ResponseWriter, r *http.Request
 	}
 
 	latency := time.Since(start)
-	cost := h.billing.CalculateCost(anthropicReq.Model, inputTokens, outputTokens)
-	h.logger.Log(&logging.LogEntry{
+	cost := h.billing.CalculateCost(anthropicReq.Model, inputTokens, outputTokens, reasoningTokens)
+	setUsageHeaders(w, r, cost, inputTokens, outputTokens)
+	h.log(r, &logging.LogEntry{
 		KeyID:           keyID,
 		Timestamp:       start,
 		Method:          r.Method,
@@ -393,12 +799,15 @@ func (h *Handler) handleAnthropicToOpenAI(w http.ResponseWriter, r *http.Request
 		Model:           anthropicReq.Model,
 		InputFormat:     "anthropic",
 		UpstreamID:      upstreamID,
+		Region:          upstream.region,
 		StatusCode:      http.StatusOK,
 		LatencyMS:       int(latency.Milliseconds()),
 		OverheadUS:      overheadUS,
 		InputTokens:     inputTokens,
 		OutputTokens:    outputTokens,
+		ReasoningTokens: reasoningTokens,
 		CacheReadTokens: cacheReadTokens,
+		ToolCalls:       countToolUses(anthropicResp.Content),
 		Cost:            cost,
 	})
 
@@ -414,28 +823,33 @@ type streamUsage struct {
 	OutputTokens        int
 	CacheCreationTokens int
 	CacheReadTokens     int
+	ReasoningTokens     int // estimated from the thinking deltas
+	ToolCalls           int
+	WebSearchRequests   int
 }
 
 var newline = []byte("\n")
 
 // passthroughAnthropicStream forwards Anthropic SSE events to the client
 // while extracting usage information from message_start and message_delta events.
-func passthroughAnthropicStream(upstream io.Reader, w http.ResponseWriter, flusher http.Flusher) streamUsage {
+// A line longer than maxFrame or a stalled upstream ends the stream with an
+// error event.
+func passthroughAnthropicStream(lg *slog.Logger, upstream io.Reader, w http.ResponseWriter, flusher http.Flusher, maxFrame int) streamUsage {
 	var usage streamUsage
+	thinkingBytes := 0
 
-	scanner := bufio.NewScanner(upstream)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	scanner := translate.NewSSEScanner(upstream, maxFrame)
 
 	for scanner.Scan() {
 		line := scanner.Bytes()
 
 		// Pass every line through as-is.
 		if _, err := w.Write(line); err != nil {
-			log.Printf("anthropic stream write error: %v", err)
+			lg.Warn("anthropic stream write error", "error", err)
 			break
 		}
 		if _, err := w.Write(newline); err != nil {
-			log.Printf("anthropic stream write error: %v", err)
+			lg.Warn("anthropic stream write error", "error", err)
 			break
 		}
 
@@ -452,36 +866,68 @@ func passthroughAnthropicStream(upstream io.Reader, w http.ResponseWriter, flush
 		}
 		data := line[6:]
 
-		// Only parse the two event types that carry usage — skip content_block_delta,
-		// content_block_start, content_block_stop, ping, etc.
+		// Only parse the event types that carry usage, start a tool_use
+		// block or carry thinking — skip text deltas, content_block_stop,
+		// ping, etc.
 		if bytes.Contains(data, []byte(`"message_start"`)) {
 			var msgStart translate.MessageStartEvent
 			if json.Unmarshal(data, &msgStart) == nil && msgStart.Type == "message_start" {
 				usage.InputTokens = msgStart.Message.Usage.InputTokens
 				usage.CacheCreationTokens = msgStart.Message.Usage.CacheCreationInputTokens
 				usage.CacheReadTokens = msgStart.Message.Usage.CacheReadInputTokens
+				usage.WebSearchRequests = msgStart.Message.Usage.ServerToolUse.WebSearches()
 			}
 		} else if bytes.Contains(data, []byte(`"message_delta"`)) {
 			var msgDelta struct {
 				Type  string `json:"type"`
 				Usage *struct {
-					OutputTokens int `json:"output_tokens"`
+					OutputTokens  int                        `json:"output_tokens"`
+					ServerToolUse *translate.ServerToolUsage `json:"server_tool_use"`
 				} `json:"usage"`
 			}
 			if json.Unmarshal(data, &msgDelta) == nil && msgDelta.Type == "message_delta" && msgDelta.Usage != nil {
 				usage.OutputTokens = msgDelta.Usage.OutputTokens
+				// Cumulative, like output_tokens; absent until a search ran.
+				if msgDelta.Usage.ServerToolUse != nil {
+					usage.WebSearchRequests = msgDelta.Usage.ServerToolUse.WebSearchRequests
+				}
+			}
+		} else if bytes.Contains(data, []byte(`"content_block_start"`)) && bytes.Contains(data, []byte(`"tool_use"`)) {
+			var blockStart translate.ContentBlockStartEvent
+			if json.Unmarshal(data, &blockStart) == nil && blockStart.ContentBlock.Type == "tool_use" {
+				usage.ToolCalls++
+			}
+		} else if bytes.Contains(data, []byte(`"thinking_delta"`)) {
+			var delta translate.ContentBlockDeltaEvent
+			if json.Unmarshal(data, &delta) == nil && delta.Delta.Type == "thinking_delta" {
+				thinkingBytes += len(delta.Delta.Thinking)
 			}
 		}
 	}
+	usage.ReasoningTokens = translate.ThinkingTokens(thinkingBytes, usage.OutputTokens)
 
 	if err := scanner.Err(); err != nil {
-		log.Printf("anthropic stream read error: %v", err)
+		lg.Warn("anthropic stream read error", "error", err)
+		if msg, ok := translate.StreamErrorMessage(err, maxFrame); ok {
+			translate.WriteAnthropicStreamError(w, flusher, msg)
+		}
 	}
 
 	flusher.Flush()
 	return usage
 }
 
+// countToolUses returns the number of tool_use blocks in an Anthropic response.
+func countToolUses(content []translate.ContentBlock) int {
+	n := 0
+	for _, block := range content {
+		if block.Type == "tool_use" {
+			n++
+		}
+	}
+	return n
+}
+
 // sanitizeAnthropicBody strips fields from cache_control objects that some
 // upstreams don't support (e.g. the "scope" field). Returns the body unchanged
 // when no "scope" is present — the bytes.Contains check makes this a no-op
@@ -643,8 +1089,8 @@ func stripThinkingBlocks(body []byte) []byte {
 	modified := false
 	for i, msgRaw := range messages {
 		var msg struct {
-			Role    string              `json:"role"`
-			Content stdjson.RawMessage  `json:"content"`
+			Role    string             `json:"role"`
+			Content stdjson.RawMessage `json:"content"`
 		}
 		if err := json.Unmarshal(msgRaw, &msg); err != nil || msg.Role != "assistant" {
 			continue
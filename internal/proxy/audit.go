@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/logging"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// AuditOpts configures quality audit sampling.
+type AuditOpts struct {
+	DefaultPercent float64 // sampled where no rule applies, 0-100
+	MaxBytes       int     // bytes kept of each body; 0 disables sampling
+}
+
+// AuditSampler picks requests to capture in full for quality audits, by
+// the audit rules of their key and model. Rules are reloaded from the
+// store every interval, and on Reload after a change through the
+// management API.
+type AuditSampler struct {
+	store    store.Store
+	interval time.Duration
+	opts     AuditOpts
+	set      atomic.Pointer[auditRuleSet]
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type auditRuleSet struct {
+	anyKey []store.AuditRule               // rules for every key
+	byKey  map[uuid.UUID][]store.AuditRule // rules for one key
+}
+
+// NewAuditSampler loads the audit rules and reloads them every interval.
+// Call Close to stop it.
+func NewAuditSampler(s store.Store, interval time.Duration, opts AuditOpts) *AuditSampler {
+	a := &AuditSampler{
+		store:    s,
+		interval: interval,
+		opts:     opts,
+		done:     make(chan struct{}),
+	}
+	a.set.Store(&auditRuleSet{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := a.Reload(ctx); err != nil {
+		log.Printf("audit rules: initial load failed: %v", err)
+	}
+	cancel()
+
+	a.wg.Add(1)
+	go a.worker()
+	return a
+}
+
+func (a *AuditSampler) Close() {
+	close(a.done)
+	a.wg.Wait()
+}
+
+func (a *AuditSampler) worker() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := a.Reload(ctx); err != nil {
+				log.Printf("audit rules: reload failed: %v", err)
+			}
+			cancel()
+		case <-a.done:
+			return
+		}
+	}
+}
+
+// Reload replaces the rules with those in the store.
+func (a *AuditSampler) Reload(ctx context.Context) error {
+	rules, err := a.store.ListAuditRules(ctx)
+	if err != nil {
+		return err
+	}
+	set := &auditRuleSet{byKey: make(map[uuid.UUID][]store.AuditRule)}
+	for _, r := range rules {
+		if r.KeyID == nil {
+			set.anyKey = append(set.anyKey, r)
+		} else {
+			set.byKey[*r.KeyID] = append(set.byKey[*r.KeyID], r)
+		}
+	}
+	a.set.Store(set)
+	return nil
+}
+
+// SetAuditSampler samples requests for quality audits with a.
+func (h *Handler) SetAuditSampler(a *AuditSampler) {
+	h.audit = a
+}
+
+// mayCapture reports whether any request of a key could be sampled, so
+// that its bodies have to be captured until its model is known.
+func (a *AuditSampler) mayCapture(keyID uuid.UUID) bool {
+	if a == nil || a.opts.MaxBytes <= 0 {
+		return false
+	}
+	if a.opts.DefaultPercent > 0 {
+		return true
+	}
+	set := a.set.Load()
+	for _, rules := range [][]store.AuditRule{set.byKey[keyID], set.anyKey} {
+		for _, r := range rules {
+			if r.Percent > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rate returns the sampling rate for a key's requests for model and the
+// rule that sets it, nil for the default. The most specific rule wins: key
+// and model, then key, then model.
+func (a *AuditSampler) rate(keyID uuid.UUID, model string) (float64, *store.AuditRule) {
+	set := a.set.Load()
+	var keyOnly *store.AuditRule
+	for i, r := range set.byKey[keyID] {
+		switch {
+		case strings.EqualFold(r.Model, model):
+			return r.Percent, &set.byKey[keyID][i]
+		case r.Model == "":
+			keyOnly = &set.byKey[keyID][i]
+		}
+	}
+	if keyOnly != nil {
+		return keyOnly.Percent, keyOnly
+	}
+	for i, r := range set.anyKey {
+		if r.Model != "" && strings.EqualFold(r.Model, model) {
+			return r.Percent, &set.anyKey[i]
+		}
+	}
+	return a.opts.DefaultPercent, nil
+}
+
+// sample returns the audit sample of the request logged as e, or nil if
+// it is not picked.
+func (a *AuditSampler) sample(e *logging.LogEntry, request, response *cappedBuffer) *store.AuditSample {
+	percent, rule := a.rate(e.KeyID, e.Model)
+	if percent <= 0 || rand.Float64()*100 >= percent {
+		return nil
+	}
+	keyID := e.KeyID
+	s := &store.AuditSample{
+		Percent:        percent,
+		KeyID:          &keyID,
+		Model:          e.Model,
+		InputFormat:    e.InputFormat,
+		UpstreamFormat: e.UpstreamFormat,
+		Translated:     e.Translated,
+		StatusCode:     e.StatusCode,
+		LatencyMS:      e.LatencyMS,
+		InputTokens:    e.InputTokens,
+		OutputTokens:   e.OutputTokens,
+		Request:        payloadText(request.upTo(a.opts.MaxBytes)),
+		Response:       payloadText(response.upTo(a.opts.MaxBytes)),
+		RequestBytes:   request.total,
+		ResponseBytes:  response.total,
+	}
+	if rule != nil {
+		s.RuleID = &rule.ID
+	}
+	return s
+}
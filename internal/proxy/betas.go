@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	json "github.com/bytedance/sonic"
+
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// Clients enable Anthropic betas with anthropic-beta headers or a top-level
+// "betas" array in the request body, as some SDKs send them. Both are
+// merged into one list, the upstream's anthropic_betas defaults are added
+// and flags it does not allow are dropped; Anthropic-format upstreams then
+// get the result as a single anthropic-beta header.
+
+// requestBetas returns the beta flags of a request, from its anthropic-beta
+// headers and its body's "betas" array, and the body without that array.
+func requestBetas(h http.Header, body []byte) ([]string, []byte, error) {
+	var flags []string
+	for _, v := range h.Values("anthropic-beta") {
+		flags = appendBetas(flags, strings.Split(v, ",")...)
+	}
+
+	if node, err := json.Get(body, "betas"); err != nil || !node.Exists() {
+		return flags, body, nil
+	}
+	var req map[string]any
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, nil, err
+	}
+	if list, ok := req["betas"].([]any); ok {
+		for _, v := range list {
+			if s, ok := v.(string); ok {
+				flags = appendBetas(flags, s)
+			}
+		}
+	}
+	delete(req, "betas")
+	body, err := json.Marshal(req)
+	return flags, body, err
+}
+
+// appendBetas adds flags to list, trimmed, skipping empty ones and
+// duplicates.
+func appendBetas(list []string, flags ...string) []string {
+	for _, f := range flags {
+		f = strings.TrimSpace(f)
+		if f != "" && !containsBeta(list, f) {
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+func containsBeta(list []string, flag string) bool {
+	for _, f := range list {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// upstreamBetas merges the client's flags with the upstream's defaults and
+// drops the flags the upstream does not allow.
+func upstreamBetas(flags []string, cfg *store.AnthropicBetas) []string {
+	if cfg == nil {
+		return flags
+	}
+	merged := appendBetas(append([]string(nil), flags...), cfg.Default...)
+	if cfg.Allowed == nil {
+		return merged
+	}
+	out := merged[:0]
+	for _, f := range merged {
+		for _, allowed := range cfg.Allowed {
+			if strings.HasPrefix(f, allowed) {
+				out = append(out, f)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// hasBeta reports whether flags enable feature. Betas are dated
+// ("interleaved-thinking-2025-05-14"), so any version matches.
+func hasBeta(flags []string, feature string) bool {
+	for _, f := range flags {
+		if strings.HasPrefix(f, feature) {
+			return true
+		}
+	}
+	return false
+}
+
+// withBetaHeader sets the anthropic-beta header sent upstream, if there
+// are any flags.
+func withBetaHeader(h http.Header, flags []string) http.Header {
+	if len(flags) > 0 {
+		h.Set("Anthropic-Beta", strings.Join(flags, ","))
+	}
+	return h
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestRequestBetasMergesHeaderAndBody(t *testing.T) {
+	h := http.Header{}
+	h.Add("anthropic-beta", "prompt-caching-2024-07-31, interleaved-thinking-2025-05-14")
+	h.Add("anthropic-beta", "prompt-caching-2024-07-31")
+	body := []byte(`{"model":"claude","betas":["interleaved-thinking-2025-05-14","files-api-2025-04-14"],"max_tokens":10}`)
+
+	flags, out, err := requestBetas(h, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"prompt-caching-2024-07-31", "interleaved-thinking-2025-05-14", "files-api-2025-04-14"}
+	if !reflect.DeepEqual(flags, want) {
+		t.Fatalf("flags = %v, want %v", flags, want)
+	}
+	if strings.Contains(string(out), "betas") || !strings.Contains(string(out), `"max_tokens":10`) {
+		t.Fatalf("body not stripped of betas: %s", out)
+	}
+
+	// A body without betas is passed through untouched.
+	body = []byte(`{"model":"claude"}`)
+	if _, out, err := requestBetas(http.Header{}, body); err != nil || string(out) != string(body) {
+		t.Fatalf("body changed: %s, %v", out, err)
+	}
+}
+
+func TestUpstreamBetas(t *testing.T) {
+	client := []string{"interleaved-thinking-2025-05-14", "computer-use-2025-01-24"}
+
+	if got := upstreamBetas(client, nil); !reflect.DeepEqual(got, client) {
+		t.Fatalf("no config: %v", got)
+	}
+
+	cfg := &store.AnthropicBetas{Default: []string{"prompt-caching-2024-07-31"}}
+	want := []string{"interleaved-thinking-2025-05-14", "computer-use-2025-01-24", "prompt-caching-2024-07-31"}
+	if got := upstreamBetas(client, cfg); !reflect.DeepEqual(got, want) {
+		t.Fatalf("defaults: got %v, want %v", got, want)
+	}
+	if len(client) != 2 {
+		t.Fatalf("client flags modified: %v", client)
+	}
+
+	cfg.Allowed = []string{"interleaved-thinking", "prompt-caching"}
+	want = []string{"interleaved-thinking-2025-05-14", "prompt-caching-2024-07-31"}
+	if got := upstreamBetas(client, cfg); !reflect.DeepEqual(got, want) {
+		t.Fatalf("allowed: got %v, want %v", got, want)
+	}
+
+	cfg.Allowed = []string{}
+	if got := upstreamBetas(client, cfg); len(got) != 0 {
+		t.Fatalf("empty allow list kept %v", got)
+	}
+
+	h := withBetaHeader(http.Header{}, want)
+	if got := h.Get("anthropic-beta"); got != "interleaved-thinking-2025-05-14,prompt-caching-2024-07-31" {
+		t.Fatalf("header = %q", got)
+	}
+	if h := withBetaHeader(http.Header{}, nil); len(h) != 0 {
+		t.Fatalf("header set without flags: %v", h)
+	}
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+	"net/http"
+	"strings"
+
+	json "github.com/bytedance/sonic"
+
+	"github.com/sertdev/pxbin/internal/auth"
+)
+
+// ephemeralCacheControl is the prompt caching breakpoint injected for keys
+// with inject_cache_control.
+var ephemeralCacheControl = stdjson.RawMessage(`{"type":"ephemeral"}`)
+
+// injectCacheControl adds prompt caching breakpoints to an Anthropic request
+// body for keys with inject_cache_control, if the client set none: one on
+// the last tool definition and one on the last system block, so the tools
+// and system prompt, which rarely change between turns, are read from the
+// cache on the next request. Bodies that set cache_control anywhere are left
+// as the client sent them. The returned request is tagged so its log
+// entries can be told apart when measuring the savings.
+func injectCacheControl(r *http.Request, body []byte) (*http.Request, []byte) {
+	key := auth.GetKeyFromContext(r.Context())
+	if key == nil || !key.InjectCacheControl {
+		return r, body
+	}
+	injected, ok := addCacheBreakpoints(body)
+	if !ok {
+		return r, body
+	}
+	t := requestLogTags(r)
+	t.cacheInjected = true
+	return withLogTags(r, t), injected
+}
+
+// addCacheBreakpoints marks the last tool and the last system block of body
+// with an ephemeral cache_control. It returns false if body already has
+// breakpoints or has neither tools nor a system prompt.
+func addCacheBreakpoints(body []byte) ([]byte, bool) {
+	if bytes.Contains(body, []byte(`"cache_control"`)) {
+		return nil, false
+	}
+	var raw map[string]stdjson.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, false
+	}
+
+	changed := false
+	var tools []map[string]stdjson.RawMessage
+	if json.Unmarshal(raw["tools"], &tools) == nil && len(tools) > 0 && tools[len(tools)-1] != nil {
+		tools[len(tools)-1]["cache_control"] = ephemeralCacheControl
+		if b, err := json.Marshal(tools); err == nil {
+			raw["tools"], changed = b, true
+		}
+	}
+
+	// The system prompt is a string or a list of text blocks; only blocks
+	// carry cache_control.
+	var system []map[string]stdjson.RawMessage
+	var text string
+	if json.Unmarshal(raw["system"], &text) == nil {
+		if strings.TrimSpace(text) != "" {
+			system = []map[string]stdjson.RawMessage{{"type": stdjson.RawMessage(`"text"`), "text": raw["system"]}}
+		}
+	} else if json.Unmarshal(raw["system"], &system) != nil {
+		system = nil
+	}
+	if len(system) > 0 && system[len(system)-1] != nil {
+		system[len(system)-1]["cache_control"] = ephemeralCacheControl
+		if b, err := json.Marshal(system); err == nil {
+			raw["system"], changed = b, true
+		}
+	}
+
+	if !changed {
+		return nil, false
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
@@ -2,14 +2,18 @@ package proxy
 
 import (
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/scoreboard"
+	"github.com/sertdev/pxbin/internal/store"
 )
 
 type cachedClient struct {
 	client  *UpstreamClient
 	baseURL string
 	apiKey  string
+	opts    *UpstreamOpts
 }
 
 // ClientCache is a thread-safe cache of UpstreamClients keyed by upstream UUID.
@@ -18,9 +22,13 @@ type ClientCache struct {
 	mu           sync.RWMutex
 	clients      map[uuid.UUID]*cachedClient
 	upstreamOpts *UpstreamOpts
+	scores       *scoreboard.Board // seeds new clients' circuit breakers; nil for none
+
+	transportErrors TransportErrorCounter // passed to new clients; nil for none
 }
 
-// NewClientCache creates an empty ClientCache with optional resilience options.
+// NewClientCache creates an empty ClientCache with optional resilience
+// options, which upstreams' own resilience policies override.
 func NewClientCache(opts *UpstreamOpts) *ClientCache {
 	return &ClientCache{
 		clients:      make(map[uuid.UUID]*cachedClient),
@@ -28,26 +36,61 @@ func NewClientCache(opts *UpstreamOpts) *ClientCache {
 	}
 }
 
-// Get returns a cached client for the given upstream ID. If the cached client's
-// baseURL or apiKey differ from the provided values, it creates a new client.
-func (c *ClientCache) Get(id uuid.UUID, baseURL, apiKey string) *UpstreamClient {
+// Get returns a cached client for the given upstream ID. If the cached
+// client's baseURL, apiKey or resilience settings differ from the provided
+// values, it creates a new client.
+func (c *ClientCache) Get(id uuid.UUID, baseURL, apiKey string, policy *store.ResiliencePolicy) *UpstreamClient {
+	opts := c.optsFor(policy)
+
 	c.mu.RLock()
 	cached, ok := c.clients[id]
 	c.mu.RUnlock()
 
-	if ok && cached.baseURL == baseURL && cached.apiKey == apiKey {
+	if ok && cached.baseURL == baseURL && cached.apiKey == apiKey && cached.opts.equal(opts) {
 		return cached.client
 	}
 
-	client := NewUpstreamClient(baseURL, apiKey, c.upstreamOpts)
+	client := NewUpstreamClient(baseURL, apiKey, opts)
+	client.transportErrors = c.transportErrors
+	if client.cb != nil && c.scores != nil {
+		client.cb.Restore(c.scores.ConsecutiveFailures(id))
+	}
 
 	c.mu.Lock()
 	c.clients[id] = &cachedClient{
 		client:  client,
 		baseURL: baseURL,
 		apiKey:  apiKey,
+		opts:    opts,
 	}
 	c.mu.Unlock()
 
 	return client
 }
+
+// optsFor returns the cache's resilience options with policy applied.
+func (c *ClientCache) optsFor(policy *store.ResiliencePolicy) *UpstreamOpts {
+	if policy == nil {
+		return c.upstreamOpts
+	}
+	var opts UpstreamOpts
+	if c.upstreamOpts != nil {
+		opts = *c.upstreamOpts
+	}
+	if policy.CBFailureThreshold != nil {
+		opts.CBOpts.Threshold = *policy.CBFailureThreshold
+	}
+	if policy.CBTimeoutSeconds != nil {
+		opts.CBOpts.Timeout = time.Duration(*policy.CBTimeoutSeconds) * time.Second
+	}
+	if policy.RetryMaxAttempts != nil {
+		opts.RetryOpts.MaxAttempts = *policy.RetryMaxAttempts
+	}
+	if policy.RetryableStatusCodes != nil {
+		opts.RetryStatusCodes = policy.RetryableStatusCodes
+	}
+	if policy.RetryBudgetRatio != nil {
+		opts.RetryBudgetRatio = *policy.RetryBudgetRatio
+	}
+	return &opts
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/resilience"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestClientCacheResiliencePolicy(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1)%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	cache := NewClientCache(&UpstreamOpts{RetryOpts: resilience.RetryOpts{MaxAttempts: 1, BaseDelay: time.Millisecond}})
+	id := uuid.New()
+	do := func(c *UpstreamClient) (int, error) {
+		resp, err := c.Do(context.Background(), "POST", "/v1/chat/completions", bytes.NewReader([]byte(`{}`)), nil)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	// Without a policy, the global options apply: no retries, no breaker.
+	plain := cache.Get(id, srv.URL, "sk", nil)
+	if code, err := do(plain); err != nil || code != http.StatusServiceUnavailable {
+		t.Fatalf("expected a 503 without retries, got %d, %v", code, err)
+	}
+	if cache.Get(id, srv.URL, "sk", nil) != plain {
+		t.Fatal("expected the client to be reused")
+	}
+
+	policy := &store.ResiliencePolicy{RetryMaxAttempts: ptr(3), RetryableStatusCodes: []int{503}}
+	retrying := cache.Get(id, srv.URL, "sk", policy)
+	if retrying == plain {
+		t.Fatal("expected a new client when the policy changes")
+	}
+	calls.Store(0)
+	if code, err := do(retrying); err != nil || code != http.StatusOK || calls.Load() != 3 {
+		t.Fatalf("expected 503s to be retried until a 200, got %d, %v after %d calls", code, err, calls.Load())
+	}
+
+	// A status that outlasts the retries is returned, and counts against
+	// the breaker.
+	policy = &store.ResiliencePolicy{CBFailureThreshold: ptr(1), CBTimeoutSeconds: ptr(60), RetryMaxAttempts: ptr(2), RetryableStatusCodes: []int{503}}
+	breaking := cache.Get(id, srv.URL, "sk", policy)
+	calls.Store(0)
+	if code, err := do(breaking); err != nil || code != http.StatusServiceUnavailable || calls.Load() != 2 {
+		t.Fatalf("expected the last 503 after 2 calls, got %d, %v after %d calls", code, err, calls.Load())
+	}
+	if _, err := do(breaking); !errors.Is(err, resilience.ErrCircuitOpen) {
+		t.Fatalf("expected the circuit to be open, got %v", err)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
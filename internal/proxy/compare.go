@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	json "github.com/bytedance/sonic"
+)
+
+// maxCompareModels caps the models one compare request fans out to.
+const maxCompareModels = 8
+
+type compareRequest struct {
+	Models  []string           `json:"models"`
+	Format  string             `json:"format"` // "openai" (default) or "anthropic"
+	Request stdjson.RawMessage `json:"request"`
+}
+
+type compareResult struct {
+	Model        string             `json:"model"`
+	StatusCode   int                `json:"status_code"`
+	LatencyMS    int                `json:"latency_ms"`
+	InputTokens  int                `json:"input_tokens"`
+	OutputTokens int                `json:"output_tokens"`
+	Cost         *float64           `json:"cost,omitempty"` // only for keys with gateway_headers
+	Response     stdjson.RawMessage `json:"response"`
+}
+
+// HandleCompare sends one prompt to several models concurrently and returns
+// every response side by side. Each model's request runs through the normal
+// handler, so admission policies, limits, logging and billing apply to it
+// as if it had been sent on its own; streaming is turned off.
+func (h *Handler) HandleCompare(w http.ResponseWriter, r *http.Request) {
+	body, err := readBody(r)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Failed to read request body")
+		return
+	}
+	defer r.Body.Close()
+
+	var req compareRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
+		return
+	}
+	if len(req.Models) == 0 || len(req.Models) > maxCompareModels {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "models must list between 1 and 8 models")
+		return
+	}
+	var (
+		path   string
+		handle http.HandlerFunc
+	)
+	switch req.Format {
+	case "", "openai":
+		path, handle = "/v1/chat/completions", h.HandleOpenAI
+	case "anthropic":
+		path, handle = "/v1/messages", h.HandleAnthropic
+	default:
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "format must be openai or anthropic")
+		return
+	}
+	var prompt map[string]any
+	if err := json.Unmarshal(req.Request, &prompt); err != nil || prompt == nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "request must be a JSON object")
+		return
+	}
+
+	results := make([]compareResult, len(req.Models))
+	var wg sync.WaitGroup
+	for i, model := range req.Models {
+		// Each goroutine gets its own copy; the handlers may rewrite it.
+		p := make(map[string]any, len(prompt))
+		for k, v := range prompt {
+			p[k] = v
+		}
+		p["model"] = model
+		p["stream"] = false
+		sub, err := json.Marshal(p)
+		if err != nil {
+			writeOpenAIError(w, http.StatusInternalServerError, "server_error", "Failed to encode request")
+			return
+		}
+
+		wg.Add(1)
+		go func(i int, model string) {
+			defer wg.Done()
+			results[i] = h.compareOne(r, path, handle, model, sub)
+		}(i, model)
+	}
+	wg.Wait()
+
+	out, err := json.Marshal(map[string]any{"results": results})
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "Failed to encode response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// compareOne runs one model's request through handle and summarises it.
+func (h *Handler) compareOne(r *http.Request, path string, handle http.HandlerFunc, model string, body []byte) compareResult {
+	sub := r.Clone(r.Context())
+	sub.URL.Path = path
+	sub.URL.RawQuery = ""
+	sub.Header.Del("Accept")
+	sub.Header.Del("Last-Event-ID")
+	sub.Body = io.NopCloser(bytes.NewReader(body))
+	sub.ContentLength = int64(len(body))
+
+	cw := &captureWriter{header: http.Header{}, status: http.StatusOK}
+	start := time.Now()
+	handle(cw, sub)
+
+	res := compareResult{
+		Model:      model,
+		StatusCode: cw.status,
+		LatencyMS:  int(time.Since(start).Milliseconds()),
+		Response:   cw.body.Bytes(),
+	}
+	if !json.Valid(res.Response) {
+		res.Response, _ = json.Marshal(cw.body.String())
+	}
+	// Usage comes from the gateway headers when the key gets them, which
+	// also carry the cost; otherwise from the response body.
+	if v := cw.header.Get(headerCost); v != "" {
+		if cost, err := strconv.ParseFloat(v, 64); err == nil {
+			res.Cost = &cost
+		}
+		res.InputTokens, _ = strconv.Atoi(cw.header.Get(headerInputTokens))
+		res.OutputTokens, _ = strconv.Atoi(cw.header.Get(headerOutputTokens))
+		return res
+	}
+	var usage struct {
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+			InputTokens      int `json:"input_tokens"`
+			OutputTokens     int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if cw.status < 300 && json.Unmarshal(res.Response, &usage) == nil {
+		res.InputTokens = usage.Usage.PromptTokens + usage.Usage.InputTokens
+		res.OutputTokens = usage.Usage.CompletionTokens + usage.Usage.OutputTokens
+	}
+	return res
+}
+
+// captureWriter buffers a handler's response in memory.
+type captureWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (c *captureWriter) Header() http.Header { return c.header }
+
+func (c *captureWriter) WriteHeader(status int) {
+	if !c.wroteHeader {
+		c.status, c.wroteHeader = status, true
+	}
+}
+
+func (c *captureWriter) Write(p []byte) (int, error) {
+	c.wroteHeader = true
+	return c.body.Write(p)
+}
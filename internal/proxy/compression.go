@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// acceptEncoding is offered to upstreams on non-streaming requests, whose
+// responses are read whole anyway. Streams are never compressed: upstreams
+// may buffer compressed SSE, which would delay tokens.
+const acceptEncoding = "zstd, br, gzip"
+
+// acceptCompressed returns headers asking for a compressed response when the
+// request does not stream and the upstream has compression enabled.
+func acceptCompressed(h http.Header, upstream *upstreamInfo, stream bool) http.Header {
+	if stream || !upstream.compress {
+		return h
+	}
+	if h == nil {
+		h = http.Header{}
+	}
+	h.Set("Accept-Encoding", acceptEncoding)
+	return h
+}
+
+// decompressBody replaces a compressed response body with its decoded
+// content, so callers read and translate it as if it were sent plain.
+func decompressBody(resp *http.Response) error {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	var dec io.Reader
+	var closeDec func()
+	switch encoding {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return fmt.Errorf("decode gzip response: %w", err)
+		}
+		dec, closeDec = zr, func() { zr.Close() }
+	case "br":
+		dec = brotli.NewReader(resp.Body)
+	case "zstd":
+		zr, err := zstd.NewReader(resp.Body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("decode zstd response: %w", err)
+		}
+		dec, closeDec = zr, zr.Close
+	default:
+		return fmt.Errorf("unsupported response encoding %q", encoding)
+	}
+
+	resp.Body = &decodedBody{Reader: dec, body: resp.Body, closeDec: closeDec}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// decodedBody reads a decoder and closes both it and the raw body.
+type decodedBody struct {
+	io.Reader
+	body     io.ReadCloser
+	closeDec func()
+}
+
+func (b *decodedBody) Close() error {
+	if b.closeDec != nil {
+		b.closeDec()
+	}
+	return b.body.Close()
+}
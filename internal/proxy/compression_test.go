@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = zw
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUpstreamClientDecompresses(t *testing.T) {
+	const payload = `{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hello"}}]}`
+	for _, enc := range []string{"gzip", "br", "zstd"} {
+		t.Run(enc, func(t *testing.T) {
+			var accepted string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				accepted = r.Header.Get("Accept-Encoding")
+				w.Header().Set("Content-Encoding", enc)
+				w.Write(compress(t, enc, []byte(payload)))
+			}))
+			defer srv.Close()
+
+			c := NewUpstreamClient(srv.URL, "sk-test", nil)
+			headers := acceptCompressed(nil, &upstreamInfo{compress: true}, false)
+			resp, err := c.Do(context.Background(), "POST", "/v1/chat/completions", bytes.NewReader([]byte(`{}`)), headers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if accepted != acceptEncoding {
+				t.Fatalf("Accept-Encoding = %q, want %q", accepted, acceptEncoding)
+			}
+			if string(body) != payload || resp.Header.Get("Content-Encoding") != "" {
+				t.Fatalf("got %q with Content-Encoding %q", body, resp.Header.Get("Content-Encoding"))
+			}
+		})
+	}
+}
+
+func TestAcceptCompressed(t *testing.T) {
+	on := &upstreamInfo{compress: true}
+	if h := acceptCompressed(nil, on, true); h.Get("Accept-Encoding") != "" {
+		t.Fatal("streaming request asked for compression")
+	}
+	if h := acceptCompressed(nil, &upstreamInfo{}, false); h.Get("Accept-Encoding") != "" {
+		t.Fatal("upstream with compression disabled asked for it")
+	}
+	h := acceptCompressed(http.Header{"X-Api-Key": {"k"}}, on, false)
+	if h.Get("Accept-Encoding") != acceptEncoding || h.Get("X-Api-Key") != "k" {
+		t.Fatalf("unexpected headers %v", h)
+	}
+}
+
+func TestDecompressBodyUnsupported(t *testing.T) {
+	resp := &http.Response{
+		Header: http.Header{"Content-Encoding": {"compress"}},
+		Body:   io.NopCloser(bytes.NewReader(nil)),
+	}
+	if err := decompressBody(resp); err == nil {
+		t.Fatal("expected an error for an unsupported encoding")
+	}
+}
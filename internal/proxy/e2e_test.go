@@ -0,0 +1,1822 @@
+package proxy_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/billing"
+	"github.com/sertdev/pxbin/internal/config"
+	"github.com/sertdev/pxbin/internal/guardrail"
+	"github.com/sertdev/pxbin/internal/logging"
+	"github.com/sertdev/pxbin/internal/policy"
+	"github.com/sertdev/pxbin/internal/proxy"
+	"github.com/sertdev/pxbin/internal/ratelimit"
+	"github.com/sertdev/pxbin/internal/server"
+	"github.com/sertdev/pxbin/internal/store"
+	"github.com/sertdev/pxbin/pkg/translate"
+)
+
+// The end-to-end tests boot the full router (auth, rate limiting, proxy,
+// logging) against fake OpenAI and Anthropic upstreams. Keys, models and
+// request logs live in PostgreSQL, so like the store integration tests they
+// are skipped unless PXBIN_TEST_DATABASE_URL is set.
+//
+// Model names select the fake upstream's behavior: a "-error" suffix returns
+// an upstream error, a "-hang" suffix streams up to the first text delta and
+// then blocks until the proxy cancels the upstream request.
+
+// fakeUpstream is an httptest server speaking one API format.
+type fakeUpstream struct {
+	*httptest.Server
+	format   string
+	canceled chan string // receives the model of every canceled request
+	release  chan struct{}
+
+	mu       sync.Mutex
+	requests []map[string]any
+}
+
+func newFakeUpstream(t *testing.T, format string) *fakeUpstream {
+	t.Helper()
+	f := &fakeUpstream{
+		format:   format,
+		canceled: make(chan string, 8),
+		release:  make(chan struct{}),
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeUpstream) requestCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.requests)
+}
+
+func (f *fakeUpstream) lastRequest() map[string]any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.requests) == 0 {
+		return nil
+	}
+	return f.requests[len(f.requests)-1]
+}
+
+func (f *fakeUpstream) serve(w http.ResponseWriter, r *http.Request) {
+	wantPath := "/v1/chat/completions"
+	if f.format == "anthropic" {
+		wantPath = "/v1/messages"
+	}
+	embeddings := f.format == "openai" && r.URL.Path == "/v1/embeddings"
+	if r.URL.Path != wantPath && !embeddings {
+		http.Error(w, "unexpected path "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	if f.format == "anthropic" && r.Header.Get("X-Api-Key") != "sk-upstream" {
+		http.Error(w, "missing x-api-key", http.StatusUnauthorized)
+		return
+	}
+	if f.format == "openai" && r.Header.Get("Authorization") != "Bearer sk-upstream" {
+		http.Error(w, "missing bearer token", http.StatusUnauthorized)
+		return
+	}
+
+	var req map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+
+	model, _ := req["model"].(string)
+	stream, _ := req["stream"].(bool)
+
+	switch {
+	case embeddings:
+		inputs, ok := req["input"].([]any)
+		if !ok {
+			inputs = []any{req["input"]}
+		}
+		var data []string
+		for i := range inputs {
+			data = append(data, fmt.Sprintf(`{"object":"embedding","index":%d,"embedding":[0.%d,0.5]}`, i, i+1))
+		}
+		// Answer out of order; clients sort by index.
+		slices.Reverse(data)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"object":"list","data":[%s],"model":%q,"usage":{"prompt_tokens":%d,"total_tokens":%d}}`, strings.Join(data, ","), model, 5*len(inputs), 5*len(inputs))
+	case strings.HasSuffix(model, "-error"):
+		w.Header().Set("Content-Type", "application/json")
+		if f.format == "anthropic" {
+			w.WriteHeader(529)
+			io.WriteString(w, `{"type":"error","error":{"type":"overloaded_error","message":"upstream overloaded"}}`)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"error":{"message":"upstream exploded","type":"server_error"}}`)
+		}
+	case stream:
+		f.writeStream(w, r, model, strings.HasSuffix(model, "-hang"))
+	case f.format == "anthropic":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"msg_fake","type":"message","role":"assistant","model":%q,"content":[{"type":"text","text":"Hello from anthropic"}],"stop_reason":"end_turn","usage":{"input_tokens":12,"output_tokens":3}}`, model)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"chatcmpl-fake","object":"chat.completion","created":1700000000,"model":%q,"choices":[{"index":0,"message":{"role":"assistant","content":"Hello from openai"},"finish_reason":"stop"}],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}`, model)
+	}
+}
+
+func (f *fakeUpstream) writeStream(w http.ResponseWriter, r *http.Request, model string, hang bool) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher := w.(http.Flusher)
+
+	var events []string
+	if f.format == "anthropic" {
+		events = []string{
+			"event: message_start\ndata: " + fmt.Sprintf(`{"type":"message_start","message":{"id":"msg_fake","type":"message","role":"assistant","model":%q,"content":[],"usage":{"input_tokens":12,"output_tokens":0}}}`, model),
+			`event: content_block_start` + "\ndata: " + `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`event: content_block_delta` + "\ndata: " + `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+			`event: content_block_stop` + "\ndata: " + `{"type":"content_block_stop","index":0}`,
+			`event: message_delta` + "\ndata: " + `{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":3}}`,
+			`event: message_stop` + "\ndata: " + `{"type":"message_stop"}`,
+		}
+	} else {
+		chunk := func(delta, finish string) string {
+			return fmt.Sprintf(`data: {"id":"chatcmpl-fake","object":"chat.completion.chunk","created":1700000000,"model":%q,"choices":[{"index":0,"delta":%s,"finish_reason":%s}]}`, model, delta, finish)
+		}
+		events = []string{
+			chunk(`{"role":"assistant","content":""}`, "null"),
+			chunk(`{"content":"Hello"}`, "null"),
+			chunk(`{}`, `"stop"`),
+			fmt.Sprintf(`data: {"id":"chatcmpl-fake","object":"chat.completion.chunk","created":1700000000,"model":%q,"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}`, model),
+			"data: [DONE]",
+		}
+	}
+
+	for i, ev := range events {
+		io.WriteString(w, ev+"\n\n")
+		flusher.Flush()
+		if hang && i == 2 {
+			select {
+			case <-r.Context().Done():
+				f.canceled <- model
+			case <-f.release:
+			}
+			return
+		}
+	}
+}
+
+// e2eEnv is a running proxy wired to fake upstreams.
+type e2eEnv struct {
+	URL       string
+	Key       string
+	Store     store.Store
+	OpenAI    *fakeUpstream
+	Anthropic *fakeUpstream
+
+	logger    *logging.AsyncLogger
+	closeLogs sync.Once
+	billing   *billing.Tracker
+	handler   *proxy.Handler
+}
+
+// flushLogs stops the async logger so every request log is in the database.
+func (e *e2eEnv) flushLogs() {
+	e.closeLogs.Do(e.logger.Close)
+}
+
+// newE2EStore returns a migrated store in a fresh schema of the database
+// at PXBIN_TEST_DATABASE_URL, or an in-memory store when it is not set.
+func newE2EStore(t *testing.T) store.Store {
+	t.Helper()
+	url := os.Getenv("PXBIN_TEST_DATABASE_URL")
+	if url == "" {
+		return store.NewMemory()
+	}
+
+	ctx := context.Background()
+	schema := fmt.Sprintf("pxbin_e2e_%d", time.Now().UnixNano())
+	pool, err := store.NewPool(ctx, url, schema, 4, 1)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), "DROP SCHEMA IF EXISTS "+schema+" CASCADE")
+		pool.Close()
+	})
+	st := store.New(pool)
+	if err := st.Migrate(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return st
+}
+
+func newE2EEnv(t *testing.T, limiter ratelimit.Limiter) *e2eEnv {
+	t.Helper()
+	ctx := context.Background()
+	st := newE2EStore(t)
+
+	env := &e2eEnv{
+		Store:     st,
+		OpenAI:    newFakeUpstream(t, "openai"),
+		Anthropic: newFakeUpstream(t, "anthropic"),
+	}
+	for _, up := range []*fakeUpstream{env.OpenAI, env.Anthropic} {
+		u, err := st.CreateUpstream(ctx, &store.UpstreamCreate{Name: up.format, BaseURL: up.URL, APIKey: "sk-upstream", Format: up.format})
+		if err != nil {
+			t.Fatalf("create upstream: %v", err)
+		}
+		prefix := "gpt-e2e"
+		if up.format == "anthropic" {
+			prefix = "claude-e2e"
+		}
+		for _, name := range []string{prefix, prefix + "-error", prefix + "-hang"} {
+			if _, err := st.CreateModel(ctx, &store.ModelCreate{Name: name, Provider: up.format, UpstreamID: &u.ID}); err != nil {
+				t.Fatalf("create model: %v", err)
+			}
+		}
+	}
+
+	plaintext, hash, prefix := auth.GenerateLLMKey()
+	if _, err := st.CreateLLMKey(ctx, hash, prefix, "e2e", nil); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	env.Key = plaintext
+
+	billingTracker := billing.NewTracker(st)
+	env.billing = billingTracker
+	env.logger = logging.NewAsyncLogger(st, 100)
+	keyCache := auth.NewKeyCache(st, time.Minute)
+	lastUsed := auth.NewLastUsedTracker(st)
+	handler := proxy.NewHandler(proxy.NewClientCache(nil), proxy.NewModelCache(st, time.Minute), st, env.logger, billingTracker)
+	env.handler = handler
+
+	cfg := &config.Config{CORSOrigins: []string{"*"}}
+	router := server.New(cfg, handler, auth.LLMAuthMiddlewareWithOpts(keyCache, lastUsed, auth.LLMAuthOpts{Budgets: billingTracker}), chi.NewRouter(), nil, nil, &server.Opts{RateLimiter: limiter, PayloadCapture: handler.CapturePayloads})
+	srv := httptest.NewServer(router)
+	env.URL = srv.URL
+
+	// Cleanups run last-in first-out: stop serving before the background
+	// workers that write to the database shut down.
+	t.Cleanup(func() {
+		env.flushLogs()
+		lastUsed.Close()
+		billingTracker.Close()
+	})
+	t.Cleanup(srv.Close)
+	// Unblock hanging upstream handlers first so a failed cancellation
+	// test cannot stall srv.Close.
+	t.Cleanup(func() {
+		close(env.OpenAI.release)
+		close(env.Anthropic.release)
+	})
+	return env
+}
+
+func (e *e2eEnv) post(ctx context.Context, t *testing.T, path, body string, header http.Header) *http.Response {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, "POST", e.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+e.Key)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST %s: %v", path, err)
+	}
+	return resp
+}
+
+func readAll(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return string(b)
+}
+
+func TestE2ECacheControlInjection(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+
+	plaintext, hash, prefix := auth.GenerateLLMKey()
+	key, err := env.Store.CreateLLMKey(ctx, hash, prefix, "cached", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled := true
+	if err := env.Store.UpdateLLMKey(ctx, key.ID, store.LLMKeyUpdate{InjectCacheControl: &enabled}); err != nil {
+		t.Fatal(err)
+	}
+	cached := http.Header{"Authorization": {"Bearer " + plaintext}}
+
+	body := `{"model":"claude-e2e","messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}],` +
+		`"tools":[{"type":"function","function":{"name":"a","parameters":{"type":"object"}}},{"type":"function","function":{"name":"b","parameters":{"type":"object"}}}]}`
+	readAll(t, env.post(ctx, t, "/v1/chat/completions", body, cached))
+	req := env.Anthropic.lastRequest()
+	system, _ := req["system"].([]any)
+	tools, _ := req["tools"].([]any)
+	if len(system) != 1 || system[0].(map[string]any)["cache_control"] == nil {
+		t.Fatalf("expected a breakpoint on the system prompt, got %v", req["system"])
+	}
+	if len(tools) != 2 || tools[0].(map[string]any)["cache_control"] != nil || tools[1].(map[string]any)["cache_control"] == nil {
+		t.Fatalf("expected a breakpoint on the last tool only, got %v", req["tools"])
+	}
+
+	// Breakpoints the client set are left alone, as are other keys' requests.
+	own := `{"model":"claude-e2e","max_tokens":64,"system":[{"type":"text","text":"Be brief."},{"type":"text","text":"Really.","cache_control":{"type":"ephemeral"}}],"messages":[{"role":"user","content":"Hi"}]}`
+	readAll(t, env.post(ctx, t, "/v1/messages", own, cached))
+	if system, _ := env.Anthropic.lastRequest()["system"].([]any); len(system) != 2 || system[0].(map[string]any)["cache_control"] != nil {
+		t.Fatalf("expected the client's breakpoints to be kept, got %v", system)
+	}
+	readAll(t, env.post(ctx, t, "/v1/messages", `{"model":"claude-e2e","max_tokens":64,"system":"Be brief.","messages":[{"role":"user","content":"Hi"}]}`, nil))
+	if _, ok := env.Anthropic.lastRequest()["system"].(string); !ok {
+		t.Fatal("expected no breakpoints for a key without inject_cache_control")
+	}
+
+	env.flushLogs()
+	stats, err := env.Store.GetCacheInjectionStats(ctx, "24h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Model != "claude-e2e" || stats[0].TotalRequests != 1 {
+		t.Fatalf("expected only the injected request in the stats, got %+v", stats)
+	}
+}
+
+func anthropicBody(model string, stream bool) string {
+	return fmt.Sprintf(`{"model":%q,"max_tokens":64,"stream":%t,"messages":[{"role":"user","content":"Hi"}]}`, model, stream)
+}
+
+func openAIBody(model string, stream bool) string {
+	return fmt.Sprintf(`{"model":%q,"stream":%t,"messages":[{"role":"user","content":"Hi"}]}`, model, stream)
+}
+
+// e2eCase is one request through one translation direction.
+type e2eCase struct {
+	name     string
+	path     string
+	body     string
+	upstream func(*e2eEnv) *fakeUpstream
+}
+
+func e2eCases(suffix string, stream bool) []e2eCase {
+	openai := func(e *e2eEnv) *fakeUpstream { return e.OpenAI }
+	anthropic := func(e *e2eEnv) *fakeUpstream { return e.Anthropic }
+	return []e2eCase{
+		{"anthropic->anthropic", "/v1/messages", anthropicBody("claude-e2e"+suffix, stream), anthropic},
+		{"anthropic->openai", "/v1/messages", anthropicBody("gpt-e2e"+suffix, stream), openai},
+		{"openai->openai", "/v1/chat/completions", openAIBody("gpt-e2e"+suffix, stream), openai},
+		{"openai->anthropic", "/v1/chat/completions", openAIBody("claude-e2e"+suffix, stream), anthropic},
+	}
+}
+
+func TestE2ENonStreaming(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	for _, tc := range e2eCases("", false) {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := env.post(context.Background(), t, tc.path, tc.body, nil)
+			body := readAll(t, resp)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d: %s", resp.StatusCode, body)
+			}
+
+			var out map[string]any
+			if err := json.Unmarshal([]byte(body), &out); err != nil {
+				t.Fatalf("decode %s: %v", body, err)
+			}
+			if tc.path == "/v1/messages" {
+				if out["type"] != "message" || !strings.Contains(body, "Hello from") {
+					t.Fatalf("expected an Anthropic message, got %s", body)
+				}
+			} else if out["object"] != "chat.completion" || !strings.Contains(body, "Hello from") {
+				t.Fatalf("expected an OpenAI chat completion, got %s", body)
+			}
+
+			// The upstream must have received its own format.
+			req := tc.upstream(env).lastRequest()
+			if _, ok := req["messages"]; !ok {
+				t.Fatalf("upstream got no messages: %v", req)
+			}
+			if tc.upstream(env).format == "anthropic" {
+				if _, ok := req["max_tokens"]; !ok {
+					t.Fatalf("anthropic upstream got no max_tokens: %v", req)
+				}
+			}
+		})
+	}
+
+	t.Run("responses->openai", func(t *testing.T) {
+		resp := env.post(context.Background(), t, "/v1/responses", `{"model":"gpt-e2e","input":"Hi"}`, nil)
+		body := readAll(t, resp)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d: %s", resp.StatusCode, body)
+		}
+		if !strings.Contains(body, `"object":"response"`) || !strings.Contains(body, "Hello from openai") {
+			t.Fatalf("unexpected responses body: %s", body)
+		}
+	})
+
+	// Every successful request is logged with the upstream's usage.
+	env.flushLogs()
+	logs, total, err := env.Store.ListLogs(context.Background(), store.LogFilter{Page: 1, PerPage: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 5 {
+		t.Fatalf("expected 5 request logs, got %d", total)
+	}
+	for _, l := range logs {
+		if l.StatusCode == nil || *l.StatusCode != http.StatusOK {
+			t.Errorf("%s %v: unexpected status %v", l.Path, l.Model, l.StatusCode)
+		}
+		if l.InputTokens == nil || *l.InputTokens != 12 || l.OutputTokens == nil || *l.OutputTokens != 3 {
+			t.Errorf("%s %s: unexpected usage in=%v out=%v", l.Path, *l.Model, l.InputTokens, l.OutputTokens)
+		}
+	}
+}
+
+func TestE2EStreaming(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	for _, tc := range e2eCases("", true) {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := env.post(context.Background(), t, tc.path, tc.body, nil)
+			body := readAll(t, resp)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d: %s", resp.StatusCode, body)
+			}
+			if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+				t.Fatalf("expected an event stream, got %q", ct)
+			}
+			if !strings.Contains(body, "Hello") {
+				t.Fatalf("stream is missing the text delta: %s", body)
+			}
+			if tc.path == "/v1/messages" {
+				for _, ev := range []string{"event: message_start", "event: content_block_delta", "event: message_stop"} {
+					if !strings.Contains(body, ev) {
+						t.Fatalf("stream is missing %q: %s", ev, body)
+					}
+				}
+			} else if !strings.Contains(body, "chat.completion.chunk") || !strings.Contains(body, "data: [DONE]") {
+				t.Fatalf("expected OpenAI chunks ending in [DONE]: %s", body)
+			}
+		})
+	}
+
+	env.flushLogs()
+	logs, _, err := env.Store.ListLogs(context.Background(), store.LogFilter{Page: 1, PerPage: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 4 {
+		t.Fatalf("expected 4 request logs, got %d", len(logs))
+	}
+	for _, l := range logs {
+		if l.OutputTokens == nil || *l.OutputTokens != 3 {
+			t.Errorf("%s %s: expected 3 output tokens, got %v", l.Path, *l.Model, l.OutputTokens)
+		}
+	}
+}
+
+func TestE2EStreamingNDJSON(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	accept := http.Header{"Accept": {"application/x-ndjson"}}
+	for _, tc := range e2eCases("", true) {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := env.post(context.Background(), t, tc.path, tc.body, accept)
+			body := readAll(t, resp)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d: %s", resp.StatusCode, body)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Fatalf("expected ndjson, got %q", ct)
+			}
+			lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+			for _, line := range lines {
+				var v map[string]any
+				if err := json.Unmarshal([]byte(line), &v); err != nil {
+					t.Fatalf("line is not a JSON object: %q", line)
+				}
+			}
+			if strings.Contains(body, "data:") || strings.Contains(body, "[DONE]") || !strings.Contains(body, "Hello") {
+				t.Fatalf("unexpected ndjson stream: %s", body)
+			}
+		})
+	}
+}
+
+func TestE2EGemini(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	body := `{"contents":[{"role":"user","parts":[{"text":"Hi"}]}],"generationConfig":{"maxOutputTokens":64}}`
+	// Gemini SDKs authenticate with x-goog-api-key instead of a bearer token.
+	header := http.Header{"Authorization": {""}, "X-Goog-Api-Key": {env.Key}}
+	for _, model := range []string{"gpt-e2e", "claude-e2e"} {
+		t.Run(model, func(t *testing.T) {
+			resp := env.post(context.Background(), t, "/v1beta/models/"+model+":generateContent", body, header)
+			out := readAll(t, resp)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d: %s", resp.StatusCode, out)
+			}
+			var gen struct {
+				Candidates []struct {
+					Content struct {
+						Parts []struct {
+							Text string `json:"text"`
+						} `json:"parts"`
+					} `json:"content"`
+					FinishReason string `json:"finishReason"`
+				} `json:"candidates"`
+				UsageMetadata struct {
+					PromptTokenCount     int `json:"promptTokenCount"`
+					CandidatesTokenCount int `json:"candidatesTokenCount"`
+				} `json:"usageMetadata"`
+			}
+			if err := json.Unmarshal([]byte(out), &gen); err != nil || len(gen.Candidates) != 1 {
+				t.Fatalf("expected a Gemini response, got %s", out)
+			}
+			c := gen.Candidates[0]
+			if len(c.Content.Parts) == 0 || !strings.HasPrefix(c.Content.Parts[0].Text, "Hello from") || c.FinishReason != "STOP" {
+				t.Fatalf("unexpected candidate: %s", out)
+			}
+			if gen.UsageMetadata.PromptTokenCount != 12 || gen.UsageMetadata.CandidatesTokenCount != 3 {
+				t.Fatalf("unexpected usage: %s", out)
+			}
+
+			resp = env.post(context.Background(), t, "/v1beta/models/"+model+":streamGenerateContent?alt=sse", body, header)
+			out = readAll(t, resp)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("stream status %d: %s", resp.StatusCode, out)
+			}
+			if !strings.Contains(out, `"text":"Hello"`) || !strings.Contains(out, `"finishReason":"STOP"`) || strings.Contains(out, "[DONE]") {
+				t.Fatalf("unexpected Gemini stream: %s", out)
+			}
+		})
+	}
+
+	t.Run("unknown model", func(t *testing.T) {
+		resp := env.post(context.Background(), t, "/v1beta/models/no-such-model:generateContent", body, header)
+		out := readAll(t, resp)
+		if resp.StatusCode < 400 || !strings.Contains(out, `"status":`) {
+			t.Fatalf("expected a Gemini error, got %d: %s", resp.StatusCode, out)
+		}
+	})
+
+	env.flushLogs()
+	format := "gemini"
+	logs, _, err := env.Store.ListLogs(context.Background(), store.LogFilter{InputFormat: &format, Page: 1, PerPage: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	billed := 0
+	for _, l := range logs {
+		if l.OutputTokens != nil && *l.OutputTokens == 3 {
+			billed++
+		}
+	}
+	if billed != 4 {
+		t.Fatalf("expected 4 gemini request logs with usage, got %d of %d", billed, len(logs))
+	}
+}
+
+func TestE2EEmbeddings(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+
+	resp := env.post(ctx, t, "/v1/embeddings", `{"model":"gpt-e2e","input":["a","b"]}`, nil)
+	out := readAll(t, resp)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, out)
+	}
+	if !strings.Contains(out, `"prompt_tokens":10`) || env.OpenAI.lastRequest()["model"] != "gpt-e2e" {
+		t.Fatalf("expected the upstream response to pass through, got %s", out)
+	}
+
+	header := http.Header{"Authorization": {""}, "X-Goog-Api-Key": {env.Key}}
+	resp = env.post(ctx, t, "/v1beta/models/gpt-e2e:embedContent", `{"content":{"parts":[{"text":"a"}]}}`, header)
+	out = readAll(t, resp)
+	if resp.StatusCode != http.StatusOK || out != `{"embedding":{"values":[0.1,0.5]}}` {
+		t.Fatalf("expected a Gemini embedding, got %d: %s", resp.StatusCode, out)
+	}
+	resp = env.post(ctx, t, "/v1beta/models/gpt-e2e:batchEmbedContents", `{"requests":[{"model":"models/gpt-e2e","content":{"parts":[{"text":"a"}]}},{"model":"models/gpt-e2e","content":{"parts":[{"text":"b"}]}}]}`, header)
+	out = readAll(t, resp)
+	if resp.StatusCode != http.StatusOK || out != `{"embeddings":[{"values":[0.1,0.5]},{"values":[0.2,0.5]}]}` {
+		t.Fatalf("expected Gemini embeddings in request order, got %d: %s", resp.StatusCode, out)
+	}
+
+	resp = env.post(ctx, t, "/v1/embeddings", `{"model":"claude-e2e","input":"a"}`, nil)
+	out = readAll(t, resp)
+	if resp.StatusCode != http.StatusBadRequest || env.Anthropic.requestCount() != 0 {
+		t.Fatalf("expected Anthropic-format models to be rejected, got %d: %s", resp.StatusCode, out)
+	}
+
+	env.flushLogs()
+	logs, _, err := env.Store.ListLogs(ctx, store.LogFilter{Page: 1, PerPage: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := map[string]int{}
+	for _, l := range logs {
+		if l.InputTokens != nil {
+			tokens[l.InputFormat] += *l.InputTokens
+		}
+	}
+	if tokens["openai"] != 10 || tokens["gemini"] != 15 {
+		t.Fatalf("expected embedding input tokens to be logged, got %v", tokens)
+	}
+}
+
+func TestE2EPayloadCapture(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+	env.handler.SetPayloadCapture(proxy.PayloadCaptureOpts{MaxBytes: 128, Redact: true})
+
+	plaintext, hash, prefix := auth.GenerateLLMKey()
+	key, err := env.Store.CreateLLMKey(ctx, hash, prefix, "debug", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled := true
+	if err := env.Store.UpdateLLMKey(ctx, key.ID, store.LLMKeyUpdate{CapturePayloads: &enabled}); err != nil {
+		t.Fatal(err)
+	}
+	debug := http.Header{"Authorization": {"Bearer " + plaintext}}
+
+	readAll(t, env.post(ctx, t, "/v1/messages", anthropicBody("claude-e2e", false), nil))
+	body := `{"model":"claude-e2e","max_tokens":64,"stream":true,"messages":[{"role":"user","content":"I am jane@example.com"}]}`
+	stream := readAll(t, env.post(ctx, t, "/v1/messages", body, debug))
+
+	env.flushLogs()
+	logs, _, err := env.Store.ListLogs(ctx, store.LogFilter{Page: 1, PerPage: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("expected 2 logs, got %d", len(logs))
+	}
+	for _, l := range logs {
+		p, err := env.Store.GetLogPayload(ctx, l.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.KeyID == nil || *l.KeyID != key.ID {
+			if p != nil {
+				t.Fatalf("expected no payload for a key without capture_payloads, got %+v", p)
+			}
+			continue
+		}
+		if p == nil {
+			t.Fatal("expected the payload of the opted-in key to be captured")
+		}
+		if p.RequestBytes != len(body) || p.ResponseBytes != len(stream) || p.Response != stream[:128] {
+			t.Fatalf("expected the stream cut at 128 bytes with the full sizes, got %+v", p)
+		}
+		if strings.Contains(p.Request, "jane@example.com") || !strings.Contains(p.Request, "[REDACTED]") || !p.Redacted {
+			t.Fatalf("expected the email address to be redacted, got %q", p.Request)
+		}
+	}
+}
+
+func TestE2EAuditSampling(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+
+	plaintext, hash, prefix := auth.GenerateLLMKey()
+	quiet, err := env.Store.CreateLLMKey(ctx, hash, prefix, "quiet", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, err := env.Store.SetAuditRule(ctx, &store.AuditRuleCreate{Model: "claude-e2e", Percent: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A key's own rule outranks a rule for the model.
+	if _, err := env.Store.SetAuditRule(ctx, &store.AuditRuleCreate{KeyID: &quiet.ID, Percent: 0}); err != nil {
+		t.Fatal(err)
+	}
+	sampler := proxy.NewAuditSampler(env.Store, time.Hour, proxy.AuditOpts{MaxBytes: 1 << 20})
+	t.Cleanup(sampler.Close)
+	env.handler.SetAuditSampler(sampler)
+
+	body := `{"model":"claude-e2e","max_tokens":64,"stream":true,"messages":[{"role":"user","content":"I am jane@example.com"}]}`
+	stream := readAll(t, env.post(ctx, t, "/v1/messages", body, nil))
+	readAll(t, env.post(ctx, t, "/v1/chat/completions", openAIBody("gpt-e2e", false), nil))
+	readAll(t, env.post(ctx, t, "/v1/messages", body, http.Header{"Authorization": {"Bearer " + plaintext}}))
+
+	env.flushLogs()
+	samples, total, err := env.Store.ListAuditSamples(ctx, store.AuditSampleFilter{Page: 1, PerPage: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 {
+		t.Fatalf("expected only the claude-e2e request of the first key to be sampled, got %+v", samples)
+	}
+	sample, _, err := env.Store.ViewAuditSample(ctx, samples[0].ID, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sample.RuleID == nil || *sample.RuleID != rule.ID || sample.Percent != 100 || sample.StatusCode != 200 {
+		t.Fatalf("expected the sample to record its rule and outcome, got %+v", sample)
+	}
+	if sample.Request != body || sample.Response != stream {
+		t.Fatalf("expected the full unredacted bodies, got %+v", sample)
+	}
+}
+
+func TestE2EMetadataMapping(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+	env.handler.SetMetadataOptions(translate.MetadataMap{"session_id": "session", "retain": translate.MetadataStore}, []string{"session_id", "session"})
+
+	readAll(t, env.post(ctx, t, "/v1/messages", `{"model":"gpt-e2e","max_tokens":64,"messages":[{"role":"user","content":"hi"}],"metadata":{"user_id":"u1","session_id":"s1","retain":"true","trace":"t1"}}`, nil))
+	got, _ := json.Marshal(env.OpenAI.lastRequest())
+	var oai struct {
+		User     string            `json:"user"`
+		Metadata map[string]string `json:"metadata"`
+		Store    *bool             `json:"store"`
+	}
+	json.Unmarshal(got, &oai)
+	if oai.User != "u1" || len(oai.Metadata) != 1 || oai.Metadata["session"] != "s1" || oai.Store == nil || !*oai.Store {
+		t.Fatalf("expected the mapped metadata and store flag upstream, got %s", got)
+	}
+
+	readAll(t, env.post(ctx, t, "/v1/chat/completions", `{"model":"claude-e2e","messages":[{"role":"user","content":"hi"}],"user":"u2","metadata":{"session":"s2"},"store":false}`, nil))
+	got, _ = json.Marshal(env.Anthropic.lastRequest()["metadata"])
+	if string(got) != `{"retain":"false","session_id":"s2","user_id":"u2"}` {
+		t.Fatalf("expected the mapped metadata upstream, got %s", got)
+	}
+
+	env.flushLogs()
+	logs, _, err := env.Store.ListLogs(ctx, store.LogFilter{Page: 1, PerPage: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("expected 2 logs, got %d", len(logs))
+	}
+	for _, l := range logs {
+		logged, _ := json.Marshal(l.RequestMetadata["metadata"])
+		if want := map[string]string{"anthropic": `{"session_id":"s1"}`, "openai": `{"session":"s2"}`}[l.InputFormat]; string(logged) != want {
+			t.Fatalf("%s: expected %s in the request metadata, got %s", l.InputFormat, want, logged)
+		}
+	}
+}
+
+func TestE2EGuardrails(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+	for _, gc := range []store.GuardrailCreate{
+		{Name: "no-passwords", Kind: guardrail.KindRegex, Stage: guardrail.StageRequest, Mode: guardrail.ModeBlock, Patterns: []string{`(?i)password`}, Message: "Leave passwords out"},
+		{Name: "pii", Kind: guardrail.KindPII, Stage: guardrail.StageBoth, Mode: guardrail.ModeFlag},
+		{Name: "no-openai-greetings", Kind: guardrail.KindRegex, Stage: guardrail.StageResponse, Mode: guardrail.ModeBlock, Patterns: []string{`Hello from openai`}},
+	} {
+		if _, err := env.Store.CreateGuardrail(ctx, &gc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	guardrails := guardrail.NewEngine(env.Store, time.Hour)
+	t.Cleanup(guardrails.Close)
+	env.handler.SetGuardrails(guardrails)
+
+	resp := env.post(ctx, t, "/v1/messages", `{"model":"claude-e2e","max_tokens":64,"messages":[{"role":"user","content":"my Password is hunter2"}]}`, nil)
+	if body := readAll(t, resp); resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "Leave passwords out") {
+		t.Fatalf("expected the request to be blocked with the guardrail's message, got %d %s", resp.StatusCode, body)
+	}
+
+	resp = env.post(ctx, t, "/v1/chat/completions", `{"model":"gpt-e2e","messages":[{"role":"user","content":"I am jane@example.com"}]}`, nil)
+	body := readAll(t, resp)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, `"finish_reason":"content_filter"`) || strings.Contains(body, "Hello from openai") {
+		t.Fatalf("expected the response to be replaced with a filtered one, got %d %s", resp.StatusCode, body)
+	}
+	resp = env.post(ctx, t, "/v1beta/models/gpt-e2e:generateContent", `{"contents":[{"role":"user","parts":[{"text":"Hi"}]}]}`, nil)
+	if body := readAll(t, resp); !strings.Contains(body, `"SAFETY"`) {
+		t.Fatalf("expected a Gemini safety stop, got %d %s", resp.StatusCode, body)
+	}
+	// A stream no block guardrail matches is passed through.
+	resp = env.post(ctx, t, "/v1/messages", `{"model":"claude-e2e","max_tokens":64,"stream":true,"messages":[{"role":"user","content":"Hi"}]}`, nil)
+	if body := readAll(t, resp); !strings.Contains(body, "Hello") {
+		t.Fatalf("expected the stream to pass, got %s", body)
+	}
+
+	env.flushLogs()
+	logs, _, err := env.Store.ListLogs(ctx, store.LogFilter{Page: 1, PerPage: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 4 {
+		t.Fatalf("expected 4 logs, got %d", len(logs))
+	}
+	verdicts := map[string]string{}
+	for _, l := range logs {
+		logged, _ := json.Marshal(l.RequestMetadata["guardrails"])
+		code := ""
+		if l.ErrorCode != nil {
+			code = *l.ErrorCode
+		}
+		verdicts[l.Path+" "+code] = string(logged)
+	}
+	want := map[string]string{
+		"/v1/messages guardrail_blocked": `[{"guardrail":"no-passwords","stage":"request","mode":"block","reason":"matched pattern 0"}]`,
+		"/v1/chat/completions guardrail_blocked": `[{"guardrail":"pii","stage":"request","mode":"flag","reason":"found email"},` +
+			`{"guardrail":"no-openai-greetings","stage":"response","mode":"block","reason":"matched pattern 0"}]`,
+		"/v1beta/models/gpt-e2e:generateContent guardrail_blocked": `[{"guardrail":"no-openai-greetings","stage":"response","mode":"block","reason":"matched pattern 0"}]`,
+		"/v1/messages ": `null`,
+	}
+	for k, v := range want {
+		if verdicts[k] != v {
+			t.Errorf("%s: expected verdicts %s, got %s", k, v, verdicts[k])
+		}
+	}
+}
+
+func TestE2EGuardrailStreams(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+	if _, err := env.Store.CreateGuardrail(ctx, &store.GuardrailCreate{Name: "no-greetings", Kind: guardrail.KindRegex, Stage: guardrail.StageResponse, Mode: guardrail.ModeBlock, Patterns: []string{`Hel+o`}, Message: "No greetings"}); err != nil {
+		t.Fatal(err)
+	}
+	guardrails := guardrail.NewEngine(env.Store, time.Hour)
+	t.Cleanup(guardrails.Close)
+	env.handler.SetGuardrails(guardrails)
+
+	// Streams end with an error event in place of the first blocked
+	// line, in the client's format.
+	ndjson := http.Header{"Accept": {"application/x-ndjson"}}
+	for _, tc := range []struct {
+		name, path, body string
+		header           http.Header
+		want, end        string
+	}{
+		{"anthropic", "/v1/messages", anthropicBody("claude-e2e", true), nil, "event: error\ndata: {\"type\":\"error\"", "message_stop"},
+		{"chat", "/v1/chat/completions", openAIBody("gpt-e2e", true), nil, `data: {"error":{"message":"No greetings"`, "[DONE]"},
+		{"chat from anthropic", "/v1/chat/completions", openAIBody("claude-e2e", true), nil, `data: {"error":{"message":"No greetings"`, "[DONE]"},
+		{"responses", "/v1/responses", `{"model":"gpt-e2e","input":"Hi","stream":true}`, nil, "event: error\ndata: ", "response.completed"},
+		{"chat ndjson", "/v1/chat/completions", openAIBody("gpt-e2e", true), ndjson, `{"error":{"message":"No greetings"`, `"finish_reason":"stop"`},
+	} {
+		resp := env.post(ctx, t, tc.path, tc.body, tc.header)
+		out := readAll(t, resp)
+		if resp.StatusCode != http.StatusOK || !strings.Contains(out, tc.want) || !strings.Contains(out, "No greetings") {
+			t.Fatalf("%s: expected an error event, got %d: %s", tc.name, resp.StatusCode, out)
+		}
+		if strings.Contains(out, "Hello") || strings.Contains(out, tc.end) {
+			t.Fatalf("%s: expected the stream to end before the blocked text, got %s", tc.name, out)
+		}
+	}
+
+	env.flushLogs()
+	logs, _, err := env.Store.ListLogs(ctx, store.LogFilter{Page: 1, PerPage: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 5 {
+		t.Fatalf("expected 5 logs, got %d", len(logs))
+	}
+	for _, l := range logs {
+		if l.ErrorCode == nil || *l.ErrorCode != "guardrail_blocked" {
+			t.Errorf("%s: expected error code guardrail_blocked, got %v", l.Path, l.ErrorCode)
+		}
+		if logged, _ := json.Marshal(l.RequestMetadata["guardrails"]); string(logged) != `[{"guardrail":"no-greetings","stage":"response","mode":"block","reason":"matched pattern 0"}]` {
+			t.Errorf("%s: unexpected verdicts %s", l.Path, logged)
+		}
+	}
+}
+
+func TestE2EGatewayHeaders(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+
+	plaintext, hash, prefix := auth.GenerateLLMKey()
+	key, err := env.Store.CreateLLMKey(ctx, hash, prefix, "observer", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled := true
+	if err := env.Store.UpdateLLMKey(ctx, key.ID, store.LLMKeyUpdate{GatewayHeaders: &enabled}); err != nil {
+		t.Fatal(err)
+	}
+	observer := http.Header{"Authorization": {"Bearer " + plaintext}}
+
+	resp := env.post(ctx, t, "/v1/messages", anthropicBody("claude-e2e", false), nil)
+	readAll(t, resp)
+	if v := resp.Header.Get("X-Pxbin-Upstream"); v != "" {
+		t.Fatalf("gateway headers sent to a key without opt-in: upstream=%q", v)
+	}
+
+	for _, tc := range e2eCases("", false) {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := env.post(ctx, t, tc.path, tc.body, observer)
+			if body := readAll(t, resp); resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d: %s", resp.StatusCode, body)
+			}
+			if resp.Header.Get("X-Pxbin-Upstream") == "" || resp.Header.Get("X-Pxbin-Model") == "" || resp.Header.Get("X-Pxbin-Overhead-Us") == "" {
+				t.Fatalf("missing routing headers: %v", resp.Header)
+			}
+			if got := resp.Header.Get("X-Pxbin-Output-Tokens"); got != "3" {
+				t.Fatalf("X-Pxbin-Output-Tokens = %q, want 3", got)
+			}
+			if resp.Header.Get("X-Pxbin-Cost") == "" {
+				t.Fatal("missing X-Pxbin-Cost")
+			}
+		})
+	}
+
+	// Streams only know usage at the end, so it arrives as trailers.
+	resp = env.post(ctx, t, "/v1/messages", anthropicBody("claude-e2e", true), observer)
+	readAll(t, resp)
+	if resp.Header.Get("X-Pxbin-Model") != "claude-e2e" {
+		t.Fatalf("X-Pxbin-Model = %q", resp.Header.Get("X-Pxbin-Model"))
+	}
+	if got := resp.Trailer.Get("X-Pxbin-Output-Tokens"); got != "3" {
+		t.Fatalf("X-Pxbin-Output-Tokens trailer = %q, want 3", got)
+	}
+}
+
+func TestE2ERegions(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+
+	upstreams, err := env.Store.ListUpstreams(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eu := "eu"
+	for _, u := range upstreams {
+		if u.Format == "anthropic" {
+			if err := env.Store.UpdateUpstream(ctx, u.ID, &store.UpstreamUpdate{Region: &eu}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	plaintext, hash, prefix := auth.GenerateLLMKey()
+	key, err := env.Store.CreateLLMKey(ctx, hash, prefix, "eu-only", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Store.UpdateLLMKey(ctx, key.ID, store.LLMKeyUpdate{AllowedRegions: &[]string{"eu"}}); err != nil {
+		t.Fatal(err)
+	}
+	euOnly := http.Header{"Authorization": {"Bearer " + plaintext}}
+
+	resp := env.post(ctx, t, "/v1/messages", anthropicBody("claude-e2e", false), euOnly)
+	if body := readAll(t, resp); resp.StatusCode != http.StatusOK {
+		t.Fatalf("eu upstream: status %d: %s", resp.StatusCode, body)
+	}
+	// The OpenAI upstream has no region, so a restricted key cannot use it.
+	resp = env.post(ctx, t, "/v1/chat/completions", openAIBody("gpt-e2e", false), euOnly)
+	if body := readAll(t, resp); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("unregioned upstream: expected 403, got %d: %s", resp.StatusCode, body)
+	}
+	// Unrestricted keys are unaffected.
+	resp = env.post(ctx, t, "/v1/chat/completions", openAIBody("gpt-e2e", false), nil)
+	if body := readAll(t, resp); resp.StatusCode != http.StatusOK {
+		t.Fatalf("unrestricted key: status %d: %s", resp.StatusCode, body)
+	}
+
+	env.flushLogs()
+	logs, _, err := env.Store.ListLogs(ctx, store.LogFilter{Region: &eu})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].Model == nil || *logs[0].Model != "claude-e2e" {
+		t.Fatalf("expected one eu log for claude-e2e, got %+v", logs)
+	}
+}
+
+func TestE2EModelAllowlist(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+
+	plaintext, hash, prefix := auth.GenerateLLMKey()
+	key, err := env.Store.CreateLLMKey(ctx, hash, prefix, "claude-only", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Store.UpdateLLMKey(ctx, key.ID, store.LLMKeyUpdate{AllowedModels: &[]string{"CLAUDE-*"}}); err != nil {
+		t.Fatal(err)
+	}
+	claudeOnly := http.Header{"Authorization": {"Bearer " + plaintext}}
+
+	resp := env.post(ctx, t, "/v1/chat/completions", openAIBody("claude-e2e", false), claudeOnly)
+	if body := readAll(t, resp); resp.StatusCode != http.StatusOK {
+		t.Fatalf("allowed model: status %d: %s", resp.StatusCode, body)
+	}
+	// Disallowed models are refused in the caller's error format.
+	resp = env.post(ctx, t, "/v1/messages", anthropicBody("gpt-e2e", false), claudeOnly)
+	if body := readAll(t, resp); resp.StatusCode != http.StatusForbidden || !strings.Contains(body, `"type":"error"`) {
+		t.Fatalf("anthropic client: expected an Anthropic 403, got %d: %s", resp.StatusCode, body)
+	}
+	resp = env.post(ctx, t, "/v1/chat/completions", openAIBody("gpt-e2e", false), claudeOnly)
+	if body := readAll(t, resp); resp.StatusCode != http.StatusForbidden || !strings.Contains(body, "not allowed to use model") {
+		t.Fatalf("openai client: expected an OpenAI 403, got %d: %s", resp.StatusCode, body)
+	}
+	// Upstreams keep the last of duplicate keys, so a body naming an
+	// allowed model first and another after it is refused outright.
+	for _, path := range []string{"/v1/chat/completions", "/v1/messages"} {
+		dup := `{"model":"claude-e2e","max_tokens":16,"messages":[{"role":"user","content":"Hi"}],"model":"gpt-e2e"}`
+		resp = env.post(ctx, t, path, dup, claudeOnly)
+		if body := readAll(t, resp); resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "more than once") {
+			t.Fatalf("%s: expected a 400 for a duplicate model, got %d: %s", path, resp.StatusCode, body)
+		}
+	}
+	if n := env.OpenAI.requestCount(); n != 0 {
+		t.Fatalf("expected no requests to reach the OpenAI upstream, got %d", n)
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", env.URL+"/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer "+plaintext)
+	listed, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := readAll(t, listed); !strings.Contains(body, "claude-e2e") || strings.Contains(body, "gpt-e2e") {
+		t.Fatalf("expected only allowed models to be listed, got %s", body)
+	}
+}
+
+func TestE2EPriority(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+
+	upstreams, err := env.Store.ListUpstreams(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range upstreams {
+		tiers := store.ServiceTiers{"low": "flex", "high": "priority"}
+		if u.Format == "anthropic" {
+			tiers = store.ServiceTiers{"low": "standard_only"}
+		}
+		if err := env.Store.UpdateUpstream(ctx, u.ID, &store.UpstreamUpdate{ServiceTiers: &tiers}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plaintext, hash, prefix := auth.GenerateLLMKey()
+	key, err := env.Store.CreateLLMKey(ctx, hash, prefix, "urgent", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	high := store.PriorityHigh
+	if err := env.Store.UpdateLLMKey(ctx, key.ID, store.LLMKeyUpdate{MaxPriority: &high}); err != nil {
+		t.Fatal(err)
+	}
+
+	tier := func(up *fakeUpstream) any { return up.lastRequest()["service_tier"] }
+	withPriority := func(p string, key ...string) http.Header {
+		h := http.Header{"X-Pxbin-Priority": {p}}
+		if len(key) > 0 {
+			h.Set("Authorization", "Bearer "+key[0])
+		}
+		return h
+	}
+
+	for _, tc := range e2eCases("", false) {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := env.post(ctx, t, tc.path, tc.body, withPriority("low"))
+			if body := readAll(t, resp); resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d: %s", resp.StatusCode, body)
+			}
+			want := "flex"
+			if tc.upstream(env) == env.Anthropic {
+				want = "standard_only"
+			}
+			if got := tier(tc.upstream(env)); got != want {
+				t.Fatalf("service_tier = %v, want %s", got, want)
+			}
+		})
+	}
+
+	// The default key is capped at normal, which has no tier.
+	resp := env.post(ctx, t, "/v1/chat/completions", openAIBody("gpt-e2e", false), withPriority("high"))
+	readAll(t, resp)
+	if got := tier(env.OpenAI); got != nil {
+		t.Fatalf("capped request sent service_tier %v", got)
+	}
+	resp = env.post(ctx, t, "/v1/chat/completions", openAIBody("gpt-e2e", false), withPriority("high", plaintext))
+	readAll(t, resp)
+	if got := tier(env.OpenAI); got != "priority" {
+		t.Fatalf("service_tier = %v, want priority", got)
+	}
+
+	resp = env.post(ctx, t, "/v1/messages", anthropicBody("claude-e2e", false), withPriority("urgent"))
+	if body := readAll(t, resp); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unknown priority: expected 400, got %d: %s", resp.StatusCode, body)
+	}
+
+	env.flushLogs()
+	for p, want := range map[string]int{"low": 4, "normal": 1, "high": 1} {
+		logs, _, err := env.Store.ListLogs(ctx, store.LogFilter{Priority: &p})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) != want {
+			t.Errorf("%d %s priority logs, want %d", len(logs), p, want)
+		}
+	}
+}
+
+func TestE2EModelNameResolution(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+
+	m, err := env.Store.GetModelByName(ctx, "gpt-e2e")
+	if err != nil || m == nil {
+		t.Fatalf("get model: %v", err)
+	}
+	if err := env.Store.UpdateModel(ctx, m.ID, &store.ModelUpdate{Aliases: &[]string{"e2e-default"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path, body string
+		upstream   *fakeUpstream
+		want       string
+	}{
+		{"/v1/messages", anthropicBody("Claude-E2E", false), env.Anthropic, "claude-e2e"},
+		{"/v1/chat/completions", openAIBody("GPT-E2E", false), env.OpenAI, "gpt-e2e"},
+		{"/v1/chat/completions", openAIBody("E2E-Default", false), env.OpenAI, "gpt-e2e"},
+	}
+	for _, tc := range tests {
+		resp := env.post(ctx, t, tc.path, tc.body, nil)
+		if body := readAll(t, resp); resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", tc.body, resp.StatusCode, body)
+		}
+		// Upstreams receive the canonical name.
+		if got := tc.upstream.lastRequest()["model"]; got != tc.want {
+			t.Fatalf("%s: upstream got model %v, want %s", tc.body, got, tc.want)
+		}
+	}
+
+	if conflict, err := env.Store.ModelNameConflict(ctx, []string{"E2E-DEFAULT"}, nil); err != nil || conflict != "gpt-e2e" {
+		t.Fatalf("expected alias conflict with gpt-e2e, got %q (%v)", conflict, err)
+	}
+}
+
+func TestE2ERouterModel(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+
+	tools := true
+	if _, err := env.Store.CreateModelRouter(ctx, &store.ModelRouterCreate{
+		Name:         "e2e-auto",
+		Rules:        []store.RouterRule{{Tools: &tools, Model: "claude-e2e"}},
+		DefaultModel: "gpt-e2e",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	routers := proxy.NewRouters(env.Store, time.Minute)
+	t.Cleanup(routers.Close)
+	env.handler.SetRouters(routers)
+
+	withTools := `{"model":"E2E-Auto","messages":[{"role":"user","content":"Hi"}],"tools":[{"type":"function","function":{"name":"lookup","parameters":{"type":"object"}}}]}`
+	tests := []struct {
+		path, body string
+		upstream   *fakeUpstream
+		want       string
+	}{
+		{"/v1/chat/completions", withTools, env.Anthropic, "claude-e2e"},
+		{"/v1/messages", anthropicBody("e2e-auto", false), env.OpenAI, "gpt-e2e"},
+	}
+	for _, tc := range tests {
+		resp := env.post(ctx, t, tc.path, tc.body, nil)
+		if body := readAll(t, resp); resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", tc.path, resp.StatusCode, body)
+		}
+		if got := tc.upstream.lastRequest()["model"]; got != tc.want {
+			t.Fatalf("%s: upstream got model %v, want %s", tc.path, got, tc.want)
+		}
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", env.URL+"/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer "+env.Key)
+	listed, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := readAll(t, listed); !strings.Contains(body, `"e2e-auto"`) {
+		t.Fatalf("expected the router to be listed, got %s", body)
+	}
+
+	// Requests are logged under the model that served them.
+	env.flushLogs()
+	logs, _, err := env.Store.ListLogs(ctx, store.LogFilter{Page: 1, PerPage: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("expected 2 logs, got %d", len(logs))
+	}
+	for _, l := range logs {
+		if l.Model == nil || (*l.Model != "gpt-e2e" && *l.Model != "claude-e2e") {
+			t.Fatalf("expected the chosen model to be logged, got %v", l.Model)
+		}
+		if l.RequestMetadata["router"] == nil {
+			t.Fatalf("expected the router in the request metadata, got %v", l.RequestMetadata)
+		}
+	}
+}
+
+func TestE2EUpstreamErrors(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	tests := map[string]struct {
+		status int
+		want   string
+	}{
+		"anthropic->anthropic": {529, "overloaded_error"},    // passed through
+		"anthropic->openai":    {500, `"type":"api_error"`},  // wrapped in an Anthropic error
+		"openai->openai":       {500, "upstream exploded"},   // passed through
+		"openai->anthropic":    {529, "upstream overloaded"}, // translated to an OpenAI error
+	}
+	for _, tc := range e2eCases("-error", false) {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := env.post(context.Background(), t, tc.path, tc.body, nil)
+			body := readAll(t, resp)
+			want := tests[tc.name]
+			if resp.StatusCode != want.status {
+				t.Fatalf("expected %d, got %d: %s", want.status, resp.StatusCode, body)
+			}
+			if !strings.Contains(body, want.want) {
+				t.Fatalf("expected %q in %s", want.want, body)
+			}
+		})
+	}
+
+	t.Run("unknown model", func(t *testing.T) {
+		resp := env.post(context.Background(), t, "/v1/messages", anthropicBody("no-such-model", false), nil)
+		body := readAll(t, resp)
+		if resp.StatusCode < 400 {
+			t.Fatalf("expected an error, got %d: %s", resp.StatusCode, body)
+		}
+	})
+
+	// Each error status comes from two directions; filtering on 500
+	// matches the whole 5xx class.
+	env.flushLogs()
+	for status, want := range map[int]int{529: 2, 500: 4} {
+		_, n, err := env.Store.ListLogs(context.Background(), store.LogFilter{StatusCode: &status, Page: 1, PerPage: 50})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("expected %d logs with status %d, got %d", want, status, n)
+		}
+	}
+}
+
+func TestE2EFailover(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+
+	overloaded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, `{"type":"error","error":{"type":"api_error","message":"down for maintenance"}}`)
+	}))
+	t.Cleanup(overloaded.Close)
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	upstreams, err := env.Store.ListUpstreams(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byFormat := map[string]uuid.UUID{}
+	for _, u := range upstreams {
+		byFormat[u.Format] = u.ID
+	}
+	create := func(name, format, url string, fallbacks ...uuid.UUID) uuid.UUID {
+		u, err := env.Store.CreateUpstream(ctx, &store.UpstreamCreate{Name: name, BaseURL: url, APIKey: "sk-upstream", Format: format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := env.Store.CreateModel(ctx, &store.ModelCreate{Name: name, Provider: format, UpstreamID: &u.ID, FallbackUpstreamIDs: fallbacks}); err != nil {
+			t.Fatal(err)
+		}
+		return u.ID
+	}
+	// A 503 from an Anthropic upstream fails over to the OpenAI one, so the
+	// request is translated on the second attempt; a connection error fails
+	// over the other way. Unreachable upstreams are tried in priority order.
+	overloadedID := create("claude-failover", "anthropic", overloaded.URL, byFormat["openai"])
+	unreachableID := create("gpt-failover", "openai", unreachable.URL, byFormat["anthropic"])
+	create("claude-no-fallback", "anthropic", overloaded.URL)
+
+	tests := []struct {
+		name, path, body, want string
+		from, servedBy         uuid.UUID
+	}{
+		{"503", "/v1/messages", anthropicBody("claude-failover", false), "Hello from openai", overloadedID, byFormat["openai"]},
+		{"503 streaming", "/v1/messages", anthropicBody("claude-failover", true), "Hello", overloadedID, byFormat["openai"]},
+		{"connection error", "/v1/chat/completions", openAIBody("gpt-failover", false), "Hello from anthropic", unreachableID, byFormat["anthropic"]},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := env.post(ctx, t, tc.path, tc.body, nil)
+			body := readAll(t, resp)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d: %s", resp.StatusCode, body)
+			}
+			if !strings.Contains(body, tc.want) {
+				t.Fatalf("expected %q in %s", tc.want, body)
+			}
+		})
+	}
+
+	// Without a fallback the upstream's error reaches the client.
+	resp := env.post(ctx, t, "/v1/messages", anthropicBody("claude-no-fallback", false), nil)
+	if body := readAll(t, resp); resp.StatusCode != http.StatusServiceUnavailable || !strings.Contains(body, "down for maintenance") {
+		t.Fatalf("no fallback: expected the upstream's 503, got %d: %s", resp.StatusCode, body)
+	}
+
+	// Each request is logged once, against the fallback that served it,
+	// with the upstreams it failed over from.
+	env.flushLogs()
+	logs, total, err := env.Store.ListLogs(ctx, store.LogFilter{Page: 1, PerPage: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != len(tests)+1 {
+		t.Errorf("expected one log per request, got %d", total)
+	}
+	served := map[uuid.UUID]int{}
+	for _, l := range logs {
+		if l.UpstreamID == nil || *l.StatusCode != http.StatusOK {
+			continue
+		}
+		from, _ := json.Marshal(l.RequestMetadata["failover_from"])
+		for _, tc := range tests {
+			if *l.UpstreamID == tc.servedBy && strings.Contains(string(from), tc.from.String()) {
+				served[tc.servedBy]++
+				break
+			}
+		}
+	}
+	if served[byFormat["openai"]] != 2 || served[byFormat["anthropic"]] != 1 {
+		t.Errorf("expected failed-over logs for each request, got %v", served)
+	}
+	status := http.StatusServiceUnavailable
+	if _, n, err := env.Store.ListLogs(ctx, store.LogFilter{StatusCode: &status, Page: 1, PerPage: 50}); err != nil || n != 1 {
+		t.Errorf("expected only the request without a fallback logged as a 503, got %d (%v)", n, err)
+	}
+}
+
+func TestE2EClientCancellation(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	for _, tc := range e2eCases("-hang", true) {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			resp := env.post(ctx, t, tc.path, tc.body, nil)
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d", resp.StatusCode)
+			}
+			// Wait for the first event so the upstream is mid-stream.
+			if _, err := bufio.NewReader(resp.Body).ReadString('\n'); err != nil {
+				t.Fatalf("read first event: %v", err)
+			}
+			cancel()
+
+			select {
+			case model := <-tc.upstream(env).canceled:
+				if !strings.HasSuffix(model, "-hang") {
+					t.Fatalf("unexpected canceled model %q", model)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("upstream request was not canceled after the client disconnected")
+			}
+		})
+	}
+}
+
+func TestE2EStreamKeepAlive(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	env.handler.SetSSEOptions(0, 20*time.Millisecond)
+
+	type keepAliveCase struct {
+		name, path, body, want string
+		header                 http.Header
+	}
+	var cases []keepAliveCase
+	for _, tc := range e2eCases("-hang", true) {
+		// Anthropic-format streams get Anthropic's ping event.
+		want := ": keep-alive"
+		if tc.path == "/v1/messages" {
+			want = `data: {"type": "ping"}`
+		}
+		cases = append(cases, keepAliveCase{tc.name, tc.path, tc.body, want, nil})
+	}
+	cases = append(cases, keepAliveCase{
+		"gemini->openai",
+		"/v1beta/models/gpt-e2e-hang:streamGenerateContent?alt=sse",
+		`{"contents":[{"role":"user","parts":[{"text":"Hi"}]}]}`,
+		": keep-alive",
+		http.Header{"Authorization": {""}, "X-Goog-Api-Key": {env.Key}},
+	})
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			// The upstream sends a few events, then nothing until the
+			// client goes away.
+			resp := env.post(ctx, t, tc.path, tc.body, tc.header)
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d", resp.StatusCode)
+			}
+			br := bufio.NewReader(resp.Body)
+			for {
+				line, err := br.ReadString('\n')
+				if err != nil {
+					t.Fatalf("no %q while the upstream was silent: %v", tc.want, err)
+				}
+				if strings.TrimRight(line, "\r\n") == tc.want {
+					return
+				}
+			}
+		})
+	}
+}
+
+func TestE2EAuth(t *testing.T) {
+	env := newE2EEnv(t, nil)
+
+	for _, tc := range []struct {
+		name   string
+		path   string
+		header http.Header
+		want   string
+	}{
+		{"anthropic missing key", "/v1/messages", http.Header{"Authorization": {""}}, "authentication_error"},
+		{"openai invalid key", "/v1/chat/completions", http.Header{"Authorization": {"Bearer pxb_invalid"}}, "Invalid API key"},
+		{"anthropic invalid x-api-key", "/v1/messages", http.Header{"Authorization": {""}, "X-Api-Key": {"pxb_invalid"}}, "Invalid API key"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := env.post(context.Background(), t, tc.path, anthropicBody("claude-e2e", false), tc.header)
+			body := readAll(t, resp)
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Fatalf("expected 401, got %d: %s", resp.StatusCode, body)
+			}
+			if !strings.Contains(body, tc.want) {
+				t.Fatalf("expected %q in %s", tc.want, body)
+			}
+		})
+	}
+
+	if reqs := env.Anthropic.requestCount() + env.OpenAI.requestCount(); reqs != 0 {
+		t.Fatalf("unauthenticated requests reached the upstream %d times", reqs)
+	}
+
+	// The x-api-key header works as well as a bearer token.
+	resp := env.post(context.Background(), t, "/v1/messages", anthropicBody("claude-e2e", false), http.Header{"Authorization": {""}, "X-Api-Key": {env.Key}})
+	if body := readAll(t, resp); resp.StatusCode != http.StatusOK {
+		t.Fatalf("x-api-key: status %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestE2EBudget(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+
+	price := 1000.0
+	for _, name := range []string{"gpt-e2e", "claude-e2e"} {
+		m, err := env.Store.GetModelByName(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := env.Store.UpdateModel(ctx, m.ID, &store.ModelUpdate{InputCostPerMillion: &price, OutputCostPerMillion: &price}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := env.billing.RefreshPricing(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, hash, prefix := auth.GenerateLLMKey()
+	key, err := env.Store.CreateLLMKey(ctx, hash, prefix, "budgeted", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	budget := 0.001
+	if _, err := env.Store.SetLLMKeyBudgets(ctx, key.ID, &budget, nil); err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{"Authorization": {"Bearer " + plaintext}}
+
+	resp := env.post(ctx, t, "/v1/chat/completions", openAIBody("gpt-e2e", false), header)
+	if body := readAll(t, resp); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+
+	// The first request spent the budget, so the next ones are cut off
+	// without reaching the upstream, in the client's error format.
+	for _, tc := range []struct {
+		path, body, want string
+	}{
+		{"/v1/chat/completions", openAIBody("gpt-e2e", false), `"code":"budget_exceeded"`},
+		{"/v1/messages", anthropicBody("claude-e2e", false), `"type":"rate_limit_error"`},
+	} {
+		resp := env.post(ctx, t, tc.path, tc.body, header)
+		body := readAll(t, resp)
+		if resp.StatusCode != http.StatusTooManyRequests || !strings.Contains(body, tc.want) || !strings.Contains(body, "Daily budget") {
+			t.Fatalf("%s: expected a budget error, got %d: %s", tc.path, resp.StatusCode, body)
+		}
+		if resp.Header.Get("Retry-After") == "" || resp.Header.Get("X-Ratelimit-Reset-Requests") == "" {
+			t.Fatalf("%s: missing Retry-After", tc.path)
+		}
+		if resp.Header.Get("X-Should-Retry") != "false" {
+			t.Fatalf("%s: expected SDKs not to retry until the budget resets", tc.path)
+		}
+	}
+	if n := env.OpenAI.requestCount() + env.Anthropic.requestCount(); n != 1 {
+		t.Fatalf("expected 1 upstream request, got %d", n)
+	}
+
+	// Other keys are not affected.
+	resp = env.post(ctx, t, "/v1/chat/completions", openAIBody("gpt-e2e", false), nil)
+	if body := readAll(t, resp); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestE2ERateLimit(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(0.1, 2)
+	defer limiter.Close()
+	env := newE2EEnv(t, limiter)
+
+	var codes []int
+	var resp *http.Response
+	var body string
+	for i := 0; i < 3; i++ {
+		resp = env.post(context.Background(), t, "/v1/chat/completions", openAIBody("gpt-e2e", false), nil)
+		body = readAll(t, resp)
+		codes = append(codes, resp.StatusCode)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Fatalf("expected [200 200 429], got %v", codes)
+	}
+	// The rejection is in the client's format, with the headers SDKs use to
+	// back off until the next token.
+	if !strings.Contains(body, `"code":"rate_limit_exceeded"`) {
+		t.Fatalf("expected an OpenAI rate limit error, got %s", body)
+	}
+	if resp.Header.Get("X-Ratelimit-Remaining-Requests") != "0" || resp.Header.Get("X-Ratelimit-Limit-Requests") != "2" ||
+		resp.Header.Get("Retry-After") == "" || resp.Header.Get("X-Should-Retry") != "true" {
+		t.Fatalf("missing rate limit headers: %v", resp.Header)
+	}
+	if n := env.OpenAI.requestCount(); n != 2 {
+		t.Fatalf("expected 2 upstream requests, got %d", n)
+	}
+}
+
+func TestE2ECompare(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+
+	body := `{"models":["gpt-e2e","claude-e2e","gpt-e2e-error"],"request":{"stream":true,"messages":[{"role":"user","content":"Hi"}]}}`
+	resp := env.post(ctx, t, "/v1/experimental/compare", body, nil)
+	raw := readAll(t, resp)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, raw)
+	}
+	var out struct {
+		Results []struct {
+			Model        string         `json:"model"`
+			StatusCode   int            `json:"status_code"`
+			InputTokens  int            `json:"input_tokens"`
+			OutputTokens int            `json:"output_tokens"`
+			Response     map[string]any `json:"response"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(raw), &out); err != nil {
+		t.Fatalf("decode %s: %v", raw, err)
+	}
+	if len(out.Results) != 3 {
+		t.Fatalf("expected 3 results, got %s", raw)
+	}
+	for i, want := range []string{"gpt-e2e", "claude-e2e"} {
+		r := out.Results[i]
+		if r.Model != want || r.StatusCode != http.StatusOK || r.InputTokens != 12 || r.OutputTokens != 3 || r.Response["object"] != "chat.completion" {
+			t.Errorf("result %d = %+v", i, r)
+		}
+	}
+	if r := out.Results[2]; r.StatusCode < 400 || r.Response["error"] == nil {
+		t.Errorf("error model result = %+v", r)
+	}
+
+	resp = env.post(ctx, t, "/v1/experimental/compare", `{"models":[],"request":{}}`, nil)
+	if body := readAll(t, resp); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("no models: expected 400, got %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestE2EFilterPolicy(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+	msg := "I can't help with that."
+	if _, err := env.Store.CreatePolicy(ctx, &store.PolicyCreate{Name: "moderation", Expression: "true", Action: policy.ActionFilter, Message: &msg}); err != nil {
+		t.Fatal(err)
+	}
+	engine := policy.NewEngine(env.Store, time.Minute)
+	t.Cleanup(engine.Close)
+	env.handler.SetPolicyEngine(engine)
+
+	// Blocked requests get a successful response in the client's format
+	// whose stop reason says the content was filtered.
+	gemini := `{"contents":[{"role":"user","parts":[{"text":"Hi"}]}]}`
+	for _, tc := range []struct {
+		name, path, body string
+		want             []string
+	}{
+		{"anthropic", "/v1/messages", anthropicBody("claude-e2e", false), []string{`"stop_reason":"refusal"`, msg}},
+		{"anthropic stream", "/v1/messages", anthropicBody("gpt-e2e", true), []string{"event: message_start", `"stop_reason":"refusal"`, "event: message_stop"}},
+		{"chat", "/v1/chat/completions", openAIBody("gpt-e2e", false), []string{`"finish_reason":"content_filter"`, msg}},
+		{"chat stream", "/v1/chat/completions", openAIBody("claude-e2e", true), []string{`"finish_reason":"content_filter"`, "data: [DONE]"}},
+		{"responses", "/v1/responses", `{"model":"gpt-e2e","input":"Hi"}`, []string{`"status":"incomplete"`, `"reason":"content_filter"`}},
+		{"responses stream", "/v1/responses", `{"model":"gpt-e2e","input":"Hi","stream":true}`, []string{"event: response.created", "event: response.incomplete", `"reason":"content_filter"`}},
+		{"gemini", "/v1beta/models/gpt-e2e:generateContent", gemini, []string{`"finishReason":"SAFETY"`, msg}},
+	} {
+		resp := env.post(ctx, t, tc.path, tc.body, nil)
+		out := readAll(t, resp)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", tc.name, resp.StatusCode, out)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(out, want) {
+				t.Fatalf("%s: expected %s in %s", tc.name, want, out)
+			}
+		}
+	}
+	if n := env.OpenAI.requestCount() + env.Anthropic.requestCount(); n != 0 {
+		t.Fatalf("expected no upstream requests, got %d", n)
+	}
+}
+
+func TestE2EPolicyActions(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+	target := "gpt-e2e"
+	maxTokens := 32
+	for _, pc := range []store.PolicyCreate{
+		{Name: "deny-header", Expression: `"x-block" in headers && headers["x-block"] == "yes"`, Action: policy.ActionDeny, Priority: 20},
+		{Name: "route-large", Expression: `key.name == "e2e" && input_tokens >= 500`, Action: policy.ActionRoute, TargetModel: &target, Priority: 10},
+		{Name: "cap", Expression: "true", Action: policy.ActionCap, MaxTokens: &maxTokens},
+	} {
+		if _, err := env.Store.CreatePolicy(ctx, &pc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine := policy.NewEngine(env.Store, time.Minute)
+	t.Cleanup(engine.Close)
+	env.handler.SetPolicyEngine(engine)
+
+	resp := env.post(ctx, t, "/v1/chat/completions", openAIBody("gpt-e2e", false), http.Header{"X-Block": {"yes"}})
+	if out := readAll(t, resp); resp.StatusCode != http.StatusForbidden || !strings.Contains(out, "deny-header") {
+		t.Fatalf("expected a 403 from the deny policy, got %d: %s", resp.StatusCode, out)
+	}
+	if n := env.OpenAI.requestCount(); n != 0 {
+		t.Fatalf("expected no upstream request for a denied request, got %d", n)
+	}
+
+	// Caps add max_tokens when the request has no limit.
+	resp = env.post(ctx, t, "/v1/chat/completions", openAIBody("gpt-e2e", false), nil)
+	if out := readAll(t, resp); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, out)
+	}
+	if got := env.OpenAI.lastRequest()["max_tokens"]; got != float64(maxTokens) {
+		t.Fatalf("expected max_tokens capped to %d, got %v", maxTokens, got)
+	}
+
+	// A large chunked request, with no Content-Length, is still sized for
+	// input_tokens and routed.
+	body := `{"model":"claude-e2e","max_tokens":1000,"messages":[{"role":"user","content":"` + strings.Repeat("a", 2000) + `"}]}`
+	req, err := http.NewRequestWithContext(ctx, "POST", env.URL+"/v1/chat/completions", io.MultiReader(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+env.Key)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := readAll(t, resp); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, out)
+	}
+	if n := env.Anthropic.requestCount(); n != 0 {
+		t.Fatalf("expected the request routed away from claude-e2e, got %d anthropic requests", n)
+	}
+	if got := env.OpenAI.lastRequest(); got["model"] != "gpt-e2e" || got["max_tokens"] != float64(maxTokens) {
+		t.Fatalf("expected a routed and capped request, got model %v max_tokens %v", got["model"], got["max_tokens"])
+	}
+}
+
+func TestE2EOpenAIPassthroughLimits(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+
+	m, err := env.Store.GetModelByName(ctx, "gpt-e2e")
+	if err != nil || m == nil {
+		t.Fatalf("get model: %v", err)
+	}
+	limit := 100
+	if err := env.Store.UpdateModel(ctx, m.ID, &store.ModelUpdate{MaxOutputTokens: &limit}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, field := range []string{"max_tokens", "max_completion_tokens"} {
+		body := `{"model":"gpt-e2e","` + field + `":1000,"messages":[{"role":"user","content":"Hi"}]}`
+		resp := env.post(ctx, t, "/v1/chat/completions", body, nil)
+		if out := readAll(t, resp); resp.StatusCode != http.StatusBadRequest || !strings.Contains(out, "1000 > 100") {
+			t.Fatalf("%s: expected a 400 for the output limit, got %d: %s", field, resp.StatusCode, out)
+		}
+	}
+	if n := env.OpenAI.requestCount(); n != 0 {
+		t.Fatalf("expected no upstream requests, got %d", n)
+	}
+
+	resp := env.post(ctx, t, "/v1/chat/completions", `{"model":"gpt-e2e","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`, nil)
+	if out := readAll(t, resp); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected a request within limits to pass, got %d: %s", resp.StatusCode, out)
+	}
+}
+
+func TestE2ESandbox(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	ctx := context.Background()
+
+	plaintext, hash, prefix := auth.GenerateLLMKey()
+	key, err := env.Store.CreateLLMKey(ctx, hash, prefix, "sandbox", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled := true
+	if err := env.Store.UpdateLLMKey(ctx, key.ID, store.LLMKeyUpdate{Sandbox: &enabled}); err != nil {
+		t.Fatal(err)
+	}
+	sandbox := http.Header{"Authorization": {"Bearer " + plaintext}}
+	gemini := http.Header{"Authorization": {""}, "X-Goog-Api-Key": {plaintext}}
+
+	// Every proxied endpoint is answered without reaching an upstream,
+	// whether the request is passed through or translated.
+	geminiBody := `{"contents":[{"role":"user","parts":[{"text":"Hi"}]}]}`
+	tests := []struct {
+		name, path, body string
+		header           http.Header
+		want             string
+	}{
+		{"messages", "/v1/messages", anthropicBody("claude-e2e", false), sandbox, "sandbox"},
+		{"messages streaming", "/v1/messages", anthropicBody("claude-e2e", true), sandbox, "event: message_stop"},
+		{"messages translated", "/v1/messages", anthropicBody("gpt-e2e", false), sandbox, "sandbox"},
+		{"count_tokens", "/v1/messages/count_tokens", `{"model":"claude-e2e","messages":[{"role":"user","content":"Hi"}]}`, sandbox, `"input_tokens":`},
+		{"chat completions", "/v1/chat/completions", openAIBody("gpt-e2e", false), sandbox, "sandbox"},
+		{"chat completions streaming", "/v1/chat/completions", openAIBody("gpt-e2e", true), sandbox, "[DONE]"},
+		{"chat completions translated", "/v1/chat/completions", openAIBody("claude-e2e", false), sandbox, "sandbox"},
+		{"responses", "/v1/responses", `{"model":"gpt-e2e","input":"Hi"}`, sandbox, "sandbox"},
+		{"responses compact", "/v1/responses/compact", `{"model":"gpt-e2e","input":"Hi"}`, sandbox, "sandbox"},
+		{"embeddings", "/v1/embeddings", `{"model":"gpt-e2e","input":["a","b"]}`, sandbox, `"embedding"`},
+		{"generateContent", "/v1beta/models/gpt-e2e:generateContent", geminiBody, gemini, "sandbox"},
+		{"generateContent translated", "/v1beta/models/claude-e2e:generateContent", geminiBody, gemini, "sandbox"},
+		{"streamGenerateContent", "/v1beta/models/gpt-e2e:streamGenerateContent?alt=sse", geminiBody, gemini, "sandbox"},
+		{"embedContent", "/v1beta/models/gpt-e2e:embedContent", `{"content":{"parts":[{"text":"a"}]}}`, gemini, `"values"`},
+		{"batchEmbedContents", "/v1beta/models/gpt-e2e:batchEmbedContents", `{"requests":[{"content":{"parts":[{"text":"a"}]}}]}`, gemini, `"embeddings"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := env.post(ctx, t, tc.path, tc.body, tc.header)
+			out := readAll(t, resp)
+			if resp.StatusCode != http.StatusOK || !strings.Contains(out, tc.want) {
+				t.Fatalf("expected 200 with %q, got %d: %s", tc.want, resp.StatusCode, out)
+			}
+		})
+	}
+	if n := env.OpenAI.requestCount() + env.Anthropic.requestCount(); n != 0 {
+		t.Fatalf("expected no upstream requests, got %d", n)
+	}
+}
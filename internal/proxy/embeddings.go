@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	json "github.com/bytedance/sonic"
+
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/logging"
+	"github.com/sertdev/pxbin/pkg/translate"
+)
+
+// HandleEmbeddings serves OpenAI embeddings requests (/v1/embeddings). The
+// body goes to OpenAI-format upstreams unchanged apart from the model name,
+// and the request is admitted, logged and billed by its input tokens like a
+// chat request. Anthropic has no embeddings API, so models linked to an
+// Anthropic-format upstream are rejected.
+func (h *Handler) HandleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	h.withFailover(w, r, h.handleEmbeddings)
+}
+
+func (h *Handler) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	keyID := auth.GetKeyIDFromContext(r.Context())
+
+	body, err := readBody(r)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Failed to read request body")
+		return
+	}
+	defer r.Body.Close()
+
+	model, _, err := extractModelAndStream(body)
+	if errors.Is(err, errDuplicateModel) {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", duplicateModelMessage)
+		return
+	}
+	if err != nil || model == "" {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Invalid request body: missing or invalid model")
+		return
+	}
+	bodyModel := model
+
+	priority, ok := requestPriority(r)
+	if !ok {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", invalidPriorityMessage)
+		return
+	}
+	r = withPriority(r, priority)
+
+	// Embeddings have no reply to filter, so filter policies deny them.
+	decision := h.admit(r, model, "openai", int64(len(body)))
+	r = withCanaryArm(r, decision)
+	if decision.Denied || decision.Filtered {
+		msg := decision.Message
+		if msg == "" {
+			msg = "Request denied by policy " + decision.Policy
+		}
+		h.logDenied(r, decision, model, "openai", start)
+		writeOpenAIError(w, http.StatusForbidden, "invalid_request_error", msg)
+		return
+	}
+	if decision.Model != "" {
+		model = decision.Model
+	}
+
+	upstream, err := h.resolveUpstream(r.Context(), model)
+	if err != nil {
+		status, msg := resolveErrorStatus(err)
+		if status == http.StatusForbidden {
+			h.logRejected(r, model, "openai", status, msg, start)
+			writeOpenAIError(w, status, "invalid_request_error", msg)
+			return
+		}
+		writeOpenAIError(w, status, "server_error", msg)
+		return
+	}
+	if upstream.format == "anthropic" {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Model is linked to an Anthropic-format upstream, which has no embeddings API")
+		return
+	}
+	r = withTranslationPath(r, upstream.format, false)
+	r = withRequestLogger(r, upstream)
+	if upstream.model != bodyModel {
+		if body, err = setRequestModel(body, upstream.model); err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
+			return
+		}
+	}
+	model = upstream.model
+	upstreamID := &upstream.id
+
+	overheadUS := int(time.Since(start).Microseconds())
+	upstreamResp, err := upstream.client.Do(r.Context(), "POST", "/v1/embeddings", bytes.NewReader(body), acceptCompressed(nil, upstream, false))
+	if err != nil {
+		h.log(r, &logging.LogEntry{
+			KeyID:        keyID,
+			Timestamp:    start,
+			Method:       r.Method,
+			Path:         r.URL.Path,
+			Model:        model,
+			InputFormat:  "openai",
+			UpstreamID:   upstreamID,
+			Region:       upstream.region,
+			StatusCode:   http.StatusBadGateway,
+			LatencyMS:    int(time.Since(start).Milliseconds()),
+			OverheadUS:   overheadUS,
+			ErrorMessage: "upstream connection error: " + err.Error(),
+			ErrorCode:    transportErrorCode(err),
+		})
+		writeOpenAIError(w, http.StatusBadGateway, "server_error", "Failed to connect to upstream")
+		return
+	}
+	defer upstreamResp.Body.Close()
+	setGatewayHeaders(w, r, upstream.id, model, overheadUS, false)
+	if v := upstreamResp.Header.Get("X-Request-Id"); v != "" {
+		w.Header().Set("X-Request-Id", v)
+	}
+
+	upstreamBody, err := io.ReadAll(upstreamResp.Body)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadGateway, "server_error", "Failed to read upstream response")
+		return
+	}
+	if upstreamResp.StatusCode >= 400 {
+		perr := classifyProviderError(upstreamResp.StatusCode, upstreamBody)
+		h.log(r, &logging.LogEntry{
+			KeyID:        keyID,
+			Timestamp:    start,
+			Method:       r.Method,
+			Path:         r.URL.Path,
+			Model:        model,
+			InputFormat:  "openai",
+			UpstreamID:   upstreamID,
+			Region:       upstream.region,
+			StatusCode:   upstreamResp.StatusCode,
+			LatencyMS:    int(time.Since(start).Milliseconds()),
+			OverheadUS:   overheadUS,
+			ErrorMessage: perr.logMessage(upstreamBody),
+			ErrorCode:    perr.errorCode(),
+		})
+		if perr != nil {
+			perr.writeOpenAI(w, upstreamResp.StatusCode)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(upstreamResp.StatusCode)
+		w.Write(upstreamBody)
+		return
+	}
+
+	// Only the model and usage are decoded; the embeddings pass through.
+	var usage struct {
+		Model string                          `json:"model"`
+		Usage *translate.OpenAIEmbeddingUsage `json:"usage"`
+	}
+	var inputTokens int
+	if err := json.Unmarshal(upstreamBody, &usage); err == nil {
+		if usage.Model != "" {
+			model = usage.Model
+		}
+		if usage.Usage != nil {
+			inputTokens = usage.Usage.PromptTokens
+		}
+	}
+
+	cost := h.billing.EmbeddingCost(model, inputTokens)
+	setUsageHeaders(w, r, cost, inputTokens, 0)
+	h.log(r, &logging.LogEntry{
+		KeyID:       keyID,
+		Timestamp:   start,
+		Method:      r.Method,
+		Path:        r.URL.Path,
+		Model:       model,
+		InputFormat: "openai",
+		UpstreamID:  upstreamID,
+		Region:      upstream.region,
+		StatusCode:  upstreamResp.StatusCode,
+		LatencyMS:   int(time.Since(start).Milliseconds()),
+		OverheadUS:  overheadUS,
+		InputTokens: inputTokens,
+		Cost:        cost,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(upstreamResp.StatusCode)
+	w.Write(upstreamBody)
+}
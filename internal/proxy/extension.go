@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sertdev/pxbin/internal/extension"
+)
+
+// SetExtensions sets the runtime that loads upstream extensions. Without
+// one, requests to upstreams with an extension fail rather than silently
+// skipping their dialect fixes.
+func (h *Handler) SetExtensions(rt *extension.Runtime) {
+	h.extensions = rt
+}
+
+// withExtension returns a copy of the client that runs ext on request and
+// response bodies. The copy shares the transport and circuit breaker.
+func (c *UpstreamClient) withExtension(ext *extension.Module) *UpstreamClient {
+	cp := *c
+	cp.ext = ext
+	return &cp
+}
+
+// extendRequest runs the extension's patch_request on a request body.
+func (c *UpstreamClient) extendRequest(ctx context.Context, body io.Reader) (io.Reader, error) {
+	if c.ext == nil || !c.ext.PatchesRequests() || body == nil {
+		return body, nil
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("read request body: %w", err)
+	}
+	if data, err = c.ext.PatchRequest(ctx, data); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// extendResponse runs the extension on a response: patch_chunk on each SSE
+// event of a stream, patch_response on anything else.
+func (c *UpstreamClient) extendResponse(ctx context.Context, resp *http.Response) error {
+	if c.ext == nil {
+		return nil
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		if !c.ext.PatchesChunks() {
+			return nil
+		}
+		stream, err := c.ext.NewStream(ctx)
+		if err != nil {
+			return err
+		}
+		resp.Body = &chunkPatcher{ctx: ctx, stream: stream, body: resp.Body, src: bufio.NewReader(resp.Body)}
+		return nil
+	}
+	if !c.ext.PatchesResponses() {
+		return nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("read response body: %w", err)
+	}
+	if data, err = c.ext.PatchResponse(ctx, data); err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	return nil
+}
+
+var (
+	sseDataPrefix = []byte("data:")
+	sseDone       = []byte("[DONE]")
+)
+
+// chunkPatcher rewrites the data lines of an SSE stream through an
+// extension, one event at a time, leaving other lines as they are.
+type chunkPatcher struct {
+	ctx    context.Context
+	stream *extension.Stream
+	body   io.ReadCloser
+	src    *bufio.Reader
+	out    []byte
+	err    error
+}
+
+func (p *chunkPatcher) Read(b []byte) (int, error) {
+	for len(p.out) == 0 {
+		if p.err != nil {
+			return 0, p.err
+		}
+		line, err := p.src.ReadBytes('\n')
+		if len(line) > 0 {
+			if p.out, p.err = p.patchLine(line); p.err != nil {
+				p.out = nil
+				continue
+			}
+		}
+		if err != nil {
+			p.err = err
+		}
+	}
+	n := copy(b, p.out)
+	p.out = p.out[n:]
+	return n, nil
+}
+
+func (p *chunkPatcher) patchLine(line []byte) ([]byte, error) {
+	if !bytes.HasPrefix(line, sseDataPrefix) {
+		return line, nil
+	}
+	payload := bytes.TrimSpace(line[len(sseDataPrefix):])
+	if len(payload) == 0 || bytes.Equal(payload, sseDone) {
+		return line, nil
+	}
+	patched, err := p.stream.PatchChunk(p.ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.ContainsAny(patched, "\r\n") {
+		return nil, fmt.Errorf("extension %s returned a multi-line chunk", p.stream.Name())
+	}
+	out := make([]byte, 0, len("data: ")+len(patched)+1)
+	out = append(out, "data: "...)
+	out = append(out, patched...)
+	return append(out, '\n'), nil
+}
+
+func (p *chunkPatcher) Close() error {
+	p.stream.Close(context.WithoutCancel(p.ctx))
+	return p.body.Close()
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sertdev/pxbin/internal/extension"
+)
+
+// testExtension is a hand-assembled module equivalent to
+//
+//	(module
+//	  (memory (export "memory") 1)
+//	  (data (i32.const 0) "{\"model\":\"m\",\"patched\":true}")
+//	  (data (i32.const 64) "{\"patched\":true}")
+//	  (func (export "alloc") (param i32) (result i32) (i32.const 1024))
+//	  (func (export "patch_request") (param i32 i32) (result i64)
+//	    (i64.or (i64.shl (i64.const 0) (i64.const 32)) (i64.const 28)))
+//	  (func (export "patch_chunk") (param i32 i32) (result i64)
+//	    (i64.or (i64.shl (i64.const 64) (i64.const 32)) (i64.const 16))))
+//
+// It replaces every request body and stream chunk with fixed JSON and leaves
+// non-streaming responses alone.
+const testExtension = "\x00\x61\x73\x6d\x01\x00\x00\x00\x01\x0c\x02\x60\x01\x7f\x01\x7f\x60\x02\x7f\x7f\x01\x7e\x03\x04\x03\x00\x01\x01\x05\x03\x01\x00" +
+	"\x01\x07\x30\x04\x06\x6d\x65\x6d\x6f\x72\x79\x02\x00\x05\x61\x6c\x6c\x6f\x63\x00\x00\x0d\x70\x61\x74\x63\x68\x5f\x72\x65\x71\x75" +
+	"\x65\x73\x74\x00\x01\x0b\x70\x61\x74\x63\x68\x5f\x63\x68\x75\x6e\x6b\x00\x02\x0a\x1e\x03\x05\x00\x41\x80\x08\x0b\x0a\x00\x42\x00" +
+	"\x42\x20\x86\x42\x1c\x84\x0b\x0b\x00\x42\xc0\x00\x42\x20\x86\x42\x10\x84\x0b\x0b\x38\x02\x00\x41\x00\x0b\x1c\x7b\x22\x6d\x6f\x64" +
+	"\x65\x6c\x22\x3a\x22\x6d\x22\x2c\x22\x70\x61\x74\x63\x68\x65\x64\x22\x3a\x74\x72\x75\x65\x7d\x00\x41\xc0\x00\x0b\x10\x7b\x22\x70" +
+	"\x61\x74\x63\x68\x65\x64\x22\x3a\x74\x72\x75\x65\x7d"
+
+func loadTestExtension(t *testing.T) *extension.Module {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "dialect.wasm"), []byte(testExtension), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rt, err := extension.NewRuntime(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rt.Close(context.Background()) })
+	ext, err := rt.Module(context.Background(), "dialect.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ext
+}
+
+func TestUpstreamClientExtension(t *testing.T) {
+	ext := loadTestExtension(t)
+
+	var received []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		if r.URL.Path == "/stream" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: {\"choices\":[]}\n\ndata: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"x"}`)
+	}))
+	defer srv.Close()
+
+	c := NewUpstreamClient(srv.URL, "sk-test", nil).withExtension(ext)
+
+	resp, err := c.Do(context.Background(), "POST", "/json", bytes.NewReader([]byte(`{"model":"m"}`)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(received) != `{"model":"m","patched":true}` {
+		t.Errorf("upstream received %q", received)
+	}
+	if string(body) != `{"id":"x"}` {
+		t.Errorf("response without patch_response changed to %q", body)
+	}
+
+	resp, err = c.Do(context.Background(), "POST", "/stream", bytes.NewReader([]byte(`{"model":"m","stream":true}`)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if want := "data: {\"patched\":true}\n\ndata: [DONE]\n\n"; string(body) != want {
+		t.Errorf("stream = %q, want %q", body, want)
+	}
+}
+
+func TestExtensionValidName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"mistral.wasm":     true,
+		"../mistral.wasm":  false,
+		"dir/mistral.wasm": false,
+		".hidden.wasm":     false,
+		"mistral.so":       false,
+		`dir\mistral.wasm`: false,
+	} {
+		if got := extension.ValidName(name); got != want {
+			t.Errorf("ValidName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/logging"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// failover is the state of a request that may be retried against its
+// model's fallback upstreams. It lives in the request context so that
+// resolveUpstream and the upstream client can reach it.
+type failover struct {
+	current uuid.UUID   // upstream of the attempt in progress
+	failed  []uuid.UUID // upstreams that already failed, in order
+	next    bool        // a fallback can take over if current fails
+
+	// retryable is set when current could not be reached or answered
+	// 502 or 503, as opposed to an error the request itself caused.
+	retryable bool
+
+	// attempts is how many times current was sent the request, its
+	// client's retries included.
+	attempts int
+
+	// body collects the request body as the first attempt reads it; nil
+	// once it is known that no fallback can take over.
+	body *bytes.Buffer
+
+	// entry is the log entry of an attempt that failed over, kept back so
+	// that only the request's final attempt is logged. The attempts before
+	// it are listed in that entry's failover_from.
+	entry *logging.LogEntry
+}
+
+// holds reports whether a response with status is held back for failover,
+// as failoverWriter decides.
+func (f *failover) holds(status int) bool {
+	return f.next && f.retryable && (status == http.StatusBadGateway || status == http.StatusServiceUnavailable)
+}
+
+// Write records request body bytes read by the first attempt.
+func (f *failover) Write(p []byte) (int, error) {
+	if f.body != nil {
+		f.body.Write(p)
+	}
+	return len(p), nil
+}
+
+type failoverKey struct{}
+
+func failoverFromContext(ctx context.Context) *failover {
+	f, _ := ctx.Value(failoverKey{}).(*failover)
+	return f
+}
+
+// noteUpstreamResult records whether an upstream call failed in a way
+// another upstream might not, and how many attempts it took.
+func noteUpstreamResult(ctx context.Context, resp *http.Response, err error, attempts int) {
+	f := failoverFromContext(ctx)
+	if f == nil {
+		return
+	}
+	f.attempts = attempts
+	f.retryable = err != nil ||
+		resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// withFailover runs serve, and runs it again against the model's next
+// fallback upstream while the attempt fails with a connection error or a
+// 502/503 before anything reaches the client. Each attempt re-resolves the
+// upstream, so a fallback with a different format gets the request
+// translated for it. The request body is kept for the retries. Only the
+// final attempt is logged; the upstreams that failed before it are listed
+// in its failover_from, so failed attempts count in no request stats.
+func (h *Handler) withFailover(w http.ResponseWriter, r *http.Request, serve http.HandlerFunc) {
+	f := &failover{body: &bytes.Buffer{}}
+	r = r.WithContext(context.WithValue(r.Context(), failoverKey{}, f))
+
+	src := r.Body
+	r.Body = io.NopCloser(io.TeeReader(src, f))
+	attempt := r
+	var body []byte
+	for {
+		fw := &failoverWriter{ResponseWriter: w, header: http.Header{}, f: f}
+		f.entry = nil
+		serve(fw, attempt)
+		if !fw.held {
+			h.releaseLog(attempt, f)
+			return
+		}
+		if body == nil {
+			// Whatever the first attempt left unread is needed too.
+			_, err := io.Copy(f.body, io.LimitReader(src, maxRequestBodySize+1-int64(f.body.Len())))
+			if err != nil {
+				fw.release()
+				h.releaseLog(attempt, f)
+				return
+			}
+			body = f.body.Bytes()
+		}
+		if r.Context().Err() != nil {
+			fw.release()
+			h.releaseLog(attempt, f)
+			return
+		}
+
+		f.failed = append(f.failed, f.current)
+		f.next, f.retryable = false, false
+		attempt = withFailedOver(r, slices.Clone(f.failed))
+		attempt.Body = io.NopCloser(bytes.NewReader(body))
+	}
+}
+
+// releaseLog queues the log entry held back for the final attempt of a
+// request, which is the one that answered the client.
+func (h *Handler) releaseLog(r *http.Request, f *failover) {
+	if f.entry != nil {
+		h.queueLog(r.Context(), f.entry)
+		f.entry = nil
+	}
+}
+
+// withFailedOver records the upstreams a request failed over from.
+func withFailedOver(r *http.Request, from []uuid.UUID) *http.Request {
+	t := requestLogTags(r)
+	t.failedOver = from
+	return withLogTags(r, t)
+}
+
+// failoverTarget picks the upstream for the current attempt of a request
+// with failover state: mw's own upstream first, then its fallbacks in
+// order, skipping those that already failed or that the schedule or the
+// key's regions rule out. Pinned requests stay on their pin.
+func (h *Handler) failoverTarget(ctx context.Context, mw *store.ModelWithUpstream, pinned bool, now time.Time) (*store.ModelWithUpstream, error) {
+	f := failoverFromContext(ctx)
+	if f == nil {
+		return mw, nil
+	}
+	var candidates []*store.Upstream
+	if !pinned {
+		key := auth.GetKeyFromContext(ctx)
+		for i := range mw.Fallbacks {
+			u := &mw.Fallbacks[i]
+			if slices.Contains(f.failed, u.ID) || !u.Availability.Allows(now) {
+				continue
+			}
+			if key != nil && !key.AllowsRegion(upstreamRegion(u)) {
+				continue
+			}
+			candidates = append(candidates, u)
+		}
+	}
+	if len(f.failed) > 0 {
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("no fallback upstream left for model %q", mw.Name)
+		}
+		mw = servedBy(mw, candidates[0])
+		candidates = candidates[1:]
+	}
+	f.current = *mw.UpstreamID
+	f.next = len(candidates) > 0
+	if !f.next && len(f.failed) == 0 {
+		f.body = nil
+	}
+	return mw, nil
+}
+
+func upstreamRegion(u *store.Upstream) string {
+	if u.Region == nil {
+		return ""
+	}
+	return *u.Region
+}
+
+// failoverWriter holds back a 502 or 503 caused by an unreachable or
+// overloaded upstream while a fallback can still take over, so the next
+// attempt can write the response instead. Headers are kept apart until the
+// status is written, so nothing from a failed attempt reaches the client.
+type failoverWriter struct {
+	http.ResponseWriter
+	header http.Header
+	f      *failover
+
+	wroteHeader bool
+	held        bool // the response is held back for failover
+	status      int
+	body        bytes.Buffer
+}
+
+func (w *failoverWriter) Header() http.Header {
+	if w.wroteHeader && !w.held {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *failoverWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.f.holds(status) {
+		w.held, w.status = true, status
+		return
+	}
+	maps.Copy(w.ResponseWriter.Header(), w.header)
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *failoverWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.held {
+		return w.body.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// release writes a held response after all, when no retry can be made.
+func (w *failoverWriter) release() {
+	maps.Copy(w.ResponseWriter.Header(), w.header)
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(w.body.Bytes())
+}
+
+// Flush implements http.Flusher.
+func (w *failoverWriter) Flush() {
+	if w.held {
+		return
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *failoverWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	json "github.com/bytedance/sonic"
+
+	"github.com/sertdev/pxbin/internal/ids"
+	"github.com/sertdev/pxbin/pkg/translate"
+)
+
+// Requests blocked by a filter policy are answered locally with the
+// response a provider sends when its own moderation stops a reply: a 200
+// whose stop reason marks the content as filtered, in the client's format
+// and streamed if the client asked for a stream. Clients then take their
+// usual refusal path instead of treating the block as an error. The
+// policy's message, if any, becomes the assistant text.
+
+// sseBuffer collects server-sent events for a response written in one go.
+type sseBuffer struct{ bytes.Buffer }
+
+// event appends an event; name is omitted for data-only streams.
+func (b *sseBuffer) event(name string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	if name != "" {
+		fmt.Fprintf(b, "event: %s\n", name)
+	}
+	fmt.Fprintf(b, "data: %s\n\n", data)
+}
+
+// writeFiltered writes a complete filtered response with status 200.
+func writeFiltered(w http.ResponseWriter, stream bool, body []byte) {
+	if stream {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writeAnthropicFiltered answers with stop_reason "refusal".
+func writeAnthropicFiltered(w http.ResponseWriter, model, message string, stream bool) {
+	stop := "refusal"
+	msg := translate.AnthropicResponse{
+		ID:      ids.AnthropicMessage(),
+		Type:    "message",
+		Role:    "assistant",
+		Model:   model,
+		Content: []translate.ContentBlock{},
+	}
+	if !stream {
+		if message != "" {
+			msg.Content = []translate.ContentBlock{{Type: "text", Text: message}}
+		}
+		msg.StopReason = &stop
+		body, _ := json.Marshal(msg)
+		writeFiltered(w, false, body)
+		return
+	}
+
+	var b sseBuffer
+	b.event("message_start", translate.MessageStartEvent{Type: "message_start", Message: msg})
+	if message != "" {
+		b.event("content_block_start", translate.ContentBlockStartEvent{
+			Type:         "content_block_start",
+			ContentBlock: translate.ContentBlock{Type: "text"},
+		})
+		b.event("content_block_delta", translate.ContentBlockDeltaEvent{
+			Type:  "content_block_delta",
+			Delta: translate.DeltaBlock{Type: "text_delta", Text: message},
+		})
+		b.event("content_block_stop", map[string]any{"type": "content_block_stop", "index": 0})
+	}
+	b.event("message_delta", translate.MessageDeltaEvent{
+		Type:  "message_delta",
+		Delta: translate.MessageDelta{StopReason: &stop},
+		Usage: &translate.MessageDeltaUsage{},
+	})
+	b.event("message_stop", map[string]any{"type": "message_stop"})
+	writeFiltered(w, true, b.Bytes())
+}
+
+// writeChatFiltered answers with finish_reason "content_filter". Gemini
+// clients, served through the chat handler, see finishReason SAFETY.
+func writeChatFiltered(w http.ResponseWriter, model, message string, stream bool) {
+	id := ids.ChatCompletion()
+	created := time.Now().Unix()
+	finish := "content_filter"
+	if !stream {
+		var content any
+		if message != "" {
+			content = message
+		}
+		body, _ := json.Marshal(translate.OpenAIResponse{
+			ID:      id,
+			Object:  "chat.completion",
+			Created: created,
+			Model:   model,
+			Choices: []translate.OpenAIChoice{{
+				Message:      translate.OpenAIMessage{Role: "assistant", Content: content},
+				FinishReason: &finish,
+			}},
+			Usage: &translate.OpenAIUsage{},
+		})
+		writeFiltered(w, false, body)
+		return
+	}
+
+	var b sseBuffer
+	chunk := func(choice translate.OpenAIStreamChoice) {
+		b.event("", translate.OpenAIStreamChunk{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []translate.OpenAIStreamChoice{choice},
+		})
+	}
+	delta := translate.OpenAIStreamDelta{Role: "assistant"}
+	if message != "" {
+		delta.Content = &message
+	}
+	chunk(translate.OpenAIStreamChoice{Delta: delta})
+	chunk(translate.OpenAIStreamChoice{FinishReason: &finish})
+	b.WriteString("data: [DONE]\n\n")
+	writeFiltered(w, true, b.Bytes())
+}
+
+// writeResponsesFiltered answers with an incomplete response whose
+// incomplete_details.reason is "content_filter".
+func writeResponsesFiltered(w http.ResponseWriter, model, message string, stream bool) {
+	resp := map[string]any{
+		"id":                 ids.Response(),
+		"object":             "response",
+		"created_at":         time.Now().Unix(),
+		"model":              model,
+		"status":             "incomplete",
+		"incomplete_details": map[string]any{"reason": "content_filter"},
+		"output":             []translate.ResponsesOutputItem{},
+		"usage":              translate.ResponsesUsage{},
+	}
+	var item *translate.ResponsesOutputItem
+	if message != "" {
+		item = &translate.ResponsesOutputItem{
+			Type:    "message",
+			ID:      ids.ResponseMessage(),
+			Role:    "assistant",
+			Status:  "incomplete",
+			Content: []translate.ResponsesContentPart{{Type: "output_text", Text: message}},
+		}
+		resp["output"] = []translate.ResponsesOutputItem{*item}
+	}
+	if !stream {
+		body, _ := json.Marshal(resp)
+		writeFiltered(w, false, body)
+		return
+	}
+
+	var b sseBuffer
+	created := map[string]any{
+		"id":         resp["id"],
+		"object":     "response",
+		"created_at": resp["created_at"],
+		"model":      model,
+		"status":     "in_progress",
+		"output":     []translate.ResponsesOutputItem{},
+	}
+	b.event("response.created", map[string]any{"type": "response.created", "response": created})
+	if item != nil {
+		part := item.Content[0]
+		added := *item
+		added.Status, added.Content = "in_progress", []translate.ResponsesContentPart{}
+		b.event("response.output_item.added", map[string]any{"type": "response.output_item.added", "output_index": 0, "item": added})
+		b.event("response.content_part.added", map[string]any{"type": "response.content_part.added", "output_index": 0, "content_index": 0, "part": translate.ResponsesContentPart{Type: "output_text"}})
+		b.event("response.output_text.delta", map[string]any{"type": "response.output_text.delta", "output_index": 0, "content_index": 0, "delta": message})
+		b.event("response.output_text.done", map[string]any{"type": "response.output_text.done", "output_index": 0, "content_index": 0, "text": message})
+		b.event("response.content_part.done", map[string]any{"type": "response.content_part.done", "output_index": 0, "content_index": 0, "part": part})
+		b.event("response.output_item.done", map[string]any{"type": "response.output_item.done", "output_index": 0, "item": *item})
+	}
+	b.event("response.incomplete", map[string]any{"type": "response.incomplete", "response": resp})
+	writeFiltered(w, true, b.Bytes())
+}
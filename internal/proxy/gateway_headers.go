@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/auth"
+)
+
+// Gateway response headers. They are only sent to keys with gateway_headers
+// enabled, so routing and cost details stay private by default.
+const (
+	headerUpstream     = "X-Pxbin-Upstream"
+	headerModel        = "X-Pxbin-Model"
+	headerOverheadUS   = "X-Pxbin-Overhead-Us"
+	headerCost         = "X-Pxbin-Cost"
+	headerInputTokens  = "X-Pxbin-Input-Tokens"
+	headerOutputTokens = "X-Pxbin-Output-Tokens"
+	headerPriority     = "X-Pxbin-Priority"
+)
+
+// usageTrailers lists the headers only known once a stream has finished;
+// streaming responses declare them as HTTP trailers.
+const usageTrailers = headerCost + ", " + headerInputTokens + ", " + headerOutputTokens
+
+func gatewayHeadersEnabled(r *http.Request) bool {
+	key := auth.GetKeyFromContext(r.Context())
+	return key != nil && key.GatewayHeaders
+}
+
+// setGatewayHeaders sets the routing headers once the upstream has answered.
+// It must be called before the response status is written.
+func setGatewayHeaders(w http.ResponseWriter, r *http.Request, upstreamID uuid.UUID, model string, overheadUS int, stream bool) {
+	if !gatewayHeadersEnabled(r) {
+		return
+	}
+	h := w.Header()
+	h.Set(headerUpstream, upstreamID.String())
+	h.Set(headerModel, model)
+	h.Set(headerOverheadUS, strconv.Itoa(overheadUS))
+	if p := requestLogTags(r).priority; p != "" {
+		h.Set(headerPriority, p)
+	}
+	if stream {
+		h.Set("Trailer", usageTrailers)
+	}
+}
+
+// setUsageHeaders sets the token and cost headers. For non-streaming
+// responses it must be called before the status is written; after a stream
+// the values are sent as the trailers declared by setGatewayHeaders. Sandbox
+// keys are never charged.
+func setUsageHeaders(w http.ResponseWriter, r *http.Request, cost float64, inputTokens, outputTokens int) {
+	if !gatewayHeadersEnabled(r) {
+		return
+	}
+	if isSandboxKey(r.Context()) {
+		cost = 0
+	}
+	h := w.Header()
+	h.Set(headerCost, strconv.FormatFloat(cost, 'f', -1, 64))
+	h.Set(headerInputTokens, strconv.Itoa(inputTokens))
+	h.Set(headerOutputTokens, strconv.Itoa(outputTokens))
+}
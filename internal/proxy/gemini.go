@@ -0,0 +1,383 @@
+package proxy
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	json "github.com/bytedance/sonic"
+	"github.com/sertdev/pxbin/internal/tracing"
+	"github.com/sertdev/pxbin/pkg/translate"
+)
+
+// HandleGemini serves Gemini generateContent and streamGenerateContent
+// requests (/v1beta/models/{model}:{method}). The request is translated to
+// Chat Completions and run through HandleOpenAI, so it can be routed to any
+// upstream and is admitted, limited, logged and billed like a chat request;
+// the response is translated back on its way to the client. embedContent
+// and batchEmbedContents requests go through HandleEmbeddings the same way.
+func (h *Handler) HandleGemini(w http.ResponseWriter, r *http.Request) {
+	model, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1beta/models/"), ":")
+	if !ok || model == "" {
+		writeGeminiError(w, http.StatusNotFound, "Expected /v1beta/models/{model}:generateContent")
+		return
+	}
+	var stream bool
+	switch method {
+	case "generateContent":
+	case "streamGenerateContent":
+		stream = true
+	case "embedContent", "batchEmbedContents":
+		h.handleGeminiEmbed(w, r, model, method == "batchEmbedContents")
+		return
+	default:
+		writeGeminiError(w, http.StatusNotFound, fmt.Sprintf("Method %s is not supported", method))
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		writeGeminiError(w, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	defer r.Body.Close()
+
+	var req translate.GeminiRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeGeminiError(w, http.StatusBadRequest, "Invalid JSON in request body")
+		return
+	}
+	span := startTranslate(r.Context(), "gemini", "openai")
+	chatReq, err := translate.GeminiRequestToOpenAI(&req, model, stream)
+	tracing.EndWithError(span, err)
+	if err != nil {
+		writeGeminiError(w, http.StatusBadRequest, "Failed to translate request: "+err.Error())
+		return
+	}
+	chatBody, err := json.Marshal(chatReq)
+	if err != nil {
+		writeGeminiError(w, http.StatusInternalServerError, "Failed to encode translated request")
+		return
+	}
+
+	// The path is kept for logs and policies. The query carries Gemini's
+	// alt and key parameters, which mean nothing to the chat handler.
+	sub := withInputFormat(r.Clone(r.Context()), "gemini")
+	sub.URL.RawQuery = ""
+	sub.Header.Del("Accept")
+	sub.Header.Del("Last-Event-ID")
+	sub.Body = io.NopCloser(bytes.NewReader(chatBody))
+	sub.ContentLength = int64(len(chatBody))
+
+	gw := newGeminiWriter(w, model, stream, r.URL.Query().Get("alt") == "sse")
+	h.HandleOpenAI(gw, sub)
+	gw.close()
+}
+
+// handleGeminiEmbed serves embedContent and batchEmbedContents requests by
+// translating them to an embeddings request run through HandleEmbeddings.
+func (h *Handler) handleGeminiEmbed(w http.ResponseWriter, r *http.Request, model string, batch bool) {
+	body, err := readBody(r)
+	if err != nil {
+		writeGeminiError(w, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	defer r.Body.Close()
+
+	var reqs []translate.GeminiEmbedContentRequest
+	if batch {
+		var req translate.GeminiBatchEmbedContentsRequest
+		err = json.Unmarshal(body, &req)
+		reqs = req.Requests
+	} else {
+		var req translate.GeminiEmbedContentRequest
+		err = json.Unmarshal(body, &req)
+		reqs = []translate.GeminiEmbedContentRequest{req}
+	}
+	if err != nil {
+		writeGeminiError(w, http.StatusBadRequest, "Invalid JSON in request body")
+		return
+	}
+	span := startTranslate(r.Context(), "gemini", "openai")
+	embReq, err := translate.GeminiEmbedRequestsToOpenAI(reqs, model)
+	tracing.EndWithError(span, err)
+	if err != nil {
+		writeGeminiError(w, http.StatusBadRequest, "Failed to translate request: "+err.Error())
+		return
+	}
+	embBody, err := json.Marshal(embReq)
+	if err != nil {
+		writeGeminiError(w, http.StatusInternalServerError, "Failed to encode translated request")
+		return
+	}
+
+	sub := withInputFormat(r.Clone(r.Context()), "gemini")
+	sub.URL.RawQuery = ""
+	sub.Body = io.NopCloser(bytes.NewReader(embBody))
+	sub.ContentLength = int64(len(embBody))
+
+	ew := &geminiEmbedWriter{ResponseWriter: w}
+	h.HandleEmbeddings(ew, sub)
+	ew.close(batch)
+}
+
+// geminiEmbedWriter buffers what HandleEmbeddings writes, for close to
+// translate into Gemini's format.
+type geminiEmbedWriter struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+func (g *geminiEmbedWriter) WriteHeader(status int) {
+	if g.status == 0 {
+		g.status = status
+	}
+}
+
+func (g *geminiEmbedWriter) Write(p []byte) (int, error) {
+	g.WriteHeader(http.StatusOK)
+	return g.buf.Write(p)
+}
+
+func (g *geminiEmbedWriter) close(batch bool) {
+	status := cmp.Or(g.status, http.StatusOK)
+	var body []byte
+	if status >= 400 {
+		body = translate.TranslateOpenAIErrorToGemini(status, g.buf.Bytes())
+	} else {
+		var resp translate.OpenAIEmbeddingResponse
+		err := json.Unmarshal(g.buf.Bytes(), &resp)
+		var out *translate.GeminiBatchEmbedContentsResponse
+		if err == nil {
+			out, err = translate.OpenAIEmbeddingsToGemini(&resp)
+		}
+		switch {
+		case err != nil || len(out.Embeddings) == 0:
+			status = http.StatusBadGateway
+			body = translate.MarshalGeminiError(status, "Failed to parse upstream response")
+		case batch:
+			body, _ = json.Marshal(out)
+		default:
+			body, _ = json.Marshal(translate.GeminiEmbedContentResponse{Embedding: out.Embeddings[0]})
+		}
+	}
+	g.Header().Del("Content-Length")
+	g.Header().Set("Content-Type", "application/json")
+	g.ResponseWriter.WriteHeader(status)
+	g.ResponseWriter.Write(body)
+}
+
+func writeGeminiError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(translate.MarshalGeminiError(statusCode, message))
+}
+
+// geminiWriter translates what HandleOpenAI writes into Gemini's format.
+// Chat Completions streams are converted as they are written: to server-sent
+// events with ?alt=sse, otherwise to a JSON array written incrementally, as
+// Gemini does. Other responses are buffered and converted by close.
+type geminiWriter struct {
+	http.ResponseWriter
+
+	model  string
+	stream bool // streamGenerateContent
+	sse    bool // ?alt=sse
+
+	status      int
+	wroteHeader bool
+	converting  bool // translating a stream as it is written
+	buf         bytes.Buffer
+	line        []byte // incomplete SSE line
+
+	conv   *translate.GeminiStreamConverter
+	events int
+}
+
+func newGeminiWriter(w http.ResponseWriter, model string, stream, sse bool) *geminiWriter {
+	return &geminiWriter{
+		ResponseWriter: w,
+		model:          model,
+		stream:         stream,
+		sse:            sse,
+		status:         http.StatusOK,
+		conv:           translate.NewGeminiStreamConverter(model),
+	}
+}
+
+func (g *geminiWriter) WriteHeader(status int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	g.status = status
+	if !strings.HasPrefix(g.Header().Get("Content-Type"), "text/event-stream") {
+		return // buffered until close
+	}
+	g.converting = true
+	g.Header().Del("Content-Length")
+	if !g.sse {
+		g.Header().Set("Content-Type", "application/json")
+	}
+	g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *geminiWriter) Write(p []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if !g.converting {
+		return g.buf.Write(p)
+	}
+
+	var out []byte
+	rest := p
+	for len(rest) > 0 {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			g.line = append(g.line, rest...)
+			break
+		}
+		line := rest[:i]
+		if len(g.line) > 0 {
+			line = append(g.line, line...)
+			g.line = g.line[:0]
+		}
+		rest = rest[i+1:]
+		out = g.processLine(bytes.TrimSpace(line), out)
+	}
+	if len(out) > 0 {
+		if _, err := g.ResponseWriter.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// processLine consumes one line of a Chat Completions stream and appends
+// the Gemini events it completes to out.
+func (g *geminiWriter) processLine(line, out []byte) []byte {
+	if bytes.HasPrefix(line, []byte(":")) {
+		return g.appendKeepAlive(out)
+	}
+	payload, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return out
+	}
+	payload = bytes.TrimSpace(payload)
+	if bytes.Equal(payload, []byte("[DONE]")) {
+		return g.finish(out)
+	}
+	var probe struct {
+		Error *translate.OpenAIError `json:"error"`
+	}
+	if json.Unmarshal(payload, &probe) == nil && probe.Error != nil {
+		return g.appendEvent(out, translate.MarshalGeminiError(http.StatusInternalServerError, probe.Error.Message))
+	}
+	var chunk translate.OpenAIStreamChunk
+	if json.Unmarshal(payload, &chunk) != nil {
+		return out
+	}
+	for _, resp := range g.conv.Convert(&chunk) {
+		b, _ := json.Marshal(resp)
+		out = g.appendEvent(out, b)
+	}
+	return out
+}
+
+func (g *geminiWriter) finish(out []byte) []byte {
+	if resp, ok := g.conv.Finish(); ok {
+		b, _ := json.Marshal(resp)
+		out = g.appendEvent(out, b)
+	}
+	return out
+}
+
+// appendEvent frames one response as an SSE event or a JSON array element.
+func (g *geminiWriter) appendEvent(out, event []byte) []byte {
+	g.events++
+	if g.sse {
+		out = append(out, "data: "...)
+		out = append(out, event...)
+		return append(out, "\r\n\r\n"...)
+	}
+	if g.events == 1 {
+		out = append(out, '[')
+	} else {
+		out = append(out, ",\r\n"...)
+	}
+	return append(out, event...)
+}
+
+// appendKeepAlive passes on a keep-alive comment of the chat stream, which
+// is only written between events: as a comment with ?alt=sse, otherwise as
+// whitespace, which JSON allows between array elements.
+func (g *geminiWriter) appendKeepAlive(out []byte) []byte {
+	if g.sse {
+		return append(out, ": keep-alive\r\n\r\n"...)
+	}
+	return append(out, "\r\n"...)
+}
+
+// close finishes the response once HandleOpenAI has returned.
+func (g *geminiWriter) close() {
+	if g.converting {
+		out := g.finish(nil)
+		if !g.sse {
+			if g.events == 0 {
+				out = append(out, '[')
+			}
+			out = append(out, ']')
+		}
+		g.ResponseWriter.Write(out)
+		g.Flush()
+		return
+	}
+
+	var body []byte
+	switch {
+	case g.status >= 400:
+		body = translate.TranslateOpenAIErrorToGemini(g.status, g.buf.Bytes())
+	default:
+		var chatResp translate.OpenAIResponse
+		if err := json.Unmarshal(g.buf.Bytes(), &chatResp); err != nil {
+			g.status = http.StatusBadGateway
+			body = translate.MarshalGeminiError(g.status, "Failed to parse upstream response")
+			break
+		}
+		body, _ = json.Marshal(translate.OpenAIResponseToGemini(&chatResp, g.model))
+		if g.stream {
+			body = g.appendEvent(nil, body)
+			if !g.sse {
+				body = append(body, ']')
+			}
+		}
+	}
+	g.Header().Del("Content-Length")
+	if g.stream && g.sse && g.status < 400 {
+		g.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		g.Header().Set("Content-Type", "application/json")
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+	g.ResponseWriter.Write(body)
+}
+
+// Flush implements http.Flusher.
+func (g *geminiWriter) Flush() {
+	if !g.converting {
+		return
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (g *geminiWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
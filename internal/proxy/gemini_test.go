@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const geminiTestStream = "data: {\"id\":\"c1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"}}]}\n\n" +
+	"data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\"}]}\n\n" +
+	"data: {\"id\":\"c1\",\"choices\":[],\"usage\":{\"prompt_tokens\":4,\"completion_tokens\":2,\"total_tokens\":6}}\n\n" +
+	"data: [DONE]\n\n"
+
+// writeStream writes s in small pieces, so events are split across writes.
+func writeStream(w http.ResponseWriter, s string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	for len(s) > 0 {
+		n := min(7, len(s))
+		io.WriteString(w, s[:n])
+		s = s[n:]
+	}
+}
+
+func TestGeminiWriterSSE(t *testing.T) {
+	rec := httptest.NewRecorder()
+	gw := newGeminiWriter(rec, "gpt-4o", true, true)
+	writeStream(gw, geminiTestStream)
+	gw.close()
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	events := strings.Split(strings.TrimSuffix(rec.Body.String(), "\r\n\r\n"), "\r\n\r\n")
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %q", rec.Body.String())
+	}
+	for i, want := range []string{`"text":"Hel"`, `"text":"lo"`, `"finishReason":"STOP"`} {
+		if !strings.HasPrefix(events[i], "data: {") || !strings.Contains(events[i], want) {
+			t.Errorf("event %d = %q, want %s", i, events[i], want)
+		}
+	}
+	if !strings.Contains(events[2], `"totalTokenCount":6`) {
+		t.Errorf("final event has no usage: %q", events[2])
+	}
+}
+
+func TestGeminiWriterJSONArray(t *testing.T) {
+	rec := httptest.NewRecorder()
+	gw := newGeminiWriter(rec, "gpt-4o", true, false)
+	writeStream(gw, geminiTestStream)
+	gw.close()
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	var events []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &events); err != nil {
+		t.Fatalf("body is not a JSON array: %v: %s", err, rec.Body.String())
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 responses, got %d", len(events))
+	}
+}
+
+func TestGeminiWriterKeepAlive(t *testing.T) {
+	// A keep-alive comment after the first chat event.
+	stream := strings.Replace(geminiTestStream, "\n\n", "\n\n: keep-alive\n\n", 1)
+
+	rec := httptest.NewRecorder()
+	gw := newGeminiWriter(rec, "gpt-4o", true, true)
+	writeStream(gw, stream)
+	gw.close()
+	events := strings.Split(strings.TrimSuffix(rec.Body.String(), "\r\n\r\n"), "\r\n\r\n")
+	if len(events) != 4 || events[1] != ": keep-alive" {
+		t.Fatalf("expected a keep-alive after the first event, got %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	gw = newGeminiWriter(rec, "gpt-4o", true, false)
+	writeStream(gw, stream)
+	gw.close()
+	var responses []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &responses); err != nil || len(responses) != 3 {
+		t.Fatalf("body is not a JSON array of 3 responses: %v: %s", err, rec.Body.String())
+	}
+}
+
+func TestGeminiWriterNonStreaming(t *testing.T) {
+	rec := httptest.NewRecorder()
+	gw := newGeminiWriter(rec, "gpt-4o", false, false)
+	gw.Header().Set("Content-Type", "application/json")
+	gw.WriteHeader(http.StatusOK)
+	io.WriteString(gw, `{"id":"c1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"length"}],"usage":{"prompt_tokens":4,"completion_tokens":2,"total_tokens":6}}`)
+	gw.close()
+
+	var resp struct {
+		Candidates []struct {
+			FinishReason string `json:"finishReason"`
+		} `json:"candidates"`
+		UsageMetadata struct {
+			CandidatesTokenCount int `json:"candidatesTokenCount"`
+		} `json:"usageMetadata"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || len(resp.Candidates) != 1 || resp.Candidates[0].FinishReason != "MAX_TOKENS" || resp.UsageMetadata.CandidatesTokenCount != 2 {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestGeminiWriterError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	gw := newGeminiWriter(rec, "gpt-4o", true, true)
+	writeOpenAIError(gw, http.StatusForbidden, "invalid_request_error", "denied by policy")
+	gw.close()
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	want := `{"error":{"code":403,"message":"denied by policy","status":"PERMISSION_DENIED"}}`
+	if got := rec.Body.String(); got != want {
+		t.Fatalf("body = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,436 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	json "github.com/bytedance/sonic"
+
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/guardrail"
+	"github.com/sertdev/pxbin/internal/logging"
+	"github.com/sertdev/pxbin/pkg/translate"
+)
+
+// API formats a guardrail answers a blocked request or response in.
+const (
+	guardAnthropic = "anthropic"
+	guardChat      = "chat"
+	guardResponses = "responses"
+)
+
+// maxGuardedStreamText bounds the text collected from a streamed response
+// for its guardrails; the rest of the stream is not checked.
+const maxGuardedStreamText = 1 << 20
+
+// guardStreamOverlap is how much of a stream's text already checked is
+// checked again with each new line, so that a match split across lines is
+// still found. Longer matches are only found once the stream has ended.
+const guardStreamOverlap = 4 << 10
+
+// errGuardBlocked is returned by writes to a stream ended by a block
+// verdict, so that the handler stops copying it.
+var errGuardBlocked = errors.New("stream blocked by guardrail")
+
+// requestTextKeys are the JSON keys whose string values make up the text of
+// a request: messages, system prompts and instructions in every format.
+var requestTextKeys = map[string]bool{
+	"text": true, "content": true, "system": true, "input": true, "instructions": true, "prompt": true,
+}
+
+// responseTextKeys are the JSON keys whose string values make up the text
+// of a response or of its stream events. Responses echo the request's
+// instructions, which are left out.
+var responseTextKeys = map[string]bool{"text": true, "content": true, "delta": true}
+
+// SetGuardrails checks requests and responses against the guardrails of e.
+func (h *Handler) SetGuardrails(e *guardrail.Engine) {
+	h.guardrails = e
+}
+
+// guardCheck holds a request's log entries back until its response has
+// been checked, so that they carry its guardrail verdicts.
+type guardCheck struct {
+	mu   sync.Mutex
+	held []*logging.LogEntry
+	done bool
+}
+
+type guardCheckKey struct{}
+
+func (c *guardCheck) hold(e *logging.LogEntry) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		return false
+	}
+	c.held = append(c.held, e)
+	return true
+}
+
+func (c *guardCheck) finish() []*logging.LogEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done = true
+	return c.held
+}
+
+// guardHeld holds e back while the request's guardrails are checked. It
+// returns false if e should be logged now.
+func guardHeld(ctx context.Context, e *logging.LogEntry) bool {
+	c, _ := ctx.Value(guardCheckKey{}).(*guardCheck)
+	return c != nil && c.hold(e)
+}
+
+// withGuardrails runs serve with the guardrails of the request's key. The
+// request's text is checked before serve runs: a block verdict answers it
+// with a 400 in format. A complete response is held back until serve
+// returns, then checked and replaced with a content-filtered response on a
+// block verdict. A stream is checked line by line as it is written, and
+// ended with an error event in place of the first line that gets a block
+// verdict. Every verdict is stored with the request's log entries.
+func (h *Handler) withGuardrails(w http.ResponseWriter, r *http.Request, format string, serve http.HandlerFunc) {
+	keyID := auth.GetKeyIDFromContext(r.Context())
+	checkRequest := h.guardrails.Applies(keyID, guardrail.StageRequest)
+	checkResponse := h.guardrails.Applies(keyID, guardrail.StageResponse)
+	if !checkRequest && !checkResponse {
+		serve(w, r)
+		return
+	}
+
+	start := time.Now()
+	body, err := readBody(r)
+	if err != nil {
+		writeGuardError(w, format, "Failed to read request body")
+		return
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	model, stream, _ := extractModelAndStream(body)
+
+	c := &guardCheck{}
+	outer := r
+	r = r.WithContext(context.WithValue(r.Context(), guardCheckKey{}, c))
+
+	var verdicts []guardrail.Verdict
+	if checkRequest {
+		verdicts = h.guardrails.Check(keyID, guardrail.StageRequest, guardedText(body, requestTextKeys))
+		if v := guardrail.Blocked(verdicts); v != nil {
+			inputFormat := "openai"
+			if format == guardAnthropic {
+				inputFormat = "anthropic"
+			}
+			h.log(r, &logging.LogEntry{
+				KeyID:        keyID,
+				Timestamp:    start,
+				Method:       r.Method,
+				Path:         r.URL.Path,
+				Model:        model,
+				InputFormat:  inputFormat,
+				StatusCode:   http.StatusBadRequest,
+				LatencyMS:    int(time.Since(start).Milliseconds()),
+				ErrorMessage: "blocked by guardrail " + v.Guardrail,
+				ErrorCode:    "guardrail_blocked",
+			})
+			writeGuardError(w, format, guardMessage(v, "Request"))
+			h.releaseGuarded(outer, c, verdicts, nil)
+			return
+		}
+	}
+	if !checkResponse {
+		serve(w, r)
+		h.releaseGuarded(outer, c, verdicts, nil)
+		return
+	}
+
+	gw := &guardWriter{ResponseWriter: w, stream: stream, format: format}
+	if stream {
+		gw.check = func(text string) *guardrail.Verdict {
+			return guardrail.Blocked(h.guardrails.Check(keyID, guardrail.StageResponse, text))
+		}
+	}
+	serve(gw, r)
+	found := h.guardrails.Check(keyID, guardrail.StageResponse, gw.text())
+	if v := gw.blocked; v != nil && !slices.ContainsFunc(found, func(f guardrail.Verdict) bool { return f.Guardrail == v.Guardrail }) {
+		found = append(found, *v)
+	}
+	verdicts = append(verdicts, found...)
+	var blocked *guardrail.Verdict
+	if gw.blocked != nil {
+		blocked = gw.blocked
+	} else if v := guardrail.Blocked(found); v != nil && !stream && gw.status == http.StatusOK {
+		blocked = v
+		w.Header().Del("Content-Length")
+		msg := guardMessage(v, "Response")
+		switch format {
+		case guardAnthropic:
+			writeAnthropicFiltered(w, model, msg, false)
+		case guardResponses:
+			writeResponsesFiltered(w, model, msg, false)
+		default:
+			writeChatFiltered(w, model, msg, false)
+		}
+	} else {
+		gw.release()
+	}
+	h.releaseGuarded(outer, c, verdicts, blocked)
+}
+
+// guardMessage returns the message a blocked request or response is
+// answered with.
+func guardMessage(v *guardrail.Verdict, what string) string {
+	if v.Message != "" {
+		return v.Message
+	}
+	return what + " blocked by guardrail " + v.Guardrail
+}
+
+// writeGuardError writes a 400 in the client's format. Gemini clients are
+// served through the chat handler, whose errors are translated for them.
+func writeGuardError(w http.ResponseWriter, format, msg string) {
+	if format == guardAnthropic {
+		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", msg)
+		return
+	}
+	writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", msg)
+}
+
+// writeGuardStreamError ends a stream in format with an error event. A
+// JSON Lines stream gets the event's payload as its last line.
+func writeGuardStreamError(w http.ResponseWriter, format, msg string) {
+	var event string
+	var payload any
+	switch format {
+	case guardAnthropic:
+		event = "error"
+		payload = translate.AnthropicErrorResponse{
+			Type:  "error",
+			Error: translate.AnthropicError{Type: "invalid_request_error", Message: msg},
+		}
+	case guardResponses:
+		event = "error"
+		payload = map[string]any{"type": "error", "code": "invalid_request_error", "message": msg, "param": nil}
+	default:
+		payload = translate.OpenAIErrorResponse{
+			Error: translate.OpenAIError{Type: "invalid_request_error", Message: msg},
+		}
+	}
+	data, _ := json.Marshal(payload)
+	var b bytes.Buffer
+	switch {
+	case ndjsonStream(w):
+		b.Write(data)
+		b.WriteByte('\n')
+	case event != "":
+		// The leading blank line ends any event whose first lines were
+		// already written.
+		fmt.Fprintf(&b, "\nevent: %s\ndata: %s\n\n", event, data)
+	default:
+		fmt.Fprintf(&b, "\ndata: %s\n\n", data)
+	}
+	w.Write(b.Bytes())
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// releaseGuarded logs the entries held back for a request's guardrails with
+// its verdicts. A response replaced for a block verdict is recorded as an
+// error of the last entry. The entries are held for the request's payload
+// in turn if its bodies are being captured.
+func (h *Handler) releaseGuarded(r *http.Request, c *guardCheck, verdicts []guardrail.Verdict, blocked *guardrail.Verdict) {
+	held := c.finish()
+	for i, e := range held {
+		if len(verdicts) > 0 {
+			if e.RequestMetadata == nil {
+				e.RequestMetadata = map[string]interface{}{}
+			}
+			e.RequestMetadata["guardrails"] = verdicts
+		}
+		if blocked != nil && i == len(held)-1 {
+			e.ErrorMessage = "response blocked by guardrail " + blocked.Guardrail
+			e.ErrorCode = "guardrail_blocked"
+		}
+		if heldLog(r.Context(), e) {
+			continue
+		}
+		h.logger.Log(e)
+	}
+}
+
+// guardedText joins the string values of body under keys, in key order so
+// that patterns see the same text on every check.
+func guardedText(body []byte, keys map[string]bool) string {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return ""
+	}
+	var b strings.Builder
+	appendGuardedText(&b, v, "", keys)
+	return b.String()
+}
+
+func appendGuardedText(b *strings.Builder, v any, key string, keys map[string]bool) {
+	switch v := v.(type) {
+	case string:
+		if keys[key] {
+			b.WriteString(v)
+			b.WriteByte('\n')
+		}
+	case []any:
+		for _, e := range v {
+			appendGuardedText(b, e, key, keys)
+		}
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			appendGuardedText(b, v[k], k, keys)
+		}
+	}
+}
+
+// guardWriter collects a response for its guardrails. A complete response
+// is held back until release. A stream is written through a line at a
+// time, each line once check has passed the text of the stream's events up
+// to it.
+type guardWriter struct {
+	http.ResponseWriter
+	stream bool
+	format string
+	check  func(text string) *guardrail.Verdict // nil unless stream
+
+	status  int
+	body    bytes.Buffer    // the held response, or a stream's unterminated line
+	events  strings.Builder // text of a stream's events
+	checked int             // length of events already checked
+	blocked *guardrail.Verdict
+}
+
+func (gw *guardWriter) WriteHeader(status int) {
+	if gw.status != 0 {
+		return
+	}
+	gw.status = status
+	if gw.stream {
+		gw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (gw *guardWriter) Write(p []byte) (int, error) {
+	if gw.status == 0 {
+		gw.WriteHeader(http.StatusOK)
+	}
+	if !gw.stream {
+		return gw.body.Write(p)
+	}
+	if gw.blocked != nil {
+		return 0, errGuardBlocked
+	}
+	if gw.events.Len() >= maxGuardedStreamText {
+		if gw.body.Len() > 0 {
+			if _, err := gw.ResponseWriter.Write(gw.body.Bytes()); err != nil {
+				return 0, err
+			}
+			gw.body.Reset()
+		}
+		return gw.ResponseWriter.Write(p)
+	}
+	gw.body.Write(p)
+	lines, v := gw.scanLines()
+	if len(lines) > 0 {
+		if _, err := gw.ResponseWriter.Write(lines); err != nil {
+			return 0, err
+		}
+	}
+	if v != nil {
+		gw.blocked = v
+		gw.body.Reset()
+		writeGuardStreamError(gw.ResponseWriter, gw.format, guardMessage(v, "Response"))
+		return 0, errGuardBlocked
+	}
+	return len(p), nil
+}
+
+// scanLines takes the complete stream lines from gw.body and collects
+// their text. Lines are SSE data lines or, for JSON Lines streams, JSON
+// objects. It returns the lines that passed the stream's guardrails and
+// the verdict that stopped it at the next one, if any.
+func (gw *guardWriter) scanLines() ([]byte, *guardrail.Verdict) {
+	var passed []byte
+	for {
+		i := bytes.IndexByte(gw.body.Bytes(), '\n')
+		if i < 0 {
+			return passed, nil
+		}
+		raw := gw.body.Next(i + 1)
+		line := bytes.TrimSpace(raw)
+		line = bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+		if len(line) > 0 && line[0] == '{' && gw.events.Len() < maxGuardedStreamText {
+			if text := guardedText(line, responseTextKeys); text != "" {
+				gw.events.WriteString(text)
+				if v := gw.checkEvents(); v != nil {
+					return passed, v
+				}
+			}
+		}
+		passed = append(passed, raw...)
+	}
+}
+
+// checkEvents checks the text added to gw.events since the last check,
+// with guardStreamOverlap bytes of the text before it.
+func (gw *guardWriter) checkEvents() *guardrail.Verdict {
+	if gw.check == nil {
+		return nil
+	}
+	from := max(gw.checked-guardStreamOverlap, 0)
+	gw.checked = gw.events.Len()
+	return gw.check(gw.events.String()[from:])
+}
+
+// text returns the text of the response written so far.
+func (gw *guardWriter) text() string {
+	if gw.stream {
+		return gw.events.String()
+	}
+	return guardedText(gw.body.Bytes(), responseTextKeys)
+}
+
+// release writes a held response, or the unterminated last line of a
+// stream.
+func (gw *guardWriter) release() {
+	if gw.stream {
+		if gw.blocked == nil && gw.body.Len() > 0 {
+			gw.ResponseWriter.Write(gw.body.Bytes())
+		}
+		return
+	}
+	if gw.status == 0 {
+		return
+	}
+	gw.ResponseWriter.WriteHeader(gw.status)
+	gw.ResponseWriter.Write(gw.body.Bytes())
+}
+
+// Flush implements http.Flusher. A held response is flushed on release.
+func (gw *guardWriter) Flush() {
+	if !gw.stream {
+		return
+	}
+	if f, ok := gw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (gw *guardWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
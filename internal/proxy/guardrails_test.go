@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sertdev/pxbin/internal/guardrail"
+)
+
+func TestGuardWriterStream(t *testing.T) {
+	newWriter := func() (*guardWriter, *httptest.ResponseRecorder) {
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Content-Type", "text/event-stream")
+		gw := &guardWriter{ResponseWriter: rec, stream: true, format: guardChat}
+		gw.check = func(text string) *guardrail.Verdict {
+			if strings.Contains(text, "secret") {
+				return &guardrail.Verdict{Guardrail: "no-secrets", Mode: guardrail.ModeBlock, Message: "Blocked"}
+			}
+			return nil
+		}
+		return gw, rec
+	}
+
+	// Lines are forwarded once complete, and an unterminated last line on
+	// release.
+	gw, rec := newWriter()
+	gw.Write([]byte(`data: {"delta":"he`))
+	gw.Write([]byte(`llo"}`))
+	if rec.Body.Len() != 0 {
+		t.Fatalf("expected an incomplete line held back, got %q", rec.Body)
+	}
+	gw.Write([]byte("\n\n"))
+	gw.Write([]byte(`data: {"delta":"bye"}`))
+	if want := "data: {\"delta\":\"hello\"}\n\n"; rec.Body.String() != want {
+		t.Fatalf("got %q, want %q", rec.Body, want)
+	}
+	gw.release()
+	if want := "data: {\"delta\":\"hello\"}\n\ndata: {\"delta\":\"bye\"}"; rec.Body.String() != want {
+		t.Fatalf("got %q, want %q", rec.Body, want)
+	}
+
+	// The lines before a blocked one are written, then the error event.
+	gw, rec = newWriter()
+	_, err := gw.Write([]byte("data: {\"delta\":\"ok\"}\n\ndata: {\"delta\":\"a secret\"}\n\ndata: [DONE]\n\n"))
+	if !errors.Is(err, errGuardBlocked) || gw.blocked == nil || gw.blocked.Guardrail != "no-secrets" {
+		t.Fatalf("expected a block, got %v %+v", err, gw.blocked)
+	}
+	if _, err := gw.Write([]byte("data: {\"delta\":\"more\"}\n\n")); !errors.Is(err, errGuardBlocked) {
+		t.Fatalf("expected writes after a block to fail, got %v", err)
+	}
+	gw.release()
+	out := rec.Body.String()
+	if !strings.HasPrefix(out, "data: {\"delta\":\"ok\"}\n\n\ndata: {\"error\":{\"message\":\"Blocked\"") || strings.Contains(out, "a secret") || strings.Contains(out, "more") || strings.Contains(out, "[DONE]") {
+		t.Fatalf("unexpected output %q", out)
+	}
+
+	// Text checked earlier is checked again within the overlap.
+	gw, _ = newWriter()
+	gw.Write([]byte("data: {\"delta\":\"sec\"}\n\n"))
+	var seen string
+	check := gw.check
+	gw.check = func(text string) *guardrail.Verdict { seen = text; return check(text) }
+	gw.Write([]byte("data: {\"delta\":\"ret\"}\n\n"))
+	if seen != "sec\nret\n" {
+		t.Fatalf("expected the overlap to be checked again, got %q", seen)
+	}
+	gw.Write([]byte("data: {\"delta\":\"" + strings.Repeat("x", 2*guardStreamOverlap) + "\"}\n\n"))
+	gw.Write([]byte("data: {\"delta\":\"y\"}\n\n"))
+	if len(seen) != guardStreamOverlap+2 {
+		t.Fatalf("expected the check to cover the overlap and the new text, got %d bytes", len(seen))
+	}
+}
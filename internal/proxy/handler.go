@@ -6,14 +6,21 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	json "github.com/bytedance/sonic"
 
 	"github.com/sertdev/pxbin/internal/billing"
+	"github.com/sertdev/pxbin/internal/extension"
+	"github.com/sertdev/pxbin/internal/guardrail"
 	"github.com/sertdev/pxbin/internal/logging"
+	"github.com/sertdev/pxbin/internal/policy"
+	"github.com/sertdev/pxbin/internal/scoreboard"
 	"github.com/sertdev/pxbin/internal/store"
-	"github.com/sertdev/pxbin/internal/translate"
+	"github.com/sertdev/pxbin/internal/vertex"
+	"github.com/sertdev/pxbin/pkg/translate"
 )
 
 // Handler contains the shared dependencies for the Anthropic and OpenAI proxy
@@ -21,20 +28,42 @@ import (
 type Handler struct {
 	clients    *ClientCache
 	modelCache *ModelCache
-	store      *store.Store
+	store      store.Store
 	logger     *logging.AsyncLogger
 	billing    *billing.Tracker
+	policy     *policy.Engine     // optional; nil disables admission policies
+	extensions *extension.Runtime // optional; nil fails upstreams that name an extension
+	scores     *scoreboard.Board  // optional; nil keeps no upstream scores
+	pins       *Pins              // optional; nil ignores upstream pins
+	routers    *Routers           // optional; nil disables router models
+	vertex     *vertex.Cache      // endpoints and access tokens of Vertex AI upstreams
+
+	upstreamObserver UpstreamObserver // optional; nil records no per-upstream metrics
+
+	defaultMaxTokens int         // injected into native Anthropic requests without max_tokens; 0 disables
+	maxSSEFrame      int         // longest upstream SSE line; 0 uses translate.DefaultMaxSSEFrameSize
+	images           ImageLimits // checks on base64 images in request bodies; zero disables
+	payloads         PayloadCaptureOpts
+	audit            *AuditSampler         // nil when requests are not sampled for audits
+	metadataMap      translate.MetadataMap // request metadata carried across formats
+	logMetadataKeys  []string              // request metadata keys copied into request logs
+	guardrails       *guardrail.Engine     // nil checks no guardrails
+
+	sseRetry           time.Duration // retry: sent at the start of client streams; 0 disables
+	sseCommentInterval time.Duration // idle time before a comment frame; 0 disables
+	streamIdleTimeout  time.Duration // silence before an upstream stream is ended; 0 disables
 }
 
 // NewHandler creates a Handler wired up to a client cache, model cache, store,
 // logger and billing tracker.
-func NewHandler(clients *ClientCache, modelCache *ModelCache, s *store.Store, logger *logging.AsyncLogger, billing *billing.Tracker) *Handler {
+func NewHandler(clients *ClientCache, modelCache *ModelCache, s store.Store, logger *logging.AsyncLogger, billing *billing.Tracker) *Handler {
 	return &Handler{
 		clients:    clients,
 		modelCache: modelCache,
 		store:      s,
 		logger:     logger,
 		billing:    billing,
+		vertex:     vertex.NewCache(),
 	}
 }
 
@@ -68,164 +97,167 @@ func readBody(r *http.Request) ([]byte, error) {
 	return data, nil
 }
 
-var errModelNotFound = errors.New("missing model field")
-
-const modelProbeLimitBytes = 8 * 1024
-
-var modelJSONField = []byte(`"model"`)
-
-// readModelAndBuildBodyReader reads just enough of a JSON body to extract the
-// "model" field, then returns a reader that replays consumed bytes plus the
-// remaining unread stream. This lets handlers dispatch upstream without first
-// buffering the entire request body.
-func readModelAndBuildBodyReader(body io.Reader, probeLimit int) (string, io.Reader, error) {
-	if probeLimit <= 0 {
-		probeLimit = modelProbeLimitBytes
-	}
-
-	prefix := make([]byte, 0, minInt(1024, probeLimit))
-	chunk := make([]byte, 1024)
-
-	for len(prefix) < probeLimit {
-		toRead := minInt(len(chunk), probeLimit-len(prefix))
-		n, err := body.Read(chunk[:toRead])
-		if n > 0 {
-			prefix = append(prefix, chunk[:n]...)
-			if model, ok := extractJSONStringFieldValue(prefix, modelJSONField); ok {
-				return model, io.MultiReader(bytes.NewReader(prefix), body), nil
-			}
-		}
-		if err == io.EOF {
-			model, modelErr := extractModelWithJSONGet(prefix)
-			if modelErr != nil {
-				return "", nil, modelErr
-			}
-			return model, bytes.NewReader(prefix), nil
-		}
-		if err != nil {
-			return "", nil, err
-		}
-	}
+var (
+	errModelNotFound  = errors.New("missing model field")
+	errDuplicateModel = errors.New("duplicate model field")
+)
 
-	rest, err := io.ReadAll(body)
-	if err != nil {
-		return "", nil, err
-	}
-	full := append(prefix, rest...)
-	model, err := extractModelWithJSONGet(full)
-	if err != nil {
-		return "", nil, err
-	}
-	return model, bytes.NewReader(full), nil
-}
+// duplicateModelMessage is the 400 message for a request that names its
+// model more than once.
+const duplicateModelMessage = "Invalid request body: model is given more than once"
 
-func extractModelWithJSONGet(body []byte) (string, error) {
-	modelNode, err := json.Get(body, "model")
-	if err != nil {
+// extractModel returns the top-level "model" string of a JSON request
+// without a full parse. It walks the document structurally, skipping nested
+// values, so a "model" key inside message content or tool arguments is
+// never mistaken for the top-level one.
+//
+// A body with more than one top-level model key is rejected with
+// errDuplicateModel. Passthrough forwards bodies unchanged and upstream
+// parsers keep the last duplicate, so checking and billing the first would
+// let a key be served a model it may not use. Keys differing only in case
+// count as duplicates, since Go's encoding/json matches them too. Any other
+// problem, including a missing, non-string or invalid UTF-8 model, is
+// errModelNotFound.
+func extractModel(body []byte) (string, error) {
+	i := skipJSONWhitespace(body, 0)
+	if i >= len(body) || body[i] != '{' {
 		return "", errModelNotFound
 	}
-	model, err := modelNode.String()
-	if err != nil || model == "" {
+	i = skipJSONWhitespace(body, i+1)
+	if i < len(body) && body[i] == '}' {
 		return "", errModelNotFound
 	}
-	return model, nil
-}
 
-// extractJSONStringFieldValue scans a JSON payload prefix for a string field
-// and returns its value without needing a full parse.
-func extractJSONStringFieldValue(body []byte, field []byte) (string, bool) {
-	pos := 0
+	var model string
+	found, seen := false, 0
 	for {
-		rel := bytes.Index(body[pos:], field)
-		if rel < 0 {
-			return "", false
+		if i >= len(body) || body[i] != '"' {
+			return "", errModelNotFound
 		}
-		keyStart := pos + rel
-
-		if !likelyJSONKeyBoundary(body, keyStart) {
-			pos = keyStart + 1
-			continue
+		keyStart := i
+		i = skipJSONString(body, i)
+		if i < 0 {
+			return "", errModelNotFound
 		}
+		key := body[keyStart:i]
 
-		i := keyStart + len(field)
-		for i < len(body) && isJSONWhitespace(body[i]) {
-			i++
+		i = skipJSONWhitespace(body, i)
+		if i >= len(body) || body[i] != ':' {
+			return "", errModelNotFound
 		}
+		i = skipJSONWhitespace(body, i+1)
 		if i >= len(body) {
-			return "", false
+			return "", errModelNotFound
 		}
-		if body[i] != ':' {
-			pos = keyStart + 1
-			continue
+
+		valueStart := i
+		i = skipJSONValue(body, i)
+		if i < 0 {
+			return "", errModelNotFound
 		}
-		i++
-		for i < len(body) && isJSONWhitespace(body[i]) {
-			i++
+		if name, ok := decodeJSONString(key); ok && strings.EqualFold(name, "model") {
+			if seen++; seen > 1 {
+				return "", errDuplicateModel
+			}
+			if name == "model" && body[valueStart] == '"' {
+				model, found = decodeJSONString(body[valueStart:i])
+			}
 		}
+
+		i = skipJSONWhitespace(body, i)
 		if i >= len(body) {
-			return "", false
+			return "", errModelNotFound
 		}
-		if body[i] != '"' {
-			pos = keyStart + 1
-			continue
+		if body[i] == '}' {
+			break
 		}
+		if body[i] != ',' {
+			return "", errModelNotFound
+		}
+		i = skipJSONWhitespace(body, i+1)
+	}
+	if !found || !utf8.ValidString(model) || skipJSONWhitespace(body, i+1) != len(body) {
+		return "", errModelNotFound
+	}
+	return model, nil
+}
 
-		i++
-		valueStart := i
-		sawEscape := false
+// skipJSONString returns the offset just past the string starting at
+// body[i], or -1 if it is unterminated.
+func skipJSONString(body []byte, i int) int {
+	for i++; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// skipJSONValue returns the offset just past the value starting at body[i],
+// or -1 if it runs past the end of body. Nested objects and arrays are only
+// bracket-matched, not validated.
+func skipJSONValue(body []byte, i int) int {
+	switch body[i] {
+	case '"':
+		return skipJSONString(body, i)
+	case '{', '[':
+		depth := 0
 		for i < len(body) {
 			switch body[i] {
-			case '\\':
-				sawEscape = true
-				i++
-				if i >= len(body) {
-					return "", false
-				}
 			case '"':
-				if !sawEscape {
-					return string(body[valueStart:i]), true
+				i = skipJSONString(body, i)
+				if i < 0 {
+					return -1
 				}
-				raw := make([]byte, i-valueStart+2)
-				raw[0] = '"'
-				copy(raw[1:], body[valueStart:i])
-				raw[len(raw)-1] = '"'
-				decoded, err := strconv.Unquote(string(raw))
-				if err != nil {
-					return "", false
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return i + 1
 				}
-				return decoded, true
 			}
 			i++
 		}
-		return "", false
+		return -1
+	default:
+		// Number or literal: it ends at the next delimiter, which must be
+		// in the prefix for the token to be complete.
+		for ; i < len(body); i++ {
+			if b := body[i]; b == ',' || b == '}' || b == ']' || isJSONWhitespace(b) {
+				return i
+			}
+		}
+		return -1
 	}
 }
 
-func likelyJSONKeyBoundary(body []byte, keyStart int) bool {
-	if keyStart == 0 {
-		return true
+func decodeJSONString(raw []byte) (string, bool) {
+	if bytes.IndexByte(raw, '\\') < 0 {
+		return string(raw[1 : len(raw)-1]), true
 	}
-	i := keyStart - 1
-	for i >= 0 && isJSONWhitespace(body[i]) {
-		i--
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", false
 	}
-	if i < 0 {
-		return true
+	return s, true
+}
+
+func skipJSONWhitespace(body []byte, i int) int {
+	for i < len(body) && isJSONWhitespace(body[i]) {
+		i++
 	}
-	return body[i] == '{' || body[i] == ','
+	return i
 }
 
 func isJSONWhitespace(b byte) bool {
 	return b == ' ' || b == '\n' || b == '\r' || b == '\t'
 }
 
-func minInt(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 func writeAnthropicError(w http.ResponseWriter, statusCode int, errType, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -1,56 +1,355 @@
 package proxy
 
 import (
-	"io"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/store"
 )
 
-func TestReadModelAndBuildBodyReaderProbeHit(t *testing.T) {
-	payload := `{"model":"gpt-5.3-codex","input":"hello","stream":false}`
+func TestExtractModel(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+		err  error
+	}{
+		{"top level", `{"model":"gpt-4o","messages":[]}`, "gpt-4o", nil},
+		{"whitespace", "{ \n\t\"model\" :\r \"gpt-4o\" }\n", "gpt-4o", nil},
+		{"after nested message text", `{"messages":[{"role":"user","content":"{\"model\":\"evil\"}"}],"model":"gpt-4o"}`, "gpt-4o", nil},
+		{"after nested object key", `{"messages":[{"role":"user","model":"evil"}],"model":"gpt-4o"}`, "gpt-4o", nil},
+		{"after tool arguments", `{"tools":[{"input_schema":{"properties":{"model":{"type":"string"}}}}],"model":"claude"}`, "claude", nil},
+		{"after scalars", `{"stream":true,"max_tokens":1024,"stop":null,"model":"gpt-4o"}`, "gpt-4o", nil},
+		{"escaped value", `{"model":"a\/b\u0041"}`, "a/bA", nil},
+		{"escaped key", `{"mod\u0065l":"gpt-4o"}`, "gpt-4o", nil},
+		{"duplicate", `{"model":"cheap","model":"expensive"}`, "", errDuplicateModel},
+		{"duplicate escaped", `{"model":"cheap","messages":[],"mod\u0065l":"expensive"}`, "", errDuplicateModel},
+		{"duplicate other case", `{"model":"cheap","Model":"expensive"}`, "", errDuplicateModel},
+		{"duplicate non-string", `{"model":"cheap","model":1}`, "", errDuplicateModel},
+		{"other case only", `{"MODEL":"gpt-4o"}`, "", errModelNotFound},
+		{"key inside value string", `{"input":"\"model\":\"evil\""}`, "", errModelNotFound},
+		{"nested only", `{"metadata":{"model":"evil"}}`, "", errModelNotFound},
+		{"non-string value", `{"model":42}`, "", errModelNotFound},
+		{"invalid UTF-8", "{\"model\":\"\x81\"}", "", errModelNotFound},
+		{"truncated", `{"model":"gpt-4o","messages":[`, "", errModelNotFound},
+		{"trailing data", `{"model":"gpt-4o"}{"model":"evil"}`, "", errModelNotFound},
+		{"empty object", `{}`, "", errModelNotFound},
+		{"not an object", `["model","gpt-4o"]`, "", errModelNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractModel([]byte(tt.body))
+			if err != tt.err || got != tt.want {
+				t.Fatalf("got (%q, %v), want (%q, %v)", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
 
-	model, bodyReader, err := readModelAndBuildBodyReader(strings.NewReader(payload), modelProbeLimitBytes)
-	if err != nil {
-		t.Fatalf("expected nil error, got %v", err)
+func FuzzExtractModel(f *testing.F) {
+	f.Add(`{"model":"gpt-4o","messages":[]}`)
+	f.Add(`{"messages":[{"role":"user","content":"{\"model\":\"evil\"}"}],"model":"gpt-4o"}`)
+	f.Add(`{"tools":[{"function":{"parameters":{"model":"x"}}}],"model":"claude"}`)
+	f.Add(`{"input":"\"model\":\"evil\"","model":"a\u0041"}`)
+	f.Add(`{"stream":true,"max_tokens":1,"model":"m"}`)
+	f.Add(`{"model":"cheap","model":"expensive"}`)
+	f.Add(`{"model":"cheap","MODEL":"expensive"}`)
+
+	f.Fuzz(func(t *testing.T, body string) {
+		got, err := extractModel([]byte(body))
+		if err != nil {
+			return
+		}
+		// Whenever the scanner answers, a full parse of the same bytes
+		// must agree. encoding/json keeps the last of duplicate keys and
+		// matches them case-insensitively, so this also catches a scanner
+		// that settles on a key a later one overrides.
+		var req struct {
+			Model *string `json:"model"`
+		}
+		if json.Unmarshal([]byte(body), &req) != nil {
+			return
+		}
+		if req.Model == nil || *req.Model != got {
+			t.Fatalf("scanner found %q, full parse found %v", got, req.Model)
+		}
+	})
+}
+
+func TestResolveErrorStatusUnavailable(t *testing.T) {
+	// Nightly batch window 22:00-06:00 UTC on weekdays.
+	sched := store.Schedule{{Days: []int{1, 2, 3, 4, 5}, Start: "22:00", End: "06:00"}}
+	if !sched.Allows(time.Date(2026, 1, 6, 3, 0, 0, 0, time.UTC)) { // Tue 03:00, Monday's window
+		t.Fatal("expected overnight window to cover Tuesday 03:00")
 	}
-	if model != "gpt-5.3-codex" {
-		t.Fatalf("expected model gpt-5.3-codex, got %q", model)
+	if sched.Allows(time.Date(2026, 1, 4, 3, 0, 0, 0, time.UTC)) { // Sun 03:00, Saturday has no window
+		t.Fatal("expected Sunday 03:00 to be outside the window")
 	}
 
-	rebuilt, err := io.ReadAll(bodyReader)
-	if err != nil {
-		t.Fatalf("expected body replay read success, got %v", err)
+	status, msg := resolveErrorStatus(&unavailableError{kind: "model", name: "opus", schedule: sched})
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", status)
 	}
-	if string(rebuilt) != payload {
-		t.Fatalf("expected rebuilt body to equal original payload")
+	if want := `model "opus" is only available Mon,Tue,Wed,Thu,Fri 22:00-06:00 UTC`; msg != want {
+		t.Fatalf("expected %q, got %q", want, msg)
+	}
+
+	if status, _ := resolveErrorStatus(errors.New("db down")); status != http.StatusInternalServerError {
+		t.Fatalf("expected 500 for other errors, got %d", status)
 	}
 }
 
-func TestReadModelAndBuildBodyReaderFallback(t *testing.T) {
-	payload := `{"input":"` + strings.Repeat("a", 256) + `","model":"gpt-5.3-codex","stream":false}`
+func TestResolveErrorStatusRegion(t *testing.T) {
+	status, msg := resolveErrorStatus(&regionError{model: "claude", allowed: []string{"eu", "eu-west"}})
+	if status != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", status)
+	}
+	if want := `model "claude" is served from no region, but this key is restricted to regions: eu, eu-west`; msg != want {
+		t.Fatalf("expected %q, got %q", want, msg)
+	}
+}
 
-	model, bodyReader, err := readModelAndBuildBodyReader(strings.NewReader(payload), 32)
-	if err != nil {
-		t.Fatalf("expected nil error, got %v", err)
+func TestCheckAnthropicLimits(t *testing.T) {
+	up := &upstreamInfo{contextWindow: 100, maxOutputTokens: 64}
+
+	if msg := checkAnthropicLimits(up, "m", []byte(`{"model":"m","max_tokens":64,"messages":[]}`)); msg != "" {
+		t.Fatalf("expected request within limits, got %q", msg)
 	}
-	if model != "gpt-5.3-codex" {
-		t.Fatalf("expected model gpt-5.3-codex, got %q", model)
+	if msg := checkAnthropicLimits(up, "m", []byte(`{"model":"m","max_tokens":65,"messages":[]}`)); !strings.HasPrefix(msg, "max_tokens: 65 > 64") {
+		t.Fatalf("expected max_tokens rejection, got %q", msg)
+	}
+
+	long := `{"model":"m","max_tokens":1,"messages":[{"role":"user","content":"` + strings.Repeat("a", 800) + `"}]}`
+	if msg := checkAnthropicLimits(up, "m", []byte(long)); !strings.HasPrefix(msg, "prompt is too long") {
+		t.Fatalf("expected context window rejection, got %q", msg)
 	}
 
-	rebuilt, err := io.ReadAll(bodyReader)
+	// A large image counts as a flat estimate, not by its base64 size.
+	image := `{"model":"m","max_tokens":1,"messages":[{"role":"user","content":[{"type":"image","source":{"type":"base64","media_type":"image/png","data":"` + strings.Repeat("A", 800) + `"}}]}]}`
+	if msg := checkAnthropicLimits(&upstreamInfo{contextWindow: 2000}, "m", []byte(image)); msg != "" {
+		t.Fatalf("expected image request within limits, got %q", msg)
+	}
+}
+
+func TestCheckOpenAIBodyLimits(t *testing.T) {
+	up := &upstreamInfo{contextWindow: 100, maxOutputTokens: 64}
+
+	for body, want := range map[string]string{
+		`{"model":"m","max_tokens":64,"messages":[]}`:                              "",
+		`{"model":"m","messages":[]}`:                                              "",
+		`{"model":"m","max_tokens":65,"messages":[]}`:                              "max_tokens: 65 > 64",
+		`{"model":"m","max_completion_tokens":65,"messages":[]}`:                   "max_tokens: 65 > 64",
+		`{"model":"m","max_completion_tokens":64,"max_tokens":1000,"messages":[]}`: "",
+	} {
+		if msg := checkOpenAIBodyLimits(up, "m", []byte(body)); !strings.HasPrefix(msg, want) || (want == "") != (msg == "") {
+			t.Errorf("%s: got %q, want prefix %q", body, msg, want)
+		}
+	}
+
+	long := `{"model":"m","max_tokens":1,"messages":[{"role":"user","content":"` + strings.Repeat("a", 800) + `"}]}`
+	if msg := checkOpenAIBodyLimits(up, "m", []byte(long)); !strings.HasPrefix(msg, "prompt is too long") {
+		t.Fatalf("expected context window rejection, got %q", msg)
+	}
+	if msg := checkOpenAIBodyLimits(&upstreamInfo{}, "m", []byte(long)); msg != "" {
+		t.Fatalf("expected no check without limits, got %q", msg)
+	}
+}
+
+func TestApplyDefaultMaxTokens(t *testing.T) {
+	h := &Handler{defaultMaxTokens: 4096}
+	tests := []struct {
+		name string
+		up   *upstreamInfo
+		body string
+		want string
+	}{
+		{"present", &upstreamInfo{}, `{"model":"m","max_tokens":10}`, `{"model":"m","max_tokens":10}`},
+		{"global default", &upstreamInfo{}, `{"model":"m"}`, `{"max_tokens":4096,"model":"m"}`},
+		{"null", &upstreamInfo{}, `{"model":"m","max_tokens":null}`, `{"max_tokens":4096,"model":"m"}`},
+		{"model default", &upstreamInfo{defaultMaxTokens: 512}, `{"model":"m"}`, `{"max_tokens":512,"model":"m"}`},
+		{"capped at output limit", &upstreamInfo{maxOutputTokens: 1024}, `{"model":"m"}`, `{"max_tokens":1024,"model":"m"}`},
+	}
+	for _, tt := range tests {
+		got, err := h.applyDefaultMaxTokens([]byte(tt.body), tt.up)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !sameJSON(t, got, []byte(tt.want)) {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	disabled := &Handler{}
+	if got, _ := disabled.applyDefaultMaxTokens([]byte(`{"model":"m"}`), &upstreamInfo{}); string(got) != `{"model":"m"}` {
+		t.Errorf("expected no injection when disabled, got %s", got)
+	}
+}
+
+// sameJSON compares JSON documents regardless of object key order.
+func sameJSON(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var va, vb any
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatalf("invalid JSON %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func TestAnthropicUpstreamPath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"/v1/messages", "/v1/messages"},
+		{"/v1/messages?beta=true", "/v1/messages?beta=true"},
+		{"/v1/messages?beta=true&key=secret&debug=1", "/v1/messages?beta=true"},
+		{"/v1/messages/count_tokens?beta=true", "/v1/messages/count_tokens?beta=true"},
+		{"/v1/messages/../../admin", "/v1/messages"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := anthropicUpstreamPath(u); got != tt.want {
+			t.Errorf("anthropicUpstreamPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMapMessageRoles(t *testing.T) {
+	body := []byte(`{"model":"o1","messages":[{"role":"developer","content":"be terse"},{"role":"user","content":"hi"}]}`)
+
+	got, err := mapMessageRoles(body, store.RoleMap{"developer": "system", "system": "user"})
 	if err != nil {
-		t.Fatalf("expected body replay read success, got %v", err)
+		t.Fatal(err)
+	}
+	var req struct {
+		Messages []struct {
+			Role string `json:"role"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(got, &req); err != nil {
+		t.Fatal(err)
+	}
+	// Each message is mapped once: developer becomes system, not user.
+	if len(req.Messages) != 2 || req.Messages[0].Role != "system" || req.Messages[1].Role != "user" {
+		t.Fatalf("unexpected roles in %s", got)
+	}
+
+	// Bodies without a mapped role pass through byte for byte.
+	if got, _ := mapMessageRoles(body, store.RoleMap{"system": "user"}); string(got) != string(body) {
+		t.Fatalf("expected unchanged body, got %s", got)
+	}
+}
+
+func TestRequestPriority(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+		ok     bool
+	}{
+		{"", "normal", true},
+		{"low", "low", true},
+		{" Low ", "low", true},
+		// Requests without a key allowing more are capped at normal.
+		{"high", "normal", true},
+		{"urgent", "", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		if tt.header != "" {
+			r.Header.Set(priorityHeader, tt.header)
+		}
+		got, ok := requestPriority(r)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("requestPriority(%q) = %q, %v; want %q, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
 	}
-	if string(rebuilt) != payload {
-		t.Fatalf("expected rebuilt body to equal original payload")
+
+	upstream := &upstreamInfo{serviceTiers: store.ServiceTiers{"low": "flex"}}
+	r := withPriority(httptest.NewRequest(http.MethodPost, "/v1/messages", nil), "low")
+	if got := serviceTier(r, upstream); got != "flex" {
+		t.Fatalf("serviceTier = %q, want flex", got)
+	}
+	body, err := setServiceTier([]byte(`{"model":"m","service_tier":"auto"}`), "flex")
+	if err != nil || !sameJSON(t, body, []byte(`{"model":"m","service_tier":"flex"}`)) {
+		t.Fatalf("setServiceTier = %s, %v", body, err)
 	}
 }
 
-func TestReadModelAndBuildBodyReaderMissingModel(t *testing.T) {
-	payload := `{"input":"hello"}`
+func TestUpstreamProbe(t *testing.T) {
+	var gotAuth, gotKey string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth, gotKey = r.Header.Get("Authorization"), r.Header.Get("X-Api-Key")
+		if r.URL.Path != "/v1/models" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
 
-	_, _, err := readModelAndBuildBodyReader(strings.NewReader(payload), modelProbeLimitBytes)
-	if err == nil {
-		t.Fatalf("expected error for missing model field")
+	if err := NewUpstreamClient(srv.URL, "sk-test", nil).probe(ctx, "openai"); err != nil || gotAuth != "Bearer sk-test" {
+		t.Fatalf("openai probe: err=%v auth=%q", err, gotAuth)
+	}
+	if err := NewUpstreamClient(srv.URL, "sk-ant", nil).probe(ctx, "anthropic"); err != nil || gotKey != "sk-ant" {
+		t.Fatalf("anthropic probe: err=%v key=%q", err, gotKey)
+	}
+	if err := NewUpstreamClient(srv.URL+"/missing", "sk-test", nil).probe(ctx, "openai"); err == nil {
+		t.Fatal("expected an error for a non-200 response")
+	}
+}
+
+func TestPassthroughAnthropicStreamFrameTooLarge(t *testing.T) {
+	stream := "event: message_start\n" +
+		`data: {"type":"message_start","message":{"usage":{"input_tokens":7}}}` + "\n\n" +
+		"event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","delta":{"data":"` + strings.Repeat("A", 128*1024) + `"}}` + "\n\n"
+
+	rec := httptest.NewRecorder()
+	usage := passthroughAnthropicStream(slog.Default(), strings.NewReader(stream), rec, rec, 64*1024)
+	if usage.InputTokens != 7 {
+		t.Fatalf("expected usage from events before the oversized one, got %+v", usage)
+	}
+
+	out := rec.Body.String()
+	if !strings.Contains(out, "message_start") {
+		t.Fatalf("expected earlier events to be forwarded, got %q", out)
+	}
+	if !strings.HasSuffix(out, "\n\n") || !strings.Contains(out, "\n\nevent: error\ndata: ") {
+		t.Fatalf("expected stream to end with a separate error event, got %q", out)
+	}
+	if !strings.Contains(out, `"api_error"`) || !strings.Contains(out, "65536-byte") {
+		t.Fatalf("unexpected error event: %q", out)
+	}
+}
+
+func TestPassthroughAnthropicStreamWebSearches(t *testing.T) {
+	stream := "event: message_start\n" +
+		`data: {"type":"message_start","message":{"usage":{"input_tokens":7,"output_tokens":1,"server_tool_use":{"web_search_requests":0}}}}` + "\n\n" +
+		"event: message_delta\n" +
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":42,"server_tool_use":{"web_search_requests":3}}}` + "\n\n"
+
+	rec := httptest.NewRecorder()
+	usage := passthroughAnthropicStream(slog.Default(), strings.NewReader(stream), rec, rec, 0)
+	if usage.InputTokens != 7 || usage.OutputTokens != 42 || usage.WebSearchRequests != 3 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+	if rec.Body.String() != stream {
+		t.Fatalf("stream not forwarded as-is: %q", rec.Body.String())
 	}
 }
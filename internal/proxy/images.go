@@ -0,0 +1,263 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // register decoders for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+	"strings"
+
+	json "github.com/bytedance/sonic"
+)
+
+// ImageLimits bounds the base64 images a request may carry, in both
+// Anthropic image blocks and OpenAI data URLs. Zero fields disable their
+// check. Images linked by URL are never fetched and pass unchecked.
+type ImageLimits struct {
+	MaxBytes     int  // decoded size of one image
+	MaxDimension int  // longest side, in pixels
+	Downscale    bool // shrink and re-encode oversized images as JPEG instead of rejecting the request
+	JPEGQuality  int  // quality of re-encoded images; 0 uses 85
+}
+
+func (l ImageLimits) enabled() bool {
+	return l.MaxBytes > 0 || l.MaxDimension > 0
+}
+
+// maxDecodePixels caps the size of images decoded for downscaling, so a
+// small file claiming huge dimensions cannot exhaust memory.
+const maxDecodePixels = 50_000_000
+
+// SetImageLimits sets the limits applied to images in request bodies.
+func (h *Handler) SetImageLimits(l ImageLimits) {
+	h.images = l
+}
+
+// imageResize records an image the proxy downscaled, for the request log.
+type imageResize struct {
+	Index          int `json:"index"`
+	OriginalBytes  int `json:"original_bytes"`
+	OriginalWidth  int `json:"original_width"`
+	OriginalHeight int `json:"original_height"`
+	SentBytes      int `json:"sent_bytes"`
+	SentWidth      int `json:"sent_width"`
+	SentHeight     int `json:"sent_height"`
+}
+
+// applyImageLimits enforces h's image limits on a raw request body and
+// records any downscaled images in the request's log tags. Bodies without
+// base64 data, or whose images are all within limits, are returned
+// unchanged. Returns a client-facing message if the request must be
+// rejected.
+func (h *Handler) applyImageLimits(r *http.Request, body []byte) (*http.Request, []byte, string) {
+	if !h.images.enabled() || !bytes.Contains(body, []byte("base64")) {
+		return r, body, ""
+	}
+	var req any
+	if err := json.Unmarshal(body, &req); err != nil {
+		return r, nil, "Invalid JSON in request body"
+	}
+	g := imageGuard{limits: h.images}
+	if msg := g.walk(req); msg != "" {
+		return r, nil, msg
+	}
+	if len(g.resized) == 0 {
+		return r, body, ""
+	}
+	out, err := json.Marshal(req)
+	if err != nil {
+		return r, nil, "Invalid JSON in request body"
+	}
+	t := requestLogTags(r)
+	t.images = g.resized
+	return withLogTags(r, t), out, ""
+}
+
+// imageGuard walks a decoded request body, checking every base64 image it
+// finds in request order.
+type imageGuard struct {
+	limits  ImageLimits
+	seen    int
+	resized []imageResize
+}
+
+func (g *imageGuard) walk(v any) string {
+	switch v := v.(type) {
+	case []any:
+		for _, item := range v {
+			if msg := g.walk(item); msg != "" {
+				return msg
+			}
+		}
+	case map[string]any:
+		if msg := g.visit(v); msg != "" {
+			return msg
+		}
+		for _, item := range v {
+			if msg := g.walk(item); msg != "" {
+				return msg
+			}
+		}
+	}
+	return ""
+}
+
+// visit checks m if it is an image content part: an Anthropic image block
+// with a base64 source, a Chat Completions image_url part or a Responses
+// input_image part holding a data URL.
+func (g *imageGuard) visit(m map[string]any) string {
+	switch m["type"] {
+	case "image":
+		src, _ := m["source"].(map[string]any)
+		if src == nil || src["type"] != "base64" {
+			return ""
+		}
+		data, _ := src["data"].(string)
+		out, changed, msg := g.check(data)
+		if changed {
+			src["data"], src["media_type"] = out, "image/jpeg"
+		}
+		return msg
+	case "image_url":
+		if u, ok := m["image_url"].(map[string]any); ok {
+			return g.checkDataURL(u, "url")
+		}
+		return g.checkDataURL(m, "image_url")
+	case "input_image":
+		return g.checkDataURL(m, "image_url")
+	}
+	return ""
+}
+
+// checkDataURL checks the image in m[key] if it is a base64 data URL.
+func (g *imageGuard) checkDataURL(m map[string]any, key string) string {
+	u, _ := m[key].(string)
+	rest, ok := strings.CutPrefix(u, "data:")
+	if !ok {
+		return ""
+	}
+	_, data, ok := strings.Cut(rest, ";base64,")
+	if !ok {
+		return ""
+	}
+	out, changed, msg := g.check(data)
+	if changed {
+		m[key] = "data:image/jpeg;base64," + out
+	}
+	return msg
+}
+
+// check enforces the limits on one base64 image, returning the re-encoded
+// image when it was downscaled, or a message rejecting it. Data that does
+// not decode is left for the upstream to reject.
+func (g *imageGuard) check(data string) (string, bool, string) {
+	g.seen++
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", false, ""
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	decodable := err == nil
+
+	l := g.limits
+	var problem string
+	switch {
+	case l.MaxBytes > 0 && len(raw) > l.MaxBytes:
+		problem = fmt.Sprintf("image %d is %d bytes, over the %d byte limit", g.seen, len(raw), l.MaxBytes)
+	case decodable && l.MaxDimension > 0 && max(cfg.Width, cfg.Height) > l.MaxDimension:
+		problem = fmt.Sprintf("image %d is %dx%d pixels, over the %d pixel limit", g.seen, cfg.Width, cfg.Height, l.MaxDimension)
+	default:
+		return "", false, ""
+	}
+	if !l.Downscale {
+		return "", false, problem
+	}
+	if !decodable || cfg.Width*cfg.Height > maxDecodePixels {
+		return "", false, problem + " and cannot be downscaled"
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return "", false, problem + " and cannot be downscaled"
+	}
+	out, w, h := downscaleImage(img, l)
+	if l.MaxBytes > 0 && len(out) > l.MaxBytes {
+		return "", false, problem + " and cannot be downscaled below it"
+	}
+	g.resized = append(g.resized, imageResize{
+		Index:          g.seen,
+		OriginalBytes:  len(raw),
+		OriginalWidth:  cfg.Width,
+		OriginalHeight: cfg.Height,
+		SentBytes:      len(out),
+		SentWidth:      w,
+		SentHeight:     h,
+	})
+	return base64.StdEncoding.EncodeToString(out), true, ""
+}
+
+// downscaleImage re-encodes img as a JPEG no larger than l.MaxDimension on
+// its longest side, shrinking it further until it fits l.MaxBytes or gets
+// too small to be useful. Transparent areas become white.
+func downscaleImage(img image.Image, l ImageLimits) ([]byte, int, int) {
+	b := img.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, b.Min, draw.Over)
+
+	w, h := b.Dx(), b.Dy()
+	if l.MaxDimension > 0 && max(w, h) > l.MaxDimension {
+		if w >= h {
+			w, h = l.MaxDimension, max(1, h*l.MaxDimension/w)
+		} else {
+			w, h = max(1, w*l.MaxDimension/h), l.MaxDimension
+		}
+	}
+	quality := l.JPEGQuality
+	if quality == 0 {
+		quality = 85
+	}
+
+	for {
+		var buf bytes.Buffer
+		jpeg.Encode(&buf, resizeBox(flat, w, h), &jpeg.Options{Quality: quality})
+		if l.MaxBytes == 0 || buf.Len() <= l.MaxBytes || max(w, h) <= 64 {
+			return buf.Bytes(), w, h
+		}
+		w, h = max(1, w*4/5), max(1, h*4/5)
+	}
+}
+
+// resizeBox scales src to w x h by averaging the source pixels covering
+// each destination pixel. It only shrinks.
+func resizeBox(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if w >= sw && h >= sh {
+		return src
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for dy := 0; dy < h; dy++ {
+		y0, y1 := dy*sh/h, max((dy+1)*sh/h, dy*sh/h+1)
+		for dx := 0; dx < w; dx++ {
+			x0, x1 := dx*sw/w, max((dx+1)*sw/w, dx*sw/w+1)
+			var r, g, b, n int
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++ {
+					r += int(row[4*x])
+					g += int(row[4*x+1])
+					b += int(row[4*x+2])
+					n++
+				}
+			}
+			i := dy*dst.Stride + 4*dx
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), 0xff
+		}
+	}
+	return dst
+}
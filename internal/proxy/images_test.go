@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	json "github.com/bytedance/sonic"
+)
+
+func testPNG(t *testing.T, w, h int) string {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x), uint8(y), uint8(x ^ y), 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func decodedSize(t *testing.T, data string) (int, int) {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil || format != "jpeg" {
+		t.Fatalf("expected a JPEG, got %q (%v)", format, err)
+	}
+	return cfg.Width, cfg.Height
+}
+
+func TestApplyImageLimitsDownscalesAnthropic(t *testing.T) {
+	h := &Handler{images: ImageLimits{MaxDimension: 100, Downscale: true}}
+	body := []byte(`{"model":"m","messages":[{"role":"user","content":[{"type":"text","text":"what is this"},` +
+		`{"type":"image","source":{"type":"base64","media_type":"image/png","data":"` + testPNG(t, 400, 200) + `"}}]}]}`)
+
+	r, out, msg := h.applyImageLimits(httptest.NewRequest("POST", "/v1/messages", nil), body)
+	if msg != "" {
+		t.Fatalf("unexpected rejection: %s", msg)
+	}
+	var req struct {
+		Messages []struct {
+			Content []struct {
+				Source *struct {
+					MediaType string `json:"media_type"`
+					Data      string `json:"data"`
+				} `json:"source"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(out, &req); err != nil {
+		t.Fatal(err)
+	}
+	src := req.Messages[0].Content[1].Source
+	if src.MediaType != "image/jpeg" {
+		t.Fatalf("expected media_type image/jpeg, got %q", src.MediaType)
+	}
+	if w, h := decodedSize(t, src.Data); w != 100 || h != 50 {
+		t.Fatalf("expected 100x50, got %dx%d", w, h)
+	}
+
+	resized := requestLogTags(r).images
+	if len(resized) != 1 || resized[0].OriginalWidth != 400 || resized[0].SentWidth != 100 || resized[0].SentBytes == 0 {
+		t.Fatalf("unexpected log record: %+v", resized)
+	}
+}
+
+func TestApplyImageLimitsDataURLs(t *testing.T) {
+	h := &Handler{images: ImageLimits{MaxDimension: 64, Downscale: true}}
+	for name, part := range map[string]string{
+		"chat":      `{"type":"image_url","image_url":{"url":"data:image/png;base64,%s"}}`,
+		"responses": `{"type":"input_image","image_url":"data:image/png;base64,%s"}`,
+	} {
+		body := []byte(`{"model":"m","messages":[{"role":"user","content":[` + strings.Replace(part, "%s", testPNG(t, 128, 128), 1) + `]}]}`)
+		_, out, msg := h.applyImageLimits(httptest.NewRequest("POST", "/", nil), body)
+		if msg != "" {
+			t.Fatalf("%s: unexpected rejection: %s", name, msg)
+		}
+		_, data, ok := strings.Cut(string(out), "data:image/jpeg;base64,")
+		if !ok {
+			t.Fatalf("%s: expected a JPEG data URL, got %s", name, out)
+		}
+		data, _, _ = strings.Cut(data, `"`)
+		if w, h := decodedSize(t, data); w != 64 || h != 64 {
+			t.Fatalf("%s: expected 64x64, got %dx%d", name, w, h)
+		}
+	}
+}
+
+func TestApplyImageLimitsRejects(t *testing.T) {
+	img := testPNG(t, 300, 100)
+	body := []byte(`{"messages":[{"role":"user","content":[{"type":"image","source":{"type":"base64","media_type":"image/png","data":"` + img + `"}}]}]}`)
+
+	h := &Handler{images: ImageLimits{MaxDimension: 200}}
+	if _, _, msg := h.applyImageLimits(httptest.NewRequest("POST", "/", nil), body); msg != "image 1 is 300x100 pixels, over the 200 pixel limit" {
+		t.Fatalf("unexpected message: %q", msg)
+	}
+
+	h = &Handler{images: ImageLimits{MaxBytes: 10, Downscale: true}}
+	if _, _, msg := h.applyImageLimits(httptest.NewRequest("POST", "/", nil), body); !strings.HasSuffix(msg, "cannot be downscaled below it") {
+		t.Fatalf("expected an image that cannot fit to be rejected, got %q", msg)
+	}
+}
+
+func TestApplyImageLimitsWithinLimits(t *testing.T) {
+	body := []byte(`{"messages":[{"role":"user","content":[{"type":"image","source":{"type":"base64","media_type":"image/png","data":"` + testPNG(t, 50, 50) + `"}}]}]}`)
+	h := &Handler{images: ImageLimits{MaxDimension: 100, MaxBytes: 1 << 20, Downscale: true}}
+	r, out, msg := h.applyImageLimits(httptest.NewRequest("POST", "/", nil), body)
+	if msg != "" || !bytes.Equal(out, body) || requestLogTags(r).images != nil {
+		t.Fatalf("expected the body unchanged, got %q %s", msg, out)
+	}
+}
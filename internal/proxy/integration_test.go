@@ -33,6 +33,30 @@ func (m *mockProxyHandler) HandleOpenAIResponses(w http.ResponseWriter, r *http.
 	w.Write([]byte(`{"id":"resp_123"}`))
 }
 
+func (m *mockProxyHandler) HandleListModels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"object":"list","data":[]}`))
+}
+
+func (m *mockProxyHandler) HandleCompare(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"results":[]}`))
+}
+
+func (m *mockProxyHandler) HandleGemini(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"candidates":[]}`))
+}
+
+func (m *mockProxyHandler) HandleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"object":"list","data":[]}`))
+}
+
 func newTestRouter(opts *server.Opts) *chi.Mux {
 	cfg := &config.Config{CORSOrigins: []string{"*"}}
 	noAuth := func(next http.Handler) http.Handler { return next }
@@ -48,8 +72,8 @@ func TestSecurityHeadersPresent(t *testing.T) {
 
 	headers := map[string]string{
 		"X-Content-Type-Options": "nosniff",
-		"X-Frame-Options":       "DENY",
-		"X-XSS-Protection":      "0",
+		"X-Frame-Options":        "DENY",
+		"X-XSS-Protection":       "0",
 		"Referrer-Policy":        "strict-origin-when-cross-origin",
 		"Permissions-Policy":     "camera=(), microphone=(), geolocation=()",
 	}
@@ -79,7 +103,7 @@ func TestHealthEndpoint(t *testing.T) {
 }
 
 func TestRateLimitReturns429(t *testing.T) {
-	limiter := ratelimit.NewLimiter(1, 1) // 1 rps, burst of 1
+	limiter := ratelimit.NewMemoryLimiter(1, 1) // 1 rps, burst of 1
 	defer limiter.Close()
 
 	router := newTestRouter(&server.Opts{RateLimiter: limiter})
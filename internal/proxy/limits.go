@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"fmt"
+
+	json "github.com/bytedance/sonic"
+
+	"github.com/sertdev/pxbin/pkg/translate"
+)
+
+// checkLimits validates a request against the model's known context window
+// and output limit so oversized requests fail fast instead of round-tripping
+// to the upstream. Input size is only an estimate, so a request is rejected
+// only when its estimated prompt alone exceeds the context window. Returns
+// a client-facing message, or "" if the request is within limits.
+func checkLimits(up *upstreamInfo, model string, inputTokens, maxTokens int) string {
+	if up.maxOutputTokens > 0 && maxTokens > up.maxOutputTokens {
+		return fmt.Sprintf("max_tokens: %d > %d, which is the maximum allowed number of output tokens for %s", maxTokens, up.maxOutputTokens, model)
+	}
+	if up.contextWindow > 0 && inputTokens > up.contextWindow {
+		return fmt.Sprintf("prompt is too long: an estimated %d tokens > %d maximum context window for %s", inputTokens, up.contextWindow, model)
+	}
+	return ""
+}
+
+// countTokens counts text with the model's tokenizer, falling back to the
+// ~4 bytes per token estimate.
+func (up *upstreamInfo) countTokens(text string) int {
+	if up.counter == nil {
+		return (len(text) + 3) / 4
+	}
+	return up.counter.Count(text)
+}
+
+// checkAnthropicLimits runs checkLimits on a raw Anthropic request body.
+// The body is only fully parsed for a token count when its size alone
+// suggests it could exceed the context window (a token is never shorter
+// than a byte).
+func checkAnthropicLimits(up *upstreamInfo, model string, body []byte) string {
+	if up.contextWindow == 0 && up.maxOutputTokens == 0 {
+		return ""
+	}
+	maxTokens := 0
+	if node, err := json.Get(body, "max_tokens"); err == nil {
+		if n, err := node.Int64(); err == nil {
+			maxTokens = int(n)
+		}
+	}
+	inputTokens := 0
+	if up.contextWindow > 0 && len(body) > up.contextWindow {
+		var req translate.AnthropicRequest
+		if err := json.Unmarshal(body, &req); err == nil {
+			inputTokens = translate.CountInputTokens(&req, up.countTokens)
+		}
+	}
+	return checkLimits(up, model, inputTokens, maxTokens)
+}
+
+// checkOpenAIBodyLimits runs checkLimits on a raw Chat Completions request
+// body forwarded to an OpenAI-format upstream. Like checkAnthropicLimits,
+// it only parses the whole body when its size could exceed the context
+// window.
+func checkOpenAIBodyLimits(up *upstreamInfo, model string, body []byte) string {
+	if up.contextWindow == 0 && up.maxOutputTokens == 0 {
+		return ""
+	}
+	maxTokens := 0
+	for _, field := range []string{"max_completion_tokens", "max_tokens"} {
+		if node, err := json.Get(body, field); err == nil {
+			if n, err := node.Int64(); err == nil {
+				maxTokens = int(n)
+				break
+			}
+		}
+	}
+	if up.contextWindow > 0 && len(body) > up.contextWindow {
+		var req translate.OpenAIRequest
+		if err := json.Unmarshal(body, &req); err == nil {
+			return checkOpenAILimits(up, model, &req)
+		}
+	}
+	return checkLimits(up, model, 0, maxTokens)
+}
+
+// checkOpenAILimits runs checkLimits on a parsed Chat Completions request.
+func checkOpenAILimits(up *upstreamInfo, model string, req *translate.OpenAIRequest) string {
+	if up.contextWindow == 0 && up.maxOutputTokens == 0 {
+		return ""
+	}
+	maxTokens := 0
+	if req.MaxCompletionTokens != nil {
+		maxTokens = *req.MaxCompletionTokens
+	} else if req.MaxTokens != nil {
+		maxTokens = *req.MaxTokens
+	}
+	inputTokens := 0
+	if up.contextWindow > 0 {
+		inputTokens = translate.CountOpenAIInputTokens(req, up.countTokens)
+	}
+	return checkLimits(up, model, inputTokens, maxTokens)
+}
+
+// SetDefaultMaxTokens sets the max_tokens injected into requests to
+// Anthropic-format upstreams that omit it, unless the model has its own
+// default. 0 disables injection.
+func (h *Handler) SetDefaultMaxTokens(n int) {
+	h.defaultMaxTokens = n
+}
+
+// SetMaxSSEFrameSize sets the longest upstream SSE line accepted from
+// upstreams without their own max_sse_frame_bytes. 0 uses
+// translate.DefaultMaxSSEFrameSize.
+func (h *Handler) SetMaxSSEFrameSize(n int) {
+	h.maxSSEFrame = n
+}
+
+// applyDefaultMaxTokens adds max_tokens to an Anthropic request body that
+// omits it (or sends null), using the model's default, falling back to the
+// proxy-wide one, capped at the model's output limit. The body is returned
+// unchanged when max_tokens is present or no default is configured.
+func (h *Handler) applyDefaultMaxTokens(body []byte, up *upstreamInfo) ([]byte, error) {
+	n := up.defaultMaxTokens
+	if n == 0 {
+		n = h.defaultMaxTokens
+	}
+	if up.maxOutputTokens > 0 && n > up.maxOutputTokens {
+		n = up.maxOutputTokens
+	}
+	if n <= 0 {
+		return body, nil
+	}
+	if node, err := json.Get(body, "max_tokens"); err == nil {
+		if raw, err := node.Raw(); err == nil && raw != "null" {
+			return body, nil
+		}
+	}
+
+	var req map[string]any
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	req["max_tokens"] = n
+	return json.Marshal(req)
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/logging"
+	"github.com/sertdev/pxbin/internal/policy"
+	"github.com/sertdev/pxbin/internal/slogger"
+	"github.com/sertdev/pxbin/pkg/translate"
+)
+
+// logTags are per-request fields that h.log adds to every log entry, so
+// they do not have to be threaded through each handler path.
+type logTags struct {
+	canaryID       uuid.UUID
+	canaryArm      string
+	upstreamFormat string
+	translated     bool
+	priority       string                 // effective x-pxbin-priority
+	images         []imageResize          // images downscaled before forwarding
+	inputFormat    string                 // client API format when translated before the handler, e.g. "gemini"
+	failedOver     []uuid.UUID            // upstreams that failed before the one serving the request
+	cacheInjected  bool                   // prompt caching breakpoints were added to the request
+	cachePrefix    *translate.CachePrefix // what a translated Anthropic request's breakpoints mark cacheable
+	router         *routedBy              // router model that picked the request's model; nil for none
+	metadata       map[string]string      // request metadata keys named by log_metadata_keys
+}
+
+type logTagsKey struct{}
+
+func requestLogTags(r *http.Request) logTags {
+	t, _ := r.Context().Value(logTagsKey{}).(logTags)
+	return t
+}
+
+func withLogTags(r *http.Request, t logTags) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), logTagsKey{}, t))
+}
+
+// withCanaryArm records the decision's canary arm so the request's log
+// entries can be compared against the other arm.
+func withCanaryArm(r *http.Request, d policy.Decision) *http.Request {
+	if d.CanaryArm == "" {
+		return r
+	}
+	t := requestLogTags(r)
+	t.canaryID, t.canaryArm = d.CanaryID, d.CanaryArm
+	return withLogTags(r, t)
+}
+
+// withTranslationPath records the upstream's format and whether the request
+// is translated between API formats on its way there.
+func withTranslationPath(r *http.Request, upstreamFormat string, translated bool) *http.Request {
+	t := requestLogTags(r)
+	t.upstreamFormat, t.translated = upstreamFormat, translated
+	return withLogTags(r, t)
+}
+
+// withInputFormat records the client's API format for a request that was
+// translated before reaching the handler that serves it.
+func withInputFormat(r *http.Request, format string) *http.Request {
+	t := requestLogTags(r)
+	t.inputFormat = format
+	return withLogTags(r, t)
+}
+
+// withRequestLogger adds the resolved model and upstream to the request's
+// logger, so warnings from stream handling can be traced to the request.
+func withRequestLogger(r *http.Request, upstream *upstreamInfo) *http.Request {
+	return r.WithContext(slogger.With(r.Context(), "model", upstream.model, "upstream_id", upstream.id))
+}
+
+// log queues a request log entry with the request's log tags.
+func (h *Handler) log(r *http.Request, e *logging.LogEntry) {
+	t := requestLogTags(r)
+	if t.canaryArm != "" {
+		e.CanaryID = &t.canaryID
+		e.CanaryArm = t.canaryArm
+	}
+	e.UpstreamFormat = t.upstreamFormat
+	e.Translated = t.translated
+	if t.inputFormat != "" {
+		e.InputFormat = t.inputFormat
+		e.Translated = true
+	}
+	e.Priority = t.priority
+	if len(t.images) > 0 {
+		if e.RequestMetadata == nil {
+			e.RequestMetadata = map[string]interface{}{}
+		}
+		e.RequestMetadata["images"] = t.images
+	}
+	if len(t.failedOver) > 0 {
+		if e.RequestMetadata == nil {
+			e.RequestMetadata = map[string]interface{}{}
+		}
+		e.RequestMetadata["failover_from"] = t.failedOver
+	}
+	if f := failoverFromContext(r.Context()); f != nil && f.attempts > 1 {
+		if e.RequestMetadata == nil {
+			e.RequestMetadata = map[string]interface{}{}
+		}
+		e.RequestMetadata["upstream_attempts"] = f.attempts
+	}
+	if t.cacheInjected {
+		if e.RequestMetadata == nil {
+			e.RequestMetadata = map[string]interface{}{}
+		}
+		e.RequestMetadata["cache_control_injected"] = true
+	}
+	if t.cachePrefix != nil {
+		if e.RequestMetadata == nil {
+			e.RequestMetadata = map[string]interface{}{}
+		}
+		e.RequestMetadata["cache_prefix"] = t.cachePrefix
+	}
+	if t.router != nil {
+		if e.RequestMetadata == nil {
+			e.RequestMetadata = map[string]interface{}{}
+		}
+		e.RequestMetadata["router"] = t.router
+	}
+	if len(t.metadata) > 0 {
+		if e.RequestMetadata == nil {
+			e.RequestMetadata = map[string]interface{}{}
+		}
+		e.RequestMetadata["metadata"] = t.metadata
+	}
+	if isSandboxKey(r.Context()) {
+		e.UpstreamID = nil
+		e.Cost = 0
+		if e.RequestMetadata == nil {
+			e.RequestMetadata = map[string]interface{}{}
+		}
+		e.RequestMetadata["sandbox"] = true
+	}
+	h.recordScore(e)
+	h.observeUpstream(e)
+	traceLog(r.Context(), e)
+	if f := failoverFromContext(r.Context()); f != nil && f.holds(e.StatusCode) {
+		f.entry = e
+		return
+	}
+	h.queueLog(r.Context(), e)
+}
+
+// queueLog bills and queues a log entry, unless a guardrail check or a
+// payload capture holds it until the response is complete.
+func (h *Handler) queueLog(ctx context.Context, e *logging.LogEntry) {
+	if h.billing != nil {
+		h.billing.AddSpend(e.KeyID, e.Cost, e.Timestamp)
+	}
+	if guardHeld(ctx, e) || heldLog(ctx, e) {
+		return
+	}
+	h.logger.Log(e)
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/http"
+
+	json "github.com/bytedance/sonic"
+	"github.com/sertdev/pxbin/pkg/translate"
+)
+
+// SetMetadataOptions sets how request metadata is carried across formats
+// when translating, and which metadata keys are copied into request logs.
+func (h *Handler) SetMetadataOptions(m translate.MetadataMap, logKeys []string) {
+	h.metadataMap = m
+	h.logMetadataKeys = logKeys
+}
+
+// withRequestMetadata records the keys of the request body's metadata
+// object that log_metadata_keys names, to be logged with the request.
+func (h *Handler) withRequestMetadata(r *http.Request, body []byte) *http.Request {
+	if len(h.logMetadataKeys) == 0 {
+		return r
+	}
+	node, err := json.Get(body, "metadata")
+	if err != nil {
+		return r
+	}
+	raw, err := node.Raw()
+	if err != nil {
+		return r
+	}
+	var md translate.Metadata
+	if json.Unmarshal([]byte(raw), &md) != nil {
+		return r
+	}
+	var logged map[string]string
+	for _, key := range h.logMetadataKeys {
+		if v, ok := md.Get(key); ok {
+			if logged == nil {
+				logged = map[string]string{}
+			}
+			logged[key] = v
+		}
+	}
+	if logged == nil {
+		return r
+	}
+	t := requestLogTags(r)
+	t.metadata = logged
+	return withLogTags(r, t)
+}
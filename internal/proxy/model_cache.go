@@ -3,6 +3,7 @@ package proxy
 import (
 	"context"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,6 +15,12 @@ type modelCacheEntry struct {
 	expires time.Time
 }
 
+// modelLookup is the store queries behind ModelCache.
+type modelLookup interface {
+	GetModelWithUpstream(ctx context.Context, modelName string) (*store.ModelWithUpstream, error)
+	ListActiveModelsWithUpstream(ctx context.Context) ([]*store.ModelWithUpstream, error)
+}
+
 // ModelCache provides an in-memory TTL cache for model→upstream resolution,
 // eliminating a DB JOIN query on every proxied request.
 //
@@ -22,14 +29,19 @@ type modelCacheEntry struct {
 // on a DB round-trip.
 type ModelCache struct {
 	mu         sync.RWMutex
-	items      map[string]*modelCacheEntry // keyed by model name
+	items      map[string]*modelCacheEntry // keyed by lowercased model name or alias
 	refreshing map[string]bool             // in-flight background refreshes
+	gen        uint64                      // bumped by Invalidate; refreshes started before it are dropped
 	ttl        time.Duration
-	store      *store.Store
+	store      modelLookup
 }
 
 // NewModelCache creates a model cache with the given TTL.
-func NewModelCache(s *store.Store, ttl time.Duration) *ModelCache {
+func NewModelCache(s store.Store, ttl time.Duration) *ModelCache {
+	return newModelCache(s, ttl)
+}
+
+func newModelCache(s modelLookup, ttl time.Duration) *ModelCache {
 	return &ModelCache{
 		items:      make(map[string]*modelCacheEntry),
 		refreshing: make(map[string]bool),
@@ -41,8 +53,13 @@ func NewModelCache(s *store.Store, ttl time.Duration) *ModelCache {
 // GetModelWithUpstream returns a cached result. If the entry is stale, it
 // returns the stale value immediately and triggers a background refresh.
 // Only truly cold misses (first request for a model) block on the DB.
+//
+// Names are matched case-insensitively and may be one of the model's
+// aliases or match one of its wildcard aliases; the returned model carries
+// its canonical name.
 func (c *ModelCache) GetModelWithUpstream(ctx context.Context, modelName string) (*store.ModelWithUpstream, error) {
 	now := time.Now()
+	modelName = strings.ToLower(modelName)
 
 	c.mu.RLock()
 	entry, ok := c.items[modelName]
@@ -59,7 +76,10 @@ func (c *ModelCache) GetModelWithUpstream(ctx context.Context, modelName string)
 	}
 
 	// Cold miss — must block on DB.
-	return c.fetchAndCache(ctx, modelName)
+	c.mu.RLock()
+	gen := c.gen
+	c.mu.RUnlock()
+	return c.fetchAndCache(ctx, modelName, gen)
 }
 
 // triggerRefresh starts a background goroutine to refresh a stale entry,
@@ -71,6 +91,7 @@ func (c *ModelCache) triggerRefresh(modelName string) {
 		return
 	}
 	c.refreshing[modelName] = true
+	gen := c.gen
 	c.mu.Unlock()
 
 	go func() {
@@ -83,20 +104,24 @@ func (c *ModelCache) triggerRefresh(modelName string) {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		if _, err := c.fetchAndCache(ctx, modelName); err != nil {
+		if _, err := c.fetchAndCache(ctx, modelName, gen); err != nil {
 			log.Printf("model cache: background refresh for %q failed: %v", modelName, err)
 		}
 	}()
 }
 
-func (c *ModelCache) fetchAndCache(ctx context.Context, modelName string) (*store.ModelWithUpstream, error) {
+// fetchAndCache looks modelName up and caches the result unless the cache was
+// invalidated since gen, when the result may predate the change.
+func (c *ModelCache) fetchAndCache(ctx context.Context, modelName string, gen uint64) (*store.ModelWithUpstream, error) {
 	mw, err := c.store.GetModelWithUpstream(ctx, modelName)
 	if err != nil {
 		return nil, err
 	}
 
 	c.mu.Lock()
-	c.items[modelName] = &modelCacheEntry{mw: mw, expires: time.Now().Add(c.ttl)}
+	if c.gen == gen {
+		c.items[modelName] = &modelCacheEntry{mw: mw, expires: time.Now().Add(c.ttl)}
+	}
 	c.mu.Unlock()
 
 	return mw, nil
@@ -116,8 +141,17 @@ func (c *ModelCache) Warm(ctx context.Context) error {
 
 	expires := time.Now().Add(c.ttl)
 	c.mu.Lock()
+	// Names go in last so they win over a clashing alias, as in the store.
+	// Names matching wildcard aliases are cached as they are first looked up.
+	for _, mw := range models {
+		for _, alias := range mw.Aliases {
+			if !store.IsAliasPattern(alias) {
+				c.items[alias] = &modelCacheEntry{mw: mw, expires: expires}
+			}
+		}
+	}
 	for _, mw := range models {
-		c.items[mw.Name] = &modelCacheEntry{mw: mw, expires: expires}
+		c.items[strings.ToLower(mw.Name)] = &modelCacheEntry{mw: mw, expires: expires}
 	}
 	c.mu.Unlock()
 	return nil
@@ -127,5 +161,6 @@ func (c *ModelCache) Warm(ctx context.Context) error {
 func (c *ModelCache) Invalidate() {
 	c.mu.Lock()
 	c.items = make(map[string]*modelCacheEntry)
+	c.gen++
 	c.mu.Unlock()
 }
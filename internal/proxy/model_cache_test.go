@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// blockingModels answers model lookups with upstream, once release is closed.
+type blockingModels struct {
+	upstream string
+	release  chan struct{}
+}
+
+func (b *blockingModels) GetModelWithUpstream(ctx context.Context, modelName string) (*store.ModelWithUpstream, error) {
+	<-b.release
+	mw := &store.ModelWithUpstream{UpstreamBaseURL: b.upstream}
+	mw.Name = modelName
+	return mw, nil
+}
+
+func (b *blockingModels) ListActiveModelsWithUpstream(ctx context.Context) ([]*store.ModelWithUpstream, error) {
+	return nil, nil
+}
+
+func staleModelCache(b *blockingModels) *ModelCache {
+	c := newModelCache(b, time.Minute)
+	mw := &store.ModelWithUpstream{UpstreamBaseURL: "http://old"}
+	mw.Name = "m"
+	c.items["m"] = &modelCacheEntry{mw: mw, expires: time.Now().Add(-time.Second)}
+	return c
+}
+
+func waitModelRefreshed(t *testing.T, c *ModelCache) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.RLock()
+		busy := c.refreshing["m"]
+		c.mu.RUnlock()
+		if !busy {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("background refresh did not finish")
+}
+
+func TestModelCacheServesStaleWhileRefreshing(t *testing.T) {
+	b := &blockingModels{upstream: "http://new", release: make(chan struct{})}
+	c := staleModelCache(b)
+
+	mw, err := c.GetModelWithUpstream(context.Background(), "M")
+	if err != nil || mw.UpstreamBaseURL != "http://old" {
+		t.Fatalf("expected the stale entry at once, got %+v, %v", mw, err)
+	}
+	close(b.release)
+	waitModelRefreshed(t, c)
+
+	mw, _ = c.GetModelWithUpstream(context.Background(), "m")
+	if mw.UpstreamBaseURL != "http://new" {
+		t.Fatalf("expected the refreshed entry, got %q", mw.UpstreamBaseURL)
+	}
+}
+
+func TestModelCacheInvalidateWinsOverRefresh(t *testing.T) {
+	b := &blockingModels{upstream: "http://new", release: make(chan struct{})}
+	c := staleModelCache(b)
+
+	c.GetModelWithUpstream(context.Background(), "m")
+	c.Invalidate()
+	close(b.release)
+	waitModelRefreshed(t, c)
+
+	c.mu.RLock()
+	_, cached := c.items["m"]
+	c.mu.RUnlock()
+	if cached {
+		t.Fatal("a refresh started before Invalidate repopulated the cache")
+	}
+}
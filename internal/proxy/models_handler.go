@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"net/http"
+	"sort"
+
+	json "github.com/bytedance/sonic"
+
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// listedModel is one entry in the /v1/models response. It carries both the
+// OpenAI (object, created, owned_by) and Anthropic (type, display_name,
+// created_at) fields, plus the model's known limits.
+type listedModel struct {
+	ID              string `json:"id"`
+	Object          string `json:"object,omitempty"`
+	Created         int64  `json:"created,omitempty"`
+	OwnedBy         string `json:"owned_by,omitempty"`
+	Type            string `json:"type,omitempty"`
+	DisplayName     string `json:"display_name,omitempty"`
+	CreatedAt       string `json:"created_at,omitempty"`
+	ContextWindow   *int   `json:"context_window,omitempty"`
+	MaxOutputTokens *int   `json:"max_output_tokens,omitempty"`
+}
+
+// HandleListModels serves GET /v1/models with the active models and router
+// models this proxy can route, less those the key's model allowlist leaves
+// out. Requests carrying an anthropic-version header get the Anthropic list
+// shape; everything else gets the OpenAI shape.
+func (h *Handler) HandleListModels(w http.ResponseWriter, r *http.Request) {
+	models, err := h.store.ListActiveModelsWithUpstream(r.Context())
+	anthropic := r.Header.Get("anthropic-version") != ""
+	if err != nil {
+		if anthropic {
+			writeAnthropicError(w, http.StatusInternalServerError, "api_error", "Failed to list models")
+		} else {
+			writeOpenAIError(w, http.StatusInternalServerError, "server_error", "Failed to list models")
+		}
+		return
+	}
+	// Router models are listed like the models they pick from.
+	for _, mr := range h.routers.list() {
+		models = append(models, &store.ModelWithUpstream{Model: store.Model{Name: mr.Name, Provider: "pxbin", CreatedAt: mr.CreatedAt}})
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].Name < models[j].Name })
+
+	key := auth.GetKeyFromContext(r.Context())
+	data := make([]listedModel, 0, len(models))
+	for _, m := range models {
+		if key != nil && !key.AllowsModel(m.Name) {
+			continue
+		}
+		lm := listedModel{
+			ID:              m.Name,
+			ContextWindow:   m.ContextWindow,
+			MaxOutputTokens: m.MaxOutputTokens,
+		}
+		if anthropic {
+			lm.Type = "model"
+			lm.DisplayName = m.Name
+			if m.DisplayName != nil {
+				lm.DisplayName = *m.DisplayName
+			}
+			lm.CreatedAt = m.CreatedAt.UTC().Format("2006-01-02T15:04:05Z")
+		} else {
+			lm.Object = "model"
+			lm.Created = m.CreatedAt.Unix()
+			lm.OwnedBy = m.Provider
+		}
+		data = append(data, lm)
+	}
+
+	var resp any
+	if anthropic {
+		body := map[string]any{"data": data, "has_more": false, "first_id": nil, "last_id": nil}
+		if len(data) > 0 {
+			body["first_id"] = data[0].ID
+			body["last_id"] = data[len(data)-1].ID
+		}
+		resp = body
+	} else {
+		resp = map[string]any{"object": "list", "data": data}
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "Failed to encode response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
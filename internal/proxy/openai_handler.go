@@ -1,11 +1,11 @@
 package proxy
 
 import (
-	"bufio"
 	"bytes"
+	"errors"
 	json "github.com/bytedance/sonic"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
@@ -13,7 +13,9 @@ import (
 	"github.com/google/uuid"
 	"github.com/sertdev/pxbin/internal/auth"
 	"github.com/sertdev/pxbin/internal/logging"
-	"github.com/sertdev/pxbin/internal/translate"
+	"github.com/sertdev/pxbin/internal/slogger"
+	"github.com/sertdev/pxbin/internal/tracing"
+	"github.com/sertdev/pxbin/pkg/translate"
 )
 
 type openAIResponsesStreamResult struct {
@@ -21,6 +23,8 @@ type openAIResponsesStreamResult struct {
 	InputTokens        int
 	OutputTokens       int
 	CacheReadTokens    int
+	ReasoningTokens    int
+	ToolCalls          int
 	HasModel           bool
 	HasInputTokens     bool
 	HasOutputTokens    bool
@@ -31,7 +35,15 @@ type openAIResponsesStreamResult struct {
 // into Chat Completions requests, forwards them to the upstream, and translates
 // the response back to Responses API format.
 func (h *Handler) HandleOpenAIResponses(w http.ResponseWriter, r *http.Request) {
+	h.withGuardrails(w, r, guardResponses, func(w http.ResponseWriter, r *http.Request) {
+		h.withFailover(w, r, h.handleOpenAIResponses)
+	})
+}
+
+func (h *Handler) handleOpenAIResponses(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
+	w, closeStream := h.streamWriter(w, r, "")
+	defer closeStream()
 	keyID := auth.GetKeyIDFromContext(r.Context())
 
 	body, err := readBody(r)
@@ -41,19 +53,71 @@ func (h *Handler) HandleOpenAIResponses(w http.ResponseWriter, r *http.Request)
 	}
 	defer r.Body.Close()
 
+	priority, ok := requestPriority(r)
+	if !ok {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", invalidPriorityMessage)
+		return
+	}
+	r = withPriority(r, priority)
+	r = h.withRequestMetadata(r, body)
+
+	var msg string
+	if r, body, msg = h.applyImageLimits(r, body); msg != "" {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", msg)
+		return
+	}
+
 	var responsesReq translate.ResponsesAPIRequest
 	if err := json.Unmarshal(body, &responsesReq); err != nil {
 		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
 		return
 	}
 
+	decision := h.admit(r, responsesReq.Model, "responses", int64(len(body)))
+	r = withCanaryArm(r, decision)
+	if decision.Denied {
+		h.logDenied(r, decision, responsesReq.Model, "openai", start)
+		writeOpenAIError(w, http.StatusForbidden, "invalid_request_error", decision.Message)
+		return
+	}
+	if decision.Filtered {
+		h.logFiltered(r, decision, responsesReq.Model, "openai", start)
+		writeResponsesFiltered(w, responsesReq.Model, decision.Message, responsesReq.Stream)
+		return
+	}
+	if decision.Model != "" {
+		responsesReq.Model = decision.Model
+	}
+	if decision.MaxTokens > 0 && (responsesReq.MaxOutputTokens == nil || *responsesReq.MaxOutputTokens > decision.MaxTokens) {
+		responsesReq.MaxOutputTokens = &decision.MaxTokens
+	}
+
 	model := responsesReq.Model
 
+	// A router model is served by the model it picks for the request.
+	if r, model, _, err = h.routeModel(r, model, body); err != nil {
+		status, msg := resolveErrorStatus(err)
+		h.logRejected(r, model, "openai", status, msg, start)
+		writeOpenAIError(w, status, "invalid_request_error", msg)
+		return
+	}
+
 	upstream, err := h.resolveUpstream(r.Context(), model)
 	if err != nil {
-		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "Failed to resolve upstream")
+		status, msg := resolveErrorStatus(err)
+		if status == http.StatusForbidden {
+			h.logRejected(r, model, "openai", status, msg, start)
+			writeOpenAIError(w, status, "invalid_request_error", msg)
+			return
+		}
+		writeOpenAIError(w, status, "server_error", msg)
 		return
 	}
+	// Responses API requests are always translated to chat completions.
+	r = withTranslationPath(r, upstream.format, true)
+	r = withRequestLogger(r, upstream)
+	responsesReq.Model = upstream.model
+	model = upstream.model
 	upstreamID := &upstream.id
 
 	if upstream.format == "anthropic" {
@@ -62,23 +126,36 @@ func (h *Handler) HandleOpenAIResponses(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Translate Responses API → Chat Completions.
+	span := startTranslate(r.Context(), "responses", "openai")
 	chatReq, err := translate.ResponsesRequestToChatCompletions(&responsesReq)
+	tracing.EndWithError(span, err)
 	if err != nil {
 		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Failed to translate request: "+err.Error())
 		return
 	}
+	translate.MapRoles(chatReq.Messages, upstream.roles)
+
+	if msg := checkOpenAILimits(upstream, model, chatReq); msg != "" {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", msg)
+		return
+	}
 
 	chatBody, err := json.Marshal(chatReq)
+	if err == nil {
+		if tier := serviceTier(r, upstream); tier != "" {
+			chatBody, err = setServiceTier(chatBody, tier)
+		}
+	}
 	if err != nil {
 		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "Failed to encode translated request")
 		return
 	}
 
 	overheadUS := int(time.Since(start).Microseconds())
-	upstreamResp, err := upstream.client.Do(r.Context(), "POST", "/v1/chat/completions", bytes.NewReader(chatBody), nil)
+	upstreamResp, err := upstream.client.Do(r.Context(), "POST", "/v1/chat/completions", bytes.NewReader(chatBody), acceptCompressed(nil, upstream, responsesReq.Stream))
 	if err != nil {
 		latency := time.Since(start)
-		h.logger.Log(&logging.LogEntry{
+		h.log(r, &logging.LogEntry{
 			KeyID:        keyID,
 			Timestamp:    start,
 			Method:       r.Method,
@@ -86,21 +163,25 @@ func (h *Handler) HandleOpenAIResponses(w http.ResponseWriter, r *http.Request)
 			Model:        model,
 			InputFormat:  "openai",
 			UpstreamID:   upstreamID,
+			Region:       upstream.region,
 			StatusCode:   http.StatusBadGateway,
 			LatencyMS:    int(latency.Milliseconds()),
 			OverheadUS:   overheadUS,
 			ErrorMessage: "upstream connection error: " + err.Error(),
+			ErrorCode:    transportErrorCode(err),
 		})
 		writeOpenAIError(w, http.StatusBadGateway, "server_error", "Failed to connect to upstream")
 		return
 	}
 	defer upstreamResp.Body.Close()
+	setGatewayHeaders(w, r, upstream.id, model, overheadUS, responsesReq.Stream)
 
 	if upstreamResp.StatusCode >= 400 {
 		upstreamBody, _ := io.ReadAll(upstreamResp.Body)
+		perr := classifyProviderError(upstreamResp.StatusCode, upstreamBody)
 		latency := time.Since(start)
 
-		h.logger.Log(&logging.LogEntry{
+		h.log(r, &logging.LogEntry{
 			KeyID:        keyID,
 			Timestamp:    start,
 			Method:       r.Method,
@@ -108,11 +189,17 @@ func (h *Handler) HandleOpenAIResponses(w http.ResponseWriter, r *http.Request)
 			Model:        model,
 			InputFormat:  "openai",
 			UpstreamID:   upstreamID,
+			Region:       upstream.region,
 			StatusCode:   upstreamResp.StatusCode,
 			LatencyMS:    int(latency.Milliseconds()),
 			OverheadUS:   overheadUS,
-			ErrorMessage: string(upstreamBody),
+			ErrorMessage: perr.logMessage(upstreamBody),
+			ErrorCode:    perr.errorCode(),
 		})
+		if perr != nil {
+			perr.writeOpenAI(w, upstreamResp.StatusCode)
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(upstreamResp.StatusCode)
@@ -132,17 +219,24 @@ func (h *Handler) HandleOpenAIResponses(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
-		result, _ := translate.TranslateChatStreamToResponses(r.Context(), upstreamResp.Body, w, flusher, model)
+		body := upstream.watchStream(upstreamResp.Body)
+		result, _ := translate.TranslateChatStreamToResponses(r.Context(), body, w, flusher, model, upstream.maxSSEFrame)
+		body.Close()
 
 		latency := time.Since(start)
-		var inputTokens, outputTokens, cacheReadTokens int
+		var inputTokens, outputTokens, reasoningTokens, cacheReadTokens, toolCalls int
+		var metadata map[string]interface{}
 		if result != nil {
 			inputTokens = result.InputTokens
 			outputTokens = result.OutputTokens
+			reasoningTokens = result.ReasoningTokens
 			cacheReadTokens = result.CacheReadTokens
+			toolCalls = result.ToolCalls
+			metadata = responseIDMetadata(result.ResponseID, result.UpstreamResponseID)
 		}
-		cost := h.billing.CalculateCost(model, inputTokens, outputTokens)
-		h.logger.Log(&logging.LogEntry{
+		cost := h.billing.CalculateCost(model, inputTokens, outputTokens, reasoningTokens)
+		setUsageHeaders(w, r, cost, inputTokens, outputTokens)
+		h.log(r, &logging.LogEntry{
 			KeyID:           keyID,
 			Timestamp:       start,
 			Method:          r.Method,
@@ -150,13 +244,20 @@ func (h *Handler) HandleOpenAIResponses(w http.ResponseWriter, r *http.Request)
 			Model:           model,
 			InputFormat:     "openai",
 			UpstreamID:      upstreamID,
+			Region:          upstream.region,
 			StatusCode:      http.StatusOK,
+			Stream:          true,
 			LatencyMS:       int(latency.Milliseconds()),
 			OverheadUS:      overheadUS,
 			InputTokens:     inputTokens,
 			OutputTokens:    outputTokens,
+			ReasoningTokens: reasoningTokens,
 			CacheReadTokens: cacheReadTokens,
+			ToolCalls:       toolCalls,
 			Cost:            cost,
+			ErrorMessage:    body.errorMessage(),
+			ErrorCode:       body.errorCode(),
+			RequestMetadata: metadata,
 		})
 		return
 	}
@@ -186,9 +287,12 @@ func (h *Handler) HandleOpenAIResponses(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	reasoningTokens := translate.OpenAIReasoningTokens(chatResp.Usage)
+
 	latency := time.Since(start)
-	cost := h.billing.CalculateCost(model, inputTokens, outputTokens)
-	h.logger.Log(&logging.LogEntry{
+	cost := h.billing.CalculateCost(model, inputTokens, outputTokens, reasoningTokens)
+	setUsageHeaders(w, r, cost, inputTokens, outputTokens)
+	h.log(r, &logging.LogEntry{
 		KeyID:           keyID,
 		Timestamp:       start,
 		Method:          r.Method,
@@ -196,13 +300,17 @@ func (h *Handler) HandleOpenAIResponses(w http.ResponseWriter, r *http.Request)
 		Model:           model,
 		InputFormat:     "openai",
 		UpstreamID:      upstreamID,
+		Region:          upstream.region,
 		StatusCode:      http.StatusOK,
 		LatencyMS:       int(latency.Milliseconds()),
 		OverheadUS:      overheadUS,
 		InputTokens:     inputTokens,
 		OutputTokens:    outputTokens,
+		ReasoningTokens: reasoningTokens,
 		CacheReadTokens: cacheReadTokens,
+		ToolCalls:       countToolCalls(&chatResp),
 		Cost:            cost,
+		RequestMetadata: responseIDMetadata(responsesResp.ID, chatResp.ID),
 	})
 
 	w.Header().Set("Content-Type", "application/json")
@@ -211,23 +319,40 @@ func (h *Handler) HandleOpenAIResponses(w http.ResponseWriter, r *http.Request)
 	w.Write(b)
 }
 
+// responseIDMetadata records the Responses API response ID returned to the
+// client and the upstream chat completion ID behind it, so a request log
+// can be matched to both the client's and the provider's records.
+func responseIDMetadata(responseID, upstreamID string) map[string]interface{} {
+	metadata := map[string]interface{}{}
+	if responseID != "" {
+		metadata["response_id"] = responseID
+	}
+	if upstreamID != "" {
+		metadata["upstream_response_id"] = upstreamID
+	}
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
+
 // passthroughOpenAIChatStream forwards OpenAI Chat Completions SSE events to
-// the client while extracting usage information for logging/billing.
-func passthroughOpenAIChatStream(upstream io.Reader, w http.ResponseWriter, flusher http.Flusher, fallbackModel string) openAIResponsesStreamResult {
+// the client while extracting usage information for logging/billing. A line
+// longer than maxFrame ends the stream with an error chunk.
+func passthroughOpenAIChatStream(lg *slog.Logger, upstream io.Reader, w http.ResponseWriter, flusher http.Flusher, fallbackModel string, maxFrame int) openAIResponsesStreamResult {
 	result := openAIResponsesStreamResult{Model: fallbackModel}
 
-	scanner := bufio.NewScanner(upstream)
-	scanner.Buffer(make([]byte, 0, 64*1024), 8*1024*1024)
+	scanner := translate.NewSSEScanner(upstream, maxFrame)
 
 	for scanner.Scan() {
 		line := scanner.Bytes()
 
 		if _, err := w.Write(line); err != nil {
-			log.Printf("openai chat stream write error: %v", err)
+			lg.Warn("openai chat stream write error", "error", err)
 			break
 		}
 		if _, err := w.Write([]byte("\n")); err != nil {
-			log.Printf("openai chat stream write error: %v", err)
+			lg.Warn("openai chat stream write error", "error", err)
 			break
 		}
 
@@ -259,15 +384,28 @@ func passthroughOpenAIChatStream(upstream io.Reader, w http.ResponseWriter, flus
 			result.HasInputTokens = true
 			result.OutputTokens = chunk.Usage.CompletionTokens
 			result.HasOutputTokens = true
+			result.ReasoningTokens = translate.OpenAIReasoningTokens(chunk.Usage)
 			if chunk.Usage.PromptTokensDetails != nil {
 				result.CacheReadTokens = chunk.Usage.PromptTokensDetails.CachedTokens
 				result.HasCacheReadTokens = true
 			}
 		}
+		// A tool call's first delta carries its id; later argument
+		// fragments only repeat the index.
+		for _, choice := range chunk.Choices {
+			for _, tc := range choice.Delta.ToolCalls {
+				if tc.ID != "" {
+					result.ToolCalls++
+				}
+			}
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		log.Printf("openai chat stream read error: %v", err)
+		lg.Warn("openai chat stream read error", "error", err)
+		if msg, ok := translate.StreamErrorMessage(err, maxFrame); ok {
+			translate.WriteOpenAIStreamError(w, flusher, msg)
+		}
 	}
 
 	flusher.Flush()
@@ -278,64 +416,176 @@ func passthroughOpenAIChatStream(upstream io.Reader, w http.ResponseWriter, flus
 // upstream's format is "openai" the request passes through unchanged;
 // "anthropic" upstreams are currently unsupported and return an error.
 func (h *Handler) HandleOpenAI(w http.ResponseWriter, r *http.Request) {
+	h.withGuardrails(w, r, guardChat, func(w http.ResponseWriter, r *http.Request) {
+		h.withFailover(w, r, h.handleOpenAI)
+	})
+}
+
+func (h *Handler) handleOpenAI(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
+	w, closeStream := h.streamWriter(w, r, "")
+	defer closeStream()
 	keyID := auth.GetKeyIDFromContext(r.Context())
 
 	defer r.Body.Close()
 
-	limitedBody := io.LimitReader(r.Body, maxRequestBodySize+1)
-	model, upstreamReqBody, err := readModelAndBuildBodyReader(limitedBody, modelProbeLimitBytes)
+	body, err := readBody(r)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Failed to read request body")
+		return
+	}
+	model, err := extractModel(body)
+	if errors.Is(err, errDuplicateModel) {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", duplicateModelMessage)
+		return
+	}
 	if err != nil {
 		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Invalid request body: missing or invalid model")
 		return
 	}
 
+	priority, ok := requestPriority(r)
+	if !ok {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", invalidPriorityMessage)
+		return
+	}
+	r = withPriority(r, priority)
+	if h.images.enabled() || len(h.logMetadataKeys) > 0 {
+		r = h.withRequestMetadata(r, body)
+		var msg string
+		if r, body, msg = h.applyImageLimits(r, body); msg != "" {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", msg)
+			return
+		}
+	}
+
+	// Apply admission policies before dispatch.
+	decision := h.admit(r, model, "openai", int64(len(body)))
+	r = withCanaryArm(r, decision)
+	if decision.Denied {
+		h.logDenied(r, decision, model, "openai", start)
+		writeOpenAIError(w, http.StatusForbidden, "invalid_request_error", decision.Message)
+		return
+	}
+	if decision.Filtered {
+		_, stream, _ := extractModelAndStream(body)
+		h.logFiltered(r, decision, model, "openai", start)
+		writeChatFiltered(w, model, decision.Message, stream)
+		return
+	}
+	if decision.Model != "" || decision.MaxTokens > 0 {
+		if body, err = applyDecision(body, decision, "max_tokens", "max_completion_tokens"); err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
+			return
+		}
+		if decision.Model != "" {
+			model = decision.Model
+		}
+	}
+
+	// A router model is served by the model it picks for the request.
+	if h.routers.lookup(model) != nil {
+		if r, model, _, err = h.routeModel(r, model, body); err != nil {
+			status, msg := resolveErrorStatus(err)
+			h.logRejected(r, model, "openai", status, msg, start)
+			writeOpenAIError(w, status, "invalid_request_error", msg)
+			return
+		}
+		if body, err = setRequestModel(body, model); err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
+			return
+		}
+	}
+
 	// Resolve upstream based on model.
 	upstream, err := h.resolveUpstream(r.Context(), model)
 	if err != nil {
-		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "Failed to resolve upstream")
+		status, msg := resolveErrorStatus(err)
+		if status == http.StatusForbidden {
+			h.logRejected(r, model, "openai", status, msg, start)
+			writeOpenAIError(w, status, "invalid_request_error", msg)
+			return
+		}
+		writeOpenAIError(w, status, "server_error", msg)
 		return
 	}
+	r = withTranslationPath(r, upstream.format, upstream.format == "anthropic")
+	r = withRequestLogger(r, upstream)
+	if upstream.model != model {
+		if body, err = setRequestModel(body, upstream.model); err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
+			return
+		}
+		model = upstream.model
+	}
 	upstreamID := &upstream.id
 
 	if upstream.format == "anthropic" {
 		// Translation path: OpenAI → Anthropic — full parse required.
-		body, readErr := io.ReadAll(upstreamReqBody)
-		if readErr != nil {
-			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Failed to read request body")
-			return
-		}
 		var openaiReq translate.OpenAIRequest
 		if err := json.Unmarshal(body, &openaiReq); err != nil {
 			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
 			return
 		}
+		if msg := checkOpenAILimits(upstream, model, &openaiReq); msg != "" {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", msg)
+			return
+		}
 		h.handleOpenAIToAnthropic(w, r, upstream, &openaiReq, keyID, start)
 		return
 	}
 
-	// Forward the request body to the upstream unchanged.
+	if msg := checkOpenAIBodyLimits(upstream, model, body); msg != "" {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", msg)
+		return
+	}
+
+	// Forward the request body to the upstream unchanged, unless the
+	// upstream needs roles rewritten.
+	if len(upstream.roles) > 0 {
+		if body, err = mapMessageRoles(body, upstream.roles); err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
+			return
+		}
+	}
+	if tier := serviceTier(r, upstream); tier != "" {
+		if body, err = setServiceTier(body, tier); err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON in request body")
+			return
+		}
+	}
+	// Whether the client streams decides if a compressed response can be
+	// asked for.
+	var headers http.Header
+	if upstream.compress {
+		_, stream, _ := extractModelAndStream(body)
+		headers = acceptCompressed(nil, upstream, stream)
+	}
 	overheadUS := int(time.Since(start).Microseconds())
-	upstreamResp, err := upstream.client.Do(r.Context(), r.Method, "/v1/chat/completions", upstreamReqBody, nil)
+	upstreamResp, err := upstream.client.Do(r.Context(), r.Method, "/v1/chat/completions", bytes.NewReader(body), headers)
 	if err != nil {
 		latency := time.Since(start)
-		h.logger.Log(&logging.LogEntry{
+		h.log(r, &logging.LogEntry{
 			KeyID:        keyID,
 			Timestamp:    start,
 			Method:       r.Method,
 			Path:         r.URL.Path,
 			Model:        model,
 			InputFormat:  "openai",
-			UpstreamID:  upstreamID,
+			UpstreamID:   upstreamID,
+			Region:       upstream.region,
 			StatusCode:   http.StatusBadGateway,
 			LatencyMS:    int(latency.Milliseconds()),
 			OverheadUS:   overheadUS,
 			ErrorMessage: "upstream connection error: " + err.Error(),
+			ErrorCode:    transportErrorCode(err),
 		})
 		writeOpenAIError(w, http.StatusBadGateway, "server_error", "Failed to connect to upstream")
 		return
 	}
 	defer upstreamResp.Body.Close()
+	stream := strings.Contains(upstreamResp.Header.Get("Content-Type"), "text/event-stream")
+	setGatewayHeaders(w, r, upstream.id, model, overheadUS, stream)
 
 	// Copy relevant upstream response headers.
 	for _, hdr := range []string{"Content-Type", "X-Request-Id"} {
@@ -347,21 +597,28 @@ func (h *Handler) HandleOpenAI(w http.ResponseWriter, r *http.Request) {
 	// Handle upstream errors: pass through as-is.
 	if upstreamResp.StatusCode >= 400 {
 		upstreamBody, _ := io.ReadAll(upstreamResp.Body)
+		perr := classifyProviderError(upstreamResp.StatusCode, upstreamBody)
 		latency := time.Since(start)
 
-		h.logger.Log(&logging.LogEntry{
+		h.log(r, &logging.LogEntry{
 			KeyID:        keyID,
 			Timestamp:    start,
 			Method:       r.Method,
 			Path:         r.URL.Path,
 			Model:        model,
 			InputFormat:  "openai",
-			UpstreamID:  upstreamID,
+			UpstreamID:   upstreamID,
+			Region:       upstream.region,
 			StatusCode:   upstreamResp.StatusCode,
 			LatencyMS:    int(latency.Milliseconds()),
 			OverheadUS:   overheadUS,
-			ErrorMessage: string(upstreamBody),
+			ErrorMessage: perr.logMessage(upstreamBody),
+			ErrorCode:    perr.errorCode(),
 		})
+		if perr != nil {
+			perr.writeOpenAI(w, upstreamResp.StatusCode)
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(upstreamResp.StatusCode)
@@ -370,7 +627,7 @@ func (h *Handler) HandleOpenAI(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Streaming passthrough.
-	if strings.Contains(upstreamResp.Header.Get("Content-Type"), "text/event-stream") {
+	if stream {
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
@@ -382,7 +639,9 @@ func (h *Handler) HandleOpenAI(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		streamResult := passthroughOpenAIChatStream(upstreamResp.Body, w, flusher, model)
+		body := upstream.watchStream(upstreamResp.Body)
+		streamResult := passthroughOpenAIChatStream(slogger.FromContext(r.Context()), body, w, flusher, model, upstream.maxSSEFrame)
+		body.Close()
 		if streamResult.Model != "" {
 			model = streamResult.Model
 		}
@@ -393,8 +652,9 @@ func (h *Handler) HandleOpenAI(w http.ResponseWriter, r *http.Request) {
 		}
 
 		latency := time.Since(start)
-		cost := h.billing.CalculateCost(model, inputTokens, streamResult.OutputTokens)
-		h.logger.Log(&logging.LogEntry{
+		cost := h.billing.CalculateCost(model, inputTokens, streamResult.OutputTokens, streamResult.ReasoningTokens)
+		setUsageHeaders(w, r, cost, inputTokens, streamResult.OutputTokens)
+		h.log(r, &logging.LogEntry{
 			KeyID:           keyID,
 			Timestamp:       start,
 			Method:          r.Method,
@@ -402,13 +662,19 @@ func (h *Handler) HandleOpenAI(w http.ResponseWriter, r *http.Request) {
 			Model:           model,
 			InputFormat:     "openai",
 			UpstreamID:      upstreamID,
+			Region:          upstream.region,
 			StatusCode:      http.StatusOK,
+			Stream:          true,
 			LatencyMS:       int(latency.Milliseconds()),
 			OverheadUS:      overheadUS,
 			InputTokens:     inputTokens,
 			OutputTokens:    streamResult.OutputTokens,
+			ReasoningTokens: streamResult.ReasoningTokens,
 			CacheReadTokens: cacheReadTokens,
+			ToolCalls:       streamResult.ToolCalls,
 			Cost:            cost,
+			ErrorMessage:    body.errorMessage(),
+			ErrorCode:       body.errorCode(),
 		})
 		return
 	}
@@ -422,7 +688,7 @@ func (h *Handler) HandleOpenAI(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var oaiResp translate.OpenAIResponse
-	var inputTokens, outputTokens, cacheReadTokens int
+	var inputTokens, outputTokens, reasoningTokens, cacheReadTokens int
 	if err := json.Unmarshal(upstreamBody, &oaiResp); err == nil {
 		if oaiResp.Model != "" {
 			model = oaiResp.Model
@@ -430,6 +696,7 @@ func (h *Handler) HandleOpenAI(w http.ResponseWriter, r *http.Request) {
 		if oaiResp.Usage != nil {
 			inputTokens = oaiResp.Usage.PromptTokens
 			outputTokens = oaiResp.Usage.CompletionTokens
+			reasoningTokens = translate.OpenAIReasoningTokens(oaiResp.Usage)
 			if oaiResp.Usage.PromptTokensDetails != nil {
 				cacheReadTokens = oaiResp.Usage.PromptTokensDetails.CachedTokens
 				inputTokens, cacheReadTokens = normalizeOpenAIInputAndCache(inputTokens, cacheReadTokens)
@@ -438,9 +705,10 @@ func (h *Handler) HandleOpenAI(w http.ResponseWriter, r *http.Request) {
 	}
 
 	latency := time.Since(start)
-	cost := h.billing.CalculateCost(model, inputTokens, outputTokens)
+	cost := h.billing.CalculateCost(model, inputTokens, outputTokens, reasoningTokens)
+	setUsageHeaders(w, r, cost, inputTokens, outputTokens)
 
-	h.logger.Log(&logging.LogEntry{
+	h.log(r, &logging.LogEntry{
 		KeyID:           keyID,
 		Timestamp:       start,
 		Method:          r.Method,
@@ -448,12 +716,15 @@ func (h *Handler) HandleOpenAI(w http.ResponseWriter, r *http.Request) {
 		Model:           model,
 		InputFormat:     "openai",
 		UpstreamID:      upstreamID,
+		Region:          upstream.region,
 		StatusCode:      upstreamResp.StatusCode,
 		LatencyMS:       int(latency.Milliseconds()),
 		OverheadUS:      overheadUS,
 		InputTokens:     inputTokens,
 		OutputTokens:    outputTokens,
+		ReasoningTokens: reasoningTokens,
 		CacheReadTokens: cacheReadTokens,
+		ToolCalls:       countToolCalls(&oaiResp),
 		Cost:            cost,
 	})
 
@@ -466,62 +737,92 @@ func (h *Handler) HandleOpenAI(w http.ResponseWriter, r *http.Request) {
 // sends it to the upstream, and translates the response back.
 func (h *Handler) handleOpenAIToAnthropic(w http.ResponseWriter, r *http.Request, upstream *upstreamInfo, openaiReq *translate.OpenAIRequest, keyID uuid.UUID, start time.Time) {
 	upstreamID := &upstream.id
+	span := startTranslate(r.Context(), "openai", "anthropic")
 	anthropicReq, err := translate.OpenAIRequestToAnthropic(openaiReq)
+	tracing.EndWithError(span, err)
 	if err != nil {
 		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Failed to translate request: "+err.Error())
 		return
 	}
+	h.metadataMap.ToAnthropic(openaiReq, anthropicReq)
+
+	// Tool schemas were rewritten to Anthropic's accepted subset; record what
+	// changed so a surprising tool call can be traced back to it.
+	var metadata map[string]interface{}
+	if len(anthropicReq.SchemaChanges) > 0 {
+		slogger.FromContext(r.Context()).Info("openai->anthropic: rewrote tool schemas", "changes", strings.Join(anthropicReq.SchemaChanges, "; "))
+		metadata = map[string]interface{}{"tool_schema_changes": anthropicReq.SchemaChanges}
+	}
 
 	anthropicBody, err := json.Marshal(anthropicReq)
+	if err == nil {
+		r, anthropicBody = injectCacheControl(r, anthropicBody)
+		if tier := serviceTier(r, upstream); tier != "" {
+			anthropicBody, err = setServiceTier(anthropicBody, tier)
+		}
+	}
 	if err != nil {
 		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "Failed to encode translated request")
 		return
 	}
 
-	extraHeaders := http.Header{
+	extraHeaders := withBetaHeader(http.Header{
 		"X-Api-Key":         {upstream.client.apiKey},
 		"Anthropic-Version": {"2023-06-01"},
-	}
+	}, upstreamBetas(nil, upstream.betas))
 
 	overheadUS := int(time.Since(start).Microseconds())
+	extraHeaders = acceptCompressed(extraHeaders, upstream, openaiReq.Stream)
 	upstreamResp, err := upstream.client.DoRaw(r.Context(), "POST", "/v1/messages", bytes.NewReader(anthropicBody), extraHeaders)
 	if err != nil {
 		latency := time.Since(start)
-		h.logger.Log(&logging.LogEntry{
-			KeyID:        keyID,
-			Timestamp:    start,
-			Method:       r.Method,
-			Path:         r.URL.Path,
-			Model:        openaiReq.Model,
-			InputFormat:  "openai",
-			UpstreamID:  upstreamID,
-			StatusCode:   http.StatusBadGateway,
-			LatencyMS:    int(latency.Milliseconds()),
-			OverheadUS:   overheadUS,
-			ErrorMessage: "upstream connection error: " + err.Error(),
+		h.log(r, &logging.LogEntry{
+			KeyID:           keyID,
+			Timestamp:       start,
+			Method:          r.Method,
+			Path:            r.URL.Path,
+			Model:           openaiReq.Model,
+			InputFormat:     "openai",
+			UpstreamID:      upstreamID,
+			Region:          upstream.region,
+			StatusCode:      http.StatusBadGateway,
+			LatencyMS:       int(latency.Milliseconds()),
+			OverheadUS:      overheadUS,
+			ErrorMessage:    "upstream connection error: " + err.Error(),
+			ErrorCode:       transportErrorCode(err),
+			RequestMetadata: metadata,
 		})
 		writeOpenAIError(w, http.StatusBadGateway, "server_error", "Failed to connect to upstream")
 		return
 	}
 	defer upstreamResp.Body.Close()
+	setGatewayHeaders(w, r, upstream.id, openaiReq.Model, overheadUS, openaiReq.Stream)
 
 	// Handle upstream errors: translate Anthropic error to OpenAI format.
 	if upstreamResp.StatusCode >= 400 {
 		upstreamBody, _ := io.ReadAll(upstreamResp.Body)
+		perr := classifyProviderError(upstreamResp.StatusCode, upstreamBody)
 		latency := time.Since(start)
-		h.logger.Log(&logging.LogEntry{
-			KeyID:        keyID,
-			Timestamp:    start,
-			Method:       r.Method,
-			Path:         r.URL.Path,
-			Model:        openaiReq.Model,
-			InputFormat:  "openai",
-			UpstreamID:  upstreamID,
-			StatusCode:   upstreamResp.StatusCode,
-			LatencyMS:    int(latency.Milliseconds()),
-			OverheadUS:   overheadUS,
-			ErrorMessage: string(upstreamBody),
+		h.log(r, &logging.LogEntry{
+			KeyID:           keyID,
+			Timestamp:       start,
+			Method:          r.Method,
+			Path:            r.URL.Path,
+			Model:           openaiReq.Model,
+			InputFormat:     "openai",
+			UpstreamID:      upstreamID,
+			Region:          upstream.region,
+			StatusCode:      upstreamResp.StatusCode,
+			LatencyMS:       int(latency.Milliseconds()),
+			OverheadUS:      overheadUS,
+			ErrorMessage:    perr.logMessage(upstreamBody),
+			ErrorCode:       perr.errorCode(),
+			RequestMetadata: metadata,
 		})
+		if perr != nil {
+			perr.writeOpenAI(w, upstreamResp.StatusCode)
+			return
+		}
 		oaiErr := translate.TranslateAnthropicErrorToOpenAI(upstreamResp.StatusCode, upstreamBody)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(upstreamResp.StatusCode)
@@ -541,18 +842,25 @@ func (h *Handler) handleOpenAIToAnthropic(w http.ResponseWriter, r *http.Request
 			return
 		}
 
-		result, _ := translate.TranslateAnthropicStreamToOpenAI(r.Context(), upstreamResp.Body, w, flusher, openaiReq.Model)
+		body := upstream.watchStream(upstreamResp.Body)
+		result, _ := translate.TranslateAnthropicStreamToOpenAI(r.Context(), body, w, flusher, openaiReq.Model, upstream.maxSSEFrame)
+		body.Close()
 
 		latency := time.Since(start)
-		var inputTokens, outputTokens, cacheCreationTokens, cacheReadTokens int
+		var inputTokens, outputTokens, reasoningTokens, cacheCreationTokens, cacheReadTokens, toolCalls, webSearches int
 		if result != nil {
 			inputTokens = result.InputTokens
 			outputTokens = result.OutputTokens
+			reasoningTokens = result.ReasoningTokens
 			cacheCreationTokens = result.CacheCreationTokens
 			cacheReadTokens = result.CacheReadTokens
+			toolCalls = result.ToolCalls
+			webSearches = result.WebSearchRequests
 		}
-		cost := h.billing.CalculateCost(openaiReq.Model, inputTokens, outputTokens)
-		h.logger.Log(&logging.LogEntry{
+		cost := h.billing.CalculateCost(openaiReq.Model, inputTokens, outputTokens, reasoningTokens) +
+			h.billing.WebSearchCost(openaiReq.Model, webSearches)
+		setUsageHeaders(w, r, cost, inputTokens, outputTokens)
+		h.log(r, &logging.LogEntry{
 			KeyID:               keyID,
 			Timestamp:           start,
 			Method:              r.Method,
@@ -560,14 +868,22 @@ func (h *Handler) handleOpenAIToAnthropic(w http.ResponseWriter, r *http.Request
 			Model:               openaiReq.Model,
 			InputFormat:         "openai",
 			UpstreamID:          upstreamID,
+			Region:              upstream.region,
 			StatusCode:          http.StatusOK,
+			Stream:              true,
 			LatencyMS:           int(latency.Milliseconds()),
 			OverheadUS:          overheadUS,
 			InputTokens:         inputTokens,
 			OutputTokens:        outputTokens,
+			ReasoningTokens:     reasoningTokens,
 			CacheCreationTokens: cacheCreationTokens,
 			CacheReadTokens:     cacheReadTokens,
+			ToolCalls:           toolCalls,
+			WebSearchRequests:   webSearches,
 			Cost:                cost,
+			ErrorMessage:        body.errorMessage(),
+			ErrorCode:           body.errorCode(),
+			RequestMetadata:     metadata,
 		})
 		return
 	}
@@ -588,25 +904,33 @@ func (h *Handler) handleOpenAIToAnthropic(w http.ResponseWriter, r *http.Request
 	oaiResp := translate.AnthropicResponseToOpenAI(&anthropicResp)
 	inputTokens := anthropicResp.Usage.InputTokens
 	outputTokens := anthropicResp.Usage.OutputTokens
+	reasoningTokens := anthropicResp.ThinkingTokens()
 	cacheReadTokens := anthropicResp.Usage.CacheReadInputTokens
+	webSearches := anthropicResp.Usage.ServerToolUse.WebSearches()
 
 	latency := time.Since(start)
-	cost := h.billing.CalculateCost(openaiReq.Model, inputTokens, outputTokens)
-	h.logger.Log(&logging.LogEntry{
-		KeyID:           keyID,
-		Timestamp:       start,
-		Method:          r.Method,
-		Path:            r.URL.Path,
-		Model:           openaiReq.Model,
-		InputFormat:     "openai",
-		UpstreamID:      upstreamID,
-		StatusCode:      http.StatusOK,
-		LatencyMS:       int(latency.Milliseconds()),
-		OverheadUS:      overheadUS,
-		InputTokens:     inputTokens,
-		OutputTokens:    outputTokens,
-		CacheReadTokens: cacheReadTokens,
-		Cost:            cost,
+	cost := h.billing.CalculateCost(openaiReq.Model, inputTokens, outputTokens, reasoningTokens) + h.billing.WebSearchCost(openaiReq.Model, webSearches)
+	setUsageHeaders(w, r, cost, inputTokens, outputTokens)
+	h.log(r, &logging.LogEntry{
+		KeyID:             keyID,
+		Timestamp:         start,
+		Method:            r.Method,
+		Path:              r.URL.Path,
+		Model:             openaiReq.Model,
+		InputFormat:       "openai",
+		UpstreamID:        upstreamID,
+		Region:            upstream.region,
+		StatusCode:        http.StatusOK,
+		LatencyMS:         int(latency.Milliseconds()),
+		OverheadUS:        overheadUS,
+		InputTokens:       inputTokens,
+		OutputTokens:      outputTokens,
+		ReasoningTokens:   reasoningTokens,
+		CacheReadTokens:   cacheReadTokens,
+		ToolCalls:         countToolUses(anthropicResp.Content),
+		WebSearchRequests: webSearches,
+		Cost:              cost,
+		RequestMetadata:   metadata,
 	})
 
 	w.Header().Set("Content-Type", "application/json")
@@ -627,3 +951,13 @@ func normalizeOpenAIInputAndCache(totalInputTokens, cacheReadTokens int) (int, i
 	}
 	return totalInputTokens - cacheReadTokens, cacheReadTokens
 }
+
+// countToolCalls returns the number of tool calls across all choices of an
+// OpenAI response.
+func countToolCalls(resp *translate.OpenAIResponse) int {
+	n := 0
+	for _, choice := range resp.Choices {
+		n += len(choice.Message.ToolCalls)
+	}
+	return n
+}
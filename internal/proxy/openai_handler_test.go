@@ -2,6 +2,8 @@ package proxy
 
 import (
 	"testing"
+
+	"github.com/sertdev/pxbin/pkg/translate"
 )
 
 func TestNormalizeOpenAIInputAndCache(t *testing.T) {
@@ -15,3 +17,16 @@ func TestNormalizeOpenAIInputAndCache(t *testing.T) {
 		t.Fatalf("expected clamped tokens (0,5), got (%d,%d)", input, cache)
 	}
 }
+
+func TestCountToolCalls(t *testing.T) {
+	resp := &translate.OpenAIResponse{
+		Choices: []translate.OpenAIChoice{
+			{Message: translate.OpenAIMessage{ToolCalls: []translate.OpenAIToolCall{{ID: "a"}, {ID: "b"}}}},
+			{Message: translate.OpenAIMessage{Content: "no tools"}},
+			{Message: translate.OpenAIMessage{ToolCalls: []translate.OpenAIToolCall{{ID: "c"}}}},
+		},
+	}
+	if got := countToolCalls(resp); got != 3 {
+		t.Fatalf("countToolCalls = %d, want 3", got)
+	}
+}
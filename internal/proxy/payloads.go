@@ -0,0 +1,221 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/logging"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// PayloadCaptureOpts configures which request and response bodies are stored
+// with the request log.
+type PayloadCaptureOpts struct {
+	All      bool // capture every key, not only keys with capture_payloads
+	MaxBytes int  // bytes kept of each body; 0 disables capture
+	Redact   bool // mask secrets and email addresses before storing
+}
+
+// SetPayloadCapture sets which request and response bodies are captured.
+func (h *Handler) SetPayloadCapture(opts PayloadCaptureOpts) {
+	h.payloads = opts
+}
+
+// redactPatterns match secrets and personal data masked in captured bodies:
+// OpenAI and Anthropic keys, pxbin keys, Google API keys, bearer tokens and
+// email addresses.
+var redactPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`sk-[A-Za-z0-9_\-]{8,}`),
+	regexp.MustCompile(`px[bm]_[0-9a-f]{8,}`),
+	regexp.MustCompile(`AIza[0-9A-Za-z_\-]{8,}`),
+	regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/\-]+=*`),
+	regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+}
+
+const redacted = "[REDACTED]"
+
+func redactPayload(s string) string {
+	for _, re := range redactPatterns {
+		s = re.ReplaceAllString(s, redacted)
+	}
+	return s
+}
+
+// cappedBuffer keeps the first max bytes written to it and counts the rest.
+type cappedBuffer struct {
+	buf   []byte
+	max   int
+	total int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.total += len(p)
+	if room := b.max - len(b.buf); room > 0 {
+		b.buf = append(b.buf, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// upTo returns the first n bytes kept.
+func (b *cappedBuffer) upTo(n int) []byte {
+	return b.buf[:min(n, len(b.buf))]
+}
+
+// payloadCapture collects the bodies of one request. The log entries the
+// request produces are held back until the response is complete, so the
+// payload can be stored with the last of them.
+type payloadCapture struct {
+	mu       sync.Mutex
+	request  cappedBuffer
+	response cappedBuffer
+	held     []*logging.LogEntry
+	done     bool
+}
+
+type payloadCaptureKey struct{}
+
+// hold keeps e until the response is complete. It returns false once the
+// response is complete, when e has to be logged directly.
+func (c *payloadCapture) hold(e *logging.LogEntry) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		return false
+	}
+	c.held = append(c.held, e)
+	return true
+}
+
+func (c *payloadCapture) writeRequest(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.request.Write(p)
+}
+
+func (c *payloadCapture) writeResponse(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.response.Write(p)
+}
+
+// finish returns the held entries. Nothing is held after it.
+func (c *payloadCapture) finish() []*logging.LogEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done = true
+	return c.held
+}
+
+// payload returns the captured bodies, cut off after maxBytes.
+func (c *payloadCapture) payload(maxBytes int, redact bool) *store.LogPayload {
+	p := &store.LogPayload{
+		Request:       payloadText(c.request.upTo(maxBytes)),
+		Response:      payloadText(c.response.upTo(maxBytes)),
+		RequestBytes:  c.request.total,
+		ResponseBytes: c.response.total,
+		Redacted:      redact,
+	}
+	if redact {
+		p.Request, p.Response = redactPayload(p.Request), redactPayload(p.Response)
+	}
+	return p
+}
+
+// payloadText makes a captured body storable as text: a body cut short may
+// end inside a UTF-8 sequence, and PostgreSQL rejects NUL characters.
+func payloadText(b []byte) string {
+	return strings.ReplaceAll(strings.ToValidUTF8(string(b), ""), "\x00", "")
+}
+
+// heldLog holds e back for the request's payload if its bodies are being
+// captured. It returns false if e should be logged now.
+func heldLog(ctx context.Context, e *logging.LogEntry) bool {
+	c, _ := ctx.Value(payloadCaptureKey{}).(*payloadCapture)
+	return c != nil && c.hold(e)
+}
+
+// CapturePayloads is a middleware that records the request and response
+// bodies of keys with capture_payloads set, or of every key with All, and
+// stores them with the request's log entry. Each body is truncated to
+// MaxBytes; the response is recorded as the client received it. The
+// bodies of requests that may be sampled for a quality audit are captured
+// too, and stored as an audit sample if the request is picked once its
+// model is known.
+func (h *Handler) CapturePayloads(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := auth.GetKeyFromContext(r.Context())
+		payload := h.payloads.MaxBytes > 0 && (h.payloads.All || key != nil && key.CapturePayloads)
+		audit := key != nil && h.audit.mayCapture(key.ID)
+		if !payload && !audit {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limit := 0
+		if payload {
+			limit = h.payloads.MaxBytes
+		}
+		if audit {
+			limit = max(limit, h.audit.opts.MaxBytes)
+		}
+		c := &payloadCapture{
+			request:  cappedBuffer{max: limit},
+			response: cappedBuffer{max: limit},
+		}
+		if r.Body != nil {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(r.Body, writerFunc(c.writeRequest)), r.Body}
+		}
+		pw := &payloadWriter{ResponseWriter: w, c: c}
+		next.ServeHTTP(pw, r.WithContext(context.WithValue(r.Context(), payloadCaptureKey{}, c)))
+
+		held := c.finish()
+		if len(held) == 0 {
+			return
+		}
+		last := held[len(held)-1]
+		if payload {
+			last.Payload = c.payload(h.payloads.MaxBytes, h.payloads.Redact)
+		}
+		if audit {
+			last.AuditSample = h.audit.sample(last, &c.request, &c.response)
+		}
+		for _, e := range held {
+			h.logger.Log(e)
+		}
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+// payloadWriter copies the response body into a payloadCapture.
+type payloadWriter struct {
+	http.ResponseWriter
+	c *payloadCapture
+}
+
+func (w *payloadWriter) Write(p []byte) (int, error) {
+	w.c.writeResponse(p)
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher.
+func (w *payloadWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *payloadWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// Pins sends the requests of pinned keys to their pinned upstream instead
+// of the one linked to the requested model. Pins are reloaded from the
+// store every interval, and on Reload after a change through the
+// management API.
+type Pins struct {
+	store    store.Store
+	interval time.Duration
+	set      atomic.Pointer[pinSet]
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type pinSet struct {
+	all   *activePin // pin for every key; nil for none
+	byKey map[uuid.UUID]*activePin
+}
+
+// activePin is a pin with the configuration of its upstream.
+type activePin struct {
+	expiresAt time.Time
+	upstream  store.Upstream
+}
+
+// NewPins loads the pins and reloads them every interval. Call Close to
+// stop it.
+func NewPins(s store.Store, interval time.Duration) *Pins {
+	p := &Pins{
+		store:    s,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	p.set.Store(&pinSet{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := p.Reload(ctx); err != nil {
+		log.Printf("pins: initial load failed: %v", err)
+	}
+	cancel()
+
+	p.wg.Add(1)
+	go p.worker()
+	return p
+}
+
+func (p *Pins) Close() {
+	close(p.done)
+	p.wg.Wait()
+}
+
+func (p *Pins) worker() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := p.Reload(ctx); err != nil {
+				log.Printf("pins: reload failed: %v", err)
+			}
+			cancel()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Reload replaces the pins with those in the store. Pins to an inactive
+// upstream are ignored.
+func (p *Pins) Reload(ctx context.Context) error {
+	pins, err := p.store.ListUpstreamPins(ctx)
+	if err != nil {
+		return err
+	}
+	set := &pinSet{byKey: make(map[uuid.UUID]*activePin)}
+	if len(pins) == 0 {
+		p.set.Store(set)
+		return nil
+	}
+	upstreams, err := p.store.ListUpstreams(ctx)
+	if err != nil {
+		return err
+	}
+	byID := make(map[uuid.UUID]store.Upstream, len(upstreams))
+	for _, u := range upstreams {
+		if u.IsActive {
+			byID[u.ID] = u
+		}
+	}
+	for _, pin := range pins {
+		u, ok := byID[pin.UpstreamID]
+		if !ok {
+			continue
+		}
+		ap := &activePin{expiresAt: pin.ExpiresAt, upstream: u}
+		if pin.KeyID == nil {
+			set.all = ap
+		} else {
+			set.byKey[*pin.KeyID] = ap
+		}
+	}
+	p.set.Store(set)
+	return nil
+}
+
+// lookup returns the pin that applies to a key at now: its own, else the
+// pin for every key.
+func (p *Pins) lookup(keyID uuid.UUID, now time.Time) *activePin {
+	set := p.set.Load()
+	if ap := set.byKey[keyID]; ap != nil && now.Before(ap.expiresAt) {
+		return ap
+	}
+	if set.all != nil && now.Before(set.all.expiresAt) {
+		return set.all
+	}
+	return nil
+}
+
+// apply returns a copy of mw served by the pinned upstream.
+func (ap *activePin) apply(mw *store.ModelWithUpstream) *store.ModelWithUpstream {
+	return servedBy(mw, &ap.upstream)
+}
+
+// servedBy returns a copy of mw served by u, whose API key the store has
+// already decrypted.
+func servedBy(mw *store.ModelWithUpstream, u *store.Upstream) *store.ModelWithUpstream {
+	out := *mw
+	out.UpstreamID = &u.ID
+	out.UpstreamBaseURL = u.BaseURL
+	out.UpstreamAPIKey = u.APIKeyEncrypted
+	out.UpstreamFormat = u.Format
+	out.UpstreamAvailability = u.Availability
+	out.UpstreamRegion = upstreamRegion(u)
+	out.UpstreamRoleMap = u.RoleMap
+	out.UpstreamServiceTiers = u.ServiceTiers
+	out.UpstreamMaxSSEFrameBytes = u.MaxSSEFrameBytes
+	out.UpstreamStreamIdleTimeoutSeconds = u.StreamIdleTimeoutSeconds
+	out.UpstreamDisableCompression = u.DisableCompression
+	out.UpstreamExtension = u.Extension
+	out.UpstreamAnthropicBetas = u.AnthropicBetas
+	out.UpstreamResilience = u.Resilience
+	return &out
+}
+
+// SetPins routes pinned keys' requests to their pinned upstream.
+func (h *Handler) SetPins(p *Pins) {
+	h.pins = p
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestPinsLookupAndApply(t *testing.T) {
+	keyID, otherKey := uuid.New(), uuid.New()
+	now := time.Now()
+	region := "eu"
+	pinned := store.Upstream{ID: uuid.New(), BaseURL: "https://pinned.example", APIKeyEncrypted: "sk-pinned", Format: "anthropic", Region: &region}
+	fallback := store.Upstream{ID: uuid.New(), BaseURL: "https://all.example", Format: "openai"}
+
+	p := &Pins{}
+	p.set.Store(&pinSet{
+		all:   &activePin{expiresAt: now.Add(time.Hour), upstream: fallback},
+		byKey: map[uuid.UUID]*activePin{keyID: {expiresAt: now.Add(time.Minute), upstream: pinned}},
+	})
+
+	if got := p.lookup(keyID, now); got == nil || got.upstream.ID != pinned.ID {
+		t.Fatalf("key pin not used: %+v", got)
+	}
+	if got := p.lookup(otherKey, now); got == nil || got.upstream.ID != fallback.ID {
+		t.Fatalf("pin for every key not used: %+v", got)
+	}
+	// Once the key's pin expires, the pin for every key applies.
+	if got := p.lookup(keyID, now.Add(2*time.Minute)); got == nil || got.upstream.ID != fallback.ID {
+		t.Fatalf("expired key pin still used: %+v", got)
+	}
+	if got := p.lookup(keyID, now.Add(2*time.Hour)); got != nil {
+		t.Fatalf("expired pins still used: %+v", got)
+	}
+
+	linked := uuid.New()
+	mw := &store.ModelWithUpstream{Model: store.Model{Name: "gpt-test", UpstreamID: &linked}, UpstreamBaseURL: "https://linked.example", UpstreamFormat: "openai"}
+	got := p.lookup(keyID, now).apply(mw)
+	if *got.UpstreamID != pinned.ID || got.UpstreamBaseURL != pinned.BaseURL || got.UpstreamAPIKey != "sk-pinned" || got.UpstreamFormat != "anthropic" || got.UpstreamRegion != "eu" || got.Name != "gpt-test" {
+		t.Fatalf("unexpected pinned model %+v", got)
+	}
+	if *mw.UpstreamID != linked || mw.UpstreamBaseURL != "https://linked.example" {
+		t.Fatal("apply modified the cached model")
+	}
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	json "github.com/bytedance/sonic"
+
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/logging"
+	"github.com/sertdev/pxbin/internal/policy"
+)
+
+// SetPolicyEngine enables admission policies. When unset, every request is
+// admitted unchanged.
+func (h *Handler) SetPolicyEngine(e *policy.Engine) {
+	h.policy = e
+}
+
+// admit evaluates admission policies for a request. bodySize is used for a
+// rough input token estimate (~4 bytes per token) since the proxy does not
+// tokenize.
+func (h *Handler) admit(r *http.Request, model, format string, bodySize int64) policy.Decision {
+	if h.policy == nil {
+		return policy.Decision{}
+	}
+	in := policy.Input{
+		Model:   model,
+		Headers: r.Header,
+		Path:    r.URL.Path,
+		Format:  format,
+		Now:     time.Now(),
+	}
+	if t := requestLogTags(r); t.inputFormat != "" {
+		in.Format = t.inputFormat
+	}
+	if bodySize > 0 {
+		in.InputTokens = int(bodySize / 4)
+	}
+	if key := auth.GetKeyFromContext(r.Context()); key != nil {
+		in.KeyID = key.ID.String()
+		in.KeyName = key.Name
+	}
+	return h.policy.Evaluate(in)
+}
+
+// logDenied records a request rejected by a deny policy.
+func (h *Handler) logDenied(r *http.Request, d policy.Decision, model, inputFormat string, start time.Time) {
+	h.logRejected(r, model, inputFormat, http.StatusForbidden, "denied by policy "+d.Policy, start)
+}
+
+// logFiltered records a request answered with a content-filtered response
+// by a filter policy.
+func (h *Handler) logFiltered(r *http.Request, d policy.Decision, model, inputFormat string, start time.Time) {
+	h.log(r, &logging.LogEntry{
+		KeyID:        auth.GetKeyIDFromContext(r.Context()),
+		Timestamp:    start,
+		Method:       r.Method,
+		Path:         r.URL.Path,
+		Model:        model,
+		InputFormat:  inputFormat,
+		StatusCode:   http.StatusOK,
+		LatencyMS:    int(time.Since(start).Milliseconds()),
+		ErrorMessage: "filtered by policy " + d.Policy,
+		ErrorCode:    "policy_filter",
+	})
+}
+
+// logRejected records a request refused before it reached an upstream.
+func (h *Handler) logRejected(r *http.Request, model, inputFormat string, status int, msg string, start time.Time) {
+	h.log(r, &logging.LogEntry{
+		KeyID:        auth.GetKeyIDFromContext(r.Context()),
+		Timestamp:    start,
+		Method:       r.Method,
+		Path:         r.URL.Path,
+		Model:        model,
+		InputFormat:  inputFormat,
+		StatusCode:   status,
+		LatencyMS:    int(time.Since(start).Milliseconds()),
+		ErrorMessage: msg,
+	})
+}
+
+// applyDecision rewrites a JSON request body for route and cap decisions.
+// maxFields lists the token limit fields in order of preference; an existing
+// field is lowered to the cap, otherwise the first field is set.
+func applyDecision(body []byte, d policy.Decision, maxFields ...string) ([]byte, error) {
+	if d.Model == "" && d.MaxTokens == 0 {
+		return body, nil
+	}
+	var req map[string]any
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	if d.Model != "" {
+		req["model"] = d.Model
+	}
+	if d.MaxTokens > 0 && len(maxFields) > 0 {
+		capped := false
+		for _, f := range maxFields {
+			v, ok := req[f]
+			if !ok || v == nil {
+				continue
+			}
+			if n, ok := v.(float64); !ok || int(n) > d.MaxTokens {
+				req[f] = d.MaxTokens
+			}
+			capped = true
+		}
+		if !capped {
+			req[maxFields[0]] = d.MaxTokens
+		}
+	}
+	return json.Marshal(req)
+}
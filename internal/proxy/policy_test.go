@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/policy"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestApplyDecision(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		d         policy.Decision
+		maxFields []string
+		want      string
+	}{
+		{"no change", `{"model":"a","max_tokens":9000}`, policy.Decision{}, []string{"max_tokens"}, `{"model":"a","max_tokens":9000}`},
+		{"route", `{"model":"a"}`, policy.Decision{Model: "b"}, nil, `{"model":"b"}`},
+		{"cap lowers", `{"model":"a","max_tokens":9000}`, policy.Decision{MaxTokens: 100}, []string{"max_tokens"}, `{"max_tokens":100,"model":"a"}`},
+		{"cap keeps lower", `{"model":"a","max_tokens":50}`, policy.Decision{MaxTokens: 100}, []string{"max_tokens"}, `{"max_tokens":50,"model":"a"}`},
+		{"cap sets first field", `{"model":"a"}`, policy.Decision{MaxTokens: 100}, []string{"max_completion_tokens", "max_tokens"}, `{"max_completion_tokens":100,"model":"a"}`},
+		{"cap lowers every present field", `{"max_tokens":9000,"max_completion_tokens":8000}`, policy.Decision{MaxTokens: 100}, []string{"max_completion_tokens", "max_tokens"}, `{"max_completion_tokens":100,"max_tokens":100}`},
+		{"cap ignores null", `{"max_tokens":null}`, policy.Decision{MaxTokens: 100}, []string{"max_output_tokens", "max_tokens"}, `{"max_output_tokens":100,"max_tokens":null}`},
+		{"cap replaces non-numbers", `{"max_tokens":"lots"}`, policy.Decision{MaxTokens: 100}, []string{"max_tokens"}, `{"max_tokens":100}`},
+		{"cap without fields", `{"model":"a"}`, policy.Decision{MaxTokens: 100}, nil, `{"model":"a"}`},
+		{"route and cap", `{"model":"a","max_tokens":9000}`, policy.Decision{Model: "b", MaxTokens: 100}, []string{"max_tokens"}, `{"max_tokens":100,"model":"b"}`},
+	}
+	for _, tt := range tests {
+		got, err := applyDecision([]byte(tt.body), tt.d, tt.maxFields...)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := applyDecision([]byte(`{"model":`), policy.Decision{Model: "b"}); err == nil {
+		t.Error("expected an error for an invalid body")
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	maxTokens := 300
+	target := "gpt-small"
+	for _, pc := range []store.PolicyCreate{
+		{Name: "deny-admin", Expression: `headers["x-role"] == "admin" && path == "/v1/chat/completions"`, Action: policy.ActionDeny, Priority: 30},
+		{Name: "filter-gemini", Expression: `format == "gemini"`, Action: policy.ActionFilter, Priority: 20},
+		{Name: "route-large", Expression: `input_tokens >= 250`, Action: policy.ActionRoute, TargetModel: &target, Priority: 10},
+		{Name: "cap-gpt", Expression: `model.startsWith("gpt-")`, Action: policy.ActionCap, MaxTokens: &maxTokens},
+	} {
+		if _, err := st.CreatePolicy(ctx, &pc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine := policy.NewEngine(st, time.Hour)
+	defer engine.Close()
+	h := &Handler{}
+
+	r := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	if d := h.admit(r, "gpt-4o", "openai", 4000); d != (policy.Decision{}) {
+		t.Fatalf("expected every request admitted without an engine, got %+v", d)
+	}
+	h.SetPolicyEngine(engine)
+
+	tests := []struct {
+		name     string
+		path     string
+		role     string
+		model    string
+		format   string
+		bodySize int64
+		want     policy.Decision
+	}{
+		{"deny", "/v1/chat/completions", "admin", "gpt-4o", "openai", 10, policy.Decision{Denied: true, Policy: "deny-admin", Message: "Request denied by policy deny-admin"}},
+		{"deny checks path", "/v1/messages", "admin", "claude", "anthropic", 10, policy.Decision{}},
+		{"filter", "/v1beta/models/gpt-4o:generateContent", "", "gpt-4o", "gemini", 10, policy.Decision{Filtered: true, Policy: "filter-gemini"}},
+		{"route on input tokens", "/v1/messages", "", "claude", "anthropic", 1000, policy.Decision{Model: "gpt-small"}},
+		{"below route threshold", "/v1/messages", "", "claude", "anthropic", 999, policy.Decision{}},
+		{"unknown size", "/v1/messages", "", "claude", "anthropic", -1, policy.Decision{}},
+		{"cap", "/v1/chat/completions", "", "gpt-4o", "openai", 10, policy.Decision{MaxTokens: 300}},
+		{"route and cap", "/v1/chat/completions", "", "gpt-4o", "openai", 4000, policy.Decision{Model: "gpt-small", MaxTokens: 300}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", tt.path, strings.NewReader("{}"))
+		if tt.role != "" {
+			r.Header.Set("X-Role", tt.role)
+		}
+		if got := h.admit(r, tt.model, tt.format, tt.bodySize); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	// The translated input format takes precedence over the endpoint's.
+	r = withLogTags(httptest.NewRequest("POST", "/v1/chat/completions", nil), logTags{inputFormat: "gemini"})
+	if d := h.admit(r, "gpt-4o", "openai", 10); !d.Filtered {
+		t.Fatalf("expected the gemini filter to apply, got %+v", d)
+	}
+}
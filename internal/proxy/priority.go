@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	json "github.com/bytedance/sonic"
+
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// priorityHeader lets clients ask for a request priority: low, normal or
+// high.
+const priorityHeader = "X-Pxbin-Priority"
+
+const invalidPriorityMessage = "x-pxbin-priority must be low, normal or high"
+
+// requestPriority returns the priority a request is served at: the one the
+// client asked for (normal when it did not), capped at its key's
+// max_priority. ok is false when the header holds an unknown priority.
+func requestPriority(r *http.Request) (string, bool) {
+	priority := store.PriorityNormal
+	if v := r.Header.Get(priorityHeader); v != "" {
+		priority = strings.ToLower(strings.TrimSpace(v))
+		if store.PriorityRank(priority) == 0 {
+			return "", false
+		}
+	}
+	limit := store.PriorityNormal
+	if key := auth.GetKeyFromContext(r.Context()); key != nil && store.PriorityRank(key.MaxPriority) != 0 {
+		limit = key.MaxPriority
+	}
+	if store.PriorityRank(priority) > store.PriorityRank(limit) {
+		priority = limit
+	}
+	return priority, true
+}
+
+// withPriority records the request's effective priority for its log
+// entries and gateway headers.
+func withPriority(r *http.Request, priority string) *http.Request {
+	t := requestLogTags(r)
+	t.priority = priority
+	return withLogTags(r, t)
+}
+
+// serviceTier returns the service_tier the upstream maps the request's
+// priority to, or "" to leave the request's own service_tier alone.
+func serviceTier(r *http.Request, upstream *upstreamInfo) string {
+	return upstream.serviceTiers[requestLogTags(r).priority]
+}
+
+// setServiceTier sets the request body's service_tier.
+func setServiceTier(body []byte, tier string) ([]byte, error) {
+	var req map[string]any
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	req["service_tier"] = tier
+	return json.Marshal(req)
+}
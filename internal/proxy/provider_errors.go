@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	json "github.com/bytedance/sonic"
+
+	"github.com/sertdev/pxbin/pkg/translate"
+)
+
+// providerError is an upstream error response recognized as the provider
+// refusing the request under one of its policies, rather than a bad request
+// or bad upstream credentials. Providers send these as opaque 400 or 403
+// bodies that look like authentication failures.
+type providerError struct {
+	code    string // logged as the error code, and sent to OpenAI clients
+	message string // sent to the client
+	hint    string // what the operator can do about it, logged
+	errType string // Anthropic error type
+}
+
+var (
+	providerRegionUnsupported = &providerError{
+		code:    "provider_region_unsupported",
+		message: "The upstream provider does not serve the region this request was sent from",
+		hint:    "the provider refuses requests from this upstream's egress region; serve the model from an upstream in a supported region",
+		errType: "permission_error",
+	}
+	providerContentPolicy = &providerError{
+		code:    "provider_content_policy",
+		message: "The upstream provider's content policy rejected the request",
+		hint:    "the provider's own moderation refused the request; this is not a pxbin policy or a key problem",
+		errType: "invalid_request_error",
+	}
+	providerAccountRestricted = &providerError{
+		code:    "provider_account_restricted",
+		message: "The upstream provider has restricted the account serving this model",
+		hint:    "the provider restricted this upstream's account; check its organization status and verification in the provider's console",
+		errType: "permission_error",
+	}
+)
+
+// classifyProviderError recognizes the provider policy errors in an upstream
+// error body in OpenAI, Anthropic or Gemini format, and returns nil for any
+// other error.
+func classifyProviderError(status int, body []byte) *providerError {
+	var resp struct {
+		Error struct {
+			Type    string `json:"type"`
+			Code    any    `json:"code"` // a string from OpenAI, the HTTP status from Gemini
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return nil
+	}
+	code, _ := resp.Error.Code.(string)
+	msg := strings.ToLower(resp.Error.Message)
+	switch {
+	case code == "unsupported_country_region_territory",
+		strings.Contains(msg, "user location is not supported"),
+		status == http.StatusForbidden && resp.Error.Type == "forbidden" && msg == "request not allowed":
+		return providerRegionUnsupported
+	case code == "content_policy_violation", code == "content_filter",
+		code == "invalid_prompt" && strings.Contains(msg, "usage policy"),
+		strings.Contains(msg, "content filtering policy"):
+		return providerContentPolicy
+	case strings.Contains(msg, "organization must be verified"),
+		strings.Contains(msg, "organization has been disabled"):
+		return providerAccountRestricted
+	}
+	return nil
+}
+
+// errorCode returns the error code logged for the upstream error, "" for
+// errors that are not provider policy errors.
+func (p *providerError) errorCode() string {
+	if p == nil {
+		return ""
+	}
+	return p.code
+}
+
+// logMessage returns the error message logged for the upstream error body,
+// led by the remediation hint for a provider policy error.
+func (p *providerError) logMessage(body []byte) string {
+	if p == nil {
+		return string(body)
+	}
+	return p.hint + ": " + string(body)
+}
+
+// writeOpenAI responds with the error in OpenAI's format, with its code.
+func (p *providerError) writeOpenAI(w http.ResponseWriter, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	b, _ := json.Marshal(translate.OpenAIErrorResponse{
+		Error: translate.OpenAIError{
+			Message: p.message,
+			Type:    "invalid_request_error",
+			Code:    &p.code,
+		},
+	})
+	w.Write(b)
+}
+
+// writeAnthropic responds with the error in Anthropic's format.
+func (p *providerError) writeAnthropic(w http.ResponseWriter, statusCode int) {
+	writeAnthropicError(w, statusCode, p.errType, p.message)
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClassifyProviderError(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		status int
+		body   string
+		want   *providerError
+	}{
+		{"openai region", 403, `{"error":{"code":"unsupported_country_region_territory","message":"Country, region, or territory not supported","param":null,"type":"request_forbidden"}}`, providerRegionUnsupported},
+		{"gemini region", 400, `{"error":{"code":400,"message":"User location is not supported for the API use.","status":"FAILED_PRECONDITION"}}`, providerRegionUnsupported},
+		{"anthropic region", 403, `{"type":"error","error":{"type":"forbidden","message":"Request not allowed"}}`, providerRegionUnsupported},
+		{"openai moderation", 400, `{"error":{"code":"invalid_prompt","message":"Invalid prompt: your prompt was flagged as potentially violating our usage policy.","type":"invalid_request_error"}}`, providerContentPolicy},
+		{"azure content filter", 400, `{"error":{"code":"content_filter","message":"The response was filtered","status":400}}`, providerContentPolicy},
+		{"anthropic output blocked", 400, `{"type":"error","error":{"type":"invalid_request_error","message":"Output blocked by content filtering policy"}}`, providerContentPolicy},
+		{"openai verification", 400, `{"error":{"code":"unsupported_value","message":"Your organization must be verified to stream this model.","type":"invalid_request_error"}}`, providerAccountRestricted},
+		{"anthropic auth", 401, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`, nil},
+		{"anthropic permission", 403, `{"type":"error","error":{"type":"permission_error","message":"Your API key does not have permission to use the specified resource."}}`, nil},
+		{"openai invalid prompt", 400, `{"error":{"code":"invalid_prompt","message":"Invalid prompt: too many images","type":"invalid_request_error"}}`, nil},
+		{"not json", 403, `Forbidden`, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyProviderError(tt.status, []byte(tt.body)); got != tt.want {
+				t.Fatalf("got %v, want %v", got.errorCode(), tt.want.errorCode())
+			}
+		})
+	}
+}
+
+func TestProviderErrorResponse(t *testing.T) {
+	body := []byte(`{"error":{"code":"unsupported_country_region_territory","message":"Country, region, or territory not supported"}}`)
+	perr := classifyProviderError(http.StatusForbidden, body)
+	if msg := perr.logMessage(body); !strings.HasPrefix(msg, perr.hint) || !strings.HasSuffix(msg, string(body)) {
+		t.Fatalf("log message = %q, want the hint and the upstream body", msg)
+	}
+
+	w := httptest.NewRecorder()
+	perr.writeOpenAI(w, http.StatusForbidden)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"code":"provider_region_unsupported"`) {
+		t.Fatalf("openai response %d %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	perr.writeAnthropic(w, http.StatusForbidden)
+	if !strings.Contains(w.Body.String(), `"type":"permission_error"`) {
+		t.Fatalf("anthropic response %s", w.Body)
+	}
+
+	var unknown *providerError
+	if unknown.errorCode() != "" || unknown.logMessage(body) != string(body) {
+		t.Fatal("expected other errors to be logged as-is")
+	}
+}
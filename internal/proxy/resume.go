@@ -0,0 +1,352 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sertdev/pxbin/internal/auth"
+)
+
+// streamIDHeader carries the ID a resumable stream's events are buffered
+// under.
+const streamIDHeader = "X-Pxbin-Stream-Id"
+
+// maxResumeBytes bounds the events buffered per stream. Older events are
+// dropped first; a client that missed more than this has to start over.
+const maxResumeBytes = 8 << 20
+
+// StreamResumer is an experimental middleware that lets clients resume
+// interrupted SSE responses. Every event of a stream is tagged with an id:
+// and kept in memory for a TTL after the stream ends. A client that lost
+// its connection re-sends the request with a Last-Event-ID header and gets
+// the events it missed, followed by the rest of the stream, instead of
+// running the generation again.
+//
+// The generation outlives a dropped connection by up to the TTL, so a
+// client has time to reconnect; it is cancelled if no one has by then.
+type StreamResumer struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	streams map[string]*resumableStream
+}
+
+// NewStreamResumer creates a StreamResumer keeping finished streams for ttl.
+func NewStreamResumer(ttl time.Duration) *StreamResumer {
+	return &StreamResumer{ttl: ttl, streams: make(map[string]*resumableStream)}
+}
+
+// resumableStream holds the buffered events of one response.
+type resumableStream struct {
+	keyID uuid.UUID
+
+	mu      sync.Mutex
+	first   int      // sequence number of events[0]
+	events  [][]byte // complete events, id: line included
+	size    int
+	done    bool
+	doneAt  time.Time
+	changed chan struct{} // closed and replaced on every append
+
+	followers atomic.Int32
+}
+
+// Middleware serves resumptions and records resumable streams.
+func (s *StreamResumer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if id, seq, ok := parseEventID(r.Header.Get("Last-Event-ID")); ok {
+			s.resume(w, r, id, seq)
+			return
+		}
+
+		rw := &resumeWriter{ResponseWriter: w, resumer: s, keyID: auth.GetKeyIDFromContext(r.Context())}
+		ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+		defer cancel()
+		stop := context.AfterFunc(r.Context(), func() {
+			rw.gone.Store(true)
+			st := rw.stream.Load()
+			if st == nil {
+				cancel()
+				return
+			}
+			time.AfterFunc(s.ttl, func() {
+				if st.followers.Load() == 0 {
+					cancel()
+				}
+			})
+		})
+		defer stop()
+
+		next.ServeHTTP(rw, r.WithContext(ctx))
+		rw.finish()
+	})
+}
+
+// resume replays a stream's events after seq and follows it to its end.
+func (s *StreamResumer) resume(w http.ResponseWriter, r *http.Request, id string, seq int) {
+	s.mu.Lock()
+	st := s.streams[id]
+	s.mu.Unlock()
+	if st == nil || st.keyID != auth.GetKeyIDFromContext(r.Context()) {
+		writeResumeError(w, r, http.StatusNotFound, "The stream is no longer available to resume; send the request without Last-Event-ID")
+		return
+	}
+	st.followers.Add(1)
+	defer st.followers.Add(-1)
+
+	st.mu.Lock()
+	missing := seq+1 < st.first
+	st.mu.Unlock()
+	if missing {
+		writeResumeError(w, r, http.StatusConflict, "Events after the given Last-Event-ID are no longer buffered; send the request without Last-Event-ID")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set(streamIDHeader, id)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	for {
+		events, next, done, changed := st.since(seq)
+		for _, ev := range events {
+			if _, err := w.Write(ev); err != nil {
+				return
+			}
+		}
+		if flusher != nil && len(events) > 0 {
+			flusher.Flush()
+		}
+		if done {
+			return
+		}
+		seq = next
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// since returns the events after seq, the sequence number of the last one
+// returned, whether the stream has ended and a channel closed on the next
+// append.
+func (st *resumableStream) since(seq int) ([][]byte, int, bool, <-chan struct{}) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	start := max(seq+1-st.first, 0)
+	var events [][]byte
+	if start < len(st.events) {
+		events = append(events, st.events[start:]...)
+	}
+	return events, st.first + len(st.events) - 1, st.done, st.changed
+}
+
+func (st *resumableStream) append(ev []byte) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.events = append(st.events, ev)
+	st.size += len(ev)
+	for st.size > maxResumeBytes && len(st.events) > 1 {
+		st.size -= len(st.events[0])
+		st.events = st.events[1:]
+		st.first++
+	}
+	close(st.changed)
+	st.changed = make(chan struct{})
+}
+
+func (st *resumableStream) end() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.done = true
+	st.doneAt = time.Now()
+	close(st.changed)
+	st.changed = make(chan struct{})
+}
+
+// start registers a new stream, dropping expired ones.
+func (s *StreamResumer) start(keyID uuid.UUID) (string, *resumableStream) {
+	id := uuid.NewString()
+	st := &resumableStream{keyID: keyID, first: 1, changed: make(chan struct{})}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sid, old := range s.streams {
+		old.mu.Lock()
+		expired := old.done && now.Sub(old.doneAt) > s.ttl
+		old.mu.Unlock()
+		if expired {
+			delete(s.streams, sid)
+		}
+	}
+	s.streams[id] = st
+	return id, st
+}
+
+// parseEventID splits an id: value written by resumeWriter into its stream
+// ID and sequence number.
+func parseEventID(v string) (string, int, bool) {
+	id, seqStr, ok := strings.Cut(v, ":")
+	if !ok || uuid.Validate(id) != nil {
+		return "", 0, false
+	}
+	seq, err := strconv.Atoi(seqStr)
+	if err != nil || seq < 0 {
+		return "", 0, false
+	}
+	return id, seq, true
+}
+
+func writeResumeError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if strings.HasPrefix(r.URL.Path, "/v1/messages") {
+		writeAnthropicError(w, status, "invalid_request_error", msg)
+		return
+	}
+	writeOpenAIError(w, status, "invalid_request_error", msg)
+}
+
+// resumeWriter tags the events of a successful SSE response with ids and
+// buffers them. Once the client is gone, writes are swallowed so the
+// response keeps being generated for a resumption.
+type resumeWriter struct {
+	http.ResponseWriter
+	resumer *StreamResumer
+	keyID   uuid.UUID
+
+	wroteHeader bool
+	id          string
+	stream      atomic.Pointer[resumableStream]
+	gone        atomic.Bool
+	seq         int
+	pending     []byte // unterminated event
+}
+
+func (rw *resumeWriter) WriteHeader(status int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.wroteHeader = true
+	if status == http.StatusOK && strings.HasPrefix(rw.Header().Get("Content-Type"), "text/event-stream") {
+		id, st := rw.resumer.start(rw.keyID)
+		rw.id = id
+		rw.stream.Store(st)
+		rw.Header().Set(streamIDHeader, id)
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *resumeWriter) Write(p []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	st := rw.stream.Load()
+	if st == nil {
+		if rw.gone.Load() {
+			return len(p), nil
+		}
+		return rw.ResponseWriter.Write(p)
+	}
+
+	rw.pending = append(rw.pending, p...)
+	for {
+		end := eventEnd(rw.pending)
+		if end < 0 {
+			break
+		}
+		ev := rw.pending[:end]
+		rw.pending = append([]byte(nil), rw.pending[end:]...)
+		if isEvent(ev) {
+			rw.seq++
+			tagged := make([]byte, 0, len(ev)+len(rw.id)+16)
+			tagged = append(tagged, "id: "+rw.id+":"+strconv.Itoa(rw.seq)+"\n"...)
+			tagged = append(tagged, ev...)
+			ev = tagged
+			st.append(ev)
+		}
+		rw.send(ev)
+	}
+	return len(p), nil
+}
+
+// send writes to the client until a write fails.
+func (rw *resumeWriter) send(b []byte) {
+	if rw.gone.Load() {
+		return
+	}
+	if _, err := rw.ResponseWriter.Write(b); err != nil {
+		rw.gone.Store(true)
+	}
+}
+
+// finish forwards any unterminated event and ends the stream.
+func (rw *resumeWriter) finish() {
+	st := rw.stream.Load()
+	if st == nil {
+		return
+	}
+	if len(rw.pending) > 0 {
+		rw.send(rw.pending)
+		rw.pending = nil
+	}
+	st.end()
+}
+
+func (rw *resumeWriter) Flush() {
+	if rw.gone.Load() {
+		return
+	}
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (rw *resumeWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// eventEnd returns the length of the first complete event in b, blank line
+// included, or -1.
+func eventEnd(b []byte) int {
+	for i := 0; i < len(b); {
+		j := bytes.IndexByte(b[i:], '\n')
+		if j < 0 {
+			return -1
+		}
+		line := bytes.TrimSuffix(b[i:i+j], []byte("\r"))
+		i += j + 1
+		if len(line) == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// isEvent reports whether an event block carries an event for the client,
+// as opposed to only comments and retry: fields, which are not buffered.
+func isEvent(ev []byte) bool {
+	for _, line := range bytes.Split(ev, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(line) == 0 || line[0] == ':' || bytes.HasPrefix(line, []byte("retry:")) {
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestStreamResumer(t *testing.T) {
+	s := NewStreamResumer(time.Minute)
+	h := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "event: message_start\ndata: {}\n\n: keep-alive\n\n")
+		io.WriteString(w, "data: {\"n\"")
+		io.WriteString(w, ":2}\n\n")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+	id := rec.Header().Get(streamIDHeader)
+	want := "id: " + id + ":1\nevent: message_start\ndata: {}\n\n: keep-alive\n\nid: " + id + ":2\ndata: {\"n\":2}\n\n"
+	if got := rec.Body.String(); got != want {
+		t.Fatalf("stream = %q, want %q", got, want)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set("Last-Event-ID", id+":1")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got, want := rec.Body.String(), "id: "+id+":2\ndata: {\"n\":2}\n\n"; got != want {
+		t.Fatalf("resumed stream = %q, want %q", got, want)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	req.Header.Set("Last-Event-ID", uuid.NewString()+":3")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), `"type":"error"`) {
+		t.Fatalf("unknown stream: %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	json "github.com/bytedance/sonic"
+
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// mapMessageRoles applies an upstream's role map to a raw chat completions
+// body. Bodies without a mapped role are returned unchanged, so the extra
+// parse only costs a re-encode when a message is actually rewritten.
+func mapMessageRoles(body []byte, roles store.RoleMap) ([]byte, error) {
+	if len(roles) == 0 {
+		return body, nil
+	}
+	var req map[string]any
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	msgs, _ := req["messages"].([]any)
+	changed := false
+	for _, m := range msgs {
+		msg, ok := m.(map[string]any)
+		if !ok {
+			continue
+		}
+		role, _ := msg["role"].(string)
+		if to, ok := roles[role]; ok && to != role {
+			msg["role"] = to
+			changed = true
+		}
+	}
+	if !changed {
+		return body, nil
+	}
+	return json.Marshal(req)
+}
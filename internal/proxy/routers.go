@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	json "github.com/bytedance/sonic"
+
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// Routers resolves virtual router models to the model serving each
+// request. Routers are reloaded from the store every interval.
+type Routers struct {
+	store    store.Store
+	interval time.Duration
+	byName   atomic.Pointer[map[string]*store.ModelRouter] // active routers by lowercase name
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewRouters loads the model routers and reloads them every interval. Call
+// Close to stop it.
+func NewRouters(s store.Store, interval time.Duration) *Routers {
+	rs := &Routers{
+		store:    s,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	rs.byName.Store(&map[string]*store.ModelRouter{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := rs.Reload(ctx); err != nil {
+		log.Printf("routers: initial load failed: %v", err)
+	}
+	cancel()
+
+	rs.wg.Add(1)
+	go rs.worker()
+	return rs
+}
+
+func (rs *Routers) Close() {
+	close(rs.done)
+	rs.wg.Wait()
+}
+
+func (rs *Routers) worker() {
+	defer rs.wg.Done()
+
+	ticker := time.NewTicker(rs.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := rs.Reload(ctx); err != nil {
+				log.Printf("routers: reload failed: %v", err)
+			}
+			cancel()
+		case <-rs.done:
+			return
+		}
+	}
+}
+
+// Reload replaces the routers with the active ones in the store.
+func (rs *Routers) Reload(ctx context.Context) error {
+	routers, err := rs.store.ListModelRouters(ctx)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]*store.ModelRouter, len(routers))
+	for i := range routers {
+		if routers[i].IsActive {
+			byName[strings.ToLower(routers[i].Name)] = &routers[i]
+		}
+	}
+	rs.byName.Store(&byName)
+	return nil
+}
+
+// lookup returns the active router named name, case-insensitively, or nil.
+func (rs *Routers) lookup(name string) *store.ModelRouter {
+	if rs == nil {
+		return nil
+	}
+	return (*rs.byName.Load())[strings.ToLower(name)]
+}
+
+// list returns the active routers.
+func (rs *Routers) list() []*store.ModelRouter {
+	if rs == nil {
+		return nil
+	}
+	byName := *rs.byName.Load()
+	out := make([]*store.ModelRouter, 0, len(byName))
+	for _, mr := range byName {
+		out = append(out, mr)
+	}
+	return out
+}
+
+// SetRouters enables router models. When unset, every model name is
+// resolved as a concrete model.
+func (h *Handler) SetRouters(rs *Routers) {
+	h.routers = rs
+}
+
+// routeInput is what router rules match a request on.
+type routeInput struct {
+	inputTokens int // estimated at ~4 bytes per token, like policies' input_tokens
+	tools       bool
+	images      bool
+	priority    string
+}
+
+// readRouteInput reads a request body in any of the supported formats for
+// the features router rules match on.
+func readRouteInput(r *http.Request, body []byte) routeInput {
+	in := routeInput{inputTokens: len(body) / 4, priority: requestLogTags(r).priority}
+	var req map[string]any
+	if json.Unmarshal(body, &req) != nil {
+		return in
+	}
+	tools, _ := req["tools"].([]any)
+	functions, _ := req["functions"].([]any)
+	in.tools = len(tools) > 0 || len(functions) > 0
+	in.images = hasImage(req)
+	return in
+}
+
+// hasImage reports whether v holds an image content part: an Anthropic
+// image block, a Chat Completions image_url part or a Responses
+// input_image part.
+func hasImage(v any) bool {
+	switch v := v.(type) {
+	case []any:
+		for _, item := range v {
+			if hasImage(item) {
+				return true
+			}
+		}
+	case map[string]any:
+		switch v["type"] {
+		case "image", "image_url", "input_image":
+			return true
+		}
+		for _, item := range v {
+			if hasImage(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ruleMatches reports whether in meets every condition the rule sets.
+func ruleMatches(rule *store.RouterRule, in routeInput) bool {
+	switch {
+	case rule.MinInputTokens != nil && in.inputTokens < *rule.MinInputTokens,
+		rule.MaxInputTokens != nil && in.inputTokens > *rule.MaxInputTokens,
+		rule.Tools != nil && *rule.Tools != in.tools,
+		rule.Images != nil && *rule.Images != in.images,
+		rule.Priority != "" && rule.Priority != in.priority:
+		return false
+	}
+	return true
+}
+
+// pickModel returns the model of the router's first rule matching in and
+// the rule's index, or the default model and -1.
+func pickModel(mr *store.ModelRouter, in routeInput) (string, int) {
+	for i := range mr.Rules {
+		if ruleMatches(&mr.Rules[i], in) {
+			return mr.Rules[i].Model, i
+		}
+	}
+	return mr.DefaultModel, -1
+}
+
+// routedBy records the router a request was sent through, for its log.
+type routedBy struct {
+	Name string `json:"name"`
+	Rule *int   `json:"rule"` // index of the matching rule; null for the default model
+}
+
+// routeModel returns the model serving a request for model: the one its
+// router picks if model names a router, otherwise model itself. The
+// router is recorded in the request's log tags. routed is false when model
+// is not a router; err is a modelNotAllowedError when the key may not use
+// the router.
+func (h *Handler) routeModel(r *http.Request, model string, body []byte) (_ *http.Request, target string, routed bool, err error) {
+	mr := h.routers.lookup(model)
+	if mr == nil {
+		return r, model, false, nil
+	}
+	if key := auth.GetKeyFromContext(r.Context()); key != nil && !key.AllowsModel(model, mr.Name) {
+		return r, model, false, &modelNotAllowedError{model: model}
+	}
+	target, i := pickModel(mr, readRouteInput(r, body))
+	t := requestLogTags(r)
+	t.router = &routedBy{Name: mr.Name}
+	if i >= 0 {
+		t.router.Rule = &i
+	}
+	return withLogTags(r, t), target, true, nil
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func TestReadRouteInput(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		body          string
+		tools, images bool
+	}{
+		{"plain", `{"messages":[{"role":"user","content":"Hi"}]}`, false, false},
+		{"chat tools", `{"messages":[],"tools":[{"type":"function"}]}`, true, false},
+		{"legacy functions", `{"messages":[],"functions":[{"name":"f"}]}`, true, false},
+		{"anthropic image", `{"messages":[{"role":"user","content":[{"type":"image","source":{}}]}]}`, false, true},
+		{"chat image", `{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"x"}}]}]}`, false, true},
+		{"responses image", `{"input":[{"role":"user","content":[{"type":"input_image","image_url":"x"}]}]}`, false, true},
+		{"empty tools", `{"messages":[],"tools":[]}`, false, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			in := readRouteInput(httptest.NewRequest("POST", "/", nil), []byte(tt.body))
+			if in.tools != tt.tools || in.images != tt.images {
+				t.Fatalf("got tools=%v images=%v", in.tools, in.images)
+			}
+		})
+	}
+}
+
+func TestPickModel(t *testing.T) {
+	small, large, yes := 1000, 1001, true
+	mr := &store.ModelRouter{
+		Rules: []store.RouterRule{
+			{Images: &yes, Model: "vision"},
+			{Priority: "high", Model: "fast"},
+			{MaxInputTokens: &small, Model: "cheap"},
+			{MinInputTokens: &large, Tools: &yes, Model: "long-tools"},
+		},
+		DefaultModel: "default",
+	}
+	for _, tt := range []struct {
+		in   routeInput
+		want string
+		rule int
+	}{
+		{routeInput{inputTokens: 10, images: true, priority: "high"}, "vision", 0},
+		{routeInput{inputTokens: 5000, priority: "high"}, "fast", 1},
+		{routeInput{inputTokens: 1000, tools: true}, "cheap", 2},
+		{routeInput{inputTokens: 5000, tools: true}, "long-tools", 3},
+		{routeInput{inputTokens: 5000}, "default", -1},
+	} {
+		if got, rule := pickModel(mr, tt.in); got != tt.want || rule != tt.rule {
+			t.Errorf("pickModel(%+v) = %s, %d; want %s, %d", tt.in, got, rule, tt.want, tt.rule)
+		}
+	}
+
+	var none *Routers
+	if none.lookup("anything") != nil || len(none.list()) != 0 {
+		t.Fatal("expected a nil Routers to hold no routers")
+	}
+}
@@ -0,0 +1,350 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	json "github.com/bytedance/sonic"
+
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/ids"
+	"github.com/sertdev/pxbin/pkg/translate"
+)
+
+// Requests from sandbox keys are sent to an UpstreamClient whose transport
+// answers them itself, in the upstream's format, so translation, usage
+// accounting and logging run exactly as they would for a real upstream.
+// Logs are written without an upstream and at no cost.
+
+// sandboxReplies are the canned answers; a request always gets the same one.
+var sandboxReplies = []string{
+	"This is a sandbox response from pxbin. No model was called and no tokens were billed.",
+	"Hello from the pxbin sandbox. Requests made with this key are answered locally with canned text, so you can build against the API without spending tokens.",
+	"pxbin sandbox: your request was accepted and logged, but it was never forwarded to an upstream model.",
+}
+
+// sandboxChunkInterval paces streamed sandbox responses, one word per chunk.
+const sandboxChunkInterval = 30 * time.Millisecond
+
+// sandboxClient answers every request with a synthetic response.
+var sandboxClient = &UpstreamClient{client: &http.Client{Transport: sandboxTransport{}}}
+
+// isSandboxKey reports whether the request was made with a sandbox key.
+func isSandboxKey(ctx context.Context) bool {
+	key := auth.GetKeyFromContext(ctx)
+	return key != nil && key.Sandbox
+}
+
+// sandboxReply picks the canned answer for a request body.
+func sandboxReply(body []byte) string {
+	h := fnv.New32a()
+	h.Write(body)
+	return sandboxReplies[h.Sum32()%uint32(len(sandboxReplies))]
+}
+
+// sandboxTransport is an http.RoundTripper that fakes the upstream
+// endpoints the proxy sends requests to: Anthropic Messages and token
+// counting, and OpenAI Chat Completions and Embeddings. The Responses and
+// Gemini endpoints reach it translated to one of those. Any other endpoint
+// is rejected in its API's error format.
+type sandboxTransport struct{}
+
+func (sandboxTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var probe struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	anthropic := strings.Contains(req.URL.Path, "/messages")
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return sandboxError(req, anthropic, http.StatusBadRequest, "sandbox: request body is not JSON"), nil
+	}
+
+	reply := sandboxReply(body)
+	s := sandboxStream{
+		model:  probe.Model,
+		words:  strings.SplitAfter(reply, " "),
+		input:  (len(body) + 3) / 4,
+		output: (len(reply) + 3) / 4,
+	}
+
+	var write func(w io.Writer, pause func() bool) error
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/messages"):
+		if !probe.Stream {
+			return sandboxJSON(req, s.anthropicMessage(reply))
+		}
+		write = s.writeAnthropic
+	case strings.HasSuffix(req.URL.Path, "/chat/completions"):
+		if !probe.Stream {
+			return sandboxJSON(req, s.chatCompletion(reply))
+		}
+		write = s.writeChat
+	case strings.HasSuffix(req.URL.Path, "/messages/count_tokens"):
+		return sandboxJSON(req, map[string]int{"input_tokens": s.input})
+	case strings.HasSuffix(req.URL.Path, "/embeddings"):
+		return sandboxJSON(req, s.embeddings(body))
+	default:
+		return sandboxError(req, anthropic, http.StatusBadRequest,
+			fmt.Sprintf("sandbox: %s is not available to sandbox keys", req.URL.Path)), nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		ctx := req.Context()
+		pause := func() bool {
+			t := time.NewTimer(sandboxChunkInterval)
+			defer t.Stop()
+			select {
+			case <-ctx.Done():
+				return false
+			case <-t.C:
+				return true
+			}
+		}
+		err := write(pw, pause)
+		if err == nil {
+			err = ctx.Err()
+		}
+		pw.CloseWithError(err)
+	}()
+	return sandboxResponse(req, http.StatusOK, "text/event-stream", pr), nil
+}
+
+func sandboxResponse(req *http.Request, status int, contentType string, body io.ReadCloser) *http.Response {
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": []string{contentType}},
+		Body:       body,
+		Request:    req,
+	}
+}
+
+// sandboxError answers with an invalid_request_error, in the Anthropic
+// format for Messages endpoints and the OpenAI format otherwise.
+func sandboxError(req *http.Request, anthropic bool, status int, message string) *http.Response {
+	var data []byte
+	if anthropic {
+		data, _ = json.Marshal(map[string]any{"type": "error", "error": map[string]any{"type": "invalid_request_error", "message": message}})
+	} else {
+		data, _ = json.Marshal(map[string]any{"error": map[string]any{"type": "invalid_request_error", "message": message}})
+	}
+	return sandboxResponse(req, status, "application/json", io.NopCloser(bytes.NewReader(data)))
+}
+
+func sandboxJSON(req *http.Request, v any) (*http.Response, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return sandboxResponse(req, http.StatusOK, "application/json", io.NopCloser(bytes.NewReader(data))), nil
+}
+
+// sandboxStream holds what a synthetic response is built from.
+type sandboxStream struct {
+	model         string
+	words         []string
+	input, output int // estimated token counts reported as usage
+}
+
+func (s *sandboxStream) anthropicMessage(reply string) *translate.AnthropicResponse {
+	stop := "end_turn"
+	return &translate.AnthropicResponse{
+		ID:         ids.AnthropicMessage(),
+		Type:       "message",
+		Role:       "assistant",
+		Model:      s.model,
+		Content:    []translate.ContentBlock{{Type: "text", Text: reply}},
+		StopReason: &stop,
+		Usage:      translate.AnthropicUsage{InputTokens: s.input, OutputTokens: s.output},
+	}
+}
+
+func (s *sandboxStream) chatCompletion(reply string) *translate.OpenAIResponse {
+	stop := "stop"
+	return &translate.OpenAIResponse{
+		ID:      ids.ChatCompletion(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   s.model,
+		Choices: []translate.OpenAIChoice{{
+			Message:      translate.OpenAIMessage{Role: "assistant", Content: reply},
+			FinishReason: &stop,
+		}},
+		Usage: &translate.OpenAIUsage{PromptTokens: s.input, CompletionTokens: s.output, TotalTokens: s.input + s.output},
+	}
+}
+
+// sandboxEmbeddingDims is the length of sandbox embeddings when the request
+// does not ask for one.
+const sandboxEmbeddingDims = 8
+
+// embeddings answers an embeddings request with a unit vector per input
+// derived from its text, so equal inputs get equal embeddings.
+func (s *sandboxStream) embeddings(body []byte) *translate.OpenAIEmbeddingResponse {
+	var req translate.OpenAIEmbeddingRequest
+	json.Unmarshal(body, &req)
+	inputs := []any{req.Input}
+	if list, ok := req.Input.([]any); ok && len(list) > 0 {
+		if _, tokens := list[0].(float64); !tokens {
+			inputs = list
+		}
+	}
+	dims := sandboxEmbeddingDims
+	if req.Dimensions != nil && *req.Dimensions > 0 {
+		dims = *req.Dimensions
+	}
+
+	resp := &translate.OpenAIEmbeddingResponse{
+		Object: "list",
+		Model:  s.model,
+		Usage:  &translate.OpenAIEmbeddingUsage{PromptTokens: s.input, TotalTokens: s.input},
+	}
+	for i, in := range inputs {
+		h := fnv.New64a()
+		fmt.Fprint(h, in)
+		rng := rand.New(rand.NewPCG(h.Sum64(), 0))
+		vec := make([]float32, dims)
+		var norm float64
+		for j := range vec {
+			v := rng.NormFloat64()
+			vec[j], norm = float32(v), norm+v*v
+		}
+		norm = math.Sqrt(norm)
+		for j := range vec {
+			vec[j] /= float32(norm)
+		}
+
+		var embedding []byte
+		if req.EncodingFormat == "base64" {
+			raw := make([]byte, 0, 4*dims)
+			for _, v := range vec {
+				raw = binary.LittleEndian.AppendUint32(raw, math.Float32bits(v))
+			}
+			embedding, _ = json.Marshal(base64.StdEncoding.EncodeToString(raw))
+		} else {
+			embedding, _ = json.Marshal(vec)
+		}
+		resp.Data = append(resp.Data, translate.OpenAIEmbedding{Object: "embedding", Index: i, Embedding: embedding})
+	}
+	return resp
+}
+
+// writeAnthropic writes the reply as an Anthropic Messages event stream.
+func (s *sandboxStream) writeAnthropic(w io.Writer, pause func() bool) error {
+	event := func(name string, v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+		return err
+	}
+
+	start := s.anthropicMessage("")
+	start.Content = []translate.ContentBlock{}
+	start.StopReason = nil
+	start.Usage.OutputTokens = 0
+	if err := event("message_start", translate.MessageStartEvent{Type: "message_start", Message: *start}); err != nil {
+		return err
+	}
+	if err := event("content_block_start", translate.ContentBlockStartEvent{
+		Type:         "content_block_start",
+		ContentBlock: translate.ContentBlock{Type: "text"},
+	}); err != nil {
+		return err
+	}
+	for _, word := range s.words {
+		if !pause() {
+			return nil
+		}
+		if err := event("content_block_delta", translate.ContentBlockDeltaEvent{
+			Type:  "content_block_delta",
+			Delta: translate.DeltaBlock{Type: "text_delta", Text: word},
+		}); err != nil {
+			return err
+		}
+	}
+	if err := event("content_block_stop", map[string]any{"type": "content_block_stop", "index": 0}); err != nil {
+		return err
+	}
+	stop := "end_turn"
+	if err := event("message_delta", translate.MessageDeltaEvent{
+		Type:  "message_delta",
+		Delta: translate.MessageDelta{StopReason: &stop},
+		Usage: &translate.MessageDeltaUsage{InputTokens: s.input, OutputTokens: s.output},
+	}); err != nil {
+		return err
+	}
+	return event("message_stop", map[string]any{"type": "message_stop"})
+}
+
+// writeChat writes the reply as an OpenAI Chat Completions stream, ending
+// with a usage chunk as if stream_options.include_usage had been set.
+func (s *sandboxStream) writeChat(w io.Writer, pause func() bool) error {
+	id := ids.ChatCompletion()
+	created := time.Now().Unix()
+	chunk := func(choices []translate.OpenAIStreamChoice, usage *translate.OpenAIUsage) error {
+		data, err := json.Marshal(translate.OpenAIStreamChunk{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   s.model,
+			Choices: choices,
+			Usage:   usage,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		return err
+	}
+
+	for i, word := range s.words {
+		if !pause() {
+			return nil
+		}
+		delta := translate.OpenAIStreamDelta{Content: &word}
+		if i == 0 {
+			delta.Role = "assistant"
+		}
+		if err := chunk([]translate.OpenAIStreamChoice{{Delta: delta}}, nil); err != nil {
+			return err
+		}
+	}
+	stop := "stop"
+	if err := chunk([]translate.OpenAIStreamChoice{{FinishReason: &stop}}, nil); err != nil {
+		return err
+	}
+	if err := chunk([]translate.OpenAIStreamChoice{}, &translate.OpenAIUsage{
+		PromptTokens:     s.input,
+		CompletionTokens: s.output,
+		TotalTokens:      s.input + s.output,
+	}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "data: [DONE]\n\n")
+	return err
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	json "github.com/bytedance/sonic"
+
+	"github.com/sertdev/pxbin/pkg/translate"
+)
+
+func TestSandboxTransportIsDeterministic(t *testing.T) {
+	body := `{"model":"claude-test","max_tokens":64,"messages":[{"role":"user","content":"hi"}]}`
+	var texts []string
+	for i := 0; i < 2; i++ {
+		resp, err := sandboxClient.DoRaw(context.Background(), "POST", "/v1/messages", strings.NewReader(body), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg translate.AnthropicResponse
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("decode %s: %v", data, err)
+		}
+		if msg.Model != "claude-test" || len(msg.Content) != 1 || msg.Usage.InputTokens == 0 || msg.Usage.OutputTokens == 0 {
+			t.Fatalf("unexpected message %s", data)
+		}
+		texts = append(texts, msg.Content[0].Text)
+	}
+	if texts[0] != texts[1] {
+		t.Fatalf("replies differ: %q vs %q", texts[0], texts[1])
+	}
+}
+
+func TestSandboxChatStreamTranslates(t *testing.T) {
+	body := `{"model":"gpt-test","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+	resp, err := sandboxClient.Do(context.Background(), "POST", "/v1/chat/completions", strings.NewReader(body), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	result, err := translate.TranslateOpenAIStreamToAnthropic(context.Background(), resp.Body, rec, rec, "gpt-test", 0, false, "", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InputTokens == 0 || result.OutputTokens == 0 {
+		t.Fatalf("missing usage: %+v", result)
+	}
+	out := rec.Body.String()
+	if !strings.Contains(out, "sandbox") || !strings.Contains(out, "event: message_stop") {
+		t.Fatalf("unexpected stream %q", out)
+	}
+}
+
+func TestSandboxTransportEndpoints(t *testing.T) {
+	do := func(path, body string) (int, string) {
+		t.Helper()
+		resp, err := sandboxClient.DoRaw(context.Background(), "POST", path, strings.NewReader(body), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	if status, out := do("/v1/messages/count_tokens", `{"model":"claude-test","messages":[{"role":"user","content":"hello there"}]}`); status != 200 || !strings.Contains(out, `"input_tokens":`) {
+		t.Errorf("count_tokens: got %d %s", status, out)
+	}
+
+	status, out := do("/v1/embeddings", `{"model":"text-embedding-test","input":["a","b"],"dimensions":4}`)
+	var emb translate.OpenAIEmbeddingResponse
+	if status != 200 || json.Unmarshal([]byte(out), &emb) != nil || len(emb.Data) != 2 || emb.Usage == nil || emb.Usage.PromptTokens == 0 {
+		t.Errorf("embeddings: got %d %s", status, out)
+	}
+
+	// Endpoints the sandbox cannot fake are rejected in their API's format.
+	for path, anthropic := range map[string]bool{"/v1/messages/batches": true, "/v1/completions": false} {
+		status, out := do(path, `{"model":"m"}`)
+		var e struct {
+			Type  string
+			Error struct{ Type, Message string }
+		}
+		if status != 400 || json.Unmarshal([]byte(out), &e) != nil || e.Error.Type != "invalid_request_error" ||
+			e.Error.Message != "sandbox: "+path+" is not available to sandbox keys" || (e.Type == "error") != anthropic {
+			t.Errorf("%s: got %d %s", path, status, out)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/logging"
+	"github.com/sertdev/pxbin/internal/scoreboard"
+)
+
+// SetScoreboard records every upstream request's outcome on b and seeds the
+// circuit breakers of upstream clients created from now on with the
+// consecutive failures b has, which may be carried over from before a
+// restart.
+func (h *Handler) SetScoreboard(b *scoreboard.Board) {
+	h.scores = b
+	h.clients.mu.Lock()
+	h.clients.scores = b
+	h.clients.mu.Unlock()
+}
+
+// recordScore adds a logged request's outcome to its upstream's score.
+// Server errors, rate limits and stalled streams count against the
+// upstream; client errors do not.
+func (h *Handler) recordScore(e *logging.LogEntry) {
+	if h.scores == nil || e.UpstreamID == nil {
+		return
+	}
+	failed := e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.ErrorCode == errorCodeUpstreamStall
+	h.scores.Record(*e.UpstreamID, !failed, time.Duration(e.LatencyMS)*time.Millisecond)
+}
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/translate"
+)
+
+// SetSSEOptions sets the retry: field sent at the start of client streams
+// and how long a stream may sit idle before a keep-alive frame is sent. Zero
+// disables either.
+func (h *Handler) SetSSEOptions(retry, commentInterval time.Duration) {
+	h.sseRetry = retry
+	h.sseCommentInterval = commentInterval
+}
+
+// anthropicPing is the keep-alive frame of Anthropic-format streams: the
+// ping event Anthropic itself sends, so clients that watch for events rather
+// than bytes see the stream is alive. Anthropic SDKs skip it.
+const anthropicPing = "event: ping\ndata: {\"type\": \"ping\"}\n\n"
+
+// streamWriter wraps a handler's response writer for the stream format the
+// client asked for: JSON Lines, or SSE with the configured retry: field and
+// keep-alive frames. keepAlive replaces the default comment frame if not
+// empty. The returned func must be deferred.
+func (h *Handler) streamWriter(w http.ResponseWriter, r *http.Request, keepAlive string) (http.ResponseWriter, func()) {
+	if translate.WantsNDJSON(r) {
+		return translate.NewNDJSONWriter(w), func() {}
+	}
+	if h.sseRetry <= 0 && h.sseCommentInterval <= 0 {
+		return w, func() {}
+	}
+	sw := translate.NewSSEWriter(w, h.sseRetry, h.sseCommentInterval)
+	if keepAlive != "" {
+		sw.SetKeepAlive(keepAlive)
+	}
+	return sw, sw.Close
+}
+
+// ndjsonStream reports whether w sends a stream re-framed as JSON Lines.
+func ndjsonStream(w http.ResponseWriter) bool {
+	return strings.HasPrefix(w.Header().Get("Content-Type"), translate.NDJSONContentType)
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/sertdev/pxbin/pkg/translate"
+)
+
+// errorCodeUpstreamStall is logged for streams ended by the idle timeout.
+const errorCodeUpstreamStall = "upstream_stall"
+
+// SetStreamIdleTimeout sets how long an upstream stream may send nothing
+// before it is ended, for upstreams without their own
+// stream_idle_timeout_seconds. 0 disables the timeout.
+func (h *Handler) SetStreamIdleTimeout(d time.Duration) {
+	h.streamIdleTimeout = d
+}
+
+// stallReader wraps an upstream stream body and closes it once no bytes
+// have arrived for the idle timeout, so a hung upstream cannot hold the
+// client connection open forever. Reads after that fail with
+// translate.ErrUpstreamStall, which the stream readers turn into an error
+// event for the client.
+type stallReader struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer // nil when the timeout is disabled
+	stalled atomic.Bool
+}
+
+// watchStream wraps an upstream stream body with the upstream's idle
+// timeout. The returned reader must be closed once the stream is done.
+func (up *upstreamInfo) watchStream(body io.ReadCloser) *stallReader {
+	s := &stallReader{body: body, timeout: up.streamIdleTimeout}
+	if s.timeout > 0 {
+		s.timer = time.AfterFunc(s.timeout, func() {
+			s.stalled.Store(true)
+			body.Close()
+		})
+	}
+	return s
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	n, err := s.body.Read(p)
+	if s.stalled.Load() {
+		return n, translate.ErrUpstreamStall
+	}
+	if n > 0 && s.timer != nil {
+		s.timer.Reset(s.timeout)
+	}
+	return n, err
+}
+
+// Close cancels the idle timeout and closes the upstream body.
+func (s *stallReader) Close() error {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	return s.body.Close()
+}
+
+// errorCode returns the log error code for a stream that was ended by the
+// idle timeout, or "".
+func (s *stallReader) errorCode() string {
+	if s.stalled.Load() {
+		return errorCodeUpstreamStall
+	}
+	return ""
+}
+
+// errorMessage returns the log error message for a stalled stream, or "".
+func (s *stallReader) errorMessage() string {
+	if s.stalled.Load() {
+		return "upstream sent no data for " + s.timeout.String()
+	}
+	return ""
+}
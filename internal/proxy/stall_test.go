@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStallReaderEndsSilentStream(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write([]byte("event: ping\ndata: {\"type\":\"ping\"}\n\n"))
+
+	up := &upstreamInfo{streamIdleTimeout: 50 * time.Millisecond}
+	body := up.watchStream(pr)
+	defer body.Close()
+
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		passthroughAnthropicStream(slog.Default(), body, rec, rec, 0)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream was not ended by the idle timeout")
+	}
+
+	if got := body.errorCode(); got != errorCodeUpstreamStall {
+		t.Fatalf("errorCode = %q, want %q", got, errorCodeUpstreamStall)
+	}
+	out := rec.Body.String()
+	if !strings.Contains(out, "event: ping") || !strings.Contains(out, "event: error") {
+		t.Fatalf("expected forwarded event followed by an error event, got %q", out)
+	}
+}
+
+func TestStallReaderDisabled(t *testing.T) {
+	body := (&upstreamInfo{}).watchStream(io.NopCloser(strings.NewReader("data: x\n\n")))
+	defer body.Close()
+	if _, err := io.ReadAll(body); err != nil {
+		t.Fatal(err)
+	}
+	if got := body.errorCode(); got != "" {
+		t.Fatalf("errorCode = %q, want none", got)
+	}
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sertdev/pxbin/internal/logging"
+	"github.com/sertdev/pxbin/internal/tracing"
+)
+
+// Span names of the stages of a proxied request, below the server span that
+// tracing.Middleware starts.
+const (
+	spanResolve   = "pxbin.resolve_model"
+	spanTranslate = "pxbin.translate_request"
+	spanUpstream  = "pxbin.upstream"
+	spanStream    = "pxbin.stream"
+)
+
+// startTranslate starts the span of a request translation between formats.
+func startTranslate(ctx context.Context, from, to string) trace.Span {
+	_, span := tracing.Start(ctx, spanTranslate, attribute.String("pxbin.translation", from+"->"+to))
+	return span
+}
+
+// tracedBody ends the span of an upstream response body when the body is
+// closed, so the span covers the time spent streaming it to the client.
+type tracedBody struct {
+	io.ReadCloser
+	span trace.Span
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		b.span.RecordError(err)
+		b.span.SetStatus(codes.Error, err.Error())
+	}
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.span.End()
+	return err
+}
+
+// traceResponse starts the stream span of an upstream response.
+func traceResponse(ctx context.Context, resp *http.Response) {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return
+	}
+	_, span := tracing.Start(ctx, spanStream)
+	resp.Body = &tracedBody{ReadCloser: resp.Body, span: span}
+}
+
+// traceLog records the outcome of a request on its server span.
+func traceLog(ctx context.Context, e *logging.LogEntry) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(
+		attribute.String("pxbin.model", e.Model),
+		attribute.String("pxbin.input_format", e.InputFormat),
+		attribute.String("pxbin.upstream_format", e.UpstreamFormat),
+		attribute.Int("http.response.status_code", e.StatusCode),
+		attribute.Int("pxbin.input_tokens", e.InputTokens),
+		attribute.Int("pxbin.output_tokens", e.OutputTokens),
+		attribute.Float64("pxbin.cost", e.Cost),
+	)
+	if e.UpstreamID != nil {
+		span.SetAttributes(attribute.String("pxbin.upstream_id", e.UpstreamID.String()))
+	}
+	if e.ErrorCode != "" {
+		span.SetAttributes(attribute.String("error.type", e.ErrorCode))
+	}
+	if e.StatusCode >= 500 {
+		span.SetStatus(codes.Error, e.ErrorMessage)
+	}
+}
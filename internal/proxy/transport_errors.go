@@ -0,0 +1,31 @@
+package proxy
+
+import "github.com/sertdev/pxbin/internal/resilience"
+
+// errorCodeUpstreamConnection is logged for requests that never got a
+// response from the upstream, other than the transient transport errors
+// transportErrorCode names.
+const errorCodeUpstreamConnection = "upstream_connection_error"
+
+// TransportErrorCounter counts transient transport errors from upstreams
+// by kind (see resilience.TransportErrorKind), and whether the request was
+// retried after them.
+type TransportErrorCounter interface {
+	Inc(kind string, retried bool)
+}
+
+// SetTransportErrorCounter counts upstream transport errors on c.
+func (h *Handler) SetTransportErrorCounter(c TransportErrorCounter) {
+	h.clients.transportErrors = c
+}
+
+// transportErrorCode returns the error code logged for a request whose
+// upstream call failed with err, keeping transport failures apart from 5xx
+// responses: upstream_goaway, upstream_connection_reset, upstream_eof or
+// upstream_connection_error.
+func transportErrorCode(err error) string {
+	if kind := resilience.TransportErrorKind(err); kind != "" {
+		return "upstream_" + kind
+	}
+	return errorCodeUpstreamConnection
+}
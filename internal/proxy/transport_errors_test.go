@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/resilience"
+)
+
+type countingTransportErrors struct {
+	counts map[string]int
+}
+
+func (c *countingTransportErrors) Inc(kind string, retried bool) {
+	c.counts[fmt.Sprintf("%s/%v", kind, retried)]++
+}
+
+// dropFirst returns a server that closes the connection without a response
+// the first n times it is called.
+func dropFirst(t *testing.T, n int32) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= n {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conn.Close()
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestTransportErrorRetried(t *testing.T) {
+	srv, calls := dropFirst(t, 1)
+	c := NewUpstreamClient(srv.URL, "sk-test", &UpstreamOpts{RetryOpts: resilience.RetryOpts{MaxAttempts: 3, BaseDelay: time.Millisecond}})
+	counter := &countingTransportErrors{counts: map[string]int{}}
+	c.transportErrors = counter
+
+	resp, err := c.Do(context.Background(), "POST", "/v1/chat/completions", bytes.NewReader([]byte(`{}`)), nil)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if calls.Load() != 2 {
+		t.Fatalf("upstream called %d times, want 2", calls.Load())
+	}
+	if counter.counts["eof/true"] != 1 || len(counter.counts) != 1 {
+		t.Fatalf("counts = %v, want one retried eof", counter.counts)
+	}
+}
+
+func TestTransportErrorExhausted(t *testing.T) {
+	srv, _ := dropFirst(t, 10)
+	c := NewUpstreamClient(srv.URL, "sk-test", &UpstreamOpts{RetryOpts: resilience.RetryOpts{MaxAttempts: 2, BaseDelay: time.Millisecond}})
+	counter := &countingTransportErrors{counts: map[string]int{}}
+	c.transportErrors = counter
+
+	_, err := c.Do(context.Background(), "POST", "/v1/chat/completions", bytes.NewReader([]byte(`{}`)), nil)
+	if err == nil {
+		t.Fatal("Do succeeded, want an error")
+	}
+	if got := transportErrorCode(err); got != "upstream_eof" {
+		t.Fatalf("error code = %q, want upstream_eof", got)
+	}
+	if counter.counts["eof/true"] != 1 || counter.counts["eof/false"] != 1 {
+		t.Fatalf("counts = %v, want one retried and one failed eof", counter.counts)
+	}
+}
@@ -2,19 +2,47 @@ package proxy
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/sertdev/pxbin/internal/extension"
+	"github.com/sertdev/pxbin/internal/loopguard"
 	"github.com/sertdev/pxbin/internal/resilience"
+	"github.com/sertdev/pxbin/internal/tracing"
+	"github.com/sertdev/pxbin/internal/vertex"
 )
 
-// UpstreamOpts configures resilience for upstream clients.
+// UpstreamOpts configures resilience for upstream clients. A circuit
+// breaker is only used with a positive threshold.
 type UpstreamOpts struct {
 	CBOpts    resilience.CircuitBreakerOpts
 	RetryOpts resilience.RetryOpts
+
+	// RetryStatusCodes are response statuses retried like connection
+	// errors.
+	RetryStatusCodes []int
+
+	// RetryBudgetRatio caps the upstream's retries at this fraction of its
+	// requests (see resilience.RetryBudget); 0 for no cap.
+	RetryBudgetRatio float64
+}
+
+// equal reports whether o and p configure clients the same way.
+func (o *UpstreamOpts) equal(p *UpstreamOpts) bool {
+	if o == nil || p == nil {
+		return o == p
+	}
+	return o.CBOpts == p.CBOpts && o.RetryOpts == p.RetryOpts && slices.Equal(o.RetryStatusCodes, p.RetryStatusCodes) &&
+		o.RetryBudgetRatio == p.RetryBudgetRatio
 }
 
 // UpstreamClient sends requests to an OpenAI-compatible upstream API.
@@ -24,6 +52,12 @@ type UpstreamClient struct {
 	apiKey    string
 	cb        *resilience.CircuitBreaker
 	retryOpts resilience.RetryOpts
+	retryOn   []int                   // response statuses that are retried
+	budget    *resilience.RetryBudget // nil for unlimited retries
+	ext       *extension.Module       // patches bodies for the upstream's dialect; nil for none
+	vertex    *vertex.Target          // the Vertex AI upstream requests go to; nil for others
+
+	transportErrors TransportErrorCounter // nil for none
 }
 
 // NewUpstreamClient creates an UpstreamClient with a configured transport for
@@ -52,8 +86,12 @@ func NewUpstreamClient(baseURL, apiKey string, opts *UpstreamOpts) *UpstreamClie
 	}
 
 	if opts != nil {
-		uc.cb = resilience.NewCircuitBreaker(opts.CBOpts)
+		if opts.CBOpts.Threshold > 0 {
+			uc.cb = resilience.NewCircuitBreaker(opts.CBOpts)
+		}
 		uc.retryOpts = opts.RetryOpts
+		uc.retryOn = opts.RetryStatusCodes
+		uc.budget = resilience.NewRetryBudget(opts.RetryBudgetRatio)
 	}
 
 	return uc
@@ -61,7 +99,9 @@ func NewUpstreamClient(baseURL, apiKey string, opts *UpstreamOpts) *UpstreamClie
 
 // Do sends a request to the upstream and returns the response. The caller is
 // responsible for closing the response body. Uses circuit breaker and retry
-// for connection errors on non-streaming requests.
+// for connection errors and the upstream's retryable statuses, waiting out
+// a retryable response's Retry-After; since retries end once response
+// headers arrive, streams are only retried before their first byte.
 func (c *UpstreamClient) Do(ctx context.Context, method, path string, body io.Reader, headers http.Header) (*http.Response, error) {
 	return c.doRequest(ctx, method, path, body, headers, true)
 }
@@ -72,14 +112,40 @@ func (c *UpstreamClient) DoRaw(ctx context.Context, method, path string, body io
 	return c.doRequest(ctx, method, path, body, headers, false)
 }
 
+// doRequest sends the request under a client span that ends once the
+// response headers arrive; reading the body is traced by the stream span.
 func (c *UpstreamClient) doRequest(ctx context.Context, method, path string, body io.Reader, headers http.Header, useBearer bool) (*http.Response, error) {
+	spanCtx, span := tracing.StartClient(ctx, spanUpstream)
+	if span.IsRecording() {
+		span.SetAttributes(attribute.String("http.request.method", method), attribute.String("url.path", path))
+		if u, err := url.Parse(c.baseURL); err == nil {
+			span.SetAttributes(attribute.String("server.address", u.Host))
+		}
+	}
+	resp, err := c.send(spanCtx, method, path, body, headers, useBearer)
+	if resp != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		traceResponse(ctx, resp)
+	}
+	tracing.EndWithError(span, err)
+	return resp, err
+}
+
+func (c *UpstreamClient) send(ctx context.Context, method, path string, body io.Reader, headers http.Header, useBearer bool) (*http.Response, error) {
+	body, err := c.extendRequest(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check circuit breaker.
 	var cbDone func(bool)
 	if c.cb != nil {
 		var err error
 		cbDone, err = c.cb.Allow()
 		if err != nil {
-			return nil, fmt.Errorf("upstream unavailable: %w", err)
+			err = fmt.Errorf("upstream unavailable: %w", err)
+			noteUpstreamResult(ctx, nil, err, 0)
+			return nil, err
 		}
 	}
 
@@ -88,6 +154,7 @@ func (c *UpstreamClient) doRequest(ctx context.Context, method, path string, bod
 
 	var resp *http.Response
 	var lastErr error
+	attempts := 1
 
 	doOnce := func() error {
 		url := c.baseURL + path
@@ -100,6 +167,7 @@ func (c *UpstreamClient) doRequest(ctx context.Context, method, path string, bod
 			req.Header.Set("Authorization", "Bearer "+c.apiKey)
 		}
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(loopguard.Header, loopguard.NextHop(ctx))
 
 		for k, vals := range headers {
 			for _, v := range vals {
@@ -110,30 +178,104 @@ func (c *UpstreamClient) doRequest(ctx context.Context, method, path string, bod
 				}
 			}
 		}
+		tracing.Inject(ctx, req.Header)
 
 		resp, err = c.client.Do(req)
 		return err
 	}
 
+	// Transient transport errors (GOAWAY, reset, EOF before the headers)
+	// usually mean the upstream dropped a pooled connection. Idle
+	// connections are closed so a retry dials a fresh one.
+	var transportErrs []string
+	attempt := func() error {
+		err := doOnce()
+		if kind := resilience.TransportErrorKind(err); kind != "" {
+			transportErrs = append(transportErrs, kind)
+			c.client.CloseIdleConnections()
+		}
+		return err
+	}
+
 	// If retry is configured and body supports seeking, wrap in retry.
 	if c.retryOpts.MaxAttempts > 1 && canRetry {
-		lastErr = resilience.Do(ctx, c.retryOpts, func() error {
+		attempts, lastErr = resilience.DoBudgeted(ctx, c.retryOpts, c.budget, func() error {
+			if resp != nil {
+				// The previous attempt got a retryable status.
+				resp.Body.Close()
+				resp = nil
+			}
 			if _, err := bodySeeker.Seek(0, io.SeekStart); err != nil {
 				return err
 			}
-			return doOnce()
+			if err := attempt(); err != nil {
+				return err
+			}
+			if slices.Contains(c.retryOn, resp.StatusCode) {
+				return &resilience.StatusError{StatusCode: resp.StatusCode, RetryAfter: retryAfter(resp.Header)}
+			}
+			return nil
 		})
 	} else {
-		lastErr = doOnce()
+		lastErr = attempt()
+	}
+	if c.transportErrors != nil {
+		for i, kind := range transportErrs {
+			// Every transport error but one that ended the request was retried.
+			retried := i < len(transportErrs)-1 || resilience.TransportErrorKind(lastErr) == ""
+			c.transportErrors.Inc(kind, retried)
+		}
 	}
 
-	// Report to circuit breaker.
+	// Report to circuit breaker. A retryable status that outlasted the
+	// retries counts as a failure, but its response is still returned.
 	if cbDone != nil {
 		cbDone(lastErr == nil)
 	}
+	var statusErr *resilience.StatusError
+	if errors.As(lastErr, &statusErr) {
+		lastErr = nil
+	} else if lastErr != nil && resp != nil {
+		resp.Body.Close()
+		resp = nil
+	}
+	noteUpstreamResult(ctx, resp, lastErr, attempts)
 
 	if lastErr != nil {
 		return nil, lastErr
 	}
+	// Only responses to requests that offered compression are decoded;
+	// anything else passes through untouched.
+	if headers.Get("Accept-Encoding") != "" {
+		if err := decompressBody(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	if err := c.extendResponse(ctx, resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
 	return resp, nil
 }
+
+// retryAfter returns how long a response asks to be retried after, from
+// OpenAI's retry-after-ms or Retry-After in seconds or as a date, or 0.
+func retryAfter(h http.Header) time.Duration {
+	if v := h.Get("Retry-After-Ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/sertdev/pxbin/internal/logging"
+	"github.com/sertdev/pxbin/internal/resilience"
+)
+
+// UpstreamObserver is told about every request log entry that names the
+// upstream which served it, for per-upstream metrics.
+type UpstreamObserver interface {
+	ObserveUpstream(e *logging.LogEntry)
+}
+
+// SetUpstreamObserver sets an optional observer of upstream requests.
+func (h *Handler) SetUpstreamObserver(o UpstreamObserver) {
+	h.upstreamObserver = o
+}
+
+// observeUpstream passes e to the upstream observer, if any.
+func (h *Handler) observeUpstream(e *logging.LogEntry) {
+	if h.upstreamObserver != nil && e.UpstreamID != nil {
+		h.upstreamObserver.ObserveUpstream(e)
+	}
+}
+
+// CircuitBreakerStates returns the circuit breaker state of every upstream
+// with a client that has one.
+func (h *Handler) CircuitBreakerStates() map[uuid.UUID]resilience.State {
+	return h.clients.breakerStates()
+}
+
+func (c *ClientCache) breakerStates() map[uuid.UUID]resilience.State {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	states := make(map[uuid.UUID]resilience.State, len(c.clients))
+	for id, cached := range c.clients {
+		if cached.client.cb != nil {
+			states[id] = cached.client.cb.State()
+		}
+	}
+	return states
+}
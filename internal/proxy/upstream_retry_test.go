@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/resilience"
+)
+
+func TestRetryableStatusReplayed(t *testing.T) {
+	var calls atomic.Int32
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, b)
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After-Ms", "20")
+			w.WriteHeader(529)
+			w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {}\n\n"))
+	}))
+	defer srv.Close()
+
+	c := NewUpstreamClient(srv.URL, "sk-test", &UpstreamOpts{
+		RetryOpts:        resilience.RetryOpts{MaxAttempts: 3, BaseDelay: time.Millisecond},
+		RetryStatusCodes: []int{429, 500, 529},
+	})
+	f := &failover{}
+	ctx := context.WithValue(context.Background(), failoverKey{}, f)
+
+	start := time.Now()
+	resp, err := c.Do(ctx, "POST", "/v1/chat/completions", bytes.NewReader([]byte(`{"stream":true}`)), nil)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Error("retried before the upstream's Retry-After")
+	}
+	if f.attempts != 2 {
+		t.Errorf("attempts = %d, want 2", f.attempts)
+	}
+	if len(bodies) != 2 || !bytes.Equal(bodies[0], bodies[1]) {
+		t.Errorf("replayed bodies = %q, want the same body twice", bodies)
+	}
+}
+
+func TestRetryableStatusBudgetExhausted(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c := NewUpstreamClient(srv.URL, "sk-test", &UpstreamOpts{
+		RetryOpts:        resilience.RetryOpts{MaxAttempts: 2, BaseDelay: time.Millisecond},
+		RetryStatusCodes: []int{429},
+		RetryBudgetRatio: 0.1,
+	})
+
+	// Once the budget's burst is spent, requests are sent once and get
+	// the upstream's 429.
+	for range 20 {
+		resp, err := c.Do(context.Background(), "POST", "/v1/chat/completions", bytes.NewReader([]byte(`{}`)), nil)
+		if err != nil {
+			t.Fatalf("Do: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("status = %d, want 429", resp.StatusCode)
+		}
+	}
+	if n := calls.Load(); n >= 40 || n <= 20 {
+		t.Errorf("upstream called %d times for 20 requests, want some but not all retried", n)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		want   time.Duration
+	}{
+		{http.Header{}, 0},
+		{http.Header{"Retry-After": {"3"}}, 3 * time.Second},
+		{http.Header{"Retry-After": {"3"}, "Retry-After-Ms": {"1500"}}, 1500 * time.Millisecond},
+		{http.Header{"Retry-After": {"soon"}}, 0},
+		{http.Header{"Retry-After": {time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)}}, 0},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.header); got != tt.want {
+			t.Errorf("retryAfter(%v) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+
+	future := http.Header{"Retry-After": {time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}}
+	if got := retryAfter(future); got <= 58*time.Second || got > time.Minute {
+		t.Errorf("retryAfter(date in a minute) = %v", got)
+	}
+}
@@ -0,0 +1,18 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/sertdev/pxbin/internal/vertex"
+)
+
+// withVertex returns a copy of the client that sends its requests to the
+// Vertex AI upstream t, authorized with t's access tokens. The copy shares
+// the transport and circuit breaker.
+func (c *UpstreamClient) withVertex(t *vertex.Target) *UpstreamClient {
+	cp := *c
+	cp.baseURL = t.BaseURL
+	cp.vertex = t
+	cp.client = &http.Client{Transport: t.Transport(c.client.Transport), Timeout: c.client.Timeout}
+	return &cp
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+	"github.com/sertdev/pxbin/internal/vertex"
+)
+
+// UpstreamProbe is the result of probing one upstream during warmup.
+type UpstreamProbe struct {
+	UpstreamID uuid.UUID `json:"upstream_id"`
+	Healthy    bool      `json:"healthy"`
+	LatencyMS  int64     `json:"latency_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// WarmUpstreams builds the client for every upstream in the model cache, so
+// the first request reuses a ready transport, and returns how many it built.
+// With probe set, it also sends GET /v1/models to each upstream in parallel,
+// which opens a pooled connection (DNS, TCP and TLS) ahead of real traffic.
+// Probes bypass the circuit breaker so a slow start cannot trip it.
+func (h *Handler) WarmUpstreams(ctx context.Context, probe bool) (int, []UpstreamProbe) {
+	upstreams := h.modelCache.upstreams()
+	clients := make([]*UpstreamClient, len(upstreams))
+	for i, mw := range upstreams {
+		clients[i] = h.clients.Get(*mw.UpstreamID, mw.UpstreamBaseURL, mw.UpstreamAPIKey, mw.UpstreamResilience)
+		if mw.UpstreamFormat == vertex.Format {
+			if target, err := h.vertex.Get(*mw.UpstreamID, mw.UpstreamBaseURL, mw.UpstreamAPIKey); err == nil {
+				clients[i] = clients[i].withVertex(target)
+			}
+		}
+	}
+	if !probe {
+		return len(upstreams), nil
+	}
+
+	probes := make([]UpstreamProbe, len(upstreams))
+	var wg sync.WaitGroup
+	for i, mw := range upstreams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := clients[i].probe(ctx, mw.UpstreamFormat)
+			probes[i] = UpstreamProbe{
+				UpstreamID: *mw.UpstreamID,
+				Healthy:    err == nil,
+				LatencyMS:  time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				probes[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+	return len(upstreams), probes
+}
+
+// upstreams returns one cached model per distinct upstream.
+func (c *ModelCache) upstreams() []*store.ModelWithUpstream {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	seen := make(map[uuid.UUID]bool)
+	var out []*store.ModelWithUpstream
+	for _, entry := range c.items {
+		if entry.mw == nil || entry.mw.UpstreamID == nil || seen[*entry.mw.UpstreamID] {
+			continue
+		}
+		seen[*entry.mw.UpstreamID] = true
+		out = append(out, entry.mw)
+	}
+	return out
+}
+
+// probe lists the upstream's models, draining the response so the
+// connection goes back to the pool. Vertex AI upstreams list none; they
+// are probed by fetching an access token.
+func (c *UpstreamClient) probe(ctx context.Context, format string) error {
+	if format == vertex.Format {
+		if c.vertex == nil {
+			return errors.New("invalid Vertex AI base URL or service account key")
+		}
+		_, err := c.vertex.Token(ctx)
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/v1/models", nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	if format == "anthropic" {
+		req.Header.Set("X-Api-Key", c.apiKey)
+		req.Header.Set("Anthropic-Version", "2023-06-01")
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("models endpoint returned %d", resp.StatusCode)
+	}
+	return nil
+}
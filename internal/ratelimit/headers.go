@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Hints describe a rejection in the headers SDKs read to schedule their
+// automatic retries: Retry-After and retry-after-ms, the OpenAI
+// x-ratelimit-*-requests headers, the Anthropic
+// anthropic-ratelimit-requests-* headers, and x-should-retry.
+type Hints struct {
+	Limit      int // 0 omits the limit headers
+	Remaining  int64
+	Reset      time.Duration // until the limit is replenished
+	RetryAfter time.Duration
+	// NoRetry tells SDKs not to retry on their own because the limit only
+	// resets long after their backoff gives up, e.g. an exhausted budget.
+	NoRetry bool
+}
+
+// Hints returns the headers for a rejection by d.
+func (d Decision) Hints() Hints {
+	return Hints{Limit: d.Limit, Remaining: d.Remaining, Reset: d.Reset, RetryAfter: d.RetryAfter}
+}
+
+// Set adds the hints to h; now is when the request was rejected.
+func (hints Hints) Set(h http.Header, now time.Time) {
+	retry := max(hints.RetryAfter, time.Millisecond)
+	h.Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+	h.Set("Retry-After-Ms", strconv.FormatInt(retry.Milliseconds(), 10))
+	h.Set("X-Should-Retry", strconv.FormatBool(!hints.NoRetry))
+
+	remaining := strconv.FormatInt(hints.Remaining, 10)
+	reset := max(hints.Reset, hints.RetryAfter)
+	h.Set("X-Ratelimit-Remaining-Requests", remaining)
+	h.Set("X-Ratelimit-Reset-Requests", reset.Round(time.Millisecond).String())
+	h.Set("Anthropic-Ratelimit-Requests-Remaining", remaining)
+	h.Set("Anthropic-Ratelimit-Requests-Reset", now.Add(reset).UTC().Format(time.RFC3339))
+	if hints.Limit > 0 {
+		limit := strconv.Itoa(hints.Limit)
+		h.Set("X-Ratelimit-Limit-Requests", limit)
+		h.Set("Anthropic-Ratelimit-Requests-Limit", limit)
+	}
+}
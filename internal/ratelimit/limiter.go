@@ -1,32 +1,78 @@
 package ratelimit
 
 import (
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// RejectedCounter is an interface for reporting rate-limited requests.
+type RejectedCounter interface {
+	Inc()
+}
+
 // bucket is a lock-free token bucket for a single key.
 type bucket struct {
 	tokens     atomic.Int64
 	lastRefill atomic.Int64 // unix nanoseconds
 	lastSeen   atomic.Int64 // unix nanoseconds for cleanup
+	allowed    atomic.Uint64
+	rejected   atomic.Uint64
 }
 
-// Limiter provides per-key token-bucket rate limiting using sync.Map for
+// Limiter is a per-key token-bucket rate limiter. MemoryLimiter keeps the
+// buckets in process; RedisLimiter shares them between replicas.
+type Limiter interface {
+	// Take consumes a token of key's bucket if it has one, returning the
+	// bucket's state for the rate limit headers of the response.
+	Take(key string) Decision
+	// Tokens returns the tokens key has right now without consuming one.
+	Tokens(key string) int64
+	Stats() Stats
+	// Standings returns every live bucket, most rejected first.
+	Standings() []Standing
+	SetRejectedCounter(c RejectedCounter)
+	Close()
+}
+
+// MemoryLimiter is a Limiter for a single instance, using sync.Map for
 // lock-free reads on the hot path.
-type Limiter struct {
-	rps     float64
-	burst   int
-	buckets sync.Map // map[string]*bucket
-	done    chan struct{}
-	wg      sync.WaitGroup
+type MemoryLimiter struct {
+	rps      float64
+	burst    int
+	buckets  sync.Map // map[string]*bucket
+	allowed  atomic.Uint64
+	rejected atomic.Uint64
+	counter  atomic.Value // RejectedCounter
+	done     chan struct{}
+	wg       sync.WaitGroup
 }
 
-// NewLimiter creates a rate limiter. rps is the refill rate (tokens per
+// Stats are a limiter's totals since it was created.
+type Stats struct {
+	RPS      float64 `json:"rps"`
+	Burst    int     `json:"burst"`
+	Allowed  uint64  `json:"allowed"`
+	Rejected uint64  `json:"rejected"`
+	Keys     int     `json:"keys"`       // keys with a live bucket
+	Empty    int     `json:"empty_keys"` // keys with no token left right now
+}
+
+// Standing is one key's bucket. Counts cover the bucket's lifetime; buckets
+// idle for five minutes are evicted and start over.
+type Standing struct {
+	Key      string    `json:"key"`
+	Tokens   int64     `json:"tokens"`
+	Allowed  uint64    `json:"allowed"`
+	Rejected uint64    `json:"rejected"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// NewMemoryLimiter creates an in-process rate limiter. rps is the refill rate (tokens per
 // second), burst is the maximum token count.
-func NewLimiter(rps float64, burst int) *Limiter {
-	l := &Limiter{
+func NewMemoryLimiter(rps float64, burst int) *MemoryLimiter {
+	l := &MemoryLimiter{
 		rps:   rps,
 		burst: burst,
 		done:  make(chan struct{}),
@@ -36,10 +82,39 @@ func NewLimiter(rps float64, burst int) *Limiter {
 	return l
 }
 
+// Decision is the outcome of Take with the bucket's state after it.
+type Decision struct {
+	Allowed    bool
+	Limit      int           // bucket size (burst)
+	Remaining  int64         // tokens left
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next token
+}
+
 // Allow returns true if the request for key is allowed.
-func (l *Limiter) Allow(key string) bool {
+func (l *MemoryLimiter) Allow(key string) bool {
+	_, allowed := l.take(key, time.Now().UnixNano())
+	return allowed
+}
+
+// Take is Allow returning the state of key's bucket as well, for the rate
+// limit headers of the response.
+func (l *MemoryLimiter) Take(key string) Decision {
 	now := time.Now().UnixNano()
+	b, allowed := l.take(key, now)
+	d := Decision{Allowed: allowed, Limit: l.burst, Remaining: max(b.tokens.Load(), 0)}
+	if l.rps > 0 {
+		perToken := time.Duration(float64(time.Second) / l.rps)
+		sinceRefill := time.Duration(now - b.lastRefill.Load())
+		d.RetryAfter = max(perToken-sinceRefill, 0)
+		if missing := int64(l.burst) - d.Remaining; missing > 0 {
+			d.Reset = d.RetryAfter + time.Duration(missing-1)*perToken
+		}
+	}
+	return d
+}
 
+func (l *MemoryLimiter) take(key string, now int64) (*bucket, bool) {
 	val, loaded := l.buckets.Load(key)
 	if !loaded {
 		b := &bucket{}
@@ -48,7 +123,7 @@ func (l *Limiter) Allow(key string) bool {
 		b.lastSeen.Store(now)
 		val, loaded = l.buckets.LoadOrStore(key, b)
 		if !loaded {
-			return true
+			return b, l.record(b, true)
 		}
 	}
 
@@ -87,22 +162,101 @@ func (l *Limiter) Allow(key string) bool {
 	for {
 		current := b.tokens.Load()
 		if current <= 0 {
-			return false
+			return b, l.record(b, false)
 		}
 		if b.tokens.CompareAndSwap(current, current-1) {
-			return true
+			return b, l.record(b, true)
 		}
 	}
 }
 
+// record counts a decision for b and returns it.
+func (l *MemoryLimiter) record(b *bucket, allowed bool) bool {
+	if allowed {
+		b.allowed.Add(1)
+		l.allowed.Add(1)
+		return true
+	}
+	b.rejected.Add(1)
+	l.rejected.Add(1)
+	if c, ok := l.counter.Load().(RejectedCounter); ok {
+		c.Inc()
+	}
+	return false
+}
+
+// SetRejectedCounter sets an optional metrics counter for rejected requests.
+func (l *MemoryLimiter) SetRejectedCounter(c RejectedCounter) {
+	l.counter.Store(c)
+}
+
+// tokensAt returns the tokens b would hold at now, without refilling it.
+func (l *MemoryLimiter) tokensAt(b *bucket, now int64) int64 {
+	elapsed := float64(now-b.lastRefill.Load()) / float64(time.Second)
+	tokens := b.tokens.Load()
+	if elapsed > 0 {
+		tokens += int64(elapsed * l.rps)
+	}
+	return min(tokens, int64(l.burst))
+}
+
+// Tokens returns the tokens key has right now without consuming one. Keys
+// with no bucket have a full burst.
+func (l *MemoryLimiter) Tokens(key string) int64 {
+	val, ok := l.buckets.Load(key)
+	if !ok {
+		return int64(l.burst)
+	}
+	return l.tokensAt(val.(*bucket), time.Now().UnixNano())
+}
+
+// Stats returns the limiter's totals and how many keys are out of tokens.
+func (l *MemoryLimiter) Stats() Stats {
+	s := Stats{RPS: l.rps, Burst: l.burst, Allowed: l.allowed.Load(), Rejected: l.rejected.Load()}
+	now := time.Now().UnixNano()
+	l.buckets.Range(func(_, val any) bool {
+		s.Keys++
+		if l.tokensAt(val.(*bucket), now) <= 0 {
+			s.Empty++
+		}
+		return true
+	})
+	return s
+}
+
+// Standings returns every live bucket, most rejected first, then most
+// recently seen.
+func (l *MemoryLimiter) Standings() []Standing {
+	now := time.Now().UnixNano()
+	var out []Standing
+	l.buckets.Range(func(key, val any) bool {
+		b := val.(*bucket)
+		out = append(out, Standing{
+			Key:      key.(string),
+			Tokens:   l.tokensAt(b, now),
+			Allowed:  b.allowed.Load(),
+			Rejected: b.rejected.Load(),
+			LastSeen: time.Unix(0, b.lastSeen.Load()),
+		})
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Rejected != out[j].Rejected {
+			return out[i].Rejected > out[j].Rejected
+		}
+		return out[i].LastSeen.After(out[j].LastSeen)
+	})
+	return out
+}
+
 // Close stops the cleanup goroutine.
-func (l *Limiter) Close() {
+func (l *MemoryLimiter) Close() {
 	close(l.done)
 	l.wg.Wait()
 }
 
 // cleanup evicts stale buckets every 60 seconds.
-func (l *Limiter) cleanup() {
+func (l *MemoryLimiter) cleanup() {
 	defer l.wg.Done()
 	ticker := time.NewTicker(60 * time.Second)
 	defer ticker.Stop()
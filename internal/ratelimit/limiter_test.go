@@ -1,12 +1,14 @@
 package ratelimit
 
 import (
+	"net/http"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestAllowBasic(t *testing.T) {
-	l := NewLimiter(10, 10)
+	l := NewMemoryLimiter(10, 10)
 	defer l.Close()
 
 	// Should allow up to burst requests.
@@ -23,7 +25,7 @@ func TestAllowBasic(t *testing.T) {
 }
 
 func TestAllowDifferentKeys(t *testing.T) {
-	l := NewLimiter(10, 5)
+	l := NewMemoryLimiter(10, 5)
 	defer l.Close()
 
 	// Exhaust key1.
@@ -38,7 +40,7 @@ func TestAllowDifferentKeys(t *testing.T) {
 }
 
 func TestAllowConcurrent(t *testing.T) {
-	l := NewLimiter(1000, 100)
+	l := NewMemoryLimiter(1000, 100)
 	defer l.Close()
 
 	var allowed, denied int64
@@ -73,7 +75,7 @@ func TestAllowConcurrent(t *testing.T) {
 }
 
 func TestBurstBehavior(t *testing.T) {
-	l := NewLimiter(1, 20)
+	l := NewMemoryLimiter(1, 20)
 	defer l.Close()
 
 	// Burst of 20 should all succeed.
@@ -88,3 +90,100 @@ func TestBurstBehavior(t *testing.T) {
 		t.Fatal("request beyond burst should be denied")
 	}
 }
+
+func TestStatsAndStandings(t *testing.T) {
+	l := NewMemoryLimiter(0.001, 3)
+	defer l.Close()
+
+	for i := 0; i < 5; i++ {
+		l.Allow("busy")
+	}
+	l.Allow("quiet")
+
+	s := l.Stats()
+	if s.Allowed != 4 || s.Rejected != 2 || s.Keys != 2 || s.Empty != 1 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+
+	standings := l.Standings()
+	if len(standings) != 2 || standings[0].Key != "busy" {
+		t.Fatalf("expected busy first, got %+v", standings)
+	}
+	if standings[0].Allowed != 3 || standings[0].Rejected != 2 || standings[0].Tokens != 0 {
+		t.Fatalf("unexpected busy standing: %+v", standings[0])
+	}
+	if standings[1].Tokens != 2 {
+		t.Fatalf("expected quiet to have 2 tokens left, got %d", standings[1].Tokens)
+	}
+}
+
+func TestTokensDoesNotConsume(t *testing.T) {
+	l := NewMemoryLimiter(0.001, 2)
+	defer l.Close()
+
+	if got := l.Tokens("new"); got != 2 {
+		t.Fatalf("expected a full burst for an unseen key, got %d", got)
+	}
+	l.Allow("k")
+	for i := 0; i < 3; i++ {
+		if got := l.Tokens("k"); got != 1 {
+			t.Fatalf("expected 1 token left, got %d", got)
+		}
+	}
+}
+
+func TestTakeHints(t *testing.T) {
+	l := NewMemoryLimiter(0.5, 2) // a token every 2s
+	defer l.Close()
+
+	if d := l.Take("k"); !d.Allowed || d.Remaining != 1 || d.Limit != 2 {
+		t.Fatalf("unexpected first decision: %+v", d)
+	}
+	l.Take("k")
+	d := l.Take("k")
+	if d.Allowed || d.Remaining != 0 {
+		t.Fatalf("expected a rejection with no tokens left, got %+v", d)
+	}
+	if d.RetryAfter <= time.Second || d.RetryAfter > 2*time.Second {
+		t.Fatalf("expected the next token within 2s, got %v", d.RetryAfter)
+	}
+	if d.Reset != d.RetryAfter+2*time.Second {
+		t.Fatalf("expected a full bucket one token after the next, got %v", d.Reset)
+	}
+
+	h := http.Header{}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	Hints{Limit: 2, RetryAfter: 1500 * time.Millisecond, Reset: 3500 * time.Millisecond}.Set(h, now)
+	for name, want := range map[string]string{
+		"Retry-After":                            "2",
+		"Retry-After-Ms":                         "1500",
+		"X-Should-Retry":                         "true",
+		"X-Ratelimit-Limit-Requests":             "2",
+		"X-Ratelimit-Remaining-Requests":         "0",
+		"X-Ratelimit-Reset-Requests":             "3.5s",
+		"Anthropic-Ratelimit-Requests-Remaining": "0",
+		"Anthropic-Ratelimit-Requests-Reset":     "2026-01-01T00:00:03Z",
+	} {
+		if got := h.Get(name); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+type countingCounter struct{ n int }
+
+func (c *countingCounter) Inc() { c.n++ }
+
+func TestRejectedCounter(t *testing.T) {
+	l := NewMemoryLimiter(0.001, 1)
+	defer l.Close()
+	c := &countingCounter{}
+	l.SetRejectedCounter(c)
+
+	l.Allow("k")
+	l.Allow("k")
+	l.Allow("k")
+	if c.n != 2 {
+		t.Fatalf("expected 2 rejections, got %d", c.n)
+	}
+}
@@ -0,0 +1,258 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/redis"
+)
+
+const (
+	redisBucketPrefix = "pxbin:ratelimit:"
+
+	// redisBucketTTL evicts idle buckets, like MemoryLimiter's cleanup.
+	redisBucketTTL = 5 * time.Minute
+	// redisTimeout bounds how long a request waits on Redis before it is
+	// let through.
+	redisTimeout = 250 * time.Millisecond
+)
+
+// takeScript refills and takes from a bucket atomically. A bucket is a hash
+// of its tokens t (fractional), the time of its last refill ts in unix
+// milliseconds, and its allowed and rejected counts a and r. It returns
+// whether a token was taken and the tokens left.
+const takeScript = `
+local rps, burst, now, ttl = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+local b = redis.call('HMGET', KEYS[1], 't', 'ts')
+local tokens, ts = tonumber(b[1]), tonumber(b[2])
+if tokens == nil or ts == nil then
+  tokens, ts = burst, now
+end
+tokens = math.min(burst, tokens + math.max(now - ts, 0) * rps / 1000)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 't', tostring(tokens), 'ts', tostring(math.max(now, ts)))
+if allowed == 1 then
+  redis.call('HINCRBY', KEYS[1], 'a', 1)
+else
+  redis.call('HINCRBY', KEYS[1], 'r', 1)
+end
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {allowed, tostring(tokens)}
+`
+
+var takeScriptSHA = func() string {
+	sum := sha1.Sum([]byte(takeScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// RedisLimiter is a Limiter whose buckets live in Redis, so every replica
+// using the same Redis enforces one limit per key. Buckets are refilled and
+// taken from in a Lua script, atomically. If Redis cannot be reached,
+// requests are let through and the error is logged.
+//
+// Stats counts the decisions of this instance; Standings and the key counts
+// cover every replica.
+type RedisLimiter struct {
+	client   *redis.Client
+	rps      float64
+	burst    int
+	allowed  atomic.Uint64
+	rejected atomic.Uint64
+	counter  atomic.Value // RejectedCounter
+	loggedAt atomic.Int64 // unix nanoseconds of the last logged Redis error
+}
+
+// NewRedisLimiter creates a rate limiter sharing its buckets through
+// client. rps is the refill rate (tokens per second), burst is the maximum
+// token count.
+func NewRedisLimiter(client *redis.Client, rps float64, burst int) *RedisLimiter {
+	return &RedisLimiter{client: client, rps: rps, burst: burst}
+}
+
+// Take implements Limiter.
+func (l *RedisLimiter) Take(key string) Decision {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	allowed, tokens, err := l.take(ctx, key, time.Now())
+	if err != nil {
+		l.logError(err)
+		allowed, tokens = true, float64(l.burst)
+	}
+	l.record(allowed)
+	return l.decision(allowed, tokens)
+}
+
+func (l *RedisLimiter) take(ctx context.Context, key string, now time.Time) (bool, float64, error) {
+	args := []string{
+		"1", redisBucketPrefix + key,
+		strconv.FormatFloat(l.rps, 'f', -1, 64),
+		strconv.Itoa(l.burst),
+		strconv.FormatInt(now.UnixMilli(), 10),
+		strconv.FormatInt(redisBucketTTL.Milliseconds(), 10),
+	}
+	reply, err := l.client.Do(ctx, append([]string{"EVALSHA", takeScriptSHA}, args...)...)
+	// The script is loaded on first use, and again after a Redis restart.
+	var rerr redis.Error
+	if errors.As(err, &rerr) && strings.HasPrefix(string(rerr), "NOSCRIPT") {
+		reply, err = l.client.Do(ctx, append([]string{"EVAL", takeScript}, args...)...)
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	parts, ok := reply.([]any)
+	if !ok || len(parts) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit script reply %#v", reply)
+	}
+	allowed, err := redis.Int(parts[0], nil)
+	if err != nil {
+		return false, 0, err
+	}
+	s, _ := parts[1].(string)
+	tokens, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return false, 0, err
+	}
+	return allowed == 1, tokens, nil
+}
+
+// decision describes a bucket holding tokens after a take.
+func (l *RedisLimiter) decision(allowed bool, tokens float64) Decision {
+	d := Decision{Allowed: allowed, Limit: l.burst, Remaining: int64(max(math.Floor(tokens), 0))}
+	if l.rps > 0 {
+		toNext := (1 - (tokens - math.Floor(tokens))) / l.rps
+		d.RetryAfter = time.Duration(toNext * float64(time.Second))
+		if missing := float64(l.burst) - tokens; missing > 0 {
+			d.Reset = time.Duration(missing / l.rps * float64(time.Second))
+		}
+	}
+	return d
+}
+
+// record counts a decision of this instance.
+func (l *RedisLimiter) record(allowed bool) {
+	if allowed {
+		l.allowed.Add(1)
+		return
+	}
+	l.rejected.Add(1)
+	if c, ok := l.counter.Load().(RejectedCounter); ok {
+		c.Inc()
+	}
+}
+
+// logError logs a Redis failure at most every ten seconds, since every
+// request runs into it while Redis is down.
+func (l *RedisLimiter) logError(err error) {
+	now := time.Now().UnixNano()
+	last := l.loggedAt.Load()
+	if now-last < int64(10*time.Second) || !l.loggedAt.CompareAndSwap(last, now) {
+		return
+	}
+	log.Printf("rate limit: redis unavailable, letting requests through: %v", err)
+}
+
+// SetRejectedCounter sets an optional metrics counter for rejected requests.
+func (l *RedisLimiter) SetRejectedCounter(c RejectedCounter) {
+	l.counter.Store(c)
+}
+
+// Tokens implements Limiter. Keys with no bucket, or whose bucket cannot be
+// read, have a full burst.
+func (l *RedisLimiter) Tokens(key string) int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	st, ok, err := l.bucket(ctx, redisBucketPrefix+key, time.Now())
+	if err != nil || !ok {
+		return int64(l.burst)
+	}
+	return st.Tokens
+}
+
+// bucket reads the bucket stored at redisKey as of now.
+func (l *RedisLimiter) bucket(ctx context.Context, redisKey string, now time.Time) (Standing, bool, error) {
+	reply, err := l.client.Do(ctx, "HMGET", redisKey, "t", "ts", "a", "r")
+	if err != nil {
+		return Standing{}, false, err
+	}
+	fields, _ := reply.([]any)
+	if len(fields) != 4 || fields[0] == nil || fields[1] == nil {
+		return Standing{}, false, nil
+	}
+	s, _ := fields[0].(string)
+	tokens, _ := strconv.ParseFloat(s, 64)
+	ts, _ := redis.Int(fields[1], nil)
+	allowed, _ := redis.Int(fields[2], nil)
+	rejected, _ := redis.Int(fields[3], nil)
+
+	if elapsed := now.UnixMilli() - ts; elapsed > 0 {
+		tokens += float64(elapsed) * l.rps / 1000
+	}
+	return Standing{
+		Key:      strings.TrimPrefix(redisKey, redisBucketPrefix),
+		Tokens:   int64(min(tokens, float64(l.burst))),
+		Allowed:  uint64(allowed),
+		Rejected: uint64(rejected),
+		LastSeen: time.UnixMilli(ts),
+	}, true, nil
+}
+
+// Stats implements Limiter. Allowed and Rejected count this instance's
+// decisions since it started.
+func (l *RedisLimiter) Stats() Stats {
+	s := Stats{RPS: l.rps, Burst: l.burst, Allowed: l.allowed.Load(), Rejected: l.rejected.Load()}
+	for _, st := range l.Standings() {
+		s.Keys++
+		if st.Tokens <= 0 {
+			s.Empty++
+		}
+	}
+	return s
+}
+
+// Standings implements Limiter, listing the buckets of every replica.
+func (l *RedisLimiter) Standings() []Standing {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	keys, err := l.client.Scan(ctx, redisBucketPrefix+"*")
+	if err != nil {
+		l.logError(err)
+		return nil
+	}
+	now := time.Now()
+	var out []Standing
+	for _, k := range keys {
+		st, ok, err := l.bucket(ctx, k, now)
+		if err != nil {
+			l.logError(err)
+			return nil
+		}
+		if ok {
+			out = append(out, st)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Rejected != out[j].Rejected {
+			return out[i].Rejected > out[j].Rejected
+		}
+		return out[i].LastSeen.After(out[j].LastSeen)
+	})
+	return out
+}
+
+// Close implements Limiter. The Redis client is closed by its owner.
+func (l *RedisLimiter) Close() {}
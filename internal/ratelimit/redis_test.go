@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/redis"
+)
+
+func TestRedisLimiterDecision(t *testing.T) {
+	l := &RedisLimiter{rps: 2, burst: 4}
+	d := l.decision(true, 2.5)
+	if !d.Allowed || d.Limit != 4 || d.Remaining != 2 {
+		t.Fatalf("unexpected decision: %+v", d)
+	}
+	if d.RetryAfter != 250*time.Millisecond || d.Reset != 750*time.Millisecond {
+		t.Fatalf("expected the next token in 250ms and a full bucket in 750ms, got %v and %v", d.RetryAfter, d.Reset)
+	}
+}
+
+func TestRedisLimiterFailsOpen(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	client, err := redis.NewClient("redis://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	l := NewRedisLimiter(client, 1, 1)
+	for i := 0; i < 3; i++ {
+		if d := l.Take("key"); !d.Allowed {
+			t.Fatalf("expected requests to be let through while Redis is down, got %+v", d)
+		}
+	}
+	if l.Tokens("key") != 1 {
+		t.Fatal("expected a full bucket while Redis is down")
+	}
+}
+
+// TestRedisLimiterShared runs against a real Redis and is skipped unless
+// PXBIN_TEST_REDIS_URL is set.
+func TestRedisLimiterShared(t *testing.T) {
+	url := os.Getenv("PXBIN_TEST_REDIS_URL")
+	if url == "" {
+		t.Skip("PXBIN_TEST_REDIS_URL not set")
+	}
+	newLimiter := func() *RedisLimiter {
+		client, err := redis.NewClient(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { client.Close() })
+		return NewRedisLimiter(client, 0.001, 3)
+	}
+	a, b := newLimiter(), newLimiter()
+	key := uuid.NewString()
+
+	// Two replicas share one bucket.
+	for i, l := range []*RedisLimiter{a, b, a} {
+		if d := l.Take(key); !d.Allowed || d.Remaining != int64(2-i) {
+			t.Fatalf("request %d: expected to be allowed with %d left, got %+v", i, 2-i, d)
+		}
+	}
+	if d := b.Take(key); d.Allowed {
+		t.Fatal("expected the shared burst to be spent")
+	}
+	if a.Tokens(key) != 0 {
+		t.Fatal("expected no tokens left")
+	}
+
+	var found bool
+	for _, st := range a.Standings() {
+		if st.Key == key {
+			found = st.Allowed == 3 && st.Rejected == 1
+		}
+	}
+	if !found {
+		t.Fatal("expected the bucket's counts across replicas in the standings")
+	}
+}
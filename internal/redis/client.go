@@ -0,0 +1,314 @@
+// Package redis is a minimal Redis client speaking RESP2 over a pool of
+// connections. It covers the handful of commands pxbin uses for state shared
+// between replicas and is not a general-purpose client.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is an error reply from the server.
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// ErrClosed is returned by commands sent after Close.
+var ErrClosed = errors.New("redis: client closed")
+
+// Client sends commands over a pool of connections, each carrying one
+// command at a time, so that a slow command such as a SCAN does not hold up
+// the others. Connections are dialled on demand, kept for reuse, and
+// dropped after I/O errors.
+type Client struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+	poolSize int
+
+	slots  chan struct{} // one token per connection that may be open
+	idle   chan *conn
+	closed chan struct{}
+}
+
+type conn struct {
+	net.Conn
+	rd *bufio.Reader
+}
+
+// NewClient parses a redis://[:password@]host[:port][/db][?pool_size=N]
+// URL. pool_size caps the connections open at once; it defaults to 10 per
+// CPU.
+func NewClient(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse redis url: %w", err)
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("parse redis url: unsupported scheme %q", u.Scheme)
+	}
+	c := &Client{addr: u.Host, timeout: 5 * time.Second, poolSize: 10 * runtime.GOMAXPROCS(0)}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("parse redis url: invalid db %q", db)
+		}
+	}
+	if v := u.Query().Get("pool_size"); v != "" {
+		if c.poolSize, err = strconv.Atoi(v); err != nil || c.poolSize < 1 {
+			return nil, fmt.Errorf("parse redis url: invalid pool_size %q", v)
+		}
+	}
+	c.slots = make(chan struct{}, c.poolSize)
+	c.idle = make(chan *conn, c.poolSize)
+	c.closed = make(chan struct{})
+	return c, nil
+}
+
+// Do sends a command and returns its reply: a string for simple and bulk
+// strings, int64 for integers, []any for arrays, nil for null replies, and
+// an Error for error replies. It waits for a connection when all of the
+// pool's are busy.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	select {
+	case c.slots <- struct{}{}:
+	case <-c.closed:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-c.slots }()
+
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := cn.roundTrip(ctx, c.timeout, args)
+	var rerr Error
+	if err != nil && !errors.As(err, &rerr) {
+		// The stream may be out of sync; start over on a new connection.
+		cn.Close()
+		return reply, err
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// get returns an idle connection, or dials a new one.
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case <-c.closed:
+		return nil, ErrClosed
+	default:
+	}
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+		return c.connect(ctx)
+	}
+}
+
+// put keeps a healthy connection for reuse, or closes it once the client
+// is closed.
+func (c *Client) put(cn *conn) {
+	select {
+	case <-c.closed:
+		cn.Close()
+		return
+	default:
+	}
+	select {
+	case c.idle <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+// Scan returns every key matching pattern.
+func (c *Client) Scan(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := c.Do(ctx, "SCAN", cursor, "MATCH", pattern, "COUNT", "1000")
+		if err != nil {
+			return nil, fmt.Errorf("scan %s: %w", pattern, err)
+		}
+		parts, ok := reply.([]any)
+		if !ok || len(parts) != 2 {
+			return nil, fmt.Errorf("scan %s: unexpected reply", pattern)
+		}
+		cursor, _ = parts[0].(string)
+		batch, _ := parts[1].([]any)
+		for _, k := range batch {
+			if key, ok := k.(string); ok {
+				keys = append(keys, key)
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			return keys, nil
+		}
+	}
+}
+
+// Close closes the idle connections; those in use are closed when their
+// command completes. Commands sent afterwards fail with ErrClosed.
+func (c *Client) Close() error {
+	select {
+	case <-c.closed:
+		return nil
+	default:
+		close(c.closed)
+	}
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *Client) connect(ctx context.Context) (*conn, error) {
+	d := net.Dialer{Timeout: c.timeout}
+	nc, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("redis dial: %w", err)
+	}
+	cn := &conn{Conn: nc, rd: bufio.NewReader(nc)}
+
+	if c.password != "" {
+		if _, err := cn.roundTrip(ctx, c.timeout, []string{"AUTH", c.password}); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("redis auth: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := cn.roundTrip(ctx, c.timeout, []string{"SELECT", strconv.Itoa(c.db)}); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("redis select: %w", err)
+		}
+	}
+	return cn, nil
+}
+
+func (cn *conn) roundTrip(ctx context.Context, timeout time.Duration, args []string) (any, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	cn.SetDeadline(deadline)
+
+	if _, err := cn.Write(encodeCommand(args)); err != nil {
+		return nil, fmt.Errorf("redis write: %w", err)
+	}
+	return readReply(cn.rd)
+}
+
+func encodeCommand(args []string) []byte {
+	var b []byte
+	b = append(b, '*')
+	b = strconv.AppendInt(b, int64(len(args)), 10)
+	b = append(b, '\r', '\n')
+	for _, a := range args {
+		b = append(b, '$')
+		b = strconv.AppendInt(b, int64(len(a)), 10)
+		b = append(b, '\r', '\n')
+		b = append(b, a...)
+		b = append(b, '\r', '\n')
+	}
+	return b
+}
+
+func readReply(rd *bufio.Reader) (any, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis read: %w", err)
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis read: malformed reply %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, Error(payload)
+	case ':':
+		n, err := strconv.ParseInt(payload, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis read: malformed integer %q", payload)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("redis read: malformed bulk length %q", payload)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, fmt.Errorf("redis read: %w", err)
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("redis read: malformed array length %q", payload)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			// Errors nested in arrays are returned as values.
+			item, err := readReply(rd)
+			var rerr Error
+			if err != nil && !errors.As(err, &rerr) {
+				return nil, err
+			}
+			if err != nil {
+				item = rerr
+			}
+			items[i] = item
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis read: unknown reply type %q", kind)
+	}
+}
+
+// Int converts an integer reply, as returned by Do, to an int64.
+func Int(reply any, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	switch v := reply.(type) {
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case nil:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("redis: unexpected reply type %T", reply)
+}
@@ -0,0 +1,190 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer answers a few commands from an in-memory map.
+func fakeServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var mu sync.Mutex
+	data := map[string]string{}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				rd := bufio.NewReader(conn)
+				for {
+					reply, err := readReply(rd)
+					if err != nil {
+						return
+					}
+					items := reply.([]any)
+					args := make([]string, len(items))
+					for i, it := range items {
+						args[i] = it.(string)
+					}
+					if strings.ToUpper(args[0]) == "SLEEP" {
+						ms, _ := strconv.Atoi(args[1])
+						time.Sleep(time.Duration(ms) * time.Millisecond)
+						conn.Write([]byte("+OK\r\n"))
+						continue
+					}
+					mu.Lock()
+					var out string
+					switch strings.ToUpper(args[0]) {
+					case "SET":
+						data[args[1]] = args[2]
+						out = "+OK\r\n"
+					case "GET":
+						if v, ok := data[args[1]]; ok {
+							out = "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+						} else {
+							out = "$-1\r\n"
+						}
+					case "INCR":
+						n, _ := strconv.Atoi(data[args[1]])
+						n++
+						data[args[1]] = strconv.Itoa(n)
+						out = ":" + strconv.Itoa(n) + "\r\n"
+					case "SCAN":
+						out = "*2\r\n$1\r\n0\r\n*1\r\n$3\r\nkey\r\n"
+					default:
+						out = "-ERR unknown command '" + args[0] + "'\r\n"
+					}
+					mu.Unlock()
+					conn.Write([]byte(out))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestClientCommands(t *testing.T) {
+	c, err := NewClient("redis://" + fakeServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if reply, err := c.Do(ctx, "SET", "k", "hello world"); err != nil || reply != "OK" {
+		t.Fatalf("SET: %v %v", reply, err)
+	}
+	if reply, err := c.Do(ctx, "GET", "k"); err != nil || reply != "hello world" {
+		t.Fatalf("GET: %v %v", reply, err)
+	}
+	if reply, err := c.Do(ctx, "GET", "missing"); err != nil || reply != nil {
+		t.Fatalf("GET missing: %v %v", reply, err)
+	}
+	if n, err := Int(c.Do(ctx, "INCR", "n")); err != nil || n != 1 {
+		t.Fatalf("INCR: %d %v", n, err)
+	}
+	if n, err := Int(c.Do(ctx, "INCR", "n")); err != nil || n != 2 {
+		t.Fatalf("INCR: %d %v", n, err)
+	}
+	reply, err := c.Do(ctx, "SCAN", "0")
+	if parts, ok := reply.([]any); err != nil || !ok || len(parts) != 2 || parts[0] != "0" {
+		t.Fatalf("SCAN: %#v %v", reply, err)
+	}
+	if keys, err := c.Scan(ctx, "*"); err != nil || len(keys) != 1 || keys[0] != "key" {
+		t.Fatalf("Scan: %v %v", keys, err)
+	}
+
+	// Error replies are returned as Error and keep the connection usable.
+	_, err = c.Do(ctx, "NOPE")
+	var rerr Error
+	if !errors.As(err, &rerr) || !strings.HasPrefix(string(rerr), "ERR unknown command") {
+		t.Fatalf("expected an error reply, got %v", err)
+	}
+	if reply, err := c.Do(ctx, "GET", "k"); err != nil || reply != "hello world" {
+		t.Fatalf("GET after error: %v %v", reply, err)
+	}
+}
+
+func TestClientPool(t *testing.T) {
+	c, err := NewClient("redis://" + fakeServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// A slow command holds one connection; others go out on another.
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Do(ctx, "SLEEP", "500")
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	if _, err := c.Do(ctx, "SET", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 250*time.Millisecond {
+		t.Fatalf("SET waited %v behind the slow command", d)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+	if _, err := c.Do(ctx, "GET", "k"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed after Close, got %v", err)
+	}
+}
+
+func TestClientPoolSize(t *testing.T) {
+	c, err := NewClient("redis://" + fakeServer(t) + "?pool_size=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// With one connection, a command waits for the slow one and gives up
+	// when its context does.
+	go c.Do(context.Background(), "SLEEP", "300")
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Do(ctx, "GET", "k"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected to time out waiting for the connection, got %v", err)
+	}
+}
+
+func TestNewClientURL(t *testing.T) {
+	c, err := NewClient("redis://:secret@cache.internal/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.addr != "cache.internal:6379" || c.password != "secret" || c.db != 2 {
+		t.Fatalf("unexpected client config: %+v", c)
+	}
+	if c, err := NewClient("redis://cache.internal?pool_size=4"); err != nil || c.poolSize != 4 {
+		t.Fatalf("expected pool_size 4, got %v", err)
+	}
+	if _, err := NewClient("redis://cache.internal?pool_size=0"); err == nil {
+		t.Fatal("expected an error for pool_size 0")
+	}
+	if _, err := NewClient("http://cache.internal"); err == nil {
+		t.Fatal("expected an error for a non-redis scheme")
+	}
+}
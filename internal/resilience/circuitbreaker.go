@@ -115,3 +115,18 @@ func (cb *CircuitBreaker) Allow() (done func(success bool), err error) {
 		}
 	}, nil
 }
+
+// Restore seeds the breaker with consecutive failures carried over from a
+// previous run. At or above the threshold it starts open, until Timeout
+// after lastFailure.
+func (cb *CircuitBreaker) Restore(failures int, lastFailure time.Time) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures = failures
+	cb.lastFailureTime = lastFailure
+	if failures >= cb.opts.Threshold {
+		cb.state = StateOpen
+		cb.halfOpenCount = 0
+	}
+}
@@ -117,3 +117,30 @@ func TestCircuitBreakerSuccessResets(t *testing.T) {
 		t.Fatal("circuit should still be closed after reset + 2 failures")
 	}
 }
+
+func TestCircuitBreakerRestore(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerOpts{Threshold: 3, Timeout: time.Minute})
+	cb.Restore(3, time.Now())
+	if cb.State() != StateOpen {
+		t.Fatalf("expected StateOpen, got %v", cb.State())
+	}
+
+	// Failures that are older than the timeout leave it half-open.
+	cb = NewCircuitBreaker(CircuitBreakerOpts{Threshold: 3, Timeout: time.Minute})
+	cb.Restore(5, time.Now().Add(-2*time.Minute))
+	if cb.State() != StateHalfOpen {
+		t.Fatalf("expected StateHalfOpen, got %v", cb.State())
+	}
+
+	// Below the threshold it stays closed, one failure from opening.
+	cb = NewCircuitBreaker(CircuitBreakerOpts{Threshold: 3, Timeout: time.Minute})
+	cb.Restore(2, time.Now())
+	done, err := cb.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done(false)
+	if cb.State() != StateOpen {
+		t.Fatalf("expected StateOpen, got %v", cb.State())
+	}
+}
@@ -2,8 +2,13 @@ package resilience
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"math/rand/v2"
 	"net"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -13,6 +18,10 @@ type RetryOpts struct {
 	BaseDelay   time.Duration // initial delay between retries (default 100ms)
 	MaxDelay    time.Duration // maximum delay cap (default 2s)
 	Jitter      bool          // add ±25% random jitter (default true)
+
+	// MaxRetryAfter is the longest Retry-After of a StatusError that is
+	// waited out (default 30s); a longer one ends the retries.
+	MaxRetryAfter time.Duration
 }
 
 func (o *RetryOpts) withDefaults() RetryOpts {
@@ -26,28 +35,35 @@ func (o *RetryOpts) withDefaults() RetryOpts {
 	if out.MaxDelay <= 0 {
 		out.MaxDelay = 2 * time.Second
 	}
+	if out.MaxRetryAfter <= 0 {
+		out.MaxRetryAfter = 30 * time.Second
+	}
 	return out
 }
 
 // Do retries fn with exponential backoff. Only connection-level errors
-// (net.Error) are retried — HTTP status errors should NOT be wrapped in
-// retryable errors.
+// (timeouts and transient transport errors) and StatusErrors are retried;
+// other HTTP status errors should NOT be wrapped in retryable errors.
 func Do(ctx context.Context, opts RetryOpts, fn func() error) error {
+	_, err := DoBudgeted(ctx, opts, nil, fn)
+	return err
+}
+
+// DoBudgeted is Do with retries drawn from budget, and returns how many
+// times fn was called. A nil budget allows every retry.
+func DoBudgeted(ctx context.Context, opts RetryOpts, budget *RetryBudget, fn func() error) (int, error) {
 	opts = opts.withDefaults()
+	budget.Deposit()
 
 	var lastErr error
 	for attempt := 0; attempt < opts.MaxAttempts; attempt++ {
 		lastErr = fn()
 		if lastErr == nil {
-			return nil
-		}
-
-		if !IsRetryable(lastErr) {
-			return lastErr
+			return attempt + 1, nil
 		}
 
-		if attempt == opts.MaxAttempts-1 {
-			break
+		if !IsRetryable(lastErr) || attempt == opts.MaxAttempts-1 {
+			return attempt + 1, lastErr
 		}
 
 		delay := opts.BaseDelay * (1 << uint(attempt))
@@ -62,24 +78,83 @@ func Do(ctx context.Context, opts RetryOpts, fn func() error) error {
 			delay = time.Duration(float64(delay) + delta)
 		}
 
+		// The upstream's own Retry-After replaces the backoff, unless it
+		// asks for a longer wait than is worth holding the request for.
+		var statusErr *StatusError
+		if errors.As(lastErr, &statusErr) && statusErr.RetryAfter > 0 {
+			if statusErr.RetryAfter > opts.MaxRetryAfter {
+				return attempt + 1, lastErr
+			}
+			delay = statusErr.RetryAfter
+		}
+
+		if !budget.Withdraw() {
+			return attempt + 1, lastErr
+		}
+
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return attempt + 1, ctx.Err()
 		case <-time.After(delay):
 		}
 	}
 
-	return lastErr
+	return opts.MaxAttempts, lastErr
 }
 
-// IsRetryable returns true only for transient network errors.
+// StatusError reports a response whose status the caller has chosen to
+// retry, such as a 429 or 503.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration // the response's Retry-After; 0 for none
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("retryable status %d", e.StatusCode)
+}
+
+// IsRetryable returns true only for transient network errors and
+// StatusErrors.
 func IsRetryable(err error) bool {
 	if err == nil {
 		return false
 	}
+	var statusErr *StatusError
+	if TransportErrorKind(err) != "" || errors.As(err, &statusErr) {
+		return true
+	}
 	netErr, ok := err.(net.Error)
 	if !ok {
 		return false
 	}
 	return netErr.Timeout()
 }
+
+// Transient transport error kinds returned by TransportErrorKind.
+const (
+	KindGoAway          = "goaway"           // HTTP/2 GOAWAY from the server
+	KindConnectionReset = "connection_reset" // connection reset or lost
+	KindEOF             = "eof"              // connection closed before the response headers
+)
+
+// TransportErrorKind classifies err as a transient transport error, one
+// that a retry on a fresh connection usually fixes, and returns "" for
+// anything else. net/http does not export its HTTP/2 errors, so GOAWAY and
+// lost connections are recognised by their message.
+func TransportErrorKind(err error) string {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ""
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "GOAWAY"):
+		return KindGoAway
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		strings.Contains(msg, "connection reset by peer"), strings.Contains(msg, "http2: client connection lost"):
+		return KindConnectionReset
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		strings.Contains(msg, "server closed idle connection"):
+		return KindEOF
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package resilience
+
+import "sync"
+
+// retryBudgetBurst is how many retries a budget holds when full, so an
+// upstream that has seen few requests can still have them retried.
+const retryBudgetBurst = 10
+
+// RetryBudget caps retries at a fraction of requests, so that an upstream
+// that is failing or shedding load is not sent every request several
+// times over. Each request adds Ratio of a retry to the budget, up to
+// retryBudgetBurst, and each retry takes one. A nil budget allows every
+// retry.
+type RetryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	tokens float64
+}
+
+// NewRetryBudget returns a full budget allowing ratio retries per request,
+// or nil, allowing every retry, for a ratio <= 0.
+func NewRetryBudget(ratio float64) *RetryBudget {
+	if ratio <= 0 {
+		return nil
+	}
+	return &RetryBudget{ratio: ratio, tokens: retryBudgetBurst}
+}
+
+// Deposit credits the budget for a request.
+func (b *RetryBudget) Deposit() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.ratio, retryBudgetBurst)
+}
+
+// Withdraw takes a retry from the budget, and returns false if none is
+// left.
+func (b *RetryBudget) Withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
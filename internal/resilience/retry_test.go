@@ -3,7 +3,10 @@ package resilience
 import (
 	"context"
 	"errors"
+	"io"
 	"net"
+	"net/url"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -102,6 +105,64 @@ func TestRetryContextCancellation(t *testing.T) {
 	}
 }
 
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	opts := RetryOpts{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxRetryAfter: time.Second}
+
+	var calls []time.Time
+	attempts, err := DoBudgeted(context.Background(), opts, nil, func() error {
+		calls = append(calls, time.Now())
+		if len(calls) == 1 {
+			return &StatusError{StatusCode: 429, RetryAfter: 50 * time.Millisecond}
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Fatalf("attempts = %d, err = %v; want 2, nil", attempts, err)
+	}
+	if wait := calls[1].Sub(calls[0]); wait < 50*time.Millisecond {
+		t.Errorf("retried after %v, want at least the 50ms Retry-After", wait)
+	}
+
+	// A Retry-After past MaxRetryAfter is not waited out.
+	attempts, err = DoBudgeted(context.Background(), opts, nil, func() error {
+		return &StatusError{StatusCode: 429, RetryAfter: time.Minute}
+	})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || attempts != 1 {
+		t.Fatalf("attempts = %d, err = %v; want 1 and the StatusError", attempts, err)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := NewRetryBudget(0.5)
+	opts := RetryOpts{MaxAttempts: 2, BaseDelay: time.Microsecond}
+	failing := func() error { return &StatusError{StatusCode: 529} }
+
+	// A full budget allows a burst of retries, after which each request
+	// earns half of one.
+	for i := 0; ; i++ {
+		if attempts, _ := DoBudgeted(context.Background(), opts, budget, failing); attempts == 1 {
+			break
+		}
+		if i > 2*retryBudgetBurst {
+			t.Fatal("budget was never exhausted")
+		}
+	}
+	var retried int
+	for range 10 {
+		if attempts, _ := DoBudgeted(context.Background(), opts, budget, failing); attempts == 2 {
+			retried++
+		}
+	}
+	if retried != 5 {
+		t.Errorf("retried %d of 10 requests on an exhausted budget, want 5", retried)
+	}
+
+	if NewRetryBudget(0) != nil {
+		t.Error("a zero ratio should disable the budget")
+	}
+}
+
 func TestIsRetryable(t *testing.T) {
 	if IsRetryable(nil) {
 		t.Error("nil should not be retryable")
@@ -115,4 +176,31 @@ func TestIsRetryable(t *testing.T) {
 	if IsRetryable(&mockNetError{timeout: false}) {
 		t.Error("non-timeout net error should not be retryable")
 	}
+	reset := &url.Error{Op: "Post", URL: "http://upstream", Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}}
+	if !IsRetryable(reset) {
+		t.Error("connection reset should be retryable")
+	}
+	if !IsRetryable(&StatusError{StatusCode: 503}) {
+		t.Error("status error should be retryable")
+	}
+}
+
+func TestTransportErrorKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{errors.New("http2: server sent GOAWAY and closed the connection; LastStreamID=1, ErrCode=NO_ERROR, debug=\"\""), KindGoAway},
+		{&url.Error{Op: "Post", URL: "http://upstream", Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}}, KindConnectionReset},
+		{errors.New("http2: client connection lost"), KindConnectionReset},
+		{&url.Error{Op: "Post", URL: "http://upstream", Err: io.EOF}, KindEOF},
+		{&url.Error{Op: "Post", URL: "http://upstream", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}, ""},
+		{&url.Error{Op: "Post", URL: "http://upstream", Err: context.Canceled}, ""},
+		{errors.New("plain error"), ""},
+	}
+	for _, tt := range tests {
+		if got := TransportErrorKind(tt.err); got != tt.want {
+			t.Errorf("TransportErrorKind(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
 }
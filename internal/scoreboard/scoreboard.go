@@ -0,0 +1,264 @@
+package scoreboard
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// window is how many recent requests each upstream's score covers.
+const window = 200
+
+// Score summarizes an upstream's recent requests.
+type Score struct {
+	UpstreamID          uuid.UUID  `json:"upstream_id"`
+	UpstreamName        string     `json:"upstream_name,omitempty"`
+	Requests            int        `json:"requests"` // in the window
+	SuccessRate         float64    `json:"success_rate"`
+	P95LatencyMS        int        `json:"p95_latency_ms"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastFailureAt       *time.Time `json:"last_failure_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// entry is one upstream's window, a ring of the last requests.
+type entry struct {
+	latencies   []int32
+	successes   []bool
+	next        int // ring position of the next outcome once full
+	consecFails int
+	lastFailure time.Time
+	updatedAt   time.Time
+}
+
+func (e *entry) add(success bool, latencyMS int32, now time.Time) {
+	if len(e.latencies) < window {
+		e.latencies = append(e.latencies, latencyMS)
+		e.successes = append(e.successes, success)
+	} else {
+		e.latencies[e.next] = latencyMS
+		e.successes[e.next] = success
+		e.next = (e.next + 1) % window
+	}
+	if success {
+		e.consecFails = 0
+	} else {
+		e.consecFails++
+		e.lastFailure = now
+	}
+	e.updatedAt = now
+}
+
+// ordered returns the window oldest first.
+func (e *entry) ordered() ([]int32, []bool) {
+	lat := append(append([]int32{}, e.latencies[e.next:]...), e.latencies[:e.next]...)
+	ok := append(append([]bool{}, e.successes[e.next:]...), e.successes[:e.next]...)
+	return lat, ok
+}
+
+func (e *entry) score(id uuid.UUID) Score {
+	s := Score{
+		UpstreamID:          id,
+		Requests:            len(e.latencies),
+		ConsecutiveFailures: e.consecFails,
+		UpdatedAt:           e.updatedAt,
+	}
+	if !e.lastFailure.IsZero() {
+		t := e.lastFailure
+		s.LastFailureAt = &t
+	}
+	if s.Requests == 0 {
+		return s
+	}
+	succeeded := 0
+	for _, ok := range e.successes {
+		if ok {
+			succeeded++
+		}
+	}
+	s.SuccessRate = float64(succeeded) / float64(s.Requests)
+	sorted := append([]int32{}, e.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	s.P95LatencyMS = int(sorted[(len(sorted)*95+99)/100-1])
+	return s
+}
+
+// Board keeps a rolling score of every upstream's recent requests and, with
+// a store, saves it periodically and loads it on start, so health decisions
+// survive a restart.
+type Board struct {
+	store    store.Store
+	interval time.Duration
+
+	mu      sync.Mutex
+	entries map[uuid.UUID]*entry
+	dirty   bool // recorded since the last save
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a board that saves to s every interval. With a nil store or
+// a zero interval the board is kept in memory only. Call Load to restore
+// saved scores and Close to stop it.
+func New(s store.Store, interval time.Duration) *Board {
+	b := &Board{
+		store:    s,
+		interval: interval,
+		entries:  make(map[uuid.UUID]*entry),
+		done:     make(chan struct{}),
+	}
+	if b.persisted() {
+		b.wg.Add(1)
+		go b.worker()
+	}
+	return b
+}
+
+// Close stops the periodic save and saves a last time.
+func (b *Board) Close() {
+	close(b.done)
+	b.wg.Wait()
+	if !b.persisted() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.Save(ctx); err != nil {
+		log.Printf("scoreboard: save failed: %v", err)
+	}
+}
+
+func (b *Board) persisted() bool {
+	return b.store != nil && b.interval > 0
+}
+
+func (b *Board) worker() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), b.interval)
+			if err := b.Save(ctx); err != nil {
+				log.Printf("scoreboard: save failed: %v", err)
+			}
+			cancel()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// Load restores the saved scores, replacing those of upstreams the board
+// already has.
+func (b *Board) Load(ctx context.Context) error {
+	if !b.persisted() {
+		return nil
+	}
+	saved, err := b.store.ListUpstreamScores(ctx)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, sc := range saved {
+		n := min(len(sc.LatenciesMS), len(sc.Successes))
+		start := max(0, n-window)
+		e := &entry{
+			latencies:   append([]int32{}, sc.LatenciesMS[start:n]...),
+			successes:   append([]bool{}, sc.Successes[start:n]...),
+			consecFails: sc.ConsecutiveFailures,
+			updatedAt:   sc.UpdatedAt,
+		}
+		if sc.LastFailureAt != nil {
+			e.lastFailure = *sc.LastFailureAt
+		}
+		b.entries[sc.UpstreamID] = e
+	}
+	return nil
+}
+
+// Save writes every upstream's score to the store if anything was recorded
+// since the last save.
+func (b *Board) Save(ctx context.Context) error {
+	if !b.persisted() {
+		return nil
+	}
+	b.mu.Lock()
+	if !b.dirty {
+		b.mu.Unlock()
+		return nil
+	}
+	scores := make([]store.UpstreamScore, 0, len(b.entries))
+	for id, e := range b.entries {
+		lat, ok := e.ordered()
+		sc := store.UpstreamScore{
+			UpstreamID:          id,
+			LatenciesMS:         lat,
+			Successes:           ok,
+			ConsecutiveFailures: e.consecFails,
+			UpdatedAt:           e.updatedAt,
+		}
+		if !e.lastFailure.IsZero() {
+			t := e.lastFailure
+			sc.LastFailureAt = &t
+		}
+		scores = append(scores, sc)
+	}
+	b.dirty = false
+	b.mu.Unlock()
+
+	if err := b.store.SaveUpstreamScores(ctx, scores); err != nil {
+		b.mu.Lock()
+		b.dirty = true
+		b.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Record adds a request's outcome to the upstream's score.
+func (b *Board) Record(upstreamID uuid.UUID, success bool, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := b.entries[upstreamID]
+	if e == nil {
+		e = &entry{}
+		b.entries[upstreamID] = e
+	}
+	e.add(success, int32(latency.Milliseconds()), time.Now())
+	b.dirty = true
+}
+
+// ConsecutiveFailures returns how many requests to the upstream have failed
+// in a row, and when the last one failed.
+func (b *Board) ConsecutiveFailures(upstreamID uuid.UUID) (int, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := b.entries[upstreamID]
+	if e == nil {
+		return 0, time.Time{}
+	}
+	return e.consecFails, e.lastFailure
+}
+
+// Scores returns the score of every upstream the board has seen.
+func (b *Board) Scores() []Score {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]Score, 0, len(b.entries))
+	for id, e := range b.entries {
+		out = append(out, e.score(id))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UpstreamID.String() < out[j].UpstreamID.String() })
+	return out
+}
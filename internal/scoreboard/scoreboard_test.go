@@ -0,0 +1,63 @@
+package scoreboard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBoardScores(t *testing.T) {
+	b := New(nil, 0)
+	defer b.Close()
+	id := uuid.New()
+
+	// Every tenth request fails, the 100th included.
+	for i := 1; i <= 100; i++ {
+		b.Record(id, i%10 != 0, time.Duration(i)*time.Millisecond)
+	}
+	b.Record(id, false, time.Millisecond)
+	b.Record(id, false, time.Millisecond)
+
+	scores := b.Scores()
+	if len(scores) != 1 {
+		t.Fatalf("got %d scores, want 1", len(scores))
+	}
+	s := scores[0]
+	if s.Requests != 102 || s.ConsecutiveFailures != 3 || s.LastFailureAt == nil {
+		t.Fatalf("unexpected score %+v", s)
+	}
+	if want := 90.0 / 102; s.SuccessRate != want {
+		t.Fatalf("success rate = %v, want %v", s.SuccessRate, want)
+	}
+	if s.P95LatencyMS != 95 {
+		t.Fatalf("p95 = %d, want 95", s.P95LatencyMS)
+	}
+
+	b.Record(id, true, time.Millisecond)
+	if n, _ := b.ConsecutiveFailures(id); n != 0 {
+		t.Fatalf("consecutive failures = %d after a success, want 0", n)
+	}
+}
+
+func TestBoardWindow(t *testing.T) {
+	b := New(nil, 0)
+	defer b.Close()
+	id := uuid.New()
+
+	for i := 0; i < window; i++ {
+		b.Record(id, false, time.Second)
+	}
+	for i := 0; i < window/2; i++ {
+		b.Record(id, true, time.Millisecond)
+	}
+
+	s := b.Scores()[0]
+	if s.Requests != window || s.SuccessRate != 0.5 {
+		t.Fatalf("unexpected score %+v", s)
+	}
+	lat, ok := b.entries[id].ordered()
+	if lat[0] != 1000 || ok[0] || lat[window-1] != 1 || !ok[window-1] {
+		t.Fatalf("window not ordered oldest first: %v %v", lat, ok)
+	}
+}
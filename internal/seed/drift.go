@@ -0,0 +1,189 @@
+package seed
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// Drift is how the database differs from a seed file.
+type Drift struct {
+	InSync    bool      `json:"in_sync"`
+	Upstreams KindDrift `json:"upstreams"`
+	Models    KindDrift `json:"models"`
+	Keys      KindDrift `json:"keys"`
+	Policies  KindDrift `json:"policies"`
+}
+
+// KindDrift lists the differences for one kind of entry.
+type KindDrift struct {
+	Missing   []string `json:"missing"`   // declared in the file, not in the database
+	Unmanaged []string `json:"unmanaged"` // in the database, not declared in the file
+	Changed   []Change `json:"changed"`   // declared fields whose database value differs
+}
+
+type Change struct {
+	Name   string      `json:"name"`
+	Fields []FieldDiff `json:"fields"`
+}
+
+type FieldDiff struct {
+	Field    string `json:"field"`
+	File     any    `json:"file"`
+	Database any    `json:"database"`
+}
+
+// redacted stands in for secrets in a FieldDiff.
+const redacted = "[redacted]"
+
+// Diff compares the database with f.
+func Diff(ctx context.Context, s store.Store, f *File) (*Drift, error) {
+	st, err := loadState(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	return diff(f, st), nil
+}
+
+func diff(f *File, st *state) *Drift {
+	d := &Drift{}
+
+	upstreamNames := make(map[uuid.UUID]string, len(st.upstreams))
+	for _, u := range st.upstreams {
+		upstreamNames[u.ID] = u.Name
+	}
+
+	d.Upstreams = diffKind(f.Upstreams, st.upstreams,
+		func(u Upstream) string { return u.Name },
+		func(u store.Upstream) string { return u.Name },
+		func(c *fieldDiffer, want Upstream, got store.Upstream) {
+			compare(c, "base_url", want.BaseURL, got.BaseURL)
+			if want.APIKey != nil && *want.APIKey != got.APIKeyEncrypted {
+				c.fields = append(c.fields, FieldDiff{Field: "api_key", File: redacted, Database: redacted})
+			}
+			compare(c, "format", want.Format, got.Format)
+			compare(c, "priority", want.Priority, got.Priority)
+			compare(c, "region", want.Region, deref(got.Region))
+			compare(c, "is_active", want.IsActive, got.IsActive)
+		})
+
+	d.Models = diffKind(f.Models, st.models,
+		func(m Model) string { return m.Name },
+		func(m store.Model) string { return m.Name },
+		func(c *fieldDiffer, want Model, got store.Model) {
+			var upstream string
+			if got.UpstreamID != nil {
+				upstream = upstreamNames[*got.UpstreamID]
+			}
+			compare(c, "upstream", want.Upstream, upstream)
+			compare(c, "provider", want.Provider, got.Provider)
+			compare(c, "display_name", want.DisplayName, deref(got.DisplayName))
+			compare(c, "input_cost_per_million", want.InputCostPerMillion, got.InputCostPerMillion)
+			compare(c, "output_cost_per_million", want.OutputCostPerMillion, got.OutputCostPerMillion)
+			compare(c, "context_window", want.ContextWindow, deref(got.ContextWindow))
+			compare(c, "max_output_tokens", want.MaxOutputTokens, deref(got.MaxOutputTokens))
+			compareSet(c, "aliases", want.Aliases, got.Aliases)
+			compare(c, "is_active", want.IsActive, got.IsActive)
+		})
+
+	d.Keys = diffKind(f.Keys, st.keys,
+		func(k Key) string { return k.Name },
+		func(k store.LLMAPIKey) string { return k.Name },
+		func(c *fieldDiffer, want Key, got store.LLMAPIKey) {
+			compare(c, "rate_limit", want.RateLimit, deref(got.RateLimit))
+			compare(c, "is_active", want.IsActive, got.IsActive)
+			compare(c, "sandbox", want.Sandbox, got.Sandbox)
+			compare(c, "max_priority", want.MaxPriority, got.MaxPriority)
+			compareSet(c, "allowed_regions", want.AllowedRegions, got.AllowedRegions)
+			compareSet(c, "allowed_models", want.AllowedModels, got.AllowedModels)
+		})
+
+	d.Policies = diffKind(f.Policies, st.policies,
+		func(p Policy) string { return p.Name },
+		func(p store.Policy) string { return p.Name },
+		func(c *fieldDiffer, want Policy, got store.Policy) {
+			compare(c, "expression", want.Expression, got.Expression)
+			compare(c, "action", want.Action, got.Action)
+			compare(c, "target_model", want.TargetModel, deref(got.TargetModel))
+			compare(c, "max_tokens", want.MaxTokens, deref(got.MaxTokens))
+			compare(c, "message", want.Message, deref(got.Message))
+			compare(c, "priority", want.Priority, got.Priority)
+			compare(c, "is_active", want.IsActive, got.IsActive)
+		})
+
+	d.InSync = d.Upstreams.empty() && d.Models.empty() && d.Keys.empty() && d.Policies.empty()
+	return d
+}
+
+func (k KindDrift) empty() bool {
+	return len(k.Missing) == 0 && len(k.Unmanaged) == 0 && len(k.Changed) == 0
+}
+
+// diffKind matches declared entries to database rows by name.
+func diffKind[W, G any](want []W, got []G, wantName func(W) string, gotName func(G) string, fields func(*fieldDiffer, W, G)) KindDrift {
+	k := KindDrift{Missing: []string{}, Unmanaged: []string{}, Changed: []Change{}}
+	byName := make(map[string]G, len(got))
+	for _, g := range got {
+		byName[gotName(g)] = g
+	}
+	declared := make(map[string]bool, len(want))
+	for _, w := range want {
+		name := wantName(w)
+		declared[name] = true
+		g, ok := byName[name]
+		if !ok {
+			k.Missing = append(k.Missing, name)
+			continue
+		}
+		var c fieldDiffer
+		fields(&c, w, g)
+		if len(c.fields) > 0 {
+			k.Changed = append(k.Changed, Change{Name: name, Fields: c.fields})
+		}
+	}
+	for _, g := range got {
+		if name := gotName(g); !declared[name] {
+			k.Unmanaged = append(k.Unmanaged, name)
+		}
+	}
+	return k
+}
+
+type fieldDiffer struct {
+	fields []FieldDiff
+}
+
+// compare records field when the file declares it and the database value
+// differs.
+func compare[T comparable](c *fieldDiffer, field string, want *T, got T) {
+	if want != nil && *want != got {
+		c.fields = append(c.fields, FieldDiff{Field: field, File: *want, Database: got})
+	}
+}
+
+// compareSet compares lists ignoring order.
+func compareSet(c *fieldDiffer, field string, want *[]string, got []string) {
+	if want == nil {
+		return
+	}
+	w, g := slices.Clone(*want), slices.Clone(got)
+	slices.Sort(w)
+	slices.Sort(g)
+	if !slices.Equal(w, g) {
+		if got == nil {
+			got = []string{}
+		}
+		c.fields = append(c.fields, FieldDiff{Field: field, File: *want, Database: got})
+	}
+}
+
+// deref returns the value p points to, or the zero value.
+func deref[T any](p *T) T {
+	var v T
+	if p != nil {
+		v = *p
+	}
+	return v
+}
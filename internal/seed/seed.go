@@ -0,0 +1,261 @@
+// Package seed reads the declarative seed file: the upstreams, models, LLM
+// keys and policies an installation should have. Entries missing from the
+// database are created at startup, and Diff reports where the database has
+// drifted from the file, e.g. through changes made in the UI, so GitOps
+// workflows can keep the file authoritative.
+package seed
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sertdev/pxbin/internal/store"
+	"gopkg.in/yaml.v3"
+)
+
+// File is a seed file. Entries are matched to the database by name; fields
+// left out of an entry are not managed by the file.
+type File struct {
+	Upstreams []Upstream `yaml:"upstreams"`
+	Models    []Model    `yaml:"models"`
+	Keys      []Key      `yaml:"keys"`
+	Policies  []Policy   `yaml:"policies"`
+}
+
+type Upstream struct {
+	Name     string  `yaml:"name"`
+	BaseURL  *string `yaml:"base_url"`
+	APIKey   *string `yaml:"api_key"` // usually ${ENV_VAR}
+	Format   *string `yaml:"format"`
+	Priority *int    `yaml:"priority"`
+	Region   *string `yaml:"region"`
+	IsActive *bool   `yaml:"is_active"`
+}
+
+type Model struct {
+	Name                 string    `yaml:"name"`
+	Upstream             *string   `yaml:"upstream"` // upstream name
+	Provider             *string   `yaml:"provider"`
+	DisplayName          *string   `yaml:"display_name"`
+	InputCostPerMillion  *float64  `yaml:"input_cost_per_million"`
+	OutputCostPerMillion *float64  `yaml:"output_cost_per_million"`
+	ContextWindow        *int      `yaml:"context_window"`
+	MaxOutputTokens      *int      `yaml:"max_output_tokens"`
+	Aliases              *[]string `yaml:"aliases"`
+	IsActive             *bool     `yaml:"is_active"`
+}
+
+// Key declares an LLM key's settings. Keys are never created from the file,
+// since their secret cannot be declared; they are only checked for drift.
+type Key struct {
+	Name           string    `yaml:"name"`
+	RateLimit      *int      `yaml:"rate_limit"`
+	IsActive       *bool     `yaml:"is_active"`
+	Sandbox        *bool     `yaml:"sandbox"`
+	MaxPriority    *string   `yaml:"max_priority"`
+	AllowedRegions *[]string `yaml:"allowed_regions"`
+	AllowedModels  *[]string `yaml:"allowed_models"`
+}
+
+type Policy struct {
+	Name        string  `yaml:"name"`
+	Expression  *string `yaml:"expression"`
+	Action      *string `yaml:"action"`
+	TargetModel *string `yaml:"target_model"`
+	MaxTokens   *int    `yaml:"max_tokens"`
+	Message     *string `yaml:"message"`
+	Priority    *int    `yaml:"priority"`
+	IsActive    *bool   `yaml:"is_active"`
+}
+
+// Load reads and validates the seed file at path. ${VAR} references are
+// replaced with environment variables, so secrets stay out of the file.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read seed file: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader([]byte(os.ExpandEnv(string(data)))))
+	dec.KnownFields(true)
+	var f File
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("parse seed file: %w", err)
+	}
+	if err := f.validate(); err != nil {
+		return nil, fmt.Errorf("seed file: %w", err)
+	}
+	return &f, nil
+}
+
+func (f *File) validate() error {
+	names := func(kind string, n int, name func(int) string) error {
+		seen := make(map[string]bool, n)
+		for i := 0; i < n; i++ {
+			switch nm := name(i); {
+			case nm == "":
+				return fmt.Errorf("%s[%d] has no name", kind, i)
+			case seen[nm]:
+				return fmt.Errorf("%s %q is declared twice", kind, nm)
+			default:
+				seen[nm] = true
+			}
+		}
+		return nil
+	}
+	if err := names("upstreams", len(f.Upstreams), func(i int) string { return f.Upstreams[i].Name }); err != nil {
+		return err
+	}
+	if err := names("models", len(f.Models), func(i int) string { return f.Models[i].Name }); err != nil {
+		return err
+	}
+	if err := names("keys", len(f.Keys), func(i int) string { return f.Keys[i].Name }); err != nil {
+		return err
+	}
+	return names("policies", len(f.Policies), func(i int) string { return f.Policies[i].Name })
+}
+
+// state is the database content a seed file is compared with.
+type state struct {
+	upstreams []store.Upstream
+	models    []store.Model
+	keys      []store.LLMAPIKey
+	policies  []store.Policy
+}
+
+func loadState(ctx context.Context, s store.Store) (*state, error) {
+	var st state
+	var err error
+	if st.upstreams, err = s.ListUpstreams(ctx); err != nil {
+		return nil, err
+	}
+	if st.models, err = s.ListModels(ctx); err != nil {
+		return nil, err
+	}
+	if st.policies, err = s.ListPolicies(ctx); err != nil {
+		return nil, err
+	}
+	for page := 1; ; page++ {
+		keys, total, err := s.ListLLMKeys(ctx, page, 500)
+		if err != nil {
+			return nil, err
+		}
+		st.keys = append(st.keys, keys...)
+		if len(keys) == 0 || len(st.keys) >= total {
+			break
+		}
+	}
+	return &st, nil
+}
+
+// Apply creates the upstreams, models and policies of f that are missing
+// from the database, and returns how many it created. Existing entries are
+// left alone; Diff reports how they differ.
+func Apply(ctx context.Context, s store.Store, f *File) (int, error) {
+	st, err := loadState(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+	created := 0
+
+	upstreamIDs := make(map[string]store.Upstream, len(st.upstreams))
+	for _, u := range st.upstreams {
+		upstreamIDs[u.Name] = u
+	}
+	for _, u := range f.Upstreams {
+		if _, ok := upstreamIDs[u.Name]; ok {
+			continue
+		}
+		if u.BaseURL == nil || u.APIKey == nil {
+			return created, fmt.Errorf("upstream %q: base_url and api_key are required to create it", u.Name)
+		}
+		uc := &store.UpstreamCreate{Name: u.Name, BaseURL: *u.BaseURL, APIKey: *u.APIKey, Format: "openai", Region: u.Region}
+		if u.Format != nil {
+			uc.Format = *u.Format
+		}
+		if u.Priority != nil {
+			uc.Priority = *u.Priority
+		}
+		rec, err := s.CreateUpstream(ctx, uc)
+		if err != nil {
+			return created, fmt.Errorf("upstream %q: %w", u.Name, err)
+		}
+		if u.IsActive != nil && !*u.IsActive {
+			if err := s.UpdateUpstream(ctx, rec.ID, &store.UpstreamUpdate{IsActive: u.IsActive}); err != nil {
+				return created, fmt.Errorf("upstream %q: %w", u.Name, err)
+			}
+		}
+		upstreamIDs[u.Name] = *rec
+		created++
+	}
+
+	modelNames := make(map[string]bool, len(st.models))
+	for _, m := range st.models {
+		modelNames[m.Name] = true
+	}
+	for _, m := range f.Models {
+		if modelNames[m.Name] {
+			continue
+		}
+		mc := &store.ModelCreate{Name: m.Name, DisplayName: m.DisplayName, Provider: "openai", ContextWindow: m.ContextWindow, MaxOutputTokens: m.MaxOutputTokens}
+		if m.Upstream != nil {
+			u, ok := upstreamIDs[*m.Upstream]
+			if !ok {
+				return created, fmt.Errorf("model %q: unknown upstream %q", m.Name, *m.Upstream)
+			}
+			mc.UpstreamID = &u.ID
+			mc.Provider = u.Format
+		}
+		if m.Provider != nil {
+			mc.Provider = *m.Provider
+		}
+		if m.InputCostPerMillion != nil {
+			mc.InputCostPerMillion = *m.InputCostPerMillion
+		}
+		if m.OutputCostPerMillion != nil {
+			mc.OutputCostPerMillion = *m.OutputCostPerMillion
+		}
+		if m.Aliases != nil {
+			mc.Aliases = *m.Aliases
+		}
+		rec, err := s.CreateModel(ctx, mc)
+		if err != nil {
+			return created, fmt.Errorf("model %q: %w", m.Name, err)
+		}
+		if m.IsActive != nil && !*m.IsActive {
+			if err := s.UpdateModel(ctx, rec.ID, &store.ModelUpdate{IsActive: m.IsActive}); err != nil {
+				return created, fmt.Errorf("model %q: %w", m.Name, err)
+			}
+		}
+		created++
+	}
+
+	policyNames := make(map[string]bool, len(st.policies))
+	for _, p := range st.policies {
+		policyNames[p.Name] = true
+	}
+	for _, p := range f.Policies {
+		if policyNames[p.Name] {
+			continue
+		}
+		if p.Expression == nil || p.Action == nil {
+			return created, fmt.Errorf("policy %q: expression and action are required to create it", p.Name)
+		}
+		pc := &store.PolicyCreate{Name: p.Name, Expression: *p.Expression, Action: *p.Action, TargetModel: p.TargetModel, MaxTokens: p.MaxTokens, Message: p.Message}
+		if p.Priority != nil {
+			pc.Priority = *p.Priority
+		}
+		rec, err := s.CreatePolicy(ctx, pc)
+		if err != nil {
+			return created, fmt.Errorf("policy %q: %w", p.Name, err)
+		}
+		if p.IsActive != nil && !*p.IsActive {
+			if err := s.UpdatePolicy(ctx, rec.ID, &store.PolicyUpdate{IsActive: p.IsActive}); err != nil {
+				return created, fmt.Errorf("policy %q: %w", p.Name, err)
+			}
+		}
+		created++
+	}
+	return created, nil
+}
@@ -0,0 +1,118 @@
+package seed
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+func writeSeed(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "seed.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("SEED_TEST_KEY", "sk-secret")
+	f, err := Load(writeSeed(t, `
+upstreams:
+  - name: openai
+    base_url: https://api.openai.com
+    api_key: ${SEED_TEST_KEY}
+models:
+  - name: gpt-4o
+    upstream: openai
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := *f.Upstreams[0].APIKey; got != "sk-secret" {
+		t.Errorf("api_key = %q, want the environment value", got)
+	}
+	if f.Models[0].Provider != nil {
+		t.Errorf("undeclared provider = %q, want nil", *f.Models[0].Provider)
+	}
+
+	for name, content := range map[string]string{
+		"unknown field": "upstreams:\n  - name: a\n    base_uri: x\n",
+		"no name":       "models:\n  - provider: openai\n",
+		"duplicate":     "policies:\n  - name: p\n  - name: p\n",
+	} {
+		if _, err := Load(writeSeed(t, content)); err == nil {
+			t.Errorf("%s: Load succeeded, want an error", name)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	ptr := func(s string) *string { return &s }
+	upstreamID := uuid.New()
+	limit := 60
+	st := &state{
+		upstreams: []store.Upstream{
+			{ID: upstreamID, Name: "openai", BaseURL: "https://api.openai.com", APIKeyEncrypted: "sk-old", Format: "openai", IsActive: true},
+			{ID: uuid.New(), Name: "added-in-ui", Format: "openai"},
+		},
+		models: []store.Model{
+			{Name: "gpt-4o", Provider: "openai", UpstreamID: &upstreamID, InputCostPerMillion: 2.5, Aliases: []string{"b", "a"}, IsActive: true},
+		},
+		keys: []store.LLMAPIKey{
+			{Name: "ci", RateLimit: &limit, IsActive: true},
+		},
+	}
+	inputCost := 3.0
+	f := &File{
+		Upstreams: []Upstream{{Name: "openai", BaseURL: ptr("https://api.openai.com"), APIKey: ptr("sk-new")}},
+		Models: []Model{
+			{Name: "gpt-4o", Upstream: ptr("openai"), InputCostPerMillion: &inputCost, Aliases: &[]string{"a", "b"}},
+			{Name: "o3", Upstream: ptr("openai")},
+		},
+		Keys:     []Key{{Name: "ci", RateLimit: new(int)}},
+		Policies: []Policy{{Name: "block-large"}},
+	}
+
+	d := diff(f, st)
+	if d.InSync {
+		t.Fatal("InSync = true, want false")
+	}
+
+	if got := d.Upstreams.Unmanaged; len(got) != 1 || got[0] != "added-in-ui" {
+		t.Errorf("unmanaged upstreams = %v", got)
+	}
+	if len(d.Upstreams.Changed) != 1 {
+		t.Fatalf("changed upstreams = %+v", d.Upstreams.Changed)
+	}
+	fd := d.Upstreams.Changed[0].Fields
+	if len(fd) != 1 || fd[0].Field != "api_key" || fd[0].File != redacted || fd[0].Database != redacted {
+		t.Errorf("upstream fields = %+v, want only a redacted api_key", fd)
+	}
+
+	if got := d.Models.Missing; len(got) != 1 || got[0] != "o3" {
+		t.Errorf("missing models = %v", got)
+	}
+	if len(d.Models.Changed) != 1 || len(d.Models.Changed[0].Fields) != 1 || d.Models.Changed[0].Fields[0].Field != "input_cost_per_million" {
+		t.Errorf("changed models = %+v, want only input_cost_per_million (aliases ignore order)", d.Models.Changed)
+	}
+
+	if len(d.Keys.Changed) != 1 || d.Keys.Changed[0].Fields[0].Database != 60 {
+		t.Errorf("changed keys = %+v", d.Keys.Changed)
+	}
+	if got := d.Policies.Missing; len(got) != 1 || got[0] != "block-large" {
+		t.Errorf("missing policies = %v", got)
+	}
+}
+
+func TestDiffInSync(t *testing.T) {
+	active := true
+	st := &state{policies: []store.Policy{{Name: "p", Expression: "true", Action: "allow", IsActive: true}}}
+	f := &File{Policies: []Policy{{Name: "p", IsActive: &active}}}
+	if d := diff(f, st); !d.InSync {
+		t.Errorf("diff = %+v, want in sync", d)
+	}
+}
@@ -16,6 +16,10 @@ type benchProxyHandler struct{}
 func (b *benchProxyHandler) HandleAnthropic(w http.ResponseWriter, r *http.Request)       { w.WriteHeader(200) }
 func (b *benchProxyHandler) HandleOpenAI(w http.ResponseWriter, r *http.Request)           { w.WriteHeader(200) }
 func (b *benchProxyHandler) HandleOpenAIResponses(w http.ResponseWriter, r *http.Request)  { w.WriteHeader(200) }
+func (b *benchProxyHandler) HandleListModels(w http.ResponseWriter, r *http.Request)       { w.WriteHeader(200) }
+func (b *benchProxyHandler) HandleCompare(w http.ResponseWriter, r *http.Request)          { w.WriteHeader(200) }
+func (b *benchProxyHandler) HandleGemini(w http.ResponseWriter, r *http.Request)           { w.WriteHeader(200) }
+func (b *benchProxyHandler) HandleEmbeddings(w http.ResponseWriter, r *http.Request)       { w.WriteHeader(200) }
 
 func BenchmarkSecurityHeadersMiddleware(b *testing.B) {
 	handler := SecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -32,7 +36,7 @@ func BenchmarkSecurityHeadersMiddleware(b *testing.B) {
 }
 
 func BenchmarkRateLimiterAllow(b *testing.B) {
-	l := ratelimit.NewLimiter(1_000_000, 1_000_000) // very high limit to not deny
+	l := ratelimit.NewMemoryLimiter(1_000_000, 1_000_000) // very high limit to not deny
 	defer l.Close()
 
 	b.ResetTimer()
@@ -60,7 +64,7 @@ func BenchmarkMetricsMiddleware(b *testing.B) {
 func BenchmarkFullMiddlewareChain(b *testing.B) {
 	cfg := &config.Config{CORSOrigins: []string{"*"}}
 	m := metrics.New()
-	limiter := ratelimit.NewLimiter(1_000_000, 1_000_000)
+	limiter := ratelimit.NewMemoryLimiter(1_000_000, 1_000_000)
 	defer limiter.Close()
 
 	opts := &Opts{
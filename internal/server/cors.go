@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/cors"
+	"github.com/sertdev/pxbin/internal/config"
+)
+
+var corsExposedHeaders = []string{"X-Request-ID", "X-Pxbin-Upstream", "X-Pxbin-Model", "X-Pxbin-Cost", "X-Pxbin-Input-Tokens", "X-Pxbin-Output-Tokens", "X-Pxbin-Overhead-Us", "X-Pxbin-Stream-Id"}
+
+// proxyCORSAllowedHeaders are the request headers browser apps may send to
+// the LLM endpoints by default: the key headers of each API format and the
+// headers the official Anthropic and OpenAI SDKs add in the browser.
+var proxyCORSAllowedHeaders = []string{
+	"Accept", "Authorization", "Content-Type", "X-Api-Key", "X-Goog-Api-Key",
+	"X-Request-ID", "Last-Event-ID", "X-Pxbin-Priority", "X-Pxbin-Stream-Id",
+	"Anthropic-Version", "Anthropic-Beta", "Anthropic-Dangerous-Direct-Browser-Access",
+	"OpenAI-Organization", "OpenAI-Project",
+	"X-Stainless-Arch", "X-Stainless-Lang", "X-Stainless-OS", "X-Stainless-Package-Version",
+	"X-Stainless-Runtime", "X-Stainless-Runtime-Version", "X-Stainless-Retry-Count",
+	"X-Stainless-Timeout", "X-Stainless-Helper-Method",
+}
+
+// corsHandler applies the CORS policy. The LLM endpoints (/v1 and /v1beta)
+// get their own policy when proxy_cors_origins is set, so browser apps can
+// call them with short-lived keys without opening the management API to the
+// same origins. That policy sends no credentials: LLM keys travel in headers.
+func corsHandler(cfg *config.Config) func(http.Handler) http.Handler {
+	mgmt := cors.Handler(cors.Options{
+		AllowedOrigins:   cfg.CORSOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Request-ID", "x-api-key", "Last-Event-ID"},
+		ExposedHeaders:   corsExposedHeaders,
+		AllowCredentials: true,
+		MaxAge:           300,
+	})
+	if len(cfg.ProxyCORSOrigins) == 0 {
+		return mgmt
+	}
+
+	allowed := cfg.ProxyCORSAllowedHeaders
+	if len(allowed) == 0 {
+		allowed = proxyCORSAllowedHeaders
+	}
+	exposed := cfg.ProxyCORSExposedHeaders
+	if len(exposed) == 0 {
+		exposed = corsExposedHeaders
+	}
+	llm := cors.Handler(cors.Options{
+		AllowedOrigins: cfg.ProxyCORSOrigins,
+		AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+		AllowedHeaders: allowed,
+		ExposedHeaders: exposed,
+		MaxAge:         cfg.ProxyCORSMaxAgeSeconds,
+	})
+
+	return func(next http.Handler) http.Handler {
+		m, p := mgmt(next), llm(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isProxyPath(r.URL.Path) {
+				p.ServeHTTP(w, r)
+				return
+			}
+			m.ServeHTTP(w, r)
+		})
+	}
+}
+
+func isProxyPath(path string) bool {
+	return path == "/v1" || strings.HasPrefix(path, "/v1/") ||
+		path == "/v1beta" || strings.HasPrefix(path, "/v1beta/")
+}
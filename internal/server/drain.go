@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sertdev/pxbin/pkg/translate"
+)
+
+// drainRetryAfter is sent with 503s for proxy requests that arrive while the
+// instance drains, long enough for a load balancer to take it out of
+// rotation.
+const drainRetryAfter = 5 * time.Second
+
+// DrainStatus reports whether the instance is draining.
+type DrainStatus struct {
+	Draining bool       `json:"draining"`
+	Since    *time.Time `json:"since"`     // when draining started
+	InFlight int64      `json:"in_flight"` // proxy requests still being served, streams included
+}
+
+// Drain takes an instance out of rotation ahead of a deploy. While draining,
+// /readyz fails and new proxy requests get 503 with Retry-After, while
+// requests already in flight, including long streams, run to completion.
+type Drain struct {
+	mu       sync.Mutex
+	since    time.Time // zero when not draining
+	inFlight atomic.Int64
+}
+
+// NewDrain returns a Drain that is not draining.
+func NewDrain() *Drain {
+	return &Drain{}
+}
+
+// SetDraining starts or stops draining. Starting again keeps the original
+// start time.
+func (d *Drain) SetDraining(on bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case !on:
+		d.since = time.Time{}
+	case d.since.IsZero():
+		d.since = time.Now()
+	}
+}
+
+// Draining reports whether the instance is draining.
+func (d *Drain) Draining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return !d.since.IsZero()
+}
+
+// DrainStatus returns the drain state and the number of proxy requests in
+// flight.
+func (d *Drain) DrainStatus() DrainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := DrainStatus{InFlight: d.inFlight.Load()}
+	if !d.since.IsZero() {
+		since := d.since
+		s.Draining = true
+		s.Since = &since
+	}
+	return s
+}
+
+// Middleware rejects new requests while draining and counts the ones it
+// lets through.
+func (d *Drain) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.Draining() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(drainRetryAfter.Seconds())))
+			w.Header().Set("Connection", "close")
+			writeDrainError(w, r)
+			return
+		}
+		d.inFlight.Add(1)
+		defer d.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+const drainMessage = "Instance is draining; retry on another instance"
+
+// writeDrainError answers a request that arrived while draining with a 503
+// in the API format of its endpoint.
+func writeDrainError(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/messages"):
+		w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"` + drainMessage + `"}}`))
+	case strings.HasPrefix(r.URL.Path, "/v1beta/"):
+		w.Write(translate.MarshalGeminiError(http.StatusServiceUnavailable, drainMessage))
+	default:
+		w.Write([]byte(`{"error":{"message":"` + drainMessage + `","type":"server_error","code":"instance_draining"}}`))
+	}
+}
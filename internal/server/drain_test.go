@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDrainRejectsNewRequests(t *testing.T) {
+	d := NewDrain()
+	var inFlight int64
+	h := d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight = d.DrainStatus().InFlight
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/messages", nil))
+	if rec.Code != http.StatusOK || inFlight != 1 {
+		t.Fatalf("before draining: status %d, in flight %d", rec.Code, inFlight)
+	}
+
+	d.SetDraining(true)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/messages", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("while draining: expected 503, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("missing Retry-After")
+	}
+	if s := d.DrainStatus(); !s.Draining || s.Since == nil || s.InFlight != 0 {
+		t.Fatalf("unexpected status %+v", s)
+	}
+
+	// Each endpoint gets the 503 in its client's API format.
+	for path, want := range map[string]string{
+		"/v1/messages":                              `"type":"overloaded_error"`,
+		"/v1/messages/count_tokens":                 `"type":"overloaded_error"`,
+		"/v1/chat/completions":                      `"code":"instance_draining"`,
+		"/v1/responses":                             `"code":"instance_draining"`,
+		"/v1/embeddings":                            `"code":"instance_draining"`,
+		"/v1beta/models/gemini-pro:generateContent": `"status":"UNAVAILABLE"`,
+	} {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", path, nil))
+		var body map[string]any
+		if rec.Code != http.StatusServiceUnavailable || json.Unmarshal(rec.Body.Bytes(), &body) != nil || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("%s: expected a 503 with %s, got %d: %s", path, want, rec.Code, rec.Body)
+		}
+	}
+
+	d.SetDraining(false)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/messages", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("after draining: expected 200, got %d", rec.Code)
+	}
+}
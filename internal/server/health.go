@@ -5,10 +5,35 @@ import (
 	"encoding/json"
 	"net/http"
 	"time"
-
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Pinger checks that the database is reachable. A *pgxpool.Pool is one.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// PingFunc adapts a function, such as a store's Health method, to a
+// Pinger.
+type PingFunc func(ctx context.Context) error
+
+func (f PingFunc) Ping(ctx context.Context) error { return f(ctx) }
+
+// SpillReporter reports whether request logs are buffered on disk waiting
+// for the database.
+type SpillReporter interface {
+	SpillPending() bool
+}
+
+// WarmupReporter reports the startup warmup's progress.
+type WarmupReporter interface {
+	WarmupStatus() (done bool, status any)
+}
+
+// DrainReporter reports whether the instance is draining.
+type DrainReporter interface {
+	Draining() bool
+}
+
 // HealthHandler returns a liveness probe handler that always returns 200 OK.
 func HealthHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -19,14 +44,14 @@ func HealthHandler() http.HandlerFunc {
 }
 
 // ReadinessHandler returns a readiness probe handler that checks DB connectivity.
-func ReadinessHandler(pool *pgxpool.Pool) http.HandlerFunc {
+func ReadinessHandler(db Pinger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
 		defer cancel()
 
 		w.Header().Set("Content-Type", "application/json")
 
-		if err := pool.Ping(ctx); err != nil {
+		if err := db.Ping(ctx); err != nil {
 			w.WriteHeader(http.StatusServiceUnavailable)
 			resp, _ := json.Marshal(map[string]string{
 				"status": "not_ready",
@@ -40,3 +65,45 @@ func ReadinessHandler(pool *pgxpool.Pool) http.HandlerFunc {
 		w.Write([]byte(`{"status":"ready","db":"ok"}`))
 	}
 }
+
+// DegradedReadinessHandler returns a readiness probe that distinguishes a
+// degraded proxy from an unready one. Without the database the proxy keeps
+// serving cached keys and models and buffers logs to disk, so a failed ping
+// reports "degraded" with 200 rather than taking the instance out of
+// rotation. While the startup warmup runs it reports "warming" with 503, so
+// traffic only arrives once caches and upstream connections are primed.
+// A draining instance reports "draining" with 503. logs, warmup and drain
+// may be nil.
+func DegradedReadinessHandler(db Pinger, logs SpillReporter, warmup WarmupReporter, drain DrainReporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		resp := map[string]interface{}{"status": "ready", "db": "ok"}
+		if err := db.Ping(ctx); err != nil {
+			resp["status"] = "degraded"
+			resp["db"] = err.Error()
+		}
+		if logs != nil {
+			resp["logs_spilled"] = logs.SpillPending()
+		}
+		status := http.StatusOK
+		if warmup != nil {
+			done, ws := warmup.WarmupStatus()
+			resp["warmup"] = ws
+			if !done {
+				resp["status"] = "warming"
+				status = http.StatusServiceUnavailable
+			}
+		}
+		if drain != nil && drain.Draining() {
+			resp["status"] = "draining"
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		b, _ := json.Marshal(resp)
+		w.Write(b)
+	}
+}
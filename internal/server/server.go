@@ -3,15 +3,17 @@ package server
 import (
 	"io/fs"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/cors"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/sertdev/pxbin/internal/auth"
 	"github.com/sertdev/pxbin/internal/config"
+	"github.com/sertdev/pxbin/internal/loopguard"
 	"github.com/sertdev/pxbin/internal/ratelimit"
+	"github.com/sertdev/pxbin/internal/slogger"
+	"github.com/sertdev/pxbin/internal/tracing"
 )
 
 // ProxyHandler defines the interface for the LLM proxy handler.
@@ -19,14 +21,31 @@ type ProxyHandler interface {
 	HandleAnthropic(w http.ResponseWriter, r *http.Request)
 	HandleOpenAI(w http.ResponseWriter, r *http.Request)
 	HandleOpenAIResponses(w http.ResponseWriter, r *http.Request)
+	HandleListModels(w http.ResponseWriter, r *http.Request)
+	HandleCompare(w http.ResponseWriter, r *http.Request)
+	HandleGemini(w http.ResponseWriter, r *http.Request)
+	HandleEmbeddings(w http.ResponseWriter, r *http.Request)
 }
 
 // Opts holds optional middleware and dependencies for server construction.
 type Opts struct {
-	RateLimiter       *ratelimit.Limiter      // nil = disabled
+	RateLimiter       ratelimit.Limiter       // nil = disabled
 	MetricsMiddleware func(http.Handler) http.Handler // nil = disabled
 	MetricsHandler    http.Handler                     // nil = no /metrics endpoint
-	Pool              *pgxpool.Pool                    // for readiness probe
+	DB                Pinger                           // for readiness probe
+	Logs              SpillReporter                    // optional; reports disk-buffered logs on /readyz
+	Warmup            WarmupReporter                   // optional; /readyz is 503 until the startup warmup finishes
+	OpenAPI           http.Handler                     // nil = no /api/openapi.json endpoint
+	SharedLogs        http.HandlerFunc                 // nil = no signed log links
+	PublicUsage       http.HandlerFunc                 // nil = no public usage report
+	Self              http.Handler                     // nil = no /api/self endpoints for LLM keys
+	StreamResume      func(http.Handler) http.Handler // nil = streams cannot be resumed
+	PayloadCapture    func(http.Handler) http.Handler // nil = request and response bodies are not captured
+	StreamTap         func(http.Handler) http.Handler // nil = in-flight streams cannot be tailed
+	TrafficCapture    func(http.Handler) http.Handler // nil = request shapes are not recorded for replay
+	Drain             *Drain                           // nil = the instance cannot be drained
+	MaxHops           int                              // 0 = proxy requests are not checked for loops
+	Tracing           bool                             // false = proxy requests are not traced
 }
 
 // New creates and configures the chi router with all routes mounted.
@@ -41,39 +60,113 @@ func New(cfg *config.Config, proxy ProxyHandler, llmAuth func(http.Handler) http
 		r.Use(opts.MetricsMiddleware)
 	}
 
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   cfg.CORSOrigins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Request-ID", "x-api-key"},
-		ExposedHeaders:   []string{"X-Request-ID"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	}))
+	r.Use(corsHandler(cfg))
+
+	if opts != nil && opts.Tracing {
+		llmAuth = tracing.Stage("pxbin.auth", llmAuth)
+	}
 
 	// LLM proxy routes (require LLM API key auth)
 	r.Route("/v1", func(r chi.Router) {
+		if opts != nil && opts.Tracing {
+			r.Use(tracing.Middleware)
+		}
+		if opts != nil && opts.MaxHops > 0 {
+			r.Use(loopguard.Middleware(opts.MaxHops))
+		}
+		if opts != nil && opts.Drain != nil {
+			r.Use(opts.Drain.Middleware)
+		}
 		r.Use(llmAuth)
+		if opts != nil && opts.TrafficCapture != nil {
+			r.Use(opts.TrafficCapture)
+		}
 		if opts != nil && opts.RateLimiter != nil {
 			r.Use(rateLimitMiddleware(opts.RateLimiter))
 		}
+		if opts != nil && opts.StreamResume != nil {
+			r.Use(opts.StreamResume)
+		}
+		if opts != nil && opts.PayloadCapture != nil {
+			r.Use(opts.PayloadCapture)
+		}
+		if opts != nil && opts.StreamTap != nil {
+			r.Use(opts.StreamTap)
+		}
 		r.Post("/messages", proxy.HandleAnthropic)
+		r.Post("/messages/*", proxy.HandleAnthropic)
 		r.Post("/chat/completions", proxy.HandleOpenAI)
 		r.Post("/responses", proxy.HandleOpenAIResponses)
 		r.Post("/responses/compact", proxy.HandleOpenAIResponses)
+		r.Post("/embeddings", proxy.HandleEmbeddings)
+		r.Get("/models", proxy.HandleListModels)
+		r.Post("/experimental/compare", proxy.HandleCompare)
+	})
+
+	// Gemini-format proxy route; streams are not resumable.
+	r.Route("/v1beta", func(r chi.Router) {
+		if opts != nil && opts.Tracing {
+			r.Use(tracing.Middleware)
+		}
+		if opts != nil && opts.MaxHops > 0 {
+			r.Use(loopguard.Middleware(opts.MaxHops))
+		}
+		if opts != nil && opts.Drain != nil {
+			r.Use(opts.Drain.Middleware)
+		}
+		r.Use(llmAuth)
+		if opts != nil && opts.TrafficCapture != nil {
+			r.Use(opts.TrafficCapture)
+		}
+		if opts != nil && opts.RateLimiter != nil {
+			r.Use(rateLimitMiddleware(opts.RateLimiter))
+		}
+		if opts != nil && opts.PayloadCapture != nil {
+			r.Use(opts.PayloadCapture)
+		}
+		if opts != nil && opts.StreamTap != nil {
+			r.Use(opts.StreamTap)
+		}
+		r.Post("/models/*", proxy.HandleGemini)
 	})
 
 	// Management API routes (already handled by the management router's middleware)
 	r.Mount("/api/v1", mgmtRouter)
 
+	// Management API description (no auth; it documents routes, not data)
+	if opts != nil && opts.OpenAPI != nil {
+		r.Handle("/api/openapi.json", opts.OpenAPI)
+	}
+
 	// Bootstrap endpoint (only active when bootstrap key is configured)
 	if bootstrapHandler != nil {
 		r.Post("/api/v1/bootstrap", bootstrapHandler)
 	}
 
+	// Signed request log links (authorized by the link's signature)
+	if opts != nil && opts.SharedLogs != nil {
+		r.Get("/api/v1/shared/logs/{id}", opts.SharedLogs)
+	}
+
+	// Anonymized usage report (no auth; opt-in)
+	if opts != nil && opts.PublicUsage != nil {
+		r.Get("/api/v1/public/usage", opts.PublicUsage)
+	}
+
+	// Self-service usage for LLM keys (authenticated by the LLM key)
+	if opts != nil && opts.Self != nil {
+		r.Mount("/api/self", opts.Self)
+	}
+
 	// Health and readiness probes (no auth)
 	r.Get("/health", HealthHandler())
-	if opts != nil && opts.Pool != nil {
-		r.Get("/ready", ReadinessHandler(opts.Pool))
+	if opts != nil && opts.DB != nil {
+		r.Get("/ready", ReadinessHandler(opts.DB))
+		var drain DrainReporter
+		if opts.Drain != nil {
+			drain = opts.Drain
+		}
+		r.Get("/readyz", DegradedReadinessHandler(opts.DB, opts.Logs, opts.Warmup, drain))
 	}
 
 	// Prometheus metrics endpoint
@@ -106,12 +199,12 @@ func requestID(next http.Handler) http.Handler {
 			id = uuid.New().String()
 		}
 		w.Header().Set("X-Request-ID", id)
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(slogger.With(r.Context(), "request_id", id)))
 	})
 }
 
 // rateLimitMiddleware creates a chi middleware that rate-limits by auth key ID.
-func rateLimitMiddleware(limiter *ratelimit.Limiter) func(http.Handler) http.Handler {
+func rateLimitMiddleware(limiter ratelimit.Limiter) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Use the authenticated key ID from context (set by auth middleware
@@ -121,11 +214,9 @@ func rateLimitMiddleware(limiter *ratelimit.Limiter) func(http.Handler) http.Han
 				key = r.RemoteAddr
 			}
 
-			if !limiter.Allow(key) {
-				w.Header().Set("Content-Type", "application/json")
-				w.Header().Set("Retry-After", "1")
-				w.WriteHeader(http.StatusTooManyRequests)
-				w.Write([]byte(`{"type":"error","error":{"type":"rate_limit_error","message":"Rate limit exceeded"}}`))
+			if d := limiter.Take(key); !d.Allowed {
+				d.Hints().Set(w.Header(), time.Now())
+				auth.WriteError(w, r, http.StatusTooManyRequests, "Rate limit exceeded")
 				return
 			}
 
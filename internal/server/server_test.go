@@ -29,6 +29,22 @@ func (s *stubProxyHandler) HandleOpenAIResponses(w http.ResponseWriter, r *http.
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (s *stubProxyHandler) HandleListModels(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+func (s *stubProxyHandler) HandleCompare(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+func (s *stubProxyHandler) HandleGemini(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+func (s *stubProxyHandler) HandleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
 func TestResponsesCompactRoute(t *testing.T) {
 	cfg := &config.Config{CORSOrigins: []string{"*"}}
 	proxy := &stubProxyHandler{}
@@ -56,3 +72,49 @@ func TestResponsesCompactRoute(t *testing.T) {
 		t.Fatalf("expected path /v1/responses/compact, got %q", proxy.lastPath)
 	}
 }
+
+func TestProxyCORSPolicy(t *testing.T) {
+	cfg := &config.Config{
+		CORSOrigins:            []string{"https://admin.example.com"},
+		ProxyCORSOrigins:       []string{"https://app.example.com"},
+		ProxyCORSMaxAgeSeconds: 600,
+	}
+	router := New(cfg, &stubProxyHandler{}, func(next http.Handler) http.Handler { return next }, chi.NewRouter(), nil, nil, nil)
+
+	preflight := func(path, origin, headers string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, path, nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", headers)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := preflight("/v1/messages", "https://app.example.com", "x-api-key,anthropic-version,content-type,x-stainless-os")
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Fatalf("expected app origin to be allowed on /v1, got %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Errorf("expected max age 600, got %q", got)
+	}
+	if rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("expected no credentials on proxy endpoints")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(got, "X-Api-Key") {
+		t.Errorf("expected x-api-key to be allowed, got %q", got)
+	}
+
+	if got := preflight("/v1beta/models/gemini:generateContent", "https://app.example.com", "x-goog-api-key").Header().Get("Access-Control-Allow-Origin"); got == "" {
+		t.Error("expected app origin to be allowed on /v1beta")
+	}
+	if got := preflight("/api/v1/keys", "https://app.example.com", "authorization").Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected app origin to be refused on the management API, got %q", got)
+	}
+	if got := preflight("/v1/messages", "https://admin.example.com", "x-api-key").Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected admin origin to be refused on proxy endpoints, got %q", got)
+	}
+	if got := preflight("/api/v1/keys", "https://admin.example.com", "authorization").Header().Get("Access-Control-Allow-Origin"); got != "https://admin.example.com" {
+		t.Errorf("expected admin origin on the management API, got %q", got)
+	}
+}
@@ -0,0 +1,28 @@
+package slogger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestWithAddsFieldsToContextLogger(t *testing.T) {
+	if FromContext(context.Background()) != slog.Default() {
+		t.Fatal("expected the default logger without one in the context")
+	}
+
+	var buf bytes.Buffer
+	ctx := NewContext(context.Background(), slog.New(slog.NewTextHandler(&buf, nil)))
+	ctx = With(ctx, "request_id", "req-1")
+	ctx = With(ctx, "model", "gpt-4o")
+	FromContext(ctx).Warn("stream read error")
+
+	out := buf.String()
+	for _, want := range []string{"request_id=req-1", "model=gpt-4o", `msg="stream read error"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in %q", want, out)
+		}
+	}
+}
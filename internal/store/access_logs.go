@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// AccessLogEntry is a management API call to be recorded.
+type AccessLogEntry struct {
+	ManagementKeyID *uuid.UUID // nil when authentication failed
+	Timestamp       time.Time
+	Method          string
+	Path            string
+	Route           string
+	StatusCode      int
+	LatencyMS       int
+	ClientIP        string
+}
+
+// AccessLog is a recorded management API call.
+type AccessLog struct {
+	ID              uuid.UUID  `json:"id"`
+	ManagementKeyID *uuid.UUID `json:"management_key_id"`
+	Timestamp       time.Time  `json:"timestamp"`
+	Method          string     `json:"method"`
+	Path            string     `json:"path"`
+	Route           string     `json:"route"`
+	StatusCode      int        `json:"status_code"`
+	LatencyMS       int        `json:"latency_ms"`
+	ClientIP        string     `json:"client_ip"`
+}
+
+type AccessLogFilter struct {
+	ManagementKeyID *uuid.UUID
+	Unauthenticated bool // only calls without a valid key
+	StatusCode      *int // a multiple of 100 matches the whole class
+	ClientIP        *string
+	DateFrom        *time.Time
+	DateTo          *time.Time
+	Page            int
+	PerPage         int
+}
+
+func (s *Postgres) InsertAccessLogBatch(ctx context.Context, entries []*AccessLogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	query := `
+		INSERT INTO access_logs (
+			management_key_id, timestamp, method, path, route, status_code, latency_ms, client_ip
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	for _, e := range entries {
+		batch.Queue(query, e.ManagementKeyID, e.Timestamp, e.Method, e.Path, e.Route, e.StatusCode, e.LatencyMS, e.ClientIP)
+	}
+
+	br := s.pool.SendBatch(ctx, batch)
+	defer br.Close()
+
+	for range entries {
+		if _, err := br.Exec(); err != nil {
+			return fmt.Errorf("insert access log batch: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Postgres) ListAccessLogs(ctx context.Context, filter AccessLogFilter) ([]AccessLog, int, error) {
+	var conditions []string
+	var args []interface{}
+	argIdx := 1
+
+	if filter.ManagementKeyID != nil {
+		conditions = append(conditions, fmt.Sprintf("management_key_id = $%d", argIdx))
+		args = append(args, *filter.ManagementKeyID)
+		argIdx++
+	}
+	if filter.Unauthenticated {
+		conditions = append(conditions, "management_key_id IS NULL")
+	}
+	if filter.StatusCode != nil {
+		if *filter.StatusCode%100 == 0 {
+			conditions = append(conditions, fmt.Sprintf("status_code >= $%d AND status_code < $%d", argIdx, argIdx+1))
+			args = append(args, *filter.StatusCode, *filter.StatusCode+100)
+			argIdx += 2
+		} else {
+			conditions = append(conditions, fmt.Sprintf("status_code = $%d", argIdx))
+			args = append(args, *filter.StatusCode)
+			argIdx++
+		}
+	}
+	if filter.ClientIP != nil {
+		conditions = append(conditions, fmt.Sprintf("client_ip = $%d", argIdx))
+		args = append(args, *filter.ClientIP)
+		argIdx++
+	}
+	if filter.DateFrom != nil {
+		conditions = append(conditions, fmt.Sprintf("timestamp >= $%d", argIdx))
+		args = append(args, *filter.DateFrom)
+		argIdx++
+	}
+	if filter.DateTo != nil {
+		conditions = append(conditions, fmt.Sprintf("timestamp <= $%d", argIdx))
+		args = append(args, *filter.DateTo)
+		argIdx++
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	page := filter.Page
+	if page < 1 {
+		page = 1
+	}
+	perPage := filter.PerPage
+	if perPage < 1 {
+		perPage = 50
+	}
+	offset := (page - 1) * perPage
+
+	query := fmt.Sprintf(`
+		SELECT id, management_key_id, timestamp, method, path, route, status_code, latency_ms, client_ip,
+		       COUNT(*) OVER() as total
+		FROM access_logs %s
+		ORDER BY timestamp DESC
+		LIMIT $%d OFFSET $%d`, where, argIdx, argIdx+1)
+	args = append(args, perPage, offset)
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list access logs: %w", err)
+	}
+	defer rows.Close()
+
+	var logs []AccessLog
+	var total int
+	for rows.Next() {
+		var l AccessLog
+		if err := rows.Scan(
+			&l.ID, &l.ManagementKeyID, &l.Timestamp, &l.Method, &l.Path, &l.Route, &l.StatusCode, &l.LatencyMS, &l.ClientIP,
+			&total,
+		); err != nil {
+			return nil, 0, fmt.Errorf("scan access log: %w", err)
+		}
+		logs = append(logs, l)
+	}
+	return logs, total, rows.Err()
+}
+
+func (s *Postgres) DeleteOldAccessLogs(ctx context.Context, olderThan time.Time) (int64, error) {
+	ct, err := s.pool.Exec(ctx, "DELETE FROM access_logs WHERE timestamp < $1", olderThan)
+	if err != nil {
+		return 0, fmt.Errorf("delete old access logs: %w", err)
+	}
+	return ct.RowsAffected(), nil
+}
@@ -0,0 +1,258 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// AuditRule samples Percent of the requests of one key, one model, or both,
+// for full capture into the audit store. A nil KeyID or empty Model matches
+// any. There is at most one rule per key and model.
+type AuditRule struct {
+	ID        uuid.UUID  `json:"id"`
+	KeyID     *uuid.UUID `json:"llm_key_id"`
+	Model     string     `json:"model"`
+	Percent   float64    `json:"percent"` // 0-100
+	Note      string     `json:"note"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type AuditRuleCreate struct {
+	KeyID   *uuid.UUID `json:"llm_key_id"`
+	Model   string     `json:"model"`
+	Percent float64    `json:"percent"`
+	Note    string     `json:"note"`
+}
+
+// AuditSample is a request captured for a quality audit: its full request
+// and response bodies, cut short only past audit_capture_max_bytes, and the
+// outcome of the request. Percent is the sampling rate that picked it, so
+// reviews can weight samples from different rules.
+type AuditSample struct {
+	ID             uuid.UUID  `json:"id"`
+	RuleID         *uuid.UUID `json:"rule_id"` // nil when sampled at audit_sample_percent
+	Percent        float64    `json:"percent"`
+	KeyID          *uuid.UUID `json:"llm_key_id"`
+	Model          string     `json:"model"`
+	InputFormat    string     `json:"input_format"`
+	UpstreamFormat string     `json:"upstream_format"`
+	Translated     bool       `json:"translated"`
+	StatusCode     int        `json:"status_code"`
+	LatencyMS      int        `json:"latency_ms"`
+	InputTokens    int        `json:"input_tokens"`
+	OutputTokens   int        `json:"output_tokens"`
+	Request        string     `json:"request_body,omitempty"`
+	Response       string     `json:"response_body,omitempty"`
+	RequestBytes   int        `json:"request_bytes"`
+	ResponseBytes  int        `json:"response_bytes"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// AuditSampleView records a management key reading a sample's bodies.
+type AuditSampleView struct {
+	ManagementKeyID uuid.UUID `json:"management_key_id"`
+	ViewedAt        time.Time `json:"viewed_at"`
+}
+
+type AuditSampleFilter struct {
+	KeyID    *uuid.UUID
+	Model    *string
+	RuleID   *uuid.UUID
+	DateFrom *time.Time
+	DateTo   *time.Time
+	Page     int
+	PerPage  int
+}
+
+// ListAuditRules returns the sampling rules, rules for every key first.
+func (s *Postgres) ListAuditRules(ctx context.Context) ([]AuditRule, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, llm_key_id, model, percent, note, created_at
+		FROM audit_rules
+		ORDER BY llm_key_id NULLS FIRST, model, created_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list audit rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []AuditRule{}
+	for rows.Next() {
+		var r AuditRule
+		if err := rows.Scan(&r.ID, &r.KeyID, &r.Model, &r.Percent, &r.Note, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan audit rule: %w", err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// SetAuditRule creates the rule for a key and model, or replaces the rate
+// and note of the existing one.
+func (s *Postgres) SetAuditRule(ctx context.Context, rc *AuditRuleCreate) (*AuditRule, error) {
+	var r AuditRule
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO audit_rules (llm_key_id, model, percent, note)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT ((COALESCE(llm_key_id, '00000000-0000-0000-0000-000000000000'::uuid)), lower(model)) DO UPDATE SET
+			percent = EXCLUDED.percent,
+			note = EXCLUDED.note
+		RETURNING id, llm_key_id, model, percent, note, created_at
+	`, rc.KeyID, rc.Model, rc.Percent, rc.Note).Scan(&r.ID, &r.KeyID, &r.Model, &r.Percent, &r.Note, &r.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("set audit rule: %w", err)
+	}
+	return &r, nil
+}
+
+// DeleteAuditRule removes a rule; its samples are kept. It reports whether
+// the rule existed.
+func (s *Postgres) DeleteAuditRule(ctx context.Context, id uuid.UUID) (bool, error) {
+	ct, err := s.pool.Exec(ctx, `DELETE FROM audit_rules WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("delete audit rule: %w", err)
+	}
+	return ct.RowsAffected() > 0, nil
+}
+
+// ListAuditSamples returns samples newest first, without their bodies.
+func (s *Postgres) ListAuditSamples(ctx context.Context, filter AuditSampleFilter) ([]AuditSample, int, error) {
+	var conditions []string
+	var args []interface{}
+	argIdx := 1
+
+	if filter.KeyID != nil {
+		conditions = append(conditions, fmt.Sprintf("llm_key_id = $%d", argIdx))
+		args = append(args, *filter.KeyID)
+		argIdx++
+	}
+	if filter.Model != nil {
+		conditions = append(conditions, fmt.Sprintf("model ILIKE '%%' || $%d || '%%'", argIdx))
+		args = append(args, *filter.Model)
+		argIdx++
+	}
+	if filter.RuleID != nil {
+		conditions = append(conditions, fmt.Sprintf("rule_id = $%d", argIdx))
+		args = append(args, *filter.RuleID)
+		argIdx++
+	}
+	if filter.DateFrom != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", argIdx))
+		args = append(args, *filter.DateFrom)
+		argIdx++
+	}
+	if filter.DateTo != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at <= $%d", argIdx))
+		args = append(args, *filter.DateTo)
+		argIdx++
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	perPage := filter.PerPage
+	if perPage < 1 {
+		perPage = 50
+	}
+	limit, limitArgs := limitOffset(filter.Page, perPage, argIdx)
+	args = append(args, limitArgs...)
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, rule_id, percent, llm_key_id, model, input_format, COALESCE(upstream_format, ''), translated,
+		       status_code, latency_ms, input_tokens, output_tokens, request_bytes, response_bytes, created_at,
+		       COUNT(*) OVER() AS total
+		FROM audit_samples `+where+`
+		ORDER BY created_at DESC, id
+		`+limit, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list audit samples: %w", err)
+	}
+	defer rows.Close()
+
+	samples := []AuditSample{}
+	var total int
+	for rows.Next() {
+		var a AuditSample
+		if err := rows.Scan(
+			&a.ID, &a.RuleID, &a.Percent, &a.KeyID, &a.Model, &a.InputFormat, &a.UpstreamFormat, &a.Translated,
+			&a.StatusCode, &a.LatencyMS, &a.InputTokens, &a.OutputTokens, &a.RequestBytes, &a.ResponseBytes, &a.CreatedAt,
+			&total,
+		); err != nil {
+			return nil, 0, fmt.Errorf("scan audit sample: %w", err)
+		}
+		samples = append(samples, a)
+	}
+	return samples, total, rows.Err()
+}
+
+// ViewAuditSample returns a sample with its bodies, or nil if there is no
+// such sample, and records that viewer read it. The views include this one.
+func (s *Postgres) ViewAuditSample(ctx context.Context, id, viewer uuid.UUID) (*AuditSample, []AuditSampleView, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var a AuditSample
+	err = tx.QueryRow(ctx, `
+		SELECT id, rule_id, percent, llm_key_id, model, input_format, COALESCE(upstream_format, ''), translated,
+		       status_code, latency_ms, input_tokens, output_tokens, request_body, response_body,
+		       request_bytes, response_bytes, created_at
+		FROM audit_samples WHERE id = $1
+	`, id).Scan(
+		&a.ID, &a.RuleID, &a.Percent, &a.KeyID, &a.Model, &a.InputFormat, &a.UpstreamFormat, &a.Translated,
+		&a.StatusCode, &a.LatencyMS, &a.InputTokens, &a.OutputTokens, &a.Request, &a.Response,
+		&a.RequestBytes, &a.ResponseBytes, &a.CreatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("get audit sample: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO audit_sample_views (sample_id, management_key_id) VALUES ($1, $2)`, id, viewer); err != nil {
+		return nil, nil, fmt.Errorf("record audit sample view: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT management_key_id, viewed_at FROM audit_sample_views
+		WHERE sample_id = $1 ORDER BY viewed_at
+	`, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list audit sample views: %w", err)
+	}
+	views := []AuditSampleView{}
+	for rows.Next() {
+		var v AuditSampleView
+		if err := rows.Scan(&v.ManagementKeyID, &v.ViewedAt); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("scan audit sample view: %w", err)
+		}
+		views = append(views, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("list audit sample views: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("commit tx: %w", err)
+	}
+	return &a, views, nil
+}
+
+// DeleteOldAuditSamples deletes samples older than olderThan, with their
+// views.
+func (s *Postgres) DeleteOldAuditSamples(ctx context.Context, olderThan time.Time) (int64, error) {
+	ct, err := s.pool.Exec(ctx, "DELETE FROM audit_samples WHERE created_at < $1", olderThan)
+	if err != nil {
+		return 0, fmt.Errorf("delete old audit samples: %w", err)
+	}
+	return ct.RowsAffected(), nil
+}
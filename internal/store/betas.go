@@ -0,0 +1,28 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AnthropicBetas configures the anthropic-beta flags sent to an upstream.
+// Default flags are added to every request. Allowed, when not null, lists
+// the flags the upstream accepts; others are dropped, and [] drops them
+// all. Entries match by prefix, so "interleaved-thinking" allows every
+// dated version of that beta. Stored as JSONB.
+type AnthropicBetas struct {
+	Default []string `json:"default"`
+	Allowed []string `json:"allowed"`
+}
+
+// Validate checks that every entry is a single, non-empty flag.
+func (b *AnthropicBetas) Validate() error {
+	for _, list := range [][]string{b.Default, b.Allowed} {
+		for _, f := range list {
+			if strings.TrimSpace(f) == "" || strings.ContainsAny(f, ", ") {
+				return fmt.Errorf("invalid anthropic beta flag %q", f)
+			}
+		}
+	}
+	return nil
+}
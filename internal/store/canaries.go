@@ -0,0 +1,222 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Canary statuses.
+const (
+	CanaryRunning    = "running"
+	CanaryPromoted   = "promoted"
+	CanaryRolledBack = "rolled_back"
+)
+
+// Canary arms recorded on request logs.
+const (
+	CanaryArmStable = "stable"
+	CanaryArmCanary = "canary"
+)
+
+// PolicyCanary is a candidate version of the full policy set, applied to
+// Percent of traffic while it runs. Promoting it replaces the active
+// policies; a regression against the stable arm rolls it back.
+type PolicyCanary struct {
+	ID           uuid.UUID      `json:"id"`
+	Name         string         `json:"name"`
+	Policies     []PolicyCreate `json:"policies"`
+	Percent      int            `json:"percent"`
+	Status       string         `json:"status"` // running, promoted, rolled_back
+	StatusReason *string        `json:"status_reason"`
+
+	// Rollback thresholds: the canary is rolled back once both arms have
+	// MinRequests requests and its error rate or average latency exceeds the
+	// stable arm's by more than these deltas. 0 disables the latency check.
+	MaxErrorRateDelta float64 `json:"max_error_rate_delta"`
+	MaxLatencyDeltaMS int     `json:"max_latency_delta_ms"`
+	MinRequests       int     `json:"min_requests"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PolicyCanaryCreate struct {
+	Name              string         `json:"name"`
+	Policies          []PolicyCreate `json:"policies"`
+	Percent           int            `json:"percent"`
+	MaxErrorRateDelta *float64       `json:"max_error_rate_delta"`
+	MaxLatencyDeltaMS *int           `json:"max_latency_delta_ms"`
+	MinRequests       *int           `json:"min_requests"`
+}
+
+// CanaryArmStats summarises the requests evaluated under one canary arm.
+// ErrorRate is the share of 5xx responses.
+type CanaryArmStats struct {
+	Requests     int     `json:"requests"`
+	ErrorRate    float64 `json:"error_rate"`
+	AvgLatencyMS float64 `json:"avg_latency_ms"`
+}
+
+type CanaryStats struct {
+	Stable CanaryArmStats `json:"stable"`
+	Canary CanaryArmStats `json:"canary"`
+}
+
+const canaryColumns = `id, name, policies, percent, status, status_reason, max_error_rate_delta, max_latency_delta_ms, min_requests, created_at, updated_at`
+
+func scanCanary(row pgx.Row, c *PolicyCanary) error {
+	return row.Scan(
+		&c.ID, &c.Name, &c.Policies, &c.Percent, &c.Status, &c.StatusReason,
+		&c.MaxErrorRateDelta, &c.MaxLatencyDeltaMS, &c.MinRequests, &c.CreatedAt, &c.UpdatedAt,
+	)
+}
+
+// ListPolicyCanaries returns all canaries, newest first.
+func (s *Postgres) ListPolicyCanaries(ctx context.Context) ([]PolicyCanary, error) {
+	rows, err := s.pool.Query(ctx, `SELECT `+canaryColumns+` FROM policy_canaries ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("list policy canaries: %w", err)
+	}
+	defer rows.Close()
+
+	canaries := make([]PolicyCanary, 0)
+	for rows.Next() {
+		var c PolicyCanary
+		if err := scanCanary(rows, &c); err != nil {
+			return nil, fmt.Errorf("scan policy canary: %w", err)
+		}
+		canaries = append(canaries, c)
+	}
+	return canaries, rows.Err()
+}
+
+func (s *Postgres) GetPolicyCanary(ctx context.Context, id uuid.UUID) (*PolicyCanary, error) {
+	var c PolicyCanary
+	err := scanCanary(s.pool.QueryRow(ctx, `SELECT `+canaryColumns+` FROM policy_canaries WHERE id = $1`, id), &c)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get policy canary: %w", err)
+	}
+	return &c, nil
+}
+
+// GetRunningPolicyCanary returns the running canary, or nil if none is.
+func (s *Postgres) GetRunningPolicyCanary(ctx context.Context) (*PolicyCanary, error) {
+	var c PolicyCanary
+	err := scanCanary(s.pool.QueryRow(ctx, `SELECT `+canaryColumns+` FROM policy_canaries WHERE status = 'running'`), &c)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get running policy canary: %w", err)
+	}
+	return &c, nil
+}
+
+// CreatePolicyCanary starts a canary. It fails if another canary is running.
+func (s *Postgres) CreatePolicyCanary(ctx context.Context, cc *PolicyCanaryCreate) (*PolicyCanary, error) {
+	var c PolicyCanary
+	err := scanCanary(s.pool.QueryRow(ctx, `
+		INSERT INTO policy_canaries (name, policies, percent, max_error_rate_delta, max_latency_delta_ms, min_requests)
+		VALUES ($1, $2, $3, COALESCE($4, 0.05), COALESCE($5, 0), COALESCE($6, 100))
+		RETURNING `+canaryColumns,
+		cc.Name, cc.Policies, cc.Percent, cc.MaxErrorRateDelta, cc.MaxLatencyDeltaMS, cc.MinRequests,
+	), &c)
+	if err != nil {
+		return nil, fmt.Errorf("create policy canary: %w", err)
+	}
+	return &c, nil
+}
+
+// RollBackPolicyCanary stops a running canary. It reports false if the
+// canary was not running.
+func (s *Postgres) RollBackPolicyCanary(ctx context.Context, id uuid.UUID, reason string) (bool, error) {
+	ct, err := s.pool.Exec(ctx, `
+		UPDATE policy_canaries SET status = 'rolled_back', status_reason = $2, updated_at = now()
+		WHERE id = $1 AND status = 'running'
+	`, id, reason)
+	if err != nil {
+		return false, fmt.Errorf("roll back policy canary: %w", err)
+	}
+	return ct.RowsAffected() > 0, nil
+}
+
+// PromotePolicyCanary replaces the active policies with the canary's and
+// marks it promoted, in one transaction. It reports false if the canary was
+// not running.
+func (s *Postgres) PromotePolicyCanary(ctx context.Context, id uuid.UUID) (bool, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var policies []PolicyCreate
+	err = tx.QueryRow(ctx, `
+		UPDATE policy_canaries SET status = 'promoted', status_reason = NULL, updated_at = now()
+		WHERE id = $1 AND status = 'running'
+		RETURNING policies
+	`, id).Scan(&policies)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("promote policy canary: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM policies"); err != nil {
+		return false, fmt.Errorf("clear policies: %w", err)
+	}
+	for _, p := range policies {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO policies (name, expression, action, target_model, max_tokens, message, priority)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, p.Name, p.Expression, p.Action, p.TargetModel, p.MaxTokens, p.Message, p.Priority); err != nil {
+			return false, fmt.Errorf("insert policy %q: %w", p.Name, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("commit tx: %w", err)
+	}
+	return true, nil
+}
+
+// PolicyCanaryStats compares the requests logged under each arm of a canary.
+func (s *Postgres) PolicyCanaryStats(ctx context.Context, id uuid.UUID) (*CanaryStats, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT canary_arm,
+		       COUNT(*),
+		       COALESCE(AVG(CASE WHEN status_code >= 500 THEN 1 ELSE 0 END), 0)::float8,
+		       COALESCE(AVG(latency_ms), 0)::float8
+		FROM request_logs
+		WHERE canary_id = $1
+		GROUP BY canary_arm
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("policy canary stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats CanaryStats
+	for rows.Next() {
+		var arm string
+		var as CanaryArmStats
+		if err := rows.Scan(&arm, &as.Requests, &as.ErrorRate, &as.AvgLatencyMS); err != nil {
+			return nil, fmt.Errorf("scan policy canary stats: %w", err)
+		}
+		switch arm {
+		case CanaryArmStable:
+			stats.Stable = as
+		case CanaryArmCanary:
+			stats.Canary = as
+		}
+	}
+	return &stats, rows.Err()
+}
@@ -2,111 +2,48 @@ package store
 
 import (
 	"context"
-	"embed"
 	"fmt"
 	"regexp"
-	"sort"
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-//go:embed migrations/*.sql
-var migrations embed.FS
-
 var schemaNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
 
-type Store struct {
+// Postgres is the Store backed by a PostgreSQL database.
+type Postgres struct {
 	pool          *pgxpool.Pool
 	encryptionKey []byte // nil = no encryption
 }
 
-func New(pool *pgxpool.Pool) *Store {
-	return &Store{pool: pool}
+func New(pool *pgxpool.Pool) *Postgres {
+	return &Postgres{pool: pool}
 }
 
-// NewWithEncryption creates a Store that encrypts/decrypts upstream API keys.
-func NewWithEncryption(pool *pgxpool.Pool, encryptionKey []byte) *Store {
-	return &Store{pool: pool, encryptionKey: encryptionKey}
+// NewWithEncryption creates a Postgres store that encrypts/decrypts upstream API keys.
+func NewWithEncryption(pool *pgxpool.Pool, encryptionKey []byte) *Postgres {
+	return &Postgres{pool: pool, encryptionKey: encryptionKey}
 }
 
-func (s *Store) Pool() *pgxpool.Pool {
+func (s *Postgres) Pool() *pgxpool.Pool {
 	return s.pool
 }
 
-func (s *Store) Migrate(ctx context.Context) error {
-	_, err := s.pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS schema_migrations (
-			version    TEXT PRIMARY KEY,
-			applied_at TIMESTAMPTZ DEFAULT now()
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("create schema_migrations table: %w", err)
-	}
-
-	entries, err := migrations.ReadDir("migrations")
-	if err != nil {
-		return fmt.Errorf("read migrations dir: %w", err)
-	}
-
-	var upFiles []string
-	for _, e := range entries {
-		if strings.HasSuffix(e.Name(), ".up.sql") {
-			upFiles = append(upFiles, e.Name())
-		}
-	}
-	sort.Strings(upFiles)
-
-	for _, filename := range upFiles {
-		version := strings.TrimSuffix(filename, ".up.sql")
-
-		var exists bool
-		err := s.pool.QueryRow(ctx,
-			"SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = $1)",
-			version,
-		).Scan(&exists)
-		if err != nil {
-			return fmt.Errorf("check migration %s: %w", version, err)
-		}
-		if exists {
-			continue
-		}
-
-		content, err := migrations.ReadFile("migrations/" + filename)
-		if err != nil {
-			return fmt.Errorf("read migration %s: %w", filename, err)
-		}
-
-		tx, err := s.pool.Begin(ctx)
-		if err != nil {
-			return fmt.Errorf("begin tx for migration %s: %w", version, err)
-		}
-
-		if _, err := tx.Exec(ctx, string(content)); err != nil {
-			tx.Rollback(ctx)
-			return fmt.Errorf("execute migration %s: %w", version, err)
-		}
-
-		if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
-			tx.Rollback(ctx)
-			return fmt.Errorf("record migration %s: %w", version, err)
-		}
-
-		if err := tx.Commit(ctx); err != nil {
-			return fmt.Errorf("commit migration %s: %w", version, err)
-		}
-	}
-
-	return nil
-}
-
-func (s *Store) Health(ctx context.Context) error {
+func (s *Postgres) Health(ctx context.Context) error {
 	return s.pool.Ping(ctx)
 }
 
 func NewPool(ctx context.Context, databaseURL, databaseSchema string, maxConns, minConns int32) (*pgxpool.Pool, error) {
+	return NewPoolWithTracer(ctx, databaseURL, databaseSchema, maxConns, minConns, nil)
+}
+
+// NewPoolWithTracer is NewPool with a query tracer, such as a
+// SlowQueryTracer, installed on every connection. A nil tracer disables
+// tracing.
+func NewPoolWithTracer(ctx context.Context, databaseURL, databaseSchema string, maxConns, minConns int32, tracer pgx.QueryTracer) (*pgxpool.Pool, error) {
 	config, err := pgxpool.ParseConfig(databaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("parse database url: %w", err)
@@ -128,6 +65,9 @@ func NewPool(ctx context.Context, databaseURL, databaseSchema string, maxConns,
 	config.MinConns = minConns
 	config.HealthCheckPeriod = 30 * time.Second
 	config.MaxConnLifetime = 1 * time.Hour
+	if tracer != nil {
+		config.ConnConfig.Tracer = tracer
+	}
 	if schema == "public" {
 		config.ConnConfig.RuntimeParams["search_path"] = "public"
 	} else {
@@ -0,0 +1,204 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Guardrail is a filter the proxy runs over the text of requests, responses
+// or both. Kind picks the filter and the fields it uses: Patterns for regex,
+// MaxChars for max_length and Entities for pii. A block guardrail stops what
+// it matches; a flag guardrail only records it with the request log.
+type Guardrail struct {
+	ID        uuid.UUID  `json:"id"`
+	Name      string     `json:"name"`
+	Kind      string     `json:"kind"`       // regex, max_length, pii
+	Stage     string     `json:"stage"`      // request, response, both
+	Mode      string     `json:"mode"`       // block, flag
+	KeyID     *uuid.UUID `json:"llm_key_id"` // nil applies to every key
+	Patterns  []string   `json:"patterns"`
+	MaxChars  int        `json:"max_chars"`
+	Entities  []string   `json:"entities"` // empty detects every entity
+	Message   string     `json:"message"`  // sent to the client when blocked
+	IsActive  bool       `json:"is_active"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type GuardrailCreate struct {
+	Name     string     `json:"name"`
+	Kind     string     `json:"kind"`
+	Stage    string     `json:"stage"`
+	Mode     string     `json:"mode"`
+	KeyID    *uuid.UUID `json:"llm_key_id"`
+	Patterns []string   `json:"patterns"`
+	MaxChars int        `json:"max_chars"`
+	Entities []string   `json:"entities"`
+	Message  string     `json:"message"`
+}
+
+type GuardrailUpdate struct {
+	Name     *string   `json:"name,omitempty"`
+	Stage    *string   `json:"stage,omitempty"`
+	Mode     *string   `json:"mode,omitempty"`
+	Patterns *[]string `json:"patterns,omitempty"`
+	MaxChars *int      `json:"max_chars,omitempty"`
+	Entities *[]string `json:"entities,omitempty"`
+	Message  *string   `json:"message,omitempty"`
+	IsActive *bool     `json:"is_active,omitempty"`
+}
+
+// Apply returns g as it looks after the update.
+func (upd *GuardrailUpdate) Apply(g Guardrail) Guardrail {
+	if upd.Name != nil {
+		g.Name = *upd.Name
+	}
+	if upd.Stage != nil {
+		g.Stage = *upd.Stage
+	}
+	if upd.Mode != nil {
+		g.Mode = *upd.Mode
+	}
+	if upd.Patterns != nil {
+		g.Patterns = *upd.Patterns
+	}
+	if upd.MaxChars != nil {
+		g.MaxChars = *upd.MaxChars
+	}
+	if upd.Entities != nil {
+		g.Entities = *upd.Entities
+	}
+	if upd.Message != nil {
+		g.Message = *upd.Message
+	}
+	if upd.IsActive != nil {
+		g.IsActive = *upd.IsActive
+	}
+	return g
+}
+
+const guardrailColumns = `id, name, kind, stage, mode, llm_key_id, patterns, max_chars, entities, message, is_active, created_at, updated_at`
+
+func scanGuardrail(row pgx.Row, g *Guardrail) error {
+	return row.Scan(
+		&g.ID, &g.Name, &g.Kind, &g.Stage, &g.Mode, &g.KeyID, &g.Patterns, &g.MaxChars,
+		&g.Entities, &g.Message, &g.IsActive, &g.CreatedAt, &g.UpdatedAt,
+	)
+}
+
+// orEmpty returns s, or an empty slice for the NOT NULL array columns if s
+// is nil.
+func orEmpty(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// ListGuardrails returns every guardrail, those for every key first.
+func (s *Postgres) ListGuardrails(ctx context.Context) ([]Guardrail, error) {
+	rows, err := s.pool.Query(ctx, `SELECT `+guardrailColumns+` FROM guardrails ORDER BY llm_key_id NULLS FIRST, name`)
+	if err != nil {
+		return nil, fmt.Errorf("list guardrails: %w", err)
+	}
+	defer rows.Close()
+
+	guardrails := []Guardrail{}
+	for rows.Next() {
+		var g Guardrail
+		if err := scanGuardrail(rows, &g); err != nil {
+			return nil, fmt.Errorf("scan guardrail: %w", err)
+		}
+		guardrails = append(guardrails, g)
+	}
+	return guardrails, rows.Err()
+}
+
+func (s *Postgres) GetGuardrail(ctx context.Context, id uuid.UUID) (*Guardrail, error) {
+	var g Guardrail
+	err := scanGuardrail(s.pool.QueryRow(ctx, `SELECT `+guardrailColumns+` FROM guardrails WHERE id = $1`, id), &g)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get guardrail: %w", err)
+	}
+	return &g, nil
+}
+
+func (s *Postgres) CreateGuardrail(ctx context.Context, gc *GuardrailCreate) (*Guardrail, error) {
+	var g Guardrail
+	err := scanGuardrail(s.pool.QueryRow(ctx, `
+		INSERT INTO guardrails (name, kind, stage, mode, llm_key_id, patterns, max_chars, entities, message)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING `+guardrailColumns,
+		gc.Name, gc.Kind, gc.Stage, gc.Mode, gc.KeyID, orEmpty(gc.Patterns), gc.MaxChars, orEmpty(gc.Entities), gc.Message,
+	), &g)
+	if err != nil {
+		return nil, fmt.Errorf("create guardrail: %w", err)
+	}
+	return &g, nil
+}
+
+func (s *Postgres) UpdateGuardrail(ctx context.Context, id uuid.UUID, upd *GuardrailUpdate) error {
+	sets := []string{}
+	args := []any{}
+	argIdx := 1
+
+	add := func(col string, v any) {
+		sets = append(sets, fmt.Sprintf("%s = $%d", col, argIdx))
+		args = append(args, v)
+		argIdx++
+	}
+	if upd.Name != nil {
+		add("name", *upd.Name)
+	}
+	if upd.Stage != nil {
+		add("stage", *upd.Stage)
+	}
+	if upd.Mode != nil {
+		add("mode", *upd.Mode)
+	}
+	if upd.Patterns != nil {
+		add("patterns", orEmpty(*upd.Patterns))
+	}
+	if upd.MaxChars != nil {
+		add("max_chars", *upd.MaxChars)
+	}
+	if upd.Entities != nil {
+		add("entities", orEmpty(*upd.Entities))
+	}
+	if upd.Message != nil {
+		add("message", *upd.Message)
+	}
+	if upd.IsActive != nil {
+		add("is_active", *upd.IsActive)
+	}
+
+	if len(sets) == 0 {
+		return nil
+	}
+
+	sets = append(sets, "updated_at = now()")
+	args = append(args, id)
+
+	query := fmt.Sprintf("UPDATE guardrails SET %s WHERE id = $%d", strings.Join(sets, ", "), argIdx)
+	if _, err := s.pool.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("update guardrail: %w", err)
+	}
+	return nil
+}
+
+// DeleteGuardrail removes a guardrail. It reports whether it existed.
+func (s *Postgres) DeleteGuardrail(ctx context.Context, id uuid.UUID) (bool, error) {
+	ct, err := s.pool.Exec(ctx, `DELETE FROM guardrails WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("delete guardrail: %w", err)
+	}
+	return ct.RowsAffected() > 0, nil
+}
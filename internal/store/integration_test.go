@@ -0,0 +1,480 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sertdev/pxbin/internal/crypto"
+)
+
+// These tests run against a real PostgreSQL instance and are skipped unless
+// PXBIN_TEST_DATABASE_URL is set (see `make test-integration`). Each test
+// gets its own schema, which is dropped afterwards.
+
+func newTestStore(t *testing.T) *Postgres {
+	t.Helper()
+	url := os.Getenv("PXBIN_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("PXBIN_TEST_DATABASE_URL not set")
+	}
+
+	ctx := context.Background()
+	schema := fmt.Sprintf("pxbin_test_%d", time.Now().UnixNano())
+	pool, err := NewPool(ctx, url, schema, 4, 1)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), "DROP SCHEMA IF EXISTS "+schema+" CASCADE")
+		pool.Close()
+	})
+
+	s := NewWithEncryption(pool, crypto.DeriveKey("integration-test"))
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	// Migrations must be idempotent across restarts.
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+	return s
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestIntegrationMigrateTo(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	st, err := s.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := st.Latest
+	if st.Version != latest || len(st.Pending) != 0 || len(st.History) != latest {
+		t.Fatalf("expected a fully migrated schema, got %+v", st)
+	}
+
+	// Every down migration must revert its up migration, down to nothing.
+	if err := s.MigrateTo(ctx, 0); err != nil {
+		t.Fatalf("migrate to 0: %v", err)
+	}
+	if st, err = s.MigrationStatus(ctx); err != nil || st.Version != 0 || len(st.Pending) != latest {
+		t.Fatalf("expected an empty schema, got %+v (%v)", st, err)
+	}
+	if err := s.MigrateTo(ctx, latest-1); err != nil {
+		t.Fatalf("migrate to %d: %v", latest-1, err)
+	}
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if st, err = s.MigrationStatus(ctx); err != nil || st.Version != latest {
+		t.Fatalf("expected version %d, got %+v (%v)", latest, st, err)
+	}
+	if err := s.MigrateTo(ctx, latest+1); err == nil {
+		t.Fatal("expected an unknown version to be rejected")
+	}
+}
+
+func TestIntegrationUpstreamsAndModels(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	primary, err := s.CreateUpstream(ctx, &UpstreamCreate{Name: "primary", BaseURL: "https://a.example", APIKey: "sk-a", Priority: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primary.Format != "openai" || primary.APIKeyEncrypted != "sk-a" {
+		t.Fatalf("unexpected upstream: format=%q key=%q", primary.Format, primary.APIKeyEncrypted)
+	}
+	var stored string
+	if err := s.pool.QueryRow(ctx, "SELECT api_key_encrypted FROM upstreams WHERE id = $1", primary.ID).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored == "sk-a" || !crypto.IsEncrypted(stored) {
+		t.Fatalf("expected api key to be encrypted at rest, got %q", stored)
+	}
+
+	secondary, err := s.CreateUpstream(ctx, &UpstreamCreate{Name: "secondary", BaseURL: "https://b.example", APIKey: "sk-b", Format: "anthropic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Dynamic UPDATE builder: several fields at once, and a no-op update.
+	sched := Schedule{{Start: "09:00", End: "17:00"}}
+	if err := s.UpdateUpstream(ctx, secondary.ID, &UpstreamUpdate{Priority: ptr(20), APIKey: ptr("sk-b2"), Availability: &sched}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateUpstream(ctx, secondary.ID, &UpstreamUpdate{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetUpstream(ctx, secondary.ID)
+	if err != nil || got == nil {
+		t.Fatalf("get upstream: %v", err)
+	}
+	if got.Priority != 20 || got.APIKeyEncrypted != "sk-b2" || len(got.Availability) != 1 {
+		t.Fatalf("update not applied: %+v", got)
+	}
+
+	ups, total, err := s.ListUpstreamsFiltered(ctx, UpstreamFilter{Sort: "-priority", Page: 1, PerPage: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(ups) != 1 || ups[0].Name != "secondary" {
+		t.Fatalf("unexpected page: total=%d ups=%+v", total, ups)
+	}
+	ups, total, err = s.ListUpstreamsFiltered(ctx, UpstreamFilter{Format: ptr("anthropic"), Search: ptr("B.EXAMPLE")})
+	if err != nil || total != 1 || ups[0].ID != secondary.ID {
+		t.Fatalf("filter: total=%d err=%v", total, err)
+	}
+	if _, _, err := s.ListUpstreamsFiltered(ctx, UpstreamFilter{Sort: "api_key_encrypted"}); !errors.Is(err, ErrInvalidSort) {
+		t.Fatalf("expected ErrInvalidSort, got %v", err)
+	}
+
+	model, err := s.CreateModel(ctx, &ModelCreate{
+		Name: "gpt-test", Provider: "openai", UpstreamID: &primary.ID,
+		InputCostPerMillion: 2.5, OutputCostPerMillion: 10,
+		ContextWindow: ptr(128000), MaxOutputTokens: ptr(16384),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model.InputCostPerMillion != 2.5 || *model.ContextWindow != 128000 {
+		t.Fatalf("unexpected model: %+v", model)
+	}
+
+	mw, err := s.GetModelWithUpstream(ctx, "gpt-test")
+	if err != nil || mw == nil {
+		t.Fatalf("get model with upstream: %v", err)
+	}
+	if mw.UpstreamAPIKey != "sk-a" || mw.UpstreamBaseURL != "https://a.example" {
+		t.Fatalf("unexpected join: %+v", mw)
+	}
+
+	// Inactive models are not resolvable.
+	if err := s.UpdateModel(ctx, model.ID, &ModelUpdate{IsActive: ptr(false), DisplayName: ptr("GPT Test")}); err != nil {
+		t.Fatal(err)
+	}
+	if mw, err := s.GetModelWithUpstream(ctx, "gpt-test"); err != nil || mw != nil {
+		t.Fatalf("expected inactive model to be unresolvable, got %+v, %v", mw, err)
+	}
+
+	models, total, err := s.ListModelsFiltered(ctx, ModelFilter{IsActive: ptr(false)})
+	if err != nil || total != 1 || *models[0].DisplayName != "GPT Test" {
+		t.Fatalf("list models: total=%d err=%v", total, err)
+	}
+
+	// Deleting an upstream unlinks its models instead of failing on the FK.
+	if err := s.DeleteUpstream(ctx, primary.ID); err != nil {
+		t.Fatal(err)
+	}
+	m, err := s.GetModel(ctx, model.ID)
+	if err != nil || m == nil || m.UpstreamID != nil {
+		t.Fatalf("expected model to be unlinked, got %+v, %v", m, err)
+	}
+
+	if n, err := s.DeleteUpstreams(ctx, []uuid.UUID{secondary.ID}); err != nil || n != 1 {
+		t.Fatalf("bulk delete: n=%d err=%v", n, err)
+	}
+	if n, err := s.DeleteModels(ctx, []uuid.UUID{model.ID}); err != nil || n != 1 {
+		t.Fatalf("bulk delete models: n=%d err=%v", n, err)
+	}
+}
+
+func TestIntegrationWildcardAliases(t *testing.T) {
+	testWildcardAliases(t, newTestStore(t))
+}
+
+func TestIntegrationMarkStaleModels(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	up, err := s.CreateUpstream(ctx, &UpstreamCreate{Name: "gw", BaseURL: "https://gw.example", AutoImportModels: true})
+	if err != nil || !up.AutoImportModels {
+		t.Fatalf("create upstream: %+v, %v", up, err)
+	}
+	for _, name := range []string{"kept", "Gone"} {
+		if _, err := s.CreateModel(ctx, &ModelCreate{Name: name, Provider: "gw", UpstreamID: &up.ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.MarkStaleModels(ctx, up.ID, []string{"KEPT", "other"}); err != nil {
+		t.Fatal(err)
+	}
+	stale, total, err := s.ListModelsFiltered(ctx, ModelFilter{Stale: ptr(true)})
+	if err != nil || total != 1 || stale[0].Name != "Gone" || stale[0].StaleSince == nil {
+		t.Fatalf("expected Gone to be stale, got %+v, %v", stale, err)
+	}
+	since := *stale[0].StaleSince
+
+	// A second sync keeps the original time; a model that is listed again
+	// is no longer stale.
+	if err := s.MarkStaleModels(ctx, up.ID, []string{"kept"}); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := s.GetModelByName(ctx, "gone"); m.StaleSince == nil || !m.StaleSince.Equal(since) {
+		t.Fatalf("expected stale_since to be kept, got %v", m.StaleSince)
+	}
+	if err := s.MarkStaleModels(ctx, up.ID, []string{"kept", "gone"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ := s.ListModelsFiltered(ctx, ModelFilter{Stale: ptr(true)}); total != 0 {
+		t.Fatalf("expected no stale models, got %d", total)
+	}
+
+	if err := s.UpdateUpstream(ctx, up.ID, &UpstreamUpdate{AutoImportModels: ptr(false)}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetUpstream(ctx, up.ID); got.AutoImportModels {
+		t.Fatal("expected auto_import_models to be cleared")
+	}
+}
+
+func TestIntegrationKeys(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	k, err := s.CreateLLMKey(ctx, "hash-1", "pxb_abc", "ci", ptr(60))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateLLMKey(ctx, "hash-2", "pxb_def", "other", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	byHash, err := s.GetLLMKeyByHash(ctx, "hash-1")
+	if err != nil || byHash == nil || byHash.ID != k.ID {
+		t.Fatalf("get by hash: %+v, %v", byHash, err)
+	}
+	if missing, err := s.GetLLMKeyByHash(ctx, "nope"); err != nil || missing != nil {
+		t.Fatalf("expected nil for unknown hash, got %+v, %v", missing, err)
+	}
+
+	if err := s.UpdateLLMKey(ctx, k.ID, LLMKeyUpdate{Name: ptr("ci-renamed"), RateLimit: ptr(120)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.BatchUpdateLLMKeyLastUsed(ctx, []uuid.UUID{k.ID}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetLLMKey(ctx, k.ID)
+	if err != nil || got.Name != "ci-renamed" || *got.RateLimit != 120 || got.LastUsedAt == nil {
+		t.Fatalf("unexpected key after update: %+v, %v", got, err)
+	}
+
+	keys, total, err := s.ListLLMKeys(ctx, 1, 1)
+	if err != nil || total != 2 || len(keys) != 1 {
+		t.Fatalf("list keys: total=%d len=%d err=%v", total, len(keys), err)
+	}
+
+	if err := s.DeactivateLLMKey(ctx, k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetLLMKey(ctx, k.ID); got.IsActive {
+		t.Fatal("expected key to be deactivated")
+	}
+
+	mk, err := s.CreateManagementKey(ctx, "mhash", "pxm_abc", "admin", []string{"read", "write"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateManagementKey(ctx, mk.ID, ManagementKeyUpdate{Permissions: []string{"read"}}); err != nil {
+		t.Fatal(err)
+	}
+	gotMK, err := s.GetManagementKeyByHash(ctx, "mhash")
+	if err != nil || len(gotMK.Permissions) != 1 || gotMK.Permissions[0] != "read" {
+		t.Fatalf("unexpected management key: %+v, %v", gotMK, err)
+	}
+}
+
+func TestIntegrationLogsAndStats(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	key, err := s.CreateLLMKey(ctx, "hash", "pxb_log", "logger", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	entries := []*LogEntry{
+		{KeyID: key.ID, Timestamp: now, Method: "POST", Path: "/v1/messages", Model: "claude-a", InputFormat: "anthropic", StatusCode: 200, LatencyMS: 100, InputTokens: 1000, OutputTokens: 100, CacheReadTokens: 1000, ToolCalls: 3, Cost: 0.01},
+		{KeyID: key.ID, Timestamp: now, Method: "POST", Path: "/v1/messages", Model: "claude-a", InputFormat: "anthropic", StatusCode: 200, LatencyMS: 300, InputTokens: 3000, OutputTokens: 300, Cost: 0.03},
+		{KeyID: key.ID, Timestamp: now, Method: "POST", Path: "/v1/chat/completions", Model: "gpt-b", InputFormat: "openai", StatusCode: 502, LatencyMS: 50, ErrorMessage: "upstream down"},
+		{KeyID: key.ID, Timestamp: now.Add(-48 * time.Hour), Method: "POST", Path: "/v1/messages", Model: "claude-a", InputFormat: "anthropic", StatusCode: 200, LatencyMS: 10, InputTokens: 5, Cost: 1},
+	}
+	if err := s.InsertLogBatch(ctx, entries); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InsertLog(ctx, &LogEntry{KeyID: key.ID, Timestamp: now, Method: "POST", Path: "/v1/messages", Model: "claude-a", InputFormat: "anthropic", StatusCode: 429, RequestMetadata: map[string]interface{}{"retry": true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	logs, total, err := s.ListLogs(ctx, LogFilter{StatusCode: ptr(500)})
+	if err != nil || total != 1 || *logs[0].ErrorMessage != "upstream down" {
+		t.Fatalf("status class filter: total=%d err=%v", total, err)
+	}
+	logs, total, err = s.ListLogs(ctx, LogFilter{KeyID: &key.ID, Model: ptr("CLAUDE"), InputFormat: ptr("anthropic"), PerPage: 2})
+	if err != nil || total != 4 || len(logs) != 2 {
+		t.Fatalf("combined filter: total=%d len=%d err=%v", total, len(logs), err)
+	}
+	if got, err := s.GetLog(ctx, logs[0].ID); err != nil || got == nil {
+		t.Fatalf("get log: %v", err)
+	}
+
+	overview, err := s.GetOverviewStats(ctx, "24h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overview.TotalRequests != 4 || overview.TotalInputTokens != 4000 || overview.ErrorCount != 2 {
+		t.Fatalf("unexpected overview: %+v", overview)
+	}
+	if overview.CacheHitRate != 0.2 {
+		t.Fatalf("expected cache hit rate 0.2, got %v", overview.CacheHitRate)
+	}
+	if week, _ := s.GetOverviewStats(ctx, "7d"); week.TotalRequests != 5 {
+		t.Fatalf("expected 5 requests in 7d, got %d", week.TotalRequests)
+	}
+
+	byModel, err := s.GetStatsByModel(ctx, "24h")
+	if err != nil || len(byModel) != 2 {
+		t.Fatalf("by model: %+v, %v", byModel, err)
+	}
+	for _, m := range byModel {
+		if m.Model == "claude-a" && (m.AvgToolCalls != 1 || m.ToolCallRate < 0.33 || m.ToolCallRate > 0.34) {
+			t.Fatalf("unexpected tool call stats: %+v", m)
+		}
+	}
+	byKey, total, err := s.GetStatsByKey(ctx, "24h", 1, 10)
+	if err != nil || total != 1 || byKey[0].KeyName != "logger" {
+		t.Fatalf("by key: %+v, %v", byKey, err)
+	}
+	series, err := s.GetTimeSeries(ctx, "24h", "1h")
+	if err != nil || len(series) == 0 {
+		t.Fatalf("time series: %+v, %v", series, err)
+	}
+	if _, err := s.GetLatencyPercentiles(ctx, "24h"); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := s.GetKeyUsage(ctx, key.ID, "24h", "1h", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Totals.TotalRequests != 4 || len(usage.RecentErrors) != 2 || usage.RequestsLastMinute != 4 {
+		t.Fatalf("unexpected key usage: %+v", usage)
+	}
+
+	deleted, err := s.DeleteOldLogs(ctx, now.Add(-24*time.Hour))
+	if err != nil || deleted != 1 {
+		t.Fatalf("delete old logs: deleted=%d err=%v", deleted, err)
+	}
+}
+
+func TestIntegrationPolicies(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	low, err := s.CreatePolicy(ctx, &PolicyCreate{Name: "cap", Expression: "true", Action: "cap", MaxTokens: ptr(1024)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreatePolicy(ctx, &PolicyCreate{Name: "deny", Expression: "false", Action: "deny", Priority: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreatePolicy(ctx, &PolicyCreate{Name: "bad", Expression: "true", Action: "explode"}); err == nil {
+		t.Fatal("expected CHECK constraint to reject unknown action")
+	}
+
+	if err := s.UpdatePolicy(ctx, low.ID, &PolicyUpdate{Priority: ptr(9), IsActive: ptr(false)}); err != nil {
+		t.Fatal(err)
+	}
+	policies, err := s.ListPolicies(ctx)
+	if err != nil || len(policies) != 2 || policies[0].Name != "cap" || policies[0].IsActive {
+		t.Fatalf("expected updated cap policy first: %+v, %v", policies, err)
+	}
+
+	if err := s.DeletePolicy(ctx, low.ID); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := s.GetPolicy(ctx, low.ID); err != nil || p != nil {
+		t.Fatalf("expected policy to be deleted, got %+v, %v", p, err)
+	}
+}
+
+func TestIntegrationSCIM(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	write := &SCIMUserWrite{
+		UserName: "ada@example.com", Active: true, KeyName: "Ada",
+		Resource: []byte(`{"userName":"ada@example.com"}`),
+		Metadata: map[string]any{"department": "R&D"},
+	}
+	user, err := s.CreateSCIMUser(ctx, write, "scim-hash", "pxb_scim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateSCIMUser(ctx, &SCIMUserWrite{UserName: "ADA@example.com", KeyName: "dup", Resource: []byte(`{}`)}, "scim-hash-2", "pxb_dup"); !errors.Is(err, ErrSCIMConflict) {
+		t.Fatalf("expected ErrSCIMConflict, got %v", err)
+	}
+
+	group, err := s.CreateSCIMGroup(ctx, &SCIMGroupWrite{DisplayName: "ml", Members: []uuid.UUID{user.ID, uuid.New()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(group.Members) != 1 || group.Members[0].Value != user.ID {
+		t.Fatalf("unexpected members: %+v", group.Members)
+	}
+
+	key, err := s.GetLLMKey(ctx, user.KeyID)
+	if err != nil || key == nil || !key.IsActive || key.Name != "Ada" {
+		t.Fatalf("unexpected key: %+v, %v", key, err)
+	}
+	var meta struct {
+		SCIM struct {
+			UserName   string   `json:"user_name"`
+			Department string   `json:"department"`
+			Teams      []string `json:"teams"`
+		} `json:"scim"`
+	}
+	if err := json.Unmarshal(key.Metadata, &meta); err != nil || meta.SCIM.Department != "R&D" || len(meta.SCIM.Teams) != 1 || meta.SCIM.Teams[0] != "ml" {
+		t.Fatalf("unexpected key metadata: %s, %v", key.Metadata, err)
+	}
+
+	// Deactivating the user deactivates the key but keeps the teams.
+	write.Active = false
+	user, err = s.ReplaceSCIMUser(ctx, user.ID, write)
+	if err != nil || user == nil || user.Active || len(user.Groups) != 1 {
+		t.Fatalf("unexpected user: %+v, %v", user, err)
+	}
+	key, _ = s.GetLLMKey(ctx, user.KeyID)
+	if key.IsActive || !json.Valid(key.Metadata) || !strings.Contains(string(key.Metadata), `"ml"`) {
+		t.Fatalf("unexpected key after deactivation: %+v", key)
+	}
+
+	if ok, err := s.DeleteSCIMGroup(ctx, group.ID); err != nil || !ok {
+		t.Fatalf("delete group: %v, %v", ok, err)
+	}
+	key, _ = s.GetLLMKey(ctx, user.KeyID)
+	if strings.Contains(string(key.Metadata), `"ml"`) {
+		t.Fatalf("team kept after group deletion: %s", key.Metadata)
+	}
+
+	if ok, err := s.DeleteSCIMUser(ctx, user.ID); err != nil || !ok {
+		t.Fatalf("delete user: %v, %v", ok, err)
+	}
+	if u, err := s.GetSCIMUser(ctx, user.ID); err != nil || u != nil {
+		t.Fatalf("expected user to be deleted, got %+v, %v", u, err)
+	}
+	if key, _ := s.GetLLMKey(ctx, user.KeyID); key == nil || key.IsActive {
+		t.Fatalf("expected key to be kept and inactive: %+v", key)
+	}
+}
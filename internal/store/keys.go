@@ -12,16 +12,104 @@ import (
 )
 
 type LLMAPIKey struct {
-	ID         uuid.UUID        `json:"id"`
-	KeyHash    string           `json:"-"`
-	KeyPrefix  string           `json:"key_prefix"`
-	Name       string           `json:"name"`
-	IsActive   bool             `json:"is_active"`
-	RateLimit  *int             `json:"rate_limit"`
-	LastUsedAt *time.Time       `json:"last_used_at"`
-	Metadata   json.RawMessage  `json:"metadata"`
-	CreatedAt  time.Time        `json:"created_at"`
-	UpdatedAt  time.Time        `json:"updated_at"`
+	ID             uuid.UUID       `json:"id"`
+	KeyHash        string          `json:"-"`
+	KeyPrefix      string          `json:"key_prefix"`
+	Name           string          `json:"name"`
+	IsActive       bool            `json:"is_active"`
+	RateLimit      *int            `json:"rate_limit"`
+	GatewayHeaders bool            `json:"gateway_headers"` // expose x-pxbin-* response headers
+	Sandbox        bool            `json:"sandbox"`         // answered with synthetic responses, never sent upstream
+	AllowedRegions []string        `json:"allowed_regions"` // upstream regions the key may use; empty allows all
+	AllowedModels  []string        `json:"allowed_models"`  // model names and "*" patterns the key may use; empty allows all
+	MaxPriority    string          `json:"max_priority"`    // highest x-pxbin-priority the key is served at
+	LastUsedAt     *time.Time      `json:"last_used_at"`
+	Metadata       json.RawMessage `json:"metadata"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+
+	// Spend budgets in USD per UTC day and calendar month; nil means none.
+	DailyBudget   *float64 `json:"daily_budget_usd"`
+	MonthlyBudget *float64 `json:"monthly_budget_usd"`
+
+	// CapturePayloads stores the key's request and response bodies with
+	// its logs.
+	CapturePayloads bool `json:"capture_payloads"`
+
+	// InjectCacheControl adds prompt caching breakpoints to the key's
+	// requests to Anthropic-format upstreams that set none.
+	InjectCacheControl bool `json:"inject_cache_control"`
+
+	// TeamID is the team the key belongs to, if any, and Team the settings
+	// it inherits from it.
+	TeamID *uuid.UUID `json:"team_id"`
+	Team   *KeyTeam   `json:"team,omitempty"`
+}
+
+// KeyTeam is what a key inherits from its team: the team's allowlist and
+// budgets apply where the key sets none of its own.
+type KeyTeam struct {
+	Name          string   `json:"name"`
+	AllowedModels []string `json:"allowed_models"`
+	DailyBudget   *float64 `json:"daily_budget_usd"`
+	MonthlyBudget *float64 `json:"monthly_budget_usd"`
+}
+
+// AllowsRegion reports whether the key may be routed to an upstream in
+// region. Keys without a restriction allow every upstream; restricted keys
+// never use upstreams with no region set.
+func (k *LLMAPIKey) AllowsRegion(region string) bool {
+	if len(k.AllowedRegions) == 0 {
+		return true
+	}
+	for _, r := range k.AllowedRegions {
+		if strings.EqualFold(r, region) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsModel reports whether the key may use a model requested as any of
+// names: its allowlist is empty, or one of the names matches an entry,
+// case-insensitively and with "*" matching any run of characters.
+func (k *LLMAPIKey) AllowsModel(names ...string) bool {
+	allowed := k.AllowedModels
+	if len(allowed) == 0 && k.Team != nil {
+		allowed = k.Team.AllowedModels
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, pattern := range allowed {
+		for _, name := range names {
+			if MatchAliasPattern(strings.ToLower(pattern), strings.ToLower(name)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Budgets returns the key's daily and monthly spend budgets, each
+// inherited from its team when the key sets none.
+func (k *LLMAPIKey) Budgets() (daily, monthly *float64) {
+	daily, monthly = k.DailyBudget, k.MonthlyBudget
+	if k.Team != nil {
+		if daily == nil {
+			daily = k.Team.DailyBudget
+		}
+		if monthly == nil {
+			monthly = k.Team.MonthlyBudget
+		}
+	}
+	return daily, monthly
+}
+
+// KeySpend is what a key has spent in the current UTC day and month.
+type KeySpend struct {
+	Daily   float64 `json:"daily_usd"`
+	Monthly float64 `json:"monthly_usd"`
 }
 
 type ManagementAPIKey struct {
@@ -37,9 +125,23 @@ type ManagementAPIKey struct {
 }
 
 type LLMKeyUpdate struct {
-	Name      *string `json:"name"`
-	IsActive  *bool   `json:"is_active"`
-	RateLimit *int    `json:"rate_limit"`
+	Name           *string `json:"name"`
+	IsActive       *bool   `json:"is_active"`
+	RateLimit      *int    `json:"rate_limit"`
+	GatewayHeaders *bool   `json:"gateway_headers"`
+	Sandbox        *bool   `json:"sandbox"`
+
+	CapturePayloads    *bool `json:"capture_payloads"`
+	InjectCacheControl *bool `json:"inject_cache_control"`
+
+	// AllowedRegions replaces the key's region restriction; an empty list
+	// removes it.
+	AllowedRegions *[]string `json:"allowed_regions"`
+	// AllowedModels replaces the key's model allowlist; an empty list
+	// removes it.
+	AllowedModels *[]string `json:"allowed_models"`
+
+	MaxPriority *string `json:"max_priority"` // low, normal or high
 }
 
 type ManagementKeyUpdate struct {
@@ -48,15 +150,36 @@ type ManagementKeyUpdate struct {
 	Permissions []string `json:"permissions"`
 }
 
-func (s *Store) GetLLMKeyByHash(ctx context.Context, hash string) (*LLMAPIKey, error) {
-	var k LLMAPIKey
-	err := s.pool.QueryRow(ctx, `
-		SELECT id, key_hash, key_prefix, name, is_active, rate_limit, last_used_at, metadata, created_at, updated_at
-		FROM llm_api_keys WHERE key_hash = $1
-	`, hash).Scan(
+// llmKeyColumns are the columns scanLLMKey reads, selected from
+// llmKeyTables.
+const llmKeyColumns = `k.id, k.key_hash, k.key_prefix, k.name, k.is_active, k.rate_limit, k.gateway_headers, k.sandbox, k.capture_payloads, k.inject_cache_control, k.allowed_regions, k.allowed_models, k.max_priority, k.daily_budget_usd, k.monthly_budget_usd, k.last_used_at, k.metadata, k.created_at, k.updated_at,
+	k.team_id, t.name, t.allowed_models, t.daily_budget_usd, t.monthly_budget_usd`
+
+const llmKeyTables = `llm_api_keys k LEFT JOIN teams t ON t.id = k.team_id`
+
+func scanLLMKey(row pgx.Row, k *LLMAPIKey) error {
+	var (
+		teamName             *string
+		teamModels           []string
+		teamDaily, teamMonth *float64
+	)
+	err := row.Scan(
 		&k.ID, &k.KeyHash, &k.KeyPrefix, &k.Name, &k.IsActive,
-		&k.RateLimit, &k.LastUsedAt, &k.Metadata, &k.CreatedAt, &k.UpdatedAt,
+		&k.RateLimit, &k.GatewayHeaders, &k.Sandbox, &k.CapturePayloads, &k.InjectCacheControl, &k.AllowedRegions, &k.AllowedModels, &k.MaxPriority, &k.DailyBudget, &k.MonthlyBudget, &k.LastUsedAt, &k.Metadata, &k.CreatedAt, &k.UpdatedAt,
+		&k.TeamID, &teamName, &teamModels, &teamDaily, &teamMonth,
 	)
+	if err == nil && teamName != nil {
+		k.Team = &KeyTeam{Name: *teamName, AllowedModels: teamModels, DailyBudget: teamDaily, MonthlyBudget: teamMonth}
+	}
+	return err
+}
+
+func (s *Postgres) GetLLMKeyByHash(ctx context.Context, hash string) (*LLMAPIKey, error) {
+	var k LLMAPIKey
+	err := scanLLMKey(s.pool.QueryRow(ctx, `
+		SELECT `+llmKeyColumns+`
+		FROM `+llmKeyTables+` WHERE k.key_hash = $1
+	`, hash), &k)
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
@@ -66,7 +189,23 @@ func (s *Store) GetLLMKeyByHash(ctx context.Context, hash string) (*LLMAPIKey, e
 	return &k, nil
 }
 
-func (s *Store) ListLLMKeys(ctx context.Context, page, perPage int) ([]LLMAPIKey, int, error) {
+func (s *Postgres) GetLLMKey(ctx context.Context, id uuid.UUID) (*LLMAPIKey, error) {
+	var k LLMAPIKey
+	err := scanLLMKey(s.pool.QueryRow(ctx, `
+		SELECT `+llmKeyColumns+`
+		FROM `+llmKeyTables+` WHERE k.id = $1
+	`, id), &k)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get llm key: %w", err)
+	}
+	k.KeyHash = ""
+	return &k, nil
+}
+
+func (s *Postgres) ListLLMKeys(ctx context.Context, page, perPage int) ([]LLMAPIKey, int, error) {
 	var total int
 	err := s.pool.QueryRow(ctx, "SELECT COUNT(*) FROM llm_api_keys").Scan(&total)
 	if err != nil {
@@ -75,8 +214,8 @@ func (s *Store) ListLLMKeys(ctx context.Context, page, perPage int) ([]LLMAPIKey
 
 	offset := (page - 1) * perPage
 	rows, err := s.pool.Query(ctx, `
-		SELECT id, key_prefix, name, is_active, rate_limit, last_used_at, metadata, created_at, updated_at
-		FROM llm_api_keys ORDER BY created_at DESC LIMIT $1 OFFSET $2
+		SELECT `+llmKeyColumns+`
+		FROM `+llmKeyTables+` ORDER BY k.created_at DESC LIMIT $1 OFFSET $2
 	`, perPage, offset)
 	if err != nil {
 		return nil, 0, fmt.Errorf("list llm keys: %w", err)
@@ -86,26 +225,51 @@ func (s *Store) ListLLMKeys(ctx context.Context, page, perPage int) ([]LLMAPIKey
 	var keys []LLMAPIKey
 	for rows.Next() {
 		var k LLMAPIKey
-		if err := rows.Scan(
-			&k.ID, &k.KeyPrefix, &k.Name, &k.IsActive,
-			&k.RateLimit, &k.LastUsedAt, &k.Metadata, &k.CreatedAt, &k.UpdatedAt,
-		); err != nil {
+		if err := scanLLMKey(rows, &k); err != nil {
 			return nil, 0, fmt.Errorf("scan llm key: %w", err)
 		}
+		k.KeyHash = ""
 		keys = append(keys, k)
 	}
 	return keys, total, rows.Err()
 }
 
-func (s *Store) CreateLLMKey(ctx context.Context, keyHash, keyPrefix, name string, rateLimit *int) (*LLMAPIKey, error) {
+// ListRecentLLMKeys returns up to limit active keys used since since, most
+// recently used first, including their hashes for cache priming.
+func (s *Postgres) ListRecentLLMKeys(ctx context.Context, since time.Time, limit int) ([]LLMAPIKey, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+llmKeyColumns+`
+		FROM `+llmKeyTables+`
+		WHERE k.is_active = true AND k.last_used_at > $1
+		ORDER BY k.last_used_at DESC
+		LIMIT $2
+	`, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list recent llm keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []LLMAPIKey
+	for rows.Next() {
+		var k LLMAPIKey
+		if err := scanLLMKey(rows, &k); err != nil {
+			return nil, fmt.Errorf("scan llm key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *Postgres) CreateLLMKey(ctx context.Context, keyHash, keyPrefix, name string, rateLimit *int) (*LLMAPIKey, error) {
 	var k LLMAPIKey
 	err := s.pool.QueryRow(ctx, `
 		INSERT INTO llm_api_keys (key_hash, key_prefix, name, rate_limit)
 		VALUES ($1, $2, $3, $4)
-		RETURNING id, key_hash, key_prefix, name, is_active, rate_limit, last_used_at, metadata, created_at, updated_at
+		RETURNING id, key_hash, key_prefix, name, is_active, rate_limit, gateway_headers, sandbox, capture_payloads, inject_cache_control, allowed_regions, allowed_models, max_priority, daily_budget_usd, monthly_budget_usd, last_used_at, metadata, created_at, updated_at, team_id
 	`, keyHash, keyPrefix, name, rateLimit).Scan(
 		&k.ID, &k.KeyHash, &k.KeyPrefix, &k.Name, &k.IsActive,
-		&k.RateLimit, &k.LastUsedAt, &k.Metadata, &k.CreatedAt, &k.UpdatedAt,
+		&k.RateLimit, &k.GatewayHeaders, &k.Sandbox, &k.CapturePayloads, &k.InjectCacheControl, &k.AllowedRegions, &k.AllowedModels, &k.MaxPriority, &k.DailyBudget, &k.MonthlyBudget, &k.LastUsedAt, &k.Metadata, &k.CreatedAt, &k.UpdatedAt,
+		&k.TeamID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("create llm key: %w", err)
@@ -113,7 +277,7 @@ func (s *Store) CreateLLMKey(ctx context.Context, keyHash, keyPrefix, name strin
 	return &k, nil
 }
 
-func (s *Store) UpdateLLMKey(ctx context.Context, id uuid.UUID, updates LLMKeyUpdate) error {
+func (s *Postgres) UpdateLLMKey(ctx context.Context, id uuid.UUID, updates LLMKeyUpdate) error {
 	sets := []string{}
 	args := []any{}
 	argIdx := 1
@@ -133,6 +297,49 @@ func (s *Store) UpdateLLMKey(ctx context.Context, id uuid.UUID, updates LLMKeyUp
 		args = append(args, *updates.RateLimit)
 		argIdx++
 	}
+	if updates.GatewayHeaders != nil {
+		sets = append(sets, fmt.Sprintf("gateway_headers = $%d", argIdx))
+		args = append(args, *updates.GatewayHeaders)
+		argIdx++
+	}
+	if updates.Sandbox != nil {
+		sets = append(sets, fmt.Sprintf("sandbox = $%d", argIdx))
+		args = append(args, *updates.Sandbox)
+		argIdx++
+	}
+	if updates.CapturePayloads != nil {
+		sets = append(sets, fmt.Sprintf("capture_payloads = $%d", argIdx))
+		args = append(args, *updates.CapturePayloads)
+		argIdx++
+	}
+	if updates.InjectCacheControl != nil {
+		sets = append(sets, fmt.Sprintf("inject_cache_control = $%d", argIdx))
+		args = append(args, *updates.InjectCacheControl)
+		argIdx++
+	}
+	if updates.AllowedRegions != nil {
+		regions := *updates.AllowedRegions
+		if len(regions) == 0 {
+			regions = nil // stored as NULL
+		}
+		sets = append(sets, fmt.Sprintf("allowed_regions = $%d", argIdx))
+		args = append(args, regions)
+		argIdx++
+	}
+	if updates.AllowedModels != nil {
+		models := *updates.AllowedModels
+		if len(models) == 0 {
+			models = nil // stored as NULL
+		}
+		sets = append(sets, fmt.Sprintf("allowed_models = $%d", argIdx))
+		args = append(args, models)
+		argIdx++
+	}
+	if updates.MaxPriority != nil {
+		sets = append(sets, fmt.Sprintf("max_priority = $%d", argIdx))
+		args = append(args, *updates.MaxPriority)
+		argIdx++
+	}
 
 	if len(sets) == 0 {
 		return nil
@@ -149,7 +356,51 @@ func (s *Store) UpdateLLMKey(ctx context.Context, id uuid.UUID, updates LLMKeyUp
 	return nil
 }
 
-func (s *Store) DeactivateLLMKey(ctx context.Context, id uuid.UUID) error {
+// SetLLMKeyBudgets replaces the key's spend budgets; nil removes one. It
+// reports false when the key does not exist.
+func (s *Postgres) SetLLMKeyBudgets(ctx context.Context, id uuid.UUID, daily, monthly *float64) (bool, error) {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE llm_api_keys SET daily_budget_usd = $2, monthly_budget_usd = $3, updated_at = now()
+		WHERE id = $1
+	`, id, daily, monthly)
+	if err != nil {
+		return false, fmt.Errorf("set llm key budgets: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ListBudgetedKeySpend returns the spend since day and since month of
+// every key with a budget of its own or from its team.
+func (s *Postgres) ListBudgetedKeySpend(ctx context.Context, day, month time.Time) (map[uuid.UUID]KeySpend, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT k.id,
+			COALESCE(SUM(rl.cost) FILTER (WHERE rl.timestamp >= $1), 0),
+			COALESCE(SUM(rl.cost), 0)
+		FROM llm_api_keys k
+		LEFT JOIN teams t ON t.id = k.team_id
+		LEFT JOIN request_logs rl ON rl.llm_key_id = k.id AND rl.timestamp >= $2
+		WHERE k.daily_budget_usd IS NOT NULL OR k.monthly_budget_usd IS NOT NULL
+			OR t.daily_budget_usd IS NOT NULL OR t.monthly_budget_usd IS NOT NULL
+		GROUP BY k.id
+	`, day, month)
+	if err != nil {
+		return nil, fmt.Errorf("list budgeted key spend: %w", err)
+	}
+	defer rows.Close()
+
+	spend := map[uuid.UUID]KeySpend{}
+	for rows.Next() {
+		var id uuid.UUID
+		var ks KeySpend
+		if err := rows.Scan(&id, &ks.Daily, &ks.Monthly); err != nil {
+			return nil, fmt.Errorf("scan key spend: %w", err)
+		}
+		spend[id] = ks
+	}
+	return spend, rows.Err()
+}
+
+func (s *Postgres) DeactivateLLMKey(ctx context.Context, id uuid.UUID) error {
 	_, err := s.pool.Exec(ctx,
 		"UPDATE llm_api_keys SET is_active = false, updated_at = now() WHERE id = $1", id)
 	if err != nil {
@@ -158,7 +409,7 @@ func (s *Store) DeactivateLLMKey(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-func (s *Store) UpdateLLMKeyLastUsed(ctx context.Context, id uuid.UUID) error {
+func (s *Postgres) UpdateLLMKeyLastUsed(ctx context.Context, id uuid.UUID) error {
 	_, err := s.pool.Exec(ctx,
 		"UPDATE llm_api_keys SET last_used_at = now() WHERE id = $1", id)
 	if err != nil {
@@ -167,7 +418,7 @@ func (s *Store) UpdateLLMKeyLastUsed(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-func (s *Store) BatchUpdateLLMKeyLastUsed(ctx context.Context, ids []uuid.UUID) error {
+func (s *Postgres) BatchUpdateLLMKeyLastUsed(ctx context.Context, ids []uuid.UUID) error {
 	_, err := s.pool.Exec(ctx,
 		"UPDATE llm_api_keys SET last_used_at = now() WHERE id = ANY($1)", ids)
 	if err != nil {
@@ -176,7 +427,7 @@ func (s *Store) BatchUpdateLLMKeyLastUsed(ctx context.Context, ids []uuid.UUID)
 	return nil
 }
 
-func (s *Store) GetManagementKeyByHash(ctx context.Context, hash string) (*ManagementAPIKey, error) {
+func (s *Postgres) GetManagementKeyByHash(ctx context.Context, hash string) (*ManagementAPIKey, error) {
 	var k ManagementAPIKey
 	err := s.pool.QueryRow(ctx, `
 		SELECT id, key_hash, key_prefix, name, is_active, permissions, last_used_at, created_at, updated_at
@@ -194,7 +445,7 @@ func (s *Store) GetManagementKeyByHash(ctx context.Context, hash string) (*Manag
 	return &k, nil
 }
 
-func (s *Store) ListManagementKeys(ctx context.Context, page, perPage int) ([]ManagementAPIKey, int, error) {
+func (s *Postgres) ListManagementKeys(ctx context.Context, page, perPage int) ([]ManagementAPIKey, int, error) {
 	var total int
 	err := s.pool.QueryRow(ctx, "SELECT COUNT(*) FROM management_api_keys").Scan(&total)
 	if err != nil {
@@ -225,7 +476,7 @@ func (s *Store) ListManagementKeys(ctx context.Context, page, perPage int) ([]Ma
 	return keys, total, rows.Err()
 }
 
-func (s *Store) CreateManagementKey(ctx context.Context, keyHash, keyPrefix, name string, permissions []string) (*ManagementAPIKey, error) {
+func (s *Postgres) CreateManagementKey(ctx context.Context, keyHash, keyPrefix, name string, permissions []string) (*ManagementAPIKey, error) {
 	var k ManagementAPIKey
 	err := s.pool.QueryRow(ctx, `
 		INSERT INTO management_api_keys (key_hash, key_prefix, name, permissions)
@@ -241,7 +492,7 @@ func (s *Store) CreateManagementKey(ctx context.Context, keyHash, keyPrefix, nam
 	return &k, nil
 }
 
-func (s *Store) UpdateManagementKey(ctx context.Context, id uuid.UUID, updates ManagementKeyUpdate) error {
+func (s *Postgres) UpdateManagementKey(ctx context.Context, id uuid.UUID, updates ManagementKeyUpdate) error {
 	sets := []string{}
 	args := []any{}
 	argIdx := 1
@@ -277,7 +528,7 @@ func (s *Store) UpdateManagementKey(ctx context.Context, id uuid.UUID, updates M
 	return nil
 }
 
-func (s *Store) DeactivateManagementKey(ctx context.Context, id uuid.UUID) error {
+func (s *Postgres) DeactivateManagementKey(ctx context.Context, id uuid.UUID) error {
 	_, err := s.pool.Exec(ctx,
 		"UPDATE management_api_keys SET is_active = false, updated_at = now() WHERE id = $1", id)
 	if err != nil {
@@ -16,18 +16,30 @@ type LogEntry struct {
 	Method             string
 	Path               string
 	Model              string
-	InputFormat        string // "anthropic" or "openai"
+	InputFormat        string // "anthropic", "openai" or "gemini"
 	UpstreamID         *uuid.UUID
 	StatusCode         int
 	LatencyMS          int
 	InputTokens        int
 	OutputTokens       int
+	ReasoningTokens    int // part of OutputTokens
 	CacheCreationTokens int
 	CacheReadTokens    int
 	Cost               float64
 	OverheadUS         int
+	ToolCalls          int
+	WebSearchRequests  int
+	Region             string
+	CanaryID           *uuid.UUID
+	CanaryArm          string
+	UpstreamFormat     string
+	Translated         bool
+	Priority           string
 	ErrorMessage       string
+	ErrorCode          string // machine-readable cause, e.g. upstream_stall
 	RequestMetadata    map[string]interface{}
+	Payload            *LogPayload // captured bodies; nil for none
+	AuditSample        *AuditSample // sampled for a quality audit; nil for none
 }
 
 type RequestLog struct {
@@ -43,9 +55,17 @@ type RequestLog struct {
 	LatencyMS       *int                   `json:"latency_ms"`
 	InputTokens     *int                   `json:"input_tokens"`
 	OutputTokens    *int                   `json:"output_tokens"`
+	ReasoningTokens int                    `json:"reasoning_tokens"` // part of output_tokens
 	Cost            *float64               `json:"cost"`
 	OverheadUS      *int                   `json:"overhead_us"`
+	ToolCalls       int                    `json:"tool_calls"`
+	WebSearches     int                    `json:"web_search_requests"`
+	Region          *string                `json:"region"`
+	UpstreamFormat  *string                `json:"upstream_format"`
+	Translated      bool                   `json:"translated"`
+	Priority        *string                `json:"priority"`
 	ErrorMessage    *string                `json:"error_message"`
+	ErrorCode       *string                `json:"error_code"`
 	RequestMetadata map[string]interface{} `json:"request_metadata"`
 	CreatedAt       time.Time              `json:"created_at"`
 }
@@ -55,23 +75,39 @@ type LogFilter struct {
 	Model       *string
 	StatusCode  *int
 	InputFormat *string
+	Region      *string
+	Priority    *string
+	ErrorCode   *string
 	DateFrom    *time.Time
 	DateTo      *time.Time
 	Page        int
 	PerPage     int
+
+	// After continues a listing after this position, in the newest first
+	// order, instead of at Page. The total is not counted then.
+	After *LogCursor
+}
+
+// LogCursor is the position of a log in the newest first order of
+// ListLogs, which breaks timestamp ties by ID.
+type LogCursor struct {
+	Timestamp time.Time
+	ID        uuid.UUID
 }
 
-func (s *Store) InsertLog(ctx context.Context, entry *LogEntry) error {
+func (s *Postgres) InsertLog(ctx context.Context, entry *LogEntry) error {
 	_, err := s.pool.Exec(ctx, `
 		INSERT INTO request_logs (
 			llm_key_id, timestamp, method, path, model, input_format,
 			upstream_id, status_code, latency_ms, input_tokens, output_tokens,
-			cache_creation_tokens, cache_read_tokens, cost, overhead_us, error_message, request_metadata
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+			cache_creation_tokens, cache_read_tokens, cost, overhead_us, error_message, request_metadata,
+			tool_calls, region, canary_id, canary_arm, upstream_format, translated, web_search_requests, priority, error_code, reasoning_tokens
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, NULLIF($19, ''), $20, NULLIF($21, ''), NULLIF($22, ''), $23, $24, NULLIF($25, ''), NULLIF($26, ''), $27)
 	`,
 		entry.KeyID, entry.Timestamp, entry.Method, entry.Path, entry.Model, entry.InputFormat,
 		entry.UpstreamID, entry.StatusCode, entry.LatencyMS, entry.InputTokens, entry.OutputTokens,
 		entry.CacheCreationTokens, entry.CacheReadTokens, entry.Cost, entry.OverheadUS, entry.ErrorMessage, entry.RequestMetadata,
+		entry.ToolCalls, entry.Region, entry.CanaryID, entry.CanaryArm, entry.UpstreamFormat, entry.Translated, entry.WebSearchRequests, entry.Priority, entry.ErrorCode, entry.ReasoningTokens,
 	)
 	if err != nil {
 		return fmt.Errorf("insert log: %w", err)
@@ -79,7 +115,7 @@ func (s *Store) InsertLog(ctx context.Context, entry *LogEntry) error {
 	return nil
 }
 
-func (s *Store) InsertLogBatch(ctx context.Context, entries []*LogEntry) error {
+func (s *Postgres) InsertLogBatch(ctx context.Context, entries []*LogEntry) error {
 	if len(entries) == 0 {
 		return nil
 	}
@@ -89,21 +125,51 @@ func (s *Store) InsertLogBatch(ctx context.Context, entries []*LogEntry) error {
 		INSERT INTO request_logs (
 			llm_key_id, timestamp, method, path, model, input_format,
 			upstream_id, status_code, latency_ms, input_tokens, output_tokens,
-			cache_creation_tokens, cache_read_tokens, cost, overhead_us, error_message, request_metadata
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`
+			cache_creation_tokens, cache_read_tokens, cost, overhead_us, error_message, request_metadata,
+			tool_calls, region, canary_id, canary_arm, upstream_format, translated, web_search_requests, priority, error_code, reasoning_tokens
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, NULLIF($19, ''), $20, NULLIF($21, ''), NULLIF($22, ''), $23, $24, NULLIF($25, ''), NULLIF($26, ''), $27)`
+
+	// Captured bodies are inserted with their log, which assigns the ID.
+	payloadQuery := `WITH log AS (` + query + ` RETURNING id)
+		INSERT INTO request_payloads (log_id, request_body, response_body, request_bytes, response_bytes, redacted)
+		SELECT id, $28, $29, $30, $31, $32 FROM log`
 
 	for _, entry := range entries {
-		batch.Queue(query,
+		args := []any{
 			entry.KeyID, entry.Timestamp, entry.Method, entry.Path, entry.Model, entry.InputFormat,
 			entry.UpstreamID, entry.StatusCode, entry.LatencyMS, entry.InputTokens, entry.OutputTokens,
 			entry.CacheCreationTokens, entry.CacheReadTokens, entry.Cost, entry.OverheadUS, entry.ErrorMessage, entry.RequestMetadata,
+			entry.ToolCalls, entry.Region, entry.CanaryID, entry.CanaryArm, entry.UpstreamFormat, entry.Translated, entry.WebSearchRequests, entry.Priority, entry.ErrorCode, entry.ReasoningTokens,
+		}
+		if p := entry.Payload; p != nil {
+			batch.Queue(payloadQuery, append(args, p.Request, p.Response, p.RequestBytes, p.ResponseBytes, p.Redacted)...)
+			continue
+		}
+		batch.Queue(query, args...)
+	}
+
+	// Audit samples are kept apart from the logs, under their own retention.
+	queued := len(entries)
+	for _, entry := range entries {
+		a := entry.AuditSample
+		if a == nil {
+			continue
+		}
+		batch.Queue(`
+			INSERT INTO audit_samples (
+				rule_id, percent, llm_key_id, model, input_format, upstream_format, translated,
+				status_code, latency_ms, input_tokens, output_tokens, request_body, response_body, request_bytes, response_bytes
+			) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+			a.RuleID, a.Percent, a.KeyID, a.Model, a.InputFormat, a.UpstreamFormat, a.Translated,
+			a.StatusCode, a.LatencyMS, a.InputTokens, a.OutputTokens, a.Request, a.Response, a.RequestBytes, a.ResponseBytes,
 		)
+		queued++
 	}
 
 	br := s.pool.SendBatch(ctx, batch)
 	defer br.Close()
 
-	for range entries {
+	for range queued {
 		if _, err := br.Exec(); err != nil {
 			return fmt.Errorf("insert log batch: %w", err)
 		}
@@ -111,17 +177,17 @@ func (s *Store) InsertLogBatch(ctx context.Context, entries []*LogEntry) error {
 	return nil
 }
 
-func (s *Store) GetLog(ctx context.Context, id uuid.UUID) (*RequestLog, error) {
+func (s *Postgres) GetLog(ctx context.Context, id uuid.UUID) (*RequestLog, error) {
 	var log RequestLog
 	err := s.pool.QueryRow(ctx, `
 		SELECT id, llm_key_id, timestamp, method, path, model, input_format,
-		       upstream_id, status_code, latency_ms, input_tokens, output_tokens,
-		       cost, overhead_us, error_message, request_metadata, created_at
+		       upstream_id, status_code, latency_ms, input_tokens, output_tokens, reasoning_tokens,
+		       cost, overhead_us, tool_calls, web_search_requests, region, upstream_format, translated, priority, error_message, error_code, request_metadata, created_at
 		FROM request_logs WHERE id = $1
 	`, id).Scan(
 		&log.ID, &log.KeyID, &log.Timestamp, &log.Method, &log.Path, &log.Model, &log.InputFormat,
-		&log.UpstreamID, &log.StatusCode, &log.LatencyMS, &log.InputTokens, &log.OutputTokens,
-		&log.Cost, &log.OverheadUS, &log.ErrorMessage, &log.RequestMetadata, &log.CreatedAt,
+		&log.UpstreamID, &log.StatusCode, &log.LatencyMS, &log.InputTokens, &log.OutputTokens, &log.ReasoningTokens,
+		&log.Cost, &log.OverheadUS, &log.ToolCalls, &log.WebSearches, &log.Region, &log.UpstreamFormat, &log.Translated, &log.Priority, &log.ErrorMessage, &log.ErrorCode, &log.RequestMetadata, &log.CreatedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -132,7 +198,7 @@ func (s *Store) GetLog(ctx context.Context, id uuid.UUID) (*RequestLog, error) {
 	return &log, nil
 }
 
-func (s *Store) ListLogs(ctx context.Context, filter LogFilter) ([]RequestLog, int, error) {
+func (s *Postgres) ListLogs(ctx context.Context, filter LogFilter) ([]RequestLog, int, error) {
 	var conditions []string
 	var args []interface{}
 	argIdx := 1
@@ -163,6 +229,21 @@ func (s *Store) ListLogs(ctx context.Context, filter LogFilter) ([]RequestLog, i
 		args = append(args, *filter.InputFormat)
 		argIdx++
 	}
+	if filter.Region != nil {
+		conditions = append(conditions, fmt.Sprintf("region = $%d", argIdx))
+		args = append(args, *filter.Region)
+		argIdx++
+	}
+	if filter.Priority != nil {
+		conditions = append(conditions, fmt.Sprintf("priority = $%d", argIdx))
+		args = append(args, *filter.Priority)
+		argIdx++
+	}
+	if filter.ErrorCode != nil {
+		conditions = append(conditions, fmt.Sprintf("error_code = $%d", argIdx))
+		args = append(args, *filter.ErrorCode)
+		argIdx++
+	}
 	if filter.DateFrom != nil {
 		conditions = append(conditions, fmt.Sprintf("timestamp >= $%d", argIdx))
 		args = append(args, *filter.DateFrom)
@@ -173,6 +254,13 @@ func (s *Store) ListLogs(ctx context.Context, filter LogFilter) ([]RequestLog, i
 		args = append(args, *filter.DateTo)
 		argIdx++
 	}
+	count := "COUNT(*) OVER()"
+	if filter.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(timestamp, id) < ($%d, $%d)", argIdx, argIdx+1))
+		args = append(args, filter.After.Timestamp, filter.After.ID)
+		argIdx += 2
+		count = "0"
+	}
 
 	where := ""
 	if len(conditions) > 0 {
@@ -180,7 +268,7 @@ func (s *Store) ListLogs(ctx context.Context, filter LogFilter) ([]RequestLog, i
 	}
 
 	page := filter.Page
-	if page < 1 {
+	if page < 1 || filter.After != nil {
 		page = 1
 	}
 	perPage := filter.PerPage
@@ -191,12 +279,12 @@ func (s *Store) ListLogs(ctx context.Context, filter LogFilter) ([]RequestLog, i
 
 	query := fmt.Sprintf(`
 		SELECT id, llm_key_id, timestamp, method, path, model, input_format,
-		       upstream_id, status_code, latency_ms, input_tokens, output_tokens,
-		       cost, overhead_us, error_message, request_metadata, created_at,
-		       COUNT(*) OVER() as total
+		       upstream_id, status_code, latency_ms, input_tokens, output_tokens, reasoning_tokens,
+		       cost, overhead_us, tool_calls, web_search_requests, region, upstream_format, translated, priority, error_message, error_code, request_metadata, created_at,
+		       %s as total
 		FROM request_logs %s
-		ORDER BY timestamp DESC
-		LIMIT $%d OFFSET $%d`, where, argIdx, argIdx+1)
+		ORDER BY timestamp DESC, id DESC
+		LIMIT $%d OFFSET $%d`, count, where, argIdx, argIdx+1)
 	args = append(args, perPage, offset)
 
 	rows, err := s.pool.Query(ctx, query, args...)
@@ -211,8 +299,8 @@ func (s *Store) ListLogs(ctx context.Context, filter LogFilter) ([]RequestLog, i
 		var log RequestLog
 		if err := rows.Scan(
 			&log.ID, &log.KeyID, &log.Timestamp, &log.Method, &log.Path, &log.Model, &log.InputFormat,
-			&log.UpstreamID, &log.StatusCode, &log.LatencyMS, &log.InputTokens, &log.OutputTokens,
-			&log.Cost, &log.OverheadUS, &log.ErrorMessage, &log.RequestMetadata, &log.CreatedAt,
+			&log.UpstreamID, &log.StatusCode, &log.LatencyMS, &log.InputTokens, &log.OutputTokens, &log.ReasoningTokens,
+			&log.Cost, &log.OverheadUS, &log.ToolCalls, &log.WebSearches, &log.Region, &log.UpstreamFormat, &log.Translated, &log.Priority, &log.ErrorMessage, &log.ErrorCode, &log.RequestMetadata, &log.CreatedAt,
 			&total,
 		); err != nil {
 			return nil, 0, fmt.Errorf("scan log: %w", err)
@@ -222,7 +310,7 @@ func (s *Store) ListLogs(ctx context.Context, filter LogFilter) ([]RequestLog, i
 	return logs, total, rows.Err()
 }
 
-func (s *Store) DeleteOldLogs(ctx context.Context, olderThan time.Time) (int64, error) {
+func (s *Postgres) DeleteOldLogs(ctx context.Context, olderThan time.Time) (int64, error) {
 	ct, err := s.pool.Exec(ctx, "DELETE FROM request_logs WHERE timestamp < $1", olderThan)
 	if err != nil {
 		return 0, fmt.Errorf("delete old logs: %w", err)
@@ -0,0 +1,510 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Memory is a Store that keeps everything in process memory and loses it
+// on exit. It backs `pxbin serve --ephemeral` and tests that need a store
+// without a database. It mirrors the Postgres store's queries, defaults,
+// unique constraints and foreign keys; values the schema merely checks,
+// such as upstream formats, are left to the API's validation.
+type Memory struct {
+	mu sync.RWMutex
+
+	llmKeys  map[uuid.UUID]*LLMAPIKey
+	mgmtKeys map[uuid.UUID]*ManagementAPIKey
+
+	upstreams map[uuid.UUID]*Upstream
+	scores    map[uuid.UUID]*UpstreamScore
+	models    map[uuid.UUID]*Model
+	pins      map[uuid.UUID]*UpstreamPin
+	routers   map[uuid.UUID]*ModelRouter
+	teams     map[uuid.UUID]*Team
+
+	auditRules   map[uuid.UUID]*AuditRule
+	auditSamples []*memoryAuditSample
+
+	guardrails map[uuid.UUID]*Guardrail
+
+	logs       []*memoryLog
+	accessLogs []*AccessLog
+
+	policies map[uuid.UUID]*Policy
+	canaries map[uuid.UUID]*PolicyCanary
+
+	scimUsers   map[uuid.UUID]*SCIMUser
+	scimGroups  map[uuid.UUID]*SCIMGroup
+	scimMembers map[uuid.UUID]map[uuid.UUID]bool // group ID -> user IDs
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		llmKeys:     make(map[uuid.UUID]*LLMAPIKey),
+		mgmtKeys:    make(map[uuid.UUID]*ManagementAPIKey),
+		upstreams:   make(map[uuid.UUID]*Upstream),
+		scores:      make(map[uuid.UUID]*UpstreamScore),
+		models:      make(map[uuid.UUID]*Model),
+		pins:        make(map[uuid.UUID]*UpstreamPin),
+		routers:     make(map[uuid.UUID]*ModelRouter),
+		teams:       make(map[uuid.UUID]*Team),
+		auditRules:  make(map[uuid.UUID]*AuditRule),
+		guardrails:  make(map[uuid.UUID]*Guardrail),
+		policies:    make(map[uuid.UUID]*Policy),
+		canaries:    make(map[uuid.UUID]*PolicyCanary),
+		scimUsers:   make(map[uuid.UUID]*SCIMUser),
+		scimGroups:  make(map[uuid.UUID]*SCIMGroup),
+		scimMembers: make(map[uuid.UUID]map[uuid.UUID]bool),
+	}
+}
+
+// Health always succeeds; there is nothing to connect to.
+func (m *Memory) Health(ctx context.Context) error {
+	return nil
+}
+
+// MigrationStatus reports the schema as up to date: Memory has no schema to
+// migrate.
+func (m *Memory) MigrationStatus(ctx context.Context) (*MigrationStatus, error) {
+	all, err := embeddedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	st := migrationStatus(all, []AppliedMigration{})
+	st.Version, st.Pending = st.Latest, []string{}
+	return st, nil
+}
+
+// memoryNow is the time rows are stamped with, at the database's
+// microsecond precision.
+func memoryNow() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// compareUUID orders IDs as Postgres does.
+func compareUUID(a, b uuid.UUID) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+// sortRows orders rows by a sort spec the way orderBy does: fields are the
+// allowed sort fields, an empty spec sorts by def, and ties are broken by
+// id.
+func sortRows[T any](rows []T, spec string, fields map[string]func(a, b T) int, def func(a, b T) int, id func(T) uuid.UUID) error {
+	cmp := def
+	if spec != "" {
+		desc := strings.HasPrefix(spec, "-")
+		field := strings.TrimPrefix(spec, "-")
+		f, ok := fields[field]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrInvalidSort, field)
+		}
+		cmp = f
+		if desc {
+			cmp = func(a, b T) int { return f(b, a) }
+		}
+	}
+	slices.SortStableFunc(rows, func(a, b T) int {
+		if c := cmp(a, b); c != 0 {
+			return c
+		}
+		return compareUUID(id(a), id(b))
+	})
+	return nil
+}
+
+// paginate returns a page of rows as limitOffset selects it: all of them
+// when perPage <= 0.
+func paginate[T any](rows []T, page, perPage int) []T {
+	if perPage <= 0 {
+		return rows
+	}
+	if page < 1 {
+		page = 1
+	}
+	return window(rows, (page-1)*perPage, perPage)
+}
+
+// window returns up to limit rows after skipping offset, like LIMIT and
+// OFFSET.
+func window[T any](rows []T, offset, limit int) []T {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(rows) || limit <= 0 {
+		return rows[:0]
+	}
+	return rows[offset:min(offset+limit, len(rows))]
+}
+
+// containsFold reports whether substr is within s, ignoring case, as an
+// ILIKE search does.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// clonePtr returns a pointer to a copy of *p, or nil.
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// cloneLLMKey copies a key with what it inherits from its team, as the
+// Postgres store joins it. m.mu must be held.
+func (m *Memory) cloneLLMKey(k *LLMAPIKey) LLMAPIKey {
+	c := *k
+	c.AllowedRegions = slices.Clone(k.AllowedRegions)
+	c.AllowedModels = slices.Clone(k.AllowedModels)
+	c.Metadata = slices.Clone(k.Metadata)
+	c.TeamID = clonePtr(k.TeamID)
+	c.Team = nil
+	if k.TeamID != nil {
+		if t, ok := m.teams[*k.TeamID]; ok {
+			c.Team = &KeyTeam{
+				Name:          t.Name,
+				AllowedModels: slices.Clone(t.AllowedModels),
+				DailyBudget:   clonePtr(t.DailyBudget),
+				MonthlyBudget: clonePtr(t.MonthlyBudget),
+			}
+		}
+	}
+	return c
+}
+
+func (m *Memory) GetLLMKeyByHash(ctx context.Context, hash string) (*LLMAPIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, k := range m.llmKeys {
+		if k.KeyHash == hash {
+			c := m.cloneLLMKey(k)
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *Memory) GetLLMKey(ctx context.Context, id uuid.UUID) (*LLMAPIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	k, ok := m.llmKeys[id]
+	if !ok {
+		return nil, nil
+	}
+	c := m.cloneLLMKey(k)
+	c.KeyHash = ""
+	return &c, nil
+}
+
+func (m *Memory) ListLLMKeys(ctx context.Context, page, perPage int) ([]LLMAPIKey, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	all := make([]LLMAPIKey, 0, len(m.llmKeys))
+	for _, k := range m.llmKeys {
+		c := m.cloneLLMKey(k)
+		c.KeyHash = ""
+		all = append(all, c)
+	}
+	sortNewestFirst(all, func(k LLMAPIKey) (time.Time, uuid.UUID) { return k.CreatedAt, k.ID })
+
+	var keys []LLMAPIKey
+	keys = append(keys, window(all, (page-1)*perPage, perPage)...)
+	return keys, len(all), nil
+}
+
+// sortNewestFirst orders rows by creation time, newest first.
+func sortNewestFirst[T any](rows []T, key func(T) (time.Time, uuid.UUID)) {
+	slices.SortStableFunc(rows, func(a, b T) int {
+		ta, ida := key(a)
+		tb, idb := key(b)
+		if c := tb.Compare(ta); c != 0 {
+			return c
+		}
+		return compareUUID(ida, idb)
+	})
+}
+
+func (m *Memory) ListRecentLLMKeys(ctx context.Context, since time.Time, limit int) ([]LLMAPIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var keys []LLMAPIKey
+	for _, k := range m.llmKeys {
+		if k.IsActive && k.LastUsedAt != nil && k.LastUsedAt.After(since) {
+			keys = append(keys, m.cloneLLMKey(k))
+		}
+	}
+	slices.SortStableFunc(keys, func(a, b LLMAPIKey) int { return b.LastUsedAt.Compare(*a.LastUsedAt) })
+	if len(keys) > limit {
+		keys = keys[:max(limit, 0)]
+	}
+	return keys, nil
+}
+
+func (m *Memory) CreateLLMKey(ctx context.Context, keyHash, keyPrefix, name string, rateLimit *int) (*LLMAPIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, err := m.insertLLMKey(keyHash, keyPrefix, name, true, json.RawMessage("{}"))
+	if err != nil {
+		return nil, fmt.Errorf("create llm key: %w", err)
+	}
+	if rateLimit != nil {
+		rl := *rateLimit
+		k.RateLimit = &rl
+	}
+	c := m.cloneLLMKey(k)
+	return &c, nil
+}
+
+// insertLLMKey adds a key with the schema's defaults. m.mu must be held.
+func (m *Memory) insertLLMKey(keyHash, keyPrefix, name string, active bool, metadata json.RawMessage) (*LLMAPIKey, error) {
+	for _, k := range m.llmKeys {
+		if k.KeyHash == keyHash {
+			return nil, fmt.Errorf("key hash already exists")
+		}
+	}
+	now := memoryNow()
+	k := &LLMAPIKey{
+		ID:          uuid.New(),
+		KeyHash:     keyHash,
+		KeyPrefix:   keyPrefix,
+		Name:        name,
+		IsActive:    active,
+		MaxPriority: PriorityNormal,
+		Metadata:    metadata,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	m.llmKeys[k.ID] = k
+	return k, nil
+}
+
+func (m *Memory) UpdateLLMKey(ctx context.Context, id uuid.UUID, updates LLMKeyUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.llmKeys[id]
+	if !ok {
+		return nil
+	}
+	changed := false
+	if updates.Name != nil {
+		k.Name = *updates.Name
+		changed = true
+	}
+	if updates.IsActive != nil {
+		k.IsActive = *updates.IsActive
+		changed = true
+	}
+	if updates.RateLimit != nil {
+		rl := *updates.RateLimit
+		k.RateLimit = &rl
+		changed = true
+	}
+	if updates.GatewayHeaders != nil {
+		k.GatewayHeaders = *updates.GatewayHeaders
+		changed = true
+	}
+	if updates.Sandbox != nil {
+		k.Sandbox = *updates.Sandbox
+		changed = true
+	}
+	if updates.CapturePayloads != nil {
+		k.CapturePayloads = *updates.CapturePayloads
+		changed = true
+	}
+	if updates.InjectCacheControl != nil {
+		k.InjectCacheControl = *updates.InjectCacheControl
+		changed = true
+	}
+	if updates.AllowedRegions != nil {
+		k.AllowedRegions = nil // stored as NULL when empty
+		if len(*updates.AllowedRegions) > 0 {
+			k.AllowedRegions = slices.Clone(*updates.AllowedRegions)
+		}
+		changed = true
+	}
+	if updates.AllowedModels != nil {
+		k.AllowedModels = nil // stored as NULL when empty
+		if len(*updates.AllowedModels) > 0 {
+			k.AllowedModels = slices.Clone(*updates.AllowedModels)
+		}
+		changed = true
+	}
+	if updates.MaxPriority != nil {
+		k.MaxPriority = *updates.MaxPriority
+		changed = true
+	}
+	if changed {
+		k.UpdatedAt = memoryNow()
+	}
+	return nil
+}
+
+func (m *Memory) DeactivateLLMKey(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if k, ok := m.llmKeys[id]; ok {
+		k.IsActive = false
+		k.UpdatedAt = memoryNow()
+	}
+	return nil
+}
+
+func (m *Memory) UpdateLLMKeyLastUsed(ctx context.Context, id uuid.UUID) error {
+	return m.BatchUpdateLLMKeyLastUsed(ctx, []uuid.UUID{id})
+}
+
+func (m *Memory) BatchUpdateLLMKeyLastUsed(ctx context.Context, ids []uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := memoryNow()
+	for _, id := range ids {
+		if k, ok := m.llmKeys[id]; ok {
+			k.LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *Memory) SetLLMKeyBudgets(ctx context.Context, id uuid.UUID, daily, monthly *float64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.llmKeys[id]
+	if !ok {
+		return false, nil
+	}
+	k.DailyBudget, k.MonthlyBudget = clonePtr(daily), clonePtr(monthly)
+	k.UpdatedAt = memoryNow()
+	return true, nil
+}
+
+func (m *Memory) ListBudgetedKeySpend(ctx context.Context, day, month time.Time) (map[uuid.UUID]KeySpend, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	spend := map[uuid.UUID]KeySpend{}
+	for id, k := range m.llmKeys {
+		c := m.cloneLLMKey(k)
+		if daily, monthly := c.Budgets(); daily != nil || monthly != nil {
+			spend[id] = KeySpend{}
+		}
+	}
+	for _, l := range m.logs {
+		ks, ok := spend[*l.KeyID]
+		if !ok || l.Timestamp.Before(month) || l.Cost == nil {
+			continue
+		}
+		ks.Monthly += *l.Cost
+		if !l.Timestamp.Before(day) {
+			ks.Daily += *l.Cost
+		}
+		spend[*l.KeyID] = ks
+	}
+	return spend, nil
+}
+
+func cloneManagementKey(k *ManagementAPIKey) ManagementAPIKey {
+	c := *k
+	c.Permissions = slices.Clone(k.Permissions)
+	return c
+}
+
+func (m *Memory) GetManagementKeyByHash(ctx context.Context, hash string) (*ManagementAPIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, k := range m.mgmtKeys {
+		if k.KeyHash == hash {
+			c := cloneManagementKey(k)
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *Memory) ListManagementKeys(ctx context.Context, page, perPage int) ([]ManagementAPIKey, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	all := make([]ManagementAPIKey, 0, len(m.mgmtKeys))
+	for _, k := range m.mgmtKeys {
+		c := cloneManagementKey(k)
+		c.KeyHash = ""
+		all = append(all, c)
+	}
+	sortNewestFirst(all, func(k ManagementAPIKey) (time.Time, uuid.UUID) { return k.CreatedAt, k.ID })
+
+	var keys []ManagementAPIKey
+	keys = append(keys, window(all, (page-1)*perPage, perPage)...)
+	return keys, len(all), nil
+}
+
+func (m *Memory) CreateManagementKey(ctx context.Context, keyHash, keyPrefix, name string, permissions []string) (*ManagementAPIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.mgmtKeys {
+		if k.KeyHash == keyHash {
+			return nil, fmt.Errorf("create management key: key hash already exists")
+		}
+	}
+	if permissions == nil {
+		return nil, fmt.Errorf("create management key: permissions must not be null")
+	}
+	now := memoryNow()
+	k := &ManagementAPIKey{
+		ID:          uuid.New(),
+		KeyHash:     keyHash,
+		KeyPrefix:   keyPrefix,
+		Name:        name,
+		IsActive:    true,
+		Permissions: slices.Clone(permissions),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	m.mgmtKeys[k.ID] = k
+	c := cloneManagementKey(k)
+	return &c, nil
+}
+
+func (m *Memory) UpdateManagementKey(ctx context.Context, id uuid.UUID, updates ManagementKeyUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.mgmtKeys[id]
+	if !ok {
+		return nil
+	}
+	changed := false
+	if updates.Name != nil {
+		k.Name = *updates.Name
+		changed = true
+	}
+	if updates.IsActive != nil {
+		k.IsActive = *updates.IsActive
+		changed = true
+	}
+	if updates.Permissions != nil {
+		k.Permissions = slices.Clone(updates.Permissions)
+		changed = true
+	}
+	if changed {
+		k.UpdatedAt = memoryNow()
+	}
+	return nil
+}
+
+func (m *Memory) DeactivateManagementKey(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if k, ok := m.mgmtKeys[id]; ok {
+		k.IsActive = false
+		k.UpdatedAt = memoryNow()
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memoryAuditSample is an audit sample with the views recorded for it.
+type memoryAuditSample struct {
+	AuditSample
+	views []AuditSampleView
+}
+
+func (m *Memory) ListAuditRules(ctx context.Context) ([]AuditRule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rules := []AuditRule{}
+	for _, r := range m.auditRules {
+		c := *r
+		c.KeyID = clonePtr(r.KeyID)
+		rules = append(rules, c)
+	}
+	slices.SortStableFunc(rules, func(a, b AuditRule) int {
+		switch {
+		case a.KeyID == nil && b.KeyID != nil:
+			return -1
+		case a.KeyID != nil && b.KeyID == nil:
+			return 1
+		case a.KeyID != nil && b.KeyID != nil:
+			if c := compareUUID(*a.KeyID, *b.KeyID); c != 0 {
+				return c
+			}
+		}
+		if c := strings.Compare(a.Model, b.Model); c != 0 {
+			return c
+		}
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return rules, nil
+}
+
+func (m *Memory) SetAuditRule(ctx context.Context, rc *AuditRuleCreate) (*AuditRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rc.KeyID != nil {
+		if _, ok := m.llmKeys[*rc.KeyID]; !ok {
+			return nil, fmt.Errorf("set audit rule: key %s does not exist", *rc.KeyID)
+		}
+	}
+
+	var rule *AuditRule
+	for _, r := range m.auditRules {
+		sameKey := (r.KeyID == nil && rc.KeyID == nil) || (r.KeyID != nil && rc.KeyID != nil && *r.KeyID == *rc.KeyID)
+		if sameKey && strings.EqualFold(r.Model, rc.Model) {
+			rule = r
+			break
+		}
+	}
+	if rule == nil {
+		rule = &AuditRule{ID: uuid.New(), KeyID: clonePtr(rc.KeyID), Model: rc.Model, CreatedAt: memoryNow()}
+		m.auditRules[rule.ID] = rule
+	}
+	rule.Percent, rule.Note = rc.Percent, rc.Note
+
+	c := *rule
+	c.KeyID = clonePtr(rule.KeyID)
+	return &c, nil
+}
+
+func (m *Memory) DeleteAuditRule(ctx context.Context, id uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.auditRules[id]; !ok {
+		return false, nil
+	}
+	delete(m.auditRules, id)
+	for _, a := range m.auditSamples {
+		if a.RuleID != nil && *a.RuleID == id {
+			a.RuleID = nil
+		}
+	}
+	return true, nil
+}
+
+// insertAuditSample stores a copy of a. m.mu must be held.
+func (m *Memory) insertAuditSample(a *AuditSample, now time.Time) {
+	c := *a
+	c.ID, c.CreatedAt = uuid.New(), now
+	c.RuleID, c.KeyID = clonePtr(a.RuleID), clonePtr(a.KeyID)
+	m.auditSamples = append(m.auditSamples, &memoryAuditSample{AuditSample: c})
+}
+
+func (m *Memory) ListAuditSamples(ctx context.Context, filter AuditSampleFilter) ([]AuditSample, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matched []AuditSample
+	for _, a := range m.auditSamples {
+		switch {
+		case filter.KeyID != nil && (a.KeyID == nil || *a.KeyID != *filter.KeyID),
+			filter.Model != nil && !containsFold(a.Model, *filter.Model),
+			filter.RuleID != nil && (a.RuleID == nil || *a.RuleID != *filter.RuleID),
+			filter.DateFrom != nil && a.CreatedAt.Before(*filter.DateFrom),
+			filter.DateTo != nil && a.CreatedAt.After(*filter.DateTo):
+			continue
+		}
+		c := a.AuditSample
+		c.Request, c.Response = "", ""
+		matched = append(matched, c)
+	}
+	page := newestPage(matched, func(a AuditSample) time.Time { return a.CreatedAt }, filter.Page, filter.PerPage)
+	if page == nil {
+		page = []AuditSample{}
+	}
+	return page, len(matched), nil
+}
+
+func (m *Memory) ViewAuditSample(ctx context.Context, id, viewer uuid.UUID) (*AuditSample, []AuditSampleView, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range m.auditSamples {
+		if a.ID == id {
+			a.views = append(a.views, AuditSampleView{ManagementKeyID: viewer, ViewedAt: memoryNow()})
+			c := a.AuditSample
+			return &c, slices.Clone(a.views), nil
+		}
+	}
+	return nil, nil, nil
+}
+
+func (m *Memory) DeleteOldAuditSamples(ctx context.Context, olderThan time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.auditSamples)
+	m.auditSamples = slices.DeleteFunc(m.auditSamples, func(a *memoryAuditSample) bool { return a.CreatedAt.Before(olderThan) })
+	return int64(n - len(m.auditSamples)), nil
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+func cloneGuardrail(g *Guardrail) Guardrail {
+	c := *g
+	c.KeyID = clonePtr(g.KeyID)
+	c.Patterns = slices.Clone(g.Patterns)
+	c.Entities = slices.Clone(g.Entities)
+	return c
+}
+
+func (m *Memory) ListGuardrails(ctx context.Context) ([]Guardrail, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	guardrails := make([]Guardrail, 0, len(m.guardrails))
+	for _, g := range m.guardrails {
+		guardrails = append(guardrails, cloneGuardrail(g))
+	}
+	slices.SortFunc(guardrails, func(a, b Guardrail) int {
+		switch {
+		case a.KeyID == nil && b.KeyID != nil:
+			return -1
+		case a.KeyID != nil && b.KeyID == nil:
+			return 1
+		case a.KeyID != nil && b.KeyID != nil:
+			if c := compareUUID(*a.KeyID, *b.KeyID); c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return guardrails, nil
+}
+
+func (m *Memory) GetGuardrail(ctx context.Context, id uuid.UUID) (*Guardrail, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	g, ok := m.guardrails[id]
+	if !ok {
+		return nil, nil
+	}
+	c := cloneGuardrail(g)
+	return &c, nil
+}
+
+// guardrailNameTaken reports whether a guardrail other than id is named
+// name. m.mu must be held.
+func (m *Memory) guardrailNameTaken(name string, id uuid.UUID) bool {
+	for _, g := range m.guardrails {
+		if g.Name == name && g.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) CreateGuardrail(ctx context.Context, gc *GuardrailCreate) (*Guardrail, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.guardrailNameTaken(gc.Name, uuid.Nil) {
+		return nil, fmt.Errorf("create guardrail: guardrail name %q already exists", gc.Name)
+	}
+	if gc.KeyID != nil {
+		if _, ok := m.llmKeys[*gc.KeyID]; !ok {
+			return nil, fmt.Errorf("create guardrail: key %s does not exist", *gc.KeyID)
+		}
+	}
+	now := memoryNow()
+	g := &Guardrail{
+		ID:        uuid.New(),
+		Name:      gc.Name,
+		Kind:      gc.Kind,
+		Stage:     gc.Stage,
+		Mode:      gc.Mode,
+		KeyID:     clonePtr(gc.KeyID),
+		Patterns:  orEmpty(slices.Clone(gc.Patterns)),
+		MaxChars:  gc.MaxChars,
+		Entities:  orEmpty(slices.Clone(gc.Entities)),
+		Message:   gc.Message,
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.guardrails[g.ID] = g
+	c := cloneGuardrail(g)
+	return &c, nil
+}
+
+func (m *Memory) UpdateGuardrail(ctx context.Context, id uuid.UUID, upd *GuardrailUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, ok := m.guardrails[id]
+	if !ok || *upd == (GuardrailUpdate{}) {
+		return nil
+	}
+	if upd.Name != nil && m.guardrailNameTaken(*upd.Name, id) {
+		return fmt.Errorf("update guardrail: guardrail name %q already exists", *upd.Name)
+	}
+	g := upd.Apply(cloneGuardrail(cur))
+	g.Patterns = orEmpty(slices.Clone(g.Patterns))
+	g.Entities = orEmpty(slices.Clone(g.Entities))
+	g.UpdatedAt = memoryNow()
+	*cur = g
+	return nil
+}
+
+func (m *Memory) DeleteGuardrail(ctx context.Context, id uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.guardrails[id]; !ok {
+		return false, nil
+	}
+	delete(m.guardrails, id)
+	return true, nil
+}
@@ -0,0 +1,676 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memoryLog is a request log row, with the columns RequestLog leaves out.
+type memoryLog struct {
+	RequestLog
+	cacheCreationTokens int
+	cacheReadTokens     int
+	canaryID            *uuid.UUID
+	canaryArm           string
+	payload             *LogPayload
+}
+
+func (m *Memory) InsertLog(ctx context.Context, entry *LogEntry) error {
+	return m.InsertLogBatch(ctx, []*LogEntry{entry})
+}
+
+func (m *Memory) InsertLogBatch(ctx context.Context, entries []*LogEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := memoryNow()
+	for _, e := range entries {
+		keyID, model, errMsg := e.KeyID, e.Model, e.ErrorMessage
+		status, latency, in, out, overhead, cost := e.StatusCode, e.LatencyMS, e.InputTokens, e.OutputTokens, e.OverheadUS, e.Cost
+		l := &memoryLog{
+			RequestLog: RequestLog{
+				ID:              uuid.New(),
+				KeyID:           &keyID,
+				Timestamp:       e.Timestamp,
+				Method:          e.Method,
+				Path:            e.Path,
+				Model:           &model,
+				InputFormat:     e.InputFormat,
+				UpstreamID:      e.UpstreamID,
+				StatusCode:      &status,
+				LatencyMS:       &latency,
+				InputTokens:     &in,
+				OutputTokens:    &out,
+				ReasoningTokens: e.ReasoningTokens,
+				Cost:            &cost,
+				OverheadUS:      &overhead,
+				ToolCalls:       e.ToolCalls,
+				WebSearches:     e.WebSearchRequests,
+				Region:          nullIfEmpty(&e.Region),
+				UpstreamFormat:  nullIfEmpty(&e.UpstreamFormat),
+				Translated:      e.Translated,
+				Priority:        nullIfEmpty(&e.Priority),
+				ErrorMessage:    &errMsg,
+				ErrorCode:       nullIfEmpty(&e.ErrorCode),
+				RequestMetadata: maps.Clone(e.RequestMetadata),
+				CreatedAt:       now,
+			},
+			cacheCreationTokens: e.CacheCreationTokens,
+			cacheReadTokens:     e.CacheReadTokens,
+			canaryID:            e.CanaryID,
+			canaryArm:           e.CanaryArm,
+		}
+		if e.Payload != nil {
+			p := *e.Payload
+			p.LogID, p.CreatedAt = l.ID, now
+			l.payload = &p
+		}
+		if e.AuditSample != nil {
+			m.insertAuditSample(e.AuditSample, now)
+		}
+		m.logs = append(m.logs, l)
+	}
+	return nil
+}
+
+func (m *Memory) GetLog(ctx context.Context, id uuid.UUID) (*RequestLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, l := range m.logs {
+		if l.ID == id {
+			c := l.RequestLog
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+// statusMatches applies a status filter: a multiple of 100 matches the
+// whole class.
+func statusMatches(filter, status int) bool {
+	if filter%100 == 0 {
+		return status >= filter && status < filter+100
+	}
+	return status == filter
+}
+
+// newestPage sorts rows newest first and returns the requested page, 50
+// rows to a page by default, as the log listings do.
+func newestPage[T any](rows []T, ts func(T) time.Time, page, perPage int) []T {
+	slices.SortStableFunc(rows, func(a, b T) int { return ts(b).Compare(ts(a)) })
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 50
+	}
+	var out []T
+	return append(out, window(rows, (page-1)*perPage, perPage)...)
+}
+
+func (m *Memory) ListLogs(ctx context.Context, filter LogFilter) ([]RequestLog, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matched []RequestLog
+	for _, l := range m.logs {
+		switch {
+		case filter.KeyID != nil && (l.KeyID == nil || *l.KeyID != *filter.KeyID),
+			filter.Model != nil && !containsFold(*l.Model, *filter.Model),
+			filter.StatusCode != nil && !statusMatches(*filter.StatusCode, *l.StatusCode),
+			filter.InputFormat != nil && l.InputFormat != *filter.InputFormat,
+			filter.Region != nil && (l.Region == nil || *l.Region != *filter.Region),
+			filter.Priority != nil && (l.Priority == nil || *l.Priority != *filter.Priority),
+			filter.ErrorCode != nil && (l.ErrorCode == nil || *l.ErrorCode != *filter.ErrorCode),
+			filter.DateFrom != nil && l.Timestamp.Before(*filter.DateFrom),
+			filter.DateTo != nil && l.Timestamp.After(*filter.DateTo):
+			continue
+		}
+		matched = append(matched, l.RequestLog)
+	}
+	// Newest first, ties broken by ID as in Postgres, so that After
+	// continues exactly where a page ended.
+	newestFirst := func(a, b RequestLog) int {
+		if c := b.Timestamp.Compare(a.Timestamp); c != 0 {
+			return c
+		}
+		return compareUUID(b.ID, a.ID)
+	}
+	slices.SortFunc(matched, newestFirst)
+	if filter.After == nil {
+		page := newestPage(matched, func(l RequestLog) time.Time { return l.Timestamp }, filter.Page, filter.PerPage)
+		return page, len(matched), nil
+	}
+	start, found := slices.BinarySearchFunc(matched, RequestLog{Timestamp: filter.After.Timestamp, ID: filter.After.ID}, newestFirst)
+	if found {
+		start++
+	}
+	perPage := filter.PerPage
+	if perPage < 1 {
+		perPage = 50
+	}
+	var out []RequestLog
+	return append(out, window(matched, start, perPage)...), 0, nil
+}
+
+func (m *Memory) DeleteOldLogs(ctx context.Context, olderThan time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.logs)
+	m.logs = slices.DeleteFunc(m.logs, func(l *memoryLog) bool { return l.Timestamp.Before(olderThan) })
+	return int64(n - len(m.logs)), nil
+}
+
+func (m *Memory) GetLogPayload(ctx context.Context, logID uuid.UUID) (*LogPayload, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, l := range m.logs {
+		if l.ID == logID && l.payload != nil {
+			p := *l.payload
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *Memory) DeleteOldPayloads(ctx context.Context, olderThan time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for _, l := range m.logs {
+		if l.payload != nil && l.payload.CreatedAt.Before(olderThan) {
+			l.payload = nil
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) InsertAccessLogBatch(ctx context.Context, entries []*AccessLogEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range entries {
+		m.accessLogs = append(m.accessLogs, &AccessLog{
+			ID:              uuid.New(),
+			ManagementKeyID: e.ManagementKeyID,
+			Timestamp:       e.Timestamp,
+			Method:          e.Method,
+			Path:            e.Path,
+			Route:           e.Route,
+			StatusCode:      e.StatusCode,
+			LatencyMS:       e.LatencyMS,
+			ClientIP:        e.ClientIP,
+		})
+	}
+	return nil
+}
+
+func (m *Memory) ListAccessLogs(ctx context.Context, filter AccessLogFilter) ([]AccessLog, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matched []AccessLog
+	for _, l := range m.accessLogs {
+		switch {
+		case filter.ManagementKeyID != nil && (l.ManagementKeyID == nil || *l.ManagementKeyID != *filter.ManagementKeyID),
+			filter.Unauthenticated && l.ManagementKeyID != nil,
+			filter.StatusCode != nil && !statusMatches(*filter.StatusCode, l.StatusCode),
+			filter.ClientIP != nil && l.ClientIP != *filter.ClientIP,
+			filter.DateFrom != nil && l.Timestamp.Before(*filter.DateFrom),
+			filter.DateTo != nil && l.Timestamp.After(*filter.DateTo):
+			continue
+		}
+		matched = append(matched, *l)
+	}
+	page := newestPage(matched, func(l AccessLog) time.Time { return l.Timestamp }, filter.Page, filter.PerPage)
+	return page, len(matched), nil
+}
+
+func (m *Memory) DeleteOldAccessLogs(ctx context.Context, olderThan time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.accessLogs)
+	m.accessLogs = slices.DeleteFunc(m.accessLogs, func(l *AccessLog) bool { return l.Timestamp.Before(olderThan) })
+	return int64(n - len(m.accessLogs)), nil
+}
+
+// periodToDuration is periodToInterval as a duration.
+func periodToDuration(period string) time.Duration {
+	switch periodToInterval(period) {
+	case "7 days":
+		return 7 * 24 * time.Hour
+	case "30 days":
+		return 30 * 24 * time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
+
+// truncateTime is date_trunc for the units intervalToTrunc returns.
+func truncateTime(t time.Time, unit string) time.Time {
+	t = t.UTC()
+	if unit == "day" {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
+
+// logsSince returns the logs of the last period that keep accepts. m.mu
+// must be held.
+func (m *Memory) logsSince(period string, keep func(*memoryLog) bool) []*memoryLog {
+	since := time.Now().Add(-periodToDuration(period))
+	var logs []*memoryLog
+	for _, l := range m.logs {
+		if l.Timestamp.After(since) && (keep == nil || keep(l)) {
+			logs = append(logs, l)
+		}
+	}
+	return logs
+}
+
+// logAggregate accumulates the sums and averages the stats queries
+// compute over a group of logs.
+type logAggregate struct {
+	requests, errors          int
+	inputTokens, outputTokens int64
+	cacheCreationTokens       int64
+	cacheReadTokens           int64
+	cost                      float64
+	latencies, overheads      []int
+	toolCalls, toolRounds     int
+}
+
+func (a *logAggregate) add(l *memoryLog) {
+	a.requests++
+	if *l.StatusCode >= 400 {
+		a.errors++
+	}
+	a.inputTokens += int64(*l.InputTokens)
+	a.outputTokens += int64(*l.OutputTokens)
+	a.cacheCreationTokens += int64(l.cacheCreationTokens)
+	a.cacheReadTokens += int64(l.cacheReadTokens)
+	a.cost += *l.Cost
+	a.latencies = append(a.latencies, *l.LatencyMS)
+	a.overheads = append(a.overheads, *l.OverheadUS)
+	a.toolCalls += l.ToolCalls
+	if l.ToolCalls > 0 {
+		a.toolRounds++
+	}
+}
+
+// ratio is n/d, or 0 when d is 0.
+func ratio(n, d float64) float64 {
+	if d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// mean is AVG(x)::int: the rounded mean, or 0 for no values.
+func mean(xs []int) int {
+	sum := 0
+	for _, x := range xs {
+		sum += x
+	}
+	return int(math.Round(ratio(float64(sum), float64(len(xs)))))
+}
+
+// percentile is percentile_cont(p)::int: linearly interpolated and
+// rounded, or 0 for no values.
+func percentile(xs []int, p float64) int {
+	if len(xs) == 0 {
+		return 0
+	}
+	sorted := slices.Sorted(slices.Values(xs))
+	pos := p * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	v := float64(sorted[lo]) + (pos-float64(lo))*float64(sorted[hi]-sorted[lo])
+	return int(math.Round(v))
+}
+
+func (a *logAggregate) overview() OverviewStats {
+	s := OverviewStats{
+		TotalRequests:        a.requests,
+		TotalInputTokens:     a.inputTokens,
+		TotalOutputTokens:    a.outputTokens,
+		TotalCacheReadTokens: a.cacheReadTokens,
+		TotalCost:            a.cost,
+		AvgLatencyMS:         mean(a.latencies),
+		AvgOverheadUS:        mean(a.overheads),
+		ErrorCount:           a.errors,
+		ErrorRate:            ratio(float64(a.errors), float64(a.requests)),
+	}
+	s.CacheHitRate = ratio(float64(a.cacheReadTokens), float64(a.inputTokens+a.cacheReadTokens))
+	return s
+}
+
+func (a *logAggregate) modelStats(model string) ModelStats {
+	return ModelStats{
+		Model:             model,
+		TotalRequests:     a.requests,
+		TotalInputTokens:  a.inputTokens,
+		TotalOutputTokens: a.outputTokens,
+		TotalCost:         a.cost,
+		AvgLatencyMS:      mean(a.latencies),
+		AvgToolCalls:      ratio(float64(a.toolCalls), float64(a.requests)),
+		ToolCallRate:      ratio(float64(a.toolRounds), float64(a.requests)),
+	}
+}
+
+func (a *logAggregate) bucket(t time.Time) TimeSeriesBucket {
+	return TimeSeriesBucket{
+		Bucket:        t,
+		Requests:      a.requests,
+		InputTokens:   a.inputTokens,
+		OutputTokens:  a.outputTokens,
+		Cost:          a.cost,
+		AvgLatencyMS:  mean(a.latencies),
+		AvgOverheadUS: mean(a.overheads),
+		Errors:        a.errors,
+	}
+}
+
+// groupLogs aggregates logs by key, in the order keys first appear.
+func groupLogs[K comparable](logs []*memoryLog, key func(*memoryLog) K) ([]K, map[K]*logAggregate) {
+	var keys []K
+	groups := make(map[K]*logAggregate)
+	for _, l := range logs {
+		k := key(l)
+		a, ok := groups[k]
+		if !ok {
+			a = &logAggregate{}
+			groups[k] = a
+			keys = append(keys, k)
+		}
+		a.add(l)
+	}
+	return keys, groups
+}
+
+func (m *Memory) GetOverviewStats(ctx context.Context, period string) (*OverviewStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var a logAggregate
+	for _, l := range m.logsSince(period, nil) {
+		a.add(l)
+	}
+	s := a.overview()
+	return &s, nil
+}
+
+func (m *Memory) GetStatsByKey(ctx context.Context, period string, page, perPage int) ([]KeyStats, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	logs := m.logsSince(period, func(l *memoryLog) bool {
+		_, ok := m.llmKeys[*l.KeyID]
+		return ok
+	})
+	ids, groups := groupLogs(logs, func(l *memoryLog) uuid.UUID { return *l.KeyID })
+
+	all := make([]KeyStats, 0, len(ids))
+	for _, id := range ids {
+		a, k := groups[id], m.llmKeys[id]
+		all = append(all, KeyStats{
+			KeyID:             id,
+			KeyPrefix:         k.KeyPrefix,
+			KeyName:           k.Name,
+			TotalRequests:     a.requests,
+			TotalInputTokens:  a.inputTokens,
+			TotalOutputTokens: a.outputTokens,
+			TotalCost:         a.cost,
+			AvgLatencyMS:      mean(a.latencies),
+		})
+	}
+	slices.SortStableFunc(all, func(a, b KeyStats) int { return cmp.Compare(b.TotalCost, a.TotalCost) })
+
+	var stats []KeyStats
+	stats = append(stats, window(all, (page-1)*perPage, perPage)...)
+	return stats, len(all), nil
+}
+
+// statsByModel groups logs by model, highest spend first.
+func statsByModel(logs []*memoryLog) []ModelStats {
+	models, groups := groupLogs(logs, func(l *memoryLog) string { return *l.Model })
+	var stats []ModelStats
+	for _, model := range models {
+		stats = append(stats, groups[model].modelStats(model))
+	}
+	slices.SortStableFunc(stats, func(a, b ModelStats) int { return cmp.Compare(b.TotalCost, a.TotalCost) })
+	return stats
+}
+
+func (m *Memory) GetStatsByModel(ctx context.Context, period string) ([]ModelStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return statsByModel(m.logsSince(period, nil)), nil
+}
+
+func (m *Memory) GetStatsByTranslation(ctx context.Context, period string) ([]TranslationStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	type path struct {
+		input, upstream string
+		translated      bool
+	}
+	logs := m.logsSince(period, func(l *memoryLog) bool { return l.UpstreamFormat != nil })
+	paths, groups := groupLogs(logs, func(l *memoryLog) path {
+		return path{l.InputFormat, *l.UpstreamFormat, l.Translated}
+	})
+
+	var stats []TranslationStats
+	for _, p := range paths {
+		a := groups[p]
+		stats = append(stats, TranslationStats{
+			InputFormat:    p.input,
+			UpstreamFormat: p.upstream,
+			Translated:     p.translated,
+			TotalRequests:  a.requests,
+			Errors:         a.errors,
+			ErrorRate:      ratio(float64(a.errors), float64(a.requests)),
+			AvgLatencyMS:   mean(a.latencies),
+			P95LatencyMS:   percentile(a.latencies, 0.95),
+			AvgOverheadUS:  mean(a.overheads),
+			P95OverheadUS:  percentile(a.overheads, 0.95),
+		})
+	}
+	slices.SortStableFunc(stats, func(a, b TranslationStats) int {
+		if c := strings.Compare(a.InputFormat, b.InputFormat); c != 0 {
+			return c
+		}
+		return strings.Compare(a.UpstreamFormat, b.UpstreamFormat)
+	})
+	return stats, nil
+}
+
+func (m *Memory) GetProviderErrorStats(ctx context.Context, period string) ([]ProviderErrorStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	type group struct {
+		code, model string
+		upstream    uuid.UUID
+	}
+	byGroup := make(map[group]*ProviderErrorStats)
+	var stats []*ProviderErrorStats
+	for _, l := range m.logsSince(period, func(l *memoryLog) bool {
+		return l.ErrorCode != nil && strings.HasPrefix(*l.ErrorCode, "provider_")
+	}) {
+		g := group{code: *l.ErrorCode}
+		if l.Model != nil {
+			g.model = *l.Model
+		}
+		if l.UpstreamID != nil {
+			g.upstream = *l.UpstreamID
+		}
+		ps, ok := byGroup[g]
+		if !ok {
+			ps = &ProviderErrorStats{ErrorCode: g.code, UpstreamID: l.UpstreamID, Model: g.model}
+			byGroup[g] = ps
+			stats = append(stats, ps)
+		}
+		ps.Requests++
+		if l.Timestamp.After(ps.LastSeen) {
+			ps.LastSeen = l.Timestamp
+		}
+	}
+	slices.SortStableFunc(stats, func(a, b *ProviderErrorStats) int {
+		if c := cmp.Compare(b.Requests, a.Requests); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ErrorCode, b.ErrorCode)
+	})
+	out := make([]ProviderErrorStats, 0, len(stats))
+	for _, ps := range stats {
+		out = append(out, *ps)
+	}
+	return out, nil
+}
+
+func (m *Memory) GetCacheInjectionStats(ctx context.Context, period string) ([]CacheInjectionStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	logs := m.logsSince(period, func(l *memoryLog) bool { return l.RequestMetadata["cache_control_injected"] == true })
+	models, groups := groupLogs(logs, func(l *memoryLog) string { return *l.Model })
+
+	var stats []CacheInjectionStats
+	for _, model := range models {
+		a := groups[model]
+		var inputPrice float64
+		for _, mo := range m.models {
+			if mo.Name == model {
+				inputPrice = mo.InputCostPerMillion
+			}
+		}
+		stats = append(stats, CacheInjectionStats{
+			Model:                    model,
+			TotalRequests:            a.requests,
+			TotalInputTokens:         a.inputTokens,
+			TotalCacheCreationTokens: a.cacheCreationTokens,
+			TotalCacheReadTokens:     a.cacheReadTokens,
+			CacheHitRate:             ratio(float64(a.cacheReadTokens), float64(a.inputTokens+a.cacheCreationTokens+a.cacheReadTokens)),
+			EstimatedSavings:         (cacheReadSaving*float64(a.cacheReadTokens) - cacheWriteSurcharge*float64(a.cacheCreationTokens)) * inputPrice / 1_000_000,
+		})
+	}
+	slices.SortStableFunc(stats, func(a, b CacheInjectionStats) int { return cmp.Compare(b.EstimatedSavings, a.EstimatedSavings) })
+	return stats, nil
+}
+
+// timeSeries buckets logs by interval, oldest first.
+func timeSeries(logs []*memoryLog, interval string) []TimeSeriesBucket {
+	unit := intervalToTrunc(interval)
+	times, groups := groupLogs(logs, func(l *memoryLog) time.Time { return truncateTime(l.Timestamp, unit) })
+	var buckets []TimeSeriesBucket
+	for _, t := range times {
+		buckets = append(buckets, groups[t].bucket(t))
+	}
+	slices.SortFunc(buckets, func(a, b TimeSeriesBucket) int { return a.Bucket.Compare(b.Bucket) })
+	return buckets
+}
+
+func (m *Memory) GetTimeSeries(ctx context.Context, period, interval string) ([]TimeSeriesBucket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return timeSeries(m.logsSince(period, nil), interval), nil
+}
+
+func (m *Memory) GetLatencyPercentiles(ctx context.Context, period string) (*LatencyStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var a logAggregate
+	for _, l := range m.logsSince(period, nil) {
+		a.add(l)
+	}
+	return &LatencyStats{
+		P50:           percentile(a.latencies, 0.50),
+		P95:           percentile(a.latencies, 0.95),
+		P99:           percentile(a.latencies, 0.99),
+		OverheadP50US: percentile(a.overheads, 0.50),
+		OverheadP95US: percentile(a.overheads, 0.95),
+		OverheadP99US: percentile(a.overheads, 0.99),
+	}, nil
+}
+
+func (m *Memory) GetKeyUsage(ctx context.Context, keyID uuid.UUID, period, interval string, errorLimit int) (*KeyUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	logs := m.logsSince(period, func(l *memoryLog) bool { return *l.KeyID == keyID })
+
+	usage := &KeyUsage{
+		TimeSeries:   append([]TimeSeriesBucket{}, timeSeries(logs, interval)...),
+		ByModel:      append([]ModelStats{}, statsByModel(logs)...),
+		RecentErrors: []KeyUsageError{},
+	}
+	var a logAggregate
+	minuteAgo := time.Now().Add(-time.Minute)
+	for _, l := range logs {
+		a.add(l)
+		if l.Timestamp.After(minuteAgo) {
+			usage.RequestsLastMinute++
+		}
+	}
+	usage.Totals = a.overview()
+
+	var failed []*memoryLog
+	for _, l := range logs {
+		if *l.StatusCode >= 400 {
+			failed = append(failed, l)
+		}
+	}
+	slices.SortStableFunc(failed, func(a, b *memoryLog) int { return b.Timestamp.Compare(a.Timestamp) })
+	for _, l := range window(failed, 0, errorLimit) {
+		usage.RecentErrors = append(usage.RecentErrors, KeyUsageError{
+			ID:           l.ID,
+			Timestamp:    l.Timestamp,
+			Model:        l.Model,
+			Path:         l.Path,
+			StatusCode:   l.StatusCode,
+			ErrorMessage: l.ErrorMessage,
+		})
+	}
+	return usage, nil
+}
+
+func (m *Memory) GetDailyModelUsage(ctx context.Context, from, to time.Time, tokenClip int) ([]DailyModelUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	type group struct {
+		day   time.Time
+		model string
+	}
+	usage := map[group]*DailyModelUsage{}
+	keys := map[group]map[uuid.UUID]bool{}
+	for _, l := range m.logs {
+		if l.Model == nil || l.Timestamp.Before(from) || !l.Timestamp.Before(to) {
+			continue
+		}
+		g := group{truncateTime(l.Timestamp, "day"), *l.Model}
+		u, ok := usage[g]
+		if !ok {
+			u = &DailyModelUsage{Day: g.day, Model: g.model}
+			usage[g], keys[g] = u, map[uuid.UUID]bool{}
+		}
+		u.Requests++
+		if l.KeyID != nil {
+			keys[g][*l.KeyID] = true
+		}
+		if l.InputTokens != nil {
+			u.InputTokens += int64(min(*l.InputTokens, tokenClip))
+		}
+		if l.OutputTokens != nil {
+			u.OutputTokens += int64(min(*l.OutputTokens, tokenClip))
+		}
+	}
+	var out []DailyModelUsage
+	for g, u := range usage {
+		u.Keys = len(keys[g])
+		out = append(out, *u)
+	}
+	slices.SortFunc(out, func(a, b DailyModelUsage) int {
+		return cmp.Or(a.Day.Compare(b.Day), strings.Compare(a.Model, b.Model))
+	})
+	return out, nil
+}
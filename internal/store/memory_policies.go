@@ -0,0 +1,285 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func clonePolicyCanary(c *PolicyCanary) PolicyCanary {
+	cc := *c
+	cc.Policies = slices.Clone(c.Policies)
+	return cc
+}
+
+func (m *Memory) ListPolicies(ctx context.Context) ([]Policy, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	policies := make([]Policy, 0, len(m.policies))
+	for _, p := range m.policies {
+		policies = append(policies, *p)
+	}
+	slices.SortFunc(policies, func(a, b Policy) int {
+		if c := cmp.Compare(b.Priority, a.Priority); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return policies, nil
+}
+
+func (m *Memory) GetPolicy(ctx context.Context, id uuid.UUID) (*Policy, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	p, ok := m.policies[id]
+	if !ok {
+		return nil, nil
+	}
+	c := *p
+	return &c, nil
+}
+
+// policyNameTaken reports whether a policy other than id is named name.
+// m.mu must be held.
+func (m *Memory) policyNameTaken(name string, id uuid.UUID) bool {
+	for _, p := range m.policies {
+		if p.Name == name && p.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// insertPolicy adds a policy with the schema's defaults. m.mu must be held.
+func (m *Memory) insertPolicy(pc *PolicyCreate) (*Policy, error) {
+	if m.policyNameTaken(pc.Name, uuid.Nil) {
+		return nil, fmt.Errorf("policy name %q already exists", pc.Name)
+	}
+	now := memoryNow()
+	p := &Policy{
+		ID:          uuid.New(),
+		Name:        pc.Name,
+		Expression:  pc.Expression,
+		Action:      pc.Action,
+		TargetModel: pc.TargetModel,
+		MaxTokens:   pc.MaxTokens,
+		Message:     pc.Message,
+		Priority:    pc.Priority,
+		IsActive:    true,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	m.policies[p.ID] = p
+	return p, nil
+}
+
+func (m *Memory) CreatePolicy(ctx context.Context, pc *PolicyCreate) (*Policy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, err := m.insertPolicy(pc)
+	if err != nil {
+		return nil, fmt.Errorf("create policy: %w", err)
+	}
+	c := *p
+	return &c, nil
+}
+
+func (m *Memory) UpdatePolicy(ctx context.Context, id uuid.UUID, upd *PolicyUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, ok := m.policies[id]
+	if !ok || *upd == (PolicyUpdate{}) {
+		return nil
+	}
+	if upd.Name != nil && m.policyNameTaken(*upd.Name, id) {
+		return fmt.Errorf("update policy: policy name %q already exists", *upd.Name)
+	}
+
+	p := *cur
+	if upd.Name != nil {
+		p.Name = *upd.Name
+	}
+	if upd.Expression != nil {
+		p.Expression = *upd.Expression
+	}
+	if upd.Action != nil {
+		p.Action = *upd.Action
+	}
+	if upd.TargetModel != nil {
+		p.TargetModel = upd.TargetModel
+	}
+	if upd.MaxTokens != nil {
+		p.MaxTokens = upd.MaxTokens
+	}
+	if upd.Message != nil {
+		p.Message = upd.Message
+	}
+	if upd.Priority != nil {
+		p.Priority = *upd.Priority
+	}
+	if upd.IsActive != nil {
+		p.IsActive = *upd.IsActive
+	}
+	p.UpdatedAt = memoryNow()
+	*cur = p
+	return nil
+}
+
+func (m *Memory) DeletePolicy(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.policies, id)
+	return nil
+}
+
+func (m *Memory) ListPolicyCanaries(ctx context.Context) ([]PolicyCanary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	canaries := make([]PolicyCanary, 0, len(m.canaries))
+	for _, c := range m.canaries {
+		canaries = append(canaries, clonePolicyCanary(c))
+	}
+	sortNewestFirst(canaries, func(c PolicyCanary) (time.Time, uuid.UUID) { return c.CreatedAt, c.ID })
+	return canaries, nil
+}
+
+func (m *Memory) GetPolicyCanary(ctx context.Context, id uuid.UUID) (*PolicyCanary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, ok := m.canaries[id]
+	if !ok {
+		return nil, nil
+	}
+	cc := clonePolicyCanary(c)
+	return &cc, nil
+}
+
+// runningCanary returns the running canary, if any. m.mu must be held.
+func (m *Memory) runningCanary() *PolicyCanary {
+	for _, c := range m.canaries {
+		if c.Status == CanaryRunning {
+			return c
+		}
+	}
+	return nil
+}
+
+func (m *Memory) GetRunningPolicyCanary(ctx context.Context) (*PolicyCanary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := m.runningCanary()
+	if c == nil {
+		return nil, nil
+	}
+	cc := clonePolicyCanary(c)
+	return &cc, nil
+}
+
+func (m *Memory) CreatePolicyCanary(ctx context.Context, cc *PolicyCanaryCreate) (*PolicyCanary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.runningCanary() != nil {
+		return nil, fmt.Errorf("create policy canary: a canary is already running")
+	}
+	now := memoryNow()
+	c := &PolicyCanary{
+		ID:                uuid.New(),
+		Name:              cc.Name,
+		Policies:          slices.Clone(cc.Policies),
+		Percent:           cc.Percent,
+		Status:            CanaryRunning,
+		MaxErrorRateDelta: 0.05,
+		MinRequests:       100,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	if cc.MaxErrorRateDelta != nil {
+		c.MaxErrorRateDelta = *cc.MaxErrorRateDelta
+	}
+	if cc.MaxLatencyDeltaMS != nil {
+		c.MaxLatencyDeltaMS = *cc.MaxLatencyDeltaMS
+	}
+	if cc.MinRequests != nil {
+		c.MinRequests = *cc.MinRequests
+	}
+	m.canaries[c.ID] = c
+	out := clonePolicyCanary(c)
+	return &out, nil
+}
+
+func (m *Memory) RollBackPolicyCanary(ctx context.Context, id uuid.UUID, reason string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.canaries[id]
+	if !ok || c.Status != CanaryRunning {
+		return false, nil
+	}
+	c.Status = CanaryRolledBack
+	c.StatusReason = &reason
+	c.UpdatedAt = memoryNow()
+	return true, nil
+}
+
+// PromotePolicyCanary replaces the active policies with the canary's. As
+// in a transaction, nothing changes if a policy cannot be created.
+func (m *Memory) PromotePolicyCanary(ctx context.Context, id uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.canaries[id]
+	if !ok || c.Status != CanaryRunning {
+		return false, nil
+	}
+
+	previous := m.policies
+	m.policies = make(map[uuid.UUID]*Policy, len(c.Policies))
+	for _, pc := range c.Policies {
+		if _, err := m.insertPolicy(&pc); err != nil {
+			m.policies = previous
+			return false, fmt.Errorf("insert policy %q: %w", pc.Name, err)
+		}
+	}
+	c.Status = CanaryPromoted
+	c.StatusReason = nil
+	c.UpdatedAt = memoryNow()
+	return true, nil
+}
+
+func (m *Memory) PolicyCanaryStats(ctx context.Context, id uuid.UUID) (*CanaryStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	type arm struct{ requests, errors, latency int }
+	arms := make(map[string]*arm)
+	for _, l := range m.logs {
+		if l.canaryID == nil || *l.canaryID != id {
+			continue
+		}
+		a, ok := arms[l.canaryArm]
+		if !ok {
+			a = &arm{}
+			arms[l.canaryArm] = a
+		}
+		a.requests++
+		if *l.StatusCode >= 500 {
+			a.errors++
+		}
+		a.latency += *l.LatencyMS
+	}
+
+	armStats := func(name string) CanaryArmStats {
+		a, ok := arms[name]
+		if !ok {
+			return CanaryArmStats{}
+		}
+		return CanaryArmStats{
+			Requests:     a.requests,
+			ErrorRate:    ratio(float64(a.errors), float64(a.requests)),
+			AvgLatencyMS: ratio(float64(a.latency), float64(a.requests)),
+		}
+	}
+	return &CanaryStats{Stable: armStats(CanaryArmStable), Canary: armStats(CanaryArmCanary)}, nil
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+func cloneRouter(mr *ModelRouter) ModelRouter {
+	c := *mr
+	c.Rules = slices.Clone(mr.Rules)
+	return c
+}
+
+func (m *Memory) ListModelRouters(ctx context.Context) ([]ModelRouter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	routers := make([]ModelRouter, 0, len(m.routers))
+	for _, mr := range m.routers {
+		routers = append(routers, cloneRouter(mr))
+	}
+	slices.SortFunc(routers, func(a, b ModelRouter) int { return strings.Compare(a.Name, b.Name) })
+	return routers, nil
+}
+
+func (m *Memory) GetModelRouter(ctx context.Context, id uuid.UUID) (*ModelRouter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	mr, ok := m.routers[id]
+	if !ok {
+		return nil, nil
+	}
+	c := cloneRouter(mr)
+	return &c, nil
+}
+
+// routerNameTaken reports whether a router other than id is named name,
+// case-insensitively. m.mu must be held.
+func (m *Memory) routerNameTaken(name string, id uuid.UUID) bool {
+	for _, mr := range m.routers {
+		if strings.EqualFold(mr.Name, name) && mr.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) CreateModelRouter(ctx context.Context, rc *ModelRouterCreate) (*ModelRouter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.routerNameTaken(rc.Name, uuid.Nil) {
+		return nil, fmt.Errorf("create model router: router name %q already exists", rc.Name)
+	}
+	now := memoryNow()
+	mr := &ModelRouter{
+		ID:           uuid.New(),
+		Name:         rc.Name,
+		Rules:        slices.Clone(rc.Rules),
+		DefaultModel: rc.DefaultModel,
+		IsActive:     true,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if mr.Rules == nil {
+		mr.Rules = []RouterRule{}
+	}
+	m.routers[mr.ID] = mr
+	c := cloneRouter(mr)
+	return &c, nil
+}
+
+func (m *Memory) UpdateModelRouter(ctx context.Context, id uuid.UUID, upd *ModelRouterUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, ok := m.routers[id]
+	if !ok || *upd == (ModelRouterUpdate{}) {
+		return nil
+	}
+	if upd.Name != nil && m.routerNameTaken(*upd.Name, id) {
+		return fmt.Errorf("update model router: router name %q already exists", *upd.Name)
+	}
+
+	mr := cloneRouter(cur)
+	if upd.Name != nil {
+		mr.Name = *upd.Name
+	}
+	if upd.Rules != nil {
+		mr.Rules = slices.Clone(*upd.Rules)
+		if mr.Rules == nil {
+			mr.Rules = []RouterRule{}
+		}
+	}
+	if upd.DefaultModel != nil {
+		mr.DefaultModel = *upd.DefaultModel
+	}
+	if upd.IsActive != nil {
+		mr.IsActive = *upd.IsActive
+	}
+	mr.UpdatedAt = memoryNow()
+	*cur = mr
+	return nil
+}
+
+func (m *Memory) DeleteModelRouter(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.routers, id)
+	return nil
+}
@@ -0,0 +1,343 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// scimMatches applies f to a resource with the given name and external ID.
+func scimMatches(f SCIMFilter, name string, externalID *string) bool {
+	if f.Name != nil && !strings.EqualFold(name, *f.Name) {
+		return false
+	}
+	if f.ExternalID != nil && (externalID == nil || *externalID != *f.ExternalID) {
+		return false
+	}
+	return true
+}
+
+// scimUser returns a copy of u with its key prefix and groups filled in.
+// m.mu must be held.
+func (m *Memory) scimUser(u *SCIMUser) SCIMUser {
+	c := *u
+	c.Resource = slices.Clone(u.Resource)
+	if k, ok := m.llmKeys[u.KeyID]; ok {
+		c.KeyPrefix = k.KeyPrefix
+	}
+	c.Groups = []SCIMRef{}
+	for gid, members := range m.scimMembers {
+		if members[u.ID] {
+			c.Groups = append(c.Groups, SCIMRef{Value: gid, Display: m.scimGroups[gid].DisplayName})
+		}
+	}
+	slices.SortFunc(c.Groups, func(a, b SCIMRef) int { return strings.Compare(a.Display, b.Display) })
+	return c
+}
+
+// scimGroup returns a copy of g with its members filled in. m.mu must be
+// held.
+func (m *Memory) scimGroup(g *SCIMGroup) SCIMGroup {
+	c := *g
+	c.Members = []SCIMRef{}
+	for uid := range m.scimMembers[g.ID] {
+		c.Members = append(c.Members, SCIMRef{Value: uid, Display: m.scimUsers[uid].UserName})
+	}
+	slices.SortFunc(c.Members, func(a, b SCIMRef) int { return strings.Compare(a.Display, b.Display) })
+	return c
+}
+
+// scimUserNameTaken reports whether a user other than id has name, ignoring
+// case. m.mu must be held.
+func (m *Memory) scimUserNameTaken(name string, id uuid.UUID) bool {
+	for _, u := range m.scimUsers {
+		if u.ID != id && strings.EqualFold(u.UserName, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// scimGroupNameTaken is scimUserNameTaken for group display names.
+func (m *Memory) scimGroupNameTaken(name string, id uuid.UUID) bool {
+	for _, g := range m.scimGroups {
+		if g.ID != id && strings.EqualFold(g.DisplayName, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyMetadata decodes a key's metadata, which is always a JSON object.
+func keyMetadata(k *LLMAPIKey) map[string]any {
+	meta := map[string]any{}
+	json.Unmarshal(k.Metadata, &meta)
+	return meta
+}
+
+func setKeyMetadata(k *LLMAPIKey, meta map[string]any) error {
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("encode key metadata: %w", err)
+	}
+	k.Metadata = b
+	k.UpdatedAt = memoryNow()
+	return nil
+}
+
+// refreshSCIMTeams sets the teams in the key metadata of users to the
+// names of the groups they belong to. m.mu must be held.
+func (m *Memory) refreshSCIMTeams(users []uuid.UUID) error {
+	for _, id := range users {
+		u, ok := m.scimUsers[id]
+		if !ok {
+			continue
+		}
+		k := m.llmKeys[u.KeyID]
+		meta := keyMetadata(k)
+		scim, ok := meta["scim"].(map[string]any)
+		if !ok {
+			continue
+		}
+		teams := []string{}
+		for _, g := range m.scimUser(u).Groups {
+			teams = append(teams, g.Display)
+		}
+		scim["teams"] = teams
+		if err := setKeyMetadata(k, meta); err != nil {
+			return fmt.Errorf("refresh scim teams: %w", err)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) ListSCIMUsers(ctx context.Context, f SCIMFilter, offset, limit int) ([]SCIMUser, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matched []*SCIMUser
+	for _, u := range m.scimUsers {
+		if scimMatches(f, u.UserName, u.ExternalID) {
+			matched = append(matched, u)
+		}
+	}
+	slices.SortFunc(matched, func(a, b *SCIMUser) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return compareUUID(a.ID, b.ID)
+	})
+
+	users := []SCIMUser{}
+	for _, u := range window(matched, offset, limit) {
+		users = append(users, m.scimUser(u))
+	}
+	return users, len(matched), nil
+}
+
+func (m *Memory) GetSCIMUser(ctx context.Context, id uuid.UUID) (*SCIMUser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.scimUsers[id]
+	if !ok {
+		return nil, nil
+	}
+	c := m.scimUser(u)
+	return &c, nil
+}
+
+func (m *Memory) CreateSCIMUser(ctx context.Context, w *SCIMUserWrite, keyHash, keyPrefix string) (*SCIMUser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.scimUserNameTaken(w.UserName, uuid.Nil) {
+		return nil, ErrSCIMConflict
+	}
+
+	id := uuid.New()
+	meta, err := json.Marshal(map[string]any{"scim": scimKeyMetadata(id, w)})
+	if err != nil {
+		return nil, fmt.Errorf("create scim user key: %w", err)
+	}
+	k, err := m.insertLLMKey(keyHash, keyPrefix, w.KeyName, w.Active, meta)
+	if err != nil {
+		return nil, fmt.Errorf("create scim user key: %w", err)
+	}
+
+	now := memoryNow()
+	u := &SCIMUser{
+		ID:         id,
+		KeyID:      k.ID,
+		UserName:   w.UserName,
+		ExternalID: w.ExternalID,
+		Active:     w.Active,
+		Resource:   slices.Clone(w.Resource),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	m.scimUsers[id] = u
+	c := m.scimUser(u)
+	return &c, nil
+}
+
+func (m *Memory) ReplaceSCIMUser(ctx context.Context, id uuid.UUID, w *SCIMUserWrite) (*SCIMUser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.scimUsers[id]
+	if !ok {
+		return nil, nil
+	}
+	if m.scimUserNameTaken(w.UserName, id) {
+		return nil, ErrSCIMConflict
+	}
+
+	k := m.llmKeys[u.KeyID]
+	meta := keyMetadata(k)
+	meta["scim"] = scimKeyMetadata(id, w)
+	if err := setKeyMetadata(k, meta); err != nil {
+		return nil, fmt.Errorf("update scim user key: %w", err)
+	}
+	k.Name = w.KeyName
+	k.IsActive = w.Active
+
+	u.UserName = w.UserName
+	u.ExternalID = w.ExternalID
+	u.Active = w.Active
+	u.Resource = slices.Clone(w.Resource)
+	u.UpdatedAt = memoryNow()
+	if err := m.refreshSCIMTeams([]uuid.UUID{id}); err != nil {
+		return nil, err
+	}
+	c := m.scimUser(u)
+	return &c, nil
+}
+
+func (m *Memory) DeleteSCIMUser(ctx context.Context, id uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.scimUsers[id]
+	if !ok {
+		return false, nil
+	}
+	delete(m.scimUsers, id)
+	for _, members := range m.scimMembers {
+		delete(members, id)
+	}
+	k := m.llmKeys[u.KeyID]
+	k.IsActive = false
+	k.UpdatedAt = memoryNow()
+	return true, nil
+}
+
+func (m *Memory) ListSCIMGroups(ctx context.Context, f SCIMFilter, offset, limit int) ([]SCIMGroup, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matched []*SCIMGroup
+	for _, g := range m.scimGroups {
+		if scimMatches(f, g.DisplayName, g.ExternalID) {
+			matched = append(matched, g)
+		}
+	}
+	slices.SortFunc(matched, func(a, b *SCIMGroup) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return compareUUID(a.ID, b.ID)
+	})
+
+	groups := []SCIMGroup{}
+	for _, g := range window(matched, offset, limit) {
+		groups = append(groups, m.scimGroup(g))
+	}
+	return groups, len(matched), nil
+}
+
+func (m *Memory) GetSCIMGroup(ctx context.Context, id uuid.UUID) (*SCIMGroup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	g, ok := m.scimGroups[id]
+	if !ok {
+		return nil, nil
+	}
+	c := m.scimGroup(g)
+	return &c, nil
+}
+
+func (m *Memory) CreateSCIMGroup(ctx context.Context, w *SCIMGroupWrite) (*SCIMGroup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.scimGroupNameTaken(w.DisplayName, uuid.Nil) {
+		return nil, ErrSCIMConflict
+	}
+	now := memoryNow()
+	g := &SCIMGroup{
+		ID:          uuid.New(),
+		DisplayName: w.DisplayName,
+		ExternalID:  w.ExternalID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	m.scimGroups[g.ID] = g
+	if err := m.setSCIMMembers(g.ID, w.Members); err != nil {
+		return nil, err
+	}
+	c := m.scimGroup(g)
+	return &c, nil
+}
+
+func (m *Memory) ReplaceSCIMGroup(ctx context.Context, id uuid.UUID, w *SCIMGroupWrite) (*SCIMGroup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, ok := m.scimGroups[id]
+	if !ok {
+		return nil, nil
+	}
+	if m.scimGroupNameTaken(w.DisplayName, id) {
+		return nil, ErrSCIMConflict
+	}
+	g.DisplayName = w.DisplayName
+	g.ExternalID = w.ExternalID
+	g.UpdatedAt = memoryNow()
+	if err := m.setSCIMMembers(id, w.Members); err != nil {
+		return nil, err
+	}
+	c := m.scimGroup(g)
+	return &c, nil
+}
+
+// setSCIMMembers makes the existing users among members the only members
+// of a group, refreshing the teams of everyone who joined, left or
+// stayed. m.mu must be held.
+func (m *Memory) setSCIMMembers(group uuid.UUID, members []uuid.UUID) error {
+	var affected []uuid.UUID
+	for id := range m.scimMembers[group] {
+		affected = append(affected, id)
+	}
+	set := make(map[uuid.UUID]bool)
+	for _, id := range members {
+		if _, ok := m.scimUsers[id]; ok {
+			set[id] = true
+		}
+	}
+	if len(set) > 0 {
+		m.scimMembers[group] = set
+	} else {
+		delete(m.scimMembers, group)
+	}
+	return m.refreshSCIMTeams(append(affected, members...))
+}
+
+func (m *Memory) DeleteSCIMGroup(ctx context.Context, id uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.scimGroups[id]; !ok {
+		return false, nil
+	}
+	delete(m.scimGroups, id)
+	if err := m.setSCIMMembers(id, nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,182 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// cloneTeam copies a team with its current key count. m.mu must be held.
+func (m *Memory) cloneTeam(t *Team) Team {
+	c := *t
+	c.AllowedModels = slices.Clone(t.AllowedModels)
+	c.DailyBudget = clonePtr(t.DailyBudget)
+	c.MonthlyBudget = clonePtr(t.MonthlyBudget)
+	c.KeyCount = 0
+	for _, k := range m.llmKeys {
+		if k.TeamID != nil && *k.TeamID == t.ID {
+			c.KeyCount++
+		}
+	}
+	return c
+}
+
+func (m *Memory) ListTeams(ctx context.Context) ([]Team, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	teams := make([]Team, 0, len(m.teams))
+	for _, t := range m.teams {
+		teams = append(teams, m.cloneTeam(t))
+	}
+	slices.SortFunc(teams, func(a, b Team) int { return strings.Compare(a.Name, b.Name) })
+	return teams, nil
+}
+
+func (m *Memory) GetTeam(ctx context.Context, id uuid.UUID) (*Team, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.teams[id]
+	if !ok {
+		return nil, nil
+	}
+	c := m.cloneTeam(t)
+	return &c, nil
+}
+
+// teamNameTaken reports whether a team other than id is named name,
+// case-insensitively. m.mu must be held.
+func (m *Memory) teamNameTaken(name string, id uuid.UUID) bool {
+	for _, t := range m.teams {
+		if strings.EqualFold(t.Name, name) && t.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) CreateTeam(ctx context.Context, tc *TeamCreate) (*Team, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.teamNameTaken(tc.Name, uuid.Nil) {
+		return nil, fmt.Errorf("create team: team name %q already exists", tc.Name)
+	}
+	now := memoryNow()
+	t := &Team{
+		ID:        uuid.New(),
+		Name:      tc.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if len(tc.AllowedModels) > 0 { // stored as NULL when empty
+		t.AllowedModels = slices.Clone(tc.AllowedModels)
+	}
+	m.teams[t.ID] = t
+	c := m.cloneTeam(t)
+	return &c, nil
+}
+
+func (m *Memory) UpdateTeam(ctx context.Context, id uuid.UUID, upd *TeamUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.teams[id]
+	if !ok || *upd == (TeamUpdate{}) {
+		return nil
+	}
+	if upd.Name != nil && m.teamNameTaken(*upd.Name, id) {
+		return fmt.Errorf("update team: team name %q already exists", *upd.Name)
+	}
+	if upd.Name != nil {
+		t.Name = *upd.Name
+	}
+	if upd.AllowedModels != nil {
+		t.AllowedModels = nil
+		if len(*upd.AllowedModels) > 0 {
+			t.AllowedModels = slices.Clone(*upd.AllowedModels)
+		}
+	}
+	t.UpdatedAt = memoryNow()
+	return nil
+}
+
+func (m *Memory) DeleteTeam(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.teams[id]; !ok {
+		return nil
+	}
+	delete(m.teams, id)
+	for _, k := range m.llmKeys {
+		if k.TeamID != nil && *k.TeamID == id {
+			k.TeamID = nil
+		}
+	}
+	return nil
+}
+
+func (m *Memory) SetTeamBudgets(ctx context.Context, id uuid.UUID, daily, monthly *float64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.teams[id]
+	if !ok {
+		return false, nil
+	}
+	t.DailyBudget, t.MonthlyBudget = clonePtr(daily), clonePtr(monthly)
+	t.UpdatedAt = memoryNow()
+	return true, nil
+}
+
+func (m *Memory) SetLLMKeyTeam(ctx context.Context, keyID uuid.UUID, teamID *uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.llmKeys[keyID]
+	if !ok {
+		return false, nil
+	}
+	if teamID != nil {
+		if _, ok := m.teams[*teamID]; !ok {
+			return false, fmt.Errorf("set llm key team: team %s does not exist", *teamID)
+		}
+	}
+	k.TeamID = clonePtr(teamID)
+	k.UpdatedAt = memoryNow()
+	return true, nil
+}
+
+func (m *Memory) GetStatsByTeam(ctx context.Context, period string) ([]TeamStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	teamOf := func(l *memoryLog) *uuid.UUID {
+		if k, ok := m.llmKeys[*l.KeyID]; ok {
+			return k.TeamID
+		}
+		return nil
+	}
+	logs := m.logsSince(period, func(l *memoryLog) bool { return teamOf(l) != nil })
+	ids, groups := groupLogs(logs, func(l *memoryLog) uuid.UUID { return *teamOf(l) })
+
+	stats := make([]TeamStats, 0, len(ids))
+	for _, id := range ids {
+		keys := map[uuid.UUID]bool{}
+		for _, l := range logs {
+			if *teamOf(l) == id {
+				keys[*l.KeyID] = true
+			}
+		}
+		a := groups[id]
+		stats = append(stats, TeamStats{
+			TeamID:            id,
+			TeamName:          m.teams[id].Name,
+			Keys:              len(keys),
+			TotalRequests:     a.requests,
+			TotalInputTokens:  a.inputTokens,
+			TotalOutputTokens: a.outputTokens,
+			TotalCost:         a.cost,
+		})
+	}
+	slices.SortStableFunc(stats, func(a, b TeamStats) int { return cmp.Compare(b.TotalCost, a.TotalCost) })
+	return stats, nil
+}
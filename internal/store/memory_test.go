@@ -0,0 +1,522 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMemoryUpstreamsAndModels(t *testing.T) {
+	s := NewMemory()
+	ctx := context.Background()
+
+	primary, err := s.CreateUpstream(ctx, &UpstreamCreate{Name: "primary", BaseURL: "https://a.example", APIKey: "sk-a", Priority: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primary.Format != "openai" || !primary.IsActive {
+		t.Fatalf("expected schema defaults, got %+v", primary)
+	}
+	secondary, err := s.CreateUpstream(ctx, &UpstreamCreate{Name: "secondary", BaseURL: "https://b.example", Format: "anthropic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateUpstream(ctx, secondary.ID, &UpstreamUpdate{Priority: ptr(20)}); err != nil {
+		t.Fatal(err)
+	}
+
+	ups, total, err := s.ListUpstreamsFiltered(ctx, UpstreamFilter{Sort: "-priority", Page: 1, PerPage: 1})
+	if err != nil || total != 2 || len(ups) != 1 || ups[0].Name != "secondary" {
+		t.Fatalf("unexpected page: total=%d ups=%+v err=%v", total, ups, err)
+	}
+	if _, total, _ := s.ListUpstreamsFiltered(ctx, UpstreamFilter{Search: ptr("B.EXAMPLE")}); total != 1 {
+		t.Fatalf("expected a case-insensitive search match, got %d", total)
+	}
+	if _, _, err := s.ListUpstreamsFiltered(ctx, UpstreamFilter{Sort: "api_key_encrypted"}); !errors.Is(err, ErrInvalidSort) {
+		t.Fatalf("expected ErrInvalidSort, got %v", err)
+	}
+
+	model, err := s.CreateModel(ctx, &ModelCreate{Name: "gpt-test", Provider: "openai", UpstreamID: &primary.ID, Aliases: []string{"default"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateModel(ctx, &ModelCreate{Name: "GPT-TEST", Provider: "openai"}); err == nil {
+		t.Fatal("expected model names to be unique regardless of case")
+	}
+	if _, err := s.CreateModel(ctx, &ModelCreate{Name: "orphan", Provider: "openai", UpstreamID: ptr(uuid.New())}); err == nil {
+		t.Fatal("expected an unknown upstream to be rejected")
+	}
+	if conflict, err := s.ModelNameConflict(ctx, []string{"DEFAULT"}, nil); err != nil || conflict != "gpt-test" {
+		t.Fatalf("expected alias conflict with gpt-test, got %q, %v", conflict, err)
+	}
+
+	mw, err := s.GetModelWithUpstream(ctx, "default")
+	if err != nil || mw == nil || mw.UpstreamAPIKey != "sk-a" {
+		t.Fatalf("resolve by alias: %+v, %v", mw, err)
+	}
+	if err := s.UpdateModel(ctx, model.ID, &ModelUpdate{IsActive: ptr(false)}); err != nil {
+		t.Fatal(err)
+	}
+	if mw, err := s.GetModelWithUpstream(ctx, "gpt-test"); err != nil || mw != nil {
+		t.Fatalf("expected inactive model to be unresolvable, got %+v, %v", mw, err)
+	}
+
+	// Deleting an upstream unlinks its models.
+	if err := s.DeleteUpstream(ctx, primary.ID); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := s.GetModel(ctx, model.ID); err != nil || m == nil || m.UpstreamID != nil {
+		t.Fatalf("expected model to be unlinked, got %+v, %v", m, err)
+	}
+}
+
+func TestMemoryWildcardAliases(t *testing.T) {
+	testWildcardAliases(t, NewMemory())
+}
+
+// testWildcardAliases checks how names, aliases and wildcard aliases are
+// ranked, for both stores.
+func testWildcardAliases(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+	up, err := s.CreateUpstream(ctx, &UpstreamCreate{Name: "up", BaseURL: "https://a.example", APIKey: "sk-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mc := range []*ModelCreate{
+		{Name: "claude-3-5-sonnet-20241022", Aliases: []string{"claude-3-5-*"}},
+		{Name: "claude-3-5-haiku-20241022", Aliases: []string{"claude-3-5-haiku*", "claude-3-5-latest"}},
+		{Name: "gpt-4o-2024-11-20", Aliases: []string{"gpt-4", "gpt_4?-*"}},
+	} {
+		mc.Provider, mc.UpstreamID = "openai", &up.ID
+		if _, err := s.CreateModel(ctx, mc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]string{
+		"gpt-4":                      "gpt-4o-2024-11-20",
+		"claude-3-5-sonnet-latest":   "claude-3-5-sonnet-20241022",
+		"CLAUDE-3-5-HAIKU-LATEST":    "claude-3-5-haiku-20241022", // the longer pattern wins
+		"claude-3-5-latest":          "claude-3-5-haiku-20241022", // an alias wins over patterns
+		"claude-3-5-sonnet-20241022": "claude-3-5-sonnet-20241022",
+		"gpt_4?-mini":                "gpt-4o-2024-11-20",
+		"gpt-4o-mini":                "", // "_" and "?" are not wildcards
+		"claude-3-7-sonnet":          "",
+	} {
+		mw, err := s.GetModelWithUpstream(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if mw != nil {
+			got = mw.Name
+		}
+		if got != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+		m, err := s.GetModelByName(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (m == nil && want != "") || (m != nil && m.Name != want) {
+			t.Errorf("%s: expected GetModelByName to find %q, got %+v", name, want, m)
+		}
+	}
+}
+
+func TestMemoryModelFallbacks(t *testing.T) {
+	s := NewMemory()
+	ctx := context.Background()
+
+	var ids []uuid.UUID
+	for i, name := range []string{"primary", "low", "high", "off"} {
+		u, err := s.CreateUpstream(ctx, &UpstreamCreate{Name: name, BaseURL: "https://" + name + ".example", Priority: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, u.ID)
+	}
+	if err := s.UpdateUpstream(ctx, ids[3], &UpstreamUpdate{IsActive: ptr(false)}); err != nil {
+		t.Fatal(err)
+	}
+	// The model's own upstream and inactive ones are never fallbacks, and
+	// the rest are tried highest priority first.
+	if _, err := s.CreateModel(ctx, &ModelCreate{Name: "m", Provider: "openai", UpstreamID: &ids[0], FallbackUpstreamIDs: ids}); err != nil {
+		t.Fatal(err)
+	}
+	mw, err := s.GetModelWithUpstream(ctx, "m")
+	if err != nil || mw == nil || len(mw.Fallbacks) != 2 || mw.Fallbacks[0].Name != "high" || mw.Fallbacks[1].Name != "low" {
+		t.Fatalf("expected fallbacks high, low; got %+v, %v", mw, err)
+	}
+
+	// Deleting an upstream drops it from fallback lists.
+	if err := s.DeleteUpstream(ctx, ids[2]); err != nil {
+		t.Fatal(err)
+	}
+	m, err := s.GetModelByName(ctx, "m")
+	if err != nil || len(m.FallbackUpstreamIDs) != 3 || slices.Contains(m.FallbackUpstreamIDs, ids[2]) {
+		t.Fatalf("expected the deleted upstream to be dropped, got %+v, %v", m, err)
+	}
+}
+
+func TestMemoryReturnsCopies(t *testing.T) {
+	s := NewMemory()
+	ctx := context.Background()
+
+	k, err := s.CreateLLMKey(ctx, "hash", "pxb_abc", "ci", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateLLMKey(ctx, "hash", "pxb_def", "dup", nil); err == nil {
+		t.Fatal("expected key hashes to be unique")
+	}
+	k.Name = "changed"
+	got, err := s.GetLLMKeyByHash(ctx, "hash")
+	if err != nil || got == nil || got.Name != "ci" {
+		t.Fatalf("store was changed through a returned key: %+v, %v", got, err)
+	}
+	if missing, err := s.GetLLMKey(ctx, uuid.New()); err != nil || missing != nil {
+		t.Fatalf("expected nil for an unknown key, got %+v, %v", missing, err)
+	}
+}
+
+func TestMemoryLogsAndStats(t *testing.T) {
+	s := NewMemory()
+	ctx := context.Background()
+
+	key, err := s.CreateLLMKey(ctx, "hash", "pxb_log", "logger", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	entries := []*LogEntry{
+		{KeyID: key.ID, Timestamp: now, Model: "claude-a", InputFormat: "anthropic", StatusCode: 200, LatencyMS: 100, InputTokens: 1000, CacheReadTokens: 1000, ToolCalls: 3, Cost: 0.01},
+		{KeyID: key.ID, Timestamp: now, Model: "claude-a", InputFormat: "anthropic", StatusCode: 200, LatencyMS: 300, InputTokens: 3000, Cost: 0.03},
+		{KeyID: key.ID, Timestamp: now, Model: "gpt-b", InputFormat: "openai", StatusCode: 502, LatencyMS: 50, ErrorMessage: "upstream down"},
+		{KeyID: key.ID, Timestamp: now.Add(-48 * time.Hour), Model: "claude-a", InputFormat: "anthropic", StatusCode: 200, LatencyMS: 10, Cost: 1},
+	}
+	if err := s.InsertLogBatch(ctx, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	logs, total, err := s.ListLogs(ctx, LogFilter{StatusCode: ptr(500)})
+	if err != nil || total != 1 || *logs[0].ErrorMessage != "upstream down" {
+		t.Fatalf("status class filter: total=%d err=%v", total, err)
+	}
+	if logs[0].Region != nil {
+		t.Fatalf("expected an empty region to be stored as nil, got %q", *logs[0].Region)
+	}
+	logs, total, _ = s.ListLogs(ctx, LogFilter{Model: ptr("CLAUDE"), PerPage: 2})
+	if total != 3 || len(logs) != 2 || logs[1].Timestamp.Before(now) {
+		t.Fatalf("expected the 2 newest of 3 claude logs, got total=%d logs=%+v", total, logs)
+	}
+
+	overview, err := s.GetOverviewStats(ctx, "24h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overview.TotalRequests != 3 || overview.ErrorCount != 1 || overview.AvgLatencyMS != 150 || overview.CacheHitRate != 0.2 {
+		t.Fatalf("unexpected overview: %+v", overview)
+	}
+	if week, _ := s.GetOverviewStats(ctx, "7d"); week.TotalRequests != 4 {
+		t.Fatalf("expected 4 requests in 7d, got %d", week.TotalRequests)
+	}
+
+	byModel, err := s.GetStatsByModel(ctx, "24h")
+	if err != nil || len(byModel) != 2 || byModel[0].Model != "claude-a" || byModel[0].AvgToolCalls != 1.5 || byModel[0].ToolCallRate != 0.5 {
+		t.Fatalf("by model: %+v, %v", byModel, err)
+	}
+	latency, err := s.GetLatencyPercentiles(ctx, "24h")
+	if err != nil || latency.P50 != 100 || latency.P95 != 280 {
+		t.Fatalf("latency percentiles: %+v, %v", latency, err)
+	}
+
+	usage, err := s.GetKeyUsage(ctx, key.ID, "24h", "1h", 10)
+	if err != nil || usage.Totals.TotalRequests != 3 || len(usage.RecentErrors) != 1 || usage.RequestsLastMinute != 3 {
+		t.Fatalf("unexpected key usage: %+v, %v", usage, err)
+	}
+
+	if err := s.InsertLog(ctx, &LogEntry{KeyID: key.ID, Timestamp: now, Model: "gpt-b", InputFormat: "openai", StatusCode: 403, ErrorCode: "provider_region_unsupported"}); err != nil {
+		t.Fatal(err)
+	}
+	providerErrors, err := s.GetProviderErrorStats(ctx, "24h")
+	if err != nil || len(providerErrors) != 1 || providerErrors[0].ErrorCode != "provider_region_unsupported" || providerErrors[0].Model != "gpt-b" || providerErrors[0].Requests != 1 {
+		t.Fatalf("provider errors: %+v, %v", providerErrors, err)
+	}
+
+	if deleted, err := s.DeleteOldLogs(ctx, now.Add(-24*time.Hour)); err != nil || deleted != 1 {
+		t.Fatalf("delete old logs: deleted=%d err=%v", deleted, err)
+	}
+}
+
+func TestMemoryTeams(t *testing.T) {
+	s := NewMemory()
+	ctx := context.Background()
+
+	team, err := s.CreateTeam(ctx, &TeamCreate{Name: "Research", AllowedModels: []string{"claude-*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateTeam(ctx, &TeamCreate{Name: "research"}); err == nil {
+		t.Fatal("expected team names to be unique, ignoring case")
+	}
+	daily := 10.0
+	if found, err := s.SetTeamBudgets(ctx, team.ID, &daily, nil); !found || err != nil {
+		t.Fatalf("set team budgets: %v %v", found, err)
+	}
+
+	member, _ := s.CreateLLMKey(ctx, "hash-member", "pxb_member", "member", nil)
+	other, _ := s.CreateLLMKey(ctx, "hash-other", "pxb_other", "other", nil)
+	if _, err := s.SetLLMKeyTeam(ctx, member.ID, ptr(uuid.New())); err == nil {
+		t.Fatal("expected an unknown team to be rejected")
+	}
+	if found, err := s.SetLLMKeyTeam(ctx, member.ID, &team.ID); !found || err != nil {
+		t.Fatalf("set key team: %v %v", found, err)
+	}
+
+	// The member inherits the team's allowlist and daily budget, and keeps
+	// its own monthly budget.
+	monthly := 50.0
+	s.SetLLMKeyBudgets(ctx, member.ID, nil, &monthly)
+	k, _ := s.GetLLMKeyByHash(ctx, "hash-member")
+	if k.Team == nil || k.Team.Name != "Research" || k.AllowsModel("gpt-4o") || !k.AllowsModel("claude-sonnet") {
+		t.Fatalf("expected the team's allowlist to apply, got %+v", k.Team)
+	}
+	if d, m := k.Budgets(); d == nil || *d != 10 || m == nil || *m != 50 {
+		t.Fatalf("expected the team's daily and the key's monthly budget, got %v %v", d, m)
+	}
+	models := []string{"gpt-*"}
+	s.UpdateLLMKey(ctx, member.ID, LLMKeyUpdate{AllowedModels: &models})
+	if k, _ = s.GetLLMKey(ctx, member.ID); !k.AllowsModel("gpt-4o") || k.AllowsModel("claude-sonnet") {
+		t.Fatal("expected the key's own allowlist to override the team's")
+	}
+	spend, _ := s.ListBudgetedKeySpend(ctx, time.Now(), time.Now())
+	if _, ok := spend[member.ID]; !ok || len(spend) != 1 {
+		t.Fatalf("expected only the member to be budgeted, got %v", spend)
+	}
+
+	now := time.Now()
+	s.InsertLogBatch(ctx, []*LogEntry{
+		{KeyID: member.ID, Timestamp: now, Model: "gpt-4o", StatusCode: 200, InputTokens: 100, OutputTokens: 10, Cost: 0.5},
+		{KeyID: member.ID, Timestamp: now, Model: "gpt-4o", StatusCode: 200, InputTokens: 200, OutputTokens: 20, Cost: 0.25},
+		{KeyID: other.ID, Timestamp: now, Model: "gpt-4o", StatusCode: 200, InputTokens: 1000, Cost: 5},
+	})
+	stats, err := s.GetStatsByTeam(ctx, "24h")
+	if err != nil || len(stats) != 1 || stats[0].TeamName != "Research" || stats[0].Keys != 1 ||
+		stats[0].TotalRequests != 2 || stats[0].TotalInputTokens != 300 || stats[0].TotalOutputTokens != 30 || stats[0].TotalCost != 0.75 {
+		t.Fatalf("team stats: %+v, %v", stats, err)
+	}
+
+	if got, _ := s.GetTeam(ctx, team.ID); got.KeyCount != 1 {
+		t.Fatalf("expected 1 key in the team, got %d", got.KeyCount)
+	}
+	if err := s.DeleteTeam(ctx, team.ID); err != nil {
+		t.Fatal(err)
+	}
+	if k, _ = s.GetLLMKey(ctx, member.ID); k.TeamID != nil || k.Team != nil {
+		t.Fatal("expected deleting the team to leave its keys without one")
+	}
+}
+
+func TestMemoryPolicyCanary(t *testing.T) {
+	s := NewMemory()
+	ctx := context.Background()
+
+	if _, err := s.CreatePolicy(ctx, &PolicyCreate{Name: "old", Expression: "true", Action: "allow"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreatePolicy(ctx, &PolicyCreate{Name: "old", Expression: "true", Action: "deny"}); err == nil {
+		t.Fatal("expected policy names to be unique")
+	}
+
+	c, err := s.CreatePolicyCanary(ctx, &PolicyCanaryCreate{Name: "v2", Percent: 10, Policies: []PolicyCreate{
+		{Name: "cap", Expression: "true", Action: "cap", MaxTokens: ptr(1024)},
+		{Name: "deny", Expression: "false", Action: "deny", Priority: 5},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Status != CanaryRunning || c.MinRequests != 100 || c.MaxErrorRateDelta != 0.05 {
+		t.Fatalf("expected schema defaults, got %+v", c)
+	}
+	if _, err := s.CreatePolicyCanary(ctx, &PolicyCanaryCreate{Name: "v3"}); err == nil {
+		t.Fatal("expected a second running canary to be rejected")
+	}
+
+	key, _ := s.CreateLLMKey(ctx, "hash", "pxb_can", "canary", nil)
+	s.InsertLogBatch(ctx, []*LogEntry{
+		{KeyID: key.ID, Timestamp: time.Now(), StatusCode: 200, LatencyMS: 100, CanaryID: &c.ID, CanaryArm: CanaryArmStable},
+		{KeyID: key.ID, Timestamp: time.Now(), StatusCode: 503, LatencyMS: 300, CanaryID: &c.ID, CanaryArm: CanaryArmCanary},
+		{KeyID: key.ID, Timestamp: time.Now(), StatusCode: 200, LatencyMS: 100, CanaryID: &c.ID, CanaryArm: CanaryArmCanary},
+	})
+	stats, err := s.PolicyCanaryStats(ctx, c.ID)
+	if err != nil || stats.Stable.Requests != 1 || stats.Canary.ErrorRate != 0.5 || stats.Canary.AvgLatencyMS != 200 {
+		t.Fatalf("unexpected canary stats: %+v, %v", stats, err)
+	}
+
+	if ok, err := s.PromotePolicyCanary(ctx, c.ID); err != nil || !ok {
+		t.Fatalf("promote: %v, %v", ok, err)
+	}
+	if ok, _ := s.RollBackPolicyCanary(ctx, c.ID, "too late"); ok {
+		t.Fatal("expected a promoted canary not to roll back")
+	}
+	policies, err := s.ListPolicies(ctx)
+	if err != nil || len(policies) != 2 || policies[0].Name != "deny" || policies[1].Name != "cap" {
+		t.Fatalf("expected the canary's policies in evaluation order, got %+v, %v", policies, err)
+	}
+}
+
+func TestMemorySCIM(t *testing.T) {
+	s := NewMemory()
+	ctx := context.Background()
+
+	write := &SCIMUserWrite{
+		UserName: "ada@example.com", Active: true, KeyName: "Ada",
+		Resource: []byte(`{"userName":"ada@example.com"}`),
+		Metadata: map[string]any{"department": "R&D"},
+	}
+	user, err := s.CreateSCIMUser(ctx, write, "scim-hash", "pxb_scim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.KeyPrefix != "pxb_scim" || len(user.Groups) != 0 {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	if _, err := s.CreateSCIMUser(ctx, &SCIMUserWrite{UserName: "ADA@example.com", KeyName: "dup"}, "scim-hash-2", "pxb_dup"); !errors.Is(err, ErrSCIMConflict) {
+		t.Fatalf("expected ErrSCIMConflict, got %v", err)
+	}
+
+	group, err := s.CreateSCIMGroup(ctx, &SCIMGroupWrite{DisplayName: "ml", Members: []uuid.UUID{user.ID, uuid.New()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(group.Members) != 1 || group.Members[0].Display != "ada@example.com" {
+		t.Fatalf("unexpected members: %+v", group.Members)
+	}
+
+	key, err := s.GetLLMKey(ctx, user.KeyID)
+	if err != nil || key == nil || !key.IsActive || key.Name != "Ada" {
+		t.Fatalf("unexpected key: %+v, %v", key, err)
+	}
+	var meta struct {
+		SCIM struct {
+			Department string   `json:"department"`
+			Teams      []string `json:"teams"`
+		} `json:"scim"`
+	}
+	if err := json.Unmarshal(key.Metadata, &meta); err != nil || meta.SCIM.Department != "R&D" || len(meta.SCIM.Teams) != 1 || meta.SCIM.Teams[0] != "ml" {
+		t.Fatalf("unexpected key metadata: %s, %v", key.Metadata, err)
+	}
+
+	write.Active = false
+	if user, err = s.ReplaceSCIMUser(ctx, user.ID, write); err != nil || user.Active || len(user.Groups) != 1 {
+		t.Fatalf("unexpected user: %+v, %v", user, err)
+	}
+	if ok, err := s.DeleteSCIMGroup(ctx, group.ID); err != nil || !ok {
+		t.Fatalf("delete group: %v, %v", ok, err)
+	}
+	key, _ = s.GetLLMKey(ctx, user.KeyID)
+	if key.IsActive || strings.Contains(string(key.Metadata), `"ml"`) {
+		t.Fatalf("unexpected key after deactivation and group deletion: %+v", key)
+	}
+
+	if ok, err := s.DeleteSCIMUser(ctx, user.ID); err != nil || !ok {
+		t.Fatalf("delete user: %v, %v", ok, err)
+	}
+	if users, total, err := s.ListSCIMUsers(ctx, SCIMFilter{}, 0, 10); err != nil || total != 0 || users == nil {
+		t.Fatalf("expected an empty user list, got %+v, %d, %v", users, total, err)
+	}
+}
+
+func TestMemoryAuditSamples(t *testing.T) {
+	s := NewMemory()
+	ctx := context.Background()
+	key, _ := s.CreateLLMKey(ctx, "hash", "pxb_aud", "audited", nil)
+
+	rule, err := s.SetAuditRule(ctx, &AuditRuleCreate{KeyID: &key.ID, Model: "gpt-4o", Percent: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := s.SetAuditRule(ctx, &AuditRuleCreate{KeyID: &key.ID, Model: "GPT-4o", Percent: 25})
+	if err != nil || again.ID != rule.ID || again.Percent != 25 {
+		t.Fatalf("expected the rule for the same key and model to be replaced, got %+v, %v", again, err)
+	}
+	missing := uuid.New()
+	if _, err := s.SetAuditRule(ctx, &AuditRuleCreate{KeyID: &missing, Percent: 5}); err == nil {
+		t.Fatal("expected a rule for a missing key to be rejected")
+	}
+
+	s.InsertLogBatch(ctx, []*LogEntry{
+		{KeyID: key.ID, Timestamp: time.Now(), Model: "gpt-4o", StatusCode: 200},
+		{KeyID: key.ID, Timestamp: time.Now(), Model: "gpt-4o", StatusCode: 200, AuditSample: &AuditSample{
+			RuleID: &rule.ID, Percent: 25, KeyID: &key.ID, Model: "gpt-4o", StatusCode: 200,
+			Request: `{"model":"gpt-4o"}`, Response: `{"id":"x"}`, RequestBytes: 18, ResponseBytes: 10,
+		}},
+	})
+	samples, total, err := s.ListAuditSamples(ctx, AuditSampleFilter{RuleID: &rule.ID})
+	if err != nil || total != 1 || samples[0].Request != "" {
+		t.Fatalf("expected one sample listed without its bodies, got %+v, %d, %v", samples, total, err)
+	}
+
+	viewer := uuid.New()
+	s.ViewAuditSample(ctx, samples[0].ID, viewer)
+	sample, views, err := s.ViewAuditSample(ctx, samples[0].ID, viewer)
+	if err != nil || sample.Request != `{"model":"gpt-4o"}` || len(views) != 2 || views[0].ManagementKeyID != viewer {
+		t.Fatalf("expected the bodies and both views, got %+v, %+v, %v", sample, views, err)
+	}
+
+	if ok, err := s.DeleteAuditRule(ctx, rule.ID); err != nil || !ok {
+		t.Fatalf("delete rule: %v, %v", ok, err)
+	}
+	if _, total, _ := s.ListAuditSamples(ctx, AuditSampleFilter{KeyID: &key.ID}); total != 1 {
+		t.Fatal("expected samples to outlive their rule")
+	}
+	if n, _ := s.DeleteOldAuditSamples(ctx, time.Now().Add(time.Hour)); n != 1 {
+		t.Fatalf("expected the sample to be cleaned up, deleted %d", n)
+	}
+}
+
+func TestMemoryGuardrails(t *testing.T) {
+	s := NewMemory()
+	ctx := context.Background()
+	key, _ := s.CreateLLMKey(ctx, "hash", "pxb_grd", "guarded", nil)
+
+	g, err := s.CreateGuardrail(ctx, &GuardrailCreate{Name: "pii", Kind: "pii", Stage: "both", Mode: "flag", KeyID: &key.ID})
+	if err != nil || !g.IsActive || g.Patterns == nil || g.Entities == nil {
+		t.Fatalf("expected an active guardrail with empty lists, got %+v, %v", g, err)
+	}
+	if _, err := s.CreateGuardrail(ctx, &GuardrailCreate{Name: "pii", Kind: "regex"}); err == nil {
+		t.Fatal("expected a duplicate name to be rejected")
+	}
+	missing := uuid.New()
+	if _, err := s.CreateGuardrail(ctx, &GuardrailCreate{Name: "other", Kind: "pii", KeyID: &missing}); err == nil {
+		t.Fatal("expected a guardrail for a missing key to be rejected")
+	}
+	if _, err := s.CreateGuardrail(ctx, &GuardrailCreate{Name: "all", Kind: "regex", Patterns: []string{"x"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	entities := []string{"email"}
+	if err := s.UpdateGuardrail(ctx, g.ID, &GuardrailUpdate{Entities: &entities}); err != nil {
+		t.Fatal(err)
+	}
+	entities[0] = "ssn"
+	list, _ := s.ListGuardrails(ctx)
+	if len(list) != 2 || list[0].Name != "all" || list[1].Entities[0] != "email" {
+		t.Fatalf("expected the guardrail for every key first and the update kept, got %+v", list)
+	}
+
+	if ok, err := s.DeleteGuardrail(ctx, g.ID); err != nil || !ok {
+		t.Fatalf("delete guardrail: %v, %v", ok, err)
+	}
+	if ok, _ := s.DeleteGuardrail(ctx, g.ID); ok {
+		t.Fatal("expected a second delete to find nothing")
+	}
+}
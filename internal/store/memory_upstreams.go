@@ -0,0 +1,749 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func cloneUpstream(u *Upstream) Upstream {
+	c := *u
+	c.Availability = slices.Clone(u.Availability)
+	c.RoleMap = maps.Clone(u.RoleMap)
+	c.ServiceTiers = maps.Clone(u.ServiceTiers)
+	return c
+}
+
+// nullIfEmpty mirrors NULLIF on an empty string: nil for an empty or nil
+// string.
+func nullIfEmpty(s *string) *string {
+	if s == nil || *s == "" {
+		return nil
+	}
+	v := *s
+	return &v
+}
+
+// nullIfZero mirrors NULLIF(x, 0).
+func nullIfZero(n *int) *int {
+	if n == nil || *n == 0 {
+		return nil
+	}
+	v := *n
+	return &v
+}
+
+func compareUpstreamsByPriority(a, b Upstream) int {
+	if c := cmp.Compare(b.Priority, a.Priority); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Name, b.Name)
+}
+
+func (m *Memory) ListUpstreams(ctx context.Context) ([]Upstream, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var upstreams []Upstream
+	for _, u := range m.upstreams {
+		upstreams = append(upstreams, cloneUpstream(u))
+	}
+	slices.SortStableFunc(upstreams, func(a, b Upstream) int {
+		if c := compareUpstreamsByPriority(a, b); c != 0 {
+			return c
+		}
+		return compareUUID(a.ID, b.ID)
+	})
+	return upstreams, nil
+}
+
+var upstreamSortFields = map[string]func(a, b Upstream) int{
+	"name":       func(a, b Upstream) int { return strings.Compare(a.Name, b.Name) },
+	"created_at": func(a, b Upstream) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"priority":   func(a, b Upstream) int { return cmp.Compare(a.Priority, b.Priority) },
+}
+
+func (m *Memory) ListUpstreamsFiltered(ctx context.Context, filter UpstreamFilter) ([]Upstream, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	matched := make([]Upstream, 0)
+	for _, u := range m.upstreams {
+		if filter.Format != nil && u.Format != *filter.Format {
+			continue
+		}
+		if filter.IsActive != nil && u.IsActive != *filter.IsActive {
+			continue
+		}
+		if filter.Search != nil && !containsFold(u.Name, *filter.Search) && !containsFold(u.BaseURL, *filter.Search) {
+			continue
+		}
+		matched = append(matched, cloneUpstream(u))
+	}
+	err := sortRows(matched, filter.Sort, upstreamSortFields, compareUpstreamsByPriority, func(u Upstream) uuid.UUID { return u.ID })
+	if err != nil {
+		return nil, 0, err
+	}
+	return paginate(matched, filter.Page, filter.PerPage), len(matched), nil
+}
+
+func (m *Memory) GetUpstream(ctx context.Context, id uuid.UUID) (*Upstream, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.upstreams[id]
+	if !ok {
+		return nil, nil
+	}
+	c := cloneUpstream(u)
+	return &c, nil
+}
+
+func (m *Memory) GetActiveUpstream(ctx context.Context) (*Upstream, error) {
+	upstreams, err := m.ListUpstreams(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range upstreams {
+		if u.IsActive {
+			return &u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *Memory) CreateUpstream(ctx context.Context, uc *UpstreamCreate) (*Upstream, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	format := uc.Format
+	if format == "" {
+		format = "openai"
+	}
+	now := memoryNow()
+	u := &Upstream{
+		ID:                       uuid.New(),
+		Name:                     uc.Name,
+		BaseURL:                  uc.BaseURL,
+		APIKeyEncrypted:          uc.APIKey,
+		Format:                   format,
+		IsActive:                 true,
+		Priority:                 uc.Priority,
+		Availability:             slices.Clone(uc.Availability),
+		Region:                   nullIfEmpty(uc.Region),
+		RoleMap:                  maps.Clone(uc.RoleMap),
+		MaxSSEFrameBytes:         nullIfZero(uc.MaxSSEFrameBytes),
+		StreamIdleTimeoutSeconds: nullIfZero(uc.StreamIdleTimeoutSeconds),
+		ServiceTiers:             maps.Clone(uc.ServiceTiers),
+		AutoImportModels:         uc.AutoImportModels,
+		DisableCompression:       uc.DisableCompression,
+		Extension:                nullIfEmpty(uc.Extension),
+		AnthropicBetas:           uc.AnthropicBetas,
+		Resilience:               uc.Resilience,
+		CreatedAt:                now,
+		UpdatedAt:                now,
+	}
+	m.upstreams[u.ID] = u
+	c := cloneUpstream(u)
+	return &c, nil
+}
+
+func (m *Memory) UpdateUpstream(ctx context.Context, id uuid.UUID, upd *UpstreamUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.upstreams[id]
+	if !ok {
+		return nil
+	}
+	if *upd == (UpstreamUpdate{}) {
+		return nil
+	}
+
+	if upd.Name != nil {
+		u.Name = *upd.Name
+	}
+	if upd.BaseURL != nil {
+		u.BaseURL = *upd.BaseURL
+	}
+	if upd.APIKey != nil {
+		u.APIKeyEncrypted = *upd.APIKey
+	}
+	if upd.Format != nil {
+		u.Format = *upd.Format
+	}
+	if upd.Priority != nil {
+		u.Priority = *upd.Priority
+	}
+	if upd.IsActive != nil {
+		u.IsActive = *upd.IsActive
+	}
+	if upd.Availability != nil {
+		u.Availability = slices.Clone(*upd.Availability)
+	}
+	if upd.Region != nil {
+		u.Region = nullIfEmpty(upd.Region)
+	}
+	if upd.RoleMap != nil {
+		u.RoleMap = maps.Clone(*upd.RoleMap)
+	}
+	if upd.ServiceTiers != nil {
+		u.ServiceTiers = maps.Clone(*upd.ServiceTiers)
+	}
+	if upd.MaxSSEFrameBytes != nil {
+		u.MaxSSEFrameBytes = nullIfZero(upd.MaxSSEFrameBytes)
+	}
+	if upd.StreamIdleTimeoutSeconds != nil {
+		u.StreamIdleTimeoutSeconds = nullIfZero(upd.StreamIdleTimeoutSeconds)
+	}
+	if upd.AutoImportModels != nil {
+		u.AutoImportModels = *upd.AutoImportModels
+	}
+	if upd.DisableCompression != nil {
+		u.DisableCompression = *upd.DisableCompression
+	}
+	if upd.Extension != nil {
+		u.Extension = nullIfEmpty(upd.Extension)
+	}
+	if upd.AnthropicBetas != nil {
+		betas := *upd.AnthropicBetas
+		u.AnthropicBetas = &betas
+	}
+	if upd.Resilience != nil {
+		policy := *upd.Resilience
+		u.Resilience = &policy
+	}
+	u.UpdatedAt = memoryNow()
+	return nil
+}
+
+func (m *Memory) DeleteUpstream(ctx context.Context, id uuid.UUID) error {
+	_, err := m.DeleteUpstreams(ctx, []uuid.UUID{id})
+	return err
+}
+
+// DeleteUpstreams unlinks the upstreams' models and logs and removes
+// their scores and pins along with them, as the foreign keys do.
+func (m *Memory) DeleteUpstreams(ctx context.Context, ids []uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for _, id := range ids {
+		if _, ok := m.upstreams[id]; !ok {
+			continue
+		}
+		for _, mo := range m.models {
+			if mo.UpstreamID != nil && *mo.UpstreamID == id {
+				mo.UpstreamID = nil
+			}
+			mo.FallbackUpstreamIDs = slices.DeleteFunc(mo.FallbackUpstreamIDs, func(f uuid.UUID) bool { return f == id })
+		}
+		for _, l := range m.logs {
+			if l.UpstreamID != nil && *l.UpstreamID == id {
+				l.UpstreamID = nil
+			}
+		}
+		for pid, p := range m.pins {
+			if p.UpstreamID == id {
+				delete(m.pins, pid)
+			}
+		}
+		delete(m.scores, id)
+		delete(m.upstreams, id)
+		n++
+	}
+	return n, nil
+}
+
+func (m *Memory) ListUpstreamScores(ctx context.Context) ([]UpstreamScore, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var scores []UpstreamScore
+	for _, sc := range m.scores {
+		c := *sc
+		c.LatenciesMS = slices.Clone(sc.LatenciesMS)
+		c.Successes = slices.Clone(sc.Successes)
+		scores = append(scores, c)
+	}
+	return scores, nil
+}
+
+func (m *Memory) SaveUpstreamScores(ctx context.Context, scores []UpstreamScore) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, sc := range scores {
+		if _, ok := m.upstreams[sc.UpstreamID]; !ok {
+			continue
+		}
+		c := sc
+		c.LatenciesMS = slices.Clone(sc.LatenciesMS)
+		c.Successes = slices.Clone(sc.Successes)
+		m.scores[sc.UpstreamID] = &c
+	}
+	return nil
+}
+
+func cloneModel(mo *Model) Model {
+	c := *mo
+	c.Availability = slices.Clone(mo.Availability)
+	c.Aliases = slices.Clone(mo.Aliases)
+	c.FallbackUpstreamIDs = slices.Clone(mo.FallbackUpstreamIDs)
+	return c
+}
+
+// modelMatches reports whether name is the model's name or one of its
+// aliases, case-insensitively, and whether it matched the name.
+func modelMatches(mo *Model, name string) (matched, byName bool) {
+	lower := strings.ToLower(name)
+	if strings.ToLower(mo.Name) == lower {
+		return true, true
+	}
+	return slices.Contains(mo.Aliases, lower), false
+}
+
+// findModel returns the model named name or, failing that, one aliased
+// name, or else the one whose longest wildcard alias matches name,
+// considering only models ok accepts. m.mu must be held.
+func (m *Memory) findModel(name string, ok func(*Model) bool) *Model {
+	var best *Model
+	bestRank := 0
+	for _, mo := range m.models {
+		rank := modelMatchRank(mo, name)
+		if rank == 0 || !ok(mo) {
+			continue
+		}
+		if rank > bestRank || (rank == bestRank && compareUUID(mo.ID, best.ID) < 0) {
+			best, bestRank = mo, rank
+		}
+	}
+	return best
+}
+
+// modelMatchRank orders the models matching name as the store queries do:
+// a name match, then an alias, then wildcard aliases by length. It is 0 if
+// the model does not match.
+func modelMatchRank(mo *Model, name string) int {
+	if matched, byName := modelMatches(mo, name); matched {
+		if byName {
+			return math.MaxInt
+		}
+		return math.MaxInt - 1
+	}
+	rank := 0
+	for _, a := range mo.Aliases {
+		if len(a) > rank && IsAliasPattern(a) && MatchAliasPattern(a, strings.ToLower(name)) {
+			rank = len(a)
+		}
+	}
+	return rank
+}
+
+// checkModel enforces the models table's constraints on mo, which is
+// being inserted or replaces the model with its ID. m.mu must be held.
+func (m *Memory) checkModel(mo *Model) error {
+	if mo.UpstreamID != nil {
+		if _, ok := m.upstreams[*mo.UpstreamID]; !ok {
+			return fmt.Errorf("upstream %s does not exist", *mo.UpstreamID)
+		}
+	}
+	for _, other := range m.models {
+		if other.ID != mo.ID && strings.EqualFold(other.Name, mo.Name) {
+			return fmt.Errorf("model name %q already exists", mo.Name)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) ListModels(ctx context.Context) ([]Model, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var models []Model
+	for _, mo := range m.models {
+		models = append(models, cloneModel(mo))
+	}
+	slices.SortFunc(models, func(a, b Model) int { return strings.Compare(a.Name, b.Name) })
+	return models, nil
+}
+
+var modelSortFields = map[string]func(a, b Model) int{
+	"name":       func(a, b Model) int { return strings.Compare(a.Name, b.Name) },
+	"created_at": func(a, b Model) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"cost": func(a, b Model) int {
+		return cmp.Compare(a.InputCostPerMillion+a.OutputCostPerMillion, b.InputCostPerMillion+b.OutputCostPerMillion)
+	},
+}
+
+func (m *Memory) ListModelsFiltered(ctx context.Context, filter ModelFilter) ([]Model, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	matched := make([]Model, 0)
+	for _, mo := range m.models {
+		if filter.Provider != nil && mo.Provider != *filter.Provider {
+			continue
+		}
+		if filter.UpstreamID != nil && (mo.UpstreamID == nil || *mo.UpstreamID != *filter.UpstreamID) {
+			continue
+		}
+		if filter.IsActive != nil && mo.IsActive != *filter.IsActive {
+			continue
+		}
+		if filter.Stale != nil && (mo.StaleSince != nil) != *filter.Stale {
+			continue
+		}
+		if filter.Search != nil && !containsFold(mo.Name, *filter.Search) &&
+			(mo.DisplayName == nil || !containsFold(*mo.DisplayName, *filter.Search)) {
+			continue
+		}
+		matched = append(matched, cloneModel(mo))
+	}
+	err := sortRows(matched, filter.Sort, modelSortFields, modelSortFields["name"], func(mo Model) uuid.UUID { return mo.ID })
+	if err != nil {
+		return nil, 0, err
+	}
+	return paginate(matched, filter.Page, filter.PerPage), len(matched), nil
+}
+
+func (m *Memory) GetModel(ctx context.Context, id uuid.UUID) (*Model, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	mo, ok := m.models[id]
+	if !ok {
+		return nil, nil
+	}
+	c := cloneModel(mo)
+	return &c, nil
+}
+
+func (m *Memory) GetModelByName(ctx context.Context, name string) (*Model, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	mo := m.findModel(name, func(*Model) bool { return true })
+	if mo == nil {
+		return nil, nil
+	}
+	c := cloneModel(mo)
+	return &c, nil
+}
+
+func (m *Memory) CreateModel(ctx context.Context, mc *ModelCreate) (*Model, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := memoryNow()
+	mo := &Model{
+		ID:                      uuid.New(),
+		Name:                    mc.Name,
+		DisplayName:             mc.DisplayName,
+		Provider:                mc.Provider,
+		UpstreamID:              mc.UpstreamID,
+		InputCostPerMillion:     mc.InputCostPerMillion,
+		OutputCostPerMillion:    mc.OutputCostPerMillion,
+		WebSearchCostPer1K:      mc.WebSearchCostPer1K,
+		EmbeddingCostPerMillion: mc.EmbeddingCostPerMillion,
+		ReasoningCostPerMillion: mc.ReasoningCostPerMillion,
+		IsActive:                true,
+		Availability:            slices.Clone(mc.Availability),
+		ContextWindow:           mc.ContextWindow,
+		MaxOutputTokens:         mc.MaxOutputTokens,
+		DefaultMaxTokens:        mc.DefaultMaxTokens,
+		Tokenizer:               mc.Tokenizer,
+		Aliases:                 append([]string{}, mc.Aliases...),
+		CreatedAt:               now,
+		UpdatedAt:               now,
+
+		FallbackUpstreamIDs: append([]uuid.UUID{}, mc.FallbackUpstreamIDs...),
+	}
+	if err := m.checkModel(mo); err != nil {
+		return nil, fmt.Errorf("create model: %w", err)
+	}
+	m.models[mo.ID] = mo
+	c := cloneModel(mo)
+	return &c, nil
+}
+
+func (m *Memory) UpdateModel(ctx context.Context, id uuid.UUID, u *ModelUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, ok := m.models[id]
+	if !ok {
+		return nil
+	}
+	if *u == (ModelUpdate{}) {
+		return nil
+	}
+
+	mo := cloneModel(cur)
+	if u.Name != nil {
+		mo.Name = *u.Name
+	}
+	if u.DisplayName != nil {
+		v := *u.DisplayName
+		mo.DisplayName = &v
+	}
+	if u.Provider != nil {
+		mo.Provider = *u.Provider
+	}
+	if u.UpstreamID != nil {
+		v := *u.UpstreamID
+		mo.UpstreamID = &v
+	}
+	if u.InputCostPerMillion != nil {
+		mo.InputCostPerMillion = *u.InputCostPerMillion
+	}
+	if u.OutputCostPerMillion != nil {
+		mo.OutputCostPerMillion = *u.OutputCostPerMillion
+	}
+	if u.WebSearchCostPer1K != nil {
+		mo.WebSearchCostPer1K = *u.WebSearchCostPer1K
+	}
+	if u.EmbeddingCostPerMillion != nil {
+		mo.EmbeddingCostPerMillion = *u.EmbeddingCostPerMillion
+	}
+	if u.ReasoningCostPerMillion != nil {
+		mo.ReasoningCostPerMillion = *u.ReasoningCostPerMillion
+	}
+	if u.IsActive != nil {
+		mo.IsActive = *u.IsActive
+	}
+	if u.Availability != nil {
+		mo.Availability = slices.Clone(*u.Availability)
+	}
+	if u.ContextWindow != nil {
+		v := *u.ContextWindow
+		mo.ContextWindow = &v
+	}
+	if u.MaxOutputTokens != nil {
+		v := *u.MaxOutputTokens
+		mo.MaxOutputTokens = &v
+	}
+	if u.DefaultMaxTokens != nil {
+		v := *u.DefaultMaxTokens
+		mo.DefaultMaxTokens = &v
+	}
+	if u.Tokenizer != nil {
+		// An empty string clears the override.
+		mo.Tokenizer = nullIfEmpty(u.Tokenizer)
+	}
+	if u.Aliases != nil {
+		mo.Aliases = append([]string{}, *u.Aliases...)
+	}
+	if u.FallbackUpstreamIDs != nil {
+		mo.FallbackUpstreamIDs = append([]uuid.UUID{}, *u.FallbackUpstreamIDs...)
+	}
+	if err := m.checkModel(&mo); err != nil {
+		return fmt.Errorf("update model: %w", err)
+	}
+	mo.UpdatedAt = memoryNow()
+	*cur = mo
+	return nil
+}
+
+func (m *Memory) DeleteModel(ctx context.Context, id uuid.UUID) error {
+	_, err := m.DeleteModels(ctx, []uuid.UUID{id})
+	return err
+}
+
+func (m *Memory) DeleteModels(ctx context.Context, ids []uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for _, id := range ids {
+		if _, ok := m.models[id]; ok {
+			delete(m.models, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) MarkStaleModels(ctx context.Context, upstreamID uuid.UUID, listed []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make(map[string]bool, len(listed))
+	for _, n := range listed {
+		names[strings.ToLower(n)] = true
+	}
+	now := memoryNow()
+	for _, mo := range m.models {
+		if mo.UpstreamID == nil || *mo.UpstreamID != upstreamID {
+			continue
+		}
+		switch found := names[strings.ToLower(mo.Name)]; {
+		case found && mo.StaleSince != nil:
+			mo.StaleSince = nil
+		case !found && mo.StaleSince == nil:
+			mo.StaleSince = &now
+		}
+	}
+	return nil
+}
+
+func (m *Memory) ModelNameConflict(ctx context.Context, names []string, exclude *uuid.UUID) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var conflict *Model
+	for _, mo := range m.models {
+		if exclude != nil && mo.ID == *exclude {
+			continue
+		}
+		for _, n := range names {
+			if matched, _ := modelMatches(mo, n); matched {
+				if conflict == nil || mo.Name < conflict.Name {
+					conflict = mo
+				}
+				break
+			}
+		}
+	}
+	if conflict == nil {
+		return "", nil
+	}
+	return conflict.Name, nil
+}
+
+// withUpstream joins a model with its upstream, or returns nil if either
+// is inactive. m.mu must be held.
+func (m *Memory) withUpstream(mo *Model) *ModelWithUpstream {
+	if !mo.IsActive || mo.UpstreamID == nil {
+		return nil
+	}
+	u, ok := m.upstreams[*mo.UpstreamID]
+	if !ok || !u.IsActive {
+		return nil
+	}
+	mw := &ModelWithUpstream{
+		Model:                            cloneModel(mo),
+		UpstreamBaseURL:                  u.BaseURL,
+		UpstreamAPIKey:                   u.APIKeyEncrypted,
+		UpstreamFormat:                   u.Format,
+		UpstreamAvailability:             slices.Clone(u.Availability),
+		UpstreamRoleMap:                  maps.Clone(u.RoleMap),
+		UpstreamServiceTiers:             maps.Clone(u.ServiceTiers),
+		UpstreamMaxSSEFrameBytes:         u.MaxSSEFrameBytes,
+		UpstreamStreamIdleTimeoutSeconds: u.StreamIdleTimeoutSeconds,
+		UpstreamAnthropicBetas:           u.AnthropicBetas,
+		UpstreamResilience:               u.Resilience,
+		UpstreamDisableCompression:       u.DisableCompression,
+		UpstreamExtension:                u.Extension,
+	}
+	if u.Region != nil {
+		mw.UpstreamRegion = *u.Region
+	}
+	var fallbacks []Upstream
+	for _, id := range mo.FallbackUpstreamIDs {
+		if f, ok := m.upstreams[id]; ok && f.IsActive {
+			fallbacks = append(fallbacks, cloneUpstream(f))
+		}
+	}
+	slices.SortFunc(fallbacks, compareUpstreamsByPriority)
+	mw.Fallbacks = fallbacksOf(&mw.Model, fallbacks)
+	return mw
+}
+
+func (m *Memory) GetModelWithUpstream(ctx context.Context, modelName string) (*ModelWithUpstream, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	mo := m.findModel(modelName, func(mo *Model) bool { return m.withUpstream(mo) != nil })
+	if mo == nil {
+		return nil, nil
+	}
+	return m.withUpstream(mo), nil
+}
+
+func (m *Memory) ListActiveModelsWithUpstream(ctx context.Context) ([]*ModelWithUpstream, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	models := make([]*ModelWithUpstream, 0)
+	for _, mo := range m.models {
+		if mw := m.withUpstream(mo); mw != nil {
+			models = append(models, mw)
+		}
+	}
+	return models, nil
+}
+
+// livePin returns a pin joined with its upstream's name. m.mu must be
+// held.
+func (m *Memory) livePin(p *UpstreamPin) UpstreamPin {
+	c := *p
+	if u, ok := m.upstreams[p.UpstreamID]; ok {
+		c.UpstreamName = u.Name
+	}
+	return c
+}
+
+func (m *Memory) ListUpstreamPins(ctx context.Context) ([]UpstreamPin, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := time.Now()
+	pins := []UpstreamPin{}
+	for _, p := range m.pins {
+		if p.ExpiresAt.After(now) {
+			pins = append(pins, m.livePin(p))
+		}
+	}
+	slices.SortStableFunc(pins, func(a, b UpstreamPin) int {
+		switch {
+		case a.KeyID == nil && b.KeyID != nil:
+			return -1
+		case a.KeyID != nil && b.KeyID == nil:
+			return 1
+		case a.KeyID != nil && b.KeyID != nil:
+			if c := compareUUID(*a.KeyID, *b.KeyID); c != 0 {
+				return c
+			}
+		}
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return pins, nil
+}
+
+func (m *Memory) CreateUpstreamPin(ctx context.Context, pc *UpstreamPinCreate) (*UpstreamPin, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.upstreams[pc.UpstreamID]; !ok {
+		return nil, fmt.Errorf("create upstream pin: upstream %s does not exist", pc.UpstreamID)
+	}
+	if pc.KeyID != nil {
+		if _, ok := m.llmKeys[*pc.KeyID]; !ok {
+			return nil, fmt.Errorf("create upstream pin: key %s does not exist", *pc.KeyID)
+		}
+	}
+
+	now := memoryNow()
+	var pin *UpstreamPin
+	for id, p := range m.pins {
+		switch {
+		case !p.ExpiresAt.After(now):
+			delete(m.pins, id)
+		case (p.KeyID == nil && pc.KeyID == nil) || (p.KeyID != nil && pc.KeyID != nil && *p.KeyID == *pc.KeyID):
+			pin = p
+		}
+	}
+	if pin == nil {
+		pin = &UpstreamPin{ID: uuid.New()}
+		if pc.KeyID != nil {
+			id := *pc.KeyID
+			pin.KeyID = &id
+		}
+		m.pins[pin.ID] = pin
+	}
+	pin.UpstreamID = pc.UpstreamID
+	pin.Reason = pc.Reason
+	pin.ExpiresAt = pc.ExpiresAt
+	pin.CreatedAt = now
+
+	c := m.livePin(pin)
+	return &c, nil
+}
+
+func (m *Memory) DeleteUpstreamPin(ctx context.Context, id uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.pins[id]; !ok {
+		return false, nil
+	}
+	delete(m.pins, id)
+	return true, nil
+}
@@ -0,0 +1,247 @@
+package store
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migration is one schema change, applied by its NNN_name.up.sql file and
+// reverted by NNN_name.down.sql.
+type migration struct {
+	number  int
+	version string // file name without .up.sql, as recorded in schema_migrations
+}
+
+// MigrationStatus is the database's schema version and the migrations this
+// build would apply to bring it up to date.
+type MigrationStatus struct {
+	Version int                `json:"version"` // number of the last applied migration, 0 if none
+	Latest  int                `json:"latest"`  // number of the last migration this build has
+	Pending []string           `json:"pending"`
+	History []AppliedMigration `json:"history"`
+}
+
+// AppliedMigration is a migration recorded in schema_migrations.
+type AppliedMigration struct {
+	Version   string    `json:"version"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// embeddedMigrations returns the migrations built into pxbin, oldest first.
+func embeddedMigrations() ([]migration, error) {
+	entries, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations dir: %w", err)
+	}
+	var out []migration
+	for _, e := range entries {
+		version, ok := strings.CutSuffix(e.Name(), ".up.sql")
+		if !ok {
+			continue
+		}
+		n, err := migrationNumber(version)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, migration{number: n, version: version})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].number < out[j].number })
+	return out, nil
+}
+
+// migrationNumber returns the NNN prefix of a migration version.
+func migrationNumber(version string) (int, error) {
+	prefix, _, _ := strings.Cut(version, "_")
+	n, err := strconv.Atoi(prefix)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid migration version %q", version)
+	}
+	return n, nil
+}
+
+// Migrate applies every migration not applied yet.
+func (s *Postgres) Migrate(ctx context.Context) error {
+	all, err := embeddedMigrations()
+	if err != nil {
+		return err
+	}
+	if len(all) == 0 {
+		return nil
+	}
+	return s.MigrateTo(ctx, all[len(all)-1].number)
+}
+
+// MigrateTo brings the schema to version target: migrations numbered up to
+// target that are not applied yet are applied, oldest first, and applied
+// migrations numbered above it are reverted with their down migrations,
+// newest first. Each migration runs in its own transaction. Target 0 reverts
+// every migration.
+func (s *Postgres) MigrateTo(ctx context.Context, target int) error {
+	all, err := embeddedMigrations()
+	if err != nil {
+		return err
+	}
+	latest := 0
+	if len(all) > 0 {
+		latest = all[len(all)-1].number
+	}
+	if target < 0 || target > latest {
+		return fmt.Errorf("migration version %d out of range 0-%d", target, latest)
+	}
+
+	_, err = s.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    TEXT PRIMARY KEY,
+			applied_at TIMESTAMPTZ DEFAULT now()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations table: %w", err)
+	}
+
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(all))
+	for _, m := range all {
+		known[m.version] = true
+	}
+	isApplied := make(map[string]bool, len(applied))
+	for _, a := range applied {
+		isApplied[a.Version] = true
+		// A newer build's migrations can only be reverted with its down files.
+		if n, err := migrationNumber(a.Version); !known[a.Version] && err == nil && n > target {
+			return fmt.Errorf("migration %s was applied by a newer pxbin and cannot be reverted by this one", a.Version)
+		}
+	}
+
+	for i := len(all) - 1; i >= 0; i-- {
+		m := all[i]
+		if m.number <= target || !isApplied[m.version] {
+			continue
+		}
+		if err := s.runMigration(ctx, m, false); err != nil {
+			return err
+		}
+	}
+	for _, m := range all {
+		if m.number > target || isApplied[m.version] {
+			continue
+		}
+		if err := s.runMigration(ctx, m, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runMigration applies m, or reverts it if up is false, and records the
+// change in schema_migrations.
+func (s *Postgres) runMigration(ctx context.Context, m migration, up bool) error {
+	filename := m.version + ".down.sql"
+	if up {
+		filename = m.version + ".up.sql"
+	}
+	content, err := migrations.ReadFile("migrations/" + filename)
+	if err != nil {
+		return fmt.Errorf("read migration %s: %w", filename, err)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx for migration %s: %w", m.version, err)
+	}
+	defer tx.Rollback(ctx)
+
+	if up {
+		if _, err := tx.Exec(ctx, string(content)); err != nil {
+			return fmt.Errorf("execute migration %s: %w", m.version, err)
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", m.version); err != nil {
+			return fmt.Errorf("record migration %s: %w", m.version, err)
+		}
+	} else {
+		// The record goes first: the first migration's down file drops
+		// schema_migrations itself.
+		if _, err := tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.version); err != nil {
+			return fmt.Errorf("unrecord migration %s: %w", m.version, err)
+		}
+		if _, err := tx.Exec(ctx, string(content)); err != nil {
+			return fmt.Errorf("revert migration %s: %w", m.version, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit migration %s: %w", m.version, err)
+	}
+	return nil
+}
+
+// appliedMigrations returns the migrations recorded in schema_migrations,
+// oldest first, or none if the table does not exist.
+func (s *Postgres) appliedMigrations(ctx context.Context) ([]AppliedMigration, error) {
+	var exists bool
+	if err := s.pool.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, fmt.Errorf("check schema_migrations: %w", err)
+	}
+	if !exists {
+		return []AppliedMigration{}, nil
+	}
+
+	rows, err := s.pool.Query(ctx, "SELECT version, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("list migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := []AppliedMigration{}
+	for rows.Next() {
+		var a AppliedMigration
+		if err := rows.Scan(&a.Version, &a.AppliedAt); err != nil {
+			return nil, fmt.Errorf("scan migration: %w", err)
+		}
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+// MigrationStatus returns the schema version, the migrations pending and
+// the history of applied ones.
+func (s *Postgres) MigrationStatus(ctx context.Context) (*MigrationStatus, error) {
+	all, err := embeddedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return migrationStatus(all, applied), nil
+}
+
+func migrationStatus(all []migration, applied []AppliedMigration) *MigrationStatus {
+	st := &MigrationStatus{Pending: []string{}, History: applied}
+	isApplied := make(map[string]bool, len(applied))
+	for _, a := range applied {
+		isApplied[a.Version] = true
+		if n, err := migrationNumber(a.Version); err == nil && n > st.Version {
+			st.Version = n
+		}
+	}
+	for _, m := range all {
+		st.Latest = m.number
+		if !isApplied[m.version] {
+			st.Pending = append(st.Pending, m.version)
+		}
+	}
+	return st
+}
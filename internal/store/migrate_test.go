@@ -0,0 +1,35 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	all, err := embeddedMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range all {
+		if m.number != i+1 {
+			t.Fatalf("expected migration %d, got %s", i+1, m.version)
+		}
+		if _, err := migrations.ReadFile("migrations/" + m.version + ".down.sql"); err != nil {
+			t.Fatalf("expected a down migration for %s: %v", m.version, err)
+		}
+	}
+}
+
+func TestMigrationStatus(t *testing.T) {
+	all := []migration{{1, "001_initial"}, {2, "002_logs"}, {3, "003_models"}}
+	applied := []AppliedMigration{{Version: "001_initial", AppliedAt: time.Now()}, {Version: "002_logs", AppliedAt: time.Now()}}
+	st := migrationStatus(all, applied)
+	if st.Version != 2 || st.Latest != 3 || len(st.Pending) != 1 || st.Pending[0] != "003_models" || len(st.History) != 2 {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	st = migrationStatus(all, []AppliedMigration{})
+	if st.Version != 0 || len(st.Pending) != 3 {
+		t.Fatalf("expected every migration pending on an empty database, got %+v", st)
+	}
+}
@@ -0,0 +1,13 @@
+CREATE TABLE policies (
+    id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name          TEXT NOT NULL UNIQUE,
+    expression    TEXT NOT NULL,
+    action        TEXT NOT NULL CHECK (action IN ('allow', 'deny', 'route', 'cap')),
+    target_model  TEXT,
+    max_tokens    INT,
+    message       TEXT,
+    priority      INT NOT NULL DEFAULT 0,
+    is_active     BOOLEAN NOT NULL DEFAULT true,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,2 @@
+ALTER TABLE models DROP COLUMN IF EXISTS availability;
+ALTER TABLE upstreams DROP COLUMN IF EXISTS availability;
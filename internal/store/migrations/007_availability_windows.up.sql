@@ -0,0 +1,3 @@
+-- Optional recurring availability windows; NULL or [] means always available.
+ALTER TABLE models ADD COLUMN availability JSONB;
+ALTER TABLE upstreams ADD COLUMN availability JSONB;
@@ -0,0 +1,2 @@
+ALTER TABLE models DROP COLUMN IF EXISTS context_window;
+ALTER TABLE models DROP COLUMN IF EXISTS max_output_tokens;
@@ -0,0 +1,3 @@
+-- Model limits, imported from LiteLLM data or set manually. NULL means unknown.
+ALTER TABLE models ADD COLUMN context_window INT;
+ALTER TABLE models ADD COLUMN max_output_tokens INT;
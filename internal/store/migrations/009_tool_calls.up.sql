@@ -0,0 +1,3 @@
+-- Tool calls (tool_use blocks / tool_calls) in the response, for spotting
+-- models that loop on tools.
+ALTER TABLE request_logs ADD COLUMN tool_calls INT NOT NULL DEFAULT 0;
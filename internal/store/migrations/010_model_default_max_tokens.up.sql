@@ -0,0 +1,3 @@
+-- max_tokens injected into Anthropic requests that omit it. NULL falls back
+-- to the global default_max_tokens setting.
+ALTER TABLE models ADD COLUMN default_max_tokens INT;
@@ -0,0 +1 @@
+ALTER TABLE llm_api_keys DROP COLUMN IF EXISTS gateway_headers;
@@ -0,0 +1,2 @@
+-- Opt-in per key: expose x-pxbin-* routing and cost headers on proxy responses.
+ALTER TABLE llm_api_keys ADD COLUMN gateway_headers BOOLEAN NOT NULL DEFAULT false;
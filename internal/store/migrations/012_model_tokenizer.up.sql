@@ -0,0 +1,3 @@
+-- Tokenizer used to count prompt tokens for the model. NULL picks one by
+-- model family.
+ALTER TABLE models ADD COLUMN tokenizer TEXT;
@@ -0,0 +1,3 @@
+ALTER TABLE request_logs DROP COLUMN IF EXISTS region;
+ALTER TABLE llm_api_keys DROP COLUMN IF EXISTS allowed_regions;
+ALTER TABLE upstreams DROP COLUMN IF EXISTS region;
@@ -0,0 +1,5 @@
+-- Upstream regions for data residency. Keys with allowed_regions set may only
+-- be routed to upstreams in one of those regions.
+ALTER TABLE upstreams ADD COLUMN region TEXT;
+ALTER TABLE llm_api_keys ADD COLUMN allowed_regions TEXT[];
+ALTER TABLE request_logs ADD COLUMN region TEXT;
@@ -0,0 +1,2 @@
+-- Optional per-upstream OpenAI role rewrites, e.g. {"developer": "system"}.
+ALTER TABLE upstreams ADD COLUMN role_map JSONB;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_request_logs_canary;
+ALTER TABLE request_logs DROP COLUMN IF EXISTS canary_arm;
+ALTER TABLE request_logs DROP COLUMN IF EXISTS canary_id;
+DROP TABLE IF EXISTS policy_canaries;
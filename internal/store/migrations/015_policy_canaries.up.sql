@@ -0,0 +1,22 @@
+-- Candidate policy sets rolled out to a share of traffic. At most one canary
+-- runs at a time; promoting it replaces the active policies.
+CREATE TABLE policy_canaries (
+    id                    UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name                  TEXT NOT NULL,
+    policies              JSONB NOT NULL,
+    percent               INT NOT NULL CHECK (percent BETWEEN 1 AND 99),
+    status                TEXT NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'promoted', 'rolled_back')),
+    status_reason         TEXT,
+    max_error_rate_delta  DOUBLE PRECISION NOT NULL DEFAULT 0.05,
+    max_latency_delta_ms  INT NOT NULL DEFAULT 0,
+    min_requests          INT NOT NULL DEFAULT 100,
+    created_at            TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at            TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_policy_canaries_running ON policy_canaries ((true)) WHERE status = 'running';
+
+-- Which arm of a canary a request was evaluated under, for comparing them.
+ALTER TABLE request_logs ADD COLUMN canary_id UUID;
+ALTER TABLE request_logs ADD COLUMN canary_arm TEXT;
+CREATE INDEX idx_request_logs_canary ON request_logs (canary_id) WHERE canary_id IS NOT NULL;
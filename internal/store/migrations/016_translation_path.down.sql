@@ -0,0 +1,2 @@
+ALTER TABLE request_logs DROP COLUMN IF EXISTS translated;
+ALTER TABLE request_logs DROP COLUMN IF EXISTS upstream_format;
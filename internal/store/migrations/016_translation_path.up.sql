@@ -0,0 +1,4 @@
+-- The upstream's API format and whether the request was translated to reach
+-- it, to separate translation overhead from upstream behaviour in stats.
+ALTER TABLE request_logs ADD COLUMN upstream_format TEXT;
+ALTER TABLE request_logs ADD COLUMN translated BOOLEAN NOT NULL DEFAULT false;
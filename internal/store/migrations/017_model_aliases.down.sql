@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_models_aliases;
+ALTER TABLE models DROP COLUMN IF EXISTS aliases;
+DROP INDEX IF EXISTS models_name_lower_key;
+ALTER TABLE models ADD CONSTRAINT models_name_key UNIQUE (name);
@@ -0,0 +1,16 @@
+-- Model names are resolved case-insensitively. Existing names that differ
+-- only by case are renamed (keeping the oldest) and deactivated so the
+-- normalized unique index can be built; review and delete them afterwards.
+UPDATE models m
+SET name = m.name || '-duplicate-' || left(m.id::text, 8), is_active = false, updated_at = now()
+WHERE EXISTS (
+    SELECT 1 FROM models o
+    WHERE lower(o.name) = lower(m.name) AND (o.created_at, o.id) < (m.created_at, m.id)
+);
+
+ALTER TABLE models DROP CONSTRAINT models_name_key;
+CREATE UNIQUE INDEX models_name_lower_key ON models (lower(name));
+
+-- Alternative names clients may send for the model, stored lowercase.
+ALTER TABLE models ADD COLUMN aliases TEXT[] NOT NULL DEFAULT '{}';
+CREATE INDEX idx_models_aliases ON models USING GIN (aliases);
@@ -0,0 +1 @@
+ALTER TABLE upstreams DROP COLUMN IF EXISTS max_sse_frame_bytes;
@@ -0,0 +1,2 @@
+-- Optional per-upstream cap on a single SSE line; NULL uses the proxy default.
+ALTER TABLE upstreams ADD COLUMN max_sse_frame_bytes INTEGER;
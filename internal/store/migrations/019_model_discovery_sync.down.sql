@@ -0,0 +1,2 @@
+ALTER TABLE models DROP COLUMN IF EXISTS stale_since;
+ALTER TABLE upstreams DROP COLUMN IF EXISTS auto_import_models;
@@ -0,0 +1,4 @@
+-- Background model discovery: upstreams opt in to importing new models, and
+-- models that disappear from their upstream's /v1/models are flagged stale.
+ALTER TABLE upstreams ADD COLUMN auto_import_models BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE models ADD COLUMN stale_since TIMESTAMPTZ;
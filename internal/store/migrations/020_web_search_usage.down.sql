@@ -0,0 +1,2 @@
+ALTER TABLE models DROP COLUMN IF EXISTS web_search_cost_per_1k;
+ALTER TABLE request_logs DROP COLUMN IF EXISTS web_search_requests;
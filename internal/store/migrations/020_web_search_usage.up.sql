@@ -0,0 +1,4 @@
+-- Server-side web searches (usage.server_tool_use) are billed per use on top
+-- of tokens: count them per request and price them per model.
+ALTER TABLE request_logs ADD COLUMN web_search_requests INT NOT NULL DEFAULT 0;
+ALTER TABLE models ADD COLUMN web_search_cost_per_1k NUMERIC(12,6) NOT NULL DEFAULT 0;
@@ -0,0 +1,16 @@
+-- Access log of management API calls, kept apart from proxy traffic in
+-- request_logs. Failed authentications are logged with a NULL key.
+CREATE TABLE access_logs (
+    id                 UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    management_key_id  UUID REFERENCES management_api_keys(id) ON DELETE SET NULL,
+    timestamp          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    method             TEXT NOT NULL,
+    path               TEXT NOT NULL,
+    route              TEXT NOT NULL DEFAULT '',
+    status_code        INT NOT NULL,
+    latency_ms         INT NOT NULL,
+    client_ip          TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_access_logs_timestamp ON access_logs (timestamp DESC);
+CREATE INDEX idx_access_logs_management_key_id ON access_logs (management_key_id);
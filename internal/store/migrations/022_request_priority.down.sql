@@ -0,0 +1,3 @@
+ALTER TABLE request_logs DROP COLUMN IF EXISTS priority;
+ALTER TABLE upstreams DROP COLUMN IF EXISTS service_tiers;
+ALTER TABLE llm_api_keys DROP COLUMN IF EXISTS max_priority;
@@ -0,0 +1,6 @@
+-- Request priorities (x-pxbin-priority): the highest a key may ask for, the
+-- service_tier each priority maps to per upstream, and the priority each
+-- request was served at.
+ALTER TABLE llm_api_keys ADD COLUMN max_priority TEXT NOT NULL DEFAULT 'normal';
+ALTER TABLE upstreams ADD COLUMN service_tiers JSONB;
+ALTER TABLE request_logs ADD COLUMN priority TEXT;
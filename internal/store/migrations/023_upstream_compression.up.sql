@@ -0,0 +1,3 @@
+-- Non-streaming responses are requested compressed unless the upstream
+-- opts out, e.g. when it mishandles Accept-Encoding.
+ALTER TABLE upstreams ADD COLUMN disable_compression BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+-- Names a WASM module in extensions_dir that patches this upstream's
+-- request and response JSON; NULL runs none.
+ALTER TABLE upstreams ADD COLUMN extension TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE request_logs DROP COLUMN IF EXISTS error_code;
+ALTER TABLE upstreams DROP COLUMN IF EXISTS stream_idle_timeout_seconds;
@@ -0,0 +1,5 @@
+-- Optional per-upstream limit on how long a stream may go without data;
+-- NULL uses the proxy default. Stalled streams are logged with error_code
+-- upstream_stall.
+ALTER TABLE upstreams ADD COLUMN stream_idle_timeout_seconds INTEGER;
+ALTER TABLE request_logs ADD COLUMN error_code TEXT;
@@ -0,0 +1,3 @@
+-- Sandbox keys are answered with synthetic responses and never reach an
+-- upstream.
+ALTER TABLE llm_api_keys ADD COLUMN sandbox BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,10 @@
+-- Each upstream's rolling window of recent outcomes, saved periodically so
+-- health decisions do not start from a blank slate after a restart.
+CREATE TABLE upstream_scores (
+    upstream_id           UUID PRIMARY KEY REFERENCES upstreams(id) ON DELETE CASCADE,
+    latencies_ms          INT[] NOT NULL DEFAULT '{}',
+    successes             BOOLEAN[] NOT NULL DEFAULT '{}',
+    consecutive_failures  INT NOT NULL DEFAULT 0,
+    last_failure_at       TIMESTAMPTZ,
+    updated_at            TIMESTAMPTZ NOT NULL DEFAULT now()
+);
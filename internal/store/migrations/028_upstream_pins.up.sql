@@ -0,0 +1,13 @@
+-- Temporary overrides that send a key's requests, or every key's when
+-- llm_key_id is NULL, to one upstream whatever model they ask for. At most
+-- one pin per key, and one for all keys.
+CREATE TABLE upstream_pins (
+    id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    llm_key_id   UUID REFERENCES llm_api_keys(id) ON DELETE CASCADE,
+    upstream_id  UUID NOT NULL REFERENCES upstreams(id) ON DELETE CASCADE,
+    reason       TEXT NOT NULL DEFAULT '',
+    expires_at   TIMESTAMPTZ NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_upstream_pins_scope ON upstream_pins ((COALESCE(llm_key_id, '00000000-0000-0000-0000-000000000000'::uuid)));
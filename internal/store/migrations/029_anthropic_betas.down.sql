@@ -0,0 +1 @@
+ALTER TABLE upstreams DROP COLUMN IF EXISTS anthropic_betas;
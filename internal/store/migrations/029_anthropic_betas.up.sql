@@ -0,0 +1,3 @@
+-- anthropic-beta flags per upstream: defaults added to every request and,
+-- optionally, the flags the upstream accepts.
+ALTER TABLE upstreams ADD COLUMN anthropic_betas JSONB;
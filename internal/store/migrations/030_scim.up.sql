@@ -0,0 +1,34 @@
+-- Employees provisioned over SCIM, each with the LLM key created for them.
+-- resource holds the SCIM User as last written by the identity provider.
+CREATE TABLE scim_users (
+    id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    llm_key_id   UUID NOT NULL UNIQUE REFERENCES llm_api_keys(id) ON DELETE CASCADE,
+    user_name    TEXT NOT NULL,
+    external_id  TEXT,
+    active       BOOLEAN NOT NULL DEFAULT true,
+    resource     JSONB NOT NULL DEFAULT '{}',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_scim_users_user_name ON scim_users (lower(user_name));
+CREATE INDEX idx_scim_users_external_id ON scim_users (external_id);
+
+-- Teams provisioned over SCIM as Groups.
+CREATE TABLE scim_groups (
+    id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    display_name  TEXT NOT NULL,
+    external_id   TEXT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_scim_groups_display_name ON scim_groups (lower(display_name));
+
+CREATE TABLE scim_group_members (
+    group_id  UUID NOT NULL REFERENCES scim_groups(id) ON DELETE CASCADE,
+    user_id   UUID NOT NULL REFERENCES scim_users(id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX idx_scim_group_members_user ON scim_group_members (user_id);
@@ -0,0 +1,4 @@
+-- Gemini generateContent requests are logged with input_format 'gemini'.
+ALTER TABLE request_logs DROP CONSTRAINT IF EXISTS request_logs_input_format_check;
+ALTER TABLE request_logs ADD CONSTRAINT request_logs_input_format_check
+  CHECK (input_format IN ('anthropic', 'openai', 'gemini'));
@@ -0,0 +1,3 @@
+-- Upstreams a model's requests fail over to when its own upstream is
+-- unreachable or returns 502/503, tried in upstream priority order.
+ALTER TABLE models ADD COLUMN fallback_upstream_ids UUID[] NOT NULL DEFAULT '{}';
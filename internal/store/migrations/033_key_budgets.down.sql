@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_request_logs_llm_key_id_timestamp;
+ALTER TABLE llm_api_keys DROP COLUMN IF EXISTS monthly_budget_usd;
+ALTER TABLE llm_api_keys DROP COLUMN IF EXISTS daily_budget_usd;
@@ -0,0 +1,6 @@
+-- Spend budgets in USD per UTC day and calendar month; NULL means none.
+-- Keys over a budget are rejected until it resets.
+ALTER TABLE llm_api_keys ADD COLUMN daily_budget_usd NUMERIC(12,4);
+ALTER TABLE llm_api_keys ADD COLUMN monthly_budget_usd NUMERIC(12,4);
+
+CREATE INDEX idx_request_logs_llm_key_id_timestamp ON request_logs (llm_key_id, timestamp);
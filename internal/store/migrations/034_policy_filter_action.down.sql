@@ -0,0 +1,3 @@
+UPDATE policies SET action = 'deny' WHERE action = 'filter';
+ALTER TABLE policies DROP CONSTRAINT policies_action_check;
+ALTER TABLE policies ADD CONSTRAINT policies_action_check CHECK (action IN ('allow', 'deny', 'route', 'cap'));
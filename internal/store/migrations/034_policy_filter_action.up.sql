@@ -0,0 +1,3 @@
+-- filter answers a request with a content-filtered response instead of an error.
+ALTER TABLE policies DROP CONSTRAINT policies_action_check;
+ALTER TABLE policies ADD CONSTRAINT policies_action_check CHECK (action IN ('allow', 'deny', 'route', 'cap', 'filter'));
@@ -0,0 +1 @@
+ALTER TABLE models DROP COLUMN IF EXISTS embedding_cost_per_million;
@@ -0,0 +1,3 @@
+-- Embedding requests are billed by input tokens only, usually at a price of
+-- their own; 0 falls back to input_cost_per_million.
+ALTER TABLE models ADD COLUMN embedding_cost_per_million NUMERIC(12,6) NOT NULL DEFAULT 0;
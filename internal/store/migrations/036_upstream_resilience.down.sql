@@ -0,0 +1 @@
+ALTER TABLE upstreams DROP COLUMN IF EXISTS resilience;
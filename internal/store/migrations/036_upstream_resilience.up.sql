@@ -0,0 +1,3 @@
+-- Circuit breaker and retry settings per upstream, overriding the
+-- proxy-wide configuration.
+ALTER TABLE upstreams ADD COLUMN resilience JSONB;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS request_payloads;
+ALTER TABLE llm_api_keys DROP COLUMN IF EXISTS capture_payloads;
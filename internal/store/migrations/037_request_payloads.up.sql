@@ -0,0 +1,17 @@
+-- Request and response bodies captured for debugging, for keys with
+-- capture_payloads or every key with payload_capture_all. Bodies are
+-- truncated to payload_capture_max_bytes and deleted with their log or
+-- after payload_retention_days.
+ALTER TABLE llm_api_keys ADD COLUMN capture_payloads BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE request_payloads (
+    log_id          UUID PRIMARY KEY REFERENCES request_logs(id) ON DELETE CASCADE,
+    request_body    TEXT NOT NULL,
+    response_body   TEXT NOT NULL,
+    request_bytes   INT NOT NULL,
+    response_bytes  INT NOT NULL,
+    redacted        BOOLEAN NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_request_payloads_created_at ON request_payloads (created_at);
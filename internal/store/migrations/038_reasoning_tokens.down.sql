@@ -0,0 +1,2 @@
+ALTER TABLE models DROP COLUMN IF EXISTS reasoning_cost_per_million;
+ALTER TABLE request_logs DROP COLUMN IF EXISTS reasoning_tokens;
@@ -0,0 +1,5 @@
+-- Reasoning (thinking) tokens are part of the output tokens but can be priced
+-- apart: count them per request and price them per model. A price of 0 bills
+-- them at output_cost_per_million.
+ALTER TABLE request_logs ADD COLUMN reasoning_tokens INT NOT NULL DEFAULT 0;
+ALTER TABLE models ADD COLUMN reasoning_cost_per_million NUMERIC(12,6) NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Keys whose requests to Anthropic-format upstreams get prompt caching
+-- breakpoints added when the client sets none.
+ALTER TABLE llm_api_keys ADD COLUMN inject_cache_control BOOLEAN NOT NULL DEFAULT false;
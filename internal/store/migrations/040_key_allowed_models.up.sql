@@ -0,0 +1,3 @@
+-- Keys with allowed_models set may only use models matching one of its
+-- names or "*" patterns; NULL allows every model.
+ALTER TABLE llm_api_keys ADD COLUMN allowed_models TEXT[];
@@ -0,0 +1,13 @@
+-- Virtual models that send each request to one of several models, picked
+-- by rules on the request. rules is a JSON array of store.RouterRule.
+CREATE TABLE model_routers (
+    id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name          TEXT NOT NULL,
+    rules         JSONB NOT NULL DEFAULT '[]',
+    default_model TEXT NOT NULL,
+    is_active     BOOLEAN NOT NULL DEFAULT true,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX model_routers_name_idx ON model_routers (lower(name));
@@ -0,0 +1,2 @@
+ALTER TABLE llm_api_keys DROP COLUMN IF EXISTS team_id;
+DROP TABLE IF EXISTS teams;
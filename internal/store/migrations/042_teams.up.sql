@@ -0,0 +1,16 @@
+-- Teams group LLM keys for stats. A team's allowlist and budgets apply to
+-- member keys that set none of their own.
+CREATE TABLE teams (
+    id                 UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name               TEXT NOT NULL,
+    allowed_models     TEXT[],
+    daily_budget_usd   NUMERIC(12,4),
+    monthly_budget_usd NUMERIC(12,4),
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX teams_name_idx ON teams (lower(name));
+
+ALTER TABLE llm_api_keys ADD COLUMN team_id UUID REFERENCES teams(id) ON DELETE SET NULL;
+CREATE INDEX idx_llm_api_keys_team_id ON llm_api_keys (team_id) WHERE team_id IS NOT NULL;
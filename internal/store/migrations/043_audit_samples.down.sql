@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS audit_sample_views;
+DROP TABLE IF EXISTS audit_samples;
+DROP TABLE IF EXISTS audit_rules;
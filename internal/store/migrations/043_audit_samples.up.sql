@@ -0,0 +1,44 @@
+-- Sampling rules and the full request and response bodies they capture for
+-- quality audits. Samples are kept apart from request_logs, with their own
+-- retention (audit_retention_days), and every read of one is recorded.
+CREATE TABLE audit_rules (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    llm_key_id  UUID REFERENCES llm_api_keys(id) ON DELETE CASCADE,
+    model       TEXT NOT NULL DEFAULT '',
+    percent     DOUBLE PRECISION NOT NULL,
+    note        TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_audit_rules_scope ON audit_rules ((COALESCE(llm_key_id, '00000000-0000-0000-0000-000000000000'::uuid)), lower(model));
+
+CREATE TABLE audit_samples (
+    id               UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    rule_id          UUID REFERENCES audit_rules(id) ON DELETE SET NULL,
+    percent          DOUBLE PRECISION NOT NULL,
+    llm_key_id       UUID REFERENCES llm_api_keys(id) ON DELETE SET NULL,
+    model            TEXT NOT NULL,
+    input_format     TEXT NOT NULL,
+    upstream_format  TEXT,
+    translated       BOOLEAN NOT NULL,
+    status_code      INT NOT NULL,
+    latency_ms       INT NOT NULL,
+    input_tokens     INT NOT NULL,
+    output_tokens    INT NOT NULL,
+    request_body     TEXT NOT NULL,
+    response_body    TEXT NOT NULL,
+    request_bytes    INT NOT NULL,
+    response_bytes   INT NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_audit_samples_created_at ON audit_samples (created_at);
+CREATE INDEX idx_audit_samples_key_model ON audit_samples (llm_key_id, model);
+
+CREATE TABLE audit_sample_views (
+    sample_id          UUID NOT NULL REFERENCES audit_samples(id) ON DELETE CASCADE,
+    management_key_id  UUID NOT NULL,
+    viewed_at          TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_audit_sample_views_sample_id ON audit_sample_views (sample_id);
@@ -0,0 +1,22 @@
+-- Guardrails check the text of requests before they are dispatched and of
+-- responses before they reach the client. A guardrail with a llm_key_id
+-- applies to that key only; the rest apply to every key. Which fields matter
+-- depends on the kind: patterns for regex, max_chars for max_length and
+-- entities for pii.
+CREATE TABLE guardrails (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name        TEXT NOT NULL UNIQUE,
+    kind        TEXT NOT NULL,
+    stage       TEXT NOT NULL CHECK (stage IN ('request', 'response', 'both')),
+    mode        TEXT NOT NULL CHECK (mode IN ('block', 'flag')),
+    llm_key_id  UUID REFERENCES llm_api_keys(id) ON DELETE CASCADE,
+    patterns    TEXT[] NOT NULL DEFAULT '{}',
+    max_chars   INT NOT NULL DEFAULT 0,
+    entities    TEXT[] NOT NULL DEFAULT '{}',
+    message     TEXT NOT NULL DEFAULT '',
+    is_active   BOOLEAN NOT NULL DEFAULT true,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_guardrails_llm_key_id ON guardrails (llm_key_id);
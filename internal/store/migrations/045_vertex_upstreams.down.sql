@@ -0,0 +1,4 @@
+UPDATE upstreams SET is_active = FALSE, format = 'openai' WHERE format = 'vertex';
+ALTER TABLE upstreams DROP CONSTRAINT IF EXISTS upstreams_format_check;
+ALTER TABLE upstreams ADD CONSTRAINT upstreams_format_check
+  CHECK (format IN ('openai', 'anthropic'));
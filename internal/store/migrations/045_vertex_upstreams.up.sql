@@ -0,0 +1,5 @@
+-- Vertex AI upstreams authenticate with a service account and serve Claude
+-- and Gemini publisher models.
+ALTER TABLE upstreams DROP CONSTRAINT IF EXISTS upstreams_format_check;
+ALTER TABLE upstreams ADD CONSTRAINT upstreams_format_check
+  CHECK (format IN ('openai', 'anthropic', 'vertex'));
@@ -0,0 +1,2 @@
+UPDATE models SET tokenizer = 'o200k_base' WHERE tokenizer = 'o200k_estimate';
+UPDATE models SET tokenizer = 'cl100k_base' WHERE tokenizer = 'cl100k_estimate';
@@ -0,0 +1,3 @@
+-- The built-in tiktoken tokenizers are estimates and were renamed to say so.
+UPDATE models SET tokenizer = 'o200k_estimate' WHERE tokenizer = 'o200k_base';
+UPDATE models SET tokenizer = 'cl100k_estimate' WHERE tokenizer = 'cl100k_base';
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -11,16 +12,30 @@ import (
 )
 
 type Model struct {
-	ID                   uuid.UUID  `json:"id"`
-	Name                 string     `json:"name"`
-	DisplayName          *string    `json:"display_name"`
-	Provider             string     `json:"provider"`
-	UpstreamID           *uuid.UUID `json:"upstream_id"`
-	InputCostPerMillion  float64    `json:"input_cost_per_million"`
-	OutputCostPerMillion float64    `json:"output_cost_per_million"`
-	IsActive             bool       `json:"is_active"`
-	CreatedAt            time.Time  `json:"created_at"`
-	UpdatedAt            time.Time  `json:"updated_at"`
+	ID                      uuid.UUID  `json:"id"`
+	Name                    string     `json:"name"`
+	DisplayName             *string    `json:"display_name"`
+	Provider                string     `json:"provider"`
+	UpstreamID              *uuid.UUID `json:"upstream_id"`
+	InputCostPerMillion     float64    `json:"input_cost_per_million"`
+	OutputCostPerMillion    float64    `json:"output_cost_per_million"`
+	WebSearchCostPer1K      float64    `json:"web_search_cost_per_1k"`     // per 1,000 server-side web searches
+	EmbeddingCostPerMillion float64    `json:"embedding_cost_per_million"` // embedding input tokens; 0 bills them at the input price
+	ReasoningCostPerMillion float64    `json:"reasoning_cost_per_million"` // reasoning output tokens; 0 bills them at the output price
+	IsActive                bool       `json:"is_active"`
+	Availability            Schedule   `json:"availability"`
+	ContextWindow           *int       `json:"context_window"`
+	MaxOutputTokens         *int       `json:"max_output_tokens"`
+	DefaultMaxTokens        *int       `json:"default_max_tokens"`
+	Tokenizer               *string    `json:"tokenizer"`
+	Aliases                 []string   `json:"aliases"`     // lowercase; resolved like the name, "*" matches any run of characters
+	StaleSince              *time.Time `json:"stale_since"` // since the model went missing from its upstream's model list
+	CreatedAt               time.Time  `json:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at"`
+
+	// FallbackUpstreamIDs are upstreams that serve the model when its own
+	// is unreachable or overloaded, tried in upstream priority order.
+	FallbackUpstreamIDs []uuid.UUID `json:"fallback_upstream_ids"`
 }
 
 type ModelWithUpstream struct {
@@ -28,30 +43,69 @@ type ModelWithUpstream struct {
 	UpstreamBaseURL string
 	UpstreamAPIKey  string
 	UpstreamFormat  string
+
+	UpstreamAvailability     Schedule
+	UpstreamRegion           string
+	UpstreamRoleMap          RoleMap
+	UpstreamServiceTiers     ServiceTiers
+	UpstreamMaxSSEFrameBytes *int
+
+	UpstreamStreamIdleTimeoutSeconds *int
+	UpstreamAnthropicBetas           *AnthropicBetas
+	UpstreamResilience               *ResiliencePolicy
+
+	UpstreamDisableCompression bool
+	UpstreamExtension          *string
+
+	// Fallbacks are the model's active fallback upstreams, highest
+	// priority first, with their API keys decrypted.
+	Fallbacks []Upstream
 }
 
 type ModelCreate struct {
-	Name                 string     `json:"name"`
-	DisplayName          *string    `json:"display_name"`
-	Provider             string     `json:"provider"`
-	UpstreamID           *uuid.UUID `json:"upstream_id"`
-	InputCostPerMillion  float64    `json:"input_cost_per_million"`
-	OutputCostPerMillion float64    `json:"output_cost_per_million"`
+	Name                    string     `json:"name"`
+	DisplayName             *string    `json:"display_name"`
+	Provider                string     `json:"provider"`
+	UpstreamID              *uuid.UUID `json:"upstream_id"`
+	InputCostPerMillion     float64    `json:"input_cost_per_million"`
+	OutputCostPerMillion    float64    `json:"output_cost_per_million"`
+	WebSearchCostPer1K      float64    `json:"web_search_cost_per_1k"`     // per 1,000 server-side web searches
+	EmbeddingCostPerMillion float64    `json:"embedding_cost_per_million"` // embedding input tokens; 0 bills them at the input price
+	ReasoningCostPerMillion float64    `json:"reasoning_cost_per_million"` // reasoning output tokens; 0 bills them at the output price
+	Availability            Schedule   `json:"availability"`
+	ContextWindow           *int       `json:"context_window"`
+	MaxOutputTokens         *int       `json:"max_output_tokens"`
+	DefaultMaxTokens        *int       `json:"default_max_tokens"`
+	Tokenizer               *string    `json:"tokenizer"`
+	Aliases                 []string   `json:"aliases"`
+
+	FallbackUpstreamIDs []uuid.UUID `json:"fallback_upstream_ids"`
 }
 
 type ModelUpdate struct {
-	Name                 *string    `json:"name,omitempty"`
-	DisplayName          *string    `json:"display_name,omitempty"`
-	Provider             *string    `json:"provider,omitempty"`
-	UpstreamID           *uuid.UUID `json:"upstream_id,omitempty"`
-	InputCostPerMillion  *float64   `json:"input_cost_per_million,omitempty"`
-	OutputCostPerMillion *float64   `json:"output_cost_per_million,omitempty"`
-	IsActive             *bool      `json:"is_active,omitempty"`
+	Name                    *string    `json:"name,omitempty"`
+	DisplayName             *string    `json:"display_name,omitempty"`
+	Provider                *string    `json:"provider,omitempty"`
+	UpstreamID              *uuid.UUID `json:"upstream_id,omitempty"`
+	InputCostPerMillion     *float64   `json:"input_cost_per_million,omitempty"`
+	OutputCostPerMillion    *float64   `json:"output_cost_per_million,omitempty"`
+	WebSearchCostPer1K      *float64   `json:"web_search_cost_per_1k,omitempty"`
+	EmbeddingCostPerMillion *float64   `json:"embedding_cost_per_million,omitempty"`
+	ReasoningCostPerMillion *float64   `json:"reasoning_cost_per_million,omitempty"`
+	IsActive                *bool      `json:"is_active,omitempty"`
+	Availability            *Schedule  `json:"availability,omitempty"`
+	ContextWindow           *int       `json:"context_window,omitempty"`
+	MaxOutputTokens         *int       `json:"max_output_tokens,omitempty"`
+	DefaultMaxTokens        *int       `json:"default_max_tokens,omitempty"`
+	Tokenizer               *string    `json:"tokenizer,omitempty"`
+	Aliases                 *[]string  `json:"aliases,omitempty"`
+
+	FallbackUpstreamIDs *[]uuid.UUID `json:"fallback_upstream_ids,omitempty"` // [] removes the fallbacks
 }
 
-func (s *Store) ListModels(ctx context.Context) ([]Model, error) {
+func (s *Postgres) ListModels(ctx context.Context) ([]Model, error) {
 	rows, err := s.pool.Query(ctx, `
-		SELECT id, name, display_name, provider, upstream_id, input_cost_per_million, output_cost_per_million, is_active, created_at, updated_at
+		SELECT id, name, display_name, provider, upstream_id, input_cost_per_million, output_cost_per_million, web_search_cost_per_1k, embedding_cost_per_million, reasoning_cost_per_million, is_active, availability, context_window, max_output_tokens, default_max_tokens, tokenizer, aliases, fallback_upstream_ids, stale_since, created_at, updated_at
 		FROM models ORDER BY name
 	`)
 	if err != nil {
@@ -64,8 +118,8 @@ func (s *Store) ListModels(ctx context.Context) ([]Model, error) {
 		var m Model
 		if err := rows.Scan(
 			&m.ID, &m.Name, &m.DisplayName, &m.Provider, &m.UpstreamID,
-			&m.InputCostPerMillion, &m.OutputCostPerMillion,
-			&m.IsActive, &m.CreatedAt, &m.UpdatedAt,
+			&m.InputCostPerMillion, &m.OutputCostPerMillion, &m.WebSearchCostPer1K, &m.EmbeddingCostPerMillion, &m.ReasoningCostPerMillion,
+			&m.IsActive, &m.Availability, &m.ContextWindow, &m.MaxOutputTokens, &m.DefaultMaxTokens, &m.Tokenizer, &m.Aliases, &m.FallbackUpstreamIDs, &m.StaleSince, &m.CreatedAt, &m.UpdatedAt,
 		); err != nil {
 			return nil, fmt.Errorf("scan model: %w", err)
 		}
@@ -74,15 +128,109 @@ func (s *Store) ListModels(ctx context.Context) ([]Model, error) {
 	return models, rows.Err()
 }
 
-func (s *Store) GetModel(ctx context.Context, id uuid.UUID) (*Model, error) {
+// ModelFilter narrows and orders ListModelsFiltered. PerPage <= 0 returns
+// all matching models.
+type ModelFilter struct {
+	Provider   *string
+	UpstreamID *uuid.UUID
+	IsActive   *bool
+	Stale      *bool   // stale_since set or not
+	Search     *string // case-insensitive match on name or display_name
+	Sort       string  // name, created_at, or cost; "-" prefix for descending
+	Page       int
+	PerPage    int
+}
+
+var modelSortColumns = map[string]string{
+	"name":       "name",
+	"created_at": "created_at",
+	"cost":       "(input_cost_per_million + output_cost_per_million)",
+}
+
+// ListModelsFiltered returns models matching filter and the total number of
+// matches before pagination.
+func (s *Postgres) ListModelsFiltered(ctx context.Context, filter ModelFilter) ([]Model, int, error) {
+	conditions := []string{}
+	args := []any{}
+	argIdx := 1
+
+	if filter.Provider != nil {
+		conditions = append(conditions, fmt.Sprintf("provider = $%d", argIdx))
+		args = append(args, *filter.Provider)
+		argIdx++
+	}
+	if filter.UpstreamID != nil {
+		conditions = append(conditions, fmt.Sprintf("upstream_id = $%d", argIdx))
+		args = append(args, *filter.UpstreamID)
+		argIdx++
+	}
+	if filter.IsActive != nil {
+		conditions = append(conditions, fmt.Sprintf("is_active = $%d", argIdx))
+		args = append(args, *filter.IsActive)
+		argIdx++
+	}
+	if filter.Stale != nil {
+		conditions = append(conditions, fmt.Sprintf("(stale_since IS NOT NULL) = $%d", argIdx))
+		args = append(args, *filter.Stale)
+		argIdx++
+	}
+	if filter.Search != nil {
+		conditions = append(conditions, fmt.Sprintf("(name ILIKE $%d OR display_name ILIKE $%d)", argIdx, argIdx))
+		args = append(args, "%"+escapeLike(*filter.Search)+"%")
+		argIdx++
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	order, err := orderBy(filter.Sort, modelSortColumns, "name")
+	if err != nil {
+		return nil, 0, err
+	}
+	limit, limitArgs := limitOffset(filter.Page, filter.PerPage, argIdx)
+	args = append(args, limitArgs...)
+
+	query := fmt.Sprintf(`
+		SELECT id, name, display_name, provider, upstream_id, input_cost_per_million, output_cost_per_million, web_search_cost_per_1k, embedding_cost_per_million, reasoning_cost_per_million, is_active, availability, context_window, max_output_tokens, default_max_tokens, tokenizer, aliases, fallback_upstream_ids, stale_since, created_at, updated_at,
+		       COUNT(*) OVER() as total
+		FROM models %s
+		ORDER BY %s
+		%s`, where, order, limit)
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list models: %w", err)
+	}
+	defer rows.Close()
+
+	models := make([]Model, 0)
+	var total int
+	for rows.Next() {
+		var m Model
+		if err := rows.Scan(
+			&m.ID, &m.Name, &m.DisplayName, &m.Provider, &m.UpstreamID,
+			&m.InputCostPerMillion, &m.OutputCostPerMillion, &m.WebSearchCostPer1K, &m.EmbeddingCostPerMillion, &m.ReasoningCostPerMillion,
+			&m.IsActive, &m.Availability, &m.ContextWindow, &m.MaxOutputTokens, &m.DefaultMaxTokens, &m.Tokenizer, &m.Aliases, &m.FallbackUpstreamIDs, &m.StaleSince, &m.CreatedAt, &m.UpdatedAt,
+			&total,
+		); err != nil {
+			return nil, 0, fmt.Errorf("scan model: %w", err)
+		}
+		models = append(models, m)
+	}
+	return models, total, rows.Err()
+}
+
+func (s *Postgres) GetModel(ctx context.Context, id uuid.UUID) (*Model, error) {
 	var m Model
 	err := s.pool.QueryRow(ctx, `
-		SELECT id, name, display_name, provider, upstream_id, input_cost_per_million, output_cost_per_million, is_active, created_at, updated_at
+		SELECT id, name, display_name, provider, upstream_id, input_cost_per_million, output_cost_per_million, web_search_cost_per_1k, embedding_cost_per_million, reasoning_cost_per_million, is_active, availability, context_window, max_output_tokens, default_max_tokens, tokenizer, aliases, fallback_upstream_ids, stale_since, created_at, updated_at
 		FROM models WHERE id = $1
 	`, id).Scan(
 		&m.ID, &m.Name, &m.DisplayName, &m.Provider, &m.UpstreamID,
-		&m.InputCostPerMillion, &m.OutputCostPerMillion,
-		&m.IsActive, &m.CreatedAt, &m.UpdatedAt,
+		&m.InputCostPerMillion, &m.OutputCostPerMillion, &m.WebSearchCostPer1K, &m.EmbeddingCostPerMillion, &m.ReasoningCostPerMillion,
+		&m.IsActive, &m.Availability, &m.ContextWindow, &m.MaxOutputTokens, &m.DefaultMaxTokens, &m.Tokenizer, &m.Aliases, &m.FallbackUpstreamIDs, &m.StaleSince, &m.CreatedAt, &m.UpdatedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -93,15 +241,64 @@ func (s *Store) GetModel(ctx context.Context, id uuid.UUID) (*Model, error) {
 	return &m, nil
 }
 
-func (s *Store) GetModelByName(ctx context.Context, name string) (*Model, error) {
+// IsAliasPattern reports whether alias is a wildcard pattern rather than a
+// name.
+func IsAliasPattern(alias string) bool {
+	return strings.Contains(alias, "*")
+}
+
+// MatchAliasPattern reports whether name matches pattern, in which each "*"
+// matches any run of characters, "/" included. Both are compared as given,
+// so callers lowercase them.
+func MatchAliasPattern(pattern, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == name
+	}
+	first, last := parts[0], parts[len(parts)-1]
+	if len(name) < len(first)+len(last) || !strings.HasPrefix(name, first) || !strings.HasSuffix(name, last) {
+		return false
+	}
+	rest := name[len(first) : len(name)-len(last)]
+	for _, p := range parts[1 : len(parts)-1] {
+		i := strings.Index(rest, p)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(p):]
+	}
+	return true
+}
+
+// modelMatchSQL matches models m by name or alias against $1, and
+// modelMatchOrder picks among them: a name match wins over an alias, and
+// an alias over wildcard aliases, of which the longest wins. "*" becomes
+// LIKE's "%" once LIKE's own wildcards are escaped.
+const (
+	modelMatchSQL = `
+		LEFT JOIN LATERAL (
+			SELECT max(length(a)) AS len FROM unnest(m.aliases) a
+			WHERE strpos(a, '*') > 0
+			  AND lower($1) LIKE replace(replace(replace(replace(a, '\', '\\'), '%', '\%'), '_', '\_'), '*', '%')
+		) pattern ON true`
+	modelMatchWhere = `(lower(m.name) = lower($1) OR m.aliases @> ARRAY[lower($1)] OR pattern.len IS NOT NULL)`
+	modelMatchOrder = `lower(m.name) = lower($1) DESC, m.aliases @> ARRAY[lower($1)] DESC, pattern.len DESC NULLS LAST, m.id`
+)
+
+// GetModelByName looks a model up by name or alias, case-insensitively. A
+// name match wins over an alias match, and an alias over a wildcard alias.
+func (s *Postgres) GetModelByName(ctx context.Context, name string) (*Model, error) {
 	var m Model
 	err := s.pool.QueryRow(ctx, `
-		SELECT id, name, display_name, provider, upstream_id, input_cost_per_million, output_cost_per_million, is_active, created_at, updated_at
-		FROM models WHERE name = $1
+		SELECT m.id, m.name, m.display_name, m.provider, m.upstream_id, m.input_cost_per_million, m.output_cost_per_million, m.web_search_cost_per_1k, m.embedding_cost_per_million, m.reasoning_cost_per_million, m.is_active, m.availability, m.context_window, m.max_output_tokens, m.default_max_tokens, m.tokenizer, m.aliases, m.fallback_upstream_ids, m.stale_since, m.created_at, m.updated_at
+		FROM models m`+modelMatchSQL+`
+		WHERE `+modelMatchWhere+`
+		ORDER BY `+modelMatchOrder+`
+		LIMIT 1
 	`, name).Scan(
 		&m.ID, &m.Name, &m.DisplayName, &m.Provider, &m.UpstreamID,
-		&m.InputCostPerMillion, &m.OutputCostPerMillion,
-		&m.IsActive, &m.CreatedAt, &m.UpdatedAt,
+		&m.InputCostPerMillion, &m.OutputCostPerMillion, &m.WebSearchCostPer1K, &m.EmbeddingCostPerMillion, &m.ReasoningCostPerMillion,
+		&m.IsActive, &m.Availability, &m.ContextWindow, &m.MaxOutputTokens, &m.DefaultMaxTokens, &m.Tokenizer, &m.Aliases, &m.FallbackUpstreamIDs, &m.StaleSince, &m.CreatedAt, &m.UpdatedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -112,16 +309,17 @@ func (s *Store) GetModelByName(ctx context.Context, name string) (*Model, error)
 	return &m, nil
 }
 
-func (s *Store) CreateModel(ctx context.Context, mc *ModelCreate) (*Model, error) {
+func (s *Postgres) CreateModel(ctx context.Context, mc *ModelCreate) (*Model, error) {
 	var m Model
 	err := s.pool.QueryRow(ctx, `
-		INSERT INTO models (name, display_name, provider, upstream_id, input_cost_per_million, output_cost_per_million)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, name, display_name, provider, upstream_id, input_cost_per_million, output_cost_per_million, is_active, created_at, updated_at
-	`, mc.Name, mc.DisplayName, mc.Provider, mc.UpstreamID, mc.InputCostPerMillion, mc.OutputCostPerMillion).Scan(
+		INSERT INTO models (name, display_name, provider, upstream_id, input_cost_per_million, output_cost_per_million, web_search_cost_per_1k, embedding_cost_per_million, reasoning_cost_per_million, availability, context_window, max_output_tokens, default_max_tokens, tokenizer, aliases, fallback_upstream_ids)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, COALESCE($15, '{}'::text[]), COALESCE($16, '{}'::uuid[]))
+		RETURNING id, name, display_name, provider, upstream_id, input_cost_per_million, output_cost_per_million, web_search_cost_per_1k, embedding_cost_per_million, reasoning_cost_per_million, is_active, availability, context_window, max_output_tokens, default_max_tokens, tokenizer, aliases, fallback_upstream_ids, stale_since, created_at, updated_at
+	`, mc.Name, mc.DisplayName, mc.Provider, mc.UpstreamID, mc.InputCostPerMillion, mc.OutputCostPerMillion, mc.WebSearchCostPer1K, mc.EmbeddingCostPerMillion, mc.ReasoningCostPerMillion, mc.Availability,
+		mc.ContextWindow, mc.MaxOutputTokens, mc.DefaultMaxTokens, mc.Tokenizer, mc.Aliases, mc.FallbackUpstreamIDs).Scan(
 		&m.ID, &m.Name, &m.DisplayName, &m.Provider, &m.UpstreamID,
-		&m.InputCostPerMillion, &m.OutputCostPerMillion,
-		&m.IsActive, &m.CreatedAt, &m.UpdatedAt,
+		&m.InputCostPerMillion, &m.OutputCostPerMillion, &m.WebSearchCostPer1K, &m.EmbeddingCostPerMillion, &m.ReasoningCostPerMillion,
+		&m.IsActive, &m.Availability, &m.ContextWindow, &m.MaxOutputTokens, &m.DefaultMaxTokens, &m.Tokenizer, &m.Aliases, &m.FallbackUpstreamIDs, &m.StaleSince, &m.CreatedAt, &m.UpdatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("create model: %w", err)
@@ -129,7 +327,7 @@ func (s *Store) CreateModel(ctx context.Context, mc *ModelCreate) (*Model, error
 	return &m, nil
 }
 
-func (s *Store) UpdateModel(ctx context.Context, id uuid.UUID, u *ModelUpdate) error {
+func (s *Postgres) UpdateModel(ctx context.Context, id uuid.UUID, u *ModelUpdate) error {
 	sets := []string{}
 	args := []any{}
 	argIdx := 1
@@ -164,11 +362,62 @@ func (s *Store) UpdateModel(ctx context.Context, id uuid.UUID, u *ModelUpdate) e
 		args = append(args, *u.OutputCostPerMillion)
 		argIdx++
 	}
+	if u.WebSearchCostPer1K != nil {
+		sets = append(sets, fmt.Sprintf("web_search_cost_per_1k = $%d", argIdx))
+		args = append(args, *u.WebSearchCostPer1K)
+		argIdx++
+	}
+	if u.EmbeddingCostPerMillion != nil {
+		sets = append(sets, fmt.Sprintf("embedding_cost_per_million = $%d", argIdx))
+		args = append(args, *u.EmbeddingCostPerMillion)
+		argIdx++
+	}
+	if u.ReasoningCostPerMillion != nil {
+		sets = append(sets, fmt.Sprintf("reasoning_cost_per_million = $%d", argIdx))
+		args = append(args, *u.ReasoningCostPerMillion)
+		argIdx++
+	}
 	if u.IsActive != nil {
 		sets = append(sets, fmt.Sprintf("is_active = $%d", argIdx))
 		args = append(args, *u.IsActive)
 		argIdx++
 	}
+	if u.Availability != nil {
+		sets = append(sets, fmt.Sprintf("availability = $%d", argIdx))
+		args = append(args, *u.Availability)
+		argIdx++
+	}
+	if u.ContextWindow != nil {
+		sets = append(sets, fmt.Sprintf("context_window = $%d", argIdx))
+		args = append(args, *u.ContextWindow)
+		argIdx++
+	}
+	if u.MaxOutputTokens != nil {
+		sets = append(sets, fmt.Sprintf("max_output_tokens = $%d", argIdx))
+		args = append(args, *u.MaxOutputTokens)
+		argIdx++
+	}
+	if u.DefaultMaxTokens != nil {
+		sets = append(sets, fmt.Sprintf("default_max_tokens = $%d", argIdx))
+		args = append(args, *u.DefaultMaxTokens)
+		argIdx++
+	}
+	if u.Tokenizer != nil {
+		// An empty string clears the override.
+		sets = append(sets, fmt.Sprintf("tokenizer = NULLIF($%d, '')", argIdx))
+		args = append(args, *u.Tokenizer)
+		argIdx++
+	}
+	if u.Aliases != nil {
+		sets = append(sets, fmt.Sprintf("aliases = COALESCE($%d, '{}'::text[])", argIdx))
+		args = append(args, *u.Aliases)
+		argIdx++
+	}
+	if u.FallbackUpstreamIDs != nil {
+		sets = append(sets, fmt.Sprintf("fallback_upstream_ids = COALESCE($%d, '{}'::uuid[])", argIdx))
+		args = append(args, *u.FallbackUpstreamIDs)
+		argIdx++
+	}
 
 	if len(sets) == 0 {
 		return nil
@@ -185,7 +434,7 @@ func (s *Store) UpdateModel(ctx context.Context, id uuid.UUID, u *ModelUpdate) e
 	return nil
 }
 
-func (s *Store) DeleteModel(ctx context.Context, id uuid.UUID) error {
+func (s *Postgres) DeleteModel(ctx context.Context, id uuid.UUID) error {
 	_, err := s.pool.Exec(ctx, "DELETE FROM models WHERE id = $1", id)
 	if err != nil {
 		return fmt.Errorf("delete model: %w", err)
@@ -193,7 +442,7 @@ func (s *Store) DeleteModel(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-func (s *Store) DeleteModels(ctx context.Context, ids []uuid.UUID) (int64, error) {
+func (s *Postgres) DeleteModels(ctx context.Context, ids []uuid.UUID) (int64, error) {
 	ct, err := s.pool.Exec(ctx, "DELETE FROM models WHERE id = ANY($1)", ids)
 	if err != nil {
 		return 0, fmt.Errorf("delete models: %w", err)
@@ -201,23 +450,69 @@ func (s *Store) DeleteModels(ctx context.Context, ids []uuid.UUID) (int64, error
 	return ct.RowsAffected(), nil
 }
 
+// MarkStaleModels sets stale_since on the models linked to upstreamID
+// whose name is not in listed, compared case-insensitively, and clears it
+// on the others. Models already flagged keep the time they went missing.
+func (s *Postgres) MarkStaleModels(ctx context.Context, upstreamID uuid.UUID, listed []string) error {
+	lower := make([]string, len(listed))
+	for i, n := range listed {
+		lower[i] = strings.ToLower(n)
+	}
+	_, err := s.pool.Exec(ctx, `
+		UPDATE models
+		SET stale_since = CASE WHEN lower(name) = ANY($2) THEN NULL ELSE now() END
+		WHERE upstream_id = $1 AND (lower(name) = ANY($2)) = (stale_since IS NOT NULL)
+	`, upstreamID, lower)
+	if err != nil {
+		return fmt.Errorf("mark stale models: %w", err)
+	}
+	return nil
+}
+
+// ModelNameConflict returns the name of a model, other than exclude, whose
+// name or aliases match any of names case-insensitively, or "" if none does.
+func (s *Postgres) ModelNameConflict(ctx context.Context, names []string, exclude *uuid.UUID) (string, error) {
+	lower := make([]string, len(names))
+	for i, n := range names {
+		lower[i] = strings.ToLower(n)
+	}
+	var name string
+	err := s.pool.QueryRow(ctx, `
+		SELECT name FROM models
+		WHERE (lower(name) = ANY($1) OR aliases && $1::text[])
+		  AND ($2::uuid IS NULL OR id <> $2)
+		LIMIT 1
+	`, lower, exclude).Scan(&name)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("check model name conflict: %w", err)
+	}
+	return name, nil
+}
+
 // GetModelWithUpstream joins models with their linked upstream in a single
-// query. Returns nil if the model doesn't exist or has no linked upstream.
-func (s *Store) GetModelWithUpstream(ctx context.Context, modelName string) (*ModelWithUpstream, error) {
+// query. The model is matched like GetModelByName. Returns nil if the model
+// doesn't exist or has no linked upstream.
+func (s *Postgres) GetModelWithUpstream(ctx context.Context, modelName string) (*ModelWithUpstream, error) {
 	var mw ModelWithUpstream
 	err := s.pool.QueryRow(ctx, `
 		SELECT m.id, m.name, m.display_name, m.provider, m.upstream_id,
-		       m.input_cost_per_million, m.output_cost_per_million,
-		       m.is_active, m.created_at, m.updated_at,
-		       u.base_url, u.api_key_encrypted, u.format
+		       m.input_cost_per_million, m.output_cost_per_million, m.web_search_cost_per_1k, m.embedding_cost_per_million, m.reasoning_cost_per_million,
+		       m.is_active, m.availability, m.context_window, m.max_output_tokens, m.default_max_tokens, m.tokenizer, m.aliases, m.fallback_upstream_ids, m.stale_since, m.created_at, m.updated_at,
+		       u.base_url, u.api_key_encrypted, u.format, u.availability, COALESCE(u.region, ''), u.role_map, u.service_tiers, u.max_sse_frame_bytes, u.disable_compression, u.extension, u.stream_idle_timeout_seconds, u.anthropic_betas, u.resilience
 		FROM models m
-		JOIN upstreams u ON u.id = m.upstream_id
-		WHERE m.name = $1 AND m.is_active = true AND u.is_active = true
+		JOIN upstreams u ON u.id = m.upstream_id`+modelMatchSQL+`
+		WHERE `+modelMatchWhere+`
+		  AND m.is_active = true AND u.is_active = true
+		ORDER BY `+modelMatchOrder+`
+		LIMIT 1
 	`, modelName).Scan(
 		&mw.ID, &mw.Name, &mw.DisplayName, &mw.Provider, &mw.UpstreamID,
-		&mw.InputCostPerMillion, &mw.OutputCostPerMillion,
-		&mw.IsActive, &mw.CreatedAt, &mw.UpdatedAt,
-		&mw.UpstreamBaseURL, &mw.UpstreamAPIKey, &mw.UpstreamFormat,
+		&mw.InputCostPerMillion, &mw.OutputCostPerMillion, &mw.WebSearchCostPer1K, &mw.EmbeddingCostPerMillion, &mw.ReasoningCostPerMillion,
+		&mw.IsActive, &mw.Availability, &mw.ContextWindow, &mw.MaxOutputTokens, &mw.DefaultMaxTokens, &mw.Tokenizer, &mw.Aliases, &mw.FallbackUpstreamIDs, &mw.StaleSince, &mw.CreatedAt, &mw.UpdatedAt,
+		&mw.UpstreamBaseURL, &mw.UpstreamAPIKey, &mw.UpstreamFormat, &mw.UpstreamAvailability, &mw.UpstreamRegion, &mw.UpstreamRoleMap, &mw.UpstreamServiceTiers, &mw.UpstreamMaxSSEFrameBytes, &mw.UpstreamDisableCompression, &mw.UpstreamExtension, &mw.UpstreamStreamIdleTimeoutSeconds, &mw.UpstreamAnthropicBetas, &mw.UpstreamResilience,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -226,17 +521,20 @@ func (s *Store) GetModelWithUpstream(ctx context.Context, modelName string) (*Mo
 		return nil, fmt.Errorf("get model with upstream: %w", err)
 	}
 	mw.UpstreamAPIKey = s.decryptAPIKey(mw.UpstreamAPIKey)
+	if err := s.attachFallbacks(ctx, []*ModelWithUpstream{&mw}); err != nil {
+		return nil, err
+	}
 	return &mw, nil
 }
 
 // ListActiveModelsWithUpstream returns all active models joined with their
 // active upstream configuration.
-func (s *Store) ListActiveModelsWithUpstream(ctx context.Context) ([]*ModelWithUpstream, error) {
+func (s *Postgres) ListActiveModelsWithUpstream(ctx context.Context) ([]*ModelWithUpstream, error) {
 	rows, err := s.pool.Query(ctx, `
 		SELECT m.id, m.name, m.display_name, m.provider, m.upstream_id,
-		       m.input_cost_per_million, m.output_cost_per_million,
-		       m.is_active, m.created_at, m.updated_at,
-		       u.base_url, u.api_key_encrypted, u.format
+		       m.input_cost_per_million, m.output_cost_per_million, m.web_search_cost_per_1k, m.embedding_cost_per_million, m.reasoning_cost_per_million,
+		       m.is_active, m.availability, m.context_window, m.max_output_tokens, m.default_max_tokens, m.tokenizer, m.aliases, m.fallback_upstream_ids, m.stale_since, m.created_at, m.updated_at,
+		       u.base_url, u.api_key_encrypted, u.format, u.availability, COALESCE(u.region, ''), u.role_map, u.service_tiers, u.max_sse_frame_bytes, u.disable_compression, u.extension, u.stream_idle_timeout_seconds, u.anthropic_betas, u.resilience
 		FROM models m
 		JOIN upstreams u ON u.id = m.upstream_id
 		WHERE m.is_active = true AND u.is_active = true
@@ -251,9 +549,9 @@ func (s *Store) ListActiveModelsWithUpstream(ctx context.Context) ([]*ModelWithU
 		var mw ModelWithUpstream
 		if err := rows.Scan(
 			&mw.ID, &mw.Name, &mw.DisplayName, &mw.Provider, &mw.UpstreamID,
-			&mw.InputCostPerMillion, &mw.OutputCostPerMillion,
-			&mw.IsActive, &mw.CreatedAt, &mw.UpdatedAt,
-			&mw.UpstreamBaseURL, &mw.UpstreamAPIKey, &mw.UpstreamFormat,
+			&mw.InputCostPerMillion, &mw.OutputCostPerMillion, &mw.WebSearchCostPer1K, &mw.EmbeddingCostPerMillion, &mw.ReasoningCostPerMillion,
+			&mw.IsActive, &mw.Availability, &mw.ContextWindow, &mw.MaxOutputTokens, &mw.DefaultMaxTokens, &mw.Tokenizer, &mw.Aliases, &mw.FallbackUpstreamIDs, &mw.StaleSince, &mw.CreatedAt, &mw.UpdatedAt,
+			&mw.UpstreamBaseURL, &mw.UpstreamAPIKey, &mw.UpstreamFormat, &mw.UpstreamAvailability, &mw.UpstreamRegion, &mw.UpstreamRoleMap, &mw.UpstreamServiceTiers, &mw.UpstreamMaxSSEFrameBytes, &mw.UpstreamDisableCompression, &mw.UpstreamExtension, &mw.UpstreamStreamIdleTimeoutSeconds, &mw.UpstreamAnthropicBetas, &mw.UpstreamResilience,
 		); err != nil {
 			return nil, fmt.Errorf("scan active model with upstream: %w", err)
 		}
@@ -264,5 +562,63 @@ func (s *Store) ListActiveModelsWithUpstream(ctx context.Context) ([]*ModelWithU
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("iterate active models with upstream: %w", err)
 	}
+	if err := s.attachFallbacks(ctx, models); err != nil {
+		return nil, err
+	}
 	return models, nil
 }
+
+// attachFallbacks fills in the Fallbacks of models from their fallback
+// upstream IDs, skipping inactive upstreams and each model's own.
+func (s *Postgres) attachFallbacks(ctx context.Context, models []*ModelWithUpstream) error {
+	var ids []uuid.UUID
+	for _, mw := range models {
+		ids = append(ids, mw.FallbackUpstreamIDs...)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, name, base_url, api_key_encrypted, format, is_active, priority, availability, region, role_map, service_tiers, max_sse_frame_bytes, auto_import_models, disable_compression, extension, stream_idle_timeout_seconds, anthropic_betas, resilience, created_at, updated_at
+		FROM upstreams
+		WHERE id = ANY($1) AND is_active = true
+		ORDER BY priority DESC, name
+	`, ids)
+	if err != nil {
+		return fmt.Errorf("list fallback upstreams: %w", err)
+	}
+	defer rows.Close()
+
+	var upstreams []Upstream
+	for rows.Next() {
+		var u Upstream
+		if err := rows.Scan(
+			&u.ID, &u.Name, &u.BaseURL, &u.APIKeyEncrypted,
+			&u.Format, &u.IsActive, &u.Priority, &u.Availability, &u.Region, &u.RoleMap, &u.ServiceTiers, &u.MaxSSEFrameBytes, &u.AutoImportModels, &u.DisableCompression, &u.Extension, &u.StreamIdleTimeoutSeconds, &u.AnthropicBetas, &u.Resilience, &u.CreatedAt, &u.UpdatedAt,
+		); err != nil {
+			return fmt.Errorf("scan fallback upstream: %w", err)
+		}
+		u.APIKeyEncrypted = s.decryptAPIKey(u.APIKeyEncrypted)
+		upstreams = append(upstreams, u)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate fallback upstreams: %w", err)
+	}
+
+	for _, mw := range models {
+		mw.Fallbacks = fallbacksOf(&mw.Model, upstreams)
+	}
+	return nil
+}
+
+// fallbacksOf returns the upstreams, already in fallback order, that are
+// among mo's fallbacks and are not its own upstream.
+func fallbacksOf(mo *Model, upstreams []Upstream) []Upstream {
+	var out []Upstream
+	for _, u := range upstreams {
+		if slices.Contains(mo.FallbackUpstreamIDs, u.ID) && (mo.UpstreamID == nil || *mo.UpstreamID != u.ID) {
+			out = append(out, u)
+		}
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// LogPayload is the request and response bodies captured for a request
+// log. Bodies longer than the capture limit are cut short; the sizes are
+// those of the whole bodies.
+type LogPayload struct {
+	LogID         uuid.UUID `json:"log_id"`
+	Request       string    `json:"request_body"`
+	Response      string    `json:"response_body"`
+	RequestBytes  int       `json:"request_bytes"`
+	ResponseBytes int       `json:"response_bytes"`
+	Redacted      bool      `json:"redacted"` // credentials and email addresses were masked
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// GetLogPayload returns the bodies captured for a request log, or nil if
+// none were.
+func (s *Postgres) GetLogPayload(ctx context.Context, logID uuid.UUID) (*LogPayload, error) {
+	var p LogPayload
+	err := s.pool.QueryRow(ctx, `
+		SELECT log_id, request_body, response_body, request_bytes, response_bytes, redacted, created_at
+		FROM request_payloads WHERE log_id = $1
+	`, logID).Scan(&p.LogID, &p.Request, &p.Response, &p.RequestBytes, &p.ResponseBytes, &p.Redacted, &p.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get log payload: %w", err)
+	}
+	return &p, nil
+}
+
+// DeleteOldPayloads deletes captured bodies older than olderThan, keeping
+// their logs.
+func (s *Postgres) DeleteOldPayloads(ctx context.Context, olderThan time.Time) (int64, error) {
+	ct, err := s.pool.Exec(ctx, "DELETE FROM request_payloads WHERE created_at < $1", olderThan)
+	if err != nil {
+		return 0, fmt.Errorf("delete old payloads: %w", err)
+	}
+	return ct.RowsAffected(), nil
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// UpstreamPin sends a key's requests, or every key's when KeyID is nil, to
+// one upstream whatever model they ask for, until ExpiresAt. It is an
+// escape hatch for provider incidents.
+type UpstreamPin struct {
+	ID           uuid.UUID  `json:"id"`
+	KeyID        *uuid.UUID `json:"llm_key_id"` // nil pins every key
+	UpstreamID   uuid.UUID  `json:"upstream_id"`
+	UpstreamName string     `json:"upstream_name"`
+	Reason       string     `json:"reason"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type UpstreamPinCreate struct {
+	KeyID      *uuid.UUID `json:"llm_key_id"`
+	UpstreamID uuid.UUID  `json:"upstream_id"`
+	Reason     string     `json:"reason"`
+	ExpiresAt  time.Time  `json:"-"`
+}
+
+const pinColumns = `p.id, p.llm_key_id, p.upstream_id, u.name, p.reason, p.expires_at, p.created_at`
+
+func scanPin(row pgx.Row, p *UpstreamPin) error {
+	return row.Scan(&p.ID, &p.KeyID, &p.UpstreamID, &p.UpstreamName, &p.Reason, &p.ExpiresAt, &p.CreatedAt)
+}
+
+// ListUpstreamPins returns the pins that have not expired, the pin for all
+// keys first.
+func (s *Postgres) ListUpstreamPins(ctx context.Context) ([]UpstreamPin, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+pinColumns+`
+		FROM upstream_pins p
+		JOIN upstreams u ON u.id = p.upstream_id
+		WHERE p.expires_at > now()
+		ORDER BY p.llm_key_id NULLS FIRST, p.created_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list upstream pins: %w", err)
+	}
+	defer rows.Close()
+
+	pins := []UpstreamPin{}
+	for rows.Next() {
+		var p UpstreamPin
+		if err := scanPin(rows, &p); err != nil {
+			return nil, fmt.Errorf("scan upstream pin: %w", err)
+		}
+		pins = append(pins, p)
+	}
+	return pins, rows.Err()
+}
+
+// CreateUpstreamPin pins a key, or every key, replacing its current pin.
+// Expired pins are cleared on the way.
+func (s *Postgres) CreateUpstreamPin(ctx context.Context, pc *UpstreamPinCreate) (*UpstreamPin, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM upstream_pins WHERE expires_at <= now()`); err != nil {
+		return nil, fmt.Errorf("delete expired pins: %w", err)
+	}
+	var id uuid.UUID
+	err = tx.QueryRow(ctx, `
+		INSERT INTO upstream_pins (llm_key_id, upstream_id, reason, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT ((COALESCE(llm_key_id, '00000000-0000-0000-0000-000000000000'::uuid))) DO UPDATE SET
+			upstream_id = EXCLUDED.upstream_id,
+			reason = EXCLUDED.reason,
+			expires_at = EXCLUDED.expires_at,
+			created_at = now()
+		RETURNING id
+	`, pc.KeyID, pc.UpstreamID, pc.Reason, pc.ExpiresAt).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("create upstream pin: %w", err)
+	}
+
+	var p UpstreamPin
+	err = scanPin(tx.QueryRow(ctx, `
+		SELECT `+pinColumns+`
+		FROM upstream_pins p
+		JOIN upstreams u ON u.id = p.upstream_id
+		WHERE p.id = $1
+	`, id), &p)
+	if err != nil {
+		return nil, fmt.Errorf("get upstream pin: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+	return &p, nil
+}
+
+// DeleteUpstreamPin removes a pin before it expires. It reports whether the
+// pin existed.
+func (s *Postgres) DeleteUpstreamPin(ctx context.Context, id uuid.UUID) (bool, error) {
+	ct, err := s.pool.Exec(ctx, `DELETE FROM upstream_pins WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("delete upstream pin: %w", err)
+	}
+	return ct.RowsAffected() > 0, nil
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Policy is an admission rule evaluated by the proxy before dispatch.
+// Expression must evaluate to a bool; when it is true, Action is applied.
+type Policy struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Expression  string    `json:"expression"`
+	Action      string    `json:"action"` // allow, deny, route, cap, filter
+	TargetModel *string   `json:"target_model"`
+	MaxTokens   *int      `json:"max_tokens"`
+	Message     *string   `json:"message"`
+	Priority    int       `json:"priority"`
+	IsActive    bool      `json:"is_active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type PolicyCreate struct {
+	Name        string  `json:"name"`
+	Expression  string  `json:"expression"`
+	Action      string  `json:"action"`
+	TargetModel *string `json:"target_model"`
+	MaxTokens   *int    `json:"max_tokens"`
+	Message     *string `json:"message"`
+	Priority    int     `json:"priority"`
+}
+
+type PolicyUpdate struct {
+	Name        *string `json:"name,omitempty"`
+	Expression  *string `json:"expression,omitempty"`
+	Action      *string `json:"action,omitempty"`
+	TargetModel *string `json:"target_model,omitempty"`
+	MaxTokens   *int    `json:"max_tokens,omitempty"`
+	Message     *string `json:"message,omitempty"`
+	Priority    *int    `json:"priority,omitempty"`
+	IsActive    *bool   `json:"is_active,omitempty"`
+}
+
+const policyColumns = `id, name, expression, action, target_model, max_tokens, message, priority, is_active, created_at, updated_at`
+
+func scanPolicy(row pgx.Row, p *Policy) error {
+	return row.Scan(
+		&p.ID, &p.Name, &p.Expression, &p.Action, &p.TargetModel, &p.MaxTokens,
+		&p.Message, &p.Priority, &p.IsActive, &p.CreatedAt, &p.UpdatedAt,
+	)
+}
+
+// ListPolicies returns all policies in evaluation order.
+func (s *Postgres) ListPolicies(ctx context.Context) ([]Policy, error) {
+	rows, err := s.pool.Query(ctx, `SELECT `+policyColumns+` FROM policies ORDER BY priority DESC, name`)
+	if err != nil {
+		return nil, fmt.Errorf("list policies: %w", err)
+	}
+	defer rows.Close()
+
+	policies := make([]Policy, 0)
+	for rows.Next() {
+		var p Policy
+		if err := scanPolicy(rows, &p); err != nil {
+			return nil, fmt.Errorf("scan policy: %w", err)
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+func (s *Postgres) GetPolicy(ctx context.Context, id uuid.UUID) (*Policy, error) {
+	var p Policy
+	err := scanPolicy(s.pool.QueryRow(ctx, `SELECT `+policyColumns+` FROM policies WHERE id = $1`, id), &p)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get policy: %w", err)
+	}
+	return &p, nil
+}
+
+func (s *Postgres) CreatePolicy(ctx context.Context, pc *PolicyCreate) (*Policy, error) {
+	var p Policy
+	err := scanPolicy(s.pool.QueryRow(ctx, `
+		INSERT INTO policies (name, expression, action, target_model, max_tokens, message, priority)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+policyColumns,
+		pc.Name, pc.Expression, pc.Action, pc.TargetModel, pc.MaxTokens, pc.Message, pc.Priority,
+	), &p)
+	if err != nil {
+		return nil, fmt.Errorf("create policy: %w", err)
+	}
+	return &p, nil
+}
+
+func (s *Postgres) UpdatePolicy(ctx context.Context, id uuid.UUID, upd *PolicyUpdate) error {
+	sets := []string{}
+	args := []any{}
+	argIdx := 1
+
+	add := func(col string, v any) {
+		sets = append(sets, fmt.Sprintf("%s = $%d", col, argIdx))
+		args = append(args, v)
+		argIdx++
+	}
+	if upd.Name != nil {
+		add("name", *upd.Name)
+	}
+	if upd.Expression != nil {
+		add("expression", *upd.Expression)
+	}
+	if upd.Action != nil {
+		add("action", *upd.Action)
+	}
+	if upd.TargetModel != nil {
+		add("target_model", *upd.TargetModel)
+	}
+	if upd.MaxTokens != nil {
+		add("max_tokens", *upd.MaxTokens)
+	}
+	if upd.Message != nil {
+		add("message", *upd.Message)
+	}
+	if upd.Priority != nil {
+		add("priority", *upd.Priority)
+	}
+	if upd.IsActive != nil {
+		add("is_active", *upd.IsActive)
+	}
+
+	if len(sets) == 0 {
+		return nil
+	}
+
+	sets = append(sets, "updated_at = now()")
+	args = append(args, id)
+
+	query := fmt.Sprintf("UPDATE policies SET %s WHERE id = $%d", strings.Join(sets, ", "), argIdx)
+	if _, err := s.pool.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("update policy: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) DeletePolicy(ctx context.Context, id uuid.UUID) error {
+	if _, err := s.pool.Exec(ctx, "DELETE FROM policies WHERE id = $1", id); err != nil {
+		return fmt.Errorf("delete policy: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package store
+
+import "fmt"
+
+// Request priorities a client can ask for, lowest first.
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// PriorityRank orders priorities: 1 for low up to 3 for high, 0 for anything
+// that is not a priority.
+func PriorityRank(p string) int {
+	switch p {
+	case PriorityLow:
+		return 1
+	case PriorityNormal:
+		return 2
+	case PriorityHigh:
+		return 3
+	}
+	return 0
+}
+
+// ServiceTiers maps request priorities to the service_tier sent to an
+// upstream, e.g. {"low": "flex", "high": "priority"} for OpenAI or
+// {"low": "standard_only"} for Anthropic. Priorities without an entry leave
+// the request's service_tier alone. Stored as JSONB.
+type ServiceTiers map[string]string
+
+// Validate checks that only known priorities are mapped, to non-empty tiers.
+func (t ServiceTiers) Validate() error {
+	for p, tier := range t {
+		if PriorityRank(p) == 0 {
+			return fmt.Errorf("cannot map priority %q, use low, normal or high", p)
+		}
+		if tier == "" {
+			return fmt.Errorf("service tier for priority %q must not be empty", p)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidSort is returned by list queries when the requested sort field
+// is not one of the allowed columns.
+var ErrInvalidSort = errors.New("invalid sort field")
+
+// orderBy builds an ORDER BY expression from a sort spec such as "name" or
+// "-created_at" (leading "-" means descending). An empty spec returns def.
+// Only fields present in columns are accepted, so user input never reaches
+// the query text directly.
+func orderBy(sort string, columns map[string]string, def string) (string, error) {
+	if sort == "" {
+		return def, nil
+	}
+	dir := "ASC"
+	field := sort
+	if strings.HasPrefix(sort, "-") {
+		dir = "DESC"
+		field = sort[1:]
+	}
+	col, ok := columns[field]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrInvalidSort, field)
+	}
+	// Tie-break on id so pages are stable when the sort column has duplicates.
+	return fmt.Sprintf("%s %s, id", col, dir), nil
+}
+
+// limitOffset returns a LIMIT/OFFSET clause for the given page, or an empty
+// string when perPage <= 0 (return all rows).
+func limitOffset(page, perPage, argIdx int) (string, []any) {
+	if perPage <= 0 {
+		return "", nil
+	}
+	if page < 1 {
+		page = 1
+	}
+	return fmt.Sprintf("LIMIT $%d OFFSET $%d", argIdx, argIdx+1), []any{perPage, (page - 1) * perPage}
+}
+
+// escapeLike escapes LIKE/ILIKE wildcards so search terms match literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,40 @@
+package store
+
+import "fmt"
+
+// ResiliencePolicy overrides the proxy-wide circuit breaker and retry
+// settings for one upstream. Nil fields keep cb_failure_threshold,
+// cb_timeout_seconds and retry_max_attempts; a threshold of 0 turns the
+// breaker off and 1 attempt turns retries off. RetryableStatusCodes lists
+// response statuses, such as 429 or 503, that are retried like connection
+// errors, in place of retry_status_codes, and RetryBudgetRatio replaces
+// retry_budget_ratio. Stored as JSONB.
+type ResiliencePolicy struct {
+	CBFailureThreshold   *int     `json:"cb_failure_threshold,omitempty"`
+	CBTimeoutSeconds     *int     `json:"cb_timeout_seconds,omitempty"`
+	RetryMaxAttempts     *int     `json:"retry_max_attempts,omitempty"`
+	RetryableStatusCodes []int    `json:"retryable_status_codes,omitempty"`
+	RetryBudgetRatio     *float64 `json:"retry_budget_ratio,omitempty"`
+}
+
+// Validate checks that every setting is in range.
+func (p *ResiliencePolicy) Validate() error {
+	if p.CBFailureThreshold != nil && *p.CBFailureThreshold < 0 {
+		return fmt.Errorf("cb_failure_threshold must be >= 0")
+	}
+	if p.CBTimeoutSeconds != nil && *p.CBTimeoutSeconds < 1 {
+		return fmt.Errorf("cb_timeout_seconds must be >= 1")
+	}
+	if p.RetryMaxAttempts != nil && (*p.RetryMaxAttempts < 1 || *p.RetryMaxAttempts > 10) {
+		return fmt.Errorf("retry_max_attempts must be between 1 and 10")
+	}
+	if p.RetryBudgetRatio != nil && (*p.RetryBudgetRatio < 0 || *p.RetryBudgetRatio > 1) {
+		return fmt.Errorf("retry_budget_ratio must be between 0 and 1")
+	}
+	for _, code := range p.RetryableStatusCodes {
+		if code < 400 || code > 599 {
+			return fmt.Errorf("invalid retryable status code %d", code)
+		}
+	}
+	return nil
+}
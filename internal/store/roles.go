@@ -0,0 +1,30 @@
+package store
+
+import "fmt"
+
+// RoleMap rewrites OpenAI message roles before a request is sent to an
+// OpenAI-format upstream, e.g. {"developer": "system"} for upstreams that
+// predate the developer role or {"system": "user"} for o1-style models that
+// reject system messages. Stored as JSONB; empty means roles are sent as-is.
+type RoleMap map[string]string
+
+// mappableRoles are the roles a RoleMap may rewrite, and roleTargets the
+// roles they may become.
+var (
+	mappableRoles = map[string]bool{"developer": true, "system": true}
+	roleTargets   = map[string]bool{"developer": true, "system": true, "user": true}
+)
+
+// Validate checks that only instruction roles are rewritten, to roles every
+// chat completions upstream understands.
+func (m RoleMap) Validate() error {
+	for from, to := range m {
+		if !mappableRoles[from] {
+			return fmt.Errorf("cannot map role %q, only developer and system can be mapped", from)
+		}
+		if !roleTargets[to] {
+			return fmt.Errorf("cannot map %q to %q, use developer, system or user", from, to)
+		}
+	}
+	return nil
+}
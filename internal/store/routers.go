@@ -0,0 +1,170 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ModelRouter is a virtual model: requests for it are served by the model
+// of its first matching rule, or by DefaultModel when none matches.
+type ModelRouter struct {
+	ID           uuid.UUID    `json:"id"`
+	Name         string       `json:"name"`
+	Rules        []RouterRule `json:"rules"`
+	DefaultModel string       `json:"default_model"`
+	IsActive     bool         `json:"is_active"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// RouterRule sends requests matching all of its set conditions to Model.
+// Input tokens are estimated from the request size. Stored as JSONB.
+type RouterRule struct {
+	MinInputTokens *int   `json:"min_input_tokens,omitempty"`
+	MaxInputTokens *int   `json:"max_input_tokens,omitempty"`
+	Tools          *bool  `json:"tools,omitempty"`    // the request declares tools
+	Images         *bool  `json:"images,omitempty"`   // the request has image input
+	Priority       string `json:"priority,omitempty"` // the request's effective priority
+	Model          string `json:"model"`
+}
+
+// ValidateRouterRules checks that every rule names a model and has
+// conditions in range.
+func ValidateRouterRules(rules []RouterRule) error {
+	for i, rule := range rules {
+		if rule.Model == "" {
+			return fmt.Errorf("rule %d: model is required", i)
+		}
+		if rule.MinInputTokens != nil && *rule.MinInputTokens < 0 || rule.MaxInputTokens != nil && *rule.MaxInputTokens < 0 {
+			return fmt.Errorf("rule %d: input token bounds must be >= 0", i)
+		}
+		if rule.MinInputTokens != nil && rule.MaxInputTokens != nil && *rule.MinInputTokens > *rule.MaxInputTokens {
+			return fmt.Errorf("rule %d: min_input_tokens is above max_input_tokens", i)
+		}
+		if rule.Priority != "" && PriorityRank(rule.Priority) == 0 {
+			return fmt.Errorf("rule %d: priority must be low, normal or high", i)
+		}
+	}
+	return nil
+}
+
+type ModelRouterCreate struct {
+	Name         string       `json:"name"`
+	Rules        []RouterRule `json:"rules"`
+	DefaultModel string       `json:"default_model"`
+}
+
+type ModelRouterUpdate struct {
+	Name         *string       `json:"name,omitempty"`
+	Rules        *[]RouterRule `json:"rules,omitempty"`
+	DefaultModel *string       `json:"default_model,omitempty"`
+	IsActive     *bool         `json:"is_active,omitempty"`
+}
+
+const routerColumns = `id, name, rules, default_model, is_active, created_at, updated_at`
+
+func scanRouter(row pgx.Row, mr *ModelRouter) error {
+	return row.Scan(&mr.ID, &mr.Name, &mr.Rules, &mr.DefaultModel, &mr.IsActive, &mr.CreatedAt, &mr.UpdatedAt)
+}
+
+// ListModelRouters returns all model routers by name.
+func (s *Postgres) ListModelRouters(ctx context.Context) ([]ModelRouter, error) {
+	rows, err := s.pool.Query(ctx, `SELECT `+routerColumns+` FROM model_routers ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list model routers: %w", err)
+	}
+	defer rows.Close()
+
+	routers := make([]ModelRouter, 0)
+	for rows.Next() {
+		var mr ModelRouter
+		if err := scanRouter(rows, &mr); err != nil {
+			return nil, fmt.Errorf("scan model router: %w", err)
+		}
+		routers = append(routers, mr)
+	}
+	return routers, rows.Err()
+}
+
+func (s *Postgres) GetModelRouter(ctx context.Context, id uuid.UUID) (*ModelRouter, error) {
+	var mr ModelRouter
+	err := scanRouter(s.pool.QueryRow(ctx, `SELECT `+routerColumns+` FROM model_routers WHERE id = $1`, id), &mr)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get model router: %w", err)
+	}
+	return &mr, nil
+}
+
+func (s *Postgres) CreateModelRouter(ctx context.Context, rc *ModelRouterCreate) (*ModelRouter, error) {
+	rules := rc.Rules
+	if rules == nil {
+		rules = []RouterRule{}
+	}
+	var mr ModelRouter
+	err := scanRouter(s.pool.QueryRow(ctx, `
+		INSERT INTO model_routers (name, rules, default_model)
+		VALUES ($1, $2, $3)
+		RETURNING `+routerColumns,
+		rc.Name, rules, rc.DefaultModel,
+	), &mr)
+	if err != nil {
+		return nil, fmt.Errorf("create model router: %w", err)
+	}
+	return &mr, nil
+}
+
+func (s *Postgres) UpdateModelRouter(ctx context.Context, id uuid.UUID, upd *ModelRouterUpdate) error {
+	sets := []string{}
+	args := []any{}
+	argIdx := 1
+
+	add := func(col string, v any) {
+		sets = append(sets, fmt.Sprintf("%s = $%d", col, argIdx))
+		args = append(args, v)
+		argIdx++
+	}
+	if upd.Name != nil {
+		add("name", *upd.Name)
+	}
+	if upd.Rules != nil {
+		rules := *upd.Rules
+		if rules == nil {
+			rules = []RouterRule{}
+		}
+		add("rules", rules)
+	}
+	if upd.DefaultModel != nil {
+		add("default_model", *upd.DefaultModel)
+	}
+	if upd.IsActive != nil {
+		add("is_active", *upd.IsActive)
+	}
+
+	if len(sets) == 0 {
+		return nil
+	}
+
+	sets = append(sets, "updated_at = now()")
+	args = append(args, id)
+
+	query := fmt.Sprintf("UPDATE model_routers SET %s WHERE id = $%d", strings.Join(sets, ", "), argIdx)
+	if _, err := s.pool.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("update model router: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) DeleteModelRouter(ctx context.Context, id uuid.UUID) error {
+	if _, err := s.pool.Exec(ctx, "DELETE FROM model_routers WHERE id = $1", id); err != nil {
+		return fmt.Errorf("delete model router: %w", err)
+	}
+	return nil
+}
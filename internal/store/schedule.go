@@ -0,0 +1,151 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AvailabilityWindow is a recurring time range during which a model or
+// upstream accepts requests. Start and End are "HH:MM" in Timezone (UTC if
+// empty); an End before Start spans midnight. Days restricts the window to
+// the given weekdays (0 = Sunday) and applies to the day the window starts.
+type AvailabilityWindow struct {
+	Days     []int  `json:"days,omitempty"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// Schedule is a set of availability windows stored as JSONB. An empty
+// schedule means always available.
+type Schedule []AvailabilityWindow
+
+// Validate checks times, weekdays and time zones.
+func (s Schedule) Validate() error {
+	for i, w := range s {
+		start, err := parseClock(w.Start)
+		if err != nil {
+			return fmt.Errorf("window %d: invalid start %q, use HH:MM", i, w.Start)
+		}
+		end, err := parseClock(w.End)
+		if err != nil {
+			return fmt.Errorf("window %d: invalid end %q, use HH:MM", i, w.End)
+		}
+		if start == end {
+			return fmt.Errorf("window %d: start and end are equal, use 00:00-24:00 for a full day", i)
+		}
+		for _, d := range w.Days {
+			if d < 0 || d > 6 {
+				return fmt.Errorf("window %d: invalid day %d, use 0 (Sunday) to 6 (Saturday)", i, d)
+			}
+		}
+		if w.Timezone != "" {
+			if _, err := time.LoadLocation(w.Timezone); err != nil {
+				return fmt.Errorf("window %d: unknown timezone %q", i, w.Timezone)
+			}
+		}
+	}
+	return nil
+}
+
+// Allows reports whether t falls inside any window. Windows that fail to
+// parse are ignored, so a schedule that was never validated fails closed.
+func (s Schedule) Allows(t time.Time) bool {
+	if len(s) == 0 {
+		return true
+	}
+	for _, w := range s {
+		if w.allows(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w AvailabilityWindow) allows(t time.Time) bool {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false
+	}
+	loc := time.UTC
+	if w.Timezone != "" {
+		if loc, err = time.LoadLocation(w.Timezone); err != nil {
+			return false
+		}
+	}
+	t = t.In(loc)
+	now := t.Hour()*60 + t.Minute()
+	day := int(t.Weekday())
+
+	if start <= end {
+		return now >= start && now < end && w.onDay(day)
+	}
+	// Overnight window: the late part belongs to today, the early part to
+	// the previous day's window.
+	if now >= start {
+		return w.onDay(day)
+	}
+	if now < end {
+		return w.onDay((day + 6) % 7)
+	}
+	return false
+}
+
+func (w AvailabilityWindow) onDay(day int) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+var weekdayNames = [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// String describes the schedule for error messages, e.g.
+// "Mon,Tue,Wed,Thu,Fri 09:00-18:00 Europe/Berlin".
+func (s Schedule) String() string {
+	if len(s) == 0 {
+		return "always"
+	}
+	parts := make([]string, 0, len(s))
+	for _, w := range s {
+		days := "daily"
+		if len(w.Days) > 0 {
+			names := make([]string, 0, len(w.Days))
+			for _, d := range w.Days {
+				if d >= 0 && d <= 6 {
+					names = append(names, weekdayNames[d])
+				}
+			}
+			days = strings.Join(names, ",")
+		}
+		tz := w.Timezone
+		if tz == "" {
+			tz = "UTC"
+		}
+		parts = append(parts, fmt.Sprintf("%s %s-%s %s", days, w.Start, w.End, tz))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// parseClock converts "HH:MM" to minutes since midnight. "24:00" is allowed
+// as an end-of-day marker.
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || len(s) != 5 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return h*60 + m, nil
+}
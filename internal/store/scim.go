@@ -0,0 +1,478 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrSCIMConflict is returned when a SCIM user's userName or a group's
+// displayName is already taken.
+var ErrSCIMConflict = errors.New("scim resource already exists")
+
+// SCIMUser is an employee provisioned by an identity provider, with the LLM
+// key created for them. Resource is the SCIM User as last written.
+type SCIMUser struct {
+	ID         uuid.UUID
+	KeyID      uuid.UUID
+	KeyPrefix  string
+	UserName   string
+	ExternalID *string
+	Active     bool
+	Resource   json.RawMessage
+	Groups     []SCIMRef
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// SCIMRef points at a SCIM user or group, as in a group's members or a
+// user's groups.
+type SCIMRef struct {
+	Value   uuid.UUID `json:"value"`
+	Display string    `json:"display"`
+}
+
+// SCIMUserWrite is the state an identity provider sets on a user. The
+// user's key is named KeyName, is active while the user is, and carries
+// Metadata under its metadata's "scim" entry, along with the user's teams.
+type SCIMUserWrite struct {
+	UserName   string
+	ExternalID *string
+	Active     bool
+	Resource   json.RawMessage
+	KeyName    string
+	Metadata   map[string]any
+}
+
+// SCIMGroup is a team provisioned by an identity provider.
+type SCIMGroup struct {
+	ID          uuid.UUID
+	DisplayName string
+	ExternalID  *string
+	Members     []SCIMRef
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type SCIMGroupWrite struct {
+	DisplayName string
+	ExternalID  *string
+	Members     []uuid.UUID // unknown users are skipped
+}
+
+// SCIMFilter narrows SCIM list queries to an exact attribute match.
+type SCIMFilter struct {
+	Name       *string // userName or displayName, case-insensitive
+	ExternalID *string
+}
+
+func scimConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+const scimUserColumns = `u.id, u.llm_key_id, k.key_prefix, u.user_name, u.external_id, u.active, u.resource,
+	COALESCE((SELECT jsonb_agg(jsonb_build_object('value', g.id, 'display', g.display_name) ORDER BY g.display_name)
+		FROM scim_group_members m JOIN scim_groups g ON g.id = m.group_id WHERE m.user_id = u.id), '[]'),
+	u.created_at, u.updated_at`
+
+func scanSCIMUser(row pgx.Row, u *SCIMUser) error {
+	return row.Scan(&u.ID, &u.KeyID, &u.KeyPrefix, &u.UserName, &u.ExternalID, &u.Active, &u.Resource,
+		&u.Groups, &u.CreatedAt, &u.UpdatedAt)
+}
+
+// scimWhere builds the WHERE clause for f on the name column.
+func scimWhere(f SCIMFilter, nameColumn string) (string, []any) {
+	where := "true"
+	var args []any
+	if f.Name != nil {
+		args = append(args, *f.Name)
+		where += fmt.Sprintf(" AND lower(%s) = lower($%d)", nameColumn, len(args))
+	}
+	if f.ExternalID != nil {
+		args = append(args, *f.ExternalID)
+		where += fmt.Sprintf(" AND external_id = $%d", len(args))
+	}
+	return where, args
+}
+
+// ListSCIMUsers returns up to limit users matching f, oldest first, after
+// skipping offset, and the number matching.
+func (s *Postgres) ListSCIMUsers(ctx context.Context, f SCIMFilter, offset, limit int) ([]SCIMUser, int, error) {
+	where, args := scimWhere(f, "u.user_name")
+	var total int
+	if err := s.pool.QueryRow(ctx, "SELECT COUNT(*) FROM scim_users u WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count scim users: %w", err)
+	}
+
+	args = append(args, limit, offset)
+	rows, err := s.pool.Query(ctx, fmt.Sprintf(`
+		SELECT `+scimUserColumns+`
+		FROM scim_users u
+		JOIN llm_api_keys k ON k.id = u.llm_key_id
+		WHERE %s
+		ORDER BY u.created_at, u.id
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list scim users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []SCIMUser{}
+	for rows.Next() {
+		var u SCIMUser
+		if err := scanSCIMUser(rows, &u); err != nil {
+			return nil, 0, fmt.Errorf("scan scim user: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, total, rows.Err()
+}
+
+// scimQuerier is a pool or a transaction.
+type scimQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func getSCIMUser(ctx context.Context, q scimQuerier, id uuid.UUID) (*SCIMUser, error) {
+	var u SCIMUser
+	err := scanSCIMUser(q.QueryRow(ctx, `
+		SELECT `+scimUserColumns+`
+		FROM scim_users u
+		JOIN llm_api_keys k ON k.id = u.llm_key_id
+		WHERE u.id = $1
+	`, id), &u)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get scim user: %w", err)
+	}
+	return &u, nil
+}
+
+// GetSCIMUser returns a user, or nil if there is none with id.
+func (s *Postgres) GetSCIMUser(ctx context.Context, id uuid.UUID) (*SCIMUser, error) {
+	return getSCIMUser(ctx, s.pool, id)
+}
+
+// scimKeyMetadata is the "scim" entry of a provisioned key's metadata.
+func scimKeyMetadata(id uuid.UUID, w *SCIMUserWrite) map[string]any {
+	meta := make(map[string]any, len(w.Metadata)+4)
+	for k, v := range w.Metadata {
+		meta[k] = v
+	}
+	meta["user_id"] = id
+	meta["user_name"] = w.UserName
+	meta["external_id"] = w.ExternalID
+	meta["teams"] = []string{}
+	return meta
+}
+
+// CreateSCIMUser provisions a user and creates their LLM key from keyHash
+// and keyPrefix.
+func (s *Postgres) CreateSCIMUser(ctx context.Context, w *SCIMUserWrite, keyHash, keyPrefix string) (*SCIMUser, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	id := uuid.New()
+	var keyID uuid.UUID
+	err = tx.QueryRow(ctx, `
+		INSERT INTO llm_api_keys (key_hash, key_prefix, name, is_active, metadata)
+		VALUES ($1, $2, $3, $4, jsonb_build_object('scim', $5::jsonb))
+		RETURNING id
+	`, keyHash, keyPrefix, w.KeyName, w.Active, scimKeyMetadata(id, w)).Scan(&keyID)
+	if err != nil {
+		return nil, fmt.Errorf("create scim user key: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO scim_users (id, llm_key_id, user_name, external_id, active, resource)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, id, keyID, w.UserName, w.ExternalID, w.Active, w.Resource)
+	if scimConflict(err) {
+		return nil, ErrSCIMConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create scim user: %w", err)
+	}
+
+	u, err := getSCIMUser(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+	return u, nil
+}
+
+// ReplaceSCIMUser overwrites a user and updates their key to match. It
+// returns nil if there is no user with id.
+func (s *Postgres) ReplaceSCIMUser(ctx context.Context, id uuid.UUID, w *SCIMUserWrite) (*SCIMUser, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var keyID uuid.UUID
+	err = tx.QueryRow(ctx, `
+		UPDATE scim_users SET user_name = $2, external_id = $3, active = $4, resource = $5, updated_at = now()
+		WHERE id = $1
+		RETURNING llm_key_id
+	`, id, w.UserName, w.ExternalID, w.Active, w.Resource).Scan(&keyID)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if scimConflict(err) {
+		return nil, ErrSCIMConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("replace scim user: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE llm_api_keys
+		SET name = $2, is_active = $3, metadata = jsonb_set(COALESCE(metadata, '{}'), '{scim}', $4::jsonb), updated_at = now()
+		WHERE id = $1
+	`, keyID, w.KeyName, w.Active, scimKeyMetadata(id, w))
+	if err != nil {
+		return nil, fmt.Errorf("update scim user key: %w", err)
+	}
+	if err := refreshSCIMTeams(ctx, tx, []uuid.UUID{id}); err != nil {
+		return nil, err
+	}
+
+	u, err := getSCIMUser(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+	return u, nil
+}
+
+// DeleteSCIMUser deprovisions a user: their key is deactivated, keeping its
+// logs, and the user is forgotten. It reports whether the user existed.
+func (s *Postgres) DeleteSCIMUser(ctx context.Context, id uuid.UUID) (bool, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var keyID uuid.UUID
+	err = tx.QueryRow(ctx, `DELETE FROM scim_users WHERE id = $1 RETURNING llm_key_id`, id).Scan(&keyID)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("delete scim user: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		"UPDATE llm_api_keys SET is_active = false, updated_at = now() WHERE id = $1", keyID)
+	if err != nil {
+		return false, fmt.Errorf("deactivate scim user key: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("commit tx: %w", err)
+	}
+	return true, nil
+}
+
+// refreshSCIMTeams sets the teams in the key metadata of users to the
+// names of the groups they belong to.
+func refreshSCIMTeams(ctx context.Context, tx pgx.Tx, users []uuid.UUID) error {
+	if len(users) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx, `
+		UPDATE llm_api_keys k
+		SET metadata = jsonb_set(k.metadata, '{scim,teams}', COALESCE((
+			SELECT jsonb_agg(g.display_name ORDER BY g.display_name)
+			FROM scim_group_members m JOIN scim_groups g ON g.id = m.group_id
+			WHERE m.user_id = u.id), '[]')),
+			updated_at = now()
+		FROM scim_users u
+		WHERE u.llm_key_id = k.id AND u.id = ANY($1) AND k.metadata ? 'scim'
+	`, users)
+	if err != nil {
+		return fmt.Errorf("refresh scim teams: %w", err)
+	}
+	return nil
+}
+
+const scimGroupColumns = `g.id, g.display_name, g.external_id,
+	COALESCE((SELECT jsonb_agg(jsonb_build_object('value', u.id, 'display', u.user_name) ORDER BY u.user_name)
+		FROM scim_group_members m JOIN scim_users u ON u.id = m.user_id WHERE m.group_id = g.id), '[]'),
+	g.created_at, g.updated_at`
+
+func scanSCIMGroup(row pgx.Row, g *SCIMGroup) error {
+	return row.Scan(&g.ID, &g.DisplayName, &g.ExternalID, &g.Members, &g.CreatedAt, &g.UpdatedAt)
+}
+
+// ListSCIMGroups returns up to limit groups matching f, oldest first, after
+// skipping offset, and the number matching.
+func (s *Postgres) ListSCIMGroups(ctx context.Context, f SCIMFilter, offset, limit int) ([]SCIMGroup, int, error) {
+	where, args := scimWhere(f, "g.display_name")
+	var total int
+	if err := s.pool.QueryRow(ctx, "SELECT COUNT(*) FROM scim_groups g WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count scim groups: %w", err)
+	}
+
+	args = append(args, limit, offset)
+	rows, err := s.pool.Query(ctx, fmt.Sprintf(`
+		SELECT `+scimGroupColumns+`
+		FROM scim_groups g
+		WHERE %s
+		ORDER BY g.created_at, g.id
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list scim groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []SCIMGroup{}
+	for rows.Next() {
+		var g SCIMGroup
+		if err := scanSCIMGroup(rows, &g); err != nil {
+			return nil, 0, fmt.Errorf("scan scim group: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	return groups, total, rows.Err()
+}
+
+// GetSCIMGroup returns a group, or nil if there is none with id.
+func (s *Postgres) GetSCIMGroup(ctx context.Context, id uuid.UUID) (*SCIMGroup, error) {
+	var g SCIMGroup
+	err := scanSCIMGroup(s.pool.QueryRow(ctx, `SELECT `+scimGroupColumns+` FROM scim_groups g WHERE g.id = $1`, id), &g)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get scim group: %w", err)
+	}
+	return &g, nil
+}
+
+// CreateSCIMGroup provisions a group and adds its members to the team.
+func (s *Postgres) CreateSCIMGroup(ctx context.Context, w *SCIMGroupWrite) (*SCIMGroup, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var id uuid.UUID
+	err = tx.QueryRow(ctx, `
+		INSERT INTO scim_groups (display_name, external_id) VALUES ($1, $2) RETURNING id
+	`, w.DisplayName, w.ExternalID).Scan(&id)
+	if scimConflict(err) {
+		return nil, ErrSCIMConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create scim group: %w", err)
+	}
+	if err := setSCIMMembers(ctx, tx, id, w.Members); err != nil {
+		return nil, err
+	}
+	return commitSCIMGroup(ctx, tx, id)
+}
+
+// ReplaceSCIMGroup overwrites a group and its members. It returns nil if
+// there is no group with id.
+func (s *Postgres) ReplaceSCIMGroup(ctx context.Context, id uuid.UUID, w *SCIMGroupWrite) (*SCIMGroup, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	ct, err := tx.Exec(ctx, `
+		UPDATE scim_groups SET display_name = $2, external_id = $3, updated_at = now() WHERE id = $1
+	`, id, w.DisplayName, w.ExternalID)
+	if scimConflict(err) {
+		return nil, ErrSCIMConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("replace scim group: %w", err)
+	}
+	if ct.RowsAffected() == 0 {
+		return nil, nil
+	}
+	if err := setSCIMMembers(ctx, tx, id, w.Members); err != nil {
+		return nil, err
+	}
+	return commitSCIMGroup(ctx, tx, id)
+}
+
+// setSCIMMembers makes members the only members of a group, refreshing
+// the teams of everyone who joined, left or stayed.
+func setSCIMMembers(ctx context.Context, tx pgx.Tx, group uuid.UUID, members []uuid.UUID) error {
+	rows, err := tx.Query(ctx, `DELETE FROM scim_group_members WHERE group_id = $1 RETURNING user_id`, group)
+	if err != nil {
+		return fmt.Errorf("clear scim group members: %w", err)
+	}
+	affected, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return fmt.Errorf("clear scim group members: %w", err)
+	}
+	if len(members) > 0 {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO scim_group_members (group_id, user_id)
+			SELECT $1, u.id FROM scim_users u WHERE u.id = ANY($2)
+		`, group, members)
+		if err != nil {
+			return fmt.Errorf("add scim group members: %w", err)
+		}
+	}
+	return refreshSCIMTeams(ctx, tx, append(affected, members...))
+}
+
+func commitSCIMGroup(ctx context.Context, tx pgx.Tx, id uuid.UUID) (*SCIMGroup, error) {
+	var g SCIMGroup
+	if err := scanSCIMGroup(tx.QueryRow(ctx, `SELECT `+scimGroupColumns+` FROM scim_groups g WHERE g.id = $1`, id), &g); err != nil {
+		return nil, fmt.Errorf("get scim group: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+	return &g, nil
+}
+
+// DeleteSCIMGroup removes a group and takes its members out of the team.
+// It reports whether the group existed.
+func (s *Postgres) DeleteSCIMGroup(ctx context.Context, id uuid.UUID) (bool, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := setSCIMMembers(ctx, tx, id, nil); err != nil {
+		return false, err
+	}
+	ct, err := tx.Exec(ctx, `DELETE FROM scim_groups WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("delete scim group: %w", err)
+	}
+	if ct.RowsAffected() == 0 {
+		return false, nil
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("commit tx: %w", err)
+	}
+	return true, nil
+}
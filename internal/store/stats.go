@@ -39,6 +39,10 @@ type ModelStats struct {
 	TotalOutputTokens int64   `json:"total_output_tokens"`
 	TotalCost         float64 `json:"total_cost"`
 	AvgLatencyMS      int     `json:"avg_latency_ms"`
+	// AvgToolCalls is tool calls per request; ToolCallRate is the share of
+	// requests that ended in at least one tool call (a tool round).
+	AvgToolCalls float64 `json:"avg_tool_calls"`
+	ToolCallRate float64 `json:"tool_call_rate"`
 }
 
 type TimeSeriesBucket struct {
@@ -85,7 +89,7 @@ func intervalToTrunc(interval string) string {
 	}
 }
 
-func (s *Store) GetOverviewStats(ctx context.Context, period string) (*OverviewStats, error) {
+func (s *Postgres) GetOverviewStats(ctx context.Context, period string) (*OverviewStats, error) {
 	interval := periodToInterval(period)
 	var stats OverviewStats
 	err := s.pool.QueryRow(ctx, `
@@ -126,7 +130,7 @@ func (s *Store) GetOverviewStats(ctx context.Context, period string) (*OverviewS
 	return &stats, nil
 }
 
-func (s *Store) GetStatsByKey(ctx context.Context, period string, page, perPage int) ([]KeyStats, int, error) {
+func (s *Postgres) GetStatsByKey(ctx context.Context, period string, page, perPage int) ([]KeyStats, int, error) {
 	interval := periodToInterval(period)
 	offset := (page - 1) * perPage
 
@@ -164,12 +168,14 @@ func (s *Store) GetStatsByKey(ctx context.Context, period string, page, perPage
 	return stats, total, rows.Err()
 }
 
-func (s *Store) GetStatsByModel(ctx context.Context, period string) ([]ModelStats, error) {
+func (s *Postgres) GetStatsByModel(ctx context.Context, period string) ([]ModelStats, error) {
 	interval := periodToInterval(period)
 
 	rows, err := s.pool.Query(ctx, `
 		SELECT model, COUNT(*), COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0),
-			COALESCE(SUM(cost), 0), COALESCE(AVG(latency_ms)::int, 0)
+			COALESCE(SUM(cost), 0), COALESCE(AVG(latency_ms)::int, 0),
+			COALESCE(AVG(tool_calls), 0)::float8,
+			COALESCE(AVG(CASE WHEN tool_calls > 0 THEN 1 ELSE 0 END), 0)::float8
 		FROM request_logs
 		WHERE timestamp > now() - $1::interval AND model IS NOT NULL
 		GROUP BY model
@@ -185,7 +191,7 @@ func (s *Store) GetStatsByModel(ctx context.Context, period string) ([]ModelStat
 		var ms ModelStats
 		if err := rows.Scan(
 			&ms.Model, &ms.TotalRequests, &ms.TotalInputTokens, &ms.TotalOutputTokens,
-			&ms.TotalCost, &ms.AvgLatencyMS,
+			&ms.TotalCost, &ms.AvgLatencyMS, &ms.AvgToolCalls, &ms.ToolCallRate,
 		); err != nil {
 			return nil, fmt.Errorf("scan model stats: %w", err)
 		}
@@ -194,7 +200,164 @@ func (s *Store) GetStatsByModel(ctx context.Context, period string) ([]ModelStat
 	return stats, rows.Err()
 }
 
-func (s *Store) GetTimeSeries(ctx context.Context, period, interval string) ([]TimeSeriesBucket, error) {
+// TranslationStats summarises one translation path: the client's input
+// format, the upstream's format, and whether the request was translated
+// between them. Comparing translated and native paths isolates the error and
+// latency cost of cross-format translation.
+type TranslationStats struct {
+	InputFormat    string  `json:"input_format"`
+	UpstreamFormat string  `json:"upstream_format"`
+	Translated     bool    `json:"translated"`
+	TotalRequests  int     `json:"total_requests"`
+	Errors         int     `json:"errors"`
+	ErrorRate      float64 `json:"error_rate"`
+	AvgLatencyMS   int     `json:"avg_latency_ms"`
+	P95LatencyMS   int     `json:"p95_latency_ms"`
+	AvgOverheadUS  int     `json:"avg_overhead_us"`
+	P95OverheadUS  int     `json:"p95_overhead_us"`
+}
+
+// GetStatsByTranslation groups requests by translation path. Requests logged
+// before the upstream format was recorded are left out.
+func (s *Postgres) GetStatsByTranslation(ctx context.Context, period string) ([]TranslationStats, error) {
+	interval := periodToInterval(period)
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT input_format, upstream_format, translated, COUNT(*),
+			COUNT(*) FILTER (WHERE status_code >= 400),
+			COALESCE(AVG(CASE WHEN status_code >= 400 THEN 1 ELSE 0 END), 0)::float8,
+			COALESCE(AVG(latency_ms)::int, 0),
+			COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY latency_ms)::int, 0),
+			COALESCE(AVG(overhead_us)::int, 0),
+			COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY overhead_us)::int, 0)
+		FROM request_logs
+		WHERE timestamp > now() - $1::interval AND upstream_format IS NOT NULL
+		GROUP BY input_format, upstream_format, translated
+		ORDER BY input_format, upstream_format
+	`, interval)
+	if err != nil {
+		return nil, fmt.Errorf("get stats by translation: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []TranslationStats
+	for rows.Next() {
+		var ts TranslationStats
+		if err := rows.Scan(
+			&ts.InputFormat, &ts.UpstreamFormat, &ts.Translated, &ts.TotalRequests,
+			&ts.Errors, &ts.ErrorRate, &ts.AvgLatencyMS, &ts.P95LatencyMS,
+			&ts.AvgOverheadUS, &ts.P95OverheadUS,
+		); err != nil {
+			return nil, fmt.Errorf("scan translation stats: %w", err)
+		}
+		stats = append(stats, ts)
+	}
+	return stats, rows.Err()
+}
+
+// ProviderErrorStats counts the requests an upstream refused for one of its
+// provider's policies, such as an unsupported region, per upstream and model.
+// ErrorCode is one of the provider_* codes the proxy logs for them.
+type ProviderErrorStats struct {
+	ErrorCode  string     `json:"error_code"`
+	UpstreamID *uuid.UUID `json:"upstream_id"`
+	Model      string     `json:"model"`
+	Requests   int        `json:"requests"`
+	LastSeen   time.Time  `json:"last_seen"`
+}
+
+// GetProviderErrorStats groups requests logged with a provider_* error code
+// by code, upstream and model, most frequent first.
+func (s *Postgres) GetProviderErrorStats(ctx context.Context, period string) ([]ProviderErrorStats, error) {
+	interval := periodToInterval(period)
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT error_code, upstream_id, COALESCE(model, ''), COUNT(*), MAX(timestamp)
+		FROM request_logs
+		WHERE timestamp > now() - $1::interval AND error_code LIKE 'provider\_%'
+		GROUP BY error_code, upstream_id, model
+		ORDER BY COUNT(*) DESC, error_code
+	`, interval)
+	if err != nil {
+		return nil, fmt.Errorf("get provider error stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []ProviderErrorStats
+	for rows.Next() {
+		var ps ProviderErrorStats
+		if err := rows.Scan(&ps.ErrorCode, &ps.UpstreamID, &ps.Model, &ps.Requests, &ps.LastSeen); err != nil {
+			return nil, fmt.Errorf("scan provider error stats: %w", err)
+		}
+		stats = append(stats, ps)
+	}
+	return stats, rows.Err()
+}
+
+// Anthropic bills cache reads at a tenth of the input price and 5-minute
+// cache writes at a quarter more, so cached prompt tokens save
+// cacheReadSaving of the input price and cached writes cost
+// cacheWriteSurcharge of it on top.
+const (
+	cacheReadSaving     = 0.9
+	cacheWriteSurcharge = 0.25
+)
+
+// CacheInjectionStats summarises prompt caching on one model's requests that
+// pxbin added cache_control breakpoints to. EstimatedSavings is what the
+// cache reads saved less what the cache writes added, at the model's input
+// price, in USD.
+type CacheInjectionStats struct {
+	Model                    string  `json:"model"`
+	TotalRequests            int     `json:"total_requests"`
+	TotalInputTokens         int64   `json:"total_input_tokens"`
+	TotalCacheCreationTokens int64   `json:"total_cache_creation_tokens"`
+	TotalCacheReadTokens     int64   `json:"total_cache_read_tokens"`
+	CacheHitRate             float64 `json:"cache_hit_rate"`
+	EstimatedSavings         float64 `json:"estimated_savings"`
+}
+
+// GetCacheInjectionStats groups requests with injected cache_control
+// breakpoints by model, most saved first.
+func (s *Postgres) GetCacheInjectionStats(ctx context.Context, period string) ([]CacheInjectionStats, error) {
+	interval := periodToInterval(period)
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT COALESCE(l.model, ''), COUNT(*),
+			COALESCE(SUM(l.input_tokens), 0),
+			COALESCE(SUM(l.cache_creation_tokens), 0),
+			COALESCE(SUM(l.cache_read_tokens), 0),
+			COALESCE(SUM(($2 * l.cache_read_tokens - $3 * l.cache_creation_tokens) * m.input_cost_per_million / 1000000), 0)::float8 AS savings
+		FROM request_logs l
+		LEFT JOIN models m ON m.name = l.model
+		WHERE l.timestamp > now() - $1::interval
+			AND l.request_metadata @> '{"cache_control_injected": true}'
+		GROUP BY l.model
+		ORDER BY savings DESC
+	`, interval, cacheReadSaving, cacheWriteSurcharge)
+	if err != nil {
+		return nil, fmt.Errorf("get cache injection stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []CacheInjectionStats
+	for rows.Next() {
+		var cs CacheInjectionStats
+		if err := rows.Scan(
+			&cs.Model, &cs.TotalRequests, &cs.TotalInputTokens,
+			&cs.TotalCacheCreationTokens, &cs.TotalCacheReadTokens, &cs.EstimatedSavings,
+		); err != nil {
+			return nil, fmt.Errorf("scan cache injection stats: %w", err)
+		}
+		if prompt := cs.TotalInputTokens + cs.TotalCacheCreationTokens + cs.TotalCacheReadTokens; prompt > 0 {
+			cs.CacheHitRate = float64(cs.TotalCacheReadTokens) / float64(prompt)
+		}
+		stats = append(stats, cs)
+	}
+	return stats, rows.Err()
+}
+
+func (s *Postgres) GetTimeSeries(ctx context.Context, period, interval string) ([]TimeSeriesBucket, error) {
 	pgInterval := periodToInterval(period)
 	trunc := intervalToTrunc(interval)
 
@@ -227,7 +390,7 @@ func (s *Store) GetTimeSeries(ctx context.Context, period, interval string) ([]T
 	return buckets, rows.Err()
 }
 
-func (s *Store) GetLatencyPercentiles(ctx context.Context, period string) (*LatencyStats, error) {
+func (s *Postgres) GetLatencyPercentiles(ctx context.Context, period string) (*LatencyStats, error) {
 	interval := periodToInterval(period)
 	var stats LatencyStats
 	err := s.pool.QueryRow(ctx, `
@@ -246,3 +409,185 @@ func (s *Store) GetLatencyPercentiles(ctx context.Context, period string) (*Late
 	}
 	return &stats, nil
 }
+
+// KeyUsage is a per-key usage report: totals, spend over time, a per-model
+// breakdown, recent error samples, and recent request volume.
+type KeyUsage struct {
+	Totals             OverviewStats      `json:"totals"`
+	TimeSeries         []TimeSeriesBucket `json:"timeseries"`
+	ByModel            []ModelStats       `json:"by_model"`
+	RecentErrors       []KeyUsageError    `json:"recent_errors"`
+	RequestsLastMinute int                `json:"-"` // surfaced by the API as rate-limit status
+}
+
+type KeyUsageError struct {
+	ID           uuid.UUID `json:"id"`
+	Timestamp    time.Time `json:"timestamp"`
+	Model        *string   `json:"model"`
+	Path         string    `json:"path"`
+	StatusCode   *int      `json:"status_code"`
+	ErrorMessage *string   `json:"error_message"`
+}
+
+// GetKeyUsage builds a KeyUsage report for a single LLM key over period,
+// bucketing the time series by interval. errorLimit caps the number of
+// recent error samples returned.
+func (s *Postgres) GetKeyUsage(ctx context.Context, keyID uuid.UUID, period, interval string, errorLimit int) (*KeyUsage, error) {
+	pgInterval := periodToInterval(period)
+	trunc := intervalToTrunc(interval)
+	usage := &KeyUsage{
+		TimeSeries:   []TimeSeriesBucket{},
+		ByModel:      []ModelStats{},
+		RecentErrors: []KeyUsageError{},
+	}
+
+	t := &usage.Totals
+	err := s.pool.QueryRow(ctx, `
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(input_tokens), 0),
+			COALESCE(SUM(output_tokens), 0),
+			COALESCE(SUM(cache_read_tokens), 0),
+			COALESCE(SUM(cost), 0),
+			COALESCE(AVG(latency_ms)::int, 0),
+			COALESCE(AVG(overhead_us)::int, 0),
+			COUNT(*) FILTER (WHERE status_code >= 400),
+			COUNT(*) FILTER (WHERE timestamp > now() - interval '1 minute')
+		FROM request_logs
+		WHERE llm_key_id = $1 AND timestamp > now() - $2::interval
+	`, keyID, pgInterval).Scan(
+		&t.TotalRequests, &t.TotalInputTokens, &t.TotalOutputTokens, &t.TotalCacheReadTokens,
+		&t.TotalCost, &t.AvgLatencyMS, &t.AvgOverheadUS, &t.ErrorCount,
+		&usage.RequestsLastMinute,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get key usage totals: %w", err)
+	}
+	if t.TotalRequests > 0 {
+		t.ErrorRate = float64(t.ErrorCount) / float64(t.TotalRequests)
+	}
+	if prompt := t.TotalInputTokens + t.TotalCacheReadTokens; prompt > 0 {
+		t.CacheHitRate = float64(t.TotalCacheReadTokens) / float64(prompt)
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT date_trunc($1, timestamp) as bucket,
+			COUNT(*), COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0),
+			COALESCE(SUM(cost), 0), COALESCE(AVG(latency_ms)::int, 0),
+			COALESCE(AVG(overhead_us)::int, 0),
+			COUNT(*) FILTER (WHERE status_code >= 400)
+		FROM request_logs
+		WHERE llm_key_id = $2 AND timestamp > now() - $3::interval
+		GROUP BY bucket ORDER BY bucket
+	`, trunc, keyID, pgInterval)
+	if err != nil {
+		return nil, fmt.Errorf("get key usage time series: %w", err)
+	}
+	for rows.Next() {
+		var b TimeSeriesBucket
+		if err := rows.Scan(
+			&b.Bucket, &b.Requests, &b.InputTokens, &b.OutputTokens,
+			&b.Cost, &b.AvgLatencyMS, &b.AvgOverheadUS, &b.Errors,
+		); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan key usage bucket: %w", err)
+		}
+		usage.TimeSeries = append(usage.TimeSeries, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate key usage time series: %w", err)
+	}
+
+	rows, err = s.pool.Query(ctx, `
+		SELECT model, COUNT(*), COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0),
+			COALESCE(SUM(cost), 0), COALESCE(AVG(latency_ms)::int, 0)
+		FROM request_logs
+		WHERE llm_key_id = $1 AND timestamp > now() - $2::interval AND model IS NOT NULL
+		GROUP BY model
+		ORDER BY SUM(cost) DESC
+	`, keyID, pgInterval)
+	if err != nil {
+		return nil, fmt.Errorf("get key usage by model: %w", err)
+	}
+	for rows.Next() {
+		var ms ModelStats
+		if err := rows.Scan(
+			&ms.Model, &ms.TotalRequests, &ms.TotalInputTokens, &ms.TotalOutputTokens,
+			&ms.TotalCost, &ms.AvgLatencyMS, &ms.AvgToolCalls, &ms.ToolCallRate,
+		); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan key usage model stats: %w", err)
+		}
+		usage.ByModel = append(usage.ByModel, ms)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate key usage by model: %w", err)
+	}
+
+	rows, err = s.pool.Query(ctx, `
+		SELECT id, timestamp, model, path, status_code, error_message
+		FROM request_logs
+		WHERE llm_key_id = $1 AND timestamp > now() - $2::interval AND status_code >= 400
+		ORDER BY timestamp DESC
+		LIMIT $3
+	`, keyID, pgInterval, errorLimit)
+	if err != nil {
+		return nil, fmt.Errorf("get key usage errors: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e KeyUsageError
+		if err := rows.Scan(&e.ID, &e.Timestamp, &e.Model, &e.Path, &e.StatusCode, &e.ErrorMessage); err != nil {
+			return nil, fmt.Errorf("scan key usage error: %w", err)
+		}
+		usage.RecentErrors = append(usage.RecentErrors, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate key usage errors: %w", err)
+	}
+
+	return usage, nil
+}
+
+// DailyModelUsage is the traffic to one model in one UTC day, with the
+// number of distinct keys behind it.
+type DailyModelUsage struct {
+	Day          time.Time
+	Model        string
+	Requests     int
+	Keys         int
+	InputTokens  int64
+	OutputTokens int64
+}
+
+// GetDailyModelUsage returns per-day, per-model usage of requests logged in
+// [from, to), oldest day first. The tokens each request counts toward the
+// sums are clipped at tokenClip, bounding what any single request adds.
+func (s *Postgres) GetDailyModelUsage(ctx context.Context, from, to time.Time, tokenClip int) ([]DailyModelUsage, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT date_trunc('day', timestamp AT TIME ZONE 'UTC') AS day, model,
+			COUNT(*), COUNT(DISTINCT llm_key_id),
+			COALESCE(SUM(LEAST(input_tokens, $3)), 0), COALESCE(SUM(LEAST(output_tokens, $3)), 0)
+		FROM request_logs
+		WHERE timestamp >= $1 AND timestamp < $2 AND model IS NOT NULL
+		GROUP BY day, model
+		ORDER BY day, model
+	`, from, to, tokenClip)
+	if err != nil {
+		return nil, fmt.Errorf("get daily model usage: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []DailyModelUsage
+	for rows.Next() {
+		var u DailyModelUsage
+		if err := rows.Scan(&u.Day, &u.Model, &u.Requests, &u.Keys, &u.InputTokens, &u.OutputTokens); err != nil {
+			return nil, fmt.Errorf("scan daily model usage: %w", err)
+		}
+		u.Day = u.Day.UTC()
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Store is pxbin's persistent state, as used by the API, auth, proxy,
+// billing and background workers. Postgres is the production
+// implementation; Memory keeps everything in process for tests and demos.
+//
+// Lookups of a single row return nil and no error when the row does not
+// exist.
+type Store interface {
+	Health(ctx context.Context) error
+	MigrationStatus(ctx context.Context) (*MigrationStatus, error)
+
+	// LLM and management API keys.
+	GetLLMKeyByHash(ctx context.Context, hash string) (*LLMAPIKey, error)
+	GetLLMKey(ctx context.Context, id uuid.UUID) (*LLMAPIKey, error)
+	ListLLMKeys(ctx context.Context, page, perPage int) ([]LLMAPIKey, int, error)
+	ListRecentLLMKeys(ctx context.Context, since time.Time, limit int) ([]LLMAPIKey, error)
+	CreateLLMKey(ctx context.Context, keyHash, keyPrefix, name string, rateLimit *int) (*LLMAPIKey, error)
+	UpdateLLMKey(ctx context.Context, id uuid.UUID, updates LLMKeyUpdate) error
+	DeactivateLLMKey(ctx context.Context, id uuid.UUID) error
+	UpdateLLMKeyLastUsed(ctx context.Context, id uuid.UUID) error
+	BatchUpdateLLMKeyLastUsed(ctx context.Context, ids []uuid.UUID) error
+	SetLLMKeyBudgets(ctx context.Context, id uuid.UUID, daily, monthly *float64) (bool, error)
+	ListBudgetedKeySpend(ctx context.Context, day, month time.Time) (map[uuid.UUID]KeySpend, error)
+	GetManagementKeyByHash(ctx context.Context, hash string) (*ManagementAPIKey, error)
+	ListManagementKeys(ctx context.Context, page, perPage int) ([]ManagementAPIKey, int, error)
+	CreateManagementKey(ctx context.Context, keyHash, keyPrefix, name string, permissions []string) (*ManagementAPIKey, error)
+	UpdateManagementKey(ctx context.Context, id uuid.UUID, updates ManagementKeyUpdate) error
+	DeactivateManagementKey(ctx context.Context, id uuid.UUID) error
+
+	// Teams of LLM keys.
+	ListTeams(ctx context.Context) ([]Team, error)
+	GetTeam(ctx context.Context, id uuid.UUID) (*Team, error)
+	CreateTeam(ctx context.Context, tc *TeamCreate) (*Team, error)
+	UpdateTeam(ctx context.Context, id uuid.UUID, upd *TeamUpdate) error
+	DeleteTeam(ctx context.Context, id uuid.UUID) error
+	SetTeamBudgets(ctx context.Context, id uuid.UUID, daily, monthly *float64) (bool, error)
+	SetLLMKeyTeam(ctx context.Context, keyID uuid.UUID, teamID *uuid.UUID) (bool, error)
+
+	// Upstreams and their saved scores.
+	ListUpstreams(ctx context.Context) ([]Upstream, error)
+	ListUpstreamsFiltered(ctx context.Context, filter UpstreamFilter) ([]Upstream, int, error)
+	GetUpstream(ctx context.Context, id uuid.UUID) (*Upstream, error)
+	GetActiveUpstream(ctx context.Context) (*Upstream, error)
+	CreateUpstream(ctx context.Context, uc *UpstreamCreate) (*Upstream, error)
+	UpdateUpstream(ctx context.Context, id uuid.UUID, upd *UpstreamUpdate) error
+	DeleteUpstream(ctx context.Context, id uuid.UUID) error
+	DeleteUpstreams(ctx context.Context, ids []uuid.UUID) (int64, error)
+	ListUpstreamScores(ctx context.Context) ([]UpstreamScore, error)
+	SaveUpstreamScores(ctx context.Context, scores []UpstreamScore) error
+
+	// Models.
+	ListModels(ctx context.Context) ([]Model, error)
+	ListModelsFiltered(ctx context.Context, filter ModelFilter) ([]Model, int, error)
+	GetModel(ctx context.Context, id uuid.UUID) (*Model, error)
+	GetModelByName(ctx context.Context, name string) (*Model, error)
+	CreateModel(ctx context.Context, mc *ModelCreate) (*Model, error)
+	UpdateModel(ctx context.Context, id uuid.UUID, u *ModelUpdate) error
+	DeleteModel(ctx context.Context, id uuid.UUID) error
+	DeleteModels(ctx context.Context, ids []uuid.UUID) (int64, error)
+	MarkStaleModels(ctx context.Context, upstreamID uuid.UUID, listed []string) error
+	ModelNameConflict(ctx context.Context, names []string, exclude *uuid.UUID) (string, error)
+	GetModelWithUpstream(ctx context.Context, modelName string) (*ModelWithUpstream, error)
+	ListActiveModelsWithUpstream(ctx context.Context) ([]*ModelWithUpstream, error)
+	ListModelRouters(ctx context.Context) ([]ModelRouter, error)
+	GetModelRouter(ctx context.Context, id uuid.UUID) (*ModelRouter, error)
+	CreateModelRouter(ctx context.Context, rc *ModelRouterCreate) (*ModelRouter, error)
+	UpdateModelRouter(ctx context.Context, id uuid.UUID, upd *ModelRouterUpdate) error
+	DeleteModelRouter(ctx context.Context, id uuid.UUID) error
+
+	// Request logs, management access logs and the statistics over them.
+	InsertLog(ctx context.Context, entry *LogEntry) error
+	InsertLogBatch(ctx context.Context, entries []*LogEntry) error
+	GetLog(ctx context.Context, id uuid.UUID) (*RequestLog, error)
+	ListLogs(ctx context.Context, filter LogFilter) ([]RequestLog, int, error)
+	DeleteOldLogs(ctx context.Context, olderThan time.Time) (int64, error)
+	GetLogPayload(ctx context.Context, logID uuid.UUID) (*LogPayload, error)
+	DeleteOldPayloads(ctx context.Context, olderThan time.Time) (int64, error)
+	InsertAccessLogBatch(ctx context.Context, entries []*AccessLogEntry) error
+	ListAccessLogs(ctx context.Context, filter AccessLogFilter) ([]AccessLog, int, error)
+	DeleteOldAccessLogs(ctx context.Context, olderThan time.Time) (int64, error)
+	GetOverviewStats(ctx context.Context, period string) (*OverviewStats, error)
+	GetStatsByKey(ctx context.Context, period string, page, perPage int) ([]KeyStats, int, error)
+	GetStatsByTeam(ctx context.Context, period string) ([]TeamStats, error)
+	GetStatsByModel(ctx context.Context, period string) ([]ModelStats, error)
+	GetStatsByTranslation(ctx context.Context, period string) ([]TranslationStats, error)
+	GetProviderErrorStats(ctx context.Context, period string) ([]ProviderErrorStats, error)
+	GetCacheInjectionStats(ctx context.Context, period string) ([]CacheInjectionStats, error)
+	GetTimeSeries(ctx context.Context, period, interval string) ([]TimeSeriesBucket, error)
+	GetLatencyPercentiles(ctx context.Context, period string) (*LatencyStats, error)
+	GetKeyUsage(ctx context.Context, keyID uuid.UUID, period, interval string, errorLimit int) (*KeyUsage, error)
+	GetDailyModelUsage(ctx context.Context, from, to time.Time, tokenClip int) ([]DailyModelUsage, error)
+
+	// Admission policies and policy canaries.
+	ListPolicies(ctx context.Context) ([]Policy, error)
+	GetPolicy(ctx context.Context, id uuid.UUID) (*Policy, error)
+	CreatePolicy(ctx context.Context, pc *PolicyCreate) (*Policy, error)
+	UpdatePolicy(ctx context.Context, id uuid.UUID, upd *PolicyUpdate) error
+	DeletePolicy(ctx context.Context, id uuid.UUID) error
+	ListPolicyCanaries(ctx context.Context) ([]PolicyCanary, error)
+	GetPolicyCanary(ctx context.Context, id uuid.UUID) (*PolicyCanary, error)
+	GetRunningPolicyCanary(ctx context.Context) (*PolicyCanary, error)
+	CreatePolicyCanary(ctx context.Context, cc *PolicyCanaryCreate) (*PolicyCanary, error)
+	RollBackPolicyCanary(ctx context.Context, id uuid.UUID, reason string) (bool, error)
+	PromotePolicyCanary(ctx context.Context, id uuid.UUID) (bool, error)
+	PolicyCanaryStats(ctx context.Context, id uuid.UUID) (*CanaryStats, error)
+
+	// Upstream pins.
+	ListUpstreamPins(ctx context.Context) ([]UpstreamPin, error)
+	CreateUpstreamPin(ctx context.Context, pc *UpstreamPinCreate) (*UpstreamPin, error)
+	DeleteUpstreamPin(ctx context.Context, id uuid.UUID) (bool, error)
+
+	// Quality audit sampling rules and the samples they capture.
+	ListAuditRules(ctx context.Context) ([]AuditRule, error)
+	SetAuditRule(ctx context.Context, rc *AuditRuleCreate) (*AuditRule, error)
+	DeleteAuditRule(ctx context.Context, id uuid.UUID) (bool, error)
+	ListAuditSamples(ctx context.Context, filter AuditSampleFilter) ([]AuditSample, int, error)
+	ViewAuditSample(ctx context.Context, id, viewer uuid.UUID) (*AuditSample, []AuditSampleView, error)
+	DeleteOldAuditSamples(ctx context.Context, olderThan time.Time) (int64, error)
+
+	// Guardrails.
+	ListGuardrails(ctx context.Context) ([]Guardrail, error)
+	GetGuardrail(ctx context.Context, id uuid.UUID) (*Guardrail, error)
+	CreateGuardrail(ctx context.Context, gc *GuardrailCreate) (*Guardrail, error)
+	UpdateGuardrail(ctx context.Context, id uuid.UUID, upd *GuardrailUpdate) error
+	DeleteGuardrail(ctx context.Context, id uuid.UUID) (bool, error)
+
+	// SCIM users and groups.
+	ListSCIMUsers(ctx context.Context, f SCIMFilter, offset, limit int) ([]SCIMUser, int, error)
+	GetSCIMUser(ctx context.Context, id uuid.UUID) (*SCIMUser, error)
+	CreateSCIMUser(ctx context.Context, w *SCIMUserWrite, keyHash, keyPrefix string) (*SCIMUser, error)
+	ReplaceSCIMUser(ctx context.Context, id uuid.UUID, w *SCIMUserWrite) (*SCIMUser, error)
+	DeleteSCIMUser(ctx context.Context, id uuid.UUID) (bool, error)
+	ListSCIMGroups(ctx context.Context, f SCIMFilter, offset, limit int) ([]SCIMGroup, int, error)
+	GetSCIMGroup(ctx context.Context, id uuid.UUID) (*SCIMGroup, error)
+	CreateSCIMGroup(ctx context.Context, w *SCIMGroupWrite) (*SCIMGroup, error)
+	ReplaceSCIMGroup(ctx context.Context, id uuid.UUID, w *SCIMGroupWrite) (*SCIMGroup, error)
+	DeleteSCIMGroup(ctx context.Context, id uuid.UUID) (bool, error)
+}
+
+var (
+	_ Store = (*Postgres)(nil)
+	_ Store = (*Memory)(nil)
+)
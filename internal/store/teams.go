@@ -0,0 +1,207 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Team groups LLM keys. Its allowlist and budgets apply to each member key
+// that sets none of its own; budgets are per key, not pooled across the
+// team.
+type Team struct {
+	ID            uuid.UUID `json:"id"`
+	Name          string    `json:"name"`
+	AllowedModels []string  `json:"allowed_models"`
+	DailyBudget   *float64  `json:"daily_budget_usd"`
+	MonthlyBudget *float64  `json:"monthly_budget_usd"`
+	KeyCount      int       `json:"key_count"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type TeamCreate struct {
+	Name          string   `json:"name"`
+	AllowedModels []string `json:"allowed_models"`
+}
+
+// TeamUpdate changes a team's name or allowlist; an empty allowlist removes
+// it.
+type TeamUpdate struct {
+	Name          *string   `json:"name,omitempty"`
+	AllowedModels *[]string `json:"allowed_models,omitempty"`
+}
+
+// TeamStats is a team's usage over a period, summed across its current
+// member keys.
+type TeamStats struct {
+	TeamID            uuid.UUID `json:"team_id"`
+	TeamName          string    `json:"team_name"`
+	Keys              int       `json:"keys"`
+	TotalRequests     int       `json:"total_requests"`
+	TotalInputTokens  int64     `json:"total_input_tokens"`
+	TotalOutputTokens int64     `json:"total_output_tokens"`
+	TotalCost         float64   `json:"total_cost"`
+}
+
+const teamColumns = `t.id, t.name, t.allowed_models, t.daily_budget_usd, t.monthly_budget_usd,
+	(SELECT COUNT(*) FROM llm_api_keys k WHERE k.team_id = t.id), t.created_at, t.updated_at`
+
+func scanTeam(row pgx.Row, t *Team) error {
+	return row.Scan(&t.ID, &t.Name, &t.AllowedModels, &t.DailyBudget, &t.MonthlyBudget, &t.KeyCount, &t.CreatedAt, &t.UpdatedAt)
+}
+
+// ListTeams returns all teams by name.
+func (s *Postgres) ListTeams(ctx context.Context) ([]Team, error) {
+	rows, err := s.pool.Query(ctx, `SELECT `+teamColumns+` FROM teams t ORDER BY t.name`)
+	if err != nil {
+		return nil, fmt.Errorf("list teams: %w", err)
+	}
+	defer rows.Close()
+
+	teams := make([]Team, 0)
+	for rows.Next() {
+		var t Team
+		if err := scanTeam(rows, &t); err != nil {
+			return nil, fmt.Errorf("scan team: %w", err)
+		}
+		teams = append(teams, t)
+	}
+	return teams, rows.Err()
+}
+
+func (s *Postgres) GetTeam(ctx context.Context, id uuid.UUID) (*Team, error) {
+	var t Team
+	err := scanTeam(s.pool.QueryRow(ctx, `SELECT `+teamColumns+` FROM teams t WHERE t.id = $1`, id), &t)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get team: %w", err)
+	}
+	return &t, nil
+}
+
+func (s *Postgres) CreateTeam(ctx context.Context, tc *TeamCreate) (*Team, error) {
+	var allowed []string // stored as NULL when empty
+	if len(tc.AllowedModels) > 0 {
+		allowed = tc.AllowedModels
+	}
+	var id uuid.UUID
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO teams (name, allowed_models) VALUES ($1, $2) RETURNING id
+	`, tc.Name, allowed).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("create team: %w", err)
+	}
+	return s.GetTeam(ctx, id)
+}
+
+func (s *Postgres) UpdateTeam(ctx context.Context, id uuid.UUID, upd *TeamUpdate) error {
+	sets := []string{}
+	args := []any{}
+	argIdx := 1
+
+	add := func(col string, v any) {
+		sets = append(sets, fmt.Sprintf("%s = $%d", col, argIdx))
+		args = append(args, v)
+		argIdx++
+	}
+	if upd.Name != nil {
+		add("name", *upd.Name)
+	}
+	if upd.AllowedModels != nil {
+		var allowed []string
+		if len(*upd.AllowedModels) > 0 {
+			allowed = *upd.AllowedModels
+		}
+		add("allowed_models", allowed)
+	}
+
+	if len(sets) == 0 {
+		return nil
+	}
+
+	sets = append(sets, "updated_at = now()")
+	args = append(args, id)
+
+	query := fmt.Sprintf("UPDATE teams SET %s WHERE id = $%d", strings.Join(sets, ", "), argIdx)
+	if _, err := s.pool.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("update team: %w", err)
+	}
+	return nil
+}
+
+// DeleteTeam deletes a team; its keys are left without one.
+func (s *Postgres) DeleteTeam(ctx context.Context, id uuid.UUID) error {
+	if _, err := s.pool.Exec(ctx, "DELETE FROM teams WHERE id = $1", id); err != nil {
+		return fmt.Errorf("delete team: %w", err)
+	}
+	return nil
+}
+
+// SetTeamBudgets replaces the team's spend budgets; nil removes one. It
+// reports false when the team does not exist.
+func (s *Postgres) SetTeamBudgets(ctx context.Context, id uuid.UUID, daily, monthly *float64) (bool, error) {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE teams SET daily_budget_usd = $2, monthly_budget_usd = $3, updated_at = now()
+		WHERE id = $1
+	`, id, daily, monthly)
+	if err != nil {
+		return false, fmt.Errorf("set team budgets: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// SetLLMKeyTeam moves the key into a team, or out of its team when teamID
+// is nil. It reports false when the key does not exist; a team that does
+// not exist is an error.
+func (s *Postgres) SetLLMKeyTeam(ctx context.Context, keyID uuid.UUID, teamID *uuid.UUID) (bool, error) {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE llm_api_keys SET team_id = $2, updated_at = now() WHERE id = $1
+	`, keyID, teamID)
+	if err != nil {
+		return false, fmt.Errorf("set llm key team: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetStatsByTeam returns the usage of every team with requests in the
+// period, by spend. Requests count toward the team their key is in now.
+func (s *Postgres) GetStatsByTeam(ctx context.Context, period string) ([]TeamStats, error) {
+	interval := periodToInterval(period)
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT t.id, t.name, COUNT(DISTINCT k.id),
+			COUNT(*), COALESCE(SUM(rl.input_tokens), 0), COALESCE(SUM(rl.output_tokens), 0),
+			COALESCE(SUM(rl.cost), 0)
+		FROM request_logs rl
+		JOIN llm_api_keys k ON k.id = rl.llm_key_id
+		JOIN teams t ON t.id = k.team_id
+		WHERE rl.timestamp > now() - $1::interval
+		GROUP BY t.id, t.name
+		ORDER BY SUM(rl.cost) DESC
+	`, interval)
+	if err != nil {
+		return nil, fmt.Errorf("get stats by team: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make([]TeamStats, 0)
+	for rows.Next() {
+		var ts TeamStats
+		if err := rows.Scan(
+			&ts.TeamID, &ts.TeamName, &ts.Keys,
+			&ts.TotalRequests, &ts.TotalInputTokens, &ts.TotalOutputTokens,
+			&ts.TotalCost,
+		); err != nil {
+			return nil, fmt.Errorf("scan team stats: %w", err)
+		}
+		stats = append(stats, ts)
+	}
+	return stats, rows.Err()
+}
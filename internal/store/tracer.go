@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"log"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SlowQueryCounter is an interface for reporting slow query metrics.
+type SlowQueryCounter interface {
+	Add(float64)
+}
+
+// SlowQueryTracer is a pgx query tracer that logs every query slower than
+// its threshold together with the pxbin call sites that issued it, so
+// database-induced proxy latency can be traced to a store method and its
+// caller.
+type SlowQueryTracer struct {
+	threshold time.Duration
+	counter   atomic.Value // SlowQueryCounter
+}
+
+// NewSlowQueryTracer creates a tracer logging queries that take at least
+// threshold.
+func NewSlowQueryTracer(threshold time.Duration) *SlowQueryTracer {
+	return &SlowQueryTracer{threshold: threshold}
+}
+
+// SetCounter sets an optional counter incremented for each slow query. It
+// may be called after the pool is in use.
+func (t *SlowQueryTracer) SetCounter(c SlowQueryCounter) {
+	t.counter.Store(c)
+}
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	sql   string
+	start time.Time
+}
+
+func (t *SlowQueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{sql: data.SQL, start: time.Now()})
+}
+
+func (t *SlowQueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	qs, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(qs.start)
+	if elapsed < t.threshold {
+		return
+	}
+	if c, ok := t.counter.Load().(SlowQueryCounter); ok {
+		c.Add(1)
+	}
+	status := "ok"
+	if data.Err != nil {
+		status = data.Err.Error()
+	}
+	// pgx ends a Query trace when its rows are closed, which the store
+	// methods do before returning, so the issuing frames are still on the
+	// stack.
+	log.Printf("slow query: %s (%s) at %s: %s", elapsed.Round(time.Millisecond), status, callSites(3), compactSQL(qs.sql))
+}
+
+// callSites returns up to n pxbin frames above the tracer, innermost first.
+func callSites(n int) string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	var sites []string
+	for len(sites) < n {
+		f, more := frames.Next()
+		if strings.Contains(f.Function, "github.com/sertdev/pxbin/") && !strings.HasSuffix(f.File, "/store/tracer.go") {
+			fn := f.Function[strings.LastIndex(f.Function, "/")+1:]
+			file := f.File[strings.LastIndex(f.File, "/")+1:]
+			sites = append(sites, fn+" ("+file+":"+strconv.Itoa(f.Line)+")")
+		}
+		if !more {
+			break
+		}
+	}
+	if len(sites) == 0 {
+		return "unknown"
+	}
+	return strings.Join(sites, " <- ")
+}
+
+// compactSQL collapses whitespace so a query fits on one log line, and
+// truncates very long statements.
+func compactSQL(sql string) string {
+	s := strings.Join(strings.Fields(sql), " ")
+	if len(s) > 500 {
+		s = s[:500] + "..."
+	}
+	return s
+}
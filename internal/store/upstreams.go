@@ -20,16 +20,62 @@ type Upstream struct {
 	Format          string    `json:"format"`
 	IsActive        bool      `json:"is_active"`
 	Priority        int       `json:"priority"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	Availability    Schedule  `json:"availability"`
+	Region          *string   `json:"region"` // e.g. "eu"; nil when unset
+	RoleMap         RoleMap   `json:"role_map"`
+	// MaxSSEFrameBytes caps a single streamed SSE line from this upstream;
+	// nil uses the proxy-wide max_sse_frame_bytes.
+	MaxSSEFrameBytes *int `json:"max_sse_frame_bytes"`
+	// StreamIdleTimeoutSeconds ends a stream from this upstream that sends
+	// nothing for this long; nil uses the proxy-wide
+	// stream_idle_timeout_seconds.
+	StreamIdleTimeoutSeconds *int `json:"stream_idle_timeout_seconds"`
+	// ServiceTiers maps x-pxbin-priority values to the service_tier sent
+	// to this upstream.
+	ServiceTiers ServiceTiers `json:"service_tiers"`
+	// AutoImportModels lets the discovery sync create models it finds on
+	// this upstream.
+	AutoImportModels bool `json:"auto_import_models"`
+	// DisableCompression stops asking this upstream for compressed
+	// non-streaming responses.
+	DisableCompression bool `json:"disable_compression"`
+	// Extension names a WASM module in extensions_dir that patches request
+	// and response JSON for this upstream's dialect; nil runs none.
+	Extension *string `json:"extension"`
+	// AnthropicBetas sets default and allowed anthropic-beta flags for
+	// this upstream; nil forwards the client's flags unchanged.
+	AnthropicBetas *AnthropicBetas `json:"anthropic_betas"`
+	// Resilience overrides the circuit breaker and retry settings for
+	// this upstream; nil uses the proxy-wide ones.
+	Resilience *ResiliencePolicy `json:"resilience"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
 }
 
 type UpstreamCreate struct {
-	Name     string `json:"name"`
-	BaseURL  string `json:"base_url"`
-	APIKey   string `json:"api_key"`
-	Format   string `json:"format"`
-	Priority int    `json:"priority"`
+	Name     string  `json:"name"`
+	BaseURL  string  `json:"base_url"`
+	APIKey   string  `json:"api_key"`
+	Format   string  `json:"format"`
+	Priority int     `json:"priority"`
+	Region   *string `json:"region"`
+
+	Availability Schedule `json:"availability"`
+	RoleMap      RoleMap  `json:"role_map"`
+
+	ServiceTiers ServiceTiers `json:"service_tiers"`
+
+	MaxSSEFrameBytes *int `json:"max_sse_frame_bytes"`
+	AutoImportModels bool `json:"auto_import_models"`
+
+	StreamIdleTimeoutSeconds *int `json:"stream_idle_timeout_seconds"`
+
+	DisableCompression bool    `json:"disable_compression"`
+	Extension          *string `json:"extension"`
+
+	AnthropicBetas *AnthropicBetas `json:"anthropic_betas"`
+
+	Resilience *ResiliencePolicy `json:"resilience"`
 }
 
 type UpstreamUpdate struct {
@@ -39,10 +85,28 @@ type UpstreamUpdate struct {
 	Format   *string `json:"format,omitempty"`
 	Priority *int    `json:"priority,omitempty"`
 	IsActive *bool   `json:"is_active,omitempty"`
+	Region   *string `json:"region,omitempty"` // "" clears the region
+
+	Availability *Schedule `json:"availability,omitempty"`
+	RoleMap      *RoleMap  `json:"role_map,omitempty"` // {} clears the mapping
+
+	ServiceTiers *ServiceTiers `json:"service_tiers,omitempty"` // {} clears the mapping
+
+	MaxSSEFrameBytes *int  `json:"max_sse_frame_bytes,omitempty"` // 0 restores the default
+	AutoImportModels *bool `json:"auto_import_models,omitempty"`
+
+	StreamIdleTimeoutSeconds *int `json:"stream_idle_timeout_seconds,omitempty"` // 0 restores the default
+
+	DisableCompression *bool   `json:"disable_compression,omitempty"`
+	Extension          *string `json:"extension,omitempty"` // "" removes the extension
+
+	AnthropicBetas *AnthropicBetas `json:"anthropic_betas,omitempty"` // {} restores the default
+
+	Resilience *ResiliencePolicy `json:"resilience,omitempty"` // {} restores the defaults
 }
 
 // encryptAPIKey encrypts an API key if an encryption key is configured.
-func (s *Store) encryptAPIKey(apiKey string) string {
+func (s *Postgres) encryptAPIKey(apiKey string) string {
 	if s.encryptionKey == nil || apiKey == "" {
 		return apiKey
 	}
@@ -56,7 +120,7 @@ func (s *Store) encryptAPIKey(apiKey string) string {
 
 // decryptAPIKey decrypts an API key if it's encrypted. Handles legacy
 // plaintext values gracefully.
-func (s *Store) decryptAPIKey(stored string) string {
+func (s *Postgres) decryptAPIKey(stored string) string {
 	if s.encryptionKey == nil || stored == "" {
 		return stored
 	}
@@ -72,9 +136,9 @@ func (s *Store) decryptAPIKey(stored string) string {
 	return string(decrypted)
 }
 
-func (s *Store) ListUpstreams(ctx context.Context) ([]Upstream, error) {
+func (s *Postgres) ListUpstreams(ctx context.Context) ([]Upstream, error) {
 	rows, err := s.pool.Query(ctx, `
-		SELECT id, name, base_url, api_key_encrypted, format, is_active, priority, created_at, updated_at
+		SELECT id, name, base_url, api_key_encrypted, format, is_active, priority, availability, region, role_map, service_tiers, max_sse_frame_bytes, auto_import_models, disable_compression, extension, stream_idle_timeout_seconds, anthropic_betas, resilience, created_at, updated_at
 		FROM upstreams ORDER BY priority DESC, name
 	`)
 	if err != nil {
@@ -87,7 +151,7 @@ func (s *Store) ListUpstreams(ctx context.Context) ([]Upstream, error) {
 		var u Upstream
 		if err := rows.Scan(
 			&u.ID, &u.Name, &u.BaseURL, &u.APIKeyEncrypted,
-			&u.Format, &u.IsActive, &u.Priority, &u.CreatedAt, &u.UpdatedAt,
+			&u.Format, &u.IsActive, &u.Priority, &u.Availability, &u.Region, &u.RoleMap, &u.ServiceTiers, &u.MaxSSEFrameBytes, &u.AutoImportModels, &u.DisableCompression, &u.Extension, &u.StreamIdleTimeoutSeconds, &u.AnthropicBetas, &u.Resilience, &u.CreatedAt, &u.UpdatedAt,
 		); err != nil {
 			return nil, fmt.Errorf("scan upstream: %w", err)
 		}
@@ -97,14 +161,96 @@ func (s *Store) ListUpstreams(ctx context.Context) ([]Upstream, error) {
 	return upstreams, rows.Err()
 }
 
-func (s *Store) GetUpstream(ctx context.Context, id uuid.UUID) (*Upstream, error) {
+// UpstreamFilter narrows and orders ListUpstreamsFiltered. PerPage <= 0
+// returns all matching upstreams.
+type UpstreamFilter struct {
+	Format   *string
+	IsActive *bool
+	Search   *string // case-insensitive match on name or base_url
+	Sort     string  // name, created_at, or priority; "-" prefix for descending
+	Page     int
+	PerPage  int
+}
+
+var upstreamSortColumns = map[string]string{
+	"name":       "name",
+	"created_at": "created_at",
+	"priority":   "priority",
+}
+
+// ListUpstreamsFiltered returns upstreams matching filter and the total
+// number of matches before pagination.
+func (s *Postgres) ListUpstreamsFiltered(ctx context.Context, filter UpstreamFilter) ([]Upstream, int, error) {
+	conditions := []string{}
+	args := []any{}
+	argIdx := 1
+
+	if filter.Format != nil {
+		conditions = append(conditions, fmt.Sprintf("format = $%d", argIdx))
+		args = append(args, *filter.Format)
+		argIdx++
+	}
+	if filter.IsActive != nil {
+		conditions = append(conditions, fmt.Sprintf("is_active = $%d", argIdx))
+		args = append(args, *filter.IsActive)
+		argIdx++
+	}
+	if filter.Search != nil {
+		conditions = append(conditions, fmt.Sprintf("(name ILIKE $%d OR base_url ILIKE $%d)", argIdx, argIdx))
+		args = append(args, "%"+escapeLike(*filter.Search)+"%")
+		argIdx++
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	order, err := orderBy(filter.Sort, upstreamSortColumns, "priority DESC, name")
+	if err != nil {
+		return nil, 0, err
+	}
+	limit, limitArgs := limitOffset(filter.Page, filter.PerPage, argIdx)
+	args = append(args, limitArgs...)
+
+	query := fmt.Sprintf(`
+		SELECT id, name, base_url, api_key_encrypted, format, is_active, priority, availability, region, role_map, service_tiers, max_sse_frame_bytes, auto_import_models, disable_compression, extension, stream_idle_timeout_seconds, anthropic_betas, resilience, created_at, updated_at,
+		       COUNT(*) OVER() as total
+		FROM upstreams %s
+		ORDER BY %s
+		%s`, where, order, limit)
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list upstreams: %w", err)
+	}
+	defer rows.Close()
+
+	upstreams := make([]Upstream, 0)
+	var total int
+	for rows.Next() {
+		var u Upstream
+		if err := rows.Scan(
+			&u.ID, &u.Name, &u.BaseURL, &u.APIKeyEncrypted,
+			&u.Format, &u.IsActive, &u.Priority, &u.Availability, &u.Region, &u.RoleMap, &u.ServiceTiers, &u.MaxSSEFrameBytes, &u.AutoImportModels, &u.DisableCompression, &u.Extension, &u.StreamIdleTimeoutSeconds, &u.AnthropicBetas, &u.Resilience, &u.CreatedAt, &u.UpdatedAt,
+			&total,
+		); err != nil {
+			return nil, 0, fmt.Errorf("scan upstream: %w", err)
+		}
+		u.APIKeyEncrypted = s.decryptAPIKey(u.APIKeyEncrypted)
+		upstreams = append(upstreams, u)
+	}
+	return upstreams, total, rows.Err()
+}
+
+func (s *Postgres) GetUpstream(ctx context.Context, id uuid.UUID) (*Upstream, error) {
 	var u Upstream
 	err := s.pool.QueryRow(ctx, `
-		SELECT id, name, base_url, api_key_encrypted, format, is_active, priority, created_at, updated_at
+		SELECT id, name, base_url, api_key_encrypted, format, is_active, priority, availability, region, role_map, service_tiers, max_sse_frame_bytes, auto_import_models, disable_compression, extension, stream_idle_timeout_seconds, anthropic_betas, resilience, created_at, updated_at
 		FROM upstreams WHERE id = $1
 	`, id).Scan(
 		&u.ID, &u.Name, &u.BaseURL, &u.APIKeyEncrypted,
-		&u.Format, &u.IsActive, &u.Priority, &u.CreatedAt, &u.UpdatedAt,
+		&u.Format, &u.IsActive, &u.Priority, &u.Availability, &u.Region, &u.RoleMap, &u.ServiceTiers, &u.MaxSSEFrameBytes, &u.AutoImportModels, &u.DisableCompression, &u.Extension, &u.StreamIdleTimeoutSeconds, &u.AnthropicBetas, &u.Resilience, &u.CreatedAt, &u.UpdatedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -116,14 +262,14 @@ func (s *Store) GetUpstream(ctx context.Context, id uuid.UUID) (*Upstream, error
 	return &u, nil
 }
 
-func (s *Store) GetActiveUpstream(ctx context.Context) (*Upstream, error) {
+func (s *Postgres) GetActiveUpstream(ctx context.Context) (*Upstream, error) {
 	var u Upstream
 	err := s.pool.QueryRow(ctx, `
-		SELECT id, name, base_url, api_key_encrypted, format, is_active, priority, created_at, updated_at
+		SELECT id, name, base_url, api_key_encrypted, format, is_active, priority, availability, region, role_map, service_tiers, max_sse_frame_bytes, auto_import_models, disable_compression, extension, stream_idle_timeout_seconds, anthropic_betas, resilience, created_at, updated_at
 		FROM upstreams WHERE is_active = true ORDER BY priority DESC LIMIT 1
 	`).Scan(
 		&u.ID, &u.Name, &u.BaseURL, &u.APIKeyEncrypted,
-		&u.Format, &u.IsActive, &u.Priority, &u.CreatedAt, &u.UpdatedAt,
+		&u.Format, &u.IsActive, &u.Priority, &u.Availability, &u.Region, &u.RoleMap, &u.ServiceTiers, &u.MaxSSEFrameBytes, &u.AutoImportModels, &u.DisableCompression, &u.Extension, &u.StreamIdleTimeoutSeconds, &u.AnthropicBetas, &u.Resilience, &u.CreatedAt, &u.UpdatedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -135,7 +281,7 @@ func (s *Store) GetActiveUpstream(ctx context.Context) (*Upstream, error) {
 	return &u, nil
 }
 
-func (s *Store) CreateUpstream(ctx context.Context, uc *UpstreamCreate) (*Upstream, error) {
+func (s *Postgres) CreateUpstream(ctx context.Context, uc *UpstreamCreate) (*Upstream, error) {
 	format := uc.Format
 	if format == "" {
 		format = "openai"
@@ -143,12 +289,12 @@ func (s *Store) CreateUpstream(ctx context.Context, uc *UpstreamCreate) (*Upstre
 	encryptedKey := s.encryptAPIKey(uc.APIKey)
 	var u Upstream
 	err := s.pool.QueryRow(ctx, `
-		INSERT INTO upstreams (name, base_url, api_key_encrypted, format, priority)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, name, base_url, api_key_encrypted, format, is_active, priority, created_at, updated_at
-	`, uc.Name, uc.BaseURL, encryptedKey, format, uc.Priority).Scan(
+		INSERT INTO upstreams (name, base_url, api_key_encrypted, format, priority, availability, region, role_map, service_tiers, max_sse_frame_bytes, auto_import_models, disable_compression, extension, stream_idle_timeout_seconds, anthropic_betas, resilience)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, NULLIF($10, 0), $11, $12, NULLIF($13, ''), NULLIF($14, 0), $15, $16)
+		RETURNING id, name, base_url, api_key_encrypted, format, is_active, priority, availability, region, role_map, service_tiers, max_sse_frame_bytes, auto_import_models, disable_compression, extension, stream_idle_timeout_seconds, anthropic_betas, resilience, created_at, updated_at
+	`, uc.Name, uc.BaseURL, encryptedKey, format, uc.Priority, uc.Availability, uc.Region, uc.RoleMap, uc.ServiceTiers, uc.MaxSSEFrameBytes, uc.AutoImportModels, uc.DisableCompression, uc.Extension, uc.StreamIdleTimeoutSeconds, uc.AnthropicBetas, uc.Resilience).Scan(
 		&u.ID, &u.Name, &u.BaseURL, &u.APIKeyEncrypted,
-		&u.Format, &u.IsActive, &u.Priority, &u.CreatedAt, &u.UpdatedAt,
+		&u.Format, &u.IsActive, &u.Priority, &u.Availability, &u.Region, &u.RoleMap, &u.ServiceTiers, &u.MaxSSEFrameBytes, &u.AutoImportModels, &u.DisableCompression, &u.Extension, &u.StreamIdleTimeoutSeconds, &u.AnthropicBetas, &u.Resilience, &u.CreatedAt, &u.UpdatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("create upstream: %w", err)
@@ -157,7 +303,7 @@ func (s *Store) CreateUpstream(ctx context.Context, uc *UpstreamCreate) (*Upstre
 	return &u, nil
 }
 
-func (s *Store) UpdateUpstream(ctx context.Context, id uuid.UUID, upd *UpstreamUpdate) error {
+func (s *Postgres) UpdateUpstream(ctx context.Context, id uuid.UUID, upd *UpstreamUpdate) error {
 	sets := []string{}
 	args := []any{}
 	argIdx := 1
@@ -192,6 +338,62 @@ func (s *Store) UpdateUpstream(ctx context.Context, id uuid.UUID, upd *UpstreamU
 		args = append(args, *upd.IsActive)
 		argIdx++
 	}
+	if upd.Availability != nil {
+		sets = append(sets, fmt.Sprintf("availability = $%d", argIdx))
+		args = append(args, *upd.Availability)
+		argIdx++
+	}
+	if upd.Region != nil {
+		sets = append(sets, fmt.Sprintf("region = NULLIF($%d, '')", argIdx))
+		args = append(args, *upd.Region)
+		argIdx++
+	}
+	if upd.RoleMap != nil {
+		sets = append(sets, fmt.Sprintf("role_map = $%d", argIdx))
+		args = append(args, *upd.RoleMap)
+		argIdx++
+	}
+	if upd.ServiceTiers != nil {
+		sets = append(sets, fmt.Sprintf("service_tiers = $%d", argIdx))
+		args = append(args, *upd.ServiceTiers)
+		argIdx++
+	}
+	if upd.MaxSSEFrameBytes != nil {
+		sets = append(sets, fmt.Sprintf("max_sse_frame_bytes = NULLIF($%d, 0)", argIdx))
+		args = append(args, *upd.MaxSSEFrameBytes)
+		argIdx++
+	}
+	if upd.StreamIdleTimeoutSeconds != nil {
+		sets = append(sets, fmt.Sprintf("stream_idle_timeout_seconds = NULLIF($%d, 0)", argIdx))
+		args = append(args, *upd.StreamIdleTimeoutSeconds)
+		argIdx++
+	}
+	if upd.AutoImportModels != nil {
+		sets = append(sets, fmt.Sprintf("auto_import_models = $%d", argIdx))
+		args = append(args, *upd.AutoImportModels)
+		argIdx++
+	}
+
+	if upd.DisableCompression != nil {
+		sets = append(sets, fmt.Sprintf("disable_compression = $%d", argIdx))
+		args = append(args, *upd.DisableCompression)
+		argIdx++
+	}
+	if upd.Extension != nil {
+		sets = append(sets, fmt.Sprintf("extension = NULLIF($%d, '')", argIdx))
+		args = append(args, *upd.Extension)
+		argIdx++
+	}
+	if upd.AnthropicBetas != nil {
+		sets = append(sets, fmt.Sprintf("anthropic_betas = $%d", argIdx))
+		args = append(args, upd.AnthropicBetas)
+		argIdx++
+	}
+	if upd.Resilience != nil {
+		sets = append(sets, fmt.Sprintf("resilience = $%d", argIdx))
+		args = append(args, upd.Resilience)
+		argIdx++
+	}
 
 	if len(sets) == 0 {
 		return nil
@@ -208,7 +410,7 @@ func (s *Store) UpdateUpstream(ctx context.Context, id uuid.UUID, upd *UpstreamU
 	return nil
 }
 
-func (s *Store) DeleteUpstream(ctx context.Context, id uuid.UUID) error {
+func (s *Postgres) DeleteUpstream(ctx context.Context, id uuid.UUID) error {
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("begin tx: %w", err)
@@ -219,6 +421,9 @@ func (s *Store) DeleteUpstream(ctx context.Context, id uuid.UUID) error {
 	if _, err := tx.Exec(ctx, "UPDATE models SET upstream_id = NULL WHERE upstream_id = $1", id); err != nil {
 		return fmt.Errorf("clear model refs: %w", err)
 	}
+	if _, err := tx.Exec(ctx, "UPDATE models SET fallback_upstream_ids = array_remove(fallback_upstream_ids, $1) WHERE $1 = ANY(fallback_upstream_ids)", id); err != nil {
+		return fmt.Errorf("clear model fallback refs: %w", err)
+	}
 	if _, err := tx.Exec(ctx, "UPDATE request_logs SET upstream_id = NULL WHERE upstream_id = $1", id); err != nil {
 		return fmt.Errorf("clear log refs: %w", err)
 	}
@@ -229,7 +434,7 @@ func (s *Store) DeleteUpstream(ctx context.Context, id uuid.UUID) error {
 	return tx.Commit(ctx)
 }
 
-func (s *Store) DeleteUpstreams(ctx context.Context, ids []uuid.UUID) (int64, error) {
+func (s *Postgres) DeleteUpstreams(ctx context.Context, ids []uuid.UUID) (int64, error) {
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("begin tx: %w", err)
@@ -239,6 +444,13 @@ func (s *Store) DeleteUpstreams(ctx context.Context, ids []uuid.UUID) (int64, er
 	if _, err := tx.Exec(ctx, "UPDATE models SET upstream_id = NULL WHERE upstream_id = ANY($1)", ids); err != nil {
 		return 0, fmt.Errorf("clear model refs: %w", err)
 	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE models
+		SET fallback_upstream_ids = ARRAY(SELECT f FROM unnest(fallback_upstream_ids) f WHERE f <> ALL($1))
+		WHERE fallback_upstream_ids && $1
+	`, ids); err != nil {
+		return 0, fmt.Errorf("clear model fallback refs: %w", err)
+	}
 	if _, err := tx.Exec(ctx, "UPDATE request_logs SET upstream_id = NULL WHERE upstream_id = ANY($1)", ids); err != nil {
 		return 0, fmt.Errorf("clear log refs: %w", err)
 	}
@@ -252,3 +464,69 @@ func (s *Store) DeleteUpstreams(ctx context.Context, ids []uuid.UUID) (int64, er
 	}
 	return ct.RowsAffected(), nil
 }
+
+// UpstreamScore is an upstream's saved window of recent outcomes, oldest
+// first; LatenciesMS and Successes are parallel.
+type UpstreamScore struct {
+	UpstreamID          uuid.UUID
+	LatenciesMS         []int32
+	Successes           []bool
+	ConsecutiveFailures int
+	LastFailureAt       *time.Time
+	UpdatedAt           time.Time
+}
+
+func (s *Postgres) ListUpstreamScores(ctx context.Context) ([]UpstreamScore, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT upstream_id, latencies_ms, successes, consecutive_failures, last_failure_at, updated_at
+		FROM upstream_scores
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list upstream scores: %w", err)
+	}
+	defer rows.Close()
+
+	var scores []UpstreamScore
+	for rows.Next() {
+		var sc UpstreamScore
+		if err := rows.Scan(&sc.UpstreamID, &sc.LatenciesMS, &sc.Successes, &sc.ConsecutiveFailures, &sc.LastFailureAt, &sc.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan upstream score: %w", err)
+		}
+		scores = append(scores, sc)
+	}
+	return scores, rows.Err()
+}
+
+// SaveUpstreamScores upserts scores, skipping upstreams deleted since they
+// were recorded.
+func (s *Postgres) SaveUpstreamScores(ctx context.Context, scores []UpstreamScore) error {
+	if len(scores) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	query := `
+		INSERT INTO upstream_scores (upstream_id, latencies_ms, successes, consecutive_failures, last_failure_at, updated_at)
+		SELECT $1::uuid, $2::int[], $3::boolean[], $4::int, $5::timestamptz, $6::timestamptz
+		WHERE EXISTS (SELECT 1 FROM upstreams WHERE id = $1)
+		ON CONFLICT (upstream_id) DO UPDATE SET
+			latencies_ms = EXCLUDED.latencies_ms,
+			successes = EXCLUDED.successes,
+			consecutive_failures = EXCLUDED.consecutive_failures,
+			last_failure_at = EXCLUDED.last_failure_at,
+			updated_at = EXCLUDED.updated_at`
+
+	for _, sc := range scores {
+		batch.Queue(query, sc.UpstreamID, sc.LatenciesMS, sc.Successes, sc.ConsecutiveFailures, sc.LastFailureAt, sc.UpdatedAt)
+	}
+
+	br := s.pool.SendBatch(ctx, batch)
+	defer br.Close()
+
+	for range scores {
+		if _, err := br.Exec(); err != nil {
+			return fmt.Errorf("save upstream scores: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package streamtap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// structuralKeys are the JSON fields whose strings describe a stream's shape
+// rather than its content, and are kept by Redact.
+var structuralKeys = map[string]bool{
+	"type":               true,
+	"event":              true,
+	"object":             true,
+	"id":                 true,
+	"item_id":            true,
+	"call_id":            true,
+	"tool_use_id":        true,
+	"model":              true,
+	"role":               true,
+	"name":               true,
+	"status":             true,
+	"stop_reason":        true,
+	"finish_reason":      true,
+	"finishReason":       true,
+	"system_fingerprint": true,
+	"service_tier":       true,
+	"code":               true,
+}
+
+// Redact returns an SSE event with the content of its data lines masked:
+// every JSON string outside structuralKeys becomes "[N bytes]", keeping
+// the event's shape, field names, numbers and sizes. Data that is not JSON
+// is replaced by a note with its size, since it cannot be masked field by
+// field. Keys of masked objects come out sorted.
+func Redact(raw []byte) []byte {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(raw, []byte("\n")) {
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			out.Write(line)
+			continue
+		}
+		eol := data[len(bytes.TrimRight(data, "\r\n")):]
+		data = bytes.TrimSpace(data)
+		out.WriteString("data: ")
+		out.Write(redactData(data))
+		out.Write(eol)
+	}
+	return out.Bytes()
+}
+
+func redactData(data []byte) []byte {
+	if string(data) == "[DONE]" || len(data) == 0 {
+		return data
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if dec.Decode(&v) != nil || dec.More() {
+		return fmt.Appendf(nil, "[invalid JSON, %d bytes]", len(data))
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(redactValue(v, false))
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// redactValue masks the strings in v, unless keep is set for a string
+// under a structural key.
+func redactValue(v any, keep bool) any {
+	switch v := v.(type) {
+	case string:
+		if keep {
+			return v
+		}
+		return fmt.Sprintf("[%d bytes]", len(v))
+	case map[string]any:
+		for k, item := range v {
+			v[k] = redactValue(item, structuralKeys[k])
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(item, false)
+		}
+	}
+	return v
+}
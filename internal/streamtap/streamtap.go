@@ -0,0 +1,298 @@
+// Package streamtap lets operators watch in-flight streaming responses as
+// the client receives them, to debug streams that go wrong mid-way without
+// asking the client to capture its traffic. Streams are found by the
+// X-Request-ID the proxy returned to the client. Watchers only read: a slow
+// watcher misses events rather than slowing the stream down.
+package streamtap
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sertdev/pxbin/internal/auth"
+)
+
+// watchBuffer is how many events wait for a watcher before newer ones are
+// dropped for it.
+const watchBuffer = 256
+
+// Stream describes an in-flight stream.
+type Stream struct {
+	RequestID string    `json:"request_id"`
+	KeyID     uuid.UUID `json:"key_id"`
+	Path      string    `json:"path"`
+	StartedAt time.Time `json:"started_at"`
+	Events    int64     `json:"events"` // sent to the client so far
+	Bytes     int64     `json:"bytes"`
+	Watchers  int       `json:"watchers"`
+}
+
+// Event is one SSE event of a watched stream, as the client received it.
+type Event struct {
+	Seq int64     // 1 for the stream's first event
+	At  time.Time // when it was written
+	Raw []byte    // the event's lines, blank line included
+}
+
+// Registry tracks the streams in flight and their watchers.
+type Registry struct {
+	mu      sync.Mutex
+	streams map[string]*stream
+}
+
+func New() *Registry {
+	return &Registry{streams: make(map[string]*stream)}
+}
+
+type stream struct {
+	info   Stream // RequestID, KeyID, Path and StartedAt
+	events atomic.Int64
+	bytes  atomic.Int64
+
+	mu       sync.Mutex
+	watchers []*Watcher
+	ended    bool
+}
+
+// Watcher receives the events of one stream. Events is closed when the
+// stream ends or Close is called.
+type Watcher struct {
+	Events  <-chan Event
+	ch      chan Event
+	dropped atomic.Int64
+	stream  *stream
+	once    sync.Once
+}
+
+// Dropped returns how many events were dropped because the watcher fell
+// behind.
+func (w *Watcher) Dropped() int64 {
+	return w.dropped.Load()
+}
+
+// Sent returns how many events the stream's client has been sent.
+func (w *Watcher) Sent() int64 {
+	return w.stream.events.Load()
+}
+
+// Close stops watching.
+func (w *Watcher) Close() {
+	st := w.stream
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if i := slices.Index(st.watchers, w); i >= 0 {
+		st.watchers = slices.Delete(st.watchers, i, i+1)
+	}
+	w.close()
+}
+
+// close closes the watcher's channel. st.mu must be held.
+func (w *Watcher) close() {
+	w.once.Do(func() { close(w.ch) })
+}
+
+// List returns the streams in flight, oldest first.
+func (reg *Registry) List() []Stream {
+	if reg == nil {
+		return []Stream{}
+	}
+	reg.mu.Lock()
+	streams := make([]Stream, 0, len(reg.streams))
+	for _, st := range reg.streams {
+		streams = append(streams, st.snapshot())
+	}
+	reg.mu.Unlock()
+	slices.SortFunc(streams, func(a, b Stream) int { return a.StartedAt.Compare(b.StartedAt) })
+	return streams
+}
+
+// Watch attaches a watcher to the in-flight stream of request requestID.
+// It returns false if there is none on this instance.
+func (reg *Registry) Watch(requestID string) (*Watcher, Stream, bool) {
+	reg.mu.Lock()
+	st := reg.streams[requestID]
+	reg.mu.Unlock()
+	if st == nil {
+		return nil, Stream{}, false
+	}
+
+	ch := make(chan Event, watchBuffer)
+	w := &Watcher{Events: ch, ch: ch, stream: st}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.ended {
+		return nil, Stream{}, false
+	}
+	st.watchers = append(st.watchers, w)
+	return w, st.snapshotLocked(), true
+}
+
+func (st *stream) snapshot() Stream {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.snapshotLocked()
+}
+
+func (st *stream) snapshotLocked() Stream {
+	s := st.info
+	s.Events = st.events.Load()
+	s.Bytes = st.bytes.Load()
+	s.Watchers = len(st.watchers)
+	return s
+}
+
+// publish sends an event to the stream's watchers.
+func (st *stream) publish(raw []byte) {
+	seq := st.events.Add(1)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.watchers) == 0 {
+		return
+	}
+	ev := Event{Seq: seq, At: time.Now(), Raw: raw}
+	for _, w := range st.watchers {
+		select {
+		case w.ch <- ev:
+		default:
+			w.dropped.Add(1)
+		}
+	}
+}
+
+func (st *stream) end() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.ended = true
+	for _, w := range st.watchers {
+		w.close()
+	}
+	st.watchers = nil
+}
+
+// Middleware registers every successful SSE response under the request's
+// X-Request-ID while it is written.
+func (reg *Registry) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := w.Header().Get("X-Request-ID")
+		if requestID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		tw := &tapWriter{ResponseWriter: w, reg: reg, info: Stream{
+			RequestID: requestID,
+			KeyID:     auth.GetKeyIDFromContext(r.Context()),
+			Path:      r.URL.Path,
+		}}
+		defer tw.finish()
+		next.ServeHTTP(tw, r)
+	})
+}
+
+func (reg *Registry) add(st *stream) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.streams[st.info.RequestID] = st
+}
+
+func (reg *Registry) remove(st *stream) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.streams[st.info.RequestID] == st {
+		delete(reg.streams, st.info.RequestID)
+	}
+}
+
+// tapWriter publishes the events of a successful SSE response to the
+// stream's watchers.
+type tapWriter struct {
+	http.ResponseWriter
+	reg  *Registry
+	info Stream
+
+	wroteHeader bool
+	stream      *stream
+	pending     []byte // unterminated event
+}
+
+func (tw *tapWriter) WriteHeader(status int) {
+	if tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	if status == http.StatusOK && strings.HasPrefix(tw.Header().Get("Content-Type"), "text/event-stream") {
+		tw.info.StartedAt = time.Now()
+		tw.stream = &stream{info: tw.info}
+		tw.reg.add(tw.stream)
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *tapWriter) Write(p []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	n, err := tw.ResponseWriter.Write(p)
+	if tw.stream == nil {
+		return n, err
+	}
+	tw.stream.bytes.Add(int64(n))
+	tw.pending = append(tw.pending, p[:n]...)
+	for {
+		end := eventEnd(tw.pending)
+		if end < 0 {
+			break
+		}
+		tw.stream.publish(bytes.Clone(tw.pending[:end]))
+		tw.pending = tw.pending[end:]
+	}
+	tw.pending = bytes.Clone(tw.pending)
+	return n, err
+}
+
+// finish publishes an unterminated last event and ends the stream.
+func (tw *tapWriter) finish() {
+	if tw.stream == nil {
+		return
+	}
+	if len(tw.pending) > 0 {
+		tw.stream.publish(tw.pending)
+	}
+	tw.reg.remove(tw.stream)
+	tw.stream.end()
+}
+
+// Flush implements http.Flusher.
+func (tw *tapWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (tw *tapWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// eventEnd returns the length of the first complete event in b, blank line
+// included, or -1.
+func eventEnd(b []byte) int {
+	for i := 0; i < len(b); {
+		j := bytes.IndexByte(b[i:], '\n')
+		if j < 0 {
+			return -1
+		}
+		line := bytes.TrimSuffix(b[i:i+j], []byte("\r"))
+		i += j + 1
+		if len(line) == 0 {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,63 @@
+package streamtap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWatchInFlightStream(t *testing.T) {
+	reg := New()
+	started, proceed, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	h := reg.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: ping\ndata: {}\n\n"))
+		close(started)
+		<-proceed
+		w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"text_delta\",\"text\":\"he"))
+		w.Write([]byte("llo\"}\n\n"))
+	}))
+
+	rec := httptest.NewRecorder()
+	rec.Header().Set("X-Request-ID", "req-1")
+	go func() {
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/messages", nil))
+		close(done)
+	}()
+	<-started
+	if _, _, ok := reg.Watch("other"); ok {
+		t.Fatal("expected an unknown request ID not to be found")
+	}
+	w, st, ok := reg.Watch("req-1")
+	if !ok || st.Path != "/v1/messages" || st.Events != 1 {
+		t.Fatalf("watch: %v %+v", ok, st)
+	}
+	close(proceed)
+
+	ev := <-w.Events
+	if ev.Seq != 2 || string(ev.Raw) != "event: content_block_delta\ndata: {\"type\":\"text_delta\",\"text\":\"hello\"}\n\n" {
+		t.Fatalf("unexpected event %d %q", ev.Seq, ev.Raw)
+	}
+	if _, open := <-w.Events; open {
+		t.Fatal("expected the watcher to be closed when the stream ends")
+	}
+	<-done
+	if len(reg.List()) != 0 || w.Sent() != 2 {
+		t.Fatalf("expected the finished stream to be removed after 2 events, got %v", reg.List())
+	}
+}
+
+func TestRedact(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"secret plan\"}}\n\n",
+			"event: content_block_delta\ndata: {\"delta\":{\"text\":\"[11 bytes]\",\"type\":\"text_delta\"},\"index\":0,\"type\":\"content_block_delta\"}\n\n"},
+		{"data: {\"choices\":[{\"delta\":{\"content\":\"<b>\"},\"finish_reason\":null}]}\n\n",
+			"data: {\"choices\":[{\"delta\":{\"content\":\"[3 bytes]\"},\"finish_reason\":null}]}\n\n"},
+		{"data: {\"text\":\"cut of\n\n", "data: [invalid JSON, 15 bytes]\n\n"},
+		{"data: [DONE]\n\n", "data: [DONE]\n\n"},
+	} {
+		if got := string(Redact([]byte(tt.in))); got != tt.want {
+			t.Errorf("Redact(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+		}
+	}
+}
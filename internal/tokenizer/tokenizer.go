@@ -0,0 +1,223 @@
+// Package tokenizer counts prompt tokens for model families without a round
+// trip to the upstream. Counts are used for limit validation and the
+// count_tokens utility endpoint; billing always uses upstream-reported usage.
+package tokenizer
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer counts the tokens in a piece of text.
+type Tokenizer interface {
+	Name() string
+	Count(text string) int
+}
+
+// Built-in tokenizer names, usable in the models.tokenizer column.
+const (
+	O200kEstimate  = "o200k_estimate"  // GPT-4o, GPT-4.1, GPT-5, o-series
+	Cl100kEstimate = "cl100k_estimate" // GPT-4, GPT-3.5, text-embedding-3
+	Claude         = "claude"          // Anthropic models
+	Approx         = "approx"          // ~4 bytes per token, for unknown models
+)
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]Tokenizer{}
+)
+
+func init() {
+	// The tiktoken o200k_base and cl100k_base encodings are approximated
+	// from their pre-tokenization rules rather than the multi-megabyte BPE
+	// rank tables, and are named as estimates so they are not mistaken for
+	// exact counts. An exact implementation can be added through Register.
+	Register(&estimator{name: O200kEstimate, wordChars: 7, nonASCIIRate: 0.6})
+	Register(&estimator{name: Cl100kEstimate, wordChars: 6, nonASCIIRate: 1})
+	// Anthropic does not publish its tokenizer; this tracks its reported
+	// usage more closely than the tiktoken estimates do.
+	Register(&estimator{name: Claude, wordChars: 5, nonASCIIRate: 1})
+	Register(approx{})
+}
+
+// Register adds t to the registry, replacing any tokenizer with the same
+// name.
+func Register(t Tokenizer) {
+	mu.Lock()
+	registry[t.Name()] = t
+	mu.Unlock()
+}
+
+// Get returns the registered tokenizer with the given name.
+func Get(name string) (Tokenizer, bool) {
+	mu.RLock()
+	t, ok := registry[name]
+	mu.RUnlock()
+	return t, ok
+}
+
+// Names returns the registered tokenizer names, sorted.
+func Names() []string {
+	mu.RLock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// familyPrefixes maps model name prefixes to tokenizers. Longer prefixes
+// are listed first where they overlap.
+var familyPrefixes = []struct {
+	prefix    string
+	tokenizer string
+}{
+	{"gpt-4o", O200kEstimate},
+	{"gpt-4.1", O200kEstimate},
+	{"gpt-4.5", O200kEstimate},
+	{"gpt-5", O200kEstimate},
+	{"chatgpt-4o", O200kEstimate},
+	{"o1", O200kEstimate},
+	{"o3", O200kEstimate},
+	{"o4", O200kEstimate},
+	{"gpt-4", Cl100kEstimate},
+	{"gpt-3.5", Cl100kEstimate},
+	{"text-embedding-3", Cl100kEstimate},
+	{"text-embedding-ada", Cl100kEstimate},
+	{"claude", Claude},
+}
+
+// ForModel returns the tokenizer for a model: the configured name when it
+// is registered, otherwise one chosen by model family, falling back to
+// Approx.
+func ForModel(model, configured string) Tokenizer {
+	if configured != "" {
+		if t, ok := Get(configured); ok {
+			return t
+		}
+	}
+	name := strings.ToLower(model)
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[i+1:] // e.g. "openai/gpt-4o"
+	}
+	for _, f := range familyPrefixes {
+		if strings.HasPrefix(name, f.prefix) {
+			t, _ := Get(f.tokenizer)
+			return t
+		}
+	}
+	t, _ := Get(Approx)
+	return t
+}
+
+// approx is the byte-length heuristic used before tokenizers existed.
+type approx struct{}
+
+func (approx) Name() string { return Approx }
+
+func (approx) Count(text string) int { return (len(text) + 3) / 4 }
+
+// estimator approximates a BPE tokenizer by splitting text the way
+// tiktoken's pre-tokenizer does (words with their leading space,
+// contractions, digit groups of up to three, punctuation runs, whitespace)
+// and charging each piece by length.
+type estimator struct {
+	name         string
+	wordChars    int     // ASCII letters covered by one token within a word
+	nonASCIIRate float64 // tokens per non-ASCII letter (CJK, accented text)
+}
+
+func (e *estimator) Name() string { return e.name }
+
+func (e *estimator) Count(text string) int {
+	tokens := 0.0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case r == '\'' && i+1 < len(text) && isContraction(text[i+1:]):
+			// 's 't 're 've 'm 'll 'd
+			i += size
+			for i < len(text) && text[i] < utf8.RuneSelf && unicode.IsLetter(rune(text[i])) {
+				i++
+			}
+			tokens++
+		case unicode.IsLetter(r) || (r == ' ' && i+1 < len(text) && startsWithLetter(text[i+1:])):
+			if r == ' ' {
+				i += size
+			}
+			ascii, other := 0, 0
+			for i < len(text) {
+				r, size := utf8.DecodeRuneInString(text[i:])
+				if !unicode.IsLetter(r) && !unicode.IsMark(r) {
+					break
+				}
+				if r < utf8.RuneSelf {
+					ascii++
+				} else {
+					other++
+				}
+				i += size
+			}
+			if ascii > 0 {
+				tokens += float64(1 + (ascii-1)/e.wordChars)
+			}
+			tokens += float64(other) * e.nonASCIIRate
+		case unicode.IsDigit(r):
+			n := 0
+			for i < len(text) {
+				r, size := utf8.DecodeRuneInString(text[i:])
+				if !unicode.IsDigit(r) {
+					break
+				}
+				n++
+				i += size
+			}
+			tokens += float64((n + 2) / 3)
+		case unicode.IsSpace(r):
+			for i < len(text) {
+				r, size := utf8.DecodeRuneInString(text[i:])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				i += size
+			}
+			tokens++
+		default:
+			n := 0
+			for i < len(text) {
+				r, size := utf8.DecodeRuneInString(text[i:])
+				if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+					break
+				}
+				n++
+				i += size
+			}
+			tokens += float64(1 + (n-1)/3)
+		}
+	}
+	return int(tokens + 0.5)
+}
+
+func isContraction(s string) bool {
+	for _, c := range []string{"s", "t", "re", "ve", "m", "ll", "d"} {
+		if len(s) >= len(c) && strings.EqualFold(s[:len(c)], c) &&
+			(len(s) == len(c) || !isLetterByte(s[len(c)])) {
+			return true
+		}
+	}
+	return false
+}
+
+func startsWithLetter(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsLetter(r)
+}
+
+func isLetterByte(b byte) bool {
+	return b < utf8.RuneSelf && unicode.IsLetter(rune(b))
+}
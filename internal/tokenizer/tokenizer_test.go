@@ -0,0 +1,59 @@
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEstimatorCount(t *testing.T) {
+	cl100k, _ := Get(Cl100kEstimate)
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"Hello world", 2},
+		{"The quick brown fox jumps over the lazy dog.", 10},
+		{"I don't know", 4},
+		{"1234567", 3},
+		{"a\n\nb", 3},
+	}
+	for _, tt := range tests {
+		if got := cl100k.Count(tt.text); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEstimatorLongWordsAndCJK(t *testing.T) {
+	o200k, _ := Get(O200kEstimate)
+	cl100k, _ := Get(Cl100kEstimate)
+	word := strings.Repeat("a", 70)
+	if o, c := o200k.Count(word), cl100k.Count(word); o != 10 || c != 12 {
+		t.Errorf("long word: o200k=%d cl100k=%d, want 10 and 12", o, c)
+	}
+	cjk := "今日は良い天気です"
+	if o, c := o200k.Count(cjk), cl100k.Count(cjk); o >= c {
+		t.Errorf("expected o200k to encode CJK more compactly: o200k=%d cl100k=%d", o, c)
+	}
+}
+
+func TestForModel(t *testing.T) {
+	tests := []struct {
+		model, configured, want string
+	}{
+		{"gpt-4o-mini", "", O200kEstimate},
+		{"gpt-4-turbo", "", Cl100kEstimate},
+		{"openai/gpt-5", "", O200kEstimate},
+		{"o3-mini", "", O200kEstimate},
+		{"claude-sonnet-4-5", "", Claude},
+		{"llama-3.1-70b", "", Approx},
+		{"llama-3.1-70b", Cl100kEstimate, Cl100kEstimate},
+		{"gpt-4o", "unknown", O200kEstimate},
+	}
+	for _, tt := range tests {
+		if got := ForModel(tt.model, tt.configured).Name(); got != tt.want {
+			t.Errorf("ForModel(%q, %q) = %s, want %s", tt.model, tt.configured, got, tt.want)
+		}
+	}
+}
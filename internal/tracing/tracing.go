@@ -0,0 +1,125 @@
+// Package tracing exports OpenTelemetry spans for proxy requests. Until
+// Setup installs an exporter, the global tracer provider is a no-op and
+// spans cost next to nothing.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/sertdev/pxbin"
+
+// Setup exports spans over OTLP/HTTP to endpoint, sampling ratio of new
+// traces; requests that arrive with a sampled traceparent are always
+// traced. It also makes upstream requests carry the trace context. The
+// returned function flushes pending spans and stops the exporter.
+func Setup(ctx context.Context, endpoint, serviceName string, ratio float64) (shutdown func(context.Context) error, err error) {
+	exp, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+// Start starts a span as a child of the span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartClient starts a client span for an outgoing request.
+func StartClient(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// Inject adds the trace context of ctx to outgoing request headers.
+func Inject(ctx context.Context, h http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(h))
+}
+
+// SetAttributes adds attributes to the span in ctx.
+func SetAttributes(ctx context.Context, attrs ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+}
+
+// EndWithError ends span, marking it failed when err is not nil.
+func EndWithError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware starts the server span of each request, continuing the trace
+// of an incoming traceparent header. The span is named after the matched
+// route once the request has been served.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(tracerName).Start(ctx, r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			))
+		defer span.End()
+		next.ServeHTTP(w, r.WithContext(ctx))
+		if rc := chi.RouteContext(ctx); rc != nil {
+			if pattern := rc.RoutePattern(); pattern != "" {
+				span.SetName(r.Method + " " + pattern)
+			}
+		}
+	})
+}
+
+// Stage wraps a middleware in a span of its own that ends when it passes
+// the request on or answers it, so e.g. authentication shows up as a step
+// of the request rather than enclosing everything after it.
+func Stage(name string, mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		inner := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			st, _ := r.Context().Value(stageKey{}).(stage)
+			if st.span == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			st.span.End()
+			next.ServeHTTP(w, r.WithContext(trace.ContextWithSpan(r.Context(), st.parent)))
+		}))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			parent := trace.SpanFromContext(r.Context())
+			ctx, span := Start(r.Context(), name)
+			defer span.End()
+			inner.ServeHTTP(w, r.WithContext(context.WithValue(ctx, stageKey{}, stage{parent: parent, span: span})))
+		})
+	}
+}
+
+type stageKey struct{}
+
+type stage struct {
+	parent, span trace.Span
+}
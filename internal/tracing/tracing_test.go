@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddlewareAndStage(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+	})
+
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	var upstream http.Header
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Use(Stage("auth", auth))
+	r.Post("/v1/messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := Start(r.Context(), "upstream")
+		upstream = http.Header{}
+		Inject(ctx, upstream)
+		span.End()
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("POST", "/v1/messages/1", nil)
+	req.Header.Set("Authorization", "Bearer k")
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range rec.Ended() {
+		spans[s.Name()] = s
+	}
+	server, ok := spans["POST /v1/messages/{id}"]
+	if !ok {
+		t.Fatalf("expected a server span named after the route, got %v", spans)
+	}
+	if got := server.SpanContext().TraceID().String(); got != traceID {
+		t.Fatalf("expected the incoming trace %s to continue, got %s", traceID, got)
+	}
+	// The auth stage ends before the handler runs, which is its sibling.
+	for _, name := range []string{"auth", "upstream"} {
+		s, ok := spans[name]
+		if !ok || s.Parent().SpanID() != server.SpanContext().SpanID() {
+			t.Fatalf("expected %s to be a child of the server span", name)
+		}
+	}
+	if spans["auth"].EndTime().After(spans["upstream"].StartTime()) {
+		t.Fatal("expected the auth span to end before the handler starts")
+	}
+	want := "00-" + traceID + "-" + spans["upstream"].SpanContext().SpanID().String() + "-01"
+	if got := upstream.Get("traceparent"); got != want {
+		t.Fatalf("expected traceparent %s upstream, got %q", want, got)
+	}
+}
@@ -0,0 +1,205 @@
+// Package traffic records the shape of production proxy traffic and replays
+// it against another instance, for load tests with realistic patterns. A
+// record holds a request's path, model, stream flag, sizes and timing, but
+// none of its content: prompts and completions never reach the capture file.
+package traffic
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Record is the anonymized shape of one proxied request.
+type Record struct {
+	Time          time.Time `json:"time"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	Model         string    `json:"model,omitempty"`
+	Stream        bool      `json:"stream,omitempty"`
+	MaxTokens     int       `json:"max_tokens,omitempty"`
+	RequestBytes  int       `json:"request_bytes"`
+	ResponseBytes int       `json:"response_bytes"`
+	Status        int       `json:"status"`
+	FirstByteMS   int64     `json:"first_byte_ms"` // until the response header
+	DurationMS    int64     `json:"duration_ms"`
+}
+
+// recorderBuffer is how many records wait to be written before new ones
+// are dropped.
+const recorderBuffer = 4096
+
+// Recorder appends a Record for every request it sees to a JSON Lines file.
+// Records are written by a background goroutine; when it falls behind, new
+// records are dropped rather than slowing requests down.
+type Recorder struct {
+	f       *os.File
+	queue   chan Record
+	dropped atomic.Uint64
+	wg      sync.WaitGroup
+	mu      sync.RWMutex // guards closed against sends on the closed queue
+	closed  bool
+}
+
+// NewRecorder opens path for appending, creating it if needed, and starts
+// writing records to it.
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{f: f, queue: make(chan Record, recorderBuffer)}
+	r.wg.Add(1)
+	go r.write()
+	return r, nil
+}
+
+func (r *Recorder) write() {
+	defer r.wg.Done()
+	enc := json.NewEncoder(r.f)
+	for rec := range r.queue {
+		if err := enc.Encode(rec); err != nil {
+			log.Printf("traffic capture: write record: %v", err)
+		}
+	}
+}
+
+func (r *Recorder) record(rec Record) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return
+	}
+	select {
+	case r.queue <- rec:
+	default:
+		if r.dropped.Add(1)%1000 == 1 {
+			log.Printf("traffic capture: falling behind, %d records dropped", r.dropped.Load())
+		}
+	}
+}
+
+// Close writes the queued records and closes the file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+	return r.f.Close()
+}
+
+// Middleware records the shape of every request passing through it. The
+// request body is copied as the handler reads it, and the model, stream flag
+// and token limit are read from the copy once the handler starts to respond,
+// when the copy is dropped.
+func (r *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		rec := Record{Time: start.UTC(), Method: req.Method, Path: req.URL.Path}
+		var body bytes.Buffer
+		if req.Body != nil {
+			req.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(req.Body, &body), req.Body}
+		}
+		shaped := false
+		shape := func() {
+			if shaped {
+				return
+			}
+			shaped = true
+			rec.RequestBytes = max(body.Len(), int(req.ContentLength))
+			readShape(&rec, body.Bytes())
+			body = bytes.Buffer{}
+		}
+
+		cw := &countingWriter{ResponseWriter: w, start: start, onHeader: shape}
+		next.ServeHTTP(cw, req)
+		shape()
+
+		rec.Status = cw.status
+		if rec.Status == 0 {
+			rec.Status = http.StatusOK
+		}
+		rec.ResponseBytes = cw.bytes
+		rec.FirstByteMS = cw.firstByte.Milliseconds()
+		rec.DurationMS = time.Since(start).Milliseconds()
+		r.record(rec)
+	})
+}
+
+// readShape fills in the model, stream flag and token limit of rec from a
+// request body in any of the supported formats. Gemini requests carry the
+// model and streaming in the path instead.
+func readShape(rec *Record, body []byte) {
+	var shape struct {
+		Model               string `json:"model"`
+		Stream              bool   `json:"stream"`
+		MaxTokens           int    `json:"max_tokens"`
+		MaxCompletionTokens int    `json:"max_completion_tokens"`
+		MaxOutputTokens     int    `json:"max_output_tokens"`
+		GenerationConfig    struct {
+			MaxOutputTokens int `json:"maxOutputTokens"`
+		} `json:"generationConfig"`
+	}
+	if json.Unmarshal(body, &shape) == nil {
+		rec.Model, rec.Stream = shape.Model, shape.Stream
+		rec.MaxTokens = max(shape.MaxTokens, shape.MaxCompletionTokens, shape.MaxOutputTokens, shape.GenerationConfig.MaxOutputTokens)
+	}
+	if rest, ok := strings.CutPrefix(rec.Path, "/v1beta/models/"); ok {
+		if model, method, ok := strings.Cut(rest, ":"); ok {
+			rec.Model, rec.Stream = model, method == "streamGenerateContent"
+		}
+	}
+}
+
+// countingWriter counts the bytes of a response and times its header.
+type countingWriter struct {
+	http.ResponseWriter
+	start     time.Time
+	onHeader  func()
+	status    int
+	bytes     int
+	firstByte time.Duration
+}
+
+func (c *countingWriter) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+		c.firstByte = time.Since(c.start)
+		c.onHeader()
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	n, err := c.ResponseWriter.Write(p)
+	c.bytes += n
+	return n, err
+}
+
+// Flush implements http.Flusher.
+func (c *countingWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (c *countingWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
@@ -0,0 +1,239 @@
+package traffic
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReadRecords reads a capture file written by a Recorder, in time order.
+func ReadRecords(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		if len(strings.TrimSpace(sc.Text())) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		records = append(records, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, nil
+}
+
+// ReplayOpts configures a replay.
+type ReplayOpts struct {
+	Target string       // base URL of the instance under test
+	Key    string       // LLM key the requests are sent with
+	Speed  float64      // time compression: 2 replays an hour of traffic in 30 minutes; 0 means 1
+	Client *http.Client // nil = a client without a timeout
+}
+
+// Report summarizes a replay.
+type Report struct {
+	Sent      int
+	Skipped   int         // records whose path cannot be replayed
+	Failed    int         // requests that got no response
+	Status    map[int]int // responses by status code
+	FirstByte Percentiles
+	Duration  Percentiles
+	MaxLag    time.Duration // how far sending fell behind the schedule
+}
+
+// Percentiles are latency percentiles over the replayed requests.
+type Percentiles struct {
+	P50, P95, P99 time.Duration
+}
+
+func percentiles(d []time.Duration) Percentiles {
+	if len(d) == 0 {
+		return Percentiles{}
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	at := func(p float64) time.Duration { return d[min(len(d)-1, int(p*float64(len(d))))] }
+	return Percentiles{P50: at(0.50), P95: at(0.95), P99: at(0.99)}
+}
+
+// String formats the report for the command line.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "sent %d requests, %d failed, %d skipped, at most %s behind schedule\n", r.Sent, r.Failed, r.Skipped, r.MaxLag.Round(time.Millisecond))
+	codes := make([]int, 0, len(r.Status))
+	for code := range r.Status {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(&b, "  %d: %d\n", code, r.Status[code])
+	}
+	fmt.Fprintf(&b, "first byte p50 %s p95 %s p99 %s\n", r.FirstByte.P50, r.FirstByte.P95, r.FirstByte.P99)
+	fmt.Fprintf(&b, "duration   p50 %s p95 %s p99 %s\n", r.Duration.P50, r.Duration.P95, r.Duration.P99)
+	return b.String()
+}
+
+// Replay sends a synthetic request for every record at the same offset from
+// the first as it was captured, divided by the speed. Each request has the
+// captured path, model, stream flag, token limit and body size, with filler
+// text as its prompt. Replay returns once every response has been read or
+// ctx is done.
+func Replay(ctx context.Context, records []Record, opts ReplayOpts) *Report {
+	speed := opts.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{}
+	}
+	target := strings.TrimSuffix(opts.Target, "/")
+
+	report := &Report{Status: map[int]int{}}
+	var (
+		mu                  sync.Mutex
+		wg                  sync.WaitGroup
+		firstByte, duration []time.Duration
+	)
+	start := time.Now()
+send:
+	for _, rec := range records {
+		req, ok := replayRequest(ctx, target, rec)
+		if !ok {
+			report.Skipped++
+			continue
+		}
+		at := start.Add(time.Duration(float64(rec.Time.Sub(records[0].Time)) / speed))
+		select {
+		case <-ctx.Done():
+			break send
+		case <-time.After(time.Until(at)):
+		}
+		report.MaxLag = max(report.MaxLag, time.Since(at))
+		req.Header.Set("Authorization", "Bearer "+opts.Key)
+		report.Sent++
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sent := time.Now()
+			resp, err := client.Do(req)
+			if err != nil {
+				mu.Lock()
+				report.Failed++
+				mu.Unlock()
+				return
+			}
+			fb := time.Since(sent)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			d := time.Since(sent)
+
+			mu.Lock()
+			report.Status[resp.StatusCode]++
+			firstByte = append(firstByte, fb)
+			duration = append(duration, d)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	report.FirstByte = percentiles(firstByte)
+	report.Duration = percentiles(duration)
+	return report
+}
+
+// filler is repeated to pad synthetic prompts to the captured size.
+const filler = "lorem ipsum dolor sit amet consectetur adipiscing elit "
+
+// replayRequest builds the synthetic request for rec, or returns false if
+// its path is not one of the proxy's.
+func replayRequest(ctx context.Context, target string, rec Record) (*http.Request, bool) {
+	path := rec.Path
+	var body map[string]any
+	switch {
+	case rec.Method == http.MethodGet && path == "/v1/models":
+	case rec.Method != http.MethodPost:
+		return nil, false
+	case path == "/v1/messages":
+		body = map[string]any{"model": rec.Model, "max_tokens": cmp.Or(rec.MaxTokens, 1024), "stream": rec.Stream}
+	case strings.HasPrefix(path, "/v1/messages/"):
+		body = map[string]any{"model": rec.Model}
+	case path == "/v1/chat/completions":
+		body = map[string]any{"model": rec.Model, "stream": rec.Stream}
+		if rec.MaxTokens > 0 {
+			body["max_tokens"] = rec.MaxTokens
+		}
+	case path == "/v1/responses" || path == "/v1/responses/compact":
+		body = map[string]any{"model": rec.Model, "stream": rec.Stream}
+		if rec.MaxTokens > 0 {
+			body["max_output_tokens"] = rec.MaxTokens
+		}
+	case path == "/v1/embeddings":
+		body = map[string]any{"model": rec.Model}
+	case strings.HasPrefix(path, "/v1beta/models/"):
+		body = map[string]any{}
+		if rec.MaxTokens > 0 {
+			body["generationConfig"] = map[string]any{"maxOutputTokens": rec.MaxTokens}
+		}
+		if rec.Stream {
+			path += "?alt=sse"
+		}
+	default:
+		return nil, false
+	}
+
+	var reader io.Reader
+	if body != nil {
+		// Size the prompt so the whole body is as long as the captured one.
+		setPrompt(body, path, "")
+		empty, _ := json.Marshal(body)
+		setPrompt(body, path, fillerText(rec.RequestBytes-len(empty)))
+		b, _ := json.Marshal(body)
+		reader = strings.NewReader(string(b))
+	}
+	req, err := http.NewRequestWithContext(ctx, rec.Method, target+path, reader)
+	if err != nil {
+		return nil, false
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, true
+}
+
+// setPrompt puts text in body where the path's format expects the prompt.
+func setPrompt(body map[string]any, path, text string) {
+	switch {
+	case strings.HasPrefix(path, "/v1/messages"), path == "/v1/chat/completions":
+		body["messages"] = []map[string]string{{"role": "user", "content": text}}
+	case strings.HasPrefix(path, "/v1/responses"), path == "/v1/embeddings":
+		body["input"] = text
+	default: // Gemini
+		body["contents"] = []map[string]any{{"role": "user", "parts": []map[string]string{{"text": text}}}}
+	}
+}
+
+// fillerText returns n bytes of filler, at least one.
+func fillerText(n int) string {
+	n = max(n, 1)
+	return strings.Repeat(filler, n/len(filler)+1)[:n]
+}
@@ -0,0 +1,130 @@
+package traffic
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecorderCapturesShapeNotContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	rec, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := rec.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: secret answer\n\n")
+	}))
+
+	bodies := map[string]string{
+		"/v1/messages": `{"max_tokens":256,"messages":[{"role":"user","content":"secret prompt"}],"model":"claude-x","stream":true}`,
+		"/v1beta/models/gemini-x:streamGenerateContent": `{"contents":[{"parts":[{"text":"secret prompt"}]}],"generationConfig":{"maxOutputTokens":64}}`,
+	}
+	for _, p := range []string{"/v1/messages", "/v1beta/models/gemini-x:streamGenerateContent"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", p, strings.NewReader(bodies[p])))
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "secret") {
+		t.Fatalf("capture file holds request or response content: %s", raw)
+	}
+	records, err := ReadRecords(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	want := []Record{
+		{Method: "POST", Path: "/v1/messages", Model: "claude-x", Stream: true, MaxTokens: 256, RequestBytes: len(bodies["/v1/messages"]), ResponseBytes: 21, Status: 200},
+		{Method: "POST", Path: "/v1beta/models/gemini-x:streamGenerateContent", Model: "gemini-x", Stream: true, MaxTokens: 64, RequestBytes: len(bodies["/v1beta/models/gemini-x:streamGenerateContent"]), ResponseBytes: 21, Status: 200},
+	}
+	for i, got := range records {
+		if got.Time.IsZero() {
+			t.Errorf("record %d has no time", i)
+		}
+		got.Time, got.FirstByteMS, got.DurationMS = time.Time{}, 0, 0
+		if got != want[i] {
+			t.Errorf("record %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	type seen struct {
+		path, auth string
+		size       int
+		body       map[string]any
+	}
+	var (
+		mu       sync.Mutex
+		requests []seen
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		json.Unmarshal(b, &body)
+		mu.Lock()
+		requests = append(requests, seen{r.URL.RequestURI(), r.Header.Get("Authorization"), len(b), body})
+		mu.Unlock()
+		if r.URL.Path == "/v1/embeddings" {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	t0 := time.Now()
+	records := []Record{
+		{Time: t0, Method: "POST", Path: "/v1/messages", Model: "claude-x", Stream: true, MaxTokens: 256, RequestBytes: 500},
+		{Time: t0.Add(100 * time.Millisecond), Method: "POST", Path: "/v1beta/models/gemini-x:streamGenerateContent", Model: "gemini-x", Stream: true, RequestBytes: 300},
+		{Time: t0.Add(200 * time.Millisecond), Method: "POST", Path: "/v1/embeddings", Model: "embed-x", RequestBytes: 40},
+		{Time: t0.Add(200 * time.Millisecond), Method: "DELETE", Path: "/v1/messages"},
+	}
+	start := time.Now()
+	report := Replay(context.Background(), records, ReplayOpts{Target: srv.URL + "/", Key: "pxb_test", Speed: 2})
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("replay of 200ms at speed 2 took %s", elapsed)
+	}
+
+	if report.Sent != 3 || report.Skipped != 1 || report.Failed != 0 || report.Status[200] != 2 || report.Status[429] != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(requests))
+	}
+	for i, want := range []struct {
+		path, model string
+		size        int
+	}{
+		{"/v1/messages", "claude-x", 500},
+		{"/v1beta/models/gemini-x:streamGenerateContent?alt=sse", "", 300},
+		{"/v1/embeddings", "embed-x", 40},
+	} {
+		got := requests[i]
+		if got.path != want.path || got.auth != "Bearer pxb_test" || got.size != want.size {
+			t.Errorf("request %d = %s %q, %d bytes; want %s, %d bytes", i, got.path, got.auth, got.size, want.path, want.size)
+		}
+		if model, _ := got.body["model"].(string); model != want.model {
+			t.Errorf("request %d model = %q, want %q", i, model, want.model)
+		}
+	}
+	if requests[0].body["max_tokens"] != float64(256) || requests[0].body["stream"] != true {
+		t.Errorf("messages request lost its shape: %v", requests[0].body)
+	}
+}
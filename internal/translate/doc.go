@@ -0,0 +1,5 @@
+// Package translate holds the proxy-specific wrappers around the public
+// pkg/translate converters: response writers that re-frame the translated
+// event streams for the client, as JSON Lines or as SSE with EventSource
+// reconnection hints.
+package translate
@@ -0,0 +1,138 @@
+package translate
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/bytedance/sonic"
+)
+
+// NDJSONContentType is the media type of JSON Lines streams.
+const NDJSONContentType = "application/x-ndjson"
+
+// NDJSONWriter re-frames a server-sent event stream as JSON Lines: each
+// event's data payload is written as one line, event names are dropped
+// (every payload carries its own type or object field), and keep-alive
+// comments and the OpenAI [DONE] sentinel are skipped. It wraps the response
+// writer handed to the stream translators and passthrough copiers, so they
+// keep writing SSE.
+//
+// Only responses sent with Content-Type text/event-stream are converted;
+// JSON responses and errors pass through unchanged.
+type NDJSONWriter struct {
+	http.ResponseWriter
+
+	wroteHeader bool
+	convert     bool
+	line        []byte   // incomplete line
+	data        [][]byte // data lines of the current event
+}
+
+func NewNDJSONWriter(w http.ResponseWriter) *NDJSONWriter {
+	return &NDJSONWriter{ResponseWriter: w}
+}
+
+func (n *NDJSONWriter) WriteHeader(status int) {
+	if n.wroteHeader {
+		return
+	}
+	n.wroteHeader = true
+	if strings.HasPrefix(n.Header().Get("Content-Type"), "text/event-stream") {
+		n.convert = true
+		n.Header().Set("Content-Type", NDJSONContentType)
+	}
+	n.ResponseWriter.WriteHeader(status)
+}
+
+func (n *NDJSONWriter) Write(p []byte) (int, error) {
+	if !n.wroteHeader {
+		n.WriteHeader(http.StatusOK)
+	}
+	if !n.convert {
+		return n.ResponseWriter.Write(p)
+	}
+
+	var out []byte
+	rest := p
+	for len(rest) > 0 {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			n.line = append(n.line, rest...)
+			break
+		}
+		line := rest[:i]
+		if len(n.line) > 0 {
+			line = append(n.line, line...)
+			n.line = n.line[:0]
+		}
+		rest = rest[i+1:]
+		out = n.processLine(bytes.TrimSuffix(line, []byte("\r")), out)
+	}
+	if len(out) > 0 {
+		if _, err := n.ResponseWriter.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// processLine consumes one SSE line and appends a JSON line to out when it
+// completes an event.
+func (n *NDJSONWriter) processLine(line, out []byte) []byte {
+	if len(line) == 0 {
+		out = n.emit(out)
+		return out
+	}
+	if v, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+		n.data = append(n.data, append([]byte(nil), bytes.TrimPrefix(v, []byte(" "))...))
+	}
+	// event:, id:, retry: and comment lines carry nothing JSON Lines needs.
+	return out
+}
+
+func (n *NDJSONWriter) emit(out []byte) []byte {
+	if len(n.data) == 0 {
+		return out
+	}
+	// A JSON value split over several data lines can only be split on
+	// whitespace, so joining with a space keeps it on one line.
+	payload := bytes.Join(n.data, []byte(" "))
+	n.data = n.data[:0]
+	if bytes.Equal(payload, []byte("[DONE]")) || !sonic.Valid(payload) {
+		return out
+	}
+	out = append(out, payload...)
+	return append(out, '\n')
+}
+
+// Flush implements http.Flusher.
+func (n *NDJSONWriter) Flush() {
+	if f, ok := n.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (n *NDJSONWriter) Unwrap() http.ResponseWriter {
+	return n.ResponseWriter
+}
+
+// WantsNDJSON reports whether the client asked for a JSON Lines stream, via
+// ?stream_format=ndjson or an Accept header listing application/x-ndjson
+// (or application/jsonl).
+func WantsNDJSON(r *http.Request) bool {
+	if f := r.URL.Query().Get("stream_format"); f != "" {
+		return f == "ndjson" || f == "jsonl"
+	}
+	for _, v := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(v, ",") {
+			mt, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+			switch strings.ToLower(strings.TrimSpace(mt)) {
+			case NDJSONContentType, "application/jsonl", "application/ndjson":
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package translate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNDJSONWriterConvertsEventStream(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := NewNDJSONWriter(rec)
+	w.Header().Set("Content-Type", "text/event-stream")
+
+	// Events split across writes, CRLF line endings, comments and [DONE].
+	for _, chunk := range []string{
+		"event: message_start\ndata: {\"type\":\"message_start\"}\n\n",
+		": ping\n\n",
+		"data: {\"type\":\"content_",
+		"block_delta\",\"delta\":{\"text\":\"hi\"}}\r\n\r\n",
+		"data: {\"a\":\ndata: 1}\n\n",
+		"data: [DONE]\n\n",
+	} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if ct := rec.Header().Get("Content-Type"); ct != NDJSONContentType {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	want := "{\"type\":\"message_start\"}\n{\"type\":\"content_block_delta\",\"delta\":{\"text\":\"hi\"}}\n{\"a\": 1}\n"
+	if got := rec.Body.String(); got != want {
+		t.Fatalf("body = %q, want %q", got, want)
+	}
+}
+
+func TestNDJSONWriterPassesThroughJSON(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := NewNDJSONWriter(rec)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte(`{"error":"bad"}`))
+
+	if rec.Code != http.StatusBadRequest || rec.Body.String() != `{"error":"bad"}` || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response: %d %q %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+}
+
+func TestWantsNDJSON(t *testing.T) {
+	tests := []struct {
+		url, accept string
+		want        bool
+	}{
+		{"/v1/messages", "", false},
+		{"/v1/messages", "text/event-stream", false},
+		{"/v1/messages", "application/json, application/x-ndjson;q=0.9", true},
+		{"/v1/chat/completions?stream_format=ndjson", "", true},
+		{"/v1/chat/completions?stream_format=sse", "application/x-ndjson", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", tt.url, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		if got := WantsNDJSON(r); got != tt.want {
+			t.Errorf("WantsNDJSON(%s, Accept %q) = %v, want %v", tt.url, tt.accept, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package translate
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSEWriter adds reconnection hints for browser EventSource clients to the
+// event streams written through it: a retry: field ahead of the first event
+// and, while the stream is idle, keep-alive frames that keep clients and
+// intermediaries from timing the connection out while the upstream is
+// silent, for example during extended thinking. Keep-alives are only written
+// between events. They are comments by default, which SSE parsers (including
+// the OpenAI and Anthropic SDKs) ignore; SetKeepAlive replaces them with an
+// event the client's format defines, such as Anthropic's ping.
+//
+// Like NDJSONWriter it wraps the writer handed to the stream translators and
+// passthrough copiers, and leaves responses that are not
+// text/event-stream alone. Close must be called before the handler returns.
+type SSEWriter struct {
+	http.ResponseWriter
+
+	retry     time.Duration
+	interval  time.Duration
+	keepAlive []byte
+
+	mu          sync.Mutex
+	wroteHeader bool
+	newlines    int // trailing newlines written; 2 or more is an event boundary
+	lastWrite   time.Time
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+// keepAliveComment is the default keep-alive frame.
+const keepAliveComment = ": keep-alive\n\n"
+
+// NewSSEWriter wraps w. A zero retry sends no retry: field and a zero
+// interval sends no keep-alives.
+func NewSSEWriter(w http.ResponseWriter, retry, interval time.Duration) *SSEWriter {
+	return &SSEWriter{ResponseWriter: w, retry: retry, interval: interval, keepAlive: []byte(keepAliveComment)}
+}
+
+// SetKeepAlive sets the frame written while the stream is idle, a complete
+// event ending in a blank line. It must be called before the first write.
+func (s *SSEWriter) SetKeepAlive(frame string) {
+	s.keepAlive = []byte(frame)
+}
+
+func (s *SSEWriter) WriteHeader(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writeHeader(status)
+}
+
+func (s *SSEWriter) writeHeader(status int) {
+	if s.wroteHeader {
+		return
+	}
+	s.wroteHeader = true
+	// The content type is checked first: a wrapped writer re-framing the
+	// stream, like the Gemini one, may change it.
+	stream := status == http.StatusOK && strings.HasPrefix(s.Header().Get("Content-Type"), "text/event-stream")
+	s.ResponseWriter.WriteHeader(status)
+	if !stream {
+		return
+	}
+	s.newlines = 2
+	s.lastWrite = time.Now()
+	if s.retry > 0 {
+		fmt.Fprintf(s.ResponseWriter, "retry: %d\n\n", s.retry.Milliseconds())
+	}
+	if s.interval > 0 {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.comments(s.stop)
+	}
+}
+
+func (s *SSEWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.wroteHeader {
+		s.writeHeader(http.StatusOK)
+	}
+	n, err := s.ResponseWriter.Write(p)
+	s.track(p[:n])
+	return n, err
+}
+
+// track counts the newlines ending the stream so far, ignoring \r.
+func (s *SSEWriter) track(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	s.lastWrite = time.Now()
+	trailing := 0
+	for i := len(p) - 1; i >= 0; i-- {
+		switch p[i] {
+		case '\n':
+			trailing++
+		case '\r':
+		default:
+			s.newlines = trailing
+			return
+		}
+	}
+	s.newlines += trailing
+}
+
+// comments writes a keep-alive frame whenever the stream has been idle
+// between events for a full interval, until stop is closed.
+func (s *SSEWriter) comments(stop <-chan struct{}) {
+	defer close(s.done)
+	timer := time.NewTimer(s.interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+		s.mu.Lock()
+		// Wait out the rest of the interval since the last write, or a full
+		// one if the stream stopped mid-event.
+		wait := s.interval - time.Since(s.lastWrite)
+		if wait <= 0 && s.newlines >= 2 {
+			if _, err := s.ResponseWriter.Write(s.keepAlive); err != nil {
+				s.mu.Unlock()
+				return
+			}
+			s.lastWrite = time.Now()
+			if f, ok := s.ResponseWriter.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+		if wait <= 0 {
+			wait = s.interval
+		}
+		s.mu.Unlock()
+		timer.Reset(wait)
+	}
+}
+
+// Close stops the keep-alive frames. The writer must not be used afterwards.
+func (s *SSEWriter) Close() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-s.done
+	}
+}
+
+// Flush implements http.Flusher.
+func (s *SSEWriter) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (s *SSEWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
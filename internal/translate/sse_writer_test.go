@@ -0,0 +1,78 @@
+package translate
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedRecorder lets the test read what was written while the comment
+// goroutine may still be writing.
+type lockedRecorder struct {
+	*httptest.ResponseRecorder
+	mu sync.Mutex
+}
+
+func (l *lockedRecorder) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ResponseRecorder.Write(p)
+}
+
+func (l *lockedRecorder) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Body.String()
+}
+
+func TestSSEWriterRetryAndComments(t *testing.T) {
+	rec := &lockedRecorder{ResponseRecorder: httptest.NewRecorder()}
+	sw := NewSSEWriter(rec, 3*time.Second, 10*time.Millisecond)
+	sw.Header().Set("Content-Type", "text/event-stream")
+
+	io.WriteString(sw, "event: message_start\n")
+	time.Sleep(50 * time.Millisecond)
+	if got := rec.String(); strings.Contains(got, ": keep-alive") {
+		t.Fatalf("comment written mid-event: %q", got)
+	}
+	io.WriteString(sw, "data: {}\n\n")
+	time.Sleep(50 * time.Millisecond)
+	sw.Close()
+
+	got := rec.String()
+	if !strings.HasPrefix(got, "retry: 3000\n\nevent: message_start\ndata: {}\n\n: keep-alive\n\n") {
+		t.Fatalf("unexpected stream %q", got)
+	}
+}
+
+func TestSSEWriterKeepAliveEvent(t *testing.T) {
+	rec := &lockedRecorder{ResponseRecorder: httptest.NewRecorder()}
+	sw := NewSSEWriter(rec, 0, 10*time.Millisecond)
+	sw.SetKeepAlive("event: ping\ndata: {\"type\": \"ping\"}\n\n")
+	sw.Header().Set("Content-Type", "text/event-stream")
+	sw.WriteHeader(http.StatusOK)
+	time.Sleep(35 * time.Millisecond)
+	sw.Close()
+
+	got := rec.String()
+	if n := strings.Count(got, "event: ping\ndata: {\"type\": \"ping\"}\n\n"); n < 2 || strings.Contains(got, ": keep-alive") {
+		t.Fatalf("expected ping events every interval, got %q", got)
+	}
+}
+
+func TestSSEWriterLeavesJSONAlone(t *testing.T) {
+	rec := httptest.NewRecorder()
+	sw := NewSSEWriter(rec, time.Second, time.Millisecond)
+	sw.Header().Set("Content-Type", "application/json")
+	sw.WriteHeader(http.StatusBadRequest)
+	io.WriteString(sw, `{"error":{}}`)
+	time.Sleep(10 * time.Millisecond)
+	sw.Close()
+	if got := rec.Body.String(); got != `{"error":{}}` {
+		t.Fatalf("body = %q", got)
+	}
+}
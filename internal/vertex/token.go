@@ -0,0 +1,143 @@
+package vertex
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scope is the OAuth2 scope Vertex AI requests need.
+const scope = "https://www.googleapis.com/auth/cloud-platform"
+
+// tokenRefreshMargin is how long before it expires an access token is
+// replaced, so that no request goes out with one about to lapse.
+const tokenRefreshMargin = 5 * time.Minute
+
+// tokenSource obtains access tokens for a service account with the OAuth2
+// JWT bearer grant and caches each until shortly before it expires.
+type tokenSource struct {
+	sa     *ServiceAccount
+	client *http.Client
+	now    func() time.Time
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func newTokenSource(sa *ServiceAccount) *tokenSource {
+	return &tokenSource{
+		sa:     sa,
+		client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+	}
+}
+
+// Token returns an access token for the target's service account.
+func (t *Target) Token(ctx context.Context) (string, error) {
+	return t.tokens.get(ctx)
+}
+
+// get returns the cached token, or fetches a new one. Requests wait for a
+// fetch in progress rather than start their own.
+func (ts *tokenSource) get(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.token != "" && ts.now().Before(ts.expiry.Add(-tokenRefreshMargin)) {
+		return ts.token, nil
+	}
+	token, expiry, err := ts.fetch(ctx)
+	if err != nil {
+		return "", fmt.Errorf("vertex: fetch access token: %w", err)
+	}
+	ts.token, ts.expiry = token, expiry
+	return token, nil
+}
+
+// fetch exchanges a signed assertion for an access token at the service
+// account's token URI.
+func (ts *tokenSource) fetch(ctx context.Context) (string, time.Time, error) {
+	now := ts.now()
+	assertion, err := ts.assertion(now)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.sa.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := ts.client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var tr struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return "", time.Time{}, fmt.Errorf("token endpoint returned %d", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || tr.AccessToken == "" {
+		msg := tr.Error
+		if tr.ErrorDescription != "" {
+			msg += ": " + tr.ErrorDescription
+		}
+		return "", time.Time{}, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, msg)
+	}
+	return tr.AccessToken, now.Add(time.Duration(tr.ExpiresIn) * time.Second), nil
+}
+
+// assertion returns a JWT for the service account, signed with its key,
+// asking for the cloud-platform scope for an hour.
+func (ts *tokenSource) assertion(now time.Time) (string, error) {
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if ts.sa.PrivateKeyID != "" {
+		header["kid"] = ts.sa.PrivateKeyID
+	}
+	claims := map[string]any{
+		"iss":   ts.sa.ClientEmail,
+		"scope": scope,
+		"aud":   ts.sa.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, ts.sa.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("sign assertion: %w", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
@@ -0,0 +1,290 @@
+package vertex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/sertdev/pxbin/pkg/translate"
+)
+
+// anthropicVersion is the Messages API version Vertex AI expects in the
+// request body in place of the anthropic-version header.
+const anthropicVersion = "vertex-2023-10-16"
+
+// Transport returns a RoundTripper that sends the requests an upstream
+// client makes, against t.BaseURL, to Vertex AI through base:
+//
+//   - /v1/messages goes to the Claude model's rawPredict, or
+//     streamRawPredict for a stream, with the model moved from the body
+//     into the URL;
+//   - /v1/messages/count_tokens goes to the Claude count-tokens model;
+//   - /v1/chat/completions is translated into a Gemini generateContent
+//     request, or streamGenerateContent for a stream, and its response
+//     back into a chat completion.
+//
+// Other paths are answered with a 404. Every request is authorized with
+// the service account's access token in place of the client's API key.
+func (t *Target) Transport(base http.RoundTripper) http.RoundTripper {
+	prefix := ""
+	if u, err := url.Parse(t.BaseURL); err == nil {
+		prefix = u.Path
+	}
+	return &transport{target: t, base: base, prefix: prefix}
+}
+
+type transport struct {
+	target *Target
+	base   http.RoundTripper
+	prefix string // path of the target's base URL
+}
+
+// CloseIdleConnections closes the idle connections of the base transport,
+// as http.Client does for the transports that support it.
+func (tr *transport) CloseIdleConnections() {
+	if c, ok := tr.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+func (tr *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	gemini := false
+	var model, method string
+	var stream bool
+	var err error
+	switch strings.TrimPrefix(req.URL.Path, tr.prefix) {
+	case "/v1/messages":
+		model, stream, body, err = claudeBody(body)
+		method = "rawPredict"
+		if stream {
+			method = "streamRawPredict"
+		}
+	case "/v1/messages/count_tokens":
+		model, method = "count-tokens", "rawPredict"
+	case "/v1/chat/completions":
+		gemini = true
+		model, stream, body, err = geminiBody(body)
+		method = "generateContent"
+		if stream {
+			method = "streamGenerateContent"
+		}
+	default:
+		return notFound(req), nil
+	}
+	if err != nil {
+		return errorResponse(req, http.StatusBadRequest, "invalid_request_error", err.Error()), nil
+	}
+
+	token, err := tr.target.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	publisher := "anthropic"
+	if gemini {
+		publisher = "google"
+	}
+	target, err := url.Parse(tr.target.BaseURL + "/publishers/" + publisher + "/models/" + url.PathEscape(model) + ":" + method)
+	if err != nil {
+		return nil, err
+	}
+	if gemini && stream {
+		target.RawQuery = "alt=sse"
+	}
+
+	out := req.Clone(req.Context())
+	out.URL = target
+	out.Host = ""
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	out.ContentLength = int64(len(body))
+	out.Header.Del("X-Api-Key")
+	out.Header.Del("Anthropic-Version")
+	out.Header.Set("Authorization", "Bearer "+token)
+	if gemini {
+		// Translated responses are read here, so they must arrive plain.
+		out.Header.Del("Accept-Encoding")
+	}
+
+	resp, err := tr.base.RoundTrip(out)
+	if err != nil || !gemini || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	if stream {
+		translateStream(resp, model)
+		return resp, nil
+	}
+	if err := translateResponse(resp, model); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// claudeBody prepares an Anthropic Messages request for Vertex AI, which
+// takes the model in the URL and the API version in the body.
+func claudeBody(body []byte) (model string, stream bool, _ []byte, _ error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", false, nil, errors.New("invalid JSON in request body")
+	}
+	if err := json.Unmarshal(fields["model"], &model); err != nil || model == "" {
+		return "", false, nil, errors.New("request has no model")
+	}
+	if s, ok := fields["stream"]; ok {
+		json.Unmarshal(s, &stream)
+	}
+	delete(fields, "model")
+	if _, ok := fields["anthropic_version"]; !ok {
+		fields["anthropic_version"] = json.RawMessage(strconv.Quote(anthropicVersion))
+	}
+	body, err := json.Marshal(fields)
+	return model, stream, body, err
+}
+
+// geminiBody translates a Chat Completions request into a Gemini
+// generateContent request.
+func geminiBody(body []byte) (model string, stream bool, _ []byte, _ error) {
+	var req translate.OpenAIRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return "", false, nil, errors.New("invalid JSON in request body")
+	}
+	if req.Model == "" {
+		return "", false, nil, errors.New("request has no model")
+	}
+	greq, err := translate.OpenAIRequestToGemini(&req)
+	if err != nil {
+		return "", false, nil, fmt.Errorf("failed to translate request for Gemini: %w", err)
+	}
+	body, err = json.Marshal(greq)
+	return req.Model, req.Stream, body, err
+}
+
+// translateResponse replaces a generateContent response with the chat
+// completion it translates into.
+func translateResponse(resp *http.Response, model string) error {
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("read response body: %w", err)
+	}
+	var gresp translate.GeminiResponse
+	if err := json.Unmarshal(data, &gresp); err != nil {
+		return fmt.Errorf("vertex: parse Gemini response: %w", err)
+	}
+	if data, err = json.Marshal(translate.GeminiResponseToOpenAI(&gresp, model)); err != nil {
+		return err
+	}
+	setBody(resp, "application/json", data)
+	return nil
+}
+
+// translateStream replaces a streamGenerateContent event stream with the
+// Chat Completions stream it translates into, ending in [DONE].
+func translateStream(resp *http.Response, model string) {
+	src := resp.Body
+	pr, pw := io.Pipe()
+	go func() {
+		defer src.Close()
+		conv := translate.NewChatStreamConverter(model)
+		r := bufio.NewReader(src)
+		for {
+			line, err := r.ReadBytes('\n')
+			if data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:")); ok {
+				var gresp translate.GeminiResponse
+				if json.Unmarshal(bytes.TrimSpace(data), &gresp) == nil {
+					for _, chunk := range conv.Convert(&gresp) {
+						if werr := writeEvent(pw, chunk); werr != nil {
+							return
+						}
+					}
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		if chunk, ok := conv.Finish(); ok {
+			if err := writeEvent(pw, chunk); err != nil {
+				return
+			}
+		}
+		io.WriteString(pw, "data: [DONE]\n\n")
+		pw.Close()
+	}()
+	resp.Body = &streamBody{PipeReader: pr, src: src}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Set("Content-Type", "text/event-stream")
+}
+
+func writeEvent(w io.Writer, chunk translate.OpenAIStreamChunk) error {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+// streamBody is a translated stream. Closing it also closes the upstream
+// body, so that the translating goroutine stops.
+type streamBody struct {
+	*io.PipeReader
+	src io.Closer
+}
+
+func (b *streamBody) Close() error {
+	b.PipeReader.Close()
+	return b.src.Close()
+}
+
+func setBody(resp *http.Response, contentType string, data []byte) {
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	resp.Header.Set("Content-Type", contentType)
+}
+
+// notFound answers a request for an API Vertex AI upstreams do not serve.
+func notFound(req *http.Request) *http.Response {
+	return errorResponse(req, http.StatusNotFound, "not_found_error", req.URL.Path+" is not supported by Vertex AI upstreams")
+}
+
+// errorResponse answers a request without sending it, with an error body
+// that both Anthropic and OpenAI clients parse.
+func errorResponse(req *http.Request, status int, typ, msg string) *http.Response {
+	data, _ := json.Marshal(map[string]any{"type": "error", "error": map[string]string{"type": typ, "message": msg}})
+	resp := &http.Response{
+		Status:     strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Request:    req,
+	}
+	setBody(resp, "application/json", data)
+	return resp
+}
@@ -0,0 +1,193 @@
+// Package vertex serves Google Vertex AI upstreams. An upstream of format
+// "vertex" stores a service account key as its API key and a location as
+// its base URL. Requests are authorized with OAuth2 access tokens obtained
+// for the service account, and sent to the location's regional endpoint:
+// Anthropic Messages requests to the Claude publisher models, and Chat
+// Completions requests, translated, to the Gemini publisher models.
+package vertex
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Format is the upstream format of Vertex AI upstreams.
+const Format = "vertex"
+
+// defaultTokenURI is Google's OAuth2 token endpoint, used when a service
+// account key names none.
+const defaultTokenURI = "https://oauth2.googleapis.com/token"
+
+// Dialect returns the API format requests for model are sent to a Vertex
+// AI upstream in: "anthropic" for Claude models, "openai" for the Gemini
+// models, whose requests are translated.
+func Dialect(model string) string {
+	if strings.HasPrefix(strings.ToLower(model), "claude") {
+		return "anthropic"
+	}
+	return "openai"
+}
+
+// ServiceAccount is a Google service account key, as downloaded from the
+// Cloud console.
+type ServiceAccount struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+// ParseServiceAccount parses a service account key in JSON.
+func ParseServiceAccount(data string) (*ServiceAccount, error) {
+	var sa ServiceAccount
+	if err := json.Unmarshal([]byte(data), &sa); err != nil {
+		return nil, errors.New("not a service account key in JSON")
+	}
+	if sa.Type != "service_account" {
+		return nil, fmt.Errorf("key type is %q, not service_account", sa.Type)
+	}
+	if sa.ClientEmail == "" {
+		return nil, errors.New("key has no client_email")
+	}
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return nil, errors.New("key has no PEM private_key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("parse private_key: %w", err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private_key is not an RSA key")
+	}
+	sa.key = key
+	if sa.TokenURI == "" {
+		sa.TokenURI = defaultTokenURI
+	}
+	return &sa, nil
+}
+
+var (
+	locationRe = regexp.MustCompile(`^[a-z]+(-[a-z]+[0-9]+)?$`)
+	resourceRe = regexp.MustCompile(`^projects/([a-z][a-z0-9-]*)/locations/([a-z]+(?:-[a-z]+[0-9]+)?)$`)
+)
+
+// EndpointURL returns the URL publisher model paths are appended to for an
+// upstream's base URL, which is one of:
+//
+//   - a location, e.g. us-east5, europe-west1 or global, in project;
+//   - a resource name, projects/PROJECT/locations/LOCATION;
+//   - an http(s) URL, in which {project} is replaced with project.
+//
+// Locations are served from their regional endpoint,
+// https://LOCATION-aiplatform.googleapis.com, and global from
+// https://aiplatform.googleapis.com.
+func EndpointURL(base, project string) (string, error) {
+	base = strings.TrimRight(strings.TrimSpace(base), "/")
+	if strings.HasPrefix(base, "https://") || strings.HasPrefix(base, "http://") {
+		if strings.Contains(base, "{project}") && project == "" {
+			return "", errors.New("base_url needs a project, but the service account key has no project_id")
+		}
+		return strings.ReplaceAll(base, "{project}", project), nil
+	}
+	location := base
+	if m := resourceRe.FindStringSubmatch(base); m != nil {
+		project, location = m[1], m[2]
+	} else if !locationRe.MatchString(base) {
+		return "", fmt.Errorf("%q is not a location, projects/PROJECT/locations/LOCATION, or URL", base)
+	}
+	if project == "" {
+		return "", errors.New("the service account key has no project_id; use projects/PROJECT/locations/LOCATION")
+	}
+	host := "https://" + location + "-aiplatform.googleapis.com"
+	if location == "global" {
+		host = "https://aiplatform.googleapis.com"
+	}
+	return host + "/v1/projects/" + project + "/locations/" + location, nil
+}
+
+// Validate reports what is wrong with an upstream's base URL and service
+// account key, if anything, by field.
+func Validate(base, key string) (field string, err error) {
+	sa, err := ParseServiceAccount(key)
+	if err != nil {
+		return "api_key", err
+	}
+	if _, err := EndpointURL(base, sa.ProjectID); err != nil {
+		return "base_url", err
+	}
+	return "", nil
+}
+
+// Target is a Vertex AI upstream: its endpoint and the access tokens of
+// its service account.
+type Target struct {
+	// BaseURL is the endpoint publisher model paths are appended to.
+	BaseURL string
+
+	tokens *tokenSource
+}
+
+// NewTarget returns the target of an upstream with base URL base and
+// service account key key.
+func NewTarget(base, key string) (*Target, error) {
+	sa, err := ParseServiceAccount(key)
+	if err != nil {
+		return nil, fmt.Errorf("vertex: %w", err)
+	}
+	endpoint, err := EndpointURL(base, sa.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("vertex: %w", err)
+	}
+	return &Target{BaseURL: endpoint, tokens: newTokenSource(sa)}, nil
+}
+
+type cachedTarget struct {
+	target *Target
+	base   string
+	key    string
+}
+
+// Cache holds a Target per upstream, so access tokens are reused across
+// requests until they expire.
+type Cache struct {
+	mu      sync.Mutex
+	targets map[uuid.UUID]*cachedTarget
+}
+
+// NewCache returns an empty Cache.
+func NewCache() *Cache {
+	return &Cache{targets: make(map[uuid.UUID]*cachedTarget)}
+}
+
+// Get returns the target of upstream id, replacing the cached one when the
+// upstream's base URL or key changed.
+func (c *Cache) Get(id uuid.UUID, base, key string) (*Target, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t, ok := c.targets[id]; ok && t.base == base && t.key == key {
+		return t.target, nil
+	}
+	target, err := NewTarget(base, key)
+	if err != nil {
+		return nil, err
+	}
+	c.targets[id] = &cachedTarget{target: target, base: base, key: key}
+	return target, nil
+}
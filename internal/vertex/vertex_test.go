@@ -0,0 +1,215 @@
+package vertex
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestEndpointURL(t *testing.T) {
+	tests := []struct {
+		base, project, want string
+		wantErr             bool
+	}{
+		{base: "us-east5", project: "p1", want: "https://us-east5-aiplatform.googleapis.com/v1/projects/p1/locations/us-east5"},
+		{base: "global", project: "p1", want: "https://aiplatform.googleapis.com/v1/projects/p1/locations/global"},
+		{base: "projects/other/locations/europe-west1/", project: "p1", want: "https://europe-west1-aiplatform.googleapis.com/v1/projects/other/locations/europe-west1"},
+		{base: "http://localhost:9000/v1/projects/{project}/locations/x", project: "p1", want: "http://localhost:9000/v1/projects/p1/locations/x"},
+		{base: "us-east5", wantErr: true},
+		{base: "http://h/{project}", wantErr: true},
+		{base: "not a location", project: "p1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := EndpointURL(tt.base, tt.project)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("EndpointURL(%q, %q) = %q, %v; want %q, error %v", tt.base, tt.project, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDialect(t *testing.T) {
+	if got := Dialect("claude-sonnet-4-5@20250929"); got != "anthropic" {
+		t.Errorf("claude dialect = %q", got)
+	}
+	if got := Dialect("gemini-2.5-pro"); got != "openai" {
+		t.Errorf("gemini dialect = %q", got)
+	}
+}
+
+// testKey returns a service account key whose tokens come from tokenURI.
+func testKey(t *testing.T, tokenURI string) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "p1",
+		"private_key_id": "kid1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "sa@p1.iam.gserviceaccount.com",
+		"token_uri":      tokenURI,
+	})
+	return string(data)
+}
+
+// tokenServer issues access tokens and counts the requests for them.
+func tokenServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || strings.Count(r.Form.Get("assertion"), ".") != 2 {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		n.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "tok", "expires_in": 3600})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &n
+}
+
+func TestValidate(t *testing.T) {
+	key := testKey(t, "http://127.0.0.1/token")
+	if field, err := Validate("us-east5", key); err != nil {
+		t.Errorf("valid upstream: %s: %v", field, err)
+	}
+	if field, _ := Validate("us-east5", `{"type":"authorized_user"}`); field != "api_key" {
+		t.Errorf("bad key field = %q", field)
+	}
+	if field, _ := Validate("nowhere!", key); field != "base_url" {
+		t.Errorf("bad base field = %q", field)
+	}
+}
+
+func TestTokenCached(t *testing.T) {
+	srv, n := tokenServer(t)
+	target, err := NewTarget("us-east5", testKey(t, srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		tok, err := target.Token(t.Context())
+		if err != nil || tok != "tok" {
+			t.Fatalf("Token = %q, %v", tok, err)
+		}
+	}
+	if got := n.Load(); got != 1 {
+		t.Errorf("token requests = %d, want 1", got)
+	}
+}
+
+// newTestTarget returns a target sending publisher requests to handler.
+func newTestTarget(t *testing.T, handler http.HandlerFunc) (*Target, *http.Client) {
+	t.Helper()
+	tokens, _ := tokenServer(t)
+	api := httptest.NewServer(handler)
+	t.Cleanup(api.Close)
+	target, err := NewTarget(api.URL+"/v1/projects/{project}/locations/us-east5", testKey(t, tokens.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return target, &http.Client{Transport: target.Transport(http.DefaultTransport)}
+}
+
+func TestTransportClaude(t *testing.T) {
+	var gotPath, gotAuth string
+	var gotBody map[string]any
+	target, client := newTestTarget(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		io.WriteString(w, `{"type":"message"}`)
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, target.BaseURL+"/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4-5","stream":true,"max_tokens":8}`))
+	req.Header.Set("X-Api-Key", "unused")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if want := "/v1/projects/p1/locations/us-east5/publishers/anthropic/models/claude-sonnet-4-5:streamRawPredict"; gotPath != want {
+		t.Errorf("path = %q, want %q", gotPath, want)
+	}
+	if gotAuth != "Bearer tok" {
+		t.Errorf("authorization = %q", gotAuth)
+	}
+	if _, ok := gotBody["model"]; ok || gotBody["anthropic_version"] != anthropicVersion {
+		t.Errorf("body = %v", gotBody)
+	}
+}
+
+func TestTransportGemini(t *testing.T) {
+	var gotPath, gotQuery string
+	target, client := newTestTarget(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.RawQuery
+		if gotQuery == "alt=sse" {
+			io.WriteString(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"Hi\"}]},\"finishReason\":\"STOP\"}],\"usageMetadata\":{\"promptTokenCount\":2,\"candidatesTokenCount\":1}}\n\n")
+			return
+		}
+		io.WriteString(w, `{"candidates":[{"content":{"parts":[{"text":"Hi"}]},"finishReason":"STOP"}]}`)
+	})
+	post := func(stream bool) string {
+		body := `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"Hello"}],"stream":` + strconv.FormatBool(stream) + `}`
+		resp, err := client.Post(target.BaseURL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return string(data)
+	}
+
+	out := post(false)
+	if want := "/v1/projects/p1/locations/us-east5/publishers/google/models/gemini-2.5-flash:generateContent"; gotPath != want {
+		t.Errorf("path = %q, want %q", gotPath, want)
+	}
+	var completion struct {
+		Object  string `json:"object"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal([]byte(out), &completion); err != nil || completion.Object != "chat.completion" || completion.Choices[0].Message.Content != "Hi" {
+		t.Errorf("completion = %s (%v)", out, err)
+	}
+
+	out = post(true)
+	if !strings.HasSuffix(gotPath, ":streamGenerateContent") || gotQuery != "alt=sse" {
+		t.Errorf("stream request = %s?%s", gotPath, gotQuery)
+	}
+	if !strings.Contains(out, `"content":"Hi"`) || !strings.Contains(out, `"prompt_tokens":2`) || !strings.HasSuffix(out, "data: [DONE]\n\n") {
+		t.Errorf("stream = %s", out)
+	}
+}
+
+func TestTransportUnsupportedPath(t *testing.T) {
+	target, client := newTestTarget(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected upstream request %s", r.URL.Path)
+	})
+	resp, err := client.Post(target.BaseURL+"/v1/embeddings", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", resp.StatusCode)
+	}
+}
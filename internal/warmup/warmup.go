@@ -0,0 +1,135 @@
+// Package warmup primes caches and upstream connections at startup so the
+// first requests after a deploy don't pay for cold lookups and handshakes.
+package warmup
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/auth"
+	"github.com/sertdev/pxbin/internal/proxy"
+	"github.com/sertdev/pxbin/internal/store"
+)
+
+// Warmup states.
+const (
+	StateRunning = "running"
+	StateDone    = "done"
+)
+
+const (
+	// keyWindow and maxKeys bound key priming to the keys that saw traffic
+	// recently, most recently used first.
+	keyWindow = 24 * time.Hour
+	maxKeys   = 10000
+)
+
+// Status reports warmup progress. Failed steps are listed in Errors; the
+// warmup still finishes so the instance becomes ready.
+type Status struct {
+	State      string                `json:"state"`
+	StartedAt  time.Time             `json:"started_at"`
+	FinishedAt *time.Time            `json:"finished_at,omitempty"`
+	Keys       int                   `json:"keys"`
+	Upstreams  int                   `json:"upstreams"`
+	Probes     []proxy.UpstreamProbe `json:"probes,omitempty"`
+	Errors     []string              `json:"errors,omitempty"`
+}
+
+type Opts struct {
+	Store  store.Store
+	Models *proxy.ModelCache
+	Keys   *auth.KeyCache
+	Proxy  *proxy.Handler
+
+	// Probe sends a model-list request to each upstream to open a
+	// connection ahead of real traffic.
+	Probe   bool
+	Timeout time.Duration
+}
+
+// Warmup runs the startup warmup in the background.
+type Warmup struct {
+	mu     sync.Mutex
+	status Status
+	done   chan struct{}
+}
+
+// Start begins warming up: it loads active models into the model cache,
+// primes the key cache with recently used keys, builds upstream clients
+// and, if enabled, probes each upstream.
+func Start(opts Opts) *Warmup {
+	w := &Warmup{
+		status: Status{State: StateRunning, StartedAt: time.Now()},
+		done:   make(chan struct{}),
+	}
+	go w.run(opts)
+	return w
+}
+
+func (w *Warmup) run(opts Opts) {
+	defer close(w.done)
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	if err := opts.Models.Warm(ctx); err != nil {
+		w.fail("models", err)
+	}
+
+	keys, err := opts.Store.ListRecentLLMKeys(ctx, time.Now().Add(-keyWindow), maxKeys)
+	if err != nil {
+		w.fail("keys", err)
+	} else {
+		opts.Keys.Prime(keys)
+	}
+
+	upstreams, probes := opts.Proxy.WarmUpstreams(ctx, opts.Probe)
+
+	now := time.Now()
+	w.mu.Lock()
+	w.status.State = StateDone
+	w.status.FinishedAt = &now
+	w.status.Keys = len(keys)
+	w.status.Upstreams = upstreams
+	w.status.Probes = probes
+	w.mu.Unlock()
+
+	unhealthy := 0
+	for _, p := range probes {
+		if !p.Healthy {
+			unhealthy++
+		}
+	}
+	log.Printf("warmup: done in %s (%d keys, %d upstreams, %d unhealthy)", now.Sub(w.status.StartedAt).Round(time.Millisecond), len(keys), upstreams, unhealthy)
+}
+
+func (w *Warmup) fail(step string, err error) {
+	log.Printf("warmup: %s failed: %v", step, err)
+	w.mu.Lock()
+	w.status.Errors = append(w.status.Errors, step+": "+err.Error())
+	w.mu.Unlock()
+}
+
+// Status returns a snapshot of the warmup's progress.
+func (w *Warmup) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s := w.status
+	s.Probes = append([]proxy.UpstreamProbe(nil), s.Probes...)
+	s.Errors = append([]string(nil), s.Errors...)
+	return s
+}
+
+// Wait blocks until the warmup has finished.
+func (w *Warmup) Wait() {
+	<-w.done
+}
+
+// WarmupStatus reports whether the warmup has finished, and its status, for
+// the readiness probe.
+func (w *Warmup) WarmupStatus() (bool, any) {
+	s := w.Status()
+	return s.State == StateDone, s
+}
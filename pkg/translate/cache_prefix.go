@@ -0,0 +1,69 @@
+package translate
+
+import "github.com/bytedance/sonic"
+
+// CachePrefix is the part of an Anthropic request its cache_control
+// breakpoints mark as cacheable: everything up to and including the last
+// marked block, in the order Anthropic caches a prompt (tools, system,
+// messages).
+type CachePrefix struct {
+	Breakpoints int `json:"breakpoints"`
+	Tokens      int `json:"eligible_tokens"` // estimated at ~4 bytes per token
+}
+
+// EstimateCachePrefix returns the cacheable prefix of req. OpenAI-format
+// upstreams ignore cache_control and cache prompt prefixes on their own, so
+// for translated requests this is what Anthropic would have cached, to set
+// against the cached tokens the upstream reports.
+func EstimateCachePrefix(req *AnthropicRequest) CachePrefix {
+	var p CachePrefix
+	if req == nil {
+		return p
+	}
+	tokens := 0
+	mark := func(cc *CacheControl) {
+		if cc != nil {
+			p.Breakpoints++
+			p.Tokens = tokens
+		}
+	}
+
+	for i := range req.Tools {
+		t := &req.Tools[i]
+		tokens += approxTokens(t.Name) + approxTokens(t.Description) + approxTokens(string(t.InputSchema))
+		mark(t.CacheControl)
+	}
+
+	var system []SystemBlock
+	if sonic.Unmarshal(req.System, &system) == nil {
+		for i := range system {
+			tokens += approxTokens(system[i].Text)
+			mark(system[i].CacheControl)
+		}
+	} else {
+		tokens += approxTokens(string(req.System))
+	}
+
+	for i := range req.Messages {
+		msg := &req.Messages[i]
+		if s, ok := msg.ContentAsString(); ok {
+			tokens += approxTokens(s)
+			continue
+		}
+		blocks, err := msg.ContentAsBlocks()
+		if err != nil {
+			tokens += approxTokens(string(msg.Content))
+			continue
+		}
+		for j := range blocks {
+			b := &blocks[j]
+			if b.Type == "image" {
+				tokens += imageTokenEstimate
+			} else {
+				tokens += approxTokens(b.Text) + approxTokens(b.Thinking) + approxTokens(string(b.Input)) + approxTokens(string(b.Content))
+			}
+			mark(b.CacheControl)
+		}
+	}
+	return p
+}
@@ -0,0 +1,32 @@
+package translate
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEstimateCachePrefix(t *testing.T) {
+	var req AnthropicRequest
+	if err := json.Unmarshal([]byte(`{
+		"model": "claude",
+		"tools": [{"name": "read", "description": "Reads a file", "input_schema": {}, "cache_control": {"type": "ephemeral"}}],
+		"system": [{"type": "text", "text": "You are a careful coding agent.", "cache_control": {"type": "ephemeral"}}],
+		"messages": [
+			{"role": "user", "content": [{"type": "text", "text": "first question", "cache_control": {"type": "ephemeral"}}]},
+			{"role": "assistant", "content": "an answer that is not cached"}
+		]
+	}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	// tools: "read" 1 + "Reads a file" 3 + "{}" 1; system 8; first message 4.
+	if got := EstimateCachePrefix(&req); got.Breakpoints != 3 || got.Tokens != 17 {
+		t.Fatalf("got %+v, want 3 breakpoints over 17 tokens", got)
+	}
+
+	req.Tools[0].CacheControl = nil
+	req.System = json.RawMessage(`"plain system prompt"`)
+	req.Messages = req.Messages[1:]
+	if got := EstimateCachePrefix(&req); got.Breakpoints != 0 || got.Tokens != 0 {
+		t.Fatalf("expected no cacheable prefix, got %+v", got)
+	}
+}
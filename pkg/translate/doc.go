@@ -0,0 +1,23 @@
+// Package translate converts between the Anthropic Messages API and the
+// OpenAI Chat Completions and Responses APIs: requests, responses, errors
+// and streams. Gemini generateContent requests are translated to Chat
+// Completions and back, Chat Completions requests to generateContent and
+// back, and embedContent requests to OpenAI Embeddings and back. It is the conversion logic of the pxbin proxy, usable from
+// other Go programs without running the proxy:
+//
+//	oaiReq, err := translate.AnthropicRequestToOpenAI(&anthropicReq)
+//	// ... send oaiReq to an OpenAI-compatible upstream ...
+//	resp, err := translate.OpenAIResponseToAnthropic(&oaiResp, model, translate.AnthropicPrefill(&anthropicReq), anthropicReq.StopSequences)
+//
+// Streams are translated from an upstream body to an http.ResponseWriter
+// with TranslateOpenAIStreamToAnthropic, TranslateAnthropicStreamToOpenAI
+// and TranslateChatStreamToResponses; Chat Completions chunks are turned into
+// Gemini stream responses one at a time by a GeminiStreamConverter, and
+// Gemini stream responses into Chat Completions chunks by a
+// ChatStreamConverter.
+//
+// The exported functions and types are a stable API: they change only in
+// backwards-compatible ways. Behaviour that only the proxy needs, such as
+// re-framing client streams as JSON Lines or adding EventSource hints, lives
+// in pxbin's internal/translate.
+package translate
@@ -0,0 +1,51 @@
+package translate
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// GeminiEmbedRequestsToOpenAI translates the requests of an embedContent
+// or batchEmbedContents call into one OpenAI /v1/embeddings request for
+// model, with one input per request. Only text can be embedded, and every
+// request must ask for the same outputDimensionality.
+func GeminiEmbedRequestsToOpenAI(reqs []GeminiEmbedContentRequest, model string) (*OpenAIEmbeddingRequest, error) {
+	if len(reqs) == 0 {
+		return nil, fmt.Errorf("no content to embed")
+	}
+	dims := reqs[0].OutputDimensionality
+	inputs := make([]string, 0, len(reqs))
+	for i, req := range reqs {
+		for _, p := range req.Content.Parts {
+			if p.InlineData != nil || p.FileData != nil || p.FunctionCall != nil || p.FunctionResponse != nil {
+				return nil, fmt.Errorf("request %d: only text parts can be embedded", i)
+			}
+		}
+		d := req.OutputDimensionality
+		if (d == nil) != (dims == nil) || (d != nil && *d != *dims) {
+			return nil, fmt.Errorf("request %d: all requests must have the same outputDimensionality", i)
+		}
+		inputs = append(inputs, geminiText(req.Content.Parts))
+	}
+	return &OpenAIEmbeddingRequest{
+		Model:          model,
+		Input:          inputs,
+		EncodingFormat: "float",
+		Dimensions:     dims,
+	}, nil
+}
+
+// OpenAIEmbeddingsToGemini translates an embeddings response with float
+// embeddings into a batchEmbedContents response, in input order.
+func OpenAIEmbeddingsToGemini(resp *OpenAIEmbeddingResponse) (*GeminiBatchEmbedContentsResponse, error) {
+	out := &GeminiBatchEmbedContentsResponse{Embeddings: make([]GeminiContentEmbedding, len(resp.Data))}
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(out.Embeddings) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		if err := json.Unmarshal(d.Embedding, &out.Embeddings[d.Index].Values); err != nil {
+			return nil, fmt.Errorf("embedding %d: %w", d.Index, err)
+		}
+	}
+	return out, nil
+}
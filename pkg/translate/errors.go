@@ -111,3 +111,49 @@ func mapStatusToOpenAIErrorType(statusCode int) string {
 		return "server_error"
 	}
 }
+
+// TranslateOpenAIErrorToGemini converts an OpenAI error response body into a
+// Gemini-format error response body with the same status code.
+func TranslateOpenAIErrorToGemini(statusCode int, body []byte) []byte {
+	msg := string(body)
+	var oaiErr OpenAIErrorResponse
+	if err := json.Unmarshal(body, &oaiErr); err == nil && oaiErr.Error.Message != "" {
+		msg = oaiErr.Error.Message
+	}
+	return MarshalGeminiError(statusCode, msg)
+}
+
+// MarshalGeminiError builds a serialised Gemini error response.
+func MarshalGeminiError(statusCode int, message string) []byte {
+	result, _ := json.Marshal(GeminiErrorResponse{
+		Error: GeminiError{
+			Code:    statusCode,
+			Message: message,
+			Status:  mapStatusToGeminiStatus(statusCode),
+		},
+	})
+	return result
+}
+
+// mapStatusToGeminiStatus maps an HTTP status code to the canonical status
+// name Gemini reports with it.
+func mapStatusToGeminiStatus(statusCode int) string {
+	switch statusCode {
+	case 400:
+		return "INVALID_ARGUMENT"
+	case 401:
+		return "UNAUTHENTICATED"
+	case 403:
+		return "PERMISSION_DENIED"
+	case 404:
+		return "NOT_FOUND"
+	case 429:
+		return "RESOURCE_EXHAUSTED"
+	case 503:
+		return "UNAVAILABLE"
+	case 504:
+		return "DEADLINE_EXCEEDED"
+	default:
+		return "INTERNAL"
+	}
+}
@@ -0,0 +1,119 @@
+package translate
+
+// imageTokenEstimate is a flat per-image token charge used when estimating
+// prompt size; base64 payload length says little about the billed size.
+const imageTokenEstimate = 1600
+
+// EstimateInputTokens returns a rough prompt token count for an Anthropic
+// request using the common ~4 bytes per token heuristic. It is only meant
+// for progress displays before the upstream reports real usage, never for
+// billing.
+func EstimateInputTokens(req *AnthropicRequest) int {
+	return CountInputTokens(req, approxTokens)
+}
+
+// CountInputTokens counts the prompt tokens of an Anthropic request using
+// count for text, plus a flat charge per image.
+func CountInputTokens(req *AnthropicRequest, count func(string) int) int {
+	if req == nil {
+		return 0
+	}
+
+	tokens := count(string(req.System))
+	images := 0
+	for i := range req.Messages {
+		msg := &req.Messages[i]
+		if s, ok := msg.ContentAsString(); ok {
+			tokens += count(s)
+			continue
+		}
+		blocks, err := msg.ContentAsBlocks()
+		if err != nil {
+			tokens += count(string(msg.Content))
+			continue
+		}
+		for _, b := range blocks {
+			switch b.Type {
+			case "image":
+				images++
+			default:
+				tokens += count(b.Text) + count(b.Thinking) + count(string(b.Input)) + count(string(b.Content))
+			}
+		}
+	}
+	for _, t := range req.Tools {
+		tokens += count(t.Name) + count(t.Description) + count(string(t.InputSchema))
+	}
+
+	return tokens + images*imageTokenEstimate
+}
+
+// EstimateOpenAIInputTokens is the Chat Completions counterpart of
+// EstimateInputTokens, with the same caveats.
+func EstimateOpenAIInputTokens(req *OpenAIRequest) int {
+	return CountOpenAIInputTokens(req, approxTokens)
+}
+
+// CountOpenAIInputTokens is the Chat Completions counterpart of
+// CountInputTokens.
+func CountOpenAIInputTokens(req *OpenAIRequest, count func(string) int) int {
+	if req == nil {
+		return 0
+	}
+
+	tokens := 0
+	images := 0
+	for i := range req.Messages {
+		msg := &req.Messages[i]
+		switch c := msg.Content.(type) {
+		case string:
+			tokens += count(c)
+		case []interface{}:
+			for _, p := range c {
+				part, ok := p.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if part["type"] == "image_url" {
+					images++
+					continue
+				}
+				if text, ok := part["text"].(string); ok {
+					tokens += count(text)
+				}
+			}
+		}
+		for _, tc := range msg.ToolCalls {
+			tokens += count(tc.Function.Name) + count(tc.Function.Arguments)
+		}
+	}
+	for _, t := range req.Tools {
+		tokens += count(t.Function.Name) + count(t.Function.Description) + count(string(t.Function.Parameters))
+	}
+
+	return tokens + images*imageTokenEstimate
+}
+
+// ThinkingTokens estimates the tokens of thinkingBytes bytes of thinking
+// text, capped at outputTokens. Anthropic counts thinking in output_tokens
+// without breaking it out, so this is the only way to price it apart.
+func ThinkingTokens(thinkingBytes, outputTokens int) int {
+	return min((thinkingBytes+3)/4, max(outputTokens, 0))
+}
+
+// ThinkingTokens estimates the part of the response's output tokens spent
+// on thinking blocks.
+func (r *AnthropicResponse) ThinkingTokens() int {
+	n := 0
+	for _, b := range r.Content {
+		if b.Type == "thinking" {
+			n += len(b.Thinking)
+		}
+	}
+	return ThinkingTokens(n, r.Usage.OutputTokens)
+}
+
+// approxTokens is the ~4 bytes per token heuristic.
+func approxTokens(s string) int {
+	return (len(s) + 3) / 4
+}
@@ -0,0 +1,377 @@
+package translate
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bytedance/sonic"
+)
+
+func TestGeminiRequestToOpenAI(t *testing.T) {
+	body := `{
+		"systemInstruction": {"parts": [{"text": "Be brief."}]},
+		"contents": [
+			{"role": "user", "parts": [{"text": "Weather in Paris?"}, {"inlineData": {"mimeType": "image/png", "data": "iVBOR"}}]},
+			{"role": "model", "parts": [{"text": "thinking", "thought": true}, {"functionCall": {"name": "get_weather", "args": {"city": "Paris"}}}]},
+			{"role": "user", "parts": [{"functionResponse": {"name": "get_weather", "response": {"temp": 21}}}]}
+		],
+		"tools": [{"functionDeclarations": [{"name": "get_weather", "parameters": {"type": "OBJECT", "properties": {"city": {"type": "STRING", "nullable": true}}, "propertyOrdering": ["city"]}}]}],
+		"toolConfig": {"functionCallingConfig": {"mode": "ANY"}},
+		"generationConfig": {"maxOutputTokens": 256, "temperature": 0.2, "stopSequences": ["END"], "responseMimeType": "application/json"}
+	}`
+	var req GeminiRequest
+	if err := sonic.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	out, err := GeminiRequestToOpenAI(&req, "gpt-4o", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Model != "gpt-4o" || !out.Stream || out.StreamOptions == nil || !out.StreamOptions.IncludeUsage {
+		t.Errorf("model/stream = %q %v %+v", out.Model, out.Stream, out.StreamOptions)
+	}
+	if len(out.Messages) != 4 {
+		t.Fatalf("got %d messages, want 4: %+v", len(out.Messages), out.Messages)
+	}
+	if m := out.Messages[0]; m.Role != "system" || m.Content != "Be brief." {
+		t.Errorf("system message = %+v", m)
+	}
+	if parts, ok := out.Messages[1].Content.([]OpenAIContentPart); !ok || len(parts) != 2 || parts[1].ImageURL.URL != "data:image/png;base64,iVBOR" {
+		t.Errorf("user message = %+v", out.Messages[1])
+	}
+	asst := out.Messages[2]
+	if asst.Role != "assistant" || asst.Content != nil || len(asst.ToolCalls) != 1 || asst.ToolCalls[0].Function.Arguments != `{"city": "Paris"}` {
+		t.Errorf("assistant message = %+v", asst)
+	}
+	if tool := out.Messages[3]; tool.Role != "tool" || tool.ToolCallID != asst.ToolCalls[0].ID || tool.Content != `{"temp": 21}` {
+		t.Errorf("tool message = %+v, want call id %q", tool, asst.ToolCalls[0].ID)
+	}
+
+	if len(out.Tools) != 1 {
+		t.Fatalf("got %d tools", len(out.Tools))
+	}
+	var params map[string]any
+	if err := json.Unmarshal(out.Tools[0].Function.Parameters, &params); err != nil {
+		t.Fatal(err)
+	}
+	if params["type"] != "object" || params["propertyOrdering"] != nil {
+		t.Errorf("parameters = %v", params)
+	}
+	city := params["properties"].(map[string]any)["city"].(map[string]any)
+	if typ, _ := city["type"].([]any); len(typ) != 2 || typ[0] != "string" || typ[1] != "null" {
+		t.Errorf("nullable property type = %v", city["type"])
+	}
+	if choice, ok := out.ToolChoice.(OpenAIToolChoiceFunction); !ok || choice.Function.Name != "get_weather" {
+		t.Errorf("tool_choice = %#v", out.ToolChoice)
+	}
+
+	if out.MaxTokens == nil || *out.MaxTokens != 256 || *out.Temperature != 0.2 {
+		t.Errorf("max_tokens/temperature = %v %v", out.MaxTokens, out.Temperature)
+	}
+	if stop, _ := out.Stop.([]string); len(stop) != 1 || stop[0] != "END" {
+		t.Errorf("stop = %v", out.Stop)
+	}
+	if rf, _ := out.ResponseFormat.(map[string]interface{}); rf["type"] != "json_object" {
+		t.Errorf("response_format = %v", out.ResponseFormat)
+	}
+}
+
+func TestGeminiRequestToOpenAIErrors(t *testing.T) {
+	tests := map[string]string{
+		"unmatched response": `{"contents": [{"role": "user", "parts": [{"functionResponse": {"name": "f", "response": {}}}]}]}`,
+		"pdf":                `{"contents": [{"parts": [{"inlineData": {"mimeType": "application/pdf", "data": "JVBE"}}]}]}`,
+		"candidates":         `{"contents": [{"parts": [{"text": "hi"}]}], "generationConfig": {"candidateCount": 2}}`,
+	}
+	for name, body := range tests {
+		var req GeminiRequest
+		if err := sonic.Unmarshal([]byte(body), &req); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GeminiRequestToOpenAI(&req, "m", false); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestOpenAIResponseToGemini(t *testing.T) {
+	finish := "tool_calls"
+	resp := &OpenAIResponse{
+		ID:    "chatcmpl-1",
+		Model: "gpt-4o-2024",
+		Choices: []OpenAIChoice{{
+			Message: OpenAIMessage{
+				Role:      "assistant",
+				Content:   "Checking.",
+				ToolCalls: []OpenAIToolCall{{ID: "call_1", Type: "function", Function: OpenAIFunction{Name: "f", Arguments: `{"a":1`}}},
+			},
+			FinishReason: &finish,
+		}},
+		Usage: &OpenAIUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, PromptTokensDetails: &OpenAIPromptTokensDetails{CachedTokens: 4}},
+	}
+	out := OpenAIResponseToGemini(resp, "gpt-4o")
+
+	if out.ModelVersion != "gpt-4o-2024" || out.ResponseID != "chatcmpl-1" {
+		t.Errorf("model/id = %q %q", out.ModelVersion, out.ResponseID)
+	}
+	cand := out.Candidates[0]
+	if cand.FinishReason != "STOP" || cand.Content.Role != "model" || len(cand.Content.Parts) != 2 {
+		t.Fatalf("candidate = %+v", cand)
+	}
+	if cand.Content.Parts[0].Text != "Checking." {
+		t.Errorf("text part = %+v", cand.Content.Parts[0])
+	}
+	if fc := cand.Content.Parts[1].FunctionCall; fc == nil || fc.Name != "f" || string(fc.Args) != `{"a":1}` {
+		t.Errorf("function call part = %+v", fc)
+	}
+	want := GeminiUsageMetadata{PromptTokenCount: 10, CandidatesTokenCount: 5, TotalTokenCount: 15, CachedContentTokenCount: 4}
+	if out.UsageMetadata == nil || *out.UsageMetadata != want {
+		t.Errorf("usage = %+v, want %+v", out.UsageMetadata, want)
+	}
+}
+
+func TestGeminiStreamConverter(t *testing.T) {
+	chunks := []string{
+		`{"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"f","arguments":"{\"a\""}}]}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":":1}"}}]}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"id":"c1","choices":[],"usage":{"prompt_tokens":7,"completion_tokens":3,"total_tokens":10}}`,
+	}
+	c := NewGeminiStreamConverter("fallback")
+	var texts []string
+	for _, raw := range chunks {
+		var chunk OpenAIStreamChunk
+		if err := sonic.Unmarshal([]byte(raw), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		for _, resp := range c.Convert(&chunk) {
+			if resp.ModelVersion != "gpt-4o" || resp.ResponseID != "c1" {
+				t.Errorf("response model/id = %q %q", resp.ModelVersion, resp.ResponseID)
+			}
+			texts = append(texts, resp.Candidates[0].Content.Parts[0].Text)
+		}
+	}
+	if len(texts) != 2 || texts[0] != "Hel" || texts[1] != "lo" {
+		t.Errorf("text events = %q", texts)
+	}
+
+	final, ok := c.Finish()
+	if !ok {
+		t.Fatal("Finish reported nothing to send")
+	}
+	cand := final.Candidates[0]
+	if cand.FinishReason != "STOP" || len(cand.Content.Parts) != 1 {
+		t.Fatalf("final candidate = %+v", cand)
+	}
+	if fc := cand.Content.Parts[0].FunctionCall; fc == nil || fc.ID != "call_1" || string(fc.Args) != `{"a":1}` {
+		t.Errorf("function call = %+v", fc)
+	}
+	if final.UsageMetadata == nil || final.UsageMetadata.TotalTokenCount != 10 {
+		t.Errorf("usage = %+v", final.UsageMetadata)
+	}
+	if _, ok := c.Finish(); ok {
+		t.Error("second Finish should report false")
+	}
+}
+
+func TestTranslateOpenAIErrorToGemini(t *testing.T) {
+	got := TranslateOpenAIErrorToGemini(429, []byte(`{"error":{"message":"slow down","type":"rate_limit_error"}}`))
+	var resp GeminiErrorResponse
+	if err := sonic.Unmarshal(got, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error.Code != 429 || resp.Error.Message != "slow down" || resp.Error.Status != "RESOURCE_EXHAUSTED" {
+		t.Errorf("error = %+v", resp.Error)
+	}
+}
+
+func TestGeminiEmbeddings(t *testing.T) {
+	body := `{"requests": [
+		{"model": "models/text-embedding-004", "content": {"parts": [{"text": "hello "}, {"text": "world"}]}, "outputDimensionality": 2},
+		{"model": "models/text-embedding-004", "content": {"parts": [{"text": "bye"}]}, "outputDimensionality": 2, "taskType": "RETRIEVAL_QUERY"}
+	]}`
+	var req GeminiBatchEmbedContentsRequest
+	if err := sonic.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	out, err := GeminiEmbedRequestsToOpenAI(req.Requests, "text-embedding-3-small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in, _ := out.Input.([]string); out.Model != "text-embedding-3-small" || len(in) != 2 || in[0] != "hello world" || in[1] != "bye" {
+		t.Errorf("model/input = %q %v", out.Model, out.Input)
+	}
+	if out.Dimensions == nil || *out.Dimensions != 2 || out.EncodingFormat != "float" {
+		t.Errorf("dimensions/encoding_format = %v %q", out.Dimensions, out.EncodingFormat)
+	}
+
+	req.Requests[1].OutputDimensionality = nil
+	if _, err := GeminiEmbedRequestsToOpenAI(req.Requests, "m"); err == nil {
+		t.Error("expected an error for mixed outputDimensionality")
+	}
+	image := []GeminiEmbedContentRequest{{Content: GeminiContent{Parts: []GeminiPart{{InlineData: &GeminiBlob{MimeType: "image/png", Data: "iVBOR"}}}}}}
+	if _, err := GeminiEmbedRequestsToOpenAI(image, "m"); err == nil {
+		t.Error("expected an error for an image part")
+	}
+
+	var resp OpenAIEmbeddingResponse
+	if err := sonic.Unmarshal([]byte(`{"object": "list", "data": [
+		{"object": "embedding", "index": 1, "embedding": [0.5, -1]},
+		{"object": "embedding", "index": 0, "embedding": [0.25, 0]}
+	], "model": "text-embedding-3-small", "usage": {"prompt_tokens": 3, "total_tokens": 3}}`), &resp); err != nil {
+		t.Fatal(err)
+	}
+	got, err := OpenAIEmbeddingsToGemini(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(got)
+	if want := `{"embeddings":[{"values":[0.25,0]},{"values":[0.5,-1]}]}`; string(b) != want {
+		t.Errorf("response = %s, want %s", b, want)
+	}
+}
+
+func TestOpenAIRequestToGemini(t *testing.T) {
+	body := `{
+		"model": "gemini-2.5-pro",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [{"type": "text", "text": "Weather?"}, {"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBOR"}}]},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "21C"}
+		],
+		"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}],
+		"tool_choice": {"type": "function", "function": {"name": "get_weather"}},
+		"max_tokens": 256,
+		"stop": ["END"],
+		"reasoning_effort": "low"
+	}`
+	var req OpenAIRequest
+	if err := sonic.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	out, err := OpenAIRequestToGemini(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.SystemInstruction == nil || out.SystemInstruction.Parts[0].Text != "Be brief." {
+		t.Errorf("system instruction = %+v", out.SystemInstruction)
+	}
+	if len(out.Contents) != 3 {
+		t.Fatalf("got %d contents, want 3: %+v", len(out.Contents), out.Contents)
+	}
+	if c := out.Contents[0]; c.Role != "user" || len(c.Parts) != 2 || c.Parts[1].InlineData == nil || c.Parts[1].InlineData.MimeType != "image/png" {
+		t.Errorf("user content = %+v", c)
+	}
+	if c := out.Contents[1]; c.Role != "model" || len(c.Parts) != 1 || c.Parts[0].FunctionCall == nil || c.Parts[0].FunctionCall.Name != "get_weather" {
+		t.Errorf("model content = %+v", c)
+	}
+	fr := out.Contents[2].Parts[0].FunctionResponse
+	if out.Contents[2].Role != "user" || fr == nil || fr.Name != "get_weather" || string(fr.Response) != `{"content":"21C"}` {
+		t.Errorf("function response = %+v", fr)
+	}
+
+	if len(out.Tools) != 1 || len(out.Tools[0].FunctionDeclarations) != 1 {
+		t.Fatalf("tools = %+v", out.Tools)
+	}
+	fc := out.ToolConfig.FunctionCallingConfig
+	if fc.Mode != "ANY" || len(fc.AllowedFunctionNames) != 1 || fc.AllowedFunctionNames[0] != "get_weather" {
+		t.Errorf("function calling config = %+v", fc)
+	}
+	gc := out.GenerationConfig
+	if gc == nil || gc.MaxOutputTokens == nil || *gc.MaxOutputTokens != 256 || len(gc.StopSequences) != 1 {
+		t.Fatalf("generation config = %+v", gc)
+	}
+	if gc.ThinkingConfig == nil || *gc.ThinkingConfig.ThinkingBudget != 5000 || !gc.ThinkingConfig.IncludeThoughts {
+		t.Errorf("thinking config = %+v", gc.ThinkingConfig)
+	}
+}
+
+func TestOpenAIRequestToGeminiUnansweredTool(t *testing.T) {
+	req := OpenAIRequest{Messages: []OpenAIMessage{{Role: "tool", ToolCallID: "call_x", Content: "1"}}}
+	if _, err := OpenAIRequestToGemini(&req); err == nil {
+		t.Error("expected an error for a tool message without a call")
+	}
+}
+
+func TestGeminiResponseToOpenAI(t *testing.T) {
+	body := `{
+		"responseId": "r1",
+		"modelVersion": "gemini-2.5-pro-001",
+		"candidates": [{"content": {"role": "model", "parts": [
+			{"text": "hmm", "thought": true},
+			{"text": "Checking."},
+			{"functionCall": {"name": "f", "args": {"a": 1}}}
+		]}, "finishReason": "STOP"}],
+		"usageMetadata": {"promptTokenCount": 10, "candidatesTokenCount": 5, "thoughtsTokenCount": 3, "totalTokenCount": 18}
+	}`
+	var resp GeminiResponse
+	if err := sonic.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatal(err)
+	}
+	out := GeminiResponseToOpenAI(&resp, "gemini-2.5-pro")
+
+	if out.ID != "r1" || out.Model != "gemini-2.5-pro-001" {
+		t.Errorf("id/model = %q %q", out.ID, out.Model)
+	}
+	choice := out.Choices[0]
+	if *choice.FinishReason != "tool_calls" {
+		t.Errorf("finish reason = %q", *choice.FinishReason)
+	}
+	msg := choice.Message
+	if msg.Content != "Checking." || msg.ReasoningContent != "hmm" || len(msg.ToolCalls) != 1 {
+		t.Fatalf("message = %+v", msg)
+	}
+	if tc := msg.ToolCalls[0]; tc.ID == "" || tc.Function.Name != "f" || tc.Function.Arguments != `{"a": 1}` {
+		t.Errorf("tool call = %+v", tc)
+	}
+	u := out.Usage
+	if u.PromptTokens != 10 || u.CompletionTokens != 8 || u.TotalTokens != 18 || u.CompletionTokensDetails == nil || u.CompletionTokensDetails.ReasoningTokens != 3 {
+		t.Errorf("usage = %+v", u)
+	}
+}
+
+func TestChatStreamConverter(t *testing.T) {
+	events := []string{
+		`{"modelVersion":"gemini-2.5-flash","candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"lo"},{"functionCall":{"name":"f","args":{"a":1}}}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":7,"candidatesTokenCount":3,"totalTokenCount":10}}`,
+	}
+	c := NewChatStreamConverter("fallback")
+	var chunks []OpenAIStreamChunk
+	for _, raw := range events {
+		var resp GeminiResponse
+		if err := sonic.Unmarshal([]byte(raw), &resp); err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, c.Convert(&resp)...)
+	}
+	if len(chunks) != 4 {
+		t.Fatalf("got %d chunks, want 4: %+v", len(chunks), chunks)
+	}
+	if d := chunks[0].Choices[0].Delta; d.Role != "assistant" || d.Content == nil || *d.Content != "Hel" || chunks[0].Model != "gemini-2.5-flash" {
+		t.Errorf("first chunk = %+v", chunks[0])
+	}
+	if d := chunks[1].Choices[0].Delta; d.Role != "" || d.Content == nil || *d.Content != "lo" {
+		t.Errorf("second chunk delta = %+v", d)
+	}
+	if tcs := chunks[2].Choices[0].Delta.ToolCalls; len(tcs) != 1 || tcs[0].Index != 0 || tcs[0].Function.Arguments != `{"a":1}` {
+		t.Errorf("tool call delta = %+v", tcs)
+	}
+	if f := chunks[3].Choices[0].FinishReason; f == nil || *f != "tool_calls" {
+		t.Errorf("finish reason = %v", f)
+	}
+
+	final, ok := c.Finish()
+	if !ok {
+		t.Fatal("Finish reported nothing to send")
+	}
+	if len(final.Choices) != 0 || final.Usage == nil || final.Usage.TotalTokens != 10 {
+		t.Errorf("usage chunk = %+v", final)
+	}
+	if _, ok := c.Finish(); ok {
+		t.Error("second Finish should report false")
+	}
+}
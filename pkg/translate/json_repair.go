@@ -0,0 +1,162 @@
+package translate
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// repairJSONSuffix returns text that, appended to partial, makes it a valid
+// JSON value: it finishes a cut-off string, escape, literal or number,
+// fills a dangling key or value with null, and closes every open object and
+// array. Text already sent to a client cannot be taken back, so the repair
+// only ever appends. It reports false if partial cannot be completed that
+// way, e.g. because it is not a JSON prefix at all.
+func repairJSONSuffix(partial string) (string, bool) {
+	if strings.TrimSpace(partial) == "" {
+		return "{}", true
+	}
+	if json.Valid([]byte(partial)) {
+		return "", true
+	}
+
+	// expect tracks what the innermost container needs next.
+	const (
+		expectValue = iota // start of a value
+		expectKey          // object key or "}"
+		expectColon        // ":" after a key
+		expectNext         // "," or the closing bracket
+	)
+	var stack []byte // open '{' and '[' characters
+	expect := expectValue
+	inString, escaped := false, false
+	unicodeDigits := -1 // hex digits seen in a \u escape, -1 outside one
+	literal := ""       // unfinished true/false/null
+	number := ""        // unfinished number
+
+	for i := 0; i < len(partial); i++ {
+		c := partial[i]
+		switch {
+		case inString:
+			switch {
+			case unicodeDigits >= 0:
+				unicodeDigits++
+				if unicodeDigits == 4 {
+					unicodeDigits = -1
+				}
+			case escaped:
+				escaped = false
+				if c == 'u' {
+					unicodeDigits = 0
+				}
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+				if expect == expectKey {
+					expect = expectColon
+				} else {
+					expect = expectNext
+				}
+			}
+			continue
+		case literal != "":
+			literal += string(c)
+			if literal == "true" || literal == "false" || literal == "null" {
+				literal = ""
+				expect = expectNext
+			}
+			continue
+		case number != "":
+			if strings.IndexByte("0123456789+-.eE", c) >= 0 {
+				number += string(c)
+				continue
+			}
+			number = ""
+			expect = expectNext
+		}
+
+		switch c {
+		case ' ', '\t', '\n', '\r':
+		case '"':
+			inString = true
+		case '{':
+			stack = append(stack, '{')
+			expect = expectKey
+		case '[':
+			stack = append(stack, '[')
+			expect = expectValue
+		case '}', ']':
+			if len(stack) == 0 {
+				return "", false
+			}
+			stack = stack[:len(stack)-1]
+			expect = expectNext
+		case ':':
+			expect = expectValue
+		case ',':
+			if len(stack) > 0 && stack[len(stack)-1] == '{' {
+				expect = expectKey
+			} else {
+				expect = expectValue
+			}
+		case 't', 'f', 'n':
+			literal = string(c)
+		default:
+			if c == '-' || (c >= '0' && c <= '9') {
+				number = string(c)
+				continue
+			}
+			return "", false
+		}
+	}
+
+	var suffix strings.Builder
+	switch {
+	case inString:
+		if escaped {
+			suffix.WriteByte('\\')
+		}
+		if unicodeDigits >= 0 {
+			suffix.WriteString(strings.Repeat("0", 4-unicodeDigits))
+		}
+		suffix.WriteByte('"')
+		if expect == expectKey {
+			suffix.WriteString(":null")
+		}
+	case literal != "":
+		for _, full := range []string{"true", "false", "null"} {
+			if strings.HasPrefix(full, literal) {
+				suffix.WriteString(full[len(literal):])
+				break
+			}
+		}
+	case number != "":
+		if last := number[len(number)-1]; last < '0' || last > '9' {
+			suffix.WriteByte('0')
+		}
+	case expect == expectColon:
+		suffix.WriteString(":null")
+	default:
+		trimmed := strings.TrimSpace(partial)
+		switch last := trimmed[len(trimmed)-1]; {
+		case last == ':' || (last == ',' && expect == expectValue):
+			suffix.WriteString("null")
+		case last == ',':
+			// A trailing comma in an object cannot be removed, only followed.
+			suffix.WriteString(`"":null`)
+		}
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i] == '{' {
+			suffix.WriteByte('}')
+		} else {
+			suffix.WriteByte(']')
+		}
+	}
+
+	out := suffix.String()
+	if !json.Valid([]byte(partial + out)) {
+		return "", false
+	}
+	return out, true
+}
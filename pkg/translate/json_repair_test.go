@@ -0,0 +1,71 @@
+package translate
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRepairJSONSuffix(t *testing.T) {
+	tests := []struct {
+		partial string
+		want    string
+	}{
+		{``, `{}`},
+		{`{"a":1}`, `{"a":1}`},
+		{`{`, `{}`},
+		{`{"loc`, `{"loc":null}`},
+		{`{"location"`, `{"location":null}`},
+		{`{"location":`, `{"location":null}`},
+		{`{"location": "San Fr`, `{"location": "San Fr"}`},
+		{`{"path": "C:\`, `{"path": "C:\\"}`},
+		{`{"s": "\u00`, `{"s": "\u0000"}`},
+		{`{"n": 12.`, `{"n": 12.0}`},
+		{`{"n": -`, `{"n": -0}`},
+		{`{"n": 12`, `{"n": 12}`},
+		{`{"ok": tr`, `{"ok": true}`},
+		{`{"v": nu`, `{"v": null}`},
+		{`{"a": [1, 2,`, `{"a": [1, 2,null]}`},
+		{`{"a": [`, `{"a": []}`},
+		{`{"a": 1,`, `{"a": 1,"":null}`},
+		{`{"a": {"b": [{"c": "d`, `{"a": {"b": [{"c": "d"}]}}`},
+	}
+	for _, tt := range tests {
+		suffix, ok := repairJSONSuffix(tt.partial)
+		if !ok {
+			t.Errorf("%q: repair failed", tt.partial)
+			continue
+		}
+		if got := tt.partial + suffix; got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.partial, got, tt.want)
+		}
+	}
+}
+
+func TestRepairJSONSuffixRejectsNonJSON(t *testing.T) {
+	for _, partial := range []string{`}`, `{"a": oops`, `<xml>`} {
+		if _, ok := repairJSONSuffix(partial); ok {
+			t.Errorf("%q: expected repair to fail", partial)
+		}
+	}
+}
+
+func FuzzRepairJSONSuffix(f *testing.F) {
+	for _, seed := range []string{`{"a": [1, {"b": "c\"d"}, true], "e": null}`, `{"q": "\u00e9", "n": -1.5e3}`} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, doc string) {
+		if !json.Valid([]byte(doc)) {
+			return
+		}
+		// Every prefix of a valid document is repairable into valid JSON.
+		for i := 0; i <= len(doc); i++ {
+			suffix, ok := repairJSONSuffix(doc[:i])
+			if !ok {
+				t.Fatalf("prefix %q: repair failed", doc[:i])
+			}
+			if !json.Valid([]byte(doc[:i] + suffix)) {
+				t.Fatalf("prefix %q: %q is not valid", doc[:i], doc[:i]+suffix)
+			}
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/bytedance/sonic"
+)
+
+// MetadataStore is the MetadataMap target that stands for OpenAI's store
+// flag rather than a metadata key.
+const MetadataStore = "store"
+
+// MetadataMap maps Anthropic metadata keys to OpenAI metadata keys, so tags
+// clients put on requests survive translation in either direction. A key
+// mapped to MetadataStore sets OpenAI's store flag from "true" or "false"
+// instead. Unmapped keys are dropped; user_id and OpenAI's user are always
+// carried over as well.
+type MetadataMap map[string]string
+
+// ToOpenAI sets the metadata and store flag of out, translated from an
+// Anthropic request, from the mapped keys of the request's metadata.
+func (m MetadataMap) ToOpenAI(md *Metadata, out *OpenAIRequest) {
+	if md == nil {
+		return
+	}
+	for from, to := range m {
+		v, ok := md.Get(from)
+		if !ok {
+			continue
+		}
+		if to == MetadataStore {
+			if b, err := strconv.ParseBool(v); err == nil {
+				out.Store = &b
+			}
+			continue
+		}
+		if out.Metadata == nil {
+			out.Metadata = map[string]string{}
+		}
+		out.Metadata[to] = v
+	}
+}
+
+// ToAnthropic sets the metadata of out, translated from req, from the keys
+// of req's metadata and its store flag that m maps.
+func (m MetadataMap) ToAnthropic(req *OpenAIRequest, out *AnthropicRequest) {
+	for to, from := range m {
+		var v string
+		if from == MetadataStore {
+			if req.Store == nil {
+				continue
+			}
+			v = strconv.FormatBool(*req.Store)
+		} else if s, ok := req.Metadata[from]; ok {
+			v = s
+		} else {
+			continue
+		}
+		if out.Metadata == nil {
+			out.Metadata = &Metadata{}
+		}
+		out.Metadata.Set(to, v)
+	}
+}
+
+// Get returns the value of a metadata key, user_id included.
+func (md *Metadata) Get(key string) (string, bool) {
+	if key == "user_id" {
+		return md.UserID, md.UserID != ""
+	}
+	v, ok := md.Extra[key]
+	return v, ok
+}
+
+// Set sets a metadata key, user_id included.
+func (md *Metadata) Set(key, value string) {
+	if key == "user_id" {
+		md.UserID = value
+		return
+	}
+	if md.Extra == nil {
+		md.Extra = map[string]string{}
+	}
+	md.Extra[key] = value
+}
+
+// UnmarshalJSON keeps every key of the metadata object. Numbers and
+// booleans are kept as their JSON text; objects, arrays and nulls are
+// dropped, as OpenAI metadata values are strings.
+func (md *Metadata) UnmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := sonic.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*md = Metadata{}
+	for k, v := range raw {
+		v = bytes.TrimSpace(v)
+		if len(v) == 0 || v[0] == '{' || v[0] == '[' || bytes.Equal(v, []byte("null")) {
+			continue
+		}
+		var s string
+		if err := sonic.Unmarshal(v, &s); err != nil {
+			s = string(v)
+		}
+		md.Set(k, s)
+	}
+	return nil
+}
+
+// MarshalJSON writes user_id and the Extra keys as one object.
+func (md Metadata) MarshalJSON() ([]byte, error) {
+	out := make(map[string]string, len(md.Extra)+1)
+	for k, v := range md.Extra {
+		out[k] = v
+	}
+	if md.UserID != "" {
+		out["user_id"] = md.UserID
+	}
+	return sonic.Marshal(out)
+}
@@ -0,0 +1,48 @@
+package translate
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bytedance/sonic"
+)
+
+func TestMetadataMap(t *testing.T) {
+	m := MetadataMap{"session_id": "session", "retain": MetadataStore}
+
+	var req AnthropicRequest
+	body := `{"model":"claude","max_tokens":10,"messages":[],"metadata":{"user_id":"u1","session_id":"s1","retain":"true","tier":3,"tags":["a"],"note":null}}`
+	if err := sonic.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"session_id": "s1", "retain": "true", "tier": "3"}
+	if req.Metadata.UserID != "u1" || len(req.Metadata.Extra) != len(want) {
+		t.Fatalf("metadata = %+v, want user u1 and %v", req.Metadata, want)
+	}
+	for k, v := range want {
+		if req.Metadata.Extra[k] != v {
+			t.Errorf("metadata[%s] = %q, want %q", k, req.Metadata.Extra[k], v)
+		}
+	}
+
+	out, err := AnthropicRequestToOpenAI(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.ToOpenAI(req.Metadata, out)
+	if out.User != "u1" || len(out.Metadata) != 1 || out.Metadata["session"] != "s1" || out.Store == nil || !*out.Store {
+		t.Fatalf("openai request = user %q, metadata %v, store %v", out.User, out.Metadata, out.Store)
+	}
+
+	back, err := OpenAIRequestToAnthropic(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.ToAnthropic(out, back)
+	b, _ := json.Marshal(back.Metadata)
+	var got map[string]string
+	json.Unmarshal(b, &got)
+	if len(got) != 3 || got["user_id"] != "u1" || got["session_id"] != "s1" || got["retain"] != "true" {
+		t.Fatalf("anthropic metadata = %s", b)
+	}
+}
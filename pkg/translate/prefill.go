@@ -0,0 +1,53 @@
+package translate
+
+import "strings"
+
+// Anthropic lets a request end with a partial assistant turn (a prefill)
+// that the response continues, without repeating it. OpenAI-format
+// upstreams receive the prefill as a trailing assistant message; many
+// answer with a fresh turn that starts by restating it, so the translated
+// response drops the prefill from the front of the generated text.
+
+// AnthropicPrefill returns the text of req's trailing assistant message, or
+// "" when the conversation does not end with one. A trailing turn holding a
+// tool_use is a completed turn, not a prefill.
+func AnthropicPrefill(req *AnthropicRequest) string {
+	if len(req.Messages) == 0 {
+		return ""
+	}
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role != "assistant" {
+		return ""
+	}
+	if s, ok := last.ContentAsString(); ok {
+		return s
+	}
+	blocks, err := last.ContentAsBlocks()
+	if err != nil {
+		return ""
+	}
+	var text strings.Builder
+	for _, b := range blocks {
+		switch b.Type {
+		case "text":
+			text.WriteString(b.Text)
+		case "tool_use":
+			return ""
+		}
+	}
+	return text.String()
+}
+
+// stripStreamedPrefill passes streamed text through, buffering it while it
+// could still be a restatement of the prefill. Once the whole prefill has
+// arrived it is dropped; text that diverges from it is released unchanged.
+func stripStreamedPrefill(state *streamState, text string) string {
+	buf := state.prefillBuf + text
+	if len(buf) < len(state.prefill) && strings.HasPrefix(state.prefill, buf) {
+		state.prefillBuf = buf
+		return ""
+	}
+	prefill := state.prefill
+	state.prefill, state.prefillBuf = "", ""
+	return strings.TrimPrefix(buf, prefill)
+}
@@ -1,6 +1,7 @@
 package translate
 
 import (
+	"bytes"
 	"encoding/json"
 
 	"github.com/bytedance/sonic"
@@ -28,7 +29,7 @@ func AnthropicRequestToOpenAI(req *AnthropicRequest) (*OpenAIRequest, error) {
 
 	// --- Messages ---
 	for i, msg := range req.Messages {
-		translated, err := translateMessage(msg)
+		translated, err := translateMessage(msg, req.InterleavedThinking)
 		if err != nil {
 			return nil, fmt.Errorf("translating message %d: %w", i, err)
 		}
@@ -51,12 +52,24 @@ func AnthropicRequestToOpenAI(req *AnthropicRequest) (*OpenAIRequest, error) {
 	}
 
 	// --- Tool choice ---
-	if len(req.ToolChoice) > 0 {
+	if allowed := parseAllowedToolsRaw(req.ToolChoice); allowed != nil {
+		out.Tools = allowed.pruneOpenAITools(out.Tools)
+		tc, err := allowed.openAIChoice(len(out.Tools))
+		if err != nil {
+			return nil, err
+		}
+		out.ToolChoice = tc
+	} else if len(req.ToolChoice) > 0 {
 		tc, err := translateToolChoice(req.ToolChoice)
 		if err != nil {
 			return nil, fmt.Errorf("translating tool_choice: %w", err)
 		}
 		out.ToolChoice = tc
+		var obj ToolChoiceObj
+		if sonic.Unmarshal(req.ToolChoice, &obj) == nil && obj.DisableParallelToolUse {
+			parallel := false
+			out.ParallelToolCalls = &parallel
+		}
 	}
 
 	// --- Scalars ---
@@ -137,12 +150,13 @@ func translateSystem(raw json.RawMessage) (*OpenAIMessage, error) {
 
 // translateMessage converts a single Anthropic message into one or more OpenAI
 // messages (tool_result blocks expand into separate tool messages).
-func translateMessage(msg AnthropicMessage) ([]OpenAIMessage, error) {
+// keepThinking carries assistant thinking blocks over as reasoning_content.
+func translateMessage(msg AnthropicMessage, keepThinking bool) ([]OpenAIMessage, error) {
 	switch msg.Role {
 	case "user":
 		return translateUserMessage(msg)
 	case "assistant":
-		return translateAssistantMessage(msg)
+		return translateAssistantMessage(msg, keepThinking)
 	default:
 		return nil, fmt.Errorf("unsupported message role: %q", msg.Role)
 	}
@@ -261,7 +275,7 @@ func toolResultContent(raw json.RawMessage) (interface{}, error) {
 	return strings.Join(texts, ""), nil
 }
 
-func translateAssistantMessage(msg AnthropicMessage) ([]OpenAIMessage, error) {
+func translateAssistantMessage(msg AnthropicMessage, keepThinking bool) ([]OpenAIMessage, error) {
 	// Simple string content.
 	if s, ok := msg.ContentAsString(); ok {
 		return []OpenAIMessage{{Role: "assistant", Content: s}}, nil
@@ -275,6 +289,7 @@ func translateAssistantMessage(msg AnthropicMessage) ([]OpenAIMessage, error) {
 	oMsg := OpenAIMessage{Role: "assistant"}
 
 	var textParts []string
+	var thinkingParts []string
 	var toolCalls []OpenAIToolCall
 
 	for _, b := range blocks {
@@ -298,13 +313,22 @@ func translateAssistantMessage(msg AnthropicMessage) ([]OpenAIMessage, error) {
 				},
 			})
 		case "thinking":
-			// Skip — no OpenAI equivalent.
+			// With interleaved thinking the reasoning between tool calls is
+			// part of the agentic loop, so hand it back to upstreams that
+			// accept reasoning_content. Otherwise skip — the official
+			// OpenAI API has no equivalent.
+			if keepThinking && strings.TrimSpace(b.Thinking) != "" {
+				thinkingParts = append(thinkingParts, b.Thinking)
+			}
 		}
 	}
 
 	if len(textParts) > 0 {
 		oMsg.Content = strings.Join(textParts, "")
 	}
+	if len(thinkingParts) > 0 {
+		oMsg.ReasoningContent = strings.Join(thinkingParts, "\n\n")
+	}
 	if len(toolCalls) > 0 {
 		oMsg.ToolCalls = toolCalls
 	}
@@ -318,16 +342,13 @@ func marshalToolInput(raw json.RawMessage) (string, error) {
 	if len(raw) == 0 {
 		return "{}", nil
 	}
-	// Re-marshal to get a compact canonical form.
-	var v interface{}
-	if err := sonic.Unmarshal(raw, &v); err != nil {
-		return "", err
-	}
-	b, err := sonic.Marshal(v)
-	if err != nil {
+	// Compact rather than re-marshal, which would round large integers
+	// through float64.
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
 		return "", err
 	}
-	return string(b), nil
+	return buf.String(), nil
 }
 
 // translateToolChoice converts Anthropic tool_choice to OpenAI tool_choice.
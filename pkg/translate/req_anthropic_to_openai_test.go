@@ -301,6 +301,59 @@ func TestAnthropicRequestToOpenAI(t *testing.T) {
 				if len(aMsg.ToolCalls) != 0 {
 					t.Errorf("unexpected tool_calls")
 				}
+				if aMsg.ReasoningContent != "" {
+					t.Errorf("reasoning_content = %q without interleaved thinking", aMsg.ReasoningContent)
+				}
+			},
+		},
+		{
+			name: "interleaved thinking kept as reasoning_content",
+			input: AnthropicRequest{
+				Model:               "claude-3-sonnet",
+				MaxTokens:           1024,
+				InterleavedThinking: true,
+				Messages: []AnthropicMessage{
+					{Role: "user", Content: mustJSON("Check the weather")},
+					{
+						Role: "assistant",
+						Content: mustJSON([]ContentBlock{
+							{Type: "thinking", Thinking: "Need the forecast.", Signature: "sig1"},
+							{Type: "tool_use", ID: "c1", Name: "weather", Input: mustJSON(map[string]string{"city": "Oslo"})},
+						}),
+					},
+					{
+						Role: "user",
+						Content: mustJSON([]ContentBlock{
+							{Type: "tool_result", ToolUseID: "c1", Content: mustJSON("rain")},
+						}),
+					},
+					{
+						Role: "assistant",
+						Content: mustJSON([]ContentBlock{
+							{Type: "thinking", Thinking: "Rain, so suggest an umbrella."},
+							{Type: "redacted_thinking"},
+							{Type: "text", Text: "Bring an umbrella."},
+						}),
+					},
+				},
+			},
+			check: func(t *testing.T, out *OpenAIRequest) {
+				// user, assistant, tool, assistant
+				if len(out.Messages) != 4 {
+					t.Fatalf("got %d messages, want 4", len(out.Messages))
+				}
+				if got := out.Messages[1].ReasoningContent; got != "Need the forecast." {
+					t.Errorf("msg[1].reasoning_content = %q", got)
+				}
+				if len(out.Messages[1].ToolCalls) != 1 {
+					t.Errorf("msg[1].tool_calls = %d", len(out.Messages[1].ToolCalls))
+				}
+				if got := out.Messages[3].ReasoningContent; got != "Rain, so suggest an umbrella." {
+					t.Errorf("msg[3].reasoning_content = %q", got)
+				}
+				if out.Messages[3].Content != "Bring an umbrella." {
+					t.Errorf("msg[3].content = %v", out.Messages[3].Content)
+				}
 			},
 		},
 		{
@@ -391,6 +444,50 @@ func TestAnthropicRequestToOpenAI(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "tool choice allowed_tools prunes tools",
+			input: AnthropicRequest{
+				Model:     "claude-3-sonnet",
+				MaxTokens: 100,
+				Tools: []AnthropicTool{
+					{Name: "read", InputSchema: mustJSON(map[string]string{"type": "object"})},
+					{Name: "write", InputSchema: mustJSON(map[string]string{"type": "object"})},
+					{Name: "exec", InputSchema: mustJSON(map[string]string{"type": "object"})},
+				},
+				ToolChoice: json.RawMessage(`{"type":"allowed_tools","mode":"any","tools":[{"name":"read"},{"name":"write"}]}`),
+				Messages:   []AnthropicMessage{{Role: "user", Content: mustJSON("Hi")}},
+			},
+			check: func(t *testing.T, out *OpenAIRequest) {
+				if len(out.Tools) != 2 || out.Tools[0].Function.Name != "read" || out.Tools[1].Function.Name != "write" {
+					t.Errorf("tools = %+v", out.Tools)
+				}
+				if out.ToolChoice != "required" {
+					t.Errorf("tool_choice = %v", out.ToolChoice)
+				}
+			},
+		},
+		{
+			name: "tool choice allowed_tools single required tool",
+			input: AnthropicRequest{
+				Model:     "claude-3-sonnet",
+				MaxTokens: 100,
+				Tools: []AnthropicTool{
+					{Name: "read", InputSchema: mustJSON(map[string]string{"type": "object"})},
+					{Name: "write", InputSchema: mustJSON(map[string]string{"type": "object"})},
+				},
+				ToolChoice: json.RawMessage(`{"type":"allowed_tools","allowed_tools":{"mode":"required","tools":[{"type":"function","function":{"name":"write"}},{"type":"function","function":{"name":"missing"}}]}}`),
+				Messages:   []AnthropicMessage{{Role: "user", Content: mustJSON("Hi")}},
+			},
+			check: func(t *testing.T, out *OpenAIRequest) {
+				if len(out.Tools) != 1 || out.Tools[0].Function.Name != "write" {
+					t.Errorf("tools = %+v", out.Tools)
+				}
+				tc, ok := out.ToolChoice.(OpenAIToolChoiceFunction)
+				if !ok || tc.Function.Name != "write" {
+					t.Errorf("tool_choice = %+v", out.ToolChoice)
+				}
+			},
+		},
 		{
 			name: "streaming flag",
 			input: AnthropicRequest{
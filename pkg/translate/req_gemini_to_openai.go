@@ -0,0 +1,304 @@
+package translate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"github.com/sertdev/pxbin/internal/ids"
+)
+
+// GeminiRequestToOpenAI translates a Gemini generateContent request for model
+// into an OpenAI /v1/chat/completions request. stream is true for
+// streamGenerateContent.
+func GeminiRequestToOpenAI(req *GeminiRequest, model string, stream bool) (*OpenAIRequest, error) {
+	out := &OpenAIRequest{
+		Model: model,
+	}
+
+	// --- System instruction ---
+	if req.SystemInstruction != nil {
+		if text := geminiText(req.SystemInstruction.Parts); text != "" {
+			out.Messages = append(out.Messages, OpenAIMessage{Role: "system", Content: text})
+		}
+	}
+
+	// --- Contents ---
+	// Gemini function calls often have no ID; responses are matched to the
+	// earliest unanswered call of the same name.
+	pending := map[string][]string{}
+	for i, c := range req.Contents {
+		var msgs []OpenAIMessage
+		var err error
+		switch c.Role {
+		case "model":
+			msgs = translateGeminiModelContent(c, pending)
+		case "", "user", "function":
+			msgs, err = translateGeminiUserContent(c, pending)
+		default:
+			err = fmt.Errorf("unknown role %q", c.Role)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("translating content %d: %w", i, err)
+		}
+		out.Messages = append(out.Messages, msgs...)
+	}
+
+	// --- Tools ---
+	for _, t := range req.Tools {
+		for _, fd := range t.FunctionDeclarations {
+			params := fd.ParametersJSONSchema
+			if len(params) == 0 && len(fd.Parameters) > 0 {
+				params = GeminiSchemaToJSONSchema(fd.Parameters)
+			}
+			out.Tools = append(out.Tools, OpenAITool{
+				Type: "function",
+				Function: OpenAIFunctionDef{
+					Name:        fd.Name,
+					Description: fd.Description,
+					Parameters:  params,
+				},
+			})
+		}
+	}
+
+	// --- Tool choice ---
+	if req.ToolConfig != nil && req.ToolConfig.FunctionCallingConfig != nil {
+		fc := req.ToolConfig.FunctionCallingConfig
+		switch strings.ToUpper(fc.Mode) {
+		case "NONE":
+			out.ToolChoice = "none"
+		case "ANY":
+			if len(fc.AllowedFunctionNames) > 0 {
+				allowed := make(map[string]bool, len(fc.AllowedFunctionNames))
+				for _, name := range fc.AllowedFunctionNames {
+					allowed[name] = true
+				}
+				kept := out.Tools[:0]
+				for _, t := range out.Tools {
+					if allowed[t.Function.Name] {
+						kept = append(kept, t)
+					}
+				}
+				out.Tools = kept
+			}
+			if len(out.Tools) == 1 {
+				out.ToolChoice = OpenAIToolChoiceFunction{
+					Type:     "function",
+					Function: OpenAIToolChoiceFuncName{Name: out.Tools[0].Function.Name},
+				}
+			} else {
+				out.ToolChoice = "required"
+			}
+		}
+	}
+
+	// --- Generation config ---
+	if gc := req.GenerationConfig; gc != nil {
+		if gc.CandidateCount != nil && *gc.CandidateCount > 1 {
+			return nil, fmt.Errorf("candidateCount above 1 is not supported")
+		}
+		out.MaxTokens = gc.MaxOutputTokens
+		if len(gc.StopSequences) > 0 {
+			out.Stop = gc.StopSequences
+		}
+		out.Temperature = gc.Temperature
+		out.TopP = gc.TopP
+		// topK has no OpenAI equivalent — omit
+
+		if gc.ResponseMimeType == "application/json" {
+			schema := gc.ResponseJSONSchema
+			if len(schema) == 0 && len(gc.ResponseSchema) > 0 {
+				schema = GeminiSchemaToJSONSchema(gc.ResponseSchema)
+			}
+			if len(schema) > 0 {
+				out.ResponseFormat = map[string]interface{}{
+					"type":        "json_schema",
+					"json_schema": map[string]interface{}{"name": "response", "schema": schema},
+				}
+			} else {
+				out.ResponseFormat = map[string]interface{}{"type": "json_object"}
+			}
+		}
+
+		// --- Thinking ---
+		// A positive budget maps onto the effort levels that
+		// OpenAIRequestToAnthropic turns back into budgets.
+		if tc := gc.ThinkingConfig; tc != nil && tc.ThinkingBudget != nil && *tc.ThinkingBudget > 0 {
+			budget := *tc.ThinkingBudget
+			switch {
+			case budget <= 5000:
+				out.ReasoningEffort = "low"
+			case budget <= 10000:
+				out.ReasoningEffort = "medium"
+			default:
+				out.ReasoningEffort = "high"
+			}
+			if out.MaxTokens != nil {
+				total := budget + *out.MaxTokens
+				out.MaxCompletionTokens = &total
+				out.MaxTokens = nil
+			}
+		}
+	}
+
+	// --- Streaming ---
+	if stream {
+		out.Stream = true
+		out.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+
+	return out, nil
+}
+
+// geminiText concatenates the non-thought text parts.
+func geminiText(parts []GeminiPart) string {
+	var sb strings.Builder
+	for _, p := range parts {
+		if !p.Thought {
+			sb.WriteString(p.Text)
+		}
+	}
+	return sb.String()
+}
+
+// translateGeminiUserContent converts a user turn. Function responses become
+// tool messages, which must come first to follow the assistant's tool calls.
+func translateGeminiUserContent(c GeminiContent, pending map[string][]string) ([]OpenAIMessage, error) {
+	var msgs []OpenAIMessage
+	var parts []OpenAIContentPart
+	for _, p := range c.Parts {
+		switch {
+		case p.FunctionResponse != nil:
+			fr := p.FunctionResponse
+			id := fr.ID
+			if queue := pending[fr.Name]; id == "" && len(queue) > 0 {
+				id, pending[fr.Name] = queue[0], queue[1:]
+			} else if id != "" {
+				pending[fr.Name] = removeID(queue, id)
+			}
+			if id == "" {
+				return nil, fmt.Errorf("function response %q does not match a function call", fr.Name)
+			}
+			content := string(fr.Response)
+			if content == "" {
+				content = "{}"
+			}
+			msgs = append(msgs, OpenAIMessage{Role: "tool", ToolCallID: id, Content: content})
+		case p.InlineData != nil:
+			if !strings.HasPrefix(p.InlineData.MimeType, "image/") {
+				return nil, fmt.Errorf("unsupported inlineData mime type %q", p.InlineData.MimeType)
+			}
+			parts = append(parts, OpenAIContentPart{
+				Type:     "image_url",
+				ImageURL: &ImageURL{URL: "data:" + p.InlineData.MimeType + ";base64," + p.InlineData.Data},
+			})
+		case p.FileData != nil:
+			uri := p.FileData.FileURI
+			if !strings.HasPrefix(p.FileData.MimeType, "image/") || !(strings.HasPrefix(uri, "https://") || strings.HasPrefix(uri, "http://")) {
+				return nil, fmt.Errorf("unsupported fileData %q: only image URLs can be forwarded", uri)
+			}
+			parts = append(parts, OpenAIContentPart{Type: "image_url", ImageURL: &ImageURL{URL: uri}})
+		case p.FunctionCall != nil:
+			return nil, fmt.Errorf("function call %q in a user turn", p.FunctionCall.Name)
+		case p.Text != "" && !p.Thought:
+			parts = append(parts, OpenAIContentPart{Type: "text", Text: p.Text})
+		}
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0].Type == "text":
+		msgs = append(msgs, OpenAIMessage{Role: "user", Content: parts[0].Text})
+	case len(parts) > 0:
+		msgs = append(msgs, OpenAIMessage{Role: "user", Content: parts})
+	}
+	return msgs, nil
+}
+
+// translateGeminiModelContent converts a model turn into an assistant
+// message, recording its function call IDs in pending. Thoughts are dropped.
+func translateGeminiModelContent(c GeminiContent, pending map[string][]string) []OpenAIMessage {
+	msg := OpenAIMessage{Role: "assistant"}
+	if text := geminiText(c.Parts); text != "" {
+		msg.Content = text
+	}
+	for _, p := range c.Parts {
+		fc := p.FunctionCall
+		if fc == nil {
+			continue
+		}
+		id := fc.ID
+		if id == "" {
+			id = ids.ToolCall()
+		}
+		pending[fc.Name] = append(pending[fc.Name], id)
+		args := string(fc.Args)
+		if args == "" || args == "null" {
+			args = "{}"
+		}
+		msg.ToolCalls = append(msg.ToolCalls, OpenAIToolCall{
+			ID:       id,
+			Type:     "function",
+			Function: OpenAIFunction{Name: fc.Name, Arguments: args},
+		})
+	}
+	if msg.Content == nil && len(msg.ToolCalls) == 0 {
+		return nil
+	}
+	return []OpenAIMessage{msg}
+}
+
+func removeID(queue []string, id string) []string {
+	for i, q := range queue {
+		if q == id {
+			return append(queue[:i:i], queue[i+1:]...)
+		}
+	}
+	return queue
+}
+
+// GeminiSchemaToJSONSchema converts a schema in Gemini's OpenAPI subset into
+// JSON Schema: type names are lower-cased ("OBJECT" → "object"), nullable
+// becomes a "null" type, and propertyOrdering is dropped. Unparseable input
+// is returned unchanged.
+func GeminiSchemaToJSONSchema(raw json.RawMessage) json.RawMessage {
+	var schema interface{}
+	if err := sonic.Unmarshal(raw, &schema); err != nil {
+		return raw
+	}
+	out, err := sonic.Marshal(convertGeminiSchema(schema))
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+func convertGeminiSchema(node interface{}) interface{} {
+	n, ok := node.(map[string]interface{})
+	if !ok {
+		return node
+	}
+	if t, ok := n["type"].(string); ok {
+		n["type"] = strings.ToLower(t)
+		if nullable, _ := n["nullable"].(bool); nullable {
+			n["type"] = []interface{}{strings.ToLower(t), "null"}
+		}
+	}
+	delete(n, "nullable")
+	delete(n, "propertyOrdering")
+	if props, ok := n["properties"].(map[string]interface{}); ok {
+		for k, v := range props {
+			props[k] = convertGeminiSchema(v)
+		}
+	}
+	if items, ok := n["items"]; ok {
+		n["items"] = convertGeminiSchema(items)
+	}
+	if anyOf, ok := n["anyOf"].([]interface{}); ok {
+		for i, v := range anyOf {
+			anyOf[i] = convertGeminiSchema(v)
+		}
+	}
+	return n
+}
@@ -87,21 +87,35 @@ func OpenAIRequestToAnthropic(req *OpenAIRequest) (*AnthropicRequest, error) {
 		if t.Type != "function" {
 			continue
 		}
+		schema, changes := AnthropicToolSchema(t.Function.Parameters)
+		for _, c := range changes {
+			out.SchemaChanges = append(out.SchemaChanges, t.Function.Name+": "+c)
+		}
 		out.Tools = append(out.Tools, AnthropicTool{
 			Name:        t.Function.Name,
 			Description: t.Function.Description,
-			InputSchema: t.Function.Parameters,
+			InputSchema: schema,
 		})
 	}
 
 	// --- Tool choice ---
-	if req.ToolChoice != nil {
+	if allowed := parseAllowedTools(req.ToolChoice); allowed != nil {
+		out.Tools = allowed.pruneAnthropicTools(out.Tools)
+		tc, err := allowed.anthropicChoice(len(out.Tools))
+		if err != nil {
+			return nil, err
+		}
+		out.ToolChoice = tc
+	} else if req.ToolChoice != nil {
 		tc, err := translateOpenAIToolChoiceToAnthropic(req.ToolChoice)
 		if err != nil {
 			return nil, fmt.Errorf("translating tool_choice: %w", err)
 		}
 		out.ToolChoice = tc
 	}
+	if req.ParallelToolCalls != nil && !*req.ParallelToolCalls {
+		out.ToolChoice = disableParallelToolUse(out.ToolChoice, len(out.Tools) > 0)
+	}
 
 	// --- Scalars ---
 	if req.MaxTokens != nil {
@@ -287,7 +301,8 @@ func translateOpenAIToolChoiceToAnthropic(tc interface{}) (json.RawMessage, erro
 			raw, _ := sonic.Marshal(ToolChoiceObj{Type: "any"})
 			return json.RawMessage(raw), nil
 		case "none":
-			return nil, nil
+			raw, _ := sonic.Marshal(ToolChoiceObj{Type: "none"})
+			return json.RawMessage(raw), nil
 		default:
 			raw, _ := sonic.Marshal(v)
 			return json.RawMessage(raw), nil
@@ -305,6 +320,26 @@ func translateOpenAIToolChoiceToAnthropic(tc interface{}) (json.RawMessage, erro
 	return nil, nil
 }
 
+// disableParallelToolUse sets disable_parallel_tool_use on an Anthropic
+// tool_choice, the counterpart of parallel_tool_calls: false. With no
+// tool_choice it adds an "auto" one, but only when there are tools.
+func disableParallelToolUse(tc json.RawMessage, hasTools bool) json.RawMessage {
+	obj := ToolChoiceObj{Type: "auto"}
+	if len(tc) > 0 {
+		if err := sonic.Unmarshal(tc, &obj); err != nil {
+			return tc
+		}
+	} else if !hasTools {
+		return tc
+	}
+	if obj.Type == "none" {
+		return tc
+	}
+	obj.DisableParallelToolUse = true
+	raw, _ := sonic.Marshal(obj)
+	return json.RawMessage(raw)
+}
+
 // ensureBlocksContent normalises Anthropic message content into an array of
 // ContentBlock, regardless of whether it was stored as a plain string.
 func ensureBlocksContent(content json.RawMessage) []ContentBlock {
@@ -0,0 +1,268 @@
+package translate
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/bytedance/sonic"
+)
+
+// OpenAIRequestToGemini translates an OpenAI /v1/chat/completions request
+// into a Gemini generateContent request. The model and whether to stream
+// are not part of a Gemini body: callers pick the URL from req.Model and
+// req.Stream.
+func OpenAIRequestToGemini(req *OpenAIRequest) (*GeminiRequest, error) {
+	out := &GeminiRequest{Contents: []GeminiContent{}}
+
+	// --- System prompt: system and developer messages ---
+	var systemParts []string
+	for _, msg := range req.Messages {
+		if msg.Role == "system" || msg.Role == "developer" {
+			if text := extractOpenAIMessageText(msg); text != "" {
+				systemParts = append(systemParts, text)
+			}
+		}
+	}
+	if len(systemParts) > 0 {
+		out.SystemInstruction = &GeminiContent{Parts: []GeminiPart{{Text: strings.Join(systemParts, "\n\n")}}}
+	}
+
+	// --- Messages ---
+	// Gemini function responses carry the function's name, not the call's
+	// ID, so names are looked up from the assistant's earlier calls.
+	// Consecutive tool messages become one user turn.
+	callNames := map[string]string{}
+	for i := 0; i < len(req.Messages); i++ {
+		msg := req.Messages[i]
+		switch msg.Role {
+		case "system", "developer":
+		case "user":
+			parts, err := openAIUserPartsToGemini(msg)
+			if err != nil {
+				return nil, fmt.Errorf("translating user message %d: %w", i, err)
+			}
+			if len(parts) > 0 {
+				out.Contents = append(out.Contents, GeminiContent{Role: "user", Parts: parts})
+			}
+		case "assistant":
+			if c, ok := openAIAssistantToGemini(msg, callNames); ok {
+				out.Contents = append(out.Contents, c)
+			}
+		case "tool":
+			c := GeminiContent{Role: "user"}
+			for ; i < len(req.Messages) && req.Messages[i].Role == "tool"; i++ {
+				toolMsg := req.Messages[i]
+				name, ok := callNames[toolMsg.ToolCallID]
+				if !ok {
+					return nil, fmt.Errorf("tool message %d does not answer a tool call", i)
+				}
+				c.Parts = append(c.Parts, GeminiPart{FunctionResponse: &GeminiFunctionResponse{
+					ID:       toolMsg.ToolCallID,
+					Name:     name,
+					Response: geminiFunctionResponse(extractOpenAIMessageText(toolMsg)),
+				}})
+			}
+			i--
+			out.Contents = append(out.Contents, c)
+		default:
+			return nil, fmt.Errorf("unknown role %q in message %d", msg.Role, i)
+		}
+	}
+
+	// --- Tools ---
+	if len(req.Tools) > 0 {
+		tool := GeminiTool{}
+		for _, t := range req.Tools {
+			if t.Type != "function" {
+				continue
+			}
+			tool.FunctionDeclarations = append(tool.FunctionDeclarations, GeminiFunctionDeclaration{
+				Name:                 t.Function.Name,
+				Description:          t.Function.Description,
+				ParametersJSONSchema: t.Function.Parameters,
+			})
+		}
+		if len(tool.FunctionDeclarations) > 0 {
+			out.Tools = []GeminiTool{tool}
+		}
+	}
+
+	// --- Tool choice ---
+	if fc := openAIToolChoiceToGemini(req.ToolChoice); fc != nil {
+		out.ToolConfig = &GeminiToolConfig{FunctionCallingConfig: fc}
+	}
+
+	// --- Generation config ---
+	gc := &GeminiGenerationConfig{
+		Temperature:     req.Temperature,
+		TopP:            req.TopP,
+		MaxOutputTokens: req.MaxTokens,
+	}
+	if req.MaxCompletionTokens != nil {
+		gc.MaxOutputTokens = req.MaxCompletionTokens
+	}
+	switch stop := req.Stop.(type) {
+	case string:
+		gc.StopSequences = []string{stop}
+	case []string:
+		gc.StopSequences = stop
+	case []interface{}:
+		for _, s := range stop {
+			if s, ok := s.(string); ok {
+				gc.StopSequences = append(gc.StopSequences, s)
+			}
+		}
+	}
+	if rf, ok := req.ResponseFormat.(map[string]interface{}); ok {
+		switch rf["type"] {
+		case "json_object":
+			gc.ResponseMimeType = "application/json"
+		case "json_schema":
+			gc.ResponseMimeType = "application/json"
+			if js, ok := rf["json_schema"].(map[string]interface{}); ok && js["schema"] != nil {
+				schema, err := sonic.Marshal(js["schema"])
+				if err != nil {
+					return nil, fmt.Errorf("encoding response schema: %w", err)
+				}
+				gc.ResponseJSONSchema = schema
+			}
+		}
+	}
+
+	// --- Thinking ---
+	// The effort levels map onto the budgets OpenAIRequestToAnthropic uses.
+	if req.ReasoningEffort != "" {
+		budget := 10000
+		switch req.ReasoningEffort {
+		case "minimal", "none":
+			budget = 0
+		case "low":
+			budget = 5000
+		case "high":
+			budget = 20000
+		}
+		gc.ThinkingConfig = &GeminiThinkingConfig{ThinkingBudget: &budget, IncludeThoughts: budget > 0}
+	}
+
+	if gc.Temperature != nil || gc.TopP != nil || gc.MaxOutputTokens != nil || len(gc.StopSequences) > 0 ||
+		gc.ResponseMimeType != "" || gc.ThinkingConfig != nil {
+		out.GenerationConfig = gc
+	}
+	return out, nil
+}
+
+// openAIUserPartsToGemini converts a user message's content. Images are
+// sent inline when given as data URLs and by URI otherwise.
+func openAIUserPartsToGemini(msg OpenAIMessage) ([]GeminiPart, error) {
+	switch v := msg.Content.(type) {
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		return []GeminiPart{{Text: v}}, nil
+	case []interface{}:
+		var parts []GeminiPart
+		for _, part := range v {
+			m, ok := part.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch m["type"] {
+			case "text":
+				if text, _ := m["text"].(string); text != "" {
+					parts = append(parts, GeminiPart{Text: text})
+				}
+			case "image_url":
+				img, _ := m["image_url"].(map[string]interface{})
+				u, _ := img["url"].(string)
+				p, err := geminiImagePart(u)
+				if err != nil {
+					return nil, err
+				}
+				parts = append(parts, p)
+			}
+		}
+		return parts, nil
+	}
+	return nil, nil
+}
+
+// geminiImagePart converts an OpenAI image URL. A linked image's media
+// type is guessed from its extension, since Gemini requires one.
+func geminiImagePart(u string) (GeminiPart, error) {
+	if rest, ok := strings.CutPrefix(u, "data:"); ok {
+		mediaType, data, ok := strings.Cut(rest, ";base64,")
+		if !ok {
+			return GeminiPart{}, fmt.Errorf("image data URL is not base64")
+		}
+		return GeminiPart{InlineData: &GeminiBlob{MimeType: mediaType, Data: data}}, nil
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return GeminiPart{}, fmt.Errorf("invalid image URL: %w", err)
+	}
+	mediaType := mime.TypeByExtension(strings.ToLower(path.Ext(parsed.Path)))
+	if !strings.HasPrefix(mediaType, "image/") {
+		return GeminiPart{}, fmt.Errorf("cannot tell the image type of %q from its extension", u)
+	}
+	return GeminiPart{FileData: &GeminiFileData{MimeType: mediaType, FileURI: u}}, nil
+}
+
+// openAIAssistantToGemini converts an assistant message into a model turn,
+// recording its tool call names in callNames. It reports false for a
+// message with neither text nor tool calls.
+func openAIAssistantToGemini(msg OpenAIMessage, callNames map[string]string) (GeminiContent, bool) {
+	c := GeminiContent{Role: "model"}
+	if text := extractOpenAIMessageText(msg); text != "" {
+		c.Parts = append(c.Parts, GeminiPart{Text: text})
+	}
+	for _, tc := range msg.ToolCalls {
+		callNames[tc.ID] = tc.Function.Name
+		c.Parts = append(c.Parts, GeminiPart{FunctionCall: &GeminiFunctionCall{
+			ID:   tc.ID,
+			Name: tc.Function.Name,
+			Args: geminiArgs(tc.Function.Arguments),
+		}})
+	}
+	return c, len(c.Parts) > 0
+}
+
+// geminiFunctionResponse wraps a tool result in the object Gemini expects:
+// a JSON object result is sent as is, anything else under "content".
+func geminiFunctionResponse(content string) json.RawMessage {
+	trimmed := strings.TrimSpace(content)
+	if strings.HasPrefix(trimmed, "{") && sonic.ValidString(trimmed) {
+		return json.RawMessage(trimmed)
+	}
+	raw, _ := sonic.Marshal(map[string]string{"content": content})
+	return raw
+}
+
+// openAIToolChoiceToGemini maps an OpenAI tool_choice onto a Gemini
+// function calling config, or returns nil to leave the default.
+func openAIToolChoiceToGemini(tc interface{}) *GeminiFunctionCallingConfig {
+	switch v := tc.(type) {
+	case string:
+		switch v {
+		case "none":
+			return &GeminiFunctionCallingConfig{Mode: "NONE"}
+		case "required":
+			return &GeminiFunctionCallingConfig{Mode: "ANY"}
+		case "auto":
+			return &GeminiFunctionCallingConfig{Mode: "AUTO"}
+		}
+	case map[string]interface{}:
+		if fn, ok := v["function"].(map[string]interface{}); ok {
+			if name, _ := fn["name"].(string); name != "" {
+				return &GeminiFunctionCallingConfig{Mode: "ANY", AllowedFunctionNames: []string{name}}
+			}
+		}
+	case OpenAIToolChoiceFunction:
+		return &GeminiFunctionCallingConfig{Mode: "ANY", AllowedFunctionNames: []string{v.Function.Name}}
+	}
+	return nil
+}
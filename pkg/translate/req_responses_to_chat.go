@@ -9,6 +9,9 @@ import (
 // ResponsesRequestToChatCompletions translates an OpenAI Responses API request
 // into a Chat Completions request suitable for /v1/chat/completions.
 func ResponsesRequestToChatCompletions(req *ResponsesAPIRequest) (*OpenAIRequest, error) {
+	if req.N != nil && *req.N > 1 {
+		return nil, fmt.Errorf("n above 1 is not supported")
+	}
 	out := &OpenAIRequest{
 		Model: req.Model,
 	}
@@ -58,7 +61,14 @@ func ResponsesRequestToChatCompletions(req *ResponsesAPIRequest) (*OpenAIRequest
 			}
 		}
 	}
-	if len(req.ToolChoice) > 0 {
+	if allowed := parseAllowedToolsRaw(req.ToolChoice); allowed != nil {
+		out.Tools = allowed.pruneOpenAITools(out.Tools)
+		tc, err := allowed.openAIChoice(len(out.Tools))
+		if err != nil {
+			return nil, err
+		}
+		out.ToolChoice = tc
+	} else if len(req.ToolChoice) > 0 {
 		var tc interface{}
 		if err := sonic.Unmarshal(req.ToolChoice, &tc); err == nil {
 			out.ToolChoice = tc
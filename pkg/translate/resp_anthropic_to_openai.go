@@ -1,6 +1,10 @@
 package translate
 
-import "time"
+import (
+	"time"
+
+	"github.com/sertdev/pxbin/internal/ids"
+)
 
 // mapAnthropicStopReason converts an Anthropic stop_reason to an OpenAI finish_reason.
 func mapAnthropicStopReason(reason *string) *string {
@@ -42,7 +46,7 @@ func AnthropicResponseToOpenAI(resp *AnthropicResponse) *OpenAIResponse {
 			}
 			id := block.ID
 			if id == "" {
-				id = generateToolUseID()
+				id = ids.ToolCall()
 			}
 			toolCalls = append(toolCalls, OpenAIToolCall{
 				ID:   id,
@@ -81,9 +85,14 @@ func AnthropicResponseToOpenAI(resp *AnthropicResponse) *OpenAIResponse {
 			CachedTokens: resp.Usage.CacheReadInputTokens,
 		}
 	}
+	if n := resp.ThinkingTokens(); n > 0 {
+		usage.CompletionTokensDetails = &OpenAICompletionTokensDetails{
+			ReasoningTokens: n,
+		}
+	}
 
 	return &OpenAIResponse{
-		ID:      "chatcmpl-" + resp.ID,
+		ID:      ids.ChatCompletion(),
 		Object:  "chat.completion",
 		Created: time.Now().Unix(),
 		Model:   resp.Model,
@@ -94,6 +103,7 @@ func AnthropicResponseToOpenAI(resp *AnthropicResponse) *OpenAIResponse {
 				FinishReason: finishReason,
 			},
 		},
-		Usage: usage,
+		Usage:             usage,
+		SystemFingerprint: ids.Fingerprint(resp.Model),
 	}
 }
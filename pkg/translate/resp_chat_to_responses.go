@@ -1,22 +1,12 @@
 package translate
 
-import (
-	crypto_rand "crypto/rand"
-	"encoding/hex"
-)
-
-// generateResponseID returns a unique Responses API response ID: "resp_" + 24 hex chars.
-func generateResponseID() string {
-	b := make([]byte, 12)
-	crypto_rand.Read(b)
-	return "resp_" + hex.EncodeToString(b)
-}
+import "github.com/sertdev/pxbin/internal/ids"
 
 // ChatCompletionsToResponsesAPI translates a Chat Completions response into a
 // Responses API response.
 func ChatCompletionsToResponsesAPI(resp *OpenAIResponse, model string) *ResponsesAPIResponse {
 	out := &ResponsesAPIResponse{
-		ID:     generateResponseID(),
+		ID:     ids.Response(),
 		Object: "response",
 		Model:  model,
 		Status: "completed",
@@ -51,7 +41,7 @@ func translateChatMessageToOutputItems(msg OpenAIMessage) []ResponsesOutputItem
 	if text := messageContentAsString(msg.Content); text != "" {
 		items = append(items, ResponsesOutputItem{
 			Type:   "message",
-			ID:     generateMessageID(),
+			ID:     ids.ResponseMessage(),
 			Role:   "assistant",
 			Status: "completed",
 			Content: []ResponsesContentPart{{
@@ -65,7 +55,7 @@ func translateChatMessageToOutputItems(msg OpenAIMessage) []ResponsesOutputItem
 	for _, tc := range msg.ToolCalls {
 		items = append(items, ResponsesOutputItem{
 			Type:      "function_call",
-			ID:        tc.ID,
+			ID:        ids.ResponseFunctionCall(),
 			CallID:    tc.ID,
 			Name:      tc.Function.Name,
 			Arguments: tc.Function.Arguments,
@@ -0,0 +1,103 @@
+package translate
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sertdev/pxbin/internal/ids"
+)
+
+// GeminiResponseToOpenAI translates a Gemini generateContent response into
+// an OpenAI chat completion. model is used when the response names none.
+func GeminiResponseToOpenAI(resp *GeminiResponse, model string) *OpenAIResponse {
+	out := &OpenAIResponse{
+		ID:      resp.ResponseID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Usage:   OpenAIUsageFromGemini(resp.UsageMetadata),
+	}
+	if out.ID == "" {
+		out.ID = ids.ChatCompletion()
+	}
+	if resp.ModelVersion != "" {
+		out.Model = resp.ModelVersion
+	}
+
+	msg := OpenAIMessage{Role: "assistant"}
+	finish := "stop"
+	if len(resp.Candidates) > 0 {
+		cand := resp.Candidates[0]
+		var text, reasoning strings.Builder
+		for _, p := range cand.Content.Parts {
+			switch {
+			case p.FunctionCall != nil:
+				msg.ToolCalls = append(msg.ToolCalls, openAIToolCallFromGemini(p.FunctionCall))
+			case p.Thought:
+				reasoning.WriteString(p.Text)
+			default:
+				text.WriteString(p.Text)
+			}
+		}
+		msg.ReasoningContent = reasoning.String()
+		if text.Len() > 0 || len(msg.ToolCalls) == 0 {
+			msg.Content = text.String()
+		}
+		finish = OpenAIFinishReasonFromGemini(cand.FinishReason, len(msg.ToolCalls) > 0)
+	}
+	out.Choices = []OpenAIChoice{{Message: msg, FinishReason: &finish}}
+	return out
+}
+
+// OpenAIFinishReasonFromGemini maps a Gemini finishReason onto an OpenAI
+// finish_reason. Gemini reports function calls as STOP, so toolCalls says
+// whether the response made any.
+func OpenAIFinishReasonFromGemini(reason string, toolCalls bool) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	}
+	if toolCalls {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// OpenAIUsageFromGemini converts Gemini usage metadata into OpenAI usage,
+// or returns nil when m is nil. Thoughts count as completion tokens.
+func OpenAIUsageFromGemini(m *GeminiUsageMetadata) *OpenAIUsage {
+	if m == nil {
+		return nil
+	}
+	u := &OpenAIUsage{
+		PromptTokens:     m.PromptTokenCount,
+		CompletionTokens: m.CandidatesTokenCount + m.ThoughtsTokenCount,
+		TotalTokens:      m.TotalTokenCount,
+	}
+	if u.TotalTokens == 0 {
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	}
+	if m.CachedContentTokenCount > 0 {
+		u.PromptTokensDetails = &OpenAIPromptTokensDetails{CachedTokens: m.CachedContentTokenCount}
+	}
+	if m.ThoughtsTokenCount > 0 {
+		u.CompletionTokensDetails = &OpenAICompletionTokensDetails{ReasoningTokens: m.ThoughtsTokenCount}
+	}
+	return u
+}
+
+// openAIToolCallFromGemini converts a Gemini function call, giving it an ID
+// if it has none.
+func openAIToolCallFromGemini(fc *GeminiFunctionCall) OpenAIToolCall {
+	id := fc.ID
+	if id == "" {
+		id = ids.ToolCall()
+	}
+	args := string(fc.Args)
+	if args == "" || args == "null" {
+		args = "{}"
+	}
+	return OpenAIToolCall{ID: id, Type: "function", Function: OpenAIFunction{Name: fc.Name, Arguments: args}}
+}
@@ -1,28 +1,14 @@
 package translate
 
 import (
-	crypto_rand "crypto/rand"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/bytedance/sonic"
+	"github.com/sertdev/pxbin/internal/ids"
 )
 
-// generateMessageID returns a unique Anthropic-style message ID: "msg_" + 24 hex chars.
-func generateMessageID() string {
-	b := make([]byte, 12)
-	crypto_rand.Read(b)
-	return "msg_" + hex.EncodeToString(b)
-}
-
-// generateToolUseID returns a unique tool use ID: "toolu_" + 24 hex chars.
-func generateToolUseID() string {
-	b := make([]byte, 12)
-	crypto_rand.Read(b)
-	return "toolu_" + hex.EncodeToString(b)
-}
-
 // mapFinishReason converts an OpenAI finish_reason to an Anthropic stop_reason.
 func mapFinishReason(reason *string) string {
 	if reason == nil || *reason == "" {
@@ -43,8 +29,11 @@ func mapFinishReason(reason *string) string {
 }
 
 // OpenAIResponseToAnthropic translates a non-streaming OpenAI chat completion
-// response into an Anthropic Messages API response.
-func OpenAIResponseToAnthropic(resp *OpenAIResponse, model string) (*AnthropicResponse, error) {
+// response into an Anthropic Messages API response. prefill is the request's
+// trailing assistant text (see AnthropicPrefill), dropped from the front of
+// the output if the upstream restated it. stopSequences are the request's
+// stop_sequences, used to report which one ended the completion.
+func OpenAIResponseToAnthropic(resp *OpenAIResponse, model, prefill string, stopSequences []string) (*AnthropicResponse, error) {
 	if len(resp.Choices) == 0 {
 		return nil, fmt.Errorf("openai response has no choices")
 	}
@@ -54,26 +43,46 @@ func OpenAIResponseToAnthropic(resp *OpenAIResponse, model string) (*AnthropicRe
 
 	var content []ContentBlock
 
+	// Reasoning comes first, as Anthropic places thinking before the answer.
+	if msg.ReasoningContent != "" {
+		content = append(content, ContentBlock{
+			Type:     "thinking",
+			Thinking: msg.ReasoningContent,
+		})
+	}
+
+	stopReason := mapFinishReason(choice.FinishReason)
+	var stopSequence *string
+
 	// Extract text content. Content is interface{} — could be string or nil.
-	if msg.Content != nil {
-		if s, ok := msg.Content.(string); ok && s != "" {
-			content = append(content, ContentBlock{
-				Type: "text",
-				Text: s,
-			})
-		}
+	text, _ := msg.Content.(string)
+	text = strings.TrimPrefix(text, prefill)
+	if seq := matchedStopSequence(stopSequences, choice.FinishReason, text, choice.StopReason, choice.MatchedStop); seq != "" {
+		text = strings.TrimSuffix(text, seq)
+		stopReason = "stop_sequence"
+		stopSequence = &seq
+	}
+	if text != "" {
+		content = append(content, ContentBlock{
+			Type: "text",
+			Text: text,
+		})
 	}
 
 	// Extract tool calls.
 	for _, tc := range msg.ToolCalls {
 		id := tc.ID
 		if id == "" {
-			id = generateToolUseID()
+			id = ids.AnthropicToolUse()
 		}
 
+		// Arguments cut off by max_tokens are closed rather than dropped.
 		var input json.RawMessage
 		if err := sonic.Unmarshal([]byte(tc.Function.Arguments), &input); err != nil {
 			input = json.RawMessage(`{}`)
+			if suffix, ok := repairJSONSuffix(tc.Function.Arguments); ok {
+				input = json.RawMessage(tc.Function.Arguments + suffix)
+			}
 		}
 
 		content = append(content, ContentBlock{
@@ -84,8 +93,6 @@ func OpenAIResponseToAnthropic(resp *OpenAIResponse, model string) (*AnthropicRe
 		})
 	}
 
-	stopReason := mapFinishReason(choice.FinishReason)
-
 	var usage AnthropicUsage
 	if resp.Usage != nil {
 		inputTokens, outputTokens, cacheReadTokens := normalizeOpenAIUsage(resp.Usage)
@@ -97,13 +104,13 @@ func OpenAIResponseToAnthropic(resp *OpenAIResponse, model string) (*AnthropicRe
 	}
 
 	return &AnthropicResponse{
-		ID:           generateMessageID(),
+		ID:           ids.AnthropicMessage(),
 		Type:         "message",
 		Role:         "assistant",
 		Model:        model,
 		Content:      content,
 		StopReason:   &stopReason,
-		StopSequence: nil,
+		StopSequence: stopSequence,
 		Usage:        usage,
 	}, nil
 }
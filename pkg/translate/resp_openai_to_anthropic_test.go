@@ -22,7 +22,7 @@ func TestOpenAIResponseToAnthropic_SimpleText(t *testing.T) {
 		Usage: &OpenAIUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
 	}
 
-	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514")
+	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -82,7 +82,7 @@ func TestOpenAIResponseToAnthropic_SingleToolCall(t *testing.T) {
 		Usage: &OpenAIUsage{PromptTokens: 20, CompletionTokens: 10},
 	}
 
-	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514")
+	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -139,7 +139,7 @@ func TestOpenAIResponseToAnthropic_MultipleToolCalls(t *testing.T) {
 		},
 	}
 
-	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514")
+	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -176,7 +176,7 @@ func TestOpenAIResponseToAnthropic_MixedTextAndToolCalls(t *testing.T) {
 		},
 	}
 
-	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514")
+	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -202,6 +202,42 @@ func TestOpenAIResponseToAnthropic_MixedTextAndToolCalls(t *testing.T) {
 	}
 }
 
+func TestOpenAIResponseToAnthropic_ReasoningContent(t *testing.T) {
+	resp := &OpenAIResponse{
+		Choices: []OpenAIChoice{
+			{
+				Message: OpenAIMessage{
+					Role:             "assistant",
+					ReasoningContent: "The user wants a lookup.",
+					ToolCalls: []OpenAIToolCall{
+						{
+							ID:       "call_r1",
+							Type:     "function",
+							Function: OpenAIFunction{Name: "lookup", Arguments: `{}`},
+						},
+					},
+				},
+				FinishReason: strPtr("tool_calls"),
+			},
+		},
+	}
+
+	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.Content) != 2 {
+		t.Fatalf("Content length = %d, want 2", len(result.Content))
+	}
+	if result.Content[0].Type != "thinking" || result.Content[0].Thinking != "The user wants a lookup." {
+		t.Errorf("Content[0] = %+v, want thinking block", result.Content[0])
+	}
+	if result.Content[1].Type != "tool_use" {
+		t.Errorf("Content[1].Type = %q, want %q", result.Content[1].Type, "tool_use")
+	}
+}
+
 func TestOpenAIResponseToAnthropic_FinishReasonMappings(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -227,7 +263,7 @@ func TestOpenAIResponseToAnthropic_FinishReasonMappings(t *testing.T) {
 				},
 			}
 
-			result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514")
+			result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", nil)
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
@@ -253,7 +289,7 @@ func TestOpenAIResponseToAnthropic_UsageTranslation(t *testing.T) {
 		Usage: &OpenAIUsage{PromptTokens: 42, CompletionTokens: 17, TotalTokens: 59},
 	}
 
-	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514")
+	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -287,7 +323,7 @@ func TestOpenAIResponseToAnthropic_UsageTranslationWithCachedTokens(t *testing.T
 		},
 	}
 
-	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514")
+	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -314,7 +350,7 @@ func TestOpenAIResponseToAnthropic_NilUsage(t *testing.T) {
 		Usage: nil,
 	}
 
-	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514")
+	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -332,7 +368,7 @@ func TestOpenAIResponseToAnthropic_EmptyChoices(t *testing.T) {
 		Choices: []OpenAIChoice{},
 	}
 
-	_, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514")
+	_, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", nil)
 	if err == nil {
 		t.Fatal("expected error for empty choices, got nil")
 	}
@@ -360,7 +396,7 @@ func TestOpenAIResponseToAnthropic_InvalidToolCallJSON(t *testing.T) {
 		},
 	}
 
-	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514")
+	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", nil)
 	if err != nil {
 		t.Fatalf("should not error on bad tool call JSON, got: %v", err)
 	}
@@ -398,7 +434,7 @@ func TestOpenAIResponseToAnthropic_NullContentWithToolCalls(t *testing.T) {
 		},
 	}
 
-	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514")
+	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -431,7 +467,7 @@ func TestOpenAIResponseToAnthropic_EmptyContentString(t *testing.T) {
 		},
 	}
 
-	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514")
+	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -464,7 +500,7 @@ func TestOpenAIResponseToAnthropic_EmptyToolCallID(t *testing.T) {
 		},
 	}
 
-	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514")
+	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -498,7 +534,7 @@ func TestOpenAIResponseToAnthropic_MultipleChoicesUsesFirst(t *testing.T) {
 		},
 	}
 
-	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514")
+	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -510,3 +546,107 @@ func TestOpenAIResponseToAnthropic_MultipleChoicesUsesFirst(t *testing.T) {
 		t.Errorf("Content[0].Text = %q, want %q", result.Content[0].Text, "first")
 	}
 }
+
+func TestOpenAIResponseToAnthropic_StopSequence(t *testing.T) {
+	stops := []string{"\n\nHuman:", "STOP"}
+	tests := []struct {
+		name     string
+		content  string
+		reported interface{}
+		text     string
+		sequence string
+	}{
+		{"echoed in text", "Answer.\n\nHuman:", nil, "Answer.", "\n\nHuman:"},
+		{"reported by upstream", "Answer.", "STOP", "Answer.", "STOP"},
+		{"not a request stop", "Answer.", "</s>", "Answer.", ""},
+		{"natural end", "Answer.", nil, "Answer.", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &OpenAIResponse{Choices: []OpenAIChoice{{
+				Message:      OpenAIMessage{Role: "assistant", Content: tt.content},
+				FinishReason: strPtr("stop"),
+				StopReason:   tt.reported,
+			}}}
+			result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", stops)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Content[0].Text != tt.text {
+				t.Errorf("text = %q, want %q", result.Content[0].Text, tt.text)
+			}
+			if tt.sequence == "" {
+				if *result.StopReason != "end_turn" || result.StopSequence != nil {
+					t.Errorf("expected end_turn with no stop_sequence, got %q %v", *result.StopReason, result.StopSequence)
+				}
+				return
+			}
+			if *result.StopReason != "stop_sequence" || result.StopSequence == nil || *result.StopSequence != tt.sequence {
+				t.Errorf("expected stop_sequence %q, got %q %v", tt.sequence, *result.StopReason, result.StopSequence)
+			}
+		})
+	}
+}
+
+func TestOpenAIResponseToAnthropic_Prefill(t *testing.T) {
+	for content, want := range map[string]string{
+		`{"answer": 42}`: `42}`,
+		`42}`:            `42}`,
+	} {
+		resp := &OpenAIResponse{Choices: []OpenAIChoice{{
+			Message:      OpenAIMessage{Role: "assistant", Content: content},
+			FinishReason: strPtr("stop"),
+		}}}
+		result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", `{"answer": `, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(result.Content) != 1 || result.Content[0].Text != want {
+			t.Errorf("content %q: got %+v, want text %q", content, result.Content, want)
+		}
+	}
+}
+
+func TestAnthropicPrefill(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages string
+		want     string
+	}{
+		{"string content", `[{"role":"user","content":"Hi"},{"role":"assistant","content":"{\"a\":"}]`, `{"a":`},
+		{"text blocks", `[{"role":"user","content":"Hi"},{"role":"assistant","content":[{"type":"text","text":"Sure, "},{"type":"text","text":"here"}]}]`, "Sure, here"},
+		{"ends with user", `[{"role":"user","content":"Hi"}]`, ""},
+		{"trailing tool_use", `[{"role":"user","content":"Hi"},{"role":"assistant","content":[{"type":"text","text":"Checking"},{"type":"tool_use","id":"t","name":"f","input":{}}]}]`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req AnthropicRequest
+			if err := json.Unmarshal([]byte(`{"messages":`+tt.messages+`}`), &req); err != nil {
+				t.Fatal(err)
+			}
+			if got := AnthropicPrefill(&req); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenAIResponseToAnthropic_TruncatedToolCallJSON(t *testing.T) {
+	resp := &OpenAIResponse{Choices: []OpenAIChoice{{
+		Message: OpenAIMessage{Role: "assistant", ToolCalls: []OpenAIToolCall{{
+			ID:       "call_1",
+			Type:     "function",
+			Function: OpenAIFunction{Name: "search", Arguments: `{"query": "go generics", "limit": 1`},
+		}}},
+		FinishReason: strPtr("length"),
+	}}}
+
+	result, err := OpenAIResponseToAnthropic(resp, "claude-sonnet-4-20250514", "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(result.Content[0].Input) != `{"query": "go generics", "limit": 1}` {
+		t.Errorf("unexpected repaired input %s", result.Content[0].Input)
+	}
+}
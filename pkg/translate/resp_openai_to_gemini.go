@@ -0,0 +1,95 @@
+package translate
+
+import (
+	"encoding/json"
+
+	"github.com/bytedance/sonic"
+)
+
+// OpenAIResponseToGemini translates an OpenAI chat completion into a Gemini
+// generateContent response. model is used when the response names none.
+func OpenAIResponseToGemini(resp *OpenAIResponse, model string) *GeminiResponse {
+	out := &GeminiResponse{
+		ModelVersion: model,
+		ResponseID:   resp.ID,
+	}
+	if resp.Model != "" {
+		out.ModelVersion = resp.Model
+	}
+
+	cand := GeminiCandidate{Content: GeminiContent{Role: "model", Parts: []GeminiPart{}}}
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		msg := choice.Message
+		if msg.ReasoningContent != "" {
+			cand.Content.Parts = append(cand.Content.Parts, GeminiPart{Text: msg.ReasoningContent, Thought: true})
+		}
+		if text := extractOpenAIMessageText(msg); text != "" {
+			cand.Content.Parts = append(cand.Content.Parts, GeminiPart{Text: text})
+		}
+		for _, tc := range msg.ToolCalls {
+			cand.Content.Parts = append(cand.Content.Parts, GeminiPart{FunctionCall: &GeminiFunctionCall{
+				ID:   tc.ID,
+				Name: tc.Function.Name,
+				Args: geminiArgs(tc.Function.Arguments),
+			}})
+		}
+		if choice.FinishReason != nil {
+			cand.FinishReason = GeminiFinishReason(*choice.FinishReason)
+		}
+	}
+	out.Candidates = []GeminiCandidate{cand}
+	out.UsageMetadata = GeminiUsage(resp.Usage)
+	return out
+}
+
+// GeminiFinishReason maps an OpenAI finish_reason onto a Gemini finishReason.
+// Gemini reports function calls as STOP.
+func GeminiFinishReason(reason string) string {
+	switch reason {
+	case "stop", "tool_calls", "function_call":
+		return "STOP"
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "OTHER"
+	}
+}
+
+// GeminiUsage converts OpenAI usage into Gemini usage metadata, or returns
+// nil when usage is nil. Both count cached tokens as part of the prompt.
+func GeminiUsage(usage *OpenAIUsage) *GeminiUsageMetadata {
+	if usage == nil {
+		return nil
+	}
+	m := &GeminiUsageMetadata{
+		PromptTokenCount:     usage.PromptTokens,
+		CandidatesTokenCount: usage.CompletionTokens,
+		TotalTokenCount:      usage.TotalTokens,
+	}
+	if m.TotalTokenCount == 0 {
+		m.TotalTokenCount = m.PromptTokenCount + m.CandidatesTokenCount
+	}
+	if usage.PromptTokensDetails != nil {
+		m.CachedContentTokenCount = usage.PromptTokensDetails.CachedTokens
+	}
+	return m
+}
+
+// geminiArgs converts OpenAI function arguments, a JSON string, into the
+// object Gemini expects. Arguments cut off mid-value are repaired; anything
+// else unparseable becomes an empty object.
+func geminiArgs(arguments string) json.RawMessage {
+	if arguments == "" {
+		return json.RawMessage("{}")
+	}
+	if sonic.ValidString(arguments) {
+		return json.RawMessage(arguments)
+	}
+	if suffix, ok := repairJSONSuffix(arguments); ok {
+		return json.RawMessage(arguments + suffix)
+	}
+	return json.RawMessage("{}")
+}
@@ -0,0 +1,15 @@
+package translate
+
+// MapRoles rewrites message roles in place according to roles (from → to).
+// Each message is mapped once, so {"developer": "system", "system": "user"}
+// sends developer messages as system, not user.
+func MapRoles(msgs []OpenAIMessage, roles map[string]string) {
+	if len(roles) == 0 {
+		return
+	}
+	for i := range msgs {
+		if to, ok := roles[msgs[i].Role]; ok {
+			msgs[i].Role = to
+		}
+	}
+}
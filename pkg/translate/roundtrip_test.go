@@ -0,0 +1,557 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bytedance/sonic"
+)
+
+// The round-trip tests translate Anthropic requests to OpenAI and back and
+// check that the result means the same thing. rtView reduces a request to
+// what both formats can express, so anything it leaves out is a known loss
+// rather than a bug:
+//
+//   - top_k, cache_control and tool_result is_error have no OpenAI
+//     equivalent
+//   - thinking becomes reasoning_effort, so only whether it is enabled
+//     survives, and max_tokens then includes the budget
+//   - system blocks are joined into one string, tool_result content and
+//     assistant text blocks into one text each
+//   - whitespace-only text, thinking blocks, server tools and block types
+//     other than text, image, tool_use and tool_result are dropped
+
+type rtView struct {
+	Model         string
+	System        string
+	Messages      []rtMessage
+	Tools         []rtTool
+	ToolChoice    rtToolChoice
+	MaxTokens     int // only without thinking
+	Thinking      bool
+	StopSequences []string
+	Temperature   *float64
+	TopP          *float64
+	Stream        bool
+	UserID        string
+}
+
+type rtMessage struct {
+	Role   string
+	Blocks []rtBlock
+}
+
+type rtBlock struct {
+	Type      string
+	Text      string      `json:",omitempty"`
+	Image     string      `json:",omitempty"` // as an OpenAI image_url
+	ID        string      `json:",omitempty"`
+	Name      string      `json:",omitempty"`
+	Input     interface{} `json:",omitempty"`
+	ToolUseID string      `json:",omitempty"`
+}
+
+type rtTool struct {
+	Name        string
+	Description string
+	Schema      interface{}
+}
+
+type rtToolChoice struct {
+	Type            string
+	Name            string
+	DisableParallel bool
+}
+
+// rtDecode decodes numbers as json.Number, so a large integer that lost
+// precision on the way shows up as a difference.
+func rtDecode(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "invalid JSON: " + string(raw)
+	}
+	return v
+}
+
+func viewAnthropicRequest(req *AnthropicRequest) rtView {
+	v := rtView{
+		Model:       req.Model,
+		Thinking:    req.Thinking != nil && req.Thinking.Type == "enabled",
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stream:      req.Stream,
+	}
+	if !v.Thinking {
+		v.MaxTokens = req.MaxTokens
+	}
+	if len(req.StopSequences) > 0 {
+		v.StopSequences = req.StopSequences
+	}
+	if req.Metadata != nil {
+		v.UserID = req.Metadata.UserID
+	}
+
+	if len(req.System) > 0 {
+		var s string
+		if sonic.Unmarshal(req.System, &s) == nil {
+			v.System = s
+		} else {
+			var blocks []SystemBlock
+			_ = sonic.Unmarshal(req.System, &blocks)
+			var parts []string
+			for _, b := range blocks {
+				if b.Text != "" {
+					parts = append(parts, b.Text)
+				}
+			}
+			v.System = strings.Join(parts, "\n\n")
+		}
+	}
+
+	for _, t := range req.Tools {
+		if t.Type != "" && t.Type != "custom" {
+			continue
+		}
+		schema, _ := AnthropicToolSchema(t.InputSchema)
+		v.Tools = append(v.Tools, rtTool{Name: t.Name, Description: t.Description, Schema: rtDecode(schema)})
+	}
+	v.ToolChoice = viewToolChoice(req.ToolChoice)
+
+	for _, m := range req.Messages {
+		var blocks []rtBlock
+		if s, ok := m.ContentAsString(); ok {
+			if strings.TrimSpace(s) != "" {
+				blocks = append(blocks, rtBlock{Type: "text", Text: s})
+			}
+		} else {
+			cbs, _ := m.ContentAsBlocks()
+			if m.Role == "assistant" {
+				blocks = viewAssistantBlocks(cbs)
+			} else {
+				blocks = viewUserBlocks(cbs)
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		// Anthropic merges consecutive user messages, and tool results
+		// come back from OpenAI as user messages of their own.
+		if n := len(v.Messages); m.Role == "user" && n > 0 && v.Messages[n-1].Role == "user" {
+			v.Messages[n-1].Blocks = append(v.Messages[n-1].Blocks, blocks...)
+			continue
+		}
+		v.Messages = append(v.Messages, rtMessage{Role: m.Role, Blocks: blocks})
+	}
+	return v
+}
+
+func viewUserBlocks(cbs []ContentBlock) []rtBlock {
+	var blocks []rtBlock
+	for _, b := range cbs {
+		switch b.Type {
+		case "text":
+			if strings.TrimSpace(b.Text) != "" {
+				blocks = append(blocks, rtBlock{Type: "text", Text: b.Text})
+			}
+		case "image":
+			part, err := translateImageBlock(b)
+			if err == nil {
+				blocks = append(blocks, rtBlock{Type: "image", Image: part.ImageURL.URL})
+			}
+		case "tool_result":
+			content, _ := toolResultContent(b.Content)
+			text, _ := content.(string)
+			blocks = append(blocks, rtBlock{Type: "tool_result", ToolUseID: b.ToolUseID, Text: text})
+		}
+	}
+	return blocks
+}
+
+func viewAssistantBlocks(cbs []ContentBlock) []rtBlock {
+	var text strings.Builder
+	var toolUses []rtBlock
+	for _, b := range cbs {
+		switch b.Type {
+		case "text":
+			if strings.TrimSpace(b.Text) != "" {
+				text.WriteString(b.Text)
+			}
+		case "tool_use":
+			input := rtDecode(b.Input)
+			if input == nil && len(b.Input) == 0 {
+				input = map[string]interface{}{}
+			}
+			toolUses = append(toolUses, rtBlock{Type: "tool_use", ID: b.ID, Name: b.Name, Input: input})
+		}
+	}
+	var blocks []rtBlock
+	if text.Len() > 0 {
+		blocks = append(blocks, rtBlock{Type: "text", Text: text.String()})
+	}
+	return append(blocks, toolUses...)
+}
+
+func viewToolChoice(raw json.RawMessage) rtToolChoice {
+	if len(raw) == 0 {
+		return rtToolChoice{}
+	}
+	var s string
+	if sonic.Unmarshal(raw, &s) == nil {
+		return rtToolChoice{Type: s}
+	}
+	var obj ToolChoiceObj
+	_ = sonic.Unmarshal(raw, &obj)
+	v := rtToolChoice{Type: obj.Type, DisableParallel: obj.DisableParallelToolUse && obj.Type != "none"}
+	if obj.Type == "tool" {
+		v.Name = obj.Name
+	}
+	return v
+}
+
+// roundTripAnthropic translates req to OpenAI and back. The OpenAI request
+// goes through its wire format in between, as it does in the proxy.
+func roundTripAnthropic(req *AnthropicRequest) (*OpenAIRequest, *AnthropicRequest, error) {
+	oai, err := AnthropicRequestToOpenAI(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := sonic.Marshal(oai)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal OpenAI request: %w", err)
+	}
+	var wire OpenAIRequest
+	if err := sonic.Unmarshal(body, &wire); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal OpenAI request: %w", err)
+	}
+	back, err := OpenAIRequestToAnthropic(&wire)
+	if err != nil {
+		return &wire, nil, fmt.Errorf("translate back: %w", err)
+	}
+	return &wire, back, nil
+}
+
+func checkRoundTrip(t *testing.T, req *AnthropicRequest) {
+	t.Helper()
+	oai, back, err := roundTripAnthropic(req)
+	if err != nil {
+		t.Fatalf("round trip: %v", err)
+	}
+	want, got := viewAnthropicRequest(req), viewAnthropicRequest(back)
+	if !reflect.DeepEqual(want, got) {
+		w, _ := json.MarshalIndent(want, "", "  ")
+		g, _ := json.MarshalIndent(got, "", "  ")
+		o, _ := json.Marshal(oai)
+		t.Fatalf("round trip changed the request\nwant: %s\n got: %s\nopenai: %s", w, g, o)
+	}
+}
+
+// roundTrippable reports whether req is a request the translators are
+// expected to carry over: one the Anthropic API would accept, without an
+// allowed_tools choice (which prunes the tools on purpose).
+func roundTrippable(req *AnthropicRequest) bool {
+	if req.MaxTokens <= 0 || parseAllowedToolsRaw(req.ToolChoice) != nil {
+		return false
+	}
+	if len(req.ToolChoice) > 0 {
+		switch viewToolChoice(req.ToolChoice).Type {
+		case "auto", "any", "tool", "none":
+		default:
+			return false
+		}
+	}
+	for _, m := range req.Messages {
+		blocks, err := m.ContentAsBlocks()
+		if err != nil {
+			continue
+		}
+		// Tool results must lead a user message.
+		seenOther := false
+		for _, b := range blocks {
+			if b.Type != "tool_result" {
+				seenOther = true
+			} else if seenOther {
+				return false
+			}
+		}
+	}
+	_, err := AnthropicRequestToOpenAI(req)
+	return err == nil
+}
+
+func loadRoundTripCorpus(tb testing.TB) map[string][]byte {
+	tb.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", "roundtrip", "*.json"))
+	if err != nil || len(paths) == 0 {
+		tb.Fatalf("no round-trip corpus: %v", err)
+	}
+	corpus := make(map[string][]byte, len(paths))
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		corpus[filepath.Base(p)] = b
+	}
+	return corpus
+}
+
+func TestAnthropicRoundTripCorpus(t *testing.T) {
+	for name, body := range loadRoundTripCorpus(t) {
+		t.Run(name, func(t *testing.T) {
+			var req AnthropicRequest
+			if err := sonic.Unmarshal(body, &req); err != nil {
+				t.Fatal(err)
+			}
+			if !roundTrippable(&req) {
+				t.Fatal("corpus request is outside the round-trippable subset")
+			}
+			checkRoundTrip(t, &req)
+		})
+	}
+}
+
+// FuzzAnthropicRoundTrip mutates real request shapes from the corpus.
+//
+//	go test ./pkg/translate -run '^$' -fuzz FuzzAnthropicRoundTrip$
+func FuzzAnthropicRoundTrip(f *testing.F) {
+	for _, body := range loadRoundTripCorpus(f) {
+		f.Add(body)
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		var req AnthropicRequest
+		if sonic.Unmarshal(body, &req) != nil || !roundTrippable(&req) {
+			t.Skip()
+		}
+		checkRoundTrip(t, &req)
+	})
+}
+
+// FuzzAnthropicRoundTripGenerated builds valid requests from the fuzzer's
+// bytes, covering combinations the corpus does not.
+//
+//	go test ./pkg/translate -run '^$' -fuzz FuzzAnthropicRoundTripGenerated
+func FuzzAnthropicRoundTripGenerated(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte("\x02\x01\x03\x02\x01\x01\x04\x05\x01\x02\x03\x00\x01\x02"))
+	f.Add([]byte("tool use with results and images, streamed"))
+	f.Add([]byte{0xff, 0x7f, 0x03, 0x02, 0x02, 0x01, 0x05, 0x03, 0x01, 0x01, 0x01, 0x02, 0x04, 0x09, 0x11})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		src := fuzzSource(data)
+		req := generateAnthropicRequest(&src)
+		if !roundTrippable(req) {
+			b, _ := json.Marshal(req)
+			t.Fatalf("generated an invalid request: %s", b)
+		}
+		checkRoundTrip(t, req)
+	})
+}
+
+// fuzzSource turns fuzzer bytes into choices. Once exhausted it keeps
+// returning 0, so every input yields a request.
+type fuzzSource []byte
+
+func (s *fuzzSource) next() int {
+	if len(*s) == 0 {
+		return 0
+	}
+	b := (*s)[0]
+	*s = (*s)[1:]
+	return int(b)
+}
+
+func (s *fuzzSource) intn(n int) int { return s.next() % n }
+
+var fuzzWords = []string{
+	"the", "tests", "fail", "go test ./...", "ünïcødé", "日本語", `"quoted"`,
+	"<b>tag</b> & more", "line\nbreak", "tab\there", `back\slash`, "🚀",
+	" ", `{"json": 1}`, "a;base64,b", " ", "end.",
+}
+
+func (s *fuzzSource) text() string {
+	words := make([]string, 1+s.intn(6))
+	for i := range words {
+		words[i] = fuzzWords[s.intn(len(fuzzWords))]
+	}
+	return strings.Join(words, " ")
+}
+
+// value returns a JSON value for tool input, nesting at most depth deep.
+func (s *fuzzSource) value(depth int) interface{} {
+	switch s.intn(7) {
+	case 0:
+		return s.text()
+	case 1:
+		return s.next() - 128
+	case 2:
+		// Past float64's exact integer range.
+		return json.Number(fmt.Sprintf("90071992547409%d", 90+s.intn(10)))
+	case 3:
+		return s.intn(2) == 0
+	case 4:
+		return nil
+	case 5:
+		if depth > 0 {
+			arr := make([]interface{}, s.intn(4))
+			for i := range arr {
+				arr[i] = s.value(depth - 1)
+			}
+			return arr
+		}
+		return json.Number("1.5")
+	default:
+		if depth > 0 {
+			return s.object(depth - 1)
+		}
+		return ""
+	}
+}
+
+func (s *fuzzSource) object(depth int) map[string]interface{} {
+	obj := make(map[string]interface{})
+	for i := s.intn(4); i > 0; i-- {
+		obj[fmt.Sprintf("k%d", s.intn(6))] = s.value(depth)
+	}
+	return obj
+}
+
+func generateAnthropicRequest(s *fuzzSource) *AnthropicRequest {
+	req := &AnthropicRequest{
+		Model:     "claude-sonnet-4-5",
+		MaxTokens: 1 + s.next()*64,
+		Stream:    s.intn(2) == 1,
+	}
+
+	switch s.intn(3) {
+	case 1:
+		req.System = mustJSON(s.text())
+	case 2:
+		blocks := make([]SystemBlock, 1+s.intn(3))
+		for i := range blocks {
+			blocks[i] = SystemBlock{Type: "text", Text: s.text()}
+			if s.intn(2) == 1 {
+				blocks[i].CacheControl = &CacheControl{Type: "ephemeral"}
+			}
+		}
+		req.System = mustJSON(blocks)
+	}
+
+	for i := s.intn(4); i > 0; i-- {
+		props := make(map[string]interface{})
+		var required []string
+		for j := s.intn(4); j > 0; j-- {
+			name := fmt.Sprintf("p%d", j)
+			props[name] = map[string]interface{}{"type": []string{"string", "integer", "boolean", "array"}[s.intn(4)]}
+			if s.intn(2) == 1 {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]interface{}{"type": "object", "properties": props}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		tool := AnthropicTool{Name: fmt.Sprintf("tool_%d", i), InputSchema: mustJSON(schema)}
+		if s.intn(2) == 1 {
+			tool.Description = s.text()
+		}
+		req.Tools = append(req.Tools, tool)
+	}
+
+	if choice := s.intn(6); choice > 0 {
+		obj := ToolChoiceObj{Type: []string{"auto", "any", "tool", "none", "auto"}[choice-1]}
+		if obj.Type == "tool" {
+			obj.Name = fmt.Sprintf("tool_%d", 1+s.intn(3))
+		}
+		obj.DisableParallelToolUse = obj.Type != "none" && s.intn(2) == 1
+		req.ToolChoice = mustJSON(obj)
+	}
+
+	if s.intn(2) == 1 {
+		temp := float64(s.intn(21)) / 10
+		req.Temperature = &temp
+	}
+	if s.intn(2) == 1 {
+		topP := float64(1+s.intn(100)) / 100
+		req.TopP = &topP
+	}
+	if s.intn(3) == 0 {
+		topK := 1 + s.intn(100)
+		req.TopK = &topK
+	}
+	for i := s.intn(3); i > 0; i-- {
+		req.StopSequences = append(req.StopSequences, s.text())
+	}
+	if s.intn(4) == 0 {
+		req.Thinking = &ThinkingConfig{Type: "enabled", BudgetTokens: 1024 * s.intn(16)}
+	}
+	if s.intn(3) == 0 {
+		req.Metadata = &Metadata{UserID: fmt.Sprintf("user_%d", s.next())}
+	}
+
+	var pending []string // tool_use IDs the next user message answers
+	for turn, turns := 0, 1+s.intn(6); turn < turns; turn++ {
+		var blocks []ContentBlock
+		for _, id := range pending {
+			b := ContentBlock{Type: "tool_result", ToolUseID: id}
+			switch s.intn(3) {
+			case 0:
+				b.Content = mustJSON(s.text())
+			case 1:
+				b.Content = mustJSON([]ContentBlock{{Type: "text", Text: s.text()}, {Type: "text", Text: s.text()}})
+			}
+			blocks = append(blocks, b)
+		}
+		pending = nil
+		for i := s.intn(3); i > 0 || len(blocks) == 0; i-- {
+			switch s.intn(4) {
+			case 0:
+				blocks = append(blocks, ContentBlock{Type: "image", Source: &ImageSource{Type: "base64", MediaType: "image/png", Data: "iVBORw0KGgo" + strings.Repeat("A", s.intn(8))}})
+			case 1:
+				blocks = append(blocks, ContentBlock{Type: "image", Source: &ImageSource{Type: "url", URL: fmt.Sprintf("https://example.com/%d.jpg", s.next())}})
+			default:
+				blocks = append(blocks, ContentBlock{Type: "text", Text: s.text()})
+			}
+		}
+		if len(blocks) == 1 && blocks[0].Type == "text" && s.intn(2) == 1 {
+			req.Messages = append(req.Messages, AnthropicMessage{Role: "user", Content: mustJSON(blocks[0].Text)})
+		} else {
+			req.Messages = append(req.Messages, AnthropicMessage{Role: "user", Content: mustJSON(blocks)})
+		}
+		if turn == turns-1 {
+			break
+		}
+
+		blocks = nil
+		for i := s.intn(3); i > 0; i-- {
+			blocks = append(blocks, ContentBlock{Type: "text", Text: s.text()})
+		}
+		if len(req.Tools) > 0 {
+			for i := s.intn(4); i > 0; i-- {
+				id := fmt.Sprintf("toolu_%d_%d", turn, i)
+				blocks = append(blocks, ContentBlock{
+					Type:  "tool_use",
+					ID:    id,
+					Name:  req.Tools[s.intn(len(req.Tools))].Name,
+					Input: mustJSON(s.object(2)),
+				})
+				pending = append(pending, id)
+			}
+		}
+		if len(blocks) == 0 {
+			req.Messages = append(req.Messages, AnthropicMessage{Role: "assistant", Content: mustJSON(s.text())})
+		} else {
+			req.Messages = append(req.Messages, AnthropicMessage{Role: "assistant", Content: mustJSON(blocks)})
+		}
+	}
+	return req
+}
@@ -0,0 +1,275 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// emptyObjectSchema is sent for tools declared without parameters; Anthropic
+// requires input_schema to be present.
+var emptyObjectSchema = json.RawMessage(`{"type":"object","properties":{}}`)
+
+// maxRefDepth bounds $ref inlining so deeply nested (but not recursive)
+// definitions cannot blow up the schema.
+const maxRefDepth = 16
+
+// AnthropicToolSchema rewrites an OpenAI function parameters schema into the
+// subset Anthropic accepts for input_schema. OpenAI strict-mode schemas
+// commonly use $ref/$defs and top-level combinators, which Anthropic rejects
+// with an opaque 400, so:
+//
+//   - $ref to #/$defs/... or #/definitions/... is inlined and the definitions
+//     are dropped; recursive references become a plain object
+//   - top-level allOf is merged, and top-level anyOf/oneOf is flattened into
+//     one object whose required fields are those common to every variant
+//   - the root is forced to "type": "object"
+//
+// It returns the schema unchanged (same bytes) when nothing needed rewriting,
+// plus a human-readable description of each change for logging.
+func AnthropicToolSchema(params json.RawMessage) (json.RawMessage, []string) {
+	trimmed := bytes.TrimSpace(params)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return emptyObjectSchema, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	dec.UseNumber() // keep integer bounds exact
+	var root map[string]interface{}
+	if err := dec.Decode(&root); err != nil {
+		return params, nil // not an object; let the upstream report it
+	}
+
+	t := &schemaRewriter{defs: map[string]interface{}{}}
+	for _, key := range []string{"$defs", "definitions"} {
+		if defs, ok := root[key].(map[string]interface{}); ok {
+			for name, def := range defs {
+				t.defs[key+"/"+name] = def
+			}
+			delete(root, key)
+			t.note("removed %s", key)
+		}
+	}
+
+	resolved, ok := t.resolve(root, "", nil).(map[string]interface{})
+	if !ok {
+		return params, nil
+	}
+	root = resolved
+	t.flattenRoot(root)
+
+	if len(t.changes) == 0 {
+		return params, nil
+	}
+	sort.Strings(t.changes)
+	out, err := json.Marshal(root)
+	if err != nil {
+		return params, nil
+	}
+	return out, t.changes
+}
+
+type schemaRewriter struct {
+	defs    map[string]interface{}
+	changes []string
+}
+
+func (t *schemaRewriter) note(format string, args ...interface{}) {
+	t.changes = append(t.changes, fmt.Sprintf(format, args...))
+}
+
+// resolve walks node, inlining local $refs. stack holds the definitions
+// being expanded on the current path to detect recursion.
+func (t *schemaRewriter) resolve(node interface{}, path string, stack []string) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := n["$ref"].(string); ok {
+			return t.inline(n, ref, path, stack)
+		}
+		for k, v := range n {
+			n[k] = t.resolve(v, path+"/"+k, stack)
+		}
+		return n
+	case []interface{}:
+		for i, v := range n {
+			n[i] = t.resolve(v, fmt.Sprintf("%s/%d", path, i), stack)
+		}
+		return n
+	default:
+		return node
+	}
+}
+
+func (t *schemaRewriter) inline(n map[string]interface{}, ref, path string, stack []string) interface{} {
+	at := path
+	if at == "" {
+		at = "/"
+	}
+
+	name := strings.TrimPrefix(ref, "#/")
+	recursive := ref == "#" // the root always refers back to itself
+	for _, s := range stack {
+		recursive = recursive || s == name
+	}
+	if recursive {
+		delete(n, "$ref")
+		if _, ok := n["type"]; !ok {
+			n["type"] = "object"
+		}
+		t.note("replaced recursive $ref %q at %s with an object", ref, at)
+		return n
+	}
+	def, ok := t.defs[name]
+	if !ok {
+		delete(n, "$ref")
+		t.note("dropped unresolvable $ref %q at %s", ref, at)
+		return t.resolve(n, path, stack)
+	}
+	if len(stack) >= maxRefDepth {
+		delete(n, "$ref")
+		t.note("stopped inlining $ref %q at %s: nesting too deep", ref, at)
+		return n
+	}
+
+	// Copy the definition so each use site is rewritten independently, and
+	// let sibling keywords (typically description) override it.
+	merged := deepCopy(def)
+	if m, ok := merged.(map[string]interface{}); ok {
+		for k, v := range n {
+			if k != "$ref" {
+				m[k] = v
+			}
+		}
+	}
+	t.note("inlined $ref %q at %s", ref, at)
+	return t.resolve(merged, path, append(stack, name))
+}
+
+// flattenRoot removes top-level combinators and ensures an object root.
+func (t *schemaRewriter) flattenRoot(root map[string]interface{}) {
+	if all, ok := root["allOf"].([]interface{}); ok {
+		delete(root, "allOf")
+		required := stringSet(root["required"])
+		for _, sub := range all {
+			if m, ok := sub.(map[string]interface{}); ok {
+				mergeProperties(root, m)
+				for name := range stringSet(m["required"]) {
+					required[name] = true
+				}
+			}
+		}
+		setRequired(root, required)
+		t.note("merged top-level allOf")
+	}
+
+	for _, key := range []string{"anyOf", "oneOf"} {
+		variants, ok := root[key].([]interface{})
+		if !ok {
+			continue
+		}
+		delete(root, key)
+		var common map[string]bool
+		for _, sub := range variants {
+			m, ok := sub.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			mergeProperties(root, m)
+			req := stringSet(m["required"])
+			if common == nil {
+				common = req
+				continue
+			}
+			for name := range common {
+				if !req[name] {
+					delete(common, name)
+				}
+			}
+		}
+		required := stringSet(root["required"])
+		for name := range common {
+			required[name] = true
+		}
+		setRequired(root, required)
+		t.note("flattened top-level %s into a single object", key)
+	}
+
+	if typ, _ := root["type"].(string); typ != "object" {
+		if typ == "" {
+			t.note("set top-level type to object")
+		} else {
+			t.note("changed top-level type %q to object", typ)
+		}
+		root["type"] = "object"
+	}
+	if _, ok := root["properties"]; !ok {
+		root["properties"] = map[string]interface{}{}
+	}
+}
+
+// mergeProperties copies src's properties into dst; existing ones win.
+func mergeProperties(dst, src map[string]interface{}) {
+	srcProps, ok := src["properties"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	dstProps, ok := dst["properties"].(map[string]interface{})
+	if !ok {
+		dstProps = map[string]interface{}{}
+		dst["properties"] = dstProps
+	}
+	for k, v := range srcProps {
+		if _, exists := dstProps[k]; !exists {
+			dstProps[k] = v
+		}
+	}
+}
+
+func stringSet(v interface{}) map[string]bool {
+	set := map[string]bool{}
+	list, _ := v.([]interface{})
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			set[s] = true
+		}
+	}
+	return set
+}
+
+func setRequired(schema map[string]interface{}, names map[string]bool) {
+	if len(names) == 0 {
+		delete(schema, "required")
+		return
+	}
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	out := make([]interface{}, len(list))
+	for i, name := range list {
+		out[i] = name
+	}
+	schema["required"] = out
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch n := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(n))
+		for k, val := range n {
+			m[k] = deepCopy(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(n))
+		for i, val := range n {
+			s[i] = deepCopy(val)
+		}
+		return s
+	default:
+		return v
+	}
+}
@@ -0,0 +1,139 @@
+package translate
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicToolSchema(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          string
+		want        string // compared as JSON; empty means unchanged bytes
+		wantChanges []string
+	}{
+		{
+			name: "empty parameters",
+			in:   ``,
+			want: `{"type":"object","properties":{}}`,
+		},
+		{
+			name: "null parameters",
+			in:   `null`,
+			want: `{"type":"object","properties":{}}`,
+		},
+		{
+			name: "supported schema untouched",
+			in:   `{"type":"object","properties":{"q":{"type":["string","null"]}},"required":["q"],"additionalProperties":false}`,
+		},
+		{
+			name: "defs inlined",
+			in: `{"type":"object","additionalProperties":false,"required":["to","cc"],
+				"properties":{"to":{"$ref":"#/$defs/Addr","description":"recipient"},"cc":{"type":"array","items":{"$ref":"#/$defs/Addr"}}},
+				"$defs":{"Addr":{"type":"object","properties":{"email":{"type":"string"}},"required":["email"],"additionalProperties":false}}}`,
+			want: `{"type":"object","additionalProperties":false,"required":["to","cc"],
+				"properties":{
+					"to":{"type":"object","properties":{"email":{"type":"string"}},"required":["email"],"additionalProperties":false,"description":"recipient"},
+					"cc":{"type":"array","items":{"type":"object","properties":{"email":{"type":"string"}},"required":["email"],"additionalProperties":false}}}}`,
+			wantChanges: []string{
+				`inlined $ref "#/$defs/Addr" at /properties/cc/items`,
+				`inlined $ref "#/$defs/Addr" at /properties/to`,
+				`removed $defs`,
+			},
+		},
+		{
+			name: "recursive ref",
+			in: `{"type":"object","properties":{"root":{"$ref":"#/definitions/Node"}},
+				"definitions":{"Node":{"type":"object","properties":{"children":{"type":"array","items":{"$ref":"#/definitions/Node"}}}}}}`,
+			want: `{"type":"object","properties":{"root":{"type":"object","properties":{"children":{"type":"array","items":{"type":"object"}}}}}}`,
+			wantChanges: []string{
+				`inlined $ref "#/definitions/Node" at /properties/root`,
+				`removed definitions`,
+				`replaced recursive $ref "#/definitions/Node" at /properties/root/properties/children/items with an object`,
+			},
+		},
+		{
+			name: "top-level anyOf",
+			in: `{"anyOf":[
+				{"type":"object","properties":{"id":{"type":"string"},"name":{"type":"string"}},"required":["id","name"]},
+				{"type":"object","properties":{"id":{"type":"string"},"email":{"type":"string"}},"required":["id"]}]}`,
+			want: `{"type":"object","properties":{"id":{"type":"string"},"name":{"type":"string"},"email":{"type":"string"}},"required":["id"]}`,
+			wantChanges: []string{
+				`flattened top-level anyOf into a single object`,
+				`set top-level type to object`,
+			},
+		},
+		{
+			name: "top-level allOf",
+			in:   `{"type":"object","allOf":[{"properties":{"a":{"type":"integer"}},"required":["a"]},{"properties":{"b":{"type":"integer"}},"required":["b"]}]}`,
+			want: `{"type":"object","properties":{"a":{"type":"integer"},"b":{"type":"integer"}},"required":["a","b"]}`,
+			wantChanges: []string{
+				`merged top-level allOf`,
+			},
+		},
+		{
+			name:        "large integers kept exact",
+			in:          `{"properties":{"n":{"type":"integer","maximum":9007199254740993}}}`,
+			want:        `{"type":"object","properties":{"n":{"type":"integer","maximum":9007199254740993}}}`,
+			wantChanges: []string{`set top-level type to object`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, changes := AnthropicToolSchema(json.RawMessage(tt.in))
+			if tt.want == "" {
+				if string(out) != tt.in {
+					t.Errorf("schema rewritten to %s, want unchanged", out)
+				}
+			} else if !jsonEqual(t, string(out), tt.want) {
+				t.Errorf("schema = %s\nwant     %s", out, tt.want)
+			}
+			if strings.Contains(tt.in, "9007199254740993") && !strings.Contains(string(out), "9007199254740993") {
+				t.Errorf("integer lost precision: %s", out)
+			}
+			if strings.Join(changes, "\n") != strings.Join(tt.wantChanges, "\n") {
+				t.Errorf("changes = %q, want %q", changes, tt.wantChanges)
+			}
+		})
+	}
+}
+
+func TestOpenAIRequestToAnthropicRecordsSchemaChanges(t *testing.T) {
+	req := &OpenAIRequest{
+		Model:    "claude-sonnet-4",
+		Messages: []OpenAIMessage{{Role: "user", Content: "hi"}},
+		Tools: []OpenAITool{
+			{Type: "function", Function: OpenAIFunctionDef{Name: "noop"}},
+			{Type: "function", Function: OpenAIFunctionDef{Name: "lookup", Parameters: json.RawMessage(`{"properties":{"id":{"type":"string"}}}`)}},
+		},
+	}
+	out, err := OpenAIRequestToAnthropic(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(out.Tools[0].InputSchema); got != `{"type":"object","properties":{}}` {
+		t.Errorf("noop input_schema = %s", got)
+	}
+	if len(out.SchemaChanges) != 1 || out.SchemaChanges[0] != "lookup: set top-level type to object" {
+		t.Errorf("SchemaChanges = %q", out.SchemaChanges)
+	}
+	if b, _ := json.Marshal(out); strings.Contains(string(b), "SchemaChanges") {
+		t.Errorf("SchemaChanges leaked into the request body: %s", b)
+	}
+}
+
+func jsonEqual(t *testing.T, a, b string) bool {
+	t.Helper()
+	var va, vb interface{}
+	if err := json.Unmarshal([]byte(a), &va); err != nil {
+		t.Fatalf("invalid JSON %s: %v", a, err)
+	}
+	if err := json.Unmarshal([]byte(b), &vb); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return string(ja) == string(jb)
+}
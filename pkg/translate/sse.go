@@ -0,0 +1,112 @@
+package translate
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/bytedance/sonic"
+)
+
+// DefaultMaxSSEFrameSize is the longest upstream SSE line accepted when no
+// limit is configured. A single event carrying a base64 image delta can run
+// to several megabytes.
+const DefaultMaxSSEFrameSize = 8 << 20
+
+// ErrSSEFrameTooLarge is returned by the stream readers when an upstream
+// line exceeds the frame limit. The client has already been sent an error
+// event.
+var ErrSSEFrameTooLarge = errors.New("upstream SSE event exceeds the maximum frame size")
+
+// ErrUpstreamStall is returned by an upstream body that went quiet for
+// longer than its idle timeout and was closed.
+var ErrUpstreamStall = errors.New("upstream stream stalled")
+
+// NewSSEScanner returns a line scanner for an upstream SSE stream that
+// accepts lines up to maxFrame bytes, or DefaultMaxSSEFrameSize when
+// maxFrame is not positive. Every stream reader uses it so the limit is the
+// same whichever path a response takes.
+func NewSSEScanner(r io.Reader, maxFrame int) *bufio.Scanner {
+	if maxFrame <= 0 {
+		maxFrame = DefaultMaxSSEFrameSize
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, min(64*1024, maxFrame)), maxFrame)
+	return scanner
+}
+
+// IsSSEFrameTooLarge reports whether a scanner error means a line was over
+// the frame limit.
+func IsSSEFrameTooLarge(err error) bool {
+	return errors.Is(err, bufio.ErrTooLong) || errors.Is(err, ErrSSEFrameTooLarge)
+}
+
+// frameTooLargeMessage is the error message sent to the client when an
+// upstream event is dropped.
+func frameTooLargeMessage(maxFrame int) string {
+	if maxFrame <= 0 {
+		maxFrame = DefaultMaxSSEFrameSize
+	}
+	return fmt.Sprintf("upstream stream event exceeded the %d-byte frame limit; the response is incomplete", maxFrame)
+}
+
+// StreamErrorMessage returns the message sent to the client when reading
+// an upstream stream fails with err: an oversized event or a stalled
+// upstream. ok is false for other errors, which end the stream without an
+// error event.
+func StreamErrorMessage(err error, maxFrame int) (msg string, ok bool) {
+	switch {
+	case IsSSEFrameTooLarge(err):
+		return frameTooLargeMessage(maxFrame), true
+	case errors.Is(err, ErrUpstreamStall):
+		return "upstream stopped sending data; the response is incomplete", true
+	}
+	return "", false
+}
+
+// WriteAnthropicStreamError ends an Anthropic-format stream with an error
+// event. The leading blank line terminates any event whose first lines
+// were already forwarded.
+func WriteAnthropicStreamError(w http.ResponseWriter, flusher http.Flusher, msg string) error {
+	data, err := sonic.Marshal(AnthropicErrorResponse{
+		Type:  "error",
+		Error: AnthropicError{Type: "api_error", Message: msg},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "\nevent: error\ndata: %s\n\n", data); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
+
+// WriteOpenAIStreamError ends an OpenAI Chat Completions stream with an
+// error chunk.
+func WriteOpenAIStreamError(w http.ResponseWriter, flusher http.Flusher, msg string) error {
+	data, err := sonic.Marshal(OpenAIErrorResponse{
+		Error: OpenAIError{Type: "server_error", Message: msg},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "\ndata: %s\n\n", data); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
+
+// writeResponsesStreamError ends a Responses API stream with an error
+// event.
+func writeResponsesStreamError(w http.ResponseWriter, flusher http.Flusher, msg string) error {
+	return writeResponsesSSE(w, flusher, "error", map[string]interface{}{
+		"type":    "error",
+		"code":    "server_error",
+		"message": msg,
+		"param":   nil,
+	})
+}
@@ -0,0 +1,99 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// oversizedStream returns an SSE stream with one normal line followed by a
+// data line longer than limit.
+func oversizedStream(first string, limit int) io.ReadCloser {
+	huge := `data: {"pad":"` + strings.Repeat("A", limit) + `"}`
+	return io.NopCloser(strings.NewReader(first + "\n\n" + huge + "\n\n"))
+}
+
+func TestNewSSEScannerLimit(t *testing.T) {
+	line := strings.Repeat("x", 100*1024)
+
+	s := NewSSEScanner(strings.NewReader(line+"\n"), 0)
+	if !s.Scan() || len(s.Bytes()) != len(line) {
+		t.Fatalf("default limit rejected a 100 KiB line: %v", s.Err())
+	}
+
+	s = NewSSEScanner(strings.NewReader(line+"\n"), 64*1024)
+	if s.Scan() {
+		t.Fatal("expected the line to exceed a 64 KiB limit")
+	}
+	if !IsSSEFrameTooLarge(s.Err()) {
+		t.Fatalf("expected frame-too-large error, got %v", s.Err())
+	}
+}
+
+func TestOpenAIToAnthropicStreamFrameTooLarge(t *testing.T) {
+	first := `data: {"id":"c1","choices":[{"index":0,"delta":{"content":"Hi"}}]}`
+	rec := httptest.NewRecorder()
+	_, err := TranslateOpenAIStreamToAnthropic(context.Background(), oversizedStream(first, 1024), rec, &mockFlusher{rec}, "claude-opus-4-6", 0, false, "", nil, 1024)
+	if !errors.Is(err, ErrSSEFrameTooLarge) {
+		t.Fatalf("expected ErrSSEFrameTooLarge, got %v", err)
+	}
+
+	events := parseSSEEvents(rec.Body.String())
+	last := events[len(events)-1]
+	if last.Type != "error" {
+		t.Fatalf("expected stream to end with an error event, got %q", last.Type)
+	}
+	for _, e := range events {
+		if e.Type == "message_stop" {
+			t.Fatal("truncated stream must not be reported as complete")
+		}
+	}
+	var body AnthropicErrorResponse
+	mustUnmarshal(t, last.Data, &body)
+	if body.Error.Type != "api_error" || !strings.Contains(body.Error.Message, "1024-byte") {
+		t.Fatalf("unexpected error event: %+v", body)
+	}
+}
+
+func TestAnthropicToOpenAIStreamFrameTooLarge(t *testing.T) {
+	first := "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"model\":\"claude\",\"usage\":{\"input_tokens\":3}}}"
+	rec := httptest.NewRecorder()
+	_, err := TranslateAnthropicStreamToOpenAI(context.Background(), oversizedStream(first, 1024), rec, &mockFlusher{rec}, "claude", 1024)
+	if !errors.Is(err, ErrSSEFrameTooLarge) {
+		t.Fatalf("expected ErrSSEFrameTooLarge, got %v", err)
+	}
+
+	out := rec.Body.String()
+	if strings.Contains(out, "[DONE]") {
+		t.Fatal("truncated stream must not end with [DONE]")
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	var body OpenAIErrorResponse
+	mustUnmarshal(t, strings.TrimPrefix(lines[len(lines)-1], "data: "), &body)
+	if body.Error.Type != "server_error" || body.Error.Message == "" {
+		t.Fatalf("unexpected error chunk: %+v", body)
+	}
+}
+
+func TestChatToResponsesStreamFrameTooLarge(t *testing.T) {
+	first := `data: {"id":"c1","choices":[{"index":0,"delta":{"content":"Hi"}}]}`
+	rec := httptest.NewRecorder()
+	_, err := TranslateChatStreamToResponses(context.Background(), oversizedStream(first, 1024), rec, &mockFlusher{rec}, "gpt-4o", 1024)
+	if !errors.Is(err, ErrSSEFrameTooLarge) {
+		t.Fatalf("expected ErrSSEFrameTooLarge, got %v", err)
+	}
+
+	events := parseSSEEvents(rec.Body.String())
+	last := events[len(events)-1]
+	if last.Type != "error" {
+		t.Fatalf("expected stream to end with an error event, got %q", last.Type)
+	}
+	for _, e := range events {
+		if e.Type == "response.completed" {
+			t.Fatal("truncated stream must not be reported as completed")
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package translate
+
+import "strings"
+
+// OpenAI upstreams report a custom stop sequence as an ordinary "stop"
+// finish, and most strip it from the output. To report stop_reason
+// "stop_sequence" to Anthropic clients, the matched sequence is taken from
+// the upstream when it names it (vLLM's stop_reason, SGLang's matched_stop),
+// or from the end of the text for upstreams that leave it in the output. In
+// the latter case it is removed from the text, as Anthropic never includes
+// the stop sequence in content.
+
+// matchedStopSequence returns the request stop sequence that ended a
+// completion with finish reason finish and final text, or "" when the
+// completion ended for another reason or the match cannot be told apart
+// from a natural end. reported are the upstream's own match fields.
+func matchedStopSequence(stops []string, finish *string, text string, reported ...interface{}) string {
+	if len(stops) == 0 || finish == nil || *finish != "stop" {
+		return ""
+	}
+	for _, r := range reported {
+		if s, ok := r.(string); ok && s != "" {
+			for _, stop := range stops {
+				if s == stop {
+					return s
+				}
+			}
+		}
+	}
+	match := ""
+	for _, stop := range stops {
+		if stop != "" && len(stop) > len(match) && strings.HasSuffix(text, stop) {
+			match = stop
+		}
+	}
+	return match
+}
+
+// stopSequenceHoldLen returns the length of the longest suffix of text that
+// is a prefix of one of stops. A streamed translation holds those bytes back
+// until the next delta shows whether they begin a stop sequence.
+func stopSequenceHoldLen(stops []string, text string) int {
+	hold := 0
+	for _, stop := range stops {
+		n := min(len(stop), len(text))
+		for ; n > hold; n-- {
+			if strings.HasPrefix(stop, text[len(text)-n:]) {
+				hold = n
+				break
+			}
+		}
+	}
+	return hold
+}
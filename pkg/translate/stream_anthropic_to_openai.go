@@ -1,7 +1,6 @@
 package translate
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"fmt"
@@ -10,6 +9,7 @@ import (
 	"time"
 
 	"github.com/bytedance/sonic"
+	"github.com/sertdev/pxbin/internal/ids"
 )
 
 // AnthropicToOpenAIStreamResult contains usage information captured during
@@ -19,11 +19,16 @@ type AnthropicToOpenAIStreamResult struct {
 	OutputTokens        int
 	CacheCreationTokens int
 	CacheReadTokens     int
+	ReasoningTokens     int // estimated from the thinking deltas
+	ToolCalls           int
+	WebSearchRequests   int
 	Model               string
 }
 
 // TranslateAnthropicStreamToOpenAI reads an Anthropic SSE stream from
 // upstreamBody and writes OpenAI-format SSE events to w in real time.
+// Upstream lines longer than maxFrame bytes (0 for DefaultMaxSSEFrameSize)
+// end the stream with an error chunk.
 //
 // The caller MUST set these response headers before calling:
 //
@@ -36,6 +41,7 @@ func TranslateAnthropicStreamToOpenAI(
 	w http.ResponseWriter,
 	flusher http.Flusher,
 	model string,
+	maxFrame int,
 ) (*AnthropicToOpenAIStreamResult, error) {
 	defer upstreamBody.Close()
 
@@ -50,14 +56,14 @@ func TranslateAnthropicStreamToOpenAI(
 	}()
 
 	result := &AnthropicToOpenAIStreamResult{Model: model}
-	chunkID := "chatcmpl-" + generateMessageID()
+	chunkID := ids.ChatCompletion()
 	created := time.Now().Unix()
 	firstChunkSent := false
 	toolCallIndex := -1
+	thinkingBytes := 0
 	currentEventType := ""
 
-	scanner := bufio.NewScanner(upstreamBody)
-	scanner.Buffer(make([]byte, 0, 64*1024), 8*1024*1024)
+	scanner := NewSSEScanner(upstreamBody, maxFrame)
 
 	for scanner.Scan() {
 		if err := ctx.Err(); err != nil {
@@ -91,6 +97,7 @@ func TranslateAnthropicStreamToOpenAI(
 			result.InputTokens = evt.Message.Usage.InputTokens
 			result.CacheCreationTokens = evt.Message.Usage.CacheCreationInputTokens
 			result.CacheReadTokens = evt.Message.Usage.CacheReadInputTokens
+			result.WebSearchRequests = evt.Message.Usage.ServerToolUse.WebSearches()
 
 			if !firstChunkSent {
 				writeOpenAIStreamChunk(w, flusher, chunkID, created, model, &OpenAIStreamChoice{
@@ -114,6 +121,7 @@ func TranslateAnthropicStreamToOpenAI(
 			}
 			if evt.ContentBlock.Type == "tool_use" {
 				toolCallIndex++
+				result.ToolCalls++
 				writeOpenAIStreamChunk(w, flusher, chunkID, created, model, &OpenAIStreamChoice{
 					Index: 0,
 					Delta: OpenAIStreamDelta{
@@ -160,6 +168,7 @@ func TranslateAnthropicStreamToOpenAI(
 				}, nil)
 			case "thinking_delta":
 				text := evt.Delta.Thinking
+				thinkingBytes += len(text)
 				writeOpenAIStreamChunk(w, flusher, chunkID, created, model, &OpenAIStreamChoice{
 					Index: 0,
 					Delta: OpenAIStreamDelta{ReasoningContent: &text},
@@ -173,8 +182,15 @@ func TranslateAnthropicStreamToOpenAI(
 			}
 			if evt.Usage != nil {
 				result.OutputTokens = evt.Usage.OutputTokens
+				// The delta's counts are cumulative, and only present once a
+				// server tool has run.
+				if evt.Usage.ServerToolUse != nil {
+					result.WebSearchRequests = evt.Usage.ServerToolUse.WebSearchRequests
+				}
 			}
 
+			result.ReasoningTokens = ThinkingTokens(thinkingBytes, result.OutputTokens)
+
 			finishReason := mapAnthropicStopReason(evt.Delta.StopReason)
 
 			totalInput := result.InputTokens + result.CacheReadTokens
@@ -188,6 +204,11 @@ func TranslateAnthropicStreamToOpenAI(
 					CachedTokens: result.CacheReadTokens,
 				}
 			}
+			if result.ReasoningTokens > 0 {
+				usage.CompletionTokensDetails = &OpenAICompletionTokensDetails{
+					ReasoningTokens: result.ReasoningTokens,
+				}
+			}
 
 			writeOpenAIStreamChunk(w, flusher, chunkID, created, model, &OpenAIStreamChoice{
 				Index:        0,
@@ -207,6 +228,12 @@ func TranslateAnthropicStreamToOpenAI(
 		return result, err
 	}
 	if err := scanner.Err(); err != nil {
+		if msg, ok := StreamErrorMessage(err, maxFrame); ok {
+			_ = WriteOpenAIStreamError(w, flusher, msg)
+			if IsSSEFrameTooLarge(err) {
+				err = ErrSSEFrameTooLarge
+			}
+		}
 		return result, fmt.Errorf("reading upstream SSE stream: %w", err)
 	}
 
@@ -215,10 +242,11 @@ func TranslateAnthropicStreamToOpenAI(
 
 func writeOpenAIStreamChunk(w http.ResponseWriter, flusher http.Flusher, id string, created int64, model string, choice *OpenAIStreamChoice, usage *OpenAIUsage) {
 	chunk := OpenAIStreamChunk{
-		ID:      id,
-		Object:  "chat.completion.chunk",
-		Created: created,
-		Model:   model,
+		ID:                id,
+		Object:            "chat.completion.chunk",
+		Created:           created,
+		Model:             model,
+		SystemFingerprint: ids.Fingerprint(model),
 	}
 	if choice != nil {
 		chunk.Choices = []OpenAIStreamChoice{*choice}
@@ -0,0 +1,86 @@
+package translate
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bytedance/sonic"
+)
+
+func TestAnthropicToOpenAIStreamWebSearches(t *testing.T) {
+	stream := "event: message_start\n" +
+		`data: {"type":"message_start","message":{"id":"msg_1","model":"claude","usage":{"input_tokens":10,"output_tokens":1}}}` + "\n\n" +
+		"event: content_block_start\n" +
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}` + "\n\n" +
+		"event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}` + "\n\n" +
+		"event: message_delta\n" +
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":20,"server_tool_use":{"web_search_requests":2}}}` + "\n\n" +
+		"event: message_stop\n" +
+		`data: {"type":"message_stop"}` + "\n\n"
+
+	rec := httptest.NewRecorder()
+	result, err := TranslateAnthropicStreamToOpenAI(context.Background(), io.NopCloser(strings.NewReader(stream)), rec, &mockFlusher{rec}, "claude", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.OutputTokens != 20 || result.WebSearchRequests != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+func TestAnthropicUsageServerToolUse(t *testing.T) {
+	var resp AnthropicResponse
+	body := `{"id":"msg_1","type":"message","usage":{"input_tokens":5,"output_tokens":9,"server_tool_use":{"web_search_requests":4}}}`
+	if err := sonic.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Usage.ServerToolUse.WebSearches(); got != 4 {
+		t.Fatalf("WebSearches() = %d, want 4", got)
+	}
+
+	// Usage without server tools must not grow a server_tool_use field.
+	out, _ := sonic.Marshal(AnthropicUsage{InputTokens: 1})
+	if strings.Contains(string(out), "server_tool_use") {
+		t.Fatalf("unexpected server_tool_use in %s", out)
+	}
+	if (*ServerToolUsage)(nil).WebSearches() != 0 {
+		t.Fatal("nil usage should count no searches")
+	}
+}
+
+func TestAnthropicToOpenAIStreamReasoningTokens(t *testing.T) {
+	stream := "event: message_start\n" +
+		`data: {"type":"message_start","message":{"id":"msg_1","model":"claude","usage":{"input_tokens":10,"output_tokens":1}}}` + "\n\n" +
+		"event: content_block_start\n" +
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}` + "\n\n" +
+		"event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"` + strings.Repeat("a", 40) + `"}}` + "\n\n" +
+		"event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"` + strings.Repeat("b", 40) + `"}}` + "\n\n" +
+		"event: message_delta\n" +
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":30}}` + "\n\n"
+
+	rec := httptest.NewRecorder()
+	result, err := TranslateAnthropicStreamToOpenAI(context.Background(), io.NopCloser(strings.NewReader(stream)), rec, &mockFlusher{rec}, "claude", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.ReasoningTokens != 20 {
+		t.Fatalf("expected 20 estimated reasoning tokens, got %d", result.ReasoningTokens)
+	}
+	if !strings.Contains(rec.Body.String(), `"completion_tokens_details":{"reasoning_tokens":20}`) {
+		t.Fatalf("expected reasoning tokens in the usage chunk, got %s", rec.Body)
+	}
+
+	resp := AnthropicResponse{
+		Content: []ContentBlock{{Type: "thinking", Thinking: strings.Repeat("a", 400)}, {Type: "text", Text: "hi"}},
+		Usage:   AnthropicUsage{OutputTokens: 60},
+	}
+	if got := resp.ThinkingTokens(); got != 60 {
+		t.Fatalf("expected the estimate to be capped at the output tokens, got %d", got)
+	}
+}
@@ -1,7 +1,6 @@
 package translate
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"io"
@@ -9,12 +8,14 @@ import (
 	"strings"
 
 	"github.com/bytedance/sonic"
+	"github.com/sertdev/pxbin/internal/ids"
 )
 
 // responsesStreamState holds mutable state for the Chat Completions → Responses
 // API SSE translation state machine.
 type responsesStreamState struct {
 	responseID string
+	upstreamID string // chat completion ID from the first upstream chunk
 	model      string
 
 	// Track whether initial events have been emitted.
@@ -37,13 +38,16 @@ type responsesStreamState struct {
 
 type responsesToolCallState struct {
 	outputIndex int
+	itemID      string
 	id          string
 	name        string
 	argsAccum   strings.Builder
 }
 
 // TranslateChatStreamToResponses reads Chat Completions SSE from upstreamBody
-// and writes Responses API SSE events to w.
+// and writes Responses API SSE events to w. Upstream lines longer than
+// maxFrame bytes (0 for DefaultMaxSSEFrameSize) end the stream with an error
+// event.
 //
 // The caller MUST set response headers before calling:
 //
@@ -56,6 +60,7 @@ func TranslateChatStreamToResponses(
 	w http.ResponseWriter,
 	flusher http.Flusher,
 	model string,
+	maxFrame int,
 ) (*StreamResult, error) {
 	defer upstreamBody.Close()
 
@@ -70,14 +75,13 @@ func TranslateChatStreamToResponses(
 	}()
 
 	state := &responsesStreamState{
-		responseID:       generateResponseID(),
+		responseID:       ids.Response(),
 		model:            model,
 		messageItemIndex: -1,
 		toolCalls:        make(map[int]*responsesToolCallState),
 	}
 
-	scanner := bufio.NewScanner(upstreamBody)
-	scanner.Buffer(make([]byte, 0, 64*1024), 8*1024*1024)
+	scanner := NewSSEScanner(upstreamBody, maxFrame)
 
 	for scanner.Scan() {
 		if err := ctx.Err(); err != nil {
@@ -109,6 +113,13 @@ func TranslateChatStreamToResponses(
 		return responsesStreamResultFromState(state), err
 	}
 	if err := scanner.Err(); err != nil {
+		if msg, ok := StreamErrorMessage(err, maxFrame); ok {
+			_ = writeResponsesStreamError(w, flusher, msg)
+			if IsSSEFrameTooLarge(err) {
+				err = ErrSSEFrameTooLarge
+			}
+			return responsesStreamResultFromState(state), fmt.Errorf("reading upstream SSE: %w", err)
+		}
 		_ = finalizeResponsesStream(w, flusher, state)
 		return responsesStreamResultFromState(state), fmt.Errorf("reading upstream SSE: %w", err)
 	}
@@ -117,9 +128,10 @@ func TranslateChatStreamToResponses(
 }
 
 func responsesStreamResultFromState(state *responsesStreamState) *StreamResult {
-	r := &StreamResult{}
+	r := &StreamResult{ToolCalls: len(state.toolCalls), ResponseID: state.responseID, UpstreamResponseID: state.upstreamID}
 	if state.usage != nil {
 		r.InputTokens, r.OutputTokens, r.CacheReadTokens = normalizeOpenAIUsage(state.usage)
+		r.ReasoningTokens = OpenAIReasoningTokens(state.usage)
 	}
 	return r
 }
@@ -132,6 +144,7 @@ func processResponsesChunk(w http.ResponseWriter, flusher http.Flusher, state *r
 		if chunk.Model != "" {
 			state.model = chunk.Model
 		}
+		state.upstreamID = chunk.ID
 		if err := emitResponsesHeader(w, flusher, state); err != nil {
 			return err
 		}
@@ -146,24 +159,30 @@ func processResponsesChunk(w http.ResponseWriter, flusher http.Flusher, state *r
 		return nil
 	}
 
-	choice := chunk.Choices[0]
+	// A response has a single output, so only the first choice is
+	// translated; the deltas of others would be merged into its items.
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
 
-	// Content delta → output_text.delta
-	if choice.Delta.Content != nil && *choice.Delta.Content != "" {
-		if err := handleResponsesContentDelta(w, flusher, state, *choice.Delta.Content); err != nil {
-			return err
+		// Content delta → output_text.delta
+		if choice.Delta.Content != nil && *choice.Delta.Content != "" {
+			if err := handleResponsesContentDelta(w, flusher, state, *choice.Delta.Content); err != nil {
+				return err
+			}
 		}
-	}
 
-	// Tool call deltas.
-	for _, tc := range choice.Delta.ToolCalls {
-		if err := handleResponsesToolCallDelta(w, flusher, state, tc); err != nil {
-			return err
+		// Tool call deltas.
+		for _, tc := range choice.Delta.ToolCalls {
+			if err := handleResponsesToolCallDelta(w, flusher, state, tc); err != nil {
+				return err
+			}
 		}
-	}
 
-	if choice.FinishReason != nil {
-		state.finishReason = choice.FinishReason
+		if choice.FinishReason != nil {
+			state.finishReason = choice.FinishReason
+		}
 	}
 	if chunk.Usage != nil {
 		state.usage = chunk.Usage
@@ -200,7 +219,7 @@ func handleResponsesContentDelta(w http.ResponseWriter, flusher http.Flusher, st
 
 		msgItem := ResponsesOutputItem{
 			Type:    "message",
-			ID:      generateMessageID(),
+			ID:      ids.ResponseMessage(),
 			Role:    "assistant",
 			Status:  "in_progress",
 			Content: []ResponsesContentPart{},
@@ -259,6 +278,7 @@ func handleResponsesToolCallDelta(w http.ResponseWriter, flusher http.Flusher, s
 
 		tcs := &responsesToolCallState{
 			outputIndex: outputIdx,
+			itemID:      ids.ResponseFunctionCall(),
 			id:          tc.ID,
 			name:        name,
 		}
@@ -266,7 +286,7 @@ func handleResponsesToolCallDelta(w http.ResponseWriter, flusher http.Flusher, s
 
 		item := ResponsesOutputItem{
 			Type:   "function_call",
-			ID:     tc.ID,
+			ID:     tcs.itemID,
 			CallID: tc.ID,
 			Name:   name,
 			Status: "in_progress",
@@ -331,7 +351,7 @@ func closeResponsesMessageItem(w http.ResponseWriter, flusher http.Flusher, stat
 		"output_index": state.messageItemIndex,
 		"item": ResponsesOutputItem{
 			Type:   "message",
-			ID:     generateMessageID(),
+			ID:     ids.ResponseMessage(),
 			Role:   "assistant",
 			Status: "completed",
 			Content: []ResponsesContentPart{{
@@ -378,7 +398,7 @@ func finalizeResponsesStream(w http.ResponseWriter, flusher http.Flusher, state
 			"output_index": tcs.outputIndex,
 			"item": ResponsesOutputItem{
 				Type:      "function_call",
-				ID:        tcs.id,
+				ID:        tcs.itemID,
 				CallID:    tcs.id,
 				Name:      tcs.name,
 				Arguments: tcs.argsAccum.String(),
@@ -394,7 +414,7 @@ func finalizeResponsesStream(w http.ResponseWriter, flusher http.Flusher, state
 	if state.textAccum.Len() > 0 {
 		output = append(output, ResponsesOutputItem{
 			Type:   "message",
-			ID:     generateMessageID(),
+			ID:     ids.ResponseMessage(),
 			Role:   "assistant",
 			Status: "completed",
 			Content: []ResponsesContentPart{{
@@ -406,7 +426,7 @@ func finalizeResponsesStream(w http.ResponseWriter, flusher http.Flusher, state
 	for _, tcs := range state.toolCalls {
 		output = append(output, ResponsesOutputItem{
 			Type:      "function_call",
-			ID:        tcs.id,
+			ID:        tcs.itemID,
 			CallID:    tcs.id,
 			Name:      tcs.name,
 			Arguments: tcs.argsAccum.String(),
@@ -0,0 +1,48 @@
+package translate
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChatToResponsesStreamMultipleChoices(t *testing.T) {
+	body := sseRaw(
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"content":"Hello"}},{"index":1,"delta":{"content":"Bonjour"}}]}`,
+		``,
+		`data: {"id":"c1","choices":[{"index":1,"delta":{"content":" monde"}}]}`,
+		``,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"content":" world"},"finish_reason":"stop"}]}`,
+		``,
+		`data: [DONE]`,
+		``,
+	)
+	rec := httptest.NewRecorder()
+	if _, err := TranslateChatStreamToResponses(context.Background(), body, rec, &mockFlusher{rec}, "gpt-4o", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var text string
+	for _, e := range parseSSEEvents(rec.Body.String()) {
+		if e.Type != "response.output_text.done" {
+			continue
+		}
+		var done struct{ Text string }
+		mustUnmarshal(t, e.Data, &done)
+		text += done.Text
+	}
+	if text != "Hello world" {
+		t.Fatalf("expected only the first choice to be translated, got %q", text)
+	}
+}
+
+func TestResponsesRequestRejectsMultipleChoices(t *testing.T) {
+	req := &ResponsesAPIRequest{Model: "gpt-4o", Input: []byte(`"hi"`), N: ptr(2)}
+	if _, err := ResponsesRequestToChatCompletions(req); err == nil {
+		t.Fatal("expected n above 1 to be rejected")
+	}
+	req.N = ptr(1)
+	if _, err := ResponsesRequestToChatCompletions(req); err != nil {
+		t.Fatalf("expected n of 1 to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package translate
+
+import (
+	"time"
+
+	"github.com/sertdev/pxbin/internal/ids"
+)
+
+// ChatStreamConverter translates Gemini streamGenerateContent responses
+// into Chat Completions chunks, one response at a time. Gemini sends each
+// function call whole, so a call becomes a single tool call delta with its
+// complete arguments. Usage goes out in a final chunk without choices, as
+// with stream_options.include_usage.
+type ChatStreamConverter struct {
+	id      string
+	model   string
+	created int64
+
+	started   bool
+	toolCalls int
+	usage     *GeminiUsageMetadata
+	finished  bool
+}
+
+// NewChatStreamConverter returns a converter for a stream from model; the
+// model named by the responses takes precedence.
+func NewChatStreamConverter(model string) *ChatStreamConverter {
+	return &ChatStreamConverter{id: ids.ChatCompletion(), model: model, created: time.Now().Unix()}
+}
+
+// Convert consumes one response and returns the chunks to send for it, if
+// any. Only the first candidate is translated.
+func (c *ChatStreamConverter) Convert(resp *GeminiResponse) []OpenAIStreamChunk {
+	if resp.ModelVersion != "" {
+		c.model = resp.ModelVersion
+	}
+	if resp.UsageMetadata != nil {
+		c.usage = resp.UsageMetadata
+	}
+	if len(resp.Candidates) == 0 {
+		return nil
+	}
+	cand := resp.Candidates[0]
+
+	var out []OpenAIStreamChunk
+	for _, p := range cand.Content.Parts {
+		var d OpenAIStreamDelta
+		switch {
+		case p.FunctionCall != nil:
+			tc := openAIToolCallFromGemini(p.FunctionCall)
+			d.ToolCalls = []OpenAIStreamToolCall{{
+				Index:    c.toolCalls,
+				ID:       tc.ID,
+				Type:     "function",
+				Function: &OpenAIStreamFunction{Name: tc.Function.Name, Arguments: tc.Function.Arguments},
+			}}
+			c.toolCalls++
+		case p.Text == "":
+			continue
+		case p.Thought:
+			d.ReasoningContent = &p.Text
+		default:
+			d.Content = &p.Text
+		}
+		out = append(out, c.chunk(d, nil))
+	}
+	if cand.FinishReason != "" {
+		finish := OpenAIFinishReasonFromGemini(cand.FinishReason, c.toolCalls > 0)
+		out = append(out, c.chunk(OpenAIStreamDelta{}, &finish))
+	}
+	return out
+}
+
+// Finish returns the final chunk, carrying the usage. It reports false if
+// Finish was already called or the stream reported no usage.
+func (c *ChatStreamConverter) Finish() (OpenAIStreamChunk, bool) {
+	if c.finished || c.usage == nil {
+		return OpenAIStreamChunk{}, false
+	}
+	c.finished = true
+	return OpenAIStreamChunk{
+		ID:      c.id,
+		Object:  "chat.completion.chunk",
+		Created: c.created,
+		Model:   c.model,
+		Choices: []OpenAIStreamChoice{},
+		Usage:   OpenAIUsageFromGemini(c.usage),
+	}, true
+}
+
+// chunk wraps a delta, giving the first one the assistant role.
+func (c *ChatStreamConverter) chunk(d OpenAIStreamDelta, finish *string) OpenAIStreamChunk {
+	if !c.started {
+		d.Role = "assistant"
+		c.started = true
+	}
+	return OpenAIStreamChunk{
+		ID:      c.id,
+		Object:  "chat.completion.chunk",
+		Created: c.created,
+		Model:   c.model,
+		Choices: []OpenAIStreamChoice{{Delta: d, FinishReason: finish}},
+	}
+}
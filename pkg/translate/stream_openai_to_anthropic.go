@@ -1,12 +1,12 @@
 package translate
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 
 	"fmt"
 	"github.com/bytedance/sonic"
+	"github.com/sertdev/pxbin/internal/ids"
 	"io"
 	"net/http"
 	"strings"
@@ -28,12 +28,21 @@ type toolCallState struct {
 type streamState struct {
 	messageStartSent  bool
 	currentBlockIndex int
-	currentBlockType  string // "" | "text" | "tool_use"
+	currentBlockType  string // "" | "text" | "thinking" | "tool_use"
 	toolCalls         map[int]*toolCallState
+	interleaved       bool
+	pendingThinking   strings.Builder // reasoning held back while a tool_use block is open
+	prefill           string          // restated prefill still to be stripped
+	prefillBuf        string          // streamed text that so far matches prefill
+	stopSequences     []string
+	heldText          string        // text that may be the start of a stop sequence
+	reportedStop      []interface{} // upstream's own stop sequence match fields
+	repairedToolCalls int
 	finishReason      *string
 	usage             *OpenAIUsage
 	messageID         string
 	model             string
+	inputEstimate     int
 }
 
 // StreamResult contains usage information captured during streaming translation.
@@ -42,11 +51,42 @@ type StreamResult struct {
 	OutputTokens        int
 	CacheCreationTokens int
 	CacheReadTokens     int
+	// ReasoningTokens is the part of OutputTokens spent on reasoning or
+	// thinking.
+	ReasoningTokens int
+	ToolCalls       int
+	// RepairedToolCalls counts tool calls whose arguments were cut off and
+	// closed with repairJSONSuffix.
+	RepairedToolCalls int
+	// ResponseID is the Responses API response ID sent to the client and
+	// UpstreamResponseID the chat completion ID it was translated from; both
+	// are only set for Responses streams.
+	ResponseID         string
+	UpstreamResponseID string
 }
 
 // TranslateOpenAIStreamToAnthropic reads an OpenAI streaming response from
 // upstreamBody and writes Anthropic-format SSE events to w in real time.
 //
+// inputTokensEstimate is reported as message_start input_tokens when the
+// upstream has not sent usage by the first chunk (pass 0 if unknown); the
+// authoritative counts are always sent in message_delta.
+//
+// With interleavedThinking, reasoning that arrives while a tool call is still
+// streaming is held back and emitted as its own thinking block once the tool
+// call is complete, so thinking lands between tool_use blocks in the order
+// the model produced it instead of cutting a tool_use block short.
+//
+// prefill is the request's trailing assistant text (see AnthropicPrefill);
+// if the upstream restates it, it is dropped from the start of the output.
+//
+// stopSequences are the request's stop_sequences. Text that could be the
+// start of one is held back until it is known not to be, so a stop sequence
+// the upstream echoes is reported as stop_sequence rather than streamed.
+//
+// Upstream lines longer than maxFrame bytes (0 for DefaultMaxSSEFrameSize)
+// end the stream with an error event rather than a truncated message.
+//
 // The caller MUST set these response headers before calling this function:
 //
 //	Content-Type: text/event-stream
@@ -58,6 +98,11 @@ func TranslateOpenAIStreamToAnthropic(
 	w http.ResponseWriter,
 	flusher http.Flusher,
 	model string,
+	inputTokensEstimate int,
+	interleavedThinking bool,
+	prefill string,
+	stopSequences []string,
+	maxFrame int,
 ) (*StreamResult, error) {
 	defer upstreamBody.Close()
 
@@ -77,10 +122,13 @@ func TranslateOpenAIStreamToAnthropic(
 		currentBlockIndex: -1,
 		toolCalls:         make(map[int]*toolCallState),
 		model:             model,
+		inputEstimate:     inputTokensEstimate,
+		interleaved:       interleavedThinking,
+		prefill:           prefill,
+		stopSequences:     stopSequences,
 	}
 
-	scanner := bufio.NewScanner(upstreamBody)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	scanner := NewSSEScanner(upstreamBody, maxFrame)
 
 	for scanner.Scan() {
 		if err := ctx.Err(); err != nil {
@@ -120,26 +168,39 @@ func TranslateOpenAIStreamToAnthropic(
 	}
 
 	if err := scanner.Err(); err != nil {
+		if msg, ok := StreamErrorMessage(err, maxFrame); ok {
+			_ = WriteAnthropicStreamError(w, flusher, msg)
+			if IsSSEFrameTooLarge(err) {
+				err = ErrSSEFrameTooLarge
+			}
+			return streamResultFromState(state), fmt.Errorf("reading upstream SSE stream: %w", err)
+		}
 		_ = finalizeStream(w, flusher, state)
 		return streamResultFromState(state), fmt.Errorf("reading upstream SSE stream: %w", err)
 	}
 
-	return streamResultFromState(state), finalizeStream(w, flusher, state)
+	err := finalizeStream(w, flusher, state)
+	return streamResultFromState(state), err
 }
 
 func streamResultFromState(state *streamState) *StreamResult {
-	r := &StreamResult{}
+	r := &StreamResult{ToolCalls: len(state.toolCalls), RepairedToolCalls: state.repairedToolCalls}
 	if state.usage != nil {
 		r.InputTokens, r.OutputTokens, r.CacheReadTokens = normalizeOpenAIUsage(state.usage)
+		r.ReasoningTokens = OpenAIReasoningTokens(state.usage)
 	}
 	return r
 }
 
 // processChunk handles a single parsed OpenAI stream chunk.
 func processChunk(w http.ResponseWriter, flusher http.Flusher, state *streamState, chunk *OpenAIStreamChunk) error {
-	// Step 1: Emit message_start on the very first chunk.
+	// Step 1: Emit message_start on the very first chunk. Some upstreams send
+	// usage on every chunk; capture it first so message_start reports it.
 	if !state.messageStartSent {
-		state.messageID = generateMessageID()
+		if chunk.Usage != nil {
+			state.usage = chunk.Usage
+		}
+		state.messageID = ids.AnthropicMessage()
 		if err := emitMessageStart(w, flusher, state); err != nil {
 			return err
 		}
@@ -186,6 +247,7 @@ func processChunk(w http.ResponseWriter, flusher http.Flusher, state *streamStat
 	// Step 6: Finish reason.
 	if choice.FinishReason != nil {
 		state.finishReason = choice.FinishReason
+		state.reportedStop = []interface{}{choice.StopReason, choice.MatchedStop}
 	}
 
 	// Store usage if present alongside choices.
@@ -196,8 +258,15 @@ func processChunk(w http.ResponseWriter, flusher http.Flusher, state *streamStat
 	return nil
 }
 
-// emitMessageStart writes the initial message_start event.
+// emitMessageStart writes the initial message_start event. Input tokens come
+// from early upstream usage when available, otherwise from the request
+// estimate, mirroring the real API which reports the prompt size up front.
 func emitMessageStart(w http.ResponseWriter, flusher http.Flusher, state *streamState) error {
+	usage := AnthropicUsage{InputTokens: state.inputEstimate}
+	if state.usage != nil && state.usage.PromptTokens > 0 {
+		usage.InputTokens, _, usage.CacheReadInputTokens = normalizeOpenAIUsage(state.usage)
+	}
+
 	evt := MessageStartEvent{
 		Type: "message_start",
 		Message: AnthropicResponse{
@@ -208,10 +277,7 @@ func emitMessageStart(w http.ResponseWriter, flusher http.Flusher, state *stream
 			Content:      []ContentBlock{},
 			StopReason:   nil,
 			StopSequence: nil,
-			Usage: AnthropicUsage{
-				InputTokens:  0,
-				OutputTokens: 0,
-			},
+			Usage:        usage,
 		},
 	}
 	return writeSSE(w, flusher, "message_start", evt)
@@ -219,6 +285,14 @@ func emitMessageStart(w http.ResponseWriter, flusher http.Flusher, state *stream
 
 // handleContentDelta processes a text content delta.
 func handleContentDelta(w http.ResponseWriter, flusher http.Flusher, state *streamState, text string) error {
+	if state.prefill != "" {
+		if text = stripStreamedPrefill(state, text); text == "" {
+			return nil
+		}
+	}
+	if err := flushPendingThinking(w, flusher, state); err != nil {
+		return err
+	}
 	if state.currentBlockType != "text" {
 		if err := closeCurrentBlock(w, flusher, state); err != nil {
 			return err
@@ -237,6 +311,20 @@ func handleContentDelta(w http.ResponseWriter, flusher http.Flusher, state *stre
 		state.currentBlockType = "text"
 	}
 
+	if len(state.stopSequences) > 0 {
+		text = state.heldText + text
+		hold := stopSequenceHoldLen(state.stopSequences, text)
+		state.heldText = text[len(text)-hold:]
+		text = text[:len(text)-hold]
+	}
+	return emitTextDelta(w, flusher, state, text)
+}
+
+// emitTextDelta writes text to the open text block.
+func emitTextDelta(w http.ResponseWriter, flusher http.Flusher, state *streamState, text string) error {
+	if text == "" {
+		return nil
+	}
 	return writeSSE(w, flusher, "content_block_delta", ContentBlockDeltaEvent{
 		Type:  "content_block_delta",
 		Index: state.currentBlockIndex,
@@ -250,6 +338,16 @@ func handleContentDelta(w http.ResponseWriter, flusher http.Flusher, state *stre
 // handleThinkingDelta processes a reasoning_content delta from the upstream
 // and emits it as an Anthropic thinking content block.
 func handleThinkingDelta(w http.ResponseWriter, flusher http.Flusher, state *streamState, text string) error {
+	if state.interleaved && state.currentBlockType == "tool_use" {
+		state.pendingThinking.WriteString(text)
+		return nil
+	}
+	return emitThinkingDelta(w, flusher, state, text)
+}
+
+// emitThinkingDelta writes text to the open thinking block, starting a new
+// one if needed.
+func emitThinkingDelta(w http.ResponseWriter, flusher http.Flusher, state *streamState, text string) error {
 	if state.currentBlockType != "thinking" {
 		if err := closeCurrentBlock(w, flusher, state); err != nil {
 			return err
@@ -278,12 +376,29 @@ func handleThinkingDelta(w http.ResponseWriter, flusher http.Flusher, state *str
 	})
 }
 
+// flushPendingThinking emits reasoning held back during a tool call as a
+// complete thinking block.
+func flushPendingThinking(w http.ResponseWriter, flusher http.Flusher, state *streamState) error {
+	if state.pendingThinking.Len() == 0 {
+		return nil
+	}
+	text := state.pendingThinking.String()
+	state.pendingThinking.Reset()
+	return emitThinkingDelta(w, flusher, state, text)
+}
+
 // handleToolCallDelta processes a single tool call delta from a chunk.
 func handleToolCallDelta(w http.ResponseWriter, flusher http.Flusher, state *streamState, tc OpenAIStreamToolCall) error {
 	tcIdx := tc.Index
 
 	// New tool call starting (has ID).
 	if tc.ID != "" {
+		if err := releasePrefill(w, flusher, state); err != nil {
+			return err
+		}
+		if err := flushPendingThinking(w, flusher, state); err != nil {
+			return err
+		}
 		if err := closeCurrentBlock(w, flusher, state); err != nil {
 			return err
 		}
@@ -337,9 +452,27 @@ func handleToolCallDelta(w http.ResponseWriter, flusher http.Flusher, state *str
 	return nil
 }
 
+// releasePrefill stops looking for a restated prefill and emits any text
+// buffered while checking for one; it was output, not a restatement.
+func releasePrefill(w http.ResponseWriter, flusher http.Flusher, state *streamState) error {
+	text := state.prefillBuf
+	state.prefill, state.prefillBuf = "", ""
+	if text == "" {
+		return nil
+	}
+	return handleContentDelta(w, flusher, state, text)
+}
+
 // closeCurrentBlock emits a content_block_stop for the current block if one
-// is open.
+// is open, first releasing any text held back for a stop sequence.
 func closeCurrentBlock(w http.ResponseWriter, flusher http.Flusher, state *streamState) error {
+	if state.currentBlockType == "text" && state.heldText != "" {
+		text := state.heldText
+		state.heldText = ""
+		if err := emitTextDelta(w, flusher, state, text); err != nil {
+			return err
+		}
+	}
 	if state.currentBlockIndex >= 0 {
 		return writeSSE(w, flusher, "content_block_stop", ContentBlockStopEvent{
 			Type:  "content_block_stop",
@@ -349,6 +482,42 @@ func closeCurrentBlock(w http.ResponseWriter, flusher http.Flusher, state *strea
 	return nil
 }
 
+// closeTruncatedToolCall closes the tool_use block open at the end of the
+// stream. If the upstream stopped before the arguments were complete, it
+// first sends the text that makes the accumulated input valid JSON, so
+// clients parsing it do not fail, and flags the block as repaired.
+func closeTruncatedToolCall(w http.ResponseWriter, flusher http.Flusher, state *streamState) error {
+	var tcs *toolCallState
+	for _, tc := range state.toolCalls {
+		if tc.anthropicIndex == state.currentBlockIndex {
+			tcs = tc
+		}
+	}
+	repaired := false
+	if tcs != nil && tcs.argsBuffer.Len() > 0 {
+		if suffix, ok := repairJSONSuffix(tcs.argsBuffer.String()); ok && suffix != "" {
+			tcs.argsBuffer.WriteString(suffix)
+			if err := writeSSE(w, flusher, "content_block_delta", ContentBlockDeltaEvent{
+				Type:  "content_block_delta",
+				Index: state.currentBlockIndex,
+				Delta: DeltaBlock{
+					Type:        "input_json_delta",
+					PartialJSON: suffix,
+				},
+			}); err != nil {
+				return err
+			}
+			state.repairedToolCalls++
+			repaired = true
+		}
+	}
+	return writeSSE(w, flusher, "content_block_stop", ContentBlockStopEvent{
+		Type:     "content_block_stop",
+		Index:    state.currentBlockIndex,
+		Repaired: repaired,
+	})
+}
+
 // finalizeStream closes any open content block and emits message_delta +
 // message_stop to finish the Anthropic stream.
 func finalizeStream(w http.ResponseWriter, flusher http.Flusher, state *streamState) error {
@@ -356,27 +525,43 @@ func finalizeStream(w http.ResponseWriter, flusher http.Flusher, state *streamSt
 		return nil
 	}
 
-	if err := closeCurrentBlock(w, flusher, state); err != nil {
+	if err := releasePrefill(w, flusher, state); err != nil {
+		return err
+	}
+	if err := flushPendingThinking(w, flusher, state); err != nil {
 		return err
 	}
 
 	stopReason := mapFinishReason(state.finishReason)
+	var stopSequence *string
+	if seq := matchedStopSequence(state.stopSequences, state.finishReason, state.heldText, state.reportedStop...); seq != "" {
+		state.heldText = strings.TrimSuffix(state.heldText, seq)
+		stopReason = "stop_sequence"
+		stopSequence = &seq
+	}
 
-	inputTokens := 0
-	outputTokens := 0
-	if state.usage != nil {
-		inputTokens, outputTokens, _ = normalizeOpenAIUsage(state.usage)
+	if state.currentBlockType == "tool_use" {
+		if err := closeTruncatedToolCall(w, flusher, state); err != nil {
+			return err
+		}
+	} else if err := closeCurrentBlock(w, flusher, state); err != nil {
+		return err
 	}
 
+	// Usage usually arrives after message_start, so the cached prompt
+	// tokens are reported here.
+	inputTokens, outputTokens, cacheReadTokens := normalizeOpenAIUsage(state.usage)
+
 	if err := writeSSE(w, flusher, "message_delta", MessageDeltaEvent{
 		Type: "message_delta",
 		Delta: MessageDelta{
 			StopReason:   &stopReason,
-			StopSequence: nil,
+			StopSequence: stopSequence,
 		},
 		Usage: &MessageDeltaUsage{
-			InputTokens:  inputTokens,
-			OutputTokens: outputTokens,
+			InputTokens:          inputTokens,
+			OutputTokens:         outputTokens,
+			CacheReadInputTokens: cacheReadTokens,
 		},
 	}); err != nil {
 		return err
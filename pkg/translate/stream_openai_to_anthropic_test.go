@@ -74,7 +74,7 @@ func runStream(t *testing.T, body io.ReadCloser) ([]sseEvent, *StreamResult, err
 	t.Helper()
 	rec := httptest.NewRecorder()
 	flusher := &mockFlusher{rec}
-	result, err := TranslateOpenAIStreamToAnthropic(context.Background(), body, rec, flusher, "claude-opus-4-6")
+	result, err := TranslateOpenAIStreamToAnthropic(context.Background(), body, rec, flusher, "claude-opus-4-6", 0, false, "", nil, 0)
 	events := parseSSEEvents(rec.Body.String())
 	return events, result, err
 }
@@ -392,10 +392,13 @@ func TestMultipleToolCalls(t *testing.T) {
 		},
 	)
 
-	events, _, err := runStream(t, body)
+	events, result, err := runStream(t, body)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	if result == nil || result.ToolCalls != 2 {
+		t.Errorf("expected 2 tool calls in result, got %+v", result)
+	}
 
 	// Two tool_use blocks.
 	assertEventTypes(t, events, []string{
@@ -430,6 +433,74 @@ func TestMultipleToolCalls(t *testing.T) {
 	}
 }
 
+func TestInterleavedThinkingBetweenToolCalls(t *testing.T) {
+	toolStart := func(idx int, id, name, args string) OpenAIStreamChunk {
+		return OpenAIStreamChunk{Choices: []OpenAIStreamChoice{{Delta: OpenAIStreamDelta{
+			ToolCalls: []OpenAIStreamToolCall{{Index: idx, ID: id, Type: "function", Function: &OpenAIStreamFunction{Name: name, Arguments: args}}},
+		}}}}
+	}
+	toolArgs := func(idx int, args string) OpenAIStreamChunk {
+		return OpenAIStreamChunk{Choices: []OpenAIStreamChoice{{Delta: OpenAIStreamDelta{
+			ToolCalls: []OpenAIStreamToolCall{{Index: idx, Function: &OpenAIStreamFunction{Arguments: args}}},
+		}}}}
+	}
+	reasoning := func(text string) OpenAIStreamChunk {
+		return OpenAIStreamChunk{Choices: []OpenAIStreamChoice{{Delta: OpenAIStreamDelta{ReasoningContent: ptr(text)}}}}
+	}
+	chunks := []OpenAIStreamChunk{
+		reasoning("Look up A first."),
+		toolStart(0, "call_1", "func_a", `{"a":`),
+		// Reasoning arrives while call_1's arguments are still streaming.
+		reasoning("Then B."),
+		toolArgs(0, `1}`),
+		toolStart(1, "call_2", "func_b", `{"b":2}`),
+		{Choices: []OpenAIStreamChoice{{FinishReason: ptr("tool_calls")}}},
+	}
+
+	rec := httptest.NewRecorder()
+	_, err := TranslateOpenAIStreamToAnthropic(context.Background(), sseLines(chunks...), rec, &mockFlusher{rec}, "claude-opus-4-6", 0, true, "", nil, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := parseSSEEvents(rec.Body.String())
+
+	assertEventTypes(t, events, []string{
+		"message_start",
+		"ping",
+		"content_block_start", // 0: thinking
+		"content_block_delta",
+		"content_block_stop",
+		"content_block_start", // 1: tool call_1
+		"content_block_delta",
+		"content_block_delta", // remaining args, block still open
+		"content_block_stop",
+		"content_block_start", // 2: held-back thinking
+		"content_block_delta",
+		"content_block_stop",
+		"content_block_start", // 3: tool call_2
+		"content_block_delta",
+		"content_block_stop",
+		"message_delta",
+		"message_stop",
+	})
+
+	var thinking ContentBlockDeltaEvent
+	mustUnmarshal(t, events[10].Data, &thinking)
+	if thinking.Index != 2 || thinking.Delta.Thinking != "Then B." {
+		t.Errorf("expected thinking %q at index 2, got %q at %d", "Then B.", thinking.Delta.Thinking, thinking.Index)
+	}
+	var args ContentBlockDeltaEvent
+	mustUnmarshal(t, events[7].Data, &args)
+	if args.Index != 1 || args.Delta.PartialJSON != "1}" {
+		t.Errorf("expected call_1 args at index 1, got %q at %d", args.Delta.PartialJSON, args.Index)
+	}
+	var second ContentBlockStartEvent
+	mustUnmarshal(t, events[12].Data, &second)
+	if second.Index != 3 || second.ContentBlock.Name != "func_b" {
+		t.Errorf("expected func_b at index 3, got %q at %d", second.ContentBlock.Name, second.Index)
+	}
+}
+
 func TestUsageInFinalChunk(t *testing.T) {
 	body := sseLines(
 		OpenAIStreamChunk{
@@ -481,6 +552,9 @@ func TestUsageInFinalChunk(t *testing.T) {
 	if msgDelta.Usage.InputTokens != 2 {
 		t.Errorf("expected 2 input tokens, got %d", msgDelta.Usage.InputTokens)
 	}
+	if msgDelta.Usage.CacheReadInputTokens != 8 {
+		t.Errorf("expected 8 cache read tokens, got %d", msgDelta.Usage.CacheReadInputTokens)
+	}
 
 	// Verify StreamResult captures usage.
 	if result == nil {
@@ -497,6 +571,63 @@ func TestUsageInFinalChunk(t *testing.T) {
 	}
 }
 
+func TestMessageStartUsesEarlyUsage(t *testing.T) {
+	body := sseLines(
+		OpenAIStreamChunk{
+			Choices: []OpenAIStreamChoice{{
+				Index: 0,
+				Delta: OpenAIStreamDelta{Content: ptr("Hi")},
+			}},
+			Usage: &OpenAIUsage{
+				PromptTokens: 120,
+				PromptTokensDetails: &OpenAIPromptTokensDetails{
+					CachedTokens: 100,
+				},
+			},
+		},
+	)
+
+	rec := httptest.NewRecorder()
+	_, err := TranslateOpenAIStreamToAnthropic(context.Background(), body, rec, &mockFlusher{rec}, "claude-opus-4-6", 999, false, "", nil, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := parseSSEEvents(rec.Body.String())
+
+	var msgStart MessageStartEvent
+	mustUnmarshal(t, events[0].Data, &msgStart)
+	if msgStart.Message.Usage.InputTokens != 20 {
+		t.Errorf("expected 20 input tokens from early usage, got %d", msgStart.Message.Usage.InputTokens)
+	}
+	if msgStart.Message.Usage.CacheReadInputTokens != 100 {
+		t.Errorf("expected 100 cache read tokens, got %d", msgStart.Message.Usage.CacheReadInputTokens)
+	}
+}
+
+func TestMessageStartUsesEstimate(t *testing.T) {
+	body := sseLines(
+		OpenAIStreamChunk{
+			Choices: []OpenAIStreamChoice{{
+				Index: 0,
+				Delta: OpenAIStreamDelta{Content: ptr("Hi")},
+			}},
+		},
+	)
+
+	rec := httptest.NewRecorder()
+	_, err := TranslateOpenAIStreamToAnthropic(context.Background(), body, rec, &mockFlusher{rec}, "claude-opus-4-6", 57, false, "", nil, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := parseSSEEvents(rec.Body.String())
+
+	var msgStart MessageStartEvent
+	mustUnmarshal(t, events[0].Data, &msgStart)
+	if msgStart.Message.Usage.InputTokens != 57 {
+		t.Errorf("expected estimated 57 input tokens, got %d", msgStart.Message.Usage.InputTokens)
+	}
+}
+
 func TestEmptyContentDeltaSkipped(t *testing.T) {
 	body := sseLines(
 		OpenAIStreamChunk{
@@ -587,6 +718,67 @@ func TestFinishReasonMapping(t *testing.T) {
 	}
 }
 
+func TestStopSequenceStream(t *testing.T) {
+	stops := []string{"###", "END"}
+	tests := []struct {
+		name     string
+		deltas   []string
+		finish   string
+		reported interface{}
+		text     string
+		reason   string
+		sequence string
+	}{
+		{"echoed across chunks", []string{"Hello #", "##"}, "stop", nil, "Hello ", "stop_sequence", "###"},
+		{"partial match released", []string{"a #", "# b"}, "stop", nil, "a ## b", "end_turn", ""},
+		{"reported by upstream", []string{"Hi"}, "stop", "END", "Hi", "stop_sequence", "END"},
+		{"natural end", []string{"Hi"}, "stop", nil, "Hi", "end_turn", ""},
+		{"held text on length", []string{"x ##"}, "length", nil, "x ##", "max_tokens", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var chunks []OpenAIStreamChunk
+			for _, d := range tt.deltas {
+				chunks = append(chunks, OpenAIStreamChunk{Choices: []OpenAIStreamChoice{{Delta: OpenAIStreamDelta{Content: ptr(d)}}}})
+			}
+			chunks = append(chunks, OpenAIStreamChunk{Choices: []OpenAIStreamChoice{{FinishReason: ptr(tt.finish), StopReason: tt.reported}}})
+
+			rec := httptest.NewRecorder()
+			_, err := TranslateOpenAIStreamToAnthropic(context.Background(), sseLines(chunks...), rec, &mockFlusher{rec}, "claude-opus-4-6", 0, false, "", stops, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var text strings.Builder
+			for _, e := range parseSSEEvents(rec.Body.String()) {
+				switch e.Type {
+				case "content_block_delta":
+					var d ContentBlockDeltaEvent
+					mustUnmarshal(t, e.Data, &d)
+					text.WriteString(d.Delta.Text)
+				case "message_delta":
+					var md MessageDeltaEvent
+					mustUnmarshal(t, e.Data, &md)
+					if *md.Delta.StopReason != tt.reason {
+						t.Errorf("expected stop_reason %q, got %q", tt.reason, *md.Delta.StopReason)
+					}
+					got := ""
+					if md.Delta.StopSequence != nil {
+						got = *md.Delta.StopSequence
+					}
+					if got != tt.sequence {
+						t.Errorf("expected stop_sequence %q, got %q", tt.sequence, got)
+					}
+				}
+			}
+			if text.String() != tt.text {
+				t.Errorf("expected text %q, got %q", tt.text, text.String())
+			}
+		})
+	}
+}
+
 func TestDataDoneHandling(t *testing.T) {
 	// Ensure data: [DONE] properly terminates the stream.
 	raw := sseRaw(
@@ -677,7 +869,7 @@ func TestContextCancellation(t *testing.T) {
 
 	rec := httptest.NewRecorder()
 	flusher := &mockFlusher{rec}
-	_, err := TranslateOpenAIStreamToAnthropic(ctx, pr, rec, flusher, "claude-opus-4-6")
+	_, err := TranslateOpenAIStreamToAnthropic(ctx, pr, rec, flusher, "claude-opus-4-6", 0, false, "", nil, 0)
 	if err == nil {
 		t.Error("expected error from context cancellation")
 	}
@@ -849,3 +1041,141 @@ func mustUnmarshal(t *testing.T, data string, v interface{}) {
 
 // Verify that the recorder implements http.Flusher via our wrapper.
 var _ http.Flusher = (*mockFlusher)(nil)
+
+func TestPrefillStrippedFromStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		deltas []string
+		text   string
+	}{
+		{"restated across chunks", []string{`{"ans`, `wer": `, `42}`}, `42}`},
+		{"restated exactly", []string{`{"answer": `}, ``},
+		{"not restated", []string{`42}`}, `42}`},
+		{"diverges midway", []string{`{"an`, `other": 1}`}, `{"another": 1}`},
+		{"ends inside prefill", []string{`{"ans`}, `{"ans`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var chunks []OpenAIStreamChunk
+			for _, d := range tt.deltas {
+				chunks = append(chunks, OpenAIStreamChunk{Choices: []OpenAIStreamChoice{{Delta: OpenAIStreamDelta{Content: ptr(d)}}}})
+			}
+			chunks = append(chunks, OpenAIStreamChunk{Choices: []OpenAIStreamChoice{{FinishReason: ptr("stop")}}})
+
+			rec := httptest.NewRecorder()
+			_, err := TranslateOpenAIStreamToAnthropic(context.Background(), sseLines(chunks...), rec, &mockFlusher{rec}, "claude-opus-4-6", 0, false, `{"answer": `, nil, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var text strings.Builder
+			blocks := 0
+			for _, e := range parseSSEEvents(rec.Body.String()) {
+				switch e.Type {
+				case "content_block_start":
+					blocks++
+				case "content_block_delta":
+					var d ContentBlockDeltaEvent
+					mustUnmarshal(t, e.Data, &d)
+					text.WriteString(d.Delta.Text)
+				}
+			}
+			if text.String() != tt.text {
+				t.Errorf("expected text %q, got %q", tt.text, text.String())
+			}
+			if tt.text == "" && blocks != 0 {
+				t.Errorf("expected no content block for a bare restatement, got %d", blocks)
+			}
+		})
+	}
+}
+
+func TestPrefillBeforeToolCallReleased(t *testing.T) {
+	chunks := []OpenAIStreamChunk{
+		{Choices: []OpenAIStreamChoice{{Delta: OpenAIStreamDelta{Content: ptr("Let")}}}},
+		{Choices: []OpenAIStreamChoice{{Delta: OpenAIStreamDelta{ToolCalls: []OpenAIStreamToolCall{{
+			Index: 0, ID: "call_1", Function: &OpenAIStreamFunction{Name: "f", Arguments: "{}"},
+		}}}}}},
+		{Choices: []OpenAIStreamChoice{{FinishReason: ptr("tool_calls")}}},
+	}
+	rec := httptest.NewRecorder()
+	_, err := TranslateOpenAIStreamToAnthropic(context.Background(), sseLines(chunks...), rec, &mockFlusher{rec}, "claude-opus-4-6", 0, false, "Let me check", nil, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := parseSSEEvents(rec.Body.String())
+	assertEventTypes(t, events, []string{
+		"message_start",
+		"ping",
+		"content_block_start", // 0: released text
+		"content_block_delta",
+		"content_block_stop",
+		"content_block_start", // 1: tool call
+		"content_block_delta",
+		"content_block_stop",
+		"message_delta",
+		"message_stop",
+	})
+	var d ContentBlockDeltaEvent
+	mustUnmarshal(t, events[3].Data, &d)
+	if d.Delta.Text != "Let" {
+		t.Errorf("expected released text %q, got %q", "Let", d.Delta.Text)
+	}
+}
+
+func TestTruncatedToolCallRepaired(t *testing.T) {
+	chunks := []OpenAIStreamChunk{
+		{Choices: []OpenAIStreamChoice{{Delta: OpenAIStreamDelta{ToolCalls: []OpenAIStreamToolCall{{
+			Index: 0, ID: "call_1", Function: &OpenAIStreamFunction{Name: "write_file", Arguments: `{"path": "a.txt", "content": "hel`},
+		}}}}}},
+		{Choices: []OpenAIStreamChoice{{FinishReason: ptr("length")}}},
+	}
+	events, result, err := runStream(t, sseLines(chunks...))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var input strings.Builder
+	var stop ContentBlockStopEvent
+	for _, e := range events {
+		switch e.Type {
+		case "content_block_delta":
+			var d ContentBlockDeltaEvent
+			mustUnmarshal(t, e.Data, &d)
+			input.WriteString(d.Delta.PartialJSON)
+		case "content_block_stop":
+			mustUnmarshal(t, e.Data, &stop)
+		}
+	}
+	if input.String() != `{"path": "a.txt", "content": "hel"}` {
+		t.Fatalf("unexpected repaired input %q", input.String())
+	}
+	if !stop.Repaired {
+		t.Error("expected the tool_use block to be flagged as repaired")
+	}
+	if result.RepairedToolCalls != 1 {
+		t.Errorf("expected 1 repaired tool call, got %d", result.RepairedToolCalls)
+	}
+}
+
+func TestCompleteToolCallNotFlagged(t *testing.T) {
+	chunks := []OpenAIStreamChunk{
+		{Choices: []OpenAIStreamChoice{{Delta: OpenAIStreamDelta{ToolCalls: []OpenAIStreamToolCall{{
+			Index: 0, ID: "call_1", Function: &OpenAIStreamFunction{Name: "f", Arguments: `{"a": 1}`},
+		}}}}}},
+		{Choices: []OpenAIStreamChoice{{FinishReason: ptr("tool_calls")}}},
+	}
+	events, result, err := runStream(t, sseLines(chunks...))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, e := range events {
+		if e.Type == "content_block_stop" && strings.Contains(e.Data, "pxbin_repaired") {
+			t.Errorf("complete tool call must not be flagged: %s", e.Data)
+		}
+	}
+	if result.RepairedToolCalls != 0 {
+		t.Errorf("expected no repaired tool calls, got %d", result.RepairedToolCalls)
+	}
+}
@@ -0,0 +1,118 @@
+package translate
+
+import "strings"
+
+// GeminiStreamConverter translates a Chat Completions stream into Gemini
+// streamGenerateContent responses, one chunk at a time. Text and reasoning
+// deltas are forwarded as they arrive; function calls are held back until
+// their arguments are complete, since Gemini sends each call whole, and go
+// out with the finish reason and usage in the final response.
+type GeminiStreamConverter struct {
+	model      string
+	responseID string
+
+	toolCalls map[int]*geminiStreamToolCall
+	toolOrder []int
+
+	finishReason string
+	usage        *OpenAIUsage
+	finished     bool
+}
+
+type geminiStreamToolCall struct {
+	id   string
+	name string
+	args strings.Builder
+}
+
+// NewGeminiStreamConverter returns a converter for a stream from model; the
+// model named by the chunks takes precedence.
+func NewGeminiStreamConverter(model string) *GeminiStreamConverter {
+	return &GeminiStreamConverter{model: model, toolCalls: map[int]*geminiStreamToolCall{}}
+}
+
+// Convert consumes one chunk and returns the responses to send for it, if
+// any. Only the first choice is translated.
+func (c *GeminiStreamConverter) Convert(chunk *OpenAIStreamChunk) []GeminiResponse {
+	if c.responseID == "" {
+		c.responseID = chunk.ID
+	}
+	if chunk.Model != "" {
+		c.model = chunk.Model
+	}
+	if chunk.Usage != nil {
+		c.usage = chunk.Usage
+	}
+
+	var out []GeminiResponse
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		d := choice.Delta
+		var parts []GeminiPart
+		if d.ReasoningContent != nil && *d.ReasoningContent != "" {
+			parts = append(parts, GeminiPart{Text: *d.ReasoningContent, Thought: true})
+		}
+		if d.Content != nil && *d.Content != "" {
+			parts = append(parts, GeminiPart{Text: *d.Content})
+		}
+		if len(parts) > 0 {
+			out = append(out, c.response(GeminiCandidate{Content: GeminiContent{Role: "model", Parts: parts}}))
+		}
+		for _, tc := range d.ToolCalls {
+			call, ok := c.toolCalls[tc.Index]
+			if !ok {
+				call = &geminiStreamToolCall{}
+				c.toolCalls[tc.Index] = call
+				c.toolOrder = append(c.toolOrder, tc.Index)
+			}
+			if tc.ID != "" {
+				call.id = tc.ID
+			}
+			if tc.Function != nil {
+				if tc.Function.Name != "" {
+					call.name = tc.Function.Name
+				}
+				call.args.WriteString(tc.Function.Arguments)
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			c.finishReason = *choice.FinishReason
+		}
+	}
+	return out
+}
+
+// Finish returns the final response, carrying the function calls, finish
+// reason and usage. It reports false if Finish was already called.
+func (c *GeminiStreamConverter) Finish() (GeminiResponse, bool) {
+	if c.finished {
+		return GeminiResponse{}, false
+	}
+	c.finished = true
+
+	cand := GeminiCandidate{Content: GeminiContent{Role: "model", Parts: []GeminiPart{}}}
+	for _, idx := range c.toolOrder {
+		call := c.toolCalls[idx]
+		cand.Content.Parts = append(cand.Content.Parts, GeminiPart{FunctionCall: &GeminiFunctionCall{
+			ID:   call.id,
+			Name: call.name,
+			Args: geminiArgs(call.args.String()),
+		}})
+	}
+	if c.finishReason != "" {
+		cand.FinishReason = GeminiFinishReason(c.finishReason)
+	}
+	resp := c.response(cand)
+	resp.UsageMetadata = GeminiUsage(c.usage)
+	return resp, true
+}
+
+func (c *GeminiStreamConverter) response(cand GeminiCandidate) GeminiResponse {
+	return GeminiResponse{
+		Candidates:   []GeminiCandidate{cand},
+		ModelVersion: c.model,
+		ResponseID:   c.responseID,
+	}
+}
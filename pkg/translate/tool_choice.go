@@ -0,0 +1,167 @@
+package translate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/bytedance/sonic"
+)
+
+// allowedTools is the normalized form of an "allowed_tools" tool_choice,
+// which restricts the model to a subset of the declared tools. Neither
+// Chat Completions upstreams in general nor the Anthropic API accept it, so
+// translators prune the tools array to the allowed subset and fall back to
+// the closest plain tool_choice.
+type allowedTools struct {
+	required bool
+	names    map[string]bool
+	order    []string
+}
+
+// parseAllowedTools recognises both wire shapes of allowed_tools:
+//
+//	Chat Completions: {"type":"allowed_tools","allowed_tools":{"mode":"required","tools":[{"type":"function","function":{"name":"x"}}]}}
+//	Responses:        {"type":"allowed_tools","mode":"required","tools":[{"type":"function","name":"x"}]}
+//
+// Mode "any" is accepted as a synonym for "required" so Anthropic clients can
+// use the same shape. Returns nil if v is not an allowed_tools choice.
+func parseAllowedTools(v interface{}) *allowedTools {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if t, _ := obj["type"].(string); t != "allowed_tools" {
+		return nil
+	}
+
+	spec := obj
+	if nested, ok := obj["allowed_tools"].(map[string]interface{}); ok {
+		spec = nested
+	}
+
+	mode, _ := spec["mode"].(string)
+	at := &allowedTools{
+		required: mode == "required" || mode == "any",
+		names:    make(map[string]bool),
+	}
+	tools, _ := spec["tools"].([]interface{})
+	for _, raw := range tools {
+		tool, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := tool["name"].(string)
+		if fn, ok := tool["function"].(map[string]interface{}); ok && name == "" {
+			name, _ = fn["name"].(string)
+		}
+		if name != "" && !at.names[name] {
+			at.names[name] = true
+			at.order = append(at.order, name)
+		}
+	}
+	return at
+}
+
+// parseAllowedToolsRaw is parseAllowedTools for a raw JSON tool_choice.
+func parseAllowedToolsRaw(raw json.RawMessage) *allowedTools {
+	var v interface{}
+	if err := sonic.Unmarshal(raw, &v); err != nil {
+		return nil
+	}
+	return parseAllowedTools(v)
+}
+
+// openAIChoice returns the closest Chat Completions tool_choice once the
+// tools array has been pruned to keep (the number of tools left).
+func (a *allowedTools) openAIChoice(keep int) (interface{}, error) {
+	switch {
+	case keep == 0 && a.required:
+		return nil, a.errNoneDeclared()
+	case keep == 0:
+		return nil, nil
+	case a.required && keep == 1:
+		return OpenAIToolChoiceFunction{
+			Type:     "function",
+			Function: OpenAIToolChoiceFuncName{Name: a.order[0]},
+		}, nil
+	case a.required:
+		return "required", nil
+	default:
+		return "auto", nil
+	}
+}
+
+// anthropicChoice returns the closest Anthropic tool_choice once the tools
+// array has been pruned to keep tools.
+func (a *allowedTools) anthropicChoice(keep int) (json.RawMessage, error) {
+	var tc ToolChoiceObj
+	switch {
+	case keep == 0 && a.required:
+		return nil, a.errNoneDeclared()
+	case keep == 0:
+		return nil, nil
+	case a.required && keep == 1:
+		tc = ToolChoiceObj{Type: "tool", Name: a.order[0]}
+	case a.required:
+		tc = ToolChoiceObj{Type: "any"}
+	default:
+		tc = ToolChoiceObj{Type: "auto"}
+	}
+	raw, _ := sonic.Marshal(tc)
+	return json.RawMessage(raw), nil
+}
+
+// errNoneDeclared reports a required allowed_tools choice none of whose
+// tools is declared. Dropping the choice would let the model answer
+// without calling a tool.
+func (a *allowedTools) errNoneDeclared() error {
+	if len(a.names) == 0 {
+		return errors.New("tool_choice allowed_tools requires a tool call but lists no tools")
+	}
+	names := slices.Sorted(maps.Keys(a.names))
+	return fmt.Errorf("tool_choice allowed_tools requires a call to one of %s, but none of them is declared in tools", strings.Join(names, ", "))
+}
+
+// pruneOpenAITools keeps only the tools allowed by a. It also narrows a.order
+// to tools that were actually declared so a single-tool choice never names
+// an undeclared function.
+func (a *allowedTools) pruneOpenAITools(tools []OpenAITool) []OpenAITool {
+	var out []OpenAITool
+	declared := make(map[string]bool)
+	for _, t := range tools {
+		if a.names[t.Function.Name] {
+			out = append(out, t)
+			declared[t.Function.Name] = true
+		}
+	}
+	a.narrow(declared)
+	return out
+}
+
+// pruneAnthropicTools is pruneOpenAITools for Anthropic tool definitions.
+func (a *allowedTools) pruneAnthropicTools(tools []AnthropicTool) []AnthropicTool {
+	var out []AnthropicTool
+	declared := make(map[string]bool)
+	for _, t := range tools {
+		if a.names[t.Name] {
+			out = append(out, t)
+			declared[t.Name] = true
+		}
+	}
+	a.narrow(declared)
+	return out
+}
+
+func (a *allowedTools) narrow(declared map[string]bool) {
+	order := a.order[:0]
+	for _, name := range a.order {
+		if declared[name] {
+			order = append(order, name)
+		}
+	}
+	a.order = order
+}
@@ -0,0 +1,52 @@
+package translate
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAllowedToolsWithoutDeclaredTool(t *testing.T) {
+	const wantMsg = "one of lookup, search"
+
+	_, err := AnthropicRequestToOpenAI(&AnthropicRequest{
+		Model:      "claude-3-sonnet",
+		MaxTokens:  100,
+		Tools:      []AnthropicTool{{Name: "read", InputSchema: mustJSON(map[string]string{"type": "object"})}},
+		ToolChoice: json.RawMessage(`{"type":"allowed_tools","mode":"any","tools":[{"name":"search"},{"name":"lookup"}]}`),
+		Messages:   []AnthropicMessage{{Role: "user", Content: mustJSON("Hi")}},
+	})
+	if err == nil || !strings.Contains(err.Error(), wantMsg) {
+		t.Fatalf("anthropic: expected an error naming the allowed tools, got %v", err)
+	}
+
+	openAI := &OpenAIRequest{
+		Model:      "gpt-4o",
+		Messages:   []OpenAIMessage{{Role: "user", Content: "Hi"}},
+		Tools:      []OpenAITool{{Type: "function", Function: OpenAIFunctionDef{Name: "read"}}},
+		ToolChoice: map[string]interface{}{"type": "allowed_tools", "allowed_tools": map[string]interface{}{"mode": "required", "tools": []interface{}{map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "search"}}, map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "lookup"}}}}},
+	}
+	if _, err := OpenAIRequestToAnthropic(openAI); err == nil || !strings.Contains(err.Error(), wantMsg) {
+		t.Fatalf("openai: expected an error naming the allowed tools, got %v", err)
+	}
+
+	_, err = ResponsesRequestToChatCompletions(&ResponsesAPIRequest{
+		Model:      "gpt-4o",
+		Input:      []byte(`"hi"`),
+		Tools:      json.RawMessage(`[{"type":"function","name":"read","parameters":{"type":"object"}}]`),
+		ToolChoice: json.RawMessage(`{"type":"allowed_tools","mode":"required","tools":[{"type":"function","name":"search"},{"type":"function","name":"lookup"}]}`),
+	})
+	if err == nil || !strings.Contains(err.Error(), wantMsg) {
+		t.Fatalf("responses: expected an error naming the allowed tools, got %v", err)
+	}
+
+	// In auto mode the model may answer without a tool, so nothing is lost.
+	openAI.ToolChoice = map[string]interface{}{"type": "allowed_tools", "mode": "auto", "tools": []interface{}{map[string]interface{}{"type": "function", "name": "search"}}}
+	out, err := OpenAIRequestToAnthropic(openAI)
+	if err != nil {
+		t.Fatalf("auto: %v", err)
+	}
+	if len(out.Tools) != 0 || out.ToolChoice != nil {
+		t.Fatalf("auto: expected no tools and no tool_choice, got %+v %s", out.Tools, out.ToolChoice)
+	}
+}
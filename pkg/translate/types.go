@@ -25,6 +25,14 @@ type AnthropicRequest struct {
 	Stream        bool               `json:"stream,omitempty"`
 	Thinking      *ThinkingConfig    `json:"thinking,omitempty"`
 	Metadata      *Metadata          `json:"metadata,omitempty"`
+
+	// InterleavedThinking is set by the proxy when the client sends the
+	// interleaved-thinking beta. It is not part of the request body.
+	InterleavedThinking bool `json:"-"`
+
+	// SchemaChanges lists tool schema rewrites made while translating from
+	// OpenAI (see AnthropicToolSchema), for logging. Not sent upstream.
+	SchemaChanges []string `json:"-"`
 }
 
 // ThinkingConfig controls extended thinking behaviour.
@@ -33,9 +41,12 @@ type ThinkingConfig struct {
 	BudgetTokens int    `json:"budget_tokens,omitempty"`
 }
 
-// Metadata carries optional request metadata.
+// Metadata carries optional request metadata. Anthropic documents only
+// user_id; other keys clients send are kept in Extra, so that a MetadataMap
+// can carry them over to OpenAI.
 type Metadata struct {
-	UserID string `json:"user_id,omitempty"`
+	UserID string            `json:"user_id,omitempty"`
+	Extra  map[string]string `json:"-"`
 }
 
 // AnthropicMessage represents a single message in a conversation.
@@ -146,6 +157,22 @@ type AnthropicUsage struct {
 	OutputTokens             int `json:"output_tokens"`
 	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
 	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+
+	ServerToolUse *ServerToolUsage `json:"server_tool_use,omitempty"`
+}
+
+// ServerToolUsage counts the server tools Anthropic ran for a message; they
+// are billed per use on top of tokens.
+type ServerToolUsage struct {
+	WebSearchRequests int `json:"web_search_requests"`
+}
+
+// WebSearches returns the number of web searches run, or 0 when u is nil.
+func (u *ServerToolUsage) WebSearches() int {
+	if u == nil {
+		return 0
+	}
+	return u.WebSearchRequests
 }
 
 // ---------------------------------------------------------------------------
@@ -185,6 +212,9 @@ type DeltaBlock struct {
 type ContentBlockStopEvent struct {
 	Type  string `json:"type"`
 	Index int    `json:"index"`
+	// Repaired marks a tool_use block whose streamed input was cut off and
+	// closed by pxbin (not part of the Anthropic API).
+	Repaired bool `json:"pxbin_repaired,omitempty"`
 }
 
 // MessageDeltaEvent carries final metadata for the message.
@@ -202,8 +232,11 @@ type MessageDelta struct {
 
 // MessageDeltaUsage contains token counts at the end of streaming.
 type MessageDeltaUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens          int `json:"input_tokens"`
+	OutputTokens         int `json:"output_tokens"`
+	CacheReadInputTokens int `json:"cache_read_input_tokens,omitempty"`
+
+	ServerToolUse *ServerToolUsage `json:"server_tool_use,omitempty"`
 }
 
 // MessageStopEvent signals the end of a streamed message.
@@ -234,19 +267,23 @@ type AnthropicError struct {
 
 // OpenAIRequest represents an OpenAI /v1/chat/completions request.
 type OpenAIRequest struct {
-	Model               string          `json:"model"`
-	Messages            []OpenAIMessage `json:"messages"`
-	Tools               []OpenAITool    `json:"tools,omitempty"`
-	ToolChoice          interface{}     `json:"tool_choice,omitempty"`
-	MaxTokens           *int            `json:"max_tokens,omitempty"`
-	MaxCompletionTokens *int            `json:"max_completion_tokens,omitempty"`
-	Temperature         *float64        `json:"temperature,omitempty"`
-	TopP                *float64        `json:"top_p,omitempty"`
-	Stop                interface{}     `json:"stop,omitempty"`
-	Stream              bool            `json:"stream,omitempty"`
-	StreamOptions       *StreamOptions  `json:"stream_options,omitempty"`
-	User                string          `json:"user,omitempty"`
-	ReasoningEffort     string          `json:"reasoning_effort,omitempty"`
+	Model               string            `json:"model"`
+	Messages            []OpenAIMessage   `json:"messages"`
+	Tools               []OpenAITool      `json:"tools,omitempty"`
+	ToolChoice          interface{}       `json:"tool_choice,omitempty"`
+	ParallelToolCalls   *bool             `json:"parallel_tool_calls,omitempty"`
+	MaxTokens           *int              `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int              `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64          `json:"temperature,omitempty"`
+	TopP                *float64          `json:"top_p,omitempty"`
+	Stop                interface{}       `json:"stop,omitempty"`
+	Stream              bool              `json:"stream,omitempty"`
+	StreamOptions       *StreamOptions    `json:"stream_options,omitempty"`
+	User                string            `json:"user,omitempty"`
+	ReasoningEffort     string            `json:"reasoning_effort,omitempty"`
+	ResponseFormat      interface{}       `json:"response_format,omitempty"`
+	Metadata            map[string]string `json:"metadata,omitempty"`
+	Store               *bool             `json:"store,omitempty"`
 }
 
 // StreamOptions controls streaming behaviour for OpenAI requests.
@@ -261,6 +298,10 @@ type OpenAIMessage struct {
 	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string           `json:"tool_call_id,omitempty"`
 	Name       string           `json:"name,omitempty"`
+	// ReasoningContent carries reasoning for upstreams that expose it
+	// (DeepSeek, vLLM, OpenRouter). Only sent back upstream for
+	// interleaved thinking.
+	ReasoningContent string `json:"reasoning_content,omitempty"`
 }
 
 // OpenAIContentPart is a multimodal content part (text or image).
@@ -318,6 +359,8 @@ type OpenAIChoice struct {
 	Index        int           `json:"index"`
 	Message      OpenAIMessage `json:"message"`
 	FinishReason *string       `json:"finish_reason"`
+	StopReason   interface{}   `json:"stop_reason,omitempty"`  // vLLM: stop string or token that ended generation
+	MatchedStop  interface{}   `json:"matched_stop,omitempty"` // SGLang: same as vLLM's stop_reason
 }
 
 // OpenAIUsage contains token usage information for an OpenAI response.
@@ -326,24 +369,30 @@ type OpenAIUsage struct {
 	CompletionTokens    int                       `json:"completion_tokens"`
 	TotalTokens         int                       `json:"total_tokens"`
 	PromptTokensDetails *OpenAIPromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *OpenAICompletionTokensDetails `json:"completion_tokens_details,omitempty"`
 }
 
 type OpenAIPromptTokensDetails struct {
 	CachedTokens int `json:"cached_tokens,omitempty"`
 }
 
+type OpenAICompletionTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
+}
+
 // ---------------------------------------------------------------------------
 // OpenAI streaming types
 // ---------------------------------------------------------------------------
 
 // OpenAIStreamChunk is a single chunk in a streamed OpenAI response.
 type OpenAIStreamChunk struct {
-	ID      string               `json:"id"`
-	Object  string               `json:"object"`
-	Created int64                `json:"created"`
-	Model   string               `json:"model"`
-	Choices []OpenAIStreamChoice `json:"choices"`
-	Usage   *OpenAIUsage         `json:"usage,omitempty"`
+	ID                string               `json:"id"`
+	Object            string               `json:"object"`
+	Created           int64                `json:"created"`
+	Model             string               `json:"model"`
+	Choices           []OpenAIStreamChoice `json:"choices"`
+	Usage             *OpenAIUsage         `json:"usage,omitempty"`
+	SystemFingerprint string               `json:"system_fingerprint,omitempty"`
 }
 
 // OpenAIStreamChoice is a choice within a stream chunk.
@@ -351,6 +400,8 @@ type OpenAIStreamChoice struct {
 	Index        int               `json:"index"`
 	Delta        OpenAIStreamDelta `json:"delta"`
 	FinishReason *string           `json:"finish_reason"`
+	StopReason   interface{}       `json:"stop_reason,omitempty"`
+	MatchedStop  interface{}       `json:"matched_stop,omitempty"`
 }
 
 // OpenAIStreamDelta carries incremental content in a stream chunk.
@@ -0,0 +1,76 @@
+package translate
+
+import "encoding/json"
+
+// ---------------------------------------------------------------------------
+// OpenAI Embeddings API types (/v1/embeddings)
+// ---------------------------------------------------------------------------
+
+// OpenAIEmbeddingRequest is an embeddings request. Input is a string, an
+// array of strings, or token arrays.
+type OpenAIEmbeddingRequest struct {
+	Model          string      `json:"model"`
+	Input          interface{} `json:"input"`
+	EncodingFormat string      `json:"encoding_format,omitempty"` // "float" (default) or "base64"
+	Dimensions     *int        `json:"dimensions,omitempty"`
+	User           string      `json:"user,omitempty"`
+}
+
+// OpenAIEmbeddingResponse holds one embedding per input, by index.
+type OpenAIEmbeddingResponse struct {
+	Object string                `json:"object"`
+	Data   []OpenAIEmbedding     `json:"data"`
+	Model  string                `json:"model"`
+	Usage  *OpenAIEmbeddingUsage `json:"usage,omitempty"`
+}
+
+// OpenAIEmbedding is the embedding of one input: an array of floats, or a
+// base64 string of little-endian float32s with encoding_format "base64".
+type OpenAIEmbedding struct {
+	Object    string          `json:"object"`
+	Index     int             `json:"index"`
+	Embedding json.RawMessage `json:"embedding"`
+}
+
+// OpenAIEmbeddingUsage counts the input tokens; embeddings have no output
+// tokens.
+type OpenAIEmbeddingUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// ---------------------------------------------------------------------------
+// Google Gemini embedding types (/v1beta/models/{model}:embedContent and
+// :batchEmbedContents)
+// ---------------------------------------------------------------------------
+
+// GeminiEmbedContentRequest is an embedContent request, or one request of
+// a batchEmbedContents call, where it also names the model.
+type GeminiEmbedContentRequest struct {
+	Model                string        `json:"model,omitempty"`
+	Content              GeminiContent `json:"content"`
+	TaskType             string        `json:"taskType,omitempty"` // not translated
+	Title                string        `json:"title,omitempty"`    // not translated
+	OutputDimensionality *int          `json:"outputDimensionality,omitempty"`
+}
+
+// GeminiBatchEmbedContentsRequest embeds several contents in one call.
+type GeminiBatchEmbedContentsRequest struct {
+	Requests []GeminiEmbedContentRequest `json:"requests"`
+}
+
+// GeminiContentEmbedding is the embedding of one content.
+type GeminiContentEmbedding struct {
+	Values []float64 `json:"values"`
+}
+
+// GeminiEmbedContentResponse is the response to embedContent.
+type GeminiEmbedContentResponse struct {
+	Embedding GeminiContentEmbedding `json:"embedding"`
+}
+
+// GeminiBatchEmbedContentsResponse is the response to batchEmbedContents,
+// with embeddings in request order.
+type GeminiBatchEmbedContentsResponse struct {
+	Embeddings []GeminiContentEmbedding `json:"embeddings"`
+}
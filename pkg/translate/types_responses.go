@@ -17,6 +17,9 @@ type ResponsesAPIRequest struct {
 	Tools           json.RawMessage `json:"tools,omitempty"`
 	ToolChoice      json.RawMessage `json:"tool_choice,omitempty"`
 	Stream          bool            `json:"stream,omitempty"`
+	// N is not part of the Responses API, but clients used to Chat
+	// Completions send it; only a single choice can be translated.
+	N *int `json:"n,omitempty"`
 }
 
 // ResponsesAPIResponse is a non-streaming Responses API response.
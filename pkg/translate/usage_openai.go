@@ -30,3 +30,12 @@ func normalizeOpenAIUsage(usage *OpenAIUsage) (inputTokens, outputTokens, cacheR
 	inputTokens -= cacheReadTokens
 	return inputTokens, outputTokens, cacheReadTokens
 }
+
+// OpenAIReasoningTokens returns the reasoning tokens counted in usage's
+// completion tokens, or 0 if the upstream did not report them.
+func OpenAIReasoningTokens(usage *OpenAIUsage) int {
+	if usage == nil || usage.CompletionTokensDetails == nil {
+		return 0
+	}
+	return min(max(usage.CompletionTokensDetails.ReasoningTokens, 0), max(usage.CompletionTokens, 0))
+}
@@ -44,3 +44,16 @@ func TestNormalizeOpenAIUsage_CachedTokensClamped(t *testing.T) {
 		t.Fatalf("expected clamped (0,3,8), got (%d,%d,%d)", in, out, cache)
 	}
 }
+
+func TestOpenAIReasoningTokens(t *testing.T) {
+	if n := OpenAIReasoningTokens(nil); n != 0 {
+		t.Fatalf("expected 0 for no usage, got %d", n)
+	}
+	n := OpenAIReasoningTokens(&OpenAIUsage{
+		CompletionTokens:        50,
+		CompletionTokensDetails: &OpenAICompletionTokensDetails{ReasoningTokens: 30},
+	})
+	if n != 30 {
+		t.Fatalf("expected 30, got %d", n)
+	}
+}